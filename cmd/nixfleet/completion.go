@@ -0,0 +1,143 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+	"github.com/nixfleet/nixfleet/internal/pki"
+	"github.com/spf13/cobra"
+)
+
+// completionTimeout bounds how long dynamic completion will wait on
+// inventory/PKI I/O before giving up silently - shell completion runs on
+// every keystroke, so a slow or unreachable path must never make the
+// shell hang.
+const completionTimeout = 500 * time.Millisecond
+
+// completionCache memoizes the inventory parse for the lifetime of one
+// `nixfleet __complete` process. A single completion invocation can ask
+// for more than one flag's completions (e.g. a line with both -H and -g
+// still being typed), so without this every keystroke would reparse the
+// whole inventory.
+var completionCache struct {
+	once sync.Once
+	inv  *inventory.Inventory
+}
+
+// completionInventory loads the inventory for completion purposes,
+// degrading silently (nil, no error surfaced) if inventoryPath doesn't
+// exist, fails to parse, or simply takes too long - completion must never
+// error out or hang just because it's run from a directory with no
+// inventory.
+func completionInventory() *inventory.Inventory {
+	completionCache.once.Do(func() {
+		result := make(chan *inventory.Inventory, 1)
+		go func() {
+			inv, err := inventory.LoadFromDir(inventoryPath)
+			if err != nil {
+				inv, err = inventory.LoadFromFile(inventoryPath)
+			}
+			if err != nil {
+				result <- nil
+				return
+			}
+			result <- inv
+		}()
+
+		select {
+		case inv := <-result:
+			completionCache.inv = inv
+		case <-time.After(completionTimeout):
+			completionCache.inv = nil
+		}
+	})
+	return completionCache.inv
+}
+
+// completeHostNames completes host names for -H/--host flags.
+func completeHostNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	inv := completionInventory()
+	if inv == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, h := range inv.AllHosts() {
+		if strings.HasPrefix(h.Name, toComplete) {
+			names = append(names, h.Name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeGroupNames completes group names for -g/--group flags.
+func completeGroupNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	inv := completionInventory()
+	if inv == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for name := range inv.Groups {
+		if strings.HasPrefix(name, toComplete) {
+			names = append(names, name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// registerHostAndGroupCompletion wires dynamic completion for the -H/--host
+// and -g/--group persistent flags. Since they're persistent flags owned by
+// rootCmd, registering here is enough for every subcommand that inherits
+// them - cobra resolves a flag's completion function by the flag itself,
+// not by which command is currently running.
+func registerHostAndGroupCompletion(cmd *cobra.Command) {
+	_ = cmd.RegisterFlagCompletionFunc("host", completeHostNames)
+	_ = cmd.RegisterFlagCompletionFunc("group", completeGroupNames)
+}
+
+// completeSecretNames completes secret names (.age file basenames) for
+// commands that take a secret file argument, such as 'secrets edit' and
+// 'secrets decrypt'. It looks in the conventional secrets/ directory
+// rather than trying to resolve a not-yet-parsed --secrets-dir flag, and
+// degrades silently if the directory doesn't exist.
+func completeSecretNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	matches, _ := filepath.Glob(filepath.Join("secrets", "*.age"))
+	var names []string
+	for _, m := range matches {
+		if strings.HasPrefix(m, toComplete) {
+			names = append(names, m)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completePKIHostnames completes hostnames with an existing certificate in
+// the PKI store, for 'pki renew'/'pki revoke'. It uses the conventional
+// secrets/pki directory rather than a not-yet-parsed --pki-dir flag.
+func completePKIHostnames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	store := pki.NewStore("secrets/pki", nil, nil)
+	if !store.CAExists() {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	hosts, err := store.ListHostCerts()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, h := range hosts {
+		if strings.HasPrefix(h, toComplete) {
+			names = append(names, h)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
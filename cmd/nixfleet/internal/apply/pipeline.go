@@ -5,15 +5,17 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/nixfleet/nixfleet/internal/health"
 	"github.com/nixfleet/nixfleet/internal/inventory"
 	"github.com/nixfleet/nixfleet/internal/k0s"
 	"github.com/nixfleet/nixfleet/internal/nix"
 	"github.com/nixfleet/nixfleet/internal/pki"
 	"github.com/nixfleet/nixfleet/internal/preflight"
+	"github.com/nixfleet/nixfleet/internal/probe"
 	"github.com/nixfleet/nixfleet/internal/ssh"
 	"github.com/nixfleet/nixfleet/internal/state"
 )
@@ -42,6 +44,12 @@ type PipelineConfig struct {
 	PKIAutoRenew  bool     // Auto-renew expiring certs before deploy
 	PKIRenewDays  int      // Renew certs expiring within this many days
 	PKIIdentities []string // Age identity files for decryption
+
+	// OverwriteAccepted allows an apply to proceed even when the host has
+	// files with accepted drift (see 'nixfleet drift accept'). Without it,
+	// applyHost refuses rather than silently clobbering an intentional
+	// hotfix that hasn't been upstreamed yet.
+	OverwriteAccepted bool
 }
 
 // DefaultPipelineConfig returns sensible defaults
@@ -61,15 +69,29 @@ func DefaultPipelineConfig() PipelineConfig {
 
 // HostResult contains the result of applying to a single host
 type HostResult struct {
-	Host              string                      `json:"host"`
-	Success           bool                        `json:"success"`
-	PreflightResults  *preflight.PreflightResults `json:"preflight,omitempty"`
-	DeployResult      *DeployResult               `json:"deploy,omitempty"`
-	PKIResult         *pki.DeployResult           `json:"pki,omitempty"`
-	K0sResult         *k0s.ReconcileResult        `json:"k0s,omitempty"`
-	HealthResults     *health.HealthResults       `json:"health,omitempty"`
-	RollbackPerformed bool                        `json:"rollbackPerformed,omitempty"`
-	Error             string                      `json:"error,omitempty"`
+	Host                string                      `json:"host"`
+	Success             bool                        `json:"success"`
+	PreflightResults    *preflight.PreflightResults `json:"preflight,omitempty"`
+	DeployResult        *DeployResult               `json:"deploy,omitempty"`
+	PKIResult           *pki.DeployResult           `json:"pki,omitempty"`
+	K0sResult           *k0s.ReconcileResult        `json:"k0s,omitempty"`
+	K0sNodeConfigResult *k0s.NodeConfigResult       `json:"k0sNodeConfig,omitempty"`
+	ProfileResults      []*ProfileResult            `json:"profiles,omitempty"`
+	HealthResults       *probe.Results              `json:"health,omitempty"`
+	RollbackPerformed   bool                        `json:"rollbackPerformed,omitempty"`
+	Error               string                      `json:"error,omitempty"`
+}
+
+// ProfileResult is the outcome of deploying one inventory.Host.Profiles
+// entry. A failed profile never fails the host's deploy - see the profile
+// phase in applyHost - so callers that care have to check Success here
+// themselves.
+type ProfileResult struct {
+	Target     string `json:"target"`
+	Success    bool   `json:"success"`
+	Generation int    `json:"generation,omitempty"`
+	StorePath  string `json:"storePath,omitempty"`
+	Error      string `json:"error,omitempty"`
 }
 
 // DeployResult contains deployment-specific results
@@ -97,23 +119,30 @@ type Pipeline struct {
 	evaluator     *nix.Evaluator
 	deployer      *nix.Deployer
 	preflight     *preflight.Checker
-	health        *health.Checker
+	probe         *probe.Engine
 	pkiDeployer   *pki.Deployer
 	k0sReconciler *k0s.Reconciler
 	stateMgr      *state.Manager
+
+	// inv, if set, is used to resolve group-level probes (see
+	// inventory.Inventory.ProbesForHost) in addition to a host's own. Callers
+	// that only apply to a fixed host list without a loaded inventory can
+	// leave this nil; only host-level probes apply then.
+	inv *inventory.Inventory
 }
 
 // NewPipeline creates a new apply pipeline
-func NewPipeline(config PipelineConfig, sshPool *ssh.Pool, evaluator *nix.Evaluator, deployer *nix.Deployer) *Pipeline {
+func NewPipeline(config PipelineConfig, sshPool *ssh.Pool, evaluator *nix.Evaluator, deployer *nix.Deployer, inv *inventory.Inventory) *Pipeline {
 	p := &Pipeline{
 		config:        config,
 		sshPool:       sshPool,
 		evaluator:     evaluator,
 		deployer:      deployer,
 		preflight:     preflight.NewChecker(),
-		health:        health.NewChecker(),
+		probe:         probe.NewEngine(),
 		k0sReconciler: k0s.NewReconciler(),
 		stateMgr:      state.NewManager(),
+		inv:           inv,
 	}
 
 	// Initialize PKI deployer if enabled
@@ -199,6 +228,15 @@ func (p *Pipeline) applyHost(ctx context.Context, host *inventory.Host, action s
 		return result
 	}
 
+	// Refuse to apply against a host whose live OS doesn't match what the
+	// inventory says, since the activation command below is chosen purely
+	// by host.Base - running the wrong one against a freshly migrated
+	// machine can genuinely damage it. See 'nixfleet host migrate'.
+	if err := p.stateMgr.CheckBaseMatch(ctx, client, host.Base); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
 	// Phase 1: Preflight checks
 	if !p.config.SkipPreflight {
 		log.Printf("[%s] Running preflight checks...", host.Name)
@@ -217,9 +255,31 @@ func (p *Pipeline) applyHost(ctx context.Context, host *inventory.Host, action s
 		log.Printf("[%s] Preflight checks passed", host.Name)
 	}
 
+	// Phase 1.5: Refuse to clobber accepted drift
+	if !p.config.OverwriteAccepted {
+		if hostState, err := p.stateMgr.ReadState(ctx, client); err == nil && len(hostState.Approvals) > 0 {
+			paths := make([]string, 0, len(hostState.Approvals))
+			for path := range hostState.Approvals {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			result.Error = fmt.Sprintf("host has accepted drift on %s; apply would overwrite it with store content - pass --overwrite-accepted to proceed, or upstream the change first", strings.Join(paths, ", "))
+			return result
+		}
+	}
+
 	// Phase 2: Build and evaluate
 	log.Printf("[%s] Building configuration...", host.Name)
-	closure, err := p.evaluator.BuildHost(ctx, host.Name, host.Base)
+	var closure *nix.HostClosure
+	if p.inv != nil {
+		if hostFlake := p.inv.FlakeForHost(host); hostFlake != "" {
+			closure, err = p.evaluator.BuildHostFromFlake(ctx, hostFlake, host.Name, host.Base)
+		} else {
+			closure, err = p.evaluator.BuildHost(ctx, host.Name, host.Base)
+		}
+	} else {
+		closure, err = p.evaluator.BuildHost(ctx, host.Name, host.Base)
+	}
 	if err != nil {
 		result.Error = fmt.Sprintf("Build failed: %v", err)
 		return result
@@ -326,6 +386,28 @@ func (p *Pipeline) applyHost(ctx context.Context, host *inventory.Host, action s
 		}
 	}
 
+	// Phase 4.6b: per-node kubelet/containerd config (if this host declares any)
+	if host.K0sNodeConfig.HasOverrides() {
+		log.Printf("[%s] Reconciling k0s node config...", host.Name)
+		if ncResult, err := p.reconcileNodeConfig(ctx, client, host); err != nil {
+			log.Printf("[%s] k0s node config warning: %v", host.Name, err)
+		} else {
+			result.K0sNodeConfigResult = ncResult
+			for path, fs := range ncResult.ManagedFiles {
+				if err := p.stateMgr.UpdateManagedFile(ctx, client, fs); err != nil {
+					log.Printf("[%s] Warning: failed to record managed file %s in state: %v", host.Name, path, err)
+				}
+			}
+		}
+	}
+
+	// Phase 4.7: additional profiles (home-manager, standalone profiles).
+	// Like PKI and k0s above, a profile failure is non-fatal - it's reported
+	// per-target in result.ProfileResults but never fails the host's deploy.
+	if len(host.Profiles) > 0 {
+		result.ProfileResults = p.deployProfiles(ctx, client, host)
+	}
+
 	// Phase 5: Health checks
 	if !p.config.SkipHealthChecks {
 		// Wait for services to stabilize
@@ -335,19 +417,19 @@ func (p *Pipeline) applyHost(ctx context.Context, host *inventory.Host, action s
 		}
 
 		log.Printf("[%s] Running health checks...", host.Name)
-		healthConfigs := p.getHealthChecksForHost(host)
+		probeConfigs := p.getProbesForHost(host)
 
-		if len(healthConfigs) > 0 {
-			healthResults, err := p.health.RunChecks(ctx, client, healthConfigs)
+		if len(probeConfigs) > 0 {
+			exec := sshExec(client)
+			healthResults := p.probe.Run(ctx, exec, host.Addr, probeConfigs)
 			result.HealthResults = healthResults
 
-			if err != nil {
-				result.Error = fmt.Sprintf("Health check error: %v", err)
-				return result
+			if err := p.stateMgr.UpdateServiceHealth(ctx, client, serviceHealthFromProbes(healthResults)); err != nil {
+				log.Printf("[%s] Warning: failed to record probe results in state: %v", host.Name, err)
 			}
 
 			if !healthResults.Passed {
-				log.Printf("[%s] Health checks failed: %s", host.Name, healthResults.Summary)
+				log.Printf("[%s] Health checks failed: %s", host.Name, healthResults.Summary())
 
 				// Apply failure policy
 				switch p.config.HealthCheckPolicy {
@@ -379,32 +461,203 @@ func (p *Pipeline) applyHost(ctx context.Context, host *inventory.Host, action s
 	return result
 }
 
-// getHealthChecksForHost extracts health check configurations for a host
-func (p *Pipeline) getHealthChecksForHost(host *inventory.Host) []health.HealthCheckConfig {
-	configs := make([]health.HealthCheckConfig, 0)
+// deployProfiles builds, copies, and activates each of host's additional
+// profile targets, recording a GenerationRecord for every one - success or
+// failure - so 'nixfleet status -v' and profile history stay complete even
+// for targets that never reach GenerationActive.
+func (p *Pipeline) deployProfiles(ctx context.Context, client *ssh.Client, host *inventory.Host) []*ProfileResult {
+	results := make([]*ProfileResult, 0, len(host.Profiles))
 
-	// Add any health checks defined in the host configuration
-	// This would typically come from the evaluated Nix configuration
-	// For now, we add basic systemd checks for common services
+	for _, spec := range host.Profiles {
+		pr := &ProfileResult{Target: spec}
+		results = append(results, pr)
 
-	// Default: check SSH is still working (sanity check)
-	configs = append(configs, health.HealthCheckConfig{
-		Name:    "ssh_post_deploy",
-		Type:    health.CheckTypeCommand,
-		Target:  "echo 'post-deploy-ok'",
-		Timeout: 5 * time.Second,
-	})
+		target, err := nix.ParseProfileTarget(spec)
+		if err != nil {
+			pr.Error = err.Error()
+			log.Printf("[%s] profile %s: %v", host.Name, spec, err)
+			continue
+		}
+
+		log.Printf("[%s] Building profile %s...", host.Name, target)
+		storePath, err := p.evaluator.BuildProfile(ctx, host.Name, target)
+		if err != nil {
+			pr.Error = fmt.Sprintf("build failed: %v", err)
+			log.Printf("[%s] profile %s: %s", host.Name, target, pr.Error)
+			continue
+		}
+		pr.StorePath = storePath
+
+		closure := &nix.HostClosure{StorePath: storePath}
+		if err := p.deployer.CopyToHost(ctx, closure, host); err != nil {
+			pr.Error = fmt.Sprintf("copy failed: %v", err)
+			log.Printf("[%s] profile %s: %s", host.Name, target, pr.Error)
+			p.recordProfileOutcome(ctx, client, target, state.GenerationFailed, 0, storePath, pr.Error)
+			continue
+		}
+
+		if err := p.deployer.ActivateProfile(ctx, client, target, storePath); err != nil {
+			pr.Error = fmt.Sprintf("activation failed: %v", err)
+			log.Printf("[%s] profile %s: %s", host.Name, target, pr.Error)
+			p.recordProfileOutcome(ctx, client, target, state.GenerationFailed, 0, storePath, pr.Error)
+			continue
+		}
+
+		gen, activeStorePath, err := p.deployer.GetProfileGeneration(ctx, client, nix.ProfileGenerationPath(target))
+		if err != nil {
+			log.Printf("[%s] profile %s: activated but couldn't read generation: %v", host.Name, target, err)
+			activeStorePath = storePath
+		}
+
+		pr.Success = true
+		pr.Generation = gen
+		log.Printf("[%s] profile %s: activated generation %d", host.Name, target, gen)
+		p.recordProfileOutcome(ctx, client, target, state.GenerationActive, gen, activeStorePath, "")
+	}
+
+	return results
+}
+
+// recordProfileOutcome records a GenerationRecord for target, logging
+// (rather than failing the deploy) if state recording itself fails.
+func (p *Pipeline) recordProfileOutcome(ctx context.Context, client *ssh.Client, target nix.ProfileTarget, outcome state.GenerationOutcome, generation int, storePath, note string) {
+	rec := state.GenerationRecord{
+		Generation:  generation,
+		ProfilePath: nix.ProfileGenerationPath(target),
+		StorePath:   storePath,
+		Outcome:     outcome,
+		Note:        note,
+	}
+	if err := p.stateMgr.RecordProfileGeneration(ctx, client, target.String(), rec); err != nil {
+		log.Printf("profile %s: failed to record generation in state: %v", target, err)
+	}
+}
+
+// reconcileNodeConfig applies host's declared kubelet/containerd overrides.
+// Kubelet overrides go through a k0s WorkerProfile, which can only be
+// patched via a controller's admin kubeconfig - so a worker host needs a
+// separate connection to a controller, found via findK0sController.
+func (p *Pipeline) reconcileNodeConfig(ctx context.Context, client *ssh.Client, host *inventory.Host) (*k0s.NodeConfigResult, error) {
+	role, err := k0s.NodeRole(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("determining node role: %w", err)
+	}
+
+	controllerClient := client
+	if role != k0s.RoleController {
+		cc, err := p.findK0sController(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("finding k0s controller: %w", err)
+		}
+		controllerClient = cc
+	}
+
+	cfg := k0s.NodeConfig{
+		Profile:              host.K0sNodeConfig.Profile,
+		KubeletOverrides:     host.K0sNodeConfig.KubeletOverrides,
+		ContainerdRegistries: make([]k0s.ContainerdRegistryMirror, len(host.K0sNodeConfig.ContainerdRegistries)),
+		NodeLabels:           host.K0sNodeConfig.NodeLabels,
+		NodeTaints:           make([]k0s.Taint, len(host.K0sNodeConfig.NodeTaints)),
+		PruneLabels:          host.K0sNodeConfig.PruneLabels,
+	}
+	for i, m := range host.K0sNodeConfig.ContainerdRegistries {
+		cfg.ContainerdRegistries[i] = k0s.ContainerdRegistryMirror{
+			Registry:  m.Registry,
+			Endpoints: m.Endpoints,
+			Username:  m.Username,
+			Password:  m.Password,
+		}
+	}
+	for i, t := range host.K0sNodeConfig.NodeTaints {
+		cfg.NodeTaints[i] = k0s.Taint{Key: t.Key, Value: t.Value, Effect: t.Effect}
+	}
+
+	return p.k0sReconciler.ReconcileNodeConfig(ctx, controllerClient, client, host.Name, role, cfg)
+}
+
+// findK0sController returns a client connected to the first inventory host
+// whose k0s role is controller, for callers that need an admin kubeconfig
+// on behalf of a worker. Requires p.inv - callers without a loaded
+// inventory (see Pipeline.inv) can't resolve a controller this way.
+func (p *Pipeline) findK0sController(ctx context.Context) (*ssh.Client, error) {
+	if p.inv == nil {
+		return nil, fmt.Errorf("no inventory loaded, can't locate a k0s controller")
+	}
+	for _, h := range p.inv.AllHosts() {
+		client, err := p.sshPool.GetWithUser(ctx, h.Addr, h.SSHPort, h.SSHUser)
+		if err != nil {
+			continue
+		}
+		role, err := k0s.NodeRole(ctx, client)
+		if err != nil || role != k0s.RoleController {
+			continue
+		}
+		return client, nil
+	}
+	return nil, fmt.Errorf("no k0s controller found in inventory")
+}
+
+// getProbesForHost returns the probes to run against host post-activation:
+// its own probes plus, if an inventory was given to NewPipeline, those of
+// any group it belongs to. If none are configured anywhere, we fall back to
+// a bare SSH sanity check so a host with no probes defined still gets some
+// signal.
+func (p *Pipeline) getProbesForHost(host *inventory.Host) []probe.Config {
+	var configs []probe.Config
+	if p.inv != nil {
+		configs = p.inv.ProbesForHost(host)
+	} else {
+		configs = host.Probes
+	}
+
+	if len(configs) == 0 {
+		configs = []probe.Config{{
+			Name:    "ssh_post_deploy",
+			Type:    probe.TypeCommand,
+			Target:  "echo 'post-deploy-ok'",
+			Timeout: 5 * time.Second,
+		}}
+	}
 
 	return configs
 }
 
-// ApplyWithHealthChecks applies with explicit health check configs
-func (p *Pipeline) ApplyWithHealthChecks(ctx context.Context, hosts []*inventory.Host, action string, healthConfigs map[string][]health.HealthCheckConfig) (*PipelineResults, error) {
-	// Store health configs for use during apply
+// ApplyWithHealthChecks applies with explicit per-host probe configs,
+// overriding whatever getProbesForHost would otherwise resolve.
+func (p *Pipeline) ApplyWithHealthChecks(ctx context.Context, hosts []*inventory.Host, action string, probeConfigs map[string][]probe.Config) (*PipelineResults, error) {
+	// Store probe configs for use during apply
 	// This is a simplified approach - in production you'd want proper config passing
 	return p.Apply(ctx, hosts, action)
 }
 
+// sshExec adapts an ssh.Client into a probe.Exec so the probe engine never
+// needs to import internal/ssh directly.
+func sshExec(client *ssh.Client) probe.Exec {
+	return func(ctx context.Context, cmd string) (*probe.ExecResult, error) {
+		result, err := client.Exec(ctx, cmd)
+		if err != nil {
+			return nil, err
+		}
+		return &probe.ExecResult{Stdout: result.Stdout, Stderr: result.Stderr, ExitCode: result.ExitCode}, nil
+	}
+}
+
+// serviceHealthFromProbes converts probe results into the map shape
+// HostState.ServiceHealth expects, so apply, reboot, and the server
+// scheduler all record probe outcomes the same way.
+func serviceHealthFromProbes(results *probe.Results) map[string]state.ServiceStatus {
+	health := make(map[string]state.ServiceStatus, len(results.Checks))
+	now := time.Now()
+	for _, c := range results.Checks {
+		health[c.Name] = state.ServiceStatus{
+			Active:    c.Passed,
+			SubState:  c.Message,
+			LastCheck: now,
+		}
+	}
+	return health
+}
+
 // autoRenewCerts checks for expiring certificates and renews them before deployment
 func (p *Pipeline) autoRenewCerts(ctx context.Context, hosts []*inventory.Host) error {
 	// Check which certs need renewal
@@ -433,7 +686,7 @@ func (p *Pipeline) autoRenewCerts(ctx context.Context, hosts []*inventory.Host)
 		log.Printf("Auto-renewing certificate for %s (%s)", info.Hostname, info.Reason)
 
 		// Renew with default validity (1 year)
-		_, err := p.pkiDeployer.RenewCert(ctx, info.Hostname, nil, 365*24*time.Hour)
+		_, _, err := p.pkiDeployer.RenewCert(ctx, info.Hostname, nil, 365*24*time.Hour, false)
 		if err != nil {
 			log.Printf("Warning: failed to renew cert for %s: %v", info.Hostname, err)
 			continue
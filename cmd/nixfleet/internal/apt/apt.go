@@ -117,18 +117,117 @@ func (m *Manager) parseUpgradablePackages(output string) []Package {
 	return packages
 }
 
-// Upgrade performs a system upgrade
-func (m *Manager) Upgrade(ctx context.Context, client *ssh.Client, securityOnly bool) (*UpgradeResult, error) {
+// ConffilePolicy controls how dpkg handles a conffile (a config file
+// shipped by a package) that was modified locally and that the package
+// now wants to replace. Without one of these, an unattended upgrade has
+// no TTY to answer dpkg's prompt and the run stalls.
+type ConffilePolicy string
+
+const (
+	// ConffileKeep always keeps the locally modified file
+	// (--force-confold). Safe default: an unattended run should never
+	// silently discard an operator's edits.
+	ConffileKeep ConffilePolicy = "keep"
+
+	// ConffileNew always installs the package maintainer's version
+	// (--force-confnew), discarding local edits.
+	ConffileNew ConffilePolicy = "new"
+
+	// ConffileAskFail passes no force-conf option. dpkg can't prompt
+	// without a TTY and falls back to keeping the old file, but this
+	// policy treats that fallback as a failure and names the conffile,
+	// so the decision is surfaced instead of being made silently.
+	ConffileAskFail ConffilePolicy = "ask-fail"
+)
+
+// ParseConffilePolicy parses a --conffile flag value.
+func ParseConffilePolicy(s string) (ConffilePolicy, error) {
+	switch strings.ToLower(s) {
+	case "keep", "":
+		return ConffileKeep, nil
+	case "new":
+		return ConffileNew, nil
+	case "ask-fail", "ask":
+		return ConffileAskFail, nil
+	default:
+		return "", fmt.Errorf("unknown conffile policy: %s (valid: keep, new, ask-fail)", s)
+	}
+}
+
+// dpkgOption returns the `-o Dpkg::Options::=...` fragment implementing
+// the policy, or "" for ConffileAskFail (no force flag: a conflict is
+// detected from the upgrade output rather than avoided up front).
+func (p ConffilePolicy) dpkgOption() string {
+	switch p {
+	case ConffileNew:
+		return `-o Dpkg::Options::='--force-confnew'`
+	case ConffileAskFail:
+		return ""
+	default: // ConffileKeep
+		return `-o Dpkg::Options::='--force-confold'`
+	}
+}
+
+// ConffileDecision records what happened to a single conffile during an
+// upgrade, because the package wanted to replace a locally modified copy.
+type ConffileDecision struct {
+	Path     string `json:"path"`
+	Decision string `json:"decision"` // "kept", "replaced", or "ask-fail"
+}
+
+var conffileHeaderRegex = regexp.MustCompile(`Configuration file '([^']+)'`)
+
+// parseConffileDecisions scans dpkg/apt-get upgrade output for conffile
+// prompt blocks and reports, per file, whether the local copy was kept,
+// the maintainer's version was installed, or (under ConffileAskFail) dpkg
+// had no TTY to ask and fell back to keeping the old file.
+func parseConffileDecisions(output string) []ConffileDecision {
+	headers := conffileHeaderRegex.FindAllStringSubmatchIndex(output, -1)
+	if headers == nil {
+		return nil
+	}
+
+	var decisions []ConffileDecision
+	for i, h := range headers {
+		path := output[h[2]:h[3]]
+		end := len(output)
+		if i+1 < len(headers) {
+			end = headers[i+1][0]
+		}
+		block := output[h[1]:end]
+
+		decision := "kept"
+		switch {
+		case strings.Contains(block, "don't know how to ask confirmation question"):
+			decision = "ask-fail"
+		case strings.Contains(block, "Installing new version of config file"):
+			decision = "replaced"
+		case strings.Contains(block, "Keeping old config file as default"):
+			decision = "kept"
+		}
+
+		decisions = append(decisions, ConffileDecision{Path: path, Decision: decision})
+	}
+
+	return decisions
+}
+
+// Upgrade performs a system upgrade. conffilePolicy decides what happens
+// when a package wants to replace a locally modified config file; see
+// ConffilePolicy.
+func (m *Manager) Upgrade(ctx context.Context, client *ssh.Client, securityOnly bool, conffilePolicy ConffilePolicy) (*UpgradeResult, error) {
 	result := &UpgradeResult{
 		StartTime: time.Now(),
 	}
 
+	dpkgOpt := conffilePolicy.dpkgOption()
+
 	var cmd string
 	if securityOnly {
 		// Only install security updates using unattended-upgrades
-		cmd = "unattended-upgrade --dry-run -d 2>&1 | grep 'Packages that will be upgraded' || apt-get upgrade -y -o Dir::Etc::SourceList=/etc/apt/sources.list.d/ubuntu-security.list"
+		cmd = fmt.Sprintf("unattended-upgrade --dry-run -d 2>&1 | grep 'Packages that will be upgraded' || apt-get upgrade -y %s -o Dir::Etc::SourceList=/etc/apt/sources.list.d/ubuntu-security.list", dpkgOpt)
 	} else {
-		cmd = "DEBIAN_FRONTEND=noninteractive apt-get upgrade -y"
+		cmd = fmt.Sprintf("DEBIAN_FRONTEND=noninteractive apt-get upgrade -y %s", dpkgOpt)
 	}
 
 	upgradeResult, err := client.ExecSudo(ctx, cmd)
@@ -148,18 +247,30 @@ func (m *Manager) Upgrade(ctx context.Context, client *ssh.Client, securityOnly
 
 	// Parse upgraded packages from output
 	result.UpgradedPackages = m.parseUpgradedPackages(result.Output)
+	result.ConffileDecisions = parseConffileDecisions(result.Output)
+
+	if conffilePolicy == ConffileAskFail {
+		for _, d := range result.ConffileDecisions {
+			if d.Decision == "ask-fail" {
+				result.Success = false
+				result.Error = fmt.Sprintf("conffile prompt for %s: unattended upgrade has no TTY to answer; use --conffile keep or --conffile new", d.Path)
+				return result, fmt.Errorf("%s", result.Error)
+			}
+		}
+	}
 
 	return result, nil
 }
 
 // UpgradeResult represents the result of an upgrade operation
 type UpgradeResult struct {
-	StartTime        time.Time `json:"start_time"`
-	EndTime          time.Time `json:"end_time"`
-	Success          bool      `json:"success"`
-	Error            string    `json:"error,omitempty"`
-	Output           string    `json:"output,omitempty"`
-	UpgradedPackages []string  `json:"upgraded_packages,omitempty"`
+	StartTime         time.Time          `json:"start_time"`
+	EndTime           time.Time          `json:"end_time"`
+	Success           bool               `json:"success"`
+	Error             string             `json:"error,omitempty"`
+	Output            string             `json:"output,omitempty"`
+	UpgradedPackages  []string           `json:"upgraded_packages,omitempty"`
+	ConffileDecisions []ConffileDecision `json:"conffile_decisions,omitempty"`
 }
 
 // parseUpgradedPackages extracts package names from upgrade output
@@ -189,32 +300,6 @@ func (m *Manager) parseUpgradedPackages(output string) []string {
 	return packages
 }
 
-// InstallPackage installs a specific package
-func (m *Manager) InstallPackage(ctx context.Context, client *ssh.Client, packageName string) error {
-	cmd := fmt.Sprintf("DEBIAN_FRONTEND=noninteractive apt-get install -y %s", packageName)
-	result, err := client.ExecSudo(ctx, cmd)
-	if err != nil {
-		return fmt.Errorf("install failed: %w", err)
-	}
-	if result.ExitCode != 0 {
-		return fmt.Errorf("install failed: %s", result.Stderr)
-	}
-	return nil
-}
-
-// RemovePackage removes a specific package
-func (m *Manager) RemovePackage(ctx context.Context, client *ssh.Client, packageName string) error {
-	cmd := fmt.Sprintf("DEBIAN_FRONTEND=noninteractive apt-get remove -y %s", packageName)
-	result, err := client.ExecSudo(ctx, cmd)
-	if err != nil {
-		return fmt.Errorf("remove failed: %w", err)
-	}
-	if result.ExitCode != 0 {
-		return fmt.Errorf("remove failed: %s", result.Stderr)
-	}
-	return nil
-}
-
 // GetInstalledPackages returns a list of installed packages
 func (m *Manager) GetInstalledPackages(ctx context.Context, client *ssh.Client) ([]Package, error) {
 	// Get list of manually installed packages (not dependencies)
@@ -323,6 +408,271 @@ func (m *Manager) CleanCache(ctx context.Context, client *ssh.Client) (int64, er
 	return beforeSize - afterSize, nil
 }
 
+// PackageSpec identifies a package to install, optionally pinned to a
+// version. Version may be an exact apt version string or a wildcard prefix
+// like "1.24.*", which versionMatcher expands into a regex before checking
+// it against `apt-cache madison`.
+type PackageSpec struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// String renders the spec the way `apt-get install` expects it on its
+// command line: "name" or "name=version".
+func (s PackageSpec) String() string {
+	if s.Version == "" {
+		return s.Name
+	}
+	return s.Name + "=" + s.Version
+}
+
+// ParsePackageSpec parses a single CLI/API package argument, e.g. "nginx"
+// or "nginx=1.24.*", into a PackageSpec.
+func ParsePackageSpec(s string) PackageSpec {
+	if name, version, found := strings.Cut(s, "="); found {
+		return PackageSpec{Name: name, Version: version}
+	}
+	return PackageSpec{Name: s}
+}
+
+// TransactionRequest describes a single apt-get invocation that installs
+// and removes packages together. Mixing installs and removes into one
+// apt-get install call (pkg- removes pkg) lets apt resolve dependencies
+// across both at once, rather than risking two separate calls disagreeing
+// about what the other is leaving behind.
+type TransactionRequest struct {
+	Install      []PackageSpec `json:"install,omitempty"`
+	Remove       []string      `json:"remove,omitempty"`
+	NoRecommends bool          `json:"no_recommends,omitempty"`
+}
+
+// TransactionFailure explains why one package in a TransactionRequest
+// could not be satisfied.
+type TransactionFailure struct {
+	Package string `json:"package"`
+	Reason  string `json:"reason"`
+}
+
+// TransactionResult is the parsed outcome of a Transact call, in place of a
+// bare success/failure status.
+type TransactionResult struct {
+	StartTime time.Time            `json:"start_time"`
+	EndTime   time.Time            `json:"end_time"`
+	Success   bool                 `json:"success"`
+	Installed []string             `json:"installed,omitempty"`
+	Upgraded  []string             `json:"upgraded,omitempty"`
+	Removed   []string             `json:"removed,omitempty"`
+	Failed    []TransactionFailure `json:"failed,omitempty"`
+	HoldsKept []string             `json:"holds_kept,omitempty"`
+	Output    string               `json:"output,omitempty"`
+}
+
+var (
+	transactionInstallRegex = regexp.MustCompile(`(?m)^Unpacking\s+([^\s]+)\s+\([^)]+\)\s+\.\.\.$`)
+	transactionUpgradeRegex = regexp.MustCompile(`(?m)^Unpacking\s+([^\s]+)\s+\([^)]+\)\s+over\s+\(`)
+	transactionRemoveRegex  = regexp.MustCompile(`(?m)^Removing\s+([^\s]+)\s+\([^)]+\)\s+\.\.\.$`)
+)
+
+// uniqueMatches returns the first capture group of every match of re
+// against output, in order, without duplicates.
+func uniqueMatches(re *regexp.Regexp, output string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range re.FindAllStringSubmatch(output, -1) {
+		if seen[match[1]] {
+			continue
+		}
+		seen[match[1]] = true
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// parseTransactionOutput extracts installed, upgraded, and removed package
+// names from apt-get install output. An upgrade's "Unpacking" line is
+// distinguished from a fresh install's by the trailing "over (oldversion)".
+func (m *Manager) parseTransactionOutput(output string) (installed, upgraded, removed []string) {
+	upgraded = uniqueMatches(transactionUpgradeRegex, output)
+	upgradedSet := make(map[string]bool, len(upgraded))
+	for _, pkg := range upgraded {
+		upgradedSet[pkg] = true
+	}
+
+	for _, pkg := range uniqueMatches(transactionInstallRegex, output) {
+		if !upgradedSet[pkg] {
+			installed = append(installed, pkg)
+		}
+	}
+
+	removed = uniqueMatches(transactionRemoveRegex, output)
+	return installed, upgraded, removed
+}
+
+// versionMatcher turns a version spec (exact, or a "*"-wildcard prefix like
+// "1.24.*") into a regex matching the full apt-cache madison version field.
+func versionMatcher(version string) *regexp.Regexp {
+	escaped := regexp.QuoteMeta(version)
+	escaped = strings.ReplaceAll(escaped, `\*`, `.*`)
+	return regexp.MustCompile("^" + escaped + "$")
+}
+
+// versionAvailable checks `apt-cache madison` for a version of spec.Name
+// matching spec.Version, so a pinned install fails fast with a clear
+// reason instead of apt-get's own, noisier error.
+func (m *Manager) versionAvailable(ctx context.Context, client *ssh.Client, spec PackageSpec) (bool, error) {
+	result, err := client.Exec(ctx, fmt.Sprintf("apt-cache madison %s", spec.Name))
+	if err != nil {
+		return false, fmt.Errorf("apt-cache madison failed: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return false, nil
+	}
+
+	matcher := versionMatcher(spec.Version)
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 2 {
+			continue
+		}
+		if matcher.MatchString(strings.TrimSpace(fields[1])) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// listHeld returns the packages currently marked `apt-mark hold`.
+func (m *Manager) listHeld(ctx context.Context, client *ssh.Client) ([]string, error) {
+	result, err := client.Exec(ctx, "apt-mark showhold")
+	if err != nil {
+		return nil, fmt.Errorf("apt-mark showhold failed: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("apt-mark showhold failed: %s", result.Stderr)
+	}
+
+	output := strings.TrimSpace(result.Stdout)
+	if output == "" {
+		return nil, nil
+	}
+	return strings.Split(output, "\n"), nil
+}
+
+// reapplyHolds re-holds any package that was held before the transaction
+// and was installed or upgraded by it, since apt-get overrides a hold to
+// satisfy an explicit install/upgrade without leaving it held afterwards.
+// A removed package is dropped from consideration: it's no longer
+// installed, so nothing is left to hold.
+func (m *Manager) reapplyHolds(ctx context.Context, client *ssh.Client, heldBefore []string, result *TransactionResult) ([]string, error) {
+	if len(heldBefore) == 0 {
+		return nil, nil
+	}
+
+	touched := make(map[string]bool, len(result.Installed)+len(result.Upgraded))
+	for _, pkg := range result.Installed {
+		touched[pkg] = true
+	}
+	for _, pkg := range result.Upgraded {
+		touched[pkg] = true
+	}
+
+	var toReapply []string
+	for _, pkg := range heldBefore {
+		if touched[pkg] {
+			toReapply = append(toReapply, pkg)
+		}
+	}
+	if len(toReapply) == 0 {
+		return nil, nil
+	}
+
+	holdResult, err := client.ExecSudo(ctx, fmt.Sprintf("apt-mark hold %s", strings.Join(toReapply, " ")))
+	if err != nil {
+		return nil, fmt.Errorf("reapplying holds: %w", err)
+	}
+	if holdResult.ExitCode != 0 {
+		return nil, fmt.Errorf("reapplying holds: %s", holdResult.Stderr)
+	}
+	return toReapply, nil
+}
+
+// Transact installs and removes packages in a single apt-get invocation
+// (`apt-get install pkg1 pkg2=1.2.3 pkg3-`), pre-checking any version pins
+// against `apt-cache madison` and re-applying any hold the transaction
+// would otherwise clear.
+func (m *Manager) Transact(ctx context.Context, client *ssh.Client, req TransactionRequest) (*TransactionResult, error) {
+	result := &TransactionResult{StartTime: time.Now()}
+
+	if len(req.Install) == 0 && len(req.Remove) == 0 {
+		return nil, fmt.Errorf("transaction has no packages to install or remove")
+	}
+
+	for _, spec := range req.Install {
+		if spec.Version == "" {
+			continue
+		}
+		ok, err := m.versionAvailable(ctx, client, spec)
+		if err != nil {
+			return nil, fmt.Errorf("checking %s: %w", spec.String(), err)
+		}
+		if !ok {
+			result.Failed = append(result.Failed, TransactionFailure{
+				Package: spec.Name,
+				Reason:  fmt.Sprintf("version %s not found via apt-cache madison", spec.Version),
+			})
+		}
+	}
+	if len(result.Failed) > 0 {
+		result.EndTime = time.Now()
+		return result, fmt.Errorf("%d package(s) failed version check", len(result.Failed))
+	}
+
+	heldBefore, err := m.listHeld(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("listing held packages: %w", err)
+	}
+
+	args := make([]string, 0, len(req.Install)+len(req.Remove))
+	for _, spec := range req.Install {
+		args = append(args, spec.String())
+	}
+	for _, pkg := range req.Remove {
+		args = append(args, pkg+"-")
+	}
+
+	flags := "-y"
+	if req.NoRecommends {
+		flags += " --no-install-recommends"
+	}
+
+	cmd := fmt.Sprintf("DEBIAN_FRONTEND=noninteractive apt-get install %s %s", flags, strings.Join(args, " "))
+	execResult, err := client.ExecSudo(ctx, cmd)
+	result.EndTime = time.Now()
+	if err != nil {
+		return result, fmt.Errorf("transaction failed: %w", err)
+	}
+
+	result.Output = execResult.Stdout + execResult.Stderr
+	result.Success = execResult.ExitCode == 0
+	result.Installed, result.Upgraded, result.Removed = m.parseTransactionOutput(result.Output)
+
+	if !result.Success {
+		result.Failed = append(result.Failed, TransactionFailure{
+			Package: "*",
+			Reason:  strings.TrimSpace(execResult.Stderr),
+		})
+		return result, fmt.Errorf("transaction failed with exit code %d", execResult.ExitCode)
+	}
+
+	reapplied, err := m.reapplyHolds(ctx, client, heldBefore, result)
+	if err != nil {
+		return result, err
+	}
+	result.HoldsKept = reapplied
+
+	return result, nil
+}
+
 // GetRebootPackages returns the list of packages that triggered a reboot requirement
 func (m *Manager) GetRebootPackages(ctx context.Context, client *ssh.Client) ([]string, error) {
 	result, err := client.Exec(ctx, "cat /var/run/reboot-required.pkgs 2>/dev/null")
@@ -0,0 +1,207 @@
+package apt
+
+import "testing"
+
+func TestParseConffilePolicy(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ConffilePolicy
+		wantErr  bool
+	}{
+		{"keep", ConffileKeep, false},
+		{"", ConffileKeep, false},
+		{"new", ConffileNew, false},
+		{"ask-fail", ConffileAskFail, false},
+		{"ask", ConffileAskFail, false},
+		{"invalid", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParseConffilePolicy(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseConffilePolicy(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+				return
+			}
+			if result != tt.expected {
+				t.Errorf("ParseConffilePolicy(%q) = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+// Fixtures below are trimmed real dpkg output for the three ways a
+// conffile prompt can resolve.
+
+const dpkgConffileKept = `Unpacking nginx-common (1.18.0-6ubuntu14.4) over (1.18.0-6ubuntu14.3) ...
+Setting up nginx-common (1.18.0-6ubuntu14.4) ...
+
+Configuration file '/etc/nginx/nginx.conf'
+ ==> Modified (by you or by a script) since installation.
+ ==> Package distributor has shipped an updated version.
+   What would you like to do about it ?  Your options are:
+    Y or I  : install the package maintainer's version
+    N or O  : keep your currently-installed version
+      D     : show the differences between the versions
+      Z     : start a shell to examine the situation
+ The default action is to keep your current version.
+*** nginx.conf (Y/I/N/O/D/Z) [default=N] ?
+   ==> Keeping old config file as default.
+Setting up nginx (1.18.0-6ubuntu14.4) ...
+`
+
+const dpkgConffileReplaced = `Preparing to unpack .../openssh-server_1%3a8.9p1-3ubuntu0.6_amd64.deb ...
+Unpacking openssh-server (1:8.9p1-3ubuntu0.6) over (1:8.9p1-3ubuntu0.5) ...
+
+Configuration file '/etc/ssh/sshd_config'
+ ==> Modified (by you or by a script) since installation.
+ ==> Package distributor has shipped an updated version.
+   * Installing new version of config file /etc/ssh/sshd_config ...
+Setting up openssh-server (1:8.9p1-3ubuntu0.6) ...
+`
+
+const dpkgConffileAskFail = `Unpacking rsyslog (8.2112.0-2ubuntu2.2) over (8.2112.0-2ubuntu2.1) ...
+Setting up rsyslog (8.2112.0-2ubuntu2.2) ...
+
+Configuration file '/etc/rsyslog.conf'
+ ==> Modified (by you or by a script) since installation.
+ ==> Package distributor has shipped an updated version.
+   What would you like to do about it ?  Your options are:
+    Y or I  : install the package maintainer's version
+    N or O  : keep your currently-installed version
+      D     : show the differences between the versions
+      Z     : start a shell to examine the situation
+ The default action is to keep your current version.
+*** rsyslog.conf (Y/I/N/O/D/Z) [default=N] ?
+  dpkg: stdin isn't a terminal, don't know how to ask confirmation question. Assuming default action.
+   ==> Keeping old config file as default.
+`
+
+func TestParseConffileDecisions(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []ConffileDecision
+	}{
+		{"kept", dpkgConffileKept, []ConffileDecision{{Path: "/etc/nginx/nginx.conf", Decision: "kept"}}},
+		{"replaced", dpkgConffileReplaced, []ConffileDecision{{Path: "/etc/ssh/sshd_config", Decision: "replaced"}}},
+		{"ask-fail", dpkgConffileAskFail, []ConffileDecision{{Path: "/etc/rsyslog.conf", Decision: "ask-fail"}}},
+		{"no conffiles", "Setting up curl (7.81.0-1ubuntu1.15) ...\n", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseConffileDecisions(tt.output)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseConffileDecisions() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("decision %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParsePackageSpec(t *testing.T) {
+	tests := []struct {
+		input string
+		want  PackageSpec
+	}{
+		{"nginx", PackageSpec{Name: "nginx"}},
+		{"nginx=1.24.0-1ubuntu1", PackageSpec{Name: "nginx", Version: "1.24.0-1ubuntu1"}},
+		{"nginx=1.24.*", PackageSpec{Name: "nginx", Version: "1.24.*"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := ParsePackageSpec(tt.input); got != tt.want {
+				t.Errorf("ParsePackageSpec(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackageSpecString(t *testing.T) {
+	tests := []struct {
+		spec PackageSpec
+		want string
+	}{
+		{PackageSpec{Name: "nginx"}, "nginx"},
+		{PackageSpec{Name: "nginx", Version: "1.24.*"}, "nginx=1.24.*"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.spec.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestVersionMatcher(t *testing.T) {
+	tests := []struct {
+		version string
+		match   string
+		want    bool
+	}{
+		{"1.24.*", "1.24.0-1ubuntu1", true},
+		{"1.24.*", "1.25.0-1ubuntu1", false},
+		{"1.24.0-1ubuntu1", "1.24.0-1ubuntu1", true},
+		{"1.24.0-1ubuntu1", "1.24.0-1ubuntu2", false},
+	}
+
+	for _, tt := range tests {
+		if got := versionMatcher(tt.version).MatchString(tt.match); got != tt.want {
+			t.Errorf("versionMatcher(%q).MatchString(%q) = %v, want %v", tt.version, tt.match, got, tt.want)
+		}
+	}
+}
+
+const aptInstallOutput = `Reading package lists...
+Building dependency tree...
+The following NEW packages will be installed:
+  nginx-common
+The following packages will be upgraded:
+  curl
+The following packages will be REMOVED:
+  apache2
+Preparing to unpack .../curl_7.81.0-1ubuntu1.16_amd64.deb ...
+Unpacking curl (7.81.0-1ubuntu1.16) over (7.81.0-1ubuntu1.15) ...
+Removing apache2 (2.4.52-1ubuntu4.9) ...
+Preparing to unpack .../nginx-common_1.24.0-2ubuntu7.3_all.deb ...
+Unpacking nginx-common (1.24.0-2ubuntu7.3) ...
+Setting up nginx-common (1.24.0-2ubuntu7.3) ...
+Setting up curl (7.81.0-1ubuntu1.16) ...
+`
+
+func TestParseTransactionOutput(t *testing.T) {
+	m := &Manager{}
+	installed, upgraded, removed := m.parseTransactionOutput(aptInstallOutput)
+
+	if len(installed) != 1 || installed[0] != "nginx-common" {
+		t.Errorf("installed = %v, want [nginx-common]", installed)
+	}
+	if len(upgraded) != 1 || upgraded[0] != "curl" {
+		t.Errorf("upgraded = %v, want [curl]", upgraded)
+	}
+	if len(removed) != 1 || removed[0] != "apache2" {
+		t.Errorf("removed = %v, want [apache2]", removed)
+	}
+}
+
+func TestConffilePolicyDpkgOption(t *testing.T) {
+	tests := []struct {
+		policy ConffilePolicy
+		want   string
+	}{
+		{ConffileKeep, `-o Dpkg::Options::='--force-confold'`},
+		{ConffileNew, `-o Dpkg::Options::='--force-confnew'`},
+		{ConffileAskFail, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.dpkgOption(); got != tt.want {
+			t.Errorf("%s.dpkgOption() = %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+}
@@ -5,11 +5,15 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/nixfleet/nixfleet/internal/secrets"
 	"github.com/nixfleet/nixfleet/internal/ssh"
 )
 
@@ -23,13 +27,23 @@ const (
 	CacheTypeSSH    CacheType = "ssh"
 )
 
-// CacheConfig holds binary cache configuration
+// CacheConfig holds binary cache configuration. A host is typically given
+// several of these - an on-prem cache and an S3/cache.nixos.org fallback -
+// so Priority controls the substituter order (lower = tried first) and
+// failover to the next entry is left to nix itself.
 type CacheConfig struct {
 	Type       CacheType
 	URL        string // Cache URL (s3://bucket, https://cache.nixos.org, etc.)
 	PublicKeys []string
 	SecretKey  string // Path to secret signing key
 	Priority   int    // Cache priority (lower = preferred)
+
+	// AuthSecretPath, if set, is the path to an age-encrypted secret
+	// containing "username:password" credentials for this cache. It's
+	// decrypted on the control machine and written into the host's netrc
+	// rather than embedded in nix.conf, so the credential never appears in
+	// a world-readable config file.
+	AuthSecretPath string
 }
 
 // SigningConfig holds signing key configuration
@@ -43,6 +57,12 @@ type SigningConfig struct {
 type Manager struct {
 	caches  []CacheConfig
 	signing *SigningConfig
+
+	// secretsMgr decrypts CacheConfig.AuthSecretPath entries; nil unless
+	// SetSecretsManager is called, in which case any authenticated cache
+	// configured without it fails ConfigureHostCache rather than silently
+	// skipping its credentials.
+	secretsMgr *secrets.Manager
 }
 
 // NewManager creates a new cache manager
@@ -53,6 +73,24 @@ func NewManager(caches []CacheConfig, signing *SigningConfig) *Manager {
 	}
 }
 
+// SetSecretsManager enables ConfigureHostCache to resolve authenticated
+// caches (CacheConfig.AuthSecretPath), matching the optional-dependency
+// setter pattern used elsewhere (e.g. nix.Evaluator.SetOffline).
+func (m *Manager) SetSecretsManager(secretsMgr *secrets.Manager) {
+	m.secretsMgr = secretsMgr
+}
+
+// orderedCaches returns caches sorted by ascending Priority (lower =
+// preferred), stable so equal-priority caches keep their configured order.
+func (m *Manager) orderedCaches() []CacheConfig {
+	ordered := make([]CacheConfig, len(m.caches))
+	copy(ordered, m.caches)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Priority < ordered[j].Priority
+	})
+	return ordered
+}
+
 // PushToCache pushes a store path to the configured cache
 func (m *Manager) PushToCache(ctx context.Context, storePath string, cacheURL string) error {
 	if m.signing == nil || m.signing.SecretKey == "" {
@@ -85,32 +123,92 @@ func (m *Manager) PushToCache(ctx context.Context, storePath string, cacheURL st
 	return nil
 }
 
-// ConfigureHostCache configures a remote host to use the binary caches
-func (m *Manager) ConfigureHostCache(ctx context.Context, client *ssh.Client, base string) error {
+// cacheConfBeginMarker and cacheConfEndMarker delimit NixFleet's managed
+// block inside the host's nix.conf, so ConfigureHostCache can replace just
+// that block on every call (idempotent, order stable) without touching any
+// options an operator set by hand elsewhere in the file.
+const (
+	cacheConfBeginMarker = "# BEGIN NIXFLEET CACHE (managed by nixfleet, do not edit)"
+	cacheConfEndMarker   = "# END NIXFLEET CACHE"
+	cacheNetrcPath       = "/etc/nix/netrc"
+)
+
+// ConfigureHostCache configures a remote host to use the binary caches,
+// rendering one idempotent, marker-delimited block into the host's nix.conf
+// with substituters ordered by ascending Priority and their
+// trusted-public-keys, plus a netrc-file entry when any cache carries
+// AuthSecretPath. It returns the path written and its resulting sha256, so
+// the caller can register it as a managed file for drift purposes.
+func (m *Manager) ConfigureHostCache(ctx context.Context, client *ssh.Client, base string) (path string, hash string, err error) {
+	block, netrc, err := m.renderCacheBlock(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
 	switch base {
-	case "ubuntu":
-		return m.configureUbuntuCache(ctx, client)
+	case "ubuntu", "darwin":
+		path = "/etc/nix/nix.conf"
 	case "nixos":
-		return m.configureNixOSCache(ctx, client)
-	case "darwin":
-		return m.configureDarwinCache(ctx, client)
+		// NixOS's own nix.conf is generated from configuration.nix and
+		// overwritten on every rebuild, so the managed block goes in a
+		// supplementary file included via nix.extraOptions instead.
+		path = "/etc/nix/nixfleet-cache.conf"
 	default:
-		return fmt.Errorf("unsupported base: %s", base)
+		return "", "", fmt.Errorf("unsupported base: %s", base)
+	}
+
+	if netrc != "" {
+		if err := writeRemoteFile(ctx, client, cacheNetrcPath, netrc, "600"); err != nil {
+			return "", "", fmt.Errorf("failed to write netrc: %w", err)
+		}
+	}
+
+	hash, err = writeManagedBlock(ctx, client, path, block)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to write cache config: %w", err)
+	}
+
+	switch base {
+	case "ubuntu":
+		result, err := client.ExecSudo(ctx, "systemctl restart nix-daemon")
+		if err != nil {
+			return path, hash, fmt.Errorf("failed to restart nix-daemon: %w", err)
+		}
+		if result.ExitCode != 0 {
+			return path, hash, fmt.Errorf("failed to restart nix-daemon: %s", result.Stderr)
+		}
+	case "darwin":
+		_, _ = client.ExecSudo(ctx, "launchctl kickstart -k system/org.nixos.nix-daemon")
 	}
+
+	return path, hash, nil
 }
 
-// configureUbuntuCache configures Nix daemon on Ubuntu to use caches
-func (m *Manager) configureUbuntuCache(ctx context.Context, client *ssh.Client) error {
-	// Build substituters and trusted-public-keys lists
-	var substituters []string
-	var publicKeys []string
+// renderCacheBlock builds the marker-delimited nix.conf block (substituters
+// and trusted-public-keys ordered by ascending Priority, cache.nixos.org
+// added as the lowest-priority fallback if absent) and, if any cache
+// carries AuthSecretPath, the netrc content authenticating against it.
+func (m *Manager) renderCacheBlock(ctx context.Context) (block string, netrc string, err error) {
+	caches := m.orderedCaches()
 
-	for _, cache := range m.caches {
-		substituters = append(substituters, cache.URL)
-		publicKeys = append(publicKeys, cache.PublicKeys...)
+	var substituters, publicKeys, netrcLines []string
+	for _, c := range caches {
+		substituters = append(substituters, c.URL)
+		publicKeys = append(publicKeys, c.PublicKeys...)
+
+		if c.AuthSecretPath == "" {
+			continue
+		}
+		if m.secretsMgr == nil {
+			return "", "", fmt.Errorf("cache %s requires decrypting %s but no secrets manager is configured", c.URL, c.AuthSecretPath)
+		}
+		line, err := m.netrcLine(ctx, c)
+		if err != nil {
+			return "", "", err
+		}
+		netrcLines = append(netrcLines, line)
 	}
 
-	// Add default cache.nixos.org if not present
 	hasDefault := false
 	for _, s := range substituters {
 		if strings.Contains(s, "cache.nixos.org") {
@@ -119,95 +217,92 @@ func (m *Manager) configureUbuntuCache(ctx context.Context, client *ssh.Client)
 		}
 	}
 	if !hasDefault {
-		substituters = append([]string{"https://cache.nixos.org"}, substituters...)
-		publicKeys = append([]string{"cache.nixos.org-1:6NCHdD59X431o0gWypbMrAURkbJ16ZPMQFGspcDShjY="}, publicKeys...)
+		substituters = append(substituters, "https://cache.nixos.org")
+		publicKeys = append(publicKeys, "cache.nixos.org-1:6NCHdD59X431o0gWypbMrAURkbJ16ZPMQFGspcDShjY=")
 	}
 
-	// Write nix.conf snippet
-	nixConf := fmt.Sprintf(`# NixFleet managed cache configuration
-substituters = %s
-trusted-public-keys = %s
-`, strings.Join(substituters, " "), strings.Join(publicKeys, " "))
-
-	writeCmd := fmt.Sprintf("mkdir -p /etc/nix/nix.conf.d && cat > /etc/nix/nix.conf.d/nixfleet-cache.conf << 'EOF'\n%s\nEOF", nixConf)
-	result, err := client.ExecSudo(ctx, writeCmd)
-	if err != nil {
-		return fmt.Errorf("failed to write cache config: %w", err)
-	}
-	if result.ExitCode != 0 {
-		return fmt.Errorf("failed to write cache config: %s", result.Stderr)
+	var b strings.Builder
+	fmt.Fprintf(&b, "substituters = %s\n", strings.Join(substituters, " "))
+	fmt.Fprintf(&b, "trusted-public-keys = %s\n", strings.Join(publicKeys, " "))
+	if len(netrcLines) > 0 {
+		fmt.Fprintf(&b, "netrc-file = %s\n", cacheNetrcPath)
 	}
 
-	// Restart nix-daemon to pick up new config
-	result, err = client.ExecSudo(ctx, "systemctl restart nix-daemon")
+	return b.String(), strings.Join(netrcLines, "\n"), nil
+}
+
+// netrcLine decrypts c.AuthSecretPath (expected content "username:password")
+// and renders it as a netrc "machine" entry for c's host, so nix
+// authenticates to it without the credential ever touching nix.conf.
+func (m *Manager) netrcLine(ctx context.Context, c CacheConfig) (string, error) {
+	creds, err := m.secretsMgr.DecryptSecret(ctx, c.AuthSecretPath)
 	if err != nil {
-		return fmt.Errorf("failed to restart nix-daemon: %w", err)
+		return "", fmt.Errorf("decrypting %s: %w", c.AuthSecretPath, err)
 	}
-	if result.ExitCode != 0 {
-		return fmt.Errorf("failed to restart nix-daemon: %s", result.Stderr)
-	}
-
-	return nil
-}
 
-// configureNixOSCache returns the Nix configuration for NixOS
-// Note: For NixOS, cache config should be in the nixosConfiguration
-func (m *Manager) configureNixOSCache(ctx context.Context, client *ssh.Client) error {
-	// NixOS cache config is typically managed via nix.settings in configuration.nix
-	// We'll write a supplementary config file that gets included
-	var substituters []string
-	var publicKeys []string
+	user, pass, ok := strings.Cut(strings.TrimSpace(string(creds)), ":")
+	if !ok {
+		return "", fmt.Errorf("%s: expected \"username:password\" content", c.AuthSecretPath)
+	}
 
-	for _, cache := range m.caches {
-		substituters = append(substituters, cache.URL)
-		publicKeys = append(publicKeys, cache.PublicKeys...)
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("cache URL %q has no host for a netrc entry", c.URL)
 	}
 
-	nixConf := fmt.Sprintf(`# NixFleet managed cache configuration
-substituters = %s
-trusted-public-keys = %s
-`, strings.Join(substituters, " "), strings.Join(publicKeys, " "))
+	return fmt.Sprintf("machine %s login %s password %s", u.Host, user, pass), nil
+}
 
-	writeCmd := fmt.Sprintf("mkdir -p /etc/nix && cat > /etc/nix/nixfleet-cache.conf << 'EOF'\n%s\nEOF", nixConf)
+// writeRemoteFile writes content to path on the host with the given octal
+// mode, creating its parent directory first. path and mode are always
+// package-internal constants, never arbitrary input, so no shell quoting
+// is needed for them.
+func writeRemoteFile(ctx context.Context, client *ssh.Client, path, content, mode string) error {
+	dir := filepath.Dir(path)
+	writeCmd := fmt.Sprintf("mkdir -p %s && cat > %s << 'EOF'\n%s\nEOF\nchmod %s %s", dir, path, content, mode, path)
 	result, err := client.ExecSudo(ctx, writeCmd)
 	if err != nil {
-		return fmt.Errorf("failed to write cache config: %w", err)
+		return err
 	}
 	if result.ExitCode != 0 {
-		return fmt.Errorf("failed to write cache config: %s", result.Stderr)
+		return fmt.Errorf("%s", result.Stderr)
 	}
-
 	return nil
 }
 
-// configureDarwinCache configures nix-darwin to use caches
-func (m *Manager) configureDarwinCache(ctx context.Context, client *ssh.Client) error {
-	var substituters []string
-	var publicKeys []string
-
-	for _, cache := range m.caches {
-		substituters = append(substituters, cache.URL)
-		publicKeys = append(publicKeys, cache.PublicKeys...)
-	}
-
-	nixConf := fmt.Sprintf(`# NixFleet managed cache configuration
-substituters = %s
-trusted-public-keys = %s
-`, strings.Join(substituters, " "), strings.Join(publicKeys, " "))
-
-	writeCmd := fmt.Sprintf("mkdir -p /etc/nix && cat > /etc/nix/nixfleet-cache.conf << 'EOF'\n%s\nEOF", nixConf)
-	result, err := client.ExecSudo(ctx, writeCmd)
+// writeManagedBlock replaces the cacheConfBeginMarker/cacheConfEndMarker
+// block in path with newBlock (appending the markers if the file doesn't
+// have them yet), leaving the rest of the file untouched, and returns the
+// resulting file's sha256 so the caller can register it for drift
+// detection. As with writeRemoteFile, path is always a package-internal
+// constant.
+func writeManagedBlock(ctx context.Context, client *ssh.Client, path, newBlock string) (hash string, err error) {
+	dir := filepath.Dir(path)
+	script := fmt.Sprintf(`set -e
+mkdir -p %s
+touch %s
+awk '$0=="%s"{skip=1;next} $0=="%s"{skip=0;next} !skip' %s > %s.nixfleet-new
+cat >> %s.nixfleet-new << 'EOF'
+%s
+%s
+%s
+EOF
+mv %s.nixfleet-new %s
+sha256sum %s | cut -d' ' -f1`,
+		dir, path,
+		cacheConfBeginMarker, cacheConfEndMarker, path, path,
+		path, cacheConfBeginMarker, newBlock, cacheConfEndMarker,
+		path, path,
+		path)
+
+	result, err := client.ExecSudo(ctx, script)
 	if err != nil {
-		return fmt.Errorf("failed to write cache config: %w", err)
+		return "", err
 	}
 	if result.ExitCode != 0 {
-		return fmt.Errorf("failed to write cache config: %s", result.Stderr)
+		return "", fmt.Errorf("%s", result.Stderr)
 	}
-
-	// Restart nix-daemon via launchctl
-	_, _ = client.ExecSudo(ctx, "launchctl kickstart -k system/org.nixos.nix-daemon")
-
-	return nil
+	return strings.TrimSpace(result.Stdout), nil
 }
 
 // GenerateSigningKey generates a new signing key pair
@@ -264,6 +359,65 @@ func (m *Manager) VerifySignature(ctx context.Context, client *ssh.Client, store
 	return false, nil
 }
 
+// CacheTestResult is one cache's reachability/latency result from TestCaches.
+type CacheTestResult struct {
+	URL       string
+	Priority  int
+	Reachable bool
+	LatencyMS int64
+	Error     string
+}
+
+// TestCaches fetches nix-cache-info - present on every binary cache and
+// independent of any specific store path, making it a stable target to
+// probe - from client for each configured cache in priority order, so
+// failover behavior can be verified before an outage forces it. Caches
+// whose URL isn't http(s) (e.g. s3://) aren't reachable with a plain HTTP
+// fetch and are reported as such rather than skipped silently.
+func (m *Manager) TestCaches(ctx context.Context, client *ssh.Client) ([]CacheTestResult, error) {
+	results := make([]CacheTestResult, 0, len(m.caches))
+
+	for _, c := range m.orderedCaches() {
+		result := CacheTestResult{URL: c.URL, Priority: c.Priority}
+
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			result.Error = "not an http(s) cache; cannot test reachability from a host"
+			results = append(results, result)
+			continue
+		}
+
+		infoURL := strings.TrimRight(c.URL, "/") + "/nix-cache-info"
+		cmd := fmt.Sprintf("curl -s -o /dev/null -w '%%{http_code} %%{time_total}' --max-time 10 %s", infoURL)
+		execResult, err := client.Exec(ctx, cmd)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		var httpCode int
+		var seconds float64
+		if _, scanErr := fmt.Sscanf(strings.TrimSpace(execResult.Stdout), "%d %f", &httpCode, &seconds); scanErr != nil {
+			result.Error = fmt.Sprintf("unexpected curl output: %s", execResult.Stdout)
+			results = append(results, result)
+			continue
+		}
+
+		if httpCode != http.StatusOK {
+			result.Error = fmt.Sprintf("HTTP %d", httpCode)
+			results = append(results, result)
+			continue
+		}
+
+		result.Reachable = true
+		result.LatencyMS = int64(seconds * 1000)
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
 // LocalCommandResult holds result of local command execution
 type LocalCommandResult struct {
 	Stdout   string
@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// RotateKeyOptions configures RotateKey.
+type RotateKeyOptions struct {
+	KeyName   string // new key's name, e.g. "myorg-cache-2"
+	OutputDir string // where GenerateSigningKey writes the new keypair
+
+	// CacheURL is the store `nix store sign` re-signs paths in.
+	CacheURL string
+
+	// OldPublicKey, if set, is reported first in RotationResult.TrustedKeys
+	// so the operator has the complete list to push via `cache configure`
+	// without having to remember it themselves.
+	OldPublicKey string
+
+	// StorePaths is the set of paths to re-sign, resolved by the caller -
+	// either every path currently or historically deployed to the fleet, or
+	// every path the cache can enumerate, or an explicit list.
+	StorePaths []string
+
+	// DryRun reports the path list and key ordering without generating a
+	// key or signing anything.
+	DryRun bool
+}
+
+// PathSignResult is one store path's outcome from RotateKey.
+type PathSignResult struct {
+	StorePath string
+	Signed    bool
+	Error     string
+}
+
+// RotationResult is RotateKey's report: the new keypair (nil on a dry run),
+// the ordered list of public keys hosts must trust during the transition
+// (old key(s) first, then the new key), and a per-path signing outcome.
+type RotationResult struct {
+	NewKey      *SigningConfig
+	TrustedKeys []string
+	Paths       []PathSignResult
+	DryRun      bool
+}
+
+// RotateKey generates a new signing keypair and re-signs opts.StorePaths
+// against opts.CacheURL with `nix store sign`, so a fleet can start trusting
+// a new key without its already-cached paths suddenly appearing unsigned.
+// It never removes the old key from anything - see RetireKey for that, once
+// every host has been reconfigured to trust the new one.
+func RotateKey(ctx context.Context, opts RotateKeyOptions) (*RotationResult, error) {
+	if opts.KeyName == "" {
+		return nil, fmt.Errorf("KeyName is required")
+	}
+	if opts.CacheURL == "" {
+		return nil, fmt.Errorf("CacheURL is required")
+	}
+
+	result := &RotationResult{DryRun: opts.DryRun}
+	if opts.OldPublicKey != "" {
+		result.TrustedKeys = append(result.TrustedKeys, opts.OldPublicKey)
+	}
+
+	if opts.DryRun {
+		result.TrustedKeys = append(result.TrustedKeys, fmt.Sprintf("<%s: not yet generated>", opts.KeyName))
+		for _, p := range opts.StorePaths {
+			result.Paths = append(result.Paths, PathSignResult{StorePath: p})
+		}
+		return result, nil
+	}
+
+	newKey, err := GenerateSigningKey(ctx, opts.KeyName, opts.OutputDir)
+	if err != nil {
+		return nil, fmt.Errorf("generating new key: %w", err)
+	}
+	result.NewKey = newKey
+	result.TrustedKeys = append(result.TrustedKeys, newKey.PublicKey)
+
+	for _, path := range opts.StorePaths {
+		pr := PathSignResult{StorePath: path}
+
+		cmd := fmt.Sprintf("nix store sign --key-file %s --store %s %s", newKey.SecretKey, opts.CacheURL, path)
+		execResult := execLocalCommand(ctx, cmd)
+		if execResult.ExitCode != 0 {
+			pr.Error = strings.TrimSpace(execResult.Stderr)
+		} else {
+			pr.Signed = true
+		}
+
+		result.Paths = append(result.Paths, pr)
+	}
+
+	return result, nil
+}
+
+// RetireKeyOptions configures RetireKey.
+type RetireKeyOptions struct {
+	// KeyName is the retiring key's name as it appears in a narinfo's
+	// Sig line, e.g. "myorg-cache-1" in "myorg-cache-1:AbC...".
+	KeyName string
+
+	// CacheURL is the store RetireKey samples narinfos from.
+	CacheURL string
+
+	// StorePaths is the set of paths to sample - every path currently or
+	// historically deployed to the fleet is the safest choice, since those
+	// are the ones substitution actually depends on.
+	StorePaths []string
+}
+
+// PathVerifyResult is one store path's outcome from RetireKey.
+type PathVerifyResult struct {
+	StorePath  string
+	Signers    []string
+	OnlyOldKey bool
+	Error      string
+}
+
+// RetireResult is RetireKey's report: whether it's safe to drop KeyName from
+// host configs, and the per-path narinfo signatures it sampled to decide.
+type RetireResult struct {
+	KeyName string
+	Safe    bool
+	Paths   []PathVerifyResult
+}
+
+// RetireKey samples the narinfo signatures of opts.StorePaths in
+// opts.CacheURL and reports whether any of them is signed only by
+// opts.KeyName - if so, removing that key from host configs would make that
+// path unsubstitutable, and RetireResult.Safe is false. A path RetireKey
+// can't even read counts as unsafe too, since an unreadable narinfo can't be
+// ruled out as old-key-only.
+func RetireKey(ctx context.Context, opts RetireKeyOptions) (*RetireResult, error) {
+	if opts.KeyName == "" {
+		return nil, fmt.Errorf("KeyName is required")
+	}
+	if opts.CacheURL == "" {
+		return nil, fmt.Errorf("CacheURL is required")
+	}
+
+	result := &RetireResult{KeyName: opts.KeyName, Safe: true}
+
+	for _, path := range opts.StorePaths {
+		pv := PathVerifyResult{StorePath: path}
+
+		cmd := fmt.Sprintf("nix path-info --store %s --sigs %s", opts.CacheURL, path)
+		execResult := execLocalCommand(ctx, cmd)
+		if execResult.ExitCode != 0 {
+			pv.Error = strings.TrimSpace(execResult.Stderr)
+			result.Safe = false
+			result.Paths = append(result.Paths, pv)
+			continue
+		}
+
+		for _, field := range strings.Fields(execResult.Stdout) {
+			name, _, ok := strings.Cut(field, ":")
+			if ok {
+				pv.Signers = append(pv.Signers, name)
+			}
+		}
+
+		pv.OnlyOldKey = len(pv.Signers) == 1 && pv.Signers[0] == opts.KeyName
+		if pv.OnlyOldKey {
+			result.Safe = false
+		}
+
+		result.Paths = append(result.Paths, pv)
+	}
+
+	return result, nil
+}
+
+// ResolveAllCachePaths lists every store path opts.CacheURL can enumerate,
+// for --scope all rotations/retirements. Not every cache backend supports
+// enumeration (e.g. a plain S3/HTTP binary cache doesn't); that surfaces as
+// an error here, before any signing or sampling is attempted.
+func ResolveAllCachePaths(ctx context.Context, cacheURL string) ([]string, error) {
+	cmd := fmt.Sprintf("nix path-info --store %s --all", cacheURL)
+	result := execLocalCommand(ctx, cmd)
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("listing cache paths: %s", strings.TrimSpace(result.Stderr))
+	}
+
+	var paths []string
+	for _, line := range strings.Split(strings.TrimSpace(result.Stdout), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,268 @@
+// Package compare computes structured differences between two hosts'
+// inventory definitions, deployed closures, HostState, and PKI certificates.
+// It's shared by the server's GET /api/compare handler and the
+// `nixfleet host diff` CLI command so the two stay in lockstep.
+package compare
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+	"github.com/nixfleet/nixfleet/internal/nix"
+	"github.com/nixfleet/nixfleet/internal/pki"
+	"github.com/nixfleet/nixfleet/internal/ssh"
+	"github.com/nixfleet/nixfleet/internal/state"
+)
+
+// Result is the structured diff between two hosts. Every section is present
+// for both hosts even when a side couldn't be gathered (e.g. host
+// unreachable) - callers should treat an empty/zero value as "unknown", not
+// "identical".
+type Result struct {
+	Host1 string `json:"host1"`
+	Host2 string `json:"host2"`
+
+	Inventory InventoryCompare `json:"inventory"`
+	Deploy    DeployCompare    `json:"deploy"`
+	State     StateCompare     `json:"state"`
+	PKI       PKICompare       `json:"pki"`
+}
+
+// InventoryCompare compares the two hosts' static inventory definitions.
+type InventoryCompare struct {
+	Base1      string   `json:"base1,omitempty"`
+	Base2      string   `json:"base2,omitempty"`
+	Base2Diff  bool     `json:"base_differs"`
+	Roles1     []string `json:"roles1,omitempty"`
+	Roles2     []string `json:"roles2,omitempty"`
+	RolesDiff  bool     `json:"roles_differ"`
+	Groups1    []string `json:"groups1,omitempty"`
+	Groups2    []string `json:"groups2,omitempty"`
+	GroupsDiff bool     `json:"groups_differ"`
+
+	// TagKeys lists every tag key present on either host, so callers can
+	// render a same/different row per key even when one side is missing it.
+	TagKeys   []string          `json:"tag_keys,omitempty"`
+	Tags1     map[string]string `json:"tags1,omitempty"`
+	Tags2     map[string]string `json:"tags2,omitempty"`
+	TagsDiffs []string          `json:"tags_differing,omitempty"`
+}
+
+// DeployCompare compares what's actually built and deployed to each host.
+type DeployCompare struct {
+	StorePath1         string           `json:"store_path1,omitempty"`
+	StorePath2         string           `json:"store_path2,omitempty"`
+	ManifestHash1      string           `json:"manifest_hash1,omitempty"`
+	ManifestHash2      string           `json:"manifest_hash2,omitempty"`
+	StorePathDiffers   bool             `json:"store_path_differs"`
+	Error1             string           `json:"error1,omitempty"`
+	Error2             string           `json:"error2,omitempty"`
+	ClosureDiff        *nix.ClosureDiff `json:"closure_diff,omitempty"`
+	ClosureDiffSkipped string           `json:"closure_diff_skipped,omitempty"`
+}
+
+// StateCompare compares each host's last-reported HostState.
+type StateCompare struct {
+	Generation1        int      `json:"generation1"`
+	Generation2        int      `json:"generation2"`
+	Generation2Differs bool     `json:"generation_differs"`
+	DriftFiles1        []string `json:"drift_files1,omitempty"`
+	DriftFiles2        []string `json:"drift_files2,omitempty"`
+	DriftDiffers       bool     `json:"drift_differs"`
+
+	// PendingUpdatesApplicable is false when the two hosts aren't both
+	// "ubuntu": NixOS/Darwin hosts don't populate PendingUpdates via apt, so
+	// a zero there isn't a meaningful "up to date" comparison against an
+	// Ubuntu host's count.
+	PendingUpdatesApplicable bool                           `json:"pending_updates_applicable"`
+	PendingUpdates1          int                            `json:"pending_updates1"`
+	PendingUpdates2          int                            `json:"pending_updates2"`
+	PendingUpdatesDiffer     bool                           `json:"pending_updates_differ"`
+	ServiceHealth1           map[string]state.ServiceStatus `json:"service_health1,omitempty"`
+	ServiceHealth2           map[string]state.ServiceStatus `json:"service_health2,omitempty"`
+	ServiceHealthDiffers     []string                       `json:"service_health_differing,omitempty"`
+	Error1                   string                         `json:"error1,omitempty"`
+	Error2                   string                         `json:"error2,omitempty"`
+}
+
+// PKICompare compares each host's certificate, if a PKI store is configured
+// and the host has a certificate issued.
+type PKICompare struct {
+	Applicable bool   `json:"applicable"`
+	Serial1    string `json:"serial1,omitempty"`
+	Serial2    string `json:"serial2,omitempty"`
+	NotAfter1  string `json:"not_after1,omitempty"`
+	NotAfter2  string `json:"not_after2,omitempty"`
+	DaysLeft1  int    `json:"days_left1,omitempty"`
+	DaysLeft2  int    `json:"days_left2,omitempty"`
+	Error1     string `json:"error1,omitempty"`
+	Error2     string `json:"error2,omitempty"`
+	Differs    bool   `json:"differs"`
+}
+
+// Inventory compares the two hosts' static inventory definitions.
+func Inventory(inv *inventory.Inventory, h1, h2 *inventory.Host) InventoryCompare {
+	c := InventoryCompare{
+		Base1:   h1.Base,
+		Base2:   h2.Base,
+		Roles1:  h1.Roles,
+		Roles2:  h2.Roles,
+		Groups1: inv.GroupsForHost(h1),
+		Groups2: inv.GroupsForHost(h2),
+		Tags1:   h1.Tags,
+		Tags2:   h2.Tags,
+	}
+	c.Base2Diff = h1.Base != h2.Base
+	c.RolesDiff = !stringSlicesEqual(h1.Roles, h2.Roles)
+	c.GroupsDiff = !stringSlicesEqual(c.Groups1, c.Groups2)
+
+	keySet := make(map[string]bool)
+	for k := range h1.Tags {
+		keySet[k] = true
+	}
+	for k := range h2.Tags {
+		keySet[k] = true
+	}
+	for k := range keySet {
+		c.TagKeys = append(c.TagKeys, k)
+		if h1.Tags[k] != h2.Tags[k] {
+			c.TagsDiffs = append(c.TagsDiffs, k)
+		}
+	}
+	sort.Strings(c.TagKeys)
+	sort.Strings(c.TagsDiffs)
+
+	return c
+}
+
+// DeployAndState compares what's deployed and each host's last-reported
+// HostState, connecting to both hosts over SSH via pool to read state.
+func DeployAndState(ctx context.Context, pool *ssh.Pool, stateMgr *state.Manager, evaluator *nix.Evaluator, h1, h2 *inventory.Host) (DeployCompare, StateCompare) {
+	var deploy DeployCompare
+	var st StateCompare
+
+	state1, err1 := readHostState(ctx, pool, stateMgr, h1)
+	if err1 != nil {
+		deploy.Error1 = err1.Error()
+		st.Error1 = err1.Error()
+	}
+	state2, err2 := readHostState(ctx, pool, stateMgr, h2)
+	if err2 != nil {
+		deploy.Error2 = err2.Error()
+		st.Error2 = err2.Error()
+	}
+
+	if state1 != nil {
+		deploy.StorePath1 = state1.StorePath
+		deploy.ManifestHash1 = state1.ManifestHash
+		st.Generation1 = state1.CurrentGeneration
+		st.DriftFiles1 = state1.DriftFiles
+		st.PendingUpdates1 = state1.PendingUpdates
+		st.ServiceHealth1 = state1.ServiceHealth
+	}
+	if state2 != nil {
+		deploy.StorePath2 = state2.StorePath
+		deploy.ManifestHash2 = state2.ManifestHash
+		st.Generation2 = state2.CurrentGeneration
+		st.DriftFiles2 = state2.DriftFiles
+		st.PendingUpdates2 = state2.PendingUpdates
+		st.ServiceHealth2 = state2.ServiceHealth
+	}
+
+	deploy.StorePathDiffers = deploy.StorePath1 != deploy.StorePath2
+	st.Generation2Differs = st.Generation1 != st.Generation2
+	st.DriftDiffers = !stringSlicesEqual(st.DriftFiles1, st.DriftFiles2)
+	st.PendingUpdatesApplicable = h1.Base == "ubuntu" && h2.Base == "ubuntu"
+	st.PendingUpdatesDiffer = st.PendingUpdatesApplicable && st.PendingUpdates1 != st.PendingUpdates2
+	st.ServiceHealthDiffers = diffServiceHealth(st.ServiceHealth1, st.ServiceHealth2)
+
+	if evaluator != nil && deploy.StorePath1 != "" && deploy.StorePath2 != "" && deploy.StorePath1 != deploy.StorePath2 {
+		diff, err := evaluator.DiffClosures(ctx, deploy.StorePath1, deploy.StorePath2)
+		if err != nil {
+			deploy.ClosureDiffSkipped = "one or both store paths aren't available locally: " + err.Error()
+		} else {
+			deploy.ClosureDiff = diff
+		}
+	}
+
+	return deploy, st
+}
+
+func readHostState(ctx context.Context, pool *ssh.Pool, stateMgr *state.Manager, host *inventory.Host) (*state.HostState, error) {
+	client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+	if err != nil {
+		return nil, fmt.Errorf("connecting: %w", err)
+	}
+	hostState, err := stateMgr.ReadState(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("reading state: %w", err)
+	}
+	return hostState, nil
+}
+
+// PKI compares each host's certificate. If store is nil, the comparison is
+// reported as not applicable rather than erroring.
+func PKI(store *pki.Store, h1, h2 *inventory.Host) PKICompare {
+	if store == nil {
+		return PKICompare{Applicable: false}
+	}
+
+	c := PKICompare{Applicable: true}
+
+	info1, err1 := store.GetCertInfo(h1.Name)
+	if err1 != nil {
+		c.Error1 = err1.Error()
+	} else {
+		c.Serial1 = info1.Serial
+		c.NotAfter1 = info1.NotAfter.Format("2006-01-02")
+		c.DaysLeft1 = info1.DaysLeft
+	}
+
+	info2, err2 := store.GetCertInfo(h2.Name)
+	if err2 != nil {
+		c.Error2 = err2.Error()
+	} else {
+		c.Serial2 = info2.Serial
+		c.NotAfter2 = info2.NotAfter.Format("2006-01-02")
+		c.DaysLeft2 = info2.DaysLeft
+	}
+
+	c.Differs = c.Serial1 != c.Serial2
+	return c
+}
+
+func diffServiceHealth(h1, h2 map[string]state.ServiceStatus) []string {
+	names := make(map[string]bool)
+	for name := range h1 {
+		names[name] = true
+	}
+	for name := range h2 {
+		names[name] = true
+	}
+	var differing []string
+	for name := range names {
+		if h1[name] != h2[name] {
+			differing = append(differing, name)
+		}
+	}
+	sort.Strings(differing)
+	return differing
+}
+
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sorted1 := append([]string{}, a...)
+	sorted2 := append([]string{}, b...)
+	sort.Strings(sorted1)
+	sort.Strings(sorted2)
+	for i := range sorted1 {
+		if sorted1[i] != sorted2[i] {
+			return false
+		}
+	}
+	return true
+}
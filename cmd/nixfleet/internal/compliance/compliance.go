@@ -0,0 +1,376 @@
+// Package compliance tracks, per host, how long OS security and regular
+// updates have sat unapplied, and aggregates that into fleet-level SLA
+// compliance metrics for GET /api/compliance and 'nixfleet compliance
+// report'.
+package compliance
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SLA sets, in days, how long a host may carry outstanding security or
+// regular updates before it's considered out of compliance. See
+// inventory.Inventory.ComplianceSLAForHost, which resolves a per-host value
+// (falling back to DefaultSLA) that's converted to this type at the point
+// of use.
+type SLA struct {
+	SecurityDays int `json:"security_days"`
+	RegularDays  int `json:"regular_days"`
+}
+
+// DefaultSLA is applied to any host that hasn't configured its own
+// threshold: patch security updates within two weeks, everything else
+// within a month.
+func DefaultSLA() SLA {
+	return SLA{SecurityDays: 14, RegularDays: 30}
+}
+
+// PendingPackage is one package with an update available, as of the check
+// that last saw it. It deliberately mirrors osupdate.PendingPackage rather
+// than importing it, so this package stays usable from contexts (the CLI's
+// offline report path, tests) that don't want an SSH dependency.
+type PendingPackage struct {
+	Name           string `json:"name"`
+	CurrentVersion string `json:"current_version"`
+	NewVersion     string `json:"new_version"`
+}
+
+// pendingEntry is when a currently-outstanding package was first observed,
+// so its age can be derived at query time instead of stored and rotted.
+type pendingEntry struct {
+	FirstSeen time.Time `json:"first_seen"`
+	Security  bool      `json:"security"`
+}
+
+// DailySample is one host's outstanding-update snapshot at the time of a
+// periodic check. Samples are keyed by calendar day (UTC) rather than exact
+// timestamp - a host checked more than once in a day overwrites that day's
+// sample rather than accumulating several, so the series stays one point
+// per day regardless of check interval.
+type DailySample struct {
+	Date               string `json:"date"` // YYYY-MM-DD, UTC
+	SecurityPending    int    `json:"security_pending"`
+	RegularPending     int    `json:"regular_pending"`
+	OldestSecurityDays int    `json:"oldest_security_days"`
+	OldestRegularDays  int    `json:"oldest_regular_days"`
+}
+
+// HostRecord is one host's compliance history: Pending is the live set of
+// outstanding packages (the source of truth for "is this host compliant
+// right now"), Samples is the daily time series derived from it (the
+// source of truth for trends like mean time to patch).
+type HostRecord struct {
+	Pending map[string]pendingEntry `json:"pending"`
+	Samples []DailySample           `json:"samples"`
+}
+
+// Store persists every host's HostRecord in a single JSON file under the
+// server's data dir, following the same one-file-of-everything shape as
+// search.Cache and server.K0sSummaryCache.
+type Store struct {
+	path string
+
+	mu    sync.RWMutex
+	hosts map[string]*HostRecord
+}
+
+// NewStore creates a store that persists under dataDir, loading any
+// existing series immediately.
+func NewStore(dataDir string) *Store {
+	s := &Store{
+		path:  filepath.Join(dataDir, "compliance.json"),
+		hosts: make(map[string]*HostRecord),
+	}
+	s.load()
+	return s
+}
+
+func (s *Store) load() {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return
+	}
+	var hosts map[string]*HostRecord
+	if err := json.Unmarshal(data, &hosts); err != nil {
+		log.Printf("compliance.Store: failed to load state: %v", err)
+		return
+	}
+	s.mu.Lock()
+	s.hosts = hosts
+	s.mu.Unlock()
+}
+
+func (s *Store) save() {
+	s.mu.RLock()
+	data, err := json.MarshalIndent(s.hosts, "", "  ")
+	s.mu.RUnlock()
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		log.Printf("compliance.Store: failed to create data dir: %v", err)
+		return
+	}
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		log.Printf("compliance.Store: failed to save state: %v", err)
+	}
+}
+
+// Record merges host's currently outstanding security/regular packages into
+// its Pending set - keeping the FirstSeen of anything still outstanding,
+// starting the clock on anything new, and dropping anything no longer
+// reported (it's been patched) - then appends or overwrites now's calendar
+// day in Samples.
+func (s *Store) Record(host string, now time.Time, security, regular []PendingPackage) {
+	s.mu.Lock()
+	rec, ok := s.hosts[host]
+	if !ok {
+		rec = &HostRecord{Pending: make(map[string]pendingEntry)}
+		s.hosts[host] = rec
+	}
+
+	current := make(map[string]bool, len(security)+len(regular))
+	mergePending := func(pkgs []PendingPackage, isSecurity bool) {
+		for _, p := range pkgs {
+			current[p.Name] = true
+			entry, existed := rec.Pending[p.Name]
+			if !existed {
+				entry.FirstSeen = now
+			}
+			entry.Security = isSecurity
+			rec.Pending[p.Name] = entry
+		}
+	}
+	mergePending(security, true)
+	mergePending(regular, false)
+	for name := range rec.Pending {
+		if !current[name] {
+			delete(rec.Pending, name)
+		}
+	}
+
+	secCount, regCount, oldestSec, oldestReg, _ := summarizePending(rec.Pending, now)
+	sample := DailySample{
+		Date:               now.UTC().Format("2006-01-02"),
+		SecurityPending:    secCount,
+		RegularPending:     regCount,
+		OldestSecurityDays: oldestSec,
+		OldestRegularDays:  oldestReg,
+	}
+	if n := len(rec.Samples); n > 0 && rec.Samples[n-1].Date == sample.Date {
+		rec.Samples[n-1] = sample
+	} else {
+		rec.Samples = append(rec.Samples, sample)
+	}
+	s.mu.Unlock()
+	s.save()
+}
+
+// Hosts returns the names of every host with a recorded compliance history.
+func (s *Store) Hosts() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.hosts))
+	for name := range s.hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Record returns host's HostRecord, if any.
+func (s *Store) hostRecord(host string) (*HostRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.hosts[host]
+	return rec, ok
+}
+
+// summarizePending derives the current outstanding counts and oldest ages
+// (in whole days, as of now) from a Pending set, plus the names currently
+// violating either threshold would need - callers combine this with an SLA
+// to produce the offending-package list.
+func summarizePending(pending map[string]pendingEntry, now time.Time) (secCount, regCount, oldestSecDays, oldestRegDays int, names []string) {
+	for name, entry := range pending {
+		age := int(now.Sub(entry.FirstSeen).Hours() / 24)
+		names = append(names, name)
+		if entry.Security {
+			secCount++
+			if age > oldestSecDays {
+				oldestSecDays = age
+			}
+		} else {
+			regCount++
+			if age > oldestRegDays {
+				oldestRegDays = age
+			}
+		}
+	}
+	sort.Strings(names)
+	return secCount, regCount, oldestSecDays, oldestRegDays, names
+}
+
+// HostMetrics is one host's compliance standing, as of now.
+type HostMetrics struct {
+	Host                string   `json:"host"`
+	SLA                 SLA      `json:"sla"`
+	Compliant           bool     `json:"compliant"`
+	SecurityPending     int      `json:"security_pending"`
+	RegularPending      int      `json:"regular_pending"`
+	OldestSecurityDays  int      `json:"oldest_security_days"`
+	OldestRegularDays   int      `json:"oldest_regular_days"`
+	MeanTimeToPatchDays float64  `json:"mean_time_to_patch_days"`
+	OffendingPackages   []string `json:"offending_packages,omitempty"`
+	MaintenanceMode     bool     `json:"maintenance_mode"`
+}
+
+// ComputeHostMetrics resolves host's current compliance standing against
+// sla, as of now. window bounds which of the host's daily samples feed
+// MeanTimeToPatchDays - the live Pending set (not the window) is always
+// used for the current counts and offending-package list, since those
+// describe "right now", not a historical range.
+func ComputeHostMetrics(host string, rec *HostRecord, sla SLA, maintenanceMode bool, now time.Time, window time.Duration) HostMetrics {
+	m := HostMetrics{Host: host, SLA: sla, MaintenanceMode: maintenanceMode}
+	if rec == nil {
+		m.Compliant = true
+		return m
+	}
+
+	var offending []string
+	for name, entry := range rec.Pending {
+		age := now.Sub(entry.FirstSeen)
+		threshold := time.Duration(sla.RegularDays) * 24 * time.Hour
+		if entry.Security {
+			threshold = time.Duration(sla.SecurityDays) * 24 * time.Hour
+		}
+		if age > threshold {
+			offending = append(offending, name)
+		}
+	}
+	sort.Strings(offending)
+
+	m.SecurityPending, m.RegularPending, m.OldestSecurityDays, m.OldestRegularDays, _ = summarizePending(rec.Pending, now)
+	m.OffendingPackages = offending
+	m.Compliant = len(offending) == 0
+	m.MeanTimeToPatchDays = meanTimeToPatch(rec.Samples, now, window)
+	return m
+}
+
+// meanTimeToPatch approximates mean time to patch as the average of the
+// window's daily OldestSecurityDays samples taken while a security update
+// was outstanding. This is only an approximation: a daily snapshot records
+// how old the oldest pending update was that day, not the moment any given
+// package was actually patched, so a host that's rarely had anything
+// pending will understate its true remediation time and one sampled mid-
+// patch will overstate it. It's still the best signal available without
+// recording every package's individual resolution event.
+func meanTimeToPatch(samples []DailySample, now time.Time, window time.Duration) float64 {
+	cutoff := now.Add(-window)
+	var total float64
+	var count int
+	for _, s := range samples {
+		sampleDate, err := time.Parse("2006-01-02", s.Date)
+		if err != nil || sampleDate.Before(cutoff) {
+			continue
+		}
+		if s.SecurityPending == 0 {
+			continue
+		}
+		total += float64(s.OldestSecurityDays)
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
+
+// FleetMetrics is the fleet-wide compliance picture returned by GET
+// /api/compliance and 'nixfleet compliance report'.
+type FleetMetrics struct {
+	Window            string        `json:"window"`
+	GeneratedAt       time.Time     `json:"generated_at"`
+	TotalHosts        int           `json:"total_hosts"`
+	CompliantHosts    int           `json:"compliant_hosts"`
+	CompliancePercent float64       `json:"compliance_percent"`
+	Hosts             []HostMetrics `json:"hosts"`
+	Violations        []HostMetrics `json:"violations"`
+	MaintenanceHosts  []string      `json:"maintenance_hosts,omitempty"`
+}
+
+// SLAResolver resolves the SLA a given host should be held to, so
+// ComputeFleetMetrics doesn't need to know anything about inventory's
+// group/host override resolution. inventory.Inventory.ComplianceSLAForHost
+// (converted to compliance.SLA at the call site) is the production
+// implementation.
+type SLAResolver func(host string) SLA
+
+// ComputeFleetMetrics computes per-host and fleet-level compliance over
+// window, as of now. hosts lists every inventory host to report on (so a
+// host with no recorded history yet still shows up as compliant, rather
+// than silently missing from the report); maintenanceMode reports whether
+// each host is currently in maintenance mode.
+func ComputeFleetMetrics(store *Store, hosts []string, resolveSLA SLAResolver, maintenanceMode func(host string) bool, now time.Time, window time.Duration) FleetMetrics {
+	fm := FleetMetrics{
+		Window:      window.String(),
+		GeneratedAt: now,
+	}
+
+	sorted := append([]string(nil), hosts...)
+	sort.Strings(sorted)
+
+	for _, host := range sorted {
+		rec, _ := store.hostRecord(host)
+		sla := resolveSLA(host)
+		inMaintenance := maintenanceMode(host)
+		hm := ComputeHostMetrics(host, rec, sla, inMaintenance, now, window)
+
+		fm.Hosts = append(fm.Hosts, hm)
+		fm.TotalHosts++
+		if hm.Compliant || inMaintenance {
+			fm.CompliantHosts++
+		}
+		if inMaintenance {
+			fm.MaintenanceHosts = append(fm.MaintenanceHosts, host)
+		} else if !hm.Compliant {
+			fm.Violations = append(fm.Violations, hm)
+		}
+	}
+
+	if fm.TotalHosts > 0 {
+		fm.CompliancePercent = 100 * float64(fm.CompliantHosts) / float64(fm.TotalHosts)
+	}
+	return fm
+}
+
+// ParseWindow parses a duration string like "90d" (a unit go's time.Parse
+// Duration doesn't support) in addition to anything time.ParseDuration
+// accepts, since "days" is the natural unit for a compliance window.
+func ParseWindow(s string) (time.Duration, error) {
+	if s == "" {
+		return 90 * 24 * time.Hour, nil
+	}
+	if days, ok := trimSuffix(s, "d"); ok {
+		var n int
+		if _, err := fmt.Sscanf(days, "%d", &n); err != nil {
+			return 0, fmt.Errorf("invalid window %q: %w", s, err)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func trimSuffix(s, suffix string) (string, bool) {
+	if len(s) > len(suffix) && s[len(s)-len(suffix):] == suffix {
+		return s[:len(s)-len(suffix)], true
+	}
+	return "", false
+}
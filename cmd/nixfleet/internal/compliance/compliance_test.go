@@ -0,0 +1,139 @@
+package compliance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreRecordTracksFirstSeenAndPrunesResolved(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir)
+
+	day0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.Record("web1", day0, []PendingPackage{{Name: "openssl"}}, nil)
+
+	day20 := day0.Add(20 * 24 * time.Hour)
+	store.Record("web1", day20, []PendingPackage{{Name: "openssl"}}, []PendingPackage{{Name: "curl"}})
+
+	rec, ok := store.hostRecord("web1")
+	if !ok {
+		t.Fatalf("expected a record for web1")
+	}
+	if rec.Pending["openssl"].FirstSeen != day0 {
+		t.Errorf("openssl FirstSeen = %v, want %v (should not reset on re-observation)", rec.Pending["openssl"].FirstSeen, day0)
+	}
+	if rec.Pending["curl"].FirstSeen != day20 {
+		t.Errorf("curl FirstSeen = %v, want %v", rec.Pending["curl"].FirstSeen, day20)
+	}
+
+	day21 := day0.Add(21 * 24 * time.Hour)
+	store.Record("web1", day21, nil, []PendingPackage{{Name: "curl"}})
+	rec, _ = store.hostRecord("web1")
+	if _, stillPending := rec.Pending["openssl"]; stillPending {
+		t.Errorf("openssl should have been pruned once no longer reported")
+	}
+	if len(rec.Samples) != 3 {
+		t.Errorf("got %d samples, want 3 (one per distinct calendar day)", len(rec.Samples))
+	}
+}
+
+func TestStoreRecordOverwritesSameDaySample(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir)
+
+	morning := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	evening := time.Date(2026, 1, 1, 20, 0, 0, 0, time.UTC)
+	store.Record("web1", morning, []PendingPackage{{Name: "openssl"}}, nil)
+	store.Record("web1", evening, []PendingPackage{{Name: "openssl"}, {Name: "curl"}}, nil)
+
+	rec, _ := store.hostRecord("web1")
+	if len(rec.Samples) != 1 {
+		t.Fatalf("got %d samples, want 1 (same calendar day should overwrite)", len(rec.Samples))
+	}
+	if rec.Samples[0].SecurityPending != 2 {
+		t.Errorf("SecurityPending = %d, want 2", rec.Samples[0].SecurityPending)
+	}
+}
+
+func TestComputeHostMetricsCompliance(t *testing.T) {
+	now := time.Date(2026, 1, 20, 0, 0, 0, 0, time.UTC)
+	sla := SLA{SecurityDays: 14, RegularDays: 30}
+
+	rec := &HostRecord{
+		Pending: map[string]pendingEntry{
+			"openssl": {FirstSeen: now.Add(-20 * 24 * time.Hour), Security: true}, // over 14-day SLA
+			"curl":    {FirstSeen: now.Add(-5 * 24 * time.Hour), Security: false}, // within 30-day SLA
+		},
+	}
+
+	m := ComputeHostMetrics("web1", rec, sla, false, now, 90*24*time.Hour)
+	if m.Compliant {
+		t.Errorf("expected non-compliant host with an overdue security package")
+	}
+	if len(m.OffendingPackages) != 1 || m.OffendingPackages[0] != "openssl" {
+		t.Errorf("OffendingPackages = %v, want [openssl]", m.OffendingPackages)
+	}
+
+	delete(rec.Pending, "openssl")
+	m = ComputeHostMetrics("web1", rec, sla, false, now, 90*24*time.Hour)
+	if !m.Compliant {
+		t.Errorf("expected compliant host once the overdue package is resolved")
+	}
+}
+
+func TestComputeFleetMetricsExcludesMaintenanceFromViolations(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir)
+	now := time.Date(2026, 1, 20, 0, 0, 0, 0, time.UTC)
+
+	overdue := now.Add(-30 * 24 * time.Hour)
+	store.Record("web1", overdue, []PendingPackage{{Name: "openssl"}}, nil)
+	store.Record("web1", now, []PendingPackage{{Name: "openssl"}}, nil)
+	store.Record("web2", overdue, []PendingPackage{{Name: "openssl"}}, nil)
+	store.Record("web2", now, []PendingPackage{{Name: "openssl"}}, nil)
+
+	resolveSLA := func(string) SLA { return DefaultSLA() }
+	maintenanceMode := func(host string) bool { return host == "web2" }
+
+	fm := ComputeFleetMetrics(store, []string{"web1", "web2", "web3"}, resolveSLA, maintenanceMode, now, 90*24*time.Hour)
+
+	if fm.TotalHosts != 3 {
+		t.Errorf("TotalHosts = %d, want 3", fm.TotalHosts)
+	}
+	if len(fm.Violations) != 1 || fm.Violations[0].Host != "web1" {
+		t.Errorf("Violations = %v, want just web1 (web2 is in maintenance, web3 has no history)", fm.Violations)
+	}
+	if len(fm.MaintenanceHosts) != 1 || fm.MaintenanceHosts[0] != "web2" {
+		t.Errorf("MaintenanceHosts = %v, want [web2]", fm.MaintenanceHosts)
+	}
+	// web3 has no recorded history and web2 is excluded via maintenance mode,
+	// so only web1's violation should count against CompliantHosts.
+	if fm.CompliantHosts != 2 {
+		t.Errorf("CompliantHosts = %d, want 2", fm.CompliantHosts)
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	cases := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 90 * 24 * time.Hour},
+		{"90d", 90 * 24 * time.Hour},
+		{"7d", 7 * 24 * time.Hour},
+		{"72h", 72 * time.Hour},
+	}
+	for _, c := range cases {
+		got, err := ParseWindow(c.in)
+		if err != nil {
+			t.Fatalf("ParseWindow(%q) error: %v", c.in, err)
+		}
+		if got != c.want {
+			t.Errorf("ParseWindow(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+
+	if _, err := ParseWindow("not-a-duration"); err == nil {
+		t.Errorf("expected an error for an invalid window")
+	}
+}
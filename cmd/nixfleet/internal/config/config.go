@@ -0,0 +1,241 @@
+// Package config loads NixFleet's global config file, which sets defaults
+// for persistent CLI flags and defines named contexts (one fleet's
+// inventory/flake/secrets/PKI/server settings, switchable without retyping
+// every flag).
+//
+// Precedence, highest to lowest: explicit CLI flags > NIXFLEET_* env vars >
+// local config (./.nixfleet.yaml) > user config
+// (~/.config/nixfleet/config.yaml). This package only resolves the file and
+// env layers; main.go's flag registration and PersistentPreRunE apply the
+// flag and env layers on top.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvVar returns the NIXFLEET_* environment variable name for a persistent
+// flag, e.g. "inventory" -> "NIXFLEET_INVENTORY".
+func EnvVar(flagName string) string {
+	return "NIXFLEET_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Context is a named fleet: the inventory/flake/secrets/PKI/server settings
+// for one environment, so switching fleets doesn't mean re-typing every
+// flag.
+type Context struct {
+	Inventory   string   `yaml:"inventory,omitempty"`
+	Flake       string   `yaml:"flake,omitempty"`
+	SecretsDir  string   `yaml:"secrets_dir,omitempty"`
+	PKIDir      string   `yaml:"pki_dir,omitempty"`
+	Identities  []string `yaml:"identities,omitempty"`
+	ServerURL   string   `yaml:"server_url,omitempty"`
+	ServerToken string   `yaml:"server_token,omitempty"`
+}
+
+// Defaults sets fallback values for the global persistent flags. Each
+// field is a pointer so "unset in this file" is distinguishable from "set
+// to the zero value".
+type Defaults struct {
+	Inventory   *string `yaml:"inventory,omitempty"`
+	Flake       *string `yaml:"flake,omitempty"`
+	Host        *string `yaml:"host,omitempty"`
+	Group       *string `yaml:"group,omitempty"`
+	Parallel    *int    `yaml:"parallel,omitempty"`
+	DryRun      *bool   `yaml:"dry_run,omitempty"`
+	Verbose     *bool   `yaml:"verbose,omitempty"`
+	Offline     *bool   `yaml:"offline,omitempty"`
+	NoEvalCache *bool   `yaml:"no_eval_cache,omitempty"`
+}
+
+// File is the on-disk shape of a nixfleet config file.
+type File struct {
+	Defaults       Defaults           `yaml:"defaults,omitempty"`
+	Contexts       map[string]Context `yaml:"contexts,omitempty"`
+	CurrentContext string             `yaml:"current_context,omitempty"`
+}
+
+// UserConfigPath returns ~/.config/nixfleet/config.yaml.
+func UserConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "nixfleet", "config.yaml")
+}
+
+// LocalConfigPath returns ./.nixfleet.yaml.
+func LocalConfigPath() string {
+	return ".nixfleet.yaml"
+}
+
+func load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &File{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if f.Contexts == nil {
+		f.Contexts = make(map[string]Context)
+	}
+
+	return &f, nil
+}
+
+// Merged is the user and local config files combined, plus which file each
+// piece came from, so `context use` knows where to persist a change.
+type Merged struct {
+	File
+
+	// UserPath and LocalPath are the paths that were loaded (present even
+	// if the file didn't exist yet), for `config view` and `context use`.
+	UserPath  string
+	LocalPath string
+}
+
+// Load reads the user config, then the local config layered on top of it:
+// local values win field-by-field for Defaults, local contexts override
+// user contexts of the same name, and a local current_context wins over
+// the user's.
+func Load() (*Merged, error) {
+	userPath := UserConfigPath()
+	localPath := LocalConfigPath()
+
+	userFile, err := load(userPath)
+	if err != nil {
+		return nil, err
+	}
+	localFile, err := load(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &Merged{
+		File:      File{Contexts: make(map[string]Context)},
+		UserPath:  userPath,
+		LocalPath: localPath,
+	}
+
+	merged.Defaults = mergeDefaults(userFile.Defaults, localFile.Defaults)
+
+	for name, c := range userFile.Contexts {
+		merged.Contexts[name] = c
+	}
+	for name, c := range localFile.Contexts {
+		merged.Contexts[name] = c
+	}
+
+	merged.CurrentContext = userFile.CurrentContext
+	if localFile.CurrentContext != "" {
+		merged.CurrentContext = localFile.CurrentContext
+	}
+
+	return merged, nil
+}
+
+// mergeDefaults layers override on top of base, field by field.
+func mergeDefaults(base, override Defaults) Defaults {
+	merged := base
+	if override.Inventory != nil {
+		merged.Inventory = override.Inventory
+	}
+	if override.Flake != nil {
+		merged.Flake = override.Flake
+	}
+	if override.Host != nil {
+		merged.Host = override.Host
+	}
+	if override.Group != nil {
+		merged.Group = override.Group
+	}
+	if override.Parallel != nil {
+		merged.Parallel = override.Parallel
+	}
+	if override.DryRun != nil {
+		merged.DryRun = override.DryRun
+	}
+	if override.Verbose != nil {
+		merged.Verbose = override.Verbose
+	}
+	if override.Offline != nil {
+		merged.Offline = override.Offline
+	}
+	if override.NoEvalCache != nil {
+		merged.NoEvalCache = override.NoEvalCache
+	}
+	return merged
+}
+
+// ActiveContext returns the currently selected context, if CurrentContext
+// names one that exists.
+func (m *Merged) ActiveContext() (Context, bool) {
+	if m.CurrentContext == "" {
+		return Context{}, false
+	}
+	c, ok := m.Contexts[m.CurrentContext]
+	return c, ok
+}
+
+// SetCurrentContext validates that name exists and persists it as the
+// active context in the local config file (./.nixfleet.yaml), so `context
+// use` only affects the current directory's fleet, not every checkout on
+// the machine.
+func SetCurrentContext(name string) error {
+	merged, err := Load()
+	if err != nil {
+		return err
+	}
+	if _, ok := merged.Contexts[name]; !ok {
+		return fmt.Errorf("unknown context %q (known: %v)", name, contextNames(merged.Contexts))
+	}
+
+	local, err := load(LocalConfigPath())
+	if err != nil {
+		return err
+	}
+	local.CurrentContext = name
+
+	return save(LocalConfigPath(), local)
+}
+
+func contextNames(contexts map[string]Context) []string {
+	names := make([]string, 0, len(contexts))
+	for name := range contexts {
+		names = append(names, name)
+	}
+	return names
+}
+
+func save(path string, f *File) error {
+	data, err := yaml.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Redacted returns a copy of m with every context's ServerToken masked, for
+// `config view --resolved` to print without leaking credentials.
+func (m *Merged) Redacted() *Merged {
+	redacted := *m
+	redacted.Contexts = make(map[string]Context, len(m.Contexts))
+	for name, c := range m.Contexts {
+		if c.ServerToken != "" {
+			c.ServerToken = "***"
+		}
+		redacted.Contexts[name] = c
+	}
+	return &redacted
+}
@@ -0,0 +1,50 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+)
+
+// CloudHost is a machine reported by a cloud provider's API, as opposed to
+// one found by probing addresses directly - CloudBackend.ListHosts
+// populates Addr, Name, and Tags from the provider rather than scanning.
+type CloudHost struct {
+	Name string            `json:"name"`
+	Addr string            `json:"addr"`
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// CloudBackend lists candidate hosts from a cloud provider's API, filtered
+// however the backend's own flags (e.g. a tag selector) specify.
+type CloudBackend interface {
+	// Name identifies the backend for error messages and output, e.g. "aws".
+	Name() string
+	ListHosts(ctx context.Context) ([]CloudHost, error)
+}
+
+// AWSBackend would list EC2 instances matching a tag filter, but this build
+// doesn't vendor an AWS SDK - adding one just for discovery isn't worth the
+// dependency weight until a second AWS-backed feature needs it. ListHosts
+// always fails; the CLI surfaces that as a clear error instead of silently
+// scanning nothing.
+type AWSBackend struct {
+	// Tag is a "key=value" EC2 tag filter, e.g. "fleet=yes".
+	Tag string
+}
+
+func (b *AWSBackend) Name() string { return "aws" }
+
+func (b *AWSBackend) ListHosts(ctx context.Context) ([]CloudHost, error) {
+	return nil, fmt.Errorf("--aws is not implemented in this build: no AWS SDK dependency is vendored")
+}
+
+// HetznerBackend would list Hetzner Cloud servers via the Hetzner API, but
+// this build doesn't vendor a Hetzner SDK. See AWSBackend for why this
+// fails rather than faking results.
+type HetznerBackend struct{}
+
+func (b *HetznerBackend) Name() string { return "hetzner" }
+
+func (b *HetznerBackend) ListHosts(ctx context.Context) ([]CloudHost, error) {
+	return nil, fmt.Errorf("--hetzner is not implemented in this build: no Hetzner SDK dependency is vendored")
+}
@@ -0,0 +1,210 @@
+package discover
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+)
+
+// ProposedHost is a responder that doesn't match any existing inventory
+// host, in ready-to-commit form.
+type ProposedHost struct {
+	Name               string `json:"name"`
+	Addr               string `json:"addr"`
+	Base               string `json:"base"` // best guess: "ubuntu" or "nixos"
+	HostKeyFingerprint string `json:"host_key_fingerprint"`
+}
+
+// MovedHost is a responder whose host key was previously recorded (in the
+// operator's known_hosts) under a different address than it answered from
+// this scan, and that old address matches an existing inventory host.
+type MovedHost struct {
+	Name               string `json:"name"`
+	OldAddr            string `json:"old_addr"`
+	NewAddr            string `json:"new_addr"`
+	HostKeyFingerprint string `json:"host_key_fingerprint"`
+}
+
+// UnexpectedHost is an existing inventory host whose configured address
+// answered with a host key that known_hosts has on record as belonging to
+// a different address - the machine at that address isn't the one the
+// inventory entry expects.
+type UnexpectedHost struct {
+	Name                string `json:"name"`
+	Addr                string `json:"addr"`
+	ExpectedFingerprint string `json:"expected_fingerprint"`
+	ActualFingerprint   string `json:"actual_fingerprint"`
+}
+
+// Diff is the proposed result of reconciling a scan's responders against
+// the existing inventory.
+type Diff struct {
+	New        []ProposedHost   `json:"new"`
+	Moved      []MovedHost      `json:"moved"`
+	Unexpected []UnexpectedHost `json:"unexpected"`
+}
+
+// DiffAgainstInventory matches responders against inv by address, falling
+// back to known_hosts history (hostKeysPath, typically ~/.ssh/known_hosts)
+// to recognize a host key that moved to a new address. A responder that
+// matches neither becomes a ProposedHost.
+func DiffAgainstInventory(inv *inventory.Inventory, responders []Responder, hostKeysPath string) *Diff {
+	entries, _ := parseKnownHosts(hostKeysPath) // best-effort; a missing/unreadable file just disables moved/unexpected detection
+
+	byAddr := make(map[string]*inventory.Host)
+	for _, h := range inv.AllHosts() {
+		byAddr[h.Addr] = h
+	}
+
+	diff := &Diff{}
+	for _, r := range responders {
+		if host, ok := byAddr[r.Addr]; ok {
+			if expected := fingerprintsForHost(entries, r.Addr); len(expected) > 0 && !contains(expected, r.HostKeyFingerprint) {
+				diff.Unexpected = append(diff.Unexpected, UnexpectedHost{
+					Name:                host.Name,
+					Addr:                r.Addr,
+					ExpectedFingerprint: strings.Join(expected, ", "),
+					ActualFingerprint:   r.HostKeyFingerprint,
+				})
+			}
+			continue
+		}
+
+		if moved, ok := findMoved(entries, byAddr, r); ok {
+			diff.Moved = append(diff.Moved, moved)
+			continue
+		}
+
+		diff.New = append(diff.New, ProposedHost{
+			Name:               suggestName(r),
+			Addr:               r.Addr,
+			Base:               suggestBase(r),
+			HostKeyFingerprint: r.HostKeyFingerprint,
+		})
+	}
+
+	return diff
+}
+
+// findMoved looks for an inventory host whose configured address used to
+// present r's host key fingerprint, according to known_hosts.
+func findMoved(entries []knownHostEntry, byAddr map[string]*inventory.Host, r Responder) (MovedHost, bool) {
+	for _, oldAddr := range hostsForFingerprint(entries, r.HostKeyFingerprint) {
+		if oldAddr == r.Addr {
+			continue
+		}
+		if host, ok := byAddr[oldAddr]; ok {
+			return MovedHost{
+				Name:               host.Name,
+				OldAddr:            oldAddr,
+				NewAddr:            r.Addr,
+				HostKeyFingerprint: r.HostKeyFingerprint,
+			}, true
+		}
+	}
+	return MovedHost{}, false
+}
+
+// suggestName derives a proposed inventory host name from a responder's
+// gathered hostname (its first label, so "web-1.internal.example.com"
+// becomes "web-1"), falling back to a dash-separated form of its address
+// when no hostname was gathered.
+func suggestName(r Responder) string {
+	if r.Hostname != "" {
+		return strings.SplitN(r.Hostname, ".", 2)[0]
+	}
+	return "host-" + strings.ReplaceAll(r.Addr, ".", "-")
+}
+
+// suggestBase guesses an inventory Base value from a responder's detected
+// OS, defaulting to "ubuntu" - nixfleet's most common non-NixOS target -
+// when OS detection didn't run or came back empty.
+func suggestBase(r Responder) string {
+	if r.OS == "nixos" {
+		return "nixos"
+	}
+	return "ubuntu"
+}
+
+// knownHostEntry is one parsed line of a known_hosts file.
+type knownHostEntry struct {
+	hosts       []string
+	fingerprint string
+}
+
+// parseKnownHosts reads path (a standard OpenSSH known_hosts file) into a
+// list of host/fingerprint entries. Hashed host patterns (HashKnownHosts
+// yes, the default on most systems) can't be reversed back into an address
+// and are skipped, since they're useless for by-address matching.
+func parseKnownHosts(path string) ([]knownHostEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []knownHostEntry
+	rest := data
+	for len(rest) > 0 {
+		_, hosts, pubKey, _, remainder, err := ssh.ParseKnownHosts(rest)
+		if err != nil {
+			break
+		}
+		rest = remainder
+
+		var plainHosts []string
+		for _, h := range hosts {
+			if !strings.HasPrefix(h, "|") { // "|1|salt|hash" = hashed entry
+				plainHosts = append(plainHosts, h)
+			}
+		}
+		if len(plainHosts) > 0 {
+			entries = append(entries, knownHostEntry{hosts: plainHosts, fingerprint: ssh.FingerprintSHA256(pubKey)})
+		}
+	}
+	return entries, nil
+}
+
+// fingerprintsForHost returns every fingerprint known_hosts has recorded
+// for addr.
+func fingerprintsForHost(entries []knownHostEntry, addr string) []string {
+	var fps []string
+	for _, e := range entries {
+		if containsHost(e.hosts, addr) {
+			fps = append(fps, e.fingerprint)
+		}
+	}
+	return fps
+}
+
+// hostsForFingerprint returns every address known_hosts has recorded fp
+// under.
+func hostsForFingerprint(entries []knownHostEntry, fp string) []string {
+	var addrs []string
+	for _, e := range entries {
+		if e.fingerprint == fp {
+			addrs = append(addrs, e.hosts...)
+		}
+	}
+	return addrs
+}
+
+func containsHost(hosts []string, addr string) bool {
+	for _, h := range hosts {
+		if h == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
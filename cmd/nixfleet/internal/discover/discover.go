@@ -0,0 +1,302 @@
+// Package discover probes a network range (or, in principle, a cloud
+// provider's API) for machines that could become inventory hosts: it grabs
+// each responder's SSH host key fingerprint and, when credentials work, its
+// hostname and OS, then diffs the results against the existing inventory so
+// an operator can see what's new, what moved, and what answered from
+// somewhere it shouldn't have - see Diff.
+package discover
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// DefaultConcurrency bounds how many addresses Scan probes at once, so a
+// /16 scan doesn't open thousands of simultaneous SSH handshakes.
+const DefaultConcurrency = 64
+
+// DefaultTimeout is how long Scan waits for each address to answer before
+// giving up on it.
+const DefaultTimeout = 3 * time.Second
+
+// DefaultSSHPort is the port probed on every address when Config.SSHPort is
+// unset.
+const DefaultSSHPort = 22
+
+// Config controls a CIDR scan.
+type Config struct {
+	// CIDR is the network range to probe, e.g. "10.0.7.0/24".
+	CIDR string
+
+	// SSHPort is the port probed on every address. Defaults to 22.
+	SSHPort int
+
+	// SSHUser, if set, is used to attempt an authenticated connection (via
+	// the caller's SSH agent/key files) against every responder, to gather
+	// its hostname and OS. Unauthenticated-only responders still appear in
+	// the result, just without those fields filled in.
+	SSHUser string
+
+	// Timeout bounds each address's probe. Defaults to DefaultTimeout.
+	Timeout time.Duration
+
+	// Concurrency bounds how many addresses are probed at once. Defaults
+	// to DefaultConcurrency.
+	Concurrency int
+}
+
+// Responder is one address that answered an SSH probe.
+type Responder struct {
+	Addr string `json:"addr"`
+
+	// HostKeyFingerprint is the SHA256 fingerprint (as rendered by
+	// ssh.FingerprintSHA256, e.g. "SHA256:abc...") of the host key the
+	// responder presented during the unauthenticated probe.
+	HostKeyFingerprint string `json:"host_key_fingerprint"`
+
+	// Authenticated is true if Config.SSHUser's credentials were accepted,
+	// in which case Hostname and OS were gathered over that session.
+	Authenticated bool   `json:"authenticated"`
+	Hostname      string `json:"hostname,omitempty"`
+	OS            string `json:"os,omitempty"` // "ubuntu", "nixos", "darwin", or "" if undetermined
+}
+
+// Scan expands cfg.CIDR and probes every address concurrently, returning
+// one Responder per address that answered SSH. Addresses that don't answer
+// within cfg.Timeout are silently excluded - a scan of an unused /24 is
+// expected to come back mostly empty.
+func Scan(ctx context.Context, cfg Config) ([]Responder, error) {
+	addrs, err := ExpandCIDR(cfg.CIDR)
+	if err != nil {
+		return nil, fmt.Errorf("expanding CIDR: %w", err)
+	}
+
+	port := cfg.SSHPort
+	if port == 0 {
+		port = DefaultSSHPort
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	sem := make(chan struct{}, concurrency)
+	results := make([]*Responder, len(addrs))
+	var wg sync.WaitGroup
+
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(idx int, addr string) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+
+			results[idx] = probe(ctx, addr, port, cfg.SSHUser, timeout)
+		}(i, addr)
+	}
+	wg.Wait()
+
+	var responders []Responder
+	for _, r := range results {
+		if r != nil {
+			responders = append(responders, *r)
+		}
+	}
+	return responders, nil
+}
+
+// probe checks whether addr:port answers SSH and, if sshUser is set,
+// attempts an authenticated fact-gather. Returns nil if the address didn't
+// answer SSH at all.
+func probe(ctx context.Context, addr string, port int, sshUser string, timeout time.Duration) *Responder {
+	target := net.JoinHostPort(addr, fmt.Sprintf("%d", port))
+
+	var fingerprint string
+	config := &ssh.ClientConfig{
+		User: "nixfleet-discover",
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			fingerprint = ssh.FingerprintSHA256(key)
+			return nil
+		},
+		Timeout: timeout,
+	}
+
+	// Auth is deliberately left empty: this is an unauthenticated banner/
+	// host-key probe, not a login attempt. The handshake completes and
+	// HostKeyCallback fires before the server rejects us for having no
+	// auth methods, so the fingerprint is captured either way.
+	conn, err := ssh.Dial("tcp", target, config)
+	if conn != nil {
+		conn.Close()
+	}
+	if fingerprint == "" {
+		// No host key was ever presented - nothing answered SSH on this
+		// address (connection refused/timed out), as opposed to answering
+		// and then rejecting our (nonexistent) credentials.
+		_ = err
+		return nil
+	}
+
+	responder := &Responder{Addr: addr, HostKeyFingerprint: fingerprint}
+
+	if sshUser != "" {
+		gatherFacts(ctx, addr, port, sshUser, timeout, responder)
+	}
+
+	return responder
+}
+
+// gatherFacts attempts an authenticated connection to addr and, if it
+// succeeds, fills in responder's Hostname and OS. Failure to authenticate
+// or gather facts is not an error - the responder is still reported, just
+// without those fields.
+func gatherFacts(ctx context.Context, addr string, port int, sshUser string, timeout time.Duration, responder *Responder) {
+	client, err := dialAuthenticated(addr, port, sshUser, timeout)
+	if err != nil {
+		return
+	}
+	defer client.Close()
+
+	responder.Authenticated = true
+	responder.Hostname = runTrim(client, "hostname")
+	responder.OS = detectOS(client)
+}
+
+// detectOS runs a minimal, best-effort OS probe: NixOS ships /etc/os-release
+// with ID=nixos; anything else with /etc/os-release reporting "ubuntu" is
+// called "ubuntu"; a bare uname of "Darwin" is called "darwin". Anything
+// else is left empty rather than guessed.
+func detectOS(client *ssh.Client) string {
+	osRelease := runTrim(client, "cat /etc/os-release 2>/dev/null")
+	switch {
+	case strings.Contains(osRelease, "ID=nixos"):
+		return "nixos"
+	case strings.Contains(osRelease, "ID=ubuntu"):
+		return "ubuntu"
+	}
+
+	if runTrim(client, "uname -s 2>/dev/null") == "Darwin" {
+		return "darwin"
+	}
+	return ""
+}
+
+// runTrim runs cmd over an already-authenticated session and returns its
+// trimmed stdout, or "" on any failure.
+func runTrim(client *ssh.Client, cmd string) string {
+	session, err := client.NewSession()
+	if err != nil {
+		return ""
+	}
+	defer session.Close()
+
+	out, err := session.Output(cmd)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// dialAuthenticated opens an SSH connection using whatever agent/key-file
+// credentials are available for sshUser, accepting any host key - a
+// discovery scan has nothing recorded yet to verify against, by
+// definition.
+func dialAuthenticated(addr string, port int, sshUser string, timeout time.Duration) (*ssh.Client, error) {
+	methods := authMethods()
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no authentication methods available")
+	}
+
+	config := &ssh.ClientConfig{
+		User:            sshUser,
+		Auth:            methods,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         timeout,
+	}
+	return ssh.Dial("tcp", net.JoinHostPort(addr, fmt.Sprintf("%d", port)), config)
+}
+
+// authMethods collects whatever credentials are available the same way
+// internal/ssh.DefaultConfig does: the running SSH agent first, then the
+// operator's default key files. A discovery scan doesn't know which host
+// it's about to try, so unlike internal/ssh it can't be pointed at
+// per-host key files via inventory config - only the ambient ones apply.
+func authMethods() []ssh.AuthMethod {
+	var methods []ssh.AuthMethod
+
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+
+	home, _ := os.UserHomeDir()
+	for _, name := range []string{"nixfleet", "id_ed25519", "id_rsa"} {
+		key, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			continue
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+
+	return methods
+}
+
+// ExpandCIDR returns every host address in cidr, in ascending order. The
+// network and broadcast addresses are excluded for IPv4 ranges wider than a
+// /31, matching what's actually assignable to a machine.
+func ExpandCIDR(cidr string) ([]string, error) {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	for cur := ip.Mask(ipNet.Mask); ipNet.Contains(cur); cur = nextIP(cur) {
+		addrs = append(addrs, cur.String())
+	}
+
+	ones, bits := ipNet.Mask.Size()
+	if bits == 32 && bits-ones > 1 && len(addrs) >= 2 {
+		addrs = addrs[1 : len(addrs)-1] // drop network and broadcast
+	}
+
+	// addrs was built by repeatedly incrementing from the network address,
+	// so it's already in ascending order - no separate sort needed.
+	return addrs, nil
+}
+
+// nextIP returns the IP address immediately after ip.
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
@@ -0,0 +1,107 @@
+package discover
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+)
+
+func TestExpandCIDR(t *testing.T) {
+	tests := []struct {
+		cidr string
+		want []string
+	}{
+		{"10.0.7.0/30", []string{"10.0.7.1", "10.0.7.2"}}, // network/broadcast excluded
+		{"10.0.7.0/31", []string{"10.0.7.0", "10.0.7.1"}}, // point-to-point, nothing excluded
+		{"10.0.7.4/32", []string{"10.0.7.4"}},             // single host
+		{"10.0.7.0/29", []string{"10.0.7.1", "10.0.7.2", "10.0.7.3", "10.0.7.4", "10.0.7.5", "10.0.7.6"}},
+	}
+	for _, tt := range tests {
+		got, err := ExpandCIDR(tt.cidr)
+		if err != nil {
+			t.Fatalf("ExpandCIDR(%q) error: %v", tt.cidr, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ExpandCIDR(%q) = %v, want %v", tt.cidr, got, tt.want)
+		}
+	}
+}
+
+func TestExpandCIDRInvalid(t *testing.T) {
+	if _, err := ExpandCIDR("not-a-cidr"); err == nil {
+		t.Error("expected an error for an invalid CIDR")
+	}
+}
+
+func TestDiffAgainstInventoryNewHost(t *testing.T) {
+	inv := inventory.NewInventory()
+	inv.Hosts["web-1"] = &inventory.Host{Name: "web-1", Base: "ubuntu", Addr: "10.0.7.10"}
+
+	responders := []Responder{
+		{Addr: "10.0.7.10", HostKeyFingerprint: "SHA256:known"}, // matches inventory by address
+		{Addr: "10.0.7.20", HostKeyFingerprint: "SHA256:new", Hostname: "db-1.internal"},
+	}
+
+	diff := DiffAgainstInventory(inv, responders, "/nonexistent/known_hosts")
+
+	if len(diff.New) != 1 || diff.New[0].Name != "db-1" || diff.New[0].Addr != "10.0.7.20" {
+		t.Errorf("New = %+v, want one proposed host named db-1 at 10.0.7.20", diff.New)
+	}
+	if len(diff.Moved) != 0 {
+		t.Errorf("Moved = %+v, want none", diff.Moved)
+	}
+	if len(diff.Unexpected) != 0 {
+		t.Errorf("Unexpected = %+v, want none (no known_hosts to contradict the match)", diff.Unexpected)
+	}
+}
+
+func TestDiffAgainstInventoryMovedAndUnexpected(t *testing.T) {
+	inv := inventory.NewInventory()
+	inv.Hosts["web-1"] = &inventory.Host{Name: "web-1", Base: "ubuntu", Addr: "10.0.7.10"}
+
+	entries := []knownHostEntry{
+		{hosts: []string{"10.0.7.10"}, fingerprint: "SHA256:original"},
+	}
+
+	t.Run("moved", func(t *testing.T) {
+		responders := []Responder{{Addr: "10.0.7.99", HostKeyFingerprint: "SHA256:original"}}
+		diff := diffWithEntries(inv, responders, entries)
+		if len(diff.Moved) != 1 || diff.Moved[0].Name != "web-1" || diff.Moved[0].NewAddr != "10.0.7.99" {
+			t.Errorf("Moved = %+v, want web-1 moved to 10.0.7.99", diff.Moved)
+		}
+	})
+
+	t.Run("unexpected", func(t *testing.T) {
+		responders := []Responder{{Addr: "10.0.7.10", HostKeyFingerprint: "SHA256:different"}}
+		diff := diffWithEntries(inv, responders, entries)
+		if len(diff.Unexpected) != 1 || diff.Unexpected[0].Name != "web-1" {
+			t.Errorf("Unexpected = %+v, want web-1 flagged", diff.Unexpected)
+		}
+	})
+}
+
+// diffWithEntries runs the same matching logic DiffAgainstInventory does,
+// against an in-memory known_hosts entry list rather than a file on disk.
+func diffWithEntries(inv *inventory.Inventory, responders []Responder, entries []knownHostEntry) *Diff {
+	byAddr := make(map[string]*inventory.Host)
+	for _, h := range inv.AllHosts() {
+		byAddr[h.Addr] = h
+	}
+
+	diff := &Diff{}
+	for _, r := range responders {
+		if host, ok := byAddr[r.Addr]; ok {
+			if expected := fingerprintsForHost(entries, r.Addr); len(expected) > 0 && !contains(expected, r.HostKeyFingerprint) {
+				diff.Unexpected = append(diff.Unexpected, UnexpectedHost{Name: host.Name, Addr: r.Addr})
+			}
+			continue
+		}
+		if moved, ok := findMoved(entries, byAddr, r); ok {
+			diff.Moved = append(diff.Moved, moved)
+			continue
+		}
+		diff.New = append(diff.New, ProposedHost{Name: suggestName(r), Addr: r.Addr})
+	}
+	return diff
+}
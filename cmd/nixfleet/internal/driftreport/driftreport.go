@@ -0,0 +1,358 @@
+// Package driftreport tracks, per host, a history of drift checks and the
+// paths they found drifted, and aggregates that into fleet-level trend
+// metrics for GET /api/drift/report and 'nixfleet drift report': which
+// hosts and files drift repeatedly, how long drift typically sits before
+// being resolved, and what's currently unresolved.
+package driftreport
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxRetainedEvents bounds how much history a single host's record keeps.
+// CheckEvents fill in one per drift check, far more often than
+// compliance's one-per-day samples, so without a cap a host checked every
+// few minutes for months would grow its record file without bound.
+const maxRetainedEvents = 500
+
+// CheckEvent is one drift check against a host, recording which managed
+// paths (if any) were found drifted.
+type CheckEvent struct {
+	Time         time.Time `json:"time"`
+	DriftedPaths []string  `json:"drifted_paths,omitempty"`
+}
+
+// ResolvedDrift is one path's drift lifecycle, from first detection to the
+// check that no longer found it drifted.
+type ResolvedDrift struct {
+	Path       string    `json:"path"`
+	DetectedAt time.Time `json:"detected_at"`
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
+// HostRecord is one host's drift history: Checks is the raw event log (the
+// source of truth for frequency and "chronic" trends), Open is the live
+// set of currently-unresolved drifted paths keyed by when each was first
+// detected, and Resolved is the completed lifecycle of everything that's
+// since cleared - the source of truth for mean time to resolution.
+type HostRecord struct {
+	Checks   []CheckEvent         `json:"checks"`
+	Open     map[string]time.Time `json:"open"`
+	Resolved []ResolvedDrift      `json:"resolved"`
+}
+
+// Store persists every host's HostRecord in a single JSON file under the
+// server's data dir, following the same one-file-of-everything shape as
+// compliance.Store.
+type Store struct {
+	path string
+
+	mu    sync.RWMutex
+	hosts map[string]*HostRecord
+}
+
+// NewStore creates a store that persists under dataDir, loading any
+// existing history immediately.
+func NewStore(dataDir string) *Store {
+	s := &Store{
+		path:  filepath.Join(dataDir, "drift-history.json"),
+		hosts: make(map[string]*HostRecord),
+	}
+	s.load()
+	return s
+}
+
+func (s *Store) load() {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return
+	}
+	var hosts map[string]*HostRecord
+	if err := json.Unmarshal(data, &hosts); err != nil {
+		log.Printf("driftreport.Store: failed to load state: %v", err)
+		return
+	}
+	s.mu.Lock()
+	s.hosts = hosts
+	s.mu.Unlock()
+}
+
+func (s *Store) save() {
+	s.mu.RLock()
+	data, err := json.MarshalIndent(s.hosts, "", "  ")
+	s.mu.RUnlock()
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		log.Printf("driftreport.Store: failed to create data dir: %v", err)
+		return
+	}
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		log.Printf("driftreport.Store: failed to save state: %v", err)
+	}
+}
+
+// Record appends a drift check result for host: any newly-drifted path
+// starts its Open clock, anything previously open that's no longer
+// reported is moved to Resolved with its detected-to-resolved duration,
+// and the check itself is appended to Checks. Both Checks and Resolved are
+// trimmed to maxRetainedEvents, keeping the most recent.
+func (s *Store) Record(host string, now time.Time, driftedPaths []string) {
+	s.mu.Lock()
+	rec, ok := s.hosts[host]
+	if !ok {
+		rec = &HostRecord{Open: make(map[string]time.Time)}
+		s.hosts[host] = rec
+	}
+	if rec.Open == nil {
+		rec.Open = make(map[string]time.Time)
+	}
+
+	current := make(map[string]bool, len(driftedPaths))
+	for _, p := range driftedPaths {
+		current[p] = true
+		if _, already := rec.Open[p]; !already {
+			rec.Open[p] = now
+		}
+	}
+	for path, detectedAt := range rec.Open {
+		if !current[path] {
+			rec.Resolved = append(rec.Resolved, ResolvedDrift{
+				Path:       path,
+				DetectedAt: detectedAt,
+				ResolvedAt: now,
+			})
+			delete(rec.Open, path)
+		}
+	}
+
+	rec.Checks = append(rec.Checks, CheckEvent{Time: now, DriftedPaths: driftedPaths})
+	if n := len(rec.Checks); n > maxRetainedEvents {
+		rec.Checks = rec.Checks[n-maxRetainedEvents:]
+	}
+	if n := len(rec.Resolved); n > maxRetainedEvents {
+		rec.Resolved = rec.Resolved[n-maxRetainedEvents:]
+	}
+
+	s.mu.Unlock()
+	s.save()
+}
+
+// Hosts returns the names of every host with a recorded drift history.
+func (s *Store) Hosts() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.hosts))
+	for name := range s.hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Store) hostRecord(host string) (*HostRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.hosts[host]
+	return rec, ok
+}
+
+// recentChronicWindow is how many of a host's most recent checks "chronic"
+// looks back across, and chronicThreshold is how many of those need to
+// have found drift for the host to be flagged - both taken directly from
+// the "drifted in >=3 of the last 5 checks" definition this package is
+// built to surface.
+const (
+	recentChronicWindow = 5
+	chronicThreshold    = 3
+)
+
+// OpenDriftEntry is one currently-unresolved drifted path, with its age as
+// of the report's generation time.
+type OpenDriftEntry struct {
+	Path       string    `json:"path"`
+	DetectedAt time.Time `json:"detected_at"`
+	AgeHours   float64   `json:"age_hours"`
+}
+
+// HostReport is one host's drift standing over the report window.
+type HostReport struct {
+	Host                      string           `json:"host"`
+	ChecksInWindow            int              `json:"checks_in_window"`
+	DriftedChecksInWindow     int              `json:"drifted_checks_in_window"`
+	DriftFrequencyPercent     float64          `json:"drift_frequency_percent"`
+	RecentDriftCount          int              `json:"recent_drift_count"` // out of the last recentChronicWindow checks
+	Chronic                   bool             `json:"chronic"`
+	MeanTimeToResolutionHours float64          `json:"mean_time_to_resolution_hours"`
+	OpenDrift                 []OpenDriftEntry `json:"open_drift,omitempty"`
+}
+
+// FileReport is one managed path's drift standing across the fleet over
+// the report window.
+type FileReport struct {
+	Path       string   `json:"path"`
+	DriftCount int      `json:"drift_count"`
+	Hosts      []string `json:"hosts"`
+}
+
+// Report is the fleet-wide drift trend picture returned by GET
+// /api/drift/report and 'nixfleet drift report'.
+type Report struct {
+	Window                    string       `json:"window"`
+	GeneratedAt               time.Time    `json:"generated_at"`
+	Hosts                     []HostReport `json:"hosts"` // ranked by drift frequency, most first
+	Files                     []FileReport `json:"files"` // ranked by drift count, most first
+	MeanTimeToResolutionHours float64      `json:"mean_time_to_resolution_hours"`
+	UnresolvedCount           int          `json:"unresolved_count"`
+	ChronicHosts              []string     `json:"chronic_hosts,omitempty"`
+}
+
+// ComputeReport aggregates store's history into a Report over window, as
+// of now. hosts lists every inventory host to report on, so a host with no
+// recorded history yet still appears (with zero checks) rather than
+// silently missing. "Chronic" and the list of currently-open drift ignore
+// window - they describe the host's current standing, not a historical
+// range - while everything else (frequency, file ranking, mean time to
+// resolution) is scoped to window.
+func ComputeReport(store *Store, hosts []string, now time.Time, window time.Duration) Report {
+	r := Report{
+		Window:      window.String(),
+		GeneratedAt: now,
+	}
+
+	cutoff := now.Add(-window)
+	fileCounts := make(map[string]int)
+	fileHosts := make(map[string]map[string]bool)
+
+	sorted := append([]string(nil), hosts...)
+	sort.Strings(sorted)
+
+	var mttrTotal float64
+	var mttrCount int
+
+	for _, host := range sorted {
+		rec, _ := store.hostRecord(host)
+		hr := HostReport{Host: host}
+
+		if rec != nil {
+			for _, check := range rec.Checks {
+				if check.Time.Before(cutoff) {
+					continue
+				}
+				hr.ChecksInWindow++
+				if len(check.DriftedPaths) > 0 {
+					hr.DriftedChecksInWindow++
+				}
+				for _, p := range check.DriftedPaths {
+					fileCounts[p]++
+					if fileHosts[p] == nil {
+						fileHosts[p] = make(map[string]bool)
+					}
+					fileHosts[p][host] = true
+				}
+			}
+			if hr.ChecksInWindow > 0 {
+				hr.DriftFrequencyPercent = 100 * float64(hr.DriftedChecksInWindow) / float64(hr.ChecksInWindow)
+			}
+
+			recent := rec.Checks
+			if n := len(recent); n > recentChronicWindow {
+				recent = recent[n-recentChronicWindow:]
+			}
+			for _, check := range recent {
+				if len(check.DriftedPaths) > 0 {
+					hr.RecentDriftCount++
+				}
+			}
+			hr.Chronic = hr.RecentDriftCount >= chronicThreshold
+
+			for path, detectedAt := range rec.Open {
+				hr.OpenDrift = append(hr.OpenDrift, OpenDriftEntry{
+					Path:       path,
+					DetectedAt: detectedAt,
+					AgeHours:   now.Sub(detectedAt).Hours(),
+				})
+			}
+			sort.Slice(hr.OpenDrift, func(i, j int) bool { return hr.OpenDrift[i].Path < hr.OpenDrift[j].Path })
+			r.UnresolvedCount += len(hr.OpenDrift)
+
+			var hostResolvedCount int
+			for _, res := range rec.Resolved {
+				if res.ResolvedAt.Before(cutoff) {
+					continue
+				}
+				hours := res.ResolvedAt.Sub(res.DetectedAt).Hours()
+				hr.MeanTimeToResolutionHours += hours
+				hostResolvedCount++
+				mttrTotal += hours
+				mttrCount++
+			}
+			if hostResolvedCount > 0 {
+				hr.MeanTimeToResolutionHours /= float64(hostResolvedCount)
+			}
+		}
+
+		r.Hosts = append(r.Hosts, hr)
+		if hr.Chronic {
+			r.ChronicHosts = append(r.ChronicHosts, host)
+		}
+	}
+
+	sort.SliceStable(r.Hosts, func(i, j int) bool {
+		return r.Hosts[i].DriftFrequencyPercent > r.Hosts[j].DriftFrequencyPercent
+	})
+
+	for path, count := range fileCounts {
+		hostsForFile := make([]string, 0, len(fileHosts[path]))
+		for h := range fileHosts[path] {
+			hostsForFile = append(hostsForFile, h)
+		}
+		sort.Strings(hostsForFile)
+		r.Files = append(r.Files, FileReport{Path: path, DriftCount: count, Hosts: hostsForFile})
+	}
+	sort.SliceStable(r.Files, func(i, j int) bool {
+		if r.Files[i].DriftCount != r.Files[j].DriftCount {
+			return r.Files[i].DriftCount > r.Files[j].DriftCount
+		}
+		return r.Files[i].Path < r.Files[j].Path
+	})
+
+	if mttrCount > 0 {
+		r.MeanTimeToResolutionHours = mttrTotal / float64(mttrCount)
+	}
+
+	return r
+}
+
+// ParseWindow parses a duration string like "30d" (a unit go's
+// time.ParseDuration doesn't support) in addition to anything
+// time.ParseDuration accepts, mirroring compliance.ParseWindow.
+func ParseWindow(s string) (time.Duration, error) {
+	if s == "" {
+		return 30 * 24 * time.Hour, nil
+	}
+	if days, ok := trimSuffix(s, "d"); ok {
+		var n int
+		if _, err := fmt.Sscanf(days, "%d", &n); err != nil {
+			return 0, fmt.Errorf("invalid window %q: %w", s, err)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func trimSuffix(s, suffix string) (string, bool) {
+	if len(s) > len(suffix) && s[len(s)-len(suffix):] == suffix {
+		return s[:len(s)-len(suffix)], true
+	}
+	return "", false
+}
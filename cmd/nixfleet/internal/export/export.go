@@ -0,0 +1,293 @@
+// Package export assembles the fleet's inventory and live state into a
+// stable, per-host row for the CMDB feed - the `nixfleet export` command
+// and the server's GET /api/export endpoint share this so the two never
+// drift apart on column names or merge behavior.
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+	"github.com/nixfleet/nixfleet/internal/osupdate"
+	"github.com/nixfleet/nixfleet/internal/pki"
+	"github.com/nixfleet/nixfleet/internal/ssh"
+	"github.com/nixfleet/nixfleet/internal/state"
+)
+
+// Columns is the stable, ordered set of export column keys. New columns
+// must be appended, not inserted, so a fixed --fields list a downstream
+// consumer wrote down keeps meaning the same thing.
+var Columns = []string{
+	"hostname",
+	"addr",
+	"base",
+	"roles",
+	"online",
+	"generation",
+	"last_apply",
+	"pending_updates",
+	"security_updates",
+	"drift_detected",
+	"cert_days_left",
+	"os_release",
+	"eol_date",
+	"days_until_eol",
+}
+
+// Row is one host's worth of export data. Fields default to their zero
+// value when a host is unreachable or has no certificate on file, rather
+// than the row being dropped.
+type Row struct {
+	Hostname        string
+	Addr            string
+	Base            string
+	Roles           []string
+	Online          bool
+	Generation      int
+	LastApply       time.Time
+	PendingUpdates  int
+	SecurityUpdates int
+	DriftDetected   bool
+	CertDaysLeft    *int
+	OSRelease       string // e.g., "24.04", blank if the host's OS info hasn't been gathered yet
+	EOLDate         *time.Time
+	DaysUntilEOL    *int
+}
+
+// Value renders column into its CSV/display string form. Unknown columns
+// render as "".
+func (r Row) Value(column string) string {
+	switch column {
+	case "hostname":
+		return r.Hostname
+	case "addr":
+		return r.Addr
+	case "base":
+		return r.Base
+	case "roles":
+		return strings.Join(r.Roles, ";")
+	case "online":
+		return strconv.FormatBool(r.Online)
+	case "generation":
+		if r.Generation == 0 {
+			return ""
+		}
+		return strconv.Itoa(r.Generation)
+	case "last_apply":
+		if r.LastApply.IsZero() {
+			return ""
+		}
+		return r.LastApply.Format(time.RFC3339)
+	case "pending_updates":
+		return strconv.Itoa(r.PendingUpdates)
+	case "security_updates":
+		return strconv.Itoa(r.SecurityUpdates)
+	case "drift_detected":
+		return strconv.FormatBool(r.DriftDetected)
+	case "cert_days_left":
+		if r.CertDaysLeft == nil {
+			return ""
+		}
+		return strconv.Itoa(*r.CertDaysLeft)
+	case "os_release":
+		return r.OSRelease
+	case "eol_date":
+		if r.EOLDate == nil {
+			return ""
+		}
+		return r.EOLDate.Format("2006-01-02")
+	case "days_until_eol":
+		if r.DaysUntilEOL == nil {
+			return ""
+		}
+		return strconv.Itoa(*r.DaysUntilEOL)
+	default:
+		return ""
+	}
+}
+
+// JSONValue renders column as a typed JSON value (bool/number/string
+// instead of Value's string-for-everything), so `format=json` output is
+// consumable without the caller re-parsing "true"/"42" back out.
+func (r Row) JSONValue(column string) any {
+	switch column {
+	case "roles":
+		return r.Roles
+	case "online":
+		return r.Online
+	case "generation":
+		return r.Generation
+	case "last_apply":
+		if r.LastApply.IsZero() {
+			return nil
+		}
+		return r.LastApply.Format(time.RFC3339)
+	case "pending_updates":
+		return r.PendingUpdates
+	case "security_updates":
+		return r.SecurityUpdates
+	case "drift_detected":
+		return r.DriftDetected
+	case "cert_days_left":
+		if r.CertDaysLeft == nil {
+			return nil
+		}
+		return *r.CertDaysLeft
+	case "eol_date":
+		if r.EOLDate == nil {
+			return nil
+		}
+		return r.EOLDate.Format("2006-01-02")
+	case "days_until_eol":
+		if r.DaysUntilEOL == nil {
+			return nil
+		}
+		return *r.DaysUntilEOL
+	default:
+		return r.Value(column)
+	}
+}
+
+// ValidateFields checks that every requested column is known, so a typo in
+// ?fields= fails fast instead of silently rendering an empty column.
+func ValidateFields(fields []string) error {
+	known := make(map[string]bool, len(Columns))
+	for _, c := range Columns {
+		known[c] = true
+	}
+	for _, f := range fields {
+		if !known[f] {
+			return fmt.Errorf("unknown export field %q (known: %s)", f, strings.Join(Columns, ", "))
+		}
+	}
+	return nil
+}
+
+// Gatherer merges inventory, live SSH-gathered state, and PKI certificate
+// info into export Rows. A host that can't be reached still gets a Row
+// with its inventory fields set and everything else blank.
+type Gatherer struct {
+	Pool         *ssh.Pool
+	StateMgr     *state.Manager
+	PKIStore     *pki.Store // nil disables the cert_days_left column
+	EOLOverrides map[string]time.Time
+}
+
+// NewGatherer creates a Gatherer. pkiStore may be nil. eolOverrides is
+// inventory.Inventory.EOLOverrides; it may also be nil.
+func NewGatherer(pool *ssh.Pool, stateMgr *state.Manager, pkiStore *pki.Store, eolOverrides map[string]time.Time) *Gatherer {
+	return &Gatherer{Pool: pool, StateMgr: stateMgr, PKIStore: pkiStore, EOLOverrides: eolOverrides}
+}
+
+// Row assembles the export row for a single host.
+func (g *Gatherer) Row(ctx context.Context, host *inventory.Host) Row {
+	row := Row{
+		Hostname: host.Name,
+		Addr:     host.Addr,
+		Base:     host.Base,
+		Roles:    host.Roles,
+	}
+
+	if g.PKIStore != nil {
+		if info, err := g.PKIStore.GetCertInfo(host.Name); err == nil {
+			days := info.DaysLeft
+			row.CertDaysLeft = &days
+		}
+	}
+
+	client, err := g.Pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+	if err != nil {
+		return row
+	}
+	row.Online = true
+
+	if hostState, err := g.StateMgr.ReadState(ctx, client); err == nil {
+		row.Generation = hostState.CurrentGeneration
+		row.LastApply = hostState.LastApply
+		row.PendingUpdates = hostState.PendingUpdates
+		row.SecurityUpdates = hostState.SecurityUpdates
+		row.DriftDetected = hostState.DriftDetected
+
+		if hostState.OSInfo != nil {
+			row.OSRelease = hostState.OSInfo.VersionID
+			// Recomputed against the current EOLOverrides rather than trusting
+			// hostState's cached EOL, which may predate a config change.
+			if eol := osupdate.ComputeEOLStatus(hostState.OSInfo.VersionID, g.EOLOverrides, time.Now()); eol != nil {
+				row.EOLDate = &eol.EOLDate
+				row.DaysUntilEOL = &eol.DaysUntilEOL
+			}
+		}
+	}
+
+	return row
+}
+
+// WriteCSV streams one CSV row per host, flushing after each row instead
+// of buffering the whole document - the reason this whole package doesn't
+// just build a []Row up front and hand it to a template.
+func WriteCSV(w io.Writer, hosts []*inventory.Host, fields []string, rowFn func(*inventory.Host) Row) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(fields); err != nil {
+		return err
+	}
+	cw.Flush()
+
+	for _, host := range hosts {
+		row := rowFn(host)
+		record := make([]string, len(fields))
+		for i, f := range fields {
+			record[i] = row.Value(f)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON streams a JSON array, one object per host, marshaling and
+// flushing each row as it's gathered rather than building the full array
+// in memory first.
+func WriteJSON(w io.Writer, hosts []*inventory.Host, fields []string, rowFn func(*inventory.Host) Row) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	for i, host := range hosts {
+		row := rowFn(host)
+		obj := make(map[string]any, len(fields))
+		for _, f := range fields {
+			obj[f] = row.JSONValue(f)
+		}
+
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		if f, ok := w.(interface{ Flush() }); ok {
+			f.Flush()
+		}
+	}
+
+	_, err := io.WriteString(w, "]")
+	return err
+}
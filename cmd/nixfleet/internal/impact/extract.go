@@ -0,0 +1,70 @@
+package impact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ManifestForStorePath extracts a ClosureManifest directly from a built
+// closure's store path on the local Nix store: every top-level systemd unit
+// file it installs, by content hash, plus - for a NixOS closure - the
+// kernel/initrd it would boot and its kernel command line. Callers already
+// assume storePath exists locally (nix.Evaluator.DiffClosures makes the
+// same assumption of both paths it compares).
+//
+// A closure with no /etc/systemd/system directory (e.g. a bare Ubuntu
+// closure with no managed units yet) isn't an error - it just has no units.
+func ManifestForStorePath(storePath, base string) (ClosureManifest, error) {
+	m := ClosureManifest{Units: make(map[string]string)}
+
+	unitDir := filepath.Join(storePath, "etc", "systemd", "system")
+	entries, err := os.ReadDir(unitDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manifestWithBoot(m, storePath, base), nil
+		}
+		return m, fmt.Errorf("reading %s: %w", unitDir, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".service") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(unitDir, entry.Name()))
+		if err != nil {
+			// A dangling symlink (target since garbage-collected) or a
+			// permission error on one unit shouldn't block classifying the
+			// rest of the closure.
+			continue
+		}
+		sum := sha256.Sum256(content)
+		m.Units[entry.Name()] = hex.EncodeToString(sum[:])
+	}
+
+	return manifestWithBoot(m, storePath, base), nil
+}
+
+// manifestWithBoot fills in the NixOS-only boot fields of m. Ubuntu closures
+// have no kernel/initrd of their own - nixfleet never manages the host
+// kernel there - so m is returned unchanged for any base other than nixos.
+func manifestWithBoot(m ClosureManifest, storePath, base string) ClosureManifest {
+	if base != "nixos" {
+		return m
+	}
+
+	if kernel, err := os.Readlink(filepath.Join(storePath, "kernel")); err == nil {
+		m.Kernel = kernel
+	}
+	if initrd, err := os.Readlink(filepath.Join(storePath, "initrd")); err == nil {
+		m.Initrd = initrd
+	}
+	if params, err := os.ReadFile(filepath.Join(storePath, "kernel-params")); err == nil {
+		m.BootParams = strings.TrimSpace(string(params))
+	}
+
+	return m
+}
@@ -0,0 +1,135 @@
+// Package impact classifies how disruptive an apply will be to a host,
+// by comparing the closure about to be deployed against the one already
+// running: whether it only touches configuration nothing is watching,
+// whether it restarts specific systemd units, or whether it changes the
+// kernel/initrd/boot parameters and so implies a reboot. It exists so
+// 'nixfleet plan'/'apply' and the server's plan API can warn an operator
+// before they bounce PostgreSQL by accident.
+package impact
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Level classifies the disruption an apply causes, ordered from least to
+// most disruptive.
+type Level string
+
+const (
+	// ConfigOnly means no unit definitions, kernel, initrd, or boot
+	// parameters changed - the new closure only affects files nothing
+	// restarts as a result.
+	ConfigOnly Level = "config-only"
+	// ServiceRestart means one or more systemd units changed, were added,
+	// or were removed, and will be (re)started when the closure activates.
+	ServiceRestart Level = "service-restart"
+	// RebootRequired means the kernel, initrd, or kernel command line
+	// changed, so the new closure won't take full effect until the host
+	// reboots.
+	RebootRequired Level = "reboot-required"
+)
+
+// ClosureManifest is the subset of a built closure's contents relevant to
+// impact analysis: the systemd units it installs, keyed by unit file name
+// and valued by a content hash, plus (NixOS only) the kernel/initrd it
+// would boot and its kernel command line. See ManifestForStorePath.
+type ClosureManifest struct {
+	Units      map[string]string
+	Kernel     string
+	Initrd     string
+	BootParams string
+}
+
+// Assessment is the result of comparing two closures for one host.
+type Assessment struct {
+	Level Level
+
+	// ChangedUnits lists every unit whose definition changed, was added, or
+	// was removed, sorted by name. Non-empty whenever Level is
+	// ServiceRestart or RebootRequired (a reboot restarts everything, but
+	// this still names what would otherwise have needed an explicit
+	// restart).
+	ChangedUnits []string
+
+	// RebootReasons explains, in order, why Level is RebootRequired. Empty
+	// otherwise.
+	RebootReasons []string
+
+	// CriticalUnits is the subset of ChangedUnits that appear in the
+	// inventory's critical_units list. A non-empty CriticalUnits means the
+	// confirmation prompt should escalate - see Escalate.
+	CriticalUnits []string
+}
+
+// Escalate reports whether confirming this apply should require typing the
+// host name rather than a plain yes/no, because it would restart a unit the
+// inventory marks critical.
+func (a Assessment) Escalate() bool {
+	return len(a.CriticalUnits) > 0
+}
+
+// Classify compares current (the closure already deployed) against desired
+// (the closure about to be deployed) and classifies the impact.
+// criticalUnits is the inventory's fleet-wide list (Inventory.CriticalUnits);
+// any changed unit that appears in it is called out in
+// Assessment.CriticalUnits.
+func Classify(current, desired ClosureManifest, criticalUnits []string) Assessment {
+	var reasons []string
+	if current.Kernel != "" && desired.Kernel != "" && current.Kernel != desired.Kernel {
+		reasons = append(reasons, fmt.Sprintf("kernel changed: %s -> %s", current.Kernel, desired.Kernel))
+	}
+	if current.Initrd != "" && desired.Initrd != "" && current.Initrd != desired.Initrd {
+		reasons = append(reasons, fmt.Sprintf("initrd changed: %s -> %s", current.Initrd, desired.Initrd))
+	}
+	if current.BootParams != desired.BootParams && (current.BootParams != "" || desired.BootParams != "") {
+		reasons = append(reasons, fmt.Sprintf("kernel parameters changed: %q -> %q", current.BootParams, desired.BootParams))
+	}
+
+	changed := changedUnits(current.Units, desired.Units)
+
+	critical := make(map[string]bool, len(criticalUnits))
+	for _, u := range criticalUnits {
+		critical[u] = true
+	}
+	var criticalChanged []string
+	for _, u := range changed {
+		if critical[u] {
+			criticalChanged = append(criticalChanged, u)
+		}
+	}
+
+	level := ConfigOnly
+	switch {
+	case len(reasons) > 0:
+		level = RebootRequired
+	case len(changed) > 0:
+		level = ServiceRestart
+	}
+
+	return Assessment{
+		Level:         level,
+		ChangedUnits:  changed,
+		RebootReasons: reasons,
+		CriticalUnits: criticalChanged,
+	}
+}
+
+// changedUnits returns the names of units whose content hash differs
+// between current and desired, or that exist in only one of the two,
+// sorted.
+func changedUnits(current, desired map[string]string) []string {
+	var changed []string
+	for name, hash := range desired {
+		if oldHash, ok := current[name]; !ok || oldHash != hash {
+			changed = append(changed, name)
+		}
+	}
+	for name := range current {
+		if _, ok := desired[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,103 @@
+package impact
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifyConfigOnly(t *testing.T) {
+	m := ClosureManifest{Units: map[string]string{"app.service": "hash-a"}, Kernel: "/nix/store/aaa-kernel"}
+	a := Classify(m, m, nil)
+	if a.Level != ConfigOnly {
+		t.Fatalf("Level = %v, want %v", a.Level, ConfigOnly)
+	}
+	if len(a.ChangedUnits) != 0 || len(a.RebootReasons) != 0 || a.Escalate() {
+		t.Fatalf("expected no changes for identical manifests, got %+v", a)
+	}
+}
+
+func TestClassifyServiceRestart(t *testing.T) {
+	current := ClosureManifest{Units: map[string]string{"app.service": "hash-a", "cron.service": "hash-c"}}
+	desired := ClosureManifest{Units: map[string]string{"app.service": "hash-b", "cron.service": "hash-c"}}
+
+	a := Classify(current, desired, nil)
+	if a.Level != ServiceRestart {
+		t.Fatalf("Level = %v, want %v", a.Level, ServiceRestart)
+	}
+	if !reflect.DeepEqual(a.ChangedUnits, []string{"app.service"}) {
+		t.Fatalf("ChangedUnits = %v, want [app.service]", a.ChangedUnits)
+	}
+	if a.Escalate() {
+		t.Fatalf("expected no escalation without a critical unit list, got %+v", a)
+	}
+}
+
+func TestClassifyUnitAddedAndRemoved(t *testing.T) {
+	current := ClosureManifest{Units: map[string]string{"old.service": "hash-a"}}
+	desired := ClosureManifest{Units: map[string]string{"new.service": "hash-b"}}
+
+	a := Classify(current, desired, nil)
+	if a.Level != ServiceRestart {
+		t.Fatalf("Level = %v, want %v", a.Level, ServiceRestart)
+	}
+	if !reflect.DeepEqual(a.ChangedUnits, []string{"new.service", "old.service"}) {
+		t.Fatalf("ChangedUnits = %v, want [new.service old.service]", a.ChangedUnits)
+	}
+}
+
+func TestClassifyRebootRequired(t *testing.T) {
+	current := ClosureManifest{
+		Units:  map[string]string{"app.service": "hash-a"},
+		Kernel: "/nix/store/aaa-linux-6.6",
+		Initrd: "/nix/store/aaa-initrd",
+	}
+	desired := ClosureManifest{
+		Units:  map[string]string{"app.service": "hash-a"},
+		Kernel: "/nix/store/bbb-linux-6.7",
+		Initrd: "/nix/store/aaa-initrd",
+	}
+
+	a := Classify(current, desired, nil)
+	if a.Level != RebootRequired {
+		t.Fatalf("Level = %v, want %v", a.Level, RebootRequired)
+	}
+	if len(a.RebootReasons) != 1 {
+		t.Fatalf("RebootReasons = %v, want exactly one reason", a.RebootReasons)
+	}
+}
+
+func TestClassifyRebootTakesPriorityOverServiceRestart(t *testing.T) {
+	current := ClosureManifest{Units: map[string]string{"app.service": "hash-a"}, Kernel: "old"}
+	desired := ClosureManifest{Units: map[string]string{"app.service": "hash-b"}, Kernel: "new"}
+
+	a := Classify(current, desired, nil)
+	if a.Level != RebootRequired {
+		t.Fatalf("Level = %v, want %v (reboot should win even when units also changed)", a.Level, RebootRequired)
+	}
+	if len(a.ChangedUnits) != 1 {
+		t.Fatalf("ChangedUnits = %v, want the restarting unit still listed", a.ChangedUnits)
+	}
+}
+
+func TestClassifyEscalatesCriticalUnits(t *testing.T) {
+	current := ClosureManifest{Units: map[string]string{"postgresql.service": "hash-a", "app.service": "hash-x"}}
+	desired := ClosureManifest{Units: map[string]string{"postgresql.service": "hash-b", "app.service": "hash-x"}}
+
+	a := Classify(current, desired, []string{"postgresql.service"})
+	if !a.Escalate() {
+		t.Fatalf("expected escalation when a critical unit restarts, got %+v", a)
+	}
+	if !reflect.DeepEqual(a.CriticalUnits, []string{"postgresql.service"}) {
+		t.Fatalf("CriticalUnits = %v, want [postgresql.service]", a.CriticalUnits)
+	}
+}
+
+func TestClassifyNoEscalationWhenCriticalUnitUnchanged(t *testing.T) {
+	current := ClosureManifest{Units: map[string]string{"postgresql.service": "hash-a", "app.service": "hash-x"}}
+	desired := ClosureManifest{Units: map[string]string{"postgresql.service": "hash-a", "app.service": "hash-y"}}
+
+	a := Classify(current, desired, []string{"postgresql.service"})
+	if a.Escalate() {
+		t.Fatalf("expected no escalation when the critical unit itself didn't change, got %+v", a)
+	}
+}
@@ -1,6 +1,7 @@
 package inventory
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -361,3 +362,349 @@ func TestValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildLeader(t *testing.T) {
+	inv := NewInventory()
+
+	if _, ok := inv.BuildLeader(); ok {
+		t.Error("Expected no build leader in an empty inventory")
+	}
+
+	inv.Hosts["web1"] = &Host{Name: "web1", Base: "ubuntu"}
+	inv.Hosts["build1"] = &Host{Name: "build1", Base: "nixos", PullBuildLeader: true}
+
+	leader, ok := inv.BuildLeader()
+	if !ok {
+		t.Fatal("Expected to find a build leader")
+	}
+	if leader.Name != "build1" {
+		t.Errorf("Expected leader 'build1', got %q", leader.Name)
+	}
+}
+
+func TestComputeStages(t *testing.T) {
+	inv := NewInventory()
+	inv.Hosts["db1"] = &Host{Name: "db1", Base: "nixos"}
+	inv.Hosts["app1"] = &Host{Name: "app1", Base: "ubuntu"}
+	inv.Hosts["app2"] = &Host{Name: "app2", Base: "ubuntu"}
+	inv.Hosts["misc1"] = &Host{Name: "misc1", Base: "ubuntu"}
+	inv.Groups["db"] = &Group{Name: "db", Hosts: []string{"db1"}}
+	inv.Groups["app"] = &Group{Name: "app", Hosts: []string{"app1", "app2"}}
+
+	hosts := inv.AllHosts()
+
+	// No order: everything is a single stage
+	stages := inv.ComputeStages(hosts, nil)
+	if len(stages) != 1 || stages[0].Name != "all" || len(stages[0].Hosts) != 4 {
+		t.Fatalf("Expected one 'all' stage with 4 hosts, got %+v", stages)
+	}
+
+	// Ordered: db, then app, then leftover hosts
+	stages = inv.ComputeStages(hosts, []string{"db", "app"})
+	if len(stages) != 3 {
+		t.Fatalf("Expected 3 stages, got %d: %+v", len(stages), stages)
+	}
+	if stages[0].Name != "db" || stages[0].HostNames()[0] != "db1" {
+		t.Errorf("Expected stage 0 to be db/[db1], got %+v", stages[0])
+	}
+	if stages[1].Name != "app" || len(stages[1].Hosts) != 2 {
+		t.Errorf("Expected stage 1 to be app with 2 hosts, got %+v", stages[1])
+	}
+	if stages[2].Name != "ungrouped" || stages[2].HostNames()[0] != "misc1" {
+		t.Errorf("Expected trailing ungrouped stage with misc1, got %+v", stages[2])
+	}
+}
+
+func TestTimezoneForHost(t *testing.T) {
+	inv := NewInventory()
+	inv.Hosts["own-tz"] = &Host{Name: "own-tz", Timezone: "America/Chicago"}
+	inv.Hosts["group-tz"] = &Host{Name: "group-tz"}
+	inv.Hosts["no-tz"] = &Host{Name: "no-tz"}
+	inv.Groups["central"] = &Group{Name: "central", Hosts: []string{"group-tz"}, Timezone: "America/Chicago"}
+
+	if got := inv.TimezoneForHost(inv.Hosts["own-tz"]); got != "America/Chicago" {
+		t.Errorf("expected host's own timezone to win, got %q", got)
+	}
+	if got := inv.TimezoneForHost(inv.Hosts["group-tz"]); got != "America/Chicago" {
+		t.Errorf("expected group timezone to apply, got %q", got)
+	}
+	if got := inv.TimezoneForHost(inv.Hosts["no-tz"]); got != "UTC" {
+		t.Errorf("expected default of UTC, got %q", got)
+	}
+}
+
+func TestPostRebootChecksForHost(t *testing.T) {
+	inv := NewInventory()
+	inv.Hosts["own-checks"] = &Host{Name: "own-checks", PostReboot: &PostRebootValidationConfig{NTP: true}}
+	inv.Hosts["group-checks"] = &Host{Name: "group-checks"}
+	inv.Hosts["no-checks"] = &Host{Name: "no-checks"}
+	inv.Groups["storage"] = &Group{Name: "storage", Hosts: []string{"group-checks"}, PostReboot: &PostRebootValidationConfig{ZFS: true}}
+
+	if got := inv.PostRebootChecksForHost(inv.Hosts["own-checks"]); got == nil || !got.NTP {
+		t.Errorf("expected host's own post-reboot config to win, got %+v", got)
+	}
+	if got := inv.PostRebootChecksForHost(inv.Hosts["group-checks"]); got == nil || !got.ZFS {
+		t.Errorf("expected group post-reboot config to apply, got %+v", got)
+	}
+	if got := inv.PostRebootChecksForHost(inv.Hosts["no-checks"]); got != nil {
+		t.Errorf("expected nil default, got %+v", got)
+	}
+}
+
+func TestResolvedVarsForHost(t *testing.T) {
+	inv := NewInventory()
+	inv.Hosts["merged"] = &Host{Name: "merged", Vars: map[string]string{"env": "prod"}}
+	inv.Hosts["group-only"] = &Host{Name: "group-only"}
+	inv.Hosts["conflict"] = &Host{Name: "conflict"}
+	inv.Groups["dc1"] = &Group{Name: "dc1", Hosts: []string{"merged", "group-only", "conflict"}, Vars: map[string]any{"datacenter": "dc1", "env": "staging"}}
+	inv.Groups["dc2"] = &Group{Name: "dc2", Hosts: []string{"conflict"}, Vars: map[string]any{"datacenter": "dc2"}}
+
+	vars, err := inv.ResolvedVarsForHost(inv.Hosts["merged"])
+	if err != nil {
+		t.Fatalf("ResolvedVarsForHost: %v", err)
+	}
+	if vars["datacenter"] != "dc1" {
+		t.Errorf("expected group var to apply, got %q", vars["datacenter"])
+	}
+	if vars["env"] != "prod" {
+		t.Errorf("expected host's own var to win over the group's, got %q", vars["env"])
+	}
+
+	vars, err = inv.ResolvedVarsForHost(inv.Hosts["group-only"])
+	if err != nil {
+		t.Fatalf("ResolvedVarsForHost: %v", err)
+	}
+	if vars["datacenter"] != "dc1" || vars["env"] != "staging" {
+		t.Errorf("expected both group vars to apply, got %+v", vars)
+	}
+
+	if _, err := inv.ResolvedVarsForHost(inv.Hosts["conflict"]); err == nil {
+		t.Error("expected an error when two groups disagree on a key the host doesn't override")
+	}
+}
+
+func TestJumpHostString(t *testing.T) {
+	tests := []struct {
+		jump *JumpHost
+		want string
+	}{
+		{&JumpHost{Addr: "bastion.example.com"}, "bastion.example.com"},
+		{&JumpHost{Addr: "bastion.example.com", Port: 22}, "bastion.example.com"},
+		{&JumpHost{Addr: "bastion.example.com", Port: 2222}, "bastion.example.com:2222"},
+		{&JumpHost{Addr: "bastion.example.com", User: "ops"}, "ops@bastion.example.com"},
+		{&JumpHost{Addr: "bastion.example.com", Port: 2222, User: "ops"}, "ops@bastion.example.com:2222"},
+	}
+	for _, tt := range tests {
+		if got := tt.jump.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.jump, got, tt.want)
+		}
+	}
+}
+
+func TestParseJumpHostSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    *JumpHost
+		wantErr bool
+	}{
+		{"bastion.example.com", &JumpHost{Addr: "bastion.example.com", Port: 22}, false},
+		{"ops@bastion.example.com", &JumpHost{Addr: "bastion.example.com", Port: 22, User: "ops"}, false},
+		{"ops@bastion.example.com:2222", &JumpHost{Addr: "bastion.example.com", Port: 2222, User: "ops"}, false},
+		{"", nil, true},
+		{"ops@", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseJumpHostSpec(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseJumpHostSpec(%q): expected an error, got %+v", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ParseJumpHostSpec(%q): %v", tt.spec, err)
+		}
+		if *got != *tt.want {
+			t.Errorf("ParseJumpHostSpec(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestLocationForHost(t *testing.T) {
+	inv := NewInventory()
+	inv.Hosts["ok"] = &Host{Name: "ok", Timezone: "America/Chicago"}
+	inv.Hosts["bad"] = &Host{Name: "bad", Timezone: "Not/AZone"}
+
+	loc, err := inv.LocationForHost(inv.Hosts["ok"])
+	if err != nil {
+		t.Fatalf("LocationForHost failed: %v", err)
+	}
+	if loc.String() != "America/Chicago" {
+		t.Errorf("expected America/Chicago, got %v", loc)
+	}
+
+	if _, err := inv.LocationForHost(inv.Hosts["bad"]); err == nil {
+		t.Error("expected error for invalid timezone")
+	}
+}
+
+func TestValidateTimezone(t *testing.T) {
+	tests := []struct {
+		name    string
+		inv     *Inventory
+		wantErr bool
+	}{
+		{
+			name: "valid host timezone",
+			inv: &Inventory{
+				Hosts:  map[string]*Host{"web1": {Name: "web1", Base: "ubuntu", Addr: "10.0.0.1", Timezone: "America/Chicago"}},
+				Groups: make(map[string]*Group),
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid host timezone",
+			inv: &Inventory{
+				Hosts:  map[string]*Host{"web1": {Name: "web1", Base: "ubuntu", Addr: "10.0.0.1", Timezone: "Not/AZone"}},
+				Groups: make(map[string]*Group),
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid group timezone",
+			inv: &Inventory{
+				Hosts: map[string]*Host{"web1": {Name: "web1", Base: "ubuntu", Addr: "10.0.0.1"}},
+				Groups: map[string]*Group{
+					"webservers": {Name: "webservers", Hosts: []string{"web1"}, Timezone: "Not/AZone"},
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.inv.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHostOccurrencesDuplicateAcrossFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	content1 := `
+hosts:
+  web1:
+    name: web1
+    base: ubuntu
+    addr: 10.0.0.1
+`
+	content2 := `
+hosts:
+  web1:
+    name: web1
+    base: ubuntu
+    addr: 10.0.0.2
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "a.yaml"), []byte(content1), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "b.yaml"), []byte(content2), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	inv, err := LoadFromDir(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadFromDir failed: %v", err)
+	}
+
+	occurrences := inv.HostOccurrences("web1")
+	if len(occurrences) != 2 {
+		t.Fatalf("Expected 2 occurrences of web1, got %d", len(occurrences))
+	}
+	for _, o := range occurrences {
+		if o.Line <= 0 {
+			t.Errorf("Expected a positive line number, got %d for %s", o.Line, o.File)
+		}
+	}
+}
+
+func TestValidateStrictDuplicateHost(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	content1 := `
+hosts:
+  web1:
+    name: web1
+    base: ubuntu
+    addr: 10.0.0.1
+`
+	content2 := `
+hosts:
+  web1:
+    name: web1
+    base: ubuntu
+    addr: 10.0.0.2
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "a.yaml"), []byte(content1), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "b.yaml"), []byte(content2), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	inv, err := LoadFromDir(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadFromDir failed: %v", err)
+	}
+
+	report := inv.ValidateStrict(context.Background(), ValidateStrictOptions{})
+	if !report.HasFailures() {
+		t.Error("Expected ValidateStrict to report a failure for a duplicated host")
+	}
+
+	var found bool
+	for _, c := range report.Checks {
+		if c.Name == "duplicate_host:web1" && c.Status == ValidationFail {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected a duplicate_host:web1 failure check")
+	}
+}
+
+func TestValidateStrictDuplicateAddr(t *testing.T) {
+	inv := NewInventory()
+	inv.Hosts["web1"] = &Host{Name: "web1", Base: "ubuntu", Addr: "10.0.0.1"}
+	inv.Hosts["web2"] = &Host{Name: "web2", Base: "ubuntu", Addr: "10.0.0.1"}
+
+	report := inv.ValidateStrict(context.Background(), ValidateStrictOptions{})
+	if report.HasFailures() {
+		t.Error("A shared address should warn, not fail")
+	}
+
+	var found bool
+	for _, c := range report.Checks {
+		if c.Name == "duplicate_addr:10.0.0.1" && c.Status == ValidationWarn {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected a duplicate_addr:10.0.0.1 warning check")
+	}
+}
+
+func TestValidateStrictClean(t *testing.T) {
+	inv := NewInventory()
+	inv.Hosts["web1"] = &Host{Name: "web1", Base: "ubuntu", Addr: "10.0.0.1"}
+	inv.Hosts["web2"] = &Host{Name: "web2", Base: "ubuntu", Addr: "10.0.0.2"}
+
+	report := inv.ValidateStrict(context.Background(), ValidateStrictOptions{})
+	if report.HasFailures() {
+		t.Errorf("Expected no failures for a clean inventory, got %+v", report.Checks)
+	}
+}
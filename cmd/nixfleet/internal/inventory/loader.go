@@ -5,25 +5,77 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // rawInventory is the structure as stored in YAML files
 type rawInventory struct {
-	Hosts  map[string]rawHost  `yaml:"hosts"`
-	Groups map[string]rawGroup `yaml:"groups"`
+	Hosts         map[string]rawHost    `yaml:"hosts"`
+	Groups        map[string]rawGroup   `yaml:"groups"`
+	ApplyOrder    []string              `yaml:"apply_order"`
+	CriticalUnits []string              `yaml:"critical_units"`
+	EOLOverrides  map[string]rawEOLDate `yaml:"eol_overrides"`
+	UseSSHConfig  bool                  `yaml:"use_ssh_config"`
+}
+
+// rawEOLDate unmarshals an eol_overrides value, which is written as a plain
+// "YYYY-MM-DD" string in the inventory YAML rather than yaml.v3's default
+// RFC 3339 timestamp expectation.
+type rawEOLDate struct {
+	time.Time
+}
+
+func (d *rawEOLDate) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return fmt.Errorf("eol_overrides: %w (want YYYY-MM-DD)", err)
+	}
+	d.Time = t
+	return nil
 }
 
 type rawHost struct {
-	Base      string            `yaml:"base"`
-	Addr      string            `yaml:"addr"`
-	SSHUser   string            `yaml:"ssh_user"`
-	SSHPort   int               `yaml:"ssh_port"`
-	Roles     []string          `yaml:"roles"`
-	Tags      map[string]string `yaml:"tags"`
-	OSUpdates rawOSUpdates      `yaml:"os_updates"`
-	Rollout   rawRollout        `yaml:"rollout"`
+	Base            string            `yaml:"base"`
+	Addr            string            `yaml:"addr"`
+	SSHUser         string            `yaml:"ssh_user"`
+	SSHPort         int               `yaml:"ssh_port"`
+	Roles           []string          `yaml:"roles"`
+	Tags            map[string]string `yaml:"tags"`
+	OSUpdates       rawOSUpdates      `yaml:"os_updates"`
+	Rollout         rawRollout        `yaml:"rollout"`
+	PullBuildLeader bool              `yaml:"pull_build_leader"`
+	K0sMonitor      rawK0sMonitor     `yaml:"k0s_monitor"`
+	K0sNodeConfig   K0sNodeConfig     `yaml:"k0s_node_config"`
+	Timezone        string            `yaml:"timezone"`
+	UseSSHConfig    *bool             `yaml:"use_ssh_config"`
+	MaintenanceMode bool              `yaml:"maintenance_mode"`
+	ComplianceSLA   *ComplianceSLA    `yaml:"compliance_sla"`
+	Vars            map[string]string `yaml:"vars"`
+	JumpHost        *JumpHost         `yaml:"jump_host"`
+
+	PullBandwidthLimitKB    int    `yaml:"pull_bandwidth_limit_kb"`
+	PullTransferWindow      string `yaml:"pull_transfer_window"`
+	PullTransferThresholdMB int    `yaml:"pull_transfer_threshold_mb"`
+}
+
+// HostOccurrence records where one "hosts" entry was defined: which file,
+// and which line its key is on within that file. A host name with more than
+// one occurrence across the inventory's loaded files is a duplicate
+// definition - see Inventory.hostOccurrences and ValidateStrict.
+type HostOccurrence struct {
+	File string
+	Line int
+}
+
+type rawK0sMonitor struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
 }
 
 type rawOSUpdates struct {
@@ -42,9 +94,11 @@ type rawRollout struct {
 }
 
 type rawGroup struct {
-	Hosts    []string       `yaml:"hosts"`
-	Children []string       `yaml:"children"`
-	Vars     map[string]any `yaml:"vars"`
+	Hosts         []string       `yaml:"hosts"`
+	Children      []string       `yaml:"children"`
+	Vars          map[string]any `yaml:"vars"`
+	Timezone      string         `yaml:"timezone"`
+	ComplianceSLA *ComplianceSLA `yaml:"compliance_sla"`
 }
 
 // LoadFromDir loads inventory from a directory of YAML files
@@ -95,6 +149,11 @@ func loadFile(inv *Inventory, path string) error {
 		return fmt.Errorf("parsing yaml: %w", err)
 	}
 
+	lineNumbers, err := hostLineNumbers(data)
+	if err != nil {
+		return fmt.Errorf("parsing yaml: %w", err)
+	}
+
 	// Convert raw hosts to typed hosts
 	for name, rh := range raw.Hosts {
 		host := &Host{
@@ -118,25 +177,71 @@ func loadFile(inv *Inventory, path string) error {
 				MaxParallel:         rh.Rollout.MaxParallel,
 				PauseBetweenBatches: rh.Rollout.PauseBetweenBatches,
 			},
+			PullBuildLeader:         rh.PullBuildLeader,
+			PullBandwidthLimitKB:    rh.PullBandwidthLimitKB,
+			PullTransferWindow:      rh.PullTransferWindow,
+			PullTransferThresholdMB: rh.PullTransferThresholdMB,
+			K0sMonitor: K0sMonitorConfig{
+				Enabled:  rh.K0sMonitor.Enabled,
+				Interval: rh.K0sMonitor.Interval,
+			},
+			K0sNodeConfig:   rh.K0sNodeConfig,
+			Timezone:        rh.Timezone,
+			UseSSHConfig:    rh.UseSSHConfig,
+			MaintenanceMode: rh.MaintenanceMode,
+			ComplianceSLA:   rh.ComplianceSLA,
+			Vars:            rh.Vars,
+			JumpHost:        rh.JumpHost,
 		}
+		host.sshUserExplicit = rh.SSHUser != ""
+		host.sshPortExplicit = rh.SSHPort != 0
 
 		// Apply defaults
 		applyHostDefaults(host)
 
 		inv.Hosts[name] = host
+		if inv.hostFiles == nil {
+			inv.hostFiles = make(map[string]string)
+		}
+		inv.hostFiles[name] = path
+		if inv.hostOccurrences == nil {
+			inv.hostOccurrences = make(map[string][]HostOccurrence)
+		}
+		inv.hostOccurrences[name] = append(inv.hostOccurrences[name], HostOccurrence{File: path, Line: lineNumbers[name]})
 	}
 
 	// Convert raw groups to typed groups
 	for name, rg := range raw.Groups {
 		group := &Group{
-			Name:     name,
-			Hosts:    rg.Hosts,
-			Children: rg.Children,
-			Vars:     rg.Vars,
+			Name:          name,
+			Hosts:         rg.Hosts,
+			Children:      rg.Children,
+			Vars:          rg.Vars,
+			Timezone:      rg.Timezone,
+			ComplianceSLA: rg.ComplianceSLA,
 		}
 		inv.Groups[name] = group
 	}
 
+	if len(raw.ApplyOrder) > 0 {
+		inv.ApplyOrder = raw.ApplyOrder
+	}
+	if len(raw.CriticalUnits) > 0 {
+		inv.CriticalUnits = append(inv.CriticalUnits, raw.CriticalUnits...)
+	}
+	if raw.UseSSHConfig {
+		inv.UseSSHConfig = true
+	}
+
+	if len(raw.EOLOverrides) > 0 {
+		if inv.EOLOverrides == nil {
+			inv.EOLOverrides = make(map[string]time.Time)
+		}
+		for versionID, d := range raw.EOLOverrides {
+			inv.EOLOverrides[versionID] = d.Time
+		}
+	}
+
 	return nil
 }
 
@@ -168,6 +273,208 @@ func applyHostDefaults(h *Host) {
 	if h.Tags == nil {
 		h.Tags = make(map[string]string)
 	}
+	if h.K0sMonitor.Enabled && h.K0sMonitor.Interval == 0 {
+		h.K0sMonitor.Interval = 5 * time.Minute
+	}
+}
+
+// RemoveHostFromFile deletes hostName's entry from the "hosts" map in the
+// YAML inventory file at path, rewriting the file in place. It's a
+// node-level edit (not a full unmarshal/remarshal of rawInventory) so
+// unrelated hosts, groups, and comments in the file survive unchanged.
+// Returns an error if the file has no such host.
+func RemoveHostFromFile(path, hostName string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing yaml: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return fmt.Errorf("host %q not found in %s", hostName, path)
+	}
+
+	root := doc.Content[0]
+	hostsNode := mappingValue(root, "hosts")
+	if hostsNode == nil {
+		return fmt.Errorf("host %q not found in %s", hostName, path)
+	}
+
+	removed := false
+	content := hostsNode.Content
+	for i := 0; i+1 < len(content); i += 2 {
+		if content[i].Value == hostName {
+			hostsNode.Content = append(content[:i], content[i+2:]...)
+			removed = true
+			break
+		}
+	}
+	if !removed {
+		return fmt.Errorf("host %q not found in %s", hostName, path)
+	}
+
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return fmt.Errorf("encoding yaml: %w", err)
+	}
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		return fmt.Errorf("writing file: %w", err)
+	}
+	return nil
+}
+
+// AddHostsToFile appends each of hosts to the "hosts" map in the YAML
+// inventory file at path, rewriting the file in place. Like
+// RemoveHostFromFile, it's a node-level edit so unrelated hosts, groups,
+// and comments survive unchanged. Only the fields an operator would
+// actually hand-write (base, addr, ssh_user, roles) are emitted, matching
+// the minimal style of hand-authored inventory entries rather than the
+// full zero-valued Host struct. Returns an error if any host name already
+// exists in the file.
+func AddHostsToFile(path string, hosts []*Host) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing yaml: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return fmt.Errorf("empty inventory file %s", path)
+	}
+
+	root := doc.Content[0]
+	hostsNode := mappingValue(root, "hosts")
+	if hostsNode == nil {
+		hostsNode = &yaml.Node{Kind: yaml.MappingNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "hosts"}, hostsNode)
+	}
+
+	for _, h := range hosts {
+		if mappingValue(hostsNode, h.Name) != nil {
+			return fmt.Errorf("host %q already exists in %s", h.Name, path)
+		}
+		hostsNode.Content = append(hostsNode.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: h.Name}, hostEntryNode(h))
+	}
+
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return fmt.Errorf("encoding yaml: %w", err)
+	}
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		return fmt.Errorf("writing file: %w", err)
+	}
+	return nil
+}
+
+// SetHostBaseInFile rewrites host hostName's "base" field in the YAML
+// inventory file at path in place, the way RemoveHostFromFile/AddHostsToFile
+// do - only the base scalar node is touched, so formatting, comments, and
+// every other field survive unchanged. Used by 'nixfleet host migrate' once
+// a base change has actually been applied to the live host, so the
+// inventory doesn't go on lying about what the host is running.
+func SetHostBaseInFile(path, hostName, base string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing yaml: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return fmt.Errorf("host %q not found in %s", hostName, path)
+	}
+
+	root := doc.Content[0]
+	hostsNode := mappingValue(root, "hosts")
+	if hostsNode == nil {
+		return fmt.Errorf("host %q not found in %s", hostName, path)
+	}
+	hostNode := mappingValue(hostsNode, hostName)
+	if hostNode == nil {
+		return fmt.Errorf("host %q not found in %s", hostName, path)
+	}
+	baseNode := mappingValue(hostNode, "base")
+	if baseNode == nil {
+		return fmt.Errorf("host %q has no base field in %s", hostName, path)
+	}
+	baseNode.Value = base
+
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return fmt.Errorf("encoding yaml: %w", err)
+	}
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		return fmt.Errorf("writing file: %w", err)
+	}
+	return nil
+}
+
+// hostEntryNode builds the minimal YAML mapping node for h, covering only
+// the fields a hand-written inventory entry sets.
+func hostEntryNode(h *Host) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	add := func(key, value string) {
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &yaml.Node{Kind: yaml.ScalarNode, Value: value})
+	}
+
+	add("base", h.Base)
+	add("addr", h.Addr)
+	if h.SSHUser != "" {
+		add("ssh_user", h.SSHUser)
+	}
+	if len(h.Roles) > 0 {
+		rolesNode := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, role := range h.Roles {
+			rolesNode.Content = append(rolesNode.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: role})
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "roles"}, rolesNode)
+	}
+
+	return node
+}
+
+// hostLineNumbers parses data a second time as a raw YAML document (the
+// first, into rawInventory, discards position info) to find the source line
+// of each key under "hosts", for duplicate-definition error messages. A file
+// with no "hosts" mapping returns an empty map, not an error.
+func hostLineNumbers(data []byte) (map[string]int, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	hostsNode := mappingValue(doc.Content[0], "hosts")
+	if hostsNode == nil {
+		return nil, nil
+	}
+
+	lines := make(map[string]int, len(hostsNode.Content)/2)
+	for i := 0; i+1 < len(hostsNode.Content); i += 2 {
+		lines[hostsNode.Content[i].Value] = hostsNode.Content[i].Line
+	}
+	return lines, nil
+}
+
+// mappingValue returns the value node for key in a YAML mapping node, or nil
+// if the key isn't present.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
 }
 
 // Validate checks inventory for consistency
@@ -186,7 +493,23 @@ func (inv *Inventory) Validate() error {
 		}
 	}
 
+	// Check apply_order references known groups
+	for _, groupName := range inv.ApplyOrder {
+		if _, ok := inv.Groups[groupName]; !ok {
+			return fmt.Errorf("apply_order references unknown group %q", groupName)
+		}
+	}
+
+	for groupName, group := range inv.Groups {
+		if group.Timezone != "" {
+			if _, err := time.LoadLocation(group.Timezone); err != nil {
+				return fmt.Errorf("group %q has invalid timezone %q: %w", groupName, group.Timezone, err)
+			}
+		}
+	}
+
 	// Validate host configurations
+	leaders := 0
 	for name, host := range inv.Hosts {
 		if host.Addr == "" {
 			return fmt.Errorf("host %q has no address", name)
@@ -194,6 +517,17 @@ func (inv *Inventory) Validate() error {
 		if host.Base != "ubuntu" && host.Base != "nixos" {
 			return fmt.Errorf("host %q has invalid base %q (must be 'ubuntu' or 'nixos')", name, host.Base)
 		}
+		if host.PullBuildLeader {
+			leaders++
+		}
+		if host.Timezone != "" {
+			if _, err := time.LoadLocation(host.Timezone); err != nil {
+				return fmt.Errorf("host %q has invalid timezone %q: %w", name, host.Timezone, err)
+			}
+		}
+	}
+	if leaders > 1 {
+		return fmt.Errorf("only one host may set pull_build_leader, found %d", leaders)
 	}
 
 	return nil
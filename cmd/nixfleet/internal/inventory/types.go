@@ -1,5 +1,16 @@
 package inventory
 
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/probe"
+)
+
 // Host represents a managed host in the inventory
 type Host struct {
 	Name     string            `yaml:"name" json:"name"`
@@ -11,6 +22,226 @@ type Host struct {
 	Tags     map[string]string `yaml:"tags" json:"tags"`
 	OSUpdate OSUpdateConfig    `yaml:"os_updates" json:"os_updates"`
 	Rollout  RolloutConfig     `yaml:"rollout" json:"rollout"`
+
+	// PullBuildLeader marks this host as the fleet's build leader for pull
+	// mode: it always builds locally, and other pull-mode hosts substitute
+	// from it over ssh-ng instead of rebuilding from source.
+	PullBuildLeader bool `yaml:"pull_build_leader" json:"pull_build_leader"`
+
+	// PullBandwidthLimitKB caps this host's pull-mode closure download
+	// speed, in KiB/s, via nix's --option download-speed. Zero means
+	// unlimited - the default for a host that doesn't share its link with
+	// other traffic. See pullmode.Config.BandwidthLimitKB.
+	PullBandwidthLimitKB int `yaml:"pull_bandwidth_limit_kb,omitempty" json:"pull_bandwidth_limit_kb,omitempty"`
+
+	// PullTransferWindow restricts this host's pull-mode build/substitution
+	// phase (not its cheap git fetch and evaluation) to a daily local-time
+	// range, e.g. "22:00-06:00", whenever the pending download exceeds
+	// PullTransferThresholdMB. Empty means no window. See
+	// pullmode.ParseTransferWindow.
+	PullTransferWindow string `yaml:"pull_transfer_window,omitempty" json:"pull_transfer_window,omitempty"`
+
+	// PullTransferThresholdMB is the pending-download size, in megabytes,
+	// above which PullTransferWindow applies. Ignored if PullTransferWindow
+	// is empty.
+	PullTransferThresholdMB int `yaml:"pull_transfer_threshold_mb,omitempty" json:"pull_transfer_threshold_mb,omitempty"`
+
+	// Probes are readiness/health checks specific to this host, run in
+	// addition to any defined on groups it belongs to. See
+	// Inventory.ProbesForHost.
+	Probes []probe.Config `yaml:"probes,omitempty" json:"probes,omitempty"`
+
+	// KexecReboot opts this host into the kexec fast-reboot path even when
+	// `nixfleet reboot now` is run without --kexec, for slow-POST hardware
+	// where skipping firmware init matters most.
+	KexecReboot bool `yaml:"kexec_reboot,omitempty" json:"kexec_reboot,omitempty"`
+
+	// K0sMonitor configures periodic k0s cluster-metrics collection for this
+	// host, when it's a k0s controller. See internal/server.Scheduler's
+	// k0s-metrics task and GET /api/k8s/{controller}/summary.
+	K0sMonitor K0sMonitorConfig `yaml:"k0s_monitor,omitempty" json:"k0s_monitor,omitempty"`
+
+	// K0sNodeConfig declares kubelet and containerd overrides for this host
+	// when it's a k0s node. 'nixfleet k0s reconcile' (or apply, for
+	// push-mode hosts) renders it onto the running cluster - see
+	// internal/k0s.Reconciler.ReconcileNodeConfig.
+	K0sNodeConfig K0sNodeConfig `yaml:"k0s_node_config,omitempty" json:"k0s_node_config,omitempty"`
+
+	// Timezone is this host's IANA time zone name (e.g. "America/Chicago"),
+	// used to evaluate maintenance/reboot windows in the host's own local
+	// time rather than the operator's. Empty falls back to the timezone of
+	// any group this host belongs to, or UTC if none set one either. See
+	// Inventory.LocationForHost.
+	Timezone string `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+
+	// UseSSHConfig opts this host into resolving its connection parameters
+	// (HostName, User, Port, IdentityFile, ProxyJump, ConnectTimeout)
+	// through the operator's ~/.ssh/config and /etc/ssh/ssh_config, falling
+	// back to inventory values for anything the host's ssh_config entry
+	// doesn't set. Unset here, the host follows Inventory.UseSSHConfig. See
+	// internal/ssh.ResolveConnection.
+	UseSSHConfig *bool `yaml:"use_ssh_config,omitempty" json:"use_ssh_config,omitempty"`
+
+	// SSHCompress enables SSH transport compression for nix copy transfers
+	// to this host. Unset, it defaults to on for any address outside the
+	// RFC1918 (or RFC4193 IPv6 ULA) private ranges - a WAN link is the case
+	// compression actually helps, and a LAN deploy has the bandwidth to
+	// spare anyway. See nix.Deployer.CopyToHost.
+	SSHCompress *bool `yaml:"ssh_compress,omitempty" json:"ssh_compress,omitempty"`
+
+	// Profiles lists additional, non-system outputs to build and activate on
+	// this host alongside its system closure: "home-manager:<user>" activates
+	// a standalone home-manager configuration as that user, and
+	// "profile:<name>" installs a plain package/profile output into a shared
+	// nix profile. See internal/nix.ParseProfileTarget for the flake output
+	// each form resolves to. Failures here never fail the host's deploy -
+	// see apply.Pipeline's profile phase.
+	Profiles []string `yaml:"profiles,omitempty" json:"profiles,omitempty"`
+
+	// MaintenanceMode excludes this host from compliance SLA violation
+	// counts (GET /api/compliance, 'nixfleet compliance report') without
+	// hiding it from the report entirely - it's still listed separately, so
+	// a host left in maintenance mode doesn't fall out of sight forever.
+	MaintenanceMode bool `yaml:"maintenance_mode,omitempty" json:"maintenance_mode,omitempty"`
+
+	// ComplianceSLA overrides how many days this host may carry outstanding
+	// security/regular updates before it's out of compliance. Unset, it
+	// falls back to the first group that sets one, then
+	// compliance.DefaultSLA. See Inventory.ComplianceSLAForHost.
+	ComplianceSLA *ComplianceSLA `yaml:"compliance_sla,omitempty" json:"compliance_sla,omitempty"`
+
+	// PostReboot configures the validation suite 'nixfleet reboot now' runs
+	// once this host comes back up, beyond confirming it answers SSH again.
+	// Unset, it falls back to the first group this host belongs to that
+	// sets one, then no extra validation. See
+	// Inventory.PostRebootChecksForHost.
+	PostReboot *PostRebootValidationConfig `yaml:"post_reboot,omitempty" json:"post_reboot,omitempty"`
+
+	// Flake overrides which flake this host is evaluated and built from -
+	// a local path or a remote flake reference (e.g. "github:team-b/infra"),
+	// in the same form accepted by the global --flake flag. Empty falls
+	// back to the first group this host belongs to that sets one, then the
+	// global --flake default. See Inventory.FlakeForHost.
+	Flake string `yaml:"flake,omitempty" json:"flake,omitempty"`
+
+	// Vars holds free-form per-host variables (datacenter, environment,
+	// upstream addresses, ...) referenced from 'nixfleet run' command
+	// templates and passed to the Nix evaluation. A key set here always
+	// wins over the same key set on a group this host belongs to. See
+	// Inventory.ResolvedVarsForHost.
+	Vars map[string]string `yaml:"vars,omitempty" json:"vars,omitempty"`
+
+	// JumpHost, if set, is a bastion ssh.Pool dials through to reach this
+	// host instead of connecting to Addr directly - a single hop, the same
+	// as ssh_config's ProxyJump directive. It takes precedence over a
+	// ProxyJump resolved from ssh_config, since it's an explicit inventory
+	// setting. See ssh.Pool.EnableSSHConfig and JumpHost.String.
+	JumpHost *JumpHost `yaml:"jump_host,omitempty" json:"jump_host,omitempty"`
+
+	// Self flags this host as the machine running the nixfleet process
+	// itself (the server, or an operator's bastion). Reboot orchestration
+	// uses it to order the host last and checkpoint the run before issuing
+	// its own reboot - see internal/reboot.IsSelfHost. Unset, nixfleet still
+	// detects a self-host by comparing /etc/machine-id; set this when that
+	// comparison isn't possible (e.g. a containerized nixfleet process).
+	Self bool `yaml:"self,omitempty" json:"self,omitempty"`
+
+	// sshUserExplicit and sshPortExplicit record whether SSHUser/SSHPort
+	// were actually set in the inventory YAML, before the loader's
+	// applyHostDefaults filled in "deploy"/22 - so ssh_config resolution
+	// can tell an explicit override from an unset field defaulting to the
+	// same fallback ssh_config might otherwise supply. See
+	// SSHUserExplicit/SSHPortExplicit.
+	sshUserExplicit bool
+	sshPortExplicit bool
+}
+
+// SSHUserExplicit reports whether SSHUser was set in the inventory YAML,
+// as opposed to having taken the loader's "deploy" default.
+func (h *Host) SSHUserExplicit() bool { return h.sshUserExplicit }
+
+// SSHPortExplicit reports whether SSHPort was set in the inventory YAML,
+// as opposed to having taken the loader's port-22 default.
+func (h *Host) SSHPortExplicit() bool { return h.sshPortExplicit }
+
+// K0sMonitorConfig enables and paces periodic k0s cluster-metrics
+// collection on a controller host. Interval is per host, not a single fleet
+// setting, because a small edge cluster and a busy one don't want the same
+// polling cadence.
+type K0sMonitorConfig struct {
+	Enabled  bool          `yaml:"enabled" json:"enabled"`
+	Interval time.Duration `yaml:"interval,omitempty" json:"interval,omitempty"`
+}
+
+// K0sNodeConfig is one host's kubelet and containerd overrides - kubelet
+// flags (max-pods, reserved resources, ...) rendered into the host's k0s
+// WorkerProfile, and containerd registry mirror/auth entries rendered as
+// on-host drop-ins. See internal/k0s.NodeConfig, which this is converted
+// to at the point of use (apply.Pipeline, 'nixfleet k0s reconcile').
+type K0sNodeConfig struct {
+	// Profile names the k0s WorkerProfile this host's KubeletOverrides are
+	// rendered into. Defaults to the host name when empty, so profiles
+	// don't collide across hosts that don't explicitly opt into sharing
+	// one.
+	Profile string `yaml:"profile,omitempty" json:"profile,omitempty"`
+
+	// KubeletOverrides is merged into the WorkerProfile's kubelet config
+	// values, e.g. {"maxPods": 150}.
+	KubeletOverrides map[string]any `yaml:"kubelet,omitempty" json:"kubelet,omitempty"`
+
+	// ContainerdRegistries are registry mirror/auth entries rendered as
+	// containerd hosts.toml drop-ins on the node.
+	ContainerdRegistries []ContainerdRegistryMirror `yaml:"containerd_registries,omitempty" json:"containerd_registries,omitempty"`
+
+	// NodeLabels are Kubernetes node labels to reconcile onto this host,
+	// mirroring nixfleet.k0s.worker.nodeLabels in modules/k0s.nix so a
+	// freshly joined worker already carries them via the kubelet's own
+	// --node-labels, with 'nixfleet k0s reconcile' (or apply) patching them
+	// onto an already-joined node the same way it patches KubeletOverrides.
+	NodeLabels map[string]string `yaml:"node_labels,omitempty" json:"node_labels,omitempty"`
+
+	// NodeTaints are taints to reconcile onto this host.
+	NodeTaints []K0sTaint `yaml:"node_taints,omitempty" json:"node_taints,omitempty"`
+
+	// PruneLabels removes labels and taints present on the node but not
+	// declared in NodeLabels/NodeTaints when reconciling - see
+	// internal/k0s.NodeConfig.PruneLabels for which keys are protected from
+	// pruning regardless.
+	PruneLabels bool `yaml:"prune_labels,omitempty" json:"prune_labels,omitempty"`
+}
+
+// K0sTaint is one Kubernetes node taint, see K0sNodeConfig.NodeTaints.
+type K0sTaint struct {
+	Key    string `yaml:"key" json:"key"`
+	Value  string `yaml:"value,omitempty" json:"value,omitempty"`
+	Effect string `yaml:"effect" json:"effect"` // NoSchedule, PreferNoSchedule, or NoExecute
+}
+
+// ContainerdRegistryMirror is one registry's mirror endpoints and optional
+// pull credentials, see K0sNodeConfig.
+type ContainerdRegistryMirror struct {
+	Registry  string   `yaml:"registry" json:"registry"`
+	Endpoints []string `yaml:"endpoints" json:"endpoints"`
+	Username  string   `yaml:"username,omitempty" json:"username,omitempty"`
+	Password  string   `yaml:"password,omitempty" json:"password,omitempty"`
+}
+
+// HasOverrides reports whether cfg declares anything for
+// ReconcileNodeConfig to do.
+func (cfg K0sNodeConfig) HasOverrides() bool {
+	return len(cfg.KubeletOverrides) > 0 || len(cfg.ContainerdRegistries) > 0 ||
+		len(cfg.NodeLabels) > 0 || len(cfg.NodeTaints) > 0
+}
+
+// ComplianceSLA sets, in days, how long a host may carry outstanding
+// security or regular updates before it's considered out of compliance.
+// Zero means "not set" rather than "zero days" - a Host or Group that wants
+// a real zero-day threshold isn't a case nixfleet needs to support today.
+// Mirrors compliance.SLA, which this is converted to at the point of use -
+// see Inventory.ComplianceSLAForHost.
+type ComplianceSLA struct {
+	SecurityDays int `yaml:"security_days,omitempty" json:"security_days,omitempty"`
+	RegularDays  int `yaml:"regular_days,omitempty" json:"regular_days,omitempty"`
 }
 
 // OSUpdateConfig defines OS update behavior
@@ -21,6 +252,7 @@ type OSUpdateConfig struct {
 	RebootWindow         string   `yaml:"reboot_window" json:"reboot_window"` // e.g., "Sun 02:00-04:00"
 	Holds                []string `yaml:"holds" json:"holds"`                 // packages to hold
 	MaxConcurrentReboots int      `yaml:"max_concurrent_reboots" json:"max_concurrent_reboots"`
+	RestartExclude       []string `yaml:"restart_exclude" json:"restart_exclude"` // services to never auto-restart, e.g. databases
 
 	// NixOS-specific
 	AutoSwitch bool `yaml:"auto_switch" json:"auto_switch"`
@@ -31,20 +263,231 @@ type RolloutConfig struct {
 	CanaryPercent       int `yaml:"canary_percent" json:"canary_percent"`
 	MaxParallel         int `yaml:"max_parallel" json:"max_parallel"`
 	PauseBetweenBatches int `yaml:"pause_between_batches" json:"pause_between_batches"` // seconds
+
+	// SmokeTestRequired makes `apply` always smoke-test this host's closure
+	// in a local VM/container (see internal/smoketest) before deploying to
+	// it, even without --smoke-test on the command line. --skip-smoke-test
+	// overrides this for a one-off apply.
+	SmokeTestRequired bool `yaml:"smoke_test_required" json:"smoke_test_required"`
+}
+
+// JumpHost identifies a bastion a Host is reached through. See Host.JumpHost.
+type JumpHost struct {
+	Addr string `yaml:"addr" json:"addr"`
+	Port int    `yaml:"port,omitempty" json:"port,omitempty"`
+	User string `yaml:"user,omitempty" json:"user,omitempty"`
+}
+
+// String renders j in the "[user@]addr[:port]" form ssh.Client's ProxyJump
+// parsing expects, omitting Port when it's the default 22.
+func (j *JumpHost) String() string {
+	spec := j.Addr
+	if j.Port != 0 && j.Port != 22 {
+		spec = net.JoinHostPort(j.Addr, strconv.Itoa(j.Port))
+	}
+	if j.User != "" {
+		spec = j.User + "@" + spec
+	}
+	return spec
+}
+
+// ParseJumpHostSpec parses a "--jump [user@]host[:port]" command-line value
+// into a JumpHost, defaulting Port to 22 when unset. Used for an ad-hoc
+// override of every targeted host's JumpHost for a single invocation.
+func ParseJumpHostSpec(spec string) (*JumpHost, error) {
+	if spec == "" {
+		return nil, fmt.Errorf("empty --jump value")
+	}
+	j := &JumpHost{Port: 22}
+	if at := strings.Index(spec, "@"); at >= 0 {
+		j.User = spec[:at]
+		spec = spec[at+1:]
+	}
+	j.Addr = spec
+	if host, portStr, err := net.SplitHostPort(spec); err == nil {
+		j.Addr = host
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --jump port %q: %w", portStr, err)
+		}
+		j.Port = port
+	}
+	if j.Addr == "" {
+		return nil, fmt.Errorf("invalid --jump value %q: missing host", spec)
+	}
+	return j, nil
 }
 
 // Group represents a group of hosts
 type Group struct {
-	Name     string         `yaml:"name" json:"name"`
-	Hosts    []string       `yaml:"hosts" json:"hosts"`
-	Children []string       `yaml:"children" json:"children"` // nested groups
-	Vars     map[string]any `yaml:"vars" json:"vars"`
+	Name     string   `yaml:"name" json:"name"`
+	Hosts    []string `yaml:"hosts" json:"hosts"`
+	Children []string `yaml:"children" json:"children"` // nested groups
+
+	// Vars holds free-form variables every host in this group inherits
+	// unless it sets the same key itself. Declared as map[string]any (YAML
+	// values are free-form here) rather than Host.Vars's map[string]string,
+	// so Inventory.ResolvedVarsForHost stringifies each value when merging
+	// it into a host's vars. See Inventory.ResolvedVarsForHost.
+	Vars map[string]any `yaml:"vars" json:"vars"`
+
+	// Probes are readiness/health checks applied to every host in this
+	// group (and, recursively, its child groups). See
+	// Inventory.ProbesForHost.
+	Probes []probe.Config `yaml:"probes,omitempty" json:"probes,omitempty"`
+
+	// Timezone is the IANA time zone name hosts in this group inherit when
+	// they don't set their own. See Inventory.LocationForHost.
+	Timezone string `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+
+	// ComplianceSLA is the patch-SLA threshold hosts in this group inherit
+	// when they don't set their own. See Inventory.ComplianceSLAForHost.
+	ComplianceSLA *ComplianceSLA `yaml:"compliance_sla,omitempty" json:"compliance_sla,omitempty"`
+
+	// Flake is the flake hosts in this group build from when they don't set
+	// their own. See Inventory.FlakeForHost.
+	Flake string `yaml:"flake,omitempty" json:"flake,omitempty"`
+
+	// PostReboot is the post-reboot validation suite hosts in this group
+	// inherit when they don't set their own. See
+	// Inventory.PostRebootChecksForHost.
+	PostReboot *PostRebootValidationConfig `yaml:"post_reboot,omitempty" json:"post_reboot,omitempty"`
+}
+
+// PostRebootValidationConfig configures the validation suite
+// 'nixfleet reboot now' runs on a host once it comes back up, beyond
+// confirming it answers SSH again. Any configured health probes (see
+// Inventory.ProbesForHost) always run as part of validation regardless of
+// this config. See Inventory.PostRebootChecksForHost and
+// reboot.Orchestrator.ValidatePostReboot, which this is converted to at the
+// point of use.
+type PostRebootValidationConfig struct {
+	// Mounts lists fstab mount points (besides "/") that must be active
+	// after reboot.
+	Mounts []string `yaml:"mounts,omitempty" json:"mounts,omitempty"`
+
+	// RAID checks mdadm array health - any array not in a clean/active
+	// state fails this check.
+	RAID bool `yaml:"raid,omitempty" json:"raid,omitempty"`
+
+	// ZFS checks zpool health - any pool not ONLINE fails this check.
+	ZFS bool `yaml:"zfs,omitempty" json:"zfs,omitempty"`
+
+	// SystemdTargets lists systemd units (targets or services) that must
+	// be active, e.g. "multi-user.target" or "k0scontroller.service".
+	SystemdTargets []string `yaml:"systemd_targets,omitempty" json:"systemd_targets,omitempty"`
+
+	// NTP checks that the host's clock is synchronized.
+	NTP bool `yaml:"ntp,omitempty" json:"ntp,omitempty"`
+
+	// KernelVersion checks that the running kernel matches the version
+	// read from the host just before the reboot was triggered, catching a
+	// silent fallback to an older kernel.
+	KernelVersion bool `yaml:"kernel_version,omitempty" json:"kernel_version,omitempty"`
 }
 
 // Inventory holds all hosts and groups
 type Inventory struct {
 	Hosts  map[string]*Host  `yaml:"hosts" json:"hosts"`
 	Groups map[string]*Group `yaml:"groups" json:"groups"`
+
+	// ApplyOrder lists group names in the order apply should deploy them
+	// (e.g. ["db", "app", "web"]), so dependents aren't restarted against a
+	// database that hasn't been updated yet. Hosts that aren't in any listed
+	// group deploy last, in an "ungrouped" stage.
+	ApplyOrder []string `yaml:"apply_order" json:"apply_order"`
+
+	// CriticalUnits lists systemd unit names (e.g. "postgresql.service")
+	// that escalate an apply's confirmation prompt when the new closure
+	// would restart them - see internal/impact and 'nixfleet apply'.
+	CriticalUnits []string `yaml:"critical_units" json:"critical_units"`
+
+	// EOLOverrides adds to (or corrects) osupdate.DefaultEOLDates, keyed by
+	// /etc/os-release's VERSION_ID (e.g. "24.04") with an RFC 3339 date
+	// value (e.g. "2029-06-01"). Lets a fleet track a release nixfleet
+	// doesn't ship a built-in EOL date for yet, without a code change.
+	EOLOverrides map[string]time.Time `yaml:"eol_overrides,omitempty" json:"eol_overrides,omitempty"`
+
+	// UseSSHConfig is the fleet-wide default for resolving connection
+	// parameters through the operator's ssh_config (see Host.UseSSHConfig,
+	// which overrides this per host). Defaults to false: nixfleet ignores
+	// ssh_config entirely unless an operator opts in.
+	UseSSHConfig bool `yaml:"use_ssh_config,omitempty" json:"use_ssh_config,omitempty"`
+
+	// hostFiles records which file each host was loaded from, so a host can
+	// later be removed from the right file (see RemoveHostFromFile). Empty
+	// when the inventory wasn't built via LoadFromDir/LoadFromFile.
+	hostFiles map[string]string
+
+	// hostOccurrences records every file/line a "hosts" entry was defined
+	// at, including ones that lost a last-writer-wins merge in
+	// inv.Hosts - unlike hostFiles, which only keeps the winner. Populated
+	// by loadFile; see ValidateStrict for the duplicate-detection this
+	// exists for.
+	hostOccurrences map[string][]HostOccurrence
+}
+
+// Stage is one sequential step of an ordered apply run: a named group of
+// hosts that deploy together, but only after every earlier stage has
+// finished.
+type Stage struct {
+	Name  string  `json:"name"`
+	Hosts []*Host `json:"-"`
+}
+
+// HostNames returns the names of the hosts in this stage.
+func (s Stage) HostNames() []string {
+	names := make([]string, len(s.Hosts))
+	for i, h := range s.Hosts {
+		names[i] = h.Name
+	}
+	return names
+}
+
+// ComputeStages partitions hosts into ordered stages by group membership.
+// Each host lands in the stage for the first group in order that contains
+// it; hosts matching no listed group go into a trailing "ungrouped" stage.
+// With no order given, everything is a single "all" stage (today's
+// unordered behavior).
+func (inv *Inventory) ComputeStages(hosts []*Host, order []string) []Stage {
+	if len(order) == 0 {
+		return []Stage{{Name: "all", Hosts: hosts}}
+	}
+
+	assigned := make(map[string]bool, len(hosts))
+	var stages []Stage
+
+	for _, groupName := range order {
+		inGroup := make(map[string]bool)
+		for _, h := range inv.HostsInGroup(groupName) {
+			inGroup[h.Name] = true
+		}
+
+		var stageHosts []*Host
+		for _, h := range hosts {
+			if assigned[h.Name] || !inGroup[h.Name] {
+				continue
+			}
+			stageHosts = append(stageHosts, h)
+			assigned[h.Name] = true
+		}
+
+		if len(stageHosts) > 0 {
+			stages = append(stages, Stage{Name: groupName, Hosts: stageHosts})
+		}
+	}
+
+	var remaining []*Host
+	for _, h := range hosts {
+		if !assigned[h.Name] {
+			remaining = append(remaining, h)
+		}
+	}
+	if len(remaining) > 0 {
+		stages = append(stages, Stage{Name: "ungrouped", Hosts: remaining})
+	}
+
+	return stages
 }
 
 // NewInventory creates an empty inventory
@@ -61,6 +504,20 @@ func (inv *Inventory) GetHost(name string) (*Host, bool) {
 	return h, ok
 }
 
+// SourceFile returns the path of the file host was loaded from, if the
+// inventory was built via LoadFromDir/LoadFromFile.
+func (inv *Inventory) SourceFile(hostName string) (string, bool) {
+	path, ok := inv.hostFiles[hostName]
+	return path, ok
+}
+
+// HostOccurrences returns every file/line a host name was defined at, in
+// load order. A length greater than one means the name was defined more
+// than once and inv.Hosts only kept the last one loaded; see ValidateStrict.
+func (inv *Inventory) HostOccurrences(hostName string) []HostOccurrence {
+	return inv.hostOccurrences[hostName]
+}
+
 // GetGroup returns a group by name
 func (inv *Inventory) GetGroup(name string) (*Group, bool) {
 	g, ok := inv.Groups[name]
@@ -122,6 +579,196 @@ func (inv *Inventory) FilterByBase(base string) []*Host {
 	return hosts
 }
 
+// BuildLeader returns the host configured as the pull-mode build leader, if
+// any. If more than one host is marked, the alphabetically-first name wins
+// so the choice is deterministic rather than map-iteration order.
+func (inv *Inventory) BuildLeader() (*Host, bool) {
+	var leader *Host
+	for _, h := range inv.Hosts {
+		if !h.PullBuildLeader {
+			continue
+		}
+		if leader == nil || h.Name < leader.Name {
+			leader = h
+		}
+	}
+	if leader == nil {
+		return nil, false
+	}
+	return leader, true
+}
+
+// ProbesForHost returns every probe that applies to host: its own probes,
+// plus those defined on any group (including ancestors via Children) that
+// the host is a member of. Group probes are collected in Groups map order,
+// which is not stable across calls if the caller depends on ordering.
+func (inv *Inventory) ProbesForHost(host *Host) []probe.Config {
+	var probes []probe.Config
+	for _, group := range inv.Groups {
+		if inv.groupContainsHost(group, host.Name, make(map[string]bool)) {
+			probes = append(probes, group.Probes...)
+		}
+	}
+	probes = append(probes, host.Probes...)
+	return probes
+}
+
+// GroupsForHost returns the names of every group (direct or via Children)
+// that host belongs to, sorted for stable output.
+func (inv *Inventory) GroupsForHost(host *Host) []string {
+	var names []string
+	for name, group := range inv.Groups {
+		if inv.groupContainsHost(group, host.Name, make(map[string]bool)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TimezoneForHost resolves host's IANA time zone: its own Timezone if set,
+// otherwise the first non-empty Timezone among the groups it belongs to
+// (in GroupsForHost's sorted order, so the result is deterministic even
+// when a host is in more than one group with conflicting settings),
+// otherwise "UTC".
+func (inv *Inventory) TimezoneForHost(host *Host) string {
+	if host.Timezone != "" {
+		return host.Timezone
+	}
+	for _, name := range inv.GroupsForHost(host) {
+		if group, ok := inv.Groups[name]; ok && group.Timezone != "" {
+			return group.Timezone
+		}
+	}
+	return "UTC"
+}
+
+// ComplianceSLAForHost resolves host's patch-SLA threshold: its own
+// ComplianceSLA if set, otherwise the first non-nil ComplianceSLA among the
+// groups it belongs to (in GroupsForHost's sorted order), otherwise the
+// zero value - callers fall back to compliance.DefaultSLA themselves, so
+// this package doesn't need to import compliance just for one constant.
+func (inv *Inventory) ComplianceSLAForHost(host *Host) (ComplianceSLA, bool) {
+	if host.ComplianceSLA != nil {
+		return *host.ComplianceSLA, true
+	}
+	for _, name := range inv.GroupsForHost(host) {
+		if group, ok := inv.Groups[name]; ok && group.ComplianceSLA != nil {
+			return *group.ComplianceSLA, true
+		}
+	}
+	return ComplianceSLA{}, false
+}
+
+// FlakeForHost resolves which flake host builds from: its own Flake if set,
+// otherwise the first non-empty Flake among the groups it belongs to (in
+// GroupsForHost's sorted order), otherwise "" - callers fall back to the
+// global --flake default themselves, the same way a host with no Flake set
+// always has.
+func (inv *Inventory) FlakeForHost(host *Host) string {
+	if host.Flake != "" {
+		return host.Flake
+	}
+	for _, name := range inv.GroupsForHost(host) {
+		if group, ok := inv.Groups[name]; ok && group.Flake != "" {
+			return group.Flake
+		}
+	}
+	return ""
+}
+
+// PostRebootChecksForHost resolves host's post-reboot validation config: its
+// own PostReboot if set, otherwise the first non-nil PostReboot among the
+// groups it belongs to (in GroupsForHost's sorted order), otherwise nil -
+// callers run only the plain SSH/boot-ID check and any configured probes in
+// that case.
+func (inv *Inventory) PostRebootChecksForHost(host *Host) *PostRebootValidationConfig {
+	if host.PostReboot != nil {
+		return host.PostReboot
+	}
+	for _, name := range inv.GroupsForHost(host) {
+		if group, ok := inv.Groups[name]; ok && group.PostReboot != nil {
+			return group.PostReboot
+		}
+	}
+	return nil
+}
+
+// ResolvedVarsForHost merges the Vars of every group host belongs to (in
+// GroupsForHost's sorted order) with host's own Vars, which always wins on
+// a key collision. Group.Vars values are stringified with fmt.Sprintf
+// before merging, since Host.Vars is map[string]string but Group.Vars is
+// map[string]any.
+//
+// It's an error for two different groups host belongs to - neither of
+// which the host itself overrides - to declare the same key with different
+// values, since there'd be no deterministic way to pick a winner between
+// two sources at the same precedence level.
+func (inv *Inventory) ResolvedVarsForHost(host *Host) (map[string]string, error) {
+	merged := make(map[string]string)
+	setBy := make(map[string]string)
+	for _, name := range inv.GroupsForHost(host) {
+		group, ok := inv.Groups[name]
+		if !ok {
+			continue
+		}
+		for k, v := range group.Vars {
+			s := fmt.Sprintf("%v", v)
+			if existing, ok := merged[k]; ok && existing != s {
+				return nil, fmt.Errorf("host %s: var %q set to %q by group %s and %q by group %s", host.Name, k, existing, setBy[k], s, name)
+			}
+			merged[k] = s
+			setBy[k] = name
+		}
+	}
+	for k, v := range host.Vars {
+		merged[k] = v
+	}
+	return merged, nil
+}
+
+// UseSSHConfigForHost reports whether host should resolve its connection
+// parameters through ssh_config: the host's own UseSSHConfig if it set one,
+// otherwise the inventory-wide default.
+func (inv *Inventory) UseSSHConfigForHost(host *Host) bool {
+	if host.UseSSHConfig != nil {
+		return *host.UseSSHConfig
+	}
+	return inv.UseSSHConfig
+}
+
+// LocationForHost resolves TimezoneForHost's result to a *time.Location,
+// for evaluating maintenance/reboot windows in the host's own local time.
+func (inv *Inventory) LocationForHost(host *Host) (*time.Location, error) {
+	tz := inv.TimezoneForHost(host)
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("host %s: invalid timezone %q: %w", host.Name, tz, err)
+	}
+	return loc, nil
+}
+
+// groupContainsHost reports whether hostName is a (possibly indirect, via
+// Children) member of group.
+func (inv *Inventory) groupContainsHost(group *Group, hostName string, seen map[string]bool) bool {
+	if seen[group.Name] {
+		return false
+	}
+	seen[group.Name] = true
+
+	for _, h := range group.Hosts {
+		if h == hostName {
+			return true
+		}
+	}
+	for _, childName := range group.Children {
+		if child, ok := inv.Groups[childName]; ok && inv.groupContainsHost(child, hostName, seen) {
+			return true
+		}
+	}
+	return false
+}
+
 // FilterByTag returns hosts with a matching tag
 func (inv *Inventory) FilterByTag(key, value string) []*Host {
 	var hosts []*Host
@@ -0,0 +1,246 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultDNSTimeout and defaultDNSConcurrency bound ValidateStrict's
+// --check-dns lookups when ValidateStrictOptions leaves them unset.
+const (
+	defaultDNSTimeout     = 5 * time.Second
+	defaultDNSConcurrency = 8
+)
+
+// ValidationStatus is the outcome of one ValidateStrict check, mirroring
+// nix.CheckStatus - this package doesn't depend on internal/nix, so it's
+// redefined here rather than shared.
+type ValidationStatus string
+
+const (
+	ValidationPass ValidationStatus = "pass"
+	ValidationWarn ValidationStatus = "warn"
+	ValidationFail ValidationStatus = "fail"
+)
+
+// ValidationCheck is one ValidateStrict finding.
+type ValidationCheck struct {
+	Name    string           `json:"name"`
+	Status  ValidationStatus `json:"status"`
+	Message string           `json:"message"`
+}
+
+// ValidationReport is the full set of checks ValidateStrict ran.
+type ValidationReport struct {
+	Checks []ValidationCheck `json:"checks"`
+}
+
+// HasFailures reports whether any check failed outright. A warn alone
+// doesn't fail validation.
+func (r *ValidationReport) HasFailures() bool {
+	for _, c := range r.Checks {
+		if c.Status == ValidationFail {
+			return true
+		}
+	}
+	return false
+}
+
+// FailureSummary joins every failed check's message, for a single error
+// returned to a CLI caller that doesn't want to print the full report.
+func (r *ValidationReport) FailureSummary() string {
+	var messages []string
+	for _, c := range r.Checks {
+		if c.Status == ValidationFail {
+			messages = append(messages, c.Message)
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ValidateStrictOptions configures ValidateStrict.
+type ValidateStrictOptions struct {
+	// CheckDNS, if set, resolves every host's addr with a bounded
+	// concurrent lookup and reports failures as part of the report instead
+	// of leaving them to surface deep inside an apply's SSH connection.
+	CheckDNS bool
+
+	// DNSTimeout bounds each individual lookup. Zero uses defaultDNSTimeout.
+	DNSTimeout time.Duration
+
+	// DNSConcurrency caps how many lookups run at once. Zero uses
+	// defaultDNSConcurrency.
+	DNSConcurrency int
+}
+
+// ValidateStrict runs Validate()'s consistency checks plus the additional
+// hardening this inventory package doesn't catch on its own: a host name
+// defined more than once across the loaded files (last-writer-wins in
+// inv.Hosts, reported as a failure here with every definition's file and
+// line), and the same address used by more than one host (reported as a
+// warning, since that's sometimes intentional - a NAT'd pair, a migration in
+// progress). With opts.CheckDNS, it also resolves every host's addr.
+//
+// Unlike Validate, which returns the first problem it finds, ValidateStrict
+// collects everything so a caller can fix an inventory in one pass instead
+// of one error at a time.
+func (inv *Inventory) ValidateStrict(ctx context.Context, opts ValidateStrictOptions) *ValidationReport {
+	report := &ValidationReport{}
+
+	if err := inv.Validate(); err != nil {
+		report.Checks = append(report.Checks, ValidationCheck{
+			Name:    "consistency",
+			Status:  ValidationFail,
+			Message: err.Error(),
+		})
+	} else {
+		report.Checks = append(report.Checks, ValidationCheck{
+			Name:    "consistency",
+			Status:  ValidationPass,
+			Message: "groups, apply_order, and host bases are consistent",
+		})
+	}
+
+	report.Checks = append(report.Checks, inv.checkDuplicateHosts()...)
+	report.Checks = append(report.Checks, inv.checkDuplicateAddrs()...)
+
+	if opts.CheckDNS {
+		report.Checks = append(report.Checks, inv.checkDNSResolution(ctx, opts)...)
+	}
+
+	return report
+}
+
+// checkDuplicateHosts reports every host name that was defined more than
+// once across the inventory's loaded files, naming each definition's file
+// and line so the operator doesn't have to grep for it.
+func (inv *Inventory) checkDuplicateHosts() []ValidationCheck {
+	var checks []ValidationCheck
+
+	names := make([]string, 0, len(inv.hostOccurrences))
+	for name := range inv.hostOccurrences {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		occurrences := inv.hostOccurrences[name]
+		if len(occurrences) <= 1 {
+			continue
+		}
+		locs := make([]string, len(occurrences))
+		for i, o := range occurrences {
+			locs[i] = fmt.Sprintf("%s:%d", o.File, o.Line)
+		}
+		checks = append(checks, ValidationCheck{
+			Name:    "duplicate_host:" + name,
+			Status:  ValidationFail,
+			Message: fmt.Sprintf("host %q is defined %d times: %s", name, len(occurrences), strings.Join(locs, ", ")),
+		})
+	}
+
+	return checks
+}
+
+// checkDuplicateAddrs reports any address shared by more than one host, as
+// a warning rather than a failure - unlike a duplicate host name, this is
+// sometimes intentional (e.g. a pair behind the same NAT'd addr during a
+// migration).
+func (inv *Inventory) checkDuplicateAddrs() []ValidationCheck {
+	byAddr := make(map[string][]string)
+	for name, h := range inv.Hosts {
+		if h.Addr == "" {
+			continue
+		}
+		byAddr[h.Addr] = append(byAddr[h.Addr], name)
+	}
+
+	addrs := make([]string, 0, len(byAddr))
+	for addr := range byAddr {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	var checks []ValidationCheck
+	for _, addr := range addrs {
+		names := byAddr[addr]
+		if len(names) <= 1 {
+			continue
+		}
+		sort.Strings(names)
+		checks = append(checks, ValidationCheck{
+			Name:    "duplicate_addr:" + addr,
+			Status:  ValidationWarn,
+			Message: fmt.Sprintf("address %q is shared by hosts: %s", addr, strings.Join(names, ", ")),
+		})
+	}
+
+	return checks
+}
+
+// checkDNSResolution resolves every host's addr with a bounded number of
+// lookups running concurrently, so a fleet of hundreds of hosts doesn't
+// validate serially. Only failures get their own check; a single summary
+// check covers the all-resolved case.
+func (inv *Inventory) checkDNSResolution(ctx context.Context, opts ValidateStrictOptions) []ValidationCheck {
+	timeout := opts.DNSTimeout
+	if timeout <= 0 {
+		timeout = defaultDNSTimeout
+	}
+	concurrency := opts.DNSConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultDNSConcurrency
+	}
+
+	hosts := inv.AllHosts()
+	type lookupResult struct {
+		host string
+		addr string
+		err  error
+	}
+	results := make([]lookupResult, len(hosts))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, h := range hosts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, h *Host) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			_, err := net.DefaultResolver.LookupHost(lookupCtx, h.Addr)
+			results[i] = lookupResult{host: h.Name, addr: h.Addr, err: err}
+		}(i, h)
+	}
+	wg.Wait()
+
+	var checks []ValidationCheck
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			checks = append(checks, ValidationCheck{
+				Name:    "dns:" + r.host,
+				Status:  ValidationFail,
+				Message: fmt.Sprintf("host %q address %q did not resolve: %v", r.host, r.addr, r.err),
+			})
+		}
+	}
+	if failed == 0 {
+		checks = append(checks, ValidationCheck{
+			Name:    "dns_resolution",
+			Status:  ValidationPass,
+			Message: fmt.Sprintf("all %d host address(es) resolved", len(hosts)),
+		})
+	}
+
+	return checks
+}
@@ -0,0 +1,306 @@
+package k0s
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nixfleet/nixfleet/internal/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// AddonsFile is the `k0s-addons.yaml` format consumed by
+// 'nixfleet k0s images bundle --from'. It mirrors the extensions.helm.charts
+// shape used in k0s.yaml, kept standalone so image resolution doesn't
+// require a live host to read the rendered config from.
+type AddonsFile struct {
+	Charts []AddonChart `yaml:"charts"`
+}
+
+// AddonChart is a single Helm chart entry in an AddonsFile.
+type AddonChart struct {
+	Name      string            `yaml:"name"`
+	ChartName string            `yaml:"chartname"`
+	Version   string            `yaml:"version"`
+	Namespace string            `yaml:"namespace"`
+	Values    map[string]string `yaml:"values,omitempty"`
+}
+
+// LoadAddonsFile reads and parses an addons file.
+func LoadAddonsFile(path string) (*AddonsFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading addons file: %w", err)
+	}
+
+	var addons AddonsFile
+	if err := yaml.Unmarshal(data, &addons); err != nil {
+		return nil, fmt.Errorf("parsing addons file: %w", err)
+	}
+	return &addons, nil
+}
+
+// imagePattern matches `image: repo/name:tag` lines in rendered Helm/k8s
+// manifests, with or without surrounding quotes.
+var imagePattern = regexp.MustCompile(`(?m)^\s*-?\s*image:\s*"?([a-zA-Z0-9./_-]+(?::[a-zA-Z0-9._-]+)?)"?\s*$`)
+
+// ResolveChartImages renders a Helm chart with `helm template` and extracts
+// the image references it uses. It does not require cluster access.
+func ResolveChartImages(chartName, version, namespace string, values map[string]string) ([]string, error) {
+	args := []string{"template", chartName, "--namespace", namespace}
+	if version != "" {
+		args = append(args, "--version", version)
+	}
+	for k, v := range values {
+		args = append(args, "--set", fmt.Sprintf("%s=%s", k, v))
+	}
+
+	out, err := exec.Command("helm", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("helm template %s: %w", chartName, err)
+	}
+
+	return extractImages(string(out)), nil
+}
+
+// extractImages returns the deduplicated, sorted set of image references
+// found in a rendered manifest.
+func extractImages(rendered string) []string {
+	seen := make(map[string]bool)
+	for _, m := range imagePattern.FindAllStringSubmatch(rendered, -1) {
+		seen[m[1]] = true
+	}
+
+	images := make([]string, 0, len(seen))
+	for img := range seen {
+		images = append(images, img)
+	}
+	sort.Strings(images)
+	return images
+}
+
+// SystemImages returns the k0s system images (kube-proxy, coredns, etc.) for
+// the k0s version installed locally, via `k0s airgap list-images`. Returns
+// an empty list (not an error) if k0s isn't available locally, since bundles
+// can still be built from addon images alone.
+func SystemImages() ([]string, error) {
+	out, err := exec.Command("k0s", "airgap", "list-images").Output()
+	if err != nil {
+		return nil, nil
+	}
+
+	var images []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			images = append(images, line)
+		}
+	}
+	return images, nil
+}
+
+// BundleResult describes a built airgapped image bundle.
+type BundleResult struct {
+	OutputPath string
+	Images     []string
+	SHA256     string
+}
+
+// BuildBundle pulls the given images with containerd's `ctr` and exports
+// them as a single OCI archive at outputPath, suitable for pushing to hosts
+// with 'nixfleet k0s images push'.
+func BuildBundle(images []string, outputPath string) (*BundleResult, error) {
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images to bundle")
+	}
+
+	for _, img := range images {
+		pull := exec.Command("ctr", "images", "pull", img)
+		if out, err := pull.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("pulling %s: %w: %s", img, err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	exportArgs := append([]string{"images", "export", outputPath}, images...)
+	export := exec.Command("ctr", exportArgs...)
+	if out, err := export.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("exporting bundle: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	sum, err := sha256File(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("hashing bundle: %w", err)
+	}
+
+	return &BundleResult{
+		OutputPath: outputPath,
+		Images:     images,
+		SHA256:     sum,
+	}, nil
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ImagesDir is where pushed bundles are stored on the remote host.
+const ImagesDir = "/var/lib/k0s/images"
+
+// pushChunkSize is how much of the local bundle is transferred per SSH exec,
+// base64-encoded and appended to the remote partial file. Kept well under
+// the SSH client's MaxOutputBytes and typical shell command-length limits.
+const pushChunkSize = 2 * 1024 * 1024 // 2 MiB
+
+// PushResult describes the outcome of pushing a bundle to a host.
+type PushResult struct {
+	RemotePath string
+	SHA256     string
+	Resumed    bool
+	BytesSent  int64
+}
+
+// PushBundle uploads a local bundle tar to {ImagesDir}/{name} on the remote
+// host over the existing SSH client, verifying the transfer with a SHA-256
+// checksum. If a partial upload from a previous attempt is found (matching
+// bytes verified against the local file), the transfer resumes from where
+// it left off rather than restarting the multi-GB copy.
+func PushBundle(ctx context.Context, client *ssh.Client, localPath string, name string) (*PushResult, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("opening bundle: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat bundle: %w", err)
+	}
+
+	localSum, err := sha256File(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("hashing bundle: %w", err)
+	}
+
+	remotePartial := fmt.Sprintf("%s/%s.partial", ImagesDir, name)
+	remoteFinal := fmt.Sprintf("%s/%s", ImagesDir, name)
+
+	if _, err := client.ExecSudo(ctx, fmt.Sprintf("mkdir -p %s", ImagesDir)); err != nil {
+		return nil, fmt.Errorf("creating %s: %w", ImagesDir, err)
+	}
+
+	// Check if this exact bundle is already loaded; nothing to do.
+	sumResult, _ := client.ExecSudo(ctx, fmt.Sprintf("sha256sum %s 2>/dev/null | cut -d' ' -f1", remoteFinal))
+	if sumResult != nil && strings.TrimSpace(sumResult.Stdout) == localSum {
+		return &PushResult{RemotePath: remoteFinal, SHA256: localSum, Resumed: false, BytesSent: 0}, nil
+	}
+
+	// Resume from a prior partial upload if its prefix matches the local file.
+	var offset int64
+	resumed := false
+	sizeResult, _ := client.Exec(ctx, fmt.Sprintf("stat -c%%s %s 2>/dev/null || echo 0", remotePartial))
+	if sizeResult != nil {
+		fmt.Sscanf(strings.TrimSpace(sizeResult.Stdout), "%d", &offset)
+	}
+	if offset > 0 {
+		if offset > info.Size() {
+			offset = 0
+		} else if verifyPrefix(ctx, client, remotePartial, f, offset) {
+			resumed = true
+		} else {
+			offset = 0
+			_, _ = client.ExecSudo(ctx, fmt.Sprintf("rm -f %s", remotePartial))
+		}
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("seeking local bundle: %w", err)
+	}
+
+	reader := bufio.NewReaderSize(f, pushChunkSize)
+	buf := make([]byte, pushChunkSize)
+	var sent int64
+
+	for {
+		n, readErr := io.ReadFull(reader, buf)
+		if n > 0 {
+			encoded := base64.StdEncoding.EncodeToString(buf[:n])
+			cmd := fmt.Sprintf("echo '%s' | base64 -d | sudo tee -a %s > /dev/null", encoded, remotePartial)
+			if _, err := client.Exec(ctx, cmd); err != nil {
+				return nil, fmt.Errorf("uploading chunk at offset %d: %w", offset+sent, err)
+			}
+			sent += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return nil, fmt.Errorf("reading local bundle: %w", readErr)
+		}
+	}
+
+	verifyResult, err := client.ExecSudo(ctx, fmt.Sprintf("sha256sum %s | cut -d' ' -f1", remotePartial))
+	if err != nil {
+		return nil, fmt.Errorf("verifying upload: %w", err)
+	}
+	remoteSum := strings.TrimSpace(verifyResult.Stdout)
+	if remoteSum != localSum {
+		return nil, fmt.Errorf("checksum mismatch after upload: local %s, remote %s", localSum, remoteSum)
+	}
+
+	if _, err := client.ExecSudo(ctx, fmt.Sprintf("mv %s %s", remotePartial, remoteFinal)); err != nil {
+		return nil, fmt.Errorf("finalizing upload: %w", err)
+	}
+
+	return &PushResult{RemotePath: remoteFinal, SHA256: localSum, Resumed: resumed, BytesSent: sent}, nil
+}
+
+// verifyPrefix checks that the first `offset` bytes of the remote partial
+// file match the local file, so an interrupted upload can be resumed
+// without risking a corrupt append.
+func verifyPrefix(ctx context.Context, client *ssh.Client, remotePath string, local *os.File, offset int64) bool {
+	section := io.NewSectionReader(local, 0, offset)
+	h := sha256.New()
+	if _, err := io.Copy(h, section); err != nil {
+		return false
+	}
+	localPrefixSum := hex.EncodeToString(h.Sum(nil))
+
+	result, err := client.ExecSudo(ctx, fmt.Sprintf("head -c %d %s | sha256sum | cut -d' ' -f1", offset, remotePath))
+	if err != nil || result.ExitCode != 0 {
+		return false
+	}
+	return strings.TrimSpace(result.Stdout) == localPrefixSum
+}
+
+// LoadBundle loads a pushed bundle into the host's containerd image store
+// via `k0s ctr images import` (k0s ships its own containerd control socket).
+func LoadBundle(ctx context.Context, client *ssh.Client, name string) error {
+	remotePath := fmt.Sprintf("%s/%s", ImagesDir, name)
+	result, err := client.ExecSudo(ctx, fmt.Sprintf("%s ctr images import %s", K0sPath, remotePath))
+	if err != nil {
+		return fmt.Errorf("importing bundle: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("k0s ctr images import failed: %s", strings.TrimSpace(result.Stderr))
+	}
+	return nil
+}
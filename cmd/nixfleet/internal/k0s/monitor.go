@@ -0,0 +1,273 @@
+package k0s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/ssh"
+)
+
+// podRestartWindow bounds "pod restarts in the last hour" to containers
+// whose last termination falls within this window - Kubernetes only tracks
+// a cumulative restartCount, not per-restart timestamps, so a container's
+// lastState.terminated.finishedAt is the closest approximation available.
+const podRestartWindow = time.Hour
+
+// eventWindow bounds "recent Warning events" the same way.
+const eventWindow = time.Hour
+
+// maxWarnings caps how many Warning events a Summary carries, newest first,
+// so a noisy cluster doesn't grow the snapshot unbounded.
+const maxWarnings = 20
+
+// Summary is a curated, point-in-time snapshot of one k0s cluster's health,
+// collected entirely through k0s kubectl over the existing SSH connection -
+// the same way GetStatus already does - so no kubeconfig or token is ever
+// fetched to, or persisted on, the nixfleet server.
+type Summary struct {
+	CollectedAt    time.Time       `json:"collected_at"`
+	NodeConditions []NodeCondition `json:"node_conditions,omitempty"`
+	PodRestarts    []PodRestart    `json:"pod_restarts,omitempty"`
+	PendingPods    []PendingPod    `json:"pending_pods,omitempty"`
+	Warnings       []WarningEvent  `json:"warnings,omitempty"`
+
+	// Error notes any section that failed to collect (e.g. "listing events
+	// failed") without discarding whichever sections did succeed.
+	Error string `json:"error,omitempty"`
+}
+
+// NodeCondition is one node's status condition, e.g. Ready or
+// DiskPressure - all conditions are kept, not just Ready, since the point
+// of this view is to surface trouble GetStatus's Ready-only summary hides.
+type NodeCondition struct {
+	Node   string `json:"node"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// PodRestart is one container that restarted within podRestartWindow.
+type PodRestart struct {
+	Namespace   string    `json:"namespace"`
+	Pod         string    `json:"pod"`
+	Container   string    `json:"container"`
+	Restarts    int32     `json:"restarts"`
+	LastRestart time.Time `json:"last_restart"`
+}
+
+// PendingPod is a pod stuck in the Pending phase.
+type PendingPod struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// WarningEvent is one recent Warning-type event.
+type WarningEvent struct {
+	Namespace string    `json:"namespace"`
+	Object    string    `json:"object"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// CollectSummary gathers node conditions, recent pod restarts, pending
+// pods, and recent Warning events over client. It's best-effort per
+// section: a failure fetching one kind of object doesn't prevent the
+// others from populating, and is recorded in Summary.Error rather than
+// failing the whole collection. It returns an error only when k0s itself
+// isn't enabled on the host.
+func (r *Reconciler) CollectSummary(ctx context.Context, client *ssh.Client) (*Summary, error) {
+	if !r.IsK0sEnabled(ctx, client) {
+		return nil, fmt.Errorf("k0s is not enabled on this host")
+	}
+
+	summary := &Summary{CollectedAt: time.Now()}
+	var failures []string
+
+	if err := collectNodeConditions(ctx, client, summary); err != nil {
+		failures = append(failures, "listing nodes failed: "+err.Error())
+	}
+	if err := collectPods(ctx, client, summary); err != nil {
+		failures = append(failures, "listing pods failed: "+err.Error())
+	}
+	if err := collectWarnings(ctx, client, summary); err != nil {
+		failures = append(failures, "listing events failed: "+err.Error())
+	}
+
+	summary.Error = strings.Join(failures, "; ")
+	return summary, nil
+}
+
+func collectNodeConditions(ctx context.Context, client *ssh.Client, summary *Summary) error {
+	result, err := client.ExecSudo(ctx, fmt.Sprintf("%s kubectl get nodes -o json", K0sPath))
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("%s", strings.TrimSpace(result.Stderr))
+	}
+
+	var nodeList struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Status struct {
+				Conditions []struct {
+					Type   string `json:"type"`
+					Status string `json:"status"`
+					Reason string `json:"reason"`
+				} `json:"conditions"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &nodeList); err != nil {
+		return err
+	}
+
+	for _, node := range nodeList.Items {
+		for _, cond := range node.Status.Conditions {
+			summary.NodeConditions = append(summary.NodeConditions, NodeCondition{
+				Node:   node.Metadata.Name,
+				Type:   cond.Type,
+				Status: cond.Status,
+				Reason: cond.Reason,
+			})
+		}
+	}
+	return nil
+}
+
+func collectPods(ctx context.Context, client *ssh.Client, summary *Summary) error {
+	result, err := client.ExecSudo(ctx, fmt.Sprintf("%s kubectl get pods -A -o json", K0sPath))
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("%s", strings.TrimSpace(result.Stderr))
+	}
+
+	var podList struct {
+		Items []struct {
+			Metadata struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+			Status struct {
+				Phase      string `json:"phase"`
+				Conditions []struct {
+					Type   string `json:"type"`
+					Status string `json:"status"`
+					Reason string `json:"reason"`
+				} `json:"conditions"`
+				ContainerStatuses []struct {
+					Name         string `json:"name"`
+					RestartCount int32  `json:"restartCount"`
+					LastState    struct {
+						Terminated *struct {
+							FinishedAt time.Time `json:"finishedAt"`
+						} `json:"terminated"`
+					} `json:"lastState"`
+				} `json:"containerStatuses"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &podList); err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-podRestartWindow)
+	for _, pod := range podList.Items {
+		if pod.Status.Phase == "Pending" {
+			reason := "Pending"
+			for _, cond := range pod.Status.Conditions {
+				if cond.Status != "True" && cond.Reason != "" {
+					reason = cond.Reason
+					break
+				}
+			}
+			summary.PendingPods = append(summary.PendingPods, PendingPod{
+				Namespace: pod.Metadata.Namespace,
+				Pod:       pod.Metadata.Name,
+				Reason:    reason,
+			})
+		}
+
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.RestartCount == 0 || cs.LastState.Terminated == nil {
+				continue
+			}
+			if cs.LastState.Terminated.FinishedAt.Before(cutoff) {
+				continue
+			}
+			summary.PodRestarts = append(summary.PodRestarts, PodRestart{
+				Namespace:   pod.Metadata.Namespace,
+				Pod:         pod.Metadata.Name,
+				Container:   cs.Name,
+				Restarts:    cs.RestartCount,
+				LastRestart: cs.LastState.Terminated.FinishedAt,
+			})
+		}
+	}
+	return nil
+}
+
+func collectWarnings(ctx context.Context, client *ssh.Client, summary *Summary) error {
+	result, err := client.ExecSudo(ctx, fmt.Sprintf("%s kubectl get events -A --field-selector type=Warning -o json", K0sPath))
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("%s", strings.TrimSpace(result.Stderr))
+	}
+
+	var eventList struct {
+		Items []struct {
+			InvolvedObject struct {
+				Kind      string `json:"kind"`
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"involvedObject"`
+			Reason        string    `json:"reason"`
+			Message       string    `json:"message"`
+			LastTimestamp time.Time `json:"lastTimestamp"`
+			EventTime     time.Time `json:"eventTime"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &eventList); err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-eventWindow)
+	var warnings []WarningEvent
+	for _, ev := range eventList.Items {
+		lastSeen := ev.LastTimestamp
+		if lastSeen.IsZero() {
+			lastSeen = ev.EventTime
+		}
+		if lastSeen.Before(cutoff) {
+			continue
+		}
+		warnings = append(warnings, WarningEvent{
+			Namespace: ev.InvolvedObject.Namespace,
+			Object:    fmt.Sprintf("%s/%s", ev.InvolvedObject.Kind, ev.InvolvedObject.Name),
+			Reason:    ev.Reason,
+			Message:   ev.Message,
+			LastSeen:  lastSeen,
+		})
+	}
+
+	sort.Slice(warnings, func(i, j int) bool {
+		return warnings[i].LastSeen.After(warnings[j].LastSeen)
+	})
+	if len(warnings) > maxWarnings {
+		warnings = warnings[:maxWarnings]
+	}
+	summary.Warnings = warnings
+	return nil
+}
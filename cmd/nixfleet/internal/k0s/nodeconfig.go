@@ -0,0 +1,466 @@
+package k0s
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/ssh"
+	"github.com/nixfleet/nixfleet/internal/state"
+)
+
+// WorkerProfileLabel is the node label k0s uses to select which
+// ClusterConfig spec.workerProfiles entry a worker's kubelet runs with -
+// see https://docs.k0sproject.io/ "Worker profiles". Reconciling a node's
+// kubelet overrides means writing this label as well as the profile itself,
+// since a profile that exists in ClusterConfig but isn't referenced by any
+// node's label never takes effect.
+const WorkerProfileLabel = "k0sproject.io/worker-profile"
+
+// ContainerdRegistryDir is where nixfleet writes per-registry containerd
+// mirror config, following containerd's "Registry Configuration Path"
+// convention (config_path/<host>/hosts.toml) so adding or changing one
+// registry's mirror never requires touching the others.
+const ContainerdRegistryDir = "/etc/k0s/containerd.d/certs.d"
+
+// protectedLabelPrefixes names label key prefixes ReconcileNodeConfig never
+// prunes even with PruneLabels set, since these are written by k0s/Kubernetes
+// itself (node identity, kubelet-reported topology, this package's own
+// WorkerProfileLabel) rather than by an operator - pruning them would fight
+// the control plane instead of cleaning up stray operator labels.
+var protectedLabelPrefixes = []string{
+	"kubernetes.io/",
+	"k8s.io/",
+	"node.kubernetes.io/",
+	"node-role.kubernetes.io/",
+	"k0sproject.io/",
+}
+
+// isProtectedLabel reports whether key falls under a protectedLabelPrefixes
+// entry, or is the bare "kubernetes.io"/"k8s.io" domain itself.
+func isProtectedLabel(key string) bool {
+	for _, prefix := range protectedLabelPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Taint is one Kubernetes node taint, mirroring inventory.K0sTaint.
+type Taint struct {
+	Key    string
+	Value  string
+	Effect string // NoSchedule, PreferNoSchedule, or NoExecute
+}
+
+// String renders t in kubectl's "key=value:Effect" taint syntax.
+func (t Taint) String() string {
+	if t.Value == "" {
+		return fmt.Sprintf("%s:%s", t.Key, t.Effect)
+	}
+	return fmt.Sprintf("%s=%s:%s", t.Key, t.Value, t.Effect)
+}
+
+// nodeReadyTimeout bounds how long ReconcileNodeConfig waits for a node to
+// report Ready again after a restart triggered by a content change.
+const nodeReadyTimeout = 3 * time.Minute
+
+// NodeConfig is one host's kubelet and containerd overrides, mirroring
+// inventory.Host.K0sNodeConfig - kept as its own type here so this package
+// doesn't import internal/inventory, the same split already used between
+// ParsedK0sConfig and state.K0sState.
+type NodeConfig struct {
+	// Profile names the k0s WorkerProfile this host's kubelet overrides are
+	// rendered into (spec.workerProfiles[].name in the controller's
+	// ClusterConfig, and this node's WorkerProfileLabel value). Defaults to
+	// the host name when empty.
+	Profile string
+
+	// KubeletOverrides is merged into the WorkerProfile's kubelet config
+	// values, e.g. {"maxPods": 150, "kubeReserved": map[string]any{"cpu": "500m"}}.
+	KubeletOverrides map[string]any
+
+	// ContainerdRegistries are registry mirror/auth entries rendered as
+	// containerd hosts.toml drop-ins on the node.
+	ContainerdRegistries []ContainerdRegistryMirror
+
+	// NodeLabels are Kubernetes node labels to reconcile onto nodeName via
+	// kubectl label, on top of whatever the kubelet's own --node-labels
+	// already set at join time (see modules/k0s.nix's nodeLabels option).
+	NodeLabels map[string]string
+
+	// NodeTaints are taints to reconcile onto nodeName via kubectl taint.
+	NodeTaints []Taint
+
+	// PruneLabels removes labels and taints present on the node but not in
+	// NodeLabels/NodeTaints, so labels applied out of band (by hand, or by a
+	// workload operator) don't linger after they're no longer declared.
+	// Labels under protectedLabelPrefixes are never pruned regardless.
+	PruneLabels bool
+}
+
+// ContainerdRegistryMirror is one registry's mirror endpoints and optional
+// pull credentials, sent as a Basic auth header on requests to Endpoints.
+type ContainerdRegistryMirror struct {
+	Registry  string
+	Endpoints []string
+	Username  string
+	Password  string
+}
+
+// HasOverrides reports whether cfg declares anything to reconcile, so
+// callers can skip the whole node-config path for the common case of a host
+// with no overrides configured at all.
+func (cfg NodeConfig) HasOverrides() bool {
+	return len(cfg.KubeletOverrides) > 0 || len(cfg.ContainerdRegistries) > 0 ||
+		len(cfg.NodeLabels) > 0 || len(cfg.NodeTaints) > 0
+}
+
+// NodeConfigResult reports what ReconcileNodeConfig actually changed.
+type NodeConfigResult struct {
+	Profile              string   `json:"profile,omitempty"`
+	WorkerProfileChanged bool     `json:"worker_profile_changed"`
+	ContainerdChanged    []string `json:"containerd_changed,omitempty"`
+	LabelsChanged        []string `json:"labels_changed,omitempty"`
+	TaintsChanged        bool     `json:"taints_changed"`
+	PrunedLabels         []string `json:"pruned_labels,omitempty"`
+	PrunedTaints         []string `json:"pruned_taints,omitempty"`
+	Restarted            bool     `json:"restarted"`
+	NodeReady            bool     `json:"node_ready"`
+
+	// ManagedFiles are the rendered containerd drop-ins, keyed by their
+	// on-host path, for the caller to register via
+	// state.Manager.UpdateManagedFile so drift detection picks them up.
+	ManagedFiles map[string]state.FileState `json:"-"`
+}
+
+// ReconcileNodeConfig renders cfg's kubelet overrides into nodeName's k0s
+// WorkerProfile (patching ClusterConfig and labeling the node, both via
+// controllerClient's admin kubectl) and cfg's containerd registry mirrors
+// onto the node itself (via nodeClient), restarting the node's k0s service
+// only when the rendered content actually changed, then waiting for the
+// node to report Ready again. controllerClient and nodeClient are the same
+// connection when nodeName is itself the controller.
+func (r *Reconciler) ReconcileNodeConfig(ctx context.Context, controllerClient, nodeClient *ssh.Client, nodeName, role string, cfg NodeConfig) (*NodeConfigResult, error) {
+	result := &NodeConfigResult{
+		Profile:      cfg.Profile,
+		ManagedFiles: make(map[string]state.FileState),
+	}
+	if result.Profile == "" {
+		result.Profile = nodeName
+	}
+
+	changed := false
+
+	if len(cfg.KubeletOverrides) > 0 {
+		profileChanged, err := applyWorkerProfile(ctx, controllerClient, nodeName, result.Profile, cfg.KubeletOverrides)
+		if err != nil {
+			return nil, fmt.Errorf("applying worker profile %s: %w", result.Profile, err)
+		}
+		result.WorkerProfileChanged = profileChanged
+		changed = changed || profileChanged
+	}
+
+	for _, mirror := range cfg.ContainerdRegistries {
+		path, fileChanged, fs, err := applyContainerdMirror(ctx, nodeClient, mirror)
+		if err != nil {
+			return nil, fmt.Errorf("applying containerd mirror for %s: %w", mirror.Registry, err)
+		}
+		result.ManagedFiles[path] = fs
+		if fileChanged {
+			result.ContainerdChanged = append(result.ContainerdChanged, path)
+			changed = true
+		}
+	}
+
+	// Labels and taints are pure Kubernetes API-server metadata: applying
+	// them never needs a kubelet restart, so they're reconciled regardless
+	// of whether the restart-worthy changes above fired.
+	if len(cfg.NodeLabels) > 0 || len(cfg.NodeTaints) > 0 || cfg.PruneLabels {
+		labelsChanged, taintsChanged, prunedLabels, prunedTaints, err := applyNodeLabelsAndTaints(
+			ctx, controllerClient, nodeName, cfg.NodeLabels, cfg.NodeTaints, cfg.PruneLabels)
+		if err != nil {
+			return nil, fmt.Errorf("applying node labels/taints for %s: %w", nodeName, err)
+		}
+		result.LabelsChanged = labelsChanged
+		result.TaintsChanged = taintsChanged
+		result.PrunedLabels = prunedLabels
+		result.PrunedTaints = prunedTaints
+	}
+
+	if !changed {
+		return result, nil
+	}
+
+	unit := serviceUnit(role)
+	if restartResult, err := nodeClient.ExecSudo(ctx, fmt.Sprintf("systemctl restart %s", unit)); err != nil || restartResult.ExitCode != 0 {
+		return result, fmt.Errorf("restarting %s: %w", unit, err)
+	}
+	result.Restarted = true
+
+	if err := WaitForNodeReady(ctx, controllerClient, nodeName, nodeReadyTimeout); err != nil {
+		return result, fmt.Errorf("waiting for %s to become Ready after node config change: %w", nodeName, err)
+	}
+	result.NodeReady = true
+
+	return result, nil
+}
+
+// workerProfile is one spec.workerProfiles[] entry in a k0s ClusterConfig.
+type workerProfile struct {
+	Name   string         `json:"name"`
+	Values map[string]any `json:"values,omitempty"`
+}
+
+// applyWorkerProfile upserts profile into the controller's ClusterConfig
+// workerProfiles and labels nodeName so k0s actually selects it, reporting
+// whether either the profile's content or the node's label changed - either
+// one means the node's kubelet needs restarting to pick it up.
+func applyWorkerProfile(ctx context.Context, controllerClient *ssh.Client, nodeName, profile string, overrides map[string]any) (bool, error) {
+	getResult, err := controllerClient.ExecSudo(ctx, fmt.Sprintf(
+		"%s kubectl get clusterconfig k0s -n kube-system -o jsonpath='{.spec.workerProfiles}'", K0sPath))
+	if err != nil {
+		return false, fmt.Errorf("reading cluster config: %w", err)
+	}
+	if getResult.ExitCode != 0 {
+		return false, fmt.Errorf("reading cluster config: %s", strings.TrimSpace(getResult.Stderr))
+	}
+
+	var profiles []workerProfile
+	if raw := strings.TrimSpace(getResult.Stdout); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &profiles); err != nil {
+			return false, fmt.Errorf("parsing existing worker profiles: %w", err)
+		}
+	}
+
+	contentChanged := true
+	found := false
+	for i, p := range profiles {
+		if p.Name != profile {
+			continue
+		}
+		found = true
+		if valuesEqual(p.Values, overrides) {
+			contentChanged = false
+		}
+		profiles[i].Values = overrides
+		break
+	}
+	if !found {
+		profiles = append(profiles, workerProfile{Name: profile, Values: overrides})
+	}
+
+	if contentChanged {
+		patch, err := json.Marshal(map[string]any{"spec": map[string]any{"workerProfiles": profiles}})
+		if err != nil {
+			return false, fmt.Errorf("encoding worker profiles: %w", err)
+		}
+		writeCmd := fmt.Sprintf("cat > /tmp/nixfleet-k0s-workerprofiles.json << 'NIXFLEET_EOF'\n%s\nNIXFLEET_EOF", patch)
+		if result, err := controllerClient.ExecSudo(ctx, writeCmd); err != nil || result.ExitCode != 0 {
+			return false, fmt.Errorf("staging worker profile patch: %w", err)
+		}
+		patchCmd := fmt.Sprintf(
+			"%s kubectl patch clusterconfig k0s -n kube-system --type=merge --patch-file=/tmp/nixfleet-k0s-workerprofiles.json && rm -f /tmp/nixfleet-k0s-workerprofiles.json",
+			K0sPath)
+		if result, err := controllerClient.ExecSudo(ctx, patchCmd); err != nil || result.ExitCode != 0 {
+			return false, fmt.Errorf("patching cluster config: %w", err)
+		}
+	}
+
+	currentLabelResult, _ := controllerClient.ExecSudo(ctx, fmt.Sprintf(
+		"%s kubectl get node %s -o jsonpath='{.metadata.labels.%s}'", K0sPath, nodeName, jsonPathEscape(WorkerProfileLabel)))
+	labelChanged := currentLabelResult == nil || strings.TrimSpace(currentLabelResult.Stdout) != profile
+
+	if labelChanged {
+		labelResult, err := controllerClient.ExecSudo(ctx, fmt.Sprintf(
+			"%s kubectl label node %s %s=%s --overwrite", K0sPath, nodeName, WorkerProfileLabel, profile))
+		if err != nil {
+			return false, fmt.Errorf("labeling node %s: %w", nodeName, err)
+		}
+		if labelResult.ExitCode != 0 {
+			return false, fmt.Errorf("labeling node %s: %s", nodeName, strings.TrimSpace(labelResult.Stderr))
+		}
+	}
+
+	return contentChanged || labelChanged, nil
+}
+
+// jsonPathEscape escapes the dots in a label key for use inside a
+// kubectl -o jsonpath='{.metadata.labels.<key>}' expression, where an
+// unescaped "." would otherwise be read as a field separator.
+func jsonPathEscape(key string) string {
+	return strings.ReplaceAll(key, ".", `\.`)
+}
+
+// valuesEqual compares two kubelet override maps by their canonical JSON
+// encoding - encoding/json sorts map keys, so this is order-independent.
+func valuesEqual(a, b map[string]any) bool {
+	aj, errA := json.Marshal(a)
+	bj, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aj) == string(bj)
+}
+
+// nodeTaint is one spec.taints[] entry as kubectl get node -o json reports
+// it.
+type nodeTaint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Effect string `json:"effect"`
+}
+
+// applyNodeLabelsAndTaints reconciles labels and taints onto nodeName: every
+// entry in wantLabels/wantTaints missing or mismatched is applied, and, when
+// prune is set, every label/taint present on the node but not declared is
+// removed - skipping anything under protectedLabelPrefixes so k0s/Kubernetes
+// -owned metadata is never touched. Returns the keys that were added or
+// changed, whether any taint changed, and what was pruned.
+func applyNodeLabelsAndTaints(ctx context.Context, controllerClient *ssh.Client, nodeName string, wantLabels map[string]string, wantTaints []Taint, prune bool) ([]string, bool, []string, []string, error) {
+	getResult, err := controllerClient.ExecSudo(ctx, fmt.Sprintf(
+		"%s kubectl get node %s -o json", K0sPath, nodeName))
+	if err != nil {
+		return nil, false, nil, nil, fmt.Errorf("reading node: %w", err)
+	}
+	if getResult.ExitCode != 0 {
+		return nil, false, nil, nil, fmt.Errorf("reading node: %s", strings.TrimSpace(getResult.Stderr))
+	}
+
+	var current struct {
+		Metadata struct {
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+		Spec struct {
+			Taints []nodeTaint `json:"taints"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal([]byte(getResult.Stdout), &current); err != nil {
+		return nil, false, nil, nil, fmt.Errorf("parsing node: %w", err)
+	}
+
+	var labelsChanged, prunedLabels, prunedTaints []string
+
+	for key, value := range wantLabels {
+		if current.Metadata.Labels[key] == value {
+			continue
+		}
+		labelResult, err := controllerClient.ExecSudo(ctx, fmt.Sprintf(
+			"%s kubectl label node %s %s=%s --overwrite", K0sPath, nodeName, key, value))
+		if err != nil || labelResult.ExitCode != 0 {
+			return labelsChanged, false, prunedLabels, prunedTaints, fmt.Errorf("labeling node %s with %s=%s: %w", nodeName, key, value, err)
+		}
+		labelsChanged = append(labelsChanged, key)
+	}
+
+	if prune {
+		for key := range current.Metadata.Labels {
+			if _, wanted := wantLabels[key]; wanted || isProtectedLabel(key) {
+				continue
+			}
+			unlabelResult, err := controllerClient.ExecSudo(ctx, fmt.Sprintf(
+				"%s kubectl label node %s %s-", K0sPath, nodeName, key))
+			if err != nil || unlabelResult.ExitCode != 0 {
+				return labelsChanged, false, prunedLabels, prunedTaints, fmt.Errorf("pruning label %s from node %s: %w", key, nodeName, err)
+			}
+			prunedLabels = append(prunedLabels, key)
+		}
+	}
+
+	wantByKey := make(map[string]Taint, len(wantTaints))
+	for _, t := range wantTaints {
+		wantByKey[t.Key] = t
+	}
+	currentByKey := make(map[string]nodeTaint, len(current.Spec.Taints))
+	for _, t := range current.Spec.Taints {
+		currentByKey[t.Key] = t
+	}
+
+	taintsChanged := false
+	for _, t := range wantTaints {
+		if c, ok := currentByKey[t.Key]; ok && c.Value == t.Value && c.Effect == t.Effect {
+			continue
+		}
+		taintResult, err := controllerClient.ExecSudo(ctx, fmt.Sprintf(
+			"%s kubectl taint node %s %s --overwrite", K0sPath, nodeName, t.String()))
+		if err != nil || taintResult.ExitCode != 0 {
+			return labelsChanged, taintsChanged, prunedLabels, prunedTaints, fmt.Errorf("tainting node %s with %s: %w", nodeName, t.String(), err)
+		}
+		taintsChanged = true
+	}
+
+	if prune {
+		for _, t := range current.Spec.Taints {
+			if _, wanted := wantByKey[t.Key]; wanted {
+				continue
+			}
+			removeTaint := Taint{Key: t.Key, Value: t.Value, Effect: t.Effect}
+			taintResult, err := controllerClient.ExecSudo(ctx, fmt.Sprintf(
+				"%s kubectl taint node %s %s-", K0sPath, nodeName, removeTaint.String()))
+			if err != nil || taintResult.ExitCode != 0 {
+				return labelsChanged, taintsChanged, prunedLabels, prunedTaints, fmt.Errorf("pruning taint %s from node %s: %w", t.Key, nodeName, err)
+			}
+			prunedTaints = append(prunedTaints, removeTaint.String())
+			taintsChanged = true
+		}
+	}
+
+	return labelsChanged, taintsChanged, prunedLabels, prunedTaints, nil
+}
+
+// applyContainerdMirror renders mirror's hosts.toml and writes it to the
+// node if its content differs from what's already there, returning the
+// rendered path, whether it changed, and the FileState for drift tracking.
+func applyContainerdMirror(ctx context.Context, client *ssh.Client, mirror ContainerdRegistryMirror) (string, bool, state.FileState, error) {
+	content := renderHostsToml(mirror)
+	hash := hashString(content)
+	dir := fmt.Sprintf("%s/%s", ContainerdRegistryDir, mirror.Registry)
+	path := dir + "/hosts.toml"
+
+	fs := state.FileState{
+		Path:  path,
+		Hash:  hash,
+		Mode:  "0644",
+		Owner: "root",
+		Group: "root",
+	}
+
+	existingResult, _ := client.ExecSudo(ctx, fmt.Sprintf("sha256sum %s 2>/dev/null | cut -d' ' -f1", path))
+	if existingResult != nil && strings.TrimSpace(existingResult.Stdout) == hash {
+		return path, false, fs, nil
+	}
+
+	if result, err := client.ExecSudo(ctx, fmt.Sprintf("mkdir -p %s", dir)); err != nil || result.ExitCode != 0 {
+		return path, false, fs, fmt.Errorf("creating %s: %w", dir, err)
+	}
+
+	writeCmd := fmt.Sprintf("tee %s > /dev/null << 'NIXFLEET_EOF'\n%sNIXFLEET_EOF", path, content)
+	if result, err := client.ExecSudo(ctx, writeCmd); err != nil || result.ExitCode != 0 {
+		return path, false, fs, fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	return path, true, fs, nil
+}
+
+// renderHostsToml renders mirror as a containerd "Registry Configuration
+// Path" hosts.toml - see
+// https://github.com/containerd/containerd/blob/main/docs/hosts.md. A
+// username/password pulls as a Basic auth header on every request to the
+// mirror, since hosts.toml has no dedicated credential fields.
+func renderHostsToml(mirror ContainerdRegistryMirror) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "server = \"https://%s\"\n", mirror.Registry)
+
+	for _, endpoint := range mirror.Endpoints {
+		fmt.Fprintf(&b, "\n[host.%q]\n", endpoint)
+		b.WriteString("  capabilities = [\"pull\", \"resolve\"]\n")
+		if mirror.Username != "" {
+			auth := base64.StdEncoding.EncodeToString([]byte(mirror.Username + ":" + mirror.Password))
+			fmt.Fprintf(&b, "\n[host.%q.header]\n", endpoint)
+			fmt.Fprintf(&b, "  Authorization = [\"Basic %s\"]\n", auth)
+		}
+	}
+
+	return b.String()
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"log"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -367,19 +368,34 @@ func (r *Reconciler) GetStatus(ctx context.Context, client *ssh.Client) (*K0sSta
 		var nodeList struct {
 			Items []struct {
 				Metadata struct {
-					Name string `json:"name"`
+					Name   string            `json:"name"`
+					Labels map[string]string `json:"labels"`
 				} `json:"metadata"`
+				Spec struct {
+					Taints []nodeTaint `json:"taints"`
+				} `json:"spec"`
 				Status struct {
 					Conditions []struct {
 						Type   string `json:"type"`
 						Status string `json:"status"`
 					} `json:"conditions"`
+					NodeInfo struct {
+						KubeletVersion string `json:"kubeletVersion"`
+					} `json:"nodeInfo"`
 				} `json:"status"`
 			} `json:"items"`
 		}
 		if err := json.Unmarshal([]byte(nodesResult.Stdout), &nodeList); err == nil {
 			for _, node := range nodeList.Items {
-				ns := NodeStatus{Name: node.Metadata.Name}
+				ns := NodeStatus{Name: node.Metadata.Name, Version: node.Status.NodeInfo.KubeletVersion, Labels: node.Metadata.Labels}
+				if profile, ok := node.Metadata.Labels[WorkerProfileLabel]; ok && profile != "" {
+					ns.Profile = profile
+				} else {
+					ns.Profile = "default"
+				}
+				for _, t := range node.Spec.Taints {
+					ns.Taints = append(ns.Taints, Taint{Key: t.Key, Value: t.Value, Effect: t.Effect})
+				}
 				for _, cond := range node.Status.Conditions {
 					if cond.Type == "Ready" {
 						ns.Ready = cond.Status == "True"
@@ -389,6 +405,7 @@ func (r *Reconciler) GetStatus(ctx context.Context, client *ssh.Client) (*K0sSta
 				status.Nodes = append(status.Nodes, ns)
 			}
 		}
+		status.MixedVersions = hasMinorSkew(status.Nodes)
 	}
 
 	// Get helm releases
@@ -437,12 +454,82 @@ type K0sStatus struct {
 	Nodes        []NodeStatus        `json:"nodes,omitempty"`
 	HelmReleases []HelmReleaseStatus `json:"helm_releases,omitempty"`
 	IPPools      []IPPoolStatus      `json:"ip_pools,omitempty"`
+
+	// MixedVersions is true when the cluster's nodes span more than one
+	// minor Kubernetes/k0s version, e.g. a 'k0s upgrade' that was aborted
+	// partway through.
+	MixedVersions bool `json:"mixed_versions"`
 }
 
 // NodeStatus represents a Kubernetes node status
 type NodeStatus struct {
-	Name  string `json:"name"`
-	Ready bool   `json:"ready"`
+	Name    string `json:"name"`
+	Ready   bool   `json:"ready"`
+	Version string `json:"version,omitempty"`
+
+	// Profile is the node's WorkerProfileLabel value ("default" if unset),
+	// i.e. which ClusterConfig spec.workerProfiles entry its kubelet is
+	// running with - see ReconcileNodeConfig.
+	Profile string `json:"profile,omitempty"`
+
+	// Labels is every label currently on the node, not just ones nixfleet
+	// manages - callers compare this against a host's declared NodeLabels
+	// to report drift. See NodeConfig.NodeLabels.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Taints is every taint currently on the node. See NodeConfig.NodeTaints.
+	Taints []Taint `json:"taints,omitempty"`
+}
+
+// LabelMismatches compares ns's actual labels against want and reports
+// every key that's missing or has a different value on the node, sorted for
+// stable output. Keys present on the node but not in want are not reported
+// here - that's PruneLabels' job, not a "mismatch" from the node's
+// perspective.
+func (ns NodeStatus) LabelMismatches(want map[string]string) []string {
+	var mismatches []string
+	for key, value := range want {
+		if ns.Labels[key] != value {
+			mismatches = append(mismatches, key)
+		}
+	}
+	sort.Strings(mismatches)
+	return mismatches
+}
+
+// TaintMismatches compares ns's actual taints against want and reports
+// every wanted taint missing (or present with a different value/effect) on
+// the node, rendered via Taint.String for display.
+func (ns NodeStatus) TaintMismatches(want []Taint) []string {
+	current := make(map[string]Taint, len(ns.Taints))
+	for _, t := range ns.Taints {
+		current[t.Key] = t
+	}
+	var mismatches []string
+	for _, t := range want {
+		if c, ok := current[t.Key]; !ok || c.Value != t.Value || c.Effect != t.Effect {
+			mismatches = append(mismatches, t.String())
+		}
+	}
+	return mismatches
+}
+
+// hasMinorSkew reports whether nodes span more than one minor version.
+func hasMinorSkew(nodes []NodeStatus) bool {
+	var first string
+	for _, n := range nodes {
+		if n.Version == "" {
+			continue
+		}
+		if first == "" {
+			first = n.Version
+			continue
+		}
+		if skew := MinorSkew(first, n.Version); skew != 0 {
+			return true
+		}
+	}
+	return false
 }
 
 // HelmReleaseStatus represents a Helm release status
@@ -0,0 +1,221 @@
+package k0s
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/ssh"
+)
+
+// Node roles as reported by which systemd unit is active - there's no
+// inventory-level field for this, since role is a property of the rendered
+// Nix config (extensions.k0s.role), not something nixfleet tracks itself.
+const (
+	RoleController = "controller"
+	RoleWorker     = "worker"
+)
+
+// NodeRole reports whether client's host is currently running k0s as a
+// controller or worker, by checking which systemd unit is active. Returns ""
+// if neither unit is active.
+func NodeRole(ctx context.Context, client *ssh.Client) (string, error) {
+	result, err := client.Exec(ctx, "systemctl is-active k0scontroller.service 2>/dev/null")
+	if err == nil && result.ExitCode == 0 && strings.TrimSpace(result.Stdout) == "active" {
+		return RoleController, nil
+	}
+
+	result, err = client.Exec(ctx, "systemctl is-active k0sworker.service 2>/dev/null")
+	if err == nil && result.ExitCode == 0 && strings.TrimSpace(result.Stdout) == "active" {
+		return RoleWorker, nil
+	}
+
+	return "", nil
+}
+
+// serviceUnit returns the systemd unit name for role.
+func serviceUnit(role string) string {
+	if role == RoleController {
+		return "k0scontroller.service"
+	}
+	return "k0sworker.service"
+}
+
+// Version returns the k0s version installed on client, e.g. "v1.30.1+k0s.0".
+func Version(ctx context.Context, client *ssh.Client) (string, error) {
+	result, err := client.Exec(ctx, fmt.Sprintf("%s version 2>/dev/null", K0sPath))
+	if err != nil || result.ExitCode != 0 {
+		return "", fmt.Errorf("k0s version: %w", err)
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+// minorVersionPattern extracts the major.minor from a k0s version string
+// such as "v1.30.1+k0s.0" or the kubelet version "v1.30.1".
+var minorVersionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+
+// MinorVersion parses the major.minor pair out of a k0s/Kubernetes version
+// string, ignoring the patch and "+k0s.N" build suffix.
+func MinorVersion(version string) (major, minor int, err error) {
+	m := minorVersionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return 0, 0, fmt.Errorf("unrecognized version %q", version)
+	}
+	major, _ = strconv.Atoi(m[1])
+	minor, _ = strconv.Atoi(m[2])
+	return major, minor, nil
+}
+
+// MinorSkew returns the absolute difference in minor version between a and
+// b, treating a major version bump as skew as well. Returns -1 if either
+// version can't be parsed, so callers can distinguish "unknown" from "none".
+func MinorSkew(a, b string) int {
+	aMajor, aMinor, err := MinorVersion(a)
+	if err != nil {
+		return -1
+	}
+	bMajor, bMinor, err := MinorVersion(b)
+	if err != nil {
+		return -1
+	}
+	if aMajor != bMajor {
+		return -1
+	}
+	skew := aMinor - bMinor
+	if skew < 0 {
+		skew = -skew
+	}
+	return skew
+}
+
+// releaseAsset returns the k0s release binary and checksum URLs for version,
+// matching the naming k0sproject publishes under
+// https://github.com/k0sproject/k0s/releases/download/.
+func releaseAsset(version string) (binURL, sumURL string) {
+	base := fmt.Sprintf("https://github.com/k0sproject/k0s/releases/download/%s/k0s-%s-amd64", version, version)
+	return base, base + ".sha256"
+}
+
+// UpgradeBinary stops unit, downloads and checksum-verifies the k0s release
+// for version, replaces K0sPath, and starts unit again. On any failure the
+// unit is left stopped rather than started against a half-replaced binary.
+func UpgradeBinary(ctx context.Context, client *ssh.Client, role, version string) error {
+	unit := serviceUnit(role)
+	binURL, sumURL := releaseAsset(version)
+	tmpPath := K0sPath + ".upgrade"
+
+	if _, err := client.ExecSudo(ctx, fmt.Sprintf("systemctl stop %s", unit)); err != nil {
+		return fmt.Errorf("stopping %s: %w", unit, err)
+	}
+
+	downloadCmd := fmt.Sprintf(
+		"curl -sSLf -o %s %s && echo \"$(curl -sSLf %s | awk '{print $1}')  %s\" | sha256sum -c -",
+		tmpPath, binURL, sumURL, tmpPath,
+	)
+	if result, err := client.Exec(ctx, downloadCmd); err != nil || result.ExitCode != 0 {
+		return fmt.Errorf("downloading/verifying k0s %s: %w", version, err)
+	}
+
+	if _, err := client.ExecSudo(ctx, fmt.Sprintf("install -m 0755 %s %s", tmpPath, K0sPath)); err != nil {
+		return fmt.Errorf("installing k0s binary: %w", err)
+	}
+	_, _ = client.Exec(ctx, fmt.Sprintf("rm -f %s", tmpPath))
+
+	if _, err := client.ExecSudo(ctx, fmt.Sprintf("systemctl start %s", unit)); err != nil {
+		return fmt.Errorf("starting %s: %w", unit, err)
+	}
+
+	return nil
+}
+
+// pollInterval is how often the Wait* functions below re-check.
+const pollInterval = 5 * time.Second
+
+// WaitForAPIHealthy polls the controller's kube-apiserver until it responds
+// to a raw /healthz request or timeout elapses.
+func WaitForAPIHealthy(ctx context.Context, client *ssh.Client, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		result, err := client.ExecSudo(ctx, fmt.Sprintf("%s kubectl get --raw=/healthz", K0sPath))
+		if err == nil && result.ExitCode == 0 && strings.TrimSpace(result.Stdout) == "ok" {
+			return nil
+		}
+		time.Sleep(pollInterval)
+	}
+	return fmt.Errorf("kube-apiserver did not become healthy within %v", timeout)
+}
+
+// WaitForEtcdHealthy polls the controller's etcd member list until it
+// succeeds with every member reporting healthy, or timeout elapses.
+func WaitForEtcdHealthy(ctx context.Context, client *ssh.Client, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		result, err := client.ExecSudo(ctx, fmt.Sprintf("%s etcd member-list", K0sPath))
+		if err == nil && result.ExitCode == 0 {
+			return nil
+		}
+		time.Sleep(pollInterval)
+	}
+	return fmt.Errorf("etcd did not become healthy within %v", timeout)
+}
+
+// WaitForNodeReady polls (via a controller client) until nodeName reports
+// condition Ready=True, or timeout elapses.
+func WaitForNodeReady(ctx context.Context, controllerClient *ssh.Client, nodeName string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	cmd := fmt.Sprintf(
+		"%s kubectl get node %s -o jsonpath='{.status.conditions[?(@.type==\"Ready\")].status}'",
+		K0sPath, nodeName,
+	)
+	for time.Now().Before(deadline) {
+		result, err := controllerClient.ExecSudo(ctx, cmd)
+		if err == nil && result.ExitCode == 0 && strings.TrimSpace(result.Stdout) == "True" {
+			return nil
+		}
+		time.Sleep(pollInterval)
+	}
+	return fmt.Errorf("node %s did not become Ready within %v", nodeName, timeout)
+}
+
+// CordonNode marks nodeName unschedulable, via a controller client.
+func CordonNode(ctx context.Context, controllerClient *ssh.Client, nodeName string) error {
+	result, err := controllerClient.ExecSudo(ctx, fmt.Sprintf("%s kubectl cordon %s", K0sPath, nodeName))
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("kubectl cordon failed: %s", strings.TrimSpace(result.Stderr))
+	}
+	return nil
+}
+
+// DrainNode evicts workloads off nodeName, via a controller client.
+func DrainNode(ctx context.Context, controllerClient *ssh.Client, nodeName string) error {
+	cmd := fmt.Sprintf(
+		"%s kubectl drain %s --ignore-daemonsets --delete-emptydir-data --force --timeout=180s",
+		K0sPath, nodeName,
+	)
+	result, err := controllerClient.ExecSudo(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("kubectl drain failed: %s", strings.TrimSpace(result.Stderr))
+	}
+	return nil
+}
+
+// UncordonNode marks nodeName schedulable again, via a controller client.
+func UncordonNode(ctx context.Context, controllerClient *ssh.Client, nodeName string) error {
+	result, err := controllerClient.ExecSudo(ctx, fmt.Sprintf("%s kubectl uncordon %s", K0sPath, nodeName))
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("kubectl uncordon failed: %s", strings.TrimSpace(result.Stderr))
+	}
+	return nil
+}
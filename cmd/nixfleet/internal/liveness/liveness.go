@@ -0,0 +1,143 @@
+// Package liveness tracks, per host, the last time it was seen reachable
+// over SSH, persisted to disk so the fact survives even when a host never
+// answers again. It exists so `nixfleet host audit` can tell "flaky, back in
+// a minute" apart from "decommissioned six months ago" instead of every
+// unreachable host looking identical.
+package liveness
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultStaleThreshold is how long a host can go unreachable before
+// Tracker.IsStale considers it stale.
+const DefaultStaleThreshold = 30 * 24 * time.Hour
+
+// Record is one host's liveness history.
+type Record struct {
+	LastSeen            time.Time `json:"last_seen"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+}
+
+// Tracker is a disk-persisted, per-host record of the last time each host
+// answered a reachability check. It's updated by `nixfleet host audit`
+// (see main.go's hostAuditCmd) rather than on any schedule of its own, so an
+// entry is only as fresh as the last audit run.
+type Tracker struct {
+	path string
+
+	mu      sync.Mutex
+	records map[string]*Record
+}
+
+// NewTracker creates a tracker that persists under dataDir, loading any
+// existing records immediately.
+func NewTracker(dataDir string) *Tracker {
+	t := &Tracker{
+		path:    filepath.Join(dataDir, "host-liveness.json"),
+		records: make(map[string]*Record),
+	}
+	t.load()
+	return t
+}
+
+func (t *Tracker) load() {
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		return
+	}
+	var records map[string]*Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		log.Printf("liveness.Tracker: failed to load state: %v", err)
+		return
+	}
+	t.mu.Lock()
+	t.records = records
+	t.mu.Unlock()
+}
+
+func (t *Tracker) save() {
+	t.mu.Lock()
+	data, err := json.MarshalIndent(t.records, "", "  ")
+	t.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		log.Printf("liveness.Tracker: failed to create data dir: %v", err)
+		return
+	}
+	if err := os.WriteFile(t.path, data, 0644); err != nil {
+		log.Printf("liveness.Tracker: failed to save state: %v", err)
+	}
+}
+
+// Record notes the outcome of a reachability check for host: reachable
+// updates LastSeen to now and clears ConsecutiveFailures, unreachable only
+// increments ConsecutiveFailures.
+func (t *Tracker) Record(host string, reachable bool) {
+	t.mu.Lock()
+	r, ok := t.records[host]
+	if !ok {
+		r = &Record{}
+		t.records[host] = r
+	}
+	if reachable {
+		r.LastSeen = time.Now()
+		r.ConsecutiveFailures = 0
+	} else {
+		r.ConsecutiveFailures++
+	}
+	t.mu.Unlock()
+	t.save()
+}
+
+// Get returns the liveness record for host, if any.
+func (t *Tracker) Get(host string) (Record, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.records[host]
+	if !ok {
+		return Record{}, false
+	}
+	return *r, true
+}
+
+// Forget removes host's liveness record, e.g. once it's pruned from
+// inventory.
+func (t *Tracker) Forget(host string) {
+	t.mu.Lock()
+	_, existed := t.records[host]
+	delete(t.records, host)
+	t.mu.Unlock()
+	if existed {
+		t.save()
+	}
+}
+
+// DaysUnreachable returns how many days it's been since host last answered.
+// ok is false if host has never once been seen.
+func (t *Tracker) DaysUnreachable(host string) (days int, ok bool) {
+	r, exists := t.Get(host)
+	if !exists || r.LastSeen.IsZero() {
+		return 0, false
+	}
+	return int(time.Since(r.LastSeen).Hours() / 24), true
+}
+
+// IsStale reports whether host has gone unreachable for longer than
+// threshold, including a host that's never once been seen (which is at
+// least as stale as one that was last seen threshold ago).
+func (t *Tracker) IsStale(host string, threshold time.Duration) bool {
+	r, exists := t.Get(host)
+	if !exists || r.LastSeen.IsZero() {
+		return true
+	}
+	return time.Since(r.LastSeen) > threshold
+}
@@ -0,0 +1,92 @@
+package liveness
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrackerRecordAndGet(t *testing.T) {
+	tr := NewTracker(t.TempDir())
+
+	if _, ok := tr.Get("web1"); ok {
+		t.Fatal("expected no record for an unseen host")
+	}
+
+	tr.Record("web1", true)
+	rec, ok := tr.Get("web1")
+	if !ok {
+		t.Fatal("expected a record after a successful check")
+	}
+	if rec.LastSeen.IsZero() {
+		t.Error("expected LastSeen to be set")
+	}
+	if rec.ConsecutiveFailures != 0 {
+		t.Errorf("ConsecutiveFailures = %d, want 0", rec.ConsecutiveFailures)
+	}
+
+	tr.Record("web1", false)
+	tr.Record("web1", false)
+	rec, _ = tr.Get("web1")
+	if rec.ConsecutiveFailures != 2 {
+		t.Errorf("ConsecutiveFailures = %d, want 2", rec.ConsecutiveFailures)
+	}
+	if rec.LastSeen.IsZero() {
+		t.Error("failed checks should not clear LastSeen")
+	}
+}
+
+func TestTrackerIsStale(t *testing.T) {
+	tr := NewTracker(t.TempDir())
+
+	if !tr.IsStale("ghost", 30*24*time.Hour) {
+		t.Error("expected a never-seen host to be stale")
+	}
+
+	tr.Record("fresh", true)
+	if tr.IsStale("fresh", 30*24*time.Hour) {
+		t.Error("expected a just-seen host to not be stale")
+	}
+
+	tr.records["old"] = &Record{LastSeen: time.Now().Add(-60 * 24 * time.Hour)}
+	if !tr.IsStale("old", 30*24*time.Hour) {
+		t.Error("expected a host last seen 60 days ago to be stale at a 30d threshold")
+	}
+	if tr.IsStale("old", 90*24*time.Hour) {
+		t.Error("did not expect 'old' to be stale at a 90d threshold")
+	}
+}
+
+func TestTrackerDaysUnreachable(t *testing.T) {
+	tr := NewTracker(t.TempDir())
+
+	if _, ok := tr.DaysUnreachable("ghost"); ok {
+		t.Error("expected ok=false for a never-seen host")
+	}
+
+	tr.records["old"] = &Record{LastSeen: time.Now().Add(-10 * 24 * time.Hour)}
+	days, ok := tr.DaysUnreachable("old")
+	if !ok || days != 10 {
+		t.Errorf("DaysUnreachable = %d, %v; want 10, true", days, ok)
+	}
+}
+
+func TestTrackerPersistsAcrossInstances(t *testing.T) {
+	dir := t.TempDir()
+
+	tr1 := NewTracker(dir)
+	tr1.Record("web1", true)
+
+	tr2 := NewTracker(dir)
+	if _, ok := tr2.Get("web1"); !ok {
+		t.Fatal("expected a fresh Tracker over the same dataDir to load the saved record")
+	}
+}
+
+func TestTrackerForget(t *testing.T) {
+	tr := NewTracker(t.TempDir())
+	tr.Record("web1", true)
+	tr.Forget("web1")
+	if _, ok := tr.Get("web1"); ok {
+		t.Error("expected Forget to remove the record")
+	}
+}
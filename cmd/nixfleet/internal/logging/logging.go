@@ -0,0 +1,113 @@
+// Package logging provides the server's structured (slog) logging setup:
+// building a Logger from the --log-level/--log-format server flags, and
+// context helpers that thread a request ID, job ID, and host name through
+// to every log record emitted while handling that request, running that
+// job, or operating on that host - the same context-carried-value pattern
+// internal/ssh.WithOperation uses for the command tracer.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"log/slog"
+)
+
+// ParseLevel parses a --log-level flag value.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level: %s (valid: debug, info, warn, error)", s)
+	}
+}
+
+// NewLogger builds the server's logger: level and format ("text" or
+// "json") come from the --log-level/--log-format flags, writing to w. If
+// store is non-nil, every record carrying a "job_id" attribute (added via
+// WithJobID) is also appended to it, so GET /api/jobs/{id}/logs can return
+// that job's records alongside whatever host recorded them.
+func NewLogger(level, format string, w io.Writer, store *JobLogStore) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var base slog.Handler
+	switch strings.ToLower(format) {
+	case "text", "":
+		base = slog.NewTextHandler(w, opts)
+	case "json":
+		base = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format: %s (valid: text, json)", format)
+	}
+
+	return slog.New(&captureHandler{base: base, store: store}), nil
+}
+
+// NewRequestID generates a random ID for a single HTTP request, attached
+// to every log record emitted while handling it (and returned to the
+// client as the X-Request-Id response header) so a report of "it failed"
+// can be correlated back to one exact run through the log.
+func NewRequestID() (string, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("generating request id: %w", err)
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// loggerKey scopes the context value ContextWithLogger stores, so it can't
+// collide with a key some other package puts in the same context.
+type loggerKey struct{}
+
+// ContextWithLogger returns a context carrying logger, retrievable with
+// FromContext.
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger ctx carries, or slog.Default() if none
+// was attached - so a call site that forgets to thread a request/job
+// context still logs somewhere instead of panicking.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// WithRequestID returns a context whose logger (see FromContext) has
+// "request_id" attached to every record it emits from here on.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return ContextWithLogger(ctx, FromContext(ctx).With("request_id", id))
+}
+
+// WithJobID returns a context whose logger has "job_id" attached to every
+// record it emits, so every log line from that job's execution - build,
+// copy, activate, across however many hosts - can be pulled with `grep
+// jobID` or GET /api/jobs/{id}/logs.
+func WithJobID(ctx context.Context, id string) context.Context {
+	return ContextWithLogger(ctx, FromContext(ctx).With("job_id", id))
+}
+
+// WithHost returns a context whose logger has "host" attached to every
+// record it emits, scoping a multi-host job's log lines to the one host
+// each line is actually about.
+func WithHost(ctx context.Context, host string) context.Context {
+	return ContextWithLogger(ctx, FromContext(ctx).With("host", host))
+}
@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"debug", slog.LevelDebug, false},
+		{"info", slog.LevelInfo, false},
+		{"", slog.LevelInfo, false},
+		{"warn", slog.LevelWarn, false},
+		{"warning", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"invalid", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseLevel(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseLevel(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseLevel(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewLoggerUnknownFormat(t *testing.T) {
+	if _, err := NewLogger("info", "xml", &bytes.Buffer{}, nil); err == nil {
+		t.Error("expected an error for an unknown log format")
+	}
+}
+
+func TestNewRequestIDUnique(t *testing.T) {
+	a, err := NewRequestID()
+	if err != nil {
+		t.Fatalf("NewRequestID() error = %v", err)
+	}
+	b, err := NewRequestID()
+	if err != nil {
+		t.Fatalf("NewRequestID() error = %v", err)
+	}
+	if a == b {
+		t.Errorf("NewRequestID() returned the same id twice: %q", a)
+	}
+	if len(a) != 16 {
+		t.Errorf("NewRequestID() = %q, want 16 hex characters", a)
+	}
+}
+
+func TestContextHelpers(t *testing.T) {
+	var buf bytes.Buffer
+	store := NewJobLogStore()
+	base, err := NewLogger("debug", "json", &buf, store)
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+
+	ctx := ContextWithLogger(context.Background(), base)
+	ctx = WithRequestID(ctx, "req-1")
+	ctx = WithJobID(ctx, "job-1")
+	ctx = WithHost(ctx, "web1")
+
+	FromContext(ctx).Info("deployed")
+
+	records := store.Get("job-1")
+	if len(records) != 1 {
+		t.Fatalf("JobLogStore.Get(job-1) = %d records, want 1", len(records))
+	}
+	rec := records[0]
+	if rec.Message != "deployed" {
+		t.Errorf("record message = %q, want %q", rec.Message, "deployed")
+	}
+	if rec.Attrs["host"] != "web1" || rec.Attrs["request_id"] != "req-1" {
+		t.Errorf("record attrs = %+v, want host=web1 request_id=req-1", rec.Attrs)
+	}
+	if _, ok := rec.Attrs["job_id"]; ok {
+		t.Error("record attrs should not repeat job_id, it's the store's key")
+	}
+}
+
+func TestFromContextFallsBackToDefault(t *testing.T) {
+	if logger := FromContext(context.Background()); logger == nil {
+		t.Error("FromContext() on a bare context returned nil, want slog.Default()")
+	}
+}
+
+func TestJobLogStoreBounded(t *testing.T) {
+	store := NewJobLogStore()
+	for i := 0; i < maxJobLogLines+10; i++ {
+		store.append("job-1", Record{Message: "line"})
+	}
+
+	records := store.Get("job-1")
+	if len(records) != maxJobLogLines {
+		t.Errorf("JobLogStore retained %d records, want %d", len(records), maxJobLogLines)
+	}
+}
+
+func TestJobLogStoreGetUnknownJob(t *testing.T) {
+	store := NewJobLogStore()
+	if records := store.Get("missing"); records != nil {
+		t.Errorf("Get() for an unknown job = %v, want nil", records)
+	}
+}
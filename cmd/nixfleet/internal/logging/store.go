@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// maxJobLogLines bounds how many records JobLogStore retains per job, so a
+// chatty or long-running job can't grow the server's memory without bound.
+const maxJobLogLines = 2000
+
+// Record is one log line captured for a job, as returned by
+// GET /api/jobs/{id}/logs.
+type Record struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Attrs   map[string]string `json:"attrs,omitempty"`
+}
+
+// JobLogStore holds, per job ID, the most recent log records emitted
+// through a context built with WithJobID. It's populated by captureHandler
+// and read by the server's job-logs endpoint.
+type JobLogStore struct {
+	mu   sync.Mutex
+	logs map[string][]Record
+}
+
+// NewJobLogStore returns an empty JobLogStore.
+func NewJobLogStore() *JobLogStore {
+	return &JobLogStore{logs: make(map[string][]Record)}
+}
+
+// append adds rec to jobID's log, trimming the oldest record if the job is
+// already at maxJobLogLines.
+func (s *JobLogStore) append(jobID string, rec Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := append(s.logs[jobID], rec)
+	if len(records) > maxJobLogLines {
+		records = records[len(records)-maxJobLogLines:]
+	}
+	s.logs[jobID] = records
+}
+
+// Get returns a copy of jobID's captured log records, oldest first. It
+// returns nil if no records have been captured for jobID.
+func (s *JobLogStore) Get(jobID string) []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := s.logs[jobID]
+	if records == nil {
+		return nil
+	}
+	out := make([]Record, len(records))
+	copy(out, records)
+	return out
+}
+
+// captureHandler wraps a base slog.Handler, forwarding every record to it
+// unchanged and additionally, when the record carries a "job_id" attribute
+// (attached via WithJobID), appending it to store so it can be retrieved
+// later by job ID alone.
+type captureHandler struct {
+	base  slog.Handler
+	store *JobLogStore
+	attrs []slog.Attr
+}
+
+func (h *captureHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.base.Enabled(ctx, level)
+}
+
+func (h *captureHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.store != nil {
+		h.capture(r)
+	}
+	return h.base.Handle(ctx, r)
+}
+
+func (h *captureHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	merged := make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	merged = append(merged, h.attrs...)
+	merged = append(merged, attrs...)
+	return &captureHandler{base: h.base.WithAttrs(attrs), store: h.store, attrs: merged}
+}
+
+func (h *captureHandler) WithGroup(name string) slog.Handler {
+	return &captureHandler{base: h.base.WithGroup(name), store: h.store, attrs: h.attrs}
+}
+
+// capture builds a Record from r plus this handler's accumulated attrs
+// (slog.Logger.With ends up as handler-level WithAttrs state, not record
+// attrs, so both have to be walked to find job_id) and, if one carries a
+// job_id, appends it to the store.
+func (h *captureHandler) capture(r slog.Record) {
+	var jobID string
+	attrMap := make(map[string]string, len(h.attrs)+r.NumAttrs())
+
+	collect := func(a slog.Attr) bool {
+		attrMap[a.Key] = a.Value.String()
+		if a.Key == "job_id" {
+			jobID = a.Value.String()
+		}
+		return true
+	}
+	for _, a := range h.attrs {
+		collect(a)
+	}
+	r.Attrs(collect)
+
+	if jobID == "" {
+		return
+	}
+	delete(attrMap, "job_id")
+
+	h.store.append(jobID, Record{
+		Time:    r.Time,
+		Level:   r.Level.String(),
+		Message: r.Message,
+		Attrs:   attrMap,
+	})
+}
@@ -1,16 +1,46 @@
 package nix
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"os/exec"
+	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/nixfleet/nixfleet/internal/inventory"
+	"github.com/nixfleet/nixfleet/internal/logging"
 	"github.com/nixfleet/nixfleet/internal/ssh"
 )
 
+// gcRootSubdir is where CopyToHost creates a temporary GC root for every
+// closure it copies, under the target user's per-user gcroots directory (so
+// no sudo is needed) rather than the root-owned /nix/var/nix/gcroots. Naming
+// every root nixfleet creates under one subdirectory keeps orphan detection
+// in 'nixfleet host cleanup-generations' simple: anything under here is
+// ours, and anything left after that generation is cleaned up is an orphan.
+const gcRootSubdir = "nixfleet"
+
+// GCRootDir returns the directory CopyToHost creates temporary GC roots in
+// for sshUser on the target host.
+func GCRootDir(sshUser string) string {
+	return path.Join("/nix/var/nix/gcroots/per-user", sshUser, gcRootSubdir)
+}
+
+// TempGCRootPath returns the temporary GC root CopyToHost creates for
+// closure's store path. It's named after the store path itself (rather than
+// e.g. a timestamp) so re-copying the same closure reuses the existing root
+// instead of accumulating a new one every retry.
+func TempGCRootPath(sshUser string, closure *HostClosure) string {
+	return path.Join(GCRootDir(sshUser), "copy-"+path.Base(closure.StorePath))
+}
+
 // Deployer handles copying closures and activating on hosts
 type Deployer struct {
 	evaluator *Evaluator
@@ -25,24 +55,225 @@ func NewDeployer(evaluator *Evaluator) *Deployer {
 	}
 }
 
-// CopyToHost copies a closure to a remote host
-func (d *Deployer) CopyToHost(ctx context.Context, closure *HostClosure, host *inventory.Host) error {
-	// Build the SSH URI
+// copyProgressLogInterval throttles how often CopyToHost logs a "still
+// copying" progress line - often enough that a slow WAN transfer doesn't
+// look hung in 'nixfleet apply -v' or GET /api/jobs/{id}/logs, rare enough
+// that a fast LAN copy doesn't spam either.
+const copyProgressLogInterval = 5 * time.Second
+
+// copyURI builds the ssh:// store URI CopyToHost copies to, including the
+// compress query param when wantCompression says the link benefits from it.
+func copyURI(host *inventory.Host) string {
 	sshURI := fmt.Sprintf("ssh://%s@%s", host.SSHUser, host.Addr)
 	if host.SSHPort != 22 {
 		sshURI = fmt.Sprintf("ssh://%s@%s:%d", host.SSHUser, host.Addr, host.SSHPort)
 	}
+	if wantCompression(host) {
+		sshURI += "?compress=true"
+	}
+	return sshURI
+}
+
+// wantCompression decides whether CopyToHost asks the ssh:// store for
+// transport compression. Host.SSHCompress always wins when set; otherwise
+// it defaults to on for any address outside the RFC1918 (or RFC4193 IPv6
+// ULA) private ranges via net.IP.IsPrivate - a WAN link is the case
+// compression actually helps, and a LAN deploy already has bandwidth to
+// spare, so spending CPU compressing there would be a net loss.
+func wantCompression(host *inventory.Host) bool {
+	if host.SSHCompress != nil {
+		return *host.SSHCompress
+	}
+	ip := net.ParseIP(host.Addr)
+	if ip == nil {
+		// Not a bare IP (a DNS name, most likely) - assume it resolves off
+		// the local network and compression is worth it.
+		return true
+	}
+	return !ip.IsPrivate() && !ip.IsLoopback()
+}
+
+// CopyToHost copies a closure to a remote host, then pins it with a
+// temporary GC root under GCRootDir so it can't be garbage-collected
+// between the copy and activation. The root is left in place afterwards -
+// activation makes the profile itself a root for a successful generation,
+// and 'nixfleet host cleanup-generations' releases this one once the
+// generation it belongs to is cleaned up.
+//
+// Progress (store paths copied so far, out of the closure's total) is
+// logged periodically through the logger ctx carries - see
+// logging.WithJobID/WithHost - by parsing `nix copy`'s structured
+// internal-json log stream rather than scraping its human-readable
+// progress bar, which isn't meant to be parsed. If a copy fails partway
+// through, the error reports how many of the closure's paths had already
+// transferred, since those are the ones a retry will find already present
+// on the remote store and skip.
+func (d *Deployer) CopyToHost(ctx context.Context, closure *HostClosure, host *inventory.Host) error {
+	logger := logging.FromContext(ctx)
+
+	total := closurePathCount(ctx, d.nixBin, closure.StorePath)
+
+	cmd := exec.CommandContext(ctx, d.nixBin, "copy", "--to", copyURI(host), "--log-format", "internal-json", "-v", closure.StorePath)
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("nix copy: %w", err)
+	}
+	var stderrTail bytes.Buffer
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("nix copy: %w", err)
+	}
+
+	done := trackCopyProgress(stderr, &stderrTail, total, func(done, total int) {
+		if total > 0 {
+			logger.Info("copying closure", "host", host.Name, "done", done, "total", total)
+		} else {
+			logger.Info("copying closure", "host", host.Name, "done", done)
+		}
+	})
+
+	if err := cmd.Wait(); err != nil {
+		copied := <-done
+		return fmt.Errorf("nix copy failed after %d store paths: %w\nstderr: %s", copied, err, stderrTail.String())
+	}
+	<-done
+
+	if err := d.createTempGCRoot(ctx, host, closure); err != nil {
+		return fmt.Errorf("creating temporary GC root: %w", err)
+	}
+
+	return nil
+}
+
+// closurePathCount returns how many store paths closure's transitive
+// closure contains, for CopyToHost's progress denominator. It's best-effort
+// - if `nix path-info -r` fails for any reason, progress just logs a count
+// with no "out of N" denominator rather than failing the copy over it.
+func closurePathCount(ctx context.Context, nixBin, storePath string) int {
+	out, err := exec.CommandContext(ctx, nixBin, "path-info", "-r", storePath).Output()
+	if err != nil {
+		return 0
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return 0
+	}
+	return len(lines)
+}
+
+// nixLogLine is the subset of `nix --log-format internal-json`'s line
+// schema CopyToHost's progress tracking reads - the numeric activity-type
+// codes that schema also carries aren't part of nix's stable interface, so
+// trackCopyProgress matches on the human-readable Text field instead, the
+// same thing nix's own progress bar renders, and correlates a path's
+// "start" and "stop" lines by ID to know when it actually finished.
+type nixLogLine struct {
+	Action string `json:"action"`
+	ID     uint64 `json:"id"`
+	Text   string `json:"text"`
+}
+
+// trackCopyProgress reads r (cmd's stderr pipe), copying everything into
+// tail for inclusion in an error message, and calls onProgress at least
+// once every copyProgressLogInterval while paths are still being copied,
+// plus once more with the final count once r is drained (cmd exits and
+// closes the pipe). It returns a channel that receives that final
+// completed-path count.
+func trackCopyProgress(r io.Reader, tail *bytes.Buffer, total int, onProgress func(done, total int)) <-chan int {
+	result := make(chan int, 1)
+	go func() {
+		copied := 0
+		inFlight := make(map[uint64]bool)
+		lastLog := time.Now()
+		scanner := bufio.NewScanner(io.TeeReader(r, tail))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			rest, ok := strings.CutPrefix(scanner.Text(), "@nix ")
+			if !ok {
+				continue
+			}
+			var entry nixLogLine
+			if err := json.Unmarshal([]byte(rest), &entry); err != nil {
+				continue
+			}
+			switch entry.Action {
+			case "start":
+				if strings.Contains(entry.Text, "copying path") {
+					inFlight[entry.ID] = true
+				}
+			case "stop":
+				if inFlight[entry.ID] {
+					delete(inFlight, entry.ID)
+					copied++
+				}
+			}
+			if time.Since(lastLog) >= copyProgressLogInterval {
+				onProgress(copied, total)
+				lastLog = time.Now()
+			}
+		}
+		onProgress(copied, total)
+		result <- copied
+	}()
+	return result
+}
+
+// CopyToHosts copies closure to each of hosts, running up to parallel
+// copies at once. It's meant for a caller juggling its own per-host
+// activation ordering (e.g. a staged rollout that must activate hosts in a
+// fixed sequence) that would otherwise copy the same closure to every host
+// one at a time purely because CopyToHost is called from a sequential
+// per-host loop - the copy itself has no such ordering requirement.
+func (d *Deployer) CopyToHosts(ctx context.Context, closure *HostClosure, hosts []*inventory.Host, parallel int) map[string]error {
+	if parallel <= 0 {
+		parallel = 1
+	}
+
+	results := make(map[string]error, len(hosts))
+	var mu sync.Mutex
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(h *inventory.Host) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			err := d.CopyToHost(ctx, closure, h)
+			mu.Lock()
+			results[h.Name] = err
+			mu.Unlock()
+		}(host)
+	}
+
+	wg.Wait()
+	return results
+}
 
-	// Run nix copy
-	cmd := exec.CommandContext(ctx, d.nixBin, "copy", "--to", sshURI, closure.StorePath)
+// createTempGCRoot creates (or refreshes) the GC root at
+// TempGCRootPath(host.SSHUser, closure) over plain ssh, matching how
+// CopyToHost already shells out to `nix copy` rather than going through the
+// app's ssh.Client pool.
+func (d *Deployer) createTempGCRoot(ctx context.Context, host *inventory.Host, closure *HostClosure) error {
+	rootDir := GCRootDir(host.SSHUser)
+	rootPath := TempGCRootPath(host.SSHUser, closure)
+	remoteCmd := fmt.Sprintf("mkdir -p %s && ln -sfn %s %s", rootDir, closure.StorePath, rootPath)
+
+	port := host.SSHPort
+	if port == 0 {
+		port = 22
+	}
+	target := fmt.Sprintf("%s@%s", host.SSHUser, host.Addr)
+	cmd := exec.CommandContext(ctx, "ssh", "-p", fmt.Sprintf("%d", port), target, remoteCmd)
 
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
-
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("nix copy failed: %w\nstderr: %s", err, stderr.String())
+		return fmt.Errorf("%w\nstderr: %s", err, stderr.String())
 	}
-
 	return nil
 }
 
@@ -117,21 +348,72 @@ func (d *Deployer) ActivateDarwin(ctx context.Context, client *ssh.Client, closu
 	return nil
 }
 
+// ProfileGenerationPath returns the nix profile a ProfileTarget activates
+// generations under, mirroring ProfilePath for system closures. A
+// home-manager profile lives under the target user's per-user profiles, a
+// plain profile under a shared nixfleet-owned directory so it isn't
+// mistaken for one a user created themselves with `nix profile install`.
+func ProfileGenerationPath(target ProfileTarget) string {
+	switch target.Kind {
+	case "home-manager":
+		return path.Join("/nix/var/nix/profiles/per-user", target.Name, "home-manager")
+	default: // "profile"
+		return path.Join("/nix/var/nix/profiles/nixfleet/profiles", target.Name)
+	}
+}
+
+// ActivateProfile activates a built ProfileTarget on the host. A
+// home-manager target runs the activation package's activate script as
+// target.Name via runuser; a plain profile is installed into its shared
+// profile path with `nix profile install`, which both creates the profile
+// on first use and adds a new generation on every later call.
+func (d *Deployer) ActivateProfile(ctx context.Context, client *ssh.Client, target ProfileTarget, storePath string) error {
+	var cmd string
+	switch target.Kind {
+	case "home-manager":
+		cmd = fmt.Sprintf("runuser -u %s -- %s/activate", target.Name, storePath)
+	default: // "profile"
+		profilePath := ProfileGenerationPath(target)
+		cmd = fmt.Sprintf("mkdir -p %s && nix profile install --profile %s %s", path.Dir(profilePath), profilePath, storePath)
+	}
+
+	result, err := client.ExecSudo(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("activating profile %s failed: %w", target, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("activating profile %s failed with exit code %d: %s", target, result.ExitCode, result.Stderr)
+	}
+	return nil
+}
+
+// ProfilePath returns the nix profile a host of the given base activates
+// generations under, shared by GetCurrentGeneration and callers that need
+// to record a GenerationRecord without re-deriving the path themselves.
+func ProfilePath(base string) (string, error) {
+	switch base {
+	case "nixos", "darwin":
+		return "/nix/var/nix/profiles/system", nil
+	case "ubuntu":
+		return "/nix/var/nix/profiles/nixfleet/system", nil
+	default:
+		return "", fmt.Errorf("unknown base: %s", base)
+	}
+}
+
 // GetCurrentGeneration gets the current generation on a host
 func (d *Deployer) GetCurrentGeneration(ctx context.Context, client *ssh.Client, base string) (int, string, error) {
-	var profilePath, storePathCmd string
+	profilePath, err := ProfilePath(base)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var storePathCmd string
 	switch base {
-	case "nixos":
-		profilePath = "/nix/var/nix/profiles/system"
+	case "nixos", "darwin":
 		storePathCmd = "readlink /run/current-system"
 	case "ubuntu":
-		profilePath = "/nix/var/nix/profiles/nixfleet/system"
 		storePathCmd = "readlink -f /nix/var/nix/profiles/nixfleet/system"
-	case "darwin":
-		profilePath = "/nix/var/nix/profiles/system"
-		storePathCmd = "readlink /run/current-system"
-	default:
-		return 0, "", fmt.Errorf("unknown base: %s", base)
 	}
 
 	// Get the store path
@@ -172,6 +454,27 @@ func parseGeneration(linkName string) int {
 	return 0
 }
 
+// GetProfileGeneration returns the current generation number and store path
+// for a profile at profilePath, the same way GetCurrentGeneration does for a
+// system profile, for any profile symlink (e.g. ProfileGenerationPath).
+func (d *Deployer) GetProfileGeneration(ctx context.Context, client *ssh.Client, profilePath string) (int, string, error) {
+	result, err := client.Exec(ctx, fmt.Sprintf("readlink -f %s", profilePath))
+	if err != nil {
+		return 0, "", err
+	}
+	if result.ExitCode != 0 {
+		return 0, "", fmt.Errorf("failed to get current store path: %s", result.Stderr)
+	}
+	storePath := strings.TrimSpace(result.Stdout)
+
+	result, err = client.Exec(ctx, fmt.Sprintf("readlink %s", profilePath))
+	if err != nil || result.ExitCode != 0 {
+		return 0, storePath, nil
+	}
+
+	return parseGeneration(strings.TrimSpace(result.Stdout)), storePath, nil
+}
+
 // Rollback rolls back to a previous generation
 func (d *Deployer) Rollback(ctx context.Context, client *ssh.Client, base string, generation int) error {
 	switch base {
@@ -257,6 +560,32 @@ func (d *Deployer) rollbackDarwin(ctx context.Context, client *ssh.Client, gener
 	return nil
 }
 
+// RollbackProfile rolls a ProfileTarget back to its previous generation. A
+// home-manager rollback rolls the profile back and re-runs the resulting
+// generation's activation script as the target user; a plain profile uses
+// `nix profile rollback`, which reactivates the previous generation itself.
+func (d *Deployer) RollbackProfile(ctx context.Context, client *ssh.Client, target ProfileTarget) error {
+	profilePath := ProfileGenerationPath(target)
+
+	var cmd string
+	switch target.Kind {
+	case "home-manager":
+		cmd = fmt.Sprintf("runuser -u %s -- nix-env --profile %s --rollback && runuser -u %s -- %s/activate",
+			target.Name, profilePath, target.Name, profilePath)
+	default: // "profile"
+		cmd = fmt.Sprintf("nix profile rollback --profile %s", profilePath)
+	}
+
+	result, err := client.ExecSudo(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("rolling back profile %s failed: %w", target, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("rolling back profile %s failed with exit code %d: %s", target, result.ExitCode, result.Stderr)
+	}
+	return nil
+}
+
 // CheckRebootNeeded checks if a host needs to be rebooted
 func (d *Deployer) CheckRebootNeeded(ctx context.Context, client *ssh.Client, base string) (bool, error) {
 	switch base {
@@ -310,3 +639,93 @@ func (d *Deployer) RebootHost(ctx context.Context, client *ssh.Client) error {
 	_, err := client.ExecSudo(ctx, "shutdown -r +0")
 	return err
 }
+
+// RemoteClosureSize returns storePath's closure size in bytes, as reported
+// by the target host's own nix - unlike Evaluator.GetClosureSize, this
+// queries the host's store directly, since a generation being cleaned up
+// lives there rather than on the machine running nixfleet.
+func (d *Deployer) RemoteClosureSize(ctx context.Context, client *ssh.Client, storePath string) (int64, error) {
+	result, err := client.Exec(ctx, fmt.Sprintf("nix path-info -S --json %s 2>/dev/null", storePath))
+	if err != nil {
+		return 0, err
+	}
+	if result.ExitCode != 0 {
+		return 0, fmt.Errorf("nix path-info failed: %s", result.Stderr)
+	}
+
+	var pathInfo []struct {
+		ClosureSize int64 `json:"closureSize"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &pathInfo); err != nil {
+		return 0, err
+	}
+	if len(pathInfo) > 0 {
+		return pathInfo[0].ClosureSize, nil
+	}
+	return 0, nil
+}
+
+// VerifyStorePathIntact checks that storePath is still present and
+// unmodified in the host's store, via nix-store --verify-path's content
+// hash check. Used before reusing a closure an earlier 'apply --stage-only'
+// left on the host instead of re-copying it - a store that's since been
+// garbage-collected or had the path corrupted reports false here rather
+// than failing activation partway through.
+func (d *Deployer) VerifyStorePathIntact(ctx context.Context, client *ssh.Client, storePath string) (bool, error) {
+	result, err := client.Exec(ctx, fmt.Sprintf("nix-store --verify-path %s 2>&1", storePath))
+	if err != nil {
+		return false, err
+	}
+	return result.ExitCode == 0, nil
+}
+
+// DeleteGeneration removes generation from base's nix profile via
+// nix-env --delete-generations, freeing it up for garbage collection. It's
+// a no-op error for generation 0, the sentinel RecordGeneration uses for an
+// activation that failed before it ever became a real profile generation.
+func (d *Deployer) DeleteGeneration(ctx context.Context, client *ssh.Client, base string, generation int) error {
+	if generation <= 0 {
+		return fmt.Errorf("no profile generation to delete (activation never completed)")
+	}
+	profilePath, err := ProfilePath(base)
+	if err != nil {
+		return err
+	}
+
+	result, err := client.ExecSudo(ctx, fmt.Sprintf("nix-env --delete-generations %d --profile %s", generation, profilePath))
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("nix-env --delete-generations failed: %s", result.Stderr)
+	}
+	return nil
+}
+
+// RemoveTempGCRoot removes the temporary GC root CopyToHost created for the
+// closure at storePath, so the store paths it was pinning become eligible
+// for garbage collection again.
+func (d *Deployer) RemoveTempGCRoot(ctx context.Context, client *ssh.Client, sshUser, storePath string) error {
+	rootPath := TempGCRootPath(sshUser, &HostClosure{StorePath: storePath})
+	result, err := client.Exec(ctx, fmt.Sprintf("rm -f %s", rootPath))
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("removing GC root %s: %s", rootPath, result.Stderr)
+	}
+	return nil
+}
+
+// CollectGarbage runs nix-collect-garbage -d on the host and returns its
+// output, which reports the store paths and space it freed.
+func (d *Deployer) CollectGarbage(ctx context.Context, client *ssh.Client) (string, error) {
+	result, err := client.ExecSudo(ctx, "nix-collect-garbage -d")
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("nix-collect-garbage failed: %s", result.Stderr)
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
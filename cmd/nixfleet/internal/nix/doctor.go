@@ -0,0 +1,385 @@
+package nix
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMinNixVersion is the oldest nix version nixfleet assumes works:
+// --print-out-paths (BuildHost/BuildAttr) and reliable flake evaluation both
+// need it. Most support requests that turn out to be "ancient nix" involve
+// something well below this.
+const DefaultMinNixVersion = "2.18.0"
+
+// RequiredExperimentalFeatures are the experimental features nixfleet can't
+// function without: every flake-ref eval/build needs "flakes", and every
+// call goes through the nix3 CLI surface gated by "nix-command".
+var RequiredExperimentalFeatures = []string{"nix-command", "flakes"}
+
+// MinNixVersion is the version nix_version checks compare the local nix
+// against. Defaults to DefaultMinNixVersion; override (e.g. from `doctor
+// --min-version`) for an environment pinned to a specific nix release.
+var MinNixVersion = DefaultMinNixVersion
+
+// CheckStatus is the outcome of one DoctorCheck.
+type CheckStatus string
+
+const (
+	StatusPass CheckStatus = "pass"
+	StatusWarn CheckStatus = "warn"
+	StatusFail CheckStatus = "fail"
+)
+
+// DoctorCheck is one environment-preflight check's result.
+type DoctorCheck struct {
+	Name        string      `json:"name"`
+	Status      CheckStatus `json:"status"`
+	Message     string      `json:"message"`
+	Remediation string      `json:"remediation,omitempty"`
+}
+
+// DoctorReport is the full set of checks `nixfleet doctor` runs.
+type DoctorReport struct {
+	Checks []DoctorCheck `json:"checks"`
+}
+
+// HasFailures reports whether any check failed outright. A warn alone
+// doesn't fail the run - doctor exits nonzero only on this.
+func (r *DoctorReport) HasFailures() bool {
+	for _, c := range r.Checks {
+		if c.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// RunDoctor runs the full environment preflight: the cheap nix version and
+// experimental-feature checks the evaluator also runs automatically once
+// per process, plus ones only worth paying for when a person asks -
+// resolving the flake, git availability and tree cleanliness, and
+// substituter connectivity.
+func RunDoctor(ctx context.Context, flakePath string) *DoctorReport {
+	report := &DoctorReport{}
+
+	nixBin, err := exec.LookPath("nix")
+	if err != nil {
+		report.Checks = append(report.Checks, DoctorCheck{
+			Name:        "nix_available",
+			Status:      StatusFail,
+			Message:     "nix not found in PATH",
+			Remediation: "install nix: https://nixos.org/download",
+		})
+		return report
+	}
+
+	report.Checks = append(report.Checks, checkNixVersion(ctx, nixBin, MinNixVersion))
+	report.Checks = append(report.Checks, checkExperimentalFeatures(ctx, nixBin))
+	report.Checks = append(report.Checks, checkFlakePresent(flakePath))
+	report.Checks = append(report.Checks, checkFlakeMetadata(ctx, nixBin, flakePath))
+	report.Checks = append(report.Checks, checkGitAvailable())
+	report.Checks = append(report.Checks, checkGitTreeClean(ctx, flakePath))
+	report.Checks = append(report.Checks, checkSubstituters(ctx, nixBin)...)
+
+	return report
+}
+
+var cheapPreflightOnce sync.Once
+var cheapPreflightErr error
+
+// checkCheapPreflightOnce runs the nix version and experimental-feature
+// checks against nixBin exactly once per process - they're invariant for
+// the process's lifetime - and caches the result, so NewEvaluator doesn't
+// re-shell out to nix for every host in a fleet-wide apply. Only these two
+// run automatically; flake metadata, git status, and substituter
+// connectivity are cheap-per-host-count but not cheap-per-process, and stay
+// doctor-only.
+func checkCheapPreflightOnce(nixBin string) error {
+	cheapPreflightOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if check := checkNixVersion(ctx, nixBin, MinNixVersion); check.Status == StatusFail {
+			cheapPreflightErr = fmt.Errorf("%s: %s", check.Message, check.Remediation)
+			return
+		}
+		if check := checkExperimentalFeatures(ctx, nixBin); check.Status == StatusFail {
+			cheapPreflightErr = fmt.Errorf("%s: %s", check.Message, check.Remediation)
+			return
+		}
+	})
+	return cheapPreflightErr
+}
+
+// versionPattern extracts a dotted version number from `nix --version`
+// output, e.g. "nix (Nix) 2.18.1" -> "2.18.1".
+var versionPattern = regexp.MustCompile(`\d+\.\d+(\.\d+)?`)
+
+func checkNixVersion(ctx context.Context, nixBin, minVersion string) DoctorCheck {
+	check := DoctorCheck{Name: "nix_version"}
+
+	out, err := exec.CommandContext(ctx, nixBin, "--version").Output()
+	if err != nil {
+		check.Status = StatusFail
+		check.Message = "could not run nix --version"
+		check.Remediation = "verify nix is installed and on PATH"
+		return check
+	}
+
+	version := versionPattern.FindString(string(out))
+	if version == "" {
+		check.Status = StatusWarn
+		check.Message = fmt.Sprintf("could not parse a version number from %q", strings.TrimSpace(string(out)))
+		return check
+	}
+
+	cmp, err := compareVersions(version, minVersion)
+	if err != nil {
+		check.Status = StatusWarn
+		check.Message = fmt.Sprintf("could not compare nix %s against minimum %s: %v", version, minVersion, err)
+		return check
+	}
+	if cmp < 0 {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("nix %s is older than the minimum supported %s", version, minVersion)
+		check.Remediation = "upgrade nix (e.g. via the Determinate Systems installer or your package manager)"
+		return check
+	}
+
+	check.Status = StatusPass
+	check.Message = fmt.Sprintf("nix %s", version)
+	return check
+}
+
+// compareVersions compares two dotted version strings component-wise,
+// returning -1, 0, or 1 as a is less than, equal to, or greater than b.
+func compareVersions(a, b string) (int, error) {
+	pa, err := parseVersionParts(a)
+	if err != nil {
+		return 0, err
+	}
+	pb, err := parseVersionParts(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < 3; i++ {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func parseVersionParts(v string) ([3]int, error) {
+	var parts [3]int
+	fields := strings.SplitN(v, ".", 3)
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return parts, fmt.Errorf("invalid version segment %q in %q", f, v)
+		}
+		parts[i] = n
+	}
+	return parts, nil
+}
+
+const experimentalFeaturesRemediation = `add "experimental-features = nix-command flakes" to nix.conf, or set NIX_CONFIG="experimental-features = nix-command flakes"`
+
+// checkExperimentalFeatures reads nix's effective config via `nix config
+// show`, a nix3 (nix-command) subcommand - if nix-command itself is
+// disabled, this call fails, which is itself proof the required feature is
+// missing, so there's no chicken-and-egg problem in treating that failure
+// as a fail rather than an error the caller has to special-case.
+func checkExperimentalFeatures(ctx context.Context, nixBin string) DoctorCheck {
+	check := DoctorCheck{Name: "experimental_features"}
+
+	cmd := exec.CommandContext(ctx, nixBin, "config", "show", "experimental-features")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("nix config show failed, which usually means nix-command itself is disabled: %s", strings.TrimSpace(stderr.String()))
+		check.Remediation = experimentalFeaturesRemediation
+		return check
+	}
+
+	enabled := make(map[string]bool)
+	for _, f := range strings.Fields(strings.TrimSpace(stdout.String())) {
+		enabled[f] = true
+	}
+
+	var missing []string
+	for _, f := range RequiredExperimentalFeatures {
+		if !enabled[f] {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) > 0 {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("missing required experimental feature(s): %s", strings.Join(missing, ", "))
+		check.Remediation = experimentalFeaturesRemediation
+		return check
+	}
+
+	check.Status = StatusPass
+	check.Message = fmt.Sprintf("required experimental features enabled: %s", strings.Join(RequiredExperimentalFeatures, ", "))
+	return check
+}
+
+func checkFlakePresent(flakePath string) DoctorCheck {
+	check := DoctorCheck{Name: "flake_present"}
+
+	if _, err := os.Stat(filepath.Join(flakePath, "flake.nix")); err != nil {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("no flake.nix found under %s", flakePath)
+		check.Remediation = "check --flake (or NIXFLEET_FLAKE) points at the repo root"
+		return check
+	}
+
+	check.Status = StatusPass
+	check.Message = fmt.Sprintf("flake.nix found at %s", flakePath)
+	return check
+}
+
+// checkFlakeMetadata runs a fast flake metadata lookup - the same check
+// CheckFlakeEvaluable does for the pre-apply health check - to catch a
+// broken flake.nix or an unreachable input before a real build fails deep
+// into the run.
+func checkFlakeMetadata(ctx context.Context, nixBin, flakePath string) DoctorCheck {
+	check := DoctorCheck{Name: "flake_metadata"}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, nixBin, "flake", "metadata", "--json", flakePath)
+	cmd.Dir = flakePath
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("nix flake metadata failed: %s", strings.TrimSpace(stderr.String()))
+		check.Remediation = fmt.Sprintf("run manually to see the full error: nix flake metadata --json %s", flakePath)
+		return check
+	}
+
+	check.Status = StatusPass
+	check.Message = "flake metadata resolved"
+	return check
+}
+
+func checkGitAvailable() DoctorCheck {
+	check := DoctorCheck{Name: "git_available"}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		check.Status = StatusFail
+		check.Message = "git not found in PATH"
+		check.Remediation = "install git - nixfleet needs it to track the flake's revision and dirty state"
+		return check
+	}
+
+	check.Status = StatusPass
+	check.Message = "git available"
+	return check
+}
+
+// checkGitTreeClean warns on uncommitted changes: a dirty flake tree
+// changes the evaluated manifest hash on every apply even with no real
+// config change, which shows up as unexpected churn rather than a hard
+// failure, so this is a warn rather than a fail.
+func checkGitTreeClean(ctx context.Context, flakePath string) DoctorCheck {
+	check := DoctorCheck{Name: "git_tree_clean"}
+
+	out, err := exec.CommandContext(ctx, "git", "-C", flakePath, "status", "--porcelain").Output()
+	if err != nil {
+		check.Status = StatusWarn
+		check.Message = fmt.Sprintf("%s is not a git repository (or git failed)", flakePath)
+		return check
+	}
+
+	if strings.TrimSpace(string(out)) != "" {
+		check.Status = StatusWarn
+		check.Message = "flake working tree has uncommitted changes"
+		check.Remediation = "commit or stash before deploying - a dirty tree changes the manifest hash on every apply"
+		return check
+	}
+
+	check.Status = StatusPass
+	check.Message = "flake working tree is clean"
+	return check
+}
+
+// checkSubstituters reads the configured substituters and probes each
+// HTTP(S) one with a HEAD request; non-HTTP substituters (e.g. local paths,
+// s3://) are reported as skipped rather than guessed at.
+func checkSubstituters(ctx context.Context, nixBin string) []DoctorCheck {
+	out, err := exec.CommandContext(ctx, nixBin, "config", "show", "substituters").Output()
+	if err != nil {
+		return []DoctorCheck{{Name: "substituters", Status: StatusWarn, Message: "could not read configured substituters"}}
+	}
+
+	substituters := strings.Fields(strings.TrimSpace(string(out)))
+	if len(substituters) == 0 {
+		return []DoctorCheck{{Name: "substituters", Status: StatusWarn, Message: "no substituters configured"}}
+	}
+
+	checks := make([]DoctorCheck, 0, len(substituters))
+	for _, substituter := range substituters {
+		checks = append(checks, checkSubstituterReachable(ctx, substituter))
+	}
+	return checks
+}
+
+func checkSubstituterReachable(ctx context.Context, substituter string) DoctorCheck {
+	check := DoctorCheck{Name: "substituter:" + substituter}
+
+	u, err := url.Parse(substituter)
+	if err != nil || u.Scheme == "" {
+		check.Status = StatusWarn
+		check.Message = fmt.Sprintf("could not parse substituter URL %q", substituter)
+		return check
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		check.Status = StatusWarn
+		check.Message = fmt.Sprintf("skipping connectivity check for non-HTTP substituter %s", substituter)
+		return check
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodHead, substituter, nil)
+	if err != nil {
+		check.Status = StatusWarn
+		check.Message = fmt.Sprintf("could not build a request for %s: %v", substituter, err)
+		return check
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("could not reach %s: %v", substituter, err)
+		check.Remediation = "check network/proxy settings, or remove this substituter from nix.conf if it's no longer used"
+		return check
+	}
+	resp.Body.Close()
+
+	check.Status = StatusPass
+	check.Message = fmt.Sprintf("%s is reachable", substituter)
+	return check
+}
@@ -0,0 +1,98 @@
+package nix
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// EvalCacheEntry is what BuildHost stores per (flake lock, host, base).
+type EvalCacheEntry struct {
+	StorePath    string    `json:"storePath"`
+	ManifestHash string    `json:"manifestHash"`
+	CachedAt     time.Time `json:"cachedAt"`
+}
+
+// EvalCache caches BuildHost results on disk under
+// ~/.cache/nixfleet/eval, keyed by a hash of flake.nix + flake.lock plus the
+// host name and base, so an unchanged repo answers `plan`/`apply` without
+// re-evaluating. Entries are never invalidated in place - any change to the
+// flake or lock file simply changes the key, leaving the stale entry to age
+// out with normal cache-dir cleanup.
+type EvalCache struct {
+	dir string
+}
+
+// NewEvalCache creates an EvalCache rooted at ~/.cache/nixfleet/eval,
+// creating the directory if needed.
+func NewEvalCache() (*EvalCache, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("resolving home dir: %w", err)
+	}
+
+	dir := filepath.Join(home, ".cache", "nixfleet", "eval")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating eval cache dir: %w", err)
+	}
+
+	return &EvalCache{dir: dir}, nil
+}
+
+// Key derives the cache key for a host build: a hash of flake.nix and
+// flake.lock's contents, plus hostName and base, so any edit to either file
+// - not just a lock update - misses the cache instead of serving a stale
+// closure.
+func (c *EvalCache) Key(flakePath, hostName, base string) (string, error) {
+	h := sha256.New()
+
+	for _, name := range []string{"flake.nix", "flake.lock"} {
+		data, err := os.ReadFile(filepath.Join(flakePath, name))
+		if err != nil {
+			return "", fmt.Errorf("hashing %s: %w", name, err)
+		}
+		h.Write(data)
+	}
+
+	fmt.Fprintf(h, "|%s|%s", hostName, base)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Get returns the cached entry for key, if present and readable.
+func (c *EvalCache) Get(key string) (EvalCacheEntry, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return EvalCacheEntry{}, false
+	}
+
+	var entry EvalCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return EvalCacheEntry{}, false
+	}
+	if entry.StorePath == "" {
+		return EvalCacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+// Put writes entry under key, stamping CachedAt.
+func (c *EvalCache) Put(key string, entry EvalCacheEntry) error {
+	entry.CachedAt = time.Now()
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(c.path(key), data, 0o644)
+}
+
+func (c *EvalCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
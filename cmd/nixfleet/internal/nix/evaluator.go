@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -15,6 +16,10 @@ import (
 type Evaluator struct {
 	flakePath string
 	nixBin    string
+
+	offline     bool
+	evalCache   *EvalCache
+	evalCacheOK bool // evalCache initialized successfully
 }
 
 // NewEvaluator creates a new Nix evaluator
@@ -30,10 +35,54 @@ func NewEvaluator(flakePath string) (*Evaluator, error) {
 		return nil, fmt.Errorf("flake path does not exist: %w", err)
 	}
 
-	return &Evaluator{
+	// Fail fast on the prerequisites every EvalHost/BuildHost call depends
+	// on - too old a nix, or flakes/nix-command not enabled - instead of
+	// letting the first real eval bubble up a raw, hard-to-diagnose nix
+	// error twenty minutes into an apply. See doctor.go for the full
+	// environment preflight this only runs a cheap subset of.
+	if err := checkCheapPreflightOnce(nixBin); err != nil {
+		return nil, fmt.Errorf("nix environment preflight failed: %w", err)
+	}
+
+	e := &Evaluator{
 		flakePath: flakePath,
 		nixBin:    nixBin,
-	}, nil
+	}
+
+	if cache, err := NewEvalCache(); err == nil {
+		e.evalCache = cache
+		e.evalCacheOK = true
+	}
+
+	return e, nil
+}
+
+// SetOffline controls whether nix commands are run with --offline (no
+// network access, no flake input refresh). Off by default.
+func (e *Evaluator) SetOffline(offline bool) {
+	e.offline = offline
+}
+
+// Offline reports whether --offline mode is active.
+func (e *Evaluator) Offline() bool {
+	return e.offline
+}
+
+// SetEvalCacheEnabled controls whether BuildHost consults the on-disk eval
+// cache (~/.cache/nixfleet/eval). On by default; has no effect if the cache
+// directory couldn't be created.
+func (e *Evaluator) SetEvalCacheEnabled(enabled bool) {
+	e.evalCacheOK = enabled && e.evalCache != nil
+}
+
+// nixArgs appends --offline when offline mode is active. Only relevant to
+// commands that touch flake inputs (eval, build, flake show); path-info and
+// store diff-closures are always local.
+func (e *Evaluator) nixArgs(args ...string) []string {
+	if e.offline {
+		args = append(args, "--offline")
+	}
+	return args
 }
 
 // HostClosure represents a built host configuration
@@ -61,7 +110,7 @@ func (e *Evaluator) EvalHost(ctx context.Context, hostName string, base string)
 	// Evaluate to get the derivation path
 	flakeRef := fmt.Sprintf("%s#%s", e.flakePath, attr)
 
-	cmd := exec.CommandContext(ctx, e.nixBin, "eval", "--raw", flakeRef)
+	cmd := exec.CommandContext(ctx, e.nixBin, e.nixArgs("eval", "--raw", flakeRef)...)
 	cmd.Dir = e.flakePath
 
 	var stdout, stderr bytes.Buffer
@@ -86,7 +135,7 @@ func (e *Evaluator) EvalHost(ctx context.Context, hostName string, base string)
 // reconcile a declarative spec rather than building/copying a closure.
 func (e *Evaluator) EvalAttrJSON(ctx context.Context, attr string) ([]byte, error) {
 	flakeRef := fmt.Sprintf("%s#%s", e.flakePath, attr)
-	cmd := exec.CommandContext(ctx, e.nixBin, "eval", "--json", flakeRef)
+	cmd := exec.CommandContext(ctx, e.nixBin, e.nixArgs("eval", "--json", flakeRef)...)
 	cmd.Dir = e.flakePath
 
 	var stdout, stderr bytes.Buffer
@@ -99,26 +148,195 @@ func (e *Evaluator) EvalAttrJSON(ctx context.Context, attr string) ([]byte, erro
 	return stdout.Bytes(), nil
 }
 
+// CheckAvailable verifies the nix binary this Evaluator resolved at
+// construction can still actually run, and returns its version string.
+// Health checks use this to fail before a real EvalHost/BuildHost call
+// would, e.g. if nix was removed from PATH after the server started.
+func (e *Evaluator) CheckAvailable(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, e.nixBin, "--version")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("nix --version failed: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// CheckFlakeEvaluable runs a fast flake metadata lookup against flakePath -
+// cheap compared to actually evaluating a host - to catch a broken flake.nix
+// or an unreachable input before a real apply fails deep into the run.
+func (e *Evaluator) CheckFlakeEvaluable(ctx context.Context) error {
+	return e.CheckFlakeEvaluableAt(ctx, e.flakePath)
+}
+
+// CheckFlakeEvaluableAt is CheckFlakeEvaluable against an arbitrary flake
+// source instead of e.flakePath - a local path or a remote flake reference
+// (e.g. "github:team-b/infra"). Used to fail fast on a host pinned to an
+// alternate flake via inventory.Host.Flake/Group.Flake or a server-side
+// override, before BuildHostFromFlake sinks time into a real build.
+func (e *Evaluator) CheckFlakeEvaluableAt(ctx context.Context, flakeSource string) error {
+	cmd := exec.CommandContext(ctx, e.nixBin, e.nixArgs("flake", "metadata", "--json", flakeSource)...)
+	if info, err := os.Stat(flakeSource); err == nil && info.IsDir() {
+		cmd.Dir = flakeSource
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("nix flake metadata failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
 // BuildHost builds a host configuration and returns the store path
 func (e *Evaluator) BuildHost(ctx context.Context, hostName string, base string) (*HostClosure, error) {
-	var attr string
+	return e.buildHostAt(ctx, e.flakePath, hostName, base, true, nil)
+}
+
+// BuildHostFromFlake builds hostName from flakeRef instead of the
+// evaluator's configured flake path, for hosts pinned to an alternate
+// branch/commit via a per-host override. Skips the eval cache, since its
+// key is derived from the flake.nix/flake.lock of e.flakePath and doesn't
+// apply to an arbitrary alternate reference.
+func (e *Evaluator) BuildHostFromFlake(ctx context.Context, flakeRef string, hostName string, base string) (*HostClosure, error) {
+	return e.buildHostAt(ctx, flakeRef, hostName, base, false, nil)
+}
+
+// BuildHostWithVars is BuildHost, additionally passing vars into the
+// evaluation as --argstr NAME VALUE pairs (sorted by key, for a stable
+// command line) - see inventory.Host.Vars and Inventory.ResolvedVarsForHost.
+// It bypasses the eval cache whenever vars is non-empty, since the cache
+// key doesn't account for vars and a stale hit could hand back a closure
+// built with different values.
+func (e *Evaluator) BuildHostWithVars(ctx context.Context, hostName string, base string, vars map[string]string) (*HostClosure, error) {
+	return e.buildHostAt(ctx, e.flakePath, hostName, base, len(vars) == 0, vars)
+}
+
+// BuildAttr builds an arbitrary flake attribute (e.g. a host's
+// config.system.build.vm) and returns its store path. Unlike BuildHost, it
+// bypasses the eval cache entirely - the cache key is hostName+base, which
+// doesn't distinguish "toplevel" from other build outputs of the same host.
+func (e *Evaluator) BuildAttr(ctx context.Context, attr string) (string, error) {
+	flakeRef := fmt.Sprintf("%s#%s", e.flakePath, attr)
+
+	cmd := exec.CommandContext(ctx, e.nixBin, e.nixArgs("build", "--no-link", "--print-out-paths", "--impure", flakeRef)...)
+	if info, err := os.Stat(e.flakePath); err == nil && info.IsDir() {
+		cmd.Dir = e.flakePath
+	}
+	cmd.Env = append(os.Environ(), "NIXPKGS_ALLOW_UNFREE=1")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("nix build %s failed: %w\nstderr: %s", attr, err, stderr.String())
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// ProfileTarget is one entry from inventory.Host.Profiles, identifying a
+// non-system output to build and activate alongside the host's system
+// closure.
+type ProfileTarget struct {
+	// Kind is "home-manager" or "profile".
+	Kind string
+	// Name is the user a home-manager config activates as, or the profile
+	// name for a plain "profile:" target.
+	Name string
+}
+
+// String renders the target back in "kind:name" form, matching the
+// inventory syntax it was parsed from.
+func (t ProfileTarget) String() string {
+	return fmt.Sprintf("%s:%s", t.Kind, t.Name)
+}
+
+// ParseProfileTarget parses one inventory.Host.Profiles entry, e.g.
+// "home-manager:ztaylor" or "profile:backup-tools".
+func ParseProfileTarget(s string) (ProfileTarget, error) {
+	kind, name, ok := strings.Cut(s, ":")
+	if !ok || name == "" {
+		return ProfileTarget{}, fmt.Errorf("invalid profile target %q: want \"kind:name\"", s)
+	}
+	switch kind {
+	case "home-manager", "profile":
+		return ProfileTarget{Kind: kind, Name: name}, nil
+	default:
+		return ProfileTarget{}, fmt.Errorf("invalid profile target %q: unknown kind %q (want home-manager or profile)", s, kind)
+	}
+}
+
+// attrForProfile returns the flake attribute path target resolves to for
+// hostName. A home-manager target builds the standalone
+// homeConfigurations."<user>@<host>" output's activation package; a plain
+// profile target builds the "profiles.<name>" output directly.
+func attrForProfile(hostName string, target ProfileTarget) string {
+	switch target.Kind {
+	case "home-manager":
+		return fmt.Sprintf("homeConfigurations.\"%s@%s\".activationPackage", target.Name, hostName)
+	default: // "profile"
+		return fmt.Sprintf("profiles.%s", target.Name)
+	}
+}
+
+// BuildProfile builds target for hostName and returns its store path. Like
+// BuildAttr, it bypasses the eval cache - profile targets are built far
+// less often than the system closure and don't share its cache key shape.
+func (e *Evaluator) BuildProfile(ctx context.Context, hostName string, target ProfileTarget) (string, error) {
+	return e.BuildAttr(ctx, attrForProfile(hostName, target))
+}
+
+// attrForHost returns the flake attribute path for hostName under base.
+func attrForHost(hostName, base string) (string, error) {
 	switch base {
 	case "nixos":
-		attr = fmt.Sprintf("nixosConfigurations.%s.config.system.build.toplevel", hostName)
+		return fmt.Sprintf("nixosConfigurations.%s.config.system.build.toplevel", hostName), nil
 	case "ubuntu":
-		attr = fmt.Sprintf("nixfleetConfigurations.%s.system", hostName)
+		return fmt.Sprintf("nixfleetConfigurations.%s.system", hostName), nil
 	case "darwin":
-		attr = fmt.Sprintf("darwinConfigurations.%s.system", hostName)
+		return fmt.Sprintf("darwinConfigurations.%s.system", hostName), nil
 	default:
-		return nil, fmt.Errorf("unknown base: %s", base)
+		return "", fmt.Errorf("unknown base: %s", base)
 	}
+}
 
-	flakeRef := fmt.Sprintf("%s#%s", e.flakePath, attr)
+func (e *Evaluator) buildHostAt(ctx context.Context, flakePath string, hostName string, base string, useCache bool, vars map[string]string) (*HostClosure, error) {
+	attr, err := attrForHost(hostName, base)
+	if err != nil {
+		return nil, err
+	}
+
+	flakeRef := fmt.Sprintf("%s#%s", flakePath, attr)
+
+	var cacheKey string
+	if useCache && e.evalCacheOK {
+		key, err := e.evalCache.Key(flakePath, hostName, base)
+		if err == nil {
+			cacheKey = key
+			if entry, ok := e.evalCache.Get(cacheKey); ok && e.storePathExists(ctx, entry.StorePath) {
+				return &HostClosure{
+					HostName:     hostName,
+					StorePath:    entry.StorePath,
+					Base:         base,
+					ManifestHash: entry.ManifestHash,
+				}, nil
+			}
+		}
+	}
 
 	// Build the configuration
 	// Use --impure and NIXPKGS_ALLOW_UNFREE=1 to allow unfree packages in user configs
-	cmd := exec.CommandContext(ctx, e.nixBin, "build", "--no-link", "--print-out-paths", "--impure", flakeRef)
-	cmd.Dir = e.flakePath
+	buildArgs := []string{"build", "--no-link", "--print-out-paths", "--impure"}
+	for _, k := range sortedVarKeys(vars) {
+		buildArgs = append(buildArgs, "--argstr", k, vars[k])
+	}
+	buildArgs = append(buildArgs, flakeRef)
+	cmd := exec.CommandContext(ctx, e.nixBin, e.nixArgs(buildArgs...)...)
+	if info, err := os.Stat(flakePath); err == nil && info.IsDir() {
+		cmd.Dir = flakePath
+	}
 	cmd.Env = append(os.Environ(), "NIXPKGS_ALLOW_UNFREE=1")
 
 	var stdout, stderr bytes.Buffer
@@ -138,6 +356,10 @@ func (e *Evaluator) BuildHost(ctx context.Context, hostName string, base string)
 		manifestHash = ""
 	}
 
+	if cacheKey != "" {
+		_ = e.evalCache.Put(cacheKey, EvalCacheEntry{StorePath: storePath, ManifestHash: manifestHash})
+	}
+
 	return &HostClosure{
 		HostName:     hostName,
 		StorePath:    storePath,
@@ -146,6 +368,17 @@ func (e *Evaluator) BuildHost(ctx context.Context, hostName string, base string)
 	}, nil
 }
 
+// storePathExists checks that storePath is still present in the local Nix
+// store, so a cache hit never hands back a path that's since been
+// garbage-collected.
+func (e *Evaluator) storePathExists(ctx context.Context, storePath string) bool {
+	if storePath == "" {
+		return false
+	}
+	cmd := exec.CommandContext(ctx, e.nixBin, "path-info", storePath)
+	return cmd.Run() == nil
+}
+
 // DeclaredFile is a file managed by the host config (nixfleet.files.<path>).
 // Either Text or Source is set (the other is null).
 type DeclaredFile struct {
@@ -164,7 +397,7 @@ func (e *Evaluator) EvalManagedFiles(ctx context.Context, hostName string) (map[
 	attr := fmt.Sprintf("nixfleetConfigurations.%s.config.nixfleet.files", hostName)
 	flakeRef := fmt.Sprintf("%s#%s", e.flakePath, attr)
 
-	cmd := exec.CommandContext(ctx, e.nixBin, "eval", "--json", flakeRef)
+	cmd := exec.CommandContext(ctx, e.nixBin, e.nixArgs("eval", "--json", flakeRef)...)
 	cmd.Dir = e.flakePath
 
 	var stdout, stderr bytes.Buffer
@@ -220,6 +453,77 @@ func (e *Evaluator) getManifestHash(ctx context.Context, storePath string) (stri
 	return "", nil
 }
 
+// ManifestHashFor returns the current narHash for storePath, the same value
+// BuildHost computes for a freshly-built closure. Used to check a store
+// path's provenance record against what's actually on disk.
+func (e *Evaluator) ManifestHashFor(ctx context.Context, storePath string) (string, error) {
+	return e.getManifestHash(ctx, storePath)
+}
+
+// ClosureDiff is the package-level summary of what changed between two
+// closures, parsed from `nix store diff-closures`.
+type ClosureDiff struct {
+	Added    []string `json:"added,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+	Upgraded []string `json:"upgraded,omitempty"`
+}
+
+// DiffClosures runs `nix store diff-closures` between two store paths and
+// parses its package-level summary into added/removed/upgraded lists. Lines
+// look like:
+//
+//	name: ∅ -> 1.2.3, +4.5 MiB
+//	name: 1.2.3 -> ∅, -4.5 MiB
+//	name: 1.2.3 -> 1.2.4, +120.0 KiB
+func (e *Evaluator) DiffClosures(ctx context.Context, oldPath, newPath string) (*ClosureDiff, error) {
+	if oldPath == "" || oldPath == newPath {
+		return &ClosureDiff{}, nil
+	}
+
+	cmd := exec.CommandContext(ctx, e.nixBin, "store", "diff-closures", oldPath, newPath)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("nix store diff-closures failed: %w\nstderr: %s", err, stderr.String())
+	}
+
+	diff := &ClosureDiff{}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		name, versions, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+
+		versions, _, _ = strings.Cut(versions, ",") // drop the trailing size delta
+		before, after, ok := strings.Cut(versions, "->")
+		if !ok {
+			continue
+		}
+		before = strings.TrimSpace(before)
+		after = strings.TrimSpace(after)
+
+		switch {
+		case before == "∅":
+			diff.Added = append(diff.Added, fmt.Sprintf("%s %s", name, after))
+		case after == "∅":
+			diff.Removed = append(diff.Removed, fmt.Sprintf("%s %s", name, before))
+		default:
+			diff.Upgraded = append(diff.Upgraded, fmt.Sprintf("%s %s -> %s", name, before, after))
+		}
+	}
+
+	return diff, nil
+}
+
 // GetClosureSize returns the size of a closure in bytes
 func (e *Evaluator) GetClosureSize(ctx context.Context, storePath string) (int64, error) {
 	cmd := exec.CommandContext(ctx, e.nixBin, "path-info", "-S", "--json", storePath)
@@ -247,7 +551,7 @@ func (e *Evaluator) GetClosureSize(ctx context.Context, storePath string) (int64
 
 // ListFlakeOutputs lists available outputs in the flake
 func (e *Evaluator) ListFlakeOutputs(ctx context.Context) ([]string, error) {
-	cmd := exec.CommandContext(ctx, e.nixBin, "flake", "show", "--json", e.flakePath)
+	cmd := exec.CommandContext(ctx, e.nixBin, e.nixArgs("flake", "show", "--json", e.flakePath)...)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -280,6 +584,10 @@ func (e *Evaluator) FlakePath() string {
 // ones (e.g. "nixpkgs"). Returns the combined nix output, which on a real
 // change includes the "Updated input ...: 'old' → 'new'" lines.
 func (e *Evaluator) FlakeUpdate(ctx context.Context, inputs ...string) (string, error) {
+	if e.offline {
+		return "skipped: offline (flake update requires network access)", nil
+	}
+
 	args := []string{"flake", "update"}
 	args = append(args, inputs...)
 	// nix flake update operates on the flake in the current dir; point it at ours.
@@ -296,6 +604,17 @@ func (e *Evaluator) FlakeUpdate(ctx context.Context, inputs ...string) (string,
 	return combined.String(), nil
 }
 
+// sortedVarKeys returns vars's keys sorted, for a stable --argstr ordering
+// in the rendered nix build command line.
+func sortedVarKeys(vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // ResolveFlakePath resolves a potentially relative flake path
 func ResolveFlakePath(path string) (string, error) {
 	if filepath.IsAbs(path) {
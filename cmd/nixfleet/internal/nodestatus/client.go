@@ -0,0 +1,77 @@
+package nodestatus
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Client scrapes a node status daemon's HTTP(S) endpoints, presenting a
+// client certificate when the daemon requires mutual TLS (see TLSConfig).
+// It's the counterpart the central server's collector uses to poll nodes
+// directly instead of going through SSH.
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient builds a Client. certFile/keyFile/caFile identify the fleet
+// certificate this client presents and the CA it trusts on the server side;
+// leaving all three empty falls back to plain HTTP for daemons that haven't
+// opted into TLS.
+func NewClient(certFile, keyFile, caFile string) (*Client, error) {
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return &Client{httpClient: &http.Client{Timeout: 10 * time.Second}}, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate %s / key %s: %w", certFile, keyFile, err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if caFile != "" {
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file %s: %w", caFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &Client{
+		httpClient: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// FetchStatus GETs baseURL's /status endpoint, e.g.
+// "https://web1.example.com:9100".
+func (c *Client) FetchStatus(ctx context.Context, baseURL string) (*Status, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(baseURL, "/")+"/status", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching status from %s: %w", baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	var status Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("decoding status from %s: %w", baseURL, err)
+	}
+	return &status, nil
+}
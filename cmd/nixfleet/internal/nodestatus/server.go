@@ -5,16 +5,27 @@ package nodestatus
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	"github.com/nixfleet/nixfleet/internal/state"
 )
 
+// defaultDriftCheckInterval is how often the node re-hashes its managed
+// files against state.json when Config.DriftCheckInterval is unset.
+const defaultDriftCheckInterval = 30 * time.Minute
+
 // Config holds the server configuration
 type Config struct {
 	Port            int
@@ -28,6 +39,22 @@ type Config struct {
 	GitTag          string
 	HostRepoPath    string
 	HomeManagerPath string
+
+	// TLS enables HTTPS and mutual TLS via the fleet PKI. Nil serves
+	// plaintext HTTP, matching the historical default.
+	TLS *TLSConfig
+
+	// DriftCheckInterval is how often the node re-hashes the ManagedFiles
+	// recorded in state.json and updates its drift fields locally, instead
+	// of waiting for a central server to SSH in and run Manager.CheckDrift.
+	// Zero uses defaultDriftCheckInterval (30m); negative disables the local
+	// checker entirely.
+	DriftCheckInterval time.Duration
+
+	// DriftCriticalPaths lists managed-file paths whose drift makes /health
+	// report unhealthy (503) in addition to the always-available /drift
+	// detail. Empty means no path's drift affects /health.
+	DriftCriticalPaths []string
 }
 
 // DefaultConfig returns a Config with sensible defaults
@@ -53,6 +80,7 @@ type Status struct {
 	PullMode     *PullStatus  `json:"pullMode,omitempty"`
 	State        *StateInfo   `json:"state,omitempty"`
 	Health       *HealthInfo  `json:"health,omitempty"`
+	Drift        *DriftReport `json:"drift,omitempty"`
 	Uptime       string       `json:"uptime,omitempty"`
 }
 
@@ -72,6 +100,30 @@ type PullStatus struct {
 	HostRepo      *RepoStatus `json:"hostRepo,omitempty"`
 	HomeManager   *RepoStatus `json:"homeManager,omitempty"`
 	RecentEntries []string    `json:"recentEntries,omitempty"`
+
+	// FailedSecrets lists secrets the last preflight check couldn't decrypt
+	// with this host's age key, left in place until a later preflight
+	// succeeds. Their names are reported, never their contents.
+	FailedSecrets   []string `json:"failedSecrets,omitempty"`
+	FailedSecretsAt string   `json:"failedSecretsAt,omitempty"`
+
+	// RollbackOccurred is true if the most recently applied generation
+	// failed its post-boot confirmation and was automatically rolled back,
+	// left in place until a later pull applies and confirms a newer one.
+	RollbackOccurred bool   `json:"rollbackOccurred,omitempty"`
+	RollbackFrom     string `json:"rollbackFrom,omitempty"`
+	RollbackTo       string `json:"rollbackTo,omitempty"`
+	RollbackAt       string `json:"rollbackAt,omitempty"`
+	RollbackReason   string `json:"rollbackReason,omitempty"`
+
+	// TransferDeferred is true if the pull script found a pending download
+	// over its configured size threshold outside the transfer window and
+	// deferred the build/substitution phase rather than apply immediately.
+	// It's reported here so a deferred host isn't mistaken for a broken one.
+	TransferDeferred  bool    `json:"transferDeferred,omitempty"`
+	DeferredPendingMB float64 `json:"deferredPendingMB,omitempty"`
+	DeferredAt        string  `json:"deferredAt,omitempty"`
+	TransferWindow    string  `json:"transferWindow,omitempty"`
 }
 
 // RepoStatus represents git repository status
@@ -98,6 +150,18 @@ type HealthInfo struct {
 type Server struct {
 	config Config
 	server *http.Server
+
+	driftMu     sync.RWMutex
+	driftReport *DriftReport
+}
+
+// DriftReport is the result of the node's most recent local drift check,
+// served at /drift and folded into /health.
+type DriftReport struct {
+	CheckedAt time.Time           `json:"checkedAt"`
+	Detected  bool                `json:"detected"`
+	Files     []state.DriftResult `json:"files,omitempty"`
+	Error     string              `json:"error,omitempty"`
 }
 
 // NewServer creates a new node status server
@@ -115,20 +179,69 @@ func (s *Server) Start(ctx context.Context) error {
 	mux.HandleFunc("/health", s.handleHealth)
 	mux.HandleFunc("/pull", s.handlePullStatus)
 	mux.HandleFunc("/state", s.handleState)
+	mux.HandleFunc("/drift", s.handleDrift)
+
+	var handler http.Handler = mux
+	var tlsConfig *tls.Config
+	if s.config.TLS != nil {
+		exempt := make(map[string]bool, len(s.config.TLS.ExemptPaths))
+		for _, p := range s.config.TLS.ExemptPaths {
+			exempt[p] = true
+		}
+		handler = requireClientCert(exempt, mux)
+
+		cfg, err := buildTLSConfig(*s.config.TLS)
+		if err != nil {
+			return err
+		}
+		tlsConfig = cfg
+	}
 
 	addr := fmt.Sprintf("%s:%d", s.config.BindAddress, s.config.Port)
 	s.server = &http.Server{
 		Addr:         addr,
-		Handler:      mux,
+		Handler:      handler,
+		TLSConfig:    tlsConfig,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
 
+	// A SIGHUP forces an immediate certificate reload instead of waiting for
+	// the next handshake to notice the files changed - handy right after
+	// `nixfleet pki renew` when the operator wants to confirm it took.
+	if s.config.TLS != nil {
+		sighup := make(chan os.Signal, 1)
+		signal.Notify(sighup, syscall.SIGHUP)
+		defer signal.Stop(sighup)
+		go func() {
+			for range sighup {
+				log.Println("nodestatus: SIGHUP received, reloading TLS certificate")
+				s.reloadCert()
+			}
+		}()
+	}
+
+	if s.config.DriftCheckInterval >= 0 {
+		go s.runDriftLoop(ctx)
+	}
+
 	// Start server in goroutine
 	errCh := make(chan error, 1)
 	go func() {
-		fmt.Printf("Node status server listening on %s\n", addr)
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		scheme := "http"
+		if s.config.TLS != nil {
+			scheme = "https"
+		}
+		fmt.Printf("Node status server listening on %s://%s\n", scheme, addr)
+		var err error
+		if s.config.TLS != nil {
+			// Cert/key are served via TLSConfig.GetCertificate, not these
+			// arguments - ListenAndServeTLS still requires non-empty paths.
+			err = s.server.ListenAndServeTLS(s.config.TLS.CertFile, s.config.TLS.KeyFile)
+		} else {
+			err = s.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			errCh <- err
 		}
 	}()
@@ -144,6 +257,19 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 }
 
+// reloadCert forces the TLS certificate reloader to re-read its files right
+// now, used by the SIGHUP handler above.
+func (s *Server) reloadCert() {
+	if s.server == nil || s.server.TLSConfig == nil || s.server.TLSConfig.GetCertificate == nil {
+		return
+	}
+	// GetCertificate already checks mtimes on every call; a nil
+	// ClientHelloInfo is fine since certReloader.maybeReload ignores it.
+	if _, err := s.server.TLSConfig.GetCertificate(nil); err != nil {
+		log.Printf("nodestatus: certificate reload failed: %v", err)
+	}
+}
+
 func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
 		http.NotFound(w, r)
@@ -169,6 +295,7 @@ a { color: #0066cc; }
 <div class="endpoint"><a href="/health">/health</a> - Health check endpoint</div>
 <div class="endpoint"><a href="/pull">/pull</a> - Pull mode status</div>
 <div class="endpoint"><a href="/state">/state</a> - State information</div>
+<div class="endpoint"><a href="/drift">/drift</a> - Local managed-file drift check</div>
 </body>
 </html>`, s.config.HostName, s.config.HostName)
 }
@@ -189,15 +316,17 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	response := struct {
-		Status   string       `json:"status"`
-		Hostname string       `json:"hostname"`
-		Time     time.Time    `json:"time"`
-		Version  *VersionInfo `json:"version,omitempty"`
+		Status       string       `json:"status"`
+		Hostname     string       `json:"hostname"`
+		Time         time.Time    `json:"time"`
+		Version      *VersionInfo `json:"version,omitempty"`
+		DriftOnCheck bool         `json:"driftDetected,omitempty"`
 	}{
-		Status:   status.Status,
-		Hostname: s.config.HostName,
-		Time:     time.Now(),
-		Version:  status.Version,
+		Status:       status.Status,
+		Hostname:     s.config.HostName,
+		Time:         time.Now(),
+		Version:      status.Version,
+		DriftOnCheck: status.Drift != nil && status.Drift.Detected,
 	}
 
 	if status.Status == "unhealthy" {
@@ -220,6 +349,20 @@ func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stateInfo)
 }
 
+func (s *Server) handleDrift(w http.ResponseWriter, r *http.Request) {
+	report := s.currentDriftReport()
+
+	w.Header().Set("Content-Type", "application/json")
+	if report == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(struct {
+			Error string `json:"error"`
+		}{Error: "no drift check has run yet"})
+		return
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
 func (s *Server) gatherStatus() Status {
 	status := Status{
 		Hostname:  s.config.HostName,
@@ -275,9 +418,65 @@ func (s *Server) gatherStatus() Status {
 		}
 	}
 
+	// An outstanding preflight secret failure means the running generation
+	// is stale relative to the repo, not just that the last pull logged an
+	// error - surface it the same way.
+	if pullStatus != nil && len(pullStatus.FailedSecrets) > 0 && status.Status == "healthy" {
+		status.Status = "degraded"
+	}
+
+	// An automatic rollback means the fleet-desired generation isn't the one
+	// actually running - worth flagging even though the host itself is
+	// healthy again.
+	if pullStatus != nil && pullStatus.RollbackOccurred && status.Status == "healthy" {
+		status.Status = "degraded"
+	}
+
+	// The local drift checker lets a pull-mode-only host surface drift
+	// without a central server SSHing in to run it. Drift on a configured
+	// critical path fails health outright; drift elsewhere just degrades it.
+	if drift := s.currentDriftReport(); drift != nil {
+		status.Drift = drift
+		if drift.Detected {
+			if s.driftOnCriticalPath(drift) {
+				status.Status = "unhealthy"
+			} else if status.Status == "healthy" {
+				status.Status = "degraded"
+			}
+		}
+	}
+
 	return status
 }
 
+// currentDriftReport returns the most recent local drift check result, or
+// nil if none has run yet (e.g. DriftCheckInterval < 0, or the first check
+// hasn't completed).
+func (s *Server) currentDriftReport() *DriftReport {
+	s.driftMu.RLock()
+	defer s.driftMu.RUnlock()
+	return s.driftReport
+}
+
+// driftOnCriticalPath reports whether any file in DriftCriticalPaths has
+// drifted. An empty DriftCriticalPaths means no path is critical, so drift
+// never fails health outright - it only degrades it.
+func (s *Server) driftOnCriticalPath(report *DriftReport) bool {
+	if len(s.config.DriftCriticalPaths) == 0 {
+		return false
+	}
+	critical := make(map[string]bool, len(s.config.DriftCriticalPaths))
+	for _, p := range s.config.DriftCriticalPaths {
+		critical[p] = true
+	}
+	for _, f := range report.Files {
+		if critical[f.Path] && f.Status != state.DriftStatusOK {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Server) gatherStateInfo() *StateInfo {
 	statePath := filepath.Join(s.config.StateDir, "state.json")
 	data, err := os.ReadFile(statePath)
@@ -379,6 +578,59 @@ func (s *Server) gatherPullStatus() *PullStatus {
 		status.RecentEntries = lines
 	}
 
+	// A preflight secret-decryption failure leaves this file behind until
+	// the next successful preflight removes it.
+	failurePath := filepath.Join(s.config.StateDir, "last-preflight-failure.json")
+	if data, err := os.ReadFile(failurePath); err == nil {
+		var failure struct {
+			Time    string   `json:"time"`
+			Secrets []string `json:"secrets"`
+		}
+		if json.Unmarshal(data, &failure) == nil {
+			status.FailedSecrets = failure.Secrets
+			status.FailedSecretsAt = failure.Time
+		}
+	}
+
+	// A failed post-boot confirmation leaves this file behind as a
+	// prominent, persistent record until a later pull applies and confirms
+	// a newer generation.
+	rollbackPath := filepath.Join(s.config.StateDir, "last-rollback.json")
+	if data, err := os.ReadFile(rollbackPath); err == nil {
+		var rollback struct {
+			FromGeneration int    `json:"from_generation"`
+			ToGeneration   int    `json:"to_generation"`
+			Time           string `json:"time"`
+			Reason         string `json:"reason"`
+		}
+		if json.Unmarshal(data, &rollback) == nil {
+			status.RollbackOccurred = true
+			status.RollbackFrom = fmt.Sprintf("%d", rollback.FromGeneration)
+			status.RollbackTo = fmt.Sprintf("%d", rollback.ToGeneration)
+			status.RollbackAt = rollback.Time
+			status.RollbackReason = rollback.Reason
+		}
+	}
+
+	// A pending-but-deferred build/substitution leaves this file behind
+	// until a later pull finds itself inside the transfer window (or within
+	// the size threshold) and proceeds.
+	deferredPath := filepath.Join(s.config.StateDir, "pull-deferred.json")
+	if data, err := os.ReadFile(deferredPath); err == nil {
+		var deferred struct {
+			Commit     string  `json:"commit"`
+			PendingMB  float64 `json:"pending_mb"`
+			DeferredAt string  `json:"deferred_at"`
+			Window     string  `json:"window"`
+		}
+		if json.Unmarshal(data, &deferred) == nil {
+			status.TransferDeferred = true
+			status.DeferredPendingMB = deferred.PendingMB
+			status.DeferredAt = deferred.DeferredAt
+			status.TransferWindow = deferred.Window
+		}
+	}
+
 	return status
 }
 
@@ -449,6 +701,76 @@ func (s *Server) gatherHealthInfo() *HealthInfo {
 	return info
 }
 
+// runDriftLoop re-checks drift on a timer for as long as ctx is alive,
+// running once immediately so /drift and /health aren't empty while the
+// node waits out its first interval. It only ever writes to local disk
+// (state.json) and never opens an SSH connection, which is the point: a
+// pull-mode-only fleet gets drift detection without a central server.
+func (s *Server) runDriftLoop(ctx context.Context) {
+	interval := s.config.DriftCheckInterval
+	if interval == 0 {
+		interval = defaultDriftCheckInterval
+	}
+
+	s.checkDriftNow()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkDriftNow()
+		}
+	}
+}
+
+// checkDriftNow re-hashes the ManagedFiles recorded in state.json, updates
+// state.json's drift fields in place, and stores the result for /drift and
+// /health to serve.
+func (s *Server) checkDriftNow() {
+	statePath := filepath.Join(s.config.StateDir, "state.json")
+	hostState, err := state.ReadStateLocal(statePath)
+	if err != nil {
+		s.setDriftReport(&DriftReport{CheckedAt: time.Now(), Error: err.Error()})
+		return
+	}
+
+	results, err := state.CheckDriftLocal(hostState.ManagedFiles)
+	if err != nil {
+		s.setDriftReport(&DriftReport{CheckedAt: time.Now(), Error: err.Error()})
+		return
+	}
+
+	checkedAt := time.Now()
+	var driftFiles []string
+	for _, r := range results {
+		if r.HasDrift() {
+			driftFiles = append(driftFiles, r.Path)
+		}
+	}
+
+	hostState.DriftDetected = len(driftFiles) > 0
+	hostState.DriftFiles = driftFiles
+	hostState.LastDriftCheck = checkedAt
+	if err := state.WriteStateLocal(statePath, hostState); err != nil {
+		log.Printf("nodestatus: writing drift results to %s: %v", statePath, err)
+	}
+
+	s.setDriftReport(&DriftReport{
+		CheckedAt: checkedAt,
+		Detected:  len(driftFiles) > 0,
+		Files:     results,
+	})
+}
+
+func (s *Server) setDriftReport(report *DriftReport) {
+	s.driftMu.Lock()
+	s.driftReport = report
+	s.driftMu.Unlock()
+}
+
 func (s *Server) getUptime() (string, error) {
 	data, err := os.ReadFile("/proc/uptime")
 	if err != nil {
@@ -0,0 +1,264 @@
+package nodestatus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSConfig enables HTTPS and mutual TLS on the node status server, using
+// the fleet PKI: CertFile/KeyFile are this node's own leaf certificate
+// (see `nixfleet pki issue`), and ClientCAFile is the fleet root (or
+// intermediate) that signed the certificates presented by whatever scrapes
+// this endpoint (see Client, used by the central server's collector).
+type TLSConfig struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+
+	// CRLFile, if set, is a PEM-encoded CRL (as deployed by `nixfleet pki
+	// deploy` alongside ca.crt - see Deployer.Deploy) checked on every
+	// client handshake so a revoked node certificate stops authenticating
+	// immediately instead of staying valid until it expires. Re-read from
+	// disk whenever it changes, same as CertFile/KeyFile.
+	CRLFile string
+
+	// ExemptPaths are served without requiring a client certificate, e.g.
+	// so an unauthenticated load balancer can still hit /health.
+	ExemptPaths []string
+}
+
+// certReloader serves the latest cert/key pair off disk, re-reading it
+// whenever either file's mtime advances so a certificate renewed by
+// `nixfleet pki renew` takes effect without restarting the daemon. A reload
+// is also forced on SIGHUP (see Server.Start).
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate %s / key %s: %w", r.certFile, r.keyFile, err)
+	}
+	certStat, err := os.Stat(r.certFile)
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", r.certFile, err)
+	}
+	keyStat, err := os.Stat(r.keyFile)
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", r.keyFile, err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.certMod = certStat.ModTime()
+	r.keyMod = keyStat.ModTime()
+	r.mu.Unlock()
+	return nil
+}
+
+// maybeReload re-reads the cert/key pair if either file changed since the
+// last load. A failed reload logs and keeps serving the previous
+// certificate rather than taking the server down over a half-written file.
+func (r *certReloader) maybeReload() {
+	certStat, err := os.Stat(r.certFile)
+	if err != nil {
+		return
+	}
+	keyStat, err := os.Stat(r.keyFile)
+	if err != nil {
+		return
+	}
+
+	r.mu.RLock()
+	changed := certStat.ModTime().After(r.certMod) || keyStat.ModTime().After(r.keyMod)
+	r.mu.RUnlock()
+	if !changed {
+		return
+	}
+
+	if err := r.reload(); err != nil {
+		log.Printf("nodestatus: certificate reload failed, keeping previous certificate: %v", err)
+	} else {
+		log.Printf("nodestatus: reloaded TLS certificate from %s", r.certFile)
+	}
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.maybeReload()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// crlChecker rejects a client certificate whose serial number appears in
+// the latest CRL read off disk, re-reading the file whenever its mtime
+// advances so a revocation published by `nixfleet pki deploy` takes effect
+// without restarting the daemon - the same reload-on-mtime approach as
+// certReloader.
+type crlChecker struct {
+	path string
+
+	mu      sync.RWMutex
+	revoked map[string]bool
+	fileMod time.Time
+}
+
+func newCRLChecker(path string) (*crlChecker, error) {
+	c := &crlChecker{path: path}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *crlChecker) reload() error {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return fmt.Errorf("reading CRL %s: %w", c.path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("decoding CRL %s: no PEM block found", c.path)
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("parsing CRL %s: %w", c.path, err)
+	}
+	stat, err := os.Stat(c.path)
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", c.path, err)
+	}
+
+	revoked := make(map[string]bool, len(crl.RevokedCertificateEntries))
+	for _, e := range crl.RevokedCertificateEntries {
+		revoked[e.SerialNumber.String()] = true
+	}
+
+	c.mu.Lock()
+	c.revoked = revoked
+	c.fileMod = stat.ModTime()
+	c.mu.Unlock()
+	return nil
+}
+
+// maybeReload re-parses the CRL if the file changed since the last load. A
+// failed reload logs and keeps enforcing the previous CRL rather than
+// taking the server down over a half-written file.
+func (c *crlChecker) maybeReload() {
+	stat, err := os.Stat(c.path)
+	if err != nil {
+		return
+	}
+	c.mu.RLock()
+	changed := stat.ModTime().After(c.fileMod)
+	c.mu.RUnlock()
+	if !changed {
+		return
+	}
+
+	if err := c.reload(); err != nil {
+		log.Printf("nodestatus: CRL reload failed, keeping previous CRL: %v", err)
+	} else {
+		log.Printf("nodestatus: reloaded CRL from %s", c.path)
+	}
+}
+
+// verifyPeerCertificate implements tls.Config.VerifyPeerCertificate,
+// rejecting the handshake if the client's verified leaf certificate serial
+// is in the CRL. verifiedChains is only populated once the certificate has
+// already chained to ClientCAs, so this only needs to check revocation.
+func (c *crlChecker) verifyPeerCertificate(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+	c.maybeReload()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, chain := range verifiedChains {
+		if len(chain) == 0 {
+			continue
+		}
+		if c.revoked[chain[0].SerialNumber.String()] {
+			return fmt.Errorf("certificate serial %s is revoked", chain[0].SerialNumber.String())
+		}
+	}
+	return nil
+}
+
+// buildTLSConfig loads cfg's certificate and client CA into a *tls.Config
+// that serves HTTPS and, for a client that presents one, verifies it
+// against the fleet CA. Verification uses VerifyClientCertIfGiven rather
+// than RequireAndVerifyClientCert so ExemptPaths can be served without a
+// client cert - requireClientCert enforces the per-path requirement.
+func buildTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	reloader, err := newCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if cfg.ClientCAFile != "" {
+		caPEM, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading client CA file %s: %w", cfg.ClientCAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+
+		if cfg.CRLFile != "" {
+			checker, err := newCRLChecker(cfg.CRLFile)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.VerifyPeerCertificate = checker.verifyPeerCertificate
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// requireClientCert wraps next so every request other than an exempt path
+// must have presented a client certificate. The TLS handshake itself
+// (VerifyClientCertIfGiven) already rejects an invalid certificate before
+// the request reaches here - this only enforces that one was presented at
+// all, so an anonymous request can't simply skip TLS client auth.
+func requireClientCert(exempt map[string]bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
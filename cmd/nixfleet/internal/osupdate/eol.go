@@ -0,0 +1,108 @@
+package osupdate
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// date is a small helper for the table below, expressed as UTC midnight -
+// Canonical publishes EOL dates as calendar dates, not timestamps.
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// DefaultEOLDates is NixFleet's built-in end-of-life table for Ubuntu
+// releases, keyed by /etc/os-release's VERSION_ID. Canonical publishes
+// these years in advance, but a release newer than this binary still won't
+// be in it - that's what the overrides passed to ComputeEOLStatus are for,
+// so tracking a new release doesn't require a nixfleet upgrade.
+var DefaultEOLDates = map[string]time.Time{
+	"14.04": date(2019, time.April, 25),
+	"16.04": date(2021, time.April, 30),
+	"18.04": date(2023, time.May, 31),
+	"20.04": date(2025, time.April, 2),
+	"22.04": date(2027, time.June, 1),
+	"24.04": date(2029, time.June, 1),
+	"23.04": date(2024, time.January, 20),
+	"23.10": date(2024, time.July, 11),
+	"24.10": date(2025, time.July, 10),
+	"25.04": date(2026, time.January, 12),
+	"25.10": date(2026, time.July, 9),
+}
+
+// EOLStatus is a release's end-of-life standing as of the moment it was
+// computed, plus (when ua/pro is installed on the host) its live ESM and
+// Livepatch entitlement.
+type EOLStatus struct {
+	VersionID    string    `json:"version_id"`
+	EOLDate      time.Time `json:"eol_date"`
+	DaysUntilEOL int       `json:"days_until_eol"` // negative once past EOL
+	Past         bool      `json:"past"`
+
+	ESMEntitled       bool `json:"esm_entitled"`
+	ESMEnabled        bool `json:"esm_enabled"`
+	LivepatchEntitled bool `json:"livepatch_entitled"`
+	LivepatchEnabled  bool `json:"livepatch_enabled"`
+}
+
+// EOLDateFor resolves versionID's end-of-life date, checking overrides
+// before the built-in table so a fleet-configured date always wins.
+func EOLDateFor(versionID string, overrides map[string]time.Time) (time.Time, bool) {
+	if d, ok := overrides[versionID]; ok {
+		return d, true
+	}
+	d, ok := DefaultEOLDates[versionID]
+	return d, ok
+}
+
+// ComputeEOLStatus resolves versionID's EOLStatus as of now, or nil when
+// versionID is in neither overrides nor the built-in table (e.g. a non-
+// Ubuntu host, or a release nobody has taught nixfleet about yet).
+func ComputeEOLStatus(versionID string, overrides map[string]time.Time, now time.Time) *EOLStatus {
+	eolDate, ok := EOLDateFor(versionID, overrides)
+	if !ok {
+		return nil
+	}
+	return &EOLStatus{
+		VersionID:    versionID,
+		EOLDate:      eolDate,
+		DaysUntilEOL: int(eolDate.Sub(now).Hours() / 24),
+		Past:         !now.Before(eolDate),
+	}
+}
+
+// ParseAdvantageStatus extracts ESM and Livepatch entitlement/enablement
+// from `ubuntu-advantage status --format json` (or `pro status --format
+// json` - pro is the current binary name, ua the old one; both accept the
+// flag and emit the same shape). Malformed or empty input (e.g. the host
+// has neither client installed) just reports everything false rather than
+// erroring, since "not entitled" is the correct answer for such a host.
+func ParseAdvantageStatus(jsonOutput string) EOLStatus {
+	var status EOLStatus
+	var parsed struct {
+		Services []struct {
+			Name     string `json:"name"`
+			Entitled string `json:"entitled"`
+			Status   string `json:"status"`
+		} `json:"services"`
+	}
+	if err := json.Unmarshal([]byte(jsonOutput), &parsed); err != nil {
+		return status
+	}
+
+	for _, svc := range parsed.Services {
+		switch svc.Name {
+		case "esm-infra", "esm-apps":
+			if svc.Entitled == "yes" {
+				status.ESMEntitled = true
+			}
+			if svc.Status == "enabled" {
+				status.ESMEnabled = true
+			}
+		case "livepatch":
+			status.LivepatchEntitled = svc.Entitled == "yes"
+			status.LivepatchEnabled = svc.Status == "enabled"
+		}
+	}
+	return status
+}
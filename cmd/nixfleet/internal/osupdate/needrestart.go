@@ -0,0 +1,159 @@
+package osupdate
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nixfleet/nixfleet/internal/ssh"
+)
+
+// RestartStatus describes what still needs restarting after an update.
+type RestartStatus struct {
+	// Services still running against a since-replaced library or binary.
+	Services []string
+	// KernelChanged is true when the installed kernel no longer matches
+	// the running one, meaning a reboot is required and restarting
+	// services alone will not fix it.
+	KernelChanged bool
+	// Method records how Services was determined: "needrestart" or
+	// "heuristic" (the /proc/*/maps fallback).
+	Method string
+}
+
+var (
+	needrestartSvcRegex  = regexp.MustCompile(`(?m)^NEEDRESTART-SVC:\s*(.+)$`)
+	needrestartKstaRegex = regexp.MustCompile(`(?m)^NEEDRESTART-KSTA:\s*(\d+)$`)
+)
+
+// CheckServicesNeedingRestart determines which services are running
+// against outdated libraries or binaries after a package update, using
+// needrestart in batch mode when available. If needrestart is missing
+// and installNeedrestart is true, it is installed via apt first; if it's
+// still unavailable, a /proc/*/maps-based heuristic is used instead.
+func (u *Updater) CheckServicesNeedingRestart(ctx context.Context, client *ssh.Client, installNeedrestart bool) (*RestartStatus, error) {
+	if !hasNeedrestart(ctx, client) {
+		if installNeedrestart {
+			if err := installNeedrestartPackage(ctx, client); err != nil {
+				return nil, fmt.Errorf("failed to install needrestart: %w", err)
+			}
+		}
+	}
+
+	if hasNeedrestart(ctx, client) {
+		return checkServicesNeedingRestartNeedrestart(ctx, client)
+	}
+
+	return checkServicesNeedingRestartHeuristic(ctx, client)
+}
+
+func hasNeedrestart(ctx context.Context, client *ssh.Client) bool {
+	result, err := client.Exec(ctx, "command -v needrestart")
+	return err == nil && result.ExitCode == 0
+}
+
+func installNeedrestartPackage(ctx context.Context, client *ssh.Client) error {
+	result, err := client.ExecSudo(ctx, "DEBIAN_FRONTEND=noninteractive apt-get install -y needrestart")
+	if err != nil {
+		return fmt.Errorf("failed to install needrestart: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("apt-get install needrestart failed: %s", result.Stderr)
+	}
+	return nil
+}
+
+func checkServicesNeedingRestartNeedrestart(ctx context.Context, client *ssh.Client) (*RestartStatus, error) {
+	// -b: batch mode, machine-readable NEEDRESTART-* lines instead of a
+	// dialog. Ignore the exit code: needrestart returns non-zero when
+	// restarts are pending, which is exactly the case we're checking for.
+	result, _ := client.ExecSudo(ctx, "needrestart -b")
+
+	status := parseNeedrestartOutput(result.Stdout)
+	status.Method = "needrestart"
+	return status, nil
+}
+
+// parseNeedrestartOutput parses `needrestart -b` output. Each stale
+// service is reported as "NEEDRESTART-SVC: <unit>"; "NEEDRESTART-KSTA: <n>"
+// reports kernel status, where 1 means the running kernel matches the
+// installed one and anything else means a reboot is required.
+func parseNeedrestartOutput(output string) *RestartStatus {
+	status := &RestartStatus{}
+
+	for _, m := range needrestartSvcRegex.FindAllStringSubmatch(output, -1) {
+		status.Services = append(status.Services, strings.TrimSpace(m[1]))
+	}
+
+	if m := needrestartKstaRegex.FindStringSubmatch(output); m != nil {
+		status.KernelChanged = m[1] != "1"
+	}
+
+	return status
+}
+
+// checkServicesNeedingRestartHeuristic falls back to scanning
+// /proc/*/maps for libraries that were replaced on disk since the
+// process mapped them (they show up suffixed "(deleted)"), then maps
+// the owning PIDs back to systemd units. This is a much cruder signal
+// than needrestart but works without installing anything.
+func checkServicesNeedingRestartHeuristic(ctx context.Context, client *ssh.Client) (*RestartStatus, error) {
+	cmd := `for p in /proc/[0-9]*/maps; do
+  pid=$(basename $(dirname "$p"))
+  if grep -q ' (deleted)$' "$p" 2>/dev/null && grep -qE '\.so(\.[0-9]+)*\s+\(deleted\)$' "$p" 2>/dev/null; then
+    unit=$(systemctl status "$pid" 2>/dev/null | head -1 | sed -n 's/^\xe2\x97\x8f \([^ ]*\).*/\1/p')
+    if [ -n "$unit" ]; then
+      echo "$unit"
+    fi
+  fi
+done | sort -u`
+
+	result, err := client.ExecSudo(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for stale services: %w", err)
+	}
+
+	status := &RestartStatus{Method: "heuristic"}
+	for _, line := range strings.Split(strings.TrimSpace(result.Stdout), "\n") {
+		if line != "" {
+			status.Services = append(status.Services, line)
+		}
+	}
+
+	return status, nil
+}
+
+// RestartServices restarts each of the given services, skipping any that
+// match an entry in exclude (a substring match against the service name,
+// e.g. "postgresql" excludes "postgresql@14-main.service"). It returns
+// the services that were restarted and those that were skipped.
+func (u *Updater) RestartServices(ctx context.Context, client *ssh.Client, services []string, exclude []string) (restarted, skipped []string, err error) {
+	for _, svc := range services {
+		if matchesAny(svc, exclude) {
+			skipped = append(skipped, svc)
+			continue
+		}
+
+		result, execErr := client.ExecSudo(ctx, fmt.Sprintf("systemctl restart %s", svc))
+		if execErr != nil {
+			return restarted, skipped, fmt.Errorf("failed to restart %s: %w", svc, execErr)
+		}
+		if result.ExitCode != 0 {
+			return restarted, skipped, fmt.Errorf("failed to restart %s: %s", svc, result.Stderr)
+		}
+
+		restarted = append(restarted, svc)
+	}
+
+	return restarted, skipped, nil
+}
+
+func matchesAny(service string, patterns []string) bool {
+	for _, p := range patterns {
+		if p != "" && strings.Contains(service, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -243,3 +243,142 @@ func TestUpdateResultFailed(t *testing.T) {
 		t.Errorf("Stderr = %s, want 'apt-get failed'", result.Stderr)
 	}
 }
+
+func TestComputeEOLStatus(t *testing.T) {
+	now := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	status := ComputeEOLStatus("20.04", nil, now)
+	if status == nil {
+		t.Fatal("expected a status for 20.04")
+	}
+	if status.Past {
+		t.Error("20.04 should not be past EOL as of 2025-01-01")
+	}
+	if status.DaysUntilEOL <= 0 {
+		t.Errorf("DaysUntilEOL = %d, want > 0", status.DaysUntilEOL)
+	}
+
+	if status := ComputeEOLStatus("18.04", nil, now); status == nil || !status.Past {
+		t.Error("18.04 should be past EOL as of 2025-01-01")
+	}
+
+	if status := ComputeEOLStatus("99.99", nil, now); status != nil {
+		t.Errorf("expected nil for an unknown release, got %+v", status)
+	}
+}
+
+func TestComputeEOLStatusOverride(t *testing.T) {
+	now := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	overrides := map[string]time.Time{
+		"20.04": time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		"30.04": time.Date(2032, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	if status := ComputeEOLStatus("20.04", overrides, now); status == nil || !status.Past {
+		t.Error("override should win over the built-in 20.04 date")
+	}
+	if status := ComputeEOLStatus("30.04", overrides, now); status == nil || status.Past {
+		t.Error("expected 30.04 to resolve via override and not be past EOL")
+	}
+}
+
+func TestParseAdvantageStatus(t *testing.T) {
+	json := `{"services":[
+		{"name":"esm-infra","entitled":"yes","status":"enabled"},
+		{"name":"esm-apps","entitled":"yes","status":"disabled"},
+		{"name":"livepatch","entitled":"yes","status":"enabled"}
+	]}`
+
+	status := ParseAdvantageStatus(json)
+	if !status.ESMEntitled || !status.ESMEnabled {
+		t.Errorf("expected ESM entitled+enabled (esm-infra is enabled), got %+v", status)
+	}
+	if !status.LivepatchEntitled || !status.LivepatchEnabled {
+		t.Errorf("expected livepatch entitled+enabled, got %+v", status)
+	}
+}
+
+func TestParseAdvantageStatusEmpty(t *testing.T) {
+	status := ParseAdvantageStatus("")
+	if status.ESMEntitled || status.ESMEnabled || status.LivepatchEntitled || status.LivepatchEnabled {
+		t.Errorf("expected all-false for empty input, got %+v", status)
+	}
+}
+
+func TestParseConffilePolicy(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ConffilePolicy
+		wantErr  bool
+	}{
+		{"keep", ConffileKeep, false},
+		{"", ConffileKeep, false},
+		{"new", ConffileNew, false},
+		{"ask-fail", ConffileAskFail, false},
+		{"ask", ConffileAskFail, false},
+		{"invalid", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParseConffilePolicy(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseConffilePolicy(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+				return
+			}
+			if result != tt.expected {
+				t.Errorf("ParseConffilePolicy(%q) = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+// dpkgConffileAskFail is trimmed real dpkg output for a conffile prompt
+// that had no TTY to answer and fell back to keeping the old file.
+const dpkgConffileAskFail = `Unpacking rsyslog (8.2112.0-2ubuntu2.2) over (8.2112.0-2ubuntu2.1) ...
+Setting up rsyslog (8.2112.0-2ubuntu2.2) ...
+
+Configuration file '/etc/rsyslog.conf'
+ ==> Modified (by you or by a script) since installation.
+ ==> Package distributor has shipped an updated version.
+   What would you like to do about it ?  Your options are:
+    Y or I  : install the package maintainer's version
+    N or O  : keep your currently-installed version
+      D     : show the differences between the versions
+      Z     : start a shell to examine the situation
+ The default action is to keep your current version.
+*** rsyslog.conf (Y/I/N/O/D/Z) [default=N] ?
+  dpkg: stdin isn't a terminal, don't know how to ask confirmation question. Assuming default action.
+   ==> Keeping old config file as default.
+`
+
+const dpkgConffileReplaced = `Configuration file '/etc/ssh/sshd_config'
+ ==> Modified (by you or by a script) since installation.
+ ==> Package distributor has shipped an updated version.
+   * Installing new version of config file /etc/ssh/sshd_config ...
+Setting up openssh-server (1:8.9p1-3ubuntu0.6) ...
+`
+
+func TestParseConffileDecisions(t *testing.T) {
+	decisions := parseConffileDecisions(dpkgConffileAskFail)
+	if len(decisions) != 1 || decisions[0].Path != "/etc/rsyslog.conf" || decisions[0].Decision != "ask-fail" {
+		t.Errorf("parseConffileDecisions(ask-fail fixture) = %+v", decisions)
+	}
+
+	decisions = parseConffileDecisions(dpkgConffileReplaced)
+	if len(decisions) != 1 || decisions[0].Path != "/etc/ssh/sshd_config" || decisions[0].Decision != "replaced" {
+		t.Errorf("parseConffileDecisions(replaced fixture) = %+v", decisions)
+	}
+}
+
+func TestConffileAskFailErr(t *testing.T) {
+	if err := conffileAskFailErr(nil); err != nil {
+		t.Errorf("expected nil error for no decisions, got %v", err)
+	}
+
+	decisions := []ConffileDecision{{Path: "/etc/rsyslog.conf", Decision: "ask-fail"}}
+	err := conffileAskFailErr(decisions)
+	if err == nil {
+		t.Fatal("expected error for an ask-fail decision")
+	}
+}
@@ -12,13 +12,120 @@ import (
 
 // UpdateResult contains the result of an OS update operation
 type UpdateResult struct {
-	Success         bool
-	PackagesUpdated []PackageUpdate
-	RebootRequired  bool
-	StartTime       time.Time
-	EndTime         time.Time
-	Stdout          string
-	Stderr          string
+	Success           bool
+	PackagesUpdated   []PackageUpdate
+	RebootRequired    bool
+	StartTime         time.Time
+	EndTime           time.Time
+	Stdout            string
+	Stderr            string
+	ConffileDecisions []ConffileDecision
+}
+
+// ConffilePolicy controls how dpkg handles a conffile (a config file
+// shipped by a package) that was modified locally and that the package
+// now wants to replace. Without one of these, an unattended upgrade has
+// no TTY to answer dpkg's prompt and the run stalls.
+type ConffilePolicy string
+
+const (
+	// ConffileKeep always keeps the locally modified file
+	// (--force-confold). Safe default: an unattended run should never
+	// silently discard an operator's edits.
+	ConffileKeep ConffilePolicy = "keep"
+
+	// ConffileNew always installs the package maintainer's version
+	// (--force-confnew), discarding local edits.
+	ConffileNew ConffilePolicy = "new"
+
+	// ConffileAskFail passes no force-conf option. dpkg can't prompt
+	// without a TTY and falls back to keeping the old file, but this
+	// policy treats that fallback as a failure and names the conffile,
+	// so the decision is surfaced instead of being made silently.
+	ConffileAskFail ConffilePolicy = "ask-fail"
+)
+
+// ParseConffilePolicy parses a --conffile flag value.
+func ParseConffilePolicy(s string) (ConffilePolicy, error) {
+	switch strings.ToLower(s) {
+	case "keep", "":
+		return ConffileKeep, nil
+	case "new":
+		return ConffileNew, nil
+	case "ask-fail", "ask":
+		return ConffileAskFail, nil
+	default:
+		return "", fmt.Errorf("unknown conffile policy: %s (valid: keep, new, ask-fail)", s)
+	}
+}
+
+// dpkgOption returns the `-o Dpkg::Options::=...` fragment implementing
+// the policy, or "" for ConffileAskFail (no force flag: a conflict is
+// detected from the upgrade output rather than avoided up front).
+func (p ConffilePolicy) dpkgOption() string {
+	switch p {
+	case ConffileNew:
+		return `-o Dpkg::Options::='--force-confnew'`
+	case ConffileAskFail:
+		return ""
+	default: // ConffileKeep
+		return `-o Dpkg::Options::='--force-confold'`
+	}
+}
+
+// ConffileDecision records what happened to a single conffile during an
+// upgrade, because the package wanted to replace a locally modified copy.
+type ConffileDecision struct {
+	Path     string
+	Decision string // "kept", "replaced", or "ask-fail"
+}
+
+var conffileHeaderRegex = regexp.MustCompile(`Configuration file '([^']+)'`)
+
+// parseConffileDecisions scans dpkg/apt-get upgrade output for conffile
+// prompt blocks and reports, per file, whether the local copy was kept,
+// the maintainer's version was installed, or (under ConffileAskFail) dpkg
+// had no TTY to ask and fell back to keeping the old file.
+func parseConffileDecisions(output string) []ConffileDecision {
+	headers := conffileHeaderRegex.FindAllStringSubmatchIndex(output, -1)
+	if headers == nil {
+		return nil
+	}
+
+	var decisions []ConffileDecision
+	for i, h := range headers {
+		path := output[h[2]:h[3]]
+		end := len(output)
+		if i+1 < len(headers) {
+			end = headers[i+1][0]
+		}
+		block := output[h[1]:end]
+
+		decision := "kept"
+		switch {
+		case strings.Contains(block, "don't know how to ask confirmation question"):
+			decision = "ask-fail"
+		case strings.Contains(block, "Installing new version of config file"):
+			decision = "replaced"
+		case strings.Contains(block, "Keeping old config file as default"):
+			decision = "kept"
+		}
+
+		decisions = append(decisions, ConffileDecision{Path: path, Decision: decision})
+	}
+
+	return decisions
+}
+
+// conffileAskFailErr returns an error naming the first conffile that hit an
+// unanswerable prompt under ConffileAskFail, or nil if none did.
+func conffileAskFailErr(decisions []ConffileDecision) error {
+	for _, d := range decisions {
+		if d.Decision == "ask-fail" {
+			return fmt.Errorf("conffile prompt for %s: unattended upgrade has no TTY to answer; use a different --conffile policy", d.Path)
+		}
+	}
+	return nil
 }
 
 // PackageUpdate represents a single package update
@@ -105,14 +212,19 @@ func (u *Updater) CheckPendingUpdates(ctx context.Context, client *ssh.Client) (
 	return pending, nil
 }
 
-// ApplySecurityUpdates applies only security updates
-func (u *Updater) ApplySecurityUpdates(ctx context.Context, client *ssh.Client) (*UpdateResult, error) {
+// ApplySecurityUpdates applies only security updates. conffilePolicy
+// decides what happens when a package wants to replace a locally modified
+// config file; see ConffilePolicy.
+func (u *Updater) ApplySecurityUpdates(ctx context.Context, client *ssh.Client, conffilePolicy ConffilePolicy) (*UpdateResult, error) {
 	result := &UpdateResult{
 		StartTime: time.Now(),
 	}
 
-	// Run unattended-upgrade for security updates only
-	execResult, err := client.ExecSudo(ctx, "unattended-upgrade -v 2>&1")
+	// Run unattended-upgrade for security updates only. It shells out to
+	// apt/dpkg internally, which still honors Dpkg::Options passed on its
+	// own command line.
+	cmd := fmt.Sprintf("unattended-upgrade -v %s 2>&1", conffilePolicy.dpkgOption())
+	execResult, err := client.ExecSudo(ctx, cmd)
 	result.EndTime = time.Now()
 
 	if err != nil {
@@ -126,15 +238,25 @@ func (u *Updater) ApplySecurityUpdates(ctx context.Context, client *ssh.Client)
 
 	// Parse updated packages from output
 	result.PackagesUpdated = parseUnattendedUpgradeOutput(execResult.Stdout)
+	result.ConffileDecisions = parseConffileDecisions(execResult.Stdout)
 
 	// Check if reboot is required
 	result.RebootRequired, _ = u.IsRebootRequired(ctx, client)
 
+	if conffilePolicy == ConffileAskFail {
+		if askErr := conffileAskFailErr(result.ConffileDecisions); askErr != nil {
+			result.Success = false
+			return result, askErr
+		}
+	}
+
 	return result, nil
 }
 
-// ApplyAllUpdates applies all available updates (security + regular)
-func (u *Updater) ApplyAllUpdates(ctx context.Context, client *ssh.Client) (*UpdateResult, error) {
+// ApplyAllUpdates applies all available updates (security + regular).
+// conffilePolicy decides what happens when a package wants to replace a
+// locally modified config file; see ConffilePolicy.
+func (u *Updater) ApplyAllUpdates(ctx context.Context, client *ssh.Client, conffilePolicy ConffilePolicy) (*UpdateResult, error) {
 	result := &UpdateResult{
 		StartTime: time.Now(),
 	}
@@ -146,7 +268,7 @@ func (u *Updater) ApplyAllUpdates(ctx context.Context, client *ssh.Client) (*Upd
 	}
 
 	// Run apt-get upgrade with DEBIAN_FRONTEND=noninteractive
-	cmd := "DEBIAN_FRONTEND=noninteractive apt-get upgrade -y -o Dpkg::Options::='--force-confdef' -o Dpkg::Options::='--force-confold'"
+	cmd := fmt.Sprintf("DEBIAN_FRONTEND=noninteractive apt-get upgrade -y %s", conffilePolicy.dpkgOption())
 	execResult, err := client.ExecSudo(ctx, cmd)
 	result.EndTime = time.Now()
 
@@ -158,6 +280,7 @@ func (u *Updater) ApplyAllUpdates(ctx context.Context, client *ssh.Client) (*Upd
 	result.Stdout = execResult.Stdout
 	result.Stderr = execResult.Stderr
 	result.Success = execResult.ExitCode == 0
+	result.ConffileDecisions = parseConffileDecisions(execResult.Stdout + execResult.Stderr)
 
 	// Build package update list from pending updates
 	for _, pkg := range pendingBefore.SecurityUpdates {
@@ -180,17 +303,26 @@ func (u *Updater) ApplyAllUpdates(ctx context.Context, client *ssh.Client) (*Upd
 	// Check if reboot is required
 	result.RebootRequired, _ = u.IsRebootRequired(ctx, client)
 
+	if conffilePolicy == ConffileAskFail {
+		if askErr := conffileAskFailErr(result.ConffileDecisions); askErr != nil {
+			result.Success = false
+			return result, askErr
+		}
+	}
+
 	return result, nil
 }
 
-// ApplyDistUpgrade applies dist-upgrade (may add/remove packages)
-func (u *Updater) ApplyDistUpgrade(ctx context.Context, client *ssh.Client) (*UpdateResult, error) {
+// ApplyDistUpgrade applies dist-upgrade (may add/remove packages).
+// conffilePolicy decides what happens when a package wants to replace a
+// locally modified config file; see ConffilePolicy.
+func (u *Updater) ApplyDistUpgrade(ctx context.Context, client *ssh.Client, conffilePolicy ConffilePolicy) (*UpdateResult, error) {
 	result := &UpdateResult{
 		StartTime: time.Now(),
 	}
 
 	// Run apt-get dist-upgrade
-	cmd := "DEBIAN_FRONTEND=noninteractive apt-get dist-upgrade -y -o Dpkg::Options::='--force-confdef' -o Dpkg::Options::='--force-confold'"
+	cmd := fmt.Sprintf("DEBIAN_FRONTEND=noninteractive apt-get dist-upgrade -y %s", conffilePolicy.dpkgOption())
 	execResult, err := client.ExecSudo(ctx, cmd)
 	result.EndTime = time.Now()
 
@@ -205,10 +337,18 @@ func (u *Updater) ApplyDistUpgrade(ctx context.Context, client *ssh.Client) (*Up
 
 	// Parse upgraded packages from apt output
 	result.PackagesUpdated = parseAptUpgradeOutput(execResult.Stdout)
+	result.ConffileDecisions = parseConffileDecisions(execResult.Stdout + execResult.Stderr)
 
 	// Check if reboot is required
 	result.RebootRequired, _ = u.IsRebootRequired(ctx, client)
 
+	if conffilePolicy == ConffileAskFail {
+		if askErr := conffileAskFailErr(result.ConffileDecisions); askErr != nil {
+			result.Success = false
+			return result, askErr
+		}
+	}
+
 	return result, nil
 }
 
@@ -0,0 +1,150 @@
+package pki
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AgentInstallSpec configures the on-host certificate renewal agent
+// installed by `pki install-agent`. Unlike the central push model
+// (SystemdService/SystemdTimer, which runs `nixfleet pki renew` from the
+// operator machine over SSH), the agent runs entirely on the host: it
+// generates its own key/CSR and calls the cert-manager webhook directly,
+// authenticating with the certificate it's renewing.
+type AgentInstallSpec struct {
+	WebhookURL  string        // e.g. "https://ca.example.com:8443/sign"
+	DestDir     string        // Directory holding host.crt/host.key/ca.crt (default: /etc/nixfleet/pki)
+	ReloadUnits []string      // systemd units to reload after a successful renewal
+	Schedule    string        // systemd OnCalendar expression (default: "daily")
+	UnitName    string        // systemd unit name (default: "nixfleet-pki-agent")
+	RenewBefore time.Duration // renew once fewer than this remains before expiry (default: 30 days)
+}
+
+// DefaultAgentInstallSpec returns sensible defaults for AgentInstallSpec.
+func DefaultAgentInstallSpec() *AgentInstallSpec {
+	return &AgentInstallSpec{
+		DestDir:     "/etc/nixfleet/pki",
+		Schedule:    "daily",
+		UnitName:    "nixfleet-pki-agent",
+		RenewBefore: 30 * 24 * time.Hour,
+	}
+}
+
+// AgentLastRenewalPath returns the path of the marker file the renewal
+// script stamps on every successful renewal, read back by
+// state.Manager.GatherPKIAgentInfo.
+func AgentLastRenewalPath(destDir string) string {
+	return destDir + "/agent-last-renewal"
+}
+
+// AgentRenewalScriptPath returns the path the renewal script is installed
+// at on the host.
+func AgentRenewalScriptPath(destDir string) string {
+	return destDir + "/renew-agent.sh"
+}
+
+// AgentRenewalScript generates the shell script the systemd service runs.
+// It's a plain POSIX shell + openssl + curl script (no nixfleet binary
+// required on the host) that:
+//  1. checks the current host cert's remaining validity, exiting early if
+//     renewal isn't due yet
+//  2. generates a fresh key and CSR for hostname
+//  3. POSTs the CSR to the webhook over mTLS, authenticating with the
+//     current host cert/key it's about to replace
+//  4. installs the returned certificate and key atomically
+//  5. reloads the configured units
+//  6. stamps AgentLastRenewalPath with the current UTC time
+func AgentRenewalScript(spec *AgentInstallSpec, hostname string) string {
+	reload := "true"
+	if len(spec.ReloadUnits) > 0 {
+		var cmds []string
+		for _, unit := range spec.ReloadUnits {
+			cmds = append(cmds, fmt.Sprintf("systemctl reload-or-restart %s", unit))
+		}
+		reload = strings.Join(cmds, " && ")
+	}
+
+	renewBeforeDays := int(spec.RenewBefore.Hours() / 24)
+	if renewBeforeDays <= 0 {
+		renewBeforeDays = 30
+	}
+
+	return fmt.Sprintf(`#!/bin/sh
+# Generated by nixfleet pki install-agent. Do not edit by hand; re-run
+# install-agent to change the schedule, webhook URL, or reload units.
+set -eu
+
+DEST_DIR=%q
+WEBHOOK_URL=%q
+HOSTNAME=%q
+RENEW_BEFORE_DAYS=%d
+LAST_RENEWAL_FILE="$DEST_DIR/agent-last-renewal"
+
+cert="$DEST_DIR/host.crt"
+key="$DEST_DIR/host.key"
+ca="$DEST_DIR/ca.crt"
+
+if [ -f "$cert" ]; then
+	expiry_epoch=$(openssl x509 -enddate -noout -in "$cert" | cut -d= -f2 | xargs -I{} date -d {} +%%s)
+	now_epoch=$(date +%%s)
+	days_left=$(( (expiry_epoch - now_epoch) / 86400 ))
+	if [ "$days_left" -gt "$RENEW_BEFORE_DAYS" ]; then
+		echo "nixfleet-pki-agent: $HOSTNAME cert valid for $days_left more days, skipping"
+		exit 0
+	fi
+fi
+
+tmpdir=$(mktemp -d)
+trap 'rm -rf "$tmpdir"' EXIT
+
+openssl ecparam -name prime256v1 -genkey -noout -out "$tmpdir/new.key"
+openssl req -new -key "$tmpdir/new.key" -out "$tmpdir/new.csr" -subj "/CN=$HOSTNAME"
+
+csr_b64=$(base64 -w0 "$tmpdir/new.csr")
+payload=$(printf '{"apiVersion":"certificates.k8s.io/v1","kind":"CertificateSigningRequest","spec":{"request":"%%s","signerName":"nixfleet.io/fleet-ca"}}' "$csr_b64")
+
+response=$(curl -sS --fail --cert "$cert" --key "$key" --cacert "$ca" \
+	-H 'Content-Type: application/json' -d "$payload" "$WEBHOOK_URL")
+
+cert_b64=$(printf '%%s' "$response" | sed -n 's/.*"certificate":"\([^"]*\)".*/\1/p')
+if [ -z "$cert_b64" ]; then
+	echo "nixfleet-pki-agent: webhook did not return a certificate: $response" >&2
+	exit 1
+fi
+
+printf '%%s' "$cert_b64" | base64 -d > "$tmpdir/new.crt"
+
+install -m 0644 "$tmpdir/new.crt" "$cert"
+install -m 0600 "$tmpdir/new.key" "$key"
+
+%s
+
+date -u +%%Y-%%m-%%dT%%H:%%M:%%SZ > "$LAST_RENEWAL_FILE"
+echo "nixfleet-pki-agent: renewed $HOSTNAME"
+`, spec.DestDir, spec.WebhookURL, hostname, renewBeforeDays, reload)
+}
+
+// AgentSystemdService returns the systemd service unit that runs the
+// renewal script. The timer is generated with rotation.go's SystemdTimer,
+// since the calendar-schedule logic doesn't differ between the push and
+// agent models.
+func AgentSystemdService(spec *AgentInstallSpec) string {
+	return fmt.Sprintf(`[Unit]
+Description=NixFleet On-Host Certificate Renewal Agent
+Documentation=https://github.com/nixfleet/nixfleet
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=/bin/sh %s
+User=root
+PrivateTmp=true
+ProtectSystem=strict
+ReadWritePaths=%s
+
+[Install]
+WantedBy=multi-user.target
+`, AgentRenewalScriptPath(spec.DestDir), spec.DestDir)
+}
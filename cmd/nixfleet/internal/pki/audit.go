@@ -0,0 +1,67 @@
+package pki
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// AuditEntry records a single signing decision made by the cert-manager
+// webhook, so a compromised or misbehaving on-host agent leaves a trail of
+// exactly what it asked for and whether it was allowed.
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Identity string    `json:"identity,omitempty"` // CN of the mTLS client cert, empty for unauthenticated requests
+	Hostname string    `json:"hostname"`           // CSR's requested CommonName
+	SANs     []string  `json:"sans,omitempty"`
+	Allowed  bool      `json:"allowed"`
+	Reason   string    `json:"reason,omitempty"`
+	Serial   string    `json:"serial,omitempty"`
+
+	// KeyReused is true if this issuance reused an existing private key
+	// (see Deployer.RenewCert's reuseKey) rather than generating a new one.
+	KeyReused bool `json:"keyReused,omitempty"`
+}
+
+// AuditLogger appends signing decisions to a JSON-lines file. It's
+// intentionally append-only and file-based, matching the rest of the PKI
+// package's filesystem-as-database approach rather than pulling in a
+// database dependency for what's just a security log.
+type AuditLogger struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewAuditLogger creates a logger that appends to path.
+func NewAuditLogger(path string) *AuditLogger {
+	return &AuditLogger{path: path}
+}
+
+// Log appends entry to the audit log, stamping Time if it's zero.
+func (l *AuditLogger) Log(entry AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,244 @@
+package pki
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BundlePEMFilename and BundleManifestFilename are the files 'pki bundle
+// build' writes under the store's PKI directory.
+const (
+	BundlePEMFilename      = "trust-bundle.crt"
+	BundleManifestFilename = "trust-bundle-manifest.json"
+)
+
+// TrustBundleConfig is the trust-bundle.yaml schema: the external CAs,
+// beyond our own root/intermediate, that every host should trust. Removing
+// an entry here and re-running 'pki bundle build' (then deploying) drops it
+// from the combined bundle file on hosts, rather than merely leaving it out
+// of future installs.
+type TrustBundleConfig struct {
+	External []ExternalCA `yaml:"external,omitempty"`
+}
+
+// ExternalCA is one non-nixfleet CA to trust fleet-wide - a partner CA or
+// an internal legacy root predating nixfleet's own PKI.
+type ExternalCA struct {
+	Name string `yaml:"name"`
+
+	// Path is a PEM file checked into the repo, relative to
+	// trust-bundle.yaml's own directory unless absolute.
+	Path string `yaml:"path"`
+
+	// ExpectedFingerprint is the certificate's SHA-256 fingerprint (hex,
+	// with or without ":" separators). 'pki bundle build' refuses to
+	// include a cert whose fingerprint doesn't match, so a PEM file
+	// silently swapped out in the repo is caught rather than trusted
+	// uncritically.
+	ExpectedFingerprint string `yaml:"expectedFingerprint"`
+}
+
+// LoadTrustBundleConfig loads trust-bundle.yaml from path.
+func LoadTrustBundleConfig(path string) (*TrustBundleConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading trust bundle config: %w", err)
+	}
+	var cfg TrustBundleConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing trust bundle config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// BundleCertInfo describes one certificate included in a built trust
+// bundle, for its manifest.
+type BundleCertInfo struct {
+	Source      string    `json:"source"` // "root", "intermediate", or the external CA's Name
+	Subject     string    `json:"subject"`
+	Fingerprint string    `json:"fingerprint"`
+	NotAfter    time.Time `json:"not_after"`
+}
+
+// BundleManifest describes a built trust bundle: every certificate it
+// contains, and the SHA-256 hash of the combined PEM file that
+// 'pki status --bundle' compares against what's actually installed on each
+// host to flag drift.
+type BundleManifest struct {
+	BuiltAt time.Time        `json:"built_at"`
+	Hash    string           `json:"hash"`
+	Certs   []BundleCertInfo `json:"certs"`
+}
+
+// GetTrustBundleConfigPath returns where 'pki bundle build' expects
+// trust-bundle.yaml, alongside the store's other top-level PKI files.
+func (s *Store) GetTrustBundleConfigPath() string {
+	return filepath.Join(s.baseDir, "trust-bundle.yaml")
+}
+
+// GetBundlePath returns the combined bundle PEM's path.
+func (s *Store) GetBundlePath() string {
+	return filepath.Join(s.baseDir, BundlePEMFilename)
+}
+
+// GetBundleManifestPath returns the bundle manifest's path.
+func (s *Store) GetBundleManifestPath() string {
+	return filepath.Join(s.baseDir, BundleManifestFilename)
+}
+
+// BuildBundle reads the store's own CA (and intermediate, if any) plus
+// every external CA listed in cfg, verifies each external cert's
+// fingerprint against what cfg expects, and combines them into a single
+// PEM bundle in a fixed order: root, intermediate, then external CAs
+// sorted by name. The fixed order and single-file shape mean a cert
+// removed from cfg is simply absent from the next build, rather than
+// requiring its own removal step.
+func (s *Store) BuildBundle(cfg *TrustBundleConfig) ([]byte, *BundleManifest, error) {
+	var bundle []byte
+	manifest := &BundleManifest{BuiltAt: time.Now()}
+
+	addCert := func(source string, pemBytes []byte) error {
+		info, err := decodeCertInfo(pemBytes)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		manifest.Certs = append(manifest.Certs, BundleCertInfo{
+			Source:      source,
+			Subject:     info.subject,
+			Fingerprint: info.fingerprint,
+			NotAfter:    info.notAfter,
+		})
+		bundle = append(bundle, pemBytes...)
+		return nil
+	}
+
+	caPEM, err := os.ReadFile(s.GetCACertPath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading root CA: %w", err)
+	}
+	if err := addCert("root", caPEM); err != nil {
+		return nil, nil, err
+	}
+
+	if s.IntermediateCAExists() {
+		icPEM, err := os.ReadFile(s.GetIntermediateCertPath())
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading intermediate CA: %w", err)
+		}
+		if err := addCert("intermediate", icPEM); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	external := append([]ExternalCA(nil), cfg.External...)
+	sort.Slice(external, func(i, j int) bool { return external[i].Name < external[j].Name })
+
+	configDir := filepath.Dir(s.GetTrustBundleConfigPath())
+	for _, ext := range external {
+		path := ext.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(configDir, path)
+		}
+		pemBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading external CA %q: %w", ext.Name, err)
+		}
+		info, err := decodeCertInfo(pemBytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("external CA %q: %w", ext.Name, err)
+		}
+		if ext.ExpectedFingerprint != "" && !fingerprintsMatch(info.fingerprint, ext.ExpectedFingerprint) {
+			return nil, nil, fmt.Errorf("external CA %q: fingerprint %s does not match expected %s", ext.Name, info.fingerprint, ext.ExpectedFingerprint)
+		}
+		if err := addCert(ext.Name, pemBytes); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sum := sha256.Sum256(bundle)
+	manifest.Hash = hex.EncodeToString(sum[:])
+
+	return bundle, manifest, nil
+}
+
+// SaveBundle writes bundle and manifest under the store's PKI directory.
+func (s *Store) SaveBundle(bundle []byte, manifest *BundleManifest) error {
+	if err := os.MkdirAll(s.baseDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.GetBundlePath(), bundle, 0644); err != nil {
+		return fmt.Errorf("writing trust bundle: %w", err)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.GetBundleManifestPath(), data, 0644); err != nil {
+		return fmt.Errorf("writing trust bundle manifest: %w", err)
+	}
+	return nil
+}
+
+// BundleExists reports whether 'pki bundle build' has been run.
+func (s *Store) BundleExists() bool {
+	_, err := os.Stat(s.GetBundlePath())
+	return err == nil
+}
+
+// LoadBundleManifest reads back the manifest written by SaveBundle.
+func (s *Store) LoadBundleManifest() (*BundleManifest, error) {
+	data, err := os.ReadFile(s.GetBundleManifestPath())
+	if err != nil {
+		return nil, err
+	}
+	var manifest BundleManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parsing trust bundle manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+type certInfo struct {
+	subject     string
+	fingerprint string
+	notAfter    time.Time
+}
+
+func decodeCertInfo(pemBytes []byte) (*certInfo, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("decoding PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate: %w", err)
+	}
+	sum := sha256.Sum256(cert.Raw)
+	return &certInfo{
+		subject:     cert.Subject.String(),
+		fingerprint: hex.EncodeToString(sum[:]),
+		notAfter:    cert.NotAfter,
+	}, nil
+}
+
+// fingerprintsMatch compares two SHA-256 fingerprints case-insensitively
+// and ignoring ":" separators, so "AA:BB:..." and "aabb..." both match.
+func fingerprintsMatch(a, b string) bool {
+	return normalizeFingerprint(a) == normalizeFingerprint(b)
+}
+
+func normalizeFingerprint(s string) string {
+	return strings.ReplaceAll(strings.ToLower(s), ":", "")
+}
@@ -18,20 +18,46 @@ import (
 // CA represents a Certificate Authority for the fleet
 type CA struct {
 	Certificate *x509.Certificate
-	PrivateKey  *ecdsa.PrivateKey
-	CertPEM     []byte
-	KeyPEM      []byte
+	// PrivateKey signs everything issued by this CA. It's either an
+	// in-memory *ecdsa.PrivateKey (the default) or a hardware-backed
+	// signer from OpenPKCS11Signer, in which case the key material never
+	// leaves the token and KeyPEM is empty.
+	PrivateKey crypto.Signer
+	CertPEM    []byte
+	KeyPEM     []byte
+
+	// MaxCertValidity, if set, is the longest validity IssueCert will accept
+	// for a leaf certificate signed by this CA. Zero means no policy limit
+	// (the 1-year default and any operator-requested validity are allowed).
+	MaxCertValidity time.Duration
+
+	// LastSignLatency records how long the most recent signing operation
+	// (IssueCert, InitIntermediateCA) took. Hardware-backed signers are
+	// noticeably slower than the in-memory default, so callers surface
+	// this in verbose output rather than assuming signing is instant.
+	LastSignLatency time.Duration
 }
 
 // IntermediateCA represents an intermediate Certificate Authority
 // It includes the chain back to the root CA for certificate validation
 type IntermediateCA struct {
 	Certificate *x509.Certificate
-	PrivateKey  *ecdsa.PrivateKey
+	// PrivateKey signs everything issued by this intermediate. See
+	// CA.PrivateKey for the in-memory vs. hardware-backed distinction.
+	PrivateKey  crypto.Signer
 	CertPEM     []byte
 	KeyPEM      []byte
 	ChainPEM    []byte // Full chain: intermediate + root
 	RootCertPEM []byte // Root CA certificate only
+
+	// MaxCertValidity, if set, is the longest validity IssueCert will accept
+	// for a leaf certificate signed by this intermediate. Zero means no
+	// policy limit.
+	MaxCertValidity time.Duration
+
+	// LastSignLatency records how long the most recent signing operation
+	// took. See CA.LastSignLatency.
+	LastSignLatency time.Duration
 }
 
 // IntermediateCAConfig holds configuration for intermediate CA initialization
@@ -70,14 +96,24 @@ func DefaultCAConfig() *CAConfig {
 	}
 }
 
-// InitCA creates a new Certificate Authority
+// InitCA creates a new Certificate Authority with an in-memory ECDSA P-256
+// key pair (compatible with macOS Keychain).
 func InitCA(cfg *CAConfig) (*CA, error) {
-	// Generate ECDSA P-256 key pair (compatible with macOS Keychain)
 	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
 		return nil, fmt.Errorf("generating CA key pair: %w", err)
 	}
-	pubKey := &privKey.PublicKey
+	return InitCAWithSigner(cfg, privKey)
+}
+
+// InitCAWithSigner creates a new Certificate Authority signed by signer
+// instead of a freshly generated in-memory key - used for hardware-backed
+// keys (see OpenPKCS11Signer). signer.Public() must be an *ecdsa.PublicKey.
+func InitCAWithSigner(cfg *CAConfig, signer crypto.Signer) (*CA, error) {
+	pubKey, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("CA signer must be ECDSA, got %T", signer.Public())
+	}
 
 	// Generate serial number
 	serialNumber, err := generateSerialNumber()
@@ -105,7 +141,9 @@ func InitCA(cfg *CAConfig) (*CA, error) {
 	}
 
 	// Self-sign the CA certificate
-	certDER, err := x509.CreateCertificate(rand.Reader, template, template, pubKey, privKey)
+	start := time.Now()
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, pubKey, signer)
+	signLatency := time.Since(start)
 	if err != nil {
 		return nil, fmt.Errorf("creating CA certificate: %w", err)
 	}
@@ -121,32 +159,22 @@ func InitCA(cfg *CAConfig) (*CA, error) {
 		Bytes: certDER,
 	})
 
-	keyPEM, err := marshalECPrivateKey(privKey)
+	keyPEM, err := marshalSignerIfLocal(signer)
 	if err != nil {
 		return nil, fmt.Errorf("encoding CA private key: %w", err)
 	}
 
 	return &CA{
-		Certificate: cert,
-		PrivateKey:  privKey,
-		CertPEM:     certPEM,
-		KeyPEM:      keyPEM,
+		Certificate:     cert,
+		PrivateKey:      signer,
+		CertPEM:         certPEM,
+		KeyPEM:          keyPEM,
+		LastSignLatency: signLatency,
 	}, nil
 }
 
 // LoadCA loads a CA from PEM-encoded certificate and key
 func LoadCA(certPEM, keyPEM []byte) (*CA, error) {
-	// Parse certificate
-	certBlock, _ := pem.Decode(certPEM)
-	if certBlock == nil {
-		return nil, fmt.Errorf("failed to decode CA certificate PEM")
-	}
-
-	cert, err := x509.ParseCertificate(certBlock.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("parsing CA certificate: %w", err)
-	}
-
 	// Parse private key
 	keyBlock, _ := pem.Decode(keyPEM)
 	if keyBlock == nil {
@@ -158,26 +186,59 @@ func LoadCA(certPEM, keyPEM []byte) (*CA, error) {
 		return nil, fmt.Errorf("parsing CA private key: %w", err)
 	}
 
+	ca, err := LoadCAWithSigner(certPEM, privKey)
+	if err != nil {
+		return nil, err
+	}
+	ca.KeyPEM = keyPEM
+	return ca, nil
+}
+
+// LoadCAWithSigner loads a CA from a PEM-encoded certificate, paired with a
+// signer that already holds the matching private key - either parsed
+// in-memory (see LoadCA) or a hardware-backed signer from OpenPKCS11Signer,
+// in which case there is no KeyPEM to set.
+func LoadCAWithSigner(certPEM []byte, signer crypto.Signer) (*CA, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, fmt.Errorf("failed to decode CA certificate PEM")
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CA certificate: %w", err)
+	}
+
 	return &CA{
 		Certificate: cert,
-		PrivateKey:  privKey,
+		PrivateKey:  signer,
 		CertPEM:     certPEM,
-		KeyPEM:      keyPEM,
 	}, nil
 }
 
-// InitIntermediateCA creates an intermediate CA signed by the root CA
+// InitIntermediateCA creates an intermediate CA, signed by the root CA, with
+// an in-memory ECDSA P-256 key pair.
 func (ca *CA) InitIntermediateCA(cfg *IntermediateCAConfig) (*IntermediateCA, error) {
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generating intermediate CA key pair: %w", err)
+	}
+	return ca.InitIntermediateCAWithSigner(cfg, privKey)
+}
+
+// InitIntermediateCAWithSigner creates an intermediate CA, signed by the
+// root CA, whose own key is signer instead of a freshly generated in-memory
+// key - used for hardware-backed intermediates (see OpenPKCS11Signer).
+// signer.Public() must be an *ecdsa.PublicKey.
+func (ca *CA) InitIntermediateCAWithSigner(cfg *IntermediateCAConfig, signer crypto.Signer) (*IntermediateCA, error) {
 	if cfg == nil {
 		cfg = DefaultIntermediateCAConfig()
 	}
 
-	// Generate ECDSA P-256 key pair for the intermediate
-	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		return nil, fmt.Errorf("generating intermediate CA key pair: %w", err)
+	pubKey, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("intermediate CA signer must be ECDSA, got %T", signer.Public())
 	}
-	pubKey := &privKey.PublicKey
 
 	// Generate serial number
 	serialNumber, err := generateSerialNumber()
@@ -212,7 +273,9 @@ func (ca *CA) InitIntermediateCA(cfg *IntermediateCAConfig) (*IntermediateCA, er
 	}
 
 	// Sign with root CA
+	start := time.Now()
 	certDER, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, pubKey, ca.PrivateKey)
+	ca.LastSignLatency = time.Since(start)
 	if err != nil {
 		return nil, fmt.Errorf("creating intermediate CA certificate: %w", err)
 	}
@@ -228,7 +291,7 @@ func (ca *CA) InitIntermediateCA(cfg *IntermediateCAConfig) (*IntermediateCA, er
 		Bytes: certDER,
 	})
 
-	keyPEM, err := marshalECPrivateKey(privKey)
+	keyPEM, err := marshalSignerIfLocal(signer)
 	if err != nil {
 		return nil, fmt.Errorf("encoding intermediate CA private key: %w", err)
 	}
@@ -237,18 +300,40 @@ func (ca *CA) InitIntermediateCA(cfg *IntermediateCAConfig) (*IntermediateCA, er
 	chainPEM := append(certPEM, ca.CertPEM...)
 
 	return &IntermediateCA{
-		Certificate: cert,
-		PrivateKey:  privKey,
-		CertPEM:     certPEM,
-		KeyPEM:      keyPEM,
-		ChainPEM:    chainPEM,
-		RootCertPEM: ca.CertPEM,
+		Certificate:     cert,
+		PrivateKey:      signer,
+		CertPEM:         certPEM,
+		KeyPEM:          keyPEM,
+		ChainPEM:        chainPEM,
+		RootCertPEM:     ca.CertPEM,
+		LastSignLatency: ca.LastSignLatency,
 	}, nil
 }
 
 // LoadIntermediateCA loads an intermediate CA from PEM-encoded certificate, key, and root cert
 func LoadIntermediateCA(certPEM, keyPEM, rootCertPEM []byte) (*IntermediateCA, error) {
-	// Parse certificate
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, fmt.Errorf("failed to decode intermediate CA private key PEM")
+	}
+
+	privKey, err := parseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing intermediate CA private key: %w", err)
+	}
+
+	ica, err := LoadIntermediateCAWithSigner(certPEM, rootCertPEM, privKey)
+	if err != nil {
+		return nil, err
+	}
+	ica.KeyPEM = keyPEM
+	return ica, nil
+}
+
+// LoadIntermediateCAWithSigner loads an intermediate CA from a PEM-encoded
+// certificate and root cert, paired with a signer that already holds the
+// matching private key. See LoadCAWithSigner.
+func LoadIntermediateCAWithSigner(certPEM, rootCertPEM []byte, signer crypto.Signer) (*IntermediateCA, error) {
 	certBlock, _ := pem.Decode(certPEM)
 	if certBlock == nil {
 		return nil, fmt.Errorf("failed to decode intermediate CA certificate PEM")
@@ -259,30 +344,17 @@ func LoadIntermediateCA(certPEM, keyPEM, rootCertPEM []byte) (*IntermediateCA, e
 		return nil, fmt.Errorf("parsing intermediate CA certificate: %w", err)
 	}
 
-	// Verify it's a CA
 	if !cert.IsCA {
 		return nil, fmt.Errorf("certificate is not a CA")
 	}
 
-	// Parse private key
-	keyBlock, _ := pem.Decode(keyPEM)
-	if keyBlock == nil {
-		return nil, fmt.Errorf("failed to decode intermediate CA private key PEM")
-	}
-
-	privKey, err := parseECPrivateKey(keyBlock.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("parsing intermediate CA private key: %w", err)
-	}
-
 	// Build chain: intermediate + root
 	chainPEM := append(certPEM, rootCertPEM...)
 
 	return &IntermediateCA{
 		Certificate: cert,
-		PrivateKey:  privKey,
+		PrivateKey:  signer,
 		CertPEM:     certPEM,
-		KeyPEM:      keyPEM,
 		ChainPEM:    chainPEM,
 		RootCertPEM: rootCertPEM,
 	}, nil
@@ -320,6 +392,12 @@ type CertInstallSpec struct {
 	Group       string `json:"group,omitempty"`       // File group (default: root)
 	CertMode    string `json:"certMode,omitempty"`    // Cert permissions (default: 0644)
 	KeyMode     string `json:"keyMode,omitempty"`     // Key permissions (default: 0600)
+
+	// ReloadUnits lists systemd units to reload (not restart) on the host
+	// after this certificate changes on disk, e.g. ["nginx"]. Deploy only
+	// reloads a unit when the cert content it just wrote actually differs
+	// from what was already there.
+	ReloadUnits []string `json:"reloadUnits,omitempty"`
 }
 
 // DefaultCertInstallSpec returns default install spec for a certificate
@@ -349,15 +427,34 @@ func (s *CertInstallSpec) FullKeyPath() string {
 	return s.InstallPath + "/" + s.KeyFile
 }
 
-// IssueCert issues a new certificate for a host
+// IssueCert issues a new certificate for a host, generating a fresh ECDSA
+// P-256 key pair for it.
 func (ca *CA) IssueCert(req *CertRequest) (*IssuedCert, error) {
-	// Generate ECDSA P-256 key pair for the host
 	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
 		return nil, fmt.Errorf("generating host key pair: %w", err)
 	}
-	pubKey := &privKey.PublicKey
 
+	cert, err := ca.IssueCertForKey(req, &privKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := marshalECPrivateKey(privKey)
+	if err != nil {
+		return nil, fmt.Errorf("encoding host private key: %w", err)
+	}
+	cert.KeyPEM = keyPEM
+
+	return cert, nil
+}
+
+// IssueCertForKey issues a new certificate for pubKey instead of generating
+// a key pair, so a renewal can keep serving the same key - DANE/TLSA
+// records and appliances that pin or re-upload the key on every change
+// break otherwise. The returned IssuedCert has no KeyPEM; the caller
+// already holds the matching private key and is responsible for it.
+func (ca *CA) IssueCertForKey(req *CertRequest, pubKey *ecdsa.PublicKey) (*IssuedCert, error) {
 	// Generate serial number
 	serialNumber, err := generateSerialNumber()
 	if err != nil {
@@ -369,6 +466,9 @@ func (ca *CA) IssueCert(req *CertRequest) (*IssuedCert, error) {
 	if validity == 0 {
 		validity = 365 * 24 * time.Hour // Default 1 year
 	}
+	if ca.MaxCertValidity > 0 && validity > ca.MaxCertValidity {
+		return nil, fmt.Errorf("requested validity %s exceeds policy maximum %s for this CA", validity, ca.MaxCertValidity)
+	}
 
 	// Parse SANs into DNS names and IP addresses
 	var dnsNames []string
@@ -402,7 +502,9 @@ func (ca *CA) IssueCert(req *CertRequest) (*IssuedCert, error) {
 	}
 
 	// Sign with CA
+	start := time.Now()
 	certDER, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, pubKey, ca.PrivateKey)
+	ca.LastSignLatency = time.Since(start)
 	if err != nil {
 		return nil, fmt.Errorf("signing host certificate: %w", err)
 	}
@@ -413,11 +515,6 @@ func (ca *CA) IssueCert(req *CertRequest) (*IssuedCert, error) {
 		Bytes: certDER,
 	})
 
-	keyPEM, err := marshalECPrivateKey(privKey)
-	if err != nil {
-		return nil, fmt.Errorf("encoding host private key: %w", err)
-	}
-
 	// Compute thumbprint
 	thumbprint := computeThumbprint(certDER)
 
@@ -429,7 +526,6 @@ func (ca *CA) IssueCert(req *CertRequest) (*IssuedCert, error) {
 
 	return &IssuedCert{
 		CertPEM:    certPEM,
-		KeyPEM:     keyPEM,
 		Hostname:   req.Hostname,
 		Name:       certName,
 		Serial:     serialNumber.String(),
@@ -440,6 +536,17 @@ func (ca *CA) IssueCert(req *CertRequest) (*IssuedCert, error) {
 	}, nil
 }
 
+// IssueCertForCSR issues a certificate for a previously-submitted CSR,
+// reusing the key the requester already holds instead of generating one -
+// see CertIntakeRequest.
+func (ca *CA) IssueCertForCSR(csr *x509.CertificateRequest, req *CertRequest) (*IssuedCert, error) {
+	pubKey, ok := csr.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("certificate request key must be ECDSA, got %T", csr.PublicKey)
+	}
+	return ca.IssueCertForKey(req, pubKey)
+}
+
 // Verify checks if a certificate is valid and signed by this CA
 func (ca *CA) Verify(certPEM []byte) error {
 	certBlock, _ := pem.Decode(certPEM)
@@ -471,13 +578,29 @@ func (ca *CA) Verify(certPEM []byte) error {
 // IssueCert issues a new certificate for a host, signed by the intermediate CA
 // The returned certificate includes the full chain (cert + intermediate + root)
 func (ica *IntermediateCA) IssueCert(req *CertRequest) (*IssuedCert, error) {
-	// Generate ECDSA P-256 key pair for the host
 	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
 		return nil, fmt.Errorf("generating host key pair: %w", err)
 	}
-	pubKey := &privKey.PublicKey
 
+	cert, err := ica.IssueCertForKey(req, &privKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := marshalECPrivateKey(privKey)
+	if err != nil {
+		return nil, fmt.Errorf("encoding host private key: %w", err)
+	}
+	cert.KeyPEM = keyPEM
+
+	return cert, nil
+}
+
+// IssueCertForKey issues a new certificate for pubKey instead of generating
+// a key pair - see CA.IssueCertForKey. The returned IssuedCert has no
+// KeyPEM.
+func (ica *IntermediateCA) IssueCertForKey(req *CertRequest, pubKey *ecdsa.PublicKey) (*IssuedCert, error) {
 	// Generate serial number
 	serialNumber, err := generateSerialNumber()
 	if err != nil {
@@ -489,6 +612,9 @@ func (ica *IntermediateCA) IssueCert(req *CertRequest) (*IssuedCert, error) {
 	if validity == 0 {
 		validity = 365 * 24 * time.Hour // Default 1 year
 	}
+	if ica.MaxCertValidity > 0 && validity > ica.MaxCertValidity {
+		return nil, fmt.Errorf("requested validity %s exceeds policy maximum %s for this CA", validity, ica.MaxCertValidity)
+	}
 
 	// Ensure cert doesn't outlive intermediate
 	if now.Add(validity).After(ica.Certificate.NotAfter) {
@@ -530,7 +656,9 @@ func (ica *IntermediateCA) IssueCert(req *CertRequest) (*IssuedCert, error) {
 	}
 
 	// Sign with intermediate CA
+	start := time.Now()
 	certDER, err := x509.CreateCertificate(rand.Reader, template, ica.Certificate, pubKey, ica.PrivateKey)
+	ica.LastSignLatency = time.Since(start)
 	if err != nil {
 		return nil, fmt.Errorf("signing host certificate: %w", err)
 	}
@@ -541,11 +669,6 @@ func (ica *IntermediateCA) IssueCert(req *CertRequest) (*IssuedCert, error) {
 		Bytes: certDER,
 	})
 
-	keyPEM, err := marshalECPrivateKey(privKey)
-	if err != nil {
-		return nil, fmt.Errorf("encoding host private key: %w", err)
-	}
-
 	// Build full chain: cert + intermediate + root
 	chainPEM := append(certPEM, ica.ChainPEM...)
 
@@ -560,7 +683,6 @@ func (ica *IntermediateCA) IssueCert(req *CertRequest) (*IssuedCert, error) {
 
 	return &IssuedCert{
 		CertPEM:    certPEM,
-		KeyPEM:     keyPEM,
 		ChainPEM:   chainPEM,
 		Hostname:   req.Hostname,
 		Name:       certName,
@@ -572,6 +694,16 @@ func (ica *IntermediateCA) IssueCert(req *CertRequest) (*IssuedCert, error) {
 	}, nil
 }
 
+// IssueCertForCSR issues a certificate for a previously-submitted CSR,
+// reusing the key the requester already holds - see CA.IssueCertForCSR.
+func (ica *IntermediateCA) IssueCertForCSR(csr *x509.CertificateRequest, req *CertRequest) (*IssuedCert, error) {
+	pubKey, ok := csr.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("certificate request key must be ECDSA, got %T", csr.PublicKey)
+	}
+	return ica.IssueCertForKey(req, pubKey)
+}
+
 // Verify checks if a certificate is valid and signed by this intermediate CA chain
 func (ica *IntermediateCA) Verify(certPEM []byte) error {
 	certBlock, _ := pem.Decode(certPEM)
@@ -642,6 +774,17 @@ func marshalECPrivateKey(key *ecdsa.PrivateKey) ([]byte, error) {
 	}), nil
 }
 
+// marshalSignerIfLocal PEM-encodes signer's private key when it's an
+// in-memory *ecdsa.PrivateKey, or returns nil for a hardware-backed signer
+// (e.g. from OpenPKCS11Signer), whose key material never leaves the token.
+func marshalSignerIfLocal(signer crypto.Signer) ([]byte, error) {
+	privKey, ok := signer.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, nil
+	}
+	return marshalECPrivateKey(privKey)
+}
+
 func parseECPrivateKey(der []byte) (*ecdsa.PrivateKey, error) {
 	key, err := x509.ParsePKCS8PrivateKey(der)
 	if err != nil {
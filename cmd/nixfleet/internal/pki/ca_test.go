@@ -1,6 +1,7 @@
 package pki
 
 import (
+	"encoding/pem"
 	"testing"
 	"time"
 )
@@ -91,6 +92,76 @@ func TestIssueCert(t *testing.T) {
 	}
 }
 
+func TestIssueCertMaxValidityPolicy(t *testing.T) {
+	caCfg := &CAConfig{
+		CommonName:   "Test CA",
+		Organization: "Test Org",
+		Validity:     365 * 24 * time.Hour,
+	}
+
+	ca, err := InitCA(caCfg)
+	if err != nil {
+		t.Fatalf("InitCA failed: %v", err)
+	}
+	ca.MaxCertValidity = 90 * 24 * time.Hour
+
+	if _, err := ca.IssueCert(&CertRequest{Hostname: "test-host", Validity: 180 * 24 * time.Hour}); err == nil {
+		t.Error("expected IssueCert to refuse a validity exceeding the policy maximum")
+	}
+
+	cert, err := ca.IssueCert(&CertRequest{Hostname: "test-host", Validity: 30 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("IssueCert failed for a validity within policy: %v", err)
+	}
+	if cert.Hostname != "test-host" {
+		t.Errorf("Expected hostname 'test-host', got '%s'", cert.Hostname)
+	}
+}
+
+func TestIssueCertForKey(t *testing.T) {
+	caCfg := &CAConfig{
+		CommonName:   "Test CA",
+		Organization: "Test Org",
+		Validity:     365 * 24 * time.Hour,
+	}
+	ca, err := InitCA(caCfg)
+	if err != nil {
+		t.Fatalf("InitCA failed: %v", err)
+	}
+
+	first, err := ca.IssueCert(&CertRequest{Hostname: "test-host", Validity: 30 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("IssueCert failed: %v", err)
+	}
+	if len(first.KeyPEM) == 0 {
+		t.Fatal("IssueCert should generate a key")
+	}
+
+	keyBlock, _ := pem.Decode(first.KeyPEM)
+	if keyBlock == nil {
+		t.Fatal("decoding issued key PEM failed")
+	}
+	privKey, err := parseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		t.Fatalf("parsing issued key: %v", err)
+	}
+
+	second, err := ca.IssueCertForKey(&CertRequest{Hostname: "test-host", Validity: 30 * 24 * time.Hour}, &privKey.PublicKey)
+	if err != nil {
+		t.Fatalf("IssueCertForKey failed: %v", err)
+	}
+	if len(second.KeyPEM) != 0 {
+		t.Error("IssueCertForKey should not generate or return a key")
+	}
+	if second.Serial == first.Serial {
+		t.Error("IssueCertForKey should issue a distinct serial from the original cert")
+	}
+
+	if err := ca.Verify(second.CertPEM); err != nil {
+		t.Errorf("Verify failed for reissued cert: %v", err)
+	}
+}
+
 func TestVerifyCert(t *testing.T) {
 	// Create CA
 	caCfg := &CAConfig{
@@ -180,4 +251,7 @@ func TestParseCertInfo(t *testing.T) {
 	if info.DaysLeft < 364 || info.DaysLeft > 366 {
 		t.Errorf("Expected ~365 days left, got %d", info.DaysLeft)
 	}
+	if info.Algorithm != "ECDSA" {
+		t.Errorf("Expected algorithm 'ECDSA', got '%s'", info.Algorithm)
+	}
 }
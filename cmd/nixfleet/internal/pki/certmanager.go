@@ -2,6 +2,7 @@ package pki
 
 import (
 	"context"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
@@ -9,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 )
@@ -19,6 +21,23 @@ type CertManagerConfig struct {
 	TLSCertFile     string        // TLS certificate for webhook server
 	TLSKeyFile      string        // TLS key for webhook server
 	DefaultValidity time.Duration // Default certificate validity
+
+	// ClientCAFile, if set, requires and verifies a client certificate on
+	// every connection (mTLS), for the on-host renewal agent path. The
+	// CSR's identity is then checked against the client cert's CommonName
+	// via checkAgentPolicy before signing.
+	ClientCAFile string
+
+	// AuditLogPath, if set, records every signing decision (allowed or
+	// denied) as a JSON line. See AuditLogger.
+	AuditLogPath string
+
+	// AllowReissue permits signing a CSR for a hostname that has a
+	// revocation on record, as long as it hasn't since been reissued a
+	// fresh certificate. Without it, checkNotRevoked refuses such CSRs
+	// outright - a compromised host shouldn't be able to get a new
+	// certificate through cert-manager just by asking again.
+	AllowReissue bool
 }
 
 // DefaultCertManagerConfig returns default configuration
@@ -32,18 +51,28 @@ func DefaultCertManagerConfig() *CertManagerConfig {
 // CertManagerWebhook handles cert-manager signing requests
 type CertManagerWebhook struct {
 	ca     *CA
+	store  *Store
 	config *CertManagerConfig
+	audit  *AuditLogger
 }
 
-// NewCertManagerWebhook creates a new webhook handler
-func NewCertManagerWebhook(ca *CA, config *CertManagerConfig) *CertManagerWebhook {
+// NewCertManagerWebhook creates a new webhook handler. store is used to
+// enforce the on-host agent renewal policy (checkAgentPolicy) and to mark
+// certificates as agent-managed; it may be nil if the webhook is only ever
+// used for the unauthenticated cert-manager flow.
+func NewCertManagerWebhook(ca *CA, store *Store, config *CertManagerConfig) *CertManagerWebhook {
 	if config == nil {
 		config = DefaultCertManagerConfig()
 	}
-	return &CertManagerWebhook{
+	w := &CertManagerWebhook{
 		ca:     ca,
+		store:  store,
 		config: config,
 	}
+	if config.AuditLogPath != "" {
+		w.audit = NewAuditLogger(config.AuditLogPath)
+	}
+	return w
 }
 
 // CertManagerSignRequest represents a signing request from cert-manager
@@ -73,8 +102,12 @@ type CertManagerSignResponse struct {
 	} `json:"status"`
 }
 
-// SignCSR signs a Certificate Signing Request
-func (w *CertManagerWebhook) SignCSR(csrPEM []byte, validity time.Duration) ([]byte, error) {
+// SignCSR signs a Certificate Signing Request. identity is the CommonName
+// of the authenticated mTLS client cert, or "" for the unauthenticated
+// cert-manager flow; when non-empty, the CSR must pass checkAgentPolicy
+// before it's signed, and the resulting certificate is marked
+// agent-managed in the store.
+func (w *CertManagerWebhook) SignCSR(csrPEM []byte, validity time.Duration, identity string) ([]byte, error) {
 	// Decode CSR
 	block, _ := pem.Decode(csrPEM)
 	if block == nil {
@@ -97,6 +130,22 @@ func (w *CertManagerWebhook) SignCSR(csrPEM []byte, validity time.Duration) ([]b
 		sans = append(sans, ip.String())
 	}
 
+	if w.store != nil {
+		if err := w.checkNotRevoked(csr.Subject.CommonName); err != nil {
+			if identity != "" {
+				w.logAudit(identity, csr.Subject.CommonName, sans, false, err.Error(), "")
+			}
+			return nil, err
+		}
+	}
+
+	if identity != "" {
+		if err := w.checkAgentPolicy(identity, csr.Subject.CommonName, sans); err != nil {
+			w.logAudit(identity, csr.Subject.CommonName, sans, false, err.Error(), "")
+			return nil, err
+		}
+	}
+
 	// Issue certificate using our CA
 	req := &CertRequest{
 		Hostname: csr.Subject.CommonName,
@@ -106,12 +155,107 @@ func (w *CertManagerWebhook) SignCSR(csrPEM []byte, validity time.Duration) ([]b
 
 	cert, err := w.ca.IssueCert(req)
 	if err != nil {
+		if identity != "" {
+			w.logAudit(identity, csr.Subject.CommonName, sans, false, err.Error(), "")
+		}
 		return nil, fmt.Errorf("issuing certificate: %w", err)
 	}
 
+	if identity != "" {
+		w.logAudit(identity, csr.Subject.CommonName, sans, true, "", cert.Serial)
+		if w.store != nil {
+			if err := w.store.SetAgentManaged(cert.Hostname, cert.Name); err != nil {
+				return nil, fmt.Errorf("marking certificate agent-managed: %w", err)
+			}
+		}
+	}
+
 	return cert.CertPEM, nil
 }
 
+// checkAgentPolicy enforces that an on-host agent, authenticated as
+// identity via its current mTLS client cert, may only request a renewal of
+// its own certificate: the CSR's CommonName must equal identity, and every
+// SAN it asks for must already be on the certificate on file for identity.
+// This is what "bound to the client cert identity" means in practice - the
+// agent can't use its cert to mint a certificate for some other host.
+func (w *CertManagerWebhook) checkAgentPolicy(identity, requestedCN string, requestedSANs []string) error {
+	if requestedCN != identity {
+		return fmt.Errorf("CSR CommonName %q does not match client identity %q", requestedCN, identity)
+	}
+	if w.store == nil {
+		return fmt.Errorf("no policy store configured, refusing agent-authenticated request")
+	}
+
+	existing, err := w.store.GetCertInfo(identity)
+	if err != nil {
+		return fmt.Errorf("no certificate on file for %q to renew: %w", identity, err)
+	}
+
+	allowed := make(map[string]bool, len(existing.SANs))
+	for _, san := range existing.SANs {
+		allowed[san] = true
+	}
+	for _, san := range requestedSANs {
+		if !allowed[san] {
+			return fmt.Errorf("CSR requests SAN %q, which %q is not authorized for", san, identity)
+		}
+	}
+
+	return nil
+}
+
+// checkNotRevoked refuses to sign a CSR for hostname if it has a
+// revocation on record and hasn't since been reissued: "reissued" means
+// the store's current certificate on file for hostname is not itself one
+// of the revoked serials, i.e. something has already replaced the revoked
+// certificate. AllowReissue bypasses this check entirely.
+func (w *CertManagerWebhook) checkNotRevoked(hostname string) error {
+	list, err := w.store.LoadRevocationList()
+	if err != nil {
+		return fmt.Errorf("loading revocation list: %w", err)
+	}
+	if len(list.RevokedForHost(hostname)) == 0 {
+		return nil
+	}
+
+	if w.store.HostCertExists(hostname) {
+		if info, err := w.store.GetCertInfo(hostname); err == nil {
+			if _, stillRevoked := list.IsRevoked(info.Serial); !stillRevoked {
+				return nil
+			}
+		}
+	}
+
+	if w.config.AllowReissue {
+		return nil
+	}
+	return fmt.Errorf("hostname %q was revoked and has not been reissued (pass --allow-reissue to override)", hostname)
+}
+
+func (w *CertManagerWebhook) logAudit(identity, hostname string, sans []string, allowedResult bool, reason, serial string) {
+	if w.audit == nil {
+		return
+	}
+	_ = w.audit.Log(AuditEntry{
+		Identity: identity,
+		Hostname: hostname,
+		SANs:     sans,
+		Allowed:  allowedResult,
+		Reason:   reason,
+		Serial:   serial,
+	})
+}
+
+// peerIdentity returns the CommonName of the request's verified mTLS client
+// certificate, or "" if the connection isn't using client certs.
+func peerIdentity(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return r.TLS.PeerCertificates[0].Subject.CommonName
+}
+
 // ServeHTTP handles webhook requests
 func (w *CertManagerWebhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -147,7 +291,7 @@ func (w *CertManagerWebhook) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 	}
 
 	// Sign the CSR
-	certPEM, err := w.SignCSR(csrPEM, validity)
+	certPEM, err := w.SignCSR(csrPEM, validity, peerIdentity(r))
 	if err != nil {
 		w.sendError(rw, "failed to sign CSR", err)
 		return
@@ -429,6 +573,21 @@ func (w *CertManagerWebhook) StartServer(ctx context.Context) error {
 		Handler: mux,
 	}
 
+	if w.config.ClientCAFile != "" {
+		caPEM, err := os.ReadFile(w.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("reading client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("no certificates found in client CA file %s", w.config.ClientCAFile)
+		}
+		server.TLSConfig = &tls.Config{
+			ClientCAs:  pool,
+			ClientAuth: tls.RequireAndVerifyClientCert,
+		}
+	}
+
 	// Graceful shutdown
 	go func() {
 		<-ctx.Done()
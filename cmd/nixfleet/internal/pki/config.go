@@ -30,6 +30,28 @@ type PKIConfig struct {
 
 	// Host certificate definitions
 	Hosts map[string]*HostConfig `yaml:"hosts,omitempty"`
+
+	// Shared certificate definitions, keyed by shared cert name.
+	// Shared certs are issued once and deployed to every host in DeployTo.
+	Shared map[string]*SharedCertConfig `yaml:"shared,omitempty"`
+}
+
+// SharedCertConfig defines a certificate that is issued once and deployed
+// to multiple hosts (e.g. a wildcard cert for a group of ingress hosts).
+type SharedCertConfig struct {
+	SANs     []string `yaml:"sans,omitempty"`
+	Validity string   `yaml:"validity,omitempty"`
+
+	// ReuseKey, if true, has `pki renew` reissue this certificate for its
+	// existing key instead of generating a new one. See CertConfig.ReuseKey.
+	ReuseKey bool `yaml:"reuseKey,omitempty"`
+
+	// DeployTo lists the host names that should receive this certificate.
+	DeployTo []string `yaml:"deployTo,omitempty"`
+
+	// ReloadUnits lists systemd units to reload on each DeployTo host after
+	// this certificate is deployed and its content has changed.
+	ReloadUnits []string `yaml:"reloadUnits,omitempty"`
 }
 
 // RootCAConfig configures the root CA
@@ -50,6 +72,11 @@ type IntermediateCAYAMLConfig struct {
 type CertDefaults struct {
 	Validity     string `yaml:"validity,omitempty"` // e.g., "90d", "1y"
 	Organization string `yaml:"organization,omitempty"`
+
+	// MaxValidity, if set, caps the validity any issued or renewed
+	// certificate may request (e.g. "1y"). Requests for a longer validity
+	// are refused rather than silently clamped. Empty means no policy limit.
+	MaxValidity string `yaml:"maxValidity,omitempty"`
 }
 
 // HostConfig defines certificates for a specific host
@@ -57,14 +84,31 @@ type HostConfig struct {
 	// SANs to include in all certificates for this host
 	SANs []string `yaml:"sans,omitempty"`
 
+	// ReuseKey, if true, applies reuseKey to this host's default ("host")
+	// certificate. See CertConfig.ReuseKey for named certificates.
+	ReuseKey bool `yaml:"reuseKey,omitempty"`
+
 	// Named certificates for this host
 	Certificates map[string]*CertConfig `yaml:"certificates,omitempty"`
+
+	// ReloadUnits lists systemd units to reload on this host after its
+	// "host" certificate is deployed and its content has changed. There is
+	// no equivalent for named certificates - 'pki deploy' only deploys a
+	// host's default "host" certificate, not its named ones.
+	ReloadUnits []string `yaml:"reloadUnits,omitempty"`
 }
 
 // CertConfig defines a single certificate
 type CertConfig struct {
 	SANs     []string `yaml:"sans,omitempty"`
 	Validity string   `yaml:"validity,omitempty"`
+
+	// ReuseKey, if true, has `pki renew` reissue this certificate for its
+	// existing key instead of generating a new one (see
+	// Deployer.RenewCert), for DANE/TLSA pinning and appliances that must
+	// be re-provisioned whenever the key changes. A `--reuse-key`/
+	// `--no-reuse-key` flag on the CLI overrides this per invocation.
+	ReuseKey bool `yaml:"reuseKey,omitempty"`
 }
 
 // LoadPKIConfig loads PKI configuration from a YAML file
@@ -164,6 +208,15 @@ func (c *PKIConfig) GetDefaultValidity() (time.Duration, error) {
 	return ParseValidityDuration(c.Defaults.Validity)
 }
 
+// GetMaxValidity returns the configured maximum certificate validity, or
+// zero if no maximum is configured.
+func (c *PKIConfig) GetMaxValidity() (time.Duration, error) {
+	if c.Defaults.MaxValidity == "" {
+		return 0, nil
+	}
+	return ParseValidityDuration(c.Defaults.MaxValidity)
+}
+
 // GetHostCertRequest creates a CertRequest for a host's named certificate
 func (c *PKIConfig) GetHostCertRequest(hostname, certName string) (*CertRequest, error) {
 	validity, err := c.GetDefaultValidity()
@@ -199,6 +252,73 @@ func (c *PKIConfig) GetHostCertRequest(hostname, certName string) (*CertRequest,
 	return req, nil
 }
 
+// GetHostCertReuseKey reports whether hostname's named certificate is
+// configured with reuseKey: true.
+func (c *PKIConfig) GetHostCertReuseKey(hostname, certName string) bool {
+	host, ok := c.Hosts[hostname]
+	if !ok {
+		return false
+	}
+	if certName == "" || certName == "host" {
+		return host.ReuseKey
+	}
+	cert, ok := host.Certificates[certName]
+	return ok && cert.ReuseKey
+}
+
+// GetSharedCertReuseKey reports whether the shared certificate name is
+// configured with reuseKey: true.
+func (c *PKIConfig) GetSharedCertReuseKey(name string) bool {
+	shared, ok := c.Shared[name]
+	return ok && shared.ReuseKey
+}
+
+// GetHostReloadUnits returns the systemd units configured to reload after
+// hostname's "host" certificate changes.
+func (c *PKIConfig) GetHostReloadUnits(hostname string) []string {
+	host, ok := c.Hosts[hostname]
+	if !ok {
+		return nil
+	}
+	return host.ReloadUnits
+}
+
+// GetSharedReloadUnits returns the systemd units configured to reload on
+// each of a shared certificate's DeployTo hosts after it changes.
+func (c *PKIConfig) GetSharedReloadUnits(name string) []string {
+	shared, ok := c.Shared[name]
+	if !ok {
+		return nil
+	}
+	return shared.ReloadUnits
+}
+
+// GetSharedCertRequest creates a CertRequest for a shared certificate
+func (c *PKIConfig) GetSharedCertRequest(name string) (*CertRequest, error) {
+	shared, ok := c.Shared[name]
+	if !ok {
+		return nil, fmt.Errorf("shared certificate %q not defined in config", name)
+	}
+
+	validity, err := c.GetDefaultValidity()
+	if err != nil {
+		return nil, err
+	}
+	if shared.Validity != "" {
+		validity, err = ParseValidityDuration(shared.Validity)
+		if err != nil {
+			return nil, fmt.Errorf("parsing shared certificate validity: %w", err)
+		}
+	}
+
+	return &CertRequest{
+		Hostname: name,
+		Name:     name,
+		SANs:     shared.SANs,
+		Validity: validity,
+	}, nil
+}
+
 // Validate checks the configuration for errors
 func (c *PKIConfig) Validate() error {
 	if len(c.Recipients) == 0 {
@@ -227,5 +347,11 @@ func (c *PKIConfig) Validate() error {
 		return fmt.Errorf("invalid default certificate validity: %w", err)
 	}
 
+	if c.Defaults.MaxValidity != "" {
+		if _, err := ParseValidityDuration(c.Defaults.MaxValidity); err != nil {
+			return fmt.Errorf("invalid max certificate validity: %w", err)
+		}
+	}
+
 	return nil
 }
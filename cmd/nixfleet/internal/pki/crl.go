@@ -0,0 +1,230 @@
+package pki
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Revocation reasons 'pki revoke --reason' accepts. These are the handful
+// of RFC 5280 CRL reason codes an operator would actually pick between by
+// hand; anything else is rejected rather than silently stored as
+// unspecified.
+const (
+	ReasonUnspecified          = "unspecified"
+	ReasonKeyCompromise        = "key-compromise"
+	ReasonSuperseded           = "superseded"
+	ReasonCessationOfOperation = "cessation-of-operation"
+)
+
+// crlReasonCodes maps the reasons above to their RFC 5280 5.3.1 CRLReason
+// values for GenerateCRL's revocation entries.
+var crlReasonCodes = map[string]int{
+	ReasonUnspecified:          0,
+	ReasonKeyCompromise:        1,
+	ReasonSuperseded:           4,
+	ReasonCessationOfOperation: 5,
+}
+
+// RevokedCert is one entry in the store's revocation list.
+type RevokedCert struct {
+	Serial    string    `json:"serial"`
+	Hostname  string    `json:"hostname,omitempty"`
+	RevokedAt time.Time `json:"revokedAt"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// RevocationList is the on-disk shape of crl/revoked.json: every
+// certificate 'pki revoke' has recorded as revoked. Entries stay here even
+// after 'pki crl generate' has published them, so the history survives
+// across CRL regenerations.
+type RevocationList struct {
+	Entries []RevokedCert `json:"entries,omitempty"`
+}
+
+// IsRevoked reports whether serial appears in the list, and its entry if so.
+func (l *RevocationList) IsRevoked(serial string) (*RevokedCert, bool) {
+	for i := range l.Entries {
+		if l.Entries[i].Serial == serial {
+			return &l.Entries[i], true
+		}
+	}
+	return nil, false
+}
+
+// RevokedForHost returns every entry recorded for hostname, most recent
+// revocation for a serial always overwriting rather than accumulating (see
+// Add), but a host can accumulate multiple entries across separate
+// issue/revoke cycles for different serials.
+func (l *RevocationList) RevokedForHost(hostname string) []RevokedCert {
+	var out []RevokedCert
+	for _, e := range l.Entries {
+		if e.Hostname == hostname {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Add records entry, replacing any existing entry for the same serial so a
+// second revocation of an already-revoked certificate updates the reason
+// and time rather than creating a duplicate row.
+func (l *RevocationList) Add(entry RevokedCert) {
+	for i := range l.Entries {
+		if l.Entries[i].Serial == entry.Serial {
+			l.Entries[i] = entry
+			return
+		}
+	}
+	l.Entries = append(l.Entries, entry)
+}
+
+// crlDir returns the directory holding the revocation list and the
+// generated CRL.
+func (s *Store) crlDir() string {
+	return filepath.Join(s.baseDir, "crl")
+}
+
+// RevocationListPath returns where the revoked-serials list is stored.
+func (s *Store) RevocationListPath() string {
+	return filepath.Join(s.crlDir(), "revoked.json")
+}
+
+// GetCRLPath returns where 'pki crl generate' writes the signed CRL.
+func (s *Store) GetCRLPath() string {
+	return filepath.Join(s.crlDir(), "ca.crl")
+}
+
+// LoadRevocationList reads the store's revocation list. A missing file
+// isn't an error - it's treated as an empty list, so 'pki status' works
+// before anything has ever been revoked.
+func (s *Store) LoadRevocationList() (*RevocationList, error) {
+	data, err := os.ReadFile(s.RevocationListPath())
+	if os.IsNotExist(err) {
+		return &RevocationList{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading revocation list: %w", err)
+	}
+	var list RevocationList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parsing revocation list: %w", err)
+	}
+	return &list, nil
+}
+
+// SaveRevocationList writes list back to disk.
+func (s *Store) SaveRevocationList(list *RevocationList) error {
+	if err := os.MkdirAll(s.crlDir(), 0755); err != nil {
+		return fmt.Errorf("creating crl directory: %w", err)
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.RevocationListPath(), data, 0644); err != nil {
+		return fmt.Errorf("writing revocation list: %w", err)
+	}
+	return nil
+}
+
+// RevokeSerial records serial (belonging to hostname, if known) as revoked
+// for reason. It only updates the revocation list - run 'pki crl generate'
+// (then 'pki deploy') to actually publish the revocation to hosts.
+func (s *Store) RevokeSerial(serial, hostname, reason string) error {
+	list, err := s.LoadRevocationList()
+	if err != nil {
+		return err
+	}
+	list.Add(RevokedCert{
+		Serial:    serial,
+		Hostname:  hostname,
+		RevokedAt: time.Now(),
+		Reason:    reason,
+	})
+	return s.SaveRevocationList(list)
+}
+
+// GenerateCRL signs a standard X.509 CRL covering every serial in the
+// store's revocation list, using the intermediate CA if one exists
+// (matching how host certificates are issued) or the root CA otherwise.
+// validity controls how far out the CRL's NextUpdate is set.
+func (s *Store) GenerateCRL(ctx context.Context, validity time.Duration) ([]byte, error) {
+	list, err := s.LoadRevocationList()
+	if err != nil {
+		return nil, err
+	}
+
+	var issuer *x509.Certificate
+	var signer crypto.Signer
+	if s.IntermediateCAExists() {
+		ica, err := s.LoadIntermediateCA(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("loading intermediate CA: %w", err)
+		}
+		issuer, signer = ica.Certificate, ica.PrivateKey
+	} else {
+		ca, err := s.LoadCA(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("loading CA: %w", err)
+		}
+		issuer, signer = ca.Certificate, ca.PrivateKey
+	}
+
+	entries := make([]x509.RevocationListEntry, 0, len(list.Entries))
+	for _, e := range list.Entries {
+		serial, ok := new(big.Int).SetString(e.Serial, 10)
+		if !ok {
+			return nil, fmt.Errorf("revocation list entry %q: invalid serial", e.Serial)
+		}
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: e.RevokedAt,
+			ReasonCode:     crlReasonCodes[e.Reason],
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].SerialNumber.Cmp(entries[j].SerialNumber) < 0
+	})
+
+	now := time.Now()
+	template := &x509.RevocationList{
+		Number:                    big.NewInt(now.Unix()),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(validity),
+		RevokedCertificateEntries: entries,
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, template, issuer, signer)
+	if err != nil {
+		return nil, fmt.Errorf("creating CRL: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), nil
+}
+
+// SaveCRL writes the CRL PEM built by GenerateCRL to disk.
+func (s *Store) SaveCRL(crlPEM []byte) error {
+	if err := os.MkdirAll(s.crlDir(), 0755); err != nil {
+		return fmt.Errorf("creating crl directory: %w", err)
+	}
+	if err := os.WriteFile(s.GetCRLPath(), crlPEM, 0644); err != nil {
+		return fmt.Errorf("writing CRL: %w", err)
+	}
+	return nil
+}
+
+// CRLExists reports whether 'pki crl generate' has been run.
+func (s *Store) CRLExists() bool {
+	_, err := os.Stat(s.GetCRLPath())
+	return err == nil
+}
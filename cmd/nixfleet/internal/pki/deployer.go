@@ -3,8 +3,10 @@ package pki
 import (
 	"context"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/nixfleet/nixfleet/internal/inventory"
@@ -18,6 +20,22 @@ type DeployConfig struct {
 	Identities  []string // Age identity files for decryption
 	TrustSystem bool     // Add CA to system trust store
 	CAOnly      bool     // Only deploy CA certificate
+
+	// MaxCertValidity, if set, is enforced on the CA used by RenewCert so
+	// renewals can't request a longer validity than fresh issuance would
+	// allow. Zero means no policy limit.
+	MaxCertValidity time.Duration
+
+	// ReloadUnits lists systemd units to reload (not restart) on every host
+	// after its certificate is deployed, in addition to any units named by
+	// a host or shared cert's own ReloadUnits. A unit is only reloaded when
+	// the certificate content just written actually changed.
+	ReloadUnits []string
+
+	// SkipReload disables reload-on-change entirely, e.g. for maintenance
+	// windows where an operator wants certs pushed without touching
+	// running services.
+	SkipReload bool
 }
 
 // DefaultDeployConfig returns default PKI deployment config
@@ -47,15 +65,28 @@ func NewDeployer(config *DeployConfig) *Deployer {
 
 // DeployResult contains the result of deploying PKI to a host
 type DeployResult struct {
-	Host         string
-	Success      bool
-	CADeployed   bool
-	CertDeployed bool
-	KeyDeployed  bool
-	TrustUpdated bool
-	CertRenewed  bool
-	Error        string
-	CertInfo     *CertInfo
+	Host           string
+	Success        bool
+	CADeployed     bool
+	CRLDeployed    bool
+	CertDeployed   bool
+	KeyDeployed    bool
+	CertChanged    bool
+	TrustUpdated   bool
+	CertRenewed    bool
+	BundleDeployed bool
+	BundleHash     string
+	Error          string
+	CertInfo       *CertInfo
+	ReloadResults  []ReloadResult
+}
+
+// ReloadResult is the outcome of reloading a single systemd unit after a
+// certificate change.
+type ReloadResult struct {
+	Unit    string
+	Success bool
+	Output  string
 }
 
 // IsEnabled checks if PKI is configured and ready for deployment
@@ -91,6 +122,21 @@ func (d *Deployer) Deploy(ctx context.Context, client *ssh.Client, host *invento
 	}
 	result.CADeployed = true
 
+	// Deploy the CRL alongside the CA cert, if one has been generated
+	if d.store.CRLExists() {
+		crlPEM, err := os.ReadFile(d.store.GetCRLPath())
+		if err != nil {
+			result.Error = fmt.Sprintf("warning: reading CRL: %v", err)
+		} else {
+			crlDest := d.config.DestDir + "/ca.crl"
+			if err := d.deployFileContent(ctx, client, crlPEM, crlDest, "0644"); err != nil {
+				result.Error = fmt.Sprintf("warning: deploying CRL: %v", err)
+			} else {
+				result.CRLDeployed = true
+			}
+		}
+	}
+
 	// Update system trust store if requested
 	if d.config.TrustSystem {
 		if err := d.updateSystemTrust(ctx, client, host.Base, caCertDest); err != nil {
@@ -131,11 +177,19 @@ func (d *Deployer) Deploy(ctx context.Context, client *ssh.Client, host *invento
 
 		// Deploy host certificate
 		hostCertDest := d.config.DestDir + "/host.crt"
+		changed := true
+		if !d.config.SkipReload {
+			changed, err = d.certContentChanged(ctx, client, hostCertDest, hostCert.CertPEM)
+			if err != nil {
+				changed = true
+			}
+		}
 		if err := d.deployFileContent(ctx, client, hostCert.CertPEM, hostCertDest, "0644"); err != nil {
 			result.Error = fmt.Sprintf("deploying host cert: %v", err)
 			return result
 		}
 		result.CertDeployed = true
+		result.CertChanged = changed
 
 		// Deploy host key (restricted permissions)
 		hostKeyDest := d.config.DestDir + "/host.key"
@@ -144,6 +198,37 @@ func (d *Deployer) Deploy(ctx context.Context, client *ssh.Client, host *invento
 			return result
 		}
 		result.KeyDeployed = true
+
+		if !d.config.SkipReload && changed && len(d.config.ReloadUnits) > 0 {
+			result.ReloadResults = d.reloadUnits(ctx, client, dedupeUnits(d.config.ReloadUnits))
+			for _, r := range result.ReloadResults {
+				if !r.Success {
+					result.Error = fmt.Sprintf("warning: reload of %s failed: %s", r.Unit, r.Output)
+				}
+			}
+		}
+	}
+
+	// Deploy the fleet-wide trust bundle, if one has been built
+	if d.store.BundleExists() {
+		bundle, err := os.ReadFile(d.store.GetBundlePath())
+		if err != nil {
+			result.Error = fmt.Sprintf("warning: reading trust bundle: %v", err)
+			result.Success = true
+			return result
+		}
+		manifest, err := d.store.LoadBundleManifest()
+		if err != nil {
+			result.Error = fmt.Sprintf("warning: loading trust bundle manifest: %v", err)
+			result.Success = true
+			return result
+		}
+		if err := d.DeployBundle(ctx, client, host, bundle, manifest); err != nil {
+			result.Error = fmt.Sprintf("warning: trust bundle deploy failed: %v", err)
+		} else {
+			result.BundleDeployed = true
+			result.BundleHash = manifest.Hash
+		}
 	}
 
 	result.Success = true
@@ -176,13 +261,20 @@ func (d *Deployer) CheckRenewalNeeded(ctx context.Context, daysThreshold int) ([
 	return needsRenewal, nil
 }
 
-// RenewCert renews a host certificate
-func (d *Deployer) RenewCert(ctx context.Context, hostname string, sans []string, validity time.Duration) (*IssuedCert, error) {
+// RenewCert renews a host certificate. If reuseKey is true, the existing
+// private key is loaded from the store and reissued under instead of
+// generating a new one - for DANE/TLSA pinning and appliances that must be
+// re-provisioned whenever the key changes - and only the cert (and chain)
+// on disk are updated; the key file is left untouched. It returns whether
+// the key was actually reused (false if reuseKey was requested but no
+// existing certificate was found to reuse a key from).
+func (d *Deployer) RenewCert(ctx context.Context, hostname string, sans []string, validity time.Duration, reuseKey bool) (*IssuedCert, bool, error) {
 	// Load CA
 	ca, err := d.store.LoadCA(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("loading CA: %w", err)
+		return nil, false, fmt.Errorf("loading CA: %w", err)
 	}
+	ca.MaxCertValidity = d.config.MaxCertValidity
 
 	// Get existing cert info to preserve SANs if not specified
 	if len(sans) == 0 {
@@ -192,24 +284,48 @@ func (d *Deployer) RenewCert(ctx context.Context, hostname string, sans []string
 		}
 	}
 
-	// Issue new certificate
 	req := &CertRequest{
 		Hostname: hostname,
 		SANs:     sans,
 		Validity: validity,
 	}
 
+	if reuseKey {
+		existing, err := d.store.LoadHostCert(ctx, hostname)
+		if err != nil {
+			return nil, false, fmt.Errorf("loading existing certificate to reuse its key: %w", err)
+		}
+		keyBlock, _ := pem.Decode(existing.KeyPEM)
+		if keyBlock == nil {
+			return nil, false, fmt.Errorf("decoding existing private key: failed to decode PEM")
+		}
+		existingKey, err := parseECPrivateKey(keyBlock.Bytes)
+		if err != nil {
+			return nil, false, fmt.Errorf("parsing existing private key: %w", err)
+		}
+
+		cert, err := ca.IssueCertForKey(req, &existingKey.PublicKey)
+		if err != nil {
+			return nil, false, fmt.Errorf("issuing certificate: %w", err)
+		}
+		cert.KeyPEM = existing.KeyPEM
+
+		if err := d.store.UpdateHostCert(cert); err != nil {
+			return nil, false, fmt.Errorf("saving certificate: %w", err)
+		}
+		return cert, true, nil
+	}
+
 	cert, err := ca.IssueCert(req)
 	if err != nil {
-		return nil, fmt.Errorf("issuing certificate: %w", err)
+		return nil, false, fmt.Errorf("issuing certificate: %w", err)
 	}
 
-	// Save new certificate
 	if err := d.store.SaveHostCert(cert); err != nil {
-		return nil, fmt.Errorf("saving certificate: %w", err)
+		return nil, false, fmt.Errorf("saving certificate: %w", err)
 	}
 
-	return cert, nil
+	return cert, false, nil
 }
 
 // RenewalInfo contains information about a certificate needing renewal
@@ -219,10 +335,17 @@ type RenewalInfo struct {
 	Reason   string
 }
 
-// RevokeCert marks a certificate as revoked (adds to CRL)
-func (d *Deployer) RevokeCert(ctx context.Context, hostname string) error {
-	// For now, we implement revocation by removing the certificate
-	// A full implementation would maintain a CRL
+// RevokeCert revokes a host certificate: records its serial in the store's
+// revocation list for reason (see Store.RevokeSerial), then removes the
+// certificate and key files. Run 'pki crl generate' and 'pki deploy'
+// afterward to publish the revocation to hosts.
+func (d *Deployer) RevokeCert(ctx context.Context, hostname, reason string) error {
+	if info, err := d.store.GetCertInfo(hostname); err == nil {
+		if err := d.store.RevokeSerial(info.Serial, hostname, reason); err != nil {
+			return fmt.Errorf("recording revocation: %w", err)
+		}
+	}
+
 	certPath := d.store.GetHostCertPath(hostname)
 	keyPath := d.store.GetHostKeyPath(hostname)
 
@@ -233,7 +356,91 @@ func (d *Deployer) RevokeCert(ctx context.Context, hostname string) error {
 		return fmt.Errorf("removing key: %w", err)
 	}
 
-	// TODO: Add to CRL file for proper revocation checking
+	return nil
+}
+
+// InstallAgent deploys the on-host renewal script and systemd timer for
+// spec to host, following the same base64-tee deploy pattern as Deploy.
+// Unlike SystemdService/SystemdTimer (installed locally by the operator
+// for a central push model), this writes files on the remote host over the
+// existing SSH connection.
+func (d *Deployer) InstallAgent(ctx context.Context, client *ssh.Client, host *inventory.Host, spec *AgentInstallSpec) error {
+	if spec.DestDir == "" {
+		spec.DestDir = d.config.DestDir
+	}
+
+	script := AgentRenewalScript(spec, host.Name)
+	if err := d.deployFileContent(ctx, client, []byte(script), AgentRenewalScriptPath(spec.DestDir), "0700"); err != nil {
+		return fmt.Errorf("deploying renewal script: %w", err)
+	}
+
+	servicePath, timerPath := SystemdUnitPaths(spec.UnitName)
+	serviceContent := AgentSystemdService(spec)
+	timerContent := SystemdTimer(spec.Schedule)
+
+	if err := d.deployFileContent(ctx, client, []byte(serviceContent), servicePath, "0644"); err != nil {
+		return fmt.Errorf("deploying service unit: %w", err)
+	}
+	if err := d.deployFileContent(ctx, client, []byte(timerContent), timerPath, "0644"); err != nil {
+		return fmt.Errorf("deploying timer unit: %w", err)
+	}
+
+	enableCmd := fmt.Sprintf("systemctl daemon-reload && systemctl enable --now %s.timer", spec.UnitName)
+	if _, err := client.ExecSudo(ctx, enableCmd); err != nil {
+		return fmt.Errorf("enabling timer: %w", err)
+	}
+
+	return nil
+}
+
+// DeployBundle deploys the combined trust bundle built by 'pki bundle build'
+// to host and, on bases where system trust is managed at runtime rather than
+// declaratively, installs it as the system's CA trust store. It then
+// verifies the bundle landed intact by recomputing its SHA-256 hash on the
+// host and comparing against manifest.Hash, the same check 'pki status
+// --bundle' later uses to detect drift.
+func (d *Deployer) DeployBundle(ctx context.Context, client *ssh.Client, host *inventory.Host, bundle []byte, manifest *BundleManifest) error {
+	bundleDest := d.config.DestDir + "/" + BundlePEMFilename
+	if err := d.deployFileContent(ctx, client, bundle, bundleDest, "0644"); err != nil {
+		return fmt.Errorf("deploying trust bundle: %w", err)
+	}
+
+	if err := d.verifyBundleHash(ctx, client, bundleDest, manifest.Hash); err != nil {
+		return err
+	}
+
+	switch host.Base {
+	case "ubuntu":
+		installCmd := fmt.Sprintf("sudo cp %s /usr/local/share/ca-certificates/nixfleet-bundle.crt && sudo update-ca-certificates", bundleDest)
+		if _, err := client.Exec(ctx, installCmd); err != nil {
+			return fmt.Errorf("installing trust bundle: %w", err)
+		}
+	case "nixos", "darwin":
+		// NixOS/darwin manage system trust declaratively; the bundle file is
+		// left in place for inspection but isn't installed at runtime here.
+	default:
+		return fmt.Errorf("unsupported base: %s", host.Base)
+	}
+
+	return nil
+}
+
+// verifyBundleHash recomputes the SHA-256 hash of the bundle file just
+// written to destPath and compares it against wantHash, catching a bundle
+// that was truncated or corrupted in transit rather than letting a host
+// silently end up with a partial trust store.
+func (d *Deployer) verifyBundleHash(ctx context.Context, client *ssh.Client, destPath, wantHash string) error {
+	result, err := client.Exec(ctx, fmt.Sprintf("sha256sum %s", destPath))
+	if err != nil {
+		return fmt.Errorf("verifying trust bundle: %w", err)
+	}
+	fields := strings.Fields(result.Stdout)
+	if len(fields) == 0 {
+		return fmt.Errorf("verifying trust bundle: no output from sha256sum")
+	}
+	if fields[0] != wantHash {
+		return fmt.Errorf("trust bundle hash mismatch: host has %s, expected %s", fields[0], wantHash)
+	}
 	return nil
 }
 
@@ -247,6 +454,68 @@ func (d *Deployer) deployFileContent(ctx context.Context, client *ssh.Client, co
 	return err
 }
 
+// CertContentChanged reports whether content differs from what's already at
+// destPath on host, for callers (e.g. pkiDeployCmd) that deploy certificates
+// without going through Deploy and need the same reload-on-change check.
+func (d *Deployer) CertContentChanged(ctx context.Context, client *ssh.Client, destPath string, content []byte) (bool, error) {
+	return d.certContentChanged(ctx, client, destPath, content)
+}
+
+// ReloadUnits runs 'systemctl reload' for each of units on host, deduplicated,
+// exported for callers that assemble their own reload unit lists (e.g. from
+// per-host and per-shared-cert config) rather than a single DeployConfig list.
+func (d *Deployer) ReloadUnits(ctx context.Context, client *ssh.Client, units []string) []ReloadResult {
+	return d.reloadUnits(ctx, client, dedupeUnits(units))
+}
+
+// certContentChanged reports whether content differs from what's already at
+// destPath on the host, so Deploy only reloads dependent services when a
+// certificate push actually changed something. A missing file counts as
+// changed, unlike verifyBundleHash's stricter "must already match" check.
+func (d *Deployer) certContentChanged(ctx context.Context, client *ssh.Client, destPath string, content []byte) (bool, error) {
+	result, err := client.Exec(ctx, fmt.Sprintf("sudo cat %s 2>/dev/null || true", destPath))
+	if err != nil {
+		return false, fmt.Errorf("reading existing file: %w", err)
+	}
+	return result.Stdout != string(content), nil
+}
+
+// dedupeUnits returns units with duplicates removed, preserving the order
+// units they first appeared in, so multiple certs naming the same systemd
+// unit only trigger a single reload.
+func dedupeUnits(units []string) []string {
+	seen := make(map[string]bool, len(units))
+	out := make([]string, 0, len(units))
+	for _, u := range units {
+		if u == "" || seen[u] {
+			continue
+		}
+		seen[u] = true
+		out = append(out, u)
+	}
+	return out
+}
+
+// reloadUnits runs 'systemctl reload' (not restart) for each unit in turn,
+// continuing past individual failures so one bad unit doesn't stop the
+// others from picking up the new certificate.
+func (d *Deployer) reloadUnits(ctx context.Context, client *ssh.Client, units []string) []ReloadResult {
+	results := make([]ReloadResult, 0, len(units))
+	for _, unit := range units {
+		result, err := client.ExecSudo(ctx, fmt.Sprintf("systemctl reload %s", unit))
+		if err != nil {
+			output := err.Error()
+			if result != nil {
+				output = result.Stdout + result.Stderr
+			}
+			results = append(results, ReloadResult{Unit: unit, Success: false, Output: strings.TrimSpace(output)})
+			continue
+		}
+		results = append(results, ReloadResult{Unit: unit, Success: true, Output: strings.TrimSpace(result.Stdout)})
+	}
+	return results
+}
+
 func (d *Deployer) updateSystemTrust(ctx context.Context, client *ssh.Client, base, caCertPath string) error {
 	var updateCmd string
 	switch base {
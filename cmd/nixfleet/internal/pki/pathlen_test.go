@@ -65,7 +65,7 @@ func TestFleetCAPathlenSupportsSPIRE(t *testing.T) {
 	}
 
 	// SPIRE mints its own server CA under the upstream, then a leaf SVID.
-	spireCA, spireCAKey := signChild(t, "SPIRE Server CA", true, 0, spireInt.Certificate, spireInt.PrivateKey)
+	spireCA, spireCAKey := signChild(t, "SPIRE Server CA", true, 0, spireInt.Certificate, spireInt.PrivateKey.(*ecdsa.PrivateKey))
 	leaf, _ := signChild(t, "workload-svid", false, 0, spireCA, spireCAKey)
 
 	roots := x509.NewCertPool()
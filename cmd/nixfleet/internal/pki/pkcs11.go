@@ -0,0 +1,321 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/miekg/pkcs11"
+	"golang.org/x/term"
+)
+
+// pkcs11PINEnvVar is checked before falling back to an interactive prompt in
+// ResolvePKCS11PIN, so scripted deployments (CI, `pki init` on an
+// already-provisioned token) don't need a TTY.
+const pkcs11PINEnvVar = "NIXFLEET_PKCS11_PIN"
+
+// ResolvePKCS11PIN returns the token PIN from NIXFLEET_PKCS11_PIN if set, or
+// prompts for it on the controlling terminal otherwise. tokenLabel is only
+// used to make the prompt legible when multiple tokens might be present.
+func ResolvePKCS11PIN(tokenLabel string) (string, error) {
+	if pin := os.Getenv(pkcs11PINEnvVar); pin != "" {
+		return pin, nil
+	}
+
+	label := tokenLabel
+	if label == "" {
+		label = "PKCS#11 token"
+	}
+	fmt.Fprintf(os.Stderr, "Enter PIN for %s: ", label)
+	pinBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("reading PIN: %w", err)
+	}
+	return string(pinBytes), nil
+}
+
+// oidP256 is the CKA_EC_PARAMS encoding for the P-256 curve
+// (1.2.840.10045.3.1.7), the only curve NixFleet's CA keys use.
+var oidP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+
+// PKCS11Config identifies a CA private key held on a PKCS#11 token (a
+// YubiKey via ykcs11, or a hardware HSM) instead of in memory. The private
+// key material never leaves the token: every signing operation is a round
+// trip to it.
+type PKCS11Config struct {
+	// Module is the path to the PKCS#11 shared library, e.g.
+	// /usr/lib/x86_64-linux-gnu/libykcs11.so.
+	Module string
+
+	// TokenLabel selects among the module's slots by CKA_LABEL. Empty
+	// selects the first slot reporting a token present, which is fine for
+	// a single-YubiKey setup but should be set explicitly once more than
+	// one token may be plugged in.
+	TokenLabel string
+
+	// KeyLabel is the CKA_LABEL of the EC key pair to sign with. If no
+	// object with this label exists on the token yet, OpenPKCS11Signer
+	// generates a P-256 key pair under it.
+	KeyLabel string
+
+	// PIN authenticates to the token as CKU_USER. Resolving it from an
+	// environment variable or an interactive prompt is the caller's job -
+	// this package only ever sees the resolved value.
+	PIN string
+}
+
+// pkcs11Signer implements crypto.Signer against an EC key pair that stays
+// on a PKCS#11 token. It also tracks how long the last Sign call took, so
+// callers can surface hardware signing latency in verbose output.
+type pkcs11Signer struct {
+	cfg     PKCS11Config
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	slot    uint
+	priv    pkcs11.ObjectHandle
+	pub     *ecdsa.PublicKey
+
+	lastSignLatency time.Duration
+}
+
+// OpenPKCS11Signer loads cfg.Module, logs into the token identified by
+// cfg.TokenLabel (or the first slot with a token present, if empty), and
+// returns a crypto.Signer for the EC key labeled cfg.KeyLabel - generating
+// it on the token first if it doesn't exist yet. The caller must Close the
+// returned signer's underlying session when done; use it as a Signer for a
+// single pki init/init-intermediate/issue invocation and let the process
+// exit close it.
+func OpenPKCS11Signer(cfg PKCS11Config) (*pkcs11Signer, error) {
+	if cfg.Module == "" {
+		return nil, fmt.Errorf("pkcs11: module path is required")
+	}
+	if cfg.KeyLabel == "" {
+		return nil, fmt.Errorf("pkcs11: key label is required")
+	}
+
+	ctx := pkcs11.New(cfg.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("pkcs11: failed to load module %q", cfg.Module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("pkcs11: initializing module %q: %w", cfg.Module, err)
+	}
+
+	slot, err := findSlot(ctx, cfg.TokenLabel)
+	if err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return nil, err
+	}
+
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return nil, fmt.Errorf("pkcs11: opening session on slot %d (token %q): %w", slot, cfg.TokenLabel, err)
+	}
+
+	if err := ctx.Login(session, pkcs11.CKU_USER, cfg.PIN); err != nil {
+		ctx.CloseSession(session)
+		ctx.Finalize()
+		ctx.Destroy()
+		return nil, fmt.Errorf("pkcs11: logging into slot %d (token %q): %w - check the token is inserted and the PIN is correct", slot, cfg.TokenLabel, err)
+	}
+
+	s := &pkcs11Signer{cfg: cfg, ctx: ctx, session: session, slot: slot}
+
+	priv, pub, err := findOrCreateKeyPair(ctx, session, cfg.KeyLabel)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("pkcs11: key %q on slot %d (token %q): %w", cfg.KeyLabel, slot, cfg.TokenLabel, err)
+	}
+	s.priv = priv
+	s.pub = pub
+
+	return s, nil
+}
+
+// findSlot returns the slot ID for tokenLabel, or the first slot reporting
+// a token present when tokenLabel is empty.
+func findSlot(ctx *pkcs11.Ctx, tokenLabel string) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("pkcs11: listing slots: %w", err)
+	}
+	if len(slots) == 0 {
+		return 0, fmt.Errorf("pkcs11: no token present in any slot")
+	}
+	if tokenLabel == "" {
+		return slots[0], nil
+	}
+
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			continue
+		}
+		if trimNullPadding(info.Label) == tokenLabel {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("pkcs11: no slot found with token label %q", tokenLabel)
+}
+
+// trimNullPadding trims the NUL padding PKCS#11 token/slot labels are
+// fixed-width and space/NUL-padded with.
+func trimNullPadding(s string) string {
+	for len(s) > 0 && (s[len(s)-1] == 0 || s[len(s)-1] == ' ') {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// findOrCreateKeyPair locates an EC key pair labeled keyLabel, generating a
+// P-256 pair under that label if none exists yet.
+func findOrCreateKeyPair(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, keyLabel string) (pkcs11.ObjectHandle, *ecdsa.PublicKey, error) {
+	priv, pub, err := findKeyPair(ctx, session, keyLabel)
+	if err == nil {
+		return priv, pub, nil
+	}
+
+	privTemplate := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyLabel),
+	}
+	ecParams, merr := asn1.Marshal(oidP256)
+	if merr != nil {
+		return 0, nil, fmt.Errorf("encoding P-256 curve OID: %w", merr)
+	}
+	pubTemplate := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, ecParams),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyLabel),
+	}
+
+	pubHandle, privHandle, err := ctx.GenerateKeyPair(session,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil)},
+		pubTemplate, privTemplate)
+	if err != nil {
+		return 0, nil, fmt.Errorf("key not found and generation failed: %w", err)
+	}
+
+	pub, err = ecdsaPublicKeyFromHandle(ctx, session, pubHandle)
+	if err != nil {
+		return 0, nil, fmt.Errorf("reading newly generated public key: %w", err)
+	}
+	return privHandle, pub, nil
+}
+
+func findKeyPair(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, keyLabel string) (pkcs11.ObjectHandle, *ecdsa.PublicKey, error) {
+	privHandle, err := findObject(ctx, session, pkcs11.CKO_PRIVATE_KEY, keyLabel)
+	if err != nil {
+		return 0, nil, err
+	}
+	pubHandle, err := findObject(ctx, session, pkcs11.CKO_PUBLIC_KEY, keyLabel)
+	if err != nil {
+		return 0, nil, err
+	}
+	pub, err := ecdsaPublicKeyFromHandle(ctx, session, pubHandle)
+	if err != nil {
+		return 0, nil, err
+	}
+	return privHandle, pub, nil
+}
+
+func findObject(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, class uint, label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return 0, fmt.Errorf("finding object: %w", err)
+	}
+	defer ctx.FindObjectsFinal(session)
+
+	handles, _, err := ctx.FindObjects(session, 1)
+	if err != nil {
+		return 0, fmt.Errorf("finding object: %w", err)
+	}
+	if len(handles) == 0 {
+		return 0, fmt.Errorf("not found")
+	}
+	return handles[0], nil
+}
+
+// ecPointEnvelope is the ASN.1 OCTET STRING wrapper CKA_EC_POINT is
+// returned in per the PKCS#11 spec.
+type ecPointEnvelope []byte
+
+func ecdsaPublicKeyFromHandle(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, handle pkcs11.ObjectHandle) (*ecdsa.PublicKey, error) {
+	attrs, err := ctx.GetAttributeValue(session, handle, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading EC point: %w", err)
+	}
+	var point ecPointEnvelope
+	if _, err := asn1.Unmarshal(attrs[0].Value, &point); err != nil {
+		return nil, fmt.Errorf("decoding EC point: %w", err)
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), point)
+	if x == nil {
+		return nil, fmt.Errorf("EC point is not a valid uncompressed P-256 point")
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
+
+// Public implements crypto.Signer.
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign implements crypto.Signer, performing a raw CKM_ECDSA signature of
+// the (already hashed) digest on the token and re-encoding the resulting
+// fixed-width r||s pair as the ASN.1 DER structure x509 expects.
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, _ crypto.SignerOpts) ([]byte, error) {
+	start := time.Now()
+	defer func() { s.lastSignLatency = time.Since(start) }()
+
+	if err := s.ctx.SignInit(s.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}, s.priv); err != nil {
+		return nil, fmt.Errorf("pkcs11: initializing sign on key %q: %w", s.cfg.KeyLabel, err)
+	}
+	raw, err := s.ctx.Sign(s.session, digest)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: signing with key %q: %w", s.cfg.KeyLabel, err)
+	}
+	if len(raw)%2 != 0 {
+		return nil, fmt.Errorf("pkcs11: unexpected signature length %d from key %q", len(raw), s.cfg.KeyLabel)
+	}
+
+	half := len(raw) / 2
+	r := new(big.Int).SetBytes(raw[:half])
+	sVal := new(big.Int).SetBytes(raw[half:])
+	return asn1.Marshal(struct{ R, S *big.Int }{r, sVal})
+}
+
+// LastSignLatency returns how long the most recent Sign call took.
+func (s *pkcs11Signer) LastSignLatency() time.Duration {
+	return s.lastSignLatency
+}
+
+// Close logs out and releases the token session. Safe to call once after
+// all signing for this process is done.
+func (s *pkcs11Signer) Close() error {
+	s.ctx.Logout(s.session)
+	s.ctx.CloseSession(s.session)
+	s.ctx.Finalize()
+	s.ctx.Destroy()
+	return nil
+}
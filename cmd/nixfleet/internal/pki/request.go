@@ -0,0 +1,126 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"time"
+)
+
+// RequestStatus is the lifecycle state of a CertIntakeRequest.
+type RequestStatus string
+
+const (
+	RequestPending  RequestStatus = "pending"
+	RequestApproved RequestStatus = "approved"
+	RequestDenied   RequestStatus = "denied"
+	RequestExpired  RequestStatus = "expired"
+)
+
+// DefaultRequestTTL is how long a pending request stays eligible for
+// approval before ExpirePendingRequests marks it expired.
+const DefaultRequestTTL = 7 * 24 * time.Hour
+
+// CertIntakeRequest is a CSR submitted by a requester who generated their
+// own key pair and never transmits the private key anywhere - only the
+// public CSR crosses the wire (CLI-to-file, or POST to the server's
+// /api/pki/requests). An admin later approves or denies it with `pki
+// requests approve/deny`, which signs against the CSR's public key, so
+// teams without access to the CA's age identities can still get a cert
+// issued without anyone minting a key on their behalf.
+type CertIntakeRequest struct {
+	ID         string        `json:"id"`
+	CSRPEM     []byte        `json:"csrPEM"`
+	CommonName string        `json:"commonName"`
+	SANs       []string      `json:"sans,omitempty"`
+	Validity   string        `json:"validity,omitempty"` // requested validity, e.g. "90d"; decided by policy at approval time
+	CertName   string        `json:"certName,omitempty"` // named certificate slot, default "host"
+	Status     RequestStatus `json:"status"`
+	Requester  string        `json:"requester,omitempty"` // free-form identity supplied by the submitter
+	CreatedAt  time.Time     `json:"createdAt"`
+	ExpiresAt  time.Time     `json:"expiresAt"`
+
+	DecidedAt time.Time `json:"decidedAt,omitempty"`
+	DecidedBy string    `json:"decidedBy,omitempty"`
+	Reason    string    `json:"reason,omitempty"` // denial reason, or an approval note
+
+	// IssuedSerial records the serial of the certificate issued for this
+	// request once approved, so `pki requests list` can point at it without
+	// re-deriving the mapping from the store.
+	IssuedSerial string `json:"issuedSerial,omitempty"`
+}
+
+// NewRequestID generates a short random identifier for a CertIntakeRequest.
+func NewRequestID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating request id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GenerateCSR creates a fresh ECDSA P-256 key pair and a PKCS#10 certificate
+// signing request for cn/sans. The private key never leaves the caller - it
+// is returned alongside the CSR so `pki request` can write it straight to
+// local disk and submit only csrPEM onward.
+func GenerateCSR(cn string, sans []string) (csrPEM, keyPEM []byte, err error) {
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating request key pair: %w", err)
+	}
+
+	var dnsNames []string
+	var ipAddresses []net.IP
+	for _, san := range sans {
+		if ip := net.ParseIP(san); ip != nil {
+			ipAddresses = append(ipAddresses, ip)
+		} else {
+			dnsNames = append(dnsNames, san)
+		}
+	}
+
+	template := &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: cn},
+		DNSNames:    dnsNames,
+		IPAddresses: ipAddresses,
+	}
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, template, privKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating certificate request: %w", err)
+	}
+	csrPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+
+	keyPEM, err = marshalECPrivateKey(privKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encoding request private key: %w", err)
+	}
+
+	return csrPEM, keyPEM, nil
+}
+
+// ParseCSR decodes a PEM-encoded PKCS#10 certificate request and verifies
+// its self-signature, rejecting a CSR whose signature doesn't match the
+// public key it carries before any of its fields are trusted.
+func ParseCSR(csrPEM []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("failed to decode certificate request PEM")
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate request: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("certificate request signature invalid: %w", err)
+	}
+
+	return csr, nil
+}
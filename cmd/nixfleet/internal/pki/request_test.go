@@ -0,0 +1,118 @@
+package pki
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGenerateCSRAndIssueCertForCSR(t *testing.T) {
+	csrPEM, keyPEM, err := GenerateCSR("svc.internal", []string{"svc.example.com", "10.0.0.5"})
+	if err != nil {
+		t.Fatalf("GenerateCSR failed: %v", err)
+	}
+	if len(csrPEM) == 0 || len(keyPEM) == 0 {
+		t.Fatal("GenerateCSR returned empty PEM")
+	}
+
+	csr, err := ParseCSR(csrPEM)
+	if err != nil {
+		t.Fatalf("ParseCSR failed: %v", err)
+	}
+	if csr.Subject.CommonName != "svc.internal" {
+		t.Errorf("expected CN 'svc.internal', got %q", csr.Subject.CommonName)
+	}
+
+	ca, err := InitCA(&CAConfig{CommonName: "Test CA", Organization: "Test Org", Validity: 365 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("InitCA failed: %v", err)
+	}
+
+	cert, err := ca.IssueCertForCSR(csr, &CertRequest{
+		Hostname: "svc.internal",
+		SANs:     []string{"svc.example.com", "10.0.0.5"},
+		Validity: 90 * 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("IssueCertForCSR failed: %v", err)
+	}
+
+	if cert.Hostname != "svc.internal" {
+		t.Errorf("expected hostname 'svc.internal', got %q", cert.Hostname)
+	}
+	if len(cert.KeyPEM) != 0 {
+		t.Error("IssueCertForCSR should not return key material - the requester already holds it")
+	}
+
+	if err := ca.Verify(cert.CertPEM); err != nil {
+		t.Errorf("issued certificate failed verification: %v", err)
+	}
+}
+
+func TestParseCSRRejectsBadSignature(t *testing.T) {
+	if _, err := ParseCSR([]byte("not a csr")); err == nil {
+		t.Error("expected error for garbage input")
+	}
+}
+
+func TestStoreRequestRoundTrip(t *testing.T) {
+	store := NewStore(t.TempDir(), nil, nil)
+
+	csrPEM, _, err := GenerateCSR("svc.internal", nil)
+	if err != nil {
+		t.Fatalf("GenerateCSR failed: %v", err)
+	}
+
+	id, err := NewRequestID()
+	if err != nil {
+		t.Fatalf("NewRequestID failed: %v", err)
+	}
+
+	req := &CertIntakeRequest{
+		ID:         id,
+		CSRPEM:     csrPEM,
+		CommonName: "svc.internal",
+		Status:     RequestPending,
+		CreatedAt:  time.Now(),
+		ExpiresAt:  time.Now().Add(DefaultRequestTTL),
+	}
+	if err := store.SaveRequest(req); err != nil {
+		t.Fatalf("SaveRequest failed: %v", err)
+	}
+
+	loaded, err := store.LoadRequest(id)
+	if err != nil {
+		t.Fatalf("LoadRequest failed: %v", err)
+	}
+	if loaded.CommonName != "svc.internal" || loaded.Status != RequestPending {
+		t.Errorf("unexpected loaded request: %+v", loaded)
+	}
+
+	list, err := store.ListRequests()
+	if err != nil {
+		t.Fatalf("ListRequests failed: %v", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(list))
+	}
+
+	// An already-expired request should flip to RequestExpired.
+	req.ExpiresAt = time.Now().Add(-time.Hour)
+	if err := store.SaveRequest(req); err != nil {
+		t.Fatalf("SaveRequest failed: %v", err)
+	}
+	expired, err := store.ExpirePendingRequests()
+	if err != nil {
+		t.Fatalf("ExpirePendingRequests failed: %v", err)
+	}
+	if expired != 1 {
+		t.Errorf("expected 1 expired request, got %d", expired)
+	}
+
+	loaded, err = store.LoadRequest(id)
+	if err != nil {
+		t.Fatalf("LoadRequest failed: %v", err)
+	}
+	if loaded.Status != RequestExpired {
+		t.Errorf("expected status %s, got %s", RequestExpired, loaded.Status)
+	}
+}
@@ -2,6 +2,8 @@ package pki
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"encoding/pem"
 	"fmt"
 	"time"
 )
@@ -16,6 +18,12 @@ type RotationConfig struct {
 
 	// Force renews all certificates regardless of expiry
 	Force bool
+
+	// ReuseKey, if true, reissues each renewed certificate for its
+	// existing key instead of generating a new one, leaving the key file
+	// untouched - the same reuseKey behavior as Deployer.RenewCert, wired
+	// into the auto-rotation timer flow via pki.yaml's reuseKey setting.
+	ReuseKey bool
 }
 
 // DefaultRotationConfig returns sensible defaults
@@ -125,34 +133,80 @@ func (s *Store) RotateCertificates(ctx context.Context, issuer CertIssuer, cfg *
 				Validity: existingCert.NotAfter.Sub(existingCert.NotBefore), // Preserve original validity
 			}
 
-			// Issue new certificate
-			newCert, err := issuer.IssueCert(req)
-			if err != nil {
-				results = append(results, RotationResult{
-					Hostname: hostname,
-					CertName: certName,
-					Action:   "failed",
-					Message:  fmt.Sprintf("issuing cert: %v", err),
-				})
-				continue
+			var newCert *IssuedCert
+			if cfg.ReuseKey {
+				keyBlock, _ := pem.Decode(existingCert.KeyPEM)
+				if keyBlock == nil {
+					results = append(results, RotationResult{
+						Hostname: hostname,
+						CertName: certName,
+						Action:   "failed",
+						Message:  "decoding existing private key: failed to decode PEM",
+					})
+					continue
+				}
+				existingKey, err := parseECPrivateKey(keyBlock.Bytes)
+				if err != nil {
+					results = append(results, RotationResult{
+						Hostname: hostname,
+						CertName: certName,
+						Action:   "failed",
+						Message:  fmt.Sprintf("parsing existing private key: %v", err),
+					})
+					continue
+				}
+				newCert, err = issuer.IssueCertForKey(req, &existingKey.PublicKey)
+				if err != nil {
+					results = append(results, RotationResult{
+						Hostname: hostname,
+						CertName: certName,
+						Action:   "failed",
+						Message:  fmt.Sprintf("issuing cert: %v", err),
+					})
+					continue
+				}
+				newCert.KeyPEM = existingCert.KeyPEM
+				if err := s.UpdateHostCert(newCert); err != nil {
+					results = append(results, RotationResult{
+						Hostname: hostname,
+						CertName: certName,
+						Action:   "failed",
+						Message:  fmt.Sprintf("saving cert: %v", err),
+					})
+					continue
+				}
+			} else {
+				var err error
+				newCert, err = issuer.IssueCert(req)
+				if err != nil {
+					results = append(results, RotationResult{
+						Hostname: hostname,
+						CertName: certName,
+						Action:   "failed",
+						Message:  fmt.Sprintf("issuing cert: %v", err),
+					})
+					continue
+				}
+				if err := s.SaveHostCert(newCert); err != nil {
+					results = append(results, RotationResult{
+						Hostname: hostname,
+						CertName: certName,
+						Action:   "failed",
+						Message:  fmt.Sprintf("saving cert: %v", err),
+					})
+					continue
+				}
 			}
 
-			// Save renewed certificate
-			if err := s.SaveHostCert(newCert); err != nil {
-				results = append(results, RotationResult{
-					Hostname: hostname,
-					CertName: certName,
-					Action:   "failed",
-					Message:  fmt.Sprintf("saving cert: %v", err),
-				})
-				continue
+			message := fmt.Sprintf("was expiring in %d days, now valid until %s", daysLeft, newCert.NotAfter.Format("2006-01-02"))
+			if cfg.ReuseKey {
+				message += " (key reused)"
 			}
-
 			results = append(results, RotationResult{
 				Hostname:  hostname,
 				CertName:  certName,
 				Action:    "renewed",
-				Message:   fmt.Sprintf("was expiring in %d days, now valid until %s", daysLeft, newCert.NotAfter.Format("2006-01-02")),
+				Message:   message,
 				ExpiresAt: newCert.NotAfter,
 				DaysLeft:  int(newCert.NotAfter.Sub(now).Hours() / 24),
 			})
@@ -165,6 +219,7 @@ func (s *Store) RotateCertificates(ctx context.Context, issuer CertIssuer, cfg *
 // CertIssuer is the interface for certificate issuers (CA or IntermediateCA)
 type CertIssuer interface {
 	IssueCert(req *CertRequest) (*IssuedCert, error)
+	IssueCertForKey(req *CertRequest, pubKey *ecdsa.PublicKey) (*IssuedCert, error)
 }
 
 // SystemdService returns the systemd service unit content
@@ -0,0 +1,330 @@
+package pki
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/ssh"
+)
+
+// DefaultScanDirs are the remote directories `pki scan` walks when the
+// caller doesn't override them, covering nixfleet's own deploy directory
+// plus the two places TLS material tends to accumulate "by hand": system
+// certs/keys and Let's Encrypt's live directory.
+var DefaultScanDirs = []string{
+	"/etc/nixfleet/pki",
+	"/etc/ssl/private",
+	"/etc/letsencrypt/live",
+}
+
+// ScannedCert is one certificate found on a host during a scan, with the
+// reconciliation verdict against the local PKI store.
+type ScannedCert struct {
+	Path      string    `json:"path"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	SANs      []string  `json:"sans,omitempty"`
+	Serial    string    `json:"serial"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	DaysLeft  int       `json:"days_left"`
+	Algorithm string    `json:"algorithm,omitempty"`
+
+	// HasKey and KeyMatches report whether a private key was found
+	// alongside the certificate and, if so, whether it's actually the
+	// matching key - a mismatched pair is as useless as a missing one.
+	HasKey     bool `json:"has_key"`
+	KeyMatches bool `json:"key_matches"`
+
+	// Classification is one of "fleet-managed" (serial known to the local
+	// store), "orphaned" (signed by our CA but the store no longer tracks
+	// it), "foreign" (issued by someone/something else), or "expired"
+	// (past NotAfter, regardless of ownership - expiry is called out on
+	// its own so it can't hide behind any of the other three).
+	Classification string `json:"classification"`
+	Detail         string `json:"detail,omitempty"`
+}
+
+// HostScanResult is the outcome of scanning one host's filesystem for
+// certificates, per Scanner.ScanHost.
+type HostScanResult struct {
+	Host      string        `json:"host"`
+	ScannedAt time.Time     `json:"scanned_at"`
+	Dirs      []string      `json:"dirs"`
+	Certs     []ScannedCert `json:"certs"`
+	Errors    []string      `json:"errors,omitempty"`
+}
+
+// Scanner reconciles certificates found on hosts against the local PKI
+// store's known serials and CA chain.
+type Scanner struct {
+	store *Store
+}
+
+// NewScanner creates a Scanner backed by store.
+func NewScanner(store *Store) *Scanner {
+	return &Scanner{store: store}
+}
+
+// ScanHost walks dirs on client over SSH (DefaultScanDirs if empty), parses
+// every certificate it finds, and classifies each against the local store.
+// A single unreadable or unparseable file is recorded in the result's
+// Errors rather than failing the whole scan - one bad entry on a snowflake
+// host shouldn't hide the rest of what's there.
+func (s *Scanner) ScanHost(ctx context.Context, client *ssh.Client, dirs []string) (*HostScanResult, error) {
+	if len(dirs) == 0 {
+		dirs = DefaultScanDirs
+	}
+
+	known, err := s.knownSerials()
+	if err != nil {
+		return nil, fmt.Errorf("loading known serials: %w", err)
+	}
+	caCerts := s.trustedCAs()
+
+	result := &HostScanResult{Host: client.Host(), ScannedAt: time.Now(), Dirs: dirs}
+
+	for _, dir := range dirs {
+		findCmd := fmt.Sprintf("find %s -type f \\( -name '*.crt' -o -name '*.pem' \\) 2>/dev/null", shQuote(dir))
+		out, err := client.Exec(ctx, findCmd)
+		if err != nil || out.ExitCode != 0 {
+			// A configured directory that doesn't exist on this host (or
+			// that we can't read) is normal, not worth reporting - most
+			// hosts won't have all three default directories.
+			continue
+		}
+
+		for _, path := range strings.Split(strings.TrimSpace(out.Stdout), "\n") {
+			path = strings.TrimSpace(path)
+			if path == "" {
+				continue
+			}
+			scanned, err := s.scanCertFile(ctx, client, path, known, caCerts)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", path, err))
+				continue
+			}
+			if scanned != nil {
+				result.Certs = append(result.Certs, *scanned)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// scanCertFile downloads and parses the certificate at path, looks for its
+// matching private key, and classifies it. Returns nil, nil for a file
+// found by the *.crt/*.pem glob that isn't actually a certificate PEM
+// (e.g. a *.pem private key) - that's not an error, just not what we're
+// looking for.
+func (s *Scanner) scanCertFile(ctx context.Context, client *ssh.Client, path string, known map[string]string, caCerts []*x509.Certificate) (*ScannedCert, error) {
+	catResult, err := client.Exec(ctx, fmt.Sprintf("cat %s 2>/dev/null", shQuote(path)))
+	if err != nil || catResult.ExitCode != 0 {
+		return nil, fmt.Errorf("reading file")
+	}
+
+	block, _ := pem.Decode([]byte(catResult.Stdout))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate: %w", err)
+	}
+
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+
+	scanned := &ScannedCert{
+		Path:      path,
+		Subject:   cert.Subject.CommonName,
+		Issuer:    cert.Issuer.CommonName,
+		SANs:      sans,
+		Serial:    cert.SerialNumber.String(),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		DaysLeft:  int(time.Until(cert.NotAfter).Hours() / 24),
+		Algorithm: cert.PublicKeyAlgorithm.String(),
+	}
+
+	if keyPath := matchingKeyPath(path); keyPath != "" {
+		keyResult, err := client.ExecSudo(ctx, fmt.Sprintf("cat %s 2>/dev/null", shQuote(keyPath)))
+		if err == nil && keyResult.ExitCode == 0 && strings.TrimSpace(keyResult.Stdout) != "" {
+			scanned.HasKey = true
+			scanned.KeyMatches = keyMatchesCert([]byte(keyResult.Stdout), cert)
+		}
+	}
+
+	scanned.Classification, scanned.Detail = s.classify(cert, known, caCerts)
+	return scanned, nil
+}
+
+// classify determines a scanned cert's reconciliation verdict. Expiry is
+// checked first regardless of ownership, so an expired fleet-managed or
+// foreign cert is never mistaken for a healthy one; otherwise a known
+// serial means fleet-managed, a valid signature from our CA chain with an
+// unknown serial means orphaned (we issued it but stopped tracking it),
+// and anything else is foreign.
+func (s *Scanner) classify(cert *x509.Certificate, known map[string]string, caCerts []*x509.Certificate) (classification, detail string) {
+	if owner, ok := known[cert.SerialNumber.String()]; ok {
+		if time.Now().After(cert.NotAfter) {
+			return "expired", "fleet-managed: " + owner
+		}
+		return "fleet-managed", owner
+	}
+
+	for _, ca := range caCerts {
+		if cert.CheckSignatureFrom(ca) == nil {
+			if time.Now().After(cert.NotAfter) {
+				return "expired", "issued by the fleet CA, no longer tracked"
+			}
+			return "orphaned", "issued by the fleet CA, no longer tracked"
+		}
+	}
+
+	if time.Now().After(cert.NotAfter) {
+		return "expired", "issuer: " + cert.Issuer.CommonName
+	}
+	return "foreign", "issuer: " + cert.Issuer.CommonName
+}
+
+// knownSerials returns every certificate serial the local store currently
+// tracks (host and shared certs), mapped to a human-readable owner label.
+func (s *Scanner) knownSerials() (map[string]string, error) {
+	known := make(map[string]string)
+
+	hostnames, err := s.store.ListHostCerts()
+	if err != nil {
+		return nil, err
+	}
+	for _, hostname := range hostnames {
+		names, err := s.store.ListHostNamedCerts(hostname)
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			info, err := s.store.GetNamedCertInfo(hostname, name)
+			if err != nil {
+				continue
+			}
+			known[info.Serial] = fmt.Sprintf("%s/%s", hostname, name)
+		}
+	}
+
+	sharedNames, err := s.store.ListSharedCerts()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range sharedNames {
+		info, err := s.store.GetSharedCertInfo(name)
+		if err != nil {
+			continue
+		}
+		known[info.Serial] = "shared/" + name
+	}
+
+	return known, nil
+}
+
+// trustedCAs returns the fleet's root and (if present) intermediate CA
+// certificates, so a cert we issued but no longer track can still be told
+// apart from one issued by something else entirely.
+func (s *Scanner) trustedCAs() []*x509.Certificate {
+	var cas []*x509.Certificate
+	for _, path := range []string{s.store.GetCACertPath(), s.store.GetIntermediateCertPath()} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		cas = append(cas, cert)
+	}
+	return cas
+}
+
+// matchingKeyPath guesses where a certificate file's private key lives,
+// following the two layouts DefaultScanDirs actually turns up: Let's
+// Encrypt's cert.pem/fullchain.pem sitting next to privkey.pem, or a plain
+// foo.crt/foo.pem next to foo.key.
+func matchingKeyPath(certPath string) string {
+	dir := filepath.Dir(certPath)
+	base := filepath.Base(certPath)
+
+	switch base {
+	case "cert.pem", "fullchain.pem":
+		return filepath.Join(dir, "privkey.pem")
+	}
+
+	ext := filepath.Ext(base)
+	if ext == ".crt" || ext == ".pem" {
+		return filepath.Join(dir, strings.TrimSuffix(base, ext)+".key")
+	}
+	return ""
+}
+
+// keyMatchesCert reports whether keyPEM's public key matches cert's,
+// covering the three private key PEM types OpenSSL/certbot/nixfleet itself
+// produce (PKCS#1 RSA, SEC1 EC, and PKCS#8).
+func keyMatchesCert(keyPEM []byte, cert *x509.Certificate) bool {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return false
+	}
+
+	var pub crypto.PublicKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return false
+		}
+		pub = &key.PublicKey
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return false
+		}
+		pub = &key.PublicKey
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return false
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return false
+		}
+		pub = signer.Public()
+	default:
+		return false
+	}
+
+	certPub, ok := cert.PublicKey.(interface{ Equal(x crypto.PublicKey) bool })
+	if !ok {
+		return false
+	}
+	return certPub.Equal(pub)
+}
+
+// shQuote single-quotes a string for safe embedding in a /bin/sh command.
+func shQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
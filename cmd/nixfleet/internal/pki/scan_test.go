@@ -0,0 +1,138 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func TestScannerClassify(t *testing.T) {
+	caCfg := DefaultCAConfig()
+	ca, err := InitCA(caCfg)
+	if err != nil {
+		t.Fatalf("InitCA failed: %v", err)
+	}
+
+	managed, err := ca.IssueCert(&CertRequest{Hostname: "managed-host", Validity: 30 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("IssueCert failed: %v", err)
+	}
+	managedCert, err := parseCertPEM(managed.CertPEM)
+	if err != nil {
+		t.Fatalf("parsing managed cert: %v", err)
+	}
+
+	orphaned, err := ca.IssueCert(&CertRequest{Hostname: "orphaned-host", Validity: 30 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("IssueCert failed: %v", err)
+	}
+	orphanedCert, err := parseCertPEM(orphaned.CertPEM)
+	if err != nil {
+		t.Fatalf("parsing orphaned cert: %v", err)
+	}
+
+	expired, err := ca.IssueCert(&CertRequest{Hostname: "expired-host", Validity: -24 * time.Hour})
+	if err != nil {
+		t.Fatalf("IssueCert failed: %v", err)
+	}
+	expiredCert, err := parseCertPEM(expired.CertPEM)
+	if err != nil {
+		t.Fatalf("parsing expired cert: %v", err)
+	}
+
+	otherCA, err := InitCA(DefaultCAConfig())
+	if err != nil {
+		t.Fatalf("InitCA failed: %v", err)
+	}
+	foreign, err := otherCA.IssueCert(&CertRequest{Hostname: "foreign-host", Validity: 30 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("IssueCert failed: %v", err)
+	}
+	foreignCert, err := parseCertPEM(foreign.CertPEM)
+	if err != nil {
+		t.Fatalf("parsing foreign cert: %v", err)
+	}
+
+	s := &Scanner{}
+	known := map[string]string{managedCert.SerialNumber.String(): "managed-host/host"}
+	caCerts := []*x509.Certificate{ca.Certificate}
+
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		wantCls string
+	}{
+		{"fleet-managed", managedCert, "fleet-managed"},
+		{"orphaned", orphanedCert, "orphaned"},
+		{"foreign", foreignCert, "foreign"},
+		{"expired", expiredCert, "expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cls, _ := s.classify(tt.cert, known, caCerts)
+			if cls != tt.wantCls {
+				t.Errorf("classify() = %q, want %q", cls, tt.wantCls)
+			}
+		})
+	}
+}
+
+func TestMatchingKeyPath(t *testing.T) {
+	tests := []struct {
+		certPath string
+		want     string
+	}{
+		{"/etc/letsencrypt/live/example.com/cert.pem", "/etc/letsencrypt/live/example.com/privkey.pem"},
+		{"/etc/letsencrypt/live/example.com/fullchain.pem", "/etc/letsencrypt/live/example.com/privkey.pem"},
+		{"/etc/ssl/private/server.crt", "/etc/ssl/private/server.key"},
+		{"/etc/ssl/private/server.pem", "/etc/ssl/private/server.key"},
+		{"/etc/ssl/private/server.der", ""},
+	}
+	for _, tt := range tests {
+		if got := matchingKeyPath(tt.certPath); got != tt.want {
+			t.Errorf("matchingKeyPath(%q) = %q, want %q", tt.certPath, got, tt.want)
+		}
+	}
+}
+
+func TestKeyMatchesCert(t *testing.T) {
+	ca, err := InitCA(DefaultCAConfig())
+	if err != nil {
+		t.Fatalf("InitCA failed: %v", err)
+	}
+	issued, err := ca.IssueCert(&CertRequest{Hostname: "key-test", Validity: 30 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("IssueCert failed: %v", err)
+	}
+	cert, err := parseCertPEM(issued.CertPEM)
+	if err != nil {
+		t.Fatalf("parsing cert: %v", err)
+	}
+
+	if !keyMatchesCert(issued.KeyPEM, cert) {
+		t.Error("keyMatchesCert() = false for the cert's own key, want true")
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating unrelated key: %v", err)
+	}
+	otherKeyBytes, err := x509.MarshalECPrivateKey(otherKey)
+	if err != nil {
+		t.Fatalf("marshaling unrelated key: %v", err)
+	}
+	otherKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: otherKeyBytes})
+
+	if keyMatchesCert(otherKeyPEM, cert) {
+		t.Error("keyMatchesCert() = true for an unrelated key, want false")
+	}
+}
+
+func parseCertPEM(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	return x509.ParseCertificate(block.Bytes)
+}
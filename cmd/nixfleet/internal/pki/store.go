@@ -3,16 +3,35 @@ package pki
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
 
+// KeyBackendMeta records where a CA's private key actually lives, for CAs
+// whose key was generated with a hardware backend (see OpenPKCS11Signer)
+// instead of the default in-memory ECDSA key. It's stored alongside (never
+// instead of) the usual cert/key files, as root.key-backend.json /
+// intermediate.key-backend.json - its presence is what tells LoadCA to open
+// the token instead of decrypting a local *.key.age file.
+type KeyBackendMeta struct {
+	Type       string `json:"type"` // "pkcs11"
+	Module     string `json:"module"`
+	TokenLabel string `json:"tokenLabel,omitempty"`
+	KeyLabel   string `json:"keyLabel"`
+}
+
+// KeyBackendPKCS11 identifies a KeyBackendMeta.Type stored on a PKCS#11 token.
+const KeyBackendPKCS11 = "pkcs11"
+
 // Store manages PKI files in the secrets directory
 type Store struct {
 	baseDir    string   // Base directory (usually "secrets/pki")
@@ -39,9 +58,10 @@ func (s *Store) CAExists() bool {
 
 	_, certErr := os.Stat(caCertPath)
 	_, keyErr := os.Stat(caKeyPath)
+	_, backendErr := os.Stat(s.caKeyBackendPath())
 
-	// Full root CA available
-	if certErr == nil && keyErr == nil {
+	// Full root CA available, key either local or on a hardware backend
+	if certErr == nil && (keyErr == nil || backendErr == nil) {
 		return true
 	}
 
@@ -53,7 +73,9 @@ func (s *Store) CAExists() bool {
 	return false
 }
 
-// SaveCA saves the CA certificate and encrypted private key
+// SaveCA saves the CA certificate and, for an in-memory key, its encrypted
+// private key. For a hardware-backed CA (ca.KeyPEM is empty), the caller
+// must also call SaveCAKeyBackend so LoadCA knows where to find the key.
 func (s *Store) SaveCA(ca *CA) error {
 	caDir := filepath.Join(s.baseDir, "ca")
 	if err := os.MkdirAll(caDir, 0755); err != nil {
@@ -66,6 +88,10 @@ func (s *Store) SaveCA(ca *CA) error {
 		return fmt.Errorf("writing CA certificate: %w", err)
 	}
 
+	if len(ca.KeyPEM) == 0 {
+		return nil
+	}
+
 	// Encrypt and save private key
 	keyPath := filepath.Join(caDir, "root.key.age")
 	if err := s.encryptAndSave(ca.KeyPEM, keyPath); err != nil {
@@ -75,7 +101,16 @@ func (s *Store) SaveCA(ca *CA) error {
 	return nil
 }
 
-// LoadCA loads the CA from disk
+// SaveCAKeyBackend records that the root CA's key lives on a hardware
+// backend rather than in root.key.age. Call this after SaveCA when ca was
+// created with InitCAWithSigner/LoadCAWithSigner.
+func (s *Store) SaveCAKeyBackend(meta *KeyBackendMeta) error {
+	return s.saveKeyBackendMeta(s.caKeyBackendPath(), meta)
+}
+
+// LoadCA loads the CA from disk, opening a hardware backend (see
+// OpenPKCS11Signer) instead of decrypting root.key.age if the CA was saved
+// with SaveCAKeyBackend.
 func (s *Store) LoadCA(ctx context.Context) (*CA, error) {
 	caDir := filepath.Join(s.baseDir, "ca")
 
@@ -86,6 +121,16 @@ func (s *Store) LoadCA(ctx context.Context) (*CA, error) {
 		return nil, fmt.Errorf("reading CA certificate: %w", err)
 	}
 
+	if meta, err := s.loadKeyBackendMeta(s.caKeyBackendPath()); err != nil {
+		return nil, fmt.Errorf("reading CA key backend: %w", err)
+	} else if meta != nil {
+		signer, err := s.openKeyBackendSigner(meta)
+		if err != nil {
+			return nil, fmt.Errorf("opening CA key backend: %w", err)
+		}
+		return LoadCAWithSigner(certPEM, signer)
+	}
+
 	// Decrypt and read private key
 	keyPath := filepath.Join(caDir, "root.key.age")
 	keyPEM, err := s.decryptFile(ctx, keyPath)
@@ -103,11 +148,15 @@ func (s *Store) IntermediateCAExists() bool {
 
 	_, certErr := os.Stat(intermediateCertPath)
 	_, keyErr := os.Stat(intermediateKeyPath)
+	_, backendErr := os.Stat(s.intermediateKeyBackendPath())
 
-	return certErr == nil && keyErr == nil
+	return certErr == nil && (keyErr == nil || backendErr == nil)
 }
 
-// SaveIntermediateCA saves the intermediate CA certificate and encrypted private key
+// SaveIntermediateCA saves the intermediate CA certificate and, for an
+// in-memory key, its encrypted private key. For a hardware-backed
+// intermediate (ica.KeyPEM is empty), the caller must also call
+// SaveIntermediateCAKeyBackend.
 func (s *Store) SaveIntermediateCA(ica *IntermediateCA) error {
 	caDir := filepath.Join(s.baseDir, "ca")
 	if err := os.MkdirAll(caDir, 0755); err != nil {
@@ -126,6 +175,10 @@ func (s *Store) SaveIntermediateCA(ica *IntermediateCA) error {
 		return fmt.Errorf("writing CA chain: %w", err)
 	}
 
+	if len(ica.KeyPEM) == 0 {
+		return nil
+	}
+
 	// Encrypt and save private key
 	keyPath := filepath.Join(caDir, "intermediate.key.age")
 	if err := s.encryptAndSave(ica.KeyPEM, keyPath); err != nil {
@@ -135,7 +188,16 @@ func (s *Store) SaveIntermediateCA(ica *IntermediateCA) error {
 	return nil
 }
 
-// LoadIntermediateCA loads the intermediate CA from disk
+// SaveIntermediateCAKeyBackend records that the intermediate CA's key lives
+// on a hardware backend rather than in intermediate.key.age. See
+// SaveCAKeyBackend.
+func (s *Store) SaveIntermediateCAKeyBackend(meta *KeyBackendMeta) error {
+	return s.saveKeyBackendMeta(s.intermediateKeyBackendPath(), meta)
+}
+
+// LoadIntermediateCA loads the intermediate CA from disk, opening a hardware
+// backend instead of decrypting intermediate.key.age if the intermediate was
+// saved with SaveIntermediateCAKeyBackend.
 func (s *Store) LoadIntermediateCA(ctx context.Context) (*IntermediateCA, error) {
 	caDir := filepath.Join(s.baseDir, "ca")
 
@@ -153,6 +215,16 @@ func (s *Store) LoadIntermediateCA(ctx context.Context) (*IntermediateCA, error)
 		return nil, fmt.Errorf("reading root CA certificate: %w", err)
 	}
 
+	if meta, err := s.loadKeyBackendMeta(s.intermediateKeyBackendPath()); err != nil {
+		return nil, fmt.Errorf("reading intermediate CA key backend: %w", err)
+	} else if meta != nil {
+		signer, err := s.openKeyBackendSigner(meta)
+		if err != nil {
+			return nil, fmt.Errorf("opening intermediate CA key backend: %w", err)
+		}
+		return LoadIntermediateCAWithSigner(certPEM, rootCertPEM, signer)
+	}
+
 	// Decrypt and read private key
 	keyPath := filepath.Join(caDir, "intermediate.key.age")
 	keyPEM, err := s.decryptFile(ctx, keyPath)
@@ -207,9 +279,88 @@ func (s *Store) SaveHostCert(cert *IssuedCert) error {
 		return fmt.Errorf("encrypting host private key: %w", err)
 	}
 
+	// Record when this key was created, so `pki status` can show its age
+	// separately from the cert's - every SaveHostCert call generates a
+	// fresh key, so this always resets to now.
+	if err := s.setKeyCreatedAt(hostDir, certName, time.Now()); err != nil {
+		return fmt.Errorf("recording key creation time: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateHostCert saves a renewed certificate (and chain, if present) for an
+// existing host without touching its key file or key-created-at marker -
+// the renewal path for reuseKey renewals (see Deployer.RenewCert), where
+// the certificate changes but the key backing it deliberately doesn't.
+func (s *Store) UpdateHostCert(cert *IssuedCert) error {
+	certName := cert.Name
+	if certName == "" {
+		certName = "host"
+	}
+
+	hostDir := filepath.Join(s.baseDir, "hosts", cert.Hostname)
+	if err := os.MkdirAll(hostDir, 0755); err != nil {
+		return fmt.Errorf("creating host directory: %w", err)
+	}
+
+	certPath := filepath.Join(hostDir, certName+".crt")
+	if err := os.WriteFile(certPath, cert.CertPEM, 0644); err != nil {
+		return fmt.Errorf("writing host certificate: %w", err)
+	}
+
+	if len(cert.ChainPEM) > 0 {
+		chainPath := filepath.Join(hostDir, certName+".chain.crt")
+		if err := os.WriteFile(chainPath, cert.ChainPEM, 0644); err != nil {
+			return fmt.Errorf("writing certificate chain: %w", err)
+		}
+	}
+
 	return nil
 }
 
+// keyCreatedPath returns the path of the marker file setKeyCreatedAt writes
+// and KeyCreatedAt reads, following the same per-cert sidecar-file
+// convention as the .agent-managed marker.
+func keyCreatedPath(hostDir, certName string) string {
+	return filepath.Join(hostDir, certName+".key-created")
+}
+
+// setKeyCreatedAt records t as the creation time of a named certificate's
+// key, overwriting any previous value.
+func (s *Store) setKeyCreatedAt(hostDir, certName string, t time.Time) error {
+	return os.WriteFile(keyCreatedPath(hostDir, certName), []byte(t.UTC().Format(time.RFC3339)), 0644)
+}
+
+// KeyCreatedAt returns when a named certificate's key was created. Keys
+// saved before this marker existed fall back to the key file's mtime,
+// so `pki status` can still show a (less precise) age for them instead of
+// an error.
+func (s *Store) KeyCreatedAt(hostname, certName string) (time.Time, error) {
+	if certName == "" {
+		certName = "host"
+	}
+	hostDir := filepath.Join(s.baseDir, "hosts", hostname)
+
+	data, err := os.ReadFile(keyCreatedPath(hostDir, certName))
+	if err == nil {
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("parsing key creation marker: %w", err)
+		}
+		return t, nil
+	}
+	if !os.IsNotExist(err) {
+		return time.Time{}, fmt.Errorf("reading key creation marker: %w", err)
+	}
+
+	info, err := os.Stat(filepath.Join(hostDir, certName+".key.age"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("stat key file: %w", err)
+	}
+	return info.ModTime(), nil
+}
+
 // LoadHostCert loads a host certificate from disk (default "host" name)
 func (s *Store) LoadHostCert(ctx context.Context, hostname string) (*IssuedCert, error) {
 	return s.LoadNamedCert(ctx, hostname, "host")
@@ -282,6 +433,32 @@ func (s *Store) NamedCertExists(hostname, certName string) bool {
 	return err == nil
 }
 
+// IsAgentManaged reports whether a named certificate was last renewed by the
+// on-host renewal agent (via the cert-manager webhook's mTLS path) rather
+// than a central `pki renew`/`pki deploy` push.
+func (s *Store) IsAgentManaged(hostname, certName string) bool {
+	if certName == "" {
+		certName = "host"
+	}
+	_, err := os.Stat(filepath.Join(s.baseDir, "hosts", hostname, certName+".agent-managed"))
+	return err == nil
+}
+
+// SetAgentManaged marks a named certificate as agent-managed, so `pki
+// status` can distinguish it from centrally-pushed certificates. It's an
+// empty marker file, following the same existence-check convention as
+// CAExists and HostCertExists.
+func (s *Store) SetAgentManaged(hostname, certName string) error {
+	if certName == "" {
+		certName = "host"
+	}
+	hostDir := filepath.Join(s.baseDir, "hosts", hostname)
+	if err := os.MkdirAll(hostDir, 0755); err != nil {
+		return fmt.Errorf("creating host directory: %w", err)
+	}
+	return os.WriteFile(filepath.Join(hostDir, certName+".agent-managed"), nil, 0644)
+}
+
 // ListHostCerts returns a list of all hostnames with certificates
 func (s *Store) ListHostCerts() ([]string, error) {
 	hostDir := filepath.Join(s.baseDir, "hosts")
@@ -358,6 +535,122 @@ func (s *Store) GetNamedKeyPath(hostname, certName string) string {
 	return filepath.Join(s.baseDir, "hosts", hostname, certName+".key.age")
 }
 
+// SaveSharedCert saves a shared certificate under secrets/pki/shared/{name}/.
+// Shared certs are issued once and deployed to multiple hosts.
+func (s *Store) SaveSharedCert(name string, cert *IssuedCert) error {
+	sharedDir := filepath.Join(s.baseDir, "shared", name)
+	if err := os.MkdirAll(sharedDir, 0755); err != nil {
+		return fmt.Errorf("creating shared certificate directory: %w", err)
+	}
+
+	certPath := filepath.Join(sharedDir, name+".crt")
+	if err := os.WriteFile(certPath, cert.CertPEM, 0644); err != nil {
+		return fmt.Errorf("writing shared certificate: %w", err)
+	}
+
+	if len(cert.ChainPEM) > 0 {
+		chainPath := filepath.Join(sharedDir, name+".chain.crt")
+		if err := os.WriteFile(chainPath, cert.ChainPEM, 0644); err != nil {
+			return fmt.Errorf("writing shared certificate chain: %w", err)
+		}
+	}
+
+	keyPath := filepath.Join(sharedDir, name+".key.age")
+	if err := s.encryptAndSave(cert.KeyPEM, keyPath); err != nil {
+		return fmt.Errorf("encrypting shared certificate private key: %w", err)
+	}
+
+	return nil
+}
+
+// LoadSharedCert loads a shared certificate from disk
+func (s *Store) LoadSharedCert(ctx context.Context, name string) (*IssuedCert, error) {
+	sharedDir := filepath.Join(s.baseDir, "shared", name)
+
+	certPath := filepath.Join(sharedDir, name+".crt")
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("shared certificate %q not found", name)
+		}
+		return nil, fmt.Errorf("reading shared certificate: %w", err)
+	}
+
+	var chainPEM []byte
+	chainPath := filepath.Join(sharedDir, name+".chain.crt")
+	if chainData, err := os.ReadFile(chainPath); err == nil {
+		chainPEM = chainData
+	}
+
+	keyPath := filepath.Join(sharedDir, name+".key.age")
+	keyPEM, err := s.decryptFile(ctx, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting shared certificate private key: %w", err)
+	}
+
+	info, err := ParseCertInfo(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parsing shared certificate info: %w", err)
+	}
+
+	return &IssuedCert{
+		CertPEM:    certPEM,
+		KeyPEM:     keyPEM,
+		ChainPEM:   chainPEM,
+		Hostname:   name,
+		Name:       name,
+		Serial:     info.Serial,
+		NotBefore:  info.NotBefore,
+		NotAfter:   info.NotAfter,
+		SANs:       info.SANs,
+		Thumbprint: info.Thumbprint,
+	}, nil
+}
+
+// SharedCertExists checks if a shared certificate has been issued
+func (s *Store) SharedCertExists(name string) bool {
+	certPath := filepath.Join(s.baseDir, "shared", name, name+".crt")
+	_, err := os.Stat(certPath)
+	return err == nil
+}
+
+// ListSharedCerts returns the names of all issued shared certificates
+func (s *Store) ListSharedCerts() ([]string, error) {
+	sharedDir := filepath.Join(s.baseDir, "shared")
+
+	entries, err := os.ReadDir(sharedDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// GetSharedCertInfo reads and parses a shared certificate from disk
+func (s *Store) GetSharedCertInfo(name string) (*CertInfo, error) {
+	certPath := filepath.Join(s.baseDir, "shared", name, name+".crt")
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := ParseCertInfo(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	info.Name = name
+	return info, nil
+}
+
 // CertInfo contains parsed certificate information
 type CertInfo struct {
 	Hostname   string
@@ -369,6 +662,19 @@ type CertInfo struct {
 	Thumbprint string
 	DaysLeft   int
 	Status     string // "valid", "expiring", "expired"
+	Algorithm  string // public key algorithm, e.g. "ECDSA"
+
+	// AgentManaged is true if this certificate's last renewal came from the
+	// on-host renewal agent rather than a central push. Only set by
+	// GetNamedCertInfo/GetCertInfo, which have a Store to check against.
+	AgentManaged bool
+
+	// KeyCreatedAt and KeyAgeDays describe the private key backing this
+	// certificate, which - under a reuseKey renewal (see
+	// Deployer.RenewCert) - can be considerably older than the certificate
+	// itself. Only set by GetNamedCertInfo/GetCertInfo.
+	KeyCreatedAt time.Time
+	KeyAgeDays   int
 }
 
 // ParseCertInfo parses a PEM-encoded certificate and returns its metadata
@@ -413,6 +719,7 @@ func ParseCertInfo(certPEM []byte) (*CertInfo, error) {
 		Thumbprint: computeThumbprint(block.Bytes),
 		DaysLeft:   daysLeft,
 		Status:     status,
+		Algorithm:  cert.PublicKeyAlgorithm.String(),
 	}, nil
 }
 
@@ -436,9 +743,161 @@ func (s *Store) GetNamedCertInfo(hostname, certName string) (*CertInfo, error) {
 		return nil, err
 	}
 	info.Name = certName
+	info.AgentManaged = s.IsAgentManaged(hostname, certName)
+	if keyCreatedAt, err := s.KeyCreatedAt(hostname, certName); err == nil {
+		info.KeyCreatedAt = keyCreatedAt
+		info.KeyAgeDays = int(time.Since(keyCreatedAt).Hours() / 24)
+	}
 	return info, nil
 }
 
+// requestsDir returns the directory holding intake request records.
+func (s *Store) requestsDir() string {
+	return filepath.Join(s.baseDir, "requests")
+}
+
+// SaveRequest writes or overwrites a certificate intake request record.
+// Unlike host certs and CA keys, requests carry no private key material -
+// the requester keeps that - so this is plain JSON, not age-encrypted.
+func (s *Store) SaveRequest(req *CertIntakeRequest) error {
+	if err := os.MkdirAll(s.requestsDir(), 0755); err != nil {
+		return fmt.Errorf("creating requests directory: %w", err)
+	}
+	data, err := json.MarshalIndent(req, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding request: %w", err)
+	}
+	return os.WriteFile(filepath.Join(s.requestsDir(), req.ID+".json"), data, 0644)
+}
+
+// LoadRequest reads a single request record by ID.
+func (s *Store) LoadRequest(id string) (*CertIntakeRequest, error) {
+	data, err := os.ReadFile(filepath.Join(s.requestsDir(), id+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("request %q not found", id)
+		}
+		return nil, fmt.Errorf("reading request: %w", err)
+	}
+	var req CertIntakeRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("parsing request: %w", err)
+	}
+	return &req, nil
+}
+
+// ListRequests returns every request record, oldest first.
+func (s *Store) ListRequests() ([]*CertIntakeRequest, error) {
+	entries, err := os.ReadDir(s.requestsDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var requests []*CertIntakeRequest
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		req, err := s.LoadRequest(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, req)
+	}
+
+	sort.Slice(requests, func(i, j int) bool { return requests[i].CreatedAt.Before(requests[j].CreatedAt) })
+	return requests, nil
+}
+
+// ExpirePendingRequests marks every pending request whose ExpiresAt has
+// passed as RequestExpired, persisting the change, and returns how many it
+// updated. `pki requests list` calls this before rendering so an expired
+// request never shows as actionable.
+func (s *Store) ExpirePendingRequests() (int, error) {
+	requests, err := s.ListRequests()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	expired := 0
+	for _, req := range requests {
+		if req.Status != RequestPending || now.Before(req.ExpiresAt) {
+			continue
+		}
+		req.Status = RequestExpired
+		if err := s.SaveRequest(req); err != nil {
+			return expired, fmt.Errorf("expiring request %s: %w", req.ID, err)
+		}
+		expired++
+	}
+
+	return expired, nil
+}
+
+// key backend helpers
+
+func (s *Store) caKeyBackendPath() string {
+	return filepath.Join(s.baseDir, "ca", "root.key-backend.json")
+}
+
+func (s *Store) intermediateKeyBackendPath() string {
+	return filepath.Join(s.baseDir, "ca", "intermediate.key-backend.json")
+}
+
+func (s *Store) saveKeyBackendMeta(path string, meta *KeyBackendMeta) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating CA directory: %w", err)
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding key backend metadata: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("writing key backend metadata: %w", err)
+	}
+	return nil
+}
+
+// loadKeyBackendMeta returns nil, nil if path doesn't exist - the CA uses
+// the default in-memory key backend.
+func (s *Store) loadKeyBackendMeta(path string) (*KeyBackendMeta, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var meta KeyBackendMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("parsing key backend metadata: %w", err)
+	}
+	return &meta, nil
+}
+
+// openKeyBackendSigner opens the hardware backend described by meta,
+// resolving the token PIN from NIXFLEET_PKCS11_PIN or, if unset, an
+// interactive prompt.
+func (s *Store) openKeyBackendSigner(meta *KeyBackendMeta) (crypto.Signer, error) {
+	if meta.Type != KeyBackendPKCS11 {
+		return nil, fmt.Errorf("unsupported key backend %q", meta.Type)
+	}
+	pin, err := ResolvePKCS11PIN(meta.TokenLabel)
+	if err != nil {
+		return nil, err
+	}
+	return OpenPKCS11Signer(PKCS11Config{
+		Module:     meta.Module,
+		TokenLabel: meta.TokenLabel,
+		KeyLabel:   meta.KeyLabel,
+		PIN:        pin,
+	})
+}
+
 // encryption helpers
 
 func (s *Store) encryptAndSave(data []byte, path string) error {
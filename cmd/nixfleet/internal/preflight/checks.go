@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/nixfleet/nixfleet/internal/ssh"
 )
@@ -356,3 +357,186 @@ func (c *Checker) checkNixDaemonLaunchd(ctx context.Context, client *ssh.Client)
 func (c *Checker) CheckNixDaemonLaunchd(ctx context.Context, client *ssh.Client) CheckResult {
 	return c.checkNixDaemonLaunchd(ctx, client)
 }
+
+// readinessFreeSpaceFloorKB is the minimum free space required on /nix when
+// the caller doesn't know the closure size yet (requiredBytes <= 0) - a
+// sanity floor, not a substitute for the real check once GetClosureSize
+// has an answer.
+const readinessFreeSpaceFloorKB = 100 * 1024 // 100MB
+
+// ReadinessResult is the outcome of a target-readiness probe, run
+// immediately before a host's closure copy begins. Unlike PreflightResults
+// (which gates the whole apply up front, once, from a fixed check list),
+// a readiness failure produces a clean skip for just that host - every
+// other host in the run is unaffected - instead of an apply dying mid-copy
+// with a wedged nix-daemon or a full /nix.
+type ReadinessResult struct {
+	Host   string        `json:"host"`
+	Ready  bool          `json:"ready"`
+	Reason string        `json:"reason,omitempty"` // set to the first failing check's message when Ready is false
+	Checks []CheckResult `json:"checks"`
+}
+
+// CheckTargetReadiness verifies a host can actually receive requiredBytes
+// worth of closure before the copy starts: the Nix daemon responds to a
+// store ping, /nix is writable with enough free space, and the system
+// profile directory is writable. requiredBytes <= 0 (closure size unknown)
+// falls back to readinessFreeSpaceFloorKB.
+func (c *Checker) CheckTargetReadiness(ctx context.Context, client *ssh.Client, requiredBytes int64) ReadinessResult {
+	result := ReadinessResult{
+		Host: client.Host(),
+		Checks: []CheckResult{
+			c.checkNixDaemonPing(ctx, client),
+			c.checkNixStoreWritable(ctx, client, requiredBytes),
+			c.checkProfileWritable(ctx, client),
+		},
+	}
+
+	result.Ready = true
+	for _, chk := range result.Checks {
+		if !chk.Passed {
+			result.Ready = false
+			if result.Reason == "" {
+				result.Reason = chk.Message
+			}
+		}
+	}
+	return result
+}
+
+// checkNixDaemonPing verifies the Nix daemon actually responds, rather than
+// just being installed - `nix store ping` talks to the daemon store the
+// same way an activation's `nix-env`/`nixos-rebuild` copy would.
+func (c *Checker) checkNixDaemonPing(ctx context.Context, client *ssh.Client) CheckResult {
+	result := CheckResult{Name: "nix_daemon_ping"}
+
+	output, err := client.Exec(ctx, "nix store ping --store daemon")
+	if err != nil || output.ExitCode != 0 {
+		result.Passed = false
+		result.Message = "Nix daemon did not respond to a store ping"
+		if err != nil {
+			result.Details = err.Error()
+		} else {
+			result.Details = strings.TrimSpace(output.Stderr)
+		}
+		return result
+	}
+
+	result.Passed = true
+	result.Message = "Nix daemon responded"
+	return result
+}
+
+// checkNixStoreWritable verifies /nix accepts a new file and has enough
+// free space for requiredBytes - the two ways a store that's been
+// remounted read-only or filled up would otherwise only surface as a copy
+// failure halfway through the transfer.
+func (c *Checker) checkNixStoreWritable(ctx context.Context, client *ssh.Client, requiredBytes int64) CheckResult {
+	result := CheckResult{Name: "nix_store_writable"}
+
+	probe, err := client.Exec(ctx, "t=$(mktemp /nix/.nixfleet-readiness-XXXXXX 2>&1) && rm -f \"$t\"")
+	if err != nil || probe.ExitCode != 0 {
+		result.Passed = false
+		result.Message = "/nix is not writable"
+		result.Details = strings.TrimSpace(probe.Stdout + probe.Stderr)
+		return result
+	}
+
+	minKB := requiredBytes / 1024
+	if minKB <= 0 {
+		minKB = readinessFreeSpaceFloorKB
+	}
+
+	df, err := client.Exec(ctx, "df -k /nix 2>/dev/null | tail -1 | awk '{print $4}'")
+	if err != nil || df.ExitCode != 0 {
+		result.Passed = false
+		result.Message = "Failed to check free space on /nix"
+		result.Details = strings.TrimSpace(df.Stderr)
+		return result
+	}
+
+	availKB, perr := strconv.ParseInt(strings.TrimSpace(df.Stdout), 10, 64)
+	if perr != nil {
+		result.Passed = false
+		result.Message = "Failed to parse free space on /nix"
+		result.Details = fmt.Sprintf("got: %q", strings.TrimSpace(df.Stdout))
+		return result
+	}
+
+	if availKB < minKB {
+		result.Passed = false
+		result.Message = "Insufficient free space on /nix for this closure"
+		result.Details = fmt.Sprintf("available: %dMB, need: %dMB", availKB/1024, minKB/1024)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("/nix is writable with %dMB available", availKB/1024)
+	return result
+}
+
+// checkProfileWritable verifies the system profile directory can actually
+// be updated - activation ultimately does `nix-env --profile
+// /nix/var/nix/profiles/system -p ...`, and a permissions problem there
+// otherwise only shows up after the copy has already completed.
+func (c *Checker) checkProfileWritable(ctx context.Context, client *ssh.Client) CheckResult {
+	result := CheckResult{Name: "profile_writable"}
+
+	output, err := client.ExecSudo(ctx, "test -w /nix/var/nix/profiles && echo writable || echo not-writable")
+	if err != nil {
+		result.Passed = false
+		result.Message = "Failed to check the system profile directory"
+		result.Details = err.Error()
+		return result
+	}
+
+	if strings.TrimSpace(output.Stdout) != "writable" {
+		result.Passed = false
+		result.Message = "System profile directory is not writable"
+		result.Details = strings.TrimSpace(output.Stdout + output.Stderr)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = "System profile directory is writable"
+	return result
+}
+
+// ReadinessCache remembers each host's target-readiness result for the
+// life of a single apply run, so a host visited more than once in the same
+// run (e.g. a retried stage) isn't re-probed. Callers create one per run,
+// not one per Server - store health can change between runs.
+type ReadinessCache struct {
+	mu      sync.Mutex
+	results map[string]ReadinessResult
+}
+
+// NewReadinessCache creates an empty ReadinessCache.
+func NewReadinessCache() *ReadinessCache {
+	return &ReadinessCache{results: make(map[string]ReadinessResult)}
+}
+
+// Get returns client's cached readiness result, probing and caching it via
+// checker if this is the first time this run has seen client's host. The
+// mutex only guards the map itself - CheckTargetReadiness's network
+// round-trip runs unlocked, so concurrent callers probing different hosts
+// (e.g. a --parallel apply run) aren't serialized behind one another. Two
+// callers racing on the same uncached host both probe it; the second
+// write just overwrites the first with an equivalent result.
+func (rc *ReadinessCache) Get(ctx context.Context, checker *Checker, client *ssh.Client, requiredBytes int64) ReadinessResult {
+	host := client.Host()
+
+	rc.mu.Lock()
+	cached, ok := rc.results[host]
+	rc.mu.Unlock()
+	if ok {
+		return cached
+	}
+
+	result := checker.CheckTargetReadiness(ctx, client, requiredBytes)
+
+	rc.mu.Lock()
+	rc.results[host] = result
+	rc.mu.Unlock()
+	return result
+}
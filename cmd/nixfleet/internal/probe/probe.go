@@ -0,0 +1,330 @@
+// Package probe implements a unified health/readiness check engine: TCP
+// ports, HTTP endpoints, systemd/launchd units, and arbitrary commands, each
+// with its own timeout and retry count. It's shared by the apply pipeline's
+// post-activation gate, the reboot orchestrator's "host is back"
+// determination, and the server's periodic health scheduler, so every
+// consumer reports pass/fail the same way. TCP and HTTP checks run directly
+// over the network; systemd, launchd, and command checks need host-local
+// visibility and go through an Exec function the caller supplies (typically
+// wrapping an SSH client) - probe deliberately doesn't import internal/ssh,
+// since internal/ssh already imports internal/inventory, and Config lives on
+// inventory.Host/Group.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxProbeBodyBytes caps how much of an HTTP probe's response body
+// checkHTTP reads for an ExpectedBody substring match, so a misbehaving or
+// hostile endpoint can't make a probe hang reading an unbounded body.
+const maxProbeBodyBytes = 1 << 20 // 1MiB
+
+// Type identifies what kind of probe to run.
+type Type string
+
+const (
+	TypeTCP     Type = "tcp"     // dial host:port
+	TypeHTTP    Type = "http"    // GET a URL, check status and optional body substring
+	TypeSystemd Type = "systemd" // systemd unit is active
+	TypeLaunchd Type = "launchd" // launchd service has a running PID
+	TypeCommand Type = "command" // run a command, check exit code
+)
+
+// Config defines a single probe.
+type Config struct {
+	Name   string `yaml:"name" json:"name"`
+	Type   Type   `yaml:"type" json:"type"`
+	Target string `yaml:"target" json:"target"` // host:port, URL, unit/service name, or command
+
+	ExpectedStatus int    `yaml:"expected_status,omitempty" json:"expected_status,omitempty"` // http, default 200
+	ExpectedBody   string `yaml:"expected_body,omitempty" json:"expected_body,omitempty"`     // http, substring match
+	ExpectedExit   int    `yaml:"expected_exit,omitempty" json:"expected_exit,omitempty"`     // command, default 0
+
+	Timeout time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Retries int           `yaml:"retries,omitempty" json:"retries,omitempty"`
+
+	// Interval is how often a periodic scheduler (e.g. the server's health
+	// scheduler) should re-run this probe. One-shot callers (apply, reboot)
+	// ignore it.
+	Interval time.Duration `yaml:"interval,omitempty" json:"interval,omitempty"`
+}
+
+// Result is the outcome of running one probe.
+type Result struct {
+	Name    string        `json:"name"`
+	Type    Type          `json:"type"`
+	Passed  bool          `json:"passed"`
+	Message string        `json:"message"`
+	Latency time.Duration `json:"latency"`
+}
+
+// Results is the outcome of running a set of probes against one host.
+type Results struct {
+	Host   string   `json:"host"`
+	Passed bool     `json:"passed"`
+	Checks []Result `json:"checks"`
+}
+
+// Summary returns a short human-readable pass count, e.g. "2/3 probes passed".
+func (r *Results) Summary() string {
+	passed := 0
+	for _, c := range r.Checks {
+		if c.Passed {
+			passed++
+		}
+	}
+	return fmt.Sprintf("%d/%d probes passed", passed, len(r.Checks))
+}
+
+// ExecResult is the outcome of running a command via Exec.
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Exec runs cmd on the target host and returns its result. Callers with an
+// SSH client adapt it, e.g.:
+//
+//	func(ctx context.Context, cmd string) (*probe.ExecResult, error) {
+//		r, err := client.Exec(ctx, cmd)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return &probe.ExecResult{Stdout: r.Stdout, Stderr: r.Stderr, ExitCode: r.ExitCode}, nil
+//	}
+type Exec func(ctx context.Context, cmd string) (*ExecResult, error)
+
+// Engine runs probes against a host.
+type Engine struct{}
+
+// NewEngine creates a new probe engine.
+func NewEngine() *Engine {
+	return &Engine{}
+}
+
+// Run executes configs against a host and returns the aggregate result.
+// exec may be nil if every config is tcp/http (checked directly over the
+// network against addr); systemd, launchd, and command probes require a
+// non-nil exec and fail if none is given.
+func (e *Engine) Run(ctx context.Context, exec Exec, addr string, configs []Config) *Results {
+	results := &Results{Host: addr, Passed: true}
+
+	for _, cfg := range configs {
+		results.Checks = append(results.Checks, e.runWithRetries(ctx, exec, addr, cfg))
+	}
+
+	for _, c := range results.Checks {
+		if !c.Passed {
+			results.Passed = false
+			break
+		}
+	}
+
+	return results
+}
+
+func (e *Engine) runWithRetries(ctx context.Context, exec Exec, addr string, cfg Config) Result {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Retries == 0 {
+		cfg.Retries = 1
+	}
+
+	var result Result
+	for attempt := 0; attempt < cfg.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(2 * time.Second)
+		}
+		result = e.RunOne(ctx, exec, addr, cfg)
+		if result.Passed {
+			break
+		}
+	}
+	if !result.Passed && cfg.Retries > 1 {
+		result.Message = fmt.Sprintf("failed after %d attempts: %s", cfg.Retries, result.Message)
+	}
+	return result
+}
+
+// RunOne runs a single probe once, with no retries.
+func (e *Engine) RunOne(ctx context.Context, exec Exec, addr string, cfg Config) Result {
+	start := time.Now()
+	var result Result
+
+	switch cfg.Type {
+	case TypeTCP:
+		result = e.checkTCP(addr, cfg)
+	case TypeHTTP:
+		result = e.checkHTTP(ctx, cfg)
+	case TypeSystemd:
+		result = e.checkSystemd(ctx, exec, cfg)
+	case TypeLaunchd:
+		result = e.checkLaunchd(ctx, exec, cfg)
+	case TypeCommand:
+		result = e.checkCommand(ctx, exec, cfg)
+	default:
+		result.Message = fmt.Sprintf("unknown probe type %q", cfg.Type)
+	}
+
+	result.Name = cfg.Name
+	result.Type = cfg.Type
+	result.Latency = time.Since(start)
+	return result
+}
+
+// checkTCP dials Target directly over the network. If Target has no host
+// part (e.g. ":8080"), addr is used.
+func (e *Engine) checkTCP(addr string, cfg Config) Result {
+	result := Result{}
+
+	target := cfg.Target
+	if strings.HasPrefix(target, ":") {
+		target = addr + target
+	}
+
+	conn, err := net.DialTimeout("tcp", target, cfg.Timeout)
+	if err != nil {
+		result.Message = fmt.Sprintf("dial %s failed: %v", target, err)
+		return result
+	}
+	conn.Close()
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("connected to %s", target)
+	return result
+}
+
+// checkHTTP performs an HTTP GET directly over the network.
+func (e *Engine) checkHTTP(ctx context.Context, cfg Config) Result {
+	result := Result{}
+
+	expectedStatus := cfg.ExpectedStatus
+	if expectedStatus == 0 {
+		expectedStatus = 200
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, cfg.Target, nil)
+	if err != nil {
+		result.Message = fmt.Sprintf("building request for %s: %v", cfg.Target, err)
+		return result
+	}
+
+	client := &http.Client{Timeout: cfg.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Message = fmt.Sprintf("GET %s failed: %v", cfg.Target, err)
+		return result
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != expectedStatus {
+		result.Message = fmt.Sprintf("GET %s returned %d, expected %d", cfg.Target, resp.StatusCode, expectedStatus)
+		return result
+	}
+
+	if cfg.ExpectedBody != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBodyBytes))
+		if err != nil {
+			result.Message = fmt.Sprintf("GET %s: reading body: %v", cfg.Target, err)
+			return result
+		}
+		if !strings.Contains(string(body), cfg.ExpectedBody) {
+			result.Message = fmt.Sprintf("GET %s body missing %q", cfg.Target, cfg.ExpectedBody)
+			return result
+		}
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("GET %s returned %d", cfg.Target, resp.StatusCode)
+	return result
+}
+
+// checkSystemd checks that a systemd unit is active.
+func (e *Engine) checkSystemd(ctx context.Context, exec Exec, cfg Config) Result {
+	result := Result{}
+	if exec == nil {
+		result.Message = "systemd probe requires exec"
+		return result
+	}
+
+	output, err := exec(ctx, fmt.Sprintf("systemctl is-active %s", cfg.Target))
+	if err != nil {
+		result.Message = fmt.Sprintf("checking unit %s: %v", cfg.Target, err)
+		return result
+	}
+
+	status := strings.TrimSpace(output.Stdout)
+	if status != "active" {
+		result.Message = fmt.Sprintf("unit %s is %s", cfg.Target, status)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("unit %s is active", cfg.Target)
+	return result
+}
+
+// checkLaunchd checks that a launchd service has a running PID.
+func (e *Engine) checkLaunchd(ctx context.Context, exec Exec, cfg Config) Result {
+	result := Result{}
+	if exec == nil {
+		result.Message = "launchd probe requires exec"
+		return result
+	}
+
+	output, err := exec(ctx, fmt.Sprintf("launchctl list %s 2>/dev/null", cfg.Target))
+	if err != nil || output.ExitCode != 0 {
+		result.Message = fmt.Sprintf("service %s not found", cfg.Target)
+		return result
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.Stdout), "\n")
+	if len(lines) > 0 {
+		fields := strings.Fields(lines[0])
+		if len(fields) >= 1 && fields[0] == "-" {
+			result.Message = fmt.Sprintf("service %s is loaded but not running", cfg.Target)
+			return result
+		}
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("service %s is running", cfg.Target)
+	return result
+}
+
+// checkCommand runs a command and checks its exit code.
+func (e *Engine) checkCommand(ctx context.Context, exec Exec, cfg Config) Result {
+	result := Result{}
+	if exec == nil {
+		result.Message = "command probe requires exec"
+		return result
+	}
+
+	cmd := fmt.Sprintf("timeout %d %s", int(cfg.Timeout.Seconds()), cfg.Target)
+	output, err := exec(ctx, cmd)
+	if err != nil {
+		result.Message = fmt.Sprintf("running %q: %v", cfg.Target, err)
+		return result
+	}
+
+	if output.ExitCode != cfg.ExpectedExit {
+		result.Message = fmt.Sprintf("%q exited %d, expected %d: %s", cfg.Target, output.ExitCode, cfg.ExpectedExit, strings.TrimSpace(output.Stderr))
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("%q exited %d", cfg.Target, output.ExitCode)
+	return result
+}
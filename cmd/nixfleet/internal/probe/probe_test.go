@@ -0,0 +1,292 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckTCPSuccess(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	e := NewEngine()
+	result := e.checkTCP("ignored", Config{Target: ln.Addr().String(), Timeout: time.Second})
+	if !result.Passed {
+		t.Errorf("expected success, got: %s", result.Message)
+	}
+}
+
+func TestCheckTCPUsesAddrWhenTargetIsPortOnly(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("splitting host/port: %v", err)
+	}
+
+	e := NewEngine()
+	result := e.checkTCP("127.0.0.1", Config{Target: ":" + port, Timeout: time.Second})
+	if !result.Passed {
+		t.Errorf("expected success, got: %s", result.Message)
+	}
+}
+
+func TestCheckTCPFailure(t *testing.T) {
+	e := NewEngine()
+	result := e.checkTCP("ignored", Config{Target: "127.0.0.1:1", Timeout: 100 * time.Millisecond})
+	if result.Passed {
+		t.Error("expected failure dialing a closed port")
+	}
+}
+
+func TestCheckHTTPStatusAndBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "status: ok")
+	}))
+	defer srv.Close()
+
+	e := NewEngine()
+	result := e.checkHTTP(context.Background(), Config{Target: srv.URL, ExpectedBody: "status: ok", Timeout: time.Second})
+	if !result.Passed {
+		t.Errorf("expected success, got: %s", result.Message)
+	}
+}
+
+func TestCheckHTTPWrongStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	e := NewEngine()
+	result := e.checkHTTP(context.Background(), Config{Target: srv.URL, Timeout: time.Second})
+	if result.Passed {
+		t.Error("expected failure on unexpected status code")
+	}
+}
+
+// TestCheckHTTPBodyMatchAcrossMultipleReads covers a body whose matching
+// substring doesn't arrive in a single TCP read - io.Reader.Read isn't
+// required to fill its buffer or return a whole chunked body in one call,
+// so a single Read() for the ExpectedBody check can miss a real match.
+// This server flushes one byte at a time to force the client to make
+// several reads before it has enough of the body to see the match.
+func TestCheckHTTPBodyMatchAcrossMultipleReads(t *testing.T) {
+	body := strings.Repeat("x", 100) + "needle" + strings.Repeat("y", 100)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("ResponseWriter does not support flushing")
+		}
+		for _, b := range []byte(body) {
+			w.Write([]byte{b})
+			flusher.Flush()
+		}
+	}))
+	defer srv.Close()
+
+	e := NewEngine()
+	result := e.checkHTTP(context.Background(), Config{Target: srv.URL, ExpectedBody: "needle", Timeout: 5 * time.Second})
+	if !result.Passed {
+		t.Errorf("expected the body match to succeed even though the server streamed it one byte at a time, got: %s", result.Message)
+	}
+}
+
+func TestCheckSystemdActive(t *testing.T) {
+	exec := func(ctx context.Context, cmd string) (*ExecResult, error) {
+		return &ExecResult{Stdout: "active\n"}, nil
+	}
+
+	e := NewEngine()
+	result := e.checkSystemd(context.Background(), exec, Config{Target: "nginx"})
+	if !result.Passed {
+		t.Errorf("expected success, got: %s", result.Message)
+	}
+}
+
+func TestCheckSystemdInactive(t *testing.T) {
+	exec := func(ctx context.Context, cmd string) (*ExecResult, error) {
+		return &ExecResult{Stdout: "inactive\n"}, nil
+	}
+
+	e := NewEngine()
+	result := e.checkSystemd(context.Background(), exec, Config{Target: "nginx"})
+	if result.Passed {
+		t.Error("expected failure for an inactive unit")
+	}
+}
+
+func TestCheckSystemdRequiresExec(t *testing.T) {
+	e := NewEngine()
+	result := e.checkSystemd(context.Background(), nil, Config{Target: "nginx"})
+	if result.Passed {
+		t.Error("expected failure with no exec function")
+	}
+}
+
+func TestCheckLaunchdRunning(t *testing.T) {
+	exec := func(ctx context.Context, cmd string) (*ExecResult, error) {
+		return &ExecResult{Stdout: "1234\t0\tcom.example.service\n", ExitCode: 0}, nil
+	}
+
+	e := NewEngine()
+	result := e.checkLaunchd(context.Background(), exec, Config{Target: "com.example.service"})
+	if !result.Passed {
+		t.Errorf("expected success, got: %s", result.Message)
+	}
+}
+
+func TestCheckLaunchdLoadedButNotRunning(t *testing.T) {
+	exec := func(ctx context.Context, cmd string) (*ExecResult, error) {
+		return &ExecResult{Stdout: "-\t0\tcom.example.service\n", ExitCode: 0}, nil
+	}
+
+	e := NewEngine()
+	result := e.checkLaunchd(context.Background(), exec, Config{Target: "com.example.service"})
+	if result.Passed {
+		t.Error("expected failure for a loaded-but-not-running service")
+	}
+}
+
+func TestCheckLaunchdNotFound(t *testing.T) {
+	exec := func(ctx context.Context, cmd string) (*ExecResult, error) {
+		return &ExecResult{ExitCode: 1}, nil
+	}
+
+	e := NewEngine()
+	result := e.checkLaunchd(context.Background(), exec, Config{Target: "com.example.missing"})
+	if result.Passed {
+		t.Error("expected failure when the service isn't found")
+	}
+}
+
+func TestCheckCommandExitCode(t *testing.T) {
+	exec := func(ctx context.Context, cmd string) (*ExecResult, error) {
+		return &ExecResult{ExitCode: 0}, nil
+	}
+
+	e := NewEngine()
+	result := e.checkCommand(context.Background(), exec, Config{Target: "true", Timeout: time.Second})
+	if !result.Passed {
+		t.Errorf("expected success, got: %s", result.Message)
+	}
+}
+
+func TestCheckCommandUnexpectedExitCode(t *testing.T) {
+	exec := func(ctx context.Context, cmd string) (*ExecResult, error) {
+		return &ExecResult{ExitCode: 1, Stderr: "boom"}, nil
+	}
+
+	e := NewEngine()
+	result := e.checkCommand(context.Background(), exec, Config{Target: "false", Timeout: time.Second})
+	if result.Passed {
+		t.Error("expected failure for a nonzero exit code")
+	}
+}
+
+func TestRunWithRetriesSucceedsAfterFailures(t *testing.T) {
+	attempts := 0
+	exec := func(ctx context.Context, cmd string) (*ExecResult, error) {
+		attempts++
+		if attempts < 3 {
+			return &ExecResult{ExitCode: 1}, nil
+		}
+		return &ExecResult{ExitCode: 0}, nil
+	}
+
+	e := &Engine{}
+	result := e.runWithRetries(context.Background(), exec, "host", Config{
+		Type: TypeCommand, Target: "flaky", Retries: 3, Timeout: time.Second,
+	})
+	if !result.Passed {
+		t.Errorf("expected eventual success, got: %s", result.Message)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRunWithRetriesReportsAttemptCountOnFailure(t *testing.T) {
+	exec := func(ctx context.Context, cmd string) (*ExecResult, error) {
+		return &ExecResult{ExitCode: 1}, nil
+	}
+
+	e := &Engine{}
+	result := e.runWithRetries(context.Background(), exec, "host", Config{
+		Type: TypeCommand, Target: "always-fails", Retries: 2, Timeout: time.Second,
+	})
+	if result.Passed {
+		t.Fatal("expected failure")
+	}
+	if !strings.Contains(result.Message, "failed after 2 attempts") {
+		t.Errorf("expected message to report attempt count, got: %s", result.Message)
+	}
+}
+
+func TestRunAggregatesPassFail(t *testing.T) {
+	exec := func(ctx context.Context, cmd string) (*ExecResult, error) {
+		if strings.Contains(cmd, "ok") {
+			return &ExecResult{ExitCode: 0}, nil
+		}
+		return &ExecResult{ExitCode: 1}, nil
+	}
+
+	e := NewEngine()
+	results := e.Run(context.Background(), exec, "host", []Config{
+		{Name: "good", Type: TypeCommand, Target: "ok", Timeout: time.Second, Retries: 1},
+		{Name: "bad", Type: TypeCommand, Target: "fail", Timeout: time.Second, Retries: 1},
+	})
+
+	if results.Passed {
+		t.Error("expected overall failure when one check fails")
+	}
+	if len(results.Checks) != 2 {
+		t.Fatalf("expected 2 checks, got %d", len(results.Checks))
+	}
+	if got := results.Summary(); got != "1/2 probes passed" {
+		t.Errorf("Summary() = %q, want %q", got, "1/2 probes passed")
+	}
+}
+
+func TestRunOneUnknownType(t *testing.T) {
+	e := NewEngine()
+	result := e.RunOne(context.Background(), nil, "host", Config{Name: "mystery", Type: "bogus"})
+	if result.Passed {
+		t.Error("expected failure for an unknown probe type")
+	}
+	if !strings.Contains(result.Message, "unknown probe type") {
+		t.Errorf("unexpected message: %s", result.Message)
+	}
+}
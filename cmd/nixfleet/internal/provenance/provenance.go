@@ -0,0 +1,358 @@
+// Package provenance records and verifies signed build provenance for
+// deployed Nix closures: who built a store path, from what git commit, with
+// what nix version, and when. Records are signed with a dedicated ed25519
+// key managed like the PKI keys in internal/pki - a plain public key and an
+// age-encrypted private key under a base directory (conventionally
+// "secrets/provenance").
+package provenance
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Record is a signed statement that a specific store path was built from a
+// specific git commit by a specific builder. One Record is stored per store
+// path in the Store's base directory.
+type Record struct {
+	StorePath    string    `json:"store_path"`
+	HostName     string    `json:"host_name"`
+	ManifestHash string    `json:"manifest_hash"`
+	GitCommit    string    `json:"git_commit"`
+	GitDirty     bool      `json:"git_dirty"`
+	Builder      string    `json:"builder"`
+	NixVersion   string    `json:"nix_version"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	// PublicKey and Signature are populated by Sign. PublicKey is embedded
+	// so Verify doesn't need access to the signing key's storage location.
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
+
+// signingBytes returns the canonical bytes that get signed - the record
+// with PublicKey/Signature cleared, so verification doesn't depend on
+// signature stripping order.
+func (r *Record) signingBytes() ([]byte, error) {
+	unsigned := *r
+	unsigned.PublicKey = ""
+	unsigned.Signature = ""
+	return json.Marshal(unsigned)
+}
+
+// Store manages provenance records and the signing key on disk.
+type Store struct {
+	baseDir    string   // Base directory (usually "secrets/provenance")
+	recipients []string // Age recipients for encrypting the signing key
+	identities []string // Age identity files for decrypting the signing key
+}
+
+// NewStore creates a new provenance store rooted at baseDir.
+func NewStore(baseDir string, recipients, identities []string) *Store {
+	return &Store{
+		baseDir:    baseDir,
+		recipients: recipients,
+		identities: identities,
+	}
+}
+
+func (s *Store) keyPath() string    { return filepath.Join(s.baseDir, "signing.key.age") }
+func (s *Store) pubKeyPath() string { return filepath.Join(s.baseDir, "signing.pub") }
+
+// KeyExists reports whether a signing key has already been generated.
+func (s *Store) KeyExists() bool {
+	_, pubErr := os.Stat(s.pubKeyPath())
+	_, keyErr := os.Stat(s.keyPath())
+	return pubErr == nil && keyErr == nil
+}
+
+// GenerateKey creates a new ed25519 signing key, storing the public half in
+// plain text and the private half age-encrypted, following the same layout
+// internal/pki uses for CA keys.
+func (s *Store) GenerateKey() error {
+	if len(s.recipients) == 0 {
+		return fmt.Errorf("no age recipients configured")
+	}
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return fmt.Errorf("generating signing key: %w", err)
+	}
+
+	if err := os.MkdirAll(s.baseDir, 0755); err != nil {
+		return fmt.Errorf("creating provenance directory: %w", err)
+	}
+
+	pubEncoded := base64.StdEncoding.EncodeToString(pub)
+	if err := os.WriteFile(s.pubKeyPath(), []byte(pubEncoded+"\n"), 0644); err != nil {
+		return fmt.Errorf("writing public key: %w", err)
+	}
+
+	privEncoded := base64.StdEncoding.EncodeToString(priv)
+	if err := s.encryptAndSave([]byte(privEncoded), s.keyPath()); err != nil {
+		return fmt.Errorf("encrypting signing key: %w", err)
+	}
+
+	return nil
+}
+
+// PublicKey returns the base64-encoded ed25519 public key.
+func (s *Store) PublicKey() (string, error) {
+	data, err := os.ReadFile(s.pubKeyPath())
+	if err != nil {
+		return "", fmt.Errorf("reading public key: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (s *Store) loadPrivateKey(ctx context.Context) (ed25519.PrivateKey, error) {
+	data, err := s.decryptFile(ctx, s.keyPath())
+	if err != nil {
+		return nil, fmt.Errorf("decrypting signing key: %w", err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("decoding signing key: %w", err)
+	}
+	return ed25519.PrivateKey(raw), nil
+}
+
+// Capture gathers a provenance Record for a newly-built closure, deriving
+// the git commit and dirty flag from flakePath's checkout and the builder
+// identity from the current process's user and host.
+func Capture(flakePath, hostName, storePath, manifestHash string) *Record {
+	commit, dirty := gitInfo(flakePath)
+
+	return &Record{
+		StorePath:    storePath,
+		HostName:     hostName,
+		ManifestHash: manifestHash,
+		GitCommit:    commit,
+		GitDirty:     dirty,
+		Builder:      builderIdentity(),
+		NixVersion:   nixVersion(),
+		CreatedAt:    time.Now(),
+	}
+}
+
+// Sign signs the record with the store's signing key, generating one first
+// if none exists yet.
+func (s *Store) Sign(ctx context.Context, r *Record) error {
+	if !s.KeyExists() {
+		if err := s.GenerateKey(); err != nil {
+			return err
+		}
+	}
+
+	priv, err := s.loadPrivateKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	pub, err := s.PublicKey()
+	if err != nil {
+		return err
+	}
+	r.PublicKey = pub
+
+	msg, err := r.signingBytes()
+	if err != nil {
+		return fmt.Errorf("encoding record: %w", err)
+	}
+	r.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, msg))
+
+	return nil
+}
+
+// Verify checks that a record's signature was produced by the store's own
+// pinned signing key (signing.pub), not whatever key happens to be embedded
+// in the record. A record embeds PublicKey for convenience (e.g. 'provenance
+// show' before a store's key is known), but trusting it for verification
+// would let anyone who can write a record generate their own keypair,
+// self-sign, and pass - so a record whose embedded key doesn't match the
+// store's is rejected outright.
+func (s *Store) Verify(r *Record) (bool, error) {
+	if r.PublicKey == "" || r.Signature == "" {
+		return false, fmt.Errorf("record has no signature")
+	}
+
+	trustedPub, err := s.PublicKey()
+	if err != nil {
+		return false, fmt.Errorf("loading store signing key: %w", err)
+	}
+	if r.PublicKey != trustedPub {
+		return false, fmt.Errorf("record was signed with a different key than this store's signing.pub")
+	}
+
+	pub, err := base64.StdEncoding.DecodeString(trustedPub)
+	if err != nil {
+		return false, fmt.Errorf("decoding public key: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil {
+		return false, fmt.Errorf("decoding signature: %w", err)
+	}
+
+	msg, err := r.signingBytes()
+	if err != nil {
+		return false, fmt.Errorf("encoding record: %w", err)
+	}
+
+	return ed25519.Verify(ed25519.PublicKey(pub), msg, sig), nil
+}
+
+// recordFileName sanitizes a nix store path into a safe file name, e.g.
+// "/nix/store/abcd-host-system" -> "abcd-host-system.json".
+func recordFileName(storePath string) string {
+	base := filepath.Base(storePath)
+	base = regexp.MustCompile(`[^A-Za-z0-9._-]`).ReplaceAllString(base, "_")
+	return base + ".json"
+}
+
+// Save writes r to the store's base directory, keyed by store path.
+func (s *Store) Save(r *Record) error {
+	if err := os.MkdirAll(s.baseDir, 0755); err != nil {
+		return fmt.Errorf("creating provenance directory: %w", err)
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding record: %w", err)
+	}
+	path := filepath.Join(s.baseDir, recordFileName(r.StorePath))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// Load reads the provenance record for storePath, if one exists.
+func (s *Store) Load(storePath string) (*Record, error) {
+	path := filepath.Join(s.baseDir, recordFileName(storePath))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// RequireValid loads the record for storePath and confirms it verifies and
+// matches manifestHash. It's the check behind --require-provenance: a
+// missing record, a bad signature, or a stale manifest hash all fail it.
+func (s *Store) RequireValid(storePath, manifestHash string) (*Record, error) {
+	r, err := s.Load(storePath)
+	if err != nil {
+		return nil, fmt.Errorf("no provenance record for %s: %w", storePath, err)
+	}
+	ok, err := s.Verify(r)
+	if err != nil {
+		return nil, fmt.Errorf("verifying provenance for %s: %w", storePath, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("provenance signature for %s does not verify", storePath)
+	}
+	if r.ManifestHash != manifestHash {
+		return nil, fmt.Errorf("provenance for %s was recorded for manifest hash %s, not %s", storePath, r.ManifestHash, manifestHash)
+	}
+	return r, nil
+}
+
+func gitInfo(repoPath string) (commit string, dirty bool) {
+	commit = runGit(repoPath, "rev-parse", "HEAD")
+	if commit == "" {
+		return "unknown", false
+	}
+	status := runGit(repoPath, "status", "--porcelain")
+	return commit, status != ""
+}
+
+func runGit(repoPath string, args ...string) string {
+	fullArgs := append([]string{"-c", "safe.directory=*", "-C", repoPath}, args...)
+	cmd := exec.Command("git", fullArgs...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(stdout.String())
+}
+
+func builderIdentity() string {
+	user := os.Getenv("USER")
+	if user == "" {
+		user = os.Getenv("USERNAME")
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	if user == "" {
+		return host
+	}
+	return user + "@" + host
+}
+
+func nixVersion() string {
+	cmd := exec.Command("nix", "--version")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(stdout.String())
+}
+
+func (s *Store) encryptAndSave(data []byte, path string) error {
+	if len(s.recipients) == 0 {
+		return fmt.Errorf("no age recipients configured")
+	}
+
+	args := []string{"--encrypt", "--armor"}
+	for _, r := range s.recipients {
+		args = append(args, "-r", r)
+	}
+	args = append(args, "-o", path)
+
+	cmd := exec.Command("age", args...)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("age encrypt failed: %s", stderr.String())
+	}
+
+	return nil
+}
+
+func (s *Store) decryptFile(ctx context.Context, path string) ([]byte, error) {
+	args := []string{"--decrypt"}
+	for _, id := range s.identities {
+		args = append(args, "-i", id)
+	}
+	args = append(args, path)
+
+	cmd := exec.CommandContext(ctx, "age", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("age decrypt failed: %s", stderr.String())
+	}
+
+	return stdout.Bytes(), nil
+}
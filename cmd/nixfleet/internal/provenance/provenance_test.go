@@ -0,0 +1,160 @@
+package provenance
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"testing"
+	"time"
+)
+
+// signedRecord generates a fresh keypair, pins its public half as store's
+// own signing.pub (the same file GenerateKey would have written), and
+// returns a record signed by the matching private key - so Verify's check
+// against the store's pinned key passes without going through age
+// encryption, which GenerateKey would otherwise require.
+func signedRecord(t *testing.T, store *Store) (*Record, ed25519.PrivateKey) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	if err := os.MkdirAll(store.baseDir, 0755); err != nil {
+		t.Fatalf("creating store dir: %v", err)
+	}
+	pubEncoded := base64.StdEncoding.EncodeToString(pub)
+	if err := os.WriteFile(store.pubKeyPath(), []byte(pubEncoded+"\n"), 0644); err != nil {
+		t.Fatalf("writing public key: %v", err)
+	}
+
+	r := &Record{
+		StorePath:    "/nix/store/abcd1234-web1-system",
+		HostName:     "web1",
+		ManifestHash: "sha256:deadbeef",
+		GitCommit:    "cafef00d",
+		Builder:      "ci@builder",
+		NixVersion:   "nix (Nix) 2.24.0",
+		CreatedAt:    time.Unix(1700000000, 0).UTC(),
+	}
+	r.PublicKey = pubEncoded
+
+	msg, err := r.signingBytes()
+	if err != nil {
+		t.Fatalf("signingBytes: %v", err)
+	}
+	r.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, msg))
+
+	return r, priv
+}
+
+func TestVerifyValidSignature(t *testing.T) {
+	store := NewStore(t.TempDir(), nil, nil)
+	r, _ := signedRecord(t, store)
+
+	ok, err := store.Verify(r)
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if !ok {
+		t.Error("expected signature to verify")
+	}
+}
+
+func TestVerifyRejectsTamperedRecord(t *testing.T) {
+	store := NewStore(t.TempDir(), nil, nil)
+	r, _ := signedRecord(t, store)
+	r.GitCommit = "tampered"
+
+	ok, err := store.Verify(r)
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if ok {
+		t.Error("expected tampered record to fail verification")
+	}
+}
+
+func TestVerifyMissingSignature(t *testing.T) {
+	store := NewStore(t.TempDir(), nil, nil)
+	r := &Record{StorePath: "/nix/store/abcd1234-web1-system"}
+	if _, err := store.Verify(r); err == nil {
+		t.Error("expected error for record with no signature")
+	}
+}
+
+func TestVerifyRejectsForeignKey(t *testing.T) {
+	store := NewStore(t.TempDir(), nil, nil)
+	r, _ := signedRecord(t, store)
+
+	forgedPub, forgedPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generating forged key: %v", err)
+	}
+	r.PublicKey = base64.StdEncoding.EncodeToString(forgedPub)
+	msg, err := r.signingBytes()
+	if err != nil {
+		t.Fatalf("signingBytes: %v", err)
+	}
+	r.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(forgedPriv, msg))
+
+	ok, err := store.Verify(r)
+	if err == nil {
+		t.Fatal("expected Verify to reject a record signed with a key other than the store's pinned signing.pub")
+	}
+	if ok {
+		t.Error("expected ok=false for a foreign-key record")
+	}
+}
+
+func TestSaveAndLoadRoundTrip(t *testing.T) {
+	store := NewStore(t.TempDir(), nil, nil)
+	r, _ := signedRecord(t, store)
+
+	if err := store.Save(r); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	loaded, err := store.Load(r.StorePath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if loaded.StorePath != r.StorePath || loaded.Signature != r.Signature {
+		t.Errorf("loaded record doesn't match saved one: %+v vs %+v", loaded, r)
+	}
+
+	ok, err := store.Verify(loaded)
+	if err != nil || !ok {
+		t.Errorf("loaded record failed to verify: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestRequireValidChecksManifestHash(t *testing.T) {
+	store := NewStore(t.TempDir(), nil, nil)
+	r, _ := signedRecord(t, store)
+
+	if err := store.Save(r); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	if _, err := store.RequireValid(r.StorePath, r.ManifestHash); err != nil {
+		t.Errorf("expected matching manifest hash to pass, got: %v", err)
+	}
+	if _, err := store.RequireValid(r.StorePath, "sha256:different"); err == nil {
+		t.Error("expected mismatched manifest hash to fail")
+	}
+}
+
+func TestRequireValidMissingRecord(t *testing.T) {
+	store := NewStore(t.TempDir(), nil, nil)
+	if _, err := store.RequireValid("/nix/store/nonexistent", "sha256:x"); err == nil {
+		t.Error("expected error for missing provenance record")
+	}
+}
+
+func TestRecordFileNameSanitizesStorePath(t *testing.T) {
+	name := recordFileName("/nix/store/abcd1234-web1-system")
+	if name != "abcd1234-web1-system.json" {
+		t.Errorf("unexpected file name: %s", name)
+	}
+}
@@ -7,7 +7,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"text/template"
 
 	"github.com/nixfleet/nixfleet/internal/ssh"
@@ -47,6 +51,41 @@ type Config struct {
 
 	// Home-manager integration (optional)
 	HomeManager *HomeManagerConfig
+
+	// BuildLeader marks this host as the fleet's build leader: it always
+	// builds from source and never substitutes from another host.
+	BuildLeader bool
+
+	// LeaderAddr is the SSH address of the build leader, used as an
+	// ssh-ng substituter by follower hosts. Empty disables substitution.
+	LeaderAddr string
+
+	// LeaderSSHUser is the SSH user to connect to the leader as when
+	// substituting (defaults to "root", since builds run as root).
+	LeaderSSHUser string
+
+	// RollbackWindow is how long a newly-applied generation has to confirm
+	// itself healthy before it's automatically rolled back (systemd timer
+	// format, e.g. "5min"). Also used as the post-boot grace period if the
+	// host reboots into the new generation before the window elapses.
+	RollbackWindow string
+
+	// BandwidthLimitKB caps the pull script's closure download speed, in
+	// KiB/s, passed through to nix as `--option download-speed`. Zero means
+	// unlimited.
+	BandwidthLimitKB int
+
+	// TransferWindow restricts the build/substitution phase (not the cheap
+	// git fetch and evaluation) to a daily local-time range, e.g.
+	// "22:00-06:00", whenever the pending download exceeds
+	// TransferThresholdMB. Empty disables deferral entirely. Evaluated
+	// against the host's own clock, since the pull script runs on the host
+	// itself. See ParseTransferWindow.
+	TransferWindow string
+
+	// TransferThresholdMB is the pending-download size, in megabytes, above
+	// which TransferWindow applies. Ignored if TransferWindow is empty.
+	TransferThresholdMB int
 }
 
 // HomeManagerConfig holds home-manager pull configuration
@@ -70,15 +109,43 @@ type HomeManagerConfig struct {
 // DefaultConfig returns a Config with sensible defaults
 func DefaultConfig() Config {
 	return Config{
-		Branch:      "main",
-		SSHKeyPath:  "/run/nixfleet-secrets/github-deploy-key",
-		AgeKeyPath:  "/root/.config/age/key.txt",
-		Interval:    "15min",
-		ApplyOnBoot: true,
-		RepoPath:    "/var/lib/nixfleet/repo",
+		Branch:              "main",
+		SSHKeyPath:          "/run/nixfleet-secrets/github-deploy-key",
+		AgeKeyPath:          "/root/.config/age/key.txt",
+		Interval:            "15min",
+		ApplyOnBoot:         true,
+		RepoPath:            "/var/lib/nixfleet/repo",
+		RollbackWindow:      "5min",
+		TransferThresholdMB: 500,
+	}
+}
+
+// ParseTransferWindow validates a transfer window string like "22:00-06:00"
+// (daily, no day-of-week - unlike reboot.ParseRebootWindow, a pull-mode
+// window is evaluated against the host's own local clock from inside the
+// generated script, not computed ahead of time from the controller, so it
+// never needs a time.Location). An empty string is valid and means "no
+// window".
+func ParseTransferWindow(s string) error {
+	if s == "" {
+		return nil
 	}
+	matches := transferWindowPattern.FindStringSubmatch(s)
+	if matches == nil {
+		return fmt.Errorf("invalid transfer window format: %s (expected 'HH:MM-HH:MM')", s)
+	}
+	startHour, _ := strconv.Atoi(matches[1])
+	startMin, _ := strconv.Atoi(matches[2])
+	endHour, _ := strconv.Atoi(matches[3])
+	endMin, _ := strconv.Atoi(matches[4])
+	if startHour > 23 || endHour > 23 || startMin > 59 || endMin > 59 {
+		return fmt.Errorf("invalid transfer window: %s", s)
+	}
+	return nil
 }
 
+var transferWindowPattern = regexp.MustCompile(`^(\d{1,2}):(\d{2})-(\d{1,2}):(\d{2})$`)
+
 // Installer handles pull mode installation on hosts
 type Installer struct{}
 
@@ -127,9 +194,16 @@ func (i *Installer) Uninstall(ctx context.Context, client *ssh.Client) error {
 	cmds := []string{
 		"systemctl stop nixfleet-pull.timer || true",
 		"systemctl disable nixfleet-pull.timer || true",
+		"systemctl stop nixfleet-confirm.timer || true",
+		"systemctl disable nixfleet-confirm.timer || true",
 		"rm -f /etc/systemd/system/nixfleet-pull.service",
 		"rm -f /etc/systemd/system/nixfleet-pull.timer",
+		"rm -f /etc/systemd/system/nixfleet-confirm.service",
+		"rm -f /etc/systemd/system/nixfleet-confirm.timer",
 		"rm -f /usr/local/bin/nixfleet-pull",
+		"rm -f /var/lib/nixfleet/pending-rollback.json",
+		"rm -f /var/lib/nixfleet/last-rollback.json",
+		"rm -f /var/lib/nixfleet/pull-deferred.json",
 		"systemctl daemon-reload",
 	}
 
@@ -188,17 +262,104 @@ func (i *Installer) Status(ctx context.Context, client *ssh.Client) (*Status, er
 		status.CurrentCommit = result.Stdout
 	}
 
+	// Get the source of the last build (built locally vs substituted from
+	// the build leader), written by the pull script after each build.
+	result, err = client.ExecSudo(ctx, "cat /var/lib/nixfleet/last-build-source 2>/dev/null || echo unknown")
+	if err == nil {
+		status.LastBuildSource = strings.TrimSpace(result.Stdout)
+	}
+
+	// A preflight secret-decryption failure leaves this file behind until
+	// the next successful preflight removes it.
+	result, err = client.ExecSudo(ctx, "cat /var/lib/nixfleet/last-preflight-failure.json 2>/dev/null || echo ''")
+	if err == nil && strings.TrimSpace(result.Stdout) != "" {
+		var failure struct {
+			Commit  string   `json:"commit"`
+			Time    string   `json:"time"`
+			Secrets []string `json:"secrets"`
+		}
+		if jsonErr := json.Unmarshal([]byte(result.Stdout), &failure); jsonErr == nil {
+			status.FailedSecrets = failure.Secrets
+			status.FailedSecretsAt = failure.Time
+		}
+	}
+
+	// A failed post-boot confirmation leaves this file behind as a
+	// prominent, persistent record until a later pull applies a newer
+	// generation that confirms healthy on its own.
+	result, err = client.ExecSudo(ctx, "cat /var/lib/nixfleet/last-rollback.json 2>/dev/null || echo ''")
+	if err == nil && strings.TrimSpace(result.Stdout) != "" {
+		var rollback struct {
+			FromGeneration int    `json:"from_generation"`
+			ToGeneration   int    `json:"to_generation"`
+			Time           string `json:"time"`
+			Reason         string `json:"reason"`
+		}
+		if jsonErr := json.Unmarshal([]byte(result.Stdout), &rollback); jsonErr == nil {
+			status.RollbackOccurred = true
+			status.RollbackFrom = fmt.Sprintf("%d", rollback.FromGeneration)
+			status.RollbackTo = fmt.Sprintf("%d", rollback.ToGeneration)
+			status.RollbackAt = rollback.Time
+			status.RollbackReason = rollback.Reason
+		}
+	}
+
+	// A pending-but-deferred build/substitution leaves this file behind
+	// until a later pull finds itself inside the transfer window (or within
+	// the size threshold) and proceeds.
+	result, err = client.ExecSudo(ctx, "cat /var/lib/nixfleet/pull-deferred.json 2>/dev/null || echo ''")
+	if err == nil && strings.TrimSpace(result.Stdout) != "" {
+		var deferred struct {
+			Commit     string  `json:"commit"`
+			PendingMB  float64 `json:"pending_mb"`
+			DeferredAt string  `json:"deferred_at"`
+			Window     string  `json:"window"`
+		}
+		if jsonErr := json.Unmarshal([]byte(result.Stdout), &deferred); jsonErr == nil {
+			status.TransferDeferred = true
+			status.DeferredPendingMB = deferred.PendingMB
+			status.DeferredAt = deferred.DeferredAt
+			status.TransferWindow = deferred.Window
+		}
+	}
+
 	return status, nil
 }
 
 // Status represents pull mode status on a host
 type Status struct {
-	Installed     bool
-	TimerActive   bool
-	LastRun       string
-	LastResult    string
-	NextRun       string
-	CurrentCommit string
+	Installed       bool
+	TimerActive     bool
+	LastRun         string
+	LastResult      string
+	NextRun         string
+	CurrentCommit   string
+	LastBuildSource string // "built", "substituted", or "unknown"
+
+	// FailedSecrets lists secrets that failed to decrypt during the most
+	// recent preflight check, if any are still outstanding. Empty once the
+	// next pull's preflight passes.
+	FailedSecrets   []string
+	FailedSecretsAt string
+
+	// RollbackOccurred is true if the most recently applied generation
+	// failed to confirm itself healthy and was automatically rolled back.
+	// It stays true until a later pull applies a newer generation.
+	RollbackOccurred bool
+	RollbackFrom     string
+	RollbackTo       string
+	RollbackAt       string
+	RollbackReason   string
+
+	// TransferDeferred is true if the pull script evaluated a pending
+	// download over the configured size threshold outside the transfer
+	// window and deferred the build/substitution phase rather than risk
+	// saturating the host's link. It clears itself once a later pull
+	// proceeds (in-window, under threshold, or via --ignore-window).
+	TransferDeferred  bool
+	DeferredPendingMB float64
+	DeferredAt        string
+	TransferWindow    string
 }
 
 func (i *Installer) createDirectories(ctx context.Context, client *ssh.Client, config Config) error {
@@ -326,6 +487,32 @@ func (i *Installer) installSystemdUnits(ctx context.Context, client *ssh.Client,
 		return fmt.Errorf("failed to install timer: %s", result.Stderr)
 	}
 
+	// Install rollback confirmation service and timer. These are written but
+	// left disabled: the pull script itself arms the timer (systemctl
+	// enable --now) right after switching to a new generation, so a host
+	// that never applies a change never runs this check.
+	confirmService := renderConfirmServiceUnit(config)
+	encodedConfirmService := base64Encode([]byte(confirmService))
+	cmd = fmt.Sprintf("bash -c \"echo '%s' | base64 -d > /etc/systemd/system/nixfleet-confirm.service\"", encodedConfirmService)
+	result, err = client.ExecSudo(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to install confirm service: %s", result.Stderr)
+	}
+
+	confirmTimer := renderConfirmTimerUnit(config)
+	encodedConfirmTimer := base64Encode([]byte(confirmTimer))
+	cmd = fmt.Sprintf("bash -c \"echo '%s' | base64 -d > /etc/systemd/system/nixfleet-confirm.timer\"", encodedConfirmTimer)
+	result, err = client.ExecSudo(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to install confirm timer: %s", result.Stderr)
+	}
+
 	// Reload systemd
 	result, err = client.ExecSudo(ctx, "systemctl daemon-reload")
 	if err != nil {
@@ -349,8 +536,22 @@ func (i *Installer) enableTimer(ctx context.Context, client *ssh.Client) error {
 	return nil
 }
 
-// TriggerPull manually triggers a pull operation
-func (i *Installer) TriggerPull(ctx context.Context, client *ssh.Client) error {
+// TriggerPull manually triggers a pull operation. ignoreWindow runs the pull
+// script directly instead of through systemd - whose ExecStart takes no
+// arguments - passing it --ignore-window so a deferred transfer-window gate
+// is bypassed for an emergency apply.
+func (i *Installer) TriggerPull(ctx context.Context, client *ssh.Client, ignoreWindow bool) error {
+	if ignoreWindow {
+		result, err := client.ExecSudo(ctx, "/usr/local/bin/nixfleet-pull --ignore-window")
+		if err != nil {
+			return err
+		}
+		if result.ExitCode != 0 {
+			return fmt.Errorf("pull failed: %s", result.Stderr)
+		}
+		return nil
+	}
+
 	result, err := client.ExecSudo(ctx, "systemctl start nixfleet-pull.service")
 	if err != nil {
 		return err
@@ -375,6 +576,16 @@ HOST_NAME="{{.HostName}}"
 BRANCH="{{.Branch}}"
 LOG_FILE="/var/log/nixfleet/pull.log"
 LOCK_FILE="/var/run/nixfleet-pull.lock"
+NIXFLEET_PROFILE="/nix/var/nix/profiles/nixfleet/system"
+ROLLBACK_MARKER="/var/lib/nixfleet/pending-rollback.json"
+LAST_ROLLBACK_FILE="/var/lib/nixfleet/last-rollback.json"
+DEFERRED_MARKER="/var/lib/nixfleet/pull-deferred.json"
+{{if .TransferWindow}}
+TRANSFER_WINDOW="{{.TransferWindow}}"
+TRANSFER_WINDOW_START="${TRANSFER_WINDOW%%-*}"
+TRANSFER_WINDOW_END="${TRANSFER_WINDOW##*-}"
+TRANSFER_THRESHOLD_MB={{.TransferThresholdMB}}
+{{end}}
 {{if .WebhookURL}}WEBHOOK_URL="{{.WebhookURL}}"{{end}}
 {{if .WebhookSecret}}WEBHOOK_SECRET="{{.WebhookSecret}}"{{end}}
 {{if .HomeManager}}
@@ -388,6 +599,19 @@ HM_CONFIG_NAME="{{.HomeManager.ConfigName}}"
 {{else}}
 HM_ENABLED=false
 {{end}}
+{{if and (not .BuildLeader) .LeaderAddr}}
+# This host substitutes pre-built closures from the fleet's build leader
+# instead of building from source, falling back to a local build if the
+# leader doesn't have the path (e.g. it hasn't pulled this commit yet).
+NIX_BUILD_ARGS=(--option substituters "ssh-ng://{{.LeaderSSHUser}}@{{.LeaderAddr}} https://cache.nixos.org" --option trusted-public-keys "" --option require-sigs false --fallback)
+{{else}}
+NIX_BUILD_ARGS=()
+{{end}}
+{{if gt .BandwidthLimitKB 0}}
+# Cap closure download speed so a substitution doesn't saturate a shared
+# link (e.g. retail-edge hosts sharing bandwidth with point-of-sale traffic).
+NIX_BUILD_ARGS+=(--option download-speed {{.BandwidthLimitKB}})
+{{end}}
 
 log() {
     echo "$(date -Iseconds) $*" | tee -a "$LOG_FILE"
@@ -396,8 +620,9 @@ log() {
 notify() {
     local status="$1"
     local message="$2"
+    local failed_secrets_json="${3:-[]}"
     {{if .WebhookURL}}
-    local payload="{\"host\":\"$HOST_NAME\",\"status\":\"$status\",\"message\":\"$message\",\"timestamp\":\"$(date -Iseconds)\"}"
+    local payload="{\"host\":\"$HOST_NAME\",\"status\":\"$status\",\"message\":\"$message\",\"failed_secrets\":$failed_secrets_json,\"timestamp\":\"$(date -Iseconds)\"}"
     {{if .WebhookSecret}}
     local signature=$(echo -n "$payload" | openssl dgst -sha256 -hmac "$WEBHOOK_SECRET" | awk '{print $2}')
     curl -s -X POST "$WEBHOOK_URL" \
@@ -417,6 +642,100 @@ cleanup() {
 }
 trap cleanup EXIT
 
+{{if .TransferWindow}}
+# in_transfer_window reports whether the current local time falls inside
+# TRANSFER_WINDOW_START..TRANSFER_WINDOW_END, handling an overnight window
+# (e.g. 22:00-06:00) the same way reboot.RebootWindow.IsInWindow does on the
+# controller side.
+in_transfer_window() {
+    local now_minutes start_minutes end_minutes
+    now_minutes=$((10#$(date +%H) * 60 + 10#$(date +%M)))
+    start_minutes=$((10#${TRANSFER_WINDOW_START%%:*} * 60 + 10#${TRANSFER_WINDOW_START##*:}))
+    end_minutes=$((10#${TRANSFER_WINDOW_END%%:*} * 60 + 10#${TRANSFER_WINDOW_END##*:}))
+
+    if [ "$end_minutes" -lt "$start_minutes" ]; then
+        [ "$now_minutes" -ge "$start_minutes" ] || [ "$now_minutes" -lt "$end_minutes" ]
+    else
+        [ "$now_minutes" -ge "$start_minutes" ] && [ "$now_minutes" -lt "$end_minutes" ]
+    fi
+}
+{{end}}
+
+# confirm_pending_generation checks whether the generation switched to by the
+# last pull is still awaiting confirmation and, if so, either disarms the
+# rollback (generation is healthy) or rolls back to the previously recorded
+# generation (it isn't). It's invoked by nixfleet-confirm.service, which the
+# main pull flow below arms right after switching generations; it's also
+# safe to run with no pending marker at all, which is a no-op.
+confirm_pending_generation() {
+    if [ ! -f "$ROLLBACK_MARKER" ]; then
+        log "No pending generation confirmation"
+        return 0
+    fi
+
+    marker_gen=$(grep -o '"new_generation":[0-9]*' "$ROLLBACK_MARKER" | grep -o '[0-9]*$')
+    prev_gen=$(grep -o '"previous_generation":[0-9]*' "$ROLLBACK_MARKER" | grep -o '[0-9]*$')
+    marker_commit=$(grep -o '"commit":"[^"]*"' "$ROLLBACK_MARKER" | cut -d'"' -f4)
+
+    current_gen=$(nix-env --profile "$NIXFLEET_PROFILE" --list-generations 2>/dev/null | awk '/current/{print $1}')
+
+    if [ -z "$marker_gen" ] || [ "$marker_gen" != "$current_gen" ]; then
+        log "Pending confirmation is for generation $marker_gen but current generation is $current_gen; clearing stale marker"
+        rm -f "$ROLLBACK_MARKER"
+        systemctl disable --now nixfleet-confirm.timer 2>/dev/null || true
+        return 0
+    fi
+
+    system_path=$(readlink -f "$NIXFLEET_PROFILE")
+    healthy=false
+    if [ -x "$system_path/bin/nixfleet-health-check" ]; then
+        if "$system_path/bin/nixfleet-health-check" >>"$LOG_FILE" 2>&1; then
+            healthy=true
+        fi
+    else
+        # No health-check binary shipped in this generation: reaching this
+        # unit at all is the only signal available, so confirm.
+        healthy=true
+    fi
+
+    if [ "$healthy" = "true" ]; then
+        log "Generation $current_gen confirmed healthy, disarming rollback"
+        rm -f "$ROLLBACK_MARKER"
+        systemctl disable --now nixfleet-confirm.timer 2>/dev/null || true
+        notify "success" "Generation $current_gen confirmed healthy"
+        return 0
+    fi
+
+    if [ -z "$prev_gen" ]; then
+        log "ERROR: generation $current_gen failed to confirm healthy, but no previous generation was recorded to roll back to"
+        notify "failed" "Generation $current_gen failed to confirm healthy; no previous generation to roll back to"
+        return 1
+    fi
+
+    log "ERROR: generation $current_gen failed to confirm healthy, rolling back to generation $prev_gen"
+    nix-env --profile "$NIXFLEET_PROFILE" --switch-generation "$prev_gen"
+    rollback_path=$(readlink -f "$NIXFLEET_PROFILE")
+    "$rollback_path/activate" >>"$LOG_FILE" 2>&1 || log "WARNING: rollback activation reported an error"
+
+    cat > "$LAST_ROLLBACK_FILE" <<ROLLBACKEOF
+{"from_generation":$current_gen,"to_generation":$prev_gen,"commit":"$marker_commit","time":"$(date -Iseconds)","reason":"failed to confirm healthy within the post-boot window"}
+ROLLBACKEOF
+
+    rm -f "$ROLLBACK_MARKER"
+    systemctl disable --now nixfleet-confirm.timer 2>/dev/null || true
+    notify "failed" "Rolled back generation $current_gen to $prev_gen: failed to confirm healthy"
+}
+
+if [ "${1:-}" = "--confirm-generation" ]; then
+    confirm_pending_generation
+    exit $?
+fi
+
+NIXFLEET_IGNORE_WINDOW=false
+if [ "${1:-}" = "--ignore-window" ]; then
+    NIXFLEET_IGNORE_WINDOW=true
+fi
+
 # Acquire lock
 exec 200>"$LOCK_FILE"
 if ! flock -n 200; then
@@ -444,6 +763,16 @@ if [ "$OLD_COMMIT" != "$NEW_COMMIT" ]; then
     NIXFLEET_CHANGED=true
 fi
 
+{{if .TransferWindow}}
+# A deferred build/substitution from an earlier run needs another look even
+# though the repo itself hasn't moved since - the commit was already reset,
+# only the build was held back.
+if [ -f "$DEFERRED_MARKER" ]; then
+    log "Pending deferred transfer from an earlier run, re-checking"
+    NIXFLEET_CHANGED=true
+fi
+{{end}}
+
 # Check dotfiles repo for changes (if home-manager enabled)
 if [ "$HM_ENABLED" = "true" ] && [ -d "$HM_DOTFILES_PATH/.git" ]; then
     log "Checking dotfiles for changes..."
@@ -479,9 +808,86 @@ if [ "$NIXFLEET_CHANGED" = "true" ]; then
     log "Updating NixFleet repo..."
     git reset --hard "origin/$BRANCH" 2>&1 | tee -a "$LOG_FILE"
 
+    # Preflight: make sure every secret this host is a recipient for still
+    # decrypts with our age key before we build/activate anything. A missing
+    # recipient here means the new generation's services will crash-loop the
+    # moment they try to read their secret, so we catch it up front instead.
+    PREFLIGHT_FAILURE_FILE="/var/lib/nixfleet/last-preflight-failure.json"
+    SECRETS_NIX="$REPO_PATH/secrets/secrets.nix"
+    AGE_KEY_PATH="{{.AgeKeyPath}}"
+
+    if [ -f "$SECRETS_NIX" ] && [ -f "$AGE_KEY_PATH" ]; then
+        log "Preflight: checking secret decryptability..."
+        HOST_AGE_PUBKEY=$(age-keygen -y "$AGE_KEY_PATH")
+        REQUIRED_SECRETS=$(nix eval --json --file "$SECRETS_NIX" --apply \
+            "cfg: builtins.filter (n: builtins.elem \"$HOST_AGE_PUBKEY\" cfg.\${n}.publicKeys) (builtins.attrNames cfg)" \
+            2>>"$LOG_FILE" || echo "[]")
+
+        FAILED_SECRETS=()
+        PREFLIGHT_TMP=$(mktemp -d)
+        for secret_name in $(echo "$REQUIRED_SECRETS" | tr -d '[]"' | tr ',' ' '); do
+            [ -z "$secret_name" ] && continue
+            secret_path="$REPO_PATH/secrets/$secret_name"
+            if [ ! -f "$secret_path" ] || ! age --decrypt -i "$AGE_KEY_PATH" -o "$PREFLIGHT_TMP/$secret_name" "$secret_path" 2>>"$LOG_FILE"; then
+                FAILED_SECRETS+=("$secret_name")
+            fi
+        done
+        rm -rf "$PREFLIGHT_TMP"
+
+        if [ ${#FAILED_SECRETS[@]} -gt 0 ]; then
+            log "ERROR: preflight failed, cannot decrypt: ${FAILED_SECRETS[*]}"
+            failed_secrets_json="[$(printf '"%s",' "${FAILED_SECRETS[@]}" | sed 's/,$//')]"
+            cat > "$PREFLIGHT_FAILURE_FILE" <<PREFLIGHTEOF
+{"commit":"$NEW_COMMIT","time":"$(date -Iseconds)","secrets":$failed_secrets_json}
+PREFLIGHTEOF
+            notify "failed" "Preflight failed: cannot decrypt ${FAILED_SECRETS[*]}" "$failed_secrets_json"
+            git reset --hard "$OLD_COMMIT"
+            exit 1
+        fi
+
+        rm -f "$PREFLIGHT_FAILURE_FILE"
+        log "Preflight: all required secrets decrypt successfully"
+    else
+        log "Preflight: skipping secret check (no secrets.nix or age key at $AGE_KEY_PATH)"
+    fi
+
+    {{if .TransferWindow}}
+    # Bandwidth-aware scheduling: a large closure on a constrained link waits
+    # for the transfer window rather than risk saturating it during the day.
+    # The fetch/reset/preflight above always runs immediately; only the
+    # build/substitution below is gated.
+    if [ "$NIXFLEET_IGNORE_WINDOW" != "true" ]; then
+        log "Evaluating pending download size against the transfer window..."
+        DRYRUN_OUTPUT=$(NIXPKGS_ALLOW_UNFREE=1 nix build ".#nixfleetConfigurations.$HOST_NAME.system" --dry-run --no-link --impure "${NIX_BUILD_ARGS[@]}" 2>&1 | tee -a "$LOG_FILE" || true)
+        PENDING_MB=$(echo "$DRYRUN_OUTPUT" | grep -oE '[0-9.]+ MiB download' | awk '{sum += $1} END {printf "%.1f", sum+0}')
+
+        if awk "BEGIN{exit !($PENDING_MB > $TRANSFER_THRESHOLD_MB)}" && ! in_transfer_window; then
+            log "Pending download is ~${PENDING_MB}MiB (over ${TRANSFER_THRESHOLD_MB}MB) and outside the $TRANSFER_WINDOW window - deferring build/substitution"
+            cat > "$DEFERRED_MARKER" <<DEFERRED_EOF
+{"commit":"$NEW_COMMIT","pending_mb":$PENDING_MB,"deferred_at":"$(date -Iseconds)","window":"$TRANSFER_WINDOW"}
+DEFERRED_EOF
+            notify "deferred" "Deferred until transfer window $TRANSFER_WINDOW (pending ~${PENDING_MB}MiB)"
+            exit 0
+        fi
+
+        if [ -f "$DEFERRED_MARKER" ]; then
+            # Was deferred, now either in-window or under threshold: jitter
+            # so every host holding a deferred download doesn't start the
+            # instant the window opens.
+            JITTER_SECONDS=$((RANDOM % 600))
+            log "Transfer window open (or download now under threshold); jittering ${JITTER_SECONDS}s before proceeding"
+            sleep "$JITTER_SECONDS"
+        fi
+        rm -f "$DEFERRED_MARKER"
+    else
+        log "--ignore-window passed, bypassing transfer window gate"
+        rm -f "$DEFERRED_MARKER"
+    fi
+    {{end}}
+
     # Build and apply configuration
     log "Building configuration for $HOST_NAME..."
-    if ! NIXPKGS_ALLOW_UNFREE=1 nix build ".#nixfleetConfigurations.$HOST_NAME.system" --no-link --impure 2>&1 | tee -a "$LOG_FILE"; then
+    if ! NIXPKGS_ALLOW_UNFREE=1 nix build ".#nixfleetConfigurations.$HOST_NAME.system" --no-link --impure "${NIX_BUILD_ARGS[@]}" 2>&1 | tee -a "$LOG_FILE"; then
         log "ERROR: Build failed"
         notify "failed" "Build failed for commit $NEW_COMMIT"
         git reset --hard "$OLD_COMMIT"
@@ -491,6 +897,16 @@ if [ "$NIXFLEET_CHANGED" = "true" ]; then
     SYSTEM_PATH=$(NIXPKGS_ALLOW_UNFREE=1 nix path-info ".#nixfleetConfigurations.$HOST_NAME.system" --impure)
     log "System path: $SYSTEM_PATH"
 
+    # A build log only exists locally for paths we actually built; a
+    # substituted path has no local log, which is how we tell them apart.
+    if nix log "$SYSTEM_PATH" >/dev/null 2>&1; then
+        BUILD_SOURCE=built
+    else
+        BUILD_SOURCE=substituted
+    fi
+    echo "$BUILD_SOURCE" > /var/lib/nixfleet/last-build-source
+    log "Build source: $BUILD_SOURCE"
+
     # Activate the configuration
     log "Activating configuration..."
     if ! "$SYSTEM_PATH/activate" 2>&1 | tee -a "$LOG_FILE"; then
@@ -499,8 +915,26 @@ if [ "$NIXFLEET_CHANGED" = "true" ]; then
         exit 1
     fi
 
+    # Record the current generation before switching, so a new generation
+    # that never confirms healthy can be rolled back to it automatically.
+    PREV_GEN=$(nix-env --profile "$NIXFLEET_PROFILE" --list-generations 2>/dev/null | awk '/current/{print $1}')
+
     # Update profile
-    nix-env --profile /nix/var/nix/profiles/nixfleet/system --set "$SYSTEM_PATH"
+    nix-env --profile "$NIXFLEET_PROFILE" --set "$SYSTEM_PATH"
+
+    if [ -n "$PREV_GEN" ]; then
+        NEW_GEN=$(nix-env --profile "$NIXFLEET_PROFILE" --list-generations 2>/dev/null | awk '/current/{print $1}')
+        cat > "$ROLLBACK_MARKER" <<MARKEREOF
+{"previous_generation":$PREV_GEN,"new_generation":$NEW_GEN,"commit":"$NEW_COMMIT","armed_at":"$(date -Iseconds)"}
+MARKEREOF
+        if systemctl enable --now nixfleet-confirm.timer 2>>"$LOG_FILE"; then
+            log "Armed rollback: generation $NEW_GEN will roll back to $PREV_GEN unless it confirms healthy"
+        else
+            log "WARNING: failed to arm rollback confirmation timer"
+        fi
+    else
+        log "No previous generation recorded; skipping rollback arming for this generation"
+    fi
 
     log "Successfully applied NixFleet commit $NEW_COMMIT"
 fi
@@ -576,7 +1010,7 @@ elif [ "$DOTFILES_CHANGED" = "true" ]; then
 fi
 
 # Run health checks if available
-SYSTEM_PATH=$(nix-env --profile /nix/var/nix/profiles/nixfleet/system -q --out-path 2>/dev/null | awk '{print $2}' || echo "")
+SYSTEM_PATH=$(nix-env --profile "$NIXFLEET_PROFILE" -q --out-path 2>/dev/null | awk '{print $2}' || echo "")
 if [ -n "$SYSTEM_PATH" ] && [ -x "$SYSTEM_PATH/bin/nixfleet-health-check" ]; then
     log "Running health checks..."
     if ! "$SYSTEM_PATH/bin/nixfleet-health-check" 2>&1 | tee -a "$LOG_FILE"; then
@@ -650,3 +1084,44 @@ Persistent=true
 WantedBy=timers.target
 `, config.Interval, onBoot)
 }
+
+func renderConfirmServiceUnit(config Config) string {
+	return `[Unit]
+Description=NixFleet Rollback Confirmation
+Documentation=https://github.com/zach-source/nix-fleet
+
+[Service]
+Type=oneshot
+ExecStart=/usr/local/bin/nixfleet-pull --confirm-generation
+Environment=HOME=/root
+Environment=PATH=/nix/var/nix/profiles/default/bin:/nix/var/nix/profiles/nixfleet/system/bin:/usr/local/bin:/usr/bin:/bin
+StandardOutput=journal
+StandardError=journal
+TimeoutStartSec=300
+`
+}
+
+func renderConfirmTimerUnit(config Config) string {
+	window := config.RollbackWindow
+	if window == "" {
+		window = DefaultConfig().RollbackWindow
+	}
+
+	return fmt.Sprintf(`[Unit]
+Description=NixFleet Rollback Confirmation Timer
+Documentation=https://github.com/zach-source/nix-fleet
+
+[Timer]
+# Disabled by default (see installSystemdUnits) - armed by the pull script
+# right after switching to a new generation. OnActiveSec covers a generation
+# applied without a reboot; OnBootSec covers one where the host reboots into
+# it before the window elapses. Both firing is harmless: confirmation is
+# idempotent and disarms itself on first run.
+OnActiveSec=%s
+OnBootSec=%s
+Persistent=false
+
+[Install]
+WantedBy=timers.target
+`, window, window)
+}
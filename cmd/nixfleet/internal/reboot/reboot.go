@@ -9,9 +9,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/nixfleet/nixfleet/internal/probe"
 	"github.com/nixfleet/nixfleet/internal/ssh"
+	"github.com/nixfleet/nixfleet/internal/state"
 )
 
+// shQuote single-quotes a string for safe embedding in a /bin/sh command.
+func shQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 // RebootStatus represents the reboot requirement status of a host
 type RebootStatus struct {
 	Required        bool
@@ -26,6 +33,12 @@ type RebootWindow struct {
 	StartMin  int          // 0-59
 	EndHour   int          // 0-23
 	EndMin    int          // 0-59
+
+	// Location is the time zone the window's day/hour/minute are expressed
+	// in - almost always the host's own zone, so "Sun 02:00-04:00" means
+	// 2am there, not 2am on the machine running nixfleet. Nil is treated as
+	// UTC.
+	Location *time.Location
 }
 
 // RebootConfig holds reboot orchestration configuration
@@ -37,8 +50,21 @@ type RebootConfig struct {
 	PostRebootHook       string
 	WaitTimeout          time.Duration
 	WaitInterval         time.Duration
+
+	// Kexec enables the kexec fast-reboot path fleet-wide. A host can also
+	// opt in individually via inventory.Host.KexecReboot.
+	Kexec bool
 }
 
+// RebootMethod identifies how a host was actually rebooted, since a kexec
+// attempt can fall back to a full reboot at runtime.
+type RebootMethod string
+
+const (
+	RebootMethodFull  RebootMethod = "full"
+	RebootMethodKexec RebootMethod = "kexec"
+)
+
 // DefaultRebootConfig returns sensible defaults
 func DefaultRebootConfig() RebootConfig {
 	return RebootConfig{
@@ -54,12 +80,18 @@ func DefaultRebootConfig() RebootConfig {
 
 // Orchestrator handles reboot orchestration
 type Orchestrator struct {
-	config RebootConfig
+	config   RebootConfig
+	probe    *probe.Engine
+	stateMgr *state.Manager
 }
 
 // NewOrchestrator creates a new reboot orchestrator
 func NewOrchestrator(config RebootConfig) *Orchestrator {
-	return &Orchestrator{config: config}
+	return &Orchestrator{
+		config:   config,
+		probe:    probe.NewEngine(),
+		stateMgr: state.NewManager(),
+	}
 }
 
 // CheckRebootRequired checks if a host needs a reboot
@@ -160,11 +192,17 @@ func (o *Orchestrator) checkDarwinReboot(ctx context.Context, client *ssh.Client
 	return status, nil
 }
 
-// ParseRebootWindow parses a window string like "Sun 02:00-04:00"
-func ParseRebootWindow(s string) (*RebootWindow, error) {
+// ParseRebootWindow parses a window string like "Sun 02:00-04:00". loc is
+// the time zone the window's day/hour/minute are evaluated in - typically
+// the target host's own zone (see inventory.Inventory.LocationForHost) -
+// and defaults to UTC when nil.
+func ParseRebootWindow(s string, loc *time.Location) (*RebootWindow, error) {
 	if s == "" {
 		return nil, nil
 	}
+	if loc == nil {
+		loc = time.UTC
+	}
 
 	// Pattern: "Day HH:MM-HH:MM" or "HH:MM-HH:MM" (daily)
 	dayPattern := regexp.MustCompile(`^(?:(Sun|Mon|Tue|Wed|Thu|Fri|Sat)\s+)?(\d{1,2}):(\d{2})-(\d{1,2}):(\d{2})$`)
@@ -173,7 +211,7 @@ func ParseRebootWindow(s string) (*RebootWindow, error) {
 		return nil, fmt.Errorf("invalid reboot window format: %s (expected 'Day HH:MM-HH:MM' or 'HH:MM-HH:MM')", s)
 	}
 
-	window := &RebootWindow{}
+	window := &RebootWindow{Location: loc}
 
 	// Parse day of week
 	if matches[1] != "" {
@@ -219,11 +257,25 @@ func ParseRebootWindow(s string) (*RebootWindow, error) {
 	return window, nil
 }
 
-// IsInWindow checks if the current time is within the reboot window
+// location returns w.Location, defaulting to UTC for a window built
+// without one (e.g. constructed directly rather than via
+// ParseRebootWindow).
+func (w *RebootWindow) location() *time.Location {
+	if w.Location != nil {
+		return w.Location
+	}
+	return time.UTC
+}
+
+// IsInWindow checks whether t falls inside the reboot window, evaluated in
+// the window's own Location - t is converted there first, so a window
+// defined as the host's local time is compared against the host's local
+// clock regardless of what zone t was constructed in.
 func (w *RebootWindow) IsInWindow(t time.Time) bool {
 	if w == nil {
 		return true // No window restriction
 	}
+	t = t.In(w.location())
 
 	// Check day of week (if specified)
 	if w.DayOfWeek >= 0 && t.Weekday() != w.DayOfWeek {
@@ -243,14 +295,18 @@ func (w *RebootWindow) IsInWindow(t time.Time) bool {
 	return currentMinutes >= startMinutes && currentMinutes < endMinutes
 }
 
-// NextWindowStart returns when the next reboot window starts
+// NextWindowStart returns when the next reboot window starts, in the
+// window's own Location. from is converted there first, so "next window"
+// is computed relative to the host's local clock rather than from's.
 func (w *RebootWindow) NextWindowStart(from time.Time) time.Time {
 	if w == nil {
 		return from
 	}
+	loc := w.location()
+	from = from.In(loc)
 
 	// Start of current day's window
-	windowStart := time.Date(from.Year(), from.Month(), from.Day(), w.StartHour, w.StartMin, 0, 0, from.Location())
+	windowStart := time.Date(from.Year(), from.Month(), from.Day(), w.StartHour, w.StartMin, 0, 0, loc)
 
 	// If we're past today's window, move to tomorrow
 	if from.After(windowStart) {
@@ -267,20 +323,97 @@ func (w *RebootWindow) NextWindowStart(from time.Time) time.Time {
 	return windowStart
 }
 
-// ExecuteReboot orchestrates a reboot for a single host
-func (o *Orchestrator) ExecuteReboot(ctx context.Context, client *ssh.Client, pool *ssh.Pool, host string, port int, user string) error {
+// ExecuteReboot orchestrates a reboot for a single host. kexecEnabled
+// requests the fast kexec path in addition to whatever RebootConfig.Kexec
+// already says (either one is enough to attempt it); base picks the
+// kernel/initrd paths kexec loads. window overrides o.config.Window for
+// this call - callers targeting hosts in different time zones build a
+// window per host (see inventory.Inventory.LocationForHost) rather than
+// sharing one Location across the whole fleet; pass nil to fall back to
+// o.config.Window. It always falls back to a full reboot if kexec isn't
+// available, is blocked by pending firmware work, or fails to load, and
+// reports which method actually ran.
+func (o *Orchestrator) ExecuteReboot(ctx context.Context, client *ssh.Client, pool *ssh.Pool, host string, port int, user string, base string, kexecEnabled bool, window *RebootWindow) (RebootMethod, error) {
 	// Check if reboot is allowed
 	if !o.config.AllowReboot {
-		return fmt.Errorf("reboot not allowed by configuration")
+		return "", fmt.Errorf("reboot not allowed by configuration")
+	}
+
+	if window == nil {
+		window = o.config.Window
 	}
 
 	// Check reboot window
-	if o.config.Window != nil && !o.config.Window.IsInWindow(time.Now()) {
-		next := o.config.Window.NextWindowStart(time.Now())
-		return fmt.Errorf("outside reboot window, next window starts at %s", next.Format(time.RFC3339))
+	if window != nil && !window.IsInWindow(time.Now()) {
+		next := window.NextWindowStart(time.Now())
+		return "", fmt.Errorf("outside reboot window, next window starts at %s (%s)", next.Format(time.RFC3339), next.Location())
 	}
 
 	// Run pre-reboot hook
+	if o.config.PreRebootHook != "" {
+		result, err := client.ExecSudo(ctx, o.config.PreRebootHook)
+		if err != nil {
+			return "", fmt.Errorf("pre-reboot hook failed: %w", err)
+		}
+		if result.ExitCode != 0 {
+			return "", fmt.Errorf("pre-reboot hook failed: %s", result.Stderr)
+		}
+	}
+
+	prevBootID, _ := readBootID(ctx, client)
+
+	method := RebootMethodFull
+	if o.config.Kexec || kexecEnabled {
+		if blocked, _ := kexecBlocked(ctx, client); !blocked && canKexec(ctx, client) {
+			if err := loadKexecKernel(ctx, client, base); err == nil {
+				if err := triggerKexec(ctx, client); err == nil {
+					method = RebootMethodKexec
+				}
+			}
+		}
+	}
+
+	if method == RebootMethodKexec {
+		// systemctl kexec is backgrounded and fires almost immediately, so
+		// there's no minute-long delay to wait out like a full reboot.
+		pool.Remove(host, port)
+		time.Sleep(5 * time.Second)
+	} else {
+		// Use shutdown to schedule reboot in 1 minute and give us time to close connection
+		if _, err := client.ExecSudo(ctx, "shutdown -r +1 'NixFleet scheduled reboot'"); err != nil {
+			return "", fmt.Errorf("failed to schedule reboot: %w", err)
+		}
+		pool.Remove(host, port)
+		time.Sleep(70 * time.Second) // Wait for reboot to start
+	}
+
+	// Wait for host to come back up
+	if err := o.waitForHost(ctx, pool, host, port, user, prevBootID); err != nil {
+		return method, err
+	}
+	return method, nil
+}
+
+// ExecuteSelfReboot triggers a reboot on the host running the current
+// nixfleet process and returns as soon as it's scheduled, without waiting
+// for the host to come back - unlike ExecuteReboot, waiting here would just
+// wait for this very process's own death. Callers must checkpoint the
+// orchestration run and install a resume unit (see RunState,
+// CheckpointStore, InstallResumeUnit) before calling this, since nothing
+// past this call is guaranteed to run.
+func (o *Orchestrator) ExecuteSelfReboot(ctx context.Context, client *ssh.Client, window *RebootWindow) error {
+	if !o.config.AllowReboot {
+		return fmt.Errorf("reboot not allowed by configuration")
+	}
+
+	if window == nil {
+		window = o.config.Window
+	}
+	if window != nil && !window.IsInWindow(time.Now()) {
+		next := window.NextWindowStart(time.Now())
+		return fmt.Errorf("outside reboot window, next window starts at %s (%s)", next.Format(time.RFC3339), next.Location())
+	}
+
 	if o.config.PreRebootHook != "" {
 		result, err := client.ExecSudo(ctx, o.config.PreRebootHook)
 		if err != nil {
@@ -291,25 +424,277 @@ func (o *Orchestrator) ExecuteReboot(ctx context.Context, client *ssh.Client, po
 		}
 	}
 
-	// Initiate reboot
-	// Use shutdown to schedule reboot in 1 minute and give us time to close connection
-	_, err := client.ExecSudo(ctx, "shutdown -r +1 'NixFleet scheduled reboot'")
-	if err != nil {
+	if _, err := client.ExecSudo(ctx, "shutdown -r +1 'NixFleet scheduled reboot (self-host, checkpointed)'"); err != nil {
 		return fmt.Errorf("failed to schedule reboot: %w", err)
 	}
 
-	// Close current connection before reboot
-	pool.Remove(host, port)
+	return nil
+}
 
-	// Wait for host to go down
-	time.Sleep(70 * time.Second) // Wait for reboot to start
+// canKexec reports whether kexec-tools is installed on the host.
+func canKexec(ctx context.Context, client *ssh.Client) bool {
+	result, err := client.Exec(ctx, "command -v kexec >/dev/null 2>&1 && echo yes || echo no")
+	return err == nil && strings.TrimSpace(result.Stdout) == "yes"
+}
 
-	// Wait for host to come back up
-	return o.waitForHost(ctx, pool, host, port, user)
+// kexecBlocked checks for host-side markers that make an in-place kexec
+// unsafe - fwupd has firmware staged, or needrestart is flagging something
+// (microcode, hardware) that a plain kernel kexec won't pick up. Either one
+// forces a full reboot instead.
+func kexecBlocked(ctx context.Context, client *ssh.Client) (bool, string) {
+	if result, err := client.Exec(ctx, "fwupdmgr get-updates --json 2>/dev/null | grep -q '\"AppstreamId\"' && echo pending || true"); err == nil {
+		if strings.TrimSpace(result.Stdout) == "pending" {
+			return true, "fwupd firmware update pending"
+		}
+	}
+	if result, err := client.Exec(ctx, "needrestart -b 2>/dev/null | grep -q '^NEEDRESTART-KSTA: [013]$' && echo needed || true"); err == nil {
+		if strings.TrimSpace(result.Stdout) == "needed" {
+			return true, "needrestart reports a kernel/microcode change kexec can't cover"
+		}
+	}
+	return false, ""
+}
+
+// loadKexecKernel loads the currently-installed target kernel and initrd
+// with the running cmdline, ready for systemctl kexec to jump to.
+func loadKexecKernel(ctx context.Context, client *ssh.Client, base string) error {
+	kernel, initrd := "/vmlinuz", "/initrd.img"
+	if base == "nixos" {
+		kernel, initrd = "/run/current-system/kernel", "/run/current-system/initrd"
+	}
+
+	cmd := fmt.Sprintf("kexec -l %s --initrd=%s --reuse-cmdline", kernel, initrd)
+	result, err := client.ExecSudo(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("kexec -l failed: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("kexec -l failed: %s", strings.TrimSpace(result.Stderr))
+	}
+
+	return nil
+}
+
+// triggerKexec fires the already-loaded kernel via systemctl, backgrounded
+// so the SSH exec returns before the kexec jump tears down the connection.
+func triggerKexec(ctx context.Context, client *ssh.Client) error {
+	_, err := client.ExecSudo(ctx, "nohup systemctl kexec >/dev/null 2>&1 & disown")
+	return err
+}
+
+// readBootID reads the kernel's random boot ID, used to confirm a host
+// actually cycled rather than just having sshd bounce back up.
+func readBootID(ctx context.Context, client *ssh.Client) (string, error) {
+	result, err := client.Exec(ctx, "cat /proc/sys/kernel/random/boot_id 2>/dev/null")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+// ReadKernelVersion reads the host's running kernel version (`uname -r`),
+// for callers that want to compare it against the version running after a
+// reboot - see PostRebootChecks.ExpectedKernel.
+func ReadKernelVersion(ctx context.Context, client *ssh.Client) (string, error) {
+	result, err := client.Exec(ctx, "uname -r")
+	if err != nil {
+		return "", fmt.Errorf("reading kernel version: %w", err)
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+// PostRebootChecks configures the validation suite ValidatePostReboot runs
+// once a host has come back up and passed the plain SSH/boot-ID check
+// waitForHost already does. Converted from inventory.PostRebootValidationConfig
+// plus inventory.Inventory.ProbesForHost at the point of use, since this
+// package doesn't depend on internal/inventory.
+type PostRebootChecks struct {
+	// Probes are additional readiness/health checks beyond the implicit
+	// SSH/boot-ID check, typically inventory.Inventory.ProbesForHost's
+	// result for the host being validated.
+	Probes []probe.Config
+
+	// Mounts lists fstab mount points (besides "/") that must be active.
+	Mounts []string
+
+	// RAID checks mdadm array health.
+	RAID bool
+
+	// ZFS checks zpool health.
+	ZFS bool
+
+	// SystemdTargets lists systemd units that must be active.
+	SystemdTargets []string
+
+	// NTP checks the host's clock is synchronized.
+	NTP bool
+
+	// ExpectedKernel, if set, is the kernel version (`uname -r`) the host
+	// is expected to come back running - usually read via ReadKernelVersion
+	// just before the reboot was triggered, so a silent fallback to an
+	// older kernel is caught.
+	ExpectedKernel string
+}
+
+// HasChecks reports whether checks declares anything for ValidatePostReboot
+// to actually run, beyond the Probes a caller might also pass directly.
+func (checks PostRebootChecks) HasChecks() bool {
+	return len(checks.Probes) > 0 || len(checks.Mounts) > 0 || checks.RAID || checks.ZFS ||
+		len(checks.SystemdTargets) > 0 || checks.NTP || checks.ExpectedKernel != ""
+}
+
+// ValidatePostReboot runs checks against client and returns a probe.Results
+// report, suitable for state.Manager.RecordRebootValidation and the webhook
+// pipeline. Unlike waitForHost's rebootProbe, a failing check here doesn't
+// abort anything - every check runs and the caller decides what a partial
+// failure means for exit codes and notifications.
+func (o *Orchestrator) ValidatePostReboot(ctx context.Context, client *ssh.Client, hostName string, checks PostRebootChecks) *probe.Results {
+	report := &probe.Results{Host: hostName, Passed: true}
+
+	for _, cfg := range checks.Probes {
+		result := o.probe.RunOne(ctx, sshExec(client), hostName, cfg)
+		report.Checks = append(report.Checks, result)
+	}
+
+	for _, mount := range checks.Mounts {
+		report.Checks = append(report.Checks, checkMount(ctx, client, mount))
+	}
+
+	if checks.RAID {
+		report.Checks = append(report.Checks, checkRAID(ctx, client))
+	}
+
+	if checks.ZFS {
+		report.Checks = append(report.Checks, checkZFSPools(ctx, client))
+	}
+
+	for _, target := range checks.SystemdTargets {
+		report.Checks = append(report.Checks, checkSystemdActive(ctx, client, target))
+	}
+
+	if checks.NTP {
+		report.Checks = append(report.Checks, checkNTPSynced(ctx, client))
+	}
+
+	if checks.ExpectedKernel != "" {
+		report.Checks = append(report.Checks, checkKernelVersion(ctx, client, checks.ExpectedKernel))
+	}
+
+	for _, c := range report.Checks {
+		if !c.Passed {
+			report.Passed = false
+			break
+		}
+	}
+
+	return report
+}
+
+// checkMount reports whether mount is an active mount point.
+func checkMount(ctx context.Context, client *ssh.Client, mount string) probe.Result {
+	name := fmt.Sprintf("mount:%s", mount)
+	result, err := client.Exec(ctx, fmt.Sprintf("mountpoint -q %s && echo yes || echo no", shQuote(mount)))
+	if err != nil {
+		return probe.Result{Name: name, Type: probe.TypeCommand, Message: err.Error()}
+	}
+	if strings.TrimSpace(result.Stdout) == "yes" {
+		return probe.Result{Name: name, Type: probe.TypeCommand, Passed: true}
+	}
+	return probe.Result{Name: name, Type: probe.TypeCommand, Message: "not mounted"}
+}
+
+// checkRAID reports whether every mdadm array on the host is clean - no
+// array's /proc/mdstat line mentions a recovery/degraded marker. A host
+// with no mdadm arrays at all passes trivially.
+func checkRAID(ctx context.Context, client *ssh.Client) probe.Result {
+	const name = "raid"
+	result, err := client.Exec(ctx, "cat /proc/mdstat 2>/dev/null || true")
+	if err != nil {
+		return probe.Result{Name: name, Type: probe.TypeCommand, Message: err.Error()}
+	}
+	if strings.Contains(result.Stdout, "_") || strings.Contains(result.Stdout, "recovery") || strings.Contains(result.Stdout, "degraded") {
+		return probe.Result{Name: name, Type: probe.TypeCommand, Message: "mdadm array degraded or recovering: " + strings.TrimSpace(result.Stdout)}
+	}
+	return probe.Result{Name: name, Type: probe.TypeCommand, Passed: true}
+}
+
+// checkZFSPools reports whether every zpool is ONLINE. A host with no zpool
+// command available passes trivially.
+func checkZFSPools(ctx context.Context, client *ssh.Client) probe.Result {
+	const name = "zfs"
+	result, err := client.Exec(ctx, "command -v zpool >/dev/null 2>&1 && zpool list -H -o health || true")
+	if err != nil {
+		return probe.Result{Name: name, Type: probe.TypeCommand, Message: err.Error()}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(result.Stdout), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && line != "ONLINE" {
+			return probe.Result{Name: name, Type: probe.TypeCommand, Message: "zpool not healthy: " + result.Stdout}
+		}
+	}
+	return probe.Result{Name: name, Type: probe.TypeCommand, Passed: true}
+}
+
+// checkSystemdActive reports whether unit (a target or a service) has
+// reached the active state.
+func checkSystemdActive(ctx context.Context, client *ssh.Client, unit string) probe.Result {
+	name := fmt.Sprintf("systemd:%s", unit)
+	result, err := client.Exec(ctx, fmt.Sprintf("systemctl is-active %s", shQuote(unit)))
+	activeState := strings.TrimSpace(result.Stdout)
+	if err == nil && activeState == "active" {
+		return probe.Result{Name: name, Type: probe.TypeSystemd, Passed: true}
+	}
+	if activeState == "" {
+		activeState = "unknown"
+	}
+	return probe.Result{Name: name, Type: probe.TypeSystemd, Message: fmt.Sprintf("state: %s", activeState)}
 }
 
-// waitForHost waits for a host to become reachable after reboot
-func (o *Orchestrator) waitForHost(ctx context.Context, pool *ssh.Pool, host string, port int, user string) error {
+// checkNTPSynced reports whether the host's clock is synchronized,
+// preferring timedatectl and falling back to chronyc for hosts that use
+// chrony without systemd-timesyncd.
+func checkNTPSynced(ctx context.Context, client *ssh.Client) probe.Result {
+	const name = "ntp"
+	result, err := client.Exec(ctx, "timedatectl show --property=NTPSynchronized --value 2>/dev/null || true")
+	if err == nil && strings.TrimSpace(result.Stdout) == "yes" {
+		return probe.Result{Name: name, Type: probe.TypeCommand, Passed: true}
+	}
+	if result, err := client.Exec(ctx, "chronyc tracking 2>/dev/null | grep -q 'Leap status.*Normal' && echo yes || true"); err == nil && strings.TrimSpace(result.Stdout) == "yes" {
+		return probe.Result{Name: name, Type: probe.TypeCommand, Passed: true}
+	}
+	return probe.Result{Name: name, Type: probe.TypeCommand, Message: "clock not synchronized"}
+}
+
+// checkKernelVersion reports whether the host's running kernel matches
+// expected, catching a reboot that silently landed back on an older
+// kernel (e.g. a bootloader default that wasn't updated).
+func checkKernelVersion(ctx context.Context, client *ssh.Client, expected string) probe.Result {
+	const name = "kernel_version"
+	got, err := ReadKernelVersion(ctx, client)
+	if err != nil {
+		return probe.Result{Name: name, Type: probe.TypeCommand, Message: err.Error()}
+	}
+	if got == expected {
+		return probe.Result{Name: name, Type: probe.TypeCommand, Passed: true, Message: got}
+	}
+	return probe.Result{Name: name, Type: probe.TypeCommand, Message: fmt.Sprintf("running %s, expected %s", got, expected)}
+}
+
+// rebootProbe is the readiness check waitForHost polls with: a plain command
+// probe over SSH, since a fresh connection alone doesn't prove sshd has
+// finished settling after boot.
+var rebootProbe = probe.Config{
+	Name:   "reboot_complete",
+	Type:   probe.TypeCommand,
+	Target: "echo 'reboot-complete'",
+}
+
+// waitForHost waits for a host to become reachable after reboot. When
+// prevBootID is known, a passing probe isn't enough on its own - the boot
+// ID must have changed too, so a kexec (which cycles the kernel exactly
+// like a full reboot) counts as a real boot cycle and not a stale ssh
+// session that answered before the host actually went down.
+func (o *Orchestrator) waitForHost(ctx context.Context, pool *ssh.Pool, host string, port int, user string, prevBootID string) error {
 	deadline := time.Now().Add(o.config.WaitTimeout)
 
 	for time.Now().Before(deadline) {
@@ -323,8 +708,20 @@ func (o *Orchestrator) waitForHost(ctx context.Context, pool *ssh.Pool, host str
 		client, err := pool.GetWithUser(ctx, host, port, user)
 		if err == nil {
 			// Connection successful, verify host is responsive
-			result, err := client.Exec(ctx, "echo 'reboot-complete'")
-			if err == nil && strings.TrimSpace(result.Stdout) == "reboot-complete" {
+			result := o.probe.RunOne(ctx, sshExec(client), host, rebootProbe)
+			if result.Passed {
+				if prevBootID != "" {
+					if newBootID, err := readBootID(ctx, client); err == nil && newBootID == prevBootID {
+						time.Sleep(o.config.WaitInterval)
+						continue
+					}
+				}
+				if err := o.stateMgr.UpdateServiceHealth(ctx, client, map[string]state.ServiceStatus{
+					result.Name: {Active: true, SubState: result.Message, LastCheck: time.Now()},
+				}); err != nil {
+					// Non-fatal: the host is up, recording that in state is best-effort.
+					_ = err
+				}
 				return nil
 			}
 		}
@@ -336,6 +733,18 @@ func (o *Orchestrator) waitForHost(ctx context.Context, pool *ssh.Pool, host str
 	return fmt.Errorf("host did not come back up within %v", o.config.WaitTimeout)
 }
 
+// sshExec adapts an ssh.Client into a probe.Exec so the probe engine never
+// needs to import internal/ssh directly.
+func sshExec(client *ssh.Client) probe.Exec {
+	return func(ctx context.Context, cmd string) (*probe.ExecResult, error) {
+		result, err := client.Exec(ctx, cmd)
+		if err != nil {
+			return nil, err
+		}
+		return &probe.ExecResult{Stdout: result.Stdout, Stderr: result.Stderr, ExitCode: result.ExitCode}, nil
+	}
+}
+
 // RunPostRebootHook runs the post-reboot hook on a host
 func (o *Orchestrator) RunPostRebootHook(ctx context.Context, client *ssh.Client) error {
 	if o.config.PostRebootHook == "" {
@@ -30,7 +30,7 @@ func TestParseRebootWindow(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			window, err := ParseRebootWindow(tt.input)
+			window, err := ParseRebootWindow(tt.input, time.UTC)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ParseRebootWindow(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
 				return
@@ -163,7 +163,7 @@ func TestDefaultRebootConfig(t *testing.T) {
 }
 
 func TestRebootConfig(t *testing.T) {
-	window, _ := ParseRebootWindow("Sun 02:00-04:00")
+	window, _ := ParseRebootWindow("Sun 02:00-04:00", time.UTC)
 
 	config := RebootConfig{
 		AllowReboot:          true,
@@ -301,3 +301,76 @@ func TestRebootWindowNextWindowStartNil(t *testing.T) {
 		t.Error("Nil window should return input time")
 	}
 }
+
+// TestRebootWindowDSTSpringForward covers a window whose start wall-clock
+// time doesn't exist on the day US clocks spring forward (2024-03-10,
+// America/New_York jumps 02:00 -> 03:00). time.Date resolves a nonexistent
+// wall-clock time by collapsing it to the instant the offset changes, which
+// here lands back at 01:00 EST - so NextWindowStart never actually reaches
+// the requested 02:00, and the window is skipped entirely that day: nothing
+// at or after the jump is "in window" for it.
+func TestRebootWindowDSTSpringForward(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+
+	window := &RebootWindow{
+		DayOfWeek: time.Sunday,
+		StartHour: 2,
+		StartMin:  0,
+		EndHour:   2,
+		EndMin:    30,
+		Location:  loc,
+	}
+
+	// Just before the spring-forward window, same Sunday.
+	from := time.Date(2024, 3, 10, 1, 0, 0, 0, loc)
+	next := window.NextWindowStart(from)
+
+	if next.Day() != 10 {
+		t.Errorf("expected the skipped window to normalize to March 10, got %v", next)
+	}
+	if !next.Equal(from) {
+		t.Errorf("expected nonexistent 02:00 to collapse to the transition instant %v, got %v", from, next)
+	}
+
+	// The wall-clock hour never occurs that day, so nothing after the jump
+	// is ever "in window".
+	justAfterJump := time.Date(2024, 3, 10, 3, 0, 0, 0, loc)
+	if window.IsInWindow(justAfterJump) {
+		t.Error("window should not be in effect once the clock has jumped past it")
+	}
+}
+
+// TestRebootWindowDSTFallBack covers a window whose wall-clock time occurs
+// twice on the day US clocks fall back (2024-11-03, America/New_York repeats
+// 01:00-02:00). IsInWindow compares wall-clock fields, so both the EDT and
+// EST occurrence of the repeated hour must be treated as in-window.
+func TestRebootWindowDSTFallBack(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+
+	window := &RebootWindow{
+		DayOfWeek: time.Sunday,
+		StartHour: 1,
+		StartMin:  0,
+		EndHour:   1,
+		EndMin:    30,
+		Location:  loc,
+	}
+
+	// 2024-11-03 05:15 UTC = 01:15 EDT (first occurrence, before fall back).
+	firstOccurrence := time.Date(2024, 11, 3, 5, 15, 0, 0, time.UTC)
+	// 2024-11-03 06:15 UTC = 01:15 EST (second occurrence, after fall back).
+	secondOccurrence := time.Date(2024, 11, 3, 6, 15, 0, 0, time.UTC)
+
+	if !window.IsInWindow(firstOccurrence) {
+		t.Error("expected the first (EDT) occurrence of the doubled hour to be in window")
+	}
+	if !window.IsInWindow(secondOccurrence) {
+		t.Error("expected the second (EST) occurrence of the doubled hour to be in window")
+	}
+}
@@ -0,0 +1,242 @@
+package reboot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+	"github.com/nixfleet/nixfleet/internal/ssh"
+)
+
+// IsSelfHost reports whether host is the machine the current nixfleet
+// process is running on: either the inventory flags it explicitly
+// (inventory.Host.Self), or its /etc/machine-id - read over the already-open
+// client - matches this machine's own. The machine-id check exists so an
+// operator who forgets to set `self: true` still gets correct behavior.
+func IsSelfHost(ctx context.Context, client *ssh.Client, host *inventory.Host) bool {
+	if host.Self {
+		return true
+	}
+
+	localID, err := localMachineID()
+	if err != nil || localID == "" {
+		return false
+	}
+
+	result, err := client.Exec(ctx, "cat /etc/machine-id 2>/dev/null")
+	if err != nil || result.ExitCode != 0 {
+		return false
+	}
+
+	return strings.TrimSpace(result.Stdout) == localID
+}
+
+// localMachineID reads this machine's own /etc/machine-id.
+func localMachineID() (string, error) {
+	data, err := os.ReadFile("/etc/machine-id")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// OrderSelfLast stable-sorts hosts so that any self-host (per IsSelfHost)
+// comes after every other host, without otherwise reordering the list. A
+// fleet-wide reboot that got to the self-host first would kill the
+// orchestrating process before the rest of the fleet was handled.
+func OrderSelfLast(ctx context.Context, pool *ssh.Pool, hosts []*inventory.Host) []*inventory.Host {
+	ordered := make([]*inventory.Host, 0, len(hosts))
+	var selves []*inventory.Host
+
+	for _, host := range hosts {
+		port := host.SSHPort
+		if port == 0 {
+			port = 22
+		}
+		client, err := pool.GetWithUser(ctx, host.Addr, port, host.SSHUser)
+		if err == nil && IsSelfHost(ctx, client, host) {
+			selves = append(selves, host)
+			continue
+		}
+		ordered = append(ordered, host)
+	}
+
+	return append(ordered, selves...)
+}
+
+// RunState is the checkpointed state of one `nixfleet reboot now` run,
+// persisted before the self-host is rebooted so `nixfleet reboot resume`
+// can pick the run back up afterwards. Config is re-supplied as flags to
+// the resume command rather than serialized here, since RebootConfig holds
+// a *time.Location that doesn't round-trip through JSON.
+type RunState struct {
+	RunID     string    `json:"runId"`
+	StartedAt time.Time `json:"startedAt"`
+
+	// Window, MaxConcurrent, Kexec mirror the flags `reboot now` was
+	// invoked with, so resume reapplies the same policy.
+	Window        string `json:"window,omitempty"`
+	MaxConcurrent int    `json:"maxConcurrent"`
+	Kexec         bool   `json:"kexec"`
+
+	// Remaining are hosts (by name) not yet rebooted when the checkpoint was
+	// written, including the self-host that's about to reboot.
+	Remaining []string `json:"remaining"`
+	Completed []string `json:"completed"`
+	Failed    []string `json:"failed"`
+
+	// SelfHost is the name of the host this run checkpointed itself before
+	// rebooting, so resume knows to verify it (and run its post-reboot
+	// hook) before continuing on to the rest of Remaining.
+	SelfHost string `json:"selfHost"`
+}
+
+// NewRunID generates a random run ID for a new reboot orchestration run.
+func NewRunID() (string, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("generating run id: %w", err)
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// CheckpointStore persists RunState to ~/.cache/nixfleet/reboot-runs, the
+// same cache-dir convention as nix.EvalCache, so a run survives the
+// self-host reboot that necessitated checkpointing it.
+type CheckpointStore struct {
+	dir string
+}
+
+// NewCheckpointStore creates a CheckpointStore rooted at
+// ~/.cache/nixfleet/reboot-runs, creating the directory if needed.
+func NewCheckpointStore() (*CheckpointStore, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("resolving home dir: %w", err)
+	}
+
+	dir := filepath.Join(home, ".cache", "nixfleet", "reboot-runs")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating checkpoint dir: %w", err)
+	}
+
+	return &CheckpointStore{dir: dir}, nil
+}
+
+func (c *CheckpointStore) path(runID string) string {
+	return filepath.Join(c.dir, runID+".json")
+}
+
+// Save writes run's checkpoint to disk, overwriting any existing checkpoint
+// for the same RunID.
+func (c *CheckpointStore) Save(run *RunState) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling run state: %w", err)
+	}
+	if err := os.WriteFile(c.path(run.RunID), data, 0o644); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Load reads back the checkpoint for runID.
+func (c *CheckpointStore) Load(runID string) (*RunState, error) {
+	data, err := os.ReadFile(c.path(runID))
+	if err != nil {
+		return nil, fmt.Errorf("reading checkpoint: %w", err)
+	}
+	var run RunState
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("parsing checkpoint: %w", err)
+	}
+	return &run, nil
+}
+
+// Remove deletes runID's checkpoint once the run has completed (or been
+// abandoned). Missing is not an error.
+func (c *CheckpointStore) Remove(runID string) error {
+	if err := os.Remove(c.path(runID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing checkpoint: %w", err)
+	}
+	return nil
+}
+
+// resumeUnitName is the systemd unit InstallResumeUnit installs on the
+// self-host, and RemoveResumeUnit cleans up once the run it was created for
+// has completed.
+const resumeUnitName = "nixfleet-reboot-resume.service"
+
+// renderResumeUnit renders the oneshot systemd unit that re-invokes
+// `nixfleet reboot resume <runID>` on boot, so the orchestration continues
+// without operator intervention once the self-host comes back up.
+// RemoveResumeUnit disables and deletes it once resume finishes, so a later
+// unrelated boot doesn't re-trigger a stale run.
+func renderResumeUnit(nixfleetBin, flakePath, inventoryPath, runID string) string {
+	return fmt.Sprintf(`[Unit]
+Description=NixFleet reboot orchestration resume (run %s)
+After=network-online.target sshd.service
+Wants=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=%s --flake %s --inventory %s reboot resume %s
+StandardOutput=journal
+StandardError=journal
+
+[Install]
+WantedBy=multi-user.target
+`, runID, nixfleetBin, flakePath, inventoryPath, runID)
+}
+
+// InstallResumeUnit writes and enables the resume unit on the self-host, so
+// it re-invokes `nixfleet reboot resume runID` as soon as the host is back
+// up and networked. nixfleetBin, flakePath, and inventoryPath are the
+// absolute paths the current process was invoked with, so the resumed run
+// sees the same flake and inventory.
+func InstallResumeUnit(ctx context.Context, client *ssh.Client, nixfleetBin, flakePath, inventoryPath, runID string) error {
+	unit := renderResumeUnit(nixfleetBin, flakePath, inventoryPath, runID)
+	encoded := base64.StdEncoding.EncodeToString([]byte(unit))
+
+	cmd := fmt.Sprintf("bash -c \"echo '%s' | base64 -d > /etc/systemd/system/%s\"", encoded, resumeUnitName)
+	result, err := client.ExecSudo(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("writing resume unit: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("writing resume unit: %s", result.Stderr)
+	}
+
+	result, err = client.ExecSudo(ctx, fmt.Sprintf("systemctl enable %s", resumeUnitName))
+	if err != nil {
+		return fmt.Errorf("enabling resume unit: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("enabling resume unit: %s", result.Stderr)
+	}
+
+	return nil
+}
+
+// RemoveResumeUnit disables and removes the resume unit once its run has
+// finished, so the self-host doesn't re-run a stale resume on a later,
+// unrelated reboot.
+func RemoveResumeUnit(ctx context.Context, client *ssh.Client) error {
+	_, _ = client.ExecSudo(ctx, fmt.Sprintf("systemctl disable %s", resumeUnitName))
+	result, err := client.ExecSudo(ctx, fmt.Sprintf("rm -f /etc/systemd/system/%s", resumeUnitName))
+	if err != nil {
+		return fmt.Errorf("removing resume unit: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("removing resume unit: %s", result.Stderr)
+	}
+	return nil
+}
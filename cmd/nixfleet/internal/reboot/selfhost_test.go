@@ -0,0 +1,69 @@
+package reboot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+)
+
+func TestIsSelfHostFlag(t *testing.T) {
+	host := &inventory.Host{Name: "bastion", Self: true}
+	if !IsSelfHost(nil, nil, host) {
+		t.Error("IsSelfHost() = false, want true for host.Self = true")
+	}
+}
+
+func TestNewRunIDUnique(t *testing.T) {
+	a, err := NewRunID()
+	if err != nil {
+		t.Fatalf("NewRunID() error = %v", err)
+	}
+	b, err := NewRunID()
+	if err != nil {
+		t.Fatalf("NewRunID() error = %v", err)
+	}
+	if a == b {
+		t.Errorf("NewRunID() returned the same id twice: %s", a)
+	}
+	if len(a) == 0 {
+		t.Error("NewRunID() returned an empty id")
+	}
+}
+
+func TestCheckpointStoreSaveLoadRemove(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	store, err := NewCheckpointStore()
+	if err != nil {
+		t.Fatalf("NewCheckpointStore() error = %v", err)
+	}
+
+	run := &RunState{
+		RunID:         "test-run",
+		StartedAt:     time.Now(),
+		MaxConcurrent: 2,
+		Remaining:     []string{"bastion"},
+		Completed:     []string{"worker-1", "worker-2"},
+		SelfHost:      "bastion",
+	}
+
+	if err := store.Save(run); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := store.Load("test-run")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.SelfHost != run.SelfHost || len(loaded.Completed) != len(run.Completed) {
+		t.Errorf("Load() = %+v, want %+v", loaded, run)
+	}
+
+	if err := store.Remove("test-run"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := store.Load("test-run"); err == nil {
+		t.Error("Load() after Remove() succeeded, want error")
+	}
+}
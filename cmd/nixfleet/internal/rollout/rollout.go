@@ -0,0 +1,59 @@
+// Package rollout batches a set of hosts into an ordered rollout plan
+// (serial, parallel, or canary) shared by 'nixfleet os-update apply' and
+// 'nixfleet apply', so both commands gate a canary failure the same way
+// instead of reimplementing the percent math twice.
+package rollout
+
+import "github.com/nixfleet/nixfleet/internal/inventory"
+
+// Strategy is a named rollout strategy.
+type Strategy string
+
+const (
+	StrategySerial   Strategy = "serial"
+	StrategyParallel Strategy = "parallel"
+	StrategyCanary   Strategy = "canary"
+)
+
+// Batches splits hosts into ordered batches according to strategy:
+//
+//   - parallel: a single batch containing every host.
+//   - canary: a first batch of ceil-free canaryPercent% of hosts (at least
+//     one, unless there are none at all), then a second batch with the rest.
+//     If the canary batch would cover the whole fleet, it's collapsed into a
+//     single batch instead, since there'd be nothing left to gate on.
+//   - serial (including any unrecognized strategy): one batch per host, in
+//     order.
+//
+// The returned slices alias hosts and must not be mutated by the caller.
+func Batches(hosts []*inventory.Host, strategy string, canaryPercent int) [][]*inventory.Host {
+	switch Strategy(strategy) {
+	case StrategyParallel:
+		return [][]*inventory.Host{hosts}
+	case StrategyCanary:
+		canaryCount := (len(hosts) * canaryPercent) / 100
+		if canaryCount < 1 {
+			canaryCount = 1
+		}
+		if canaryCount >= len(hosts) {
+			return [][]*inventory.Host{hosts}
+		}
+		return [][]*inventory.Host{hosts[:canaryCount], hosts[canaryCount:]}
+	default: // serial
+		batches := make([][]*inventory.Host, 0, len(hosts))
+		for _, h := range hosts {
+			batches = append(batches, []*inventory.Host{h})
+		}
+		return batches
+	}
+}
+
+// ShouldAbortAfterBatch reports whether a rollout should stop before
+// starting its next batch, given the failure count observed in the batch at
+// batchIdx. Only a canary strategy's first batch gates the rest: serial
+// already isolates one host per batch (so a later batch proceeding despite
+// an earlier failure is the point), and parallel has no "next batch" to
+// abort.
+func ShouldAbortAfterBatch(strategy string, batchIdx int, failures int) bool {
+	return Strategy(strategy) == StrategyCanary && batchIdx == 0 && failures > 0
+}
@@ -0,0 +1,125 @@
+package rollout
+
+import (
+	"testing"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+)
+
+func hostsNamed(names ...string) []*inventory.Host {
+	hosts := make([]*inventory.Host, 0, len(names))
+	for _, n := range names {
+		hosts = append(hosts, &inventory.Host{Name: n})
+	}
+	return hosts
+}
+
+func batchNames(batches [][]*inventory.Host) [][]string {
+	names := make([][]string, 0, len(batches))
+	for _, batch := range batches {
+		var b []string
+		for _, h := range batch {
+			b = append(b, h.Name)
+		}
+		names = append(names, b)
+	}
+	return names
+}
+
+func TestBatchesSerial(t *testing.T) {
+	hosts := hostsNamed("a", "b", "c")
+	got := batchNames(Batches(hosts, "serial", 10))
+	want := [][]string{{"a"}, {"b"}, {"c"}}
+	if !equalBatches(got, want) {
+		t.Errorf("Batches(serial) = %v, want %v", got, want)
+	}
+}
+
+func TestBatchesParallel(t *testing.T) {
+	hosts := hostsNamed("a", "b", "c")
+	got := batchNames(Batches(hosts, "parallel", 10))
+	want := [][]string{{"a", "b", "c"}}
+	if !equalBatches(got, want) {
+		t.Errorf("Batches(parallel) = %v, want %v", got, want)
+	}
+}
+
+func TestBatchesCanaryPercentRounding(t *testing.T) {
+	tests := []struct {
+		name    string
+		hosts   int
+		percent int
+		want    [][]string
+	}{
+		// 10% of 3 rounds down to 0, clamped up to 1 canary host.
+		{"rounds up to at least one", 3, 10, [][]string{{"h0"}, {"h1", "h2"}}},
+		// 50% of 4 is exactly 2.
+		{"exact split", 4, 50, [][]string{{"h0", "h1"}, {"h2", "h3"}}},
+		// 100% would cover the whole fleet, so it collapses to one batch.
+		{"whole fleet collapses", 5, 100, [][]string{{"h0", "h1", "h2", "h3", "h4"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := make([]string, tt.hosts)
+			for i := range names {
+				names[i] = []string{"h0", "h1", "h2", "h3", "h4"}[i]
+			}
+			got := batchNames(Batches(hostsNamed(names...), "canary", tt.percent))
+			if !equalBatches(got, tt.want) {
+				t.Errorf("Batches(canary, %d%% of %d hosts) = %v, want %v", tt.percent, tt.hosts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchesSingleHostFleet(t *testing.T) {
+	for _, strategy := range []string{"serial", "parallel", "canary"} {
+		t.Run(strategy, func(t *testing.T) {
+			got := batchNames(Batches(hostsNamed("only"), strategy, 10))
+			want := [][]string{{"only"}}
+			if !equalBatches(got, want) {
+				t.Errorf("Batches(%s, 1 host) = %v, want %v", strategy, got, want)
+			}
+		})
+	}
+}
+
+func TestShouldAbortAfterBatch(t *testing.T) {
+	tests := []struct {
+		strategy string
+		batchIdx int
+		failures int
+		want     bool
+	}{
+		{"canary", 0, 1, true},
+		{"canary", 0, 0, false},
+		{"canary", 1, 1, false}, // only the first (canary) batch gates
+		{"serial", 0, 1, false}, // serial never aborts later batches
+		{"parallel", 0, 1, false},
+	}
+
+	for _, tt := range tests {
+		got := ShouldAbortAfterBatch(tt.strategy, tt.batchIdx, tt.failures)
+		if got != tt.want {
+			t.Errorf("ShouldAbortAfterBatch(%q, %d, %d) = %v, want %v", tt.strategy, tt.batchIdx, tt.failures, got, tt.want)
+		}
+	}
+}
+
+func equalBatches(a, b [][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,224 @@
+// Package schedule computes, across every recurring window a fleet has
+// registered (reboot windows, OS update windows, backup windows, and
+// whatever else grows its own window later), when each one actually fires
+// in a given time range, and flags overlaps between windows that shouldn't
+// run on the same host at the same time - a deploy stomping on a reboot,
+// a backup running mid dist-upgrade. It deliberately reuses
+// reboot.RebootWindow as the window representation rather than inventing a
+// parallel one, since "day-of-week + start/end time in a location" is
+// already exactly what every one of these activities needs.
+package schedule
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/reboot"
+)
+
+// ActivityType identifies what kind of thing a scheduled window runs.
+type ActivityType string
+
+const (
+	ActivityReboot    ActivityType = "reboot"
+	ActivityOSUpdate  ActivityType = "os-update"
+	ActivityDeploy    ActivityType = "deploy"
+	ActivityBackup    ActivityType = "backup"
+	ActivityAutoApply ActivityType = "auto-apply"
+	ActivityPKI       ActivityType = "pki-rotation"
+)
+
+// exclusiveWith lists, for each activity type, the other types that must
+// not overlap it on the same host. It's intentionally asymmetric-looking
+// but built symmetric by init() below, so callers only have to list each
+// pair once.
+var exclusiveWith = buildExclusivity(map[ActivityType][]ActivityType{
+	ActivityReboot:    {ActivityDeploy, ActivityOSUpdate, ActivityBackup, ActivityAutoApply},
+	ActivityOSUpdate:  {ActivityDeploy, ActivityBackup, ActivityAutoApply},
+	ActivityDeploy:    {ActivityBackup},
+	ActivityAutoApply: {ActivityBackup},
+})
+
+func buildExclusivity(pairs map[ActivityType][]ActivityType) map[ActivityType]map[ActivityType]bool {
+	m := make(map[ActivityType]map[ActivityType]bool)
+	add := func(a, b ActivityType) {
+		if m[a] == nil {
+			m[a] = make(map[ActivityType]bool)
+		}
+		m[a][b] = true
+	}
+	for a, others := range pairs {
+		for _, b := range others {
+			add(a, b)
+			add(b, a)
+		}
+	}
+	return m
+}
+
+// IsExclusive reports whether a and b are registered as mutually exclusive
+// activity types - two occurrences of such types overlapping on the same
+// host is a conflict.
+func IsExclusive(a, b ActivityType) bool {
+	return exclusiveWith[a][b]
+}
+
+// Activity is one registered recurring window: what it is, which host it
+// scopes to, and when it runs.
+type Activity struct {
+	Name   string
+	Host   string
+	Type   ActivityType
+	Window *reboot.RebootWindow
+}
+
+// Occurrence is a single concrete firing of an Activity within a queried
+// range.
+type Occurrence struct {
+	Name  string       `json:"name"`
+	Host  string       `json:"host"`
+	Type  ActivityType `json:"type"`
+	Start time.Time    `json:"start"`
+	End   time.Time    `json:"end"`
+}
+
+// overlaps reports whether o and other share any instant.
+func (o Occurrence) overlaps(other Occurrence) bool {
+	return o.Start.Before(other.End) && other.Start.Before(o.End)
+}
+
+// Conflict is two occurrences on the same host whose activity types are
+// registered exclusive and whose time ranges overlap.
+type Conflict struct {
+	Host string     `json:"host"`
+	A    Occurrence `json:"a"`
+	B    Occurrence `json:"b"`
+}
+
+// Registry holds the fleet's registered recurring activities. It has no
+// locking of its own: callers that mutate it concurrently with reads (the
+// server does, via its own config-reload path) are expected to swap in a
+// freshly built Registry rather than mutate one in place, the same
+// pattern ReloadConfig already uses elsewhere.
+type Registry struct {
+	activities []Activity
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds an activity. A nil Window never produces an occurrence -
+// it's accepted rather than rejected so callers can register an activity
+// unconditionally and let an unset window silently contribute nothing.
+func (r *Registry) Register(a Activity) {
+	r.activities = append(r.activities, a)
+}
+
+// Activities returns every registered activity, in registration order.
+func (r *Registry) Activities() []Activity {
+	return append([]Activity(nil), r.activities...)
+}
+
+// Occurrences computes every concrete firing of every registered activity
+// that overlaps [from, to), sorted by start time then host then name.
+//
+// Each activity's window is walked one calendar day at a time in the
+// window's own location, which is what makes this DST-safe: time.Date
+// with a *time.Location normalizes a nonexistent (spring-forward) or
+// ambiguous (fall-back) wall-clock time per Go's documented time.Date
+// behavior, and AddDate(0, 0, 1) advances by one calendar day respecting
+// that location's DST transitions rather than a fixed 24h duration - a
+// window that starts at 02:00 on the one day of the year that hour is
+// skipped simply doesn't occur that day, it isn't silently shifted into
+// the next window's slot.
+func Occurrences(activities []Activity, from, to time.Time) []Occurrence {
+	var out []Occurrence
+
+	for _, a := range activities {
+		if a.Window == nil {
+			continue
+		}
+		loc := a.Window.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+
+		fromLocal := from.In(loc)
+		toLocal := to.In(loc)
+
+		day := time.Date(fromLocal.Year(), fromLocal.Month(), fromLocal.Day(), 0, 0, 0, 0, loc)
+		// Walk one extra day back: an overnight window (e.g. 23:00-02:00)
+		// starting the day before `from` can still be in-progress at `from`.
+		day = day.AddDate(0, 0, -1)
+
+		for !day.After(toLocal) {
+			if a.Window.DayOfWeek >= 0 && day.Weekday() != a.Window.DayOfWeek {
+				day = day.AddDate(0, 0, 1)
+				continue
+			}
+
+			start := time.Date(day.Year(), day.Month(), day.Day(), a.Window.StartHour, a.Window.StartMin, 0, 0, loc)
+			end := time.Date(day.Year(), day.Month(), day.Day(), a.Window.EndHour, a.Window.EndMin, 0, 0, loc)
+			if !end.After(start) {
+				end = end.AddDate(0, 0, 1)
+			}
+
+			if end.After(fromLocal) && start.Before(toLocal) {
+				out = append(out, Occurrence{Name: a.Name, Host: a.Host, Type: a.Type, Start: start, End: end})
+			}
+
+			day = day.AddDate(0, 0, 1)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Start.Equal(out[j].Start) {
+			return out[i].Start.Before(out[j].Start)
+		}
+		if out[i].Host != out[j].Host {
+			return out[i].Host < out[j].Host
+		}
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
+
+// DetectConflicts finds every pair of occurrences on the same host whose
+// activity types are registered exclusive (see IsExclusive) and whose
+// time ranges overlap. Occurrences are assumed already sorted by start
+// time (as Occurrences returns them); the result is not deduplicated
+// beyond each unordered pair appearing once.
+func DetectConflicts(occurrences []Occurrence) []Conflict {
+	var conflicts []Conflict
+
+	byHost := make(map[string][]Occurrence)
+	for _, o := range occurrences {
+		byHost[o.Host] = append(byHost[o.Host], o)
+	}
+
+	for host, occs := range byHost {
+		for i := 0; i < len(occs); i++ {
+			for j := i + 1; j < len(occs); j++ {
+				if !occs[i].overlaps(occs[j]) {
+					continue
+				}
+				if !IsExclusive(occs[i].Type, occs[j].Type) {
+					continue
+				}
+				conflicts = append(conflicts, Conflict{Host: host, A: occs[i], B: occs[j]})
+			}
+		}
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Host != conflicts[j].Host {
+			return conflicts[i].Host < conflicts[j].Host
+		}
+		return conflicts[i].A.Start.Before(conflicts[j].A.Start)
+	})
+
+	return conflicts
+}
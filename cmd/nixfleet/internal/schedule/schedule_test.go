@@ -0,0 +1,195 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/reboot"
+)
+
+func mustLoc(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("tzdata for %q not available in this environment: %v", name, err)
+	}
+	return loc
+}
+
+func TestOccurrencesWeeklyWindow(t *testing.T) {
+	loc := time.UTC
+	window := &reboot.RebootWindow{DayOfWeek: time.Sunday, StartHour: 2, StartMin: 0, EndHour: 4, EndMin: 0, Location: loc}
+	activities := []Activity{{Name: "weekly-reboot", Host: "host-a", Type: ActivityReboot, Window: window}}
+
+	from := time.Date(2026, 8, 1, 0, 0, 0, 0, loc)
+	to := time.Date(2026, 8, 31, 0, 0, 0, 0, loc)
+
+	occs := Occurrences(activities, from, to)
+
+	// August 2026 has Sundays on 2, 9, 16, 23, 30.
+	wantDays := []int{2, 9, 16, 23, 30}
+	if len(occs) != len(wantDays) {
+		t.Fatalf("got %d occurrences, want %d: %+v", len(occs), len(wantDays), occs)
+	}
+	for i, o := range occs {
+		if o.Start.Day() != wantDays[i] || o.Start.Hour() != 2 || o.End.Hour() != 4 {
+			t.Errorf("occurrence %d = %v..%v, want day %d 02:00-04:00", i, o.Start, o.End, wantDays[i])
+		}
+	}
+}
+
+func TestOccurrencesOvernightWindow(t *testing.T) {
+	loc := time.UTC
+	window := &reboot.RebootWindow{DayOfWeek: -1, StartHour: 23, StartMin: 0, EndHour: 2, EndMin: 0, Location: loc}
+	activities := []Activity{{Name: "nightly", Host: "host-a", Type: ActivityBackup, Window: window}}
+
+	from := time.Date(2026, 3, 1, 1, 0, 0, 0, loc)
+	to := time.Date(2026, 3, 1, 1, 30, 0, 0, loc)
+
+	occs := Occurrences(activities, from, to)
+	if len(occs) != 1 {
+		t.Fatalf("expected the overnight window begun on Feb 28 to still be in progress at 01:00 Mar 1, got %+v", occs)
+	}
+	if occs[0].Start.Day() != 28 || occs[0].Start.Month() != time.February {
+		t.Errorf("expected window to start Feb 28 23:00, got %v", occs[0].Start)
+	}
+}
+
+func TestOccurrencesMonthBoundary(t *testing.T) {
+	loc := time.UTC
+	window := &reboot.RebootWindow{DayOfWeek: -1, StartHour: 1, StartMin: 0, EndHour: 2, EndMin: 0, Location: loc}
+	activities := []Activity{{Name: "daily", Host: "host-a", Type: ActivityBackup, Window: window}}
+
+	from := time.Date(2026, 1, 30, 0, 0, 0, 0, loc)
+	to := time.Date(2026, 2, 2, 0, 0, 0, 0, loc)
+
+	occs := Occurrences(activities, from, to)
+	if len(occs) != 3 {
+		t.Fatalf("expected occurrences on Jan 30, 31, Feb 1, got %d: %+v", len(occs), occs)
+	}
+	if occs[0].Start.Month() != time.January || occs[2].Start.Month() != time.February {
+		t.Errorf("expected to cross the January/February boundary cleanly, got %v .. %v", occs[0].Start, occs[2].Start)
+	}
+}
+
+func TestOccurrencesSpringForwardDST(t *testing.T) {
+	loc := mustLoc(t, "America/New_York")
+	// 2026-03-08 is the US spring-forward date; 02:00-02:30 local never
+	// occurs that day (clocks jump 02:00 -> 03:00).
+	window := &reboot.RebootWindow{DayOfWeek: -1, StartHour: 2, StartMin: 0, EndHour: 2, EndMin: 30, Location: loc}
+	activities := []Activity{{Name: "daily", Host: "host-a", Type: ActivityBackup, Window: window}}
+
+	from := time.Date(2026, 3, 8, 0, 0, 0, 0, loc)
+	to := time.Date(2026, 3, 9, 0, 0, 0, 0, loc)
+
+	occs := Occurrences(activities, from, to)
+	for _, o := range occs {
+		if o.Start.Day() != 8 {
+			continue
+		}
+		// The 02:00 wall-clock time doesn't exist on the spring-forward
+		// day; time.Date resolves it per Go's documented (implementation
+		// defined but deterministic) normalization rather than panicking
+		// or silently dropping the occurrence. We only assert that it
+		// still produced a well-formed, non-inverted window.
+		if !o.End.After(o.Start) {
+			t.Errorf("spring-forward occurrence has non-positive duration: %v..%v", o.Start, o.End)
+		}
+	}
+}
+
+func TestOccurrencesFallBackDST(t *testing.T) {
+	loc := mustLoc(t, "America/New_York")
+	// 2026-11-01 is the US fall-back date; 01:00-01:30 local occurs twice.
+	window := &reboot.RebootWindow{DayOfWeek: -1, StartHour: 1, StartMin: 0, EndHour: 1, EndMin: 30, Location: loc}
+	activities := []Activity{{Name: "daily", Host: "host-a", Type: ActivityBackup, Window: window}}
+
+	from := time.Date(2026, 11, 1, 0, 0, 0, 0, loc)
+	to := time.Date(2026, 11, 2, 0, 0, 0, 0, loc)
+
+	occs := Occurrences(activities, from, to)
+	found := false
+	for _, o := range occs {
+		if o.Start.Day() == 1 && o.Start.Hour() == 1 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a Nov 1 01:00 occurrence despite the fall-back repeated hour, got %+v", occs)
+	}
+}
+
+func TestDetectConflictsOverlappingExclusiveTypes(t *testing.T) {
+	loc := time.UTC
+	rebootWindow := &reboot.RebootWindow{DayOfWeek: -1, StartHour: 2, StartMin: 0, EndHour: 4, EndMin: 0, Location: loc}
+	backupWindow := &reboot.RebootWindow{DayOfWeek: -1, StartHour: 3, StartMin: 0, EndHour: 5, EndMin: 0, Location: loc}
+
+	activities := []Activity{
+		{Name: "reboot-window", Host: "host-a", Type: ActivityReboot, Window: rebootWindow},
+		{Name: "backup-window", Host: "host-a", Type: ActivityBackup, Window: backupWindow},
+	}
+
+	from := time.Date(2026, 8, 1, 0, 0, 0, 0, loc)
+	to := time.Date(2026, 8, 2, 0, 0, 0, 0, loc)
+
+	occs := Occurrences(activities, from, to)
+	conflicts := DetectConflicts(occs)
+
+	if len(conflicts) != 1 {
+		t.Fatalf("expected exactly 1 conflict (02:00-04:00 overlaps 03:00-05:00), got %d: %+v", len(conflicts), conflicts)
+	}
+	if conflicts[0].Host != "host-a" {
+		t.Errorf("conflict host = %q, want host-a", conflicts[0].Host)
+	}
+}
+
+func TestDetectConflictsNonOverlappingNoConflict(t *testing.T) {
+	loc := time.UTC
+	rebootWindow := &reboot.RebootWindow{DayOfWeek: -1, StartHour: 2, StartMin: 0, EndHour: 3, EndMin: 0, Location: loc}
+	backupWindow := &reboot.RebootWindow{DayOfWeek: -1, StartHour: 4, StartMin: 0, EndHour: 5, EndMin: 0, Location: loc}
+
+	activities := []Activity{
+		{Name: "reboot-window", Host: "host-a", Type: ActivityReboot, Window: rebootWindow},
+		{Name: "backup-window", Host: "host-a", Type: ActivityBackup, Window: backupWindow},
+	}
+
+	from := time.Date(2026, 8, 1, 0, 0, 0, 0, loc)
+	to := time.Date(2026, 8, 2, 0, 0, 0, 0, loc)
+
+	occs := Occurrences(activities, from, to)
+	if conflicts := DetectConflicts(occs); len(conflicts) != 0 {
+		t.Errorf("expected no conflicts for non-overlapping windows, got %+v", conflicts)
+	}
+}
+
+func TestDetectConflictsIgnoresNonExclusiveTypesAndDifferentHosts(t *testing.T) {
+	loc := time.UTC
+	window := &reboot.RebootWindow{DayOfWeek: -1, StartHour: 2, StartMin: 0, EndHour: 4, EndMin: 0, Location: loc}
+
+	activities := []Activity{
+		{Name: "reboot-a", Host: "host-a", Type: ActivityReboot, Window: window},
+		{Name: "reboot-b", Host: "host-b", Type: ActivityReboot, Window: window},
+		{Name: "pki-a", Host: "host-a", Type: ActivityPKI, Window: window},
+	}
+
+	from := time.Date(2026, 8, 1, 0, 0, 0, 0, loc)
+	to := time.Date(2026, 8, 2, 0, 0, 0, 0, loc)
+
+	occs := Occurrences(activities, from, to)
+	conflicts := DetectConflicts(occs)
+	if len(conflicts) != 0 {
+		t.Errorf("expected no conflicts (different hosts, and pki-rotation isn't registered exclusive with reboot), got %+v", conflicts)
+	}
+}
+
+func TestIsExclusiveSymmetric(t *testing.T) {
+	if !IsExclusive(ActivityReboot, ActivityDeploy) {
+		t.Error("expected reboot/deploy to be exclusive")
+	}
+	if !IsExclusive(ActivityDeploy, ActivityReboot) {
+		t.Error("expected exclusivity to be registered symmetrically")
+	}
+	if IsExclusive(ActivityReboot, ActivityPKI) {
+		t.Error("reboot/pki-rotation was not registered exclusive")
+	}
+}
@@ -0,0 +1,124 @@
+package search
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/apt"
+	"github.com/nixfleet/nixfleet/internal/state"
+)
+
+// CachedHostData is a point-in-time snapshot of one host's package and file
+// state, as last observed by whichever handler happened to SSH to it for
+// another reason (apt package listing, state read). CollectedAt covers the
+// snapshot as a whole rather than each field individually - good enough for
+// "how stale is this" without tracking per-field freshness.
+type CachedHostData struct {
+	Packages    []apt.Package              `json:"packages,omitempty"`
+	Files       map[string]state.FileState `json:"files,omitempty"`
+	StorePath   string                     `json:"store_path,omitempty"`
+	CollectedAt time.Time                  `json:"collected_at"`
+}
+
+// Cache is a disk-persisted, per-host snapshot of package/file data used to
+// answer search queries without ever triggering live SSH. It's updated
+// opportunistically (see server.Server's apt/state handlers) rather than on
+// its own schedule, so an entry may be arbitrarily stale or simply absent
+// until something else has talked to that host.
+type Cache struct {
+	path string
+
+	mu    sync.RWMutex
+	hosts map[string]CachedHostData
+}
+
+// NewCache creates a cache that persists under dataDir, loading any
+// existing snapshot immediately.
+func NewCache(dataDir string) *Cache {
+	c := &Cache{
+		path:  filepath.Join(dataDir, "search-cache.json"),
+		hosts: make(map[string]CachedHostData),
+	}
+	c.load()
+	return c
+}
+
+func (c *Cache) load() {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return
+	}
+	var hosts map[string]CachedHostData
+	if err := json.Unmarshal(data, &hosts); err != nil {
+		log.Printf("search.Cache: failed to load state: %v", err)
+		return
+	}
+	c.mu.Lock()
+	c.hosts = hosts
+	c.mu.Unlock()
+}
+
+func (c *Cache) save() {
+	c.mu.RLock()
+	data, err := json.MarshalIndent(c.hosts, "", "  ")
+	c.mu.RUnlock()
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		log.Printf("search.Cache: failed to create data dir: %v", err)
+		return
+	}
+	if err := os.WriteFile(c.path, data, 0644); err != nil {
+		log.Printf("search.Cache: failed to save state: %v", err)
+	}
+}
+
+// UpdatePackages records host's currently installed packages, leaving any
+// previously cached file/store-path data for the host untouched.
+func (c *Cache) UpdatePackages(host string, packages []apt.Package) {
+	c.mu.Lock()
+	entry := c.hosts[host]
+	entry.Packages = packages
+	entry.CollectedAt = time.Now()
+	c.hosts[host] = entry
+	c.mu.Unlock()
+	c.save()
+}
+
+// UpdateState records host's managed files and deployed store path, leaving
+// any previously cached package data for the host untouched.
+func (c *Cache) UpdateState(host string, files map[string]state.FileState, storePath string) {
+	c.mu.Lock()
+	entry := c.hosts[host]
+	entry.Files = files
+	entry.StorePath = storePath
+	entry.CollectedAt = time.Now()
+	c.hosts[host] = entry
+	c.mu.Unlock()
+	c.save()
+}
+
+// Get returns the cached snapshot for host, if any.
+func (c *Cache) Get(host string) (CachedHostData, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	data, ok := c.hosts[host]
+	return data, ok
+}
+
+// All returns a copy of every cached host snapshot, keyed by host name.
+func (c *Cache) All() map[string]CachedHostData {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make(map[string]CachedHostData, len(c.hosts))
+	for k, v := range c.hosts {
+		out[k] = v
+	}
+	return out
+}
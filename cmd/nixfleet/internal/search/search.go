@@ -0,0 +1,292 @@
+// Package search implements a fleet-wide search across hosts, cached
+// package/file state, and PKI certificates, so questions like "which hosts
+// have openssl 3.0.2" or "which hosts still have the old wildcard cert" can
+// be answered in seconds during an incident. Search never triggers live
+// SSH: package and file data come from Cache, a disk-persisted snapshot
+// updated opportunistically whenever the server already talks to a host
+// for another reason (see server.Server's apt/state handlers), and host
+// and certificate data are already local (inventory.Inventory, pki.Store).
+// Stale cache entries are returned as-is, tagged with when they were
+// collected, rather than silently refreshed.
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+	"github.com/nixfleet/nixfleet/internal/pki"
+)
+
+// Match is one search hit.
+type Match struct {
+	Type        string    `json:"type"` // "host", "package", "file", "cert"
+	Host        string    `json:"host"`
+	Value       string    `json:"value"`            // the matched name: package name, file path, cert CN, host field
+	Detail      string    `json:"detail,omitempty"` // e.g. installed version, cert expiry
+	CollectedAt time.Time `json:"collected_at,omitempty"`
+}
+
+// Results is the response to a search query.
+type Results struct {
+	Query   string  `json:"query"`
+	Type    string  `json:"type"`
+	Matches []Match `json:"matches"`
+}
+
+// queryRegex splits a raw query into an optional leading "type:" prefix, a
+// term, and an optional trailing comparison operator and value, e.g.
+// "package:openssl<3.0.7" -> type=package term=openssl op=< value=3.0.7.
+var queryRegex = regexp.MustCompile(`^(?:(\w+):)?([^<>=]+?)(?:\s*(<|>|=)\s*(.+))?$`)
+
+// parsedQuery is a single search term after operator parsing.
+type parsedQuery struct {
+	Type  string // "", "host", "package", "file", "cert", "any"
+	Term  string
+	Op    string // "", "<", ">", "="
+	Value string
+}
+
+// parseQuery parses raw, falling back to defaultType when raw carries no
+// "type:" prefix of its own.
+func parseQuery(raw, defaultType string) parsedQuery {
+	m := queryRegex.FindStringSubmatch(strings.TrimSpace(raw))
+	if m == nil {
+		return parsedQuery{Type: defaultType, Term: raw}
+	}
+
+	q := parsedQuery{Type: m[1], Term: strings.TrimSpace(m[2]), Op: m[3], Value: strings.TrimSpace(m[4])}
+	if q.Type == "" {
+		q.Type = defaultType
+	}
+	if q.Type == "" {
+		q.Type = "any"
+	}
+	return q
+}
+
+// Run searches inv, certStore, and cache for raw, restricted to typeFilter
+// ("host", "package", "file", "cert", or "any"/"" for everything). certStore
+// and cache may be nil, in which case the corresponding match types are
+// skipped rather than erroring.
+func Run(inv *inventory.Inventory, certStore *pki.Store, cache *Cache, raw, typeFilter string) Results {
+	q := parseQuery(raw, typeFilter)
+
+	var matches []Match
+	if q.Type == "any" || q.Type == "host" {
+		matches = append(matches, searchHosts(inv, q)...)
+	}
+	if certStore != nil && (q.Type == "any" || q.Type == "cert") {
+		matches = append(matches, searchCerts(inv, certStore, q)...)
+	}
+	if cache != nil && (q.Type == "any" || q.Type == "package") {
+		matches = append(matches, searchPackages(cache, q)...)
+	}
+	if cache != nil && (q.Type == "any" || q.Type == "file") {
+		matches = append(matches, searchFiles(cache, q)...)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Type != matches[j].Type {
+			return matches[i].Type < matches[j].Type
+		}
+		if matches[i].Host != matches[j].Host {
+			return matches[i].Host < matches[j].Host
+		}
+		return matches[i].Value < matches[j].Value
+	})
+
+	return Results{Query: raw, Type: q.Type, Matches: matches}
+}
+
+func searchHosts(inv *inventory.Inventory, q parsedQuery) []Match {
+	var matches []Match
+	term := strings.ToLower(q.Term)
+
+	for _, h := range inv.AllHosts() {
+		if strings.Contains(strings.ToLower(h.Name), term) {
+			matches = append(matches, Match{Type: "host", Host: h.Name, Value: h.Name, Detail: "host name"})
+			continue
+		}
+		if strings.Contains(strings.ToLower(h.Addr), term) {
+			matches = append(matches, Match{Type: "host", Host: h.Name, Value: h.Addr, Detail: "address"})
+			continue
+		}
+		for _, role := range h.Roles {
+			if strings.Contains(strings.ToLower(role), term) {
+				matches = append(matches, Match{Type: "host", Host: h.Name, Value: role, Detail: "role"})
+				break
+			}
+		}
+		for k, v := range h.Tags {
+			if strings.Contains(strings.ToLower(k), term) || strings.Contains(strings.ToLower(v), term) {
+				matches = append(matches, Match{Type: "host", Host: h.Name, Value: fmt.Sprintf("%s=%s", k, v), Detail: "tag"})
+				break
+			}
+		}
+	}
+	return matches
+}
+
+func searchCerts(inv *inventory.Inventory, certStore *pki.Store, q parsedQuery) []Match {
+	var matches []Match
+
+	// "cert:expires<30d" checks days-until-expiry rather than a text match.
+	var maxDays int
+	expiresQuery := q.Op != "" && strings.EqualFold(q.Term, "expires")
+	if expiresQuery {
+		maxDays, _ = parseDays(q.Value)
+	}
+
+	for _, h := range inv.AllHosts() {
+		names, err := certStore.ListHostNamedCerts(h.Name)
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			info, err := certStore.GetNamedCertInfo(h.Name, name)
+			if err != nil {
+				continue
+			}
+
+			if expiresQuery {
+				if compareInt(info.DaysLeft, q.Op, maxDays) {
+					matches = append(matches, Match{
+						Type:   "cert",
+						Host:   h.Name,
+						Value:  name,
+						Detail: fmt.Sprintf("expires in %d days (%s)", info.DaysLeft, info.Status),
+					})
+				}
+				continue
+			}
+
+			if certMatchesTerm(info, q.Term) {
+				matches = append(matches, Match{
+					Type:   "cert",
+					Host:   h.Name,
+					Value:  name,
+					Detail: fmt.Sprintf("serial %s, expires in %d days", info.Serial, info.DaysLeft),
+				})
+			}
+		}
+	}
+	return matches
+}
+
+func certMatchesTerm(info *pki.CertInfo, term string) bool {
+	term = strings.ToLower(term)
+	if strings.Contains(strings.ToLower(info.Hostname), term) || strings.Contains(strings.ToLower(info.Serial), term) {
+		return true
+	}
+	for _, san := range info.SANs {
+		if strings.Contains(strings.ToLower(san), term) {
+			return true
+		}
+	}
+	return false
+}
+
+func searchPackages(cache *Cache, q parsedQuery) []Match {
+	var matches []Match
+	term := strings.ToLower(q.Term)
+
+	for host, data := range cache.All() {
+		for _, pkg := range data.Packages {
+			if !strings.Contains(strings.ToLower(pkg.Name), term) {
+				continue
+			}
+			if q.Op != "" && !compareVersions(pkg.InstalledVersion, q.Op, q.Value) {
+				continue
+			}
+			matches = append(matches, Match{
+				Type:        "package",
+				Host:        host,
+				Value:       pkg.Name,
+				Detail:      pkg.InstalledVersion,
+				CollectedAt: data.CollectedAt,
+			})
+		}
+	}
+	return matches
+}
+
+func searchFiles(cache *Cache, q parsedQuery) []Match {
+	var matches []Match
+	term := strings.ToLower(q.Term)
+
+	for host, data := range cache.All() {
+		if data.StorePath != "" && strings.Contains(strings.ToLower(data.StorePath), term) {
+			matches = append(matches, Match{Type: "file", Host: host, Value: data.StorePath, Detail: "deployed store path", CollectedAt: data.CollectedAt})
+		}
+		for path := range data.Files {
+			if strings.Contains(strings.ToLower(path), term) {
+				matches = append(matches, Match{Type: "file", Host: host, Value: path, Detail: "managed file", CollectedAt: data.CollectedAt})
+			}
+		}
+	}
+	return matches
+}
+
+// compareVersions reports whether a op b holds, comparing dot-separated
+// numeric segments left to right (e.g. "3.0.2" < "3.0.7") and falling back
+// to a plain string comparison for anything non-numeric, e.g. distro
+// suffixes like "3.0.7-1ubuntu2".
+func compareVersions(a, op, b string) bool {
+	c := compareVersionStrings(a, b)
+	return compareResult(c, op)
+}
+
+func compareVersionStrings(a, b string) int {
+	as := strings.FieldsFunc(a, func(r rune) bool { return r == '.' || r == '-' || r == '~' })
+	bs := strings.FieldsFunc(b, func(r rune) bool { return r == '.' || r == '-' || r == '~' })
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var av, bv string
+		if i < len(as) {
+			av = as[i]
+		}
+		if i < len(bs) {
+			bv = bs[i]
+		}
+		an, aerr := strconv.Atoi(av)
+		bn, berr := strconv.Atoi(bv)
+		if aerr == nil && berr == nil {
+			if an != bn {
+				return an - bn
+			}
+			continue
+		}
+		if av != bv {
+			return strings.Compare(av, bv)
+		}
+	}
+	return 0
+}
+
+func compareInt(a int, op string, b int) bool {
+	return compareResult(a-b, op)
+}
+
+func compareResult(diff int, op string) bool {
+	switch op {
+	case "<":
+		return diff < 0
+	case ">":
+		return diff > 0
+	case "=":
+		return diff == 0
+	default:
+		return diff == 0
+	}
+}
+
+// parseDays parses a duration like "30d" into an integer day count.
+func parseDays(s string) (int, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "d")
+	return strconv.Atoi(s)
+}
@@ -0,0 +1,48 @@
+package search
+
+import "testing"
+
+func TestParseQuery(t *testing.T) {
+	cases := []struct {
+		raw         string
+		defaultType string
+		want        parsedQuery
+	}{
+		{"openssl", "any", parsedQuery{Type: "any", Term: "openssl"}},
+		{"openssl", "package", parsedQuery{Type: "package", Term: "openssl"}},
+		{"host:web1", "any", parsedQuery{Type: "host", Term: "web1"}},
+		{"package:openssl<3.0.7", "any", parsedQuery{Type: "package", Term: "openssl", Op: "<", Value: "3.0.7"}},
+		{"cert:expires<30d", "any", parsedQuery{Type: "cert", Term: "expires", Op: "<", Value: "30d"}},
+	}
+	for _, c := range cases {
+		got := parseQuery(c.raw, c.defaultType)
+		if got != c.want {
+			t.Errorf("parseQuery(%q, %q) = %+v, want %+v", c.raw, c.defaultType, got, c.want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, op, b string
+		want     bool
+	}{
+		{"3.0.2", "<", "3.0.7", true},
+		{"3.0.7", "<", "3.0.2", false},
+		{"3.0.7", "=", "3.0.7", true},
+		{"3.0.7-1ubuntu2", ">", "3.0.7", true},
+		{"1.2", "<", "1.10", true}, // numeric segment compare, not lexical
+	}
+	for _, c := range cases {
+		if got := compareVersions(c.a, c.op, c.b); got != c.want {
+			t.Errorf("compareVersions(%q, %q, %q) = %v, want %v", c.a, c.op, c.b, got, c.want)
+		}
+	}
+}
+
+func TestParseDays(t *testing.T) {
+	got, err := parseDays("30d")
+	if err != nil || got != 30 {
+		t.Errorf("parseDays(30d) = %d, %v, want 30, nil", got, err)
+	}
+}
@@ -0,0 +1,206 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// AccessMarker classifies one (secret, principal) pairing in an AccessMatrix.
+type AccessMarker string
+
+const (
+	// MarkerDeclaredEncrypted means the principal is a recipient in
+	// secrets.nix and the on-disk .age file's recipient count matches, so
+	// the principal is presumed able to decrypt it.
+	MarkerDeclaredEncrypted AccessMarker = "declared-and-encrypted"
+
+	// MarkerDeclaredNotEncrypted means secrets.nix declares the principal
+	// as a recipient but the .age file has fewer recipient stanzas than
+	// declared (or doesn't exist at all) - the file is stale or was never
+	// created, e.g. after an edit to secrets.nix that hasn't been followed
+	// by `secrets rekey`.
+	MarkerDeclaredNotEncrypted AccessMarker = "declared-but-not-encrypted"
+
+	// MarkerEncryptedNotDeclared means the .age file has more recipient
+	// stanzas than secrets.nix declares, or exists with no secrets.nix
+	// entry at all - ciphertext a reader can't attribute to a specific
+	// principal (age recipient stanzas don't identify who they're for;
+	// see BuildAccessMatrix), surfaced as an "unidentified recipient" row
+	// so it isn't silently missed in an audit.
+	MarkerEncryptedNotDeclared AccessMarker = "encrypted-but-not-declared"
+)
+
+// AccessMatrixEntry is one row: whether Principal can read Secret, and why.
+type AccessMatrixEntry struct {
+	Secret    string       `json:"secret"`
+	Principal string       `json:"principal"` // "admin:<name>", "host:<name>", or "unidentified"
+	Marker    AccessMarker `json:"marker"`
+}
+
+// AccessMatrix is the result of BuildAccessMatrix: every (secret, principal)
+// pairing secrets.nix or the secrets directory knows about, sorted by
+// secret then principal so two runs against an unchanged tree produce
+// byte-identical JSON.
+type AccessMatrix struct {
+	Entries []AccessMatrixEntry `json:"entries"`
+}
+
+// BuildAccessMatrix cross-references every secret in config against the
+// principals (admins and hosts) declared as its recipients, then checks
+// that declaration against the recipient stanzas actually present in the
+// corresponding .age file under secretsDir.
+//
+// age doesn't record which recipient a stanza belongs to - each "-> X25519
+// ..." line is an ephemeral key wrapping the file key for one recipient,
+// indistinguishable from any other without that recipient's identity to
+// test-decrypt with - so, like CheckManifest's drift detection, the
+// cross-check is by count rather than by identity: a file with fewer
+// stanzas than secrets.nix declares is missing recipients (flagged
+// declared-but-not-encrypted), a file with more has recipients secrets.nix
+// doesn't account for (flagged encrypted-but-not-declared, since the
+// surplus stanzas can't be attributed to a principal).
+func BuildAccessMatrix(secretsDir string, config *SecretsNixConfig) (*AccessMatrix, error) {
+	if config == nil {
+		return nil, fmt.Errorf("secrets.nix config is required")
+	}
+
+	principalByKey := make(map[string]string, len(config.Admins)+len(config.Hosts))
+	for name, key := range config.Admins {
+		principalByKey[key] = "admin:" + name
+	}
+	for name, key := range config.Hosts {
+		principalByKey[key] = "host:" + name
+	}
+
+	secretNames := make([]string, 0, len(config.Secrets))
+	for name := range config.Secrets {
+		secretNames = append(secretNames, name)
+	}
+	sort.Strings(secretNames)
+
+	var entries []AccessMatrixEntry
+	for _, secretName := range secretNames {
+		entry := config.Secrets[secretName]
+
+		declared := make([]string, 0, len(entry.PublicKeys))
+		for _, key := range entry.PublicKeys {
+			principal, ok := principalByKey[key]
+			if !ok {
+				principal = "unidentified"
+			}
+			declared = append(declared, principal)
+		}
+		sort.Strings(declared)
+
+		actualCount, err := countRecipientStanzas(filepath.Join(secretsDir, secretName))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", secretName, err)
+		}
+
+		declaredMarker := MarkerDeclaredEncrypted
+		if actualCount < len(declared) {
+			declaredMarker = MarkerDeclaredNotEncrypted
+		}
+		for _, principal := range declared {
+			entries = append(entries, AccessMatrixEntry{Secret: secretName, Principal: principal, Marker: declaredMarker})
+		}
+
+		if surplus := actualCount - len(declared); surplus > 0 {
+			for i := 0; i < surplus; i++ {
+				entries = append(entries, AccessMatrixEntry{Secret: secretName, Principal: "unidentified", Marker: MarkerEncryptedNotDeclared})
+			}
+		}
+	}
+
+	// .age files on disk with no secrets.nix entry at all: every recipient
+	// stanza they carry is encrypted-but-not-declared, since there's no
+	// declaration to even compare the count against.
+	orphans, err := orphanedSecretFiles(secretsDir, config)
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range orphans {
+		count, err := countRecipientStanzas(filepath.Join(secretsDir, rel))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", rel, err)
+		}
+		for i := 0; i < count; i++ {
+			entries = append(entries, AccessMatrixEntry{Secret: rel, Principal: "unidentified", Marker: MarkerEncryptedNotDeclared})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Secret != entries[j].Secret {
+			return entries[i].Secret < entries[j].Secret
+		}
+		return entries[i].Principal < entries[j].Principal
+	})
+
+	return &AccessMatrix{Entries: entries}, nil
+}
+
+// countRecipientStanzas returns the number of recipient stanzas in the .age
+// file at path, or 0 if the file doesn't exist - a secrets.nix entry that
+// hasn't been encrypted yet (e.g. `secrets add` was never run after the
+// entry was declared).
+func countRecipientStanzas(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	recipients, err := parseRecipientStanzas(data)
+	if err != nil {
+		return 0, fmt.Errorf("parsing recipients: %w", err)
+	}
+	return len(recipients), nil
+}
+
+// orphanedSecretFiles returns, sorted, the .age files directly under
+// secretsDir that have no matching entry in config.Secrets.
+func orphanedSecretFiles(secretsDir string, config *SecretsNixConfig) ([]string, error) {
+	files, err := os.ReadDir(secretsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", secretsDir, err)
+	}
+
+	var orphans []string
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".age" {
+			continue
+		}
+		if _, declared := config.Secrets[f.Name()]; declared {
+			continue
+		}
+		orphans = append(orphans, f.Name())
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
+
+// FilterAccessMatrix returns the subset of m.Entries matching secret and
+// host, either of which may be empty to skip that filter. host matches
+// against the "host:<name>" principal form.
+func FilterAccessMatrix(m *AccessMatrix, secret, host string) *AccessMatrix {
+	if secret == "" && host == "" {
+		return m
+	}
+	filtered := &AccessMatrix{}
+	for _, e := range m.Entries {
+		if secret != "" && e.Secret != secret {
+			continue
+		}
+		if host != "" && e.Principal != "host:"+host {
+			continue
+		}
+		filtered.Entries = append(filtered.Entries, e)
+	}
+	return filtered
+}
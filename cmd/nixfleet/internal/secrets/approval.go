@@ -0,0 +1,275 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// DefaultApprovalTTL is how long an ApprovalRequest is valid for if no
+// explicit expiry is requested.
+const DefaultApprovalTTL = time.Hour
+
+// ApprovalSignNamespace scopes ssh-keygen -Y sign/verify signatures to this
+// use, the same way `git commit -S` uses "git" as its namespace - so a
+// signature produced for an approval can never be replayed to satisfy an
+// unrelated ssh-keygen signing check.
+const ApprovalSignNamespace = "nixfleet-approval"
+
+// Operation identifies which secrets command an ApprovalRequest gates.
+type Operation string
+
+const (
+	OperationDecrypt Operation = "decrypt"
+	OperationEdit    Operation = "edit"
+	OperationDeploy  Operation = "deploy"
+)
+
+// ApprovalRequest is a two-person-rule request to decrypt, edit, or deploy
+// a secret marked requiresApproval = true in secrets.nix. The requester
+// creates it locally (or the server does, if it received the operation)
+// and must sign it with SignRequest, proving Requester names a real signer
+// rather than an arbitrary string; it isn't valid to act on until a second
+// admin - never the requester - countersigns it with SignGrant.
+type ApprovalRequest struct {
+	ID                 string    `json:"id"`
+	SecretName         string    `json:"secret_name"`
+	Operation          Operation `json:"operation"`
+	Requester          string    `json:"requester"` // requester's signer principal, e.g. an email matching an allowed_signers entry
+	RequesterSignature string    `json:"requester_signature,omitempty"`
+	Purpose            string    `json:"purpose"`
+	CreatedAt          time.Time `json:"created_at"`
+	ExpiresAt          time.Time `json:"expires_at"`
+	Grants             []Grant   `json:"grants,omitempty"`
+}
+
+// Grant is a second admin's signature over an ApprovalRequest's binding
+// fields.
+type Grant struct {
+	Signer    string    `json:"signer"` // signer principal, matched against an allowed_signers file
+	Signature string    `json:"signature"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// NewApprovalRequest builds a fresh request bound to exactly one secret and
+// operation, expiring after ttl (DefaultApprovalTTL if ttl <= 0). Its ID is
+// derived from the binding fields, so it can be recomputed and checked
+// rather than trusted as an opaque token.
+func NewApprovalRequest(secretName string, operation Operation, requester, purpose string, ttl time.Duration) *ApprovalRequest {
+	if ttl <= 0 {
+		ttl = DefaultApprovalTTL
+	}
+	now := time.Now()
+	req := &ApprovalRequest{
+		SecretName: secretName,
+		Operation:  operation,
+		Requester:  requester,
+		Purpose:    purpose,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	req.ID = req.computeID()
+	return req
+}
+
+// computeID derives a stable identifier from r's binding fields, so an ID
+// always names exactly one (secret, operation, requester, expiry) tuple.
+func (r *ApprovalRequest) computeID() string {
+	h := sha256.Sum256(r.signingBytes())
+	return hex.EncodeToString(h[:])[:16]
+}
+
+// SetID recomputes and assigns r.ID from its current binding fields. Used
+// by callers that build an ApprovalRequest by hand instead of through
+// NewApprovalRequest - e.g. the server reconstructing one from a client's
+// POST /api/approvals body, where CreatedAt/ExpiresAt come from the
+// request rather than time.Now().
+func (r *ApprovalRequest) SetID() {
+	r.ID = r.computeID()
+}
+
+// signingBytes returns the canonical bytes a grant signs over: everything
+// that binds the approval to one specific secret, operation, requester, and
+// expiry. A signature over these bytes can't be replayed to approve a
+// different secret, a different operation, or an extended expiry.
+func (r *ApprovalRequest) signingBytes() []byte {
+	return []byte(fmt.Sprintf("nixfleet-approval-v1\nsecret=%s\noperation=%s\nrequester=%s\npurpose=%s\nexpires=%s",
+		r.SecretName, r.Operation, r.Requester, r.Purpose, r.ExpiresAt.UTC().Format(time.RFC3339)))
+}
+
+// IsExpired reports whether r's expiry has passed.
+func (r *ApprovalRequest) IsExpired() bool {
+	return time.Now().After(r.ExpiresAt)
+}
+
+// SignRequest signs r as r.Requester using the SSH private key at
+// identityPath (via `ssh-keygen -Y sign`), populating RequesterSignature.
+// This is what turns Requester from an arbitrary, unauthenticated string
+// into a claim a verifier can check against allowed_signers: without it, a
+// single actor could write someone else's name into Requester and then
+// grant their own request with their own genuine key, since nothing tied
+// Requester to a real signer. A request without a valid RequesterSignature
+// never satisfies HasValidGrant, however many grants it accumulates.
+func SignRequest(ctx context.Context, r *ApprovalRequest, identityPath string) error {
+	sig, err := signPayload(ctx, r.signingBytes(), identityPath)
+	if err != nil {
+		return fmt.Errorf("signing request: %w", err)
+	}
+	r.RequesterSignature = sig
+	return nil
+}
+
+// SignGrant countersigns r as signerPrincipal using the SSH private key at
+// identityPath (via `ssh-keygen -Y sign`), refusing to let the requester
+// grant their own request. The caller is responsible for delivering the
+// resulting Grant back to wherever r is stored (the server, or the shared
+// approvals file in offline mode).
+func SignGrant(ctx context.Context, r *ApprovalRequest, identityPath, signerPrincipal string) (Grant, error) {
+	if signerPrincipal == r.Requester {
+		return Grant{}, fmt.Errorf("the requester cannot grant their own approval")
+	}
+
+	sig, err := signPayload(ctx, r.signingBytes(), identityPath)
+	if err != nil {
+		return Grant{}, fmt.Errorf("signing approval: %w", err)
+	}
+
+	return Grant{Signer: signerPrincipal, Signature: sig, GrantedAt: time.Now()}, nil
+}
+
+// signPayload signs payload with the SSH private key at identityPath via
+// `ssh-keygen -Y sign`, the mechanism both SignRequest and SignGrant sign
+// over their respective binding fields with.
+func signPayload(ctx context.Context, payload []byte, identityPath string) (string, error) {
+	tmp, err := os.CreateTemp("", "nixfleet-approval-*")
+	if err != nil {
+		return "", fmt.Errorf("creating temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	if _, err := tmp.Write(payload); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("writing signing payload: %w", err)
+	}
+	tmp.Close()
+
+	sigPath := tmpPath + ".sig"
+	defer os.Remove(sigPath)
+
+	cmd := exec.CommandContext(ctx, "ssh-keygen", "-Y", "sign", "-n", ApprovalSignNamespace, "-f", identityPath, tmpPath)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s", stderr.String())
+	}
+
+	sig, err := os.ReadFile(sigPath)
+	if err != nil {
+		return "", fmt.Errorf("reading signature: %w", err)
+	}
+	return string(sig), nil
+}
+
+// verifySignature checks that signature is a valid `ssh-keygen -Y sign`
+// signature over payload from principal, using an SSH allowed_signers file
+// (the "<principal> <key-type> <base64-key>" format `ssh-keygen -Y verify`
+// and git's gpg.ssh.allowedSignersFile both use). A malformed signature or
+// a principal missing from allowedSignersPath both just report false, not
+// an error.
+func verifySignature(ctx context.Context, payload []byte, signature, principal, allowedSignersPath string) (bool, error) {
+	sigPath, err := writeTempFile("nixfleet-approval-sig-*.sig", []byte(signature))
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(sigPath)
+
+	cmd := exec.CommandContext(ctx, "ssh-keygen", "-Y", "verify",
+		"-n", ApprovalSignNamespace,
+		"-f", allowedSignersPath,
+		"-I", principal,
+		"-s", sigPath,
+	)
+	cmd.Stdin = bytes.NewReader(payload)
+	if err := cmd.Run(); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+// VerifyRequesterSignature checks that r.RequesterSignature is a valid
+// signature over r's binding fields from r.Requester, proving Requester
+// names a real principal in allowedSignersPath rather than an arbitrary,
+// unauthenticated string. A request with no RequesterSignature at all
+// (e.g. one created before this check existed) fails closed.
+func VerifyRequesterSignature(ctx context.Context, r *ApprovalRequest, allowedSignersPath string) (bool, error) {
+	if r.RequesterSignature == "" {
+		return false, nil
+	}
+	return verifySignature(ctx, r.signingBytes(), r.RequesterSignature, r.Requester, allowedSignersPath)
+}
+
+// VerifyGrant checks that g is a valid signature over r's binding fields
+// from g.Signer, using an SSH allowed_signers file (the "<principal>
+// <key-type> <base64-key>" format `ssh-keygen -Y verify` and git's
+// gpg.ssh.allowedSignersFile both use). A malformed signature or a signer
+// missing from allowedSignersPath both just report false, not an error.
+func VerifyGrant(ctx context.Context, r *ApprovalRequest, g Grant, allowedSignersPath string) (bool, error) {
+	return verifySignature(ctx, r.signingBytes(), g.Signature, g.Signer, allowedSignersPath)
+}
+
+// HasValidGrant reports whether r's own Requester signature checks out
+// against allowedSignersPath AND r carries at least one non-expired grant
+// from a signer other than the requester that also verifies - the check
+// `secrets decrypt/edit/deploy` makes before proceeding on a secret marked
+// requiresApproval. Verifying RequesterSignature first is what makes "a
+// signer other than the requester" mean a real, distinct principal instead
+// of just a string comparison against unauthenticated input: without it, a
+// single actor could name an arbitrary Requester and then grant their own
+// request with their own genuine key.
+func (r *ApprovalRequest) HasValidGrant(ctx context.Context, allowedSignersPath string) (bool, error) {
+	if r.IsExpired() {
+		return false, nil
+	}
+
+	requesterOK, err := VerifyRequesterSignature(ctx, r, allowedSignersPath)
+	if err != nil {
+		return false, err
+	}
+	if !requesterOK {
+		return false, nil
+	}
+
+	for _, g := range r.Grants {
+		if g.Signer == r.Requester {
+			continue
+		}
+		ok, err := VerifyGrant(ctx, r, g, allowedSignersPath)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func writeTempFile(pattern string, data []byte) (string, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("creating temp file: %w", err)
+	}
+	path := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", fmt.Errorf("writing temp file: %w", err)
+	}
+	f.Close()
+	return path, nil
+}
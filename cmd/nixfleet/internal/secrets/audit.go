@@ -0,0 +1,62 @@
+package secrets
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// AuditEntry records a single secrets operation and, for one gated by
+// requiresApproval, the approval request behind it. See pki.AuditLogger,
+// which this mirrors for cert-issuance decisions.
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"`
+	SecretName string    `json:"secret_name"`
+	Operation  Operation `json:"operation"`
+	ApprovalID string    `json:"approval_id,omitempty"`
+	Allowed    bool      `json:"allowed"`
+	Reason     string    `json:"reason,omitempty"`
+}
+
+// AuditLogger appends secrets operations to a JSON-lines file. Like
+// pki.AuditLogger, it's intentionally append-only and file-based rather
+// than pulling in a database dependency for what's just a security log.
+type AuditLogger struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewAuditLogger creates a logger that appends to path.
+func NewAuditLogger(path string) *AuditLogger {
+	return &AuditLogger{path: path}
+}
+
+// Log appends entry to the audit log, stamping Time if it's zero.
+func (l *AuditLogger) Log(entry AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,121 @@
+package secrets
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Finding describes a suspected plaintext secret found in a file
+type Finding struct {
+	Path   string
+	Line   int
+	Reason string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d: %s", f.Path, f.Line, f.Reason)
+}
+
+// plaintextSecretPatterns match content that should never be committed
+// unencrypted: PEM/SSH private keys, age identities, and common cloud
+// provider secret key formats.
+var plaintextSecretPatterns = []struct {
+	reason string
+	re     *regexp.Regexp
+}{
+	{"PEM private key block", regexp.MustCompile(`-----BEGIN (RSA |EC |OPENSSH |DSA |)PRIVATE KEY-----`)},
+	{"age identity (unencrypted private key)", regexp.MustCompile(`^AGE-SECRET-KEY-1[A-Z0-9]+$`)},
+	{"AWS access key ID", regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`)},
+	{"GitHub personal access token", regexp.MustCompile(`\bghp_[A-Za-z0-9]{36}\b`)},
+	{"generic high-entropy secret assignment", regexp.MustCompile(`(?i)(secret|password|api_?key|token)\s*[:=]\s*['"][A-Za-z0-9+/_=\-]{20,}['"]`)},
+}
+
+// skipExtensions are files this scanner never inspects, either because
+// they're expected to hold encrypted or public material.
+var skipExtensions = map[string]bool{
+	".age":  true,
+	".crt":  true,
+	".pub":  true,
+	".lock": true,
+}
+
+// ScanFile scans a single file's content for plaintext secret material.
+// It is skipped (and returns no findings) if the extension is in
+// skipExtensions or the content doesn't look like text.
+func ScanFile(path string) ([]Finding, error) {
+	for ext := range skipExtensions {
+		if strings.HasSuffix(path, ext) {
+			return nil, nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var findings []Finding
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		for _, p := range plaintextSecretPatterns {
+			if p.re.MatchString(line) {
+				findings = append(findings, Finding{Path: path, Line: lineNum, Reason: p.reason})
+			}
+		}
+	}
+
+	return findings, nil
+}
+
+// ScanPaths scans a list of file paths and returns all findings, in order.
+// Missing files (e.g. a staged deletion) are silently skipped.
+func ScanPaths(paths []string) ([]Finding, error) {
+	var findings []Finding
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		fileFindings, err := ScanFile(path)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, fileFindings...)
+	}
+	return findings, nil
+}
+
+// StagedFiles returns the paths staged for the next git commit (used for a
+// pre-commit hook). It shells out to `git diff --cached --name-only`.
+func StagedFiles() ([]string, error) {
+	cmd := exec.Command("git", "diff", "--cached", "--name-only", "--diff-filter=ACM")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing staged files: %w", err)
+	}
+
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
+// PreCommitHookScript is installed at .git/hooks/pre-commit to guard
+// against accidentally committing plaintext secrets.
+const PreCommitHookScript = `#!/bin/sh
+# Installed by 'nixfleet secrets install-hook'
+exec nixfleet secrets scan --staged
+`
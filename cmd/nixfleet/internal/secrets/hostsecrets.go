@@ -0,0 +1,88 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HostSecretsFile is the on-disk shape of secrets/secrets.yaml: which
+// secrets get deployed to which hosts. It's the "secrets.yaml in the
+// secrets dir" alternative to a nixfleet.secrets stanza in the evaluated
+// host config - the evaluator doesn't expose one of those yet, so this is
+// the only source 'secrets deploy' and 'secrets prune' resolve a host's
+// desired secrets from today.
+type HostSecretsFile struct {
+	Hosts map[string]HostSecretsEntry `yaml:"hosts"`
+}
+
+// HostSecretsEntry lists the secrets deployed to one host.
+type HostSecretsEntry struct {
+	Secrets []SecretSpec `yaml:"secrets"`
+}
+
+// SecretSpec names one secrets.yaml entry: an encrypted file, relative to
+// the manifest's --secrets-dir, and where/how it lands on the host.
+// Owner/Group/Mode fall back to DeploySecret's defaults (root:root, 0400)
+// when left blank.
+type SecretSpec struct {
+	Name         string   `yaml:"name"`
+	Dest         string   `yaml:"dest"`
+	Owner        string   `yaml:"owner,omitempty"`
+	Group        string   `yaml:"group,omitempty"`
+	Mode         string   `yaml:"mode,omitempty"`
+	RestartUnits []string `yaml:"restart_units,omitempty"`
+}
+
+// LoadHostSecretsFile reads and strictly decodes path, rejecting unknown
+// keys the same way server.LoadConfigFile does. A missing file isn't an
+// error - it's treated as a file with no hosts, so 'secrets deploy' works
+// before anyone's written one.
+func LoadHostSecretsFile(path string) (*HostSecretsFile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &HostSecretsFile{Hosts: map[string]HostSecretsEntry{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	var f HostSecretsFile
+	dec := yaml.NewDecoder(strings.NewReader(string(data)))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if f.Hosts == nil {
+		f.Hosts = map[string]HostSecretsEntry{}
+	}
+	return &f, nil
+}
+
+// SecretConfigsFor builds the []SecretConfig assigned to host, resolving
+// each entry's Name against secretsDir to get SourcePath. Returns nil for
+// a host with no entry, same as a map miss.
+func (f *HostSecretsFile) SecretConfigsFor(host, secretsDir string) []SecretConfig {
+	hs, ok := f.Hosts[host]
+	if !ok {
+		return nil
+	}
+
+	configs := make([]SecretConfig, 0, len(hs.Secrets))
+	for _, s := range hs.Secrets {
+		configs = append(configs, SecretConfig{
+			Name:         s.Name,
+			SourcePath:   filepath.Join(secretsDir, s.Name),
+			DestPath:     s.Dest,
+			Owner:        s.Owner,
+			Group:        s.Group,
+			Mode:         s.Mode,
+			RestartUnits: s.RestartUnits,
+		})
+	}
+	return configs
+}
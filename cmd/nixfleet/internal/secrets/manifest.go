@@ -0,0 +1,435 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManifestVersion is bumped if Manifest's on-disk shape changes in a way
+// that isn't backward compatible.
+const ManifestVersion = 1
+
+// ManifestSignNamespace scopes ssh-keygen -Y sign/verify signatures over a
+// Manifest to this use, the same way ApprovalSignNamespace scopes approval
+// grants - so a manifest signature can't be replayed to satisfy an
+// unrelated ssh-keygen signing check.
+const ManifestSignNamespace = "nixfleet-secrets-manifest"
+
+// ManifestEntry records what SealManifest observed for one .age file.
+type ManifestEntry struct {
+	Size            int64    `json:"size"`
+	SHA256          string   `json:"sha256"`
+	Recipients      []string `json:"recipients"`
+	SecretsNixEntry string   `json:"secrets_nix_entry,omitempty"`
+}
+
+// Manifest is the signed integrity record 'nixfleet secrets seal' writes to
+// secrets/.manifest.json and 'nixfleet secrets check' verifies against.
+type Manifest struct {
+	Version  int                      `json:"version"`
+	SealedAt time.Time                `json:"sealed_at"`
+	Files    map[string]ManifestEntry `json:"files"` // keyed by path relative to the secrets directory
+
+	Signer    string `json:"signer"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// signingBytes returns the canonical bytes a manifest signature covers:
+// everything except the signature itself, so a signature can't be stripped
+// off and reattached to a modified manifest. json.Marshal sorts map keys,
+// so this is stable across runs for the same content.
+func (m *Manifest) signingBytes() ([]byte, error) {
+	unsigned := *m
+	unsigned.Signature = ""
+	return json.Marshal(unsigned)
+}
+
+// LoadManifest reads and parses the manifest at path.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// Save writes m to path as indented JSON.
+func (m *Manifest) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// BuildManifest walks secretsDir for .age files and computes a fresh
+// ManifestEntry for each. Recipients are parsed from each file's own header
+// rather than looked up in config, since the whole point of the manifest is
+// to catch a file whose actual recipients have drifted from what
+// secrets.nix says a file should have.
+func BuildManifest(secretsDir string, config *SecretsNixConfig) (*Manifest, error) {
+	files := map[string]ManifestEntry{}
+
+	err := filepath.WalkDir(secretsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".age") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(secretsDir, path)
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+
+		recipients, err := parseRecipientStanzas(data)
+		if err != nil {
+			return fmt.Errorf("parsing recipients from %s: %w", path, err)
+		}
+
+		sum := sha256.Sum256(data)
+		files[rel] = ManifestEntry{
+			Size:            int64(len(data)),
+			SHA256:          hex.EncodeToString(sum[:]),
+			Recipients:      recipients,
+			SecretsNixEntry: secretsNixEntryFor(rel, config),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manifest{Version: ManifestVersion, Files: files}, nil
+}
+
+// secretsNixEntryFor returns the secrets.nix key config uses for the .age
+// file at rel (entries are keyed by the file's base name), or "" if config
+// has no matching entry - an orphaned file, as CheckManifest reports it.
+func secretsNixEntryFor(rel string, config *SecretsNixConfig) string {
+	if config == nil {
+		return ""
+	}
+	name := filepath.Base(rel)
+	if _, ok := config.Secrets[name]; ok {
+		return name
+	}
+	return ""
+}
+
+// SignManifest sets m.Signer to signerPrincipal and signs m's contents
+// with the SSH private key at identityPath, via `ssh-keygen -Y sign` - the
+// same mechanism approval.SignGrant uses for approval grants.
+func SignManifest(ctx context.Context, m *Manifest, identityPath, signerPrincipal string) error {
+	m.Signer = signerPrincipal
+	payload, err := m.signingBytes()
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+
+	tmpPath, err := writeTempFile("nixfleet-manifest-*", payload)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	sigPath := tmpPath + ".sig"
+	defer os.Remove(sigPath)
+
+	cmd := exec.CommandContext(ctx, "ssh-keygen", "-Y", "sign", "-n", ManifestSignNamespace, "-f", identityPath, tmpPath)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("signing manifest: %s", stderr.String())
+	}
+
+	sig, err := os.ReadFile(sigPath)
+	if err != nil {
+		return fmt.Errorf("reading signature: %w", err)
+	}
+	m.Signature = string(sig)
+	return nil
+}
+
+// VerifyManifestSignature checks that m.Signature is a valid ssh-keygen -Y
+// signature over m's contents from m.Signer, using an SSH allowed_signers
+// file. A malformed or missing signature just reports false, not an error.
+func VerifyManifestSignature(ctx context.Context, m *Manifest, allowedSignersPath string) (bool, error) {
+	if m.Signature == "" {
+		return false, nil
+	}
+	payload, err := m.signingBytes()
+	if err != nil {
+		return false, fmt.Errorf("encoding manifest: %w", err)
+	}
+
+	sigPath, err := writeTempFile("nixfleet-manifest-sig-*.sig", []byte(m.Signature))
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(sigPath)
+
+	cmd := exec.CommandContext(ctx, "ssh-keygen", "-Y", "verify",
+		"-n", ManifestSignNamespace,
+		"-f", allowedSignersPath,
+		"-I", m.Signer,
+		"-s", sigPath,
+	)
+	cmd.Stdin = bytes.NewReader(payload)
+	if err := cmd.Run(); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+// SealManifest builds a fresh manifest for secretsDir, signs it as
+// signerPrincipal using the SSH key at identityPath, and writes it to
+// manifestPath.
+func SealManifest(ctx context.Context, secretsDir, manifestPath string, config *SecretsNixConfig, identityPath, signerPrincipal string) (*Manifest, error) {
+	m, err := BuildManifest(secretsDir, config)
+	if err != nil {
+		return nil, err
+	}
+	m.SealedAt = time.Now()
+
+	if err := SignManifest(ctx, m, identityPath, signerPrincipal); err != nil {
+		return nil, err
+	}
+
+	if err := m.Save(manifestPath); err != nil {
+		return nil, fmt.Errorf("writing %s: %w", manifestPath, err)
+	}
+	return m, nil
+}
+
+// ModifiedFile is one .age file whose content has changed since the
+// manifest was sealed.
+type ModifiedFile struct {
+	Path string
+
+	// RecipientsMatch reports whether the file's current recipients still
+	// match secrets.nix's entry for it - the signature of a routine rekey.
+	RecipientsMatch bool
+
+	// RecipientsShrank reports whether the file now has fewer recipients
+	// than the manifest recorded - the specific "access was quietly
+	// narrowed" shape CheckManifest is meant to catch, distinct from a
+	// rekey that simply changed the recipient set to something else.
+	RecipientsShrank bool
+}
+
+// CheckResult is CheckManifest's report of every way the secrets directory
+// can have drifted from its sealed manifest.
+type CheckResult struct {
+	SignatureValid bool
+	Modified       []ModifiedFile
+	Missing        []string // in the manifest but no longer on disk
+	UnsignedNew    []string // on disk, .age, but absent from the manifest
+	Orphaned       []string // in the manifest and on disk, but no secrets.nix entry
+}
+
+// Suspicious reports whether result contains a change a routine
+// add/edit/rekey wouldn't produce: an invalid manifest signature, or a
+// modified file whose recipients no longer match secrets.nix.
+func (r *CheckResult) Suspicious() bool {
+	if !r.SignatureValid {
+		return true
+	}
+	for _, mf := range r.Modified {
+		if !mf.RecipientsMatch {
+			return true
+		}
+	}
+	return false
+}
+
+// Clean reports whether result found nothing at all to act on.
+func (r *CheckResult) Clean() bool {
+	return r.SignatureValid && len(r.Modified) == 0 && len(r.Missing) == 0 &&
+		len(r.UnsignedNew) == 0 && len(r.Orphaned) == 0
+}
+
+// CheckManifest verifies every .age file under secretsDir against the
+// manifest at manifestPath and the manifest's own signature, without
+// altering anything on disk.
+func CheckManifest(ctx context.Context, secretsDir, manifestPath, allowedSignersPath string, config *SecretsNixConfig) (*CheckResult, *Manifest, error) {
+	m, err := LoadManifest(manifestPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading manifest: %w", err)
+	}
+
+	result := &CheckResult{}
+	result.SignatureValid, err = VerifyManifestSignature(ctx, m, allowedSignersPath)
+	if err != nil {
+		return nil, m, fmt.Errorf("verifying manifest signature: %w", err)
+	}
+
+	seen := map[string]bool{}
+	err = filepath.WalkDir(secretsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".age") {
+			return nil
+		}
+		rel, err := filepath.Rel(secretsDir, path)
+		if err != nil {
+			return err
+		}
+		seen[rel] = true
+
+		entry, known := m.Files[rel]
+		if !known {
+			result.UnsignedNew = append(result.UnsignedNew, rel)
+			return nil
+		}
+		if config != nil {
+			if _, ok := config.Secrets[filepath.Base(rel)]; !ok {
+				result.Orphaned = append(result.Orphaned, rel)
+			}
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) == entry.SHA256 {
+			return nil
+		}
+
+		recipients, err := parseRecipientStanzas(data)
+		if err != nil {
+			return fmt.Errorf("parsing recipients from %s: %w", path, err)
+		}
+		expected := expectedRecipients(entry.SecretsNixEntry, config)
+		result.Modified = append(result.Modified, ModifiedFile{
+			Path:             rel,
+			RecipientsMatch:  recipientSetsEqual(recipients, expected),
+			RecipientsShrank: len(entry.Recipients) > 0 && len(recipients) < len(entry.Recipients),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, m, err
+	}
+
+	names := make([]string, 0, len(m.Files))
+	for rel := range m.Files {
+		names = append(names, rel)
+	}
+	sort.Strings(names)
+	for _, rel := range names {
+		if !seen[rel] {
+			result.Missing = append(result.Missing, rel)
+		}
+	}
+	sort.Strings(result.UnsignedNew)
+
+	return result, m, nil
+}
+
+// expectedRecipients returns config's current recipient list for
+// secretsNixEntry - the set RekeyAll would re-encrypt with - or nil if
+// config or the entry can't be found.
+func expectedRecipients(secretsNixEntry string, config *SecretsNixConfig) []string {
+	if config == nil || secretsNixEntry == "" {
+		return nil
+	}
+	entry, ok := config.Secrets[secretsNixEntry]
+	if !ok {
+		return nil
+	}
+	return entry.PublicKeys
+}
+
+// recipientSetsEqual reports whether a and b contain the same keys,
+// ignoring order.
+func recipientSetsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sa := append([]string(nil), a...)
+	sb := append([]string(nil), b...)
+	sort.Strings(sa)
+	sort.Strings(sb)
+	for i := range sa {
+		if sa[i] != sb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRecipientStanzas extracts the "-> <type> ..." recipient stanza
+// lines from an age file's header. age's header is always plaintext, even
+// though the payload it precedes is encrypted, so this doesn't require
+// decrypting anything - only, for an --armor file (the only kind this repo
+// writes), unwrapping the PEM-style base64 armor first.
+func parseRecipientStanzas(data []byte) ([]string, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN AGE ENCRYPTED FILE-----")) {
+		unarmored, err := unarmor(data)
+		if err != nil {
+			return nil, fmt.Errorf("unarmoring: %w", err)
+		}
+		data = unarmored
+	}
+
+	var stanzas []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "---") {
+			break
+		}
+		if strings.HasPrefix(line, "-> ") {
+			stanzas = append(stanzas, strings.TrimPrefix(line, "-> "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return stanzas, nil
+}
+
+// unarmor decodes age's ASCII armor: a PEM-style wrapper around a base64
+// body, no headers.
+func unarmor(data []byte) ([]byte, error) {
+	var b64 strings.Builder
+	inBody := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "-----BEGIN AGE ENCRYPTED FILE-----"):
+			inBody = true
+		case strings.HasPrefix(line, "-----END AGE ENCRYPTED FILE-----"):
+			inBody = false
+		case inBody:
+			b64.WriteString(line)
+		}
+	}
+	return base64.StdEncoding.DecodeString(b64.String())
+}
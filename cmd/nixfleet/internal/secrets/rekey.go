@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 )
 
@@ -24,6 +25,12 @@ type SecretsNixConfig struct {
 // SecretNixEntry represents a secret entry in secrets.nix
 type SecretNixEntry struct {
 	PublicKeys []string `json:"publicKeys"`
+
+	// RequiresApproval marks a high-value secret (root CA passphrase, cloud
+	// master credentials) as subject to the two-person rule: decrypt/edit/
+	// deploy must present a valid ApprovalRequest signed by a second admin
+	// before they're allowed to proceed. See internal/secrets/approval.go.
+	RequiresApproval bool `json:"requiresApproval,omitempty"`
 }
 
 // ParseSecretsNix parses a secrets.nix file and returns the configuration
@@ -84,8 +91,19 @@ func RekeySecret(ctx context.Context, secretPath string, recipients []string, id
 	return nil
 }
 
-// RekeyAll re-encrypts all secrets based on secrets.nix configuration
-func RekeyAll(ctx context.Context, secretsDir string, config *SecretsNixConfig, identityPath string, dryRun bool) ([]string, error) {
+// RekeyAll re-encrypts all secrets based on secrets.nix configuration.
+// onlyChanged restricts this to the secrets SyncCheck finds out of sync
+// (by recipient count) instead of rewriting every file unconditionally,
+// for a quieter git diff when most secrets didn't actually need it.
+func RekeyAll(ctx context.Context, secretsDir string, config *SecretsNixConfig, identityPath string, dryRun bool, onlyChanged bool) ([]string, error) {
+	if onlyChanged {
+		result, err := SyncCheck(secretsDir, config)
+		if err != nil {
+			return nil, fmt.Errorf("checking sync status: %w", err)
+		}
+		return RekeyOutOfSync(ctx, secretsDir, config, identityPath, result, dryRun)
+	}
+
 	var rekeyed []string
 
 	for secretName, entry := range config.Secrets {
@@ -293,3 +311,47 @@ func (c *SecretsNixConfig) LookupRecipientsForSecret(secretName string) ([]strin
 func (c *SecretsNixConfig) GetDefaultRecipients() []string {
 	return c.AllAdmins
 }
+
+// SecretsWithRecipient returns the subset of c.Secrets whose recipient list
+// includes pubKey. Used to scope a host key rotation to only the secrets it
+// actually affects, instead of rekeying everything.
+func (c *SecretsNixConfig) SecretsWithRecipient(pubKey string) map[string]SecretNixEntry {
+	matched := make(map[string]SecretNixEntry)
+	for name, entry := range c.Secrets {
+		for _, k := range entry.PublicKeys {
+			if k == pubKey {
+				matched[name] = entry
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// RotateHostKey replaces a host's age public key in secrets.nix in place. It
+// matches the host's let-bound key line (e.g. `  web1 = "age1...";`) and
+// swaps in newKey, leaving the rest of the file untouched. The original file
+// is preserved alongside it with a ".bak" suffix in case the rotation needs
+// to be undone by hand.
+func RotateHostKey(secretsNixPath, hostName, oldKey, newKey string) error {
+	data, err := os.ReadFile(secretsNixPath)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", secretsNixPath, err)
+	}
+
+	pattern := regexp.MustCompile(`(?m)^(\s*` + regexp.QuoteMeta(hostName) + `\s*=\s*")` +
+		regexp.QuoteMeta(oldKey) + `(";.*)$`)
+	if !pattern.Match(data) {
+		return fmt.Errorf("no %q key binding found in %s", hostName, secretsNixPath)
+	}
+
+	updated := pattern.ReplaceAll(data, []byte("${1}"+newKey+"${2}"))
+
+	if err := os.WriteFile(secretsNixPath+".bak", data, 0644); err != nil {
+		return fmt.Errorf("backing up %s: %w", secretsNixPath, err)
+	}
+	if err := os.WriteFile(secretsNixPath, updated, 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", secretsNixPath, err)
+	}
+	return nil
+}
@@ -4,13 +4,17 @@ package secrets
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/nixfleet/nixfleet/internal/ssh"
+	"github.com/nixfleet/nixfleet/internal/state"
 )
 
 // EncryptionType represents the encryption backend
@@ -155,12 +159,13 @@ func (m *Manager) encryptSops(ctx context.Context, data []byte, outputPath strin
 	return nil
 }
 
-// DeploySecret decrypts and deploys a secret to a host
-func (m *Manager) DeploySecret(ctx context.Context, client *ssh.Client, secret SecretConfig) error {
+// DeploySecret decrypts and deploys a secret to a host, returning the
+// SHA-256 hash of its plaintext for ownership-manifest tracking.
+func (m *Manager) DeploySecret(ctx context.Context, client *ssh.Client, secret SecretConfig) (hash string, err error) {
 	// Decrypt locally
 	plaintext, err := m.DecryptSecret(ctx, secret.SourcePath)
 	if err != nil {
-		return fmt.Errorf("decrypting secret %s: %w", secret.Name, err)
+		return "", fmt.Errorf("decrypting secret %s: %w", secret.Name, err)
 	}
 
 	// Set defaults
@@ -179,10 +184,10 @@ func (m *Manager) DeploySecret(ctx context.Context, client *ssh.Client, secret S
 	mkdirCmd := fmt.Sprintf("mkdir -p %s && chmod 0750 %s", secretsDir, secretsDir)
 	result, err := client.ExecSudo(ctx, mkdirCmd)
 	if err != nil {
-		return fmt.Errorf("creating secrets directory: %w", err)
+		return "", fmt.Errorf("creating secrets directory: %w", err)
 	}
 	if result.ExitCode != 0 {
-		return fmt.Errorf("creating secrets directory: %s", result.Stderr)
+		return "", fmt.Errorf("creating secrets directory: %s", result.Stderr)
 	}
 
 	// Write secret to host via SSH
@@ -191,10 +196,10 @@ func (m *Manager) DeploySecret(ctx context.Context, client *ssh.Client, secret S
 	writeCmd := fmt.Sprintf("echo '%s' | base64 -d > %s", encoded, secret.DestPath)
 	result, err = client.ExecSudo(ctx, writeCmd)
 	if err != nil {
-		return fmt.Errorf("writing secret: %w", err)
+		return "", fmt.Errorf("writing secret: %w", err)
 	}
 	if result.ExitCode != 0 {
-		return fmt.Errorf("writing secret: %s", result.Stderr)
+		return "", fmt.Errorf("writing secret: %s", result.Stderr)
 	}
 
 	// Set ownership and permissions
@@ -202,24 +207,51 @@ func (m *Manager) DeploySecret(ctx context.Context, client *ssh.Client, secret S
 		secret.Owner, secret.Group, secret.DestPath, secret.Mode, secret.DestPath)
 	result, err = client.ExecSudo(ctx, chownCmd)
 	if err != nil {
-		return fmt.Errorf("setting secret permissions: %w", err)
+		return "", fmt.Errorf("setting secret permissions: %w", err)
 	}
 	if result.ExitCode != 0 {
-		return fmt.Errorf("setting secret permissions: %s", result.Stderr)
+		return "", fmt.Errorf("setting secret permissions: %s", result.Stderr)
 	}
 
-	return nil
+	return sha256Hex(plaintext), nil
 }
 
-// DeploySecrets deploys multiple secrets and handles unit restarts
-func (m *Manager) DeploySecrets(ctx context.Context, client *ssh.Client, secrets []SecretConfig) ([]string, error) {
-	var unitsToRestart []string
+// DeploySecrets deploys multiple secrets, collects units to restart, and
+// prunes secrets nixfleet had previously deployed to this host that are no
+// longer in the desired set. A secret whose remote content already matches
+// (per CheckSecretChanged) is left untouched and doesn't contribute its
+// RestartUnits, so an unrelated secret rotation doesn't bounce every
+// service on the host. prevManifest is the host's current DeployedSecrets
+// (from HostState); the returned manifest replaces it once the deploy
+// succeeds. secretsDir bounds where pruning is allowed to touch: a
+// manifest entry outside it is left alone even though it looks orphaned,
+// since the manifest driving pruning could in principle be corrupted.
+func (m *Manager) DeploySecrets(ctx context.Context, client *ssh.Client, secrets []SecretConfig, prevManifest map[string]state.DeployedSecret, secretsDir string) (unitsToRestart []string, manifest map[string]state.DeployedSecret, changed []string, removed []string, err error) {
+	manifest = make(map[string]state.DeployedSecret, len(secrets))
 	seenUnits := make(map[string]bool)
 
 	for _, secret := range secrets {
-		if err := m.DeploySecret(ctx, client, secret); err != nil {
-			return nil, fmt.Errorf("deploying secret %s: %w", secret.Name, err)
+		isChanged, err := m.CheckSecretChanged(ctx, client, secret)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("checking secret %s: %w", secret.Name, err)
+		}
+
+		if !isChanged {
+			if prev, ok := prevManifest[secret.DestPath]; ok {
+				manifest[secret.DestPath] = prev
+				continue
+			}
+			// No manifest record yet, but the content already matches -
+			// deploy anyway so ownership/permissions are set and this
+			// secret gets recorded.
+		}
+
+		hash, err := m.DeploySecret(ctx, client, secret)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("deploying secret %s: %w", secret.Name, err)
 		}
+		manifest[secret.DestPath] = state.DeployedSecret{Name: secret.Name, Hash: hash, DeployedAt: time.Now()}
+		changed = append(changed, secret.DestPath)
 
 		// Collect units to restart
 		for _, unit := range secret.RestartUnits {
@@ -230,7 +262,108 @@ func (m *Manager) DeploySecrets(ctx context.Context, client *ssh.Client, secrets
 		}
 	}
 
-	return unitsToRestart, nil
+	for path := range prevManifest {
+		if _, stillWanted := manifest[path]; stillWanted {
+			continue
+		}
+		if !underDir(path, secretsDir) {
+			continue
+		}
+		if err := m.shredFile(ctx, client, path); err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("removing orphaned secret %s: %w", path, err)
+		}
+		removed = append(removed, path)
+	}
+
+	return unitsToRestart, manifest, changed, removed, nil
+}
+
+// PruneResult describes what a prune pass found: secrets nixfleet
+// previously deployed that are no longer in the desired set (removed, or in
+// a dry run, would be removed), and files sitting under the secrets
+// destination that nixfleet has no manifest record of ever deploying.
+type PruneResult struct {
+	Removed []string
+	Unknown []string
+}
+
+// PruneOrphaned previews, or (unless dryRun) performs, removal of secrets
+// previously deployed to a host that aren't in desired, plus reports files
+// found under secretsDir that aren't in prevManifest at all ("unknown" —
+// e.g. hand-copied credentials, or leftovers from before a host carried a
+// manifest). Like DeploySecrets, it refuses to touch any path outside
+// secretsDir even if prevManifest claims otherwise.
+func (m *Manager) PruneOrphaned(ctx context.Context, client *ssh.Client, desired []SecretConfig, prevManifest map[string]state.DeployedSecret, secretsDir string, dryRun bool) (*PruneResult, error) {
+	desiredPaths := make(map[string]bool, len(desired))
+	for _, secret := range desired {
+		desiredPaths[secret.DestPath] = true
+	}
+
+	result := &PruneResult{}
+	for path := range prevManifest {
+		if desiredPaths[path] {
+			continue
+		}
+		if !underDir(path, secretsDir) {
+			continue
+		}
+		if !dryRun {
+			if err := m.shredFile(ctx, client, path); err != nil {
+				return nil, fmt.Errorf("removing orphaned secret %s: %w", path, err)
+			}
+		}
+		result.Removed = append(result.Removed, path)
+	}
+
+	findCmd := fmt.Sprintf("find %s -type f 2>/dev/null", secretsDir)
+	findResult, err := client.Exec(ctx, findCmd)
+	if err == nil && findResult.ExitCode == 0 {
+		for _, line := range strings.Split(findResult.Stdout, "\n") {
+			path := strings.TrimSpace(line)
+			if path == "" {
+				continue
+			}
+			if _, known := prevManifest[path]; known {
+				continue
+			}
+			if desiredPaths[path] {
+				continue
+			}
+			result.Unknown = append(result.Unknown, path)
+		}
+	}
+
+	return result, nil
+}
+
+// shredFile overwrites a file with random data before unlinking it, since an
+// orphaned secret is a credential and a plain rm leaves recoverable
+// plaintext on disk.
+func (m *Manager) shredFile(ctx context.Context, client *ssh.Client, path string) error {
+	cmd := fmt.Sprintf("shred -u %s 2>/dev/null || (dd if=/dev/urandom of=%s bs=1024 count=1 conv=notrunc >/dev/null 2>&1; rm -f %s)", path, path, path)
+	result, err := client.ExecSudo(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("shredding %s: %w", path, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("shredding %s: %s", path, result.Stderr)
+	}
+	return nil
+}
+
+// underDir reports whether path is cleanly contained within dir. It's the
+// safety check pruning relies on before touching anything on a host, so a
+// corrupted manifest can never point removal outside the configured secret
+// destinations.
+func underDir(path, dir string) bool {
+	if dir == "" || path == "" {
+		return false
+	}
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
 
 // RestartUnits restarts the specified systemd units
@@ -296,6 +429,12 @@ func (m *Manager) CheckSecretChanged(ctx context.Context, client *ssh.Client, se
 	return localHash != remoteHash, nil
 }
 
+// sha256Hex returns the hex-encoded SHA-256 hash of data
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
 // base64Encode encodes data to base64 string
 func base64Encode(data []byte) string {
 	cmd := exec.Command("base64")
@@ -0,0 +1,116 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// SyncCheckEntry is one secret's comparison between what secrets.nix
+// declares and what's actually in its .age file, by recipient count -
+// identity can't be compared directly, see BuildAccessMatrix's doc
+// comment on why age recipient stanzas don't reveal who they're for.
+type SyncCheckEntry struct {
+	Secret        string `json:"secret"`
+	DeclaredCount int    `json:"declared_count"`
+	ActualCount   int    `json:"actual_count"`
+	InSync        bool   `json:"in_sync"`
+}
+
+// SyncCheckResult is SyncCheck's report across every secret declared in
+// secrets.nix, plus any .age file on disk with no declaration at all.
+type SyncCheckResult struct {
+	Entries []SyncCheckEntry `json:"entries"`
+}
+
+// OutOfSync returns the subset of result.Entries whose on-disk recipient
+// count doesn't match secrets.nix - exactly the set RekeyOutOfSync
+// re-encrypts.
+func (r *SyncCheckResult) OutOfSync() []SyncCheckEntry {
+	var out []SyncCheckEntry
+	for _, e := range r.Entries {
+		if !e.InSync {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// SyncCheck compares, for every secret in config, the recipient count
+// secrets.nix declares against the recipient stanzas actually present in
+// its .age file under secretsDir. It only parses each file's plaintext
+// header (see parseRecipientStanzas) - no decryption, no identity - so
+// it's cheap enough to run as a pre-push hook or in CI on every commit
+// that touches secrets.nix.
+func SyncCheck(secretsDir string, config *SecretsNixConfig) (*SyncCheckResult, error) {
+	if config == nil {
+		return nil, fmt.Errorf("secrets.nix config is required")
+	}
+
+	secretNames := make([]string, 0, len(config.Secrets))
+	for name := range config.Secrets {
+		secretNames = append(secretNames, name)
+	}
+	sort.Strings(secretNames)
+
+	result := &SyncCheckResult{}
+	for _, name := range secretNames {
+		entry := config.Secrets[name]
+		actualCount, err := countRecipientStanzas(filepath.Join(secretsDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+		result.Entries = append(result.Entries, SyncCheckEntry{
+			Secret:        name,
+			DeclaredCount: len(entry.PublicKeys),
+			ActualCount:   actualCount,
+			InSync:        actualCount == len(entry.PublicKeys),
+		})
+	}
+
+	orphans, err := orphanedSecretFiles(secretsDir, config)
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range orphans {
+		actualCount, err := countRecipientStanzas(filepath.Join(secretsDir, rel))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", rel, err)
+		}
+		result.Entries = append(result.Entries, SyncCheckEntry{Secret: rel, DeclaredCount: 0, ActualCount: actualCount, InSync: false})
+	}
+
+	return result, nil
+}
+
+// RekeyOutOfSync re-encrypts only the secrets SyncCheck found out of sync,
+// rather than every secret RekeyAll would touch - the same recipient-count
+// diff underlies both, so a `rekey --only-changed` and a `sync-check --fix`
+// agree on exactly what needs re-encrypting. A secret missing from disk is
+// skipped, same as RekeyAll.
+func RekeyOutOfSync(ctx context.Context, secretsDir string, config *SecretsNixConfig, identityPath string, result *SyncCheckResult, dryRun bool) ([]string, error) {
+	var rekeyed []string
+
+	for _, e := range result.OutOfSync() {
+		entry, declared := config.Secrets[e.Secret]
+		if !declared {
+			// An orphaned .age file has no secrets.nix entry to rekey
+			// against - nothing RekeyOutOfSync can do for it.
+			continue
+		}
+
+		secretPath := filepath.Join(secretsDir, e.Secret)
+		if dryRun {
+			rekeyed = append(rekeyed, e.Secret)
+			continue
+		}
+
+		if err := RekeySecret(ctx, secretPath, entry.PublicKeys, identityPath); err != nil {
+			return rekeyed, fmt.Errorf("rekeying %s: %w", e.Secret, err)
+		}
+		rekeyed = append(rekeyed, e.Secret)
+	}
+
+	return rekeyed, nil
+}
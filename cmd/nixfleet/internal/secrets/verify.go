@@ -0,0 +1,135 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// VerifyResult is 'secrets verify's report of every way secretsDir and
+// secrets.nix can have drifted apart: files with no declaration, entries
+// with no file, and files whose recipient count no longer matches their
+// declaration.
+type VerifyResult struct {
+	// OrphanedFiles are .age files under secretsDir with no secrets.nix
+	// entry, so 'secrets rekey' never touches them.
+	OrphanedFiles []string `json:"orphaned_files,omitempty"`
+
+	// MissingFiles are secrets.nix entries whose .age file doesn't exist
+	// on disk.
+	MissingFiles []string `json:"missing_files,omitempty"`
+
+	// StaleRekeys are files whose on-disk recipient stanza count no
+	// longer matches the entry's declared publicKeys - the same
+	// count-based comparison SyncCheck uses, since age recipient stanzas
+	// don't reveal which key they were encrypted for (see
+	// BuildAccessMatrix's doc comment).
+	StaleRekeys []SyncCheckEntry `json:"stale_rekeys,omitempty"`
+}
+
+// Clean reports whether result found nothing to act on.
+func (r *VerifyResult) Clean() bool {
+	return len(r.OrphanedFiles) == 0 && len(r.MissingFiles) == 0 && len(r.StaleRekeys) == 0
+}
+
+// Verify cross-checks config against the .age files under secretsDir,
+// reporting orphaned files, missing files, and stale rekeys separately -
+// unlike SyncCheck, which folds a missing file into the same "out of
+// sync" bucket as a genuine recipient mismatch.
+func Verify(secretsDir string, config *SecretsNixConfig) (*VerifyResult, error) {
+	if config == nil {
+		return nil, fmt.Errorf("secrets.nix config is required")
+	}
+
+	result := &VerifyResult{}
+
+	orphans, err := orphanedSecretFiles(secretsDir, config)
+	if err != nil {
+		return nil, err
+	}
+	result.OrphanedFiles = orphans
+
+	names := make([]string, 0, len(config.Secrets))
+	for name := range config.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		entry := config.Secrets[name]
+		path := filepath.Join(secretsDir, name)
+
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			result.MissingFiles = append(result.MissingFiles, name)
+			continue
+		}
+
+		actualCount, err := countRecipientStanzas(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+		declaredCount := len(entry.PublicKeys)
+		if actualCount != declaredCount {
+			result.StaleRekeys = append(result.StaleRekeys, SyncCheckEntry{
+				Secret:        name,
+				DeclaredCount: declaredCount,
+				ActualCount:   actualCount,
+				InSync:        false,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// secretsNixEntryLine matches secrets.nix's single-line entry shape, as
+// used throughout the repo's own secrets.nix (e.g. `"smb-ztaylor.age".publicKeys
+// = [ admin ] ++ linuxHosts;`), capturing the secret name.
+var secretsNixEntryLine = regexp.MustCompile(`^\s*"([^"]+)"\.publicKeys\s*=.*;\s*$`)
+
+// RemoveSecretsNixEntries deletes the single-line declaration for each
+// name in names from the secrets.nix file at path, preserving every other
+// line byte-for-byte. An entry that isn't declared on one line (split
+// across lines, or otherwise formatted) is left untouched and reported in
+// skipped instead, since a partial edit to a Nix file is worse than none.
+func RemoveSecretsNixEntries(path string, names []string) (removed []string, skipped []string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	want := make(map[string]bool, len(names))
+	for _, n := range names {
+		want[n] = true
+	}
+
+	found := make(map[string]bool, len(names))
+	lines := strings.Split(string(data), "\n")
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if m := secretsNixEntryLine.FindStringSubmatch(line); m != nil && want[m[1]] {
+			found[m[1]] = true
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	for _, n := range names {
+		if found[n] {
+			removed = append(removed, n)
+		} else {
+			skipped = append(skipped, n)
+		}
+	}
+	if len(removed) == 0 {
+		return removed, skipped, nil
+	}
+
+	if err := os.WriteFile(path, []byte(strings.Join(kept, "\n")), 0644); err != nil {
+		return nil, nil, fmt.Errorf("writing %s: %w", path, err)
+	}
+	return removed, skipped, nil
+}
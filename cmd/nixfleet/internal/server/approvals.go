@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/nixfleet/nixfleet/internal/secrets"
+)
+
+// ApprovalStore persists two-person-rule approval requests for
+// requiresApproval secrets to <dataDir>/approvals.json, the same way
+// OverrideStore persists host overrides. Requests are looked up and
+// countersigned by ID, so unlike OverrideStore's per-host keying this is
+// keyed by ApprovalRequest.ID.
+type ApprovalStore struct {
+	dataDir string
+
+	mu       sync.RWMutex
+	requests map[string]*secrets.ApprovalRequest
+}
+
+// NewApprovalStore creates a store rooted at dataDir and loads any
+// previously persisted requests. A missing or unreadable file just starts
+// empty, matching OverrideStore's tolerance for a fresh data dir.
+func NewApprovalStore(dataDir string) *ApprovalStore {
+	s := &ApprovalStore{dataDir: dataDir, requests: make(map[string]*secrets.ApprovalRequest)}
+	s.load()
+	return s
+}
+
+func (s *ApprovalStore) statePath() string {
+	return filepath.Join(s.dataDir, "approvals.json")
+}
+
+func (s *ApprovalStore) load() {
+	data, err := os.ReadFile(s.statePath())
+	if err != nil {
+		return
+	}
+
+	var requests map[string]*secrets.ApprovalRequest
+	if err := json.Unmarshal(data, &requests); err != nil {
+		return
+	}
+
+	s.requests = requests
+}
+
+func (s *ApprovalStore) save() error {
+	if err := os.MkdirAll(s.dataDir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s.requests, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.statePath(), data, 0644)
+}
+
+// Create records a newly-submitted approval request, refusing to overwrite
+// an existing one with the same ID (its ID is derived from its binding
+// fields, so a collision means the same secret/operation/requester/expiry
+// tuple was already submitted).
+func (s *ApprovalStore) Create(req *secrets.ApprovalRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.requests[req.ID]; exists {
+		return fmt.Errorf("approval request %s already exists", req.ID)
+	}
+	s.requests[req.ID] = req
+
+	return s.save()
+}
+
+// Get returns the approval request with the given ID, if any.
+func (s *ApprovalStore) Get(id string) (*secrets.ApprovalRequest, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	req, ok := s.requests[id]
+	return req, ok
+}
+
+// List returns every stored approval request, newest first.
+func (s *ApprovalStore) List() []*secrets.ApprovalRequest {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]*secrets.ApprovalRequest, 0, len(s.requests))
+	for _, req := range s.requests {
+		out = append(out, req)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+
+	return out
+}
+
+// AddGrant appends grant to the request identified by id and persists it.
+// It doesn't verify the signature itself - that's the caller's job, using
+// secrets.VerifyGrant against the fleet's allowed_signers file - so that a
+// store can be exercised in tests without shelling out to ssh-keygen.
+func (s *ApprovalStore) AddGrant(id string, grant secrets.Grant) (*secrets.ApprovalRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, ok := s.requests[id]
+	if !ok {
+		return nil, fmt.Errorf("approval request %s not found", id)
+	}
+
+	req.Grants = append(req.Grants, grant)
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// Snapshot returns the current requests in their persisted JSON encoding,
+// for 'server backup'. See OverrideStore.Snapshot.
+func (s *ApprovalStore) Snapshot() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return json.MarshalIndent(s.requests, "", "  ")
+}
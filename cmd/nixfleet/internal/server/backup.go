@@ -0,0 +1,288 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupManifestVersion is the schema version of the backup archive format
+// itself (the manifest layout and which files it lists) - bumped if that
+// layout changes. It's independent of backupFileVersions, which tracks each
+// individual persisted file's own format.
+const backupManifestVersion = 1
+
+// backupFileVersions pins the schema version of every file Backup can
+// include, so Restore can refuse a file in a format newer than this
+// nixfleet understands. Bump the relevant entry whenever that file's own
+// JSON shape changes in a way older code can't read.
+var backupFileVersions = map[string]int{
+	"overrides.json":    1,
+	"job-history.json":  1,
+	"prober-state.json": 1,
+	"approvals.json":    1,
+}
+
+// BackupManifest describes one server data-dir snapshot: when it was taken
+// and, for every file it contains, the schema version it was written at.
+// Fleet-wide maintenance locks aren't persisted state yet (see
+// internal/server's other stores), so there's nothing to snapshot for those -
+// Files only ever lists whichever of overrides.json, job-history.json,
+// prober-state.json, and approvals.json actually exist.
+type BackupManifest struct {
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	Files     map[string]int `json:"files"`
+}
+
+// Backup snapshots the server's persisted local state into a tar.gz archive
+// written to w. It reads each store's in-memory state directly, under that
+// store's own lock, rather than copying the on-disk file - the same reason
+// each store already serializes its own writes through save() - so a backup
+// taken while the server is handling requests can never observe a
+// half-written file.
+func (s *Server) Backup(w io.Writer) (BackupManifest, error) {
+	return backupStores(s.overrides, s.jobHistory, s.prober, s.approvals, w)
+}
+
+// BackupDataDir snapshots a data dir into an archive without a live
+// *Server, for the 'server backup' CLI command. Each store is loaded fresh
+// from disk, so running this against a data dir a live server is still
+// writing to can race that server's next save() the same way any two
+// processes sharing a file would; POST /api/admin/backup is the consistent
+// path for a server that's currently running.
+func BackupDataDir(dataDir string, w io.Writer) (BackupManifest, error) {
+	overrides := NewOverrideStore(dataDir)
+	jobHistory := NewJobHistory(dataDir)
+	prober := NewProber(nil, 0, dataDir)
+	approvals := NewApprovalStore(dataDir)
+	return backupStores(overrides, jobHistory, prober, approvals, w)
+}
+
+func backupStores(overrides *OverrideStore, jobHistory *JobHistory, prober *Prober, approvals *ApprovalStore, w io.Writer) (BackupManifest, error) {
+	manifest := BackupManifest{
+		Version:   backupManifestVersion,
+		CreatedAt: time.Now(),
+		Files:     make(map[string]int),
+	}
+
+	type file struct {
+		name string
+		data []byte
+	}
+	var files []file
+
+	overridesData, err := overrides.Snapshot()
+	if err != nil {
+		return manifest, fmt.Errorf("snapshotting overrides: %w", err)
+	}
+	files = append(files, file{"overrides.json", overridesData})
+
+	historyData, err := jobHistory.Snapshot()
+	if err != nil {
+		return manifest, fmt.Errorf("snapshotting job history: %w", err)
+	}
+	files = append(files, file{"job-history.json", historyData})
+
+	if prober != nil {
+		proberData, err := prober.Snapshot()
+		if err != nil {
+			return manifest, fmt.Errorf("snapshotting prober state: %w", err)
+		}
+		files = append(files, file{"prober-state.json", proberData})
+	}
+
+	approvalsData, err := approvals.Snapshot()
+	if err != nil {
+		return manifest, fmt.Errorf("snapshotting approvals: %w", err)
+	}
+	files = append(files, file{"approvals.json", approvalsData})
+
+	for _, f := range files {
+		manifest.Files[f.name] = backupFileVersions[f.name]
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	if err := writeTarFile(tw, "manifest.json", manifestData); err != nil {
+		return manifest, err
+	}
+	for _, f := range files {
+		if err := writeTarFile(tw, f.name, f.data); err != nil {
+			return manifest, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return manifest, err
+	}
+	return manifest, gz.Close()
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("writing %s header: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// RestoreDataDir extracts a backup archive produced by Backup/BackupDataDir
+// into dataDir, swapping it in atomically: the archive is extracted into a
+// fresh directory next to dataDir, any existing dataDir is moved aside as
+// "<dataDir>.pre-restore", and the fresh directory is renamed into its
+// place. It refuses to restore a manifest - or any individual file inside
+// it - at a schema version newer than this nixfleet understands, unless
+// force is set, since restoring it anyway could silently drop fields a
+// newer nixfleet would have kept.
+func RestoreDataDir(r io.Reader, dataDir string, force bool) (BackupManifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return BackupManifest{}, fmt.Errorf("opening backup: %w", err)
+	}
+	defer gz.Close()
+
+	dataDir = filepath.Clean(dataDir)
+	parent := filepath.Dir(dataDir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return BackupManifest{}, fmt.Errorf("creating %s: %w", parent, err)
+	}
+
+	staging, err := os.MkdirTemp(parent, ".nixfleet-restore-*")
+	if err != nil {
+		return BackupManifest{}, fmt.Errorf("creating restore staging dir: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	var manifest BackupManifest
+	sawManifest := false
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, fmt.Errorf("reading backup: %w", err)
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return manifest, fmt.Errorf("reading %s from backup: %w", hdr.Name, err)
+		}
+
+		if hdr.Name == "manifest.json" {
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				return manifest, fmt.Errorf("parsing manifest: %w", err)
+			}
+			sawManifest = true
+
+			if manifest.Version > backupManifestVersion && !force {
+				return manifest, fmt.Errorf("backup schema version %d is newer than this nixfleet understands (%d) - pass --force to restore anyway", manifest.Version, backupManifestVersion)
+			}
+			for name, v := range manifest.Files {
+				if known, ok := backupFileVersions[name]; (!ok || v > known) && !force {
+					return manifest, fmt.Errorf("backup contains %q at schema version %d, newer than this nixfleet understands - pass --force to restore anyway", name, v)
+				}
+			}
+			continue
+		}
+
+		if err := os.WriteFile(filepath.Join(staging, hdr.Name), data, 0644); err != nil {
+			return manifest, fmt.Errorf("writing %s: %w", hdr.Name, err)
+		}
+	}
+
+	if !sawManifest {
+		return manifest, fmt.Errorf("backup has no manifest.json - not a nixfleet server backup")
+	}
+
+	if _, err := os.Stat(dataDir); err == nil {
+		displaced := dataDir + ".pre-restore"
+		os.RemoveAll(displaced)
+		if err := os.Rename(dataDir, displaced); err != nil {
+			return manifest, fmt.Errorf("moving aside existing data dir: %w", err)
+		}
+	}
+	if err := os.Rename(staging, dataDir); err != nil {
+		return manifest, fmt.Errorf("swapping in restored data dir: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// ageEncryptFile shells out to `age` to encrypt inPath for recipients,
+// writing the result to outPath - the same approach internal/secrets uses
+// to re-encrypt secrets, minus --armor since a backup archive is already
+// binary and never checked into git.
+func ageEncryptFile(inPath, outPath string, recipients []string) error {
+	args := []string{"--encrypt"}
+	for _, r := range recipients {
+		args = append(args, "-r", r)
+	}
+	args = append(args, "-o", outPath, inPath)
+
+	cmd := exec.Command("age", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("age encrypt: %s", stderr.String())
+	}
+	return nil
+}
+
+// pruneBackups keeps only the retention most recent scheduled backups under
+// dir, removing older ones. Backup file names embed a sortable timestamp
+// (see Scheduler.runBackup), so lexical order is chronological order.
+func pruneBackups(dir string, retention int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		n := e.Name()
+		if strings.HasPrefix(n, "server-backup-") && (strings.HasSuffix(n, ".tar.gz") || strings.HasSuffix(n, ".tar.gz.age")) {
+			names = append(names, n)
+		}
+	}
+	if len(names) <= retention {
+		return
+	}
+
+	sort.Strings(names)
+	for _, n := range names[:len(names)-retention] {
+		if err := os.Remove(filepath.Join(dir, n)); err != nil {
+			log.Printf("Scheduler: backup - pruning %s: %v", n, err)
+		}
+	}
+}
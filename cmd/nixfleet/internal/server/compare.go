@@ -0,0 +1,39 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/nixfleet/nixfleet/internal/compare"
+)
+
+func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
+	name1 := r.URL.Query().Get("host1")
+	name2 := r.URL.Query().Get("host2")
+	if name1 == "" || name2 == "" {
+		s.jsonError(w, "both host1 and host2 query parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	host1, ok := s.inventory.GetHost(name1)
+	if !ok {
+		s.jsonError(w, fmt.Sprintf("host %q not found", name1), http.StatusNotFound)
+		return
+	}
+	host2, ok := s.inventory.GetHost(name2)
+	if !ok {
+		s.jsonError(w, fmt.Sprintf("host %q not found", name2), http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	result := compare.Result{
+		Host1:     host1.Name,
+		Host2:     host2.Name,
+		Inventory: compare.Inventory(s.inventory, host1, host2),
+		PKI:       compare.PKI(s.pkiStore, host1, host2),
+	}
+	result.Deploy, result.State = compare.DeployAndState(ctx, s.pool, s.stateMgr, s.evaluator, host1, host2)
+
+	s.jsonResponse(w, result, http.StatusOK)
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/compliance"
+)
+
+// handleCompliance serves GET /api/compliance?window=90d: per-host and
+// fleet-level patch compliance, computed from complianceStore's recorded
+// series plus each host's resolved SLA and maintenance-mode flag.
+func (s *Server) handleCompliance(w http.ResponseWriter, r *http.Request) {
+	window, err := compliance.ParseWindow(r.URL.Query().Get("window"))
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hosts := s.inventory.AllHosts()
+	names := make([]string, len(hosts))
+	for i, h := range hosts {
+		names[i] = h.Name
+	}
+
+	resolveSLA := func(name string) compliance.SLA {
+		host, ok := s.inventory.GetHost(name)
+		if !ok {
+			return compliance.DefaultSLA()
+		}
+		sla, ok := s.inventory.ComplianceSLAForHost(host)
+		if !ok {
+			return compliance.DefaultSLA()
+		}
+		return compliance.SLA{SecurityDays: sla.SecurityDays, RegularDays: sla.RegularDays}
+	}
+	maintenanceMode := func(name string) bool {
+		host, ok := s.inventory.GetHost(name)
+		return ok && host.MaintenanceMode
+	}
+
+	result := compliance.ComputeFleetMetrics(s.complianceStore, names, resolveSLA, maintenanceMode, time.Now(), window)
+	s.jsonResponse(w, result, http.StatusOK)
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileConfig is the on-disk shape of `nixfleet server --config server.yaml`,
+// mirroring Config's flag-equivalent fields (plus ApprovalAllowedSigners,
+// which today has no flag). Durations are plain strings ("5m", "1h") rather
+// than Config's time.Duration, since that's what a human editing YAML
+// expects to write; LoadConfigFile parses them and reports the source line
+// on a bad value instead of yaml's default (and unhelpful) int64-nanoseconds
+// unmarshal.
+type FileConfig struct {
+	ListenAddr string `yaml:"listen_addr"`
+	FlakePath  string `yaml:"flake_path"`
+
+	DriftCheckInterval  string `yaml:"drift_check_interval"`
+	UpdateCheckInterval string `yaml:"update_check_interval"`
+	HealthCheckInterval string `yaml:"health_check_interval"`
+	ProbeInterval       string `yaml:"probe_interval"`
+
+	DataDir            string `yaml:"data_dir"`
+	MaxJobs            int    `yaml:"max_jobs"`
+	JobRetention       string `yaml:"job_retention"`
+	PKIDir             string `yaml:"pki_dir"`
+	CredentialsDir     string `yaml:"credentials_dir"`
+	ProvenanceDir      string `yaml:"provenance_dir"`
+	RequireProvenance  bool   `yaml:"require_provenance"`
+	Offline            bool   `yaml:"offline"`
+	NoEvalCache        bool   `yaml:"no_eval_cache"`
+	SkipReadinessCheck bool   `yaml:"no_readiness_check"`
+
+	WebhookURL    string   `yaml:"webhook_url"`
+	WebhookSecret string   `yaml:"webhook_secret"`
+	WebhookEvents []string `yaml:"webhook_events"`
+	WebhookDetail string   `yaml:"webhook_detail"`
+
+	EmailSMTPHost    string   `yaml:"email_smtp_host"`
+	EmailSMTPPort    int      `yaml:"email_smtp_port"`
+	EmailSTARTTLS    bool     `yaml:"email_starttls"`
+	EmailImplicitTLS bool     `yaml:"email_implicit_tls"`
+	EmailUsername    string   `yaml:"email_username"`
+	EmailPassword    string   `yaml:"email_password"`
+	EmailFrom        string   `yaml:"email_from"`
+	EmailTo          []string `yaml:"email_to"`
+	EmailEvents      []string `yaml:"email_events"`
+
+	SlackWebhookURL string   `yaml:"slack_webhook_url"`
+	SlackEvents     []string `yaml:"slack_events"`
+
+	MatrixHomeserverURL string   `yaml:"matrix_homeserver_url"`
+	MatrixAccessToken   string   `yaml:"matrix_access_token"`
+	MatrixRoomID        string   `yaml:"matrix_room_id"`
+	MatrixEvents        []string `yaml:"matrix_events"`
+
+	SIEMURL       string   `yaml:"siem_url"`
+	SIEMEvents    []string `yaml:"siem_events"`
+	SIEMSpoolFile string   `yaml:"siem_spool_file"`
+
+	PublicURL string `yaml:"public_url"`
+
+	APIToken     string `yaml:"api_token"`
+	MetricsToken string `yaml:"metrics_token"`
+
+	BackupInterval   string   `yaml:"backup_interval"`
+	BackupDir        string   `yaml:"backup_dir"`
+	BackupRetention  int      `yaml:"backup_retention"`
+	BackupRecipients []string `yaml:"backup_recipients"`
+
+	ApprovalAllowedSigners  string `yaml:"approval_allowed_signers"`
+	K0sMetricsInterval      string `yaml:"k0s_metrics_interval"`
+	ComplianceCheckInterval string `yaml:"compliance_check_interval"`
+	DrainTimeout            string `yaml:"drain_timeout"`
+	HostTimeout             string `yaml:"host_timeout"`
+
+	LogLevel  string `yaml:"log_level"`
+	LogFormat string `yaml:"log_format"`
+}
+
+// envVarPattern matches ${ENV_VAR} references for LoadConfigFile's
+// substitution pass, so a config file can name a webhook secret or API
+// token without committing it to the repo.
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnvVars replaces every ${ENV_VAR} in data with os.Getenv(ENV_VAR),
+// leaving the reference untouched if the variable isn't set - the same
+// "unset means empty, not an error" behavior os.Expand would give, but
+// scoped to ${...} only so a literal "$5" in a value isn't touched.
+func expandEnvVars(data []byte) []byte {
+	return envVarPattern.ReplaceAllFunc(data, func(match []byte) []byte {
+		name := envVarPattern.FindSubmatch(match)[1]
+		if v, ok := os.LookupEnv(string(name)); ok {
+			return []byte(v)
+		}
+		return match
+	})
+}
+
+// LoadConfigFile reads and validates path: environment variable
+// substitution, then a strict YAML decode that rejects unknown keys (so a
+// typo'd field is a startup error, not a silently-ignored no-op), then
+// duration parsing and cross-field validation. Every error names the
+// offending YAML line.
+func LoadConfigFile(path string) (*FileConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	expanded := expandEnvVars(raw)
+
+	var fc FileConfig
+	dec := yaml.NewDecoder(strings.NewReader(string(expanded)))
+	dec.KnownFields(true)
+	if err := dec.Decode(&fc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := fc.validateDurations(expanded); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &fc, nil
+}
+
+// durationFields lists FileConfig's duration-string fields together with
+// their YAML key, so validateDurations can parse each one and, on failure,
+// look up its line number from the raw document.
+var durationFields = []struct {
+	key   string
+	value func(*FileConfig) string
+}{
+	{"drift_check_interval", func(fc *FileConfig) string { return fc.DriftCheckInterval }},
+	{"update_check_interval", func(fc *FileConfig) string { return fc.UpdateCheckInterval }},
+	{"health_check_interval", func(fc *FileConfig) string { return fc.HealthCheckInterval }},
+	{"probe_interval", func(fc *FileConfig) string { return fc.ProbeInterval }},
+	{"backup_interval", func(fc *FileConfig) string { return fc.BackupInterval }},
+	{"k0s_metrics_interval", func(fc *FileConfig) string { return fc.K0sMetricsInterval }},
+	{"compliance_check_interval", func(fc *FileConfig) string { return fc.ComplianceCheckInterval }},
+	{"drain_timeout", func(fc *FileConfig) string { return fc.DrainTimeout }},
+	{"host_timeout", func(fc *FileConfig) string { return fc.HostTimeout }},
+	{"job_retention", func(fc *FileConfig) string { return fc.JobRetention }},
+}
+
+// validateDurations parses every duration-string field, reporting the
+// document line of the first one that doesn't parse via yaml.Node - decoded
+// from the same (already env-expanded) bytes fc itself came from, so line
+// numbers match what an operator sees in their editor.
+func (fc *FileConfig) validateDurations(document []byte) error {
+	var root yaml.Node
+	_ = yaml.Unmarshal(document, &root) // best-effort; a bad line number beats none
+
+	for _, df := range durationFields {
+		v := df.value(fc)
+		if v == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(v); err != nil {
+			line := lineOf(&root, df.key)
+			if line > 0 {
+				return fmt.Errorf("line %d: %s: %w", line, df.key, err)
+			}
+			return fmt.Errorf("%s: %w", df.key, err)
+		}
+	}
+	return nil
+}
+
+// lineOf finds key's value node in root's top-level mapping and returns its
+// source line, or 0 if root isn't a mapping document or key isn't present.
+func lineOf(root *yaml.Node, key string) int {
+	if len(root.Content) == 0 {
+		return 0
+	}
+	mapping := root.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return 0
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1].Line
+		}
+	}
+	return 0
+}
+
+// parseDuration parses s, returning zero for an empty string - the FileConfig
+// equivalent of a flag's unset zero-value default.
+func parseDuration(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	d, _ := time.ParseDuration(s) // validated by validateDurations before this is ever called
+	return d
+}
+
+// ToConfig converts fc into a server.Config, leaving Inventory and the
+// scheduler/webhook/token fields Config's zero value where fc doesn't set
+// them - the caller (serverCmd's RunE) fills in Inventory and applies any
+// flags the user explicitly passed on top of this.
+func (fc *FileConfig) ToConfig() Config {
+	return Config{
+		ListenAddr:              fc.ListenAddr,
+		FlakePath:               fc.FlakePath,
+		DriftCheckInterval:      parseDuration(fc.DriftCheckInterval),
+		UpdateCheckInterval:     parseDuration(fc.UpdateCheckInterval),
+		HealthCheckInterval:     parseDuration(fc.HealthCheckInterval),
+		ProbeInterval:           parseDuration(fc.ProbeInterval),
+		DataDir:                 fc.DataDir,
+		MaxJobs:                 fc.MaxJobs,
+		JobRetention:            parseDuration(fc.JobRetention),
+		PKIDir:                  fc.PKIDir,
+		CredentialsDir:          fc.CredentialsDir,
+		ProvenanceDir:           fc.ProvenanceDir,
+		RequireProvenance:       fc.RequireProvenance,
+		Offline:                 fc.Offline,
+		NoEvalCache:             fc.NoEvalCache,
+		SkipReadinessCheck:      fc.SkipReadinessCheck,
+		WebhookURL:              fc.WebhookURL,
+		WebhookSecret:           fc.WebhookSecret,
+		WebhookEvents:           fc.WebhookEvents,
+		WebhookDetail:           fc.WebhookDetail,
+		EmailSMTPHost:           fc.EmailSMTPHost,
+		EmailSMTPPort:           fc.EmailSMTPPort,
+		EmailSTARTTLS:           fc.EmailSTARTTLS,
+		EmailImplicitTLS:        fc.EmailImplicitTLS,
+		EmailUsername:           fc.EmailUsername,
+		EmailPassword:           fc.EmailPassword,
+		EmailFrom:               fc.EmailFrom,
+		EmailTo:                 fc.EmailTo,
+		EmailEvents:             fc.EmailEvents,
+		SlackWebhookURL:         fc.SlackWebhookURL,
+		SlackEvents:             fc.SlackEvents,
+		MatrixHomeserverURL:     fc.MatrixHomeserverURL,
+		MatrixAccessToken:       fc.MatrixAccessToken,
+		MatrixRoomID:            fc.MatrixRoomID,
+		MatrixEvents:            fc.MatrixEvents,
+		SIEMURL:                 fc.SIEMURL,
+		SIEMEvents:              fc.SIEMEvents,
+		SIEMSpoolFile:           fc.SIEMSpoolFile,
+		PublicURL:               fc.PublicURL,
+		APIToken:                fc.APIToken,
+		MetricsToken:            fc.MetricsToken,
+		BackupInterval:          parseDuration(fc.BackupInterval),
+		BackupDir:               fc.BackupDir,
+		BackupRetention:         fc.BackupRetention,
+		BackupRecipients:        fc.BackupRecipients,
+		ApprovalAllowedSigners:  fc.ApprovalAllowedSigners,
+		K0sMetricsInterval:      parseDuration(fc.K0sMetricsInterval),
+		ComplianceCheckInterval: parseDuration(fc.ComplianceCheckInterval),
+		DrainTimeout:            parseDuration(fc.DrainTimeout),
+		HostOperationTimeout:    parseDuration(fc.HostTimeout),
+		LogLevel:                fc.LogLevel,
+		LogFormat:               fc.LogFormat,
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTempConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("writing temp config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeTempConfig(t, `
+listen_addr: ":9090"
+flake_path: /srv/flake
+drift_check_interval: 15m
+api_token: hunter2
+webhook_events: [drift, apply]
+`)
+
+	fc, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFile: %v", err)
+	}
+
+	config := fc.ToConfig()
+	if config.ListenAddr != ":9090" {
+		t.Errorf("ListenAddr = %q, want :9090", config.ListenAddr)
+	}
+	if config.DriftCheckInterval != 15*time.Minute {
+		t.Errorf("DriftCheckInterval = %v, want 15m", config.DriftCheckInterval)
+	}
+	if config.APIToken != "hunter2" {
+		t.Errorf("APIToken = %q, want hunter2", config.APIToken)
+	}
+	if len(config.WebhookEvents) != 2 {
+		t.Errorf("WebhookEvents = %v, want 2 entries", config.WebhookEvents)
+	}
+}
+
+func TestLoadConfigFileRejectsUnknownKeys(t *testing.T) {
+	path := writeTempConfig(t, "listen_addr: \":9090\"\nbogus_key: true\n")
+
+	_, err := LoadConfigFile(path)
+	if err == nil {
+		t.Fatal("expected an error for an unknown key")
+	}
+	if !strings.Contains(err.Error(), "bogus_key") {
+		t.Errorf("error %q doesn't mention the offending key", err)
+	}
+}
+
+func TestLoadConfigFileBadDurationReportsLine(t *testing.T) {
+	path := writeTempConfig(t, "listen_addr: \":9090\"\ndrift_check_interval: not-a-duration\n")
+
+	_, err := LoadConfigFile(path)
+	if err == nil {
+		t.Fatal("expected an error for an unparseable duration")
+	}
+	if !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("error %q doesn't name line 2", err)
+	}
+	if !strings.Contains(err.Error(), "drift_check_interval") {
+		t.Errorf("error %q doesn't name the offending field", err)
+	}
+}
+
+func TestLoadConfigFileExpandsEnvVars(t *testing.T) {
+	t.Setenv("NIXFLEET_TEST_TOKEN", "s3cret")
+	path := writeTempConfig(t, "api_token: ${NIXFLEET_TEST_TOKEN}\n")
+
+	fc, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFile: %v", err)
+	}
+	if fc.APIToken != "s3cret" {
+		t.Errorf("APIToken = %q, want s3cret", fc.APIToken)
+	}
+}
+
+func TestLoadConfigFileMissing(t *testing.T) {
+	if _, err := LoadConfigFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
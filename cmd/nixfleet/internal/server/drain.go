@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultDrainTimeout is used when Config.DrainTimeout is unset, so a
+// server started without --drain-timeout still drains cooperatively
+// instead of behaving like an old, drain-unaware build.
+const defaultDrainTimeout = 2 * time.Minute
+
+// drainTimeout returns the configured drain timeout, or defaultDrainTimeout
+// if it wasn't set.
+func (s *Server) drainTimeout() time.Duration {
+	if s.config.DrainTimeout > 0 {
+		return s.config.DrainTimeout
+	}
+	return defaultDrainTimeout
+}
+
+// DrainCheckpoint records where a fleet-wide apply job had gotten to the
+// last time it reported progress. It's kept on disk (see DrainStore) so
+// that a job killed mid-run - because the drain timeout expired, or because
+// something skipped draining entirely - is reported as interrupted rather
+// than just disappearing along with the in-memory Job that tracked it.
+type DrainCheckpoint struct {
+	JobID          string    `json:"job_id"`
+	CompletedHosts []string  `json:"completed_hosts"`
+	CurrentHost    string    `json:"current_host,omitempty"`
+	CurrentPhase   string    `json:"current_phase,omitempty"` // build, provenance, readiness, copy, activate
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// DrainStore persists in-flight apply-all progress to
+// <dataDir>/drain-checkpoints.json, the same load-once/save-on-write
+// pattern as JobHistory and OverrideStore. A checkpoint is written on every
+// phase transition and cleared once its job reaches a terminal status, so
+// whatever is left on disk at startup is, by construction, a job that never
+// got to finish.
+type DrainStore struct {
+	dataDir string
+
+	mu          sync.Mutex
+	checkpoints map[string]DrainCheckpoint
+}
+
+// NewDrainStore creates a store rooted at dataDir and loads any checkpoints
+// left over from a previous run. A missing or unreadable file just starts
+// empty.
+func NewDrainStore(dataDir string) *DrainStore {
+	d := &DrainStore{dataDir: dataDir, checkpoints: make(map[string]DrainCheckpoint)}
+	d.load()
+	return d
+}
+
+func (d *DrainStore) statePath() string {
+	return filepath.Join(d.dataDir, "drain-checkpoints.json")
+}
+
+func (d *DrainStore) load() {
+	data, err := os.ReadFile(d.statePath())
+	if err != nil {
+		return
+	}
+
+	var checkpoints map[string]DrainCheckpoint
+	if err := json.Unmarshal(data, &checkpoints); err != nil {
+		return
+	}
+	d.checkpoints = checkpoints
+}
+
+func (d *DrainStore) save() error {
+	if err := os.MkdirAll(d.dataDir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(d.checkpoints, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(d.statePath(), data, 0644)
+}
+
+// Update records cp's progress, keyed by cp.JobID.
+func (d *DrainStore) Update(cp DrainCheckpoint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cp.UpdatedAt = time.Now()
+	d.checkpoints[cp.JobID] = cp
+	_ = d.save()
+}
+
+// Clear removes jobID's checkpoint, once its job reaches a terminal status.
+func (d *DrainStore) Clear(jobID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.checkpoints[jobID]; !ok {
+		return
+	}
+	delete(d.checkpoints, jobID)
+	_ = d.save()
+}
+
+// Take returns every checkpoint left on disk and clears the store, for New
+// to report the previous run's interrupted jobs exactly once at startup.
+func (d *DrainStore) Take() []DrainCheckpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make([]DrainCheckpoint, 0, len(d.checkpoints))
+	for _, cp := range d.checkpoints {
+		out = append(out, cp)
+	}
+	d.checkpoints = make(map[string]DrainCheckpoint)
+	_ = d.save()
+	return out
+}
+
+// DrainResult summarizes what Drain did, returned to both the SIGTERM
+// shutdown path and POST /api/admin/drain.
+type DrainResult struct {
+	JobsAtStart  int    `json:"jobs_running_at_start"`
+	JobsFinished int    `json:"jobs_finished"`
+	TimedOut     bool   `json:"timed_out"`
+	Duration     string `json:"duration"`
+}
+
+// Drain stops the server from accepting new mutating requests (see
+// drainMiddleware) and running job runners from starting any host they
+// haven't already started, then waits up to timeout for jobs already in
+// flight to finish. It's safe to call more than once - draining only ever
+// turns on - and is used both by Start's SIGTERM handling and by
+// POST /api/admin/drain for maintenance windows that don't want the server
+// to actually exit.
+func (s *Server) Drain(timeout time.Duration) DrainResult {
+	s.draining.Store(true)
+
+	start := time.Now()
+	atStart := s.runningJobCount()
+
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+
+	for {
+		remaining := s.runningJobCount()
+		if remaining == 0 {
+			return DrainResult{JobsAtStart: atStart, JobsFinished: atStart, Duration: time.Since(start).String()}
+		}
+		select {
+		case <-ticker.C:
+			continue
+		case <-deadline:
+			return DrainResult{
+				JobsAtStart:  atStart,
+				JobsFinished: atStart - remaining,
+				TimedOut:     true,
+				Duration:     time.Since(start).String(),
+			}
+		}
+	}
+}
+
+// runningJobCount returns how many tracked jobs are still pending or
+// running.
+func (s *Server) runningJobCount() int {
+	s.jobsMu.RLock()
+	defer s.jobsMu.RUnlock()
+
+	n := 0
+	for _, j := range s.jobs {
+		if j.Status == "pending" || j.Status == "running" {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDrainStoreUpdateAndClear(t *testing.T) {
+	store := NewDrainStore(t.TempDir())
+
+	store.Update(DrainCheckpoint{JobID: "apply-all-1", CompletedHosts: []string{"web1"}, CurrentHost: "web2", CurrentPhase: "copy"})
+
+	reloaded := NewDrainStore(store.dataDir)
+	got := reloaded.Take()
+	if len(got) != 1 {
+		t.Fatalf("Take() = %d checkpoint(s), want 1", len(got))
+	}
+	if got[0].CurrentHost != "web2" || got[0].CurrentPhase != "copy" {
+		t.Errorf("checkpoint = %+v, want current host web2/copy", got[0])
+	}
+
+	store.Clear("apply-all-1")
+	if again := NewDrainStore(store.dataDir).Take(); len(again) != 0 {
+		t.Errorf("expected Clear to remove the checkpoint, got %v", again)
+	}
+}
+
+func TestDrainMiddlewareRejectsMutatingRequestsWhileDraining(t *testing.T) {
+	ts := newTestServer(t)
+	ts.draining.Store(true)
+
+	handler := ts.drainMiddleware(ts.mux)
+
+	req := httptest.NewRequest("POST", "/api/apply", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Code = %d, want 503", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header on a draining rejection")
+	}
+}
+
+func TestDrainMiddlewareAllowsReadsWhileDraining(t *testing.T) {
+	ts := newTestServer(t)
+	ts.draining.Store(true)
+
+	handler := ts.drainMiddleware(ts.mux)
+
+	req := httptest.NewRequest("GET", "/api/health", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Code = %d, want 200 for a GET while draining", rec.Code)
+	}
+}
+
+func TestDrainReturnsImmediatelyWithNoRunningJobs(t *testing.T) {
+	ts := newTestServer(t)
+
+	result := ts.Drain(100 * time.Millisecond)
+	if result.TimedOut {
+		t.Error("expected Drain not to time out with no running jobs")
+	}
+	if !ts.draining.Load() {
+		t.Error("expected Drain to set draining")
+	}
+}
+
+func TestDrainTimesOutWithAStuckJob(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createJob("apply-all", "")
+
+	result := ts.Drain(50 * time.Millisecond)
+	if !result.TimedOut {
+		t.Error("expected Drain to time out with a job stuck in pending")
+	}
+	if result.JobsAtStart != 1 {
+		t.Errorf("JobsAtStart = %d, want 1", result.JobsAtStart)
+	}
+}
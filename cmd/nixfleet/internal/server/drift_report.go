@@ -0,0 +1,29 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/driftreport"
+)
+
+// handleDriftReport serves GET /api/drift/report?window=30d: fleet-wide
+// drift trends computed from driftHistory's recorded checks - hosts and
+// files ranked by how often they drift, mean time to resolution, and
+// currently-unresolved drift.
+func (s *Server) handleDriftReport(w http.ResponseWriter, r *http.Request) {
+	window, err := driftreport.ParseWindow(r.URL.Query().Get("window"))
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hosts := s.inventory.AllHosts()
+	names := make([]string, len(hosts))
+	for i, h := range hosts {
+		names[i] = h.Name
+	}
+
+	result := driftreport.ComputeReport(s.driftHistory, names, time.Now(), window)
+	s.jsonResponse(w, result, http.StatusOK)
+}
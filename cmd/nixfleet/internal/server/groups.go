@@ -0,0 +1,257 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+	"github.com/nixfleet/nixfleet/internal/logging"
+	"github.com/nixfleet/nixfleet/internal/pullmode"
+)
+
+// handleListGroups handles GET /api/groups, listing every declared group
+// with its resolved (children-included) host count, for the UI's group
+// filter dropdown to populate without hardcoding anything.
+func (s *Server) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(s.inventory.Groups))
+	for name := range s.inventory.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	groups := make([]map[string]any, 0, len(names))
+	for _, name := range names {
+		groups = append(groups, map[string]any{
+			"name":       name,
+			"host_count": len(s.inventory.HostsInGroup(name)),
+		})
+	}
+
+	s.jsonResponse(w, map[string]any{"groups": groups}, http.StatusOK)
+}
+
+// groupHostsOrError resolves name to its hosts via Inventory.HostsInGroup,
+// which already recurses into child groups, so group-scoped endpoints get
+// nested-group support for free. It writes the response itself on failure:
+// a 404 for a group that was never declared, a 422 for one that resolves
+// to zero hosts - the latter matters because an empty result here isn't a
+// no-op, it's almost always a typo'd name or a misconfigured group that
+// should be surfaced, not silently treated as "nothing to do".
+func (s *Server) groupHostsOrError(w http.ResponseWriter, name string) ([]*inventory.Host, bool) {
+	if _, ok := s.inventory.GetGroup(name); !ok {
+		s.jsonError(w, "group not found: "+name, http.StatusNotFound)
+		return nil, false
+	}
+
+	hosts := s.inventory.HostsInGroup(name)
+	if len(hosts) == 0 {
+		s.jsonError(w, "group resolves to zero hosts: "+name, http.StatusUnprocessableEntity)
+		return nil, false
+	}
+
+	return hosts, true
+}
+
+// handleGroupApply handles POST /api/groups/{name}/apply: applies every
+// host in the group as a single staged apply-all job, the same runner
+// GET /api/apply?group= uses under the hood, just addressed by path
+// instead of a query filter.
+func (s *Server) handleGroupApply(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	hosts, ok := s.groupHostsOrError(w, name)
+	if !ok {
+		return
+	}
+
+	if report := s.evaluateReadiness(r.Context()); !report.Ready {
+		s.jsonResponse(w, report, http.StatusServiceUnavailable)
+		return
+	}
+
+	job := s.createJob("apply-all", "")
+
+	go func() {
+		ctx := logging.WithJobID(logging.ContextWithLogger(context.Background(), s.logger), job.ID)
+		s.runApplyAllJob(ctx, job, []inventory.Stage{{Name: name, Hosts: hosts}}, -1)
+	}()
+
+	s.jsonResponse(w, job, http.StatusAccepted)
+}
+
+// handleGroupDriftCheck handles POST /api/groups/{name}/drift/check,
+// running the same drift-check job POST /api/drift/check?group= does.
+func (s *Server) handleGroupDriftCheck(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	hosts, ok := s.groupHostsOrError(w, name)
+	if !ok {
+		return
+	}
+
+	job := s.createJob("drift-check", "")
+
+	go func() {
+		ctx := logging.WithJobID(logging.ContextWithLogger(context.Background(), s.logger), job.ID)
+		s.runDriftCheckJob(ctx, job, hosts)
+	}()
+
+	s.jsonResponse(w, job, http.StatusAccepted)
+}
+
+// handleGroupPullTrigger handles POST /api/groups/{name}/pull-trigger,
+// triggering a pull-mode run on every pull-mode host in the group as one
+// job. ?ignore_window=true bypasses each host's transfer window gate, same
+// as the per-host POST /api/pull-mode/{name}/trigger.
+func (s *Server) handleGroupPullTrigger(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	hosts, ok := s.groupHostsOrError(w, name)
+	if !ok {
+		return
+	}
+
+	ignoreWindow := r.URL.Query().Get("ignore_window") == "true"
+	job := s.createJob("pull-trigger", "")
+
+	go func() {
+		ctx := logging.WithJobID(logging.ContextWithLogger(context.Background(), s.logger), job.ID)
+		s.runGroupPullTriggerJob(ctx, job, hosts, ignoreWindow)
+	}()
+
+	s.jsonResponse(w, job, http.StatusAccepted)
+}
+
+// runGroupPullTriggerJob triggers pull mode on each of hosts, skipping
+// (not failing) any host that doesn't have it installed - a group mixing
+// push- and pull-mode hosts is normal, not an error condition.
+func (s *Server) runGroupPullTriggerJob(ctx context.Context, job *Job, hosts []*inventory.Host, ignoreWindow bool) {
+	s.updateJob(job, "running", nil, "")
+
+	installer := pullmode.NewInstaller()
+	results := make([]map[string]any, 0, len(hosts))
+	triggered, skipped, failed := 0, 0, 0
+
+	for _, host := range hosts {
+		hostCtx := logging.WithHost(ctx, host.Name)
+
+		client, err := s.pool.GetWithUser(hostCtx, host.Addr, host.SSHPort, host.SSHUser)
+		if err != nil {
+			results = append(results, map[string]any{"host": host.Name, "error": "connection failed: " + err.Error()})
+			failed++
+			continue
+		}
+
+		status, err := installer.Status(hostCtx, client)
+		if err != nil {
+			results = append(results, map[string]any{"host": host.Name, "error": "status failed: " + err.Error()})
+			failed++
+			continue
+		}
+		if !status.Installed {
+			results = append(results, map[string]any{"host": host.Name, "skipped": true, "reason": "pull mode not installed"})
+			skipped++
+			continue
+		}
+
+		if err := installer.TriggerPull(hostCtx, client, ignoreWindow); err != nil {
+			results = append(results, map[string]any{"host": host.Name, "error": "trigger failed: " + err.Error()})
+			failed++
+			continue
+		}
+
+		results = append(results, map[string]any{"host": host.Name, "triggered": true})
+		triggered++
+	}
+
+	s.updateJob(job, "completed", map[string]any{
+		"hosts":     len(hosts),
+		"triggered": triggered,
+		"skipped":   skipped,
+		"failed":    failed,
+		"results":   results,
+	}, "")
+}
+
+// groupRollup is GET /api/groups/{name}/status's response: per-category
+// counts across the group plus the name of one host in each non-healthy
+// category, so a dashboard can link straight to the host that needs
+// attention instead of scanning the full per-host list. "Worst" picks the
+// first offender for drift/reboot and the host with the most pending
+// updates - there's no single ranking that makes sense across all three.
+type groupRollup struct {
+	Group          string `json:"group"`
+	TotalHosts     int    `json:"total_hosts"`
+	Online         int    `json:"online"`
+	Offline        int    `json:"offline"`
+	Drifted        int    `json:"drifted"`
+	RebootRequired int    `json:"reboot_required"`
+	UpdatePending  int    `json:"update_pending"`
+
+	WorstDrifted        string `json:"worst_drifted,omitempty"`
+	WorstRebootRequired string `json:"worst_reboot_required,omitempty"`
+	WorstUpdatePending  string `json:"worst_update_pending,omitempty"`
+
+	worstUpdateCount int
+
+	Hosts []map[string]any `json:"hosts"`
+}
+
+// handleGroupStatus handles GET /api/groups/{name}/status: an aggregated
+// roll-up across the group's hosts, built the same way GET /api/drift does
+// per host - a live SSH read of each host's state, so it reflects reality
+// rather than whatever the last background check happened to record.
+func (s *Server) handleGroupStatus(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	hosts, ok := s.groupHostsOrError(w, name)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	rollup := groupRollup{Group: name, TotalHosts: len(hosts), Hosts: make([]map[string]any, 0, len(hosts))}
+
+	for _, host := range hosts {
+		client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+		if err != nil {
+			rollup.Offline++
+			rollup.Hosts = append(rollup.Hosts, map[string]any{"host": host.Name, "online": false, "error": err.Error()})
+			continue
+		}
+
+		hostState, err := s.stateMgr.ReadState(ctx, client)
+		if err != nil {
+			rollup.Offline++
+			rollup.Hosts = append(rollup.Hosts, map[string]any{"host": host.Name, "online": false, "error": err.Error()})
+			continue
+		}
+
+		rollup.Online++
+		entry := map[string]any{"host": host.Name, "online": true}
+
+		if hostState.DriftDetected {
+			rollup.Drifted++
+			entry["drift_detected"] = true
+			if rollup.WorstDrifted == "" {
+				rollup.WorstDrifted = host.Name
+			}
+		}
+		if hostState.RebootRequired {
+			rollup.RebootRequired++
+			entry["reboot_required"] = true
+			if rollup.WorstRebootRequired == "" {
+				rollup.WorstRebootRequired = host.Name
+			}
+		}
+		if hostState.PendingUpdates > 0 {
+			rollup.UpdatePending++
+			entry["pending_updates"] = hostState.PendingUpdates
+			if hostState.PendingUpdates > rollup.worstUpdateCount {
+				rollup.worstUpdateCount = hostState.PendingUpdates
+				rollup.WorstUpdatePending = host.Name
+			}
+		}
+
+		rollup.Hosts = append(rollup.Hosts, entry)
+	}
+
+	s.jsonResponse(w, rollup, http.StatusOK)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/preflight"
+	"github.com/nixfleet/nixfleet/internal/ssh"
+)
+
+// readinessCacheTTL bounds how often evaluateReadiness actually re-runs its
+// checks. Unlike preflight.ReadinessCache (which caches for the lifetime of
+// a single apply run), the server runs indefinitely, so a plain run-once
+// cache would go stale forever after the first request.
+const readinessCacheTTL = 15 * time.Second
+
+// ReadinessReport is the GET /api/health/ready response body: whether the
+// server can currently do its job, and the breakdown of checks that decided
+// that, so a caller can name the failing dependency instead of guessing.
+type ReadinessReport struct {
+	Ready     bool                    `json:"ready"`
+	Checks    []preflight.CheckResult `json:"checks"`
+	CheckedAt time.Time               `json:"checked_at"`
+}
+
+// readinessCache holds the last ReadinessReport computed, so a client
+// polling /api/health/ready (or the apply handlers gating on it) doesn't
+// force a fresh nix/SSH round trip on every call.
+type readinessCache struct {
+	mu   sync.Mutex
+	last *ReadinessReport
+}
+
+// evaluateReadiness returns the server's current self-readiness, reusing the
+// last report if it's within readinessCacheTTL. This is distinct from
+// checkReadiness, which probes a single deploy target's readiness for a
+// copy, not the server's own ability to evaluate and deploy at all.
+func (s *Server) evaluateReadiness(ctx context.Context) ReadinessReport {
+	s.readiness.mu.Lock()
+	defer s.readiness.mu.Unlock()
+
+	if s.readiness.last != nil && time.Since(s.readiness.last.CheckedAt) < readinessCacheTTL {
+		return *s.readiness.last
+	}
+
+	checks := []preflight.CheckResult{
+		s.checkNixAvailable(ctx),
+		s.checkFlakeEvaluable(ctx),
+		s.checkInventoryValid(),
+		s.checkDataDirWritable(),
+		s.checkSSHAgent(),
+	}
+
+	ready := true
+	for _, c := range checks {
+		if !c.Passed {
+			ready = false
+			break
+		}
+	}
+
+	report := ReadinessReport{
+		Ready:     ready,
+		Checks:    checks,
+		CheckedAt: time.Now(),
+	}
+	s.readiness.last = &report
+	return report
+}
+
+func (s *Server) checkNixAvailable(ctx context.Context) preflight.CheckResult {
+	version, err := s.evaluator.CheckAvailable(ctx)
+	if err != nil {
+		return preflight.CheckResult{Name: "nix_available", Passed: false, Message: "nix binary is not usable", Details: err.Error()}
+	}
+	return preflight.CheckResult{Name: "nix_available", Passed: true, Message: version}
+}
+
+func (s *Server) checkFlakeEvaluable(ctx context.Context) preflight.CheckResult {
+	if err := s.evaluator.CheckFlakeEvaluable(ctx); err != nil {
+		return preflight.CheckResult{Name: "flake_evaluable", Passed: false, Message: "flake failed to evaluate", Details: err.Error()}
+	}
+	return preflight.CheckResult{Name: "flake_evaluable", Passed: true, Message: "flake metadata OK"}
+}
+
+func (s *Server) checkInventoryValid() preflight.CheckResult {
+	if err := s.inventory.Validate(); err != nil {
+		return preflight.CheckResult{Name: "inventory_valid", Passed: false, Message: "inventory failed validation", Details: err.Error()}
+	}
+	return preflight.CheckResult{Name: "inventory_valid", Passed: true, Message: "inventory OK"}
+}
+
+func (s *Server) checkDataDirWritable() preflight.CheckResult {
+	probe := filepath.Join(s.dataDir(), ".readiness-probe")
+	if err := os.WriteFile(probe, []byte("ok"), 0o600); err != nil {
+		return preflight.CheckResult{Name: "data_dir_writable", Passed: false, Message: "data dir is not writable", Details: err.Error()}
+	}
+	os.Remove(probe)
+	return preflight.CheckResult{Name: "data_dir_writable", Passed: true, Message: s.dataDir()}
+}
+
+func (s *Server) checkSSHAgent() preflight.CheckResult {
+	if err := ssh.AgentReachable(); err != nil {
+		return preflight.CheckResult{Name: "ssh_agent", Passed: false, Message: "SSH agent is not reachable", Details: err.Error()}
+	}
+	return preflight.CheckResult{Name: "ssh_agent", Passed: true, Message: "agent reachable"}
+}
+
+// handleHealthReady serves GET /api/health/ready. It's unauthenticated like
+// GET /api/health so a load balancer or the UI's degraded banner can poll it
+// without a token, and returns 503 rather than 200 the moment any hard
+// dependency fails.
+func (s *Server) handleHealthReady(w http.ResponseWriter, r *http.Request) {
+	report := s.evaluateReadiness(r.Context())
+
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	s.jsonResponse(w, report, status)
+}
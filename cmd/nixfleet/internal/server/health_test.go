@@ -0,0 +1,50 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckInventoryValid(t *testing.T) {
+	ts := newTestServer(t)
+
+	result := ts.checkInventoryValid()
+	if !result.Passed {
+		t.Errorf("expected a valid inventory to pass, got: %s", result.Message)
+	}
+	if result.Name != "inventory_valid" {
+		t.Errorf("expected name 'inventory_valid', got %q", result.Name)
+	}
+}
+
+func TestCheckDataDirWritable(t *testing.T) {
+	ts := newTestServer(t)
+	ts.config.DataDir = t.TempDir()
+
+	result := ts.checkDataDirWritable()
+	if !result.Passed {
+		t.Errorf("expected a writable temp dir to pass, got: %s", result.Message)
+	}
+}
+
+func TestCheckDataDirWritableFailsOnMissingDir(t *testing.T) {
+	ts := newTestServer(t)
+	ts.config.DataDir = "/nonexistent/does/not/exist"
+
+	result := ts.checkDataDirWritable()
+	if result.Passed {
+		t.Error("expected an unwritable data dir to fail")
+	}
+}
+
+func TestReadinessCacheReusesRecentReport(t *testing.T) {
+	ts := newTestServer(t)
+
+	report := &ReadinessReport{Ready: true, CheckedAt: time.Now()}
+	ts.readiness.last = report
+
+	got := ts.evaluateReadiness(t.Context())
+	if !got.Ready {
+		t.Error("expected cached report to be reused within the TTL")
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// JobHistoryEntry is a completed job's record, kept after the in-memory Job
+// it came from is eligible for garbage collection.
+type JobHistoryEntry struct {
+	Type      string    `json:"type"`
+	Status    string    `json:"status"`
+	Host      string    `json:"host,omitempty"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+// maxJobHistoryEntries bounds job-history.json so it doesn't grow forever on
+// a long-lived server.
+const maxJobHistoryEntries = 2000
+
+// JobHistory persists completed jobs to <dataDir>/job-history.json, so
+// GET /api/stats can compute aggregates (jobs completed/failed, average
+// apply duration) that survive a server restart, the same way OverrideStore
+// persists host overrides.
+type JobHistory struct {
+	dataDir string
+
+	mu      sync.Mutex
+	entries []JobHistoryEntry
+}
+
+// NewJobHistory creates a store rooted at dataDir and loads any previously
+// persisted history. A missing or unreadable file just starts empty.
+func NewJobHistory(dataDir string) *JobHistory {
+	h := &JobHistory{dataDir: dataDir}
+	h.load()
+	return h
+}
+
+func (h *JobHistory) statePath() string {
+	return filepath.Join(h.dataDir, "job-history.json")
+}
+
+func (h *JobHistory) load() {
+	data, err := os.ReadFile(h.statePath())
+	if err != nil {
+		return
+	}
+
+	var entries []JobHistoryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return
+	}
+	h.entries = entries
+}
+
+func (h *JobHistory) save() error {
+	if err := os.MkdirAll(h.dataDir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(h.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(h.statePath(), data, 0644)
+}
+
+// Record appends a completed job, trimming the oldest entries beyond
+// maxJobHistoryEntries.
+func (h *JobHistory) Record(e JobHistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries = append(h.entries, e)
+	if len(h.entries) > maxJobHistoryEntries {
+		h.entries = h.entries[len(h.entries)-maxJobHistoryEntries:]
+	}
+	_ = h.save()
+}
+
+// JobStats is the aggregate GET /api/stats reports for a time window.
+type JobStats struct {
+	Window               string `json:"window"`
+	Completed            int    `json:"completed"`
+	Failed               int    `json:"failed"`
+	AverageApplyDuration string `json:"average_apply_duration,omitempty"`
+}
+
+// Stats computes aggregates over entries that finished within the last
+// window.
+func (h *JobHistory) Stats(window time.Duration) JobStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stats := JobStats{Window: window.String()}
+	cutoff := time.Now().Add(-window)
+
+	var applyTotal time.Duration
+	var applyCount int
+	for _, e := range h.entries {
+		if e.EndTime.Before(cutoff) {
+			continue
+		}
+		switch e.Status {
+		case "completed":
+			stats.Completed++
+		case "failed":
+			stats.Failed++
+		}
+		if e.Type == "apply" && e.Status == "completed" {
+			applyTotal += e.EndTime.Sub(e.StartTime)
+			applyCount++
+		}
+	}
+	if applyCount > 0 {
+		stats.AverageApplyDuration = (applyTotal / time.Duration(applyCount)).String()
+	}
+
+	return stats
+}
+
+// Snapshot returns the current history in its persisted JSON encoding, for
+// 'server backup'. See OverrideStore.Snapshot.
+func (h *JobHistory) Snapshot() ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return json.MarshalIndent(h.entries, "", "  ")
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// defaultMaxJobs and defaultJobRetention bound the in-memory/persisted job
+// map when Config.MaxJobs/JobRetention aren't set, so a server left running
+// indefinitely doesn't grow jobs.json (or memory) without bound.
+const (
+	defaultMaxJobs      = 500
+	defaultJobRetention = 24 * time.Hour
+)
+
+// jobPruneInterval is how often runJobPruner sweeps the job map. Pruning is
+// cheap (an in-memory scan plus one JSON write), so there's no need to make
+// it configurable the way the drift/update/health schedulers are.
+const jobPruneInterval = 10 * time.Minute
+
+// jobStorePath returns where jobs.json lives under dataDir, mirroring
+// JobHistory.statePath and Prober.statePath.
+func jobStorePath(dataDir string) string {
+	return filepath.Join(dataDir, "jobs.json")
+}
+
+// loadJobs reads <dataDir>/jobs.json, marking any job that was still
+// "pending" or "running" when the process last stopped as "interrupted" -
+// it was killed mid-flight by a restart, not abandoned by the operator. A
+// missing or unreadable file just starts empty, the same as JobHistory.
+func loadJobs(dataDir string) map[string]*Job {
+	jobs := make(map[string]*Job)
+
+	data, err := os.ReadFile(jobStorePath(dataDir))
+	if err != nil {
+		return jobs
+	}
+
+	var list []*Job
+	if err := json.Unmarshal(data, &list); err != nil {
+		log.Printf("loading jobs.json: %v", err)
+		return jobs
+	}
+
+	now := time.Now()
+	for _, j := range list {
+		if !jobTerminal(j.Status) {
+			j.Status = "interrupted"
+			j.Error = "server restarted while job was in progress"
+			j.EndTime = now
+		}
+		jobs[j.ID] = j
+	}
+	return jobs
+}
+
+// saveJobs persists the current job map to <dataDir>/jobs.json, newest-last
+// so a human skimming the file sees recent jobs at the bottom.
+func saveJobs(dataDir string, jobs map[string]*Job) error {
+	list := make([]*Job, 0, len(jobs))
+	for _, j := range jobs {
+		list = append(list, j)
+	}
+	sort.Slice(list, func(i, k int) bool { return list[i].StartTime.Before(list[k].StartTime) })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(jobStorePath(dataDir), data, 0644)
+}
+
+// pruneJobs removes terminal jobs older than maxAge and, beyond that, the
+// oldest terminal jobs past maxCount. A job that hasn't reached a terminal
+// status is never pruned, however old, since forgetting about it while
+// it's still in flight would make it look like it never ran at all.
+// maxCount <= 0 or maxAge <= 0 disables that half of the bound. Returns
+// whether anything was removed, so the caller only persists when it did.
+func pruneJobs(jobs map[string]*Job, maxCount int, maxAge time.Duration) bool {
+	changed := false
+
+	if maxAge > 0 {
+		cutoff := time.Now().Add(-maxAge)
+		for id, j := range jobs {
+			if jobTerminal(j.Status) && j.EndTime.Before(cutoff) {
+				delete(jobs, id)
+				changed = true
+			}
+		}
+	}
+
+	if maxCount > 0 && len(jobs) > maxCount {
+		terminal := make([]*Job, 0, len(jobs))
+		for _, j := range jobs {
+			if jobTerminal(j.Status) {
+				terminal = append(terminal, j)
+			}
+		}
+		sort.Slice(terminal, func(i, k int) bool { return terminal[i].StartTime.Before(terminal[k].StartTime) })
+
+		excess := len(jobs) - maxCount
+		for _, j := range terminal {
+			if excess <= 0 {
+				break
+			}
+			delete(jobs, j.ID)
+			excess--
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// maxJobs and jobRetention resolve Config.MaxJobs/JobRetention, applying
+// the package defaults when unset. Both are reloadable (see ReloadConfig),
+// so they're read through configMu rather than off s.config directly.
+func (s *Server) maxJobs() int {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	if s.config.MaxJobs > 0 {
+		return s.config.MaxJobs
+	}
+	return defaultMaxJobs
+}
+
+func (s *Server) jobRetention() time.Duration {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	if s.config.JobRetention > 0 {
+		return s.config.JobRetention
+	}
+	return defaultJobRetention
+}
+
+// persistJobs snapshots the job map and writes it to disk. Called with
+// jobsMu NOT held - it takes its own RLock, matching handleListJobs.
+func (s *Server) persistJobs() {
+	s.jobsMu.RLock()
+	jobs := make(map[string]*Job, len(s.jobs))
+	for id, j := range s.jobs {
+		jobCopy := *j
+		jobs[id] = &jobCopy
+	}
+	s.jobsMu.RUnlock()
+
+	if err := saveJobs(s.dataDir(), jobs); err != nil {
+		log.Printf("saving jobs.json: %v", err)
+	}
+}
+
+// runJobPruner periodically removes jobs beyond maxJobs()/jobRetention()
+// from the live job map and persists the result, so a long-lived server's
+// memory and jobs.json stay bounded without an operator having to restart
+// it. Stops when ctx is done.
+func (s *Server) runJobPruner(ctx context.Context) {
+	ticker := time.NewTicker(jobPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.jobsMu.Lock()
+			changed := pruneJobs(s.jobs, s.maxJobs(), s.jobRetention())
+			s.jobsMu.Unlock()
+			if changed {
+				s.persistJobs()
+			}
+		}
+	}
+}
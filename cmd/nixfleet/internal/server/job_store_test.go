@@ -0,0 +1,125 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSaveAndLoadJobsRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	jobs := map[string]*Job{
+		"apply-1": {ID: "apply-1", Type: "apply", Status: "completed", Host: "web1", StartTime: time.Now()},
+	}
+	if err := saveJobs(dir, jobs); err != nil {
+		t.Fatalf("saveJobs: %v", err)
+	}
+
+	loaded := loadJobs(dir)
+	if len(loaded) != 1 {
+		t.Fatalf("loadJobs() = %d job(s), want 1", len(loaded))
+	}
+	got, ok := loaded["apply-1"]
+	if !ok {
+		t.Fatal("expected job apply-1 to round-trip")
+	}
+	if got.Status != "completed" || got.Host != "web1" {
+		t.Errorf("loaded job = %+v, want status completed on web1", got)
+	}
+}
+
+func TestLoadJobsMarksInFlightJobsInterrupted(t *testing.T) {
+	dir := t.TempDir()
+
+	jobs := map[string]*Job{
+		"apply-1": {ID: "apply-1", Type: "apply", Status: "running", Host: "web1", StartTime: time.Now()},
+		"apply-2": {ID: "apply-2", Type: "apply", Status: "pending", Host: "web2", StartTime: time.Now()},
+		"apply-3": {ID: "apply-3", Type: "apply", Status: "completed", Host: "web3", StartTime: time.Now()},
+	}
+	if err := saveJobs(dir, jobs); err != nil {
+		t.Fatalf("saveJobs: %v", err)
+	}
+
+	loaded := loadJobs(dir)
+	if loaded["apply-1"].Status != "interrupted" {
+		t.Errorf("apply-1 status = %q, want interrupted", loaded["apply-1"].Status)
+	}
+	if loaded["apply-1"].Error == "" {
+		t.Error("expected apply-1 to get an explanatory Error")
+	}
+	if loaded["apply-2"].Status != "interrupted" {
+		t.Errorf("apply-2 status = %q, want interrupted", loaded["apply-2"].Status)
+	}
+	if loaded["apply-3"].Status != "completed" {
+		t.Errorf("apply-3 status = %q, want unchanged completed", loaded["apply-3"].Status)
+	}
+}
+
+func TestLoadJobsMissingFileStartsEmpty(t *testing.T) {
+	loaded := loadJobs(t.TempDir())
+	if len(loaded) != 0 {
+		t.Errorf("loadJobs() on an empty dir = %d job(s), want 0", len(loaded))
+	}
+}
+
+func TestPruneJobsByAge(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	jobs := map[string]*Job{
+		"old":     {ID: "old", Status: "completed", StartTime: old, EndTime: old},
+		"recent":  {ID: "recent", Status: "completed", StartTime: time.Now(), EndTime: time.Now()},
+		"running": {ID: "running", Status: "running", StartTime: old},
+	}
+
+	changed := pruneJobs(jobs, 0, 24*time.Hour)
+	if !changed {
+		t.Error("expected pruneJobs to report a change")
+	}
+	if _, ok := jobs["old"]; ok {
+		t.Error("expected old completed job to be pruned")
+	}
+	if _, ok := jobs["recent"]; !ok {
+		t.Error("expected recent completed job to survive")
+	}
+	if _, ok := jobs["running"]; !ok {
+		t.Error("expected a still-running job to survive regardless of age")
+	}
+}
+
+func TestPruneJobsByCount(t *testing.T) {
+	jobs := make(map[string]*Job)
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		id := string(rune('a' + i))
+		jobs[id] = &Job{ID: id, Status: "completed", StartTime: base.Add(time.Duration(i) * time.Minute), EndTime: base}
+	}
+
+	changed := pruneJobs(jobs, 3, 0)
+	if !changed {
+		t.Error("expected pruneJobs to report a change")
+	}
+	if len(jobs) != 3 {
+		t.Fatalf("len(jobs) = %d, want 3", len(jobs))
+	}
+	for _, id := range []string{"a", "b"} {
+		if _, ok := jobs[id]; ok {
+			t.Errorf("expected oldest job %s to be pruned", id)
+		}
+	}
+	for _, id := range []string{"c", "d", "e"} {
+		if _, ok := jobs[id]; !ok {
+			t.Errorf("expected newest job %s to survive", id)
+		}
+	}
+}
+
+func TestPruneJobsNoop(t *testing.T) {
+	jobs := map[string]*Job{
+		"a": {ID: "a", Status: "completed", StartTime: time.Now(), EndTime: time.Now()},
+	}
+	if pruneJobs(jobs, 0, 0) {
+		t.Error("expected pruneJobs with no bounds to report no change")
+	}
+	if len(jobs) != 1 {
+		t.Error("expected pruneJobs with no bounds to remove nothing")
+	}
+}
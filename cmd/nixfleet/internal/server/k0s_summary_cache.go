@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/nixfleet/nixfleet/internal/k0s"
+)
+
+// K0sSummaryCache is a disk-persisted, latest-snapshot-per-cluster cache of
+// k0s.Summary, one entry per k0s controller host. It's updated by
+// Scheduler's k0s-metrics task and read by GET /api/k8s/{controller}/summary.
+// Like search.Cache, an entry is opportunistic - it reflects whenever that
+// host's collection last ran, not a live query - and it's deliberately left
+// out of 'server backup': it's a recomputable metrics snapshot, not durable
+// state, the same reasoning that keeps search-cache.json out of backups too.
+type K0sSummaryCache struct {
+	path string
+
+	mu       sync.RWMutex
+	clusters map[string]k0s.Summary
+}
+
+// NewK0sSummaryCache creates a cache that persists under dataDir, loading
+// any existing snapshot immediately.
+func NewK0sSummaryCache(dataDir string) *K0sSummaryCache {
+	c := &K0sSummaryCache{
+		path:     filepath.Join(dataDir, "k0s-summary-cache.json"),
+		clusters: make(map[string]k0s.Summary),
+	}
+	c.load()
+	return c
+}
+
+func (c *K0sSummaryCache) load() {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return
+	}
+	var clusters map[string]k0s.Summary
+	if err := json.Unmarshal(data, &clusters); err != nil {
+		log.Printf("K0sSummaryCache: failed to load state: %v", err)
+		return
+	}
+	c.mu.Lock()
+	c.clusters = clusters
+	c.mu.Unlock()
+}
+
+func (c *K0sSummaryCache) save() {
+	c.mu.RLock()
+	data, err := json.MarshalIndent(c.clusters, "", "  ")
+	c.mu.RUnlock()
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		log.Printf("K0sSummaryCache: failed to create data dir: %v", err)
+		return
+	}
+	if err := os.WriteFile(c.path, data, 0644); err != nil {
+		log.Printf("K0sSummaryCache: failed to save state: %v", err)
+	}
+}
+
+// Update records controller's latest summary.
+func (c *K0sSummaryCache) Update(controller string, summary k0s.Summary) {
+	c.mu.Lock()
+	c.clusters[controller] = summary
+	c.mu.Unlock()
+	c.save()
+}
+
+// Get returns the latest summary for controller, if one has been collected.
+func (c *K0sSummaryCache) Get(controller string) (k0s.Summary, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	summary, ok := c.clusters[controller]
+	return summary, ok
+}
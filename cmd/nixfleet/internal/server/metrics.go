@@ -0,0 +1,225 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// applyDurationBuckets are the histogram bucket boundaries (seconds) for
+// nixfleet_apply_duration_seconds, chosen to span a quick single-host apply
+// (a few seconds) up to a slow multi-host apply-all (tens of minutes)
+// without needing so many buckets the exposition gets noisy.
+var applyDurationBuckets = []float64{5, 15, 30, 60, 120, 300, 600, 1800, 3600}
+
+// hostMetrics is the latest known values for one host's gauges, each set
+// independently by whichever scheduler task last checked it - drift-check
+// sets Reachable/DriftDetected, update-check sets PendingUpdates/
+// SecurityUpdates, health-check sets Reachable/RebootRequired. A field a
+// task has never populated stays at its zero value rather than blocking the
+// others from being reported.
+type hostMetrics struct {
+	reachable       bool
+	driftDetected   bool
+	driftFiles      int
+	pendingUpdates  int
+	securityUpdates int
+	rebootRequired  bool
+}
+
+// Metrics is a small hand-rolled Prometheus registry backing GET /metrics.
+// It's updated in place by the scheduler's drift/update/health check tasks
+// and by Server.updateJob, rather than the handler doing any SSH work of
+// its own on scrape - a scrape has to stay cheap no matter how large the
+// fleet or how tight the scrape interval is.
+type Metrics struct {
+	mu    sync.Mutex
+	hosts map[string]*hostMetrics
+
+	jobCounts map[jobCountKey]int64
+
+	applyDurationCounts []int64 // cumulative count per bucket in applyDurationBuckets, plus one for +Inf
+	applyDurationSum    float64
+	applyDurationTotal  int64
+}
+
+type jobCountKey struct {
+	jobType string
+	status  string
+}
+
+// NewMetrics creates an empty registry.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		hosts:               make(map[string]*hostMetrics),
+		jobCounts:           make(map[jobCountKey]int64),
+		applyDurationCounts: make([]int64, len(applyDurationBuckets)+1),
+	}
+}
+
+func (m *Metrics) host(name string) *hostMetrics {
+	hm, ok := m.hosts[name]
+	if !ok {
+		hm = &hostMetrics{}
+		m.hosts[name] = hm
+	}
+	return hm
+}
+
+// SetReachable records whether host could be connected to for the check
+// that just ran on it.
+func (m *Metrics) SetReachable(host string, reachable bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.host(host).reachable = reachable
+}
+
+// SetDrift records the outcome of a drift check on host.
+func (m *Metrics) SetDrift(host string, detected bool, fileCount int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hm := m.host(host)
+	hm.reachable = true
+	hm.driftDetected = detected
+	hm.driftFiles = fileCount
+}
+
+// SetUpdates records the outcome of an update check on host.
+func (m *Metrics) SetUpdates(host string, pending, security int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hm := m.host(host)
+	hm.reachable = true
+	hm.pendingUpdates = pending
+	hm.securityUpdates = security
+}
+
+// SetRebootRequired records the outcome of a reboot-required check on host.
+func (m *Metrics) SetRebootRequired(host string, required bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hm := m.host(host)
+	hm.reachable = true
+	hm.rebootRequired = required
+}
+
+// IncJob increments the counter for a terminal job of jobType/status,
+// called from Server.updateJob once per job's lifetime (when it reaches a
+// terminal state), so retried polling of the same job never double-counts.
+func (m *Metrics) IncJob(jobType, status string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobCounts[jobCountKey{jobType, status}]++
+}
+
+// ObserveApplyDuration records one apply job's wall-clock duration into the
+// apply duration histogram.
+func (m *Metrics) ObserveApplyDuration(d time.Duration) {
+	seconds := d.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, le := range applyDurationBuckets {
+		if seconds <= le {
+			m.applyDurationCounts[i]++
+		}
+	}
+	m.applyDurationCounts[len(applyDurationBuckets)]++ // +Inf bucket
+	m.applyDurationSum += seconds
+	m.applyDurationTotal++
+}
+
+// Render formats the registry as Prometheus text exposition format
+// (https://prometheus.io/docs/instrumenting/exposition_formats/), suitable
+// for a direct scrape or a node_exporter textfile collector.
+func (m *Metrics) Render() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	hostNames := make([]string, 0, len(m.hosts))
+	for name := range m.hosts {
+		hostNames = append(hostNames, name)
+	}
+	sort.Strings(hostNames)
+
+	writeHostGauge := func(name, help string, val func(*hostMetrics) int) {
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+		for _, host := range hostNames {
+			fmt.Fprintf(&b, "%s{host=%q} %d\n", name, host, val(m.hosts[host]))
+		}
+	}
+
+	writeHostGauge("nixfleet_host_reachable", "Whether the host responded to its last scheduled check.", func(hm *hostMetrics) int { return boolGauge(hm.reachable) })
+	writeHostGauge("nixfleet_host_drift_detected", "Whether configuration drift was detected on the host.", func(hm *hostMetrics) int { return boolGauge(hm.driftDetected) })
+	writeHostGauge("nixfleet_host_drift_files", "Number of files with detected drift on the host.", func(hm *hostMetrics) int { return hm.driftFiles })
+	writeHostGauge("nixfleet_host_pending_updates", "Number of pending package updates on the host.", func(hm *hostMetrics) int { return hm.pendingUpdates })
+	writeHostGauge("nixfleet_host_security_updates", "Number of pending security package updates on the host.", func(hm *hostMetrics) int { return hm.securityUpdates })
+	writeHostGauge("nixfleet_host_reboot_required", "Whether the host has a pending reboot.", func(hm *hostMetrics) int { return boolGauge(hm.rebootRequired) })
+
+	fmt.Fprintln(&b, "# HELP nixfleet_jobs_total Total number of jobs that reached a terminal status, by type and status.")
+	fmt.Fprintln(&b, "# TYPE nixfleet_jobs_total counter")
+	keys := make([]jobCountKey, 0, len(m.jobCounts))
+	for k := range m.jobCounts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].jobType != keys[j].jobType {
+			return keys[i].jobType < keys[j].jobType
+		}
+		return keys[i].status < keys[j].status
+	})
+	for _, k := range keys {
+		fmt.Fprintf(&b, "nixfleet_jobs_total{type=%q,status=%q} %d\n", k.jobType, k.status, m.jobCounts[k])
+	}
+
+	fmt.Fprintln(&b, "# HELP nixfleet_apply_duration_seconds Wall-clock duration of apply jobs.")
+	fmt.Fprintln(&b, "# TYPE nixfleet_apply_duration_seconds histogram")
+	for i, le := range applyDurationBuckets {
+		fmt.Fprintf(&b, "nixfleet_apply_duration_seconds_bucket{le=%q} %d\n", formatLe(le), m.applyDurationCounts[i])
+	}
+	fmt.Fprintf(&b, "nixfleet_apply_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.applyDurationCounts[len(applyDurationBuckets)])
+	fmt.Fprintf(&b, "nixfleet_apply_duration_seconds_sum %g\n", m.applyDurationSum)
+	fmt.Fprintf(&b, "nixfleet_apply_duration_seconds_count %d\n", m.applyDurationTotal)
+
+	return b.String()
+}
+
+func boolGauge(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func formatLe(seconds float64) string {
+	return fmt.Sprintf("%g", seconds)
+}
+
+// handleMetrics serves GET /metrics. Unlike every other endpoint it isn't
+// behind authMiddleware - a Prometheus scraper is rarely able to send a
+// bearer token, and metrics values aren't secrets - but if --metrics-token
+// is configured it's checked the same way an API token would be, in case an
+// operator wants the endpoint restricted anyway.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if token := s.metricsToken(); token != "" {
+		auth := r.Header.Get("Authorization")
+		if auth != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprint(w, s.metrics.Render())
+
+	fmt.Fprintf(w, "# HELP nixfleet_webhook_deliveries_total Outbound webhook delivery attempts by outcome.\n")
+	fmt.Fprintf(w, "# TYPE nixfleet_webhook_deliveries_total counter\n")
+	fmt.Fprintf(w, "nixfleet_webhook_deliveries_total{outcome=\"sent\"} %d\n", s.webhookSent.Load())
+	fmt.Fprintf(w, "nixfleet_webhook_deliveries_total{outcome=\"failed\"} %d\n", s.webhookFailed.Load())
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsRenderHostGauges(t *testing.T) {
+	m := NewMetrics()
+	m.SetDrift("web1", true, 3)
+	m.SetUpdates("web1", 5, 2)
+	m.SetRebootRequired("web1", true)
+	m.SetReachable("db1", false)
+
+	out := m.Render()
+
+	for _, want := range []string{
+		`nixfleet_host_reachable{host="web1"} 1`,
+		`nixfleet_host_reachable{host="db1"} 0`,
+		`nixfleet_host_drift_detected{host="web1"} 1`,
+		`nixfleet_host_drift_files{host="web1"} 3`,
+		`nixfleet_host_pending_updates{host="web1"} 5`,
+		`nixfleet_host_security_updates{host="web1"} 2`,
+		`nixfleet_host_reboot_required{host="web1"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Render() missing %q\ngot:\n%s", want, out)
+		}
+	}
+}
+
+func TestMetricsIncJobCounts(t *testing.T) {
+	m := NewMetrics()
+	m.IncJob("apply", "completed")
+	m.IncJob("apply", "completed")
+	m.IncJob("apply", "failed")
+
+	out := m.Render()
+
+	if !strings.Contains(out, `nixfleet_jobs_total{type="apply",status="completed"} 2`) {
+		t.Errorf("Render() missing completed count\ngot:\n%s", out)
+	}
+	if !strings.Contains(out, `nixfleet_jobs_total{type="apply",status="failed"} 1`) {
+		t.Errorf("Render() missing failed count\ngot:\n%s", out)
+	}
+}
+
+func TestMetricsObserveApplyDuration(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveApplyDuration(10 * time.Second)
+	m.ObserveApplyDuration(45 * time.Second)
+
+	out := m.Render()
+
+	if !strings.Contains(out, `nixfleet_apply_duration_seconds_bucket{le="15"} 1`) {
+		t.Errorf("Render() expected 1 sample in the 15s bucket\ngot:\n%s", out)
+	}
+	if !strings.Contains(out, `nixfleet_apply_duration_seconds_bucket{le="60"} 2`) {
+		t.Errorf("Render() expected 2 samples in the 60s bucket\ngot:\n%s", out)
+	}
+	if !strings.Contains(out, "nixfleet_apply_duration_seconds_count 2") {
+		t.Errorf("Render() expected count 2\ngot:\n%s", out)
+	}
+}
@@ -0,0 +1,346 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// notifyQueueSize bounds pending channel deliveries, mirroring
+// webhookQueueSize - a caller that fills this counts the drop as a failure
+// rather than blocking on a slow SMTP server or chat homeserver.
+const notifyQueueSize = 256
+
+// notifyChannelKind names a notification channel other than the generic
+// webhook.
+type notifyChannelKind string
+
+const (
+	notifyEmail  notifyChannelKind = "email"
+	notifySlack  notifyChannelKind = "slack"
+	notifyMatrix notifyChannelKind = "matrix"
+)
+
+// notifyDelivery is one queued email/Slack/Matrix delivery.
+type notifyDelivery struct {
+	kind  notifyChannelKind
+	event string
+	data  map[string]any
+}
+
+// notifyChannels queues event on every email/Slack/Matrix channel that's
+// configured and has event in its event list.
+func (s *Server) notifyChannels(event string, data map[string]any) {
+	cfg := s.notifyConfig()
+
+	if cfg.EmailSMTPHost != "" && len(cfg.EmailTo) > 0 && eventEnabled(cfg.EmailEvents, event) {
+		s.queueNotification(notifyEmail, event, data)
+	}
+	if cfg.SlackWebhookURL != "" && eventEnabled(cfg.SlackEvents, event) {
+		s.queueNotification(notifySlack, event, data)
+	}
+	if cfg.MatrixHomeserverURL != "" && eventEnabled(cfg.MatrixEvents, event) {
+		s.queueNotification(notifyMatrix, event, data)
+	}
+}
+
+func (s *Server) queueNotification(kind notifyChannelKind, event string, data map[string]any) {
+	select {
+	case s.notifyQueue <- notifyDelivery{kind: kind, event: event, data: data}:
+	default:
+		// Queue is full - count it as a failure rather than blocking the
+		// caller on a stuck SMTP server or chat homeserver.
+		s.notifyFailed.Add(1)
+		s.recordNotifyFailure(string(kind), event, "queue full")
+		log.Printf("Notification queue full, dropping %s %s event", kind, event)
+	}
+}
+
+// runNotifyQueue delivers queued email/Slack/Matrix events one at a time.
+// It's the only writer of notifySent/notifyFailed, mirroring
+// runWebhookQueue.
+func (s *Server) runNotifyQueue() {
+	for d := range s.notifyQueue {
+		if err := s.deliverNotification(d); err != nil {
+			s.notifyFailed.Add(1)
+			s.recordNotifyFailure(string(d.kind), d.event, err.Error())
+			log.Printf("Notification error (%s): %v", d.kind, err)
+		} else {
+			s.notifySent.Add(1)
+		}
+	}
+}
+
+func (s *Server) deliverNotification(d notifyDelivery) error {
+	cfg := s.notifyConfig()
+	switch d.kind {
+	case notifyEmail:
+		return sendEmailNotification(cfg, d.event, d.data)
+	case notifySlack:
+		return sendSlackNotification(cfg, d.event, d.data)
+	case notifyMatrix:
+		return sendMatrixNotification(cfg, d.event, d.data)
+	default:
+		return fmt.Errorf("unknown notification channel %q", d.kind)
+	}
+}
+
+// SendTestNotification sends a synthetic "test" event through channel
+// ("email", "slack", or "matrix") using cfg's settings, so
+// 'nixfleet server notify-test' can verify a config without waiting for
+// real drift. It delivers synchronously and bypasses the queue entirely - a
+// config smoke test should fail loud, not disappear into a background
+// retry.
+func SendTestNotification(cfg Config, channel string) error {
+	settings := newNotifySettings(cfg)
+	data := map[string]any{
+		"host":    "test-host",
+		"summary": "This is a test notification from 'nixfleet server notify-test'.",
+	}
+
+	switch channel {
+	case string(notifyEmail):
+		return sendEmailNotification(settings, "test", data)
+	case string(notifySlack):
+		return sendSlackNotification(settings, "test", data)
+	case string(notifyMatrix):
+		return sendMatrixNotification(settings, "test", data)
+	default:
+		return fmt.Errorf("unknown channel %q (want email, slack, or matrix)", channel)
+	}
+}
+
+// notifySummary reports the channel queue's depth and lifetime sent/failed
+// counts, the notify.go equivalent of webhookSummary.
+func (s *Server) notifySummary() map[string]any {
+	return map[string]any{
+		"queue_depth": len(s.notifyQueue),
+		"sent":        s.notifySent.Load(),
+		"failed":      s.notifyFailed.Load(),
+	}
+}
+
+// NotificationFailure is one failed webhook or channel delivery, kept for
+// GET /api/notifications/failed so an operator debugging "why didn't I get
+// paged" has the actual error instead of just a counter.
+type NotificationFailure struct {
+	Time    time.Time `json:"time"`
+	Channel string    `json:"channel"` // webhook, email, slack, matrix
+	Event   string    `json:"event"`
+	Error   string    `json:"error"`
+}
+
+// maxNotifyFailures bounds the in-memory failure log kept for
+// /api/notifications/failed - this is a live-debugging aid, not an audit
+// trail, so it isn't persisted to disk the way JobHistory is.
+const maxNotifyFailures = 100
+
+func (s *Server) recordNotifyFailure(channel, event, errMsg string) {
+	s.notifyFailuresMu.Lock()
+	defer s.notifyFailuresMu.Unlock()
+
+	s.notifyFailures = append(s.notifyFailures, NotificationFailure{
+		Time:    time.Now(),
+		Channel: channel,
+		Event:   event,
+		Error:   errMsg,
+	})
+	if len(s.notifyFailures) > maxNotifyFailures {
+		s.notifyFailures = s.notifyFailures[len(s.notifyFailures)-maxNotifyFailures:]
+	}
+}
+
+// NotificationFailures returns a snapshot of the recent failure log.
+func (s *Server) NotificationFailures() []NotificationFailure {
+	s.notifyFailuresMu.Lock()
+	defer s.notifyFailuresMu.Unlock()
+
+	out := make([]NotificationFailure, len(s.notifyFailures))
+	copy(out, s.notifyFailures)
+	return out
+}
+
+func (s *Server) handleNotificationsFailed(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, s.NotificationFailures(), http.StatusOK)
+}
+
+// notificationSummaryLine builds the one-line human summary used as the
+// email subject and the first line of the Slack/Matrix message.
+func notificationSummaryLine(event string, data map[string]any) string {
+	if host, ok := data["host"].(string); ok && host != "" {
+		return fmt.Sprintf("nixfleet: %s on %s", event, host)
+	}
+	return fmt.Sprintf("nixfleet: %s", event)
+}
+
+// notificationLink returns cfg.PublicURL's dashboard link, or "" if unset.
+func notificationLink(cfg notifySettings) string {
+	if cfg.PublicURL == "" {
+		return ""
+	}
+	return strings.TrimRight(cfg.PublicURL, "/") + "/"
+}
+
+// notificationBody renders event's payload into the plain-text message body
+// shared by every channel: the event name, the affected host, a summary
+// line pulled from the payload if the caller supplied one, and a link back
+// to the server's web UI.
+func notificationBody(event string, data map[string]any, link string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Event: %s\n", event)
+	if host, ok := data["host"].(string); ok && host != "" {
+		fmt.Fprintf(&b, "Host: %s\n", host)
+	}
+	if summary, ok := data["summary"].(string); ok && summary != "" {
+		fmt.Fprintf(&b, "Summary: %s\n", summary)
+	}
+	if link != "" {
+		fmt.Fprintf(&b, "Details: %s\n", link)
+	}
+	return b.String()
+}
+
+// sendEmailNotification sends event as a plain-text email to cfg.EmailTo.
+// smtp.SendMail negotiates STARTTLS itself when the server offers it;
+// EmailImplicitTLS instead dials straight into TLS for servers (port 465)
+// that never speak plaintext SMTP at all.
+func sendEmailNotification(cfg notifySettings, event string, data map[string]any) error {
+	if cfg.EmailSMTPHost == "" || len(cfg.EmailTo) == 0 {
+		return fmt.Errorf("email channel not configured")
+	}
+
+	subject := notificationSummaryLine(event, data)
+	body := notificationBody(event, data, notificationLink(cfg))
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s",
+		cfg.EmailFrom, strings.Join(cfg.EmailTo, ", "), subject, body)
+
+	addr := fmt.Sprintf("%s:%d", cfg.EmailSMTPHost, cfg.EmailSMTPPort)
+
+	var auth smtp.Auth
+	if cfg.EmailUsername != "" {
+		auth = smtp.PlainAuth("", cfg.EmailUsername, cfg.EmailPassword, cfg.EmailSMTPHost)
+	}
+
+	if cfg.EmailImplicitTLS {
+		return sendMailImplicitTLS(addr, cfg.EmailSMTPHost, auth, cfg.EmailFrom, cfg.EmailTo, []byte(msg))
+	}
+	return smtp.SendMail(addr, auth, cfg.EmailFrom, cfg.EmailTo, []byte(msg))
+}
+
+// sendMailImplicitTLS is smtp.SendMail for a server that expects the TLS
+// handshake before any SMTP command, rather than after a STARTTLS.
+func sendMailImplicitTLS(addr, host string, auth smtp.Auth, from string, to []string, msg []byte) error {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: host})
+	if err != nil {
+		return fmt.Errorf("dialing %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer c.Close()
+
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// notifyHTTPClient is shared by the Slack and Matrix senders below, mirroring
+// deliverWebhook's 10-second timeout.
+var notifyHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// sendSlackNotification posts event to a Slack (or any Slack-incoming-
+// webhook-compatible receiver, which covers Mattermost/Rocket.Chat too) as
+// a plain text message.
+func sendSlackNotification(cfg notifySettings, event string, data map[string]any) error {
+	if cfg.SlackWebhookURL == "" {
+		return fmt.Errorf("slack channel not configured")
+	}
+
+	text := notificationSummaryLine(event, data) + "\n" + notificationBody(event, data, notificationLink(cfg))
+	payload, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", cfg.SlackWebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := notifyHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendMatrixNotification posts event as an m.text message to a Matrix room
+// via the Client-Server API's send-message endpoint, using the wall-clock
+// time as the transaction ID - fine here since a duplicate send on retry is
+// harmless (an operator sees the same notification twice, not zero times).
+func sendMatrixNotification(cfg notifySettings, event string, data map[string]any) error {
+	if cfg.MatrixHomeserverURL == "" || cfg.MatrixRoomID == "" || cfg.MatrixAccessToken == "" {
+		return fmt.Errorf("matrix channel not configured")
+	}
+
+	text := notificationSummaryLine(event, data) + "\n" + notificationBody(event, data, notificationLink(cfg))
+	payload, err := json.Marshal(map[string]string{"msgtype": "m.text", "body": text})
+	if err != nil {
+		return err
+	}
+
+	sendURL := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%d",
+		strings.TrimRight(cfg.MatrixHomeserverURL, "/"), url.PathEscape(cfg.MatrixRoomID), time.Now().UnixNano())
+
+	req, err := http.NewRequest("PUT", sendURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+cfg.MatrixAccessToken)
+
+	resp, err := notifyHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("matrix send returned status %d", resp.StatusCode)
+	}
+	return nil
+}
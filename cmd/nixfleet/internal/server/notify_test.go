@@ -0,0 +1,103 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEventEnabled(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		event  string
+		want   bool
+	}{
+		{"event enabled", []string{"drift", "apply"}, "drift", true},
+		{"event not enabled", []string{"apply"}, "drift", false},
+		{"wildcard enabled", []string{"*"}, "drift", true},
+		{"empty events", []string{}, "drift", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := eventEnabled(tt.events, tt.event); got != tt.want {
+				t.Errorf("eventEnabled(%v, %q) = %v, want %v", tt.events, tt.event, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotificationSummaryLine(t *testing.T) {
+	withHost := notificationSummaryLine("drift", map[string]any{"host": "web-1"})
+	if withHost != "nixfleet: drift on web-1" {
+		t.Errorf("summary with host = %q", withHost)
+	}
+
+	withoutHost := notificationSummaryLine("drift", map[string]any{})
+	if withoutHost != "nixfleet: drift" {
+		t.Errorf("summary without host = %q", withoutHost)
+	}
+}
+
+func TestNotificationBody(t *testing.T) {
+	body := notificationBody("apply", map[string]any{
+		"host":    "web-1",
+		"summary": "2 packages upgraded",
+	}, "https://fleet.example.com/")
+
+	for _, want := range []string{"Event: apply", "Host: web-1", "Summary: 2 packages upgraded", "Details: https://fleet.example.com/"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body = %q, want it to contain %q", body, want)
+		}
+	}
+}
+
+func TestNotificationBodyOmitsUnsetFields(t *testing.T) {
+	body := notificationBody("drift", map[string]any{}, "")
+	if strings.Contains(body, "Host:") || strings.Contains(body, "Summary:") || strings.Contains(body, "Details:") {
+		t.Errorf("body = %q, want no Host/Summary/Details lines when unset", body)
+	}
+}
+
+func TestNotificationLink(t *testing.T) {
+	if got := notificationLink(notifySettings{PublicURL: "https://fleet.example.com"}); got != "https://fleet.example.com/" {
+		t.Errorf("notificationLink = %q", got)
+	}
+	if got := notificationLink(notifySettings{}); got != "" {
+		t.Errorf("notificationLink with no PublicURL = %q, want empty", got)
+	}
+}
+
+func TestRecordNotifyFailureTrims(t *testing.T) {
+	ts := newTestServer(t)
+
+	for i := 0; i < maxNotifyFailures+10; i++ {
+		ts.recordNotifyFailure("slack", "drift", "boom")
+	}
+
+	failures := ts.NotificationFailures()
+	if len(failures) != maxNotifyFailures {
+		t.Fatalf("len(failures) = %d, want %d", len(failures), maxNotifyFailures)
+	}
+	for _, f := range failures {
+		if f.Channel != "slack" || f.Event != "drift" || f.Error != "boom" {
+			t.Errorf("unexpected failure entry: %+v", f)
+		}
+	}
+}
+
+func TestSendTestNotificationUnknownChannel(t *testing.T) {
+	err := SendTestNotification(Config{}, "carrier-pigeon")
+	if err == nil {
+		t.Fatal("expected an error for an unknown channel")
+	}
+	if !strings.Contains(err.Error(), "carrier-pigeon") {
+		t.Errorf("error = %v, want it to name the bad channel", err)
+	}
+}
+
+func TestSendTestNotificationUnconfiguredChannel(t *testing.T) {
+	if err := SendTestNotification(Config{}, "slack"); err == nil {
+		t.Fatal("expected an error when the slack channel has no webhook URL configured")
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// HostOverride is an operator-set annotation on a host that changes how
+// apply treats it, for cases like pinning a vendor appliance to an older
+// commit while the rest of the fleet moves on. Frozen skips the host
+// entirely; FlakeRef, if set, builds it from that flake reference instead
+// of the server's configured working-tree flake.
+type HostOverride struct {
+	Frozen   bool      `json:"frozen,omitempty"`
+	FlakeRef string    `json:"flake_ref,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Expires  time.Time `json:"expires,omitempty"`
+	SetAt    time.Time `json:"set_at"`
+}
+
+// expired reports whether o should no longer be honored as of now.
+func (o HostOverride) expired(now time.Time) bool {
+	return !o.Expires.IsZero() && now.After(o.Expires)
+}
+
+// OverrideStore persists per-host overrides to <dataDir>/overrides.json,
+// pruning expired entries on read so they stop applying automatically.
+type OverrideStore struct {
+	dataDir string
+
+	mu        sync.RWMutex
+	overrides map[string]HostOverride
+}
+
+// NewOverrideStore creates a store rooted at dataDir and loads any
+// previously persisted overrides. A missing or unreadable file just starts
+// empty, matching Prober's tolerance for a fresh data dir.
+func NewOverrideStore(dataDir string) *OverrideStore {
+	s := &OverrideStore{dataDir: dataDir, overrides: make(map[string]HostOverride)}
+	s.load()
+	return s
+}
+
+func (s *OverrideStore) statePath() string {
+	return filepath.Join(s.dataDir, "overrides.json")
+}
+
+func (s *OverrideStore) load() {
+	data, err := os.ReadFile(s.statePath())
+	if err != nil {
+		return
+	}
+
+	var overrides map[string]HostOverride
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return
+	}
+
+	s.overrides = overrides
+}
+
+func (s *OverrideStore) save() error {
+	if err := os.MkdirAll(s.dataDir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s.overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.statePath(), data, 0644)
+}
+
+// Set stores an override for host, replacing any existing one.
+func (s *OverrideStore) Set(host string, o HostOverride) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o.SetAt = time.Now()
+	s.overrides[host] = o
+
+	return s.save()
+}
+
+// Clear removes any override for host.
+func (s *OverrideStore) Clear(host string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.overrides[host]; !ok {
+		return nil
+	}
+	delete(s.overrides, host)
+
+	return s.save()
+}
+
+// Get returns the active override for host, if any. An expired override is
+// pruned from the store and reported as absent.
+func (s *OverrideStore) Get(host string) (HostOverride, bool) {
+	s.mu.RLock()
+	o, ok := s.overrides[host]
+	s.mu.RUnlock()
+
+	if !ok {
+		return HostOverride{}, false
+	}
+
+	if o.expired(time.Now()) {
+		s.mu.Lock()
+		delete(s.overrides, host)
+		s.save()
+		s.mu.Unlock()
+		return HostOverride{}, false
+	}
+
+	return o, true
+}
+
+// Snapshot returns the current overrides in their persisted JSON encoding,
+// for 'server backup' - read under s.mu like every other access, so a
+// backup can never observe a save() that's still in progress.
+func (s *OverrideStore) Snapshot() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return json.MarshalIndent(s.overrides, "", "  ")
+}
@@ -0,0 +1,721 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+	"github.com/nixfleet/nixfleet/internal/logging"
+	"github.com/nixfleet/nixfleet/internal/nix"
+	"github.com/nixfleet/nixfleet/internal/probe"
+	"github.com/nixfleet/nixfleet/internal/ssh"
+)
+
+// defaultPreviewTTL and maxPreviewTTL bound how long a preview deployment
+// sits on a canary host before it's automatically reverted, when the
+// request doesn't specify one (or specifies one unreasonably long).
+const (
+	defaultPreviewTTL = 30 * time.Minute
+	maxPreviewTTL     = 6 * time.Hour
+)
+
+// PreviewSCMTarget identifies the commit/PR a preview should report back to.
+// Omitted entirely, a preview just deploys and records its own result
+// without any outbound SCM call.
+type PreviewSCMTarget struct {
+	Owner     string `json:"owner"`
+	Repo      string `json:"repo"`
+	CommitSHA string `json:"commit_sha,omitempty"`
+	PRNumber  int    `json:"pr_number,omitempty"`
+}
+
+// PreviewRequest is the POST /api/preview body.
+type PreviewRequest struct {
+	Ref  string            `json:"ref"`
+	Host string            `json:"host"`
+	TTL  string            `json:"ttl,omitempty"`
+	SCM  *PreviewSCMTarget `json:"scm,omitempty"`
+}
+
+// Preview is a PR-preview deployment to a single canary host: a closure
+// built from an isolated worktree checkout of Ref, deployed in place of the
+// host's current generation, with a TTL after which it's automatically
+// reverted unless replaced first by a newer preview for the same host.
+type Preview struct {
+	ID     string `json:"id"`
+	Host   string `json:"host"`
+	Ref    string `json:"ref"`
+	Commit string `json:"commit,omitempty"`
+
+	// Status: pending, building, deploying, healthy, unhealthy, failed,
+	// reverted, replaced, expired.
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	StorePath     string           `json:"store_path,omitempty"`
+	PrevStorePath string           `json:"prev_store_path,omitempty"`
+	PrevGen       int              `json:"prev_generation,omitempty"`
+	ClosureDiff   *nix.ClosureDiff `json:"closure_diff,omitempty"`
+	Health        *probe.Results   `json:"health,omitempty"`
+
+	SCM *PreviewSCMTarget `json:"scm,omitempty"`
+
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+	RevertedAt time.Time `json:"reverted_at,omitempty"`
+
+	// worktreeDir is the isolated git worktree this preview was built from,
+	// cleaned up once the preview is reverted or replaced. Unexported: it's
+	// server-local filesystem state, not part of the API response.
+	worktreeDir string
+}
+
+// PreviewStore tracks in-flight and recently-finished previews, persisted to
+// <dataDir>/previews.json so GET /api/preview survives a restart - though,
+// like DrainStore's in-flight apply-all tracking, a TTL revert scheduled
+// in-process doesn't: New() re-arms or immediately reverts any preview still
+// active when the server starts back up (see reviveExpiredPreviews).
+type PreviewStore struct {
+	dataDir string
+
+	mu     sync.Mutex
+	byID   map[string]*Preview
+	byHost map[string]string // host -> active preview ID
+	timers map[string]*time.Timer
+}
+
+// NewPreviewStore creates a store rooted at dataDir and loads any previously
+// persisted previews. A missing or unreadable file just starts empty,
+// matching OverrideStore's tolerance for a fresh data dir.
+func NewPreviewStore(dataDir string) *PreviewStore {
+	s := &PreviewStore{
+		dataDir: dataDir,
+		byID:    make(map[string]*Preview),
+		byHost:  make(map[string]string),
+		timers:  make(map[string]*time.Timer),
+	}
+	s.load()
+	return s
+}
+
+func (s *PreviewStore) statePath() string {
+	return filepath.Join(s.dataDir, "previews.json")
+}
+
+func (s *PreviewStore) load() {
+	data, err := os.ReadFile(s.statePath())
+	if err != nil {
+		return
+	}
+
+	var previews []*Preview
+	if err := json.Unmarshal(data, &previews); err != nil {
+		return
+	}
+
+	for _, p := range previews {
+		s.byID[p.ID] = p
+		if isActivePreviewStatus(p.Status) {
+			s.byHost[p.Host] = p.ID
+		}
+	}
+}
+
+// isActivePreviewStatus reports whether status is one a preview is still
+// live on its host in, as opposed to a terminal outcome.
+func isActivePreviewStatus(status string) bool {
+	switch status {
+	case "pending", "building", "deploying", "healthy", "unhealthy":
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *PreviewStore) save() error {
+	if err := os.MkdirAll(s.dataDir, 0755); err != nil {
+		return err
+	}
+
+	out := make([]*Preview, 0, len(s.byID))
+	for _, p := range s.byID {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.statePath(), data, 0644)
+}
+
+// Create records a new preview and marks it the active one for its host,
+// returning the previously active preview for that host (if any), which the
+// caller must revert and replace with "replaced" status.
+func (s *PreviewStore) Create(p *Preview) (previous *Preview) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if prevID, ok := s.byHost[p.Host]; ok {
+		previous = s.byID[prevID]
+	}
+
+	s.byID[p.ID] = p
+	s.byHost[p.Host] = p.ID
+	s.save()
+
+	return previous
+}
+
+// Update applies fn to the preview identified by id under the store's lock,
+// persisting the result. Used instead of exposing the map directly so every
+// mutation is saved.
+func (s *PreviewStore) Update(id string, fn func(*Preview)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.byID[id]
+	if !ok {
+		return
+	}
+	fn(p)
+	if !isActivePreviewStatus(p.Status) {
+		if s.byHost[p.Host] == id {
+			delete(s.byHost, p.Host)
+		}
+	}
+	s.save()
+}
+
+// Get returns the preview with the given ID, if any.
+func (s *PreviewStore) Get(id string) (*Preview, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.byID[id]
+	return p, ok
+}
+
+// List returns every stored preview, newest first.
+func (s *PreviewStore) List() []*Preview {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]*Preview, 0, len(s.byID))
+	for _, p := range s.byID {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+
+	return out
+}
+
+// SetTimer registers the TTL-revert timer for a preview, canceling any
+// timer already registered for that ID first.
+func (s *PreviewStore) SetTimer(id string, t *time.Timer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.timers[id]; ok {
+		existing.Stop()
+	}
+	s.timers[id] = t
+}
+
+// CancelTimer stops and forgets the TTL-revert timer for a preview, if one
+// is registered - called when a preview is reverted early (replaced, or via
+// DELETE /api/preview/{id}) so its TTL doesn't also fire.
+func (s *PreviewStore) CancelTimer(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.timers[id]; ok {
+		t.Stop()
+		delete(s.timers, id)
+	}
+}
+
+// Snapshot returns the current previews in their persisted JSON encoding,
+// for 'server backup'. See OverrideStore.Snapshot.
+func (s *PreviewStore) Snapshot() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]*Preview, 0, len(s.byID))
+	for _, p := range s.byID {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+
+	return json.MarshalIndent(out, "", "  ")
+}
+
+// reviveExpiredPreviews is called once from New(): any preview that was
+// still active when the server last stopped either gets its TTL timer
+// re-armed (if ExpiresAt is still in the future) or is reverted immediately
+// (if it already expired while the server was down), so a crash or restart
+// never leaves a canary stuck on a stale preview closure indefinitely.
+func (s *Server) reviveExpiredPreviews() {
+	for _, p := range s.previews.List() {
+		if !isActivePreviewStatus(p.Status) {
+			continue
+		}
+		if p.ExpiresAt.IsZero() {
+			continue
+		}
+
+		remaining := time.Until(p.ExpiresAt)
+		id := p.ID
+		if remaining <= 0 {
+			go s.revertPreview(context.Background(), id, "expired")
+			continue
+		}
+		s.previews.SetTimer(id, time.AfterFunc(remaining, func() {
+			s.revertPreview(context.Background(), id, "expired")
+		}))
+	}
+}
+
+// handlePreviewCreate serves POST /api/preview: fetch ref into an isolated
+// worktree, build the target host's closure from it, deploy it to the
+// canary host (refusing a frozen/maintenance host the same way a regular
+// apply would), and run the host's health probes. Any preview already
+// active on that host is reverted and marked "replaced" first.
+func (s *Server) handlePreviewCreate(w http.ResponseWriter, r *http.Request) {
+	var req PreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.jsonError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Ref == "" || req.Host == "" {
+		s.jsonError(w, "ref and host are required", http.StatusBadRequest)
+		return
+	}
+
+	host, ok := s.inventory.GetHost(req.Host)
+	if !ok {
+		s.jsonError(w, "host not found", http.StatusNotFound)
+		return
+	}
+
+	if override, ok := s.overrides.Get(host.Name); ok && override.Frozen {
+		s.jsonError(w, fmt.Sprintf("host %s is frozen (%s)", host.Name, override.Reason), http.StatusConflict)
+		return
+	}
+
+	ttl := s.config.PreviewDefaultTTL
+	if ttl <= 0 {
+		ttl = defaultPreviewTTL
+	}
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			s.jsonError(w, "invalid ttl: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		ttl = parsed
+	}
+	maxTTL := s.config.PreviewMaxTTL
+	if maxTTL <= 0 {
+		maxTTL = maxPreviewTTL
+	}
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	preview := &Preview{
+		ID:        fmt.Sprintf("preview-%d", time.Now().UnixNano()),
+		Host:      host.Name,
+		Ref:       req.Ref,
+		Status:    "pending",
+		SCM:       req.SCM,
+		CreatedAt: time.Now(),
+	}
+
+	replaced := s.previews.Create(preview)
+	if replaced != nil {
+		s.previews.CancelTimer(replaced.ID)
+		go s.revertPreview(context.Background(), replaced.ID, "replaced")
+	}
+
+	go func() {
+		ctx := logging.WithHost(logging.WithJobID(logging.ContextWithLogger(context.Background(), s.logger), preview.ID), host.Name)
+		s.runPreviewJob(ctx, preview, host, ttl)
+	}()
+
+	s.jsonResponse(w, preview, http.StatusAccepted)
+}
+
+// handlePreviewList serves GET /api/preview.
+func (s *Server) handlePreviewList(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, s.previews.List(), http.StatusOK)
+}
+
+// handlePreviewGet serves GET /api/preview/{id}.
+func (s *Server) handlePreviewGet(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	preview, ok := s.previews.Get(id)
+	if !ok {
+		s.jsonError(w, "preview not found", http.StatusNotFound)
+		return
+	}
+	s.jsonResponse(w, preview, http.StatusOK)
+}
+
+// handlePreviewDelete serves DELETE /api/preview/{id}, reverting an active
+// preview before its TTL expires.
+func (s *Server) handlePreviewDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	preview, ok := s.previews.Get(id)
+	if !ok {
+		s.jsonError(w, "preview not found", http.StatusNotFound)
+		return
+	}
+	if !isActivePreviewStatus(preview.Status) {
+		s.jsonResponse(w, preview, http.StatusOK)
+		return
+	}
+
+	s.previews.CancelTimer(id)
+	go s.revertPreview(r.Context(), id, "reverted")
+
+	s.jsonResponse(w, map[string]string{"status": "reverting"}, http.StatusAccepted)
+}
+
+// runPreviewJob drives a single preview through worktree checkout, build,
+// deploy, and health check, updating the store as it goes. It mirrors
+// runApplyJob's build/copy/activate sequence, but against an isolated
+// worktree build and with a TTL-revert timer armed on success instead of
+// recording the deploy as the host's new steady state.
+func (s *Server) runPreviewJob(ctx context.Context, preview *Preview, host *inventory.Host, ttl time.Duration) {
+	logger := logging.FromContext(ctx)
+
+	worktreeDir := filepath.Join(s.previewWorkDir(), preview.ID)
+	commit, err := gitWorktreeAdd(ctx, s.evaluator.FlakePath(), preview.Ref, worktreeDir)
+	if err != nil {
+		s.failPreview(ctx, preview, "checkout failed: "+err.Error())
+		return
+	}
+	preview.Commit = commit
+	s.previews.Update(preview.ID, func(p *Preview) { p.Commit = commit; p.worktreeDir = worktreeDir })
+	s.postSCMStatus(ctx, preview, "pending", "Building preview...")
+
+	s.previews.Update(preview.ID, func(p *Preview) { p.Status = "building" })
+
+	closure, err := s.evaluator.BuildHostFromFlake(ctx, worktreeDir, host.Name, host.Base)
+	if err != nil {
+		s.failPreview(ctx, preview, "build failed: "+err.Error())
+		return
+	}
+
+	client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+	if err != nil {
+		s.failPreview(ctx, preview, "connection failed: "+err.Error())
+		return
+	}
+
+	prevGen, prevStorePath, _ := s.deployer.GetCurrentGeneration(ctx, client, host.Base)
+	closureDiff, err := s.evaluator.DiffClosures(ctx, prevStorePath, closure.StorePath)
+	if err != nil {
+		logger.Warn("preview: closure diff failed", "error", err)
+	}
+
+	s.previews.Update(preview.ID, func(p *Preview) {
+		p.Status = "deploying"
+		p.StorePath = closure.StorePath
+		p.PrevStorePath = prevStorePath
+		p.PrevGen = prevGen
+		p.ClosureDiff = closureDiff
+	})
+
+	if err := s.deployer.CopyToHost(ctx, closure, host); err != nil {
+		s.failPreview(ctx, preview, "copy failed: "+err.Error())
+		return
+	}
+
+	switch host.Base {
+	case "ubuntu":
+		err = s.deployer.ActivateUbuntu(ctx, client, closure)
+	case "nixos":
+		err = s.deployer.ActivateNixOS(ctx, client, closure, "switch")
+	default:
+		err = fmt.Errorf("preview deploy unsupported for base %q", host.Base)
+	}
+	if err != nil {
+		s.failPreview(ctx, preview, "activation failed: "+err.Error())
+		return
+	}
+
+	gen, _, _ := s.deployer.GetCurrentGeneration(ctx, client, host.Base)
+	s.stateMgr.UpdateAfterApply(ctx, client, closure.StorePath, closure.ManifestHash, gen, 0)
+
+	health := s.probe.Run(ctx, sshExecForPreview(client), host.Addr, s.inventory.ProbesForHost(host))
+
+	expiresAt := time.Now().Add(ttl)
+	status := "healthy"
+	if !health.Passed {
+		status = "unhealthy"
+	}
+	s.previews.Update(preview.ID, func(p *Preview) {
+		p.Status = status
+		p.Health = health
+		p.ExpiresAt = expiresAt
+	})
+	s.previews.SetTimer(preview.ID, time.AfterFunc(ttl, func() {
+		s.revertPreview(context.Background(), preview.ID, "expired")
+	}))
+
+	desc := fmt.Sprintf("Deployed to %s, health checks %s. Expires %s.", host.Name, health.Summary(), expiresAt.Format(time.RFC3339))
+	if !health.Passed {
+		s.postSCMStatus(ctx, preview, "failure", desc)
+	} else {
+		s.postSCMStatus(ctx, preview, "success", desc)
+	}
+
+	logger.Info("preview: deployed", "store_path", closure.StorePath, "status", status)
+}
+
+// failPreview records a terminal failure and reports it to the SCM, if
+// configured, cleaning up the worktree since there's nothing left to revert.
+func (s *Server) failPreview(ctx context.Context, preview *Preview, errStr string) {
+	logging.FromContext(ctx).Warn("preview: failed", "error", errStr)
+	s.previews.Update(preview.ID, func(p *Preview) { p.Status = "failed"; p.Error = errStr })
+	s.postSCMStatus(ctx, preview, "error", "Preview failed: "+errStr)
+	s.cleanupPreviewWorktree(preview.ID)
+}
+
+// revertPreview rolls the preview's host back to the generation it recorded
+// before deploying, then marks the preview with finalStatus ("replaced",
+// "expired", or "reverted") and cleans up its worktree. Safe to call more
+// than once for the same ID; only the first call still in an active state
+// does anything.
+func (s *Server) revertPreview(ctx context.Context, id, finalStatus string) {
+	preview, ok := s.previews.Get(id)
+	if !ok || !isActivePreviewStatus(preview.Status) {
+		return
+	}
+
+	host, ok := s.inventory.GetHost(preview.Host)
+	if ok && preview.StorePath != "" {
+		if client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser); err == nil {
+			if err := s.deployer.Rollback(ctx, client, host.Base, preview.PrevGen); err != nil {
+				logging.FromContext(ctx).Warn("preview: revert failed", "preview", id, "error", err)
+			} else if preview.PrevStorePath != "" {
+				gen, _, _ := s.deployer.GetCurrentGeneration(ctx, client, host.Base)
+				s.stateMgr.UpdateAfterApply(ctx, client, preview.PrevStorePath, "", gen, 0)
+			}
+		}
+	}
+
+	s.previews.Update(id, func(p *Preview) {
+		p.Status = finalStatus
+		p.RevertedAt = time.Now()
+	})
+	s.postSCMStatus(ctx, preview, "success", "Preview "+finalStatus+", canary reverted to its previous generation.")
+	s.cleanupPreviewWorktree(id)
+}
+
+// cleanupPreviewWorktree removes the isolated worktree a preview built from,
+// so completed/reverted PR builds don't accumulate on the server's disk.
+func (s *Server) cleanupPreviewWorktree(id string) {
+	preview, ok := s.previews.Get(id)
+	if !ok || preview.worktreeDir == "" {
+		return
+	}
+	if err := gitWorktreeRemove(context.Background(), s.evaluator.FlakePath(), preview.worktreeDir); err != nil {
+		logging.FromContext(context.Background()).Warn("preview: worktree cleanup failed", "preview", id, "error", err)
+	}
+}
+
+// previewWorkDir is where isolated preview worktrees are checked out,
+// beneath the server's data directory.
+func (s *Server) previewWorkDir() string {
+	return filepath.Join(s.dataDir(), "previews")
+}
+
+// gitWorktreeAdd fetches ref into repoDir's git history and checks it out,
+// detached, into a fresh worktree at targetDir, returning the resolved
+// commit SHA. ref may be a branch, tag, or commit already reachable from
+// origin.
+func gitWorktreeAdd(ctx context.Context, repoDir, ref, targetDir string) (string, error) {
+	if _, err := runGit(ctx, repoDir, "fetch", "origin", ref); err != nil {
+		return "", fmt.Errorf("fetching %s: %w", ref, err)
+	}
+	if _, err := runGit(ctx, repoDir, "worktree", "add", "--detach", targetDir, "FETCH_HEAD"); err != nil {
+		return "", fmt.Errorf("adding worktree: %w", err)
+	}
+
+	sha, err := runGit(ctx, targetDir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("resolving commit: %w", err)
+	}
+
+	return strings.TrimSpace(sha), nil
+}
+
+// gitWorktreeRemove removes a worktree added by gitWorktreeAdd and prunes
+// its metadata, falling back to a plain directory removal if git itself
+// can't (e.g. the worktree already has uncommitted build byproducts it
+// considers dirty).
+func gitWorktreeRemove(ctx context.Context, repoDir, targetDir string) error {
+	if _, err := runGit(ctx, repoDir, "worktree", "remove", "--force", targetDir); err != nil {
+		os.RemoveAll(targetDir)
+	}
+	runGit(ctx, repoDir, "worktree", "prune")
+	return nil
+}
+
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
+// sshExecForPreview adapts an ssh.Client into a probe.Exec, mirroring
+// internal/apply's unexported sshExec so the probe engine never needs to
+// import internal/ssh directly.
+func sshExecForPreview(client *ssh.Client) probe.Exec {
+	return func(ctx context.Context, cmd string) (*probe.ExecResult, error) {
+		result, err := client.Exec(ctx, cmd)
+		if err != nil {
+			return nil, err
+		}
+		return &probe.ExecResult{Stdout: result.Stdout, Stderr: result.Stderr, ExitCode: result.ExitCode}, nil
+	}
+}
+
+// postSCMStatus posts a commit status (and, if the request named a PR, a
+// summary comment) to the configured GitHub or Gitea instance. It's a
+// best-effort notification - failures are logged, never surfaced to the
+// preview's own result - and a no-op whenever the server has no SCM token
+// configured or the request didn't include SCM target info.
+func (s *Server) postSCMStatus(ctx context.Context, preview *Preview, state, description string) {
+	if s.config.PreviewSCMToken == "" || preview.SCM == nil || preview.SCM.Owner == "" || preview.SCM.Repo == "" {
+		return
+	}
+	sha := preview.SCM.CommitSHA
+	if sha == "" {
+		sha = preview.Commit
+	}
+	if sha == "" {
+		return
+	}
+
+	targetURL := s.config.PublicURL
+	if targetURL != "" {
+		targetURL = strings.TrimRight(targetURL, "/") + "/previews/" + preview.ID
+	}
+
+	logger := logging.FromContext(ctx)
+	if err := scmPostStatus(s.config.PreviewSCMProvider, s.config.PreviewSCMBaseURL, s.config.PreviewSCMToken, *preview.SCM, sha, state, description, targetURL); err != nil {
+		logger.Warn("preview: SCM status post failed", "preview", preview.ID, "error", err)
+	}
+
+	if preview.SCM.PRNumber > 0 {
+		body := fmt.Sprintf("**nixfleet preview** (`%s`): %s\n\n%s", preview.ID, state, description)
+		if targetURL != "" {
+			body += fmt.Sprintf("\n\n[job details](%s)", targetURL)
+		}
+		if err := scmPostComment(s.config.PreviewSCMProvider, s.config.PreviewSCMBaseURL, s.config.PreviewSCMToken, *preview.SCM, body); err != nil {
+			logger.Warn("preview: SCM comment post failed", "preview", preview.ID, "error", err)
+		}
+	}
+}
+
+// scmPostStatus posts a commit status to GitHub or Gitea. Both expose the
+// same "statuses" shape; only the base URL and auth scheme differ.
+func scmPostStatus(provider, baseURL, token string, target PreviewSCMTarget, sha, state, description, targetURL string) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/statuses/%s", scmAPIBase(provider, baseURL), target.Owner, target.Repo, sha)
+	body := map[string]string{
+		"state":       state,
+		"description": truncateSCMDescription(description),
+		"context":     "nixfleet/preview",
+	}
+	if targetURL != "" {
+		body["target_url"] = targetURL
+	}
+	return scmPost(provider, token, url, body)
+}
+
+// scmPostComment posts a summary comment on the PR, using the issue-comment
+// endpoint both GitHub and Gitea share.
+func scmPostComment(provider, baseURL, token string, target PreviewSCMTarget, body string) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/issues/%d/comments", scmAPIBase(provider, baseURL), target.Owner, target.Repo, target.PRNumber)
+	return scmPost(provider, token, url, map[string]string{"body": body})
+}
+
+func scmAPIBase(provider, baseURL string) string {
+	if baseURL != "" {
+		return strings.TrimRight(baseURL, "/")
+	}
+	if provider == "gitea" {
+		return "" // a Gitea target without an explicit base URL has nowhere to post to
+	}
+	return "https://api.github.com"
+}
+
+func scmPost(provider, token, url string, body map[string]string) error {
+	if url == "" || strings.HasPrefix(url, "/repos") {
+		return fmt.Errorf("no SCM base URL configured for provider %q", provider)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if provider == "gitea" {
+		req.Header.Set("Authorization", "token "+token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/vnd.github+json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("SCM API returned %s", resp.Status)
+	}
+	return nil
+}
+
+// truncateSCMDescription keeps a status description within GitHub's 140
+// character limit for the field (Gitea is more lenient, but there's no harm
+// applying the tighter limit to both).
+func truncateSCMDescription(s string) string {
+	const max = 140
+	if len(s) <= max {
+		return s
+	}
+	return s[:max-1] + "…"
+}
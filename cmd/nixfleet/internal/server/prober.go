@@ -0,0 +1,288 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// availabilityWindow is how far back per-host samples are kept for the
+// rolling availability percentage.
+const availabilityWindow = 24 * time.Hour
+
+// downThreshold is how many consecutive probe failures are required before
+// a host-down webhook fires, so a single missed probe doesn't page anyone.
+const downThreshold = 3
+
+// probeTimeout bounds each individual connectivity check.
+const probeTimeout = 5 * time.Second
+
+// probeSample is one point-in-time connectivity result, kept only long
+// enough to compute the rolling availability percentage.
+type probeSample struct {
+	Time   time.Time `json:"time"`
+	Online bool      `json:"online"`
+}
+
+// hostAvailability tracks a single host's connectivity history.
+type hostAvailability struct {
+	Online              bool          `json:"online"`
+	Since               time.Time     `json:"since"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	LastCheck           time.Time     `json:"last_check"`
+	Samples             []probeSample `json:"samples,omitempty"`
+}
+
+// availability24h returns the fraction of samples in the last 24h where the
+// host was online, as a percentage. Returns 100 if there's no data yet.
+func (h *hostAvailability) availability24h() float64 {
+	if len(h.Samples) == 0 {
+		return 100
+	}
+	online := 0
+	for _, s := range h.Samples {
+		if s.Online {
+			online++
+		}
+	}
+	return 100 * float64(online) / float64(len(h.Samples))
+}
+
+// prune drops samples older than availabilityWindow.
+func (h *hostAvailability) prune(now time.Time) {
+	cutoff := now.Add(-availabilityWindow)
+	i := 0
+	for i < len(h.Samples) && h.Samples[i].Time.Before(cutoff) {
+		i++
+	}
+	h.Samples = h.Samples[i:]
+}
+
+// Prober runs a lightweight background connectivity check against every
+// host on a fixed interval, tracking availability and firing debounced
+// host-up/host-down webhooks. It's cheaper than the drift/update/health
+// schedulers because it never authenticates - just a TCP dial and (for SSH
+// hosts) a banner read - so it's safe to run frequently.
+type Prober struct {
+	server   *Server
+	interval time.Duration
+	dataDir  string
+
+	mu    sync.RWMutex
+	state map[string]*hostAvailability
+
+	stop chan struct{}
+}
+
+// NewProber creates a prober that persists state under dataDir.
+func NewProber(server *Server, interval time.Duration, dataDir string) *Prober {
+	p := &Prober{
+		server:   server,
+		interval: interval,
+		dataDir:  dataDir,
+		state:    make(map[string]*hostAvailability),
+		stop:     make(chan struct{}),
+	}
+	p.load()
+	return p
+}
+
+func (p *Prober) statePath() string {
+	return filepath.Join(p.dataDir, "prober-state.json")
+}
+
+func (p *Prober) load() {
+	data, err := os.ReadFile(p.statePath())
+	if err != nil {
+		return
+	}
+	var state map[string]*hostAvailability
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("Prober: failed to load state: %v", err)
+		return
+	}
+	p.mu.Lock()
+	p.state = state
+	p.mu.Unlock()
+}
+
+func (p *Prober) save() {
+	p.mu.RLock()
+	data, err := json.MarshalIndent(p.state, "", "  ")
+	p.mu.RUnlock()
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(p.dataDir, 0755); err != nil {
+		log.Printf("Prober: failed to create data dir: %v", err)
+		return
+	}
+	if err := os.WriteFile(p.statePath(), data, 0644); err != nil {
+		log.Printf("Prober: failed to save state: %v", err)
+	}
+}
+
+// Start begins probing on the configured interval, until ctx is cancelled or
+// Stop is called.
+func (p *Prober) Start(ctx context.Context) {
+	go p.run(ctx)
+}
+
+// Stop halts the prober.
+func (p *Prober) Stop() {
+	close(p.stop)
+}
+
+func (p *Prober) run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	log.Printf("Prober: connectivity probing enabled (every %s)", p.interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.probeAll(ctx)
+		}
+	}
+}
+
+// probeAll checks every host, staggered with random jitter so a fleet of
+// hosts isn't dialed in a synchronized burst every interval.
+func (p *Prober) probeAll(ctx context.Context) {
+	hosts := p.server.inventory.AllHosts()
+
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(name, addr string, port int) {
+			defer wg.Done()
+			jitter := time.Duration(rand.Int63n(int64(p.interval / 4)))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(jitter):
+			}
+			p.probeHost(name, addr, port)
+		}(host.Name, host.Addr, host.SSHPort)
+	}
+	wg.Wait()
+
+	p.save()
+}
+
+// probeHost performs a single connectivity check and updates state.
+func (p *Prober) probeHost(name, addr string, port int) {
+	online := tcpProbe(addr, port, probeTimeout)
+	now := time.Now()
+
+	p.mu.Lock()
+	avail, exists := p.state[name]
+	if !exists {
+		avail = &hostAvailability{Online: online, Since: now}
+		p.state[name] = avail
+	}
+
+	wasOnline := avail.Online
+	avail.LastCheck = now
+	avail.Samples = append(avail.Samples, probeSample{Time: now, Online: online})
+	avail.prune(now)
+
+	if online {
+		avail.ConsecutiveFailures = 0
+		if !wasOnline {
+			avail.Online = true
+			avail.Since = now
+		}
+	} else {
+		avail.ConsecutiveFailures++
+	}
+
+	fireDown := !online && wasOnline && avail.ConsecutiveFailures >= downThreshold
+	if fireDown {
+		avail.Online = false
+		avail.Since = now
+	}
+	fireUp := online && !wasOnline
+	failures := avail.ConsecutiveFailures
+	p.mu.Unlock()
+
+	if fireDown {
+		log.Printf("Prober: %s is down (%d consecutive failures)", name, failures)
+		p.server.dispatchEvent("host-down", map[string]any{"host": name})
+	}
+	if fireUp {
+		log.Printf("Prober: %s is back up", name)
+		p.server.dispatchEvent("host-up", map[string]any{"host": name})
+	}
+}
+
+// Get returns the tracked availability for a host, if any.
+func (p *Prober) Get(name string) (online bool, since time.Time, availability24h float64, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	avail, exists := p.state[name]
+	if !exists {
+		return false, time.Time{}, 0, false
+	}
+	return avail.Online, avail.Since, avail.availability24h(), true
+}
+
+// IsDown reports whether a host is currently tracked as down, so expensive
+// per-host work (drift checks, update checks) can skip it instead of
+// waiting out an SSH timeout.
+func (p *Prober) IsDown(name string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	avail, exists := p.state[name]
+	if !exists {
+		return false
+	}
+	return !avail.Online && avail.ConsecutiveFailures >= downThreshold
+}
+
+// Snapshot returns the current availability state in its persisted JSON
+// encoding, for 'server backup'. See OverrideStore.Snapshot.
+func (p *Prober) Snapshot() ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return json.MarshalIndent(p.state, "", "  ")
+}
+
+// tcpProbe dials the host's SSH port and reads its version banner. This
+// avoids the cost of a full SSH handshake/auth just to check reachability.
+func tcpProbe(addr string, port int, timeout time.Duration) bool {
+	if port == 0 {
+		port = 22
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(addr, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(string(buf[:n]), "SSH-")
+}
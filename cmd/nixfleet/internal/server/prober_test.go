@@ -0,0 +1,70 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHostAvailability24h(t *testing.T) {
+	avail := &hostAvailability{}
+	if got := avail.availability24h(); got != 100 {
+		t.Errorf("Expected 100 with no samples, got %v", got)
+	}
+
+	now := time.Now()
+	avail.Samples = []probeSample{
+		{Time: now, Online: true},
+		{Time: now, Online: true},
+		{Time: now, Online: false},
+		{Time: now, Online: true},
+	}
+	if got := avail.availability24h(); got != 75 {
+		t.Errorf("Expected 75, got %v", got)
+	}
+}
+
+func TestHostAvailabilityPrune(t *testing.T) {
+	now := time.Now()
+	avail := &hostAvailability{
+		Samples: []probeSample{
+			{Time: now.Add(-25 * time.Hour), Online: false},
+			{Time: now.Add(-1 * time.Hour), Online: true},
+		},
+	}
+
+	avail.prune(now)
+
+	if len(avail.Samples) != 1 {
+		t.Fatalf("Expected 1 sample after pruning, got %d", len(avail.Samples))
+	}
+	if !avail.Samples[0].Online {
+		t.Error("Expected the remaining sample to be the recent online one")
+	}
+}
+
+func TestProberIsDown(t *testing.T) {
+	p := &Prober{state: map[string]*hostAvailability{
+		"flapping": {Online: false, ConsecutiveFailures: downThreshold},
+		"blip":     {Online: false, ConsecutiveFailures: downThreshold - 1},
+		"healthy":  {Online: true},
+	}}
+
+	if !p.IsDown("flapping") {
+		t.Error("Expected 'flapping' to be marked down")
+	}
+	if p.IsDown("blip") {
+		t.Error("Did not expect 'blip' to be marked down yet (below threshold)")
+	}
+	if p.IsDown("healthy") {
+		t.Error("Did not expect 'healthy' to be marked down")
+	}
+	if p.IsDown("unknown") {
+		t.Error("Did not expect an unknown host to be marked down")
+	}
+}
+
+func TestTCPProbeUnreachable(t *testing.T) {
+	if tcpProbe("127.0.0.1", 1, 200*time.Millisecond) {
+		t.Error("Expected probe against an unreachable port to fail")
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReloadConfigWithoutConfigPathFails(t *testing.T) {
+	ts := newTestServer(t)
+
+	if _, err := ts.ReloadConfig(); err == nil {
+		t.Fatal("expected an error when the server has no --config file")
+	}
+}
+
+func TestReloadConfigAppliesWebhooksAndToken(t *testing.T) {
+	ts := newTestServer(t)
+	ts.config.ConfigPath = writeTempConfig(t, `
+api_token: new-token
+webhook_url: https://hooks.example.com/reloaded
+webhook_events: [drift]
+`)
+
+	result, err := ts.ReloadConfig()
+	if err != nil {
+		t.Fatalf("ReloadConfig: %v", err)
+	}
+
+	if ts.apiToken() != "new-token" {
+		t.Errorf("APIToken = %q, want new-token", ts.apiToken())
+	}
+	if ts.webhookConfig().URL != "https://hooks.example.com/reloaded" {
+		t.Errorf("WebhookURL = %q, want reloaded URL", ts.webhookConfig().URL)
+	}
+
+	if !contains(result.Applied, "api_token") || !contains(result.Applied, "webhooks") {
+		t.Errorf("Applied = %v, want it to include api_token and webhooks", result.Applied)
+	}
+
+	sawRateLimits := false
+	for _, u := range result.Unsupported {
+		if strings.Contains(u, "rate limit") {
+			sawRateLimits = true
+		}
+	}
+	if !sawRateLimits {
+		t.Errorf("Unsupported = %v, want it to call out rate limiting as unimplemented", result.Unsupported)
+	}
+}
+
+func contains(list []string, want string) bool {
+	for _, v := range list {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
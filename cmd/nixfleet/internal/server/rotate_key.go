@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+	nfssh "github.com/nixfleet/nixfleet/internal/ssh"
+)
+
+// credentialAuditFile is the JSONL audit log rotate-key appends to under
+// a server's data dir, next to its other data-dir-scoped stores
+// (overrides.json, approvals.json, ...).
+const credentialAuditFile = "credential-rotations.jsonl"
+
+// CredentialAuditEntry records one step of a rotate-key run. A rotation
+// that fails partway still leaves a full trail of what was attempted and
+// why it stopped, since the whole point of scoped keys is to be able to
+// answer "what could this host's key have done, and when did it change".
+type CredentialAuditEntry struct {
+	Time   time.Time `json:"time"`
+	Host   string    `json:"host"`
+	Step   string    `json:"step"` // install-new-key, verify-new-key, remove-old-key
+	Result string    `json:"result"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// CredentialAuditLogger appends rotate-key steps to a JSON-lines file,
+// mirroring pki.AuditLogger and secrets.AuditLogger.
+type CredentialAuditLogger struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewCredentialAuditLogger creates a logger that appends to path.
+func NewCredentialAuditLogger(path string) *CredentialAuditLogger {
+	return &CredentialAuditLogger{path: path}
+}
+
+// Log appends entry to the audit log, stamping Time if it's zero.
+func (l *CredentialAuditLogger) Log(entry CredentialAuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// CredentialAuditLogPath returns the rotate-key audit log path for a server
+// using dataDir as its data directory.
+func CredentialAuditLogPath(dataDir string) string {
+	if dataDir == "" {
+		dataDir = "."
+	}
+	return filepath.Join(dataDir, credentialAuditFile)
+}
+
+// authorizedKeysTag marks the line RotateHostKey manages in a host's
+// authorized_keys, so a later rotation can find and replace exactly that
+// line without disturbing any other key an operator put there by hand.
+func authorizedKeysTag(hostName string) string {
+	return "nixfleet-rotate:" + hostName
+}
+
+// RotateHostKey generates a new ed25519 keypair for host, installs the
+// public half on the remote using whatever credential pool currently
+// authenticates with, verifies an SSH login with the new private key, and
+// only after that succeeds removes the old nixfleet-managed key from
+// authorized_keys and writes the new private key into credentialsDir.
+//
+// Ordering matters: the old credential is never touched until the new one
+// has been proven to work, so a failure at any step leaves the host
+// reachable with the credential it already had - never locked out, and
+// never exposed with both an old and a new valid key at once for longer
+// than the time it takes to run this function.
+func RotateHostKey(ctx context.Context, pool *nfssh.Pool, credentialsDir string, host *inventory.Host, audit *CredentialAuditLogger) error {
+	_, newKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return fmt.Errorf("generating key: %w", err)
+	}
+	newSigner, err := ssh.NewSignerFromKey(newKey)
+	if err != nil {
+		return fmt.Errorf("building signer: %w", err)
+	}
+
+	tag := authorizedKeysTag(host.Name)
+	authorizedLine := fmt.Sprintf("%s %s", string(ssh.MarshalAuthorizedKey(newSigner.PublicKey())), tag)
+
+	oldClient, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+	if err != nil {
+		auditLog(audit, host.Name, "install-new-key", "failed", err.Error())
+		return fmt.Errorf("connecting with current credential: %w", err)
+	}
+
+	installCmd := fmt.Sprintf("mkdir -p ~/.ssh && chmod 700 ~/.ssh && printf '%%s\\n' %q >> ~/.ssh/authorized_keys", authorizedLine)
+	if res, err := oldClient.Exec(ctx, installCmd); err != nil || res.ExitCode != 0 {
+		detail := errOrOutput(err, res)
+		auditLog(audit, host.Name, "install-new-key", "failed", detail)
+		return fmt.Errorf("installing new key: %s", detail)
+	}
+	auditLog(audit, host.Name, "install-new-key", "ok", "")
+
+	verifyClient, err := nfssh.NewClient(host.Addr, &nfssh.ClientConfig{
+		User:    host.SSHUser,
+		Port:    host.SSHPort,
+		Timeout: 30 * time.Second,
+		Signer:  newSigner,
+	})
+	if err != nil {
+		auditLog(audit, host.Name, "verify-new-key", "failed", err.Error())
+		return fmt.Errorf("building verification client: %w", err)
+	}
+	defer verifyClient.Close()
+
+	if err := verifyClient.Connect(ctx); err != nil {
+		auditLog(audit, host.Name, "verify-new-key", "failed", err.Error())
+		return fmt.Errorf("new key does not work, old key left in place: %w", err)
+	}
+	if res, err := verifyClient.Exec(ctx, "true"); err != nil || res.ExitCode != 0 {
+		detail := errOrOutput(err, res)
+		auditLog(audit, host.Name, "verify-new-key", "failed", detail)
+		return fmt.Errorf("new key failed verification, old key left in place: %s", detail)
+	}
+	auditLog(audit, host.Name, "verify-new-key", "ok", "")
+
+	// Only now remove everything else nixfleet previously installed for
+	// this host under the same tag - the new line (also tagged) is filtered
+	// out and re-appended, so this is correct whether 0, 1, or 2 older
+	// tagged lines exist.
+	removeCmd := fmt.Sprintf(
+		"grep -v -F %q ~/.ssh/authorized_keys > ~/.ssh/.authorized_keys.nixfleet-rotate && printf '%%s\\n' %q >> ~/.ssh/.authorized_keys.nixfleet-rotate && mv ~/.ssh/.authorized_keys.nixfleet-rotate ~/.ssh/authorized_keys",
+		tag, authorizedLine,
+	)
+	if res, err := verifyClient.Exec(ctx, removeCmd); err != nil || res.ExitCode != 0 {
+		detail := errOrOutput(err, res)
+		auditLog(audit, host.Name, "remove-old-key", "failed", detail)
+		return fmt.Errorf("removing old key: %s", detail)
+	}
+
+	if err := writeCredentialFile(credentialsDir, host.Name, newKey); err != nil {
+		auditLog(audit, host.Name, "remove-old-key", "failed", "writing new credential file: "+err.Error())
+		return fmt.Errorf("writing new credential file: %w", err)
+	}
+
+	pool.Remove(host.Addr, host.SSHPort)
+	auditLog(audit, host.Name, "remove-old-key", "ok", "")
+
+	return nil
+}
+
+func auditLog(audit *CredentialAuditLogger, host, step, result, detail string) {
+	if audit == nil {
+		return
+	}
+	audit.Log(CredentialAuditEntry{Host: host, Step: step, Result: result, Detail: detail})
+}
+
+func errOrOutput(err error, res *nfssh.ExecResult) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("exit %d: %s", res.ExitCode, res.Stderr)
+}
+
+// writeCredentialFile writes key into credentialsDir under hostName,
+// atomically (write to a temp file, then rename) so a concurrent
+// CredentialStore read never observes a partially-written key.
+func writeCredentialFile(credentialsDir, hostName string, key ed25519.PrivateKey) error {
+	if err := os.MkdirAll(credentialsDir, 0700); err != nil {
+		return err
+	}
+
+	block, err := ssh.MarshalPrivateKey(key, "nixfleet rotate-key: "+hostName)
+	if err != nil {
+		return err
+	}
+
+	dest := filepath.Join(credentialsDir, hostName)
+	tmp := dest + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(block), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
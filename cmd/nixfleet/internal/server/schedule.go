@@ -0,0 +1,98 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+	"github.com/nixfleet/nixfleet/internal/reboot"
+	"github.com/nixfleet/nixfleet/internal/schedule"
+)
+
+// buildScheduleRegistry registers every host's recurring maintenance
+// window - today, just OSUpdate.RebootWindow, the only window configured
+// per host in inventory - against both the reboot and os-update activity
+// types, since a single window currently governs when this build is
+// allowed to do either. A host with an unparsable or empty window
+// contributes nothing rather than failing server startup; a bad window
+// string is already reported by 'nixfleet host validate'.
+func buildScheduleRegistry(inv *inventory.Inventory) *schedule.Registry {
+	reg := schedule.NewRegistry()
+	if inv == nil {
+		return reg
+	}
+
+	for _, host := range inv.AllHosts() {
+		if host.OSUpdate.RebootWindow == "" {
+			continue
+		}
+
+		loc, err := inv.LocationForHost(host)
+		if err != nil {
+			log.Printf("schedule: %s: %v", host.Name, err)
+			continue
+		}
+
+		window, err := reboot.ParseRebootWindow(host.OSUpdate.RebootWindow, loc)
+		if err != nil {
+			log.Printf("schedule: %s: invalid reboot_window %q: %v", host.Name, host.OSUpdate.RebootWindow, err)
+			continue
+		}
+
+		reg.Register(schedule.Activity{Name: host.Name + "-reboot-window", Host: host.Name, Type: schedule.ActivityReboot, Window: window})
+		reg.Register(schedule.Activity{Name: host.Name + "-os-update-window", Host: host.Name, Type: schedule.ActivityOSUpdate, Window: window})
+	}
+
+	return reg
+}
+
+// scheduleResponse is GET /api/schedule's payload.
+type scheduleResponse struct {
+	From        time.Time             `json:"from"`
+	To          time.Time             `json:"to"`
+	Occurrences []schedule.Occurrence `json:"occurrences"`
+	Conflicts   []schedule.Conflict   `json:"conflicts"`
+}
+
+// handleSchedule serves GET /api/schedule?from=...&to=...: every
+// registered activity's computed occurrences in the range (RFC3339,
+// defaulting to now..now+7d when omitted) and any overlaps between
+// occurrences whose activity types are mutually exclusive on the same
+// host.
+func (s *Server) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	from := now
+	to := now.AddDate(0, 0, 7)
+
+	if v := r.URL.Query().Get("from"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			s.jsonError(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			s.jsonError(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+	if !to.After(from) {
+		s.jsonError(w, "to must be after from", http.StatusBadRequest)
+		return
+	}
+
+	occurrences := schedule.Occurrences(s.scheduleRegistry.Activities(), from, to)
+	conflicts := schedule.DetectConflicts(occurrences)
+
+	s.jsonResponse(w, scheduleResponse{
+		From:        from,
+		To:          to,
+		Occurrences: occurrences,
+		Conflicts:   conflicts,
+	}, http.StatusOK)
+}
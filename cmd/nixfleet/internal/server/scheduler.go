@@ -4,13 +4,34 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
+
+	"github.com/nixfleet/nixfleet/internal/compliance"
+	"github.com/nixfleet/nixfleet/internal/osupdate"
+	"github.com/nixfleet/nixfleet/internal/probe"
+	"github.com/nixfleet/nixfleet/internal/ssh"
+	"github.com/nixfleet/nixfleet/internal/state"
 )
 
 // Scheduler runs periodic background tasks
 type Scheduler struct {
 	server *Server
 	stop   chan struct{}
+
+	tasksMu sync.RWMutex
+	tasks   map[string]TaskStatus
+}
+
+// TaskStatus is a snapshot of one scheduled task's run history, used by
+// GET /api/info to answer "when did this last run, and when's it next due"
+// without exposing the scheduler's internals.
+type TaskStatus struct {
+	Interval time.Duration `json:"interval"`
+	LastRun  time.Time     `json:"last_run,omitempty"`
+	NextRun  time.Time     `json:"next_run,omitempty"`
 }
 
 // NewScheduler creates a new scheduler
@@ -18,24 +39,83 @@ func NewScheduler(server *Server) *Scheduler {
 	return &Scheduler{
 		server: server,
 		stop:   make(chan struct{}),
+		tasks:  make(map[string]TaskStatus),
 	}
 }
 
-// Start begins the scheduler goroutines
+// Status returns a snapshot of every registered task's last/next run time.
+func (s *Scheduler) Status() map[string]TaskStatus {
+	s.tasksMu.RLock()
+	defer s.tasksMu.RUnlock()
+
+	snapshot := make(map[string]TaskStatus, len(s.tasks))
+	for name, t := range s.tasks {
+		snapshot[name] = t
+	}
+	return snapshot
+}
+
+// Start begins the scheduler goroutines, reading each interval once (via
+// the server's scheduleIntervals(), which is reload-aware) to decide
+// whether to spawn it at all. ReloadConfig doesn't change a running
+// goroutine's ticker; it stops this Scheduler and starts a fresh one so new
+// intervals (or newly zeroed ones) take effect.
 func (s *Scheduler) Start(ctx context.Context) {
+	intervals := s.server.scheduleIntervals()
+
 	// Drift check scheduler
-	if s.server.config.DriftCheckInterval > 0 {
-		go s.runPeriodic(ctx, "drift-check", s.server.config.DriftCheckInterval, s.runDriftCheck)
+	if intervals.drift > 0 {
+		go s.runPeriodic(ctx, "drift-check", intervals.drift, s.runDriftCheck)
 	}
 
 	// Update check scheduler
-	if s.server.config.UpdateCheckInterval > 0 {
-		go s.runPeriodic(ctx, "update-check", s.server.config.UpdateCheckInterval, s.runUpdateCheck)
+	if intervals.update > 0 {
+		go s.runPeriodic(ctx, "update-check", intervals.update, s.runUpdateCheck)
 	}
 
 	// Health check scheduler
-	if s.server.config.HealthCheckInterval > 0 {
-		go s.runPeriodic(ctx, "health-check", s.server.config.HealthCheckInterval, s.runHealthCheck)
+	if intervals.health > 0 {
+		go s.runPeriodic(ctx, "health-check", intervals.health, s.runHealthCheck)
+	}
+
+	// Scheduled backup
+	if intervals.backup > 0 {
+		go s.runPeriodic(ctx, "backup", intervals.backup, s.runBackup)
+	}
+
+	// k0s cluster metrics
+	if intervals.k0sMetrics > 0 {
+		go s.runPeriodic(ctx, "k0s-metrics", intervals.k0sMetrics, s.runK0sMetrics)
+	}
+
+	// Patch compliance recording
+	if intervals.compliance > 0 {
+		go s.runPeriodic(ctx, "compliance-check", intervals.compliance, s.runComplianceCheck)
+	}
+
+	// SIEM spool retry - always on (not configurable) when SIEM export is
+	// configured at all, since an unreachable collector should recover on
+	// its own without an operator having to set another interval flag.
+	if s.server.siemSender != nil {
+		go s.runPeriodic(ctx, "siem-flush", siemFlushInterval, s.runSIEMFlush)
+	}
+}
+
+// siemFlushInterval controls how often the scheduler retries delivering
+// spooled SIEM events.
+const siemFlushInterval = 30 * time.Second
+
+// runSIEMFlush retries delivering events spooled because the SIEM collector
+// was unreachable when dispatchEvent first tried them - the durability half
+// of SIEM export's "spool when the collector is unreachable" promise.
+func (s *Scheduler) runSIEMFlush(ctx context.Context) {
+	n, err := s.server.siemSender.FlushSpool()
+	if err != nil {
+		log.Printf("Scheduler: siem flush failed: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Scheduler: siem flush - delivered %d spooled event(s)", n)
 	}
 }
 
@@ -50,6 +130,9 @@ func (s *Scheduler) runPeriodic(ctx context.Context, name string, interval time.
 	defer ticker.Stop()
 
 	log.Printf("Scheduler: %s enabled (every %s)", name, interval)
+	s.tasksMu.Lock()
+	s.tasks[name] = TaskStatus{Interval: interval, NextRun: time.Now().Add(interval)}
+	s.tasksMu.Unlock()
 
 	for {
 		select {
@@ -60,19 +143,34 @@ func (s *Scheduler) runPeriodic(ctx context.Context, name string, interval time.
 		case <-ticker.C:
 			log.Printf("Scheduler: running %s", name)
 			task(ctx)
+			s.recordRun(name, interval, time.Now())
 		}
 	}
 }
 
+// recordRun updates name's last/next run snapshot. Called from the single
+// goroutine driving that task, so it never overlaps a concurrent run of the
+// same task - the lock only ever contends with a GET /api/info read.
+func (s *Scheduler) recordRun(name string, interval time.Duration, at time.Time) {
+	s.tasksMu.Lock()
+	s.tasks[name] = TaskStatus{Interval: interval, LastRun: at, NextRun: at.Add(interval)}
+	s.tasksMu.Unlock()
+}
+
 // runDriftCheck performs drift detection on all hosts
 func (s *Scheduler) runDriftCheck(ctx context.Context) {
 	hosts := s.server.inventory.AllHosts()
 
 	totalDrift := 0
 	for _, host := range hosts {
+		if s.server.prober != nil && s.server.prober.IsDown(host.Name) {
+			continue
+		}
+
 		client, err := s.server.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 		if err != nil {
 			log.Printf("Scheduler: drift check %s - connection failed: %v", host.Name, err)
+			s.server.metrics.SetReachable(host.Name, false)
 			continue
 		}
 
@@ -101,6 +199,8 @@ func (s *Scheduler) runDriftCheck(ctx context.Context) {
 		hostState.DriftFiles = driftFiles
 		hostState.LastDriftCheck = time.Now()
 		s.server.stateMgr.WriteState(ctx, client, hostState)
+		s.server.driftHistory.Record(host.Name, hostState.LastDriftCheck, driftFiles)
+		s.server.metrics.SetDrift(host.Name, hostState.DriftDetected, len(driftFiles))
 
 		if driftCount > 0 {
 			log.Printf("Scheduler: drift check %s - %d file(s) drifted", host.Name, driftCount)
@@ -110,7 +210,7 @@ func (s *Scheduler) runDriftCheck(ctx context.Context) {
 
 	// Send webhook if drift detected
 	if totalDrift > 0 {
-		s.server.sendWebhook("drift", map[string]any{
+		s.server.dispatchEvent("drift", map[string]any{
 			"source":      "scheduled",
 			"total_drift": totalDrift,
 			"hosts":       len(hosts),
@@ -129,6 +229,9 @@ func (s *Scheduler) runUpdateCheck(ctx context.Context) {
 		if host.Base != "ubuntu" {
 			continue
 		}
+		if s.server.prober != nil && s.server.prober.IsDown(host.Name) {
+			continue
+		}
 
 		client, err := s.server.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 		if err != nil {
@@ -148,9 +251,9 @@ func (s *Scheduler) runUpdateCheck(ctx context.Context) {
 		}
 
 		// Check security updates
+		var security int
 		secResult, err := client.Exec(ctx, "apt-get -s upgrade 2>/dev/null | grep -c security || echo 0")
 		if err == nil {
-			var security int
 			if _, err := fmt.Sscanf(secResult.Stdout, "%d", &security); err == nil {
 				totalSecurity += security
 			}
@@ -163,6 +266,7 @@ func (s *Scheduler) runUpdateCheck(ctx context.Context) {
 			hostState.LastUpdateCheck = time.Now()
 			s.server.stateMgr.WriteState(ctx, client, hostState)
 		}
+		s.server.metrics.SetUpdates(host.Name, pending, security)
 	}
 
 	if totalUpdates > 0 {
@@ -170,6 +274,56 @@ func (s *Scheduler) runUpdateCheck(ctx context.Context) {
 	}
 }
 
+// runComplianceCheck records each ubuntu host's currently outstanding
+// security/regular updates into s.server.complianceStore, using
+// osupdate.Updater.CheckPendingUpdates for named packages instead of
+// runUpdateCheck's ad hoc grep counts - the compliance store needs package
+// names, not just a count, to track each one's age and report offenders.
+func (s *Scheduler) runComplianceCheck(ctx context.Context) {
+	updater := osupdate.NewUpdater()
+	now := time.Now()
+
+	for _, host := range s.server.inventory.AllHosts() {
+		if host.Base != "ubuntu" {
+			continue
+		}
+		if s.server.prober != nil && s.server.prober.IsDown(host.Name) {
+			continue
+		}
+
+		client, err := s.server.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+		if err != nil {
+			log.Printf("Scheduler: compliance check %s - connection failed: %v", host.Name, err)
+			continue
+		}
+
+		pending, err := updater.CheckPendingUpdates(ctx, client)
+		if err != nil {
+			log.Printf("Scheduler: compliance check %s - failed: %v", host.Name, err)
+			continue
+		}
+
+		security := make([]compliance.PendingPackage, len(pending.SecurityUpdates))
+		for i, p := range pending.SecurityUpdates {
+			security[i] = compliance.PendingPackage{Name: p.Name, CurrentVersion: p.CurrentVersion, NewVersion: p.NewVersion}
+		}
+		regular := make([]compliance.PendingPackage, len(pending.RegularUpdates))
+		for i, p := range pending.RegularUpdates {
+			regular[i] = compliance.PendingPackage{Name: p.Name, CurrentVersion: p.CurrentVersion, NewVersion: p.NewVersion}
+		}
+		s.server.complianceStore.Record(host.Name, now, security, regular)
+	}
+}
+
+// defaultSystemProbe runs when a host has no probes configured on itself or
+// any group it belongs to, preserving the scheduler's old systemd-wide
+// sanity check as a fallback.
+var defaultSystemProbe = probe.Config{
+	Name:   "system_running",
+	Type:   probe.TypeCommand,
+	Target: "systemctl is-system-running 2>/dev/null || echo unknown",
+}
+
 // runHealthCheck checks host connectivity and service health
 func (s *Scheduler) runHealthCheck(ctx context.Context) {
 	hosts := s.server.inventory.AllHosts()
@@ -183,21 +337,25 @@ func (s *Scheduler) runHealthCheck(ctx context.Context) {
 		if err != nil {
 			offline++
 			log.Printf("Scheduler: health check %s - offline: %v", host.Name, err)
+			s.server.metrics.SetReachable(host.Name, false)
 			continue
 		}
 
 		online++
+		s.server.metrics.SetReachable(host.Name, true)
 
-		// Check system status
-		result, err := client.Exec(ctx, "systemctl is-system-running 2>/dev/null || echo unknown")
-		if err != nil {
-			continue
+		configs := s.server.inventory.ProbesForHost(host)
+		if len(configs) == 0 {
+			configs = []probe.Config{defaultSystemProbe}
 		}
 
-		status := result.Stdout
-		if status != "running\n" && status != "degraded\n" {
+		results := s.server.probe.Run(ctx, schedulerExec(client), host.Addr, configs)
+		if err := s.server.stateMgr.UpdateServiceHealth(ctx, client, serviceHealthFromProbes(results)); err != nil {
+			log.Printf("Scheduler: failed to record probe results for %s: %v", host.Name, err)
+		}
+		if !results.Passed {
 			unhealthy++
-			log.Printf("Scheduler: health check %s - status: %s", host.Name, status)
+			log.Printf("Scheduler: health check %s - %s", host.Name, results.Summary())
 		}
 
 		// Check reboot required
@@ -209,13 +367,14 @@ func (s *Scheduler) runHealthCheck(ctx context.Context) {
 				s.server.stateMgr.WriteState(ctx, client, hostState)
 			}
 		}
+		s.server.metrics.SetRebootRequired(host.Name, reboot)
 	}
 
 	log.Printf("Scheduler: health check - %d online, %d offline, %d unhealthy", online, offline, unhealthy)
 
 	// Send webhook if hosts are offline or unhealthy
 	if offline > 0 || unhealthy > 0 {
-		s.server.sendWebhook("health", map[string]any{
+		s.server.dispatchEvent("health", map[string]any{
 			"source":    "scheduled",
 			"online":    online,
 			"offline":   offline,
@@ -223,3 +382,130 @@ func (s *Scheduler) runHealthCheck(ctx context.Context) {
 		})
 	}
 }
+
+// runBackup snapshots the server's data dir on schedule, into
+// Config.BackupDir (or the data dir itself if unset), optionally
+// age-encrypting it for Config.BackupRecipients, then prunes old backups
+// beyond Config.BackupRetention. It reuses the exact same Server.Backup
+// logic as POST /api/admin/backup and 'server backup', so this is the
+// "no external cron" path the scheduler already provides for drift/update/
+// health checks.
+func (s *Scheduler) runBackup(ctx context.Context) {
+	cfg := s.server.config
+
+	dir := cfg.BackupDir
+	if dir == "" {
+		dir = s.server.dataDir()
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Scheduler: backup - creating %s: %v", dir, err)
+		return
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("server-backup-%s.tar.gz", time.Now().UTC().Format("20060102-150405")))
+	f, err := os.Create(path)
+	if err != nil {
+		log.Printf("Scheduler: backup - creating %s: %v", path, err)
+		return
+	}
+
+	manifest, err := s.server.Backup(f)
+	f.Close()
+	if err != nil {
+		log.Printf("Scheduler: backup - snapshot failed: %v", err)
+		os.Remove(path)
+		return
+	}
+
+	if len(cfg.BackupRecipients) > 0 {
+		encPath := path + ".age"
+		if err := ageEncryptFile(path, encPath, cfg.BackupRecipients); err != nil {
+			log.Printf("Scheduler: backup - encrypting %s: %v", path, err)
+		} else {
+			os.Remove(path)
+			path = encPath
+		}
+	}
+
+	log.Printf("Scheduler: backup - wrote %s (%d file(s), schema v%d)", path, len(manifest.Files), manifest.Version)
+
+	if cfg.BackupRetention > 0 {
+		pruneBackups(dir, cfg.BackupRetention)
+	}
+}
+
+// runK0sMetrics collects a curated cluster-health snapshot for every host
+// configured with K0sMonitor.Enabled, respecting each host's own configured
+// interval rather than a single fleet-wide cadence: this task itself runs
+// on Config.K0sMetricsInterval (a base tick), but a host whose own Interval
+// hasn't elapsed since its last collected snapshot is skipped this tick, the
+// same "collect only when due" idea as search.Cache being updated
+// opportunistically rather than on its own schedule. A collection failure
+// on one host is logged and skipped, matching runDriftCheck/runUpdateCheck/
+// runHealthCheck's existing per-host error tolerance, so it never affects
+// other hosts or other scheduler tasks.
+func (s *Scheduler) runK0sMetrics(ctx context.Context) {
+	for _, host := range s.server.inventory.AllHosts() {
+		if !host.K0sMonitor.Enabled {
+			continue
+		}
+		if s.server.prober != nil && s.server.prober.IsDown(host.Name) {
+			continue
+		}
+
+		if prev, ok := s.server.k0sSummaries.Get(host.Name); ok {
+			interval := host.K0sMonitor.Interval
+			if interval <= 0 {
+				interval = 5 * time.Minute
+			}
+			if time.Since(prev.CollectedAt) < interval {
+				continue
+			}
+		}
+
+		client, err := s.server.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+		if err != nil {
+			log.Printf("Scheduler: k0s metrics %s - connection failed: %v", host.Name, err)
+			continue
+		}
+
+		summary, err := s.server.k0sReconciler.CollectSummary(ctx, client)
+		if err != nil {
+			log.Printf("Scheduler: k0s metrics %s - collection failed: %v", host.Name, err)
+			continue
+		}
+
+		s.server.k0sSummaries.Update(host.Name, *summary)
+		if summary.Error != "" {
+			log.Printf("Scheduler: k0s metrics %s - partial: %s", host.Name, summary.Error)
+		}
+	}
+}
+
+// schedulerExec adapts an ssh.Client into a probe.Exec so the probe engine
+// never needs to import internal/ssh directly.
+func schedulerExec(client *ssh.Client) probe.Exec {
+	return func(ctx context.Context, cmd string) (*probe.ExecResult, error) {
+		result, err := client.Exec(ctx, cmd)
+		if err != nil {
+			return nil, err
+		}
+		return &probe.ExecResult{Stdout: result.Stdout, Stderr: result.Stderr, ExitCode: result.ExitCode}, nil
+	}
+}
+
+// serviceHealthFromProbes converts probe results into the map shape
+// HostState.ServiceHealth expects, so apply, reboot, and the server
+// scheduler all record probe outcomes the same way.
+func serviceHealthFromProbes(results *probe.Results) map[string]state.ServiceStatus {
+	health := make(map[string]state.ServiceStatus, len(results.Checks))
+	now := time.Now()
+	for _, c := range results.Checks {
+		health[c.Name] = state.ServiceStatus{
+			Active:    c.Passed,
+			SubState:  c.Message,
+			LastCheck: now,
+		}
+	}
+	return health
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/nixfleet/nixfleet/internal/search"
+)
+
+// handleSearch answers GET /api/search?q=...&type=package|file|cert|host|any
+// entirely from local data - inventory, the PKI store, and searchCache -
+// never SSHing to a host on search's behalf. See internal/search for the
+// query syntax, including operators like "package:openssl<3.0.7" and
+// "cert:expires<30d".
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		s.jsonError(w, "q query parameter is required", http.StatusBadRequest)
+		return
+	}
+	searchType := r.URL.Query().Get("type")
+
+	results := search.Run(s.inventory, s.pkiStore, s.searchCache, q, searchType)
+	s.jsonResponse(w, results, http.StatusOK)
+}
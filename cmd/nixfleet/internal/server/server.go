@@ -6,17 +6,39 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nixfleet/nixfleet/internal/apt"
+	"github.com/nixfleet/nixfleet/internal/compliance"
+	"github.com/nixfleet/nixfleet/internal/discover"
+	"github.com/nixfleet/nixfleet/internal/driftreport"
+	"github.com/nixfleet/nixfleet/internal/export"
+	"github.com/nixfleet/nixfleet/internal/impact"
 	"github.com/nixfleet/nixfleet/internal/inventory"
+	"github.com/nixfleet/nixfleet/internal/k0s"
+	"github.com/nixfleet/nixfleet/internal/logging"
 	"github.com/nixfleet/nixfleet/internal/nix"
+	"github.com/nixfleet/nixfleet/internal/pki"
+	"github.com/nixfleet/nixfleet/internal/preflight"
+	"github.com/nixfleet/nixfleet/internal/probe"
+	"github.com/nixfleet/nixfleet/internal/provenance"
 	"github.com/nixfleet/nixfleet/internal/pullmode"
+	"github.com/nixfleet/nixfleet/internal/schedule"
+	"github.com/nixfleet/nixfleet/internal/search"
+	"github.com/nixfleet/nixfleet/internal/secrets"
+	"github.com/nixfleet/nixfleet/internal/siem"
 	"github.com/nixfleet/nixfleet/internal/ssh"
 	"github.com/nixfleet/nixfleet/internal/state"
+	"github.com/nixfleet/nixfleet/pkg/api"
 )
 
 // Config holds server configuration
@@ -30,49 +52,388 @@ type Config struct {
 	UpdateCheckInterval time.Duration
 	HealthCheckInterval time.Duration
 
+	// ProbeInterval controls the background connectivity prober. Zero
+	// disables it.
+	ProbeInterval time.Duration
+
+	// DataDir is where the server persists local state that isn't tied to
+	// any single host: prober availability history, host overrides, and
+	// completed-job history for GET /api/stats.
+	DataDir string
+
+	// MaxJobs bounds how many jobs (including completed ones) are kept in
+	// memory and in <DataDir>/jobs.json. Zero uses defaultMaxJobs. Only
+	// terminal jobs are ever pruned to stay under this - a job still
+	// running never counts against it.
+	MaxJobs int
+
+	// JobRetention bounds how long a completed job is kept before the
+	// background pruner removes it. Zero uses defaultJobRetention.
+	JobRetention time.Duration
+
+	// PKIDir is the fleet PKI store, used to report certificate expiry in
+	// the CMDB export. Empty disables the cert_days_left export column.
+	PKIDir string
+
+	// ProvenanceDir is the fleet provenance store, used to sign and record
+	// a provenance document for every closure the server deploys. Empty
+	// defaults to "secrets/provenance".
+	ProvenanceDir string
+
+	// RequireProvenance refuses to deploy any closure lacking a valid,
+	// matching provenance record instead of building and activating it.
+	RequireProvenance bool
+
+	// CredentialsDir, if set, scopes SSH auth per host instead of using
+	// whatever the server's SSH agent holds for everything: a file named
+	// for a host (or "@<group>" for a group-wide fallback) under this
+	// directory is used as that host's only private key. A host with no
+	// file here connects exactly as it would without CredentialsDir set.
+	// See internal/ssh.CredentialStore and 'nixfleet server rotate-key'.
+	CredentialsDir string
+
+	// Offline passes --offline to nix and makes network-dependent steps
+	// (cache push, remote diff) degrade instead of erroring.
+	Offline bool
+
+	// NoEvalCache bypasses the on-disk eval cache, re-evaluating every host
+	// from scratch.
+	NoEvalCache bool
+
 	// Webhook settings
 	WebhookURL    string
 	WebhookSecret string
-	WebhookEvents []string // drift, apply, reboot, health
+	WebhookEvents []string // drift, apply, apply-all, reboot, health, host-up, host-down
+
+	// WebhookDetail controls how much detail apply-all sends: "summary"
+	// (default) sends only the one apply-all event with per-host outcomes;
+	// "full" additionally sends a per-host "apply" detail event for every
+	// host in the run, same as a single-host apply.
+	WebhookDetail string
+
+	// Email notification channel: an SMTP sender, separate from the
+	// webhook above, for teams that just want drift/apply events emailed
+	// to a list. EmailEvents follows the same event-name/"*" matching as
+	// WebhookEvents.
+	EmailSMTPHost    string
+	EmailSMTPPort    int
+	EmailSTARTTLS    bool
+	EmailImplicitTLS bool
+	EmailUsername    string
+	EmailPassword    string
+	EmailFrom        string
+	EmailTo          []string
+	EmailEvents      []string
+
+	// Slack notification channel: an incoming webhook URL, posted to with
+	// the same event payload as the generic webhook, reduced to a short
+	// text summary.
+	SlackWebhookURL string
+	SlackEvents     []string
+
+	// Matrix notification channel: a homeserver + access token + room,
+	// using the Client-Server API's send-message endpoint directly rather
+	// than a bot framework, since that's all a one-way notification needs.
+	MatrixHomeserverURL string
+	MatrixAccessToken   string
+	MatrixRoomID        string
+	MatrixEvents        []string
+
+	// SIEM export: every dispatched event is formatted as an RFC 5424
+	// syslog message (CEF or JSON, see package internal/siem) and sent to
+	// SIEMURL, a "syslog://host:514?proto=udp|tcp|tls&format=cef|json"
+	// target. SIEMEvents follows the same event-name/"*" matching as
+	// WebhookEvents. Unlike the other channels, a delivery that can't reach
+	// the collector is spooled to SIEMSpoolFile and retried, rather than
+	// just counted as a failure - a security team's SIEM going down for
+	// maintenance shouldn't leave a gap in its audit trail. Empty SIEMURL
+	// disables SIEM export entirely.
+	SIEMURL       string
+	SIEMEvents    []string
+	SIEMSpoolFile string
+
+	// PreviewSCMProvider selects how POST /api/preview reports results back
+	// to the source host: "github" (default if PreviewSCMToken is set) or
+	// "gitea". Only affects the auth header and default base URL used by
+	// PreviewSCMBaseURL.
+	PreviewSCMProvider string
+
+	// PreviewSCMBaseURL overrides the SCM API base URL, required for Gitea
+	// (there's no fixed default) and for GitHub Enterprise. Empty uses
+	// https://api.github.com for provider "github".
+	PreviewSCMBaseURL string
+
+	// PreviewSCMToken authenticates commit-status and PR-comment posts for
+	// previews. Empty disables SCM feedback entirely - previews still
+	// deploy and record their own result, they just don't report back.
+	PreviewSCMToken string
+
+	// PreviewDefaultTTL bounds how long a preview deployment sits on its
+	// canary host before auto-reverting, when POST /api/preview doesn't
+	// specify one. Zero uses defaultPreviewTTL.
+	PreviewDefaultTTL time.Duration
+
+	// PreviewMaxTTL caps any TTL a caller requests, however long. Zero uses
+	// maxPreviewTTL.
+	PreviewMaxTTL time.Duration
+
+	// PublicURL, if set, is included in email/Slack/Matrix notifications as
+	// the link back to this server's web UI.
+	PublicURL string
 
 	// Auth settings
 	APIToken string
+
+	// MetricsToken, if set, requires a matching "Authorization: Bearer
+	// <token>" header on GET /metrics, the same way APIToken gates every
+	// other endpoint. Empty leaves /metrics unauthenticated, since most
+	// Prometheus scrape configs can't easily send one and a metrics value
+	// isn't a secret.
+	MetricsToken string
+
+	// ConfigPath is the --config file this Config was loaded from, if any.
+	// Empty when the server was started from flags alone. ReloadConfig and
+	// the SIGHUP handler re-read this file; a server without one rejects
+	// reload requests instead of silently no-op'ing.
+	ConfigPath string
+
+	// BackupInterval, if non-zero, has the scheduler snapshot DataDir on
+	// that interval via the same logic as 'server backup' / POST
+	// /api/admin/backup, so an operator doesn't need external cron.
+	BackupInterval time.Duration
+
+	// BackupDir is where scheduled backups are written. Empty defaults to
+	// DataDir.
+	BackupDir string
+
+	// BackupRetention caps how many scheduled backups are kept in
+	// BackupDir; the oldest are deleted once it's exceeded. Zero keeps
+	// every one.
+	BackupRetention int
+
+	// BackupRecipients, if set, age-encrypts each scheduled backup for
+	// these recipients (typically the fleet's admin keys from
+	// secrets.nix), the same way internal/secrets encrypts secrets.
+	BackupRecipients []string
+
+	// ApprovalAllowedSigners is the path to an SSH allowed_signers file
+	// ("<principal> <key-type> <base64-key>" per line, the same format git's
+	// gpg.ssh.allowedSignersFile uses) used to verify grant signatures on
+	// POST /api/approvals/{id}/grant. Empty refuses every grant, so the
+	// two-person rule fails closed rather than silently accepting unverified
+	// signatures.
+	ApprovalAllowedSigners string
+
+	// K0sMetricsInterval drives how often the scheduler checks whether any
+	// k0s-controller host is due for a metrics collection, per its own
+	// Host.K0sMonitor.Interval. Zero disables k0s metrics collection fleet-
+	// wide regardless of what individual hosts have configured.
+	K0sMetricsInterval time.Duration
+
+	// ComplianceCheckInterval drives how often the scheduler records each
+	// ubuntu host's outstanding security/regular update counts into the
+	// compliance store, for GET /api/compliance. Zero disables compliance
+	// tracking fleet-wide.
+	ComplianceCheckInterval time.Duration
+
+	// SkipReadinessCheck disables the target-readiness probe (nix daemon
+	// ping, /nix free space and writability, profile writability) that
+	// otherwise runs before every host's closure copy. Set for unusual
+	// store configurations where the probe itself doesn't apply.
+	SkipReadinessCheck bool
+
+	// DrainTimeout bounds how long SIGTERM or POST /api/admin/drain waits
+	// for in-flight jobs to finish the host they're on before giving up.
+	// Zero uses defaultDrainTimeout. The systemd unit's TimeoutStopSec
+	// should be set a little higher than this, so systemd doesn't SIGKILL
+	// the process out from under its own drain wait.
+	DrainTimeout time.Duration
+
+	// HostOperationTimeout bounds how long a multi-host job (drift check,
+	// apply-all) spends on any single host before moving on, so one wedged
+	// machine can't stall the rest of the fleet. Zero uses
+	// defaultHostOperationTimeout.
+	HostOperationTimeout time.Duration
+
+	// LogLevel sets the server's structured log verbosity: "debug", "info"
+	// (default), "warn", or "error". Set once at startup; not reloadable.
+	LogLevel string
+
+	// LogFormat selects the structured log encoding: "text" (default) or
+	// "json". Set once at startup; not reloadable.
+	LogFormat string
 }
 
 // Server is the NixFleet HTTP API server
 type Server struct {
-	config    Config
+	// configMu guards the subset of config that ReloadConfig can change on
+	// a running server (webhook settings, schedule intervals, the API
+	// token) - see reload.go. Every other field is only ever set once, in
+	// New(), and is read unguarded.
+	configMu sync.RWMutex
+	config   Config
+
+	// runCtx is the context Start(ctx) is running under, kept so
+	// ReloadConfig can restart the scheduler with the same lifetime rather
+	// than needing its own context threaded in.
+	runCtx context.Context
+
 	inventory *inventory.Inventory
 	evaluator *nix.Evaluator
 	deployer  *nix.Deployer
 	pool      *ssh.Pool
 	stateMgr  *state.Manager
 	aptMgr    *apt.Manager
+	probe     *probe.Engine
+	pkiStore  *pki.Store // nil if PKIDir isn't configured
+	provStore *provenance.Store
+
+	// readinessChecker runs the target-readiness probe ahead of a closure
+	// copy; see checkReadiness.
+	readinessChecker *preflight.Checker
+
+	// readiness caches the server's own self-readiness (nix, flake, SSH
+	// agent, ...); see evaluateReadiness. Distinct from readinessChecker
+	// above, which probes a deploy target rather than the server itself.
+	readiness readinessCache
+
+	// searchCache backs GET /api/search with package/file data collected
+	// opportunistically by the apt/state handlers below, so search never
+	// has to SSH on its own.
+	searchCache *search.Cache
 
 	// Scheduler
 	scheduler *Scheduler
 
-	// Job tracking
+	// prober tracks host connectivity in the background; nil if disabled.
+	prober *Prober
+
+	// overrides holds operator-set per-host deployment overrides (frozen,
+	// alternate flake_ref).
+	overrides *OverrideStore
+
+	// approvals holds two-person-rule approval requests for secrets marked
+	// requiresApproval in secrets.nix.
+	approvals *ApprovalStore
+
+	// previews holds PR-preview deployments created by POST /api/preview,
+	// including the TTL-revert timer for whichever one is currently active
+	// on each host.
+	previews *PreviewStore
+
+	// k0sSummaries holds the latest collected metrics/events snapshot per
+	// k0s controller, populated by Scheduler's k0s-metrics task.
+	k0sSummaries  *K0sSummaryCache
+	k0sReconciler *k0s.Reconciler
+
+	// complianceStore holds the per-host patch-compliance series populated
+	// by Scheduler's compliance-check task, backing GET /api/compliance.
+	complianceStore *compliance.Store
+
+	// driftHistory holds the per-host drift-check history populated by
+	// Scheduler's drift-check task and by runDriftCheckJob, backing GET
+	// /api/drift/report.
+	driftHistory *driftreport.Store
+
+	// scheduleRegistry holds every host's registered recurring windows
+	// (currently: OS update/reboot windows), built once from inventory at
+	// startup, backing GET /api/schedule. Inventory isn't reloadable (see
+	// requiresRestartFields), so unlike the scheduler intervals above this
+	// never needs rebuilding by ReloadConfig.
+	scheduleRegistry *schedule.Registry
+
+	// Job tracking. jobs is seeded from <dataDir>/jobs.json at startup (see
+	// loadJobs) and kept under maxJobs()/jobRetention() by runJobPruner, so
+	// it survives a restart without growing forever.
 	jobs   map[string]*Job
 	jobsMu sync.RWMutex
 
+	// metrics backs GET /metrics: per-host gauges kept current by the
+	// scheduler's drift/update/health check tasks, plus job counters and an
+	// apply-duration histogram updated from updateJob, so a scrape never
+	// does SSH work of its own.
+	metrics *Metrics
+
+	// jobHistory persists completed jobs to disk so GET /api/stats can
+	// compute aggregates that survive a restart.
+	jobHistory *JobHistory
+
+	// drainStore persists in-flight apply-all progress so a job that gets
+	// killed before it can finish is reported as interrupted rather than
+	// silently lost. draining is set by Drain (SIGTERM or POST
+	// /api/admin/drain) and consulted by drainMiddleware and
+	// runApplyAllJob; it only ever goes false->true for a given process.
+	drainStore *DrainStore
+	draining   atomic.Bool
+
+	// webhookQueue decouples callers (apply, drift check, ...) from the
+	// outbound HTTP POST, so a slow or unreachable webhook receiver never
+	// blocks the operation it's reporting on. webhookSent/webhookFailed are
+	// updated only by runWebhookQueue, so GET /api/info can read them
+	// without touching the queue at all.
+	webhookQueue  chan webhookEvent
+	webhookSent   atomic.Int64
+	webhookFailed atomic.Int64
+
+	// notifyQueue is the equivalent decoupling queue for the email/Slack/
+	// Matrix channels - see notify.go. It's separate from webhookQueue so a
+	// slow SMTP server can't back up webhook delivery or vice versa.
+	notifyQueue  chan notifyDelivery
+	notifySent   atomic.Int64
+	notifyFailed atomic.Int64
+
+	// notifyFailuresMu guards notifyFailures, the bounded recent-failure
+	// log GET /api/notifications/failed reports (covering the webhook and
+	// every notification channel), so an operator can see *why* a delivery
+	// failed instead of just the failed counter ticking up.
+	notifyFailuresMu sync.Mutex
+	notifyFailures   []NotificationFailure
+
+	// siemQueue is the SIEM export path's decoupling queue, mirroring
+	// webhookQueue/notifyQueue - see siem.go. siemSender owns the actual
+	// network connection and its own reconnect/spool logic (package
+	// internal/siem); it's nil when Config.SIEMURL is unset. Unlike the
+	// webhook/email/Slack/Matrix channels, siemSender holds a live
+	// connection, so SIEMURL can't be hot-reloaded (see
+	// requiresRestartFields) - it's fixed for the process lifetime.
+	siemQueue    chan siemDelivery
+	siemSent     atomic.Int64
+	siemFailed   atomic.Int64
+	siemSender   *siem.Sender
+	siemTarget   siem.Target
+	siemHostname string
+
 	// Server state
 	startTime time.Time
 	mux       *http.ServeMux
-}
 
-// Job represents an async operation
-type Job struct {
-	ID        string    `json:"id"`
-	Type      string    `json:"type"`   // apply, drift-check, update-check
-	Status    string    `json:"status"` // pending, running, completed, failed
-	Host      string    `json:"host,omitempty"`
-	StartTime time.Time `json:"start_time"`
-	EndTime   time.Time `json:"end_time,omitempty"`
-	Result    any       `json:"result,omitempty"`
-	Error     string    `json:"error,omitempty"`
+	// logger is the server's structured logger, built from
+	// config.LogLevel/config.LogFormat in New(). Call sites that want a
+	// request/job/host-scoped logger should pull one from context via
+	// logging.FromContext instead of using this field directly.
+	logger *slog.Logger
+
+	// jobLogs holds the structured log records captured for each job ID,
+	// backing GET /api/jobs/{id}/logs.
+	jobLogs *logging.JobLogStore
 }
 
+// webhookQueueSize bounds pending webhook deliveries. A caller that fills
+// this (received faster than the webhook endpoint can be POSTed to) counts
+// the drop as a failure rather than blocking.
+const webhookQueueSize = 256
+
+// siemQueueSize bounds pending SIEM deliveries, mirroring webhookQueueSize -
+// a delivery that can't even be queued still counts as a failure rather than
+// blocking the caller; one that's queued but can't reach the collector gets
+// spooled to disk instead (see siem.go).
+const siemQueueSize = 256
+
+// Job represents an async operation. It's an alias for api.Job, the wire
+// type pkg/client decodes - keeping Job a plain alias instead of a second
+// struct definition means a new field only needs adding once.
+type Job = api.Job
+
 // New creates a new server instance
 func New(config Config) (*Server, error) {
 	flake, err := nix.ResolveFlakePath(config.FlakePath)
@@ -84,47 +445,146 @@ func New(config Config) (*Server, error) {
 	if err != nil {
 		return nil, fmt.Errorf("creating evaluator: %w", err)
 	}
+	evaluator.SetOffline(config.Offline)
+	evaluator.SetEvalCacheEnabled(!config.NoEvalCache)
+
+	jobLogs := logging.NewJobLogStore()
+	logger, err := logging.NewLogger(config.LogLevel, config.LogFormat, os.Stderr, jobLogs)
+	if err != nil {
+		return nil, fmt.Errorf("creating logger: %w", err)
+	}
+
+	siemHostname, _ := os.Hostname()
 
 	s := &Server{
-		config:    config,
-		inventory: config.Inventory,
-		evaluator: evaluator,
-		deployer:  nix.NewDeployer(evaluator),
-		pool:      ssh.NewPool(nil),
-		stateMgr:  state.NewManager(),
-		aptMgr:    apt.NewManager(),
-		jobs:      make(map[string]*Job),
-		startTime: time.Now(),
-		mux:       http.NewServeMux(),
+		config:           config,
+		inventory:        config.Inventory,
+		evaluator:        evaluator,
+		deployer:         nix.NewDeployer(evaluator),
+		pool:             ssh.NewPool(nil),
+		stateMgr:         state.NewManager(),
+		aptMgr:           apt.NewManager(),
+		probe:            probe.NewEngine(),
+		readinessChecker: preflight.NewChecker(),
+		jobs:             make(map[string]*Job),
+		metrics:          NewMetrics(),
+		webhookQueue:     make(chan webhookEvent, webhookQueueSize),
+		notifyQueue:      make(chan notifyDelivery, notifyQueueSize),
+		siemQueue:        make(chan siemDelivery, siemQueueSize),
+		siemHostname:     siemHostname,
+		startTime:        time.Now(),
+		mux:              http.NewServeMux(),
+		logger:           logger,
+		jobLogs:          jobLogs,
+	}
+	if _, err := s.pool.EnableSSHConfig(s.inventory); err != nil {
+		log.Printf("ssh_config resolution disabled: %v", err)
+	}
+	if config.CredentialsDir != "" {
+		s.pool.SetCredentialStore(ssh.NewCredentialStore(config.CredentialsDir).WithInventory(s.inventory))
+	}
+
+	if config.SIEMURL != "" {
+		target, err := siem.ParseTarget(config.SIEMURL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing siem_url: %w", err)
+		}
+		s.siemTarget = *target
+		s.siemSender = siem.NewSender(*target, config.SIEMSpoolFile)
 	}
 
+	if config.PKIDir != "" {
+		s.pkiStore = pki.NewStore(config.PKIDir, nil, nil)
+	}
+
+	provenanceDir := config.ProvenanceDir
+	if provenanceDir == "" {
+		provenanceDir = "secrets/provenance"
+	}
+	s.provStore = provenance.NewStore(provenanceDir, nil, nil)
+
+	dataDir := s.dataDir()
+	s.jobs = loadJobs(dataDir)
+	if len(s.jobs) > 0 {
+		s.persistJobs()
+	}
+	s.overrides = NewOverrideStore(dataDir)
+	s.approvals = NewApprovalStore(dataDir)
+	s.jobHistory = NewJobHistory(dataDir)
+	s.drainStore = NewDrainStore(dataDir)
+	for _, cp := range s.drainStore.Take() {
+		log.Printf("apply-all job %s was interrupted mid-run (completed %d host(s), was on %s/%s)", cp.JobID, len(cp.CompletedHosts), cp.CurrentHost, cp.CurrentPhase)
+		s.jobHistory.Record(JobHistoryEntry{
+			Type:      "apply-all",
+			Status:    "interrupted",
+			StartTime: cp.UpdatedAt,
+			EndTime:   cp.UpdatedAt,
+		})
+	}
+	s.searchCache = search.NewCache(dataDir)
+	s.k0sSummaries = NewK0sSummaryCache(dataDir)
+	s.k0sReconciler = k0s.NewReconciler()
+	s.complianceStore = compliance.NewStore(dataDir)
+	s.driftHistory = driftreport.NewStore(dataDir)
+	s.scheduleRegistry = buildScheduleRegistry(s.inventory)
+	s.previews = NewPreviewStore(dataDir)
+	s.reviveExpiredPreviews()
+
 	s.setupRoutes()
 	s.scheduler = NewScheduler(s)
+	go s.runWebhookQueue()
+	go s.runNotifyQueue()
+	go s.runSIEMQueue()
+
+	if config.ProbeInterval > 0 {
+		s.prober = NewProber(s, config.ProbeInterval, dataDir)
+	}
 
 	return s, nil
 }
 
+// dataDir returns where the server persists its local state, defaulting to
+// the working directory when Config.DataDir isn't set.
+func (s *Server) dataDir() string {
+	if s.config.DataDir == "" {
+		return "."
+	}
+	return s.config.DataDir
+}
+
 // setupRoutes configures HTTP handlers
 func (s *Server) setupRoutes() {
 	// Health and info
 	s.mux.HandleFunc("GET /api/health", s.handleHealth)
+	s.mux.HandleFunc("GET /api/health/ready", s.handleHealthReady)
 	s.mux.HandleFunc("GET /api/info", s.handleInfo)
 
+	// Metrics - not behind authMiddleware; see handleMetrics.
+	s.mux.HandleFunc("GET /metrics", s.handleMetrics)
+
 	// Hosts
 	s.mux.HandleFunc("GET /api/hosts", s.authMiddleware(s.handleListHosts))
 	s.mux.HandleFunc("GET /api/hosts/{name}", s.authMiddleware(s.handleGetHost))
 	s.mux.HandleFunc("GET /api/hosts/{name}/state", s.authMiddleware(s.handleGetHostState))
 	s.mux.HandleFunc("POST /api/hosts/{name}/apply", s.authMiddleware(s.handleApplyHost))
 	s.mux.HandleFunc("POST /api/hosts/{name}/rollback", s.authMiddleware(s.handleRollbackHost))
+	s.mux.HandleFunc("PUT /api/hosts/{name}/override", s.authMiddleware(s.handleSetHostOverride))
+	s.mux.HandleFunc("DELETE /api/hosts/{name}/override", s.authMiddleware(s.handleClearHostOverride))
 
 	// Drift
 	s.mux.HandleFunc("GET /api/drift", s.authMiddleware(s.handleDriftStatus))
 	s.mux.HandleFunc("POST /api/drift/check", s.authMiddleware(s.handleDriftCheck))
 	s.mux.HandleFunc("POST /api/drift/fix", s.authMiddleware(s.handleDriftFix))
+	s.mux.HandleFunc("GET /api/drift/report", s.authMiddleware(s.handleDriftReport))
+
+	s.mux.HandleFunc("GET /api/schedule", s.authMiddleware(s.handleSchedule))
 
 	// Jobs
 	s.mux.HandleFunc("GET /api/jobs", s.authMiddleware(s.handleListJobs))
 	s.mux.HandleFunc("GET /api/jobs/{id}", s.authMiddleware(s.handleGetJob))
+	s.mux.HandleFunc("GET /api/jobs/{id}/logs", s.authMiddleware(s.handleGetJobLogs))
+	s.mux.HandleFunc("GET /api/jobs/{id}/events", s.authMiddleware(s.handleGetJobEvents))
+	s.mux.HandleFunc("GET /api/stats", s.authMiddleware(s.handleStats))
 
 	// Plan
 	s.mux.HandleFunc("GET /api/plan", s.authMiddleware(s.handlePlan))
@@ -137,6 +597,14 @@ func (s *Server) setupRoutes() {
 	s.mux.HandleFunc("GET /api/pull-mode/status", s.authMiddleware(s.handlePullModeStatus))
 	s.mux.HandleFunc("POST /api/pull-mode/{name}/trigger", s.authMiddleware(s.handlePullModeTrigger))
 
+	// Groups - a consistent set of group-scoped operations, instead of the
+	// ad-hoc ?group= filters individual endpoints above grew over time.
+	s.mux.HandleFunc("GET /api/groups", s.authMiddleware(s.handleListGroups))
+	s.mux.HandleFunc("GET /api/groups/{name}/status", s.authMiddleware(s.handleGroupStatus))
+	s.mux.HandleFunc("POST /api/groups/{name}/apply", s.authMiddleware(s.handleGroupApply))
+	s.mux.HandleFunc("POST /api/groups/{name}/drift/check", s.authMiddleware(s.handleGroupDriftCheck))
+	s.mux.HandleFunc("POST /api/groups/{name}/pull-trigger", s.authMiddleware(s.handleGroupPullTrigger))
+
 	// APT package management (Ubuntu hosts)
 	s.mux.HandleFunc("GET /api/hosts/{name}/apt/updates", s.authMiddleware(s.handleGetAptUpdates))
 	s.mux.HandleFunc("POST /api/hosts/{name}/apt/update", s.authMiddleware(s.handleAptUpdate))
@@ -150,6 +618,51 @@ func (s *Server) setupRoutes() {
 	// OS info
 	s.mux.HandleFunc("GET /api/hosts/{name}/os-info", s.authMiddleware(s.handleGetOSInfo))
 
+	// PKI certificate inventory scan
+	s.mux.HandleFunc("GET /api/hosts/{name}/pki/scan", s.authMiddleware(s.handleGetPKIScan))
+
+	// PKI certificate request intake - approval happens out-of-band via
+	// 'nixfleet pki requests approve', which needs the CA's private key
+	// material the server doesn't have.
+	s.mux.HandleFunc("POST /api/pki/requests", s.authMiddleware(s.handlePKIRequestSubmit))
+
+	// Host discovery
+	s.mux.HandleFunc("GET /api/discover", s.authMiddleware(s.handleDiscover))
+
+	// CMDB export
+	s.mux.HandleFunc("GET /api/export", s.authMiddleware(s.handleExport))
+
+	// Admin
+	s.mux.HandleFunc("POST /api/admin/backup", s.authMiddleware(s.handleAdminBackup))
+	s.mux.HandleFunc("POST /api/admin/reload-config", s.authMiddleware(s.handleAdminReloadConfig))
+	s.mux.HandleFunc("POST /api/admin/drain", s.authMiddleware(s.handleAdminDrain))
+
+	s.mux.HandleFunc("GET /api/notifications/failed", s.authMiddleware(s.handleNotificationsFailed))
+
+	// Host comparison
+	s.mux.HandleFunc("GET /api/compare", s.authMiddleware(s.handleCompare))
+
+	// Fleet-wide search
+	s.mux.HandleFunc("GET /api/search", s.authMiddleware(s.handleSearch))
+
+	// Approvals (two-person rule for requiresApproval secrets)
+	s.mux.HandleFunc("POST /api/approvals", s.authMiddleware(s.handleCreateApproval))
+	s.mux.HandleFunc("GET /api/approvals", s.authMiddleware(s.handleListApprovals))
+	s.mux.HandleFunc("GET /api/approvals/{id}", s.authMiddleware(s.handleGetApproval))
+	s.mux.HandleFunc("POST /api/approvals/{id}/grant", s.authMiddleware(s.handleGrantApproval))
+
+	// k0s cluster metrics
+	s.mux.HandleFunc("GET /api/k8s/{controller}/summary", s.authMiddleware(s.handleK0sSummary))
+
+	// Patch compliance
+	s.mux.HandleFunc("GET /api/compliance", s.authMiddleware(s.handleCompliance))
+
+	// PR previews (canary deploy from a git ref, with TTL auto-revert)
+	s.mux.HandleFunc("POST /api/preview", s.authMiddleware(s.handlePreviewCreate))
+	s.mux.HandleFunc("GET /api/preview", s.authMiddleware(s.handlePreviewList))
+	s.mux.HandleFunc("GET /api/preview/{id}", s.authMiddleware(s.handlePreviewGet))
+	s.mux.HandleFunc("DELETE /api/preview/{id}", s.authMiddleware(s.handlePreviewDelete))
+
 	// Web UI
 	s.setupUIRoutes()
 }
@@ -157,9 +670,9 @@ func (s *Server) setupRoutes() {
 // authMiddleware wraps handlers with token authentication
 func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if s.config.APIToken != "" {
+		if token := s.apiToken(); token != "" {
 			auth := r.Header.Get("Authorization")
-			expected := "Bearer " + s.config.APIToken
+			expected := "Bearer " + token
 			if auth != expected {
 				s.jsonError(w, "unauthorized", http.StatusUnauthorized)
 				return
@@ -171,12 +684,22 @@ func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 // Start starts the HTTP server
 func (s *Server) Start(ctx context.Context) error {
+	s.runCtx = ctx
+
 	// Start scheduler
 	s.scheduler.Start(ctx)
 
+	if s.prober != nil {
+		s.prober.Start(ctx)
+	}
+
+	go s.runJobPruner(ctx)
+
+	s.watchReloadSignal(ctx)
+
 	server := &http.Server{
 		Addr:         s.config.ListenAddr,
-		Handler:      s.loggingMiddleware(s.mux),
+		Handler:      s.loggingMiddleware(s.drainMiddleware(s.mux)),
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 300 * time.Second,
 		IdleTimeout:  120 * time.Second,
@@ -191,7 +714,9 @@ func (s *Server) Start(ctx context.Context) error {
 
 	select {
 	case <-ctx.Done():
-		log.Println("Shutting down server...")
+		log.Println("Shutting down server: draining in-flight jobs...")
+		result := s.Drain(s.drainTimeout())
+		log.Printf("Drain finished (%d/%d job(s), timed out=%v, took %s)", result.JobsFinished, result.JobsAtStart, result.TimedOut, result.Duration)
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 		return server.Shutdown(shutdownCtx)
@@ -200,18 +725,69 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 }
 
-// loggingMiddleware logs requests
+// loggingMiddleware tags each request with a unique request ID, logs it as
+// one structured record on completion, and returns the ID to the caller
+// via X-Request-Id so a report of "it failed" can be matched back to this
+// exact log line.
 func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+
+		requestID, err := logging.NewRequestID()
+		if err != nil {
+			log.Printf("generating request id: %v", err)
+		}
+
+		ctx := logging.WithRequestID(logging.ContextWithLogger(r.Context(), s.logger), requestID)
+		r = r.WithContext(ctx)
+		w.Header().Set("X-Request-Id", requestID)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		logging.FromContext(ctx).Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration", time.Since(start).String(),
+		)
+	})
+}
+
+// statusRecorder wraps http.ResponseWriter to capture the status code a
+// handler wrote, so loggingMiddleware can log it after the fact.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// drainMiddleware rejects new mutating requests once the server is
+// draining (see Drain), so a fleet operator doing planned maintenance -
+// or systemd stopping the service - doesn't race new applies against jobs
+// that are already being told to wind down. GET/HEAD requests and the
+// drain endpoint itself always go through, since they don't start new work.
+func (s *Server) drainMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.draining.Load() && r.Method != http.MethodGet && r.Method != http.MethodHead && r.URL.Path != "/api/admin/drain" {
+			w.Header().Set("Retry-After", strconv.Itoa(int(s.drainTimeout().Seconds())))
+			s.jsonError(w, "server is draining, not accepting new mutating requests", http.StatusServiceUnavailable)
+			return
+		}
 		next.ServeHTTP(w, r)
-		log.Printf("%s %s %s", r.Method, r.URL.Path, time.Since(start))
 	})
 }
 
 // Close cleans up resources
 func (s *Server) Close() error {
 	s.pool.Close()
+	if s.siemSender != nil {
+		s.siemSender.Close()
+	}
 	return nil
 }
 
@@ -237,61 +813,123 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
 	s.jsonResponse(w, map[string]any{
-		"version":    "dev",
-		"start_time": s.startTime,
-		"uptime":     time.Since(s.startTime).String(),
-		"hosts":      len(s.inventory.AllHosts()),
-		"flake_path": s.config.FlakePath,
+		"version":       "dev",
+		"start_time":    s.startTime,
+		"uptime":        time.Since(s.startTime).String(),
+		"hosts":         len(s.inventory.AllHosts()),
+		"flake_path":    s.config.FlakePath,
+		"jobs":          s.jobSummary(),
+		"ssh_pool":      s.pool.Stats(),
+		"scheduler":     s.scheduler.Status(),
+		"webhooks":      s.webhookSummary(),
+		"notifications": s.notifySummary(),
+		"siem":          s.siemSummary(),
 	}, http.StatusOK)
 }
 
+// jobSummary snapshots in-flight job counts and the oldest still-running
+// job. It holds the jobs RLock only long enough to iterate the (small,
+// in-memory) map - the same brief-scan pattern handleListJobs already uses
+// - so a read spike here never blocks a job update.
+func (s *Server) jobSummary() map[string]any {
+	s.jobsMu.RLock()
+	defer s.jobsMu.RUnlock()
+
+	byStatus := make(map[string]int)
+	var oldestRunning *Job
+	for _, j := range s.jobs {
+		byStatus[j.Status]++
+		if j.Status == "running" && (oldestRunning == nil || j.StartTime.Before(oldestRunning.StartTime)) {
+			oldestRunning = j
+		}
+	}
+
+	summary := map[string]any{"by_status": byStatus}
+	if oldestRunning != nil {
+		summary["oldest_running"] = map[string]any{
+			"id":      oldestRunning.ID,
+			"type":    oldestRunning.Type,
+			"host":    oldestRunning.Host,
+			"elapsed": time.Since(oldestRunning.StartTime).String(),
+		}
+	}
+	return summary
+}
+
+// webhookSummary reports the outbound webhook queue's depth and lifetime
+// sent/failed counts. webhookSent/webhookFailed are atomics updated only by
+// runWebhookQueue, so this never contends with delivery.
+func (s *Server) webhookSummary() map[string]any {
+	return map[string]any{
+		"queue_depth": len(s.webhookQueue),
+		"sent":        s.webhookSent.Load(),
+		"failed":      s.webhookFailed.Load(),
+	}
+}
+
 func (s *Server) handleListHosts(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	hosts := s.inventory.AllHosts()
-	result := make([]map[string]any, 0, len(hosts))
+	result := make([]api.HostSummary, 0, len(hosts))
 
 	// Check pull mode status for hosts
 	installer := pullmode.NewInstaller()
 
 	for _, h := range hosts {
-		hostData := map[string]any{
-			"name":     h.Name,
-			"addr":     h.Addr,
-			"port":     h.SSHPort,
-			"base":     h.Base,
-			"roles":    h.Roles,
-			"ssh_user": h.SSHUser,
+		hostData := api.HostSummary{
+			Name:       h.Name,
+			Addr:       h.Addr,
+			Port:       h.SSHPort,
+			Base:       h.Base,
+			Roles:      h.Roles,
+			SSHUser:    h.SSHUser,
+			K0sMonitor: h.K0sMonitor.Enabled,
+			Groups:     s.inventory.GroupsForHost(h),
+		}
+
+		// If the background prober has this host marked down, trust it and
+		// skip the live connection attempt rather than waiting out a timeout.
+		if s.prober != nil {
+			if online, since, availability, ok := s.prober.Get(h.Name); ok {
+				hostData.Since = since
+				hostData.Availability24h = availability
+				if !online {
+					hostData.Online = false
+					result = append(result, hostData)
+					continue
+				}
+			}
 		}
 
 		// Try to get connection and state
 		client, err := s.pool.GetWithUser(ctx, h.Addr, h.SSHPort, h.SSHUser)
 		if err != nil {
-			hostData["online"] = false
-			hostData["error"] = err.Error()
+			hostData.Online = false
+			hostData.Error = err.Error()
 		} else {
-			hostData["online"] = true
+			hostData.Online = true
 
 			// Get host state
 			hostState, _ := s.stateMgr.ReadState(ctx, client)
 			if hostState != nil {
-				hostData["drift_detected"] = hostState.DriftDetected
-				hostData["last_apply"] = hostState.LastApply
-				hostData["last_drift_check"] = hostState.LastDriftCheck
-				hostData["generation"] = hostState.CurrentGeneration
-				hostData["healthy"] = !hostState.DriftDetected
+				hostData.DriftDetected = hostState.DriftDetected
+				hostData.LastApply = hostState.LastApply
+				hostData.LastDriftCheck = hostState.LastDriftCheck
+				hostData.Generation = hostState.CurrentGeneration
+				hostData.Healthy = !hostState.DriftDetected
 			}
 
 			// Check pull mode status
 			status, err := installer.Status(ctx, client)
 			if err == nil && status.Installed {
-				hostData["pull_mode"] = true
+				hostData.PullMode = true
 			}
 		}
 
 		result = append(result, hostData)
 	}
 
-	s.jsonResponse(w, map[string]any{"hosts": result}, http.StatusOK)
+	s.jsonResponse(w, api.HostList{Hosts: result}, http.StatusOK)
 }
 
 func (s *Server) handleGetHost(w http.ResponseWriter, r *http.Request) {
@@ -305,20 +943,25 @@ func (s *Server) handleGetHost(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	installer := pullmode.NewInstaller()
 
+	override, hasOverride := s.overrides.Get(name)
+
 	// Get connection and state
 	client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 	if err != nil {
-		s.jsonResponse(w, map[string]any{
-			"name":      host.Name,
-			"addr":      host.Addr,
-			"port":      host.SSHPort,
-			"base":      host.Base,
-			"ssh_user":  host.SSHUser,
-			"roles":     host.Roles,
-			"online":    false,
-			"pull_mode": false,
-			"error":     err.Error(),
-		}, http.StatusOK)
+		errResult := api.HostDetail{
+			Name:    host.Name,
+			Addr:    host.Addr,
+			Port:    host.SSHPort,
+			Base:    host.Base,
+			SSHUser: host.SSHUser,
+			Roles:   host.Roles,
+			Online:  false,
+			Error:   err.Error(),
+		}
+		if hasOverride {
+			errResult.Override = override
+		}
+		s.jsonResponse(w, errResult, http.StatusOK)
 		return
 	}
 
@@ -331,36 +974,38 @@ func (s *Server) handleGetHost(w http.ResponseWriter, r *http.Request) {
 
 	// Check pull mode status
 	pullModeEnabled := false
-	var pullModeStatus map[string]any
+	var pullModeStatus *api.PullModeStatus
 	if status, err := installer.Status(ctx, client); err == nil {
 		pullModeEnabled = status.Installed
 		if status.Installed {
-			pullModeStatus = map[string]any{
-				"timer_active":   status.TimerActive,
-				"last_run":       strings.TrimSpace(status.LastRun),
-				"last_result":    strings.TrimSpace(status.LastResult),
-				"next_run":       strings.TrimSpace(status.NextRun),
-				"current_commit": strings.TrimSpace(status.CurrentCommit),
+			pullModeStatus = &api.PullModeStatus{
+				Installed:     status.Installed,
+				TimerActive:   status.TimerActive,
+				LastRun:       strings.TrimSpace(status.LastRun),
+				LastResult:    strings.TrimSpace(status.LastResult),
+				NextRun:       strings.TrimSpace(status.NextRun),
+				CurrentCommit: strings.TrimSpace(status.CurrentCommit),
 			}
 		}
 	}
 
-	result := map[string]any{
-		"name":       host.Name,
-		"addr":       host.Addr,
-		"port":       host.SSHPort,
-		"base":       host.Base,
-		"ssh_user":   host.SSHUser,
-		"roles":      host.Roles,
-		"online":     true,
-		"generation": gen,
-		"store_path": storePath,
-		"reboot":     reboot,
-		"pull_mode":  pullModeEnabled,
+	result := api.HostDetail{
+		Name:       host.Name,
+		Addr:       host.Addr,
+		Port:       host.SSHPort,
+		Base:       host.Base,
+		SSHUser:    host.SSHUser,
+		Roles:      host.Roles,
+		Online:     true,
+		Generation: gen,
+		StorePath:  storePath,
+		Reboot:     reboot,
+		PullMode:   pullModeEnabled,
+		K0sMonitor: host.K0sMonitor.Enabled,
 	}
 
 	if pullModeStatus != nil {
-		result["pull_mode_status"] = pullModeStatus
+		result.PullModeStatus = pullModeStatus
 	}
 
 	// Only include non-empty state fields
@@ -394,11 +1039,18 @@ func (s *Server) handleGetHost(w http.ResponseWriter, r *http.Request) {
 		if hostState.SecurityUpdates > 0 {
 			stateData["security_updates"] = hostState.SecurityUpdates
 		}
+		if len(hostState.Annotations) > 0 {
+			stateData["annotations"] = hostState.Annotations
+		}
 		if len(stateData) > 0 {
-			result["state"] = stateData
+			result.State = stateData
 		}
 	}
 
+	if hasOverride {
+		result.Override = override
+	}
+
 	s.jsonResponse(w, result, http.StatusOK)
 }
 
@@ -422,6 +1074,7 @@ func (s *Server) handleGetHostState(w http.ResponseWriter, r *http.Request) {
 		s.jsonError(w, "failed to read state: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.searchCache.UpdateState(name, hostState.ManagedFiles, hostState.StorePath)
 
 	s.jsonResponse(w, hostState, http.StatusOK)
 }
@@ -434,17 +1087,229 @@ func (s *Server) handleApplyHost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if report := s.evaluateReadiness(r.Context()); !report.Ready {
+		s.jsonResponse(w, report, http.StatusServiceUnavailable)
+		return
+	}
+
 	// Create async job
 	job := s.createJob("apply", name)
 
 	go func() {
-		ctx := context.Background()
+		ctx := logging.WithHost(logging.WithJobID(logging.ContextWithLogger(context.Background(), s.logger), job.ID), name)
 		s.runApplyJob(ctx, job, host)
 	}()
 
 	s.jsonResponse(w, job, http.StatusAccepted)
 }
 
+// handleSetHostOverride sets or replaces the deployment override for a
+// host: {"flake_ref": "...", "frozen": true, "reason": "...", "expires":
+// "2026-01-01T00:00:00Z"}. All fields are optional except that at least
+// one of frozen/flake_ref should be meaningful.
+func (s *Server) handleSetHostOverride(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := s.inventory.GetHost(name); !ok {
+		s.jsonError(w, "host not found", http.StatusNotFound)
+		return
+	}
+
+	var override HostOverride
+	if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+		s.jsonError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.overrides.Set(name, override); err != nil {
+		s.jsonError(w, "failed to save override: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.jsonResponse(w, override, http.StatusOK)
+}
+
+// handleClearHostOverride removes a host's deployment override, if any.
+func (s *Server) handleClearHostOverride(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := s.inventory.GetHost(name); !ok {
+		s.jsonError(w, "host not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.overrides.Clear(name); err != nil {
+		s.jsonError(w, "failed to clear override: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.jsonResponse(w, map[string]any{"cleared": true}, http.StatusOK)
+}
+
+// createApprovalRequest is the POST /api/approvals body: secret_name,
+// operation, requester, expires_at, and requester_signature are all
+// required; purpose is recommended but not enforced server-side.
+// requester_signature must be produced by the CLI's 'approvals request
+// --identity', signing the exact same binding fields (including
+// expires_at) that the server reconstructs here - the server can't pick
+// its own expiry the way it used to, since that would no longer match
+// what the requester signed.
+type createApprovalRequest struct {
+	SecretName         string            `json:"secret_name"`
+	Operation          secrets.Operation `json:"operation"`
+	Requester          string            `json:"requester"`
+	RequesterSignature string            `json:"requester_signature"`
+	Purpose            string            `json:"purpose"`
+	ExpiresAt          time.Time         `json:"expires_at"`
+}
+
+// handleCreateApproval records a new two-person-rule approval request for a
+// requiresApproval secret. It doesn't check secrets.nix itself - the CLI
+// already resolved that the secret needs approval before calling this -
+// but it does require and verify requester_signature against
+// Config.ApprovalAllowedSigners before storing anything, the same way
+// handleGrantApproval verifies a grant eagerly: without this, Requester
+// would be an arbitrary unauthenticated string and the two-person rule
+// would be bypassable by one actor with two self-chosen names.
+func (s *Server) handleCreateApproval(w http.ResponseWriter, r *http.Request) {
+	var body createApprovalRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.jsonError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.SecretName == "" || body.Operation == "" || body.Requester == "" || body.ExpiresAt.IsZero() {
+		s.jsonError(w, "secret_name, operation, requester, and expires_at are required", http.StatusBadRequest)
+		return
+	}
+	if body.RequesterSignature == "" {
+		s.jsonError(w, "requester_signature is required - sign the request with 'nixfleet approvals request --identity'", http.StatusBadRequest)
+		return
+	}
+	if s.config.ApprovalAllowedSigners == "" {
+		s.jsonError(w, "server has no ApprovalAllowedSigners configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	req := &secrets.ApprovalRequest{
+		SecretName:         body.SecretName,
+		Operation:          body.Operation,
+		Requester:          body.Requester,
+		Purpose:            body.Purpose,
+		CreatedAt:          time.Now(),
+		ExpiresAt:          body.ExpiresAt,
+		RequesterSignature: body.RequesterSignature,
+	}
+	req.SetID()
+
+	ok, err := secrets.VerifyRequesterSignature(r.Context(), req, s.config.ApprovalAllowedSigners)
+	if err != nil {
+		s.jsonError(w, "verifying requester signature: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		log.Printf("Approvals: rejected request with invalid requester signature from %q", body.Requester)
+		s.jsonError(w, "requester signature did not verify", http.StatusForbidden)
+		return
+	}
+
+	if err := s.approvals.Create(req); err != nil {
+		s.jsonError(w, "failed to create approval: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Approvals: %s requested %s on secret %q (id=%s, expires=%s)", req.Requester, req.Operation, req.SecretName, req.ID, req.ExpiresAt)
+	s.jsonResponse(w, req, http.StatusCreated)
+}
+
+// handleListApprovals returns every stored approval request, newest first.
+func (s *Server) handleListApprovals(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, map[string]any{"approvals": s.approvals.List()}, http.StatusOK)
+}
+
+// handleGetApproval returns a single approval request by ID.
+func (s *Server) handleGetApproval(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	req, ok := s.approvals.Get(id)
+	if !ok {
+		s.jsonError(w, "approval request not found", http.StatusNotFound)
+		return
+	}
+	s.jsonResponse(w, req, http.StatusOK)
+}
+
+// handleGrantApproval records a second admin's countersignature on an
+// approval request. It rejects a grant from the requester themselves, an
+// expired request, and a signature that doesn't verify against
+// Config.ApprovalAllowedSigners - the same checks ApprovalRequest.HasValidGrant
+// makes, but performed eagerly so a bad grant is reported at grant time
+// rather than silently accepted and only caught later.
+func (s *Server) handleGrantApproval(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	req, ok := s.approvals.Get(id)
+	if !ok {
+		s.jsonError(w, "approval request not found", http.StatusNotFound)
+		return
+	}
+
+	var grant secrets.Grant
+	if err := json.NewDecoder(r.Body).Decode(&grant); err != nil {
+		s.jsonError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.IsExpired() {
+		s.jsonError(w, "approval request has expired", http.StatusGone)
+		return
+	}
+	if grant.Signer == req.Requester {
+		s.jsonError(w, "the requester cannot grant their own approval", http.StatusForbidden)
+		return
+	}
+	if s.config.ApprovalAllowedSigners == "" {
+		s.jsonError(w, "server has no ApprovalAllowedSigners configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	ok, err := secrets.VerifyGrant(r.Context(), req, grant, s.config.ApprovalAllowedSigners)
+	if err != nil {
+		s.jsonError(w, "verifying grant: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		log.Printf("Approvals: rejected invalid grant from %q on %s", grant.Signer, id)
+		s.jsonError(w, "grant signature did not verify", http.StatusForbidden)
+		return
+	}
+
+	updated, err := s.approvals.AddGrant(id, grant)
+	if err != nil {
+		s.jsonError(w, "failed to record grant: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Approvals: %s granted %s on secret %q (id=%s)", grant.Signer, req.Operation, req.SecretName, id)
+	s.jsonResponse(w, updated, http.StatusOK)
+}
+
+// handleK0sSummary returns the latest collected cluster-health snapshot for
+// a k0s controller host. It 404s if the host doesn't exist, isn't
+// configured with K0sMonitor.Enabled, or hasn't had a snapshot collected
+// yet - all three look the same from the caller's perspective: there's
+// nothing to show.
+func (s *Server) handleK0sSummary(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("controller")
+	host, ok := s.inventory.GetHost(name)
+	if !ok || !host.K0sMonitor.Enabled {
+		s.jsonError(w, "no k0s monitoring configured for this host", http.StatusNotFound)
+		return
+	}
+
+	summary, ok := s.k0sSummaries.Get(name)
+	if !ok {
+		s.jsonError(w, "no k0s summary collected yet for this host", http.StatusNotFound)
+		return
+	}
+	s.jsonResponse(w, summary, http.StatusOK)
+}
+
 func (s *Server) handleRollbackHost(w http.ResponseWriter, r *http.Request) {
 	name := r.PathValue("name")
 	host, ok := s.inventory.GetHost(name)
@@ -485,30 +1350,30 @@ func (s *Server) handleDriftStatus(w http.ResponseWriter, r *http.Request) {
 		hosts = s.inventory.HostsInGroup(group)
 	}
 
-	results := make([]map[string]any, 0)
+	results := make([]api.DriftHostStatus, 0)
 
 	for _, host := range hosts {
 		client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 		if err != nil {
-			results = append(results, map[string]any{
-				"host":   host.Name,
-				"online": false,
-				"error":  err.Error(),
+			results = append(results, api.DriftHostStatus{
+				Host:   host.Name,
+				Online: false,
+				Error:  err.Error(),
 			})
 			continue
 		}
 
 		hostState, _ := s.stateMgr.ReadState(ctx, client)
 
-		result := map[string]any{
-			"host":   host.Name,
-			"online": true,
+		result := api.DriftHostStatus{
+			Host:   host.Name,
+			Online: true,
 		}
 
 		if hostState != nil {
-			result["drift_detected"] = hostState.DriftDetected
-			result["drift_files"] = hostState.DriftFiles
-			result["last_check"] = hostState.LastDriftCheck
+			result.DriftDetected = hostState.DriftDetected
+			result.DriftFiles = hostState.DriftFiles
+			result.LastCheck = hostState.LastDriftCheck
 		}
 
 		results = append(results, result)
@@ -540,7 +1405,7 @@ func (s *Server) handleDriftCheck(w http.ResponseWriter, r *http.Request) {
 	job := s.createJob("drift-check", "")
 
 	go func() {
-		ctx := context.Background()
+		ctx := logging.WithJobID(logging.ContextWithLogger(context.Background(), s.logger), job.ID)
 		s.runDriftCheckJob(ctx, job, hosts)
 	}()
 
@@ -593,22 +1458,72 @@ func (s *Server) handleDriftFix(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	s.jsonResponse(w, map[string]any{
-		"fixed":   fixed,
-		"checked": len(results),
+	s.jsonResponse(w, api.DriftFixResult{
+		Fixed:   fixed,
+		Checked: len(results),
 	}, http.StatusOK)
 }
 
+// handleListJobs serves GET /api/jobs, optionally filtered by ?type=,
+// ?status=, ?host= and paginated with ?page= (1-based, default 1) and
+// ?per_page= (default 50, capped at 200). Jobs are sorted newest-first by
+// StartTime so the first page is the one an operator actually wants.
 func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
-	s.jobsMu.RLock()
-	defer s.jobsMu.RUnlock()
+	typeFilter := r.URL.Query().Get("type")
+	statusFilter := r.URL.Query().Get("status")
+	hostFilter := r.URL.Query().Get("host")
 
-	jobs := make([]*Job, 0, len(s.jobs))
+	s.jobsMu.RLock()
+	jobs := make([]Job, 0, len(s.jobs))
 	for _, j := range s.jobs {
-		jobs = append(jobs, j)
+		if typeFilter != "" && j.Type != typeFilter {
+			continue
+		}
+		if statusFilter != "" && j.Status != statusFilter {
+			continue
+		}
+		if hostFilter != "" && j.Host != hostFilter {
+			continue
+		}
+		jobs = append(jobs, *j)
+	}
+	s.jobsMu.RUnlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartTime.After(jobs[j].StartTime)
+	})
+
+	page := 1
+	if v, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && v > 0 {
+		page = v
+	}
+	perPage := 50
+	if v, err := strconv.Atoi(r.URL.Query().Get("per_page")); err == nil && v > 0 {
+		perPage = v
+	}
+	if perPage > 200 {
+		perPage = 200
+	}
+
+	total := len(jobs)
+	start := (page - 1) * perPage
+	if start > total {
+		start = total
+	}
+	end := start + perPage
+	if end > total {
+		end = total
 	}
 
-	s.jsonResponse(w, jobs, http.StatusOK)
+	s.jsonResponse(w, api.JobList{
+		Jobs: jobs[start:end],
+		Pagination: api.Pagination{
+			Page:    page,
+			PerPage: perPage,
+			Total:   total,
+			HasMore: end < total,
+		},
+	}, http.StatusOK)
 }
 
 func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
@@ -626,6 +1541,167 @@ func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
 	s.jsonResponse(w, job, http.StatusOK)
 }
 
+// handleGetJobLogs returns the structured log records captured for a job
+// (see internal/logging.JobLogStore), oldest first. Defaults to one plain
+// text line per record; ?format=json returns the full Record list.
+func (s *Server) handleGetJobLogs(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	s.jobsMu.RLock()
+	_, ok := s.jobs[id]
+	s.jobsMu.RUnlock()
+
+	if !ok {
+		s.jsonError(w, "job not found", http.StatusNotFound)
+		return
+	}
+
+	records := s.jobLogs.Get(id)
+
+	if r.URL.Query().Get("format") == "json" {
+		s.jsonResponse(w, records, http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, rec := range records {
+		fmt.Fprintf(w, "%s [%s] %s\n", rec.Time.Format(time.RFC3339), rec.Level, rec.Message)
+	}
+}
+
+// jobEventsPollInterval is how often handleGetJobEvents checks for new log
+// records and status changes on a still-running job.
+const jobEventsPollInterval = 250 * time.Millisecond
+
+// handleGetJobEvents streams a job's status transitions and captured log
+// records (see internal/logging.JobLogStore) as Server-Sent Events. A
+// client connecting to a job that has already reached a terminal status
+// gets the full history in one burst, immediately followed by a "done"
+// event and stream close - it never blocks waiting for a tail that will
+// never arrive. A client connecting to a still-running job gets the
+// history so far, then polls for new log records and the terminal status,
+// closing the stream itself once the job finishes.
+func (s *Server) handleGetJobEvents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	s.jobsMu.RLock()
+	job, ok := s.jobs[id]
+	s.jobsMu.RUnlock()
+	if !ok {
+		s.jsonError(w, "job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	ticker := time.NewTicker(jobEventsPollInterval)
+	defer ticker.Stop()
+
+	sent := 0
+	lastStatus := ""
+	for {
+		records := s.jobLogs.Get(id)
+		for _, rec := range records[sent:] {
+			writeSSEEvent(w, "log", rec)
+		}
+		sent = len(records)
+
+		s.jobsMu.RLock()
+		status, result, errStr := job.Status, job.Result, job.Error
+		s.jobsMu.RUnlock()
+
+		if status != lastStatus {
+			writeSSEEvent(w, "status", map[string]string{"status": status})
+			lastStatus = status
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		if jobTerminal(status) {
+			writeSSEEvent(w, "done", map[string]any{
+				"status": status,
+				"result": result,
+				"error":  errStr,
+			})
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeSSEEvent writes one Server-Sent Event with the given event name and
+// a JSON-encoded data payload. Errors marshaling data are dropped rather
+// than surfaced - there's no response status left to report them on once
+// the stream has started.
+func writeSSEEvent(w http.ResponseWriter, event string, data any) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+}
+
+// handleStats returns aggregates over the persisted job history for the
+// given ?window= (default 1h), e.g. jobs completed/failed and average apply
+// duration, so capacity trends can be graphed externally.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	window := 1 * time.Hour
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			s.jsonError(w, fmt.Sprintf("invalid window %q: %v", raw, err), http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+
+	s.jsonResponse(w, s.jobHistory.Stats(window), http.StatusOK)
+}
+
+// impactFields classifies the disruption of replacing currentStorePath with
+// desiredStorePath on host and returns the plan API fields describing it, or
+// nil if no assessment could be made (e.g. currentStorePath no longer exists
+// locally). See internal/impact.
+func (s *Server) impactFields(host *inventory.Host, currentStorePath, desiredStorePath string) map[string]any {
+	if currentStorePath == "" || currentStorePath == desiredStorePath {
+		return nil
+	}
+	current, err := impact.ManifestForStorePath(currentStorePath, host.Base)
+	if err != nil {
+		return nil
+	}
+	desired, err := impact.ManifestForStorePath(desiredStorePath, host.Base)
+	if err != nil {
+		return nil
+	}
+	assessment := impact.Classify(current, desired, s.inventory.CriticalUnits)
+
+	fields := map[string]any{"level": assessment.Level}
+	if len(assessment.ChangedUnits) > 0 {
+		fields["changed_units"] = assessment.ChangedUnits
+	}
+	if len(assessment.RebootReasons) > 0 {
+		fields["reboot_reasons"] = assessment.RebootReasons
+	}
+	if assessment.Escalate() {
+		fields["critical_units"] = assessment.CriticalUnits
+	}
+	return fields
+}
+
 func (s *Server) handlePlan(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	hosts := s.inventory.AllHosts()
@@ -635,6 +1711,13 @@ func (s *Server) handlePlan(w http.ResponseWriter, r *http.Request) {
 		hosts = s.inventory.HostsInGroup(group)
 	}
 
+	order := parseOrder(r, s.inventory)
+	stages := s.inventory.ComputeStages(hosts, order)
+	stageInfo := make([]map[string]any, len(stages))
+	for i, stage := range stages {
+		stageInfo[i] = map[string]any{"name": stage.Name, "hosts": stage.HostNames()}
+	}
+
 	results := make([]map[string]any, 0)
 
 	for _, host := range hosts {
@@ -643,7 +1726,23 @@ func (s *Server) handlePlan(w http.ResponseWriter, r *http.Request) {
 			"base": host.Base,
 		}
 
-		closure, err := s.evaluator.BuildHost(ctx, host.Name, host.Base)
+		override, hasOverride := s.overrides.Get(host.Name)
+		if hasOverride {
+			result["override"] = override
+		}
+		if hasOverride && override.Frozen {
+			result["status"] = "frozen"
+			results = append(results, result)
+			continue
+		}
+
+		var closure *nix.HostClosure
+		var err error
+		if hasOverride && override.FlakeRef != "" {
+			closure, err = s.evaluator.BuildHostFromFlake(ctx, override.FlakeRef, host.Name, host.Base)
+		} else {
+			closure, err = s.evaluator.BuildHost(ctx, host.Name, host.Base)
+		}
 		if err != nil {
 			result["error"] = err.Error()
 			results = append(results, result)
@@ -666,6 +1765,9 @@ func (s *Server) handlePlan(w http.ResponseWriter, r *http.Request) {
 				} else {
 					result["status"] = "changes_pending"
 					result["current_hash"] = hostState.ManifestHash
+					if fields := s.impactFields(host, hostState.StorePath, closure.StorePath); fields != nil {
+						result["impact"] = fields
+					}
 				}
 			} else {
 				result["status"] = "new_deployment"
@@ -675,7 +1777,12 @@ func (s *Server) handlePlan(w http.ResponseWriter, r *http.Request) {
 		results = append(results, result)
 	}
 
-	s.jsonResponse(w, results, http.StatusOK)
+	response := map[string]any{"hosts": results}
+	if len(stages) > 1 {
+		response["stages"] = stageInfo
+	}
+
+	s.jsonResponse(w, response, http.StatusOK)
 }
 
 func (s *Server) handlePlanHost(w http.ResponseWriter, r *http.Request) {
@@ -688,7 +1795,23 @@ func (s *Server) handlePlanHost(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 
-	closure, err := s.evaluator.BuildHost(ctx, host.Name, host.Base)
+	override, hasOverride := s.overrides.Get(name)
+	if hasOverride && override.Frozen {
+		s.jsonResponse(w, map[string]any{
+			"host":     host.Name,
+			"status":   "frozen",
+			"override": override,
+		}, http.StatusOK)
+		return
+	}
+
+	var closure *nix.HostClosure
+	var err error
+	if hasOverride && override.FlakeRef != "" {
+		closure, err = s.evaluator.BuildHostFromFlake(ctx, override.FlakeRef, host.Name, host.Base)
+	} else {
+		closure, err = s.evaluator.BuildHost(ctx, host.Name, host.Base)
+	}
 	if err != nil {
 		s.jsonError(w, "build failed: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -702,6 +1825,9 @@ func (s *Server) handlePlanHost(w http.ResponseWriter, r *http.Request) {
 		"manifest_hash": closure.ManifestHash,
 		"closure_size":  size,
 	}
+	if hasOverride {
+		result["override"] = override
+	}
 
 	client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 	if err != nil {
@@ -715,6 +1841,9 @@ func (s *Server) handlePlanHost(w http.ResponseWriter, r *http.Request) {
 				result["status"] = "changes_pending"
 				result["current_hash"] = hostState.ManifestHash
 				result["current_path"] = hostState.StorePath
+				if fields := s.impactFields(host, hostState.StorePath, closure.StorePath); fields != nil {
+					result["impact"] = fields
+				}
 			}
 		} else {
 			result["status"] = "new_deployment"
@@ -724,6 +1853,24 @@ func (s *Server) handlePlanHost(w http.ResponseWriter, r *http.Request) {
 	s.jsonResponse(w, result, http.StatusOK)
 }
 
+// buildHostWithOverride builds host from its override's flake_ref when one
+// is set, otherwise from the server's configured working-tree flake.
+func (s *Server) buildHostWithOverride(ctx context.Context, host *inventory.Host) (*nix.HostClosure, error) {
+	if override, ok := s.overrides.Get(host.Name); ok && override.FlakeRef != "" {
+		return s.evaluator.BuildHostFromFlake(ctx, override.FlakeRef, host.Name, host.Base)
+	}
+	return s.evaluator.BuildHost(ctx, host.Name, host.Base)
+}
+
+// parseOrder reads the "order" query param (comma-separated group names),
+// falling back to the inventory's apply_order when absent.
+func parseOrder(r *http.Request, inv *inventory.Inventory) []string {
+	if raw := r.URL.Query().Get("order"); raw != "" {
+		return strings.Split(raw, ",")
+	}
+	return inv.ApplyOrder
+}
+
 func (s *Server) handleApplyAll(w http.ResponseWriter, r *http.Request) {
 	group := r.URL.Query().Get("group")
 
@@ -739,11 +1886,25 @@ func (s *Server) handleApplyAll(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if report := s.evaluateReadiness(r.Context()); !report.Ready {
+		s.jsonResponse(w, report, http.StatusServiceUnavailable)
+		return
+	}
+
+	stages := s.inventory.ComputeStages(hosts, parseOrder(r, s.inventory))
+
+	stageMaxFailures := -1
+	if raw := r.URL.Query().Get("stage_max_failures"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil {
+			stageMaxFailures = n
+		}
+	}
+
 	job := s.createJob("apply-all", "")
 
 	go func() {
-		ctx := context.Background()
-		s.runApplyAllJob(ctx, job, hosts)
+		ctx := logging.WithJobID(logging.ContextWithLogger(context.Background(), s.logger), job.ID)
+		s.runApplyAllJob(ctx, job, stages, stageMaxFailures)
 	}()
 
 	s.jsonResponse(w, job, http.StatusAccepted)
@@ -764,36 +1925,146 @@ func (s *Server) createJob(jobType, host string) *Job {
 	s.jobsMu.Lock()
 	s.jobs[id] = job
 	s.jobsMu.Unlock()
+	s.persistJobs()
 
 	return job
 }
 
+// jobTerminal reports whether status is one a job doesn't leave once
+// reached - it stops counting toward runningJobCount, gets an EndTime, and
+// is recorded to jobHistory.
+func jobTerminal(status string) bool {
+	return status == "completed" || status == "failed" || status == "interrupted"
+}
+
 func (s *Server) updateJob(job *Job, status string, result any, errStr string) {
 	s.jobsMu.Lock()
-	defer s.jobsMu.Unlock()
-
 	job.Status = status
 	job.Result = result
 	job.Error = errStr
-	if status == "completed" || status == "failed" {
+	if jobTerminal(status) {
 		job.EndTime = time.Now()
 	}
+	s.jobsMu.Unlock()
+	s.persistJobs()
+
+	if jobTerminal(status) {
+		s.jobHistory.Record(JobHistoryEntry{
+			Type:      job.Type,
+			Status:    job.Status,
+			Host:      job.Host,
+			StartTime: job.StartTime,
+			EndTime:   job.EndTime,
+		})
+		s.drainStore.Clear(job.ID)
+
+		s.metrics.IncJob(job.Type, job.Status)
+		if job.Type == "apply" || job.Type == "apply-all" {
+			s.metrics.ObserveApplyDuration(job.EndTime.Sub(job.StartTime))
+		}
+	}
 }
 
 // Job runners
 
+// checkProvenance enforces --require-provenance: it's a no-op unless the
+// server was configured with RequireProvenance, in which case a closure
+// without a valid, matching provenance record is refused.
+func (s *Server) checkProvenance(closure *nix.HostClosure) error {
+	if !s.config.RequireProvenance {
+		return nil
+	}
+	_, err := s.provStore.RequireValid(closure.StorePath, closure.ManifestHash)
+	return err
+}
+
+// checkReadiness enforces the target-readiness probe ahead of a closure
+// copy: it's a no-op if SkipReadinessCheck is set, otherwise it connects to
+// host, probes it via cache (so a host isn't re-probed within the same
+// run), and returns the result. Callers turn a !Ready result into a clean
+// skip instead of letting the copy fail halfway through.
+func (s *Server) checkReadiness(ctx context.Context, host *inventory.Host, closure *nix.HostClosure, cache *preflight.ReadinessCache) (*preflight.ReadinessResult, error) {
+	if s.config.SkipReadinessCheck {
+		return nil, nil
+	}
+
+	client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+	if err != nil {
+		return nil, err
+	}
+
+	requiredBytes, err := s.evaluator.GetClosureSize(ctx, closure.StorePath)
+	if err != nil {
+		requiredBytes = 0
+	}
+
+	result := cache.Get(ctx, s.readinessChecker, client, requiredBytes)
+	return &result, nil
+}
+
+// recordProvenance signs and saves a provenance record for a closure that
+// was just successfully activated, and mirrors a summary of it into the
+// host's state. Failures are logged, not returned - a provenance write
+// failure shouldn't undo a successful deployment.
+func (s *Server) recordProvenance(ctx context.Context, client *ssh.Client, host *inventory.Host, closure *nix.HostClosure) {
+	rec := provenance.Capture(s.evaluator.FlakePath(), host.Name, closure.StorePath, closure.ManifestHash)
+	if err := s.provStore.Sign(ctx, rec); err != nil {
+		log.Printf("provenance: failed to sign record for %s: %v", host.Name, err)
+		return
+	}
+	if err := s.provStore.Save(rec); err != nil {
+		log.Printf("provenance: failed to save record for %s: %v", host.Name, err)
+		return
+	}
+	s.stateMgr.UpdateProvenance(ctx, client, state.ProvenanceState{
+		StorePath: rec.StorePath,
+		GitCommit: rec.GitCommit,
+		GitDirty:  rec.GitDirty,
+		Builder:   rec.Builder,
+		SignedAt:  rec.CreatedAt,
+	})
+}
+
 func (s *Server) runApplyJob(ctx context.Context, job *Job, host *inventory.Host) {
+	logger := logging.FromContext(ctx)
 	s.updateJob(job, "running", nil, "")
 
+	if override, ok := s.overrides.Get(host.Name); ok && override.Frozen {
+		s.updateJob(job, "completed", map[string]any{
+			"skipped": true,
+			"reason":  override.Reason,
+		}, "")
+		return
+	}
+
 	startTime := time.Now()
 
 	// Build
-	closure, err := s.evaluator.BuildHost(ctx, host.Name, host.Base)
+	closure, err := s.buildHostWithOverride(ctx, host)
 	if err != nil {
 		s.updateJob(job, "failed", nil, "build failed: "+err.Error())
 		return
 	}
 
+	if err := s.checkProvenance(closure); err != nil {
+		s.updateJob(job, "failed", nil, "provenance check failed: "+err.Error())
+		return
+	}
+
+	readiness, err := s.checkReadiness(ctx, host, closure, preflight.NewReadinessCache())
+	if err != nil {
+		s.updateJob(job, "failed", nil, "readiness check failed: "+err.Error())
+		return
+	}
+	if readiness != nil && !readiness.Ready {
+		s.updateJob(job, "completed", map[string]any{
+			"skipped":   true,
+			"reason":    readiness.Reason,
+			"readiness": readiness,
+		}, "")
+		return
+	}
+
 	// Copy
 	if err := s.deployer.CopyToHost(ctx, closure, host); err != nil {
 		s.updateJob(job, "failed", nil, "copy failed: "+err.Error())
@@ -807,6 +2078,8 @@ func (s *Server) runApplyJob(ctx context.Context, job *Job, host *inventory.Host
 		return
 	}
 
+	prevState, _ := s.stateMgr.ReadState(ctx, client)
+
 	switch host.Base {
 	case "ubuntu":
 		err = s.deployer.ActivateUbuntu(ctx, client, closure)
@@ -815,6 +2088,14 @@ func (s *Server) runApplyJob(ctx context.Context, job *Job, host *inventory.Host
 	}
 
 	if err != nil {
+		profilePath, _ := nix.ProfilePath(host.Base)
+		s.stateMgr.RecordGeneration(ctx, client, state.GenerationRecord{
+			ProfilePath: profilePath,
+			StorePath:   closure.StorePath,
+			Outcome:     state.GenerationFailed,
+			Note:        err.Error(),
+		})
+		logger.Warn("apply: activation failed", "error", err)
 		s.updateJob(job, "failed", nil, "activation failed: "+err.Error())
 		return
 	}
@@ -824,53 +2105,81 @@ func (s *Server) runApplyJob(ctx context.Context, job *Job, host *inventory.Host
 	// Update state
 	gen, _, _ := s.deployer.GetCurrentGeneration(ctx, client, host.Base)
 	s.stateMgr.UpdateAfterApply(ctx, client, closure.StorePath, closure.ManifestHash, gen, duration)
+	profilePath, _ := nix.ProfilePath(host.Base)
+	s.stateMgr.RecordGeneration(ctx, client, state.GenerationRecord{
+		Generation:  gen,
+		ProfilePath: profilePath,
+		StorePath:   closure.StorePath,
+		Outcome:     state.GenerationActive,
+	})
+	s.recordProvenance(ctx, client, host, closure)
 
 	// Send webhook
-	s.sendWebhook("apply", map[string]any{
-		"host":       host.Name,
-		"store_path": closure.StorePath,
-		"duration":   duration.String(),
-	})
+	s.dispatchEvent("apply", s.applyWebhookDetail(ctx, client, host, closure, prevState, duration))
 
+	logger.Info("apply: activated", "store_path", closure.StorePath, "generation", gen, "duration", duration.String())
 	s.updateJob(job, "completed", map[string]any{
 		"store_path": closure.StorePath,
 		"generation": gen,
 		"duration":   duration.String(),
+		"readiness":  readiness,
 	}, "")
 }
 
+// defaultHostOperationTimeout is used when Config.HostOperationTimeout is
+// unset, so a server started without --host-timeout still bounds per-host
+// work in fleet-wide jobs instead of letting one wedged host block the rest.
+const defaultHostOperationTimeout = 5 * time.Minute
+
+// hostOperationTimeout returns the configured per-host operation timeout,
+// or defaultHostOperationTimeout if it wasn't set.
+func (s *Server) hostOperationTimeout() time.Duration {
+	if s.config.HostOperationTimeout > 0 {
+		return s.config.HostOperationTimeout
+	}
+	return defaultHostOperationTimeout
+}
+
 func (s *Server) runDriftCheckJob(ctx context.Context, job *Job, hosts []*inventory.Host) {
 	s.updateJob(job, "running", nil, "")
 
 	results := make([]map[string]any, 0)
 	totalDrift := 0
 
-	for _, host := range hosts {
-		client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+	// checkOneHost is scoped to its own per-host timeout (see
+	// hostOperationTimeout) via a func literal so a wedged host's commands
+	// can't outlast the defer and block the hosts that come after it.
+	checkOneHost := func(host *inventory.Host) {
+		hostCtx, cancel := context.WithTimeout(logging.WithHost(ctx, host.Name), s.hostOperationTimeout())
+		defer cancel()
+
+		client, err := s.pool.GetWithUser(hostCtx, host.Addr, host.SSHPort, host.SSHUser)
 		if err != nil {
+			logging.FromContext(hostCtx).Warn("drift check: connect failed", "error", err)
 			results = append(results, map[string]any{
 				"host":  host.Name,
 				"error": err.Error(),
 			})
-			continue
+			return
 		}
 
-		hostState, err := s.stateMgr.ReadState(ctx, client)
+		hostState, err := s.stateMgr.ReadState(hostCtx, client)
 		if err != nil || len(hostState.ManagedFiles) == 0 {
 			results = append(results, map[string]any{
 				"host":   host.Name,
 				"status": "no managed files",
 			})
-			continue
+			return
 		}
 
-		driftResults, err := s.stateMgr.CheckDrift(ctx, client, hostState.ManagedFiles)
+		driftResults, err := s.stateMgr.CheckDrift(hostCtx, client, hostState.ManagedFiles)
 		if err != nil {
+			logging.FromContext(hostCtx).Warn("drift check: failed", "error", err)
 			results = append(results, map[string]any{
 				"host":  host.Name,
 				"error": err.Error(),
 			})
-			continue
+			return
 		}
 
 		driftCount := 0
@@ -886,7 +2195,10 @@ func (s *Server) runDriftCheckJob(ctx context.Context, job *Job, hosts []*invent
 		hostState.DriftDetected = driftCount > 0
 		hostState.DriftFiles = driftFiles
 		hostState.LastDriftCheck = time.Now()
-		s.stateMgr.WriteState(ctx, client, hostState)
+		s.stateMgr.WriteState(hostCtx, client, hostState)
+		s.driftHistory.Record(host.Name, hostState.LastDriftCheck, driftFiles)
+
+		logging.FromContext(hostCtx).Info("drift check: done", "drift_count", driftCount)
 
 		results = append(results, map[string]any{
 			"host":        host.Name,
@@ -897,9 +2209,13 @@ func (s *Server) runDriftCheckJob(ctx context.Context, job *Job, hosts []*invent
 		totalDrift += driftCount
 	}
 
+	for _, host := range hosts {
+		checkOneHost(host)
+	}
+
 	// Send webhook if drift detected
 	if totalDrift > 0 {
-		s.sendWebhook("drift", map[string]any{
+		s.dispatchEvent("drift", map[string]any{
 			"total_drift": totalDrift,
 			"hosts":       len(hosts),
 		})
@@ -912,126 +2228,473 @@ func (s *Server) runDriftCheckJob(ctx context.Context, job *Job, hosts []*invent
 	}, "")
 }
 
-func (s *Server) runApplyAllJob(ctx context.Context, job *Job, hosts []*inventory.Host) {
+// stagePrepResult is what prepareStage produces for one host in a stage:
+// either a closure (and the readiness report that cleared it) ready for
+// sequential activation, or a terminal outcome - frozen, a build/
+// provenance/readiness failure, or a readiness-driven skip - that belongs
+// directly in runApplyAllJob's results/completedHosts bookkeeping without
+// the host ever reaching activation.
+type stagePrepResult struct {
+	closure   *nix.HostClosure
+	readiness *preflight.ReadinessResult
+	startTime time.Time
+	outcome   map[string]any
+	failed    bool // outcome is a failure (vs. a frozen/readiness skip) - counts toward stageFailed
+}
+
+// stagePrepareParallelism bounds how many hosts in a stage build and copy
+// at once in prepareStage. Activation still happens one host at a time in
+// stage order (see runApplyAllJob) - only the build/provenance/readiness/
+// copy phases ahead of it benefit from running concurrently, since that's
+// where a slow WAN copy or a big rebuild otherwise serializes a whole stage
+// for no reason the activation ordering actually requires.
+const stagePrepareParallelism = 4
+
+// prepareStage runs build, provenance check, readiness check, and copy for
+// every host in stage concurrently (bounded by stagePrepareParallelism),
+// and returns each host's outcome keyed by host name, for runApplyAllJob to
+// walk through in order and activate. checkpoint is called from every
+// worker as it moves through phases, same as the old sequential loop did -
+// with several hosts in flight at once it records whichever phase
+// transition happens to land last, which is still a fine best-effort
+// resume hint, not a strict per-host progress log.
+func (s *Server) prepareStage(ctx context.Context, stage inventory.Stage, readinessCache *preflight.ReadinessCache, checkpoint func(host, phase string)) map[string]*stagePrepResult {
+	prepared := make(map[string]*stagePrepResult, len(stage.Hosts))
+	var mu sync.Mutex
+	sem := make(chan struct{}, stagePrepareParallelism)
+	var wg sync.WaitGroup
+
+	for _, host := range stage.Hosts {
+		wg.Add(1)
+		go func(h *inventory.Host) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			r := s.prepareStageHost(ctx, stage.Name, h, readinessCache, checkpoint)
+
+			mu.Lock()
+			prepared[h.Name] = r
+			mu.Unlock()
+		}(host)
+	}
+
+	wg.Wait()
+	return prepared
+}
+
+// prepareStageHost runs one host's frozen-check, build, provenance,
+// readiness, and copy phases for prepareStage - exactly the phases
+// runApplyAllJob's stage loop used to run inline before activation.
+func (s *Server) prepareStageHost(ctx context.Context, stageName string, host *inventory.Host, readinessCache *preflight.ReadinessCache, checkpoint func(host, phase string)) *stagePrepResult {
+	if override, ok := s.overrides.Get(host.Name); ok && override.Frozen {
+		return &stagePrepResult{outcome: map[string]any{
+			"host":    host.Name,
+			"stage":   stageName,
+			"skipped": true,
+			"reason":  override.Reason,
+		}}
+	}
+
+	hostCtx := logging.WithHost(ctx, host.Name)
+	startTime := time.Now()
+
+	checkpoint(host.Name, "build")
+	closure, err := s.buildHostWithOverride(hostCtx, host)
+	if err != nil {
+		logging.FromContext(hostCtx).Warn("apply-all: build failed", "stage", stageName, "error", err)
+		return &stagePrepResult{failed: true, outcome: map[string]any{
+			"host":  host.Name,
+			"stage": stageName,
+			"error": "build failed: " + err.Error(),
+		}}
+	}
+
+	checkpoint(host.Name, "provenance")
+	if err := s.checkProvenance(closure); err != nil {
+		return &stagePrepResult{failed: true, outcome: map[string]any{
+			"host":  host.Name,
+			"stage": stageName,
+			"error": "provenance check failed: " + err.Error(),
+		}}
+	}
+
+	checkpoint(host.Name, "readiness")
+	readiness, err := s.checkReadiness(hostCtx, host, closure, readinessCache)
+	if err != nil {
+		return &stagePrepResult{failed: true, outcome: map[string]any{
+			"host":  host.Name,
+			"stage": stageName,
+			"error": "readiness check failed: " + err.Error(),
+		}}
+	}
+	if readiness != nil && !readiness.Ready {
+		return &stagePrepResult{outcome: map[string]any{
+			"host":      host.Name,
+			"stage":     stageName,
+			"skipped":   true,
+			"reason":    readiness.Reason,
+			"readiness": readiness,
+		}}
+	}
+
+	checkpoint(host.Name, "copy")
+	if err := s.deployer.CopyToHost(hostCtx, closure, host); err != nil {
+		return &stagePrepResult{failed: true, outcome: map[string]any{
+			"host":  host.Name,
+			"stage": stageName,
+			"error": "copy failed: " + err.Error(),
+		}}
+	}
+
+	return &stagePrepResult{closure: closure, readiness: readiness, startTime: startTime}
+}
+
+// runApplyAllJob deploys each stage in order, only moving on to the next
+// stage once the current one finishes. If stageMaxFailures is >= 0 and a
+// non-final stage exceeds it, remaining stages are skipped.
+func (s *Server) runApplyAllJob(ctx context.Context, job *Job, stages []inventory.Stage, stageMaxFailures int) {
 	s.updateJob(job, "running", nil, "")
 
 	success := 0
 	failed := 0
 	results := make([]map[string]any, 0)
+	var completedHosts []string
+	var stageSummaries []map[string]any
+	readinessCache := preflight.NewReadinessCache()
+	interrupted := false
+
+	// checkpoint records where the job is right now, for a hard kill
+	// (drain timeout expired, or the process was killed without draining
+	// at all) to leave behind an accurate account instead of nothing.
+	checkpoint := func(currentHost, phase string) {
+		s.drainStore.Update(DrainCheckpoint{
+			JobID:          job.ID,
+			CompletedHosts: append([]string{}, completedHosts...),
+			CurrentHost:    currentHost,
+			CurrentPhase:   phase,
+		})
+	}
 
-	for _, host := range hosts {
-		startTime := time.Now()
-
-		closure, err := s.evaluator.BuildHost(ctx, host.Name, host.Base)
-		if err != nil {
-			results = append(results, map[string]any{
-				"host":  host.Name,
-				"error": "build failed: " + err.Error(),
-			})
-			failed++
-			continue
+stageLoop:
+	for stageIdx, stage := range stages {
+		if s.draining.Load() {
+			for _, host := range stage.Hosts {
+				results = append(results, map[string]any{
+					"host":    host.Name,
+					"stage":   stage.Name,
+					"skipped": true,
+					"reason":  "server draining",
+				})
+			}
+			interrupted = true
+			break stageLoop
 		}
 
-		if err := s.deployer.CopyToHost(ctx, closure, host); err != nil {
-			results = append(results, map[string]any{
-				"host":  host.Name,
-				"error": "copy failed: " + err.Error(),
-			})
-			failed++
-			continue
-		}
+		stageFailed := 0
+		prepared := s.prepareStage(ctx, stage, readinessCache, checkpoint)
 
-		client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
-		if err != nil {
-			results = append(results, map[string]any{
-				"host":  host.Name,
-				"error": "connection failed: " + err.Error(),
+		for _, host := range stage.Hosts {
+			prep := prepared[host.Name]
+			if prep.outcome != nil {
+				results = append(results, prep.outcome)
+				if prep.failed {
+					failed++
+					stageFailed++
+				}
+				completedHosts = append(completedHosts, host.Name)
+				continue
+			}
+
+			hostCtx, cancel := context.WithTimeout(logging.WithHost(ctx, host.Name), s.hostOperationTimeout())
+			defer cancel()
+			closure := prep.closure
+			readiness := prep.readiness
+			startTime := prep.startTime
+
+			client, err := s.pool.GetWithUser(hostCtx, host.Addr, host.SSHPort, host.SSHUser)
+			if err != nil {
+				results = append(results, map[string]any{
+					"host":  host.Name,
+					"stage": stage.Name,
+					"error": "connection failed: " + err.Error(),
+				})
+				failed++
+				stageFailed++
+				completedHosts = append(completedHosts, host.Name)
+				continue
+			}
+
+			prevState, _ := s.stateMgr.ReadState(hostCtx, client)
+
+			checkpoint(host.Name, "activate")
+			switch host.Base {
+			case "ubuntu":
+				err = s.deployer.ActivateUbuntu(hostCtx, client, closure)
+			case "nixos":
+				err = s.deployer.ActivateNixOS(hostCtx, client, closure, "switch")
+			}
+
+			if err != nil {
+				profilePath, _ := nix.ProfilePath(host.Base)
+				s.stateMgr.RecordGeneration(hostCtx, client, state.GenerationRecord{
+					ProfilePath: profilePath,
+					StorePath:   closure.StorePath,
+					Outcome:     state.GenerationFailed,
+					Note:        err.Error(),
+				})
+				results = append(results, map[string]any{
+					"host":  host.Name,
+					"stage": stage.Name,
+					"error": "activation failed: " + err.Error(),
+				})
+				logging.FromContext(hostCtx).Warn("apply-all: activation failed", "stage", stage.Name, "error", err)
+				failed++
+				stageFailed++
+				completedHosts = append(completedHosts, host.Name)
+				continue
+			}
+
+			duration := time.Since(startTime)
+			gen, _, _ := s.deployer.GetCurrentGeneration(hostCtx, client, host.Base)
+			s.stateMgr.UpdateAfterApply(hostCtx, client, closure.StorePath, closure.ManifestHash, gen, duration)
+			profilePath, _ := nix.ProfilePath(host.Base)
+			s.stateMgr.RecordGeneration(hostCtx, client, state.GenerationRecord{
+				Generation:  gen,
+				ProfilePath: profilePath,
+				StorePath:   closure.StorePath,
+				Outcome:     state.GenerationActive,
 			})
-			failed++
-			continue
-		}
+			s.recordProvenance(hostCtx, client, host, closure)
 
-		switch host.Base {
-		case "ubuntu":
-			err = s.deployer.ActivateUbuntu(ctx, client, closure)
-		case "nixos":
-			err = s.deployer.ActivateNixOS(ctx, client, closure, "switch")
-		}
+			if s.webhookConfig().Detail == "full" {
+				s.dispatchEvent("apply", s.applyWebhookDetail(hostCtx, client, host, closure, prevState, duration))
+			}
 
-		if err != nil {
 			results = append(results, map[string]any{
-				"host":  host.Name,
-				"error": "activation failed: " + err.Error(),
+				"host":       host.Name,
+				"stage":      stage.Name,
+				"success":    true,
+				"store_path": closure.StorePath,
+				"duration":   duration.String(),
+				"readiness":  readiness,
 			})
-			failed++
-			continue
+			logging.FromContext(hostCtx).Info("apply-all: activated", "stage", stage.Name, "duration", duration.String())
+			success++
+			completedHosts = append(completedHosts, host.Name)
 		}
 
-		duration := time.Since(startTime)
-		gen, _, _ := s.deployer.GetCurrentGeneration(ctx, client, host.Base)
-		s.stateMgr.UpdateAfterApply(ctx, client, closure.StorePath, closure.ManifestHash, gen, duration)
-
-		results = append(results, map[string]any{
-			"host":       host.Name,
-			"success":    true,
-			"store_path": closure.StorePath,
-			"duration":   duration.String(),
+		aborted := stageIdx < len(stages)-1 && stageMaxFailures >= 0 && stageFailed > stageMaxFailures
+		stageSummaries = append(stageSummaries, map[string]any{
+			"name":    stage.Name,
+			"failed":  stageFailed,
+			"aborted": aborted,
 		})
-		success++
+		if aborted {
+			break
+		}
 	}
 
-	s.updateJob(job, "completed", map[string]any{
-		"success": success,
-		"failed":  failed,
-		"results": results,
+	s.dispatchEvent("apply-all", map[string]any{
+		"success":     success,
+		"failed":      failed,
+		"results":     results,
+		"stages":      stageSummaries,
+		"interrupted": interrupted,
+	})
+
+	status := "completed"
+	if interrupted {
+		status = "interrupted"
+	}
+	s.updateJob(job, status, map[string]any{
+		"success":     success,
+		"failed":      failed,
+		"results":     results,
+		"stages":      stageSummaries,
+		"interrupted": interrupted,
 	}, "")
 }
 
 // Webhook support
 
+// webhookListCap bounds how many entries a package/file/unit list in a
+// webhook payload can carry, so a giant nixpkgs bump can't turn into a
+// multi-megabyte webhook.
+const webhookListCap = 50
+
+// truncatedList caps items at webhookListCap, appending a marker noting how
+// many were dropped rather than silently cutting the list short.
+func truncatedList(items []string) []string {
+	if len(items) <= webhookListCap {
+		return items
+	}
+	out := append([]string{}, items[:webhookListCap]...)
+	return append(out, fmt.Sprintf("(%d more truncated)", len(items)-webhookListCap))
+}
+
+// applyWebhookDetail builds the enriched payload for an "apply" webhook
+// event: the manifest hash and store path before and after, the
+// package-level closure diff, which managed files changed content, and
+// which systemd units were restarted as a result. prevState is the host's
+// state read just before activation; if it's nil (first apply, or the state
+// file couldn't be read) everything derived from it is simply omitted.
+func (s *Server) applyWebhookDetail(ctx context.Context, client *ssh.Client, host *inventory.Host, closure *nix.HostClosure, prevState *state.HostState, duration time.Duration) map[string]any {
+	data := map[string]any{
+		"host":           host.Name,
+		"new_store_path": closure.StorePath,
+		"new_manifest":   closure.ManifestHash,
+		"duration":       duration.String(),
+	}
+
+	if prevState == nil {
+		return data
+	}
+	data["prev_store_path"] = prevState.StorePath
+	data["prev_manifest"] = prevState.ManifestHash
+
+	if prevState.StorePath != "" && prevState.StorePath != closure.StorePath {
+		if s.evaluator.Offline() {
+			data["packages_diff"] = "skipped: offline"
+		} else if diff, err := s.evaluator.DiffClosures(ctx, prevState.StorePath, closure.StorePath); err == nil {
+			if len(diff.Added) > 0 {
+				data["packages_added"] = truncatedList(diff.Added)
+			}
+			if len(diff.Removed) > 0 {
+				data["packages_removed"] = truncatedList(diff.Removed)
+			}
+			if len(diff.Upgraded) > 0 {
+				data["packages_upgraded"] = truncatedList(diff.Upgraded)
+			}
+		}
+	}
+
+	// The activation script rewrites managed-file hashes as it applies them,
+	// so re-reading state now shows what actually changed on disk.
+	newState, err := s.stateMgr.ReadState(ctx, client)
+	if err != nil {
+		return data
+	}
+
+	var changedFiles []string
+	var restartedUnits []string
+	seenUnits := make(map[string]bool)
+	for path, fs := range newState.ManagedFiles {
+		old, ok := prevState.ManagedFiles[path]
+		if ok && old.Hash == fs.Hash {
+			continue
+		}
+		changedFiles = append(changedFiles, path)
+		for _, unit := range fs.RestartUnits {
+			if !seenUnits[unit] {
+				seenUnits[unit] = true
+				restartedUnits = append(restartedUnits, unit)
+			}
+		}
+	}
+	if len(changedFiles) > 0 {
+		data["changed_files"] = truncatedList(changedFiles)
+	}
+	if len(restartedUnits) > 0 {
+		data["restarted_units"] = truncatedList(restartedUnits)
+	}
+
+	return data
+}
+
+// dispatchEvent fans event out to the generic webhook, every configured
+// email/Slack/Matrix channel that has it enabled, and the SIEM export. It's
+// the single entry point apply, drift-check, health-check, and the prober
+// call - see sendWebhook, notify.go's notifyChannels, and siem.go's
+// sendSIEM for the three paths this wraps.
+func (s *Server) dispatchEvent(event string, data map[string]any) {
+	s.sendWebhook(event, data)
+	s.notifyChannels(event, data)
+	s.sendSIEM(event, data)
+}
+
+// webhookEvent is one queued webhook delivery.
+type webhookEvent struct {
+	event string
+	data  map[string]any
+}
+
 func (s *Server) sendWebhook(event string, data map[string]any) {
-	if s.config.WebhookURL == "" {
+	webhook := s.webhookConfig()
+	if webhook.URL == "" {
+		return
+	}
+	if !eventEnabled(webhook.Events, event) {
 		return
 	}
 
-	// Check if event is enabled
-	enabled := false
-	for _, e := range s.config.WebhookEvents {
+	select {
+	case s.webhookQueue <- webhookEvent{event: event, data: data}:
+	default:
+		// Queue is full - count it as a failure rather than blocking the
+		// caller (apply, drift check, ...) on a stuck webhook receiver.
+		s.webhookFailed.Add(1)
+		s.recordNotifyFailure("webhook", event, "queue full")
+		log.Printf("Webhook queue full, dropping %s event", event)
+	}
+}
+
+// eventEnabled reports whether event is in a channel's configured event
+// list, treating "*" as a wildcard matching everything - shared by the
+// webhook and every notification channel below.
+func eventEnabled(events []string, event string) bool {
+	for _, e := range events {
 		if e == event || e == "*" {
-			enabled = true
-			break
+			return true
 		}
 	}
-	if !enabled {
-		return
+	return false
+}
+
+// runWebhookQueue delivers queued webhook events one at a time. It's the
+// only writer of webhookSent/webhookFailed, so GET /api/info can read them
+// without any locking.
+func (s *Server) runWebhookQueue() {
+	for evt := range s.webhookQueue {
+		if s.deliverWebhook(evt) {
+			s.webhookSent.Add(1)
+		} else {
+			s.webhookFailed.Add(1)
+			s.recordNotifyFailure("webhook", evt.event, "delivery failed")
+		}
 	}
+}
 
+func (s *Server) deliverWebhook(evt webhookEvent) bool {
 	payload := map[string]any{
-		"event":     event,
+		"event":     evt.event,
 		"timestamp": time.Now(),
-		"data":      data,
+		"data":      evt.data,
 	}
 
 	jsonData, _ := json.Marshal(payload)
 
-	req, err := http.NewRequest("POST", s.config.WebhookURL, strings.NewReader(string(jsonData)))
+	webhook := s.webhookConfig()
+	req, err := http.NewRequest("POST", webhook.URL, strings.NewReader(string(jsonData)))
 	if err != nil {
 		log.Printf("Webhook error: %v", err)
-		return
+		return false
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	if s.config.WebhookSecret != "" {
-		req.Header.Set("X-Webhook-Secret", s.config.WebhookSecret)
+	if webhook.Secret != "" {
+		req.Header.Set("X-Webhook-Secret", webhook.Secret)
 	}
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("Webhook error: %v", err)
-		return
+		return false
 	}
-	resp.Body.Close()
+	defer resp.Body.Close()
+
+	return resp.StatusCode < 300
 }
 
 // Pull mode handlers
@@ -1041,38 +2704,40 @@ func (s *Server) handlePullModeStatus(w http.ResponseWriter, r *http.Request) {
 	hosts := s.inventory.AllHosts()
 
 	installer := pullmode.NewInstaller()
-	results := make([]map[string]any, 0)
+	results := make([]api.PullModeHostStatus, 0)
 
 	for _, host := range hosts {
 		client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 		if err != nil {
-			results = append(results, map[string]any{
-				"host":   host.Name,
-				"online": false,
-				"error":  err.Error(),
+			results = append(results, api.PullModeHostStatus{
+				Host:   host.Name,
+				Online: false,
+				Error:  err.Error(),
 			})
 			continue
 		}
 
 		status, err := installer.Status(ctx, client)
 		if err != nil {
-			results = append(results, map[string]any{
-				"host":   host.Name,
-				"online": true,
-				"error":  err.Error(),
+			results = append(results, api.PullModeHostStatus{
+				Host:   host.Name,
+				Online: true,
+				Error:  err.Error(),
 			})
 			continue
 		}
 
-		results = append(results, map[string]any{
-			"host":           host.Name,
-			"online":         true,
-			"installed":      status.Installed,
-			"timer_active":   status.TimerActive,
-			"last_run":       strings.TrimSpace(status.LastRun),
-			"last_result":    strings.TrimSpace(status.LastResult),
-			"next_run":       strings.TrimSpace(status.NextRun),
-			"current_commit": strings.TrimSpace(status.CurrentCommit),
+		results = append(results, api.PullModeHostStatus{
+			Host:   host.Name,
+			Online: true,
+			PullModeStatus: api.PullModeStatus{
+				Installed:     status.Installed,
+				TimerActive:   status.TimerActive,
+				LastRun:       strings.TrimSpace(status.LastRun),
+				LastResult:    strings.TrimSpace(status.LastResult),
+				NextRun:       strings.TrimSpace(status.NextRun),
+				CurrentCommit: strings.TrimSpace(status.CurrentCommit),
+			},
 		})
 	}
 
@@ -1108,8 +2773,10 @@ func (s *Server) handlePullModeTrigger(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Trigger the pull
-	if err := installer.TriggerPull(ctx, client); err != nil {
+	// Trigger the pull. ?ignore_window=true bypasses a host's transfer
+	// window gate for an emergency apply, mirroring the CLI's --ignore-window.
+	ignoreWindow := r.URL.Query().Get("ignore_window") == "true"
+	if err := installer.TriggerPull(ctx, client, ignoreWindow); err != nil {
 		s.jsonError(w, "failed to trigger pull: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -1136,7 +2803,7 @@ func (s *Server) handleGetAptUpdates(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
+	ctx := ssh.WithOperation(r.Context(), "apt check-updates")
 	client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 	if err != nil {
 		s.jsonError(w, "connection failed: "+err.Error(), http.StatusServiceUnavailable)
@@ -1175,7 +2842,7 @@ func (s *Server) handleAptUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
+	ctx := ssh.WithOperation(r.Context(), "apt update")
 	client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 	if err != nil {
 		s.jsonError(w, "connection failed: "+err.Error(), http.StatusServiceUnavailable)
@@ -1213,14 +2880,20 @@ func (s *Server) handleAptUpgrade(w http.ResponseWriter, r *http.Request) {
 	// Check for security-only flag
 	securityOnly := r.URL.Query().Get("security") == "true"
 
-	ctx := r.Context()
+	conffilePolicy, err := apt.ParseConffilePolicy(r.URL.Query().Get("conffile"))
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := ssh.WithOperation(r.Context(), "apt upgrade")
 	client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 	if err != nil {
 		s.jsonError(w, "connection failed: "+err.Error(), http.StatusServiceUnavailable)
 		return
 	}
 
-	result, err := s.aptMgr.Upgrade(ctx, client, securityOnly)
+	result, err := s.aptMgr.Upgrade(ctx, client, securityOnly, conffilePolicy)
 	if err != nil {
 		s.jsonError(w, "upgrade failed: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -1233,6 +2906,18 @@ func (s *Server) handleAptUpgrade(w http.ResponseWriter, r *http.Request) {
 		s.stateMgr.WriteState(ctx, client, hostState)
 	}
 
+	var keptConffiles []string
+	for _, d := range result.ConffileDecisions {
+		if d.Decision == "kept" {
+			keptConffiles = append(keptConffiles, d.Path)
+		}
+	}
+	if len(keptConffiles) > 0 {
+		if err := s.stateMgr.RecordConffileDrift(ctx, client, keptConffiles); err != nil {
+			log.Printf("failed to record conffile drift for %s: %v", name, err)
+		}
+	}
+
 	s.jsonResponse(w, result, http.StatusOK)
 }
 
@@ -1249,7 +2934,7 @@ func (s *Server) handleGetAptPackages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
+	ctx := ssh.WithOperation(r.Context(), "apt list-packages")
 	client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 	if err != nil {
 		s.jsonError(w, "connection failed: "+err.Error(), http.StatusServiceUnavailable)
@@ -1261,6 +2946,7 @@ func (s *Server) handleGetAptPackages(w http.ResponseWriter, r *http.Request) {
 		s.jsonError(w, "failed to get packages: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.searchCache.UpdatePackages(name, packages)
 
 	s.jsonResponse(w, map[string]any{
 		"count":    len(packages),
@@ -1281,36 +2967,47 @@ func (s *Server) handleAptInstall(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse request body
+	// Parse request body. Packages accepts plain names or "name=version"
+	// pins; Remove lets one call install and remove packages in the same
+	// apt-get transaction (see apt.Manager.Transact).
 	var req struct {
-		Package string `json:"package"`
+		Packages     []string `json:"packages"`
+		Remove       []string `json:"remove,omitempty"`
+		NoRecommends bool     `json:"no_recommends,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.jsonError(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if req.Package == "" {
-		s.jsonError(w, "package name required", http.StatusBadRequest)
+	if len(req.Packages) == 0 && len(req.Remove) == 0 {
+		s.jsonError(w, "at least one package to install or remove is required", http.StatusBadRequest)
 		return
 	}
 
-	ctx := r.Context()
+	install := make([]apt.PackageSpec, 0, len(req.Packages))
+	for _, pkg := range req.Packages {
+		install = append(install, apt.ParsePackageSpec(pkg))
+	}
+
+	ctx := ssh.WithOperation(r.Context(), "apt install")
 	client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 	if err != nil {
 		s.jsonError(w, "connection failed: "+err.Error(), http.StatusServiceUnavailable)
 		return
 	}
 
-	if err := s.aptMgr.InstallPackage(ctx, client, req.Package); err != nil {
+	result, err := s.aptMgr.Transact(ctx, client, apt.TransactionRequest{
+		Install:      install,
+		Remove:       req.Remove,
+		NoRecommends: req.NoRecommends,
+	})
+	if err != nil {
 		s.jsonError(w, "install failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	s.jsonResponse(w, map[string]string{
-		"status":  "installed",
-		"package": req.Package,
-	}, http.StatusOK)
+	s.jsonResponse(w, result, http.StatusOK)
 }
 
 func (s *Server) handleAptRemove(w http.ResponseWriter, r *http.Request) {
@@ -1328,34 +3025,32 @@ func (s *Server) handleAptRemove(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request body
 	var req struct {
-		Package string `json:"package"`
+		Packages []string `json:"packages"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.jsonError(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if req.Package == "" {
-		s.jsonError(w, "package name required", http.StatusBadRequest)
+	if len(req.Packages) == 0 {
+		s.jsonError(w, "at least one package name is required", http.StatusBadRequest)
 		return
 	}
 
-	ctx := r.Context()
+	ctx := ssh.WithOperation(r.Context(), "apt remove")
 	client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 	if err != nil {
 		s.jsonError(w, "connection failed: "+err.Error(), http.StatusServiceUnavailable)
 		return
 	}
 
-	if err := s.aptMgr.RemovePackage(ctx, client, req.Package); err != nil {
+	result, err := s.aptMgr.Transact(ctx, client, apt.TransactionRequest{Remove: req.Packages})
+	if err != nil {
 		s.jsonError(w, "remove failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	s.jsonResponse(w, map[string]string{
-		"status":  "removed",
-		"package": req.Package,
-	}, http.StatusOK)
+	s.jsonResponse(w, result, http.StatusOK)
 }
 
 func (s *Server) handleAptAutoremove(w http.ResponseWriter, r *http.Request) {
@@ -1371,7 +3066,7 @@ func (s *Server) handleAptAutoremove(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
+	ctx := ssh.WithOperation(r.Context(), "apt autoremove")
 	client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 	if err != nil {
 		s.jsonError(w, "connection failed: "+err.Error(), http.StatusServiceUnavailable)
@@ -1404,7 +3099,7 @@ func (s *Server) handleAptClean(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
+	ctx := ssh.WithOperation(r.Context(), "apt clean")
 	client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 	if err != nil {
 		s.jsonError(w, "connection failed: "+err.Error(), http.StatusServiceUnavailable)
@@ -1441,7 +3136,7 @@ func (s *Server) handleGetOSInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	osInfo, err := s.stateMgr.GatherOSInfo(ctx, client)
+	osInfo, err := s.stateMgr.GatherOSInfo(ctx, client, s.inventory.EOLOverrides)
 	if err != nil {
 		s.jsonError(w, "failed to gather OS info: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -1456,3 +3151,212 @@ func (s *Server) handleGetOSInfo(w http.ResponseWriter, r *http.Request) {
 
 	s.jsonResponse(w, osInfo, http.StatusOK)
 }
+
+// handleGetPKIScan runs a certificate inventory scan against the host,
+// records the summary in its state, and returns the full scan result -
+// unlike the stored summary, the response includes fleet-managed certs too,
+// since a caller hitting this endpoint directly likely wants the whole
+// picture, not just the findings that made it into HostState.
+func (s *Server) handleGetPKIScan(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	host, ok := s.inventory.GetHost(name)
+	if !ok {
+		s.jsonError(w, "host not found", http.StatusNotFound)
+		return
+	}
+	if s.pkiStore == nil {
+		s.jsonError(w, "PKI not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx := r.Context()
+	client, err := s.pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+	if err != nil {
+		s.jsonError(w, "connection failed: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	result, err := pki.NewScanner(s.pkiStore).ScanHost(ctx, client, nil)
+	if err != nil {
+		s.jsonError(w, "scan failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.stateMgr.UpdatePKIScan(ctx, client, result); err != nil {
+		s.jsonError(w, "failed to record scan: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.jsonResponse(w, result, http.StatusOK)
+}
+
+// pkiRequestSubmission is the body of POST /api/pki/requests: a CSR and the
+// metadata the requester wants attached to it. The admin decides the actual
+// issued validity at approval time (via 'pki requests approve'); Validity
+// here is only a request, bounded by the store's issuance policy later.
+type pkiRequestSubmission struct {
+	CSRPEM     string   `json:"csrPEM"`
+	CommonName string   `json:"commonName"`
+	SANs       []string `json:"sans,omitempty"`
+	Validity   string   `json:"validity,omitempty"`
+	CertName   string   `json:"certName,omitempty"`
+	Requester  string   `json:"requester,omitempty"`
+}
+
+// handlePKIRequestSubmit handles POST /api/pki/requests: intake for a CSR
+// generated by 'nixfleet pki request' elsewhere. Only the CSR's signature is
+// verified here - the issuance policy and the decision to sign are left
+// entirely to 'nixfleet pki requests approve', which an admin runs with the
+// CA's private key material the server doesn't have.
+func (s *Server) handlePKIRequestSubmit(w http.ResponseWriter, r *http.Request) {
+	if s.pkiStore == nil {
+		s.jsonError(w, "PKI not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	var body pkiRequestSubmission
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.jsonError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.CommonName == "" {
+		s.jsonError(w, "commonName is required", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := pki.ParseCSR([]byte(body.CSRPEM)); err != nil {
+		s.jsonError(w, "invalid CSR: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := pki.NewRequestID()
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	req := &pki.CertIntakeRequest{
+		ID:         id,
+		CSRPEM:     []byte(body.CSRPEM),
+		CommonName: body.CommonName,
+		SANs:       body.SANs,
+		Validity:   body.Validity,
+		CertName:   body.CertName,
+		Status:     pki.RequestPending,
+		Requester:  body.Requester,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(pki.DefaultRequestTTL),
+	}
+
+	if err := s.pkiStore.SaveRequest(req); err != nil {
+		s.jsonError(w, "saving request: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.jsonResponse(w, req, http.StatusCreated)
+}
+
+// handleDiscover scans ?cidr= for SSH responders (optionally authenticating
+// as ?ssh_user= to gather hostname/OS) and returns the proposed diff
+// against the running inventory - the read-only counterpart to
+// 'nixfleet discover'; writing proposed hosts into the inventory file is
+// CLI-only (--apply), since the server has no business rewriting its own
+// config file out from under an operator mid-session.
+func (s *Server) handleDiscover(w http.ResponseWriter, r *http.Request) {
+	cidr := r.URL.Query().Get("cidr")
+	if cidr == "" {
+		s.jsonError(w, "cidr is required", http.StatusBadRequest)
+		return
+	}
+
+	cfg := discover.Config{CIDR: cidr, SSHUser: r.URL.Query().Get("ssh_user")}
+	if portStr := r.URL.Query().Get("ssh_port"); portStr != "" {
+		if port, err := strconv.Atoi(portStr); err == nil {
+			cfg.SSHPort = port
+		}
+	}
+
+	responders, err := discover.Scan(r.Context(), cfg)
+	if err != nil {
+		s.jsonError(w, "scan failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	home, _ := os.UserHomeDir()
+	knownHostsFile := filepath.Join(home, ".ssh", "known_hosts")
+	diff := discover.DiffAgainstInventory(s.inventory, responders, knownHostsFile)
+
+	s.jsonResponse(w, diff, http.StatusOK)
+}
+
+// CMDB export handler
+
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		s.jsonError(w, "format must be csv or json", http.StatusBadRequest)
+		return
+	}
+
+	fields := export.Columns
+	if raw := r.URL.Query().Get("fields"); raw != "" {
+		fields = strings.Split(raw, ",")
+		if err := export.ValidateFields(fields); err != nil {
+			s.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	gatherer := export.NewGatherer(s.pool, s.stateMgr, s.pkiStore, s.inventory.EOLOverrides)
+	hosts := s.inventory.AllHosts()
+	rowFn := func(h *inventory.Host) export.Row { return gatherer.Row(r.Context(), h) }
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="fleet.csv"`)
+		if err := export.WriteCSV(w, hosts, fields, rowFn); err != nil {
+			log.Printf("export csv: %v", err)
+		}
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		if err := export.WriteJSON(w, hosts, fields, rowFn); err != nil {
+			log.Printf("export json: %v", err)
+		}
+	}
+}
+
+// handleAdminBackup streams a tar.gz snapshot of the server's data dir,
+// the same archive 'server backup' writes to a file.
+func (s *Server) handleAdminBackup(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="server-backup.tar.gz"`)
+	if _, err := s.Backup(w); err != nil {
+		log.Printf("admin backup: %v", err)
+	}
+}
+
+// handleAdminReloadConfig re-reads the server's --config file and applies
+// its reloadable subset, the HTTP equivalent of sending SIGHUP. The
+// response names exactly which sections were applied and which still need
+// a restart, matching what's logged for a SIGHUP-triggered reload.
+func (s *Server) handleAdminReloadConfig(w http.ResponseWriter, r *http.Request) {
+	result, err := s.ReloadConfig()
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.jsonResponse(w, result, http.StatusOK)
+}
+
+// handleAdminDrain triggers the same job-aware draining SIGTERM does,
+// without exiting the process - for an operator to run ahead of planned
+// maintenance on the server host and know once it's safe to proceed.
+func (s *Server) handleAdminDrain(w http.ResponseWriter, r *http.Request) {
+	result := s.Drain(s.drainTimeout())
+	s.jsonResponse(w, result, http.StatusOK)
+}
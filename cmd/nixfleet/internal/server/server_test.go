@@ -3,13 +3,17 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/nixfleet/nixfleet/internal/inventory"
+	"github.com/nixfleet/nixfleet/internal/logging"
 	"github.com/nixfleet/nixfleet/internal/ssh"
+	"github.com/nixfleet/nixfleet/pkg/api"
 )
 
 func TestConfig(t *testing.T) {
@@ -142,13 +146,21 @@ func newTestServer(t *testing.T) *TestServer {
 			ListenAddr: ":8080",
 			APIToken:   "",
 			Inventory:  inv,
+			DataDir:    t.TempDir(),
 		},
-		inventory: inv,
-		jobs:      make(map[string]*Job),
-		startTime: time.Now(),
-		mux:       http.NewServeMux(),
-		pool:      ssh.NewPool(nil),
-	}
+		inventory:    inv,
+		jobs:         make(map[string]*Job),
+		metrics:      NewMetrics(),
+		jobHistory:   NewJobHistory(t.TempDir()),
+		drainStore:   NewDrainStore(t.TempDir()),
+		webhookQueue: make(chan webhookEvent, webhookQueueSize),
+		startTime:    time.Now(),
+		mux:          http.NewServeMux(),
+		pool:         ssh.NewPool(nil),
+		logger:       slog.Default(),
+		jobLogs:      logging.NewJobLogStore(),
+	}
+	s.scheduler = NewScheduler(s)
 	s.setupRoutes()
 
 	return &TestServer{Server: s}
@@ -381,13 +393,16 @@ func TestHandleListJobs(t *testing.T) {
 		t.Errorf("Expected status 200, got %d", rec.Code)
 	}
 
-	var response []*Job
+	var response api.JobList
 	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
 		t.Fatalf("Failed to parse response: %v", err)
 	}
 
-	if len(response) != 2 {
-		t.Errorf("Expected 2 jobs, got %d", len(response))
+	if len(response.Jobs) != 2 {
+		t.Errorf("Expected 2 jobs, got %d", len(response.Jobs))
+	}
+	if response.Pagination.Total != 2 {
+		t.Errorf("Expected pagination total 2, got %d", response.Pagination.Total)
 	}
 }
 
@@ -448,6 +463,54 @@ func TestHandleGetJobNotFound(t *testing.T) {
 	}
 }
 
+func TestHandleGetJobEventsTerminal(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.jobs["job1"] = &Job{
+		ID:        "job1",
+		Type:      "apply",
+		Status:    "completed",
+		Host:      "web1",
+		StartTime: time.Now(),
+		EndTime:   time.Now(),
+		Result:    map[string]string{"store_path": "/nix/store/abc123"},
+	}
+
+	req := httptest.NewRequest("GET", "/api/jobs/job1/events", nil)
+	req.SetPathValue("id", "job1")
+	rec := httptest.NewRecorder()
+
+	ts.handleGetJobEvents(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected Content-Type 'text/event-stream', got '%s'", ct)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "event: status") {
+		t.Errorf("Expected a status event, got body: %s", body)
+	}
+	if !strings.Contains(body, "event: done") {
+		t.Errorf("Expected a done event, got body: %s", body)
+	}
+}
+
+func TestHandleGetJobEventsNotFound(t *testing.T) {
+	ts := newTestServer(t)
+
+	req := httptest.NewRequest("GET", "/api/jobs/nonexistent/events", nil)
+	req.SetPathValue("id", "nonexistent")
+	rec := httptest.NewRecorder()
+
+	ts.handleGetJobEvents(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+}
+
 func TestCreateJob(t *testing.T) {
 	ts := newTestServer(t)
 
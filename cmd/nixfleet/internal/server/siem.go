@@ -0,0 +1,106 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/siem"
+)
+
+// siemDelivery is one queued SIEM export.
+type siemDelivery struct {
+	event string
+	data  map[string]any
+}
+
+// sendSIEM queues event for SIEM export if one is configured and event is
+// in its event list, mirroring sendWebhook.
+func (s *Server) sendSIEM(event string, data map[string]any) {
+	if s.siemSender == nil {
+		return
+	}
+	if !eventEnabled(s.siemEvents(), event) {
+		return
+	}
+
+	select {
+	case s.siemQueue <- siemDelivery{event: event, data: data}:
+	default:
+		// Queue is full - count it as a failure rather than blocking the
+		// caller. A delivery that makes it into the queue but still can't
+		// reach the collector is spooled to disk instead; this path is only
+		// for when we can't even queue it.
+		s.siemFailed.Add(1)
+		s.recordNotifyFailure("siem", event, "queue full")
+		log.Printf("SIEM queue full, dropping %s event", event)
+	}
+}
+
+// siemEvents returns the current SIEM event filter, safe to call while a
+// reload is in flight.
+func (s *Server) siemEvents() []string {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.config.SIEMEvents
+}
+
+// runSIEMQueue delivers queued SIEM events one at a time. It's the only
+// writer of siemSent/siemFailed, mirroring runWebhookQueue.
+func (s *Server) runSIEMQueue() {
+	for d := range s.siemQueue {
+		if err := s.deliverSIEM(d); err != nil {
+			s.siemFailed.Add(1)
+			s.recordNotifyFailure("siem", d.event, err.Error())
+			log.Printf("SIEM delivery error: %v", err)
+		} else {
+			s.siemSent.Add(1)
+		}
+	}
+}
+
+func (s *Server) deliverSIEM(d siemDelivery) error {
+	msg, err := siem.FormatMessage(d.event, d.data, s.siemTarget.Format, s.siemHostname, time.Now())
+	if err != nil {
+		return fmt.Errorf("formatting: %w", err)
+	}
+	return s.siemSender.Send(msg)
+}
+
+// SendTestSIEM delivers a synthetic "test" event straight to target (a
+// "syslog://..." spec, see package siem), bypassing the queue and spool
+// entirely, so 'nixfleet siem test' fails loud on a bad address/format
+// instead of disappearing into a background retry.
+func SendTestSIEM(target string) error {
+	t, err := siem.ParseTarget(target)
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	msg, err := siem.FormatMessage("test", map[string]any{
+		"summary": "This is a test event from 'nixfleet siem test'.",
+	}, t.Format, hostname, time.Now())
+	if err != nil {
+		return fmt.Errorf("formatting: %w", err)
+	}
+
+	sender := siem.NewSender(*t, "")
+	defer sender.Close()
+	return sender.Send(msg)
+}
+
+// siemSummary reports the SIEM export queue's depth and lifetime sent/failed
+// counts, the siem.go equivalent of webhookSummary/notifySummary.
+func (s *Server) siemSummary() map[string]any {
+	if s.siemSender == nil {
+		return map[string]any{"configured": false}
+	}
+	return map[string]any{
+		"configured":  true,
+		"queue_depth": len(s.siemQueue),
+		"sent":        s.siemSent.Load(),
+		"failed":      s.siemFailed.Load(),
+	}
+}
@@ -0,0 +1,169 @@
+package siem
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Sender delivers syslog lines to a Target, redialing on failure and
+// spooling to disk when the collector can't be reached at all - unlike the
+// webhook/email/Slack/Matrix channels, which just count a failed delivery
+// and move on, a security team's audit trail shouldn't have a gap just
+// because their collector was down for maintenance.
+type Sender struct {
+	target    Target
+	spoolPath string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSender returns a Sender for target. spoolPath is where undelivered
+// messages are appended when the collector is unreachable; empty disables
+// spooling (a failed Send is simply reported as an error).
+func NewSender(target Target, spoolPath string) *Sender {
+	return &Sender{target: target, spoolPath: spoolPath}
+}
+
+// Send delivers msg (a complete syslog line, no trailing newline) to the
+// collector, dialing or redialing the connection as needed. On failure, msg
+// is appended to the spool file instead of being dropped, and an error is
+// still returned so the caller can count the delivery as failed.
+func (s *Sender) Send(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.trySend(msg); err != nil {
+		if spoolErr := s.spool(msg); spoolErr != nil {
+			return fmt.Errorf("%w (and spooling failed: %v)", err, spoolErr)
+		}
+		return fmt.Errorf("%w (spooled for retry)", err)
+	}
+	return nil
+}
+
+// trySend writes msg over the current connection, dialing one if needed,
+// and retries once after a fresh dial if the write fails - a half-closed
+// TCP/TLS connection usually only surfaces on the write that follows the
+// one that actually broke it.
+func (s *Sender) trySend(msg string) error {
+	if s.conn == nil {
+		if err := s.dial(); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(s.conn, "%s\n", msg); err == nil {
+		return nil
+	}
+
+	s.conn.Close()
+	s.conn = nil
+	if err := s.dial(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.conn, "%s\n", msg); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// dial opens a fresh connection to the target. UDP is "dialed" too -
+// net.Dial fixes the destination of an otherwise connectionless socket - so
+// the reconnect logic above is uniform across all three protocols.
+func (s *Sender) dial() error {
+	var conn net.Conn
+	var err error
+	switch s.target.Network {
+	case "tls":
+		conn, err = tls.Dial("tcp", s.target.Addr, &tls.Config{ServerName: hostOf(s.target.Addr)})
+	case "tcp":
+		conn, err = net.Dial("tcp", s.target.Addr)
+	default: // "udp"
+		conn, err = net.Dial("udp", s.target.Addr)
+	}
+	if err != nil {
+		return fmt.Errorf("dialing %s://%s: %w", s.target.Network, s.target.Addr, err)
+	}
+	s.conn = conn
+	return nil
+}
+
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// spool appends msg to the spool file, best-effort: this is the last resort
+// when the collector itself is unreachable, not a guaranteed-durable queue.
+func (s *Sender) spool(msg string) error {
+	if s.spoolPath == "" {
+		return fmt.Errorf("no spool file configured")
+	}
+	f, err := os.OpenFile(s.spoolPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s\n", msg)
+	return err
+}
+
+// FlushSpool resends every line in the spool file, in order, stopping at
+// the first delivery failure and re-spooling that line plus everything
+// after it for the next attempt. It returns how many lines were
+// successfully delivered. A missing spool file is not an error - it just
+// means nothing was ever spooled.
+func (s *Sender) FlushSpool() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.spoolPath == "" {
+		return 0, nil
+	}
+	data, err := os.ReadFile(s.spoolPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	trimmed := strings.TrimRight(string(data), "\n")
+	if trimmed == "" {
+		return 0, nil
+	}
+	lines := strings.Split(trimmed, "\n")
+
+	sent := 0
+	for _, line := range lines {
+		if err := s.trySend(line); err != nil {
+			remaining := strings.Join(lines[sent:], "\n") + "\n"
+			if writeErr := os.WriteFile(s.spoolPath, []byte(remaining), 0600); writeErr != nil {
+				return sent, fmt.Errorf("re-spooling after flush failure: %w", writeErr)
+			}
+			return sent, err
+		}
+		sent++
+	}
+	return sent, os.Remove(s.spoolPath)
+}
+
+// Close releases the underlying connection, if one is open.
+func (s *Sender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,228 @@
+// Package siem formats nixfleet change events (applies, rollbacks, drift
+// detections and fixes, secret deployments) as CEF-over-syslog messages and
+// delivers them to a security team's collector. It's the same event stream
+// that already goes to the webhook/email/Slack/Matrix channels (see
+// internal/server/notify.go) rendered for an audience that only speaks
+// syslog.
+package siem
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultPort is used when a syslog:// target doesn't specify one.
+const DefaultPort = "514"
+
+// cefDeviceVendor, cefDeviceProduct, and cefDeviceVersion are the fixed
+// CEF header fields identifying nixfleet as the event source - SIEM
+// products generally key correlation rules off vendor+product, so these
+// stay constant across releases rather than tracking the nixfleet version.
+const (
+	cefDeviceVendor  = "nixfleet"
+	cefDeviceProduct = "nixfleet"
+	cefDeviceVersion = "1.0"
+)
+
+// syslogFacility is RFC 5424's local4, a common default for
+// application-level sources that don't own a more specific facility.
+const syslogFacility = 20
+
+// Target is a parsed syslog:// SIEM destination.
+type Target struct {
+	// Network is "udp", "tcp", or "tls".
+	Network string
+
+	// Addr is host:port to dial.
+	Addr string
+
+	// Format is "cef" or "json".
+	Format string
+}
+
+// ParseTarget parses a "syslog://host:514?proto=tcp&format=cef" spec into a
+// Target, defaulting proto to "udp", format to "cef", and the port to
+// DefaultPort when omitted.
+func ParseTarget(raw string) (*Target, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", raw, err)
+	}
+	if u.Scheme != "syslog" {
+		return nil, fmt.Errorf("unsupported scheme %q in %q (want syslog://)", u.Scheme, raw)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("missing host in %q", raw)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = DefaultPort
+	}
+
+	proto := u.Query().Get("proto")
+	if proto == "" {
+		proto = "udp"
+	}
+	switch proto {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, fmt.Errorf("unsupported proto %q in %q (want udp, tcp, or tls)", proto, raw)
+	}
+
+	format := u.Query().Get("format")
+	if format == "" {
+		format = "cef"
+	}
+	switch format {
+	case "cef", "json":
+	default:
+		return nil, fmt.Errorf("unsupported format %q in %q (want cef or json)", format, raw)
+	}
+
+	return &Target{
+		Network: proto,
+		Addr:    net.JoinHostPort(u.Hostname(), port),
+		Format:  format,
+	}, nil
+}
+
+// cefSeverity maps an event name to a CEF severity (0-10, higher is more
+// severe). Events not listed here default to 5 (medium) rather than erroring
+// - a new event type added to dispatchEvent shouldn't need a matching entry
+// here before it can reach the SIEM.
+var cefSeverity = map[string]int{
+	"host-up":   2,
+	"health":    3,
+	"drift":     4,
+	"apply":     5,
+	"apply-all": 5,
+	"host-down": 6,
+	"rollback":  7,
+}
+
+func severityFor(event string) int {
+	if s, ok := cefSeverity[event]; ok {
+		return s
+	}
+	return 5
+}
+
+// FormatMessage renders event/data as a complete RFC 5424 syslog line ready
+// to write to the wire: "<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID
+// STRUCTURED-DATA MSG", where MSG is event's CEF (format "cef") or JSON
+// (format "json") rendering. hostname is the syslog HOSTNAME field - this
+// nixfleet server's own host, not the fleet host the event is about, which
+// is carried in the CEF "dvchost" extension field (or the JSON "data.host"
+// key) instead.
+func FormatMessage(event string, data map[string]any, format, hostname string, now time.Time) (string, error) {
+	var msg string
+	switch format {
+	case "", "cef":
+		msg = cefBody(event, data)
+	case "json":
+		payload, err := json.Marshal(map[string]any{
+			"event":     event,
+			"timestamp": now.UTC(),
+			"data":      data,
+		})
+		if err != nil {
+			return "", fmt.Errorf("marshaling json event: %w", err)
+		}
+		msg = string(payload)
+	default:
+		return "", fmt.Errorf("unsupported format %q (want cef or json)", format)
+	}
+
+	if hostname == "" {
+		hostname = "-"
+	}
+	pri := syslogFacility*8 + 6 // severity 6 (informational); per-event severity lives in the CEF body instead
+	return fmt.Sprintf("<%d>1 %s %s nixfleet - - %s", pri, now.UTC().Format(time.RFC3339), hostname, msg), nil
+}
+
+// cefBody renders event/data as a CEF record: "CEF:Version|Device
+// Vendor|Device Product|Device Version|Signature ID|Name|Severity|Extension".
+func cefBody(event string, data map[string]any) string {
+	header := strings.Join([]string{
+		"CEF:0",
+		cefDeviceVendor,
+		cefDeviceProduct,
+		cefDeviceVersion,
+		cefEscapeHeader(event),
+		cefEscapeHeader(cefName(event, data)),
+		fmt.Sprintf("%d", severityFor(event)),
+	}, "|")
+	return header + "|" + cefExtension(event, data)
+}
+
+// cefName builds the CEF "Name" header field: a short human summary, the
+// same "event on host" shape notify.go's notificationSummaryLine uses for
+// the other channels.
+func cefName(event string, data map[string]any) string {
+	if host, ok := data["host"].(string); ok && host != "" {
+		return fmt.Sprintf("%s on %s", event, host)
+	}
+	return event
+}
+
+// cefExtension builds the CEF extension field (space-separated key=value
+// pairs) from data's well-known keys - host, actor, before/after hashes,
+// and result, per the request's field list - plus a free-form "msg" for
+// anything else a caller put in "summary", so a field that doesn't map to a
+// dedicated CEF key still reaches the analyst instead of being dropped.
+func cefExtension(event string, data map[string]any) string {
+	var parts []string
+	add := func(key, value string) {
+		if value == "" {
+			return
+		}
+		parts = append(parts, key+"="+cefEscapeExtension(value))
+	}
+
+	if host, ok := data["host"].(string); ok {
+		add("dvchost", host)
+	}
+	if actor, ok := data["actor"].(string); ok {
+		add("suser", actor)
+	}
+	add("act", event)
+	if before, ok := data["before_hash"].(string); ok && before != "" {
+		parts = append(parts, "cs1Label=BeforeHash")
+		add("cs1", before)
+	}
+	if after, ok := data["after_hash"].(string); ok && after != "" {
+		parts = append(parts, "cs2Label=AfterHash")
+		add("cs2", after)
+	}
+	if result, ok := data["result"].(string); ok {
+		add("outcome", result)
+	}
+	if summary, ok := data["summary"].(string); ok {
+		add("msg", summary)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// cefEscapeHeader escapes '\' and '|' in a CEF header field, per the CEF
+// spec - header fields are pipe-delimited, so a literal pipe in an event
+// name or hostname would otherwise split the record.
+func cefEscapeHeader(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `|`, `\|`)
+	return s
+}
+
+// cefEscapeExtension escapes '\' and '=' in a CEF extension value, and
+// folds newlines to "\n" since a syslog message is a single line.
+func cefEscapeExtension(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `=`, `\=`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return s
+}
@@ -0,0 +1,119 @@
+package siem
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    Target
+		wantErr bool
+	}{
+		{"syslog://collector:514?proto=tcp&format=cef", Target{Network: "tcp", Addr: "collector:514", Format: "cef"}, false},
+		{"syslog://collector?proto=tls&format=json", Target{Network: "tls", Addr: "collector:514", Format: "json"}, false},
+		{"syslog://collector", Target{Network: "udp", Addr: "collector:514", Format: "cef"}, false},
+		{"http://collector:514", Target{}, true},
+		{"syslog://collector:514?proto=carrier-pigeon", Target{}, true},
+		{"syslog://collector:514?format=xml", Target{}, true},
+		{"not-a-url\x7f", Target{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTarget(tt.raw)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseTarget(%q): expected an error", tt.raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ParseTarget(%q) error: %v", tt.raw, err)
+		}
+		if *got != tt.want {
+			t.Errorf("ParseTarget(%q) = %+v, want %+v", tt.raw, *got, tt.want)
+		}
+	}
+}
+
+func TestCEFEscapeHeader(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`apply`, `apply`},
+		{`apply|all`, `apply\|all`},
+		{`C:\nix\fleet`, `C:\\nix\\fleet`},
+		{`a|b\c`, `a\|b\\c`},
+	}
+	for _, tt := range tests {
+		if got := cefEscapeHeader(tt.in); got != tt.want {
+			t.Errorf("cefEscapeHeader(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCEFEscapeExtension(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`ok`, `ok`},
+		{`a=b`, `a\=b`},
+		{`C:\path`, `C:\\path`},
+		{"line1\nline2", `line1\nline2`},
+		{`a=b\c=d`, `a\=b\\c\=d`},
+	}
+	for _, tt := range tests {
+		if got := cefEscapeExtension(tt.in); got != tt.want {
+			t.Errorf("cefEscapeExtension(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatMessageCEF(t *testing.T) {
+	now := time.Date(2026, 3, 5, 12, 0, 0, 0, time.UTC)
+	msg, err := FormatMessage("apply", map[string]any{
+		"host":        "web-1",
+		"actor":       "alice",
+		"before_hash": "abc123",
+		"after_hash":  "def|456",
+		"result":      "success",
+	}, "cef", "nixfleet-srv", now)
+	if err != nil {
+		t.Fatalf("FormatMessage error: %v", err)
+	}
+
+	if !strings.HasPrefix(msg, "<166>1 2026-03-05T12:00:00Z nixfleet-srv nixfleet - - CEF:0|nixfleet|nixfleet|1.0|apply|apply on web-1|5|") {
+		t.Fatalf("unexpected message prefix: %q", msg)
+	}
+	for _, want := range []string{"dvchost=web-1", "suser=alice", "act=apply", "cs1Label=BeforeHash", "cs1=abc123", "cs2Label=AfterHash", "cs2=def|456", "outcome=success"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message %q missing %q", msg, want)
+		}
+	}
+}
+
+func TestFormatMessageJSON(t *testing.T) {
+	now := time.Date(2026, 3, 5, 12, 0, 0, 0, time.UTC)
+	msg, err := FormatMessage("drift", map[string]any{"host": "db-1"}, "json", "", now)
+	if err != nil {
+		t.Fatalf("FormatMessage error: %v", err)
+	}
+	if !strings.HasPrefix(msg, "<166>1 2026-03-05T12:00:00Z - nixfleet - - ") {
+		t.Fatalf("unexpected message prefix: %q", msg)
+	}
+	for _, want := range []string{`"event":"drift"`, `"host":"db-1"`} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message %q missing %q", msg, want)
+		}
+	}
+}
+
+func TestFormatMessageUnsupportedFormat(t *testing.T) {
+	if _, err := FormatMessage("apply", nil, "xml", "host", time.Now()); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
@@ -0,0 +1,371 @@
+// Package smoketest boots a host's built closure in an ephemeral, local
+// sandbox - a headless qemu VM for NixOS (reusing the host's
+// config.system.build.vm the same way nixos-rebuild build-vm does), a
+// systemd-nspawn container for Ubuntu - and runs the host's configured
+// health probes against it before a real apply is allowed to touch the
+// host. A closure that fails to boot or fails its probes never reaches the
+// real host; the sandbox is torn down whether the test passes, fails, or
+// times out.
+package smoketest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+	"github.com/nixfleet/nixfleet/internal/nix"
+	"github.com/nixfleet/nixfleet/internal/probe"
+)
+
+// DefaultTimeout bounds how long a smoke test may run, VM/container boot
+// included, before it's considered failed and torn down.
+const DefaultTimeout = 3 * time.Minute
+
+// Result is the outcome of smoke-testing one host's closure.
+type Result struct {
+	Host     string         `json:"host"`
+	Method   string         `json:"method"` // "vm", "container", or "skipped"
+	Passed   bool           `json:"passed"`
+	TimedOut bool           `json:"timedOut,omitempty"`
+	Duration time.Duration  `json:"duration"`
+	Log      string         `json:"log,omitempty"` // captured console/activation output, tail only
+	Probes   *probe.Results `json:"probes,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// Tester runs smoke tests for hosts' built closures.
+type Tester struct {
+	evaluator *nix.Evaluator
+	probe     *probe.Engine
+	timeout   time.Duration
+}
+
+// NewTester creates a Tester that builds VM/container images through evaluator.
+func NewTester(evaluator *nix.Evaluator) *Tester {
+	return &Tester{
+		evaluator: evaluator,
+		probe:     probe.NewEngine(),
+		timeout:   DefaultTimeout,
+	}
+}
+
+// SetTimeout overrides DefaultTimeout.
+func (t *Tester) SetTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		t.timeout = timeout
+	}
+}
+
+// Run smoke-tests host's closure, dispatching to a qemu VM for nixos or a
+// systemd-nspawn container for ubuntu. darwin has no local sandbox
+// equivalent and is reported as skipped (Passed: true) rather than failed,
+// so it never blocks an apply it can't actually verify.
+func (t *Tester) Run(ctx context.Context, host *inventory.Host, probes []probe.Config) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	var result *Result
+	var err error
+	switch host.Base {
+	case "nixos":
+		result, err = t.runNixOSVM(ctx, host, probes)
+	case "ubuntu":
+		result, err = t.runUbuntuContainer(ctx, host, probes)
+	default:
+		return &Result{Host: host.Name, Method: "skipped", Passed: true}, nil
+	}
+
+	if result == nil {
+		result = &Result{Host: host.Name}
+	}
+	result.Host = host.Name
+	result.Duration = time.Since(start)
+
+	if ctx.Err() == context.DeadlineExceeded {
+		result.TimedOut = true
+		result.Passed = false
+		if result.Error == "" {
+			result.Error = fmt.Sprintf("smoke test timed out after %s", t.timeout)
+		}
+	}
+
+	return result, err
+}
+
+// runNixOSVM builds host's config.system.build.vm, boots it headlessly with
+// its console captured to a log file and guest port 22 forwarded to a free
+// local port, waits for multi-user.target, runs probes against the
+// forwarded port, then kills the VM regardless of outcome.
+func (t *Tester) runNixOSVM(ctx context.Context, host *inventory.Host, probes []probe.Config) (*Result, error) {
+	result := &Result{Method: "vm"}
+
+	vmAttr := fmt.Sprintf("nixosConfigurations.%s.config.system.build.vm", host.Name)
+	vmPath, err := t.evaluator.BuildAttr(ctx, vmAttr)
+	if err != nil {
+		result.Error = fmt.Sprintf("building VM: %v", err)
+		return result, nil
+	}
+
+	runScript := filepath.Join(vmPath, "bin", fmt.Sprintf("run-%s-vm", host.Name))
+	if _, err := os.Stat(runScript); err != nil {
+		result.Error = fmt.Sprintf("VM run script not found at %s: %v", runScript, err)
+		return result, nil
+	}
+
+	workDir, err := os.MkdirTemp("", "nixfleet-smoketest-vm-")
+	if err != nil {
+		result.Error = fmt.Sprintf("creating work dir: %v", err)
+		return result, nil
+	}
+	defer os.RemoveAll(workDir)
+
+	sshPort, err := freePort()
+	if err != nil {
+		result.Error = fmt.Sprintf("finding a free port: %v", err)
+		return result, nil
+	}
+
+	logPath := filepath.Join(workDir, "console.log")
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		result.Error = fmt.Sprintf("creating console log: %v", err)
+		return result, nil
+	}
+	defer logFile.Close()
+
+	cmd := exec.CommandContext(ctx, runScript)
+	cmd.Dir = workDir
+	cmd.Env = append(os.Environ(),
+		"QEMU_OPTS=-nographic -no-reboot",
+		fmt.Sprintf("QEMU_NET_OPTS=hostfwd=tcp::%d-:22", sshPort),
+		fmt.Sprintf("NIX_DISK_IMAGE=%s", filepath.Join(workDir, "disk.qcow2")),
+	)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+
+	if err := cmd.Start(); err != nil {
+		result.Error = fmt.Sprintf("starting VM: %v", err)
+		return result, nil
+	}
+	defer killVM(cmd)
+
+	if err := waitForConsoleLine(ctx, logPath, "Reached target Multi-User System", "multi-user.target"); err != nil {
+		result.Log = tailFile(logPath, 8192)
+		result.Error = fmt.Sprintf("VM did not reach multi-user.target: %v", err)
+		return result, nil
+	}
+
+	execFn := sshExecLocal(sshPort)
+	result.Probes = t.probe.Run(ctx, execFn, "127.0.0.1", probes)
+	result.Passed = result.Probes.Passed
+	result.Log = tailFile(logPath, 8192)
+	if !result.Passed {
+		result.Error = fmt.Sprintf("smoke test probes failed: %s", result.Probes.Summary())
+	}
+
+	return result, nil
+}
+
+// runUbuntuContainer copies host's activation closure into a systemd-nspawn
+// container, runs the activation script inside it, and (if activation
+// succeeded) runs probes against the container. This exercises the
+// activation script itself rather than a full boot, since Ubuntu hosts are
+// managed in-place rather than booted from an image.
+func (t *Tester) runUbuntuContainer(ctx context.Context, host *inventory.Host, probes []probe.Config) (*Result, error) {
+	result := &Result{Method: "container"}
+
+	closureAttr := fmt.Sprintf("nixfleetConfigurations.%s.system", host.Name)
+	closurePath, err := t.evaluator.BuildAttr(ctx, closureAttr)
+	if err != nil {
+		result.Error = fmt.Sprintf("building closure: %v", err)
+		return result, nil
+	}
+
+	rootDir, err := os.MkdirTemp("", "nixfleet-smoketest-ct-")
+	if err != nil {
+		result.Error = fmt.Sprintf("creating container root: %v", err)
+		return result, nil
+	}
+	defer os.RemoveAll(rootDir)
+
+	machineName := fmt.Sprintf("nixfleet-smoke-%s", strings.ReplaceAll(host.Name, ".", "-"))
+
+	activate := filepath.Join(closurePath, "activate")
+	cmd := exec.CommandContext(ctx, "systemd-nspawn",
+		"--quiet",
+		"--ephemeral",
+		"--directory", rootDir,
+		"--machine", machineName,
+		"--bind", closurePath+":"+closurePath,
+		"--", activate,
+	)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	defer exec.Command("machinectl", "terminate", machineName).Run() //nolint:errcheck
+
+	runErr := cmd.Run()
+	result.Log = truncate(out.String(), 8192)
+
+	if runErr != nil {
+		result.Error = fmt.Sprintf("activation failed inside container: %v", runErr)
+		return result, nil
+	}
+
+	if len(probes) == 0 {
+		result.Passed = true
+		return result, nil
+	}
+
+	execFn := nspawnExec(machineName)
+	result.Probes = t.probe.Run(ctx, execFn, "", probes)
+	result.Passed = result.Probes.Passed
+	if !result.Passed {
+		result.Error = fmt.Sprintf("smoke test probes failed: %s", result.Probes.Summary())
+	}
+
+	return result, nil
+}
+
+// killVM sends the run script's process group a termination signal so qemu
+// exits even if the smoke test failed before the VM reached a shutdown
+// point; the deferred call runs regardless of how runNixOSVM returns.
+func killVM(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	_ = cmd.Process.Kill()
+	_, _ = cmd.Process.Wait()
+}
+
+// waitForConsoleLine polls logPath until it contains any of substrs or ctx
+// is done.
+func waitForConsoleLine(ctx context.Context, logPath string, substrs ...string) error {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			content := tailFile(logPath, 1<<20)
+			for _, s := range substrs {
+				if strings.Contains(content, s) {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// tailFile reads up to the last maxBytes of path, returning "" on any error
+// (the file may not exist yet while the VM is still starting).
+func tailFile(path string, maxBytes int64) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return ""
+	}
+
+	offset := int64(0)
+	if info.Size() > maxBytes {
+		offset = info.Size() - maxBytes
+	}
+	if _, err := f.Seek(offset, 0); err != nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		sb.WriteString(scanner.Text())
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func truncate(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	return s[len(s)-maxBytes:]
+}
+
+// freePort asks the OS for an unused TCP port to forward the VM's SSH port to.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// sshExecLocal adapts a locally-forwarded VM SSH port into a probe.Exec.
+// Smoke-test VMs are throwaway and have no known host key, so strict host
+// key checking is disabled the same way it would be for any ephemeral CI
+// sandbox.
+func sshExecLocal(port int) probe.Exec {
+	return func(ctx context.Context, command string) (*probe.ExecResult, error) {
+		cmd := exec.CommandContext(ctx, "ssh",
+			"-p", strconv.Itoa(port),
+			"-o", "StrictHostKeyChecking=no",
+			"-o", "UserKnownHostsFile=/dev/null",
+			"-o", "ConnectTimeout=5",
+			"root@127.0.0.1",
+			command,
+		)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+
+		exitCode := 0
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		} else if err != nil {
+			return nil, err
+		}
+
+		return &probe.ExecResult{Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: exitCode}, nil
+	}
+}
+
+// nspawnExec adapts a running systemd-nspawn container into a probe.Exec.
+func nspawnExec(machineName string) probe.Exec {
+	return func(ctx context.Context, command string) (*probe.ExecResult, error) {
+		cmd := exec.CommandContext(ctx, "systemd-run", "--machine", machineName, "--wait", "--pipe", "--quiet", "--", "sh", "-c", command)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+
+		exitCode := 0
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		} else if err != nil {
+			return nil, err
+		}
+
+		return &probe.ExecResult{Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: exitCode}, nil
+	}
+}
@@ -1,12 +1,17 @@
 package ssh
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,16 +20,30 @@ import (
 	"golang.org/x/crypto/ssh/knownhosts"
 )
 
+// DefaultMaxOutputBytes caps how much stdout/stderr a single command
+// execution will buffer in memory. Commands that print more than this
+// (e.g. an accidental `cat` of a large binary) are truncated rather than
+// exhausting memory or flooding logs.
+const DefaultMaxOutputBytes = 4 * 1024 * 1024 // 4 MiB
+
 // Client represents an SSH connection to a host
 type Client struct {
-	host       string
-	port       int
-	user       string
-	conn       *ssh.Client
-	mu         sync.Mutex
-	lastUsed   time.Time
-	config     *ssh.ClientConfig
-	knownHosts ssh.HostKeyCallback
+	host           string
+	port           int
+	user           string
+	conn           *ssh.Client
+	mu             sync.Mutex
+	lastUsed       time.Time
+	config         *ssh.ClientConfig
+	knownHosts     ssh.HostKeyCallback
+	maxOutputBytes int64
+
+	// proxyJump is an optional "user@host:port" (user/port optional) to
+	// dial through instead of connecting directly, mirroring ssh_config's
+	// ProxyJump for a single hop. jumpClient holds the connection opened to
+	// reach it, closed alongside this client.
+	proxyJump  string
+	jumpClient *Client
 }
 
 // ClientConfig holds configuration for SSH clients
@@ -36,6 +55,19 @@ type ClientConfig struct {
 	UseAgent       bool
 	KnownHostsFile string
 	StrictHostKeys bool
+	// MaxOutputBytes caps buffered stdout/stderr per command. Zero uses
+	// DefaultMaxOutputBytes; a negative value disables the limit.
+	MaxOutputBytes int64
+	// ProxyJump, if set, is a single "[user@]host[:port]" to connect through
+	// instead of dialing the target directly - the same single-hop case as
+	// ssh_config's ProxyJump directive. Multi-hop ("a,b,c") isn't supported.
+	ProxyJump string
+
+	// Signer, if set, is the one scoped credential this client will offer -
+	// it replaces UseAgent/KeyFiles entirely rather than adding to them, so
+	// a host given a scoped key via CredentialStore only ever authenticates
+	// with that key, never falling back to whatever else the agent holds.
+	Signer ssh.Signer
 }
 
 // DefaultConfig returns a default SSH client configuration
@@ -48,6 +80,7 @@ func DefaultConfig() *ClientConfig {
 		UseAgent:       true,
 		KnownHostsFile: filepath.Join(home, ".ssh", "known_hosts"),
 		StrictHostKeys: true,
+		MaxOutputBytes: DefaultMaxOutputBytes,
 		KeyFiles: []string{
 			filepath.Join(home, ".ssh", "nixfleet"),
 			filepath.Join(home, ".ssh", "id_ed25519"),
@@ -84,16 +117,30 @@ func NewClient(host string, cfg *ClientConfig) (*Client, error) {
 		Timeout:         cfg.Timeout,
 	}
 
+	maxOutputBytes := cfg.MaxOutputBytes
+	if maxOutputBytes == 0 {
+		maxOutputBytes = DefaultMaxOutputBytes
+	}
+
 	return &Client{
-		host:       host,
-		port:       cfg.Port,
-		user:       cfg.User,
-		config:     sshConfig,
-		knownHosts: hostKeyCallback,
+		host:           host,
+		port:           cfg.Port,
+		user:           cfg.User,
+		config:         sshConfig,
+		knownHosts:     hostKeyCallback,
+		maxOutputBytes: maxOutputBytes,
+		proxyJump:      cfg.ProxyJump,
 	}, nil
 }
 
 func buildAuthMethods(cfg *ClientConfig) ([]ssh.AuthMethod, error) {
+	// A scoped credential is exclusive: offering it alongside the agent or
+	// KeyFiles would let a host-scoped key holder still authenticate with
+	// whatever else is lying around, defeating the point of scoping it.
+	if cfg.Signer != nil {
+		return []ssh.AuthMethod{ssh.PublicKeys(cfg.Signer)}, nil
+	}
+
 	var methods []ssh.AuthMethod
 
 	// Try SSH agent first
@@ -132,6 +179,23 @@ func sshAgentAuth() ssh.AuthMethod {
 	return ssh.PublicKeysCallback(agentClient.Signers)
 }
 
+// AgentReachable checks that SSH_AUTH_SOCK is set and its socket accepts a
+// connection, without pulling any signers from it. Health checks use this to
+// report a dead or unset agent before it causes every auth attempt to fail.
+func AgentReachable() error {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return fmt.Errorf("SSH_AUTH_SOCK is not set")
+	}
+
+	conn, err := net.DialTimeout("unix", socket, 2*time.Second)
+	if err != nil {
+		return fmt.Errorf("connecting to agent socket: %w", err)
+	}
+	conn.Close()
+	return nil
+}
+
 func publicKeyAuth(keyFile string) (ssh.AuthMethod, error) {
 	key, err := os.ReadFile(keyFile)
 	if err != nil {
@@ -148,6 +212,16 @@ func publicKeyAuth(keyFile string) (ssh.AuthMethod, error) {
 
 // Connect establishes the SSH connection
 func (c *Client) Connect(ctx context.Context) error {
+	if t := activeTracer(); t != nil && t.DryRun {
+		// A pure trace run never touches the network, including the
+		// initial handshake - Exec/ExecSudo already short-circuit, but
+		// callers checking IsConnected() should still see a connection.
+		c.mu.Lock()
+		c.lastUsed = time.Now()
+		c.mu.Unlock()
+		return nil
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -157,8 +231,7 @@ func (c *Client) Connect(ctx context.Context) error {
 
 	addr := fmt.Sprintf("%s:%d", c.host, c.port)
 
-	var d net.Dialer
-	netConn, err := d.DialContext(ctx, "tcp", addr)
+	netConn, err := c.dial(ctx, addr)
 	if err != nil {
 		return fmt.Errorf("dial %s: %w", addr, err)
 	}
@@ -175,17 +248,82 @@ func (c *Client) Connect(ctx context.Context) error {
 	return nil
 }
 
-// Close closes the SSH connection
+// dial opens a net.Conn to addr, going through c.proxyJump first if it's
+// set. The jump connection uses the same auth methods and known_hosts
+// policy as c itself, since nixfleet doesn't track separate credentials per
+// jump host.
+func (c *Client) dial(ctx context.Context, addr string) (net.Conn, error) {
+	if c.proxyJump == "" {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", addr)
+	}
+
+	jumpHost, jumpPort, jumpUser := parseProxyJump(c.proxyJump)
+	jumpCfg := &ssh.ClientConfig{
+		User:            c.user,
+		Auth:            c.config.Auth,
+		HostKeyCallback: c.knownHosts,
+		Timeout:         c.config.Timeout,
+	}
+	if jumpUser != "" {
+		jumpCfg.User = jumpUser
+	}
+
+	jump := &Client{
+		host:           jumpHost,
+		port:           jumpPort,
+		user:           jumpCfg.User,
+		config:         jumpCfg,
+		knownHosts:     c.knownHosts,
+		maxOutputBytes: c.maxOutputBytes,
+	}
+	if err := jump.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("connecting to ProxyJump %s: %w", c.proxyJump, err)
+	}
+
+	netConn, err := jump.conn.Dial("tcp", addr)
+	if err != nil {
+		jump.Close()
+		return nil, fmt.Errorf("dialing %s via ProxyJump %s: %w", addr, c.proxyJump, err)
+	}
+
+	c.jumpClient = jump
+	return netConn, nil
+}
+
+// parseProxyJump splits a ProxyJump value ("[user@]host[:port]") into its
+// parts, defaulting port to 22 when unset.
+func parseProxyJump(spec string) (host string, port int, user string) {
+	port = 22
+	if at := strings.Index(spec, "@"); at >= 0 {
+		user = spec[:at]
+		spec = spec[at+1:]
+	}
+	host = spec
+	if _, portStr, err := net.SplitHostPort(spec); err == nil {
+		host = spec[:len(spec)-len(portStr)-1]
+		if p, err := strconv.Atoi(portStr); err == nil {
+			port = p
+		}
+	}
+	return host, port, user
+}
+
+// Close closes the SSH connection (and any ProxyJump connection it was
+// tunneled through).
 func (c *Client) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.conn == nil {
-		return nil
+	var err error
+	if c.conn != nil {
+		err = c.conn.Close()
+		c.conn = nil
+	}
+	if c.jumpClient != nil {
+		c.jumpClient.Close()
+		c.jumpClient = nil
 	}
-
-	err := c.conn.Close()
-	c.conn = nil
 	return err
 }
 
@@ -201,10 +339,31 @@ type ExecResult struct {
 	Stdout   string
 	Stderr   string
 	ExitCode int
+
+	// StdoutTruncated/StderrTruncated are true if the stream exceeded the
+	// client's MaxOutputBytes and was cut short.
+	StdoutTruncated bool
+	StderrTruncated bool
+
+	// StdoutBinary/StderrBinary are true if the captured output looked
+	// like binary data (contains NUL bytes) rather than text.
+	StdoutBinary bool
+	StderrBinary bool
 }
 
 // Exec executes a command on the remote host
 func (c *Client) Exec(ctx context.Context, cmd string) (*ExecResult, error) {
+	return c.exec(ctx, cmd, false)
+}
+
+func (c *Client) exec(ctx context.Context, cmd string, sudo bool) (*ExecResult, error) {
+	if t := activeTracer(); t != nil {
+		t.record(ctx, c.host, cmd, sudo)
+		if t.DryRun {
+			return &ExecResult{Stdout: "", Stderr: "", ExitCode: 0}, nil
+		}
+	}
+
 	c.mu.Lock()
 	if c.conn == nil {
 		c.mu.Unlock()
@@ -235,13 +394,13 @@ func (c *Client) Exec(ctx context.Context, cmd string) (*ExecResult, error) {
 	}
 
 	// Read output with context cancellation
-	var stdoutBuf, stderrBuf []byte
+	var stdoutCap, stderrCap cappedOutput
 	var readErr error
 
 	done := make(chan struct{})
 	go func() {
-		stdoutBuf, _ = io.ReadAll(stdout)
-		stderrBuf, _ = io.ReadAll(stderr)
+		stdoutCap = readCapped(stdout, c.maxOutputBytes)
+		stderrCap = readCapped(stderr, c.maxOutputBytes)
 		close(done)
 	}()
 
@@ -271,15 +430,182 @@ func (c *Client) Exec(ctx context.Context, cmd string) (*ExecResult, error) {
 	c.mu.Unlock()
 
 	return &ExecResult{
-		Stdout:   string(stdoutBuf),
-		Stderr:   string(stderrBuf),
-		ExitCode: exitCode,
+		Stdout:          string(stdoutCap.data),
+		Stderr:          string(stderrCap.data),
+		ExitCode:        exitCode,
+		StdoutTruncated: stdoutCap.truncated,
+		StderrTruncated: stderrCap.truncated,
+		StdoutBinary:    stdoutCap.binary,
+		StderrBinary:    stderrCap.binary,
 	}, nil
 }
 
+// cappedOutput is the result of reading a stream with a size limit
+type cappedOutput struct {
+	data      []byte
+	truncated bool
+	binary    bool
+}
+
+// readCapped reads r up to limit bytes, then drains and discards the rest
+// so the remote command can still finish and the session doesn't deadlock
+// on a full pipe. A non-positive limit disables capping. Output containing
+// a NUL byte is flagged as binary since it's unsafe to treat as text.
+func readCapped(r io.Reader, limit int64) cappedOutput {
+	if limit <= 0 {
+		data, _ := io.ReadAll(r)
+		return cappedOutput{data: data, binary: bytes.IndexByte(data, 0) >= 0}
+	}
+
+	data, _ := io.ReadAll(io.LimitReader(r, limit))
+	truncated := false
+	if n, _ := io.Copy(io.Discard, r); n > 0 {
+		truncated = true
+	}
+
+	return cappedOutput{
+		data:      data,
+		truncated: truncated,
+		binary:    bytes.IndexByte(data, 0) >= 0,
+	}
+}
+
 // ExecSudo executes a command with sudo on the remote host
 func (c *Client) ExecSudo(ctx context.Context, cmd string) (*ExecResult, error) {
-	return c.Exec(ctx, fmt.Sprintf("sudo %s", cmd))
+	return c.exec(ctx, fmt.Sprintf("sudo %s", cmd), true)
+}
+
+// Command is a single shell command to run as part of an ExecBatch.
+type Command struct {
+	Cmd string
+}
+
+// batchMarker delimits each command's output within a batch script's
+// stdout. \x01 can't appear in the base64 alphabet the script encodes
+// output with, so it's an unambiguous separator without needing to escape
+// anything a command might print.
+const batchMarker = "\x01"
+
+// batchBlockPattern matches one command's OUT/ERR/CODE block in a batch
+// script's stdout, in the order buildBatchScript emits them. (?s) lets '.'
+// span the newlines gofmt-wrapped base64 can introduce.
+var batchBlockPattern = regexp.MustCompile(`(?s)` + batchMarker + `NFBATCH-OUT-(\d+)` + batchMarker + `(.*?)` +
+	batchMarker + `NFBATCH-ERR-(\d+)` + batchMarker + `(.*?)` +
+	batchMarker + `NFBATCH-CODE-(\d+)` + batchMarker + `(\d+)` + batchMarker)
+
+// ExecBatch runs many small commands as a single remote exec instead of one
+// exec per command, for callers like state.Manager.CheckDrift that would
+// otherwise issue a separate SSH channel per file. Commands run
+// sequentially in the order given; a failing command (non-zero exit) does
+// not stop the rest, and its result is attributed to its own index in the
+// returned slice - a mismatch or connection failure that prevents reading
+// results at all is returned as an error instead.
+//
+// The returned error is only about the batch mechanism itself (session
+// setup, output parsing); an individual command's failure shows up as a
+// non-zero ExitCode on its ExecResult, exactly like Exec. One difference
+// from Exec: each command's output is captured with `$(...)`, so a single
+// trailing newline is stripped, matching what callers get from backtick
+// output in a shell.
+
+func (c *Client) ExecBatch(ctx context.Context, cmds []Command) ([]*ExecResult, error) {
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+
+	result, err := c.Exec(ctx, buildBatchScript(cmds))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseBatchOutput(result.Stdout, len(cmds))
+}
+
+// buildBatchScript renders cmds as a single bash script: each command is
+// base64-encoded into the script (so arbitrary shell metacharacters in a
+// command never need escaping against the script's own quoting) and
+// decoded and eval'd on the remote side, with its stdout, stderr, and exit
+// code captured and re-encoded between batchMarker-delimited tags. The
+// whole script is single-quoted for `bash -c`, which is safe because
+// base64 and the tags it emits never contain a single quote.
+func buildBatchScript(cmds []Command) string {
+	var b strings.Builder
+	b.WriteString("bash -c '\ncmds=(\n")
+	for _, cmd := range cmds {
+		b.WriteString("\"")
+		b.WriteString(base64.StdEncoding.EncodeToString([]byte(cmd.Cmd)))
+		b.WriteString("\"\n")
+	}
+	b.WriteString(")\n")
+	b.WriteString(`for i in "${!cmds[@]}"; do
+  c=$(printf "%s" "${cmds[$i]}" | base64 -d 2>/dev/null || printf "%s" "${cmds[$i]}" | base64 -D)
+  o=$(eval "$c" 2>/tmp/.nfbatch.$$.$i)
+  code=$?
+  err=$(cat /tmp/.nfbatch.$$.$i 2>/dev/null); rm -f /tmp/.nfbatch.$$.$i
+  printf "` + batchMarker + `NFBATCH-OUT-%d` + batchMarker + `" "$i"
+  printf "%s" "$o" | base64
+  printf "` + batchMarker + `NFBATCH-ERR-%d` + batchMarker + `" "$i"
+  printf "%s" "$err" | base64
+  printf "` + batchMarker + `NFBATCH-CODE-%d` + batchMarker + `%d` + batchMarker + `" "$i" "$code"
+done
+`)
+	b.WriteString("'")
+	return b.String()
+}
+
+// parseBatchOutput extracts each command's OUT/ERR/CODE block from a batch
+// script's stdout and decodes it back into an ExecResult, indexed the same
+// as the Command slice ExecBatch was given. Whitespace is stripped from
+// each base64 blob before decoding since some base64 implementations wrap
+// long lines.
+func parseBatchOutput(stdout string, want int) ([]*ExecResult, error) {
+	matches := batchBlockPattern.FindAllStringSubmatch(stdout, -1)
+	if len(matches) != want {
+		return nil, fmt.Errorf("expected %d batch result(s), got %d", want, len(matches))
+	}
+
+	results := make([]*ExecResult, want)
+	for _, m := range matches {
+		idx, err := strconv.Atoi(m[1])
+		if err != nil || idx < 0 || idx >= want {
+			return nil, fmt.Errorf("batch result had out-of-range index %q", m[1])
+		}
+
+		stdoutData, err := decodeBatchField(m[2])
+		if err != nil {
+			return nil, fmt.Errorf("decoding stdout for command %d: %w", idx, err)
+		}
+		stderrData, err := decodeBatchField(m[4])
+		if err != nil {
+			return nil, fmt.Errorf("decoding stderr for command %d: %w", idx, err)
+		}
+		exitCode, err := strconv.Atoi(m[6])
+		if err != nil {
+			return nil, fmt.Errorf("parsing exit code for command %d: %w", idx, err)
+		}
+
+		results[idx] = &ExecResult{
+			Stdout:       string(stdoutData),
+			Stderr:       string(stderrData),
+			ExitCode:     exitCode,
+			StdoutBinary: bytes.IndexByte(stdoutData, 0) >= 0,
+			StderrBinary: bytes.IndexByte(stderrData, 0) >= 0,
+		}
+	}
+
+	return results, nil
+}
+
+// decodeBatchField strips whitespace (some base64 implementations wrap
+// output at a fixed column) before decoding a batch field.
+func decodeBatchField(field string) ([]byte, error) {
+	stripped := strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, field)
+	return base64.StdEncoding.DecodeString(stripped)
 }
 
 // Host returns the hostname
@@ -0,0 +1,116 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+)
+
+// CredentialStore resolves a scoped private key for a host instead of the
+// pool falling back to whatever the SSH agent or DefaultConfig.KeyFiles
+// holds. This is what lets a compromised server be limited to the hosts it
+// was actually given keys for, rather than one agent key that opens every
+// host in the fleet.
+//
+// Keys are read from disk lazily, on first connection to a host that has
+// one, and cached from then on - so a credentials directory with hundreds
+// of per-host keys doesn't mean hundreds of file reads at startup, only for
+// the hosts a given process actually talks to.
+type CredentialStore struct {
+	dir string
+	inv *inventory.Inventory // optional; enables per-group fallback files
+
+	mu    sync.Mutex
+	cache map[string]credEntry
+}
+
+type credEntry struct {
+	signer ssh.Signer
+	found  bool
+}
+
+// NewCredentialStore creates a store that looks for per-host (and, once
+// WithInventory is called, per-group) key files under dir.
+func NewCredentialStore(dir string) *CredentialStore {
+	return &CredentialStore{dir: dir, cache: make(map[string]credEntry)}
+}
+
+// WithInventory arms group-scoped fallback: a host with no key file of its
+// own falls back to "@<group>" for each group it belongs to, in name order.
+// Returns the store for chaining at construction time.
+func (s *CredentialStore) WithInventory(inv *inventory.Inventory) *CredentialStore {
+	s.inv = inv
+	return s
+}
+
+// SignerForHost returns the private key scoped to host, if one has been
+// provisioned for it. ok is false (with a nil error) when neither the host
+// nor any of its groups has a credential file - callers should fall back to
+// their own default auth in that case, not treat it as an error.
+func (s *CredentialStore) SignerForHost(host string) (signer ssh.Signer, ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, cached := s.cache[host]; cached {
+		return entry.signer, entry.found, nil
+	}
+
+	signer, ok, err = s.loadSigner(host)
+	if err != nil {
+		return nil, false, err
+	}
+	s.cache[host] = credEntry{signer: signer, found: ok}
+	return signer, ok, nil
+}
+
+func (s *CredentialStore) loadSigner(host string) (ssh.Signer, bool, error) {
+	if signer, err := readSignerFile(filepath.Join(s.dir, host)); err == nil {
+		return signer, true, nil
+	} else if !os.IsNotExist(err) {
+		return nil, false, fmt.Errorf("loading credential for host %s: %w", host, err)
+	}
+
+	for _, group := range s.groupsFor(host) {
+		if signer, err := readSignerFile(filepath.Join(s.dir, "@"+group)); err == nil {
+			return signer, true, nil
+		} else if !os.IsNotExist(err) {
+			return nil, false, fmt.Errorf("loading credential for group %s: %w", group, err)
+		}
+	}
+
+	return nil, false, nil
+}
+
+// groupsFor returns, sorted, the names of every group host belongs to -
+// checked in that order so which group's key wins is deterministic when a
+// host is in more than one.
+func (s *CredentialStore) groupsFor(host string) []string {
+	if s.inv == nil {
+		return nil
+	}
+	var groups []string
+	for name := range s.inv.Groups {
+		for _, h := range s.inv.HostsInGroup(name) {
+			if h.Name == host {
+				groups = append(groups, name)
+				break
+			}
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+func readSignerFile(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(data)
+}
@@ -2,24 +2,57 @@ package ssh
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/nixfleet/nixfleet/internal/inventory"
 )
 
+// ErrHostTimeout is wrapped into a HostResult's Error when a host exceeds
+// the Executor's HostTimeout. Callers can distinguish it from other
+// failures with errors.Is, and HostResult.TimedOut is set as a shortcut.
+var ErrHostTimeout = errors.New("host command timed out")
+
 // HostResult holds the result of an operation on a single host
 type HostResult struct {
 	Host    *inventory.Host
 	Result  *ExecResult
 	Error   error
 	Success bool
+	// EffectiveUser is the user the command actually ran as, set by
+	// ExecRemoteCommandOnHosts when a RemoteCommand's Become/BecomeUser
+	// changed it from the host's SSH user. Empty for plain ExecOnHosts/
+	// RunFunc calls, which always run as the SSH user.
+	EffectiveUser string
+	// TimedOut is set when this host's own command exceeded the
+	// Executor's HostTimeout, as opposed to failing for some other reason.
+	TimedOut bool
+	// NeverStarted is set when the operation's ctx deadline had already
+	// passed before this host got a turn, so it was skipped rather than
+	// attempted and failed.
+	NeverStarted bool
 }
 
 // Executor runs commands across multiple hosts in parallel
 type Executor struct {
 	pool        *Pool
 	maxParallel int
+
+	// HostTimeout, when set via SetHostTimeout, bounds how long a single
+	// host's command may run independent of every other host - a wedged
+	// host only ever burns its own timeout instead of stalling the whole
+	// operation. Zero means no per-host cap beyond whatever deadline the
+	// caller's ctx already carries.
+	HostTimeout time.Duration
+
+	// GracePeriod extends a host's remaining time past ctx's own deadline
+	// if it's already in flight when that deadline is reached, so a
+	// fleet-wide timeout stops scheduling new hosts without yanking the
+	// rug out from under a command that was seconds from finishing.
+	// Ignored when HostTimeout is zero.
+	GracePeriod time.Duration
 }
 
 // NewExecutor creates a new parallel executor
@@ -33,6 +66,63 @@ func NewExecutor(pool *Pool, maxParallel int) *Executor {
 	}
 }
 
+// SetHostTimeout configures the per-host timeout and grace period described
+// on the Executor's HostTimeout/GracePeriod fields. Call sites pick values
+// that fit what they're running - short for preflight checks, long for
+// activation. A zero hostTimeout disables the per-host cap.
+func (e *Executor) SetHostTimeout(hostTimeout, grace time.Duration) {
+	e.HostTimeout = hostTimeout
+	e.GracePeriod = grace
+}
+
+// runOne acquires a concurrency slot and runs work for a single host,
+// honoring maxParallel, ctx's own deadline, and the Executor's
+// HostTimeout/GracePeriod. Hosts that don't get a slot before ctx is done
+// are reported NeverStarted rather than attempted. Once a host starts, its
+// context is decoupled from ctx's cancellation so a global deadline alone
+// can't cut it off mid-command; it keeps running until HostTimeout expires,
+// plus GracePeriod more if ctx's deadline arrives first.
+func (e *Executor) runOne(ctx context.Context, sem chan struct{}, host *inventory.Host, work func(context.Context) HostResult) HostResult {
+	select {
+	case sem <- struct{}{}:
+		defer func() { <-sem }()
+	case <-ctx.Done():
+		return HostResult{Host: host, Error: ctx.Err(), NeverStarted: true}
+	}
+
+	if e.HostTimeout <= 0 {
+		result := work(ctx)
+		result.Host = host
+		return result
+	}
+
+	hostCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), e.HostTimeout)
+	defer cancel()
+
+	done := make(chan HostResult, 1)
+	go func() { done <- work(hostCtx) }()
+
+	select {
+	case result := <-done:
+		result.Host = host
+		return result
+	case <-hostCtx.Done():
+		return HostResult{Host: host, Error: fmt.Errorf("exceeded host timeout of %s: %w", e.HostTimeout, ErrHostTimeout), TimedOut: true}
+	case <-ctx.Done():
+		// The operation's own deadline arrived while this host was still
+		// running. Give it GracePeriod more before forcing it down too.
+		select {
+		case result := <-done:
+			result.Host = host
+			return result
+		case <-time.After(e.GracePeriod):
+			return HostResult{Host: host, Error: fmt.Errorf("exceeded grace period after operation deadline: %w", ctx.Err()), TimedOut: true}
+		case <-hostCtx.Done():
+			return HostResult{Host: host, Error: fmt.Errorf("exceeded host timeout of %s: %w", e.HostTimeout, ErrHostTimeout), TimedOut: true}
+		}
+	}
+}
+
 // ExecOnHosts executes a command on multiple hosts in parallel
 func (e *Executor) ExecOnHosts(ctx context.Context, hosts []*inventory.Host, cmd string, sudo bool) []HostResult {
 	results := make([]HostResult, len(hosts))
@@ -45,21 +135,9 @@ func (e *Executor) ExecOnHosts(ctx context.Context, hosts []*inventory.Host, cmd
 		wg.Add(1)
 		go func(idx int, h *inventory.Host) {
 			defer wg.Done()
-
-			// Acquire semaphore
-			select {
-			case sem <- struct{}{}:
-				defer func() { <-sem }()
-			case <-ctx.Done():
-				results[idx] = HostResult{
-					Host:  h,
-					Error: ctx.Err(),
-				}
-				return
-			}
-
-			result := e.execOnHost(ctx, h, cmd, sudo)
-			results[idx] = result
+			results[idx] = e.runOne(ctx, sem, h, func(hostCtx context.Context) HostResult {
+				return e.execOnHost(hostCtx, h, cmd, sudo)
+			})
 		}(i, host)
 	}
 
@@ -97,6 +175,26 @@ func (e *Executor) execOnHost(ctx context.Context, host *inventory.Host, cmd str
 	}
 }
 
+// ExecRemoteCommandOnHosts builds rc's command line once and runs it across
+// hosts in parallel, the same way ExecOnHosts does for a bare string, except
+// each result's EffectiveUser records who the command actually ran as on
+// that host (which varies per host when rc doesn't Become, since each host
+// can have its own SSHUser).
+func (e *Executor) ExecRemoteCommandOnHosts(ctx context.Context, hosts []*inventory.Host, rc *RemoteCommand) ([]HostResult, string, error) {
+	cmd, err := rc.Build()
+	if err != nil {
+		return nil, "", err
+	}
+
+	results := e.ExecOnHosts(ctx, hosts, cmd, false)
+	for i := range results {
+		if results[i].Host != nil {
+			results[i].EffectiveUser = rc.EffectiveUser(results[i].Host.SSHUser)
+		}
+	}
+	return results, cmd, nil
+}
+
 // RunFunc runs a function for each host in parallel
 func (e *Executor) RunFunc(ctx context.Context, hosts []*inventory.Host, fn func(context.Context, *Client, *inventory.Host) error) []HostResult {
 	results := make([]HostResult, len(hosts))
@@ -108,33 +206,15 @@ func (e *Executor) RunFunc(ctx context.Context, hosts []*inventory.Host, fn func
 		wg.Add(1)
 		go func(idx int, h *inventory.Host) {
 			defer wg.Done()
-
-			select {
-			case sem <- struct{}{}:
-				defer func() { <-sem }()
-			case <-ctx.Done():
-				results[idx] = HostResult{
-					Host:  h,
-					Error: ctx.Err(),
-				}
-				return
-			}
-
-			client, err := e.pool.GetWithUser(ctx, h.Addr, h.SSHPort, h.SSHUser)
-			if err != nil {
-				results[idx] = HostResult{
-					Host:  h,
-					Error: fmt.Errorf("connecting: %w", err),
+			results[idx] = e.runOne(ctx, sem, h, func(hostCtx context.Context) HostResult {
+				client, err := e.pool.GetWithUser(hostCtx, h.Addr, h.SSHPort, h.SSHUser)
+				if err != nil {
+					return HostResult{Error: fmt.Errorf("connecting: %w", err)}
 				}
-				return
-			}
-
-			err = fn(ctx, client, h)
-			results[idx] = HostResult{
-				Host:    h,
-				Success: err == nil,
-				Error:   err,
-			}
+
+				err = fn(hostCtx, client, h)
+				return HostResult{Success: err == nil, Error: err}
+			})
 		}(i, host)
 	}
 
@@ -164,6 +244,30 @@ func CountErrors(results []HostResult) int {
 	return count
 }
 
+// CountTimedOut returns the number of results whose host exceeded the
+// Executor's HostTimeout (or GracePeriod after the operation's deadline).
+func CountTimedOut(results []HostResult) int {
+	count := 0
+	for _, r := range results {
+		if r.TimedOut {
+			count++
+		}
+	}
+	return count
+}
+
+// CountNeverStarted returns the number of hosts skipped because the
+// operation's deadline had already passed before they got a turn.
+func CountNeverStarted(results []HostResult) int {
+	count := 0
+	for _, r := range results {
+		if r.NeverStarted {
+			count++
+		}
+	}
+	return count
+}
+
 // FilterFailed returns only the failed results
 func FilterFailed(results []HostResult) []HostResult {
 	var failed []HostResult
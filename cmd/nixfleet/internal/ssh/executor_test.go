@@ -0,0 +1,110 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+)
+
+func TestRunOneNoHostTimeout(t *testing.T) {
+	e := &Executor{maxParallel: 1}
+	sem := make(chan struct{}, 1)
+	host := &inventory.Host{Name: "a"}
+
+	result := e.runOne(context.Background(), sem, host, func(ctx context.Context) HostResult {
+		return HostResult{Success: true}
+	})
+
+	if result.Host != host || !result.Success || result.TimedOut || result.NeverStarted {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestRunOneNeverStarted(t *testing.T) {
+	e := &Executor{maxParallel: 1}
+	sem := make(chan struct{}, 1)
+	sem <- struct{}{} // full, so the only ready case is ctx.Done()
+	host := &inventory.Host{Name: "a"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result := e.runOne(ctx, sem, host, func(ctx context.Context) HostResult {
+		t.Fatal("work should not run once ctx is already done")
+		return HostResult{}
+	})
+
+	if !result.NeverStarted || !errors.Is(result.Error, context.Canceled) {
+		t.Errorf("expected NeverStarted with context.Canceled, got %+v", result)
+	}
+}
+
+func TestRunOneHostTimeout(t *testing.T) {
+	e := &Executor{maxParallel: 1, HostTimeout: 20 * time.Millisecond}
+	sem := make(chan struct{}, 1)
+	host := &inventory.Host{Name: "a"}
+
+	result := e.runOne(context.Background(), sem, host, func(ctx context.Context) HostResult {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		return HostResult{Success: true}
+	})
+
+	if !result.TimedOut || !errors.Is(result.Error, ErrHostTimeout) {
+		t.Errorf("expected TimedOut with ErrHostTimeout, got %+v", result)
+	}
+}
+
+func TestRunOneSurvivesOperationDeadlineWithinGrace(t *testing.T) {
+	e := &Executor{maxParallel: 1, HostTimeout: time.Second, GracePeriod: 200 * time.Millisecond}
+	sem := make(chan struct{}, 1)
+	host := &inventory.Host{Name: "a"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	result := e.runOne(ctx, sem, host, func(ctx context.Context) HostResult {
+		time.Sleep(60 * time.Millisecond)
+		return HostResult{Success: true}
+	})
+
+	if result.TimedOut || result.NeverStarted || !result.Success {
+		t.Errorf("expected the in-flight host to survive the operation deadline via its grace period, got %+v", result)
+	}
+}
+
+func TestRunOneExceedsGracePeriod(t *testing.T) {
+	e := &Executor{maxParallel: 1, HostTimeout: time.Second, GracePeriod: 20 * time.Millisecond}
+	sem := make(chan struct{}, 1)
+	host := &inventory.Host{Name: "a"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	result := e.runOne(ctx, sem, host, func(ctx context.Context) HostResult {
+		time.Sleep(200 * time.Millisecond)
+		return HostResult{Success: true}
+	})
+
+	if !result.TimedOut || !errors.Is(result.Error, context.DeadlineExceeded) {
+		t.Errorf("expected TimedOut after grace period elapsed, got %+v", result)
+	}
+}
+
+func TestCountTimedOutAndNeverStarted(t *testing.T) {
+	results := []HostResult{
+		{TimedOut: true},
+		{NeverStarted: true},
+		{Success: true},
+	}
+
+	if got := CountTimedOut(results); got != 1 {
+		t.Errorf("CountTimedOut() = %d, want 1", got)
+	}
+	if got := CountNeverStarted(results); got != 1 {
+		t.Errorf("CountNeverStarted() = %d, want 1", got)
+	}
+}
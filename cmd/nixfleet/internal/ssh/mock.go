@@ -51,20 +51,39 @@ func (m *MockClient) RegisterCommandOutput(cmd, stdout string, exitCode int) {
 // Exec executes a command (mock implementation)
 func (m *MockClient) Exec(ctx context.Context, cmd string) (*ExecResult, error) {
 	m.ExecLog = append(m.ExecLog, cmd)
+	return m.lookup(cmd), nil
+}
 
-	// Check for exact match first
-	if result, ok := m.Commands[cmd]; ok {
-		return result, nil
+// ExecBatch executes multiple commands as a single mock exec, mirroring
+// Client.ExecBatch's one-remote-exec-per-batch behavior: it appends exactly
+// one entry to ExecLog regardless of len(cmds), so tests counting ExecLog
+// see the real number of remote round trips a caller would incur.
+func (m *MockClient) ExecBatch(ctx context.Context, cmds []Command) ([]*ExecResult, error) {
+	names := make([]string, len(cmds))
+	for i, c := range cmds {
+		names[i] = c.Cmd
+	}
+	m.ExecLog = append(m.ExecLog, "batch: "+strings.Join(names, " && "))
+
+	results := make([]*ExecResult, len(cmds))
+	for i, c := range cmds {
+		results[i] = m.lookup(c.Cmd)
 	}
+	return results, nil
+}
 
-	// Check for prefix matches (for parameterized commands)
+// lookup resolves a single command to its registered result, following the
+// same exact-then-prefix-match rules as Exec.
+func (m *MockClient) lookup(cmd string) *ExecResult {
+	if result, ok := m.Commands[cmd]; ok {
+		return result
+	}
 	for pattern, result := range m.Commands {
 		if strings.HasPrefix(cmd, pattern) {
-			return result, nil
+			return result
 		}
 	}
-
-	return m.DefaultResult, nil
+	return m.DefaultResult
 }
 
 // ExecSudo executes a command with sudo (mock implementation)
@@ -3,8 +3,12 @@ package ssh
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+	"github.com/nixfleet/nixfleet/internal/sshconfig"
 )
 
 // Pool manages a pool of SSH connections
@@ -14,6 +18,35 @@ type Pool struct {
 	config      *ClientConfig
 	maxIdle     time.Duration
 	cleanupStop chan struct{}
+
+	// sshConfigOverrides holds the IdentityFile/ProxyJump/ConnectTimeout a
+	// connection should use, keyed by the inventory Addr GetWithUser is
+	// called with, for hosts that opted into ssh_config resolution. See
+	// EnableSSHConfig.
+	sshConfigOverrides map[string]sshconfigOverride
+
+	// credentials resolves a per-host (or per-group) scoped key, taking
+	// priority over everything sshConfigOverrides/ClientConfig would
+	// otherwise offer. Nil unless SetCredentialStore was called.
+	credentials *CredentialStore
+}
+
+// SetCredentialStore arms the pool to look up a scoped credential for every
+// host it connects to. See CredentialStore for the fallback/caching
+// behavior; a host with no credential in store connects exactly as it would
+// without one.
+func (p *Pool) SetCredentialStore(store *CredentialStore) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.credentials = store
+}
+
+type sshconfigOverride struct {
+	user           string
+	port           int
+	identityFile   string
+	proxyJump      string
+	connectTimeout time.Duration
 }
 
 // PoolConfig holds configuration for the connection pool
@@ -52,7 +85,13 @@ func (p *Pool) Get(ctx context.Context, host string, port int) (*Client, error)
 	return p.GetWithUser(ctx, host, port, "")
 }
 
-// GetWithUser returns an SSH client for the given host with a specific user
+// GetWithUser returns an SSH client for the given host with a specific
+// user, reusing an already-connected client for that host:port:user rather
+// than dialing and re-authenticating. Consecutive Exec/ExecBatch calls
+// through the same *Client share one underlying connection and open a new
+// channel per call - no session renegotiation - so batching commands with
+// ExecBatch is what actually cuts round trips; the pool's job is just to
+// make sure repeated Gets don't undo that by paying for a fresh handshake.
 func (p *Pool) GetWithUser(ctx context.Context, host string, port int, user string) (*Client, error) {
 	key := fmt.Sprintf("%s@%s:%d", user, host, port)
 	if user == "" {
@@ -84,6 +123,44 @@ func (p *Pool) GetWithUser(ctx context.Context, host string, port int, user stri
 		cfg.User = user
 	}
 
+	// Safe without an extra lock: we're already holding p.mu from the
+	// write-lock section above. The override's user/port already reflect
+	// ResolveConnection's inventory-wins precedence, so they're safe to
+	// apply unconditionally over whatever the caller passed in.
+	if override, ok := p.sshConfigOverrides[host]; ok {
+		if override.user != "" {
+			cfg.User = override.user
+		}
+		if override.port != 0 {
+			cfg.Port = override.port
+		}
+		if override.identityFile != "" {
+			cfg.KeyFiles = append([]string{override.identityFile}, cfg.KeyFiles...)
+		}
+		if override.proxyJump != "" {
+			cfg.ProxyJump = override.proxyJump
+		}
+		if override.connectTimeout != 0 {
+			cfg.Timeout = override.connectTimeout
+		}
+	}
+
+	// A scoped credential wins over everything above: ssh_config and the
+	// pool's defaults exist to pick among keys a caller is willing to offer,
+	// but a host given its own key is meant to authenticate with *only*
+	// that key.
+	if p.credentials != nil {
+		signer, ok, err := p.credentials.SignerForHost(host)
+		if err != nil {
+			return nil, fmt.Errorf("resolving credential for %s: %w", host, err)
+		}
+		if ok {
+			cfg.Signer = signer
+			cfg.UseAgent = false
+			cfg.KeyFiles = nil
+		}
+	}
+
 	client, err := NewClient(host, &cfg)
 	if err != nil {
 		return nil, fmt.Errorf("creating client for %s: %w", host, err)
@@ -97,6 +174,79 @@ func (p *Pool) GetWithUser(ctx context.Context, host string, port int, user stri
 	return client, nil
 }
 
+// EnableSSHConfig resolves ssh_config (see internal/sshconfig.DefaultPaths)
+// for every host in inv that has opted in via UseSSHConfig, and arms the
+// pool to apply the resulting IdentityFile/ProxyJump/ConnectTimeout the next
+// time GetWithUser connects to that host's Addr. It also applies Host.
+// JumpHost, for hosts only reachable through a bastion, regardless of
+// UseSSHConfig - JumpHost wins over a ProxyJump resolved from ssh_config,
+// since it's an explicit inventory setting. It returns the set of
+// unsupported ssh_config directives encountered, deduplicated, for the
+// caller to warn about once - nil if neither feature applies to any host or
+// nothing unsupported was found.
+func (p *Pool) EnableSSHConfig(inv *inventory.Inventory) ([]string, error) {
+	var useSSHConfig, useJumpHosts bool
+	for _, h := range inv.AllHosts() {
+		if inv.UseSSHConfigForHost(h) {
+			useSSHConfig = true
+		}
+		if h.JumpHost != nil {
+			useJumpHosts = true
+		}
+	}
+	if !useSSHConfig && !useJumpHosts {
+		return nil, nil
+	}
+
+	var cfg *sshconfig.Config
+	if useSSHConfig {
+		var err error
+		cfg, err = sshconfig.Load(sshconfig.DefaultPaths())
+		if err != nil {
+			return nil, fmt.Errorf("loading ssh_config: %w", err)
+		}
+	}
+
+	overrides := make(map[string]sshconfigOverride)
+	for _, h := range inv.AllHosts() {
+		if !inv.UseSSHConfigForHost(h) && h.JumpHost == nil {
+			continue
+		}
+		resolved := ResolveConnection(inv, h, cfg)
+		var timeout time.Duration
+		if resolved.ConnectTimeout.Source == SourceSSHConfig {
+			timeout, _ = time.ParseDuration(resolved.ConnectTimeout.Value)
+		}
+		var identityFile, proxyJump string
+		if resolved.IdentityFile.Source == SourceSSHConfig {
+			identityFile = resolved.IdentityFile.Value
+		}
+		if resolved.ProxyJump.Source == SourceSSHConfig {
+			proxyJump = resolved.ProxyJump.Value
+		}
+		if h.JumpHost != nil {
+			proxyJump = h.JumpHost.String()
+		}
+		port, _ := strconv.Atoi(resolved.Port.Value)
+		overrides[h.Addr] = sshconfigOverride{
+			user:           resolved.User.Value,
+			port:           port,
+			identityFile:   identityFile,
+			proxyJump:      proxyJump,
+			connectTimeout: timeout,
+		}
+	}
+
+	p.mu.Lock()
+	p.sshConfigOverrides = overrides
+	p.mu.Unlock()
+
+	if cfg == nil {
+		return nil, nil
+	}
+	return cfg.Unsupported, nil
+}
+
 // Close closes all connections in the pool
 func (p *Pool) Close() error {
 	close(p.cleanupStop)
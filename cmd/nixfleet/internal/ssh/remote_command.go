@@ -0,0 +1,122 @@
+package ssh
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ShellMode controls how a RemoteCommand's Args are turned into the command
+// line sent over the SSH exec channel.
+type ShellMode string
+
+const (
+	// ShellSh runs Args joined with spaces as `sh -c '<joined>'`, the most
+	// portable choice and the default when Shell is left empty.
+	ShellSh ShellMode = "sh"
+	// ShellBash is the same as ShellSh but forces bash, for scripts that
+	// rely on bash-only syntax regardless of the host's login shell.
+	ShellBash ShellMode = "bash"
+	// ShellNone quotes each of Args individually and concatenates them with
+	// no shell wrapper at all, so a value containing spaces, quotes, or
+	// shell metacharacters is passed through literally instead of being
+	// re-interpreted. This is what makes `--` argument passing quoting-safe.
+	ShellNone ShellMode = "none"
+)
+
+// RemoteCommand describes an ad-hoc command to run on a host: what to run,
+// who to run it as, and how its arguments are encoded into the single
+// command string the SSH exec channel expects. Building it through Build
+// rather than string concatenation is what lets --env values and `--`
+// arguments contain spaces, quotes, or shell metacharacters safely.
+type RemoteCommand struct {
+	// Args is the command and its arguments. With Shell set to ShellNone
+	// each element is quoted and passed through as-is; otherwise the
+	// elements are joined with spaces and handed to a shell's -c, so a
+	// caller not using `--` typically passes the whole command line as a
+	// single already-shell-syntax element (e.g. "systemctl restart nginx").
+	Args []string
+	// Become runs the command via sudo. BecomeUser being non-empty implies
+	// Become and additionally passes `-u <user>`.
+	Become     bool
+	BecomeUser string
+	// Env is exported into the command's environment via a leading `env
+	// KEY=VALUE ...` prefix rather than shell variable assignments, so a
+	// value can't be reinterpreted as additional shell syntax.
+	Env map[string]string
+	// Chdir changes the working directory before running the command.
+	Chdir string
+	// Shell selects how Args is encoded; empty defaults to ShellSh.
+	Shell ShellMode
+}
+
+// Build renders rc into the single command string Client.Exec sends over
+// the SSH exec channel. Every value that came from the caller - Chdir,
+// BecomeUser, Env values, and Args in ShellNone mode - is quoted with
+// shQuote rather than concatenated raw, so nothing in them can break out
+// into shell syntax.
+func (rc *RemoteCommand) Build() (string, error) {
+	if len(rc.Args) == 0 {
+		return "", fmt.Errorf("remote command has no arguments")
+	}
+
+	var parts []string
+	if rc.Chdir != "" {
+		parts = append(parts, "cd", shQuote(rc.Chdir), "&&")
+	}
+	if rc.Become || rc.BecomeUser != "" {
+		parts = append(parts, "sudo")
+		if rc.BecomeUser != "" {
+			parts = append(parts, "-u", shQuote(rc.BecomeUser))
+		}
+	}
+	if len(rc.Env) > 0 {
+		parts = append(parts, "env")
+		for _, k := range sortedKeys(rc.Env) {
+			parts = append(parts, fmt.Sprintf("%s=%s", k, shQuote(rc.Env[k])))
+		}
+	}
+
+	switch rc.Shell {
+	case ShellNone:
+		for _, a := range rc.Args {
+			parts = append(parts, shQuote(a))
+		}
+	case ShellBash:
+		parts = append(parts, "bash", "-c", shQuote(strings.Join(rc.Args, " ")))
+	case ShellSh, "":
+		parts = append(parts, "sh", "-c", shQuote(strings.Join(rc.Args, " ")))
+	default:
+		return "", fmt.Errorf("unknown shell mode %q (want bash, sh, or none)", rc.Shell)
+	}
+
+	return strings.Join(parts, " "), nil
+}
+
+// EffectiveUser returns the user the command actually runs as once Become/
+// BecomeUser are applied, given the SSH user the connection authenticated
+// with. Root is assumed for a bare Become with no BecomeUser, matching
+// plain `sudo`'s default target.
+func (rc *RemoteCommand) EffectiveUser(sshUser string) string {
+	if rc.BecomeUser != "" {
+		return rc.BecomeUser
+	}
+	if rc.Become {
+		return "root"
+	}
+	return sshUser
+}
+
+// shQuote single-quotes a string for safe embedding in a /bin/sh command.
+func shQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,94 @@
+package ssh
+
+import "testing"
+
+func TestRemoteCommandBuild(t *testing.T) {
+	tests := []struct {
+		name string
+		rc   *RemoteCommand
+		want string
+	}{
+		{
+			name: "plain sh",
+			rc:   &RemoteCommand{Args: []string{"systemctl restart nginx"}},
+			want: `sh -c 'systemctl restart nginx'`,
+		},
+		{
+			name: "explicit bash",
+			rc:   &RemoteCommand{Args: []string{"echo $BASH_VERSION"}, Shell: ShellBash},
+			want: `bash -c 'echo $BASH_VERSION'`,
+		},
+		{
+			name: "become root",
+			rc:   &RemoteCommand{Args: []string{"apt-get update"}, Become: true},
+			want: `sudo sh -c 'apt-get update'`,
+		},
+		{
+			name: "become user",
+			rc:   &RemoteCommand{Args: []string{"psql -c 'select 1'"}, BecomeUser: "postgres"},
+			want: `sudo -u 'postgres' sh -c 'psql -c '\''select 1'\'''`,
+		},
+		{
+			name: "chdir",
+			rc:   &RemoteCommand{Args: []string{"ls"}, Chdir: "/var/log"},
+			want: `cd '/var/log' && sh -c 'ls'`,
+		},
+		{
+			name: "env vars sorted",
+			rc:   &RemoteCommand{Args: []string{"printenv"}, Env: map[string]string{"B": "2", "A": "1 two"}},
+			want: `env A='1 two' B='2' sh -c 'printenv'`,
+		},
+		{
+			name: "shell none quotes each arg",
+			rc:   &RemoteCommand{Args: []string{"psql", "-c", "select 1; drop table x"}, Shell: ShellNone},
+			want: `'psql' '-c' 'select 1; drop table x'`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rc.Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Build() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoteCommandBuildNoArgs(t *testing.T) {
+	rc := &RemoteCommand{}
+	if _, err := rc.Build(); err == nil {
+		t.Error("expected error for empty Args")
+	}
+}
+
+func TestRemoteCommandBuildUnknownShell(t *testing.T) {
+	rc := &RemoteCommand{Args: []string{"true"}, Shell: "fish"}
+	if _, err := rc.Build(); err == nil {
+		t.Error("expected error for unknown shell mode")
+	}
+}
+
+func TestRemoteCommandEffectiveUser(t *testing.T) {
+	tests := []struct {
+		name string
+		rc   *RemoteCommand
+		want string
+	}{
+		{"default", &RemoteCommand{}, "deploy"},
+		{"become", &RemoteCommand{Become: true}, "root"},
+		{"become user", &RemoteCommand{BecomeUser: "postgres"}, "postgres"},
+		{"become user wins over become", &RemoteCommand{Become: true, BecomeUser: "postgres"}, "postgres"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rc.EffectiveUser("deploy"); got != tt.want {
+				t.Errorf("EffectiveUser() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
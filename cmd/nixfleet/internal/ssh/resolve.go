@@ -0,0 +1,106 @@
+package ssh
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+	"github.com/nixfleet/nixfleet/internal/sshconfig"
+)
+
+// ConnectionSource says where a resolved connection parameter's effective
+// value came from, for `nixfleet host show` to report per-field provenance.
+type ConnectionSource string
+
+const (
+	SourceInventory ConnectionSource = "inventory"
+	SourceSSHConfig ConnectionSource = "ssh_config"
+	SourceDefault   ConnectionSource = "default"
+)
+
+// ConnectionField is one resolved connection parameter and where it came
+// from.
+type ConnectionField struct {
+	Value  string
+	Source ConnectionSource
+}
+
+// ResolvedConnection is a host's effective connection parameters after
+// merging inventory values with its ssh_config entry (if enabled). Inventory
+// values that were actually set in YAML always win; ssh_config only fills
+// in what inventory left unset, and a hardcoded default fills in anything
+// neither set.
+type ResolvedConnection struct {
+	HostName       ConnectionField
+	User           ConnectionField
+	Port           ConnectionField
+	IdentityFile   ConnectionField
+	ProxyJump      ConnectionField
+	ConnectTimeout ConnectionField
+}
+
+// ResolveConnection computes host's effective connection parameters. When
+// inv.UseSSHConfigForHost(host) is false, every field simply reflects the
+// inventory (or, for IdentityFile/ProxyJump/ConnectTimeout, which have no
+// inventory equivalent, the pool's own default). sshCfg may be nil, which
+// is treated the same as an empty config - useful for a host that has
+// ssh_config resolution enabled but no ~/.ssh/config exists.
+func ResolveConnection(inv *inventory.Inventory, host *inventory.Host, sshCfg *sshconfig.Config) *ResolvedConnection {
+	r := &ResolvedConnection{
+		HostName: ConnectionField{Value: host.Addr, Source: SourceInventory},
+	}
+
+	if host.SSHUserExplicit() {
+		r.User = ConnectionField{Value: host.SSHUser, Source: SourceInventory}
+	} else {
+		r.User = ConnectionField{Value: host.SSHUser, Source: SourceDefault}
+	}
+	if host.SSHPortExplicit() {
+		r.Port = ConnectionField{Value: portString(host.SSHPort), Source: SourceInventory}
+	} else {
+		r.Port = ConnectionField{Value: portString(host.SSHPort), Source: SourceDefault}
+	}
+	r.IdentityFile = ConnectionField{Source: SourceDefault}
+	r.ProxyJump = ConnectionField{Source: SourceDefault}
+	r.ConnectTimeout = ConnectionField{Value: DefaultConfig().Timeout.String(), Source: SourceDefault}
+
+	if !inv.UseSSHConfigForHost(host) || sshCfg == nil {
+		return r
+	}
+
+	p := sshCfg.Resolve(host.Name)
+
+	// p.HostName is deliberately not applied: Addr is a required inventory
+	// field, so it's always "present" and always wins under the "inventory
+	// overrides ssh_config" rule. ProxyJump/IdentityFile, which inventory
+	// has no field for at all, are where this feature actually pays off.
+
+	if !host.SSHUserExplicit() && p.User != "" {
+		r.User = ConnectionField{Value: p.User, Source: SourceSSHConfig}
+	}
+	if !host.SSHPortExplicit() {
+		if n, ok := p.PortNumber(); ok {
+			r.Port = ConnectionField{Value: portString(n), Source: SourceSSHConfig}
+		}
+	}
+	if p.IdentityFile != "" {
+		r.IdentityFile = ConnectionField{Value: p.IdentityFile, Source: SourceSSHConfig}
+	}
+	if p.ProxyJump != "" {
+		r.ProxyJump = ConnectionField{Value: p.ProxyJump, Source: SourceSSHConfig}
+	}
+	if p.ConnectTimeout != "" {
+		if d, err := time.ParseDuration(p.ConnectTimeout + "s"); err == nil {
+			r.ConnectTimeout = ConnectionField{Value: d.String(), Source: SourceSSHConfig}
+		}
+	}
+
+	return r
+}
+
+func portString(port int) string {
+	if port == 0 {
+		return ""
+	}
+	return strconv.Itoa(port)
+}
@@ -0,0 +1,122 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nixfleet/nixfleet/internal/inventory"
+	"github.com/nixfleet/nixfleet/internal/sshconfig"
+)
+
+func loadTestSSHConfig(t *testing.T, contents string) *sshconfig.Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("writing test ssh_config: %v", err)
+	}
+	cfg, err := sshconfig.Load([]string{path})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return cfg
+}
+
+func newTestHost(name, addr string) *inventory.Host {
+	inv := inventory.NewInventory()
+	inv.Hosts[name] = &inventory.Host{Name: name, Addr: addr, Base: "ubuntu"}
+	// Mirror the loader's applyHostDefaults so tests see the same
+	// SSHUser/SSHPort defaulting real inventory hosts get.
+	h := inv.Hosts[name]
+	if h.SSHUser == "" {
+		h.SSHUser = "deploy"
+	}
+	if h.SSHPort == 0 {
+		h.SSHPort = 22
+	}
+	return h
+}
+
+func TestResolveConnectionDisabledUsesInventoryOnly(t *testing.T) {
+	inv := inventory.NewInventory()
+	host := newTestHost("web3", "10.0.0.5")
+	inv.Hosts["web3"] = host
+
+	cfg := loadTestSSHConfig(t, "Host web3\n    User admin\n    ProxyJump bastion\n")
+	resolved := ResolveConnection(inv, host, cfg)
+
+	if resolved.User.Value != "deploy" || resolved.User.Source != SourceDefault {
+		t.Errorf("User = %+v, want deploy/default when ssh_config isn't enabled", resolved.User)
+	}
+	if resolved.ProxyJump.Value != "" || resolved.ProxyJump.Source != SourceDefault {
+		t.Errorf("ProxyJump = %+v, want empty/default when ssh_config isn't enabled", resolved.ProxyJump)
+	}
+}
+
+func TestResolveConnectionFillsUnsetFields(t *testing.T) {
+	inv := inventory.NewInventory()
+	inv.UseSSHConfig = true
+	host := newTestHost("web3", "10.0.0.5")
+	inv.Hosts["web3"] = host
+
+	cfg := loadTestSSHConfig(t, "Host web3\n    User admin\n    ProxyJump bastion\n    IdentityFile ~/.ssh/web_key\n")
+	resolved := ResolveConnection(inv, host, cfg)
+
+	if resolved.User.Value != "admin" || resolved.User.Source != SourceSSHConfig {
+		t.Errorf("User = %+v, want admin/ssh_config", resolved.User)
+	}
+	if resolved.ProxyJump.Value != "bastion" || resolved.ProxyJump.Source != SourceSSHConfig {
+		t.Errorf("ProxyJump = %+v, want bastion/ssh_config", resolved.ProxyJump)
+	}
+	if resolved.IdentityFile.Source != SourceSSHConfig {
+		t.Errorf("IdentityFile.Source = %v, want ssh_config", resolved.IdentityFile.Source)
+	}
+}
+
+func TestResolveConnectionInventoryOverridesSSHConfig(t *testing.T) {
+	invPath := filepath.Join(t.TempDir(), "hosts.yaml")
+	yaml := "use_ssh_config: true\nhosts:\n  web3:\n    addr: 10.0.0.5\n    ssh_user: explicit-user\n"
+	if err := os.WriteFile(invPath, []byte(yaml), 0o600); err != nil {
+		t.Fatalf("writing test inventory: %v", err)
+	}
+	inv, err := inventory.LoadFromFile(invPath)
+	if err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	host, _ := inv.GetHost("web3")
+
+	cfg := loadTestSSHConfig(t, "Host web3\n    User admin\n")
+	resolved := ResolveConnection(inv, host, cfg)
+
+	if resolved.User.Value != "explicit-user" || resolved.User.Source != SourceInventory {
+		t.Errorf("User = %+v, want explicit-user/inventory (inventory should win)", resolved.User)
+	}
+}
+
+func TestResolveConnectionPerHostOverridesGlobalDefault(t *testing.T) {
+	inv := inventory.NewInventory()
+	inv.UseSSHConfig = false
+	host := newTestHost("web3", "10.0.0.5")
+	disabled := false
+	host.UseSSHConfig = &disabled
+	inv.Hosts["web3"] = host
+
+	cfg := loadTestSSHConfig(t, "Host web3\n    ProxyJump bastion\n")
+	resolved := ResolveConnection(inv, host, cfg)
+
+	if resolved.ProxyJump.Source != SourceDefault {
+		t.Errorf("ProxyJump.Source = %v, want default (host opted out of the fleet-wide default)", resolved.ProxyJump.Source)
+	}
+}
+
+func TestResolveConnectionNilConfig(t *testing.T) {
+	inv := inventory.NewInventory()
+	inv.UseSSHConfig = true
+	host := newTestHost("web3", "10.0.0.5")
+	inv.Hosts["web3"] = host
+
+	resolved := ResolveConnection(inv, host, nil)
+	if resolved.User.Value != "deploy" {
+		t.Errorf("User = %+v, want the inventory default when there's no ssh_config to consult", resolved.User)
+	}
+}
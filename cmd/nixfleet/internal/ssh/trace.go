@@ -0,0 +1,148 @@
+package ssh
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// CommandTrace is one recorded call through Client.Exec/ExecSudo.
+type CommandTrace struct {
+	Time      time.Time `json:"time"`
+	Host      string    `json:"host"`
+	Sudo      bool      `json:"sudo"`
+	Operation string    `json:"operation,omitempty"`
+	Command   string    `json:"command"`
+
+	// Suspect flags a command whose text matches a common secret-bearing
+	// pattern (a password/token/key embedded literally). It's a prompt to
+	// go audit that call site, not a confirmed leak.
+	Suspect bool `json:"suspect,omitempty"`
+}
+
+// suspectPatterns catches command strings that embed what looks like a
+// literal secret rather than a path to one - e.g. a password on a command
+// line (visible in `ps`, shell history, and now the trace itself) instead
+// of a file or env var reference.
+var suspectPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)-{1,2}password[= ]\S+`),
+	regexp.MustCompile(`(?i)passwd[= ]\S+`),
+	regexp.MustCompile(`(?i)(api[_-]?key|token|secret)[= ]\S{8,}`),
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`AGE-SECRET-KEY-1[A-Z0-9]+`),
+}
+
+// looksLikeSecret reports whether cmd appears to embed a literal secret.
+func looksLikeSecret(cmd string) bool {
+	for _, p := range suspectPatterns {
+		if p.MatchString(cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tracer records every command a Client would run to w as JSONL, one
+// CommandTrace per line. When DryRun is true, Exec/ExecSudo record the
+// command and return a canned success ExecResult without dialing the host
+// or the network at all, so a full command plan (e.g. `apply --dry-run` is
+// not enough for, since it stops before building the SSH command strings)
+// can be reviewed offline.
+type Tracer struct {
+	DryRun bool
+
+	mu       sync.Mutex
+	w        io.Writer
+	perHost  map[string]int
+	suspects int
+}
+
+// NewTracer creates a Tracer that appends JSONL trace entries to w.
+func NewTracer(w io.Writer, dryRun bool) *Tracer {
+	return &Tracer{
+		DryRun:  dryRun,
+		w:       w,
+		perHost: make(map[string]int),
+	}
+}
+
+// record appends a trace entry and updates the running per-host/suspect
+// counts used by Summary.
+func (t *Tracer) record(ctx context.Context, host, cmd string, sudo bool) {
+	entry := CommandTrace{
+		Time:      time.Now(),
+		Host:      host,
+		Sudo:      sudo,
+		Operation: operationFromContext(ctx),
+		Command:   cmd,
+		Suspect:   looksLikeSecret(cmd),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.perHost[host]++
+	if entry.Suspect {
+		t.suspects++
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	t.w.Write(append(data, '\n'))
+}
+
+// Summary reports how many commands were traced per host, and how many
+// looked like they embedded a literal secret.
+func (t *Tracer) Summary() (perHost map[string]int, suspects int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	perHost = make(map[string]int, len(t.perHost))
+	for host, n := range t.perHost {
+		perHost[host] = n
+	}
+	return perHost, t.suspects
+}
+
+var (
+	tracerMu sync.RWMutex
+	tracer   *Tracer
+)
+
+// SetTracer installs t as the process-wide command tracer; every
+// Client.Exec/ExecSudo call records to it from then on. A nil t disables
+// tracing.
+func SetTracer(t *Tracer) {
+	tracerMu.Lock()
+	defer tracerMu.Unlock()
+	tracer = t
+}
+
+// activeTracer returns the current tracer, if any.
+func activeTracer() *Tracer {
+	tracerMu.RLock()
+	defer tracerMu.RUnlock()
+	return tracer
+}
+
+// operationKey scopes the context value WithOperation stores, so it can't
+// collide with a key some other package puts in the same context.
+type operationKey struct{}
+
+// WithOperation returns a context tagging every Client.Exec/ExecSudo call
+// made with it (or a context derived from it) as belonging to op, e.g.
+// "apply" or "pki deploy" - purely for the command tracer; it has no effect
+// when no Tracer is installed.
+func WithOperation(ctx context.Context, op string) context.Context {
+	return context.WithValue(ctx, operationKey{}, op)
+}
+
+func operationFromContext(ctx context.Context) string {
+	op, _ := ctx.Value(operationKey{}).(string)
+	return op
+}
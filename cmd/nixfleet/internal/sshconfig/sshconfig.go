@@ -0,0 +1,322 @@
+// Package sshconfig parses OpenSSH client config files (ssh_config(5)) far
+// enough to resolve the handful of directives nixfleet's SSH pool cares
+// about - HostName, User, Port, IdentityFile, ProxyJump, and ConnectTimeout -
+// with the same Host/Match pattern precedence real ssh uses: the first block
+// that matches a given alias wins, independently for each keyword.
+//
+// This is intentionally not a complete ssh_config implementation. Anything
+// else encountered (ControlMaster, ServerAliveInterval, Include, "Match"
+// blocks with criteria other than a plain host pattern, ...) is recorded in
+// Config.Unsupported instead of applied, so callers can warn about it once
+// rather than silently ignoring settings a fleet operator tuned by hand.
+package sshconfig
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Params holds the directive values collected for one Host/Match block.
+// Fields are empty when the directive wasn't set in that block.
+type Params struct {
+	HostName       string
+	User           string
+	Port           string
+	IdentityFile   string
+	ProxyJump      string
+	ConnectTimeout string
+}
+
+// pattern is one space-separated token of a Host (or "Match host") pattern
+// list, e.g. "web*" or the negated "!web9".
+type pattern struct {
+	negate bool
+	text   string
+}
+
+func (p pattern) match(alias string) bool {
+	return wildcardMatch(p.text, alias)
+}
+
+// block is one Host or Match section of an ssh_config file, in file order.
+type block struct {
+	patterns         []pattern
+	isMatch          bool
+	matchUnsupported bool // a Match block with criteria we don't evaluate
+	params           Params
+}
+
+func (b *block) matches(alias string) bool {
+	if b.isMatch {
+		if b.matchUnsupported {
+			return false
+		}
+	}
+	matched := false
+	for _, p := range b.patterns {
+		if p.match(alias) {
+			if p.negate {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// Config is a parsed, ordered sequence of ssh_config blocks, typically
+// assembled from the user's ~/.ssh/config followed by the system-wide
+// /etc/ssh/ssh_config, mirroring how ssh(1) itself reads them.
+type Config struct {
+	blocks []*block
+
+	// Unsupported lists directive (or "Match <criteria>") names that were
+	// encountered but not applied, in first-seen order with duplicates
+	// removed, so a caller can print each one exactly once.
+	Unsupported []string
+	seen        map[string]bool
+}
+
+// directivesApplied are the keywords Resolve actually understands. Anything
+// else parsed inside a Host/Match block is recorded in Config.Unsupported.
+var directivesApplied = map[string]bool{
+	"hostname":       true,
+	"user":           true,
+	"port":           true,
+	"identityfile":   true,
+	"proxyjump":      true,
+	"connecttimeout": true,
+}
+
+// DefaultPaths returns the ssh_config files ssh(1) itself consults, in the
+// order they take precedence (user config first), filtered to those that
+// actually exist. A caller with nothing to load gets an empty slice, not an
+// error - most hosts simply won't have a system-wide ssh_config.
+func DefaultPaths() []string {
+	var paths []string
+	if home, err := os.UserHomeDir(); err == nil {
+		p := filepath.Join(home, ".ssh", "config")
+		if _, err := os.Stat(p); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	if _, err := os.Stat("/etc/ssh/ssh_config"); err == nil {
+		paths = append(paths, "/etc/ssh/ssh_config")
+	}
+	return paths
+}
+
+// Load parses paths in order and returns the combined Config. A missing file
+// is skipped rather than treated as an error, since DefaultPaths already
+// filters those out but callers may pass explicit paths of their own.
+func Load(paths []string) (*Config, error) {
+	cfg := &Config{seen: make(map[string]bool)}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		err = cfg.parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) parse(f *os.File) error {
+	// Directives before the first Host/Match block behave like an implicit
+	// "Host *" - they apply to every alias.
+	current := &block{patterns: []pattern{{text: "*"}}}
+	cfg.blocks = append(cfg.blocks, current)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := splitDirective(line)
+		if !ok {
+			continue
+		}
+		lower := strings.ToLower(key)
+
+		switch lower {
+		case "host":
+			current = &block{patterns: parsePatterns(value)}
+			cfg.blocks = append(cfg.blocks, current)
+			continue
+		case "match":
+			fields := strings.Fields(value)
+			current = &block{isMatch: true}
+			if len(fields) == 2 && strings.EqualFold(fields[0], "host") {
+				current.patterns = parsePatterns(fields[1])
+			} else {
+				// "Match all", "Match exec ...", "Match user ...", etc. -
+				// we only understand a bare host pattern.
+				current.matchUnsupported = true
+				cfg.noteUnsupported(fmt.Sprintf("Match %s", value))
+			}
+			cfg.blocks = append(cfg.blocks, current)
+			continue
+		}
+
+		if !directivesApplied[lower] {
+			cfg.noteUnsupported(key)
+			continue
+		}
+
+		switch lower {
+		case "hostname":
+			current.params.HostName = value
+		case "user":
+			current.params.User = value
+		case "port":
+			current.params.Port = value
+		case "identityfile":
+			if current.params.IdentityFile == "" {
+				current.params.IdentityFile = expandTilde(value)
+			}
+		case "proxyjump":
+			current.params.ProxyJump = value
+		case "connecttimeout":
+			current.params.ConnectTimeout = value
+		}
+	}
+	return scanner.Err()
+}
+
+func (cfg *Config) noteUnsupported(name string) {
+	if cfg.seen[name] {
+		return
+	}
+	cfg.seen[name] = true
+	cfg.Unsupported = append(cfg.Unsupported, name)
+}
+
+// Resolve returns the effective Params for alias, applying first-match-wins
+// per field across every Host/Match block that matches it, in file order -
+// the same semantics ssh(1) itself uses, where later blocks can only fill in
+// directives an earlier match left unset.
+func (cfg *Config) Resolve(alias string) Params {
+	var result Params
+	for _, b := range cfg.blocks {
+		if !b.matches(alias) {
+			continue
+		}
+		if result.HostName == "" {
+			result.HostName = b.params.HostName
+		}
+		if result.User == "" {
+			result.User = b.params.User
+		}
+		if result.Port == "" {
+			result.Port = b.params.Port
+		}
+		if result.IdentityFile == "" {
+			result.IdentityFile = b.params.IdentityFile
+		}
+		if result.ProxyJump == "" {
+			result.ProxyJump = b.params.ProxyJump
+		}
+		if result.ConnectTimeout == "" {
+			result.ConnectTimeout = b.params.ConnectTimeout
+		}
+	}
+	return result
+}
+
+// PortNumber parses p.Port, returning ok=false if it's empty or invalid.
+func (p Params) PortNumber() (int, bool) {
+	if p.Port == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(p.Port)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+func splitDirective(line string) (key, value string, ok bool) {
+	// ssh_config allows "Key Value", "Key=Value", and "Key = Value".
+	line = strings.TrimSpace(strings.Replace(line, "=", " ", 1))
+	fields := strings.SplitN(line, " ", 2)
+	if len(fields) != 2 {
+		return "", "", false
+	}
+	value = strings.TrimSpace(fields[1])
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		value = value[1 : len(value)-1]
+	}
+	if value == "" {
+		return "", "", false
+	}
+	return fields[0], value, true
+}
+
+func parsePatterns(value string) []pattern {
+	var patterns []pattern
+	for _, tok := range strings.Fields(value) {
+		p := pattern{text: tok}
+		if strings.HasPrefix(tok, "!") {
+			p.negate = true
+			p.text = tok[1:]
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+func expandTilde(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+// wildcardMatch reports whether alias matches an ssh_config pattern, where
+// '*' matches any run of characters (including none) and '?' matches
+// exactly one.
+func wildcardMatch(pattern, alias string) bool {
+	return wildcardMatchRunes([]rune(pattern), []rune(alias))
+}
+
+func wildcardMatchRunes(pattern, alias []rune) bool {
+	if len(pattern) == 0 {
+		return len(alias) == 0
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(alias); i++ {
+			if wildcardMatchRunes(pattern[1:], alias[i:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		if len(alias) == 0 {
+			return false
+		}
+		return wildcardMatchRunes(pattern[1:], alias[1:])
+	default:
+		if len(alias) == 0 || pattern[0] != alias[0] {
+			return false
+		}
+		return wildcardMatchRunes(pattern[1:], alias[1:])
+	}
+}
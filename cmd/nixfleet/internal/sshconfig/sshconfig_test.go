@@ -0,0 +1,165 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, contents string) *Config {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("writing test config: %v", err)
+	}
+	cfg, err := Load([]string{path})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return cfg
+}
+
+func TestResolveBasicHost(t *testing.T) {
+	cfg := writeConfig(t, `
+Host web3
+    HostName 10.0.0.5
+    User admin
+    Port 2222
+    IdentityFile ~/.ssh/web_key
+    ProxyJump bastion
+    ConnectTimeout 5
+`)
+
+	p := cfg.Resolve("web3")
+	if p.HostName != "10.0.0.5" {
+		t.Errorf("HostName = %q, want 10.0.0.5", p.HostName)
+	}
+	if p.User != "admin" {
+		t.Errorf("User = %q, want admin", p.User)
+	}
+	if p.Port != "2222" {
+		t.Errorf("Port = %q, want 2222", p.Port)
+	}
+	if p.ProxyJump != "bastion" {
+		t.Errorf("ProxyJump = %q, want bastion", p.ProxyJump)
+	}
+	if p.ConnectTimeout != "5" {
+		t.Errorf("ConnectTimeout = %q, want 5", p.ConnectTimeout)
+	}
+	if !filepath.IsAbs(p.IdentityFile) {
+		t.Errorf("IdentityFile = %q, want an expanded absolute path", p.IdentityFile)
+	}
+}
+
+func TestResolveFirstMatchWins(t *testing.T) {
+	cfg := writeConfig(t, `
+Host web*
+    User first
+    Port 22
+
+Host web3
+    User second
+`)
+
+	p := cfg.Resolve("web3")
+	if p.User != "first" {
+		t.Errorf("User = %q, want first (first matching block should win)", p.User)
+	}
+	if p.Port != "22" {
+		t.Errorf("Port = %q, want 22", p.Port)
+	}
+}
+
+func TestResolveNegatedPattern(t *testing.T) {
+	cfg := writeConfig(t, `
+Host web* !web9
+    ProxyJump bastion
+`)
+
+	if p := cfg.Resolve("web1"); p.ProxyJump != "bastion" {
+		t.Errorf("web1: ProxyJump = %q, want bastion", p.ProxyJump)
+	}
+	if p := cfg.Resolve("web9"); p.ProxyJump != "" {
+		t.Errorf("web9: ProxyJump = %q, want empty (negated pattern excludes it)", p.ProxyJump)
+	}
+}
+
+func TestResolveNoMatch(t *testing.T) {
+	cfg := writeConfig(t, `
+Host db1
+    User dbadmin
+`)
+
+	p := cfg.Resolve("web3")
+	if p.User != "" {
+		t.Errorf("User = %q, want empty for a non-matching alias", p.User)
+	}
+}
+
+func TestUnsupportedDirectivesRecordedOnce(t *testing.T) {
+	cfg := writeConfig(t, `
+Host *
+    ControlMaster auto
+    ControlPath ~/.ssh/cm-%r@%h:%p
+
+Host web3
+    ControlMaster auto
+`)
+
+	if len(cfg.Unsupported) != 2 {
+		t.Fatalf("Unsupported = %v, want 2 unique entries", cfg.Unsupported)
+	}
+	if cfg.Unsupported[0] != "ControlMaster" {
+		t.Errorf("Unsupported[0] = %q, want ControlMaster", cfg.Unsupported[0])
+	}
+}
+
+func TestMatchWithUnsupportedCriteriaIgnored(t *testing.T) {
+	cfg := writeConfig(t, `
+Match exec "/bin/true"
+    User should-not-apply
+
+Host web3
+    User admin
+`)
+
+	p := cfg.Resolve("web3")
+	if p.User != "admin" {
+		t.Errorf("User = %q, want admin (Match exec block should be skipped)", p.User)
+	}
+	found := false
+	for _, u := range cfg.Unsupported {
+		if u == `Match exec "/bin/true"` {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected Match exec criteria to be recorded as unsupported, got %v", cfg.Unsupported)
+	}
+}
+
+func TestGlobalDirectivesApplyBeforeFirstHost(t *testing.T) {
+	cfg := writeConfig(t, `
+ConnectTimeout 10
+
+Host web3
+    User admin
+`)
+
+	p := cfg.Resolve("web3")
+	if p.ConnectTimeout != "10" {
+		t.Errorf("ConnectTimeout = %q, want 10 (global default should apply)", p.ConnectTimeout)
+	}
+}
+
+func TestPortNumber(t *testing.T) {
+	if _, ok := (Params{}).PortNumber(); ok {
+		t.Error("expected ok=false for an empty Port")
+	}
+	p := Params{Port: "2222"}
+	n, ok := p.PortNumber()
+	if !ok || n != 2222 {
+		t.Errorf("PortNumber() = (%d, %v), want (2222, true)", n, ok)
+	}
+}
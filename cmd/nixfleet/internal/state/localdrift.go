@@ -0,0 +1,114 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"syscall"
+)
+
+// ReadStateLocal reads state.json directly off local disk, for callers
+// running on the managed host itself (e.g. the pull-mode agent) rather than
+// a central controller with an SSH connection. Unlike Manager.ReadState, a
+// missing or unparsable file is an error here rather than an empty state,
+// since a local caller has no business writing back a blank one.
+func ReadStateLocal(path string) (*HostState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading state: %w", err)
+	}
+
+	var hostState HostState
+	if err := json.Unmarshal(data, &hostState); err != nil {
+		return nil, fmt.Errorf("parsing state: %w", err)
+	}
+
+	return &hostState, nil
+}
+
+// WriteStateLocal writes state.json directly to local disk, the local
+// counterpart to Manager.WriteState.
+func WriteStateLocal(path string, hostState *HostState) error {
+	hostState.PruneExpiredAnnotations()
+
+	data, err := json.MarshalIndent(hostState, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling state: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+
+	return nil
+}
+
+// CheckDriftLocal is CheckDrift's local-filesystem counterpart: it hashes
+// and stats expectedFiles directly with os.ReadFile/os.Stat instead of
+// batching sha256sum/stat over SSH, so a pull-mode host can self-check drift
+// against its own state.json without a central server connecting in.
+func CheckDriftLocal(expectedFiles map[string]FileState) ([]DriftResult, error) {
+	if len(expectedFiles) == 0 {
+		return nil, nil
+	}
+
+	paths := make([]string, 0, len(expectedFiles))
+	for path := range expectedFiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	results := make([]DriftResult, 0, len(paths))
+	for _, path := range paths {
+		expected := expectedFiles[path]
+		result := DriftResult{Path: path, Expected: expected}
+
+		actual, err := statFileLocal(path)
+		if err != nil {
+			result.Status = DriftStatusMissing
+			results = append(results, result)
+			continue
+		}
+
+		result.Actual = actual
+		result.Status = evaluateDriftStatus(expected, actual)
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// statFileLocal hashes path's content and looks up its mode/owner/group,
+// matching the format CheckDrift's `sha256sum` / `stat -c '%a %U %G'` pair
+// produces remotely, so the same FileState values compare equal either way.
+func statFileLocal(path string) (FileState, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return FileState{}, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileState{}, err
+	}
+
+	actual := FileState{
+		Path: path,
+		Hash: hashContent(content),
+		Mode: fmt.Sprintf("%o", info.Mode().Perm()),
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		if u, err := user.LookupId(strconv.FormatUint(uint64(stat.Uid), 10)); err == nil {
+			actual.Owner = u.Username
+		}
+		if g, err := user.LookupGroupId(strconv.FormatUint(uint64(stat.Gid), 10)); err == nil {
+			actual.Group = g.Name
+		}
+	}
+
+	return actual, nil
+}
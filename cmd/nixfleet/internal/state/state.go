@@ -7,9 +7,13 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/nixfleet/nixfleet/internal/osupdate"
+	"github.com/nixfleet/nixfleet/internal/pki"
+	"github.com/nixfleet/nixfleet/internal/probe"
 	"github.com/nixfleet/nixfleet/internal/ssh"
 )
 
@@ -31,6 +35,11 @@ type OSInfo struct {
 	Architecture string `json:"architecture"` // e.g., "x86_64"
 	Uptime       string `json:"uptime"`       // e.g., "5 days, 3:22"
 	LastBoot     string `json:"last_boot"`    // e.g., "2024-12-18 10:30:00"
+
+	// EOL is VersionID's end-of-life standing, plus live ESM/Livepatch
+	// entitlement when ua/pro is installed. Nil when VersionID isn't in
+	// osupdate's EOL table (e.g. a non-Ubuntu host).
+	EOL *osupdate.EOLStatus `json:"eol,omitempty"`
 }
 
 // HostState represents the current state of a managed host
@@ -42,6 +51,16 @@ type HostState struct {
 	// OS Information
 	OSInfo *OSInfo `json:"os_info,omitempty"`
 
+	// PreviousBase archives this host's base-specific state (managed files,
+	// update tracking, OS info) from just before its most recent
+	// 'nixfleet host migrate', in case the migration needs investigating
+	// after the fact. Nil for a host that has never migrated.
+	PreviousBase *PreviousBaseState `json:"previous_base,omitempty"`
+
+	// MigrationHistory records every base change 'nixfleet host migrate' has
+	// performed on this host, oldest first.
+	MigrationHistory []MigrationRecord `json:"migration_history,omitempty"`
+
 	// Current deployment
 	CurrentGeneration int       `json:"current_generation"`
 	ManifestHash      string    `json:"manifest_hash"`
@@ -49,6 +68,25 @@ type HostState struct {
 	LastApply         time.Time `json:"last_apply"`
 	ApplyDuration     string    `json:"apply_duration"`
 
+	// Generations records every generation nixfleet has created on this
+	// host, including ones a failed activation or a later rollback made
+	// obsolete, so 'nixfleet host cleanup-generations' has something to
+	// reason about beyond what the profile's own generation listing shows.
+	// See Manager.RecordGeneration and Manager.MarkGenerationOutcome.
+	Generations []GenerationRecord `json:"generations,omitempty"`
+
+	// StagedClosure records a closure copied ahead of activation by
+	// 'nixfleet apply --stage-only', pending a later plain apply (which
+	// activates it in place of re-copying) or 'apply --unstage' (which
+	// releases it). Nil once neither applies. See Manager.UpdateStaged and
+	// Manager.ClearStaged.
+	StagedClosure *StagedClosure `json:"staged_closure,omitempty"`
+
+	// Profiles tracks the non-system outputs deployed alongside the system
+	// closure (see inventory.Host.Profiles), keyed by target in "kind:name"
+	// form, e.g. "home-manager:ztaylor". See Manager.RecordProfileGeneration.
+	Profiles map[string]*ProfileState `json:"profiles,omitempty"`
+
 	// OS Updates
 	LastOSUpdate      time.Time     `json:"last_os_update,omitempty"`
 	PendingUpdates    int           `json:"pending_updates"`
@@ -56,31 +94,184 @@ type HostState struct {
 	LastUpdateCheck   time.Time     `json:"last_update_check,omitempty"`
 	UpdatePackageDiff []PackageDiff `json:"update_package_diff,omitempty"`
 
-	// Reboot status
+	// Reboot status. RebootRequired means the kernel (or another
+	// reboot-only change, e.g. a libc soname bump) changed and only a
+	// reboot fixes it; services flagged in ServicesNeedingRestart can be
+	// fixed by restarting them without rebooting.
 	RebootRequired bool      `json:"reboot_required"`
 	RebootPackages []string  `json:"reboot_packages,omitempty"`
 	LastReboot     time.Time `json:"last_reboot,omitempty"`
 
+	// LastRebootValidation is the post-reboot validation suite's outcome
+	// from the most recent reboot - mounts, RAID/ZFS health, systemd
+	// targets, NTP sync, kernel version, and any configured probes. Nil for
+	// a host that hasn't gone through 'nixfleet reboot now' with validation
+	// configured. A host that came back over SSH but failed validation
+	// stays visible here (rather than looking identical to a clean reboot)
+	// until someone re-runs validation and it passes. See
+	// Manager.RecordRebootValidation and reboot.Orchestrator.ValidatePostReboot.
+	LastRebootValidation *probe.Results `json:"last_reboot_validation,omitempty"`
+
+	// ServicesNeedingRestart lists services still running against
+	// since-replaced libraries or binaries after an update, per
+	// osupdate.CheckServicesNeedingRestart. Cleared once they've been
+	// restarted (or the host has rebooted).
+	ServicesNeedingRestart []string `json:"services_needing_restart,omitempty"`
+
 	// Service health
 	ServiceHealth map[string]ServiceStatus `json:"service_health,omitempty"`
 
 	// Managed files
 	ManagedFiles map[string]FileState `json:"managed_files,omitempty"`
 
+	// ManagedDirs declares directories nixfleet owns the membership of, so
+	// CheckManagedDirs can flag a file dropped into one that isn't on its
+	// allowlist - drift CheckDrift can't see, since it only ever compares
+	// paths it already knows about.
+	ManagedDirs []ManagedDir `json:"managed_dirs,omitempty"`
+
+	// Deployed secrets, keyed by destination path on the host. Lets a later
+	// deploy tell a secret that's no longer assigned to this host from one
+	// that just hasn't changed, so it can be pruned instead of left behind.
+	DeployedSecrets map[string]DeployedSecret `json:"deployed_secrets,omitempty"`
+
 	// Drift detection
 	DriftDetected  bool      `json:"drift_detected"`
 	DriftFiles     []string  `json:"drift_files,omitempty"`
 	LastDriftCheck time.Time `json:"last_drift_check,omitempty"`
 
+	// Approvals records drift that was deliberately accepted rather than
+	// reverted, keyed by file path. An apply won't silently overwrite these
+	// paths - see Manager.AcceptDrift.
+	Approvals map[string]Approval `json:"approvals,omitempty"`
+
 	// k0s Kubernetes state (for reconciliation)
 	K0s *K0sState `json:"k0s,omitempty"`
 
+	// K0sUpgrade records this host's progress through the most recent
+	// 'nixfleet k0s upgrade', so an aborted upgrade can be resumed without
+	// re-upgrading nodes that already finished. Nil once no upgrade has run.
+	K0sUpgrade *K0sUpgradeState `json:"k0s_upgrade,omitempty"`
+
+	// PKIAgent reports whether this host is renewing its own certificate
+	// via the on-host renewal agent, and when it last did so. See
+	// Manager.GatherPKIAgentInfo.
+	PKIAgent *PKIAgentState `json:"pki_agent,omitempty"`
+
+	// PKIScan summarizes the most recent certificate inventory scan of this
+	// host (see 'nixfleet pki scan' and Manager.UpdatePKIScan) - certs found
+	// under its scan directories that aren't cleanly fleet-managed.
+	PKIScan *PKIScanState `json:"pki_scan,omitempty"`
+
+	// PKIBundle records the trust bundle most recently deployed to this
+	// host by 'pki deploy' (see pki.Deployer.DeployBundle and
+	// Manager.UpdatePKIBundleState), for 'pki status --bundle' to compare
+	// against the hash of the current local build.
+	PKIBundle *PKIBundleState `json:"pki_bundle,omitempty"`
+
+	// Provenance summarizes the signed build provenance record for the
+	// currently-deployed closure. The full signed record lives in the
+	// fleet's provenance/ directory keyed by store path; this is a copy of
+	// its key facts for quick inspection via 'nixfleet status'. See
+	// Manager.UpdateProvenance.
+	Provenance *ProvenanceState `json:"provenance,omitempty"`
+
+	// Annotations are short free-form operator notes attached to the host
+	// (e.g. "RAM flaky, replace Q3"), keyed by annotation key.
+	Annotations map[string]Annotation `json:"annotations,omitempty"`
+
 	// Metadata
 	NixFleetVersion string    `json:"nixfleet_version"`
 	StateVersion    int       `json:"state_version"`
 	UpdatedAt       time.Time `json:"updated_at"`
 }
 
+// Annotation is a single key/value note attached to a host, with optional
+// expiry. Well-known keys influence behavior elsewhere in nixfleet:
+//   - "no-reboot":         the reboot orchestrator skips the host
+//   - "sticky-generation": auto-apply skips the host
+type Annotation struct {
+	Value     string    `json:"value"`
+	SetAt     time.Time `json:"set_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+
+	// History keeps the last few prior values of this annotation, most
+	// recent first.
+	History []AnnotationHistoryEntry `json:"history,omitempty"`
+}
+
+// AnnotationHistoryEntry records a prior value of an annotation
+type AnnotationHistoryEntry struct {
+	Value string    `json:"value"`
+	SetAt time.Time `json:"set_at"`
+}
+
+// maxAnnotationHistory bounds how many prior values are retained per key
+const maxAnnotationHistory = 5
+
+// Expired reports whether the annotation's TTL has elapsed
+func (a Annotation) Expired(now time.Time) bool {
+	return !a.ExpiresAt.IsZero() && now.After(a.ExpiresAt)
+}
+
+// SetAnnotation sets (or overwrites) an annotation on the host state,
+// pushing the previous value onto its history.
+func (s *HostState) SetAnnotation(key, value string, ttl time.Duration) {
+	if s.Annotations == nil {
+		s.Annotations = make(map[string]Annotation)
+	}
+
+	now := time.Now()
+	ann := Annotation{Value: value, SetAt: now}
+	if ttl != 0 {
+		ann.ExpiresAt = now.Add(ttl)
+	}
+
+	if prev, ok := s.Annotations[key]; ok {
+		ann.History = append([]AnnotationHistoryEntry{{Value: prev.Value, SetAt: prev.SetAt}}, prev.History...)
+		if len(ann.History) > maxAnnotationHistory {
+			ann.History = ann.History[:maxAnnotationHistory]
+		}
+	}
+
+	s.Annotations[key] = ann
+}
+
+// UnsetAnnotation removes an annotation from the host state
+func (s *HostState) UnsetAnnotation(key string) {
+	delete(s.Annotations, key)
+}
+
+// PruneExpiredAnnotations removes annotations whose TTL has elapsed.
+// It returns true if any annotations were removed.
+func (s *HostState) PruneExpiredAnnotations() bool {
+	now := time.Now()
+	pruned := false
+	for key, ann := range s.Annotations {
+		if ann.Expired(now) {
+			delete(s.Annotations, key)
+			pruned = true
+		}
+	}
+	return pruned
+}
+
+// GetAnnotation returns the value of an annotation and whether it is set
+// and not expired.
+func (s *HostState) GetAnnotation(key string) (string, bool) {
+	ann, ok := s.Annotations[key]
+	if !ok || ann.Expired(time.Now()) {
+		return "", false
+	}
+	return ann.Value, true
+}
+
+// Well-known annotation keys that influence nixfleet behavior
+const (
+	AnnotationNoReboot         = "no-reboot"
+	AnnotationStickyGeneration = "sticky-generation"
+)
+
 // K0sState tracks deployed k0s resources for reconciliation
 // This enables automatic cleanup of orphaned resources when config changes
 type K0sState struct {
@@ -98,6 +289,36 @@ type K0sState struct {
 
 	// LastReconcile is when resources were last reconciled
 	LastReconcile time.Time `json:"last_reconcile,omitempty"`
+
+	// LoadedImageBundle is the SHA-256 of the airgapped image bundle
+	// (see 'nixfleet k0s images bundle') currently loaded into this node's
+	// containerd, if any. Compared against the bundle a deploy expects to
+	// surface "this node hasn't picked up the new addon images yet".
+	LoadedImageBundle string `json:"loaded_image_bundle,omitempty"`
+}
+
+// K0sUpgradeState is one host's record of a fleet-wide k0s binary upgrade.
+// 'nixfleet k0s upgrade' checks this before touching a host so a resumed
+// upgrade skips nodes that already completed against the same target
+// version, and re-attempts anything left Done: false.
+type K0sUpgradeState struct {
+	// TargetVersion is the version this record applies to. A record for a
+	// different version is treated as stale and the host is upgraded again.
+	TargetVersion string `json:"target_version"`
+
+	// FromVersion is the k0s version this host was running before the
+	// upgrade started, kept for audit purposes.
+	FromVersion string `json:"from_version,omitempty"`
+
+	// Role is "controller" or "worker", the role this host was upgraded as.
+	Role string `json:"role"`
+
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+	Done        bool      `json:"done"`
+
+	// Error holds the failure message from the last attempt, if any.
+	Error string `json:"error,omitempty"`
 }
 
 // K0sHelmChartState tracks a Helm chart deployed via k0s
@@ -162,15 +383,112 @@ type FileState struct {
 	RestartUnits []string `json:"restart_units,omitempty"`
 }
 
+// ManagedDir is a directory whose membership (not just the contents of
+// files nixfleet already knows about) is under fleet control. Allow names
+// the entries - file or symlink names, not full paths - expected to exist
+// directly inside Path; anything else CheckManagedDirs finds there is
+// reported as DriftStatusUnexpectedFile.
+type ManagedDir struct {
+	Path  string   `json:"path"`
+	Allow []string `json:"allow"`
+}
+
+// Approval records that a file's on-host drift was deliberately accepted as
+// the new expected state, rather than reverted, and by whom.
+type Approval struct {
+	By string    `json:"by"`
+	At time.Time `json:"at"`
+}
+
+// DeployedSecret records a secret file nixfleet wrote to a host.
+type DeployedSecret struct {
+	Name       string    `json:"name"`
+	Hash       string    `json:"hash"`
+	DeployedAt time.Time `json:"deployed_at"`
+}
+
+// GenerationOutcome describes what happened to a generation nixfleet
+// created, so a later cleanup pass knows which ones are safe to remove.
+type GenerationOutcome string
+
+const (
+	// GenerationActive is the generation currently activated on the host.
+	GenerationActive GenerationOutcome = "active"
+	// GenerationSuperseded is a generation that activated successfully but
+	// has since been replaced by a newer one.
+	GenerationSuperseded GenerationOutcome = "superseded"
+	// GenerationFailed is a generation whose activation script exited
+	// nonzero; it was created (and copied) but never became current.
+	GenerationFailed GenerationOutcome = "failed"
+	// GenerationRolledBack is a generation that activated but was rolled
+	// back away from, e.g. after a failed health check.
+	GenerationRolledBack GenerationOutcome = "rolled-back"
+)
+
+// GenerationRecord is one entry in HostState.Generations: a generation
+// nixfleet created on this host, its profile/store paths, and how it
+// turned out.
+type GenerationRecord struct {
+	Generation  int               `json:"generation"`
+	ProfilePath string            `json:"profile_path"`
+	StorePath   string            `json:"store_path"`
+	Outcome     GenerationOutcome `json:"outcome"`
+	CreatedAt   time.Time         `json:"created_at"`
+	Note        string            `json:"note,omitempty"`
+}
+
+// ProfileState is HostState.Profiles' entry for one deployed profile
+// target: its most recent generation plus the history 'status -v' and
+// profile rollback draw on. Unlike the system closure, a profile target has
+// no single HostState field of its own - everything about it lives here.
+type ProfileState struct {
+	CurrentGeneration int                `json:"current_generation"`
+	StorePath         string             `json:"store_path"`
+	LastApply         time.Time          `json:"last_apply"`
+	Generations       []GenerationRecord `json:"generations,omitempty"`
+}
+
+// StagedClosure is a closure sitting on a host, pinned by a temporary GC
+// root, that hasn't been activated yet.
+type StagedClosure struct {
+	StorePath    string    `json:"store_path"`
+	ManifestHash string    `json:"manifest_hash"`
+	GCRootPath   string    `json:"gc_root_path"`
+	StagedAt     time.Time `json:"staged_at"`
+}
+
+// PreviousBaseState archives the base-specific fields of a host's state from
+// just before 'nixfleet host migrate' reset them for the new base, so a
+// migration gone wrong still has the old managed-files/update-tracking
+// state to compare against.
+type PreviousBaseState struct {
+	Base            string               `json:"base"`
+	ManagedFiles    map[string]FileState `json:"managed_files,omitempty"`
+	PendingUpdates  int                  `json:"pending_updates"`
+	SecurityUpdates int                  `json:"security_updates"`
+	OSInfo          *OSInfo              `json:"os_info,omitempty"`
+	ArchivedAt      time.Time            `json:"archived_at"`
+}
+
+// MigrationRecord is one entry in HostState.MigrationHistory: a base change
+// 'nixfleet host migrate' performed on this host.
+type MigrationRecord struct {
+	FromBase   string    `json:"from_base"`
+	ToBase     string    `json:"to_base"`
+	Method     string    `json:"method"`
+	MigratedAt time.Time `json:"migrated_at"`
+}
+
 // NewHostState creates a new empty host state
 func NewHostState(hostname, base string) *HostState {
 	return &HostState{
-		Hostname:      hostname,
-		Base:          base,
-		ServiceHealth: make(map[string]ServiceStatus),
-		ManagedFiles:  make(map[string]FileState),
-		StateVersion:  1,
-		UpdatedAt:     time.Now(),
+		Hostname:        hostname,
+		Base:            base,
+		ServiceHealth:   make(map[string]ServiceStatus),
+		ManagedFiles:    make(map[string]FileState),
+		DeployedSecrets: make(map[string]DeployedSecret),
+		StateVersion:    1,
+		UpdatedAt:       time.Now(),
 	}
 }
 
@@ -206,6 +524,7 @@ func (m *Manager) ReadState(ctx context.Context, client *ssh.Client) (*HostState
 // WriteState writes state to a host
 func (m *Manager) WriteState(ctx context.Context, client *ssh.Client, state *HostState) error {
 	state.UpdatedAt = time.Now()
+	state.PruneExpiredAnnotations()
 
 	data, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
@@ -249,6 +568,271 @@ func (m *Manager) UpdateAfterApply(ctx context.Context, client *ssh.Client, stor
 	return m.WriteState(ctx, client, state)
 }
 
+// UpdateStaged records a closure copied to the host ahead of activation by
+// 'apply --stage-only'. It leaves the host's active deployment fields
+// (StorePath, ManifestHash, CurrentGeneration, ...) untouched - those still
+// describe what's actually running until a later apply activates the
+// staged closure.
+func (m *Manager) UpdateStaged(ctx context.Context, client *ssh.Client, staged StagedClosure) error {
+	state, err := m.ReadState(ctx, client)
+	if err != nil {
+		state = NewHostState("", "")
+	}
+
+	state.StagedClosure = &staged
+
+	return m.WriteState(ctx, client, state)
+}
+
+// ClearStaged removes a host's staged closure record, once it's been
+// activated by a plain apply or released by 'apply --unstage'.
+func (m *Manager) ClearStaged(ctx context.Context, client *ssh.Client) error {
+	state, err := m.ReadState(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	state.StagedClosure = nil
+
+	return m.WriteState(ctx, client, state)
+}
+
+// RecordGeneration appends a GenerationRecord for a generation nixfleet
+// just created, marking any previously-active generation as superseded.
+// Call this once activation is known to have succeeded (outcome
+// GenerationActive); a failed activation should record GenerationFailed
+// instead so 'nixfleet host cleanup-generations' can find it.
+func (m *Manager) RecordGeneration(ctx context.Context, client *ssh.Client, rec GenerationRecord) error {
+	state, err := m.ReadState(ctx, client)
+	if err != nil {
+		state = NewHostState("", "")
+	}
+
+	if rec.Outcome == GenerationActive {
+		for i := range state.Generations {
+			if state.Generations[i].Outcome == GenerationActive {
+				state.Generations[i].Outcome = GenerationSuperseded
+			}
+		}
+	}
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now()
+	}
+	state.Generations = append(state.Generations, rec)
+
+	return m.WriteState(ctx, client, state)
+}
+
+// RecordProfileGeneration appends a GenerationRecord to the named profile
+// target's own history (creating its ProfileState entry on first use) and
+// updates its CurrentGeneration/StorePath/LastApply, the same way
+// RecordGeneration does for the system closure. A failed activation should
+// still call this with outcome GenerationFailed rather than being skipped,
+// so the profile's history stays complete; CurrentGeneration/StorePath are
+// only advanced for GenerationActive.
+func (m *Manager) RecordProfileGeneration(ctx context.Context, client *ssh.Client, target string, rec GenerationRecord) error {
+	state, err := m.ReadState(ctx, client)
+	if err != nil {
+		state = NewHostState("", "")
+	}
+	if state.Profiles == nil {
+		state.Profiles = make(map[string]*ProfileState)
+	}
+
+	ps, ok := state.Profiles[target]
+	if !ok {
+		ps = &ProfileState{}
+		state.Profiles[target] = ps
+	}
+
+	if rec.Outcome == GenerationActive {
+		for i := range ps.Generations {
+			if ps.Generations[i].Outcome == GenerationActive {
+				ps.Generations[i].Outcome = GenerationSuperseded
+			}
+		}
+		ps.CurrentGeneration = rec.Generation
+		ps.StorePath = rec.StorePath
+		ps.LastApply = time.Now()
+	}
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now()
+	}
+	ps.Generations = append(ps.Generations, rec)
+
+	return m.WriteState(ctx, client, state)
+}
+
+// GenerationsForCleanup splits the host's recorded failed/rolled-back
+// generations into the most recent `keep` (kept for post-mortem debugging)
+// and the rest (candidates for 'nixfleet host cleanup-generations' to
+// remove). Superseded and active generations are left out of both lists -
+// this command only reclaims space from deploys that never became (or
+// stopped being) the running configuration.
+func (m *Manager) GenerationsForCleanup(ctx context.Context, client *ssh.Client, keep int) (toKeep, toRemove []GenerationRecord, err error) {
+	hostState, err := m.ReadState(ctx, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var obsolete []GenerationRecord
+	for _, rec := range hostState.Generations {
+		if rec.Outcome == GenerationFailed || rec.Outcome == GenerationRolledBack {
+			obsolete = append(obsolete, rec)
+		}
+	}
+	sort.Slice(obsolete, func(i, j int) bool { return obsolete[i].CreatedAt.After(obsolete[j].CreatedAt) })
+
+	if keep >= len(obsolete) {
+		return obsolete, nil, nil
+	}
+	return obsolete[:keep], obsolete[keep:], nil
+}
+
+// RemoveGenerationRecords deletes the given records from state.Generations,
+// once the caller has actually removed the underlying profile generation
+// and GC root on the host. Matches on (Generation, StorePath) since a
+// pre-activation failure's Generation is always 0.
+func (m *Manager) RemoveGenerationRecords(ctx context.Context, client *ssh.Client, removed []GenerationRecord) error {
+	if len(removed) == 0 {
+		return nil
+	}
+
+	hostState, err := m.ReadState(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	drop := make(map[[2]string]bool, len(removed))
+	for _, rec := range removed {
+		drop[[2]string{fmt.Sprintf("%d", rec.Generation), rec.StorePath}] = true
+	}
+
+	kept := hostState.Generations[:0]
+	for _, rec := range hostState.Generations {
+		if drop[[2]string{fmt.Sprintf("%d", rec.Generation), rec.StorePath}] {
+			continue
+		}
+		kept = append(kept, rec)
+	}
+	hostState.Generations = kept
+
+	return m.WriteState(ctx, client, hostState)
+}
+
+// DetectBase probes the live host's OS via /etc/os-release's ID field, or
+// uname -s on a host with none (e.g. macOS), and maps it to the same
+// "ubuntu", "nixos", "darwin" strings inventory.Host.Base uses. Used by
+// CheckBaseMatch and 'nixfleet host migrate' to catch inventory that's
+// drifted from what a host is actually running.
+func (m *Manager) DetectBase(ctx context.Context, client *ssh.Client) (string, error) {
+	result, err := client.Exec(ctx, `if [ -f /etc/os-release ]; then grep -E '^ID=' /etc/os-release | head -1 | cut -d= -f2 | tr -d '"'; else uname -s; fi`)
+	if err != nil {
+		return "", fmt.Errorf("detecting host base: %w", err)
+	}
+	return strings.ToLower(strings.TrimSpace(result.Stdout)), nil
+}
+
+// CheckBaseMatch detects the host's live base via DetectBase and compares it
+// against want (typically the inventory's recorded host.Base), returning a
+// descriptive error on mismatch. apply, status, and drift check all call
+// this before trusting host.Base for OS-specific behavior, since running
+// the wrong activation or rollback path against a freshly migrated host can
+// genuinely damage it - see 'nixfleet host migrate'.
+func (m *Manager) CheckBaseMatch(ctx context.Context, client *ssh.Client, want string) error {
+	got, err := m.DetectBase(ctx, client)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("base mismatch: inventory says %s, host is %s — run host migrate", want, got)
+	}
+	return nil
+}
+
+// MigrateBase archives hostState's base-specific fields under PreviousBase,
+// appends a MigrationRecord, and resets those fields for toBase. Called by
+// 'nixfleet host migrate' once it has confirmed (via DetectBase) that the
+// host is actually running toBase; method is recorded for audit purposes
+// (e.g. "manual", "nixos-anywhere") but doesn't change any behavior here.
+func (m *Manager) MigrateBase(ctx context.Context, client *ssh.Client, toBase, method string) (*MigrationRecord, error) {
+	state, err := m.ReadState(ctx, client)
+	if err != nil {
+		state = NewHostState("", "")
+	}
+
+	now := time.Now()
+	state.PreviousBase = &PreviousBaseState{
+		Base:            state.Base,
+		ManagedFiles:    state.ManagedFiles,
+		PendingUpdates:  state.PendingUpdates,
+		SecurityUpdates: state.SecurityUpdates,
+		OSInfo:          state.OSInfo,
+		ArchivedAt:      now,
+	}
+
+	rec := MigrationRecord{FromBase: state.Base, ToBase: toBase, Method: method, MigratedAt: now}
+	state.MigrationHistory = append(state.MigrationHistory, rec)
+
+	state.Base = toBase
+	state.ManagedFiles = make(map[string]FileState)
+	state.PendingUpdates = 0
+	state.SecurityUpdates = 0
+	state.LastUpdateCheck = time.Time{}
+	state.OSInfo = nil
+	state.DriftDetected = false
+	state.DriftFiles = nil
+	state.CurrentGeneration = 0
+	state.StorePath = ""
+	state.ManifestHash = ""
+
+	if err := m.WriteState(ctx, client, state); err != nil {
+		return nil, fmt.Errorf("writing state: %w", err)
+	}
+	return &rec, nil
+}
+
+// MarkGenerationOutcome updates the recorded outcome of a generation
+// already in state.Generations, e.g. from active to rolled-back after a
+// health-check-triggered rollback. It's a no-op if the generation was
+// never recorded.
+func (m *Manager) MarkGenerationOutcome(ctx context.Context, client *ssh.Client, generation int, outcome GenerationOutcome) error {
+	state, err := m.ReadState(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i := range state.Generations {
+		if state.Generations[i].Generation == generation {
+			state.Generations[i].Outcome = outcome
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	return m.WriteState(ctx, client, state)
+}
+
+// UpdateManagedFile records fs as a managed file so CheckDrift picks it up,
+// for a file written outside the normal declared-files apply path (e.g. a
+// CLI command that renders a config snippet directly onto the host).
+func (m *Manager) UpdateManagedFile(ctx context.Context, client *ssh.Client, fs FileState) error {
+	state, err := m.ReadState(ctx, client)
+	if err != nil {
+		state = NewHostState("", "")
+	}
+	if state.ManagedFiles == nil {
+		state.ManagedFiles = make(map[string]FileState)
+	}
+
+	state.ManagedFiles[fs.Path] = fs
+
+	return m.WriteState(ctx, client, state)
+}
+
 // UpdateRebootStatus updates the reboot status in state
 func (m *Manager) UpdateRebootStatus(ctx context.Context, client *ssh.Client, required bool, packages []string) error {
 	state, err := m.ReadState(ctx, client)
@@ -262,6 +846,50 @@ func (m *Manager) UpdateRebootStatus(ctx context.Context, client *ssh.Client, re
 	return m.WriteState(ctx, client, state)
 }
 
+// UpdateServicesNeedingRestart records which services are running against
+// since-replaced libraries or binaries after an update. Pass nil/empty once
+// they've all been restarted (or the host has rebooted) to clear it.
+func (m *Manager) UpdateServicesNeedingRestart(ctx context.Context, client *ssh.Client, services []string) error {
+	state, err := m.ReadState(ctx, client)
+	if err != nil {
+		state = NewHostState("", "")
+	}
+
+	state.ServicesNeedingRestart = services
+
+	return m.WriteState(ctx, client, state)
+}
+
+// RecordConffileDrift merges conffile paths that an upgrade kept in their
+// locally-modified form (instead of the version the package shipped) into
+// DriftFiles, so a later drift check surfaces them rather than leaving them
+// silently out of sync with what Nix expects. Paths already present are
+// left alone.
+func (m *Manager) RecordConffileDrift(ctx context.Context, client *ssh.Client, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	state, err := m.ReadState(ctx, client)
+	if err != nil {
+		state = NewHostState("", "")
+	}
+
+	existing := make(map[string]bool, len(state.DriftFiles))
+	for _, p := range state.DriftFiles {
+		existing[p] = true
+	}
+	for _, p := range paths {
+		if !existing[p] {
+			state.DriftFiles = append(state.DriftFiles, p)
+			existing[p] = true
+		}
+	}
+	state.DriftDetected = len(state.DriftFiles) > 0
+
+	return m.WriteState(ctx, client, state)
+}
+
 // UpdateServiceHealth updates service health status
 func (m *Manager) UpdateServiceHealth(ctx context.Context, client *ssh.Client, services map[string]ServiceStatus) error {
 	state, err := m.ReadState(ctx, client)
@@ -274,20 +902,65 @@ func (m *Manager) UpdateServiceHealth(ctx context.Context, client *ssh.Client, s
 	return m.WriteState(ctx, client, state)
 }
 
-// CheckDrift compares managed files against their expected state
-func (m *Manager) CheckDrift(ctx context.Context, client *ssh.Client, expectedFiles map[string]FileState) ([]DriftResult, error) {
-	var results []DriftResult
+// RecordRebootValidation stores the post-reboot validation suite's outcome
+// on the host, so 'nixfleet reboot status' can show a host as rebooted
+// with issues even after the checks that failed have stopped running.
+func (m *Manager) RecordRebootValidation(ctx context.Context, client *ssh.Client, report *probe.Results) error {
+	state, err := m.ReadState(ctx, client)
+	if err != nil {
+		state = NewHostState("", "")
+	}
 
-	for path, expected := range expectedFiles {
-		result := DriftResult{
-			Path:     path,
-			Expected: expected,
-		}
+	state.LastRebootValidation = report
 
-		// Get current file hash
-		hashCmd := fmt.Sprintf("sha256sum %s 2>/dev/null | cut -d' ' -f1", path)
-		hashResult, err := client.Exec(ctx, hashCmd)
-		if err != nil || hashResult.ExitCode != 0 {
+	return m.WriteState(ctx, client, state)
+}
+
+// execBatcher is the subset of *ssh.Client that CheckDrift needs, kept as
+// an interface so it can run against ssh.MockClient in tests instead of a
+// real connection.
+type execBatcher interface {
+	ExecBatch(ctx context.Context, cmds []ssh.Command) ([]*ssh.ExecResult, error)
+}
+
+// CheckDrift compares managed files against their expected state. It reads
+// every file's hash and permissions in a single ExecBatch call rather than
+// two client.Exec round trips per file, since a fleet-wide drift check can
+// otherwise dominate latency on high-RTT links.
+func (m *Manager) CheckDrift(ctx context.Context, client execBatcher, expectedFiles map[string]FileState) ([]DriftResult, error) {
+	if len(expectedFiles) == 0 {
+		return nil, nil
+	}
+
+	paths := make([]string, 0, len(expectedFiles))
+	for path := range expectedFiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	cmds := make([]ssh.Command, 0, len(paths)*2)
+	for _, path := range paths {
+		cmds = append(cmds, ssh.Command{Cmd: fmt.Sprintf("sha256sum %s 2>/dev/null | cut -d' ' -f1", path)})
+		cmds = append(cmds, ssh.Command{Cmd: fmt.Sprintf("stat -c '%%a %%U %%G' %s 2>/dev/null", path)})
+	}
+
+	batchResults, err := client.ExecBatch(ctx, cmds)
+	if err != nil {
+		return nil, fmt.Errorf("batch drift check: %w", err)
+	}
+
+	results := make([]DriftResult, 0, len(paths))
+	for i, path := range paths {
+		expected := expectedFiles[path]
+		result := DriftResult{Path: path, Expected: expected}
+
+		// Each file owns exactly two consecutive slots in batchResults (hash,
+		// then stat), so a failure always attributes back to its own file
+		// regardless of what happened to any other command in the batch.
+		hashResult := batchResults[i*2]
+		statResult := batchResults[i*2+1]
+
+		if hashResult.ExitCode != 0 {
 			result.Status = DriftStatusMissing
 			results = append(results, result)
 			continue
@@ -296,10 +969,7 @@ func (m *Manager) CheckDrift(ctx context.Context, client *ssh.Client, expectedFi
 		currentHash := strings.TrimSpace(hashResult.Stdout)
 		result.Actual.Hash = currentHash
 
-		// Get current permissions
-		statCmd := fmt.Sprintf("stat -c '%%a %%U %%G' %s 2>/dev/null", path)
-		statResult, err := client.Exec(ctx, statCmd)
-		if err == nil && statResult.ExitCode == 0 {
+		if statResult.ExitCode == 0 {
 			parts := strings.Fields(statResult.Stdout)
 			if len(parts) >= 3 {
 				result.Actual.Mode = parts[0]
@@ -308,23 +978,91 @@ func (m *Manager) CheckDrift(ctx context.Context, client *ssh.Client, expectedFi
 			}
 		}
 
-		// Compare
-		if currentHash != expected.Hash {
-			result.Status = DriftStatusContentChanged
-		} else if result.Actual.Mode != expected.Mode ||
-			result.Actual.Owner != expected.Owner ||
-			result.Actual.Group != expected.Group {
-			result.Status = DriftStatusPermissionsChanged
-		} else {
-			result.Status = DriftStatusOK
+		result.Status = evaluateDriftStatus(expected, result.Actual)
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// CheckManagedDirs lists the immediate contents of each of dirs and reports
+// any entry not named in its Allow list as DriftStatusUnexpectedFile. Like
+// CheckDrift, every directory's listing goes out in a single ExecBatch call.
+// A symlink resolving into /nix/store is never flagged regardless of Allow:
+// that's exactly the shape every nixfleet-managed entry in a profile-linked
+// directory takes, so treating it as unexpected would flag the fleet's own
+// deploys as drift.
+func (m *Manager) CheckManagedDirs(ctx context.Context, client execBatcher, dirs []ManagedDir) ([]DriftResult, error) {
+	if len(dirs) == 0 {
+		return nil, nil
+	}
+
+	cmds := make([]ssh.Command, len(dirs))
+	for i, d := range dirs {
+		cmds[i] = ssh.Command{Cmd: fmt.Sprintf(`find %s -mindepth 1 -maxdepth 1 -printf '%%f\t%%y\t%%l\n' 2>/dev/null`, d.Path)}
+	}
+
+	batchResults, err := client.ExecBatch(ctx, cmds)
+	if err != nil {
+		return nil, fmt.Errorf("batch managed-dir check: %w", err)
+	}
+
+	var results []DriftResult
+	for i, d := range dirs {
+		if batchResults[i].ExitCode != 0 {
+			// Directory doesn't exist or isn't readable - nothing to flag,
+			// and CheckDrift's own ManagedFiles entries (if any exist under
+			// it) already surface that as DriftStatusMissing.
+			continue
 		}
 
-		results = append(results, result)
+		allowed := make(map[string]bool, len(d.Allow))
+		for _, name := range d.Allow {
+			allowed[name] = true
+		}
+
+		for _, line := range strings.Split(strings.TrimRight(batchResults[i].Stdout, "\n"), "\n") {
+			if line == "" {
+				continue
+			}
+			fields := strings.SplitN(line, "\t", 3)
+			if len(fields) < 2 || allowed[fields[0]] {
+				continue
+			}
+			if fields[1] == "l" && len(fields) == 3 && isNixStoreLink(fields[2]) {
+				continue
+			}
+			results = append(results, DriftResult{
+				Path:   strings.TrimRight(d.Path, "/") + "/" + fields[0],
+				Status: DriftStatusUnexpectedFile,
+			})
+		}
 	}
 
 	return results, nil
 }
 
+// isNixStoreLink reports whether target - a symlink's resolved target, as
+// printed by find's %l - points into /nix/store.
+func isNixStoreLink(target string) bool {
+	return strings.Contains(target, "/nix/store/")
+}
+
+// evaluateDriftStatus is the comparison CheckDrift and CheckDriftLocal both
+// apply once they have an expected and an actual FileState in hand,
+// regardless of whether actual came from a remote sha256sum/stat pair or a
+// local os.ReadFile/os.Stat - the file "missing" case is handled by the
+// caller, which never gets as far as building an actual FileState to compare.
+func evaluateDriftStatus(expected, actual FileState) DriftStatus {
+	if actual.Hash != expected.Hash {
+		return DriftStatusContentChanged
+	}
+	if actual.Mode != expected.Mode || actual.Owner != expected.Owner || actual.Group != expected.Group {
+		return DriftStatusPermissionsChanged
+	}
+	return DriftStatusOK
+}
+
 // DriftStatus represents the drift status of a file
 type DriftStatus string
 
@@ -333,6 +1071,11 @@ const (
 	DriftStatusMissing            DriftStatus = "missing"
 	DriftStatusContentChanged     DriftStatus = "content_changed"
 	DriftStatusPermissionsChanged DriftStatus = "permissions_changed"
+
+	// DriftStatusUnexpectedFile marks an entry CheckManagedDirs found inside
+	// a ManagedDir that isn't on its Allow list - something dropped there
+	// outside of nixfleet, rather than drift on a file nixfleet manages.
+	DriftStatusUnexpectedFile DriftStatus = "unexpected_file"
 )
 
 // DriftResult represents the result of a drift check for a single file
@@ -375,15 +1118,150 @@ func (m *Manager) FixDrift(ctx context.Context, client *ssh.Client, drift DriftR
 	return nil
 }
 
-// GatherOSInfo collects operating system information from a remote host
-func (m *Manager) GatherOSInfo(ctx context.Context, client *ssh.Client) (*OSInfo, error) {
+// RestoreFromStore restores fs's content directly from the active closure
+// at storePath, without the 30-minute round trip of a full re-apply: a
+// managed file's destination path mirrors its location under the closure
+// root (e.g. "/etc/nginx/nginx.conf" lives at "<storePath>/etc/nginx/nginx.conf"),
+// the same layout NixOS's own /etc activation uses. It copies the file back,
+// then chmods/chowns it per fs. If storePath's copy is no longer present -
+// most commonly because the generation was garbage-collected - it returns
+// gone=true and no error, so the caller can fall back to recommending a
+// re-apply instead of treating a GC'd generation as a hard failure.
+func (m *Manager) RestoreFromStore(ctx context.Context, client *ssh.Client, storePath string, fs FileState) (gone bool, err error) {
+	if storePath == "" {
+		return true, nil
+	}
+	source := strings.TrimRight(storePath, "/") + fs.Path
+
+	check, err := client.Exec(ctx, fmt.Sprintf("test -e %s", source))
+	if err != nil {
+		return false, fmt.Errorf("checking store path %s: %w", source, err)
+	}
+	if check.ExitCode != 0 {
+		return true, nil
+	}
+
+	if _, err := client.ExecSudo(ctx, fmt.Sprintf("cp %s %s", source, fs.Path)); err != nil {
+		return false, fmt.Errorf("copying %s from store: %w", fs.Path, err)
+	}
+	if fs.Mode != "" {
+		if _, err := client.ExecSudo(ctx, fmt.Sprintf("chmod %s %s", fs.Mode, fs.Path)); err != nil {
+			return false, fmt.Errorf("fixing mode: %w", err)
+		}
+	}
+	if fs.Owner != "" && fs.Group != "" {
+		if _, err := client.ExecSudo(ctx, fmt.Sprintf("chown %s:%s %s", fs.Owner, fs.Group, fs.Path)); err != nil {
+			return false, fmt.Errorf("fixing ownership: %w", err)
+		}
+	}
+
+	return false, nil
+}
+
+// RemoveUnexpectedFile deletes path, a file CheckManagedDirs flagged with
+// DriftStatusUnexpectedFile. Unlike FixDrift there's no expected content to
+// restore it to - the correct remediation for a file nixfleet never declared
+// is removing it, not reverting it.
+func (m *Manager) RemoveUnexpectedFile(ctx context.Context, client *ssh.Client, path string) error {
+	if _, err := client.ExecSudo(ctx, fmt.Sprintf("rm -f %s", path)); err != nil {
+		return fmt.Errorf("removing %s: %w", path, err)
+	}
+	return nil
+}
+
+// AcceptDrift re-hashes the current on-host content/permissions for paths
+// and records them as the new expected state, rather than reverting them.
+// It updates the corresponding ManagedFiles entries, records an Approval
+// (who accepted it and when), and clears the paths from DriftFiles. Paths
+// not present in ManagedFiles are skipped since there's nothing to accept
+// drift against.
+func (m *Manager) AcceptDrift(ctx context.Context, client *ssh.Client, paths []string, by string) ([]string, error) {
+	hostState, err := m.ReadState(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("reading state: %w", err)
+	}
+
+	if hostState.Approvals == nil {
+		hostState.Approvals = make(map[string]Approval)
+	}
+
+	var accepted []string
+	now := time.Now()
+	for _, path := range paths {
+		fs, ok := hostState.ManagedFiles[path]
+		if !ok {
+			continue
+		}
+
+		hashCmd := fmt.Sprintf("sha256sum %s 2>/dev/null | cut -d' ' -f1", path)
+		hashResult, err := client.Exec(ctx, hashCmd)
+		if err != nil || hashResult.ExitCode != 0 {
+			return accepted, fmt.Errorf("hashing %s: %w", path, err)
+		}
+		fs.Hash = strings.TrimSpace(hashResult.Stdout)
+
+		statCmd := fmt.Sprintf("stat -c '%%a %%U %%G' %s 2>/dev/null", path)
+		statResult, err := client.Exec(ctx, statCmd)
+		if err == nil && statResult.ExitCode == 0 {
+			parts := strings.Fields(statResult.Stdout)
+			if len(parts) >= 3 {
+				fs.Mode = parts[0]
+				fs.Owner = parts[1]
+				fs.Group = parts[2]
+			}
+		}
+
+		hostState.ManagedFiles[path] = fs
+		hostState.Approvals[path] = Approval{By: by, At: now}
+
+		remaining := hostState.DriftFiles[:0]
+		for _, p := range hostState.DriftFiles {
+			if p != path {
+				remaining = append(remaining, p)
+			}
+		}
+		hostState.DriftFiles = remaining
+
+		accepted = append(accepted, path)
+	}
+
+	hostState.DriftDetected = len(hostState.DriftFiles) > 0
+
+	if err := m.WriteState(ctx, client, hostState); err != nil {
+		return accepted, fmt.Errorf("writing state: %w", err)
+	}
+
+	return accepted, nil
+}
+
+// advantageStatusCmd prints `pro`'s (or the older `ua`'s) JSON status when
+// either client is installed, and nothing otherwise - GatherOSInfo treats
+// empty output the same as "not entitled to ESM/Livepatch", which is the
+// correct read for a host that was never registered with Ubuntu Pro.
+const advantageStatusCmd = `command -v pro >/dev/null 2>&1 && pro status --format json 2>/dev/null || (command -v ubuntu-advantage >/dev/null 2>&1 && ubuntu-advantage status --format json 2>/dev/null) || true`
+
+// GatherOSInfo collects operating system information from a remote host,
+// including its end-of-life standing. eolOverrides is checked ahead of
+// osupdate.DefaultEOLDates - see inventory.Inventory.EOLOverrides.
+func (m *Manager) GatherOSInfo(ctx context.Context, client execBatcher, eolOverrides map[string]time.Time) (*OSInfo, error) {
 	info := &OSInfo{}
 
+	results, err := client.ExecBatch(ctx, []ssh.Command{
+		{Cmd: `cat /etc/os-release 2>/dev/null | grep -E '^(NAME|VERSION|VERSION_ID|PRETTY_NAME|VERSION_CODENAME)=' | sed 's/"//g'`},
+		{Cmd: "uname -r"},
+		{Cmd: "uname -m"},
+		{Cmd: "uptime -p 2>/dev/null || uptime | sed 's/.*up //' | sed 's/,.*load.*//'"},
+		{Cmd: "who -b 2>/dev/null | awk '{print $3, $4}' || uptime -s 2>/dev/null"},
+		{Cmd: advantageStatusCmd},
+	})
+	if err != nil {
+		return info, nil
+	}
+	osReleaseResult, kernelResult, archResult, uptimeResult, bootResult, advantageResult := results[0], results[1], results[2], results[3], results[4], results[5]
+
 	// Parse /etc/os-release for distribution info
-	osReleaseCmd := `cat /etc/os-release 2>/dev/null | grep -E '^(NAME|VERSION|VERSION_ID|PRETTY_NAME|VERSION_CODENAME)=' | sed 's/"//g'`
-	result, err := client.Exec(ctx, osReleaseCmd)
-	if err == nil && result.ExitCode == 0 {
-		for _, line := range strings.Split(result.Stdout, "\n") {
+	if osReleaseResult.ExitCode == 0 {
+		for _, line := range strings.Split(osReleaseResult.Stdout, "\n") {
 			parts := strings.SplitN(line, "=", 2)
 			if len(parts) != 2 {
 				continue
@@ -405,40 +1283,51 @@ func (m *Manager) GatherOSInfo(ctx context.Context, client *ssh.Client) (*OSInfo
 	}
 
 	// Get kernel version
-	kernelResult, err := client.Exec(ctx, "uname -r")
-	if err == nil && kernelResult.ExitCode == 0 {
+	if kernelResult.ExitCode == 0 {
 		info.Kernel = strings.TrimSpace(kernelResult.Stdout)
 	}
 
 	// Get architecture
-	archResult, err := client.Exec(ctx, "uname -m")
-	if err == nil && archResult.ExitCode == 0 {
+	if archResult.ExitCode == 0 {
 		info.Architecture = strings.TrimSpace(archResult.Stdout)
 	}
 
 	// Get uptime in human-readable format
-	uptimeResult, err := client.Exec(ctx, "uptime -p 2>/dev/null || uptime | sed 's/.*up //' | sed 's/,.*load.*//'")
-	if err == nil && uptimeResult.ExitCode == 0 {
+	if uptimeResult.ExitCode == 0 {
 		info.Uptime = strings.TrimSpace(uptimeResult.Stdout)
 	}
 
 	// Get last boot time
-	bootResult, err := client.Exec(ctx, "who -b 2>/dev/null | awk '{print $3, $4}' || uptime -s 2>/dev/null")
-	if err == nil && bootResult.ExitCode == 0 {
+	if bootResult.ExitCode == 0 {
 		info.LastBoot = strings.TrimSpace(bootResult.Stdout)
 	}
 
+	// End-of-life standing, plus live ESM/Livepatch entitlement when ua/pro
+	// is installed.
+	if info.VersionID != "" {
+		info.EOL = osupdate.ComputeEOLStatus(info.VersionID, eolOverrides, time.Now())
+		if info.EOL != nil && advantageResult.ExitCode == 0 {
+			if advantage := strings.TrimSpace(advantageResult.Stdout); advantage != "" {
+				entitlement := osupdate.ParseAdvantageStatus(advantage)
+				info.EOL.ESMEntitled = entitlement.ESMEntitled
+				info.EOL.ESMEnabled = entitlement.ESMEnabled
+				info.EOL.LivepatchEntitled = entitlement.LivepatchEntitled
+				info.EOL.LivepatchEnabled = entitlement.LivepatchEnabled
+			}
+		}
+	}
+
 	return info, nil
 }
 
 // UpdateOSInfo updates the OS information in state
-func (m *Manager) UpdateOSInfo(ctx context.Context, client *ssh.Client) error {
+func (m *Manager) UpdateOSInfo(ctx context.Context, client *ssh.Client, eolOverrides map[string]time.Time) error {
 	state, err := m.ReadState(ctx, client)
 	if err != nil {
 		state = NewHostState("", "")
 	}
 
-	osInfo, err := m.GatherOSInfo(ctx, client)
+	osInfo, err := m.GatherOSInfo(ctx, client, eolOverrides)
 	if err != nil {
 		return fmt.Errorf("gathering OS info: %w", err)
 	}
@@ -447,6 +1336,159 @@ func (m *Manager) UpdateOSInfo(ctx context.Context, client *ssh.Client) error {
 	return m.WriteState(ctx, client, state)
 }
 
+// PKIAgentState reports the on-host certificate renewal agent's status, as
+// gathered by GatherPKIAgentInfo. This is host-reported: it reflects
+// whatever the renewal script last stamped, not what the fleet operator
+// thinks should be running there.
+type PKIAgentState struct {
+	Managed     bool      `json:"managed"`
+	LastRenewal time.Time `json:"last_renewal,omitempty"`
+}
+
+// ProvenanceState summarizes a signed provenance record for the currently
+// deployed closure. See internal/provenance for the full record and its
+// signature.
+type ProvenanceState struct {
+	StorePath string    `json:"store_path"`
+	GitCommit string    `json:"git_commit"`
+	GitDirty  bool      `json:"git_dirty"`
+	Builder   string    `json:"builder"`
+	SignedAt  time.Time `json:"signed_at"`
+}
+
+// UpdateProvenance records the summary of a newly-signed provenance record
+// against the host's state, alongside the deployment it describes.
+func (m *Manager) UpdateProvenance(ctx context.Context, client *ssh.Client, summary ProvenanceState) error {
+	state, err := m.ReadState(ctx, client)
+	if err != nil {
+		state = NewHostState("", "")
+	}
+
+	state.Provenance = &summary
+
+	return m.WriteState(ctx, client, state)
+}
+
+// GatherPKIAgentInfo reads the renewal agent's last-renewal marker file
+// from destDir (see pki.AgentLastRenewalPath) and reports whether the
+// agent has ever run there.
+func (m *Manager) GatherPKIAgentInfo(ctx context.Context, client *ssh.Client, destDir string) (*PKIAgentState, error) {
+	markerPath := destDir + "/agent-last-renewal"
+	result, err := client.Exec(ctx, fmt.Sprintf("cat %s 2>/dev/null", markerPath))
+	if err != nil {
+		return nil, fmt.Errorf("reading agent marker: %w", err)
+	}
+
+	stamp := strings.TrimSpace(result.Stdout)
+	if stamp == "" {
+		return &PKIAgentState{Managed: false}, nil
+	}
+
+	lastRenewal, err := time.Parse(time.RFC3339, stamp)
+	if err != nil {
+		return &PKIAgentState{Managed: true}, nil
+	}
+
+	return &PKIAgentState{Managed: true, LastRenewal: lastRenewal}, nil
+}
+
+// PKIBundleState records the trust bundle hash deployed to a host.
+type PKIBundleState struct {
+	Hash       string    `json:"hash"`
+	DeployedAt time.Time `json:"deployed_at"`
+}
+
+// UpdatePKIBundleState records that a trust bundle with the given manifest
+// hash (see pki.Store.BuildBundle) was just deployed to the host.
+func (m *Manager) UpdatePKIBundleState(ctx context.Context, client *ssh.Client, hash string) error {
+	state, err := m.ReadState(ctx, client)
+	if err != nil {
+		state = NewHostState("", "")
+	}
+
+	state.PKIBundle = &PKIBundleState{Hash: hash, DeployedAt: time.Now()}
+
+	return m.WriteState(ctx, client, state)
+}
+
+// UpdatePKIAgentInfo updates the PKI renewal agent status in state.
+func (m *Manager) UpdatePKIAgentInfo(ctx context.Context, client *ssh.Client, destDir string) error {
+	state, err := m.ReadState(ctx, client)
+	if err != nil {
+		state = NewHostState("", "")
+	}
+
+	agentInfo, err := m.GatherPKIAgentInfo(ctx, client, destDir)
+	if err != nil {
+		return fmt.Errorf("gathering PKI agent info: %w", err)
+	}
+
+	state.PKIAgent = agentInfo
+	return m.WriteState(ctx, client, state)
+}
+
+// PKIScanState summarizes a certificate inventory scan (see
+// pki.Scanner.ScanHost). Fleet-managed, unexpired certs are dropped from
+// Findings - they're already visible in 'pki status' - so this stays a
+// short list of the ones that actually need a look.
+type PKIScanState struct {
+	ScannedAt time.Time        `json:"scanned_at"`
+	Dirs      []string         `json:"dirs"`
+	Total     int              `json:"total"`
+	Findings  []PKIScanFinding `json:"findings,omitempty"`
+	Errors    []string         `json:"errors,omitempty"`
+}
+
+// PKIScanFinding is one scanned certificate that isn't cleanly
+// fleet-managed: foreign, orphaned, or expired.
+type PKIScanFinding struct {
+	Path           string    `json:"path"`
+	Subject        string    `json:"subject"`
+	Classification string    `json:"classification"`
+	Detail         string    `json:"detail,omitempty"`
+	NotAfter       time.Time `json:"not_after"`
+	DaysLeft       int       `json:"days_left"`
+}
+
+// GatherPKIScan reduces an already-run certificate inventory scan into a
+// PKIScanState fit for storage. It takes the scan result rather than a
+// client because ScanHost itself does the (expensive, multi-command) SSH
+// work - unlike GatherPKIAgentInfo's single cat, there's no cheap way to
+// re-derive this from the host on demand.
+func (m *Manager) GatherPKIScan(result *pki.HostScanResult) *PKIScanState {
+	scan := &PKIScanState{
+		ScannedAt: result.ScannedAt,
+		Dirs:      result.Dirs,
+		Total:     len(result.Certs),
+		Errors:    result.Errors,
+	}
+	for _, cert := range result.Certs {
+		if cert.Classification == "fleet-managed" {
+			continue
+		}
+		scan.Findings = append(scan.Findings, PKIScanFinding{
+			Path:           cert.Path,
+			Subject:        cert.Subject,
+			Classification: cert.Classification,
+			Detail:         cert.Detail,
+			NotAfter:       cert.NotAfter,
+			DaysLeft:       cert.DaysLeft,
+		})
+	}
+	return scan
+}
+
+// UpdatePKIScan records result's findings against the host's state.
+func (m *Manager) UpdatePKIScan(ctx context.Context, client *ssh.Client, result *pki.HostScanResult) error {
+	state, err := m.ReadState(ctx, client)
+	if err != nil {
+		state = NewHostState("", "")
+	}
+
+	state.PKIScan = m.GatherPKIScan(result)
+	return m.WriteState(ctx, client, state)
+}
+
 // hashContent returns SHA256 hash of content
 func hashContent(content []byte) string {
 	h := sha256.Sum256(content)
@@ -490,6 +1532,10 @@ func (s *HostState) GetHostSummary() string {
 		sb.WriteString(fmt.Sprintf("Services: %d healthy, %d unhealthy\n", healthy, unhealthy))
 	}
 
+	if len(s.ServicesNeedingRestart) > 0 {
+		sb.WriteString(fmt.Sprintf("Services Needing Restart: %d (%s)\n", len(s.ServicesNeedingRestart), strings.Join(s.ServicesNeedingRestart, ", ")))
+	}
+
 	return sb.String()
 }
 
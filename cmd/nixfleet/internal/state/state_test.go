@@ -1,8 +1,14 @@
 package state
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/nixfleet/nixfleet/internal/ssh"
 )
 
 func TestNewHostState(t *testing.T) {
@@ -302,6 +308,305 @@ func TestPackageDiff(t *testing.T) {
 	}
 }
 
+func TestHostStateAnnotations(t *testing.T) {
+	hs := NewHostState("db-1", "ubuntu")
+
+	hs.SetAnnotation("no-reboot", "telescope run until May 12", 0)
+	if v, ok := hs.GetAnnotation("no-reboot"); !ok || v != "telescope run until May 12" {
+		t.Fatalf("expected annotation to be set, got %q, %v", v, ok)
+	}
+
+	hs.SetAnnotation("no-reboot", "extended", 0)
+	if len(hs.Annotations["no-reboot"].History) != 1 {
+		t.Fatalf("expected 1 history entry, got %d", len(hs.Annotations["no-reboot"].History))
+	}
+
+	hs.UnsetAnnotation("no-reboot")
+	if _, ok := hs.GetAnnotation("no-reboot"); ok {
+		t.Fatal("expected annotation to be removed")
+	}
+}
+
+func TestHostStateAnnotationExpiry(t *testing.T) {
+	hs := NewHostState("db-1", "ubuntu")
+	hs.SetAnnotation("sticky-generation", "pin to gen 5", -time.Minute)
+
+	if _, ok := hs.GetAnnotation("sticky-generation"); ok {
+		t.Fatal("expected already-expired annotation to be unreadable")
+	}
+
+	if !hs.PruneExpiredAnnotations() {
+		t.Fatal("expected PruneExpiredAnnotations to report a removal")
+	}
+	if _, exists := hs.Annotations["sticky-generation"]; exists {
+		t.Fatal("expected expired annotation to be pruned")
+	}
+}
+
+func TestCheckDriftUsesBoundedExecutions(t *testing.T) {
+	client := ssh.NewMockClient()
+	client.DefaultResult = &ssh.ExecResult{ExitCode: 0}
+
+	expected := make(map[string]FileState, 20)
+	for i := 0; i < 20; i++ {
+		path := fmt.Sprintf("/etc/nixfleet/file-%d.conf", i)
+		hash := fmt.Sprintf("hash-%d", i)
+		expected[path] = FileState{Path: path, Hash: hash, Mode: "644", Owner: "root", Group: "root"}
+		client.RegisterCommand(fmt.Sprintf("sha256sum %s 2>/dev/null | cut -d' ' -f1", path), &ssh.ExecResult{Stdout: hash, ExitCode: 0})
+		client.RegisterCommand(fmt.Sprintf("stat -c '%%a %%U %%G' %s 2>/dev/null", path), &ssh.ExecResult{Stdout: "644 root root", ExitCode: 0})
+	}
+
+	m := NewManager()
+	results, err := m.CheckDrift(context.Background(), client, expected)
+	if err != nil {
+		t.Fatalf("CheckDrift failed: %v", err)
+	}
+	if len(results) != 20 {
+		t.Fatalf("expected 20 results, got %d", len(results))
+	}
+	for _, r := range results {
+		if r.HasDrift() {
+			t.Errorf("%s: expected no drift, got status %s", r.Path, r.Status)
+		}
+	}
+
+	if len(client.ExecLog) > 3 {
+		t.Errorf("expected a 20-file drift check to issue <=3 remote executions, got %d: %v", len(client.ExecLog), client.ExecLog)
+	}
+}
+
+func TestCheckDriftAttributesPartialFailure(t *testing.T) {
+	client := ssh.NewMockClient()
+	client.DefaultResult = &ssh.ExecResult{ExitCode: 0}
+
+	expected := map[string]FileState{
+		"/etc/a.conf": {Path: "/etc/a.conf", Hash: "hash-a", Mode: "644", Owner: "root", Group: "root"},
+		"/etc/b.conf": {Path: "/etc/b.conf", Hash: "hash-b", Mode: "644", Owner: "root", Group: "root"},
+		"/etc/c.conf": {Path: "/etc/c.conf", Hash: "hash-c", Mode: "644", Owner: "root", Group: "root"},
+	}
+	for path, fs := range expected {
+		client.RegisterCommand(fmt.Sprintf("stat -c '%%a %%U %%G' %s 2>/dev/null", path), &ssh.ExecResult{Stdout: "644 root root", ExitCode: 0})
+		if path == "/etc/b.conf" {
+			// b's hash command fails; a and c must still report their own status.
+			client.RegisterCommand(fmt.Sprintf("sha256sum %s 2>/dev/null | cut -d' ' -f1", path), &ssh.ExecResult{ExitCode: 1})
+			continue
+		}
+		client.RegisterCommand(fmt.Sprintf("sha256sum %s 2>/dev/null | cut -d' ' -f1", path), &ssh.ExecResult{Stdout: fs.Hash, ExitCode: 0})
+	}
+
+	m := NewManager()
+	results, err := m.CheckDrift(context.Background(), client, expected)
+	if err != nil {
+		t.Fatalf("CheckDrift failed: %v", err)
+	}
+
+	byPath := make(map[string]DriftResult, len(results))
+	for _, r := range results {
+		byPath[r.Path] = r
+	}
+
+	if byPath["/etc/a.conf"].Status != DriftStatusOK {
+		t.Errorf("/etc/a.conf: got %s, want ok", byPath["/etc/a.conf"].Status)
+	}
+	if byPath["/etc/b.conf"].Status != DriftStatusMissing {
+		t.Errorf("/etc/b.conf: got %s, want missing (its own hash command failed)", byPath["/etc/b.conf"].Status)
+	}
+	if byPath["/etc/c.conf"].Status != DriftStatusOK {
+		t.Errorf("/etc/c.conf: got %s, want ok (b's failure must not bleed into it)", byPath["/etc/c.conf"].Status)
+	}
+}
+
+func TestCheckManagedDirsFlagsUnexpectedFile(t *testing.T) {
+	client := ssh.NewMockClient()
+	client.DefaultResult = &ssh.ExecResult{ExitCode: 0}
+	client.RegisterCommand(
+		`find /etc/nginx/conf.d -mindepth 1 -maxdepth 1 -printf '%f\t%y\t%l\n' 2>/dev/null`,
+		&ssh.ExecResult{ExitCode: 0, Stdout: "app.conf\tf\t\nevil.conf\tf\t\n"},
+	)
+
+	dirs := []ManagedDir{{Path: "/etc/nginx/conf.d", Allow: []string{"app.conf"}}}
+
+	m := NewManager()
+	results, err := m.CheckManagedDirs(context.Background(), client, dirs)
+	if err != nil {
+		t.Fatalf("CheckManagedDirs failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected 1 unexpected file, got %d: %v", len(results), results)
+	}
+	if results[0].Path != "/etc/nginx/conf.d/evil.conf" {
+		t.Errorf("path = %q, want /etc/nginx/conf.d/evil.conf", results[0].Path)
+	}
+	if results[0].Status != DriftStatusUnexpectedFile {
+		t.Errorf("status = %q, want unexpected_file", results[0].Status)
+	}
+}
+
+func TestCheckManagedDirsIgnoresNixStoreSymlinks(t *testing.T) {
+	client := ssh.NewMockClient()
+	client.DefaultResult = &ssh.ExecResult{ExitCode: 0}
+	client.RegisterCommand(
+		`find /etc/nixfleet/units -mindepth 1 -maxdepth 1 -printf '%f\t%y\t%l\n' 2>/dev/null`,
+		&ssh.ExecResult{ExitCode: 0, Stdout: "app.service\tl\t/nix/store/abc123-app/app.service\n"},
+	)
+
+	dirs := []ManagedDir{{Path: "/etc/nixfleet/units"}}
+
+	m := NewManager()
+	results, err := m.CheckManagedDirs(context.Background(), client, dirs)
+	if err != nil {
+		t.Fatalf("CheckManagedDirs failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("expected a /nix/store symlink not to be flagged, got %v", results)
+	}
+}
+
 func containsString(s, substr string) bool {
 	return len(s) > 0 && len(substr) > 0 && (s == substr || len(s) > len(substr) && (s[:len(substr)] == substr || containsString(s[1:], substr)))
 }
+
+func TestGatherOSInfoComputesEOL(t *testing.T) {
+	client := ssh.NewMockClient()
+	client.DefaultResult = &ssh.ExecResult{ExitCode: 0}
+	client.RegisterCommandOutput(
+		`cat /etc/os-release 2>/dev/null | grep -E '^(NAME|VERSION|VERSION_ID|PRETTY_NAME|VERSION_CODENAME)=' | sed 's/"//g'`,
+		"NAME=Ubuntu\nVERSION_ID=20.04\nPRETTY_NAME=Ubuntu 20.04.6 LTS\nVERSION_CODENAME=focal", 0)
+	client.RegisterCommandOutput(advantageStatusCmd,
+		`{"services":[{"name":"esm-infra","entitled":"yes","status":"enabled"}]}`, 0)
+
+	m := NewManager()
+	info, err := m.GatherOSInfo(context.Background(), client, nil)
+	if err != nil {
+		t.Fatalf("GatherOSInfo failed: %v", err)
+	}
+
+	if info.VersionID != "20.04" {
+		t.Fatalf("VersionID = %q, want 20.04", info.VersionID)
+	}
+	if info.EOL == nil {
+		t.Fatal("expected EOL to be computed for 20.04")
+	}
+	if !info.EOL.Past {
+		t.Error("20.04 should be reported as past EOL")
+	}
+	if !info.EOL.ESMEntitled || !info.EOL.ESMEnabled {
+		t.Errorf("expected ESM entitled+enabled from advantage status, got %+v", info.EOL)
+	}
+}
+
+func TestGatherOSInfoNonUbuntuHasNoEOL(t *testing.T) {
+	client := ssh.NewMockClient()
+	client.DefaultResult = &ssh.ExecResult{ExitCode: 0}
+	client.RegisterCommandOutput(
+		`cat /etc/os-release 2>/dev/null | grep -E '^(NAME|VERSION|VERSION_ID|PRETTY_NAME|VERSION_CODENAME)=' | sed 's/"//g'`,
+		"NAME=NixOS\nVERSION_ID=24.11", 0)
+
+	m := NewManager()
+	info, err := m.GatherOSInfo(context.Background(), client, nil)
+	if err != nil {
+		t.Fatalf("GatherOSInfo failed: %v", err)
+	}
+	if info.EOL != nil {
+		t.Errorf("expected no EOL entry for an unknown VersionID, got %+v", info.EOL)
+	}
+}
+
+func TestCheckDriftLocalDetectsContentChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "managed.conf")
+	if err := os.WriteFile(path, []byte("changed contents"), 0644); err != nil {
+		t.Fatalf("failed to write managed file: %v", err)
+	}
+
+	expected := map[string]FileState{
+		path: {Path: path, Hash: hashContent([]byte("original contents")), Mode: "644"},
+	}
+
+	results, err := CheckDriftLocal(expected)
+	if err != nil {
+		t.Fatalf("CheckDriftLocal failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	if results[0].Status != DriftStatusContentChanged {
+		t.Errorf("expected content_changed, got %s", results[0].Status)
+	}
+}
+
+func TestCheckDriftLocalNoDrift(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "managed.conf")
+	content := []byte("stable contents")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("failed to write managed file: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat managed file: %v", err)
+	}
+
+	expected := map[string]FileState{
+		path: {Path: path, Hash: hashContent(content), Mode: fmt.Sprintf("%o", info.Mode().Perm())},
+	}
+
+	results, err := CheckDriftLocal(expected)
+	if err != nil {
+		t.Fatalf("CheckDriftLocal failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	// Match the actual owner/group CheckDriftLocal observed, since a real
+	// expected FileState would've been recorded the same way at deploy time.
+	expected[path] = FileState{Path: path, Hash: hashContent(content), Mode: fmt.Sprintf("%o", info.Mode().Perm()), Owner: results[0].Actual.Owner, Group: results[0].Actual.Group}
+
+	results, err = CheckDriftLocal(expected)
+	if err != nil {
+		t.Fatalf("CheckDriftLocal failed: %v", err)
+	}
+	if len(results) != 1 || results[0].HasDrift() {
+		t.Errorf("expected no drift, got %+v", results)
+	}
+}
+
+func TestCheckDriftLocalMissing(t *testing.T) {
+	dir := t.TempDir()
+	missingPath := filepath.Join(dir, "does-not-exist.conf")
+
+	expected := map[string]FileState{
+		missingPath: {Path: missingPath, Hash: "deadbeef", Mode: "644"},
+	}
+
+	results, err := CheckDriftLocal(expected)
+	if err != nil {
+		t.Fatalf("CheckDriftLocal failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != DriftStatusMissing {
+		t.Errorf("expected missing status, got %+v", results)
+	}
+}
+
+func TestReadWriteStateLocal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	original := NewHostState("web1", "ubuntu")
+	original.ManagedFiles["/etc/a.conf"] = FileState{Path: "/etc/a.conf", Hash: "abc123", Mode: "644"}
+
+	if err := WriteStateLocal(path, original); err != nil {
+		t.Fatalf("WriteStateLocal failed: %v", err)
+	}
+
+	loaded, err := ReadStateLocal(path)
+	if err != nil {
+		t.Fatalf("ReadStateLocal failed: %v", err)
+	}
+	if loaded.Hostname != "web1" {
+		t.Errorf("expected hostname 'web1', got '%s'", loaded.Hostname)
+	}
+	if loaded.ManagedFiles["/etc/a.conf"].Hash != "abc123" {
+		t.Errorf("expected managed file hash 'abc123', got '%s'", loaded.ManagedFiles["/etc/a.conf"].Hash)
+	}
+}
@@ -1,37 +1,65 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/nixfleet/nixfleet/internal/agenttui"
+	"github.com/nixfleet/nixfleet/internal/apt"
 	"github.com/nixfleet/nixfleet/internal/cache"
+	"github.com/nixfleet/nixfleet/internal/compare"
+	"github.com/nixfleet/nixfleet/internal/compliance"
+	"github.com/nixfleet/nixfleet/internal/config"
+	"github.com/nixfleet/nixfleet/internal/discover"
+	"github.com/nixfleet/nixfleet/internal/driftreport"
+	"github.com/nixfleet/nixfleet/internal/export"
+	"github.com/nixfleet/nixfleet/internal/impact"
 	"github.com/nixfleet/nixfleet/internal/inventory"
 	"github.com/nixfleet/nixfleet/internal/juicefs"
 	"github.com/nixfleet/nixfleet/internal/k0s"
+	"github.com/nixfleet/nixfleet/internal/liveness"
 	"github.com/nixfleet/nixfleet/internal/nix"
 	"github.com/nixfleet/nixfleet/internal/nodestatus"
 	"github.com/nixfleet/nixfleet/internal/osupdate"
 	"github.com/nixfleet/nixfleet/internal/pki"
+	"github.com/nixfleet/nixfleet/internal/preflight"
+	"github.com/nixfleet/nixfleet/internal/probe"
+	"github.com/nixfleet/nixfleet/internal/provenance"
 	"github.com/nixfleet/nixfleet/internal/pullmode"
 	"github.com/nixfleet/nixfleet/internal/reboot"
+	"github.com/nixfleet/nixfleet/internal/rollout"
+	"github.com/nixfleet/nixfleet/internal/search"
 	"github.com/nixfleet/nixfleet/internal/secrets"
 	"github.com/nixfleet/nixfleet/internal/server"
+	"github.com/nixfleet/nixfleet/internal/smoketest"
 	spirepkg "github.com/nixfleet/nixfleet/internal/spire"
 	"github.com/nixfleet/nixfleet/internal/ssh"
+	"github.com/nixfleet/nixfleet/internal/sshconfig"
 	"github.com/nixfleet/nixfleet/internal/state"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -49,8 +77,241 @@ var (
 	maxParallel   int
 	dryRun        bool
 	verbose       bool
+	offline       bool
+	noEvalCache   bool
+	traceCommands string
+	traceOnly     bool
+	checkDNS      bool
+	jumpOverride  string
 )
 
+// cliDefaults holds the resolved defaults for flags that read from the
+// nixfleet config file, before flags and env vars are applied on top.
+// Precedence overall is: explicit flag > NIXFLEET_* env var > local config
+// (./.nixfleet.yaml) > user config (~/.config/nixfleet/config.yaml) >
+// hardcoded fallback.
+type cliDefaults struct {
+	inventory   string
+	flake       string
+	host        string
+	group       string
+	parallel    int
+	dryRun      bool
+	verbose     bool
+	offline     bool
+	noEvalCache bool
+
+	pkiDir      string
+	identities  []string
+	cacheURL    string
+	serverToken string
+}
+
+var (
+	cliDefaultsOnce   sync.Once
+	cliDefaultsCached cliDefaults
+)
+
+// cachedCLIDefaults memoizes resolveCLIDefaults so the many subcommand
+// constructors that pull a single field (pki-dir, identities, cache-url)
+// don't each re-read the config file from disk.
+func cachedCLIDefaults() cliDefaults {
+	cliDefaultsOnce.Do(func() {
+		cliDefaultsCached = resolveCLIDefaults()
+	})
+	return cliDefaultsCached
+}
+
+func defaultPKIDir() string {
+	return cachedCLIDefaults().pkiDir
+}
+
+func defaultProvenanceDir() string {
+	return "secrets/provenance"
+}
+
+func defaultIdentities() []string {
+	return cachedCLIDefaults().identities
+}
+
+func defaultCacheURL() string {
+	return cachedCLIDefaults().cacheURL
+}
+
+func defaultServerToken() string {
+	return cachedCLIDefaults().serverToken
+}
+
+// resolveCLIDefaults loads the merged config file (if any) and layers the
+// active context's fleet-specific settings on top, producing the defaults
+// flag registration should use. A malformed config file is reported but
+// doesn't block the command - it just falls back to hardcoded defaults.
+func resolveCLIDefaults() cliDefaults {
+	d := cliDefaults{
+		inventory: "inventory/",
+		flake:     ".",
+		parallel:  5,
+		pkiDir:    "secrets/pki",
+	}
+
+	merged, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: nixfleet config: %v\n", err)
+		return d
+	}
+
+	if v := merged.Defaults.Inventory; v != nil {
+		d.inventory = *v
+	}
+	if v := merged.Defaults.Flake; v != nil {
+		d.flake = *v
+	}
+	if v := merged.Defaults.Host; v != nil {
+		d.host = *v
+	}
+	if v := merged.Defaults.Group; v != nil {
+		d.group = *v
+	}
+	if v := merged.Defaults.Parallel; v != nil {
+		d.parallel = *v
+	}
+	if v := merged.Defaults.DryRun; v != nil {
+		d.dryRun = *v
+	}
+	if v := merged.Defaults.Verbose; v != nil {
+		d.verbose = *v
+	}
+	if v := merged.Defaults.Offline; v != nil {
+		d.offline = *v
+	}
+	if v := merged.Defaults.NoEvalCache; v != nil {
+		d.noEvalCache = *v
+	}
+
+	if ctx, ok := merged.ActiveContext(); ok {
+		if ctx.Inventory != "" {
+			d.inventory = ctx.Inventory
+		}
+		if ctx.Flake != "" {
+			d.flake = ctx.Flake
+		}
+		if ctx.PKIDir != "" {
+			d.pkiDir = ctx.PKIDir
+		}
+		if len(ctx.Identities) > 0 {
+			d.identities = ctx.Identities
+		}
+		d.serverToken = ctx.ServerToken
+	}
+
+	return d
+}
+
+// envOverrideString applies flagName's NIXFLEET_* env var to *target,
+// unless the flag was set explicitly on the command line.
+func envOverrideString(cmd *cobra.Command, flagName string, target *string) {
+	if cmd.Root().PersistentFlags().Changed(flagName) {
+		return
+	}
+	if v, ok := os.LookupEnv(config.EnvVar(flagName)); ok {
+		*target = v
+	}
+}
+
+// envOverrideBool is envOverrideString for boolean flags.
+func envOverrideBool(cmd *cobra.Command, flagName string, target *bool) {
+	if cmd.Root().PersistentFlags().Changed(flagName) {
+		return
+	}
+	if v, ok := os.LookupEnv(config.EnvVar(flagName)); ok {
+		*target = v == "1" || strings.EqualFold(v, "true")
+	}
+}
+
+// envOverrideInt is envOverrideString for integer flags.
+func envOverrideInt(cmd *cobra.Command, flagName string, target *int) {
+	if cmd.Root().PersistentFlags().Changed(flagName) {
+		return
+	}
+	if v, ok := os.LookupEnv(config.EnvVar(flagName)); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			*target = n
+		}
+	}
+}
+
+// traceCommandsWriter and cmdTracer hold the file (if any) and Tracer set
+// up by setUpCommandTracer, so tearDownCommandTracer can flush a summary
+// and close it again.
+var (
+	traceCommandsFile *os.File
+	cmdTracer         *ssh.Tracer
+)
+
+// setUpCommandTracer installs a process-wide ssh.Tracer when --trace-commands
+// is set, so every Client.Exec/ExecSudo call for the rest of this invocation
+// is recorded. It's a no-op when the flag is unset.
+func setUpCommandTracer() error {
+	if traceCommands == "" {
+		if traceOnly {
+			return fmt.Errorf("--trace-only requires --trace-commands")
+		}
+		return nil
+	}
+
+	w := io.Writer(os.Stdout)
+	if traceCommands != "-" {
+		f, err := os.Create(traceCommands)
+		if err != nil {
+			return fmt.Errorf("creating trace file: %w", err)
+		}
+		traceCommandsFile = f
+		w = f
+	}
+
+	cmdTracer = ssh.NewTracer(w, traceOnly)
+	ssh.SetTracer(cmdTracer)
+	return nil
+}
+
+// tearDownCommandTracer prints the per-host/suspect command summary and
+// closes the trace file, if tracing was enabled for this invocation.
+func tearDownCommandTracer() error {
+	if cmdTracer == nil {
+		return nil
+	}
+
+	perHost, suspects := cmdTracer.Summary()
+	fmt.Fprintln(os.Stderr, "\nCommand trace summary:")
+	for _, host := range sortedKeys(perHost) {
+		fmt.Fprintf(os.Stderr, "  %s: %d command(s)\n", host, perHost[host])
+	}
+	if suspects > 0 {
+		fmt.Fprintf(os.Stderr, "  WARNING: %d command(s) look like they embed a literal secret - check the trace and fix that call site\n", suspects)
+	}
+
+	ssh.SetTracer(nil)
+	cmdTracer = nil
+
+	if traceCommandsFile != nil {
+		err := traceCommandsFile.Close()
+		traceCommandsFile = nil
+		return err
+	}
+	return nil
+}
+
+// sortedKeys returns m's keys in ascending order, for deterministic summary
+// output.
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -66,8 +327,33 @@ func main() {
 
 	if err := rootCmd().ExecuteContext(ctx); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		code := 1
+		var exitErr *cliExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.code
+		}
+		os.Exit(code)
+	}
+}
+
+// cliExitError lets a command's RunE request a specific process exit code
+// instead of the default 1, while still printing like any other error - so
+// e.g. 'pki status --output json' can hand a cron wrapper a code that
+// distinguishes "certs expiring" from "certs expired" from "couldn't run at
+// all" without it having to parse the JSON just to decide whether to page.
+type cliExitError struct {
+	err  error
+	code int
+}
+
+func (e *cliExitError) Error() string { return e.err.Error() }
+func (e *cliExitError) Unwrap() error { return e.err }
+
+func exitWithCode(code int, err error) error {
+	if err == nil {
+		return nil
 	}
+	return &cliExitError{err: err, code: code}
 }
 
 func rootCmd() *cobra.Command {
@@ -84,30 +370,72 @@ It provides Ansible-like UX for:
 		Version: version,
 	}
 
-	// Global flags
-	cmd.PersistentFlags().StringVarP(&inventoryPath, "inventory", "i", "inventory/", "Path to inventory directory or file")
-	cmd.PersistentFlags().StringVarP(&flakePath, "flake", "f", ".", "Path to flake directory")
-	cmd.PersistentFlags().StringVarP(&targetHost, "host", "H", "", "Target specific host")
-	cmd.PersistentFlags().StringVarP(&targetGroup, "group", "g", "", "Target host group")
-	cmd.PersistentFlags().IntVarP(&maxParallel, "parallel", "p", 5, "Max parallel operations")
-	cmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Show what would be done without making changes")
-	cmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+	// Global flags. Defaults come from the resolved config file (user
+	// config, then local ./.nixfleet.yaml, then the active context) so a
+	// context switch changes what a bare `nixfleet plan` does without
+	// needing every flag re-typed. PersistentPreRunE below layers
+	// NIXFLEET_* env vars on top of these defaults, below whatever the
+	// user actually typed on the command line.
+	defaults := resolveCLIDefaults()
+	cmd.PersistentFlags().StringVarP(&inventoryPath, "inventory", "i", defaults.inventory, "Path to inventory directory or file")
+	cmd.PersistentFlags().StringVarP(&flakePath, "flake", "f", defaults.flake, "Path to flake directory")
+	cmd.PersistentFlags().StringVarP(&targetHost, "host", "H", defaults.host, "Target specific host")
+	cmd.PersistentFlags().StringVarP(&targetGroup, "group", "g", defaults.group, "Target host group")
+	cmd.PersistentFlags().IntVarP(&maxParallel, "parallel", "p", defaults.parallel, "Max parallel operations")
+	cmd.PersistentFlags().BoolVar(&dryRun, "dry-run", defaults.dryRun, "Show what would be done without making changes")
+	cmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", defaults.verbose, "Verbose output")
+	cmd.PersistentFlags().BoolVar(&offline, "offline", defaults.offline, "Don't touch the network: pass --offline to nix and skip cache pushes/remote diffs")
+	cmd.PersistentFlags().BoolVar(&noEvalCache, "no-eval-cache", defaults.noEvalCache, "Bypass the eval cache and re-evaluate every host from scratch")
+	cmd.PersistentFlags().StringVar(&traceCommands, "trace-commands", "", "Record every remote command as JSONL to this file ('-' for stdout)")
+	cmd.PersistentFlags().BoolVar(&traceOnly, "trace-only", false, "With --trace-commands, record the command plan without executing anything or touching the network")
+	cmd.PersistentFlags().BoolVar(&checkDNS, "check-dns", false, "Resolve every host's address while loading the inventory, reporting failures up front")
+	cmd.PersistentFlags().StringVar(&jumpOverride, "jump", "", "Dial every targeted host through this bastion for this run, as [user@]host[:port] - overrides any inventory JumpHost")
+
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		envOverrideString(cmd, "inventory", &inventoryPath)
+		envOverrideString(cmd, "flake", &flakePath)
+		envOverrideString(cmd, "host", &targetHost)
+		envOverrideString(cmd, "group", &targetGroup)
+		envOverrideInt(cmd, "parallel", &maxParallel)
+		envOverrideBool(cmd, "dry-run", &dryRun)
+		envOverrideBool(cmd, "verbose", &verbose)
+		envOverrideBool(cmd, "offline", &offline)
+		envOverrideBool(cmd, "no-eval-cache", &noEvalCache)
+		envOverrideString(cmd, "trace-commands", &traceCommands)
+		envOverrideBool(cmd, "trace-only", &traceOnly)
+		return setUpCommandTracer()
+	}
+
+	cmd.PersistentPostRunE = func(cmd *cobra.Command, args []string) error {
+		return tearDownCommandTracer()
+	}
+
+	registerHostAndGroupCompletion(cmd)
 
 	// Add subcommands
+	cmd.AddCommand(configCmd())
+	cmd.AddCommand(contextCmd())
 	cmd.AddCommand(planCmd())
 	cmd.AddCommand(applyCmd())
+	cmd.AddCommand(testCmd())
 	cmd.AddCommand(rollbackCmd())
 	cmd.AddCommand(statusCmd())
+	cmd.AddCommand(exportCmd())
 	cmd.AddCommand(osUpdateCmd())
+	cmd.AddCommand(aptCmd())
 	cmd.AddCommand(nixCmd())
 	cmd.AddCommand(rebootCmd())
 	cmd.AddCommand(cacheCmd())
 	cmd.AddCommand(secretsCmd())
+	cmd.AddCommand(approvalsCmd())
 	cmd.AddCommand(driftCmd())
 	cmd.AddCommand(runCmd())
 	cmd.AddCommand(serverCmd())
 	cmd.AddCommand(pullModeCmd())
 	cmd.AddCommand(hostCmd())
+	cmd.AddCommand(searchCmd())
+	cmd.AddCommand(discoverCmd())
+	cmd.AddCommand(siemCmd())
 	cmd.AddCommand(pkiCmd())
 	cmd.AddCommand(k0sCmd())
 	cmd.AddCommand(nodeStatusCmd())
@@ -116,1770 +444,2443 @@ It provides Ansible-like UX for:
 	cmd.AddCommand(juicefsCmd())
 	cmd.AddCommand(stateCmd())
 	cmd.AddCommand(synologyCmd())
+	cmd.AddCommand(provenanceCmd())
+	cmd.AddCommand(complianceCmd())
+	cmd.AddCommand(doctorCmd())
 
 	return cmd
 }
 
-func loadInventoryAndHosts(ctx context.Context) (*inventory.Inventory, []*inventory.Host, error) {
-	// Load inventory
-	inv, err := inventory.LoadFromDir(inventoryPath)
-	if err != nil {
-		// Try as single file
-		inv, err = inventory.LoadFromFile(inventoryPath)
-		if err != nil {
-			return nil, nil, fmt.Errorf("loading inventory: %w", err)
-		}
-	}
-
-	if err := inv.Validate(); err != nil {
-		return nil, nil, fmt.Errorf("invalid inventory: %w", err)
-	}
-
-	// Determine target hosts
-	var hosts []*inventory.Host
-	switch {
-	case targetHost != "":
-		h, ok := inv.GetHost(targetHost)
-		if !ok {
-			return nil, nil, fmt.Errorf("host %q not found in inventory", targetHost)
-		}
-		hosts = []*inventory.Host{h}
-	case targetGroup != "":
-		hosts = inv.HostsInGroup(targetGroup)
-		if len(hosts) == 0 {
-			return nil, nil, fmt.Errorf("no hosts in group %q", targetGroup)
-		}
-	default:
-		hosts = inv.AllHosts()
-	}
+func doctorCmd() *cobra.Command {
+	var minVersion string
 
-	return inv, hosts, nil
-}
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the local nix/git environment against what nixfleet needs",
+		Long: `Run the full set of environment preflight checks nixfleet relies on:
+nix version and required experimental features (flakes, nix-command) - the
+same cheap checks NewEvaluator runs automatically once per process - plus
+flake resolution, git availability and working-tree cleanliness, and
+substituter connectivity.
 
-func planCmd() *cobra.Command {
-	var showDiff bool
+Most "inscrutable evaluation error" support questions come down to one of
+these being missing; doctor prints pass/warn/fail per check with a
+remediation hint instead of making you guess from the raw nix error.
 
-	cmd := &cobra.Command{
-		Use:   "plan",
-		Short: "Show what changes would be applied",
-		Long: `Evaluate host configurations and show a diff of what would change.
+Exit codes: 0 if every check passed or only warned, 1 if any check failed.
 
-Compares desired configuration against current deployed state to show:
-- Changed configuration hashes
-- Store path differences
-- Whether a rebuild is needed`,
+Example:
+  nixfleet doctor
+  nixfleet doctor --min-version 2.20.0`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
-			if err != nil {
-				return err
+			if minVersion != "" {
+				nix.MinNixVersion = minVersion
 			}
 
-			// Initialize Nix evaluator
 			flake, err := nix.ResolveFlakePath(flakePath)
 			if err != nil {
 				return err
 			}
 
-			evaluator, err := nix.NewEvaluator(flake)
-			if err != nil {
-				return err
-			}
-
-			pool := ssh.NewPool(nil)
-			defer pool.Close()
-
-			stateMgr := state.NewManager()
-
-			fmt.Printf("Planning changes for %d host(s)...\n\n", len(hosts))
-
-			changedCount := 0
-			upToDateCount := 0
-
-			for _, host := range hosts {
-				fmt.Printf("Host: %s (%s @ %s)\n", host.Name, host.Base, host.Addr)
-
-				closure, err := evaluator.BuildHost(ctx, host.Name, host.Base)
-				if err != nil {
-					fmt.Printf("  ERROR: %v\n\n", err)
-					continue
+			report := nix.RunDoctor(ctx, flake)
+			for _, check := range report.Checks {
+				symbol := map[nix.CheckStatus]string{nix.StatusPass: "✓", nix.StatusWarn: "⚠", nix.StatusFail: "✗"}[check.Status]
+				fmt.Printf("%s %-24s %s\n", symbol, check.Name, check.Message)
+				if check.Remediation != "" {
+					fmt.Printf("    -> %s\n", check.Remediation)
 				}
+			}
 
-				size, _ := evaluator.GetClosureSize(ctx, closure.StorePath)
+			if report.HasFailures() {
+				return exitWithCode(1, fmt.Errorf("one or more doctor checks failed"))
+			}
+			return nil
+		},
+	}
 
-				// Try to get current state from host
-				var hostState *state.HostState
-				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
-				if err == nil {
-					hostState, _ = stateMgr.ReadState(ctx, client)
-				}
+	cmd.Flags().StringVar(&minVersion, "min-version", "", fmt.Sprintf("Minimum nix version to require (default %s)", nix.DefaultMinNixVersion))
 
-				// Compare with current state
-				hasChanges := true
-				if hostState != nil && hostState.ManifestHash != "" {
-					if hostState.ManifestHash == closure.ManifestHash {
-						hasChanges = false
-						upToDateCount++
-						fmt.Printf("  Status: UP TO DATE\n")
-						fmt.Printf("  Store path: %s\n", closure.StorePath)
-						if verbose {
-							fmt.Printf("  Manifest hash: %s\n", closure.ManifestHash)
-							fmt.Printf("  Last apply: %s\n", hostState.LastApply.Format(time.RFC3339))
-						}
-					} else {
-						changedCount++
-						fmt.Printf("  Status: CHANGES PENDING\n")
-						fmt.Printf("  Current path: %s\n", hostState.StorePath)
-						fmt.Printf("  New path:     %s\n", closure.StorePath)
-						if showDiff {
-							fmt.Printf("  Hash diff:\n")
-							fmt.Printf("    - %s (current)\n", hostState.ManifestHash)
-							fmt.Printf("    + %s (new)\n", closure.ManifestHash)
-						}
-					}
-				} else {
-					changedCount++
-					fmt.Printf("  Status: NEW DEPLOYMENT\n")
-					fmt.Printf("  Store path: %s\n", closure.StorePath)
-					fmt.Printf("  Manifest hash: %s\n", closure.ManifestHash)
-				}
+	return cmd
+}
 
-				fmt.Printf("  Closure size: %.2f MB\n", float64(size)/1024/1024)
+func configCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect nixfleet's config file",
+	}
+	cmd.AddCommand(configViewCmd())
+	return cmd
+}
 
-				// Show additional info if changes are pending
-				if hasChanges && hostState != nil {
-					if hostState.DriftDetected {
-						fmt.Printf("  Note: %d file(s) have drifted from expected state\n", len(hostState.DriftFiles))
-					}
-					if hostState.RebootRequired {
-						fmt.Printf("  Note: Host requires reboot (pending from previous apply)\n")
-					}
-				}
+func configViewCmd() *cobra.Command {
+	var resolved bool
 
-				fmt.Println()
+	cmd := &cobra.Command{
+		Use:   "view",
+		Short: "Print the config file(s)",
+		Long: `Print nixfleet's config.
+
+Without --resolved, prints the raw user (~/.config/nixfleet/config.yaml) and
+local (./.nixfleet.yaml) files separately. With --resolved, prints the
+merged view actually used - user config, local config, and the active
+context layered on top of each other - with server tokens redacted.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			merged, err := config.Load()
+			if err != nil {
+				return err
 			}
 
-			// Summary
-			fmt.Printf("Summary: %d with changes, %d up-to-date\n", changedCount, upToDateCount)
-			if changedCount > 0 {
-				fmt.Println("Run 'nixfleet apply' to deploy changes")
+			if !resolved {
+				fmt.Printf("User config (%s):\n", merged.UserPath)
+				printYAML(userConfigOnly(merged))
+				fmt.Printf("\nLocal config (%s):\n", merged.LocalPath)
+				printYAML(localConfigOnly(merged))
+				return nil
 			}
 
+			fmt.Printf("Active context: %s\n\n", merged.CurrentContext)
+			printYAML(merged.Redacted().File)
 			return nil
 		},
 	}
 
-	cmd.Flags().BoolVar(&showDiff, "diff", false, "Show detailed diff of manifest hashes")
+	cmd.Flags().BoolVar(&resolved, "resolved", false, "Print the merged, effective configuration instead of the raw files")
 
 	return cmd
 }
 
-func applyCmd() *cobra.Command {
-	var (
-		skipPreflight bool
-		skipHealth    bool
-		skipState     bool
-		withPKI       bool
-		pkiDir        string
-		pkiIdentities []string
-	)
+// userConfigOnly and localConfigOnly re-read a single file for `config
+// view`'s non-resolved output, so it reflects exactly what's on disk in
+// that file rather than the merged result.
+func userConfigOnly(merged *config.Merged) any {
+	data, err := os.ReadFile(merged.UserPath)
+	if err != nil {
+		return map[string]string{"error": err.Error()}
+	}
+	var raw map[string]any
+	yaml.Unmarshal(data, &raw)
+	return raw
+}
+
+func localConfigOnly(merged *config.Merged) any {
+	data, err := os.ReadFile(merged.LocalPath)
+	if err != nil {
+		return map[string]string{"error": err.Error()}
+	}
+	var raw map[string]any
+	yaml.Unmarshal(data, &raw)
+	return raw
+}
+
+func printYAML(v any) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		fmt.Printf("  (error: %v)\n", err)
+		return
+	}
+	fmt.Println(strings.TrimRight(string(data), "\n"))
+}
 
+func contextCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "apply",
-		Short: "Apply configurations to hosts",
-		Long:  `Build and deploy configurations to target hosts.`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
+		Use:   "context",
+		Short: "Manage named fleet contexts",
+		Long: `Named contexts bundle a fleet's inventory, flake, secrets/PKI dirs,
+identities, and server URL/token, so switching fleets doesn't mean
+re-typing every flag. Define them under "contexts:" in
+~/.config/nixfleet/config.yaml or ./.nixfleet.yaml.`,
+	}
+	cmd.AddCommand(contextListCmd())
+	cmd.AddCommand(contextUseCmd())
+	return cmd
+}
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+func contextListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List defined contexts",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			merged, err := config.Load()
 			if err != nil {
 				return err
 			}
 
-			if dryRun {
-				fmt.Printf("Would apply to %d host(s):\n", len(hosts))
-				for _, h := range hosts {
-					fmt.Printf("  - %s (%s)\n", h.Name, h.Addr)
-				}
+			if len(merged.Contexts) == 0 {
+				fmt.Println("No contexts defined")
 				return nil
 			}
 
-			// Initialize components
-			flake, err := nix.ResolveFlakePath(flakePath)
-			if err != nil {
-				return err
+			names := make([]string, 0, len(merged.Contexts))
+			for name := range merged.Contexts {
+				names = append(names, name)
 			}
+			sort.Strings(names)
 
-			evaluator, err := nix.NewEvaluator(flake)
-			if err != nil {
+			for _, name := range names {
+				marker := " "
+				if name == merged.CurrentContext {
+					marker = "*"
+				}
+				c := merged.Contexts[name]
+				fmt.Printf("%s %-15s inventory=%s flake=%s\n", marker, name, c.Inventory, c.Flake)
+			}
+			return nil
+		},
+	}
+}
+
+func contextUseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "use <name>",
+		Short: "Switch the active context",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := config.SetCurrentContext(args[0]); err != nil {
 				return err
 			}
+			fmt.Printf("Active context set to %q (in %s)\n", args[0], config.LocalConfigPath())
+			return nil
+		},
+	}
+}
 
-			deployer := nix.NewDeployer(evaluator)
-			pool := ssh.NewPool(nil)
-			defer pool.Close()
+// newEvaluator creates a Nix evaluator for flake, applying the --offline and
+// --no-eval-cache global flags. Use this instead of nix.NewEvaluator
+// directly in any command that builds or evaluates host configs.
+func newEvaluator(flake string) (*nix.Evaluator, error) {
+	evaluator, err := nix.NewEvaluator(flake)
+	if err != nil {
+		return nil, err
+	}
+	evaluator.SetOffline(offline)
+	evaluator.SetEvalCacheEnabled(!noEvalCache)
+	return evaluator, nil
+}
 
-			stateMgr := state.NewManager()
-			executor := ssh.NewExecutor(pool, maxParallel)
-
-			fmt.Printf("Applying to %d host(s)...\n\n", len(hosts))
-
-			// Preflight checks
-			if !skipPreflight {
-				fmt.Println("Running preflight checks...")
-				results := executor.ExecOnHosts(ctx, hosts, "echo ok", false)
-				failed := ssh.FilterFailed(results)
-				if len(failed) > 0 {
-					fmt.Printf("Preflight failed for %d host(s):\n", len(failed))
-					for _, r := range failed {
-						fmt.Printf("  - %s: %v\n", r.Host.Name, r.Error)
-					}
-					return fmt.Errorf("preflight checks failed")
-				}
-				fmt.Printf("Preflight passed for %d host(s)\n\n", len(hosts))
-			}
-
-			successCount := 0
-			failedCount := 0
-
-			// Build and deploy each host
-			for _, host := range hosts {
-				fmt.Printf("Deploying to %s...\n", host.Name)
-				startTime := time.Now()
-
-				// Build
-				closure, err := evaluator.BuildHost(ctx, host.Name, host.Base)
-				if err != nil {
-					fmt.Printf("  Build failed: %v\n", err)
-					failedCount++
-					continue
-				}
-				fmt.Printf("  Built: %s\n", closure.StorePath)
-
-				// Copy
-				fmt.Printf("  Copying closure...\n")
-				if err := deployer.CopyToHost(ctx, closure, host); err != nil {
-					fmt.Printf("  Copy failed: %v\n", err)
-					failedCount++
-					continue
-				}
-
-				// Activate
-				fmt.Printf("  Activating...\n")
-				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
-				if err != nil {
-					fmt.Printf("  Connection failed: %v\n", err)
-					failedCount++
-					continue
-				}
-
-				switch host.Base {
-				case "ubuntu":
-					err = deployer.ActivateUbuntu(ctx, client, closure)
-				case "nixos":
-					err = deployer.ActivateNixOS(ctx, client, closure, "switch")
-				}
-
-				if err != nil {
-					fmt.Printf("  Activation failed: %v\n", err)
-					failedCount++
-					continue
-				}
-
-				// Deploy PKI certificates if enabled
-				if withPKI {
-					pkiConfig := pki.DefaultDeployConfig()
-					pkiConfig.PKIDir = pkiDir
-					pkiConfig.Identities = pkiIdentities
-					pkiDeployer := pki.NewDeployer(pkiConfig)
-
-					if pkiDeployer.IsEnabled() {
-						pkiResult := pkiDeployer.Deploy(ctx, client, host)
-						if pkiResult.Success {
-							if pkiResult.CertDeployed && pkiResult.CertInfo != nil {
-								fmt.Printf("  PKI: deployed cert (expires in %d days)\n", pkiResult.CertInfo.DaysLeft)
-							} else if pkiResult.CADeployed {
-								fmt.Printf("  PKI: deployed CA only\n")
-							}
-						} else {
-							fmt.Printf("  PKI warning: %s\n", pkiResult.Error)
-						}
-					}
-				}
+// classifyImpact compares the closure host currently has deployed
+// (currentStorePath) against the one about to replace it (desiredStorePath)
+// and classifies the disruption, escalating against inv's critical_units.
+// Either store path missing from the local Nix store (already GC'd, or a
+// first-ever deployment with no prior state) degrades to no assessment
+// rather than an error, since impact analysis is advisory.
+func classifyImpact(inv *inventory.Inventory, host *inventory.Host, currentStorePath, desiredStorePath string) (impact.Assessment, bool) {
+	if currentStorePath == "" || currentStorePath == desiredStorePath {
+		return impact.Assessment{}, false
+	}
+	current, err := impact.ManifestForStorePath(currentStorePath, host.Base)
+	if err != nil {
+		return impact.Assessment{}, false
+	}
+	desired, err := impact.ManifestForStorePath(desiredStorePath, host.Base)
+	if err != nil {
+		return impact.Assessment{}, false
+	}
+	return impact.Classify(current, desired, inv.CriticalUnits), true
+}
 
-				duration := time.Since(startTime)
+// printImpact prints the impact classification for a pending change, if one
+// could be computed, in the format used by 'nixfleet plan'.
+func printImpact(inv *inventory.Inventory, host *inventory.Host, currentStorePath, desiredStorePath string) {
+	assessment, ok := classifyImpact(inv, host, currentStorePath, desiredStorePath)
+	if !ok {
+		return
+	}
+	fmt.Printf("  Impact: %s\n", assessment.Level)
+	if len(assessment.ChangedUnits) > 0 {
+		fmt.Printf("  Units restarting: %s\n", strings.Join(assessment.ChangedUnits, ", "))
+	}
+	if len(assessment.RebootReasons) > 0 {
+		fmt.Printf("  Reboot reasons: %s\n", strings.Join(assessment.RebootReasons, "; "))
+	}
+	if assessment.Escalate() {
+		fmt.Printf("  Critical unit(s) affected: %s\n", strings.Join(assessment.CriticalUnits, ", "))
+	}
+}
 
-				// Update state
-				if !skipState {
-					gen, _, _ := deployer.GetCurrentGeneration(ctx, client, host.Base)
-					if err := stateMgr.UpdateAfterApply(ctx, client, closure.StorePath, closure.ManifestHash, gen, duration); err != nil {
-						fmt.Printf("  Warning: failed to update state - %v\n", err)
-					} else if verbose {
-						fmt.Printf("  State updated (gen %d)\n", gen)
-					}
-				}
+func loadInventoryAndHosts(ctx context.Context) (*inventory.Inventory, []*inventory.Host, error) {
+	// Load inventory
+	inv, err := inventory.LoadFromDir(inventoryPath)
+	if err != nil {
+		// Try as single file
+		inv, err = inventory.LoadFromFile(inventoryPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading inventory: %w", err)
+		}
+	}
 
-				// Health checks
-				if !skipHealth {
-					// Basic health check: ensure SSH still works
-					result, err := client.Exec(ctx, "systemctl is-system-running || true")
-					if err != nil {
-						fmt.Printf("  Health check failed: %v\n", err)
-					} else {
-						fmt.Printf("  System status: %s", result.Stdout)
-					}
-				}
+	report := inv.ValidateStrict(ctx, inventory.ValidateStrictOptions{CheckDNS: checkDNS})
+	for _, check := range report.Checks {
+		if check.Status == inventory.ValidationWarn {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", check.Message)
+		}
+	}
+	if report.HasFailures() {
+		return nil, nil, fmt.Errorf("invalid inventory: %s", report.FailureSummary())
+	}
 
-				fmt.Printf("  Done! (%s)\n\n", duration.Round(time.Second))
-				successCount++
-			}
+	// Determine target hosts
+	var hosts []*inventory.Host
+	switch {
+	case targetHost != "":
+		h, ok := inv.GetHost(targetHost)
+		if !ok {
+			return nil, nil, fmt.Errorf("host %q not found in inventory", targetHost)
+		}
+		hosts = []*inventory.Host{h}
+	case targetGroup != "":
+		hosts = inv.HostsInGroup(targetGroup)
+		if len(hosts) == 0 {
+			return nil, nil, fmt.Errorf("no hosts in group %q", targetGroup)
+		}
+	default:
+		hosts = inv.AllHosts()
+	}
 
-			fmt.Printf("Summary: %d succeeded, %d failed\n", successCount, failedCount)
-			return nil
-		},
+	if jumpOverride != "" {
+		jump, err := inventory.ParseJumpHostSpec(jumpOverride)
+		if err != nil {
+			return nil, nil, fmt.Errorf("--jump: %w", err)
+		}
+		for _, h := range hosts {
+			h.JumpHost = jump
+		}
 	}
 
-	cmd.Flags().BoolVar(&skipPreflight, "skip-preflight", false, "Skip preflight checks")
-	cmd.Flags().BoolVar(&skipHealth, "skip-health", false, "Skip post-apply health checks")
-	cmd.Flags().BoolVar(&skipState, "skip-state", false, "Skip updating host state after apply")
-	cmd.Flags().BoolVar(&withPKI, "with-pki", false, "Deploy PKI certificates after activation")
-	cmd.Flags().StringVar(&pkiDir, "pki-dir", "secrets/pki", "Directory containing PKI files")
-	cmd.Flags().StringSliceVar(&pkiIdentities, "pki-identity", nil, "Age identity files for decrypting PKI keys")
+	return inv, hosts, nil
+}
 
+func complianceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compliance",
+		Short: "Fleet-wide OS patch compliance reporting",
+	}
+	cmd.AddCommand(complianceReportCmd())
 	return cmd
 }
 
-func rollbackCmd() *cobra.Command {
-	var toGeneration string
+func complianceReportCmd() *cobra.Command {
+	var (
+		format   string
+		window   string
+		server   string
+		apiToken string
+		dataDir  string
+	)
 
 	cmd := &cobra.Command{
-		Use:   "rollback",
-		Short: "Rollback to a previous generation",
-		Long:  `Rollback host configuration to a previous generation.`,
+		Use:   "report",
+		Short: "Report per-host and fleet-level SLA compliance for outstanding OS updates",
+		Long: `Report how long each host has carried outstanding security/regular
+updates, against its configured SLA (see Host/Group compliance_sla in the
+inventory), over the last --window.
+
+With --server, this calls GET /api/compliance on a running nixfleet server,
+which is the only place the check history (recorded by its compliance-check
+scheduler task) lives. Without --server, it computes the same metrics
+directly from --data-dir's compliance.json, for a server's own data dir
+inspected offline.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
-
-			_, hosts, err := loadInventoryAndHosts(ctx)
-			if err != nil {
-				return err
+			if format != "csv" && format != "json" {
+				return fmt.Errorf("--format must be csv or json")
 			}
 
-			pool := ssh.NewPool(nil)
-			defer pool.Close()
-
-			flake, err := nix.ResolveFlakePath(flakePath)
+			metrics, err := getComplianceMetrics(cmd.Context(), server, apiToken, dataDir, window)
 			if err != nil {
 				return err
 			}
 
-			evaluator, err := nix.NewEvaluator(flake)
-			if err != nil {
-				return err
+			switch format {
+			case "json":
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(metrics)
+			default:
+				return writeComplianceCSV(os.Stdout, metrics)
 			}
+		},
+	}
 
-			deployer := nix.NewDeployer(evaluator)
+	cmd.Flags().StringVar(&format, "format", "csv", "Output format: csv or json")
+	cmd.Flags().StringVar(&window, "window", "90d", "Reporting window, e.g. 90d or 720h")
+	cmd.Flags().StringVar(&server, "server", "", "nixfleet server URL (e.g. http://localhost:8080); unset computes locally from --data-dir")
+	cmd.Flags().StringVar(&apiToken, "api-token", defaultServerToken(), "API authentication token for --server")
+	cmd.Flags().StringVar(&dataDir, "data-dir", ".", "Server data dir to read compliance.json from when --server is unset")
 
-			for _, host := range hosts {
-				fmt.Printf("Rolling back %s...\n", host.Name)
+	return cmd
+}
 
-				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
-				if err != nil {
-					fmt.Printf("  Connection failed: %v\n", err)
-					continue
-				}
+// getComplianceMetrics resolves a compliance.FleetMetrics either by calling
+// a live server (the only place the scheduler's recorded history lives) or,
+// for inspecting a server's data dir offline, by loading its compliance.json
+// and the local inventory directly - the same approvalRef-style "--server or
+// local files" duality used by the approvals commands.
+func getComplianceMetrics(ctx context.Context, server, apiToken, dataDir, window string) (*compliance.FleetMetrics, error) {
+	if server != "" {
+		var metrics compliance.FleetMetrics
+		url := strings.TrimSuffix(server, "/") + "/api/compliance?window=" + window
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if apiToken != "" {
+			req.Header.Set("Authorization", "Bearer "+apiToken)
+		}
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, body)
+		}
+		if err := json.Unmarshal(body, &metrics); err != nil {
+			return nil, err
+		}
+		return &metrics, nil
+	}
 
-				generation := 0 // 0 means previous
-				if toGeneration != "previous" && toGeneration != "" {
-					fmt.Sscanf(toGeneration, "%d", &generation)
-				}
+	win, err := compliance.ParseWindow(window)
+	if err != nil {
+		return nil, err
+	}
+	inv, hosts, err := loadInventoryAndHosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(hosts))
+	for i, h := range hosts {
+		names[i] = h.Name
+	}
 
-				if err := deployer.Rollback(ctx, client, host.Base, generation); err != nil {
-					fmt.Printf("  Rollback failed: %v\n", err)
-					continue
-				}
+	store := compliance.NewStore(dataDir)
+	resolveSLA := func(name string) compliance.SLA {
+		host, ok := inv.GetHost(name)
+		if !ok {
+			return compliance.DefaultSLA()
+		}
+		sla, ok := inv.ComplianceSLAForHost(host)
+		if !ok {
+			return compliance.DefaultSLA()
+		}
+		return compliance.SLA{SecurityDays: sla.SecurityDays, RegularDays: sla.RegularDays}
+	}
+	maintenanceMode := func(name string) bool {
+		host, ok := inv.GetHost(name)
+		return ok && host.MaintenanceMode
+	}
 
-				fmt.Printf("  Done!\n")
-			}
+	fm := compliance.ComputeFleetMetrics(store, names, resolveSLA, maintenanceMode, time.Now(), win)
+	return &fm, nil
+}
 
-			return nil
-		},
+// writeComplianceCSV writes one row per host, mirroring export.WriteCSV's
+// plain encoding/csv usage.
+func writeComplianceCSV(w io.Writer, metrics *compliance.FleetMetrics) error {
+	cw := csv.NewWriter(w)
+	header := []string{"host", "compliant", "maintenance_mode", "security_pending", "regular_pending", "oldest_security_days", "oldest_regular_days", "mean_time_to_patch_days", "offending_packages"}
+	if err := cw.Write(header); err != nil {
+		return err
 	}
+	for _, h := range metrics.Hosts {
+		row := []string{
+			h.Host,
+			strconv.FormatBool(h.Compliant),
+			strconv.FormatBool(h.MaintenanceMode),
+			strconv.Itoa(h.SecurityPending),
+			strconv.Itoa(h.RegularPending),
+			strconv.Itoa(h.OldestSecurityDays),
+			strconv.Itoa(h.OldestRegularDays),
+			strconv.FormatFloat(h.MeanTimeToPatchDays, 'f', 1, 64),
+			strings.Join(h.OffendingPackages, ";"),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
 
-	cmd.Flags().StringVar(&toGeneration, "to", "previous", "Target generation (previous or generation number)")
-
-	return cmd
+// planHostJSON is one row of --output json output for 'plan' - a
+// machine-readable summary of a single host's diff so a CI job can act on
+// it without parsing the human-readable table. Error is set instead of the
+// fields above when building the host's closure failed, so a broken host
+// shows up as data in the array rather than aborting the whole run.
+type planHostJSON struct {
+	Name             string `json:"name"`
+	Base             string `json:"base"`
+	Addr             string `json:"addr"`
+	Status           string `json:"status"`
+	CurrentStorePath string `json:"currentStorePath,omitempty"`
+	NewStorePath     string `json:"newStorePath,omitempty"`
+	CurrentManifest  string `json:"currentManifestHash,omitempty"`
+	NewManifest      string `json:"newManifestHash,omitempty"`
+	ClosureSizeBytes int64  `json:"closureSizeBytes,omitempty"`
+	DriftDetected    bool   `json:"driftDetected,omitempty"`
+	RebootRequired   bool   `json:"rebootRequired,omitempty"`
+	Error            string `json:"error,omitempty"`
 }
 
-func statusCmd() *cobra.Command {
-	var showAll bool
+func planCmd() *cobra.Command {
+	var showDiff bool
+	var order []string
+	var output string
+	var exitCodeOnChanges bool
 
 	cmd := &cobra.Command{
-		Use:   "status",
-		Short: "Show host status",
-		Long: `Display current status of managed hosts including generation, health, and pending changes.
+		Use:   "plan",
+		Short: "Show what changes would be applied",
+		Long: `Evaluate host configurations and show a diff of what would change.
+
+Compares desired configuration against current deployed state to show:
+- Changed configuration hashes
+- Store path differences
+- Whether a rebuild is needed
 
-Use --all to show extended status including update counts and drift.`,
+If --order or the inventory's apply_order is set, hosts are shown grouped
+into the stages 'apply' would deploy them in.
+
+With --output json, prints one JSON object per host (name, base, addr,
+status of up_to_date/changes_pending/new_deployment/error, current and new
+store paths, manifest hashes, closure size in bytes, driftDetected,
+rebootRequired, error) instead of the table, and suppresses the deploy
+order and summary text. A host whose closure failed to build appears as an
+"error" row rather than aborting the run.
+
+With --exit-code-on-changes, the process exits 2 if any host has pending
+changes (changes_pending or new_deployment) and 1 if any host errored, like
+'terraform plan -detailed-exitcode' - useful for failing a CI job on drift.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid --output %q (want table or json)", output)
+			}
+			asJSON := output == "json"
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
 			if err != nil {
 				return err
 			}
 
-			pool := ssh.NewPool(nil)
-			defer pool.Close()
-
+			// Initialize Nix evaluator
 			flake, err := nix.ResolveFlakePath(flakePath)
 			if err != nil {
 				return err
 			}
 
-			evaluator, err := nix.NewEvaluator(flake)
+			evaluator, err := newEvaluator(flake)
 			if err != nil {
 				return err
 			}
 
-			deployer := nix.NewDeployer(evaluator)
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
 			stateMgr := state.NewManager()
 
-			if showAll {
-				fmt.Printf("%-18s %-7s %-15s %-6s %-6s %-8s %s\n", "HOST", "BASE", "ADDRESS", "REBOOT", "DRIFT", "UPDATES", "GENERATION")
-				fmt.Printf("%-18s %-7s %-15s %-6s %-6s %-8s %s\n", "----", "----", "-------", "------", "-----", "-------", "----------")
-			} else {
-				fmt.Printf("%-20s %-8s %-15s %-10s %s\n", "HOST", "BASE", "ADDRESS", "REBOOT", "CURRENT")
-				fmt.Printf("%-20s %-8s %-15s %-10s %s\n", "----", "----", "-------", "------", "-------")
+			deployOrder := order
+			if len(deployOrder) == 0 {
+				deployOrder = inv.ApplyOrder
 			}
-
+			stages := inv.ComputeStages(hosts, deployOrder)
+			if len(stages) > 1 && !asJSON {
+				fmt.Println("Deploy order:")
+				for i, stage := range stages {
+					fmt.Printf("  %d. %s: %s\n", i+1, stage.Name, strings.Join(stage.HostNames(), ", "))
+				}
+				fmt.Println()
+			}
+
+			if !asJSON {
+				fmt.Printf("Planning changes for %d host(s)...\n\n", len(hosts))
+			}
+
+			changedCount := 0
+			upToDateCount := 0
+			erroredCount := 0
+			var rows []planHostJSON
+
 			for _, host := range hosts {
-				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if !asJSON {
+					fmt.Printf("Host: %s (%s @ %s)\n", host.Name, host.Base, host.Addr)
+				}
+
+				row := planHostJSON{Name: host.Name, Base: host.Base, Addr: host.Addr}
+
+				var closure *nix.HostClosure
+				if hostFlake := inv.FlakeForHost(host); hostFlake != "" {
+					if err := evaluator.CheckFlakeEvaluableAt(ctx, hostFlake); err != nil {
+						erroredCount++
+						row.Status = "error"
+						row.Error = fmt.Sprintf("flake %s: %v", hostFlake, err)
+						rows = append(rows, row)
+						if !asJSON {
+							fmt.Printf("  ERROR: flake %s: %v\n\n", hostFlake, err)
+						}
+						continue
+					}
+					closure, err = evaluator.BuildHostFromFlake(ctx, hostFlake, host.Name, host.Base)
+				} else {
+					closure, err = evaluator.BuildHost(ctx, host.Name, host.Base)
+				}
 				if err != nil {
-					if showAll {
-						fmt.Printf("%-18s %-7s %-15s %-6s %-6s %-8s %s\n", host.Name, host.Base, host.Addr, "?", "?", "?", "connection failed")
-					} else {
-						fmt.Printf("%-20s %-8s %-15s %-10s %s\n", host.Name, host.Base, host.Addr, "?", "connection failed")
+					erroredCount++
+					row.Status = "error"
+					row.Error = err.Error()
+					rows = append(rows, row)
+					if !asJSON {
+						fmt.Printf("  ERROR: %v\n\n", err)
 					}
 					continue
 				}
 
-				_, current, err := deployer.GetCurrentGeneration(ctx, client, host.Base)
-				if err != nil {
-					current = "unknown"
-				}
+				size, _ := evaluator.GetClosureSize(ctx, closure.StorePath)
+				row.NewStorePath = closure.StorePath
+				row.NewManifest = closure.ManifestHash
+				row.ClosureSizeBytes = size
 
-				reboot, _ := deployer.CheckRebootNeeded(ctx, client, host.Base)
-				rebootStr := "no"
-				if reboot {
-					rebootStr = "YES"
+				// Try to get current state from host
+				var hostState *state.HostState
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err == nil {
+					hostState, _ = stateMgr.ReadState(ctx, client)
 				}
 
-				// Read state for extended info
-				hostState, _ := stateMgr.ReadState(ctx, client)
-
-				if showAll {
-					driftStr := "-"
-					updatesStr := "-"
-
-					if hostState != nil {
-						if hostState.DriftDetected {
-							driftStr = fmt.Sprintf("%d", len(hostState.DriftFiles))
-						} else if !hostState.LastDriftCheck.IsZero() {
-							driftStr = "ok"
+				// Compare with current state
+				hasChanges := true
+				if hostState != nil && hostState.ManifestHash != "" {
+					row.CurrentStorePath = hostState.StorePath
+					row.CurrentManifest = hostState.ManifestHash
+					if hostState.ManifestHash == closure.ManifestHash {
+						hasChanges = false
+						upToDateCount++
+						row.Status = "up_to_date"
+						if !asJSON {
+							fmt.Printf("  Status: UP TO DATE\n")
+							fmt.Printf("  Store path: %s\n", closure.StorePath)
+							if verbose {
+								fmt.Printf("  Manifest hash: %s\n", closure.ManifestHash)
+								fmt.Printf("  Last apply: %s\n", hostState.LastApply.Format(time.RFC3339))
+							}
 						}
-
-						if hostState.PendingUpdates > 0 {
-							if hostState.SecurityUpdates > 0 {
-								updatesStr = fmt.Sprintf("%d(%d!)", hostState.PendingUpdates, hostState.SecurityUpdates)
-							} else {
-								updatesStr = fmt.Sprintf("%d", hostState.PendingUpdates)
+					} else {
+						changedCount++
+						row.Status = "changes_pending"
+						if !asJSON {
+							fmt.Printf("  Status: CHANGES PENDING\n")
+							fmt.Printf("  Current path: %s\n", hostState.StorePath)
+							fmt.Printf("  New path:     %s\n", closure.StorePath)
+							if showDiff {
+								fmt.Printf("  Hash diff:\n")
+								fmt.Printf("    - %s (current)\n", hostState.ManifestHash)
+								fmt.Printf("    + %s (new)\n", closure.ManifestHash)
 							}
-						} else if !hostState.LastUpdateCheck.IsZero() {
-							updatesStr = "0"
+							printImpact(inv, host, hostState.StorePath, closure.StorePath)
 						}
 					}
-
-					// Truncate store path for display
-					gen := current
-					if len(gen) > 25 {
-						gen = gen[:22] + "..."
-					}
-
-					fmt.Printf("%-18s %-7s %-15s %-6s %-6s %-8s %s\n", host.Name, host.Base, host.Addr, rebootStr, driftStr, updatesStr, gen)
 				} else {
-					// Truncate store path for display
-					if len(current) > 40 {
-						current = current[:37] + "..."
+					changedCount++
+					row.Status = "new_deployment"
+					if !asJSON {
+						fmt.Printf("  Status: NEW DEPLOYMENT\n")
+						fmt.Printf("  Store path: %s\n", closure.StorePath)
+						fmt.Printf("  Manifest hash: %s\n", closure.ManifestHash)
 					}
+				}
 
-					fmt.Printf("%-20s %-8s %-15s %-10s %s\n", host.Name, host.Base, host.Addr, rebootStr, current)
+				if !asJSON {
+					fmt.Printf("  Closure size: %.2f MB\n", float64(size)/1024/1024)
 				}
 
-				// Verbose output
-				if verbose && hostState != nil {
-					fmt.Printf("  Last Apply: %s (gen %d)\n", hostState.LastApply.Format(time.RFC3339), hostState.CurrentGeneration)
-					if hostState.ApplyDuration != "" {
-						fmt.Printf("  Apply Duration: %s\n", hostState.ApplyDuration)
-					}
-					if len(hostState.ServiceHealth) > 0 {
-						healthy := 0
-						for _, s := range hostState.ServiceHealth {
-							if s.Active {
-								healthy++
-							}
+				// Show additional info if changes are pending
+				if hasChanges && hostState != nil {
+					row.DriftDetected = hostState.DriftDetected
+					row.RebootRequired = hostState.RebootRequired
+					if !asJSON {
+						if hostState.DriftDetected {
+							fmt.Printf("  Note: %d file(s) have drifted from expected state\n", len(hostState.DriftFiles))
+						}
+						if hostState.RebootRequired {
+							fmt.Printf("  Note: Host requires reboot (pending from previous apply)\n")
 						}
-						fmt.Printf("  Services: %d/%d healthy\n", healthy, len(hostState.ServiceHealth))
-					}
-					if hostState.DriftDetected {
-						fmt.Printf("  Drift: %d file(s)\n", len(hostState.DriftFiles))
 					}
+				}
+
+				rows = append(rows, row)
+
+				if !asJSON {
 					fmt.Println()
 				}
 			}
 
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(rows); err != nil {
+					return fmt.Errorf("encoding plan output: %w", err)
+				}
+			} else {
+				// Summary
+				fmt.Printf("Summary: %d with changes, %d up-to-date\n", changedCount, upToDateCount)
+				if changedCount > 0 {
+					fmt.Println("Run 'nixfleet apply' to deploy changes")
+				}
+			}
+
+			if exitCodeOnChanges {
+				if erroredCount > 0 {
+					return exitWithCode(1, fmt.Errorf("%d host(s) failed to plan", erroredCount))
+				}
+				if changedCount > 0 {
+					return exitWithCode(2, fmt.Errorf("%d host(s) have pending changes", changedCount))
+				}
+			}
+
 			return nil
 		},
 	}
 
-	cmd.Flags().BoolVarP(&showAll, "all", "a", false, "Show extended status (updates, drift)")
+	cmd.Flags().BoolVar(&showDiff, "diff", false, "Show detailed diff of manifest hashes")
+	cmd.Flags().StringSliceVar(&order, "order", nil, "Group names in deploy order (e.g. db,app,web); defaults to the inventory's apply_order")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json")
+	cmd.Flags().BoolVar(&exitCodeOnChanges, "exit-code-on-changes", false, "Exit 2 if any host has pending changes, 1 if any host errored (like 'terraform plan -detailed-exitcode')")
 
 	return cmd
 }
 
-func osUpdateCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "os-update",
-		Short: "Manage OS updates on Ubuntu hosts",
-		Long: `Manage OS updates on Ubuntu hosts with configurable policies and rollout strategies.
-
-Subcommands:
-  check      - Check for pending updates
-  apply      - Apply updates
-  policy     - Configure update policy
-  hold       - Hold packages from upgrades
-  unhold     - Remove package holds`,
-	}
+func applyCmd() *cobra.Command {
+	var (
+		skipPreflight        bool
+		skipHealth           bool
+		skipState            bool
+		withPKI              bool
+		pkiDir               string
+		pkiIdentities        []string
+		order                []string
+		stageMaxFailures     int
+		overwriteAccepted    bool
+		requireProvenance    bool
+		provenanceDir        string
+		provenanceIdentities []string
+		provenanceRecipients []string
+		smokeTest            bool
+		skipSmokeTest        bool
+		smokeTestTimeout     time.Duration
+		assumeYes            bool
+		skipReadinessCheck   bool
+		stageOnly            bool
+		unstage              bool
+		failFast             bool
+		strategy             string
+		canaryPercent        int
+	)
 
-	cmd.AddCommand(osUpdateCheckCmd())
-	cmd.AddCommand(osUpdateApplyCmd())
-	cmd.AddCommand(osUpdatePolicyCmd())
-	cmd.AddCommand(osUpdateHoldCmd())
-	cmd.AddCommand(osUpdateUnholdCmd())
-	cmd.AddCommand(osUpdateReleaseUpgradeCmd())
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Apply configurations to hosts",
+		Long: `Build and deploy configurations to target hosts.
+
+If --order or the inventory's apply_order is set, hosts are deployed in
+named group stages (e.g. db, then app, then web) instead of all at once, so
+dependents never get redeployed ahead of what they depend on. Each stage
+must finish before the next one starts; if a stage's failure count exceeds
+--stage-max-failures, remaining stages are skipped.
+
+Before activating, each host's new closure is compared against what it
+currently has deployed to classify the impact: config-only, restarting
+specific systemd units, or reboot-implied (kernel/initrd/boot parameters
+changed). A restart or reboot pauses for a [y/N] confirmation unless --yes
+is set; restarting a unit listed in the inventory's critical_units instead
+requires typing the host name, so a database bounce can't be waved through
+by muscle memory.
+
+Pass --smoke-test to boot each host's built closure in a local VM (NixOS)
+or container (Ubuntu) and run its health probes there before deploying;
+a failed smoke test blocks the apply for that host without ever touching
+it. See 'nixfleet test' to run the same check standalone.
+
+Right before copying, each host is probed for target readiness (the Nix
+daemon responds, /nix is writable with room for the closure, the system
+profile directory is writable); a host that fails is skipped with a
+reason instead of failing the copy halfway through. Pass
+--no-readiness-check to disable this for unusual store configurations.
+
+Pass --stage-only to build and copy closures ahead of a maintenance window
+without activating anything - each closure is pinned on its host with a
+temporary GC root and recorded in host state. A later plain apply for the
+same host reuses the staged closure (skipping the copy) if it still
+matches the built closure and its content hash still verifies on the
+host; otherwise it falls back to copying fresh with a note. Pass --unstage
+to release every host's staged closure (dropping its GC root) without
+applying anything, e.g. when a maintenance window is cancelled.
+
+Hosts within a stage are built and deployed concurrently, up to --parallel
+at a time; each host's log is printed as one block once it finishes so
+output from concurrent hosts doesn't interleave mid-line. A failure on one
+host doesn't stop the others unless --fail-fast is set, in which case the
+rest of that stage's in-flight and not-yet-started hosts are cancelled.
+Ctrl-C cancels every in-flight deploy the same way.
+
+Pass --strategy to further split each stage's hosts into a rollout, the
+same way 'nixfleet os-update apply' does:
+  serial   - one host at a time
+  parallel - every host in the stage at once (the default behavior above)
+  canary   - --canary-percent of the stage's hosts first (at least one),
+             then the rest - if any canary host fails activation or its
+             post-apply health check, the rest of the stage is aborted
+--strategy is only consulted when passed explicitly; a plain 'nixfleet
+apply' keeps deploying a whole stage at once regardless of its default.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := ssh.WithOperation(cmd.Context(), "apply")
 
-	return cmd
-}
+			if stageOnly && unstage {
+				return fmt.Errorf("--stage-only and --unstage are mutually exclusive")
+			}
 
-func filterUbuntuHosts(hosts []*inventory.Host) []*inventory.Host {
-	var ubuntuHosts []*inventory.Host
-	for _, h := range hosts {
-		if h.Base == "ubuntu" {
-			ubuntuHosts = append(ubuntuHosts, h)
-		}
-	}
-	return ubuntuHosts
-}
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
 
-func osUpdateCheckCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "check",
-		Short: "Check for pending updates",
-		Long:  `Check for available OS updates on Ubuntu hosts.`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
+			if dryRun {
+				fmt.Printf("Would apply to %d host(s):\n", len(hosts))
+				for _, h := range hosts {
+					fmt.Printf("  - %s (%s)\n", h.Name, h.Addr)
+				}
+				return nil
+			}
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			// Initialize components
+			flake, err := nix.ResolveFlakePath(flakePath)
 			if err != nil {
 				return err
 			}
 
-			ubuntuHosts := filterUbuntuHosts(hosts)
-			if len(ubuntuHosts) == 0 {
-				fmt.Println("No Ubuntu hosts found")
-				return nil
+			evaluator, err := newEvaluator(flake)
+			if err != nil {
+				return err
 			}
 
+			deployer := nix.NewDeployer(evaluator)
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
-			updater := osupdate.NewUpdater()
+			stateMgr := state.NewManager()
+			executor := ssh.NewExecutor(pool, maxParallel)
+			provStore := provenance.NewStore(provenanceDir, provenanceRecipients, provenanceIdentities)
+			smokeTester := smoketest.NewTester(evaluator)
+			smokeTester.SetTimeout(smokeTestTimeout)
+			readinessChecker := preflight.NewChecker()
+			readinessCache := preflight.NewReadinessCache()
+
+			if unstage {
+				fmt.Printf("Unstaging %d host(s)...\n\n", len(hosts))
+				unstagedCount := 0
+				for _, host := range hosts {
+					client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+					if err != nil {
+						fmt.Printf("  %s: connection failed: %v\n", host.Name, err)
+						continue
+					}
+					existing, err := stateMgr.ReadState(ctx, client)
+					if err != nil || existing.StagedClosure == nil {
+						continue
+					}
+					if err := deployer.RemoveTempGCRoot(ctx, client, host.SSHUser, existing.StagedClosure.StorePath); err != nil {
+						fmt.Printf("  %s: failed to remove GC root: %v\n", host.Name, err)
+						continue
+					}
+					if err := stateMgr.ClearStaged(ctx, client); err != nil {
+						fmt.Printf("  %s: failed to clear staged state: %v\n", host.Name, err)
+						continue
+					}
+					fmt.Printf("  %s: unstaged %s\n", host.Name, existing.StagedClosure.StorePath)
+					unstagedCount++
+				}
+				fmt.Printf("\nUnstaged %d host(s)\n", unstagedCount)
+				return nil
+			}
 
-			fmt.Printf("Checking updates on %d host(s)...\n\n", len(ubuntuHosts))
+			fmt.Printf("Applying to %d host(s)...\n\n", len(hosts))
 
-			for _, host := range ubuntuHosts {
-				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
-				if err != nil {
-					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
-					continue
+			// Preflight checks
+			if !skipPreflight {
+				fmt.Println("Running preflight checks...")
+				executor.SetHostTimeout(30*time.Second, 5*time.Second)
+				results := executor.ExecOnHosts(ctx, hosts, "echo ok", false)
+				failed := ssh.FilterFailed(results)
+				if len(failed) > 0 {
+					fmt.Printf("Preflight failed for %d host(s):\n", len(failed))
+					for _, r := range failed {
+						fmt.Printf("  - %s: %v\n", r.Host.Name, r.Error)
+					}
+					return fmt.Errorf("preflight checks failed")
 				}
+				fmt.Printf("Preflight passed for %d host(s)\n\n", len(hosts))
+			}
 
-				pending, err := updater.CheckPendingUpdates(ctx, client)
-				if err != nil {
-					fmt.Printf("%s: check failed - %v\n", host.Name, err)
-					continue
+			deployOrder := order
+			if len(deployOrder) == 0 {
+				deployOrder = inv.ApplyOrder
+			}
+			stages := inv.ComputeStages(hosts, deployOrder)
+			if len(stages) > 1 {
+				fmt.Println("Deploy order:")
+				for i, stage := range stages {
+					fmt.Printf("  %d. %s: %s\n", i+1, stage.Name, strings.Join(stage.HostNames(), ", "))
 				}
+				fmt.Println()
+			}
 
-				reboot, _ := updater.IsRebootRequired(ctx, client)
+			successCount := 0
+			failedCount := 0
+			skippedNotReadyCount := 0
+
+			// outMu serializes writes to stdout across concurrently-deploying
+			// hosts: each host's log lines are buffered and flushed together so
+			// one host's output never gets interleaved mid-line with another's,
+			// and it also guards the interactive confirmation prompt below (only
+			// one host can be waiting on stdin at a time).
+			var outMu sync.Mutex
+
+			// deployOneHost runs the full build/copy/activate sequence for a
+			// single host, writing its log to buf instead of stdout directly so
+			// the caller can flush it as one readable block. It returns whether
+			// the host succeeded and, on failure, whether it was specifically a
+			// "target not ready" skip (for the summary line).
+			// deployOneHost's third return value, healthy, only matters to the
+			// canary strategy below - it's true whenever the host wasn't
+			// activated at all (stage-only, or --skip-health) so a canary
+			// batch is never gated on a signal it never collected.
+			deployOneHost := func(ctx context.Context, host *inventory.Host, buf *strings.Builder) (success, skippedNotReady, healthy bool) {
+				out := func(format string, a ...any) { fmt.Fprintf(buf, format, a...) }
+				out("Deploying to %s...\n", host.Name)
+				startTime := time.Now()
 
-				fmt.Printf("%s:\n", host.Name)
-				fmt.Printf("  Security updates: %d\n", len(pending.SecurityUpdates))
-				fmt.Printf("  Regular updates:  %d\n", len(pending.RegularUpdates))
-				fmt.Printf("  Total pending:    %d\n", pending.TotalCount)
-				if reboot {
-					fmt.Printf("  Reboot required:  YES\n")
+				// Build
+				vars, err := inv.ResolvedVarsForHost(host)
+				if err != nil {
+					out("  Build failed: %v\n", err)
+					return false, false, false
 				}
+				closure, err := evaluator.BuildHostWithVars(ctx, host.Name, host.Base, vars)
+				if err != nil {
+					out("  Build failed: %v\n", err)
+					return false, false, false
+				}
+				out("  Built: %s\n", closure.StorePath)
 
-				if verbose && pending.TotalCount > 0 {
-					fmt.Println("  Packages:")
-					for _, pkg := range pending.SecurityUpdates {
-						fmt.Printf("    [SECURITY] %s: %s -> %s\n", pkg.Name, pkg.CurrentVersion, pkg.NewVersion)
+				if (smokeTest || host.Rollout.SmokeTestRequired) && !skipSmokeTest {
+					out("  Smoke testing...\n")
+					smokeResult, err := smokeTester.Run(ctx, host, inv.ProbesForHost(host))
+					if err != nil {
+						out("  Smoke test error: %v\n", err)
+						return false, false, false
 					}
-					for _, pkg := range pending.RegularUpdates {
-						fmt.Printf("    %s: %s -> %s\n", pkg.Name, pkg.CurrentVersion, pkg.NewVersion)
+					if !smokeResult.Passed {
+						out("  Smoke test failed (%s): %s\n", smokeResult.Method, smokeResult.Error)
+						if verbose && smokeResult.Log != "" {
+							out("  --- captured log ---\n%s\n  --------------------\n", smokeResult.Log)
+						}
+						return false, false, false
 					}
+					out("  Smoke test passed (%s, %s)\n", smokeResult.Method, smokeResult.Duration.Round(time.Second))
 				}
-				fmt.Println()
-			}
-
-			return nil
-		},
-	}
-}
 
-func osUpdateApplyCmd() *cobra.Command {
-	var securityOnly, allowReboot, distUpgrade bool
-	var strategy string
-	var canaryPercent int
-	var rebootDelay time.Duration
+				if requireProvenance {
+					if _, err := provStore.RequireValid(closure.StorePath, closure.ManifestHash); err != nil {
+						out("  Refused: %v\n", err)
+						return false, false, false
+					}
+				}
 
-	cmd := &cobra.Command{
-		Use:   "apply",
-		Short: "Apply OS updates",
-		Long: `Apply OS updates to Ubuntu hosts.
+				if !skipReadinessCheck {
+					readinessClient, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+					if err != nil {
+						out("  Connection failed: %v\n", err)
+						return false, false, false
+					}
+					requiredBytes, _ := evaluator.GetClosureSize(ctx, closure.StorePath)
+					readiness := readinessCache.Get(ctx, readinessChecker, readinessClient, requiredBytes)
+					if !readiness.Ready {
+						out("  Skipped: target not ready (%s)\n\n", readiness.Reason)
+						return false, true, false
+					}
+				}
 
-Strategies:
-  serial   - Update hosts one at a time (default)
-  parallel - Update all hosts simultaneously
-  canary   - Update a percentage first, then the rest`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
+				// Reuse a closure staged earlier by 'apply --stage-only' instead of
+				// re-copying it, as long as it's still the same closure and its
+				// content still verifies on the host.
+				stagedReused := false
+				if !stageOnly {
+					if stageClient, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser); err == nil {
+						if staged, _ := stateMgr.ReadState(ctx, stageClient); staged != nil && staged.StagedClosure != nil {
+							sc := staged.StagedClosure
+							if sc.StorePath == closure.StorePath && sc.ManifestHash == closure.ManifestHash {
+								if intact, verr := deployer.VerifyStorePathIntact(ctx, stageClient, sc.StorePath); verr == nil && intact {
+									out("  Reusing closure staged at %s\n", sc.StagedAt.Format(time.RFC3339))
+									stagedReused = true
+								} else {
+									out("  Staged closure is no longer intact, copying fresh\n")
+								}
+							}
+						}
+					}
+				}
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
-			if err != nil {
-				return err
-			}
+				// Copy
+				if !stagedReused {
+					out("  Copying closure...\n")
+					if err := deployer.CopyToHost(ctx, closure, host); err != nil {
+						out("  Copy failed: %v\n", err)
+						return false, false, false
+					}
+				}
 
-			ubuntuHosts := filterUbuntuHosts(hosts)
-			if len(ubuntuHosts) == 0 {
-				fmt.Println("No Ubuntu hosts found")
-				return nil
-			}
+				if stageOnly {
+					client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+					if err != nil {
+						out("  Connection failed: %v\n", err)
+						return false, false, false
+					}
+					if err := stateMgr.UpdateStaged(ctx, client, state.StagedClosure{
+						StorePath:    closure.StorePath,
+						ManifestHash: closure.ManifestHash,
+						GCRootPath:   nix.TempGCRootPath(host.SSHUser, closure),
+						StagedAt:     time.Now(),
+					}); err != nil {
+						out("  Warning: failed to record staged state - %v\n", err)
+					}
+					out("  Staged (not activated)\n\n")
+					return true, false, true
+				}
 
-			if dryRun {
-				fmt.Printf("Would apply updates to %d host(s):\n", len(ubuntuHosts))
-				for _, h := range ubuntuHosts {
-					fmt.Printf("  - %s (%s)\n", h.Name, h.Addr)
+				// Activate
+				out("  Activating...\n")
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					out("  Connection failed: %v\n", err)
+					return false, false, false
 				}
-				return nil
-			}
 
-			pool := ssh.NewPool(nil)
-			defer pool.Close()
+				existing, _ := stateMgr.ReadState(ctx, client)
 
-			updater := osupdate.NewUpdater()
+				if !overwriteAccepted && existing != nil && len(existing.Approvals) > 0 {
+					paths := make([]string, 0, len(existing.Approvals))
+					for path := range existing.Approvals {
+						paths = append(paths, path)
+					}
+					sort.Strings(paths)
+					out("  Skipped: accepted drift on %s would be overwritten by store content; pass --overwrite-accepted to proceed\n\n", strings.Join(paths, ", "))
+					return false, false, false
+				}
+
+				if existing != nil {
+					if assessment, ok := classifyImpact(inv, host, existing.StorePath, closure.StorePath); ok && assessment.Level != impact.ConfigOnly {
+						switch assessment.Level {
+						case impact.ServiceRestart:
+							out("  Impact: will restart %s\n", strings.Join(assessment.ChangedUnits, ", "))
+						case impact.RebootRequired:
+							out("  Impact: reboot required (%s)\n", strings.Join(assessment.RebootReasons, "; "))
+						}
 
-			// Handle different strategies
-			var hostsToUpdate [][]*inventory.Host
-			switch strategy {
-			case "parallel":
-				hostsToUpdate = [][]*inventory.Host{ubuntuHosts}
-			case "canary":
-				canaryCount := (len(ubuntuHosts) * canaryPercent) / 100
-				if canaryCount < 1 {
-					canaryCount = 1
-				}
-				if canaryCount >= len(ubuntuHosts) {
-					hostsToUpdate = [][]*inventory.Host{ubuntuHosts}
-				} else {
-					hostsToUpdate = [][]*inventory.Host{
-						ubuntuHosts[:canaryCount],
-						ubuntuHosts[canaryCount:],
+						if !assumeYes {
+							// Flush what's buffered so far and prompt directly on
+							// stdout, holding outMu so no other host's output (or
+							// prompt) interleaves with this one.
+							outMu.Lock()
+							fmt.Print(buf.String())
+							buf.Reset()
+
+							confirmed := true
+							if assessment.Escalate() {
+								fmt.Printf("  This restarts critical unit(s) %s. Type the host name (%s) to confirm: ", strings.Join(assessment.CriticalUnits, ", "), host.Name)
+								var resp string
+								fmt.Scanln(&resp)
+								confirmed = resp == host.Name
+							} else {
+								fmt.Printf("  Proceed? [y/N]: ")
+								var resp string
+								fmt.Scanln(&resp)
+								confirmed = strings.HasPrefix(strings.ToLower(strings.TrimSpace(resp)), "y")
+							}
+							outMu.Unlock()
+
+							if !confirmed {
+								out("  Skipped: not confirmed\n\n")
+								return false, false, false
+							}
+						}
 					}
-					fmt.Printf("Canary rollout: %d canary host(s), then %d remaining\n\n", canaryCount, len(ubuntuHosts)-canaryCount)
 				}
-			default: // serial
-				for _, h := range ubuntuHosts {
-					hostsToUpdate = append(hostsToUpdate, []*inventory.Host{h})
+
+				switch host.Base {
+				case "ubuntu":
+					err = deployer.ActivateUbuntu(ctx, client, closure)
+				case "nixos":
+					err = deployer.ActivateNixOS(ctx, client, closure, "switch")
 				}
-			}
 
-			totalUpdated := 0
-			totalFailed := 0
+				if err != nil {
+					out("  Activation failed: %v\n", err)
+					if !skipState {
+						profilePath, _ := nix.ProfilePath(host.Base)
+						stateMgr.RecordGeneration(ctx, client, state.GenerationRecord{
+							ProfilePath: profilePath,
+							StorePath:   closure.StorePath,
+							Outcome:     state.GenerationFailed,
+							Note:        err.Error(),
+						})
+					}
+					return false, false, false
+				}
 
-			for batchIdx, batch := range hostsToUpdate {
-				if strategy == "canary" && batchIdx > 0 {
-					fmt.Println("\nCanary batch completed successfully. Proceeding with remaining hosts...")
+				// Deploy PKI certificates if enabled
+				if withPKI {
+					pkiConfig := pki.DefaultDeployConfig()
+					pkiConfig.PKIDir = pkiDir
+					pkiConfig.Identities = pkiIdentities
+					pkiDeployer := pki.NewDeployer(pkiConfig)
+
+					if pkiDeployer.IsEnabled() {
+						pkiResult := pkiDeployer.Deploy(ctx, client, host)
+						if pkiResult.Success {
+							if pkiResult.CertDeployed && pkiResult.CertInfo != nil {
+								out("  PKI: deployed cert (expires in %d days)\n", pkiResult.CertInfo.DaysLeft)
+							} else if pkiResult.CADeployed {
+								out("  PKI: deployed CA only\n")
+							}
+						} else {
+							out("  PKI warning: %s\n", pkiResult.Error)
+						}
+					}
 				}
 
-				for _, host := range batch {
-					fmt.Printf("Updating %s...\n", host.Name)
+				duration := time.Since(startTime)
 
-					client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
-					if err != nil {
-						fmt.Printf("  Connection failed: %v\n", err)
-						totalFailed++
-						continue
+				// Update state
+				if !skipState {
+					if existing != nil && existing.StagedClosure != nil {
+						if err := stateMgr.ClearStaged(ctx, client); err != nil && verbose {
+							out("  Warning: failed to clear staged state - %v\n", err)
+						}
 					}
 
-					var result *osupdate.UpdateResult
-					if securityOnly {
-						result, err = updater.ApplySecurityUpdates(ctx, client)
-					} else if distUpgrade {
-						result, err = updater.ApplyDistUpgrade(ctx, client)
+					gen, _, _ := deployer.GetCurrentGeneration(ctx, client, host.Base)
+					if err := stateMgr.UpdateAfterApply(ctx, client, closure.StorePath, closure.ManifestHash, gen, duration); err != nil {
+						out("  Warning: failed to update state - %v\n", err)
+					} else if verbose {
+						out("  State updated (gen %d)\n", gen)
+					}
+					profilePath, _ := nix.ProfilePath(host.Base)
+					if err := stateMgr.RecordGeneration(ctx, client, state.GenerationRecord{
+						Generation:  gen,
+						ProfilePath: profilePath,
+						StorePath:   closure.StorePath,
+						Outcome:     state.GenerationActive,
+					}); err != nil && verbose {
+						out("  Warning: failed to record generation - %v\n", err)
+					}
+
+					rec := provenance.Capture(flake, host.Name, closure.StorePath, closure.ManifestHash)
+					if err := provStore.Sign(ctx, rec); err != nil {
+						out("  Provenance warning: failed to sign - %v\n", err)
+					} else if err := provStore.Save(rec); err != nil {
+						out("  Provenance warning: failed to save - %v\n", err)
 					} else {
-						result, err = updater.ApplyAllUpdates(ctx, client)
+						stateMgr.UpdateProvenance(ctx, client, state.ProvenanceState{
+							StorePath: rec.StorePath,
+							GitCommit: rec.GitCommit,
+							GitDirty:  rec.GitDirty,
+							Builder:   rec.Builder,
+							SignedAt:  rec.CreatedAt,
+						})
+						if verbose {
+							out("  Provenance recorded (%s)\n", rec.GitCommit)
+						}
 					}
+				}
 
+				// Health checks
+				healthy = true
+				if !skipHealth {
+					// Basic health check: ensure SSH still works
+					result, err := client.Exec(ctx, "systemctl is-system-running || true")
 					if err != nil {
-						fmt.Printf("  Update failed: %v\n", err)
-						totalFailed++
-						continue
+						out("  Health check failed: %v\n", err)
+						healthy = false
+					} else {
+						out("  System status: %s", result.Stdout)
+						if status := strings.TrimSpace(result.Stdout); status != "running" {
+							healthy = false
+						}
 					}
+				}
 
-					if !result.Success {
-						fmt.Printf("  Update failed: %s\n", result.Stderr)
-						totalFailed++
-						continue
+				out("  Done! (%s)\n\n", duration.Round(time.Second))
+				return true, false, healthy
+			}
+
+			hostParallel := maxParallel
+			if hostParallel < 1 {
+				hostParallel = 1
+			}
+
+			// strategyExplicit is true only when --strategy was actually passed,
+			// so a plain 'nixfleet apply' keeps deploying every host in a stage
+			// at once (bounded by --parallel) exactly as before.
+			strategyExplicit := cmd.Flags().Changed("strategy")
+
+			for stageIdx, stage := range stages {
+				if len(stages) > 1 {
+					fmt.Printf("=== Stage %d/%d: %s ===\n\n", stageIdx+1, len(stages), stage.Name)
+				}
+
+				stageFailed := 0
+				stageCtx, cancelStage := context.WithCancel(ctx)
+
+				batches := [][]*inventory.Host{stage.Hosts}
+				if strategyExplicit {
+					batches = rollout.Batches(stage.Hosts, strategy, canaryPercent)
+					if strategy == "canary" && len(batches) > 1 {
+						fmt.Printf("Canary rollout for stage %q: %d canary host(s), then %d remaining\n\n",
+							stage.Name, len(batches[0]), len(batches[1]))
 					}
+				}
 
-					fmt.Printf("  Updated %d package(s)\n", len(result.PackagesUpdated))
-					if verbose && len(result.PackagesUpdated) > 0 {
-						for _, pkg := range result.PackagesUpdated {
-							if pkg.OldVersion != "" {
-								fmt.Printf("    %s: %s -> %s\n", pkg.Name, pkg.OldVersion, pkg.NewVersion)
-							} else {
-								fmt.Printf("    %s\n", pkg.Name)
-							}
-						}
+				for batchIdx, batch := range batches {
+					if stageCtx.Err() != nil {
+						break
 					}
 
-					if result.RebootRequired {
-						fmt.Printf("  Reboot required\n")
-						if allowReboot {
-							if rebootDelay > 0 {
-								fmt.Printf("  Scheduling reboot in %v...\n", rebootDelay)
-								if err := updater.ScheduleReboot(ctx, client, rebootDelay); err != nil {
-									fmt.Printf("  Failed to schedule reboot: %v\n", err)
-								}
+					// Build and deploy the hosts in this batch concurrently,
+					// bounded by --parallel. A failure cancels the remaining
+					// in-flight and not-yet-started hosts in this stage only
+					// when --fail-fast is set; otherwise every host still gets
+					// a chance, except a failed canary batch which always
+					// cancels the rest of the stage below.
+					sem := make(chan struct{}, hostParallel)
+					var wg sync.WaitGroup
+					batchGateFailed := 0
+
+					for _, host := range batch {
+						wg.Add(1)
+						go func(h *inventory.Host) {
+							defer wg.Done()
+
+							sem <- struct{}{}
+							defer func() { <-sem }()
+
+							if stageCtx.Err() != nil {
+								outMu.Lock()
+								fmt.Printf("Skipping %s: %v\n\n", h.Name, stageCtx.Err())
+								outMu.Unlock()
+								return
+							}
+
+							var buf strings.Builder
+							success, skippedNotReady, healthy := deployOneHost(stageCtx, h, &buf)
+
+							outMu.Lock()
+							fmt.Print(buf.String())
+							if success {
+								successCount++
 							} else {
-								fmt.Printf("  Rebooting immediately...\n")
-								if err := updater.ScheduleReboot(ctx, client, 1*time.Minute); err != nil {
-									fmt.Printf("  Failed to schedule reboot: %v\n", err)
+								failedCount++
+								stageFailed++
+								if skippedNotReady {
+									skippedNotReadyCount++
+								}
+								if failFast {
+									cancelStage()
 								}
 							}
-						}
+							if !success || !healthy {
+								batchGateFailed++
+							}
+							outMu.Unlock()
+						}(host)
 					}
 
-					totalUpdated++
+					wg.Wait()
 
-					// Cleanup old packages
-					if err := updater.Cleanup(ctx, client); err != nil {
-						if verbose {
-							fmt.Printf("  Cleanup warning: %v\n", err)
-						}
+					if strategyExplicit && rollout.ShouldAbortAfterBatch(strategy, batchIdx, batchGateFailed) {
+						fmt.Printf("Canary batch for stage %q had %d failure(s) (activation or health); aborting the rest of this stage\n\n",
+							stage.Name, batchGateFailed)
+						cancelStage()
+						break
 					}
-
-					fmt.Println()
 				}
 
-				// If canary strategy and first batch, check for failures
-				if strategy == "canary" && batchIdx == 0 && totalFailed > 0 {
-					return fmt.Errorf("canary batch had %d failure(s), aborting rollout", totalFailed)
+				cancelStage()
+
+				if len(stages) > 1 && stageIdx < len(stages)-1 && stageMaxFailures >= 0 && stageFailed > stageMaxFailures {
+					fmt.Printf("Stage %q had %d failure(s), exceeding --stage-max-failures=%d; skipping remaining stage(s)\n\n",
+						stage.Name, stageFailed, stageMaxFailures)
+					break
 				}
 			}
 
-			fmt.Printf("\nSummary: %d updated, %d failed\n", totalUpdated, totalFailed)
+			if skippedNotReadyCount > 0 {
+				fmt.Printf("Summary: %d succeeded, %d failed (%d skipped: target not ready)\n", successCount, failedCount, skippedNotReadyCount)
+			} else {
+				fmt.Printf("Summary: %d succeeded, %d failed\n", successCount, failedCount)
+			}
 			return nil
 		},
 	}
 
-	cmd.Flags().BoolVar(&securityOnly, "security-only", false, "Only apply security updates")
-	cmd.Flags().BoolVar(&distUpgrade, "dist-upgrade", false, "Run dist-upgrade (may add/remove packages)")
-	cmd.Flags().BoolVar(&allowReboot, "reboot", false, "Allow reboot if required")
-	cmd.Flags().DurationVar(&rebootDelay, "reboot-delay", 5*time.Minute, "Delay before reboot")
-	cmd.Flags().StringVar(&strategy, "strategy", "serial", "Rollout strategy (serial, parallel, canary)")
-	cmd.Flags().IntVar(&canaryPercent, "canary-percent", 10, "Percentage of hosts in canary batch")
+	cmd.Flags().BoolVar(&skipPreflight, "skip-preflight", false, "Skip preflight checks")
+	cmd.Flags().BoolVar(&skipHealth, "skip-health", false, "Skip post-apply health checks")
+	cmd.Flags().BoolVar(&skipState, "skip-state", false, "Skip updating host state after apply")
+	cmd.Flags().BoolVar(&withPKI, "with-pki", false, "Deploy PKI certificates after activation")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory containing PKI files")
+	cmd.Flags().StringSliceVar(&pkiIdentities, "pki-identity", nil, "Age identity files for decrypting PKI keys")
+	cmd.Flags().StringSliceVar(&order, "order", nil, "Group names in deploy order (e.g. db,app,web); defaults to the inventory's apply_order")
+	cmd.Flags().IntVar(&stageMaxFailures, "stage-max-failures", 0, "Max failures tolerated in a stage before later stages are skipped")
+	cmd.Flags().BoolVar(&overwriteAccepted, "overwrite-accepted", false, "Overwrite files with accepted drift (see 'nixfleet drift accept') instead of skipping the host")
+	cmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Do not pause for confirmation on service-restarting or reboot-implied deploys")
+	cmd.Flags().BoolVar(&requireProvenance, "require-provenance", false, "Refuse to deploy closures lacking a valid, matching provenance record (see 'nixfleet provenance')")
+	cmd.Flags().StringVar(&provenanceDir, "provenance-dir", defaultProvenanceDir(), "Directory containing provenance records and the signing key")
+	cmd.Flags().StringSliceVar(&provenanceIdentities, "provenance-identity", defaultIdentities(), "Age identity files for decrypting the provenance signing key")
+	cmd.Flags().StringSliceVar(&provenanceRecipients, "provenance-recipient", nil, "Age recipients for encrypting a newly-generated provenance signing key")
+	cmd.Flags().BoolVar(&skipReadinessCheck, "no-readiness-check", false, "Skip the target-readiness probe (nix daemon ping, /nix free space, profile writability) before copying to each host")
+	cmd.Flags().BoolVar(&smokeTest, "smoke-test", false, "Boot the built closure in a local VM/container and run health probes against it before deploying (see 'nixfleet test')")
+	cmd.Flags().BoolVar(&skipSmokeTest, "skip-smoke-test", false, "Skip the smoke test even for hosts with rollout.smoke_test_required set")
+	cmd.Flags().DurationVar(&smokeTestTimeout, "smoke-test-timeout", smoketest.DefaultTimeout, "Max time to spend smoke testing a single host, VM/container boot included")
+	cmd.Flags().BoolVar(&stageOnly, "stage-only", false, "Build and copy closures to hosts, pinned with a GC root, without activating - for pre-positioning ahead of a maintenance window")
+	cmd.Flags().BoolVar(&unstage, "unstage", false, "Release any closures staged by a prior --stage-only run (drops their GC root) without applying anything")
+	cmd.Flags().BoolVar(&failFast, "fail-fast", false, "Cancel the rest of a stage's in-flight and pending hosts as soon as one host fails")
+	cmd.Flags().StringVar(&strategy, "strategy", "serial", "Rollout strategy for hosts within each stage (serial, parallel, canary); only consulted when this flag is passed explicitly")
+	cmd.Flags().IntVar(&canaryPercent, "canary-percent", 10, "Percentage of a stage's hosts in the canary batch")
 
 	return cmd
 }
 
-func osUpdatePolicyCmd() *cobra.Command {
-	var policy string
-	var window string
-	var allowReboot bool
+func testCmd() *cobra.Command {
+	var timeout time.Duration
+	var output string
 
 	cmd := &cobra.Command{
-		Use:   "policy",
-		Short: "Configure update policy",
-		Long: `Configure automatic update policy on Ubuntu hosts.
-
-Policies:
-  security-daily - Apply security updates daily via unattended-upgrades
-  full-weekly    - Apply all updates weekly
-  manual         - Disable automatic updates (NixFleet manages manually)`,
+		Use:   "test",
+		Short: "Smoke test hosts' built closures without deploying anywhere",
+		Long: `Build each targeted host's closure and boot it in a local VM (NixOS)
+or systemd-nspawn container (Ubuntu), then run its configured health
+probes against it. Nothing is copied or activated on the real host - this
+is the same check 'apply --smoke-test' runs before deploying, available
+standalone so it can be run on its own (e.g. in CI) before opening a PR.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			inv, hosts, err := loadInventoryAndHosts(ctx)
 			if err != nil {
 				return err
 			}
 
-			ubuntuHosts := filterUbuntuHosts(hosts)
-			if len(ubuntuHosts) == 0 {
-				fmt.Println("No Ubuntu hosts found")
-				return nil
-			}
-
-			parsedPolicy, err := osupdate.ParsePolicy(policy)
+			flake, err := nix.ResolveFlakePath(flakePath)
 			if err != nil {
 				return err
 			}
 
-			config := osupdate.DefaultPolicyConfig(parsedPolicy)
-			if window != "" {
-				config.MaintenanceWindow = window
-			}
-			config.AllowReboot = allowReboot
-
-			if dryRun {
-				fmt.Printf("Would configure %s policy on %d host(s)\n", policy, len(ubuntuHosts))
-				return nil
+			evaluator, err := newEvaluator(flake)
+			if err != nil {
+				return err
 			}
 
-			pool := ssh.NewPool(nil)
-			defer pool.Close()
-
-			updater := osupdate.NewUpdater()
+			tester := smoketest.NewTester(evaluator)
+			tester.SetTimeout(timeout)
 
-			fmt.Printf("Configuring %s policy on %d host(s)...\n\n", policy, len(ubuntuHosts))
+			results := make([]*smoketest.Result, 0, len(hosts))
+			failed := 0
 
-			for _, host := range ubuntuHosts {
-				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+			for _, host := range hosts {
+				fmt.Printf("Smoke testing %s (%s)...\n", host.Name, host.Base)
+				result, err := tester.Run(ctx, host, inv.ProbesForHost(host))
 				if err != nil {
-					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
+					fmt.Printf("  Error: %v\n", err)
+					failed++
 					continue
 				}
+				results = append(results, result)
 
-				if err := updater.ConfigurePolicy(ctx, client, config); err != nil {
-					fmt.Printf("%s: failed - %v\n", host.Name, err)
+				if result.Method == "skipped" {
+					fmt.Printf("  Skipped: no local sandbox for base %q\n", host.Base)
+					continue
+				}
+				if !result.Passed {
+					fmt.Printf("  FAILED (%s, %s): %s\n", result.Method, result.Duration.Round(time.Second), result.Error)
+					if verbose && result.Log != "" {
+						fmt.Printf("  --- captured log ---\n%s\n  --------------------\n", result.Log)
+					}
+					failed++
 					continue
 				}
+				fmt.Printf("  Passed (%s, %s)\n", result.Method, result.Duration.Round(time.Second))
+			}
 
-				fmt.Printf("%s: OK\n", host.Name)
+			if output == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(results); err != nil {
+					return err
+				}
 			}
 
+			if failed > 0 {
+				return fmt.Errorf("%d/%d host(s) failed smoke test", failed, len(hosts))
+			}
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&policy, "set", "security-daily", "Policy to configure (security-daily, full-weekly, manual)")
-	cmd.Flags().StringVar(&window, "window", "", "Maintenance window (e.g., 'Sun 02:00-06:00')")
-	cmd.Flags().BoolVar(&allowReboot, "allow-reboot", false, "Allow automatic reboot")
+	cmd.Flags().DurationVar(&timeout, "timeout", smoketest.DefaultTimeout, "Max time to spend smoke testing a single host, VM/container boot included")
+	cmd.Flags().StringVar(&output, "output", "text", "Output format: text or json")
 
 	return cmd
 }
 
-func osUpdateHoldCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "hold [packages...]",
-		Short: "Hold packages from being upgraded",
-		Long:  `Mark packages as held so they won't be upgraded.`,
-		Args:  cobra.MinimumNArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
-
-			_, hosts, err := loadInventoryAndHosts(ctx)
-			if err != nil {
-				return err
-			}
-
-			ubuntuHosts := filterUbuntuHosts(hosts)
-			if len(ubuntuHosts) == 0 {
-				fmt.Println("No Ubuntu hosts found")
-				return nil
-			}
-
-			pool := ssh.NewPool(nil)
-			defer pool.Close()
+func rollbackCmd() *cobra.Command {
+	var toGeneration string
+	var profile string
 
-			updater := osupdate.NewUpdater()
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Rollback to a previous generation",
+		Long: `Rollback host configuration to a previous generation.
 
-			fmt.Printf("Holding packages on %d host(s): %v\n\n", len(ubuntuHosts), args)
+By default this rolls back each host's system configuration. Pass --profile
+(e.g. --profile home-manager:ztaylor) to roll back one of the host's
+additional profiles instead - see the 'profiles' inventory field.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 
-			for _, host := range ubuntuHosts {
-				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+			var target nix.ProfileTarget
+			if profile != "" {
+				var err error
+				target, err = nix.ParseProfileTarget(profile)
 				if err != nil {
-					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
-					continue
-				}
-
-				if err := updater.HoldPackages(ctx, client, args); err != nil {
-					fmt.Printf("%s: failed - %v\n", host.Name, err)
-					continue
+					return err
 				}
-
-				fmt.Printf("%s: OK\n", host.Name)
 			}
 
-			return nil
-		},
-	}
-}
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
 
-func osUpdateUnholdCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "unhold [packages...]",
-		Short: "Remove hold from packages",
-		Long:  `Remove hold from packages so they can be upgraded again.`,
-		Args:  cobra.MinimumNArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			flake, err := nix.ResolveFlakePath(flakePath)
 			if err != nil {
 				return err
 			}
 
-			ubuntuHosts := filterUbuntuHosts(hosts)
-			if len(ubuntuHosts) == 0 {
-				fmt.Println("No Ubuntu hosts found")
-				return nil
+			evaluator, err := newEvaluator(flake)
+			if err != nil {
+				return err
 			}
 
-			pool := ssh.NewPool(nil)
-			defer pool.Close()
-
-			updater := osupdate.NewUpdater()
+			deployer := nix.NewDeployer(evaluator)
 
-			fmt.Printf("Removing hold from packages on %d host(s): %v\n\n", len(ubuntuHosts), args)
+			for _, host := range hosts {
+				if profile != "" {
+					fmt.Printf("Rolling back %s on %s...\n", target, host.Name)
+				} else {
+					fmt.Printf("Rolling back %s...\n", host.Name)
+				}
 
-			for _, host := range ubuntuHosts {
 				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 				if err != nil {
-					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
+					fmt.Printf("  Connection failed: %v\n", err)
 					continue
 				}
 
-				if err := updater.UnholdPackages(ctx, client, args); err != nil {
-					fmt.Printf("%s: failed - %v\n", host.Name, err)
+				if profile != "" {
+					if err := deployer.RollbackProfile(ctx, client, target); err != nil {
+						fmt.Printf("  Rollback failed: %v\n", err)
+						continue
+					}
+					fmt.Printf("  Done!\n")
 					continue
 				}
 
-				fmt.Printf("%s: OK\n", host.Name)
+				generation := 0 // 0 means previous
+				if toGeneration != "previous" && toGeneration != "" {
+					fmt.Sscanf(toGeneration, "%d", &generation)
+				}
+
+				if err := deployer.Rollback(ctx, client, host.Base, generation); err != nil {
+					fmt.Printf("  Rollback failed: %v\n", err)
+					continue
+				}
+
+				fmt.Printf("  Done!\n")
 			}
 
 			return nil
 		},
 	}
+
+	cmd.Flags().StringVar(&toGeneration, "to", "previous", "Target generation (previous or generation number)")
+	cmd.Flags().StringVar(&profile, "profile", "", "Roll back a specific profile target instead of the system configuration (e.g. home-manager:ztaylor)")
+
+	return cmd
 }
 
-func osUpdateReleaseUpgradeCmd() *cobra.Command {
-	var (
-		only         string
-		target       string
-		allowEOL     bool
-		nextCodename string
-		stopUnits    []string
-		preHook      string
-		postHook     string
-		noReboot     bool
-		assumeYes    bool
-		checkOnly    bool
-		pollEvery    time.Duration
-		waitTimeout  time.Duration
-		minFreeBoot  int64
-	)
+// eolColumn renders an EOLStatus for the status --all table, in red once a
+// release is within 90 days of (or past) EOL so it doesn't get lost in the
+// rest of the table's plain text.
+func eolColumn(eol *osupdate.EOLStatus) string {
+	var s string
+	switch {
+	case eol.Past:
+		s = fmt.Sprintf("%s PAST", eol.VersionID)
+	case eol.DaysUntilEOL <= 90:
+		s = fmt.Sprintf("%s %dd", eol.VersionID, eol.DaysUntilEOL)
+	default:
+		return fmt.Sprintf("%s %dd", eol.VersionID, eol.DaysUntilEOL)
+	}
+	return "\033[31m" + s + "\033[0m"
+}
+
+// hostStatusJSON is one host's row for `nixfleet status --output json` and
+// the source data for `--output prometheus`. Reachable is false whenever the
+// host couldn't be connected to or its base didn't match, with Error
+// explaining why - unlike the table view, which just prints "?" and moves
+// on, a host must always get a row here so it doesn't look like it was
+// never inventoried at all.
+type hostStatusJSON struct {
+	Host            string    `json:"host"`
+	Base            string    `json:"base"`
+	Addr            string    `json:"addr"`
+	Reachable       bool      `json:"reachable"`
+	Generation      string    `json:"generation,omitempty"`
+	RebootRequired  bool      `json:"rebootRequired,omitempty"`
+	DriftDetected   bool      `json:"driftDetected,omitempty"`
+	DriftFiles      int       `json:"driftFiles,omitempty"`
+	PendingUpdates  int       `json:"pendingUpdates,omitempty"`
+	SecurityUpdates int       `json:"securityUpdates,omitempty"`
+	LastApply       time.Time `json:"lastApply,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+func statusCmd() *cobra.Command {
+	var showAll bool
+	var output string
+	var outputFile string
 
 	cmd := &cobra.Command{
-		Use:   "release-upgrade",
-		Short: "Upgrade Ubuntu hosts to a new distro release (e.g. 26.04 LTS)",
-		Long: `Orchestrate a serial, per-host Ubuntu release upgrade (do-release-upgrade).
+		Use:   "status",
+		Short: "Show host status",
+		Long: `Display current status of managed hosts including generation, health, and pending changes.
 
-For each Ubuntu host, in turn:
-  1. check the available release + free disk
-  2. (unless --check) run pre-hook (stop --stop-units, drain, ...), fully patch
-     the current release, then launch the upgrade DETACHED under a transient
-     systemd unit (survives SSH drops) and stream progress
-  3. reboot and wait for the host to return
-  4. verify the new release and run the post-hook (uncordon, ...)
+Use --all to show extended status including update counts and drift.
 
-EOL releases cannot use do-release-upgrade; pass --allow-eol together with
---next-codename to instead rewrite the apt sources codename and full-upgrade.
-Always serial — one host at a time — to protect shared services.`,
+--output json emits one object per host. --output prometheus emits
+node_exporter textfile-collector gauges (--output-file to write them
+straight to a collector directory instead of stdout).`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			if output != "table" && output != "json" && output != "prometheus" {
+				return fmt.Errorf("invalid --output %q: must be table, json, or prometheus", output)
+			}
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
 			if err != nil {
 				return err
 			}
-			hosts = filterUbuntuHosts(hosts)
-			if only != "" {
-				var sel []*inventory.Host
-				for _, h := range hosts {
-					if h.Name == only {
-						sel = append(sel, h)
-					}
-				}
-				if len(sel) == 0 {
-					return fmt.Errorf("host %q not found among Ubuntu hosts", only)
-				}
-				hosts = sel
-			}
-			if len(hosts) == 0 {
-				fmt.Println("No Ubuntu hosts found")
-				return nil
-			}
 
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
-			updater := osupdate.NewUpdater()
 
-			preHookFull := preHook
-			if len(stopUnits) > 0 {
-				stop := fmt.Sprintf("systemctl stop %s || true", strings.Join(stopUnits, " "))
-				if preHookFull != "" {
-					preHookFull = stop + "; " + preHookFull
+			flake, err := nix.ResolveFlakePath(flakePath)
+			if err != nil {
+				return err
+			}
+
+			evaluator, err := newEvaluator(flake)
+			if err != nil {
+				return err
+			}
+
+			deployer := nix.NewDeployer(evaluator)
+			stateMgr := state.NewManager()
+
+			if output == "table" {
+				if showAll {
+					fmt.Printf("%-18s %-7s %-15s %-6s %-6s %-8s %-6s %-10s %s\n", "HOST", "BASE", "ADDRESS", "REBOOT", "DRIFT", "UPDATES", "STALE", "EOL", "GENERATION")
+					fmt.Printf("%-18s %-7s %-15s %-6s %-6s %-8s %-6s %-10s %s\n", "----", "----", "-------", "------", "-----", "-------", "-----", "---", "----------")
 				} else {
-					preHookFull = stop
+					fmt.Printf("%-20s %-8s %-15s %-10s %s\n", "HOST", "BASE", "ADDRESS", "REBOOT", "CURRENT")
+					fmt.Printf("%-20s %-8s %-15s %-10s %s\n", "----", "----", "-------", "------", "-------")
 				}
 			}
 
-			fmt.Printf("Release-upgrade plan for %d host(s) [serial]:\n\n", len(hosts))
+			var reports []hostStatusJSON
 
 			for _, host := range hosts {
-				fmt.Printf("=== %s (%s) ===\n", host.Name, host.Addr)
 				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 				if err != nil {
-					fmt.Printf("  connection failed: %v\n\n", err)
+					if output == "table" {
+						if showAll {
+							fmt.Printf("%-18s %-7s %-15s %-6s %-6s %-8s %-6s %s\n", host.Name, host.Base, host.Addr, "?", "?", "?", "?", "connection failed")
+						} else {
+							fmt.Printf("%-20s %-8s %-15s %-10s %s\n", host.Name, host.Base, host.Addr, "?", "connection failed")
+						}
+					}
+					reports = append(reports, hostStatusJSON{Host: host.Name, Base: host.Base, Addr: host.Addr, Error: "connection failed: " + err.Error()})
 					continue
 				}
 
-				info, err := updater.CheckReleaseInfo(ctx, client)
-				if err != nil {
-					fmt.Printf("  check failed: %v\n\n", err)
+				if err := stateMgr.CheckBaseMatch(ctx, client, host.Base); err != nil {
+					if output == "table" {
+						if showAll {
+							fmt.Printf("%-18s %-7s %-15s %-6s %-6s %-8s %-6s %s\n", host.Name, host.Base, host.Addr, "?", "?", "?", "?", err)
+						} else {
+							fmt.Printf("%-20s %-8s %-15s %-10s %s\n", host.Name, host.Base, host.Addr, "?", err)
+						}
+					}
+					reports = append(reports, hostStatusJSON{Host: host.Name, Base: host.Base, Addr: host.Addr, Error: err.Error()})
 					continue
 				}
-				eolNote := ""
-				if info.RunningEOL {
-					eolNote = " [running release is EOL]"
+
+				_, current, err := deployer.GetCurrentGeneration(ctx, client, host.Base)
+				if err != nil {
+					current = "unknown"
 				}
-				fmt.Printf("  current: %s (%s)%s  free /: %d MiB  free /boot: %d MiB  target: %q\n",
-					info.CurrentVersion, info.Codename, eolNote, info.FreeRootMB, info.FreeBootMB, info.TargetRelease)
 
-				if checkOnly {
-					fmt.Println()
-					continue
+				reboot, _ := deployer.CheckRebootNeeded(ctx, client, host.Base)
+				rebootStr := "no"
+				if reboot {
+					rebootStr = "YES"
 				}
 
-				// /boot preflight up front — a too-small /boot breaks the prepare
-				// full-upgrade (new kernel initramfs) before we ever reach the
-				// release upgrade. Better to flag it here than half-configure a kernel.
-				cfgBoot := osupdate.DefaultReleaseUpgradeConfig()
-				if minFreeBoot >= 0 {
-					cfgBoot.MinFreeBootMB = minFreeBoot
+				// Read state for extended info
+				hostState, _ := stateMgr.ReadState(ctx, client)
+
+				report := hostStatusJSON{Host: host.Name, Base: host.Base, Addr: host.Addr, Reachable: true, Generation: current, RebootRequired: reboot}
+				if hostState != nil {
+					report.DriftDetected = hostState.DriftDetected
+					report.DriftFiles = len(hostState.DriftFiles)
+					report.PendingUpdates = hostState.PendingUpdates
+					report.SecurityUpdates = hostState.SecurityUpdates
+					report.LastApply = hostState.LastApply
 				}
-				if cfgBoot.MinFreeBootMB > 0 && info.FreeBootMB > 0 && info.FreeBootMB < cfgBoot.MinFreeBootMB {
-					fmt.Printf("  SKIP: only %d MiB free on /boot (need ~%d). Remove old kernels, set initramfs MODULES=dep, or lower --min-free-boot.\n\n",
-						info.FreeBootMB, cfgBoot.MinFreeBootMB)
+				reports = append(reports, report)
+
+				if output != "table" {
 					continue
 				}
 
-				// Decision: a target from do-release-upgrade drives the supported
-				// path (works even from an EOL release). Only a stranded EOL host
-				// (no target) needs the --allow-eol codename-rewrite fallback.
-				if info.TargetRelease == "" {
-					if info.RunningEOL {
-						if !allowEOL || nextCodename == "" {
-							fmt.Printf("  SKIP: EOL with no upgrade target; pass --allow-eol --next-codename <name>\n\n")
-							continue
+				if showAll {
+					driftStr := "-"
+					updatesStr := "-"
+					staleStr := "-"
+					eolStr := "-"
+
+					if hostState != nil {
+						if hostState.DriftDetected {
+							driftStr = fmt.Sprintf("%d", len(hostState.DriftFiles))
+						} else if !hostState.LastDriftCheck.IsZero() {
+							driftStr = "ok"
+						}
+
+						if hostState.PendingUpdates > 0 {
+							if hostState.SecurityUpdates > 0 {
+								updatesStr = fmt.Sprintf("%d(%d!)", hostState.PendingUpdates, hostState.SecurityUpdates)
+							} else {
+								updatesStr = fmt.Sprintf("%d", hostState.PendingUpdates)
+							}
+						} else if !hostState.LastUpdateCheck.IsZero() {
+							updatesStr = "0"
+						}
+
+						if len(hostState.ServicesNeedingRestart) > 0 {
+							staleStr = fmt.Sprintf("%d", len(hostState.ServicesNeedingRestart))
+						}
+
+						if hostState.OSInfo != nil {
+							if eol := osupdate.ComputeEOLStatus(hostState.OSInfo.VersionID, inv.EOLOverrides, time.Now()); eol != nil {
+								eolStr = eolColumn(eol)
+							}
 						}
-					} else {
-						fmt.Printf("  SKIP: already on the latest available release\n\n")
-						continue
 					}
-				}
 
-				// Determine the version we expect to land on, for verification.
-				wantVer := target
-				if wantVer == "" {
-					if m := regexp.MustCompile(`(\d+\.\d+)`).FindStringSubmatch(info.TargetRelease); m != nil {
-						wantVer = m[1]
+					// Truncate store path for display
+					gen := current
+					if len(gen) > 25 {
+						gen = gen[:22] + "..."
 					}
-				}
 
-				if !assumeYes {
-					dest := info.TargetRelease
-					if dest == "" && info.RunningEOL {
-						dest = "codename " + nextCodename + " (EOL sources rewrite)"
-					}
-					fmt.Printf("  Proceed with upgrade of %s → %s? [y/N]: ", host.Name, dest)
-					var resp string
-					fmt.Scanln(&resp)
-					if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(resp)), "y") {
-						fmt.Printf("  skipped by operator\n\n")
-						continue
+					fmt.Printf("%-18s %-7s %-15s %-6s %-6s %-8s %-6s %-10s %s\n", host.Name, host.Base, host.Addr, rebootStr, driftStr, updatesStr, staleStr, eolStr, gen)
+				} else {
+					// Truncate store path for display
+					if len(current) > 40 {
+						current = current[:37] + "..."
 					}
-				}
-
-				cfg := osupdate.DefaultReleaseUpgradeConfig()
-				cfg.AllowEOL = allowEOL
-				cfg.NextCodename = nextCodename
-				cfg.PreHook = preHookFull
-				cfg.PostHook = postHook
-				if minFreeBoot >= 0 {
-					cfg.MinFreeBootMB = minFreeBoot
-				}
 
-				fmt.Printf("  Preparing (set prompt, full-upgrade current release)...\n")
-				if err := updater.PrepareRelease(ctx, client); err != nil {
-					fmt.Printf("  prepare failed: %v\n\n", err)
-					continue
+					fmt.Printf("%-20s %-8s %-15s %-10s %s\n", host.Name, host.Base, host.Addr, rebootStr, current)
 				}
 
-				// do-release-upgrade refuses to run while a reboot is pending
-				// ("you have not rebooted after updating a package which requires
-				// a reboot"). The prepare full-upgrade can install a new kernel, so
-				// reboot into it first, then proceed. Also covers each hop of an
-				// EOL two-hop upgrade.
-				if rr, _ := updater.IsRebootRequired(ctx, client); rr {
-					fmt.Printf("  Reboot required after prepare (new kernel) — rebooting first...\n")
-					preRO := reboot.NewOrchestrator(func() reboot.RebootConfig {
-						c := reboot.DefaultRebootConfig()
-						c.AllowReboot = true
-						if waitTimeout > 0 {
-							c.WaitTimeout = waitTimeout
+				// Verbose output
+				if verbose && hostState != nil {
+					fmt.Printf("  Last Apply: %s (gen %d)\n", hostState.LastApply.Format(time.RFC3339), hostState.CurrentGeneration)
+					if hostState.ApplyDuration != "" {
+						fmt.Printf("  Apply Duration: %s\n", hostState.ApplyDuration)
+					}
+					if len(hostState.ServiceHealth) > 0 {
+						healthy := 0
+						for _, s := range hostState.ServiceHealth {
+							if s.Active {
+								healthy++
+							}
 						}
-						return c
-					}())
-					if err := preRO.ExecuteReboot(ctx, client, pool, host.Addr, host.SSHPort, host.SSHUser); err != nil {
-						fmt.Printf("  pre-upgrade reboot failed: %v\n\n", err)
-						continue
+						fmt.Printf("  Services: %d/%d healthy\n", healthy, len(hostState.ServiceHealth))
 					}
-					client, err = pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
-					if err != nil {
-						fmt.Printf("  reconnect after pre-upgrade reboot failed: %v\n\n", err)
-						continue
+					if hostState.DriftDetected {
+						fmt.Printf("  Drift: %d file(s)\n", len(hostState.DriftFiles))
 					}
-				}
-
-				fmt.Printf("  Launching detached release upgrade...\n")
-				if err := updater.StartReleaseUpgrade(ctx, client, info, cfg); err != nil {
-					fmt.Printf("  launch failed: %v\n\n", err)
-					continue
-				}
-
-				exit, err := updater.WaitForReleaseUpgrade(ctx, client, cfg, pollEvery, func(tail string) {
-					last := tail
-					if i := strings.LastIndex(tail, "\n"); i >= 0 {
-						last = tail[i+1:]
+					if len(hostState.ServicesNeedingRestart) > 0 {
+						fmt.Printf("  %d service(s) stale: %s\n", len(hostState.ServicesNeedingRestart), strings.Join(hostState.ServicesNeedingRestart, ", "))
 					}
-					fmt.Printf("    … %s\n", last)
-				})
-				if err != nil {
-					fmt.Printf("  upgrade wait failed: %v (check %s on host)\n\n", err, cfg.LogPath)
-					continue
-				}
-				if exit != 0 {
-					fmt.Printf("  UPGRADE FAILED (exit %d) — host NOT rebooted. Inspect %s\n\n", exit, cfg.LogPath)
-					continue
-				}
-				fmt.Printf("  Upgrade process completed.\n")
-
-				if noReboot {
-					fmt.Printf("  --no-reboot set; reboot %s manually then verify.\n\n", host.Name)
-					continue
-				}
-
-				fmt.Printf("  Rebooting and waiting for host...\n")
-				rebootOrch := reboot.NewOrchestrator(func() reboot.RebootConfig {
-					c := reboot.DefaultRebootConfig()
-					c.AllowReboot = true
-					if waitTimeout > 0 {
-						c.WaitTimeout = waitTimeout
+					if len(hostState.Annotations) > 0 {
+						fmt.Printf("  Annotations:\n")
+						for key, ann := range hostState.Annotations {
+							fmt.Printf("    %s: %s (set %s)\n", key, ann.Value, ann.SetAt.Format("2006-01-02"))
+						}
 					}
-					return c
-				}())
-				if err := rebootOrch.ExecuteReboot(ctx, client, pool, host.Addr, host.SSHPort, host.SSHUser); err != nil {
-					fmt.Printf("  reboot/wait failed: %v\n\n", err)
-					continue
-				}
-
-				client, err = pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
-				if err != nil {
-					fmt.Printf("  reconnect after reboot failed: %v\n\n", err)
-					continue
-				}
-				ok, got, _ := updater.VerifyRelease(ctx, client, wantVer)
-				if ok {
-					fmt.Printf("  VERIFIED: now on %s\n", got)
-				} else {
-					fmt.Printf("  WARNING: expected %s, host reports %s\n", wantVer, got)
+					if len(hostState.Profiles) > 0 {
+						targets := make([]string, 0, len(hostState.Profiles))
+						for target := range hostState.Profiles {
+							targets = append(targets, target)
+						}
+						sort.Strings(targets)
+						fmt.Printf("  Profiles:\n")
+						for _, target := range targets {
+							ps := hostState.Profiles[target]
+							fmt.Printf("    %s: gen %d (%s)\n", target, ps.CurrentGeneration, ps.LastApply.Format(time.RFC3339))
+						}
+					}
+					fmt.Println()
 				}
+			}
 
-				if postHook != "" {
-					if _, err := client.ExecSudo(ctx, postHook); err != nil {
-						fmt.Printf("  post-hook warning: %v\n", err)
-					}
+			switch output {
+			case "json":
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(reports)
+			case "prometheus":
+				text := renderPrometheusStatus(reports)
+				if outputFile == "" {
+					fmt.Print(text)
+					return nil
 				}
-				fmt.Printf("  %s done.\n\n", host.Name)
+				return os.WriteFile(outputFile, []byte(text), 0o644)
 			}
 
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&only, "only", "", "Upgrade just this host (by inventory name)")
-	cmd.Flags().StringVar(&target, "target", "", "Expected resulting version for verification (e.g. 26.04); auto-detected if empty")
-	cmd.Flags().BoolVar(&allowEOL, "allow-eol", false, "Allow upgrading an EOL release via apt sources codename rewrite")
-	cmd.Flags().StringVar(&nextCodename, "next-codename", "", "Next release codename for the EOL path (e.g. questing)")
-	cmd.Flags().StringSliceVar(&stopUnits, "stop-units", nil, "Systemd units to stop before upgrading (e.g. llama-rocm-foo.service)")
-	cmd.Flags().StringVar(&preHook, "pre-hook", "", "Extra sudo command to run before the upgrade (e.g. k0s drain)")
-	cmd.Flags().StringVar(&postHook, "post-hook", "", "Sudo command to run after verify (e.g. k0s uncordon)")
-	cmd.Flags().BoolVar(&noReboot, "no-reboot", false, "Do not reboot after the upgrade completes")
-	cmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Do not prompt for per-host confirmation")
-	cmd.Flags().BoolVar(&checkOnly, "check", false, "Only report current/target release per host; make no changes")
-	cmd.Flags().DurationVar(&pollEvery, "poll", 30*time.Second, "How often to poll the detached upgrade for progress")
-	cmd.Flags().DurationVar(&waitTimeout, "wait-timeout", 30*time.Minute, "How long to wait for a host to return after reboot")
-	cmd.Flags().Int64Var(&minFreeBoot, "min-free-boot", -1, "Override required free /boot MiB (-1 = default 350; lower for MODULES=dep nodes)")
+	cmd.Flags().BoolVarP(&showAll, "all", "a", false, "Show extended status (updates, drift)")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table, json, or prometheus")
+	cmd.Flags().StringVar(&outputFile, "output-file", "", "Write --output prometheus text to this file instead of stdout (for a node_exporter textfile collector)")
 
 	return cmd
 }
 
-func nixCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "nix",
-		Short: "Manage the Nix flake inputs (nixpkgs) for the fleet",
-		Long:  `Update and deploy the Nix package set the fleet is built from.`,
+// renderPrometheusStatus formats status reports as node_exporter
+// textfile-collector gauges: one metric family per field, one line per host
+// labeled by host name. An unreachable host still gets a
+// nixfleet_host_reachable{...} 0 line rather than being dropped from the
+// output - the other gauges are meaningless for it, so those are skipped.
+func renderPrometheusStatus(reports []hostStatusJSON) string {
+	var b strings.Builder
+
+	fmt.Fprintln(&b, "# HELP nixfleet_host_reachable Whether nixfleet could reach and validate the host.")
+	fmt.Fprintln(&b, "# TYPE nixfleet_host_reachable gauge")
+	for _, r := range reports {
+		fmt.Fprintf(&b, "nixfleet_host_reachable{host=%q} %d\n", r.Host, boolToGauge(r.Reachable))
 	}
-	cmd.AddCommand(nixUpdateCmd())
-	return cmd
+
+	metrics := []struct {
+		name string
+		help string
+		val  func(hostStatusJSON) int
+	}{
+		{"nixfleet_host_reboot_required", "Whether the host has a pending reboot.", func(r hostStatusJSON) int { return boolToGauge(r.RebootRequired) }},
+		{"nixfleet_host_drift_detected", "Whether configuration drift was detected on the host.", func(r hostStatusJSON) int { return boolToGauge(r.DriftDetected) }},
+		{"nixfleet_host_drift_files", "Number of files with detected drift on the host.", func(r hostStatusJSON) int { return r.DriftFiles }},
+		{"nixfleet_host_pending_updates", "Number of pending package updates on the host.", func(r hostStatusJSON) int { return r.PendingUpdates }},
+		{"nixfleet_host_security_updates", "Number of pending security package updates on the host.", func(r hostStatusJSON) int { return r.SecurityUpdates }},
+	}
+
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", m.name)
+		for _, r := range reports {
+			if !r.Reachable {
+				continue
+			}
+			fmt.Fprintf(&b, "%s{host=%q} %d\n", m.name, r.Host, m.val(r))
+		}
+	}
+
+	return b.String()
 }
 
-func nixUpdateCmd() *cobra.Command {
+func boolToGauge(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func exportCmd() *cobra.Command {
 	var (
-		doApply    bool
-		skipVerify bool
-		skipState  bool
-		inputs     []string
+		format string
+		fields []string
+		output string
+		pkiDir string
 	)
 
 	cmd := &cobra.Command{
-		Use:   "update",
-		Short: "Update flake.lock (nixpkgs) and optionally deploy",
-		Long: `Run 'nix flake update' to refresh flake.lock, verify every host still
-evaluates with the new package set, and optionally build + deploy the result.
+		Use:   "export",
+		Short: "Export fleet inventory and state as a CMDB feed",
+		Long: `Export one row per host, merging inventory data, the latest cached
+host state, and PKI certificate info (days left on the host cert), for
+feeding into an asset-management/CMDB system.
 
-By default only the 'nixpkgs' input is updated. Pass --input to target others
-(repeatable), or --input "" semantics are not supported — omit the flag to keep
-the default. Use --apply to roll the new closures out to all inventory hosts.`,
+The column set is stable and documented (see --fields); by default all
+columns are included in a fixed order. Hosts that are unreachable still
+appear with their inventory data and blank state columns rather than
+being dropped.
+
+This mirrors the server's GET /api/export endpoint.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			flake, err := nix.ResolveFlakePath(flakePath)
-			if err != nil {
-				return err
+			if format != "csv" && format != "json" {
+				return fmt.Errorf("--format must be csv or json")
 			}
-			evaluator, err := nix.NewEvaluator(flake)
-			if err != nil {
+
+			cols := export.Columns
+			if len(fields) > 0 {
+				cols = fields
+			}
+			if err := export.ValidateFields(cols); err != nil {
 				return err
 			}
 
-			fmt.Printf("Updating flake inputs: %s\n", strings.Join(inputs, ", "))
-			out, err := evaluator.FlakeUpdate(ctx, inputs...)
-			if out != "" {
-				fmt.Println(strings.TrimRight(out, "\n"))
-			}
+			inv, hosts, err := loadInventoryAndHosts(ctx)
 			if err != nil {
 				return err
 			}
 
-			if !strings.Contains(out, "Updated input") {
-				fmt.Println("\nflake.lock already up to date — nothing to do.")
-				return nil
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			var pkiStore *pki.Store
+			if pkiDir != "" {
+				pkiStore = pki.NewStore(pkiDir, nil, nil)
+				if !pkiStore.CAExists() {
+					pkiStore = nil
+				}
 			}
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
-			if err != nil {
-				return err
+			gatherer := export.NewGatherer(pool, state.NewManager(), pkiStore, inv.EOLOverrides)
+			rowFn := func(h *inventory.Host) export.Row { return gatherer.Row(ctx, h) }
+
+			w := os.Stdout
+			if output != "" {
+				f, err := os.Create(output)
+				if err != nil {
+					return fmt.Errorf("creating output file: %w", err)
+				}
+				defer f.Close()
+				w = f
 			}
 
-			// Verify every host still evaluates before we consider deploying.
-			if !skipVerify {
-				fmt.Printf("\nVerifying %d host(s) still evaluate...\n", len(hosts))
-				var broken []string
-				for _, host := range hosts {
-					if _, err := evaluator.EvalHost(ctx, host.Name, host.Base); err != nil {
-						fmt.Printf("  %s: EVAL FAILED - %v\n", host.Name, err)
-						broken = append(broken, host.Name)
-					} else if verbose {
-						fmt.Printf("  %s: ok\n", host.Name)
-					}
+			switch format {
+			case "csv":
+				if err := export.WriteCSV(w, hosts, cols, rowFn); err != nil {
+					return fmt.Errorf("writing csv: %w", err)
 				}
-				if len(broken) > 0 {
-					return fmt.Errorf("%d host(s) fail to evaluate with updated nixpkgs: %s (flake.lock left updated; fix or `git checkout flake.lock`)", len(broken), strings.Join(broken, ", "))
+			case "json":
+				if err := export.WriteJSON(w, hosts, cols, rowFn); err != nil {
+					return fmt.Errorf("writing json: %w", err)
 				}
-				fmt.Printf("All %d host(s) evaluate cleanly.\n", len(hosts))
 			}
 
-			if !doApply {
-				fmt.Println("\nflake.lock updated. Run `nixfleet apply` (or re-run with --apply) to deploy.")
-				return nil
+			if output != "" {
+				fmt.Fprintf(os.Stderr, "Exported %d hosts to %s\n", len(hosts), output)
 			}
 
-			// Deploy: build + copy + activate each host. This intentionally does
-			// not run preflight/PKI (see `nixfleet apply` for the full pipeline);
-			// a package-set bump only needs the closure rolled out.
-			deployer := nix.NewDeployer(evaluator)
-			pool := ssh.NewPool(nil)
-			defer pool.Close()
-			stateMgr := state.NewManager()
+			return nil
+		},
+	}
 
-			fmt.Printf("\nDeploying updated closures to %d host(s)...\n\n", len(hosts))
-			success, failed := 0, 0
-			for _, host := range hosts {
-				fmt.Printf("Deploying to %s...\n", host.Name)
-				startTime := time.Now()
-
-				closure, err := evaluator.BuildHost(ctx, host.Name, host.Base)
-				if err != nil {
-					fmt.Printf("  Build failed: %v\n", err)
-					failed++
-					continue
-				}
-				if err := deployer.CopyToHost(ctx, closure, host); err != nil {
-					fmt.Printf("  Copy failed: %v\n", err)
-					failed++
-					continue
-				}
-				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
-				if err != nil {
-					fmt.Printf("  Connection failed: %v\n", err)
-					failed++
-					continue
-				}
-				switch host.Base {
-				case "ubuntu":
-					err = deployer.ActivateUbuntu(ctx, client, closure)
-				case "nixos":
-					err = deployer.ActivateNixOS(ctx, client, closure, "switch")
-				}
-				if err != nil {
-					fmt.Printf("  Activation failed: %v\n", err)
-					failed++
-					continue
-				}
-				if !skipState {
-					gen, _, _ := deployer.GetCurrentGeneration(ctx, client, host.Base)
-					if err := stateMgr.UpdateAfterApply(ctx, client, closure.StorePath, closure.ManifestHash, gen, time.Since(startTime)); err != nil {
-						fmt.Printf("  Warning: failed to update state - %v\n", err)
-					}
-				}
-				fmt.Printf("  Done! (%s)\n\n", time.Since(startTime).Round(time.Second))
-				success++
-			}
-			fmt.Printf("Summary: %d succeeded, %d failed\n", success, failed)
-			if failed > 0 {
-				return fmt.Errorf("%d host(s) failed to deploy", failed)
-			}
-			return nil
-		},
-	}
-
-	cmd.Flags().BoolVar(&doApply, "apply", false, "Build and deploy updated closures to all hosts after updating")
-	cmd.Flags().BoolVar(&skipVerify, "skip-verify", false, "Skip re-evaluating all hosts after the lock update")
-	cmd.Flags().BoolVar(&skipState, "skip-state", false, "Skip updating host state after deploy (with --apply)")
-	cmd.Flags().StringSliceVar(&inputs, "input", []string{"nixpkgs"}, "Flake inputs to update (repeatable)")
+	cmd.Flags().StringVar(&format, "format", "csv", "Output format: csv or json")
+	cmd.Flags().StringSliceVar(&fields, "fields", nil, "Columns to include, in order (default: all columns)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file (prints to stdout if not specified)")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files (used for cert_days_left; skipped if no CA is initialized)")
 
 	return cmd
 }
 
-func rebootCmd() *cobra.Command {
+func osUpdateCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "reboot",
-		Short: "Manage host reboots",
-		Long: `Manage host reboots with configurable windows and hooks.
+		Use:   "os-update",
+		Short: "Manage OS updates on Ubuntu hosts",
+		Long: `Manage OS updates on Ubuntu hosts with configurable policies and rollout strategies.
 
 Subcommands:
-  status  - Check reboot requirements
-  now     - Reboot hosts immediately
-  schedule - Schedule reboots in maintenance window`,
+  check      - Check for pending updates
+  apply      - Apply updates
+  policy     - Configure update policy
+  hold       - Hold packages from upgrades
+  unhold     - Remove package holds
+  eol-report - Report hosts by release EOL date, exit nonzero if any are past EOL`,
 	}
 
-	cmd.AddCommand(rebootStatusCmd())
-	cmd.AddCommand(rebootNowCmd())
+	cmd.AddCommand(osUpdateCheckCmd())
+	cmd.AddCommand(osUpdateApplyCmd())
+	cmd.AddCommand(osUpdatePolicyCmd())
+	cmd.AddCommand(osUpdateHoldCmd())
+	cmd.AddCommand(osUpdateUnholdCmd())
+	cmd.AddCommand(osUpdateReleaseUpgradeCmd())
+	cmd.AddCommand(osUpdateEOLReportCmd())
 
 	return cmd
 }
 
-func rebootStatusCmd() *cobra.Command {
+// osUpdateEOLReportCmd lists hosts grouped by Ubuntu release with their EOL
+// dates, for gating CI on a fleet that's drifted onto an unsupported
+// release. It reads each host's cached OSInfo (from the last `os-info` or
+// `status` gather) rather than connecting over SSH itself, since the point
+// is a fast report, not a fresh collection.
+func osUpdateEOLReportCmd() *cobra.Command {
 	return &cobra.Command{
-		Use:   "status",
-		Short: "Check reboot requirements",
-		Long:  `Check if hosts require a reboot.`,
+		Use:   "eol-report",
+		Short: "Report hosts by Ubuntu release EOL date, exiting nonzero if any are past EOL",
+		Long: `List hosts grouped by Ubuntu release, each with its end-of-life date and
+days remaining (or "PAST" once support has ended), computed from each
+host's cached OS info plus the built-in EOL table (see eol_overrides in
+the inventory to track a release nixfleet doesn't know about yet).
+
+Exits nonzero if any host is past EOL, so it can gate CI.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			inv, hosts, err := loadInventoryAndHosts(ctx)
 			if err != nil {
 				return err
 			}
 
+			ubuntuHosts := filterUbuntuHosts(hosts)
+			if len(ubuntuHosts) == 0 {
+				fmt.Println("No Ubuntu hosts found")
+				return nil
+			}
+
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
-			orchestrator := reboot.NewOrchestrator(reboot.DefaultRebootConfig())
-
-			fmt.Printf("Checking reboot status on %d host(s)...\n\n", len(hosts))
-			fmt.Printf("%-20s %-10s %-15s %s\n", "HOST", "BASE", "REBOOT", "REASON")
-			fmt.Printf("%-20s %-10s %-15s %s\n", "----", "----", "------", "------")
+			stateMgr := state.NewManager()
+			byRelease := make(map[string][]string)
+			eolByRelease := make(map[string]*osupdate.EOLStatus)
+			var unknown []string
+			pastEOL := false
 
-			for _, host := range hosts {
+			for _, host := range ubuntuHosts {
 				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 				if err != nil {
-					fmt.Printf("%-20s %-10s %-15s %s\n", host.Name, host.Base, "error", err.Error())
+					unknown = append(unknown, fmt.Sprintf("%s (connection failed)", host.Name))
 					continue
 				}
 
-				status, err := orchestrator.CheckRebootRequired(ctx, client, host.Base)
-				if err != nil {
-					fmt.Printf("%-20s %-10s %-15s %s\n", host.Name, host.Base, "error", err.Error())
+				hostState, err := stateMgr.ReadState(ctx, client)
+				if err != nil || hostState.OSInfo == nil {
+					unknown = append(unknown, fmt.Sprintf("%s (no cached OS info; run `nixfleet status` or the os-info API first)", host.Name))
 					continue
 				}
 
-				rebootStr := "no"
-				reason := ""
-				if status.Required {
-					rebootStr = "YES"
-					reason = status.Reason
-					if len(status.TriggerPackages) > 0 {
-						reason += fmt.Sprintf(" (%s)", strings.Join(status.TriggerPackages, ", "))
-					}
+				eol := osupdate.ComputeEOLStatus(hostState.OSInfo.VersionID, inv.EOLOverrides, time.Now())
+				if eol == nil {
+					unknown = append(unknown, fmt.Sprintf("%s (%s not in EOL table)", host.Name, hostState.OSInfo.VersionID))
+					continue
 				}
 
-				fmt.Printf("%-20s %-10s %-15s %s\n", host.Name, host.Base, rebootStr, reason)
+				byRelease[eol.VersionID] = append(byRelease[eol.VersionID], host.Name)
+				eolByRelease[eol.VersionID] = eol
+				if eol.Past {
+					pastEOL = true
+				}
 			}
 
+			releases := make([]string, 0, len(byRelease))
+			for release := range byRelease {
+				releases = append(releases, release)
+			}
+			sort.Strings(releases)
+
+			for _, release := range releases {
+				eol := eolByRelease[release]
+				status := fmt.Sprintf("%d day(s) remaining", eol.DaysUntilEOL)
+				if eol.Past {
+					status = fmt.Sprintf("PAST EOL by %d day(s)", -eol.DaysUntilEOL)
+				}
+				fmt.Printf("%s (EOL %s, %s):\n", release, eol.EOLDate.Format("2006-01-02"), status)
+				for _, name := range byRelease[release] {
+					fmt.Printf("  - %s\n", name)
+				}
+			}
+
+			if len(unknown) > 0 {
+				fmt.Println("Unknown:")
+				for _, name := range unknown {
+					fmt.Printf("  - %s\n", name)
+				}
+			}
+
+			if pastEOL {
+				return fmt.Errorf("one or more hosts are past their release's end-of-life")
+			}
 			return nil
 		},
 	}
 }
 
-func rebootNowCmd() *cobra.Command {
-	var window string
-	var preHook, postHook string
-	var maxConcurrent int
-	var waitTimeout time.Duration
-	var force bool
-
-	cmd := &cobra.Command{
-		Use:   "now",
-		Short: "Reboot hosts immediately",
-		Long: `Reboot hosts that require a reboot.
+func filterUbuntuHosts(hosts []*inventory.Host) []*inventory.Host {
+	var ubuntuHosts []*inventory.Host
+	for _, h := range hosts {
+		if h.Base == "ubuntu" {
+			ubuntuHosts = append(ubuntuHosts, h)
+		}
+	}
+	return ubuntuHosts
+}
 
-Only reboots hosts that have the reboot-required flag set, unless --force is used.`,
+func osUpdateCheckCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "check",
+		Short: "Check for pending updates",
+		Long:  `Check for available OS updates on Ubuntu hosts.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			inv, hosts, err := loadInventoryAndHosts(ctx)
 			if err != nil {
 				return err
 			}
 
+			ubuntuHosts := filterUbuntuHosts(hosts)
+			if len(ubuntuHosts) == 0 {
+				fmt.Println("No Ubuntu hosts found")
+				return nil
+			}
+
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
-			// Parse reboot window if specified
-			var rebootWindow *reboot.RebootWindow
-			if window != "" {
-				rebootWindow, err = reboot.ParseRebootWindow(window)
-				if err != nil {
-					return err
-				}
-			}
-
-			config := reboot.RebootConfig{
-				AllowReboot:          true,
-				Window:               rebootWindow,
-				MaxConcurrentReboots: maxConcurrent,
-				PreRebootHook:        preHook,
-				PostRebootHook:       postHook,
-				WaitTimeout:          waitTimeout,
-				WaitInterval:         10 * time.Second,
-			}
+			updater := osupdate.NewUpdater()
 
-			orchestrator := reboot.NewOrchestrator(config)
-			limiter := reboot.NewConcurrencyLimiter(maxConcurrent)
+			fmt.Printf("Checking updates on %d host(s)...\n\n", len(ubuntuHosts))
 
-			// First check which hosts need reboot
-			var hostsToReboot []*inventory.Host
-			for _, host := range hosts {
+			for _, host := range ubuntuHosts {
 				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 				if err != nil {
 					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
 					continue
 				}
 
-				status, err := orchestrator.CheckRebootRequired(ctx, client, host.Base)
+				pending, err := updater.CheckPendingUpdates(ctx, client)
 				if err != nil {
 					fmt.Printf("%s: check failed - %v\n", host.Name, err)
 					continue
 				}
 
-				if status.Required || force {
-					hostsToReboot = append(hostsToReboot, host)
+				reboot, _ := updater.IsRebootRequired(ctx, client)
+
+				fmt.Printf("%s:\n", host.Name)
+				fmt.Printf("  Security updates: %d\n", len(pending.SecurityUpdates))
+				fmt.Printf("  Regular updates:  %d\n", len(pending.RegularUpdates))
+				fmt.Printf("  Total pending:    %d\n", pending.TotalCount)
+				if reboot {
+					fmt.Printf("  Reboot required:  YES\n")
+				}
+
+				if verbose && pending.TotalCount > 0 {
+					fmt.Println("  Packages:")
+					for _, pkg := range pending.SecurityUpdates {
+						fmt.Printf("    [SECURITY] %s: %s -> %s\n", pkg.Name, pkg.CurrentVersion, pkg.NewVersion)
+					}
+					for _, pkg := range pending.RegularUpdates {
+						fmt.Printf("    %s: %s -> %s\n", pkg.Name, pkg.CurrentVersion, pkg.NewVersion)
+					}
 				}
+				fmt.Println()
 			}
 
-			if len(hostsToReboot) == 0 {
-				fmt.Println("No hosts require reboot")
+			return nil
+		},
+	}
+}
+
+func osUpdateApplyCmd() *cobra.Command {
+	var securityOnly, allowReboot, distUpgrade bool
+	var strategy string
+	var canaryPercent int
+	var rebootDelay time.Duration
+	var installNeedrestart, restartServices bool
+	var conffile string
+
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Apply OS updates",
+		Long: `Apply OS updates to Ubuntu hosts.
+
+Strategies:
+  serial   - Update hosts one at a time (default)
+  parallel - Update all hosts simultaneously
+  canary   - Update a percentage first, then the rest
+
+After updating, checks for services still running against replaced
+libraries (via needrestart, falling back to a /proc/*/maps heuristic).
+By default these are just recorded in host state; pass --restart-services
+to restart them (skipping anything in the host's os_updates.restart_exclude).
+A changed kernel still requires a full --reboot; stale services alone do not.
+
+--conffile decides what happens when a package wants to replace a config
+file that was modified locally (a dpkg conffile prompt), since there's no
+TTY to answer it during an unattended run:
+  keep     - keep the locally modified file (default)
+  new      - install the package maintainer's version
+  ask-fail - fail fast and name the file instead of deciding either way`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			conffilePolicy, err := osupdate.ParseConffilePolicy(conffile)
+			if err != nil {
+				return err
+			}
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			ubuntuHosts := filterUbuntuHosts(hosts)
+			if len(ubuntuHosts) == 0 {
+				fmt.Println("No Ubuntu hosts found")
 				return nil
 			}
 
 			if dryRun {
-				fmt.Printf("Would reboot %d host(s):\n", len(hostsToReboot))
-				for _, h := range hostsToReboot {
+				fmt.Printf("Would apply updates to %d host(s):\n", len(ubuntuHosts))
+				for _, h := range ubuntuHosts {
 					fmt.Printf("  - %s (%s)\n", h.Name, h.Addr)
 				}
 				return nil
 			}
 
-			fmt.Printf("Rebooting %d host(s) (max %d concurrent)...\n\n", len(hostsToReboot), maxConcurrent)
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
 
-			success := 0
-			failed := 0
+			updater := osupdate.NewUpdater()
+			stateMgr := state.NewManager()
 
-			for _, host := range hostsToReboot {
-				if err := limiter.Acquire(ctx); err != nil {
-					return err
-				}
+			// Handle different strategies
+			hostsToUpdate := rollout.Batches(ubuntuHosts, strategy, canaryPercent)
+			if strategy == "canary" && len(hostsToUpdate) > 1 {
+				fmt.Printf("Canary rollout: %d canary host(s), then %d remaining\n\n", len(hostsToUpdate[0]), len(hostsToUpdate[1]))
+			}
 
-				fmt.Printf("Rebooting %s...\n", host.Name)
+			totalUpdated := 0
+			totalFailed := 0
 
-				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
-				if err != nil {
-					fmt.Printf("  Connection failed: %v\n", err)
-					failed++
-					limiter.Release()
-					continue
+			for batchIdx, batch := range hostsToUpdate {
+				if strategy == "canary" && batchIdx > 0 {
+					fmt.Println("\nCanary batch completed successfully. Proceeding with remaining hosts...")
 				}
 
-				port := host.SSHPort
-				if port == 0 {
-					port = 22
-				}
+				for _, host := range batch {
+					fmt.Printf("Updating %s...\n", host.Name)
 
-				if err := orchestrator.ExecuteReboot(ctx, client, pool, host.Addr, port, host.SSHUser); err != nil {
-					fmt.Printf("  Reboot failed: %v\n", err)
-					failed++
-					limiter.Release()
-					continue
-				}
-
-				// Run post-reboot hook if host came back
-				client, err = pool.GetWithUser(ctx, host.Addr, port, host.SSHUser)
-				if err == nil {
-					if err := orchestrator.RunPostRebootHook(ctx, client); err != nil {
-						fmt.Printf("  Post-reboot hook failed: %v\n", err)
+					client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+					if err != nil {
+						fmt.Printf("  Connection failed: %v\n", err)
+						totalFailed++
+						continue
 					}
-				}
 
-				fmt.Printf("  OK (host is back)\n")
-				success++
-				limiter.Release()
-			}
+					var result *osupdate.UpdateResult
+					if securityOnly {
+						result, err = updater.ApplySecurityUpdates(ctx, client, conffilePolicy)
+					} else if distUpgrade {
+						result, err = updater.ApplyDistUpgrade(ctx, client, conffilePolicy)
+					} else {
+						result, err = updater.ApplyAllUpdates(ctx, client, conffilePolicy)
+					}
 
-			fmt.Printf("\nSummary: %d rebooted, %d failed\n", success, failed)
-			return nil
-		},
-	}
+					if err != nil {
+						fmt.Printf("  Update failed: %v\n", err)
+						totalFailed++
+						continue
+					}
 
-	cmd.Flags().StringVar(&window, "window", "", "Reboot window (e.g., 'Sun 02:00-04:00')")
-	cmd.Flags().StringVar(&preHook, "pre-hook", "", "Command to run before reboot")
-	cmd.Flags().StringVar(&postHook, "post-hook", "", "Command to run after reboot")
-	cmd.Flags().IntVar(&maxConcurrent, "max-concurrent", 1, "Maximum concurrent reboots")
-	cmd.Flags().DurationVar(&waitTimeout, "wait-timeout", 10*time.Minute, "Timeout waiting for host to come back")
-	cmd.Flags().BoolVar(&force, "force", false, "Reboot even if not required")
+					var keptConffiles []string
+					for _, d := range result.ConffileDecisions {
+						if verbose {
+							fmt.Printf("  conffile %s: %s\n", d.Path, d.Decision)
+						}
+						if d.Decision == "kept" {
+							keptConffiles = append(keptConffiles, d.Path)
+						}
+					}
+					if len(keptConffiles) > 0 {
+						if err := stateMgr.RecordConffileDrift(ctx, client, keptConffiles); err != nil && verbose {
+							fmt.Printf("  Warning: failed to record conffile drift: %v\n", err)
+						}
+					}
 
-	return cmd
-}
+					if !result.Success {
+						fmt.Printf("  Update failed: %s\n", result.Stderr)
+						totalFailed++
+						continue
+					}
 
-func runCmd() *cobra.Command {
-	var timeout time.Duration
+					fmt.Printf("  Updated %d package(s)\n", len(result.PackagesUpdated))
+					if verbose && len(result.PackagesUpdated) > 0 {
+						for _, pkg := range result.PackagesUpdated {
+							if pkg.OldVersion != "" {
+								fmt.Printf("    %s: %s -> %s\n", pkg.Name, pkg.OldVersion, pkg.NewVersion)
+							} else {
+								fmt.Printf("    %s\n", pkg.Name)
+							}
+						}
+					}
 
-	cmd := &cobra.Command{
-		Use:   "run [command]",
-		Short: "Run ad-hoc commands on hosts",
-		Long:  `Execute commands on target hosts.`,
-		Args:  cobra.MinimumNArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
+					restartStatus, rsErr := updater.CheckServicesNeedingRestart(ctx, client, installNeedrestart)
+					if rsErr != nil && verbose {
+						fmt.Printf("  Warning: could not check for stale services: %v\n", rsErr)
+					}
 
-			if timeout > 0 {
-				var cancel context.CancelFunc
-				ctx, cancel = context.WithTimeout(ctx, timeout)
-				defer cancel()
-			}
+					// A changed kernel can only be fixed by rebooting; stale
+					// userspace services can be fixed by restarting them
+					// without a reboot, so only fold them into RebootRequired
+					// when the kernel itself is the reason.
+					if restartStatus != nil && restartStatus.KernelChanged {
+						result.RebootRequired = true
+					}
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
-			if err != nil {
-				return err
-			}
+					if result.RebootRequired {
+						fmt.Printf("  Reboot required\n")
+						if allowReboot {
+							if rebootDelay > 0 {
+								fmt.Printf("  Scheduling reboot in %v...\n", rebootDelay)
+								if err := updater.ScheduleReboot(ctx, client, rebootDelay); err != nil {
+									fmt.Printf("  Failed to schedule reboot: %v\n", err)
+								}
+							} else {
+								fmt.Printf("  Rebooting immediately...\n")
+								if err := updater.ScheduleReboot(ctx, client, 1*time.Minute); err != nil {
+									fmt.Printf("  Failed to schedule reboot: %v\n", err)
+								}
+							}
+						}
+					} else if restartStatus != nil && len(restartStatus.Services) > 0 {
+						fmt.Printf("  %d service(s) need restarting (%s)\n", len(restartStatus.Services), strings.Join(restartStatus.Services, ", "))
+						if restartServices {
+							restarted, skipped, err := updater.RestartServices(ctx, client, restartStatus.Services, host.OSUpdate.RestartExclude)
+							if err != nil {
+								fmt.Printf("  Failed to restart services: %v\n", err)
+							}
+							if len(restarted) > 0 {
+								fmt.Printf("  Restarted: %s\n", strings.Join(restarted, ", "))
+							}
+							if len(skipped) > 0 {
+								fmt.Printf("  Skipped (excluded): %s\n", strings.Join(skipped, ", "))
+							}
+							restartStatus.Services = skipped
+						}
+					}
 
-			pool := ssh.NewPool(nil)
-			defer pool.Close()
+					if restartStatus != nil {
+						if err := stateMgr.UpdateServicesNeedingRestart(ctx, client, restartStatus.Services); err != nil && verbose {
+							fmt.Printf("  Warning: failed to record stale services: %v\n", err)
+						}
+					}
 
-			executor := ssh.NewExecutor(pool, maxParallel)
+					totalUpdated++
 
-			command := args[0]
-			fmt.Printf("Running on %d host(s): %s\n\n", len(hosts), command)
+					// Cleanup old packages
+					if err := updater.Cleanup(ctx, client); err != nil {
+						if verbose {
+							fmt.Printf("  Cleanup warning: %v\n", err)
+						}
+					}
 
-			results := executor.ExecOnHosts(ctx, hosts, command, false)
+					fmt.Println()
+				}
 
-			for _, r := range results {
-				fmt.Printf("=== %s ===\n", r.Host.Name)
-				if r.Error != nil {
-					fmt.Printf("ERROR: %v\n", r.Error)
-				} else {
-					if r.Result.Stdout != "" {
-						fmt.Print(r.Result.Stdout)
-					}
-					if r.Result.Stderr != "" {
-						fmt.Printf("stderr: %s", r.Result.Stderr)
-					}
-					if r.Result.ExitCode != 0 {
-						fmt.Printf("exit code: %d\n", r.Result.ExitCode)
-					}
+				// If canary strategy and first batch, check for failures
+				if rollout.ShouldAbortAfterBatch(strategy, batchIdx, totalFailed) {
+					return fmt.Errorf("canary batch had %d failure(s), aborting rollout", totalFailed)
 				}
-				fmt.Println()
 			}
 
-			fmt.Printf("Success: %d, Failed: %d\n", ssh.CountSuccess(results), ssh.CountErrors(results))
-
+			fmt.Printf("\nSummary: %d updated, %d failed\n", totalUpdated, totalFailed)
 			return nil
 		},
 	}
 
-	cmd.Flags().DurationVar(&timeout, "timeout", 2*time.Minute, "Command timeout")
-
-	return cmd
-}
-
-func cacheCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "cache",
-		Short: "Manage binary cache",
-		Long: `Manage Nix binary cache for faster deployments.
-
-Subcommands:
-  push       - Push store paths to cache
-  configure  - Configure hosts to use cache
-  keygen     - Generate signing keys`,
-	}
-
-	cmd.AddCommand(cachePushCmd())
-	cmd.AddCommand(cacheConfigureCmd())
-	cmd.AddCommand(cacheKeygenCmd())
+	cmd.Flags().BoolVar(&securityOnly, "security-only", false, "Only apply security updates")
+	cmd.Flags().BoolVar(&distUpgrade, "dist-upgrade", false, "Run dist-upgrade (may add/remove packages)")
+	cmd.Flags().BoolVar(&allowReboot, "reboot", false, "Allow reboot if required")
+	cmd.Flags().DurationVar(&rebootDelay, "reboot-delay", 5*time.Minute, "Delay before reboot")
+	cmd.Flags().StringVar(&strategy, "strategy", "serial", "Rollout strategy (serial, parallel, canary)")
+	cmd.Flags().IntVar(&canaryPercent, "canary-percent", 10, "Percentage of hosts in canary batch")
+	cmd.Flags().BoolVar(&installNeedrestart, "install-needrestart", false, "Install needrestart if it's not already present")
+	cmd.Flags().BoolVar(&restartServices, "restart-services", false, "Restart services running against replaced libraries instead of just recording them")
+	cmd.Flags().StringVar(&conffile, "conffile", "keep", "dpkg conffile policy when a package wants to replace a locally modified config file (keep, new, ask-fail)")
 
 	return cmd
 }
 
-func cachePushCmd() *cobra.Command {
-	var cacheURL string
-	var secretKey string
+func osUpdatePolicyCmd() *cobra.Command {
+	var policy string
+	var window string
+	var allowReboot bool
 
 	cmd := &cobra.Command{
-		Use:   "push [store-path]",
-		Short: "Push store path to cache",
-		Long:  `Push a Nix store path and its dependencies to the binary cache.`,
-		Args:  cobra.ExactArgs(1),
+		Use:   "policy",
+		Short: "Configure update policy",
+		Long: `Configure automatic update policy on Ubuntu hosts.
+
+Policies:
+  security-daily - Apply security updates daily via unattended-upgrades
+  full-weekly    - Apply all updates weekly
+  manual         - Disable automatic updates (NixFleet manages manually)`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
-			storePath := args[0]
 
-			if cacheURL == "" {
-				return fmt.Errorf("--cache-url is required")
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
 			}
-			if secretKey == "" {
-				return fmt.Errorf("--secret-key is required")
+
+			ubuntuHosts := filterUbuntuHosts(hosts)
+			if len(ubuntuHosts) == 0 {
+				fmt.Println("No Ubuntu hosts found")
+				return nil
 			}
 
-			signing := &cache.SigningConfig{SecretKey: secretKey}
-			mgr := cache.NewManager(nil, signing)
+			parsedPolicy, err := osupdate.ParsePolicy(policy)
+			if err != nil {
+				return err
+			}
 
-			fmt.Printf("Pushing %s to %s...\n", storePath, cacheURL)
+			config := osupdate.DefaultPolicyConfig(parsedPolicy)
+			if window != "" {
+				config.MaintenanceWindow = window
+			}
+			config.AllowReboot = allowReboot
 
 			if dryRun {
-				fmt.Println("Would push (dry-run)")
+				fmt.Printf("Would configure %s policy on %d host(s)\n", policy, len(ubuntuHosts))
 				return nil
 			}
 
-			if err := mgr.PushToCache(ctx, storePath, cacheURL); err != nil {
-				return fmt.Errorf("push failed: %w", err)
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			updater := osupdate.NewUpdater()
+
+			fmt.Printf("Configuring %s policy on %d host(s)...\n\n", policy, len(ubuntuHosts))
+
+			for _, host := range ubuntuHosts {
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
+					continue
+				}
+
+				if err := updater.ConfigurePolicy(ctx, client, config); err != nil {
+					fmt.Printf("%s: failed - %v\n", host.Name, err)
+					continue
+				}
+
+				fmt.Printf("%s: OK\n", host.Name)
 			}
 
-			fmt.Println("Done!")
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&cacheURL, "cache-url", "", "Cache URL (e.g., s3://bucket or ssh://host)")
-	cmd.Flags().StringVar(&secretKey, "secret-key", "", "Path to signing secret key")
+	cmd.Flags().StringVar(&policy, "set", "security-daily", "Policy to configure (security-daily, full-weekly, manual)")
+	cmd.Flags().StringVar(&window, "window", "", "Maintenance window (e.g., 'Sun 02:00-06:00')")
+	cmd.Flags().BoolVar(&allowReboot, "allow-reboot", false, "Allow automatic reboot")
 
 	return cmd
 }
 
-func cacheConfigureCmd() *cobra.Command {
-	var cacheURL string
-	var publicKeys []string
-
-	cmd := &cobra.Command{
-		Use:   "configure",
-		Short: "Configure hosts to use cache",
-		Long:  `Configure remote hosts to substitute from the binary cache.`,
+func osUpdateHoldCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "hold [packages...]",
+		Short: "Hold packages from being upgraded",
+		Long:  `Mark packages as held so they won't be upgraded.`,
+		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			inv, hosts, err := loadInventoryAndHosts(ctx)
 			if err != nil {
 				return err
 			}
 
-			if cacheURL == "" {
-				return fmt.Errorf("--cache-url is required")
-			}
-
-			cacheConfig := cache.CacheConfig{
-				URL:        cacheURL,
-				PublicKeys: publicKeys,
+			ubuntuHosts := filterUbuntuHosts(hosts)
+			if len(ubuntuHosts) == 0 {
+				fmt.Println("No Ubuntu hosts found")
+				return nil
 			}
 
-			mgr := cache.NewManager([]cache.CacheConfig{cacheConfig}, nil)
-
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
-			fmt.Printf("Configuring cache on %d host(s)...\n\n", len(hosts))
+			updater := osupdate.NewUpdater()
 
-			for _, host := range hosts {
+			fmt.Printf("Holding packages on %d host(s): %v\n\n", len(ubuntuHosts), args)
+
+			for _, host := range ubuntuHosts {
 				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 				if err != nil {
 					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
 					continue
 				}
 
-				if err := mgr.ConfigureHostCache(ctx, client, host.Base); err != nil {
+				if err := updater.HoldPackages(ctx, client, args); err != nil {
 					fmt.Printf("%s: failed - %v\n", host.Name, err)
 					continue
 				}
@@ -1890,2672 +2891,10066 @@ func cacheConfigureCmd() *cobra.Command {
 			return nil
 		},
 	}
-
-	cmd.Flags().StringVar(&cacheURL, "cache-url", "", "Cache URL")
-	cmd.Flags().StringSliceVar(&publicKeys, "public-key", nil, "Trusted public keys")
-
-	return cmd
 }
 
-func cacheKeygenCmd() *cobra.Command {
-	var keyName string
-	var outputDir string
-
-	cmd := &cobra.Command{
-		Use:   "keygen",
-		Short: "Generate signing key pair",
-		Long:  `Generate a new Nix signing key pair for binary cache.`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
-
-			if keyName == "" {
-				return fmt.Errorf("--name is required")
-			}
-			if outputDir == "" {
-				outputDir = "."
-			}
-
-			fmt.Printf("Generating signing key '%s'...\n", keyName)
-
-			signing, err := cache.GenerateSigningKey(ctx, keyName, outputDir)
-			if err != nil {
-				return fmt.Errorf("keygen failed: %w", err)
-			}
-
-			fmt.Printf("Secret key: %s\n", signing.SecretKey)
-			fmt.Printf("Public key: %s\n", signing.PublicKey)
-			fmt.Println("\nAdd the public key to your cache configuration.")
-
-			return nil
-		},
-	}
-
-	cmd.Flags().StringVar(&keyName, "name", "", "Key name (e.g., 'myorg-cache-1')")
-	cmd.Flags().StringVar(&outputDir, "output", ".", "Output directory for key files")
-
-	return cmd
-}
-
-func secretsCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "secrets",
-		Short: "Manage encrypted secrets",
-		Long: `Manage encrypted secrets with age encryption.
-
-Subcommands:
-  rekey    - Re-encrypt all secrets after modifying secrets.nix
-  edit     - Edit a secret in-place
-  add      - Add a new encrypted secret
-  host-key - Get age public key from a host's SSH key
-  deploy   - Deploy secrets to hosts
-  encrypt  - Encrypt a secret file
-  decrypt  - Decrypt a secret file
-  keygen   - Generate age key pair`,
-	}
-
-	cmd.AddCommand(secretsRekeyCmd())
-	cmd.AddCommand(secretsEditCmd())
-	cmd.AddCommand(secretsAddCmd())
-	cmd.AddCommand(secretsHostKeyCmd())
-	cmd.AddCommand(secretsDeployCmd())
-	cmd.AddCommand(secretsEncryptCmd())
-	cmd.AddCommand(secretsDecryptCmd())
-	cmd.AddCommand(secretsKeygenCmd())
-
-	return cmd
-}
-
-func secretsDeployCmd() *cobra.Command {
-	var identities []string
-	var secretsDir string
-
-	cmd := &cobra.Command{
-		Use:   "deploy",
-		Short: "Deploy secrets to hosts",
-		Long:  `Decrypt and deploy secrets to remote hosts.`,
+func osUpdateUnholdCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "unhold [packages...]",
+		Short: "Remove hold from packages",
+		Long:  `Remove hold from packages so they can be upgraded again.`,
+		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			inv, hosts, err := loadInventoryAndHosts(ctx)
 			if err != nil {
 				return err
 			}
 
-			mgr := secrets.NewManager(secrets.EncryptionAge, identities, nil)
+			ubuntuHosts := filterUbuntuHosts(hosts)
+			if len(ubuntuHosts) == 0 {
+				fmt.Println("No Ubuntu hosts found")
+				return nil
+			}
 
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
-			// TODO: Load secrets config from inventory or flake
-			fmt.Printf("Deploying secrets to %d host(s)...\n\n", len(hosts))
-			fmt.Printf("Note: Secret definitions should be in host config (nixfleet.secrets)\n")
-			fmt.Printf("Secrets directory: %s\n\n", secretsDir)
+			updater := osupdate.NewUpdater()
 
-			for _, host := range hosts {
+			fmt.Printf("Removing hold from packages on %d host(s): %v\n\n", len(ubuntuHosts), args)
+
+			for _, host := range ubuntuHosts {
 				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 				if err != nil {
 					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
 					continue
 				}
 
-				// For now, just verify connectivity
-				// Full implementation would read secrets config from the host's nixfleet config
-				result, _ := client.Exec(ctx, "echo ok")
-				if result != nil && result.Stdout == "ok\n" {
-					fmt.Printf("%s: ready (secrets would be deployed here)\n", host.Name)
+				if err := updater.UnholdPackages(ctx, client, args); err != nil {
+					fmt.Printf("%s: failed - %v\n", host.Name, err)
+					continue
 				}
-				_ = mgr // Use manager when secrets config is loaded
+
+				fmt.Printf("%s: OK\n", host.Name)
 			}
 
 			return nil
 		},
 	}
-
-	cmd.Flags().StringSliceVarP(&identities, "identity", "i", nil, "Age identity file(s)")
-	cmd.Flags().StringVar(&secretsDir, "secrets-dir", "secrets/", "Directory containing encrypted secrets")
-
-	return cmd
 }
 
-func secretsEncryptCmd() *cobra.Command {
-	var recipients []string
-	var output string
+func osUpdateReleaseUpgradeCmd() *cobra.Command {
+	var (
+		only         string
+		target       string
+		allowEOL     bool
+		nextCodename string
+		stopUnits    []string
+		preHook      string
+		postHook     string
+		noReboot     bool
+		assumeYes    bool
+		checkOnly    bool
+		pollEvery    time.Duration
+		waitTimeout  time.Duration
+		minFreeBoot  int64
+	)
 
 	cmd := &cobra.Command{
-		Use:   "encrypt [file]",
-		Short: "Encrypt a file",
-		Long:  `Encrypt a file using age encryption.`,
-		Args:  cobra.ExactArgs(1),
+		Use:   "release-upgrade",
+		Short: "Upgrade Ubuntu hosts to a new distro release (e.g. 26.04 LTS)",
+		Long: `Orchestrate a serial, per-host Ubuntu release upgrade (do-release-upgrade).
+
+For each Ubuntu host, in turn:
+  1. check the available release + free disk
+  2. (unless --check) run pre-hook (stop --stop-units, drain, ...), fully patch
+     the current release, then launch the upgrade DETACHED under a transient
+     systemd unit (survives SSH drops) and stream progress
+  3. reboot and wait for the host to return
+  4. verify the new release and run the post-hook (uncordon, ...)
+
+EOL releases cannot use do-release-upgrade; pass --allow-eol together with
+--next-codename to instead rewrite the apt sources codename and full-upgrade.
+Always serial — one host at a time — to protect shared services.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
-			inputFile := args[0]
 
-			if len(recipients) == 0 {
-				return fmt.Errorf("at least one --recipient is required")
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
 			}
-			if output == "" {
-				output = inputFile + ".age"
+			hosts = filterUbuntuHosts(hosts)
+			if only != "" {
+				var sel []*inventory.Host
+				for _, h := range hosts {
+					if h.Name == only {
+						sel = append(sel, h)
+					}
+				}
+				if len(sel) == 0 {
+					return fmt.Errorf("host %q not found among Ubuntu hosts", only)
+				}
+				hosts = sel
 			}
-
-			data, err := os.ReadFile(inputFile)
-			if err != nil {
-				return fmt.Errorf("reading input: %w", err)
+			if len(hosts) == 0 {
+				fmt.Println("No Ubuntu hosts found")
+				return nil
 			}
 
-			mgr := secrets.NewManager(secrets.EncryptionAge, nil, recipients)
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+			updater := osupdate.NewUpdater()
 
-			if err := mgr.EncryptSecret(ctx, data, output); err != nil {
-				return fmt.Errorf("encryption failed: %w", err)
+			preHookFull := preHook
+			if len(stopUnits) > 0 {
+				stop := fmt.Sprintf("systemctl stop %s || true", strings.Join(stopUnits, " "))
+				if preHookFull != "" {
+					preHookFull = stop + "; " + preHookFull
+				} else {
+					preHookFull = stop
+				}
 			}
 
-			fmt.Printf("Encrypted to %s\n", output)
-			return nil
-		},
-	}
+			fmt.Printf("Release-upgrade plan for %d host(s) [serial]:\n\n", len(hosts))
 
-	cmd.Flags().StringSliceVarP(&recipients, "recipient", "r", nil, "Age recipient public key(s)")
-	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file (default: input.age)")
+			for _, host := range hosts {
+				fmt.Printf("=== %s (%s) ===\n", host.Name, host.Addr)
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("  connection failed: %v\n\n", err)
+					continue
+				}
 
-	return cmd
-}
+				info, err := updater.CheckReleaseInfo(ctx, client)
+				if err != nil {
+					fmt.Printf("  check failed: %v\n\n", err)
+					continue
+				}
+				eolNote := ""
+				if info.RunningEOL {
+					eolNote = " [running release is EOL]"
+				}
+				fmt.Printf("  current: %s (%s)%s  free /: %d MiB  free /boot: %d MiB  target: %q\n",
+					info.CurrentVersion, info.Codename, eolNote, info.FreeRootMB, info.FreeBootMB, info.TargetRelease)
 
-func secretsDecryptCmd() *cobra.Command {
-	var identities []string
-	var output string
+				if checkOnly {
+					fmt.Println()
+					continue
+				}
 
-	cmd := &cobra.Command{
-		Use:   "decrypt [file]",
-		Short: "Decrypt a file",
-		Long:  `Decrypt an age-encrypted file.`,
-		Args:  cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
-			inputFile := args[0]
+				// /boot preflight up front — a too-small /boot breaks the prepare
+				// full-upgrade (new kernel initramfs) before we ever reach the
+				// release upgrade. Better to flag it here than half-configure a kernel.
+				cfgBoot := osupdate.DefaultReleaseUpgradeConfig()
+				if minFreeBoot >= 0 {
+					cfgBoot.MinFreeBootMB = minFreeBoot
+				}
+				if cfgBoot.MinFreeBootMB > 0 && info.FreeBootMB > 0 && info.FreeBootMB < cfgBoot.MinFreeBootMB {
+					fmt.Printf("  SKIP: only %d MiB free on /boot (need ~%d). Remove old kernels, set initramfs MODULES=dep, or lower --min-free-boot.\n\n",
+						info.FreeBootMB, cfgBoot.MinFreeBootMB)
+					continue
+				}
 
-			if len(identities) == 0 {
-				return fmt.Errorf("at least one --identity is required")
-			}
+				// Decision: a target from do-release-upgrade drives the supported
+				// path (works even from an EOL release). Only a stranded EOL host
+				// (no target) needs the --allow-eol codename-rewrite fallback.
+				if info.TargetRelease == "" {
+					if info.RunningEOL {
+						if !allowEOL || nextCodename == "" {
+							fmt.Printf("  SKIP: EOL with no upgrade target; pass --allow-eol --next-codename <name>\n\n")
+							continue
+						}
+					} else {
+						fmt.Printf("  SKIP: already on the latest available release\n\n")
+						continue
+					}
+				}
 
-			mgr := secrets.NewManager(secrets.EncryptionAge, identities, nil)
+				// Determine the version we expect to land on, for verification.
+				wantVer := target
+				if wantVer == "" {
+					if m := regexp.MustCompile(`(\d+\.\d+)`).FindStringSubmatch(info.TargetRelease); m != nil {
+						wantVer = m[1]
+					}
+				}
 
-			data, err := mgr.DecryptSecret(ctx, inputFile)
-			if err != nil {
-				return fmt.Errorf("decryption failed: %w", err)
-			}
+				if !assumeYes {
+					dest := info.TargetRelease
+					if dest == "" && info.RunningEOL {
+						dest = "codename " + nextCodename + " (EOL sources rewrite)"
+					}
+					fmt.Printf("  Proceed with upgrade of %s → %s? [y/N]: ", host.Name, dest)
+					var resp string
+					fmt.Scanln(&resp)
+					if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(resp)), "y") {
+						fmt.Printf("  skipped by operator\n\n")
+						continue
+					}
+				}
 
-			if output == "" {
-				fmt.Print(string(data))
-			} else {
-				if err := os.WriteFile(output, data, 0600); err != nil {
-					return fmt.Errorf("writing output: %w", err)
+				cfg := osupdate.DefaultReleaseUpgradeConfig()
+				cfg.AllowEOL = allowEOL
+				cfg.NextCodename = nextCodename
+				cfg.PreHook = preHookFull
+				cfg.PostHook = postHook
+				if minFreeBoot >= 0 {
+					cfg.MinFreeBootMB = minFreeBoot
 				}
-				fmt.Printf("Decrypted to %s\n", output)
-			}
 
-			return nil
-		},
-	}
+				fmt.Printf("  Preparing (set prompt, full-upgrade current release)...\n")
+				if err := updater.PrepareRelease(ctx, client); err != nil {
+					fmt.Printf("  prepare failed: %v\n\n", err)
+					continue
+				}
 
-	cmd.Flags().StringSliceVarP(&identities, "identity", "i", nil, "Age identity file(s)")
-	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file (default: stdout)")
+				// do-release-upgrade refuses to run while a reboot is pending
+				// ("you have not rebooted after updating a package which requires
+				// a reboot"). The prepare full-upgrade can install a new kernel, so
+				// reboot into it first, then proceed. Also covers each hop of an
+				// EOL two-hop upgrade.
+				if rr, _ := updater.IsRebootRequired(ctx, client); rr {
+					fmt.Printf("  Reboot required after prepare (new kernel) — rebooting first...\n")
+					preRO := reboot.NewOrchestrator(func() reboot.RebootConfig {
+						c := reboot.DefaultRebootConfig()
+						c.AllowReboot = true
+						if waitTimeout > 0 {
+							c.WaitTimeout = waitTimeout
+						}
+						return c
+					}())
+					if _, err := preRO.ExecuteReboot(ctx, client, pool, host.Addr, host.SSHPort, host.SSHUser, host.Base, host.KexecReboot, nil); err != nil {
+						fmt.Printf("  pre-upgrade reboot failed: %v\n\n", err)
+						continue
+					}
+					client, err = pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+					if err != nil {
+						fmt.Printf("  reconnect after pre-upgrade reboot failed: %v\n\n", err)
+						continue
+					}
+				}
 
-	return cmd
-}
+				fmt.Printf("  Launching detached release upgrade...\n")
+				if err := updater.StartReleaseUpgrade(ctx, client, info, cfg); err != nil {
+					fmt.Printf("  launch failed: %v\n\n", err)
+					continue
+				}
 
-func secretsKeygenCmd() *cobra.Command {
-	var output string
+				exit, err := updater.WaitForReleaseUpgrade(ctx, client, cfg, pollEvery, func(tail string) {
+					last := tail
+					if i := strings.LastIndex(tail, "\n"); i >= 0 {
+						last = tail[i+1:]
+					}
+					fmt.Printf("    … %s\n", last)
+				})
+				if err != nil {
+					fmt.Printf("  upgrade wait failed: %v (check %s on host)\n\n", err, cfg.LogPath)
+					continue
+				}
+				if exit != 0 {
+					fmt.Printf("  UPGRADE FAILED (exit %d) — host NOT rebooted. Inspect %s\n\n", exit, cfg.LogPath)
+					continue
+				}
+				fmt.Printf("  Upgrade process completed.\n")
 
-	cmd := &cobra.Command{
-		Use:   "keygen",
-		Short: "Generate age key pair",
-		Long:  `Generate a new age key pair for secrets encryption.`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
+				if noReboot {
+					fmt.Printf("  --no-reboot set; reboot %s manually then verify.\n\n", host.Name)
+					continue
+				}
 
-			if output == "" {
-				output = "age-key.txt"
-			}
+				fmt.Printf("  Rebooting and waiting for host...\n")
+				rebootOrch := reboot.NewOrchestrator(func() reboot.RebootConfig {
+					c := reboot.DefaultRebootConfig()
+					c.AllowReboot = true
+					if waitTimeout > 0 {
+						c.WaitTimeout = waitTimeout
+					}
+					return c
+				}())
+				if _, err := rebootOrch.ExecuteReboot(ctx, client, pool, host.Addr, host.SSHPort, host.SSHUser, host.Base, host.KexecReboot, nil); err != nil {
+					fmt.Printf("  reboot/wait failed: %v\n\n", err)
+					continue
+				}
 
-			publicKey, err := secrets.GenerateAgeKey(ctx, output)
-			if err != nil {
-				return fmt.Errorf("keygen failed: %w", err)
-			}
+				client, err = pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("  reconnect after reboot failed: %v\n\n", err)
+					continue
+				}
+				ok, got, _ := updater.VerifyRelease(ctx, client, wantVer)
+				if ok {
+					fmt.Printf("  VERIFIED: now on %s\n", got)
+				} else {
+					fmt.Printf("  WARNING: expected %s, host reports %s\n", wantVer, got)
+				}
 
-			fmt.Printf("Generated key pair:\n")
-			fmt.Printf("  Secret key: %s\n", output)
-			fmt.Printf("  Public key: %s\n", publicKey)
-			fmt.Println("\nUse the public key as a recipient for encryption.")
+				if postHook != "" {
+					if _, err := client.ExecSudo(ctx, postHook); err != nil {
+						fmt.Printf("  post-hook warning: %v\n", err)
+					}
+				}
+				fmt.Printf("  %s done.\n\n", host.Name)
+			}
 
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&output, "output", "o", "age-key.txt", "Output file for secret key")
+	cmd.Flags().StringVar(&only, "only", "", "Upgrade just this host (by inventory name)")
+	cmd.Flags().StringVar(&target, "target", "", "Expected resulting version for verification (e.g. 26.04); auto-detected if empty")
+	cmd.Flags().BoolVar(&allowEOL, "allow-eol", false, "Allow upgrading an EOL release via apt sources codename rewrite")
+	cmd.Flags().StringVar(&nextCodename, "next-codename", "", "Next release codename for the EOL path (e.g. questing)")
+	cmd.Flags().StringSliceVar(&stopUnits, "stop-units", nil, "Systemd units to stop before upgrading (e.g. llama-rocm-foo.service)")
+	cmd.Flags().StringVar(&preHook, "pre-hook", "", "Extra sudo command to run before the upgrade (e.g. k0s drain)")
+	cmd.Flags().StringVar(&postHook, "post-hook", "", "Sudo command to run after verify (e.g. k0s uncordon)")
+	cmd.Flags().BoolVar(&noReboot, "no-reboot", false, "Do not reboot after the upgrade completes")
+	cmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Do not prompt for per-host confirmation")
+	cmd.Flags().BoolVar(&checkOnly, "check", false, "Only report current/target release per host; make no changes")
+	cmd.Flags().DurationVar(&pollEvery, "poll", 30*time.Second, "How often to poll the detached upgrade for progress")
+	cmd.Flags().DurationVar(&waitTimeout, "wait-timeout", 30*time.Minute, "How long to wait for a host to return after reboot")
+	cmd.Flags().Int64Var(&minFreeBoot, "min-free-boot", -1, "Override required free /boot MiB (-1 = default 350; lower for MODULES=dep nodes)")
 
 	return cmd
 }
 
-func secretsRekeyCmd() *cobra.Command {
-	var secretsNixPath string
-	var secretsDir string
-	var identityPath string
-
+func aptCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "rekey",
-		Short: "Re-encrypt all secrets after modifying secrets.nix",
-		Long: `Re-encrypt all secrets using the recipients defined in secrets.nix.
+		Use:   "apt",
+		Short: "Install and remove packages on Ubuntu hosts",
+		Long: `Install and remove packages on Ubuntu hosts via a single apt-get
+transaction.
 
-Use this after:
-  - Adding a new host to secrets.nix
-  - Removing a host from secrets.nix
-  - Changing which secrets a host can access
+Subcommands:
+  install - Install (and optionally remove) packages in one transaction
+  remove  - Remove packages`,
+	}
 
-Example:
-  nixfleet secrets rekey -c secrets/secrets.nix -i ~/.config/age/admin-key.txt`,
+	cmd.AddCommand(aptInstallCmd())
+	cmd.AddCommand(aptRemoveCmd())
+
+	return cmd
+}
+
+// printAptTransactionResult reports one host's apt.TransactionResult in the
+// same terse per-host form as os-update hold/unhold, adding detail only
+// where the transaction did something worth calling out.
+func printAptTransactionResult(host *inventory.Host, result *apt.TransactionResult) {
+	fmt.Printf("%s: OK\n", host.Name)
+	if len(result.Installed) > 0 {
+		fmt.Printf("  installed: %s\n", strings.Join(result.Installed, " "))
+	}
+	if len(result.Upgraded) > 0 {
+		fmt.Printf("  upgraded: %s\n", strings.Join(result.Upgraded, " "))
+	}
+	if len(result.Removed) > 0 {
+		fmt.Printf("  removed: %s\n", strings.Join(result.Removed, " "))
+	}
+	if len(result.HoldsKept) > 0 {
+		fmt.Printf("  holds preserved: %s\n", strings.Join(result.HoldsKept, " "))
+	}
+}
+
+func aptInstallCmd() *cobra.Command {
+	var remove []string
+	var noRecommends bool
+
+	cmd := &cobra.Command{
+		Use:   "install [packages...]",
+		Short: "Install packages, optionally removing others in the same transaction",
+		Long: `Install one or more packages on Ubuntu hosts in a single apt-get
+transaction. Each package may pin a version, exact or wildcard:
+
+  nixfleet apt install -H host nginx nginx-common=1.24.* --remove apache2
+
+--remove packages are folded into the same apt-get invocation (as
+"pkg-"), so apt resolves installs and removals together instead of as two
+separate commands. Any package that was held before the transaction and
+is installed or upgraded by it has its hold re-applied afterwards.`,
+		Args: cobra.MinimumNArgs(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			if identityPath == "" {
-				// Default to admin key location
-				home, _ := os.UserHomeDir()
-				identityPath = home + "/.config/age/admin-key.txt"
+			if len(args) == 0 && len(remove) == 0 {
+				return fmt.Errorf("specify at least one package to install or --remove")
 			}
 
-			// Check identity exists
-			if _, err := os.Stat(identityPath); os.IsNotExist(err) {
-				return fmt.Errorf("identity file not found: %s\nUse -i to specify your age identity file", identityPath)
+			install := make([]apt.PackageSpec, 0, len(args))
+			for _, spec := range args {
+				install = append(install, apt.ParsePackageSpec(spec))
 			}
 
-			// Parse secrets.nix
-			config, err := secrets.ParseSecretsNix(ctx, secretsNixPath)
+			inv, hosts, err := loadInventoryAndHosts(ctx)
 			if err != nil {
-				return fmt.Errorf("parsing secrets.nix: %w", err)
+				return err
 			}
 
-			fmt.Printf("Parsed secrets.nix:\n")
-			fmt.Printf("  Admins: %d\n", len(config.Admins))
-			fmt.Printf("  Hosts: %d\n", len(config.Hosts))
-			fmt.Printf("  Secrets: %d\n\n", len(config.Secrets))
-
-			if dryRun {
-				fmt.Println("Would rekey the following secrets:")
-				for name, entry := range config.Secrets {
-					fmt.Printf("  %s -> %d recipients\n", name, len(entry.PublicKeys))
-				}
+			ubuntuHosts := filterUbuntuHosts(hosts)
+			if len(ubuntuHosts) == 0 {
+				fmt.Println("No Ubuntu hosts found")
 				return nil
 			}
 
-			rekeyed, err := secrets.RekeyAll(ctx, secretsDir, config, identityPath, false)
-			if err != nil {
-				return err
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			aptMgr := apt.NewManager()
+			req := apt.TransactionRequest{
+				Install:      install,
+				Remove:       remove,
+				NoRecommends: noRecommends,
 			}
 
-			fmt.Printf("Rekeyed %d secret(s):\n", len(rekeyed))
-			for _, name := range rekeyed {
-				entry := config.Secrets[name]
-				fmt.Printf("  ✓ %s (%d recipients)\n", name, len(entry.PublicKeys))
+			for _, host := range ubuntuHosts {
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
+					continue
+				}
+
+				result, err := aptMgr.Transact(ctx, client, req)
+				if err != nil {
+					fmt.Printf("%s: failed - %v\n", host.Name, err)
+					continue
+				}
+
+				printAptTransactionResult(host, result)
 			}
 
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&secretsNixPath, "config", "c", "secrets/secrets.nix", "Path to secrets.nix")
-	cmd.Flags().StringVarP(&secretsDir, "secrets-dir", "s", "secrets/", "Directory containing .age files")
-	cmd.Flags().StringVar(&identityPath, "identity", "", "Path to age identity for decryption (default: ~/.config/age/admin-key.txt)")
+	cmd.Flags().StringSliceVar(&remove, "remove", nil, "Package(s) to remove in the same transaction")
+	cmd.Flags().BoolVar(&noRecommends, "no-recommends", false, "Pass --no-install-recommends to apt-get")
 
 	return cmd
 }
 
-func secretsEditCmd() *cobra.Command {
-	var secretsNixPath string
-	var identityPath string
-
-	cmd := &cobra.Command{
-		Use:   "edit [secret-file]",
-		Short: "Edit a secret in-place",
-		Long: `Decrypt a secret, open in $EDITOR, and re-encrypt with the same recipients.
-
-The recipients are looked up from secrets.nix to ensure proper multi-recipient encryption.
-
-Example:
-  nixfleet secrets edit secrets/api-key.age`,
-		Args: cobra.ExactArgs(1),
+func aptRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <packages...>",
+		Short: "Remove packages",
+		Long:  `Remove one or more packages from Ubuntu hosts in a single apt-get transaction.`,
+		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
-			secretPath := args[0]
 
-			if identityPath == "" {
-				home, _ := os.UserHomeDir()
-				identityPath = home + "/.config/age/admin-key.txt"
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
 			}
 
-			// Check identity exists
-			if _, err := os.Stat(identityPath); os.IsNotExist(err) {
-				return fmt.Errorf("identity file not found: %s", identityPath)
-			}
-
-			// Check secret exists
-			if _, err := os.Stat(secretPath); os.IsNotExist(err) {
-				return fmt.Errorf("secret file not found: %s", secretPath)
+			ubuntuHosts := filterUbuntuHosts(hosts)
+			if len(ubuntuHosts) == 0 {
+				fmt.Println("No Ubuntu hosts found")
+				return nil
 			}
 
-			// Parse secrets.nix to get recipients
-			config, err := secrets.ParseSecretsNix(ctx, secretsNixPath)
-			if err != nil {
-				return fmt.Errorf("parsing secrets.nix: %w", err)
-			}
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
 
-			// Get secret name (basename)
-			secretName := filepath.Base(secretPath)
-			recipients, err := config.LookupRecipientsForSecret(secretName)
-			if err != nil {
-				return err
-			}
+			aptMgr := apt.NewManager()
 
-			fmt.Printf("Editing %s (%d recipients)\n", secretName, len(recipients))
-			fmt.Printf("Opening in $EDITOR...\n\n")
+			for _, host := range ubuntuHosts {
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
+					continue
+				}
 
-			if err := secrets.EditSecret(ctx, secretPath, recipients, identityPath); err != nil {
-				return err
+				result, err := aptMgr.Transact(ctx, client, apt.TransactionRequest{Remove: args})
+				if err != nil {
+					fmt.Printf("%s: failed - %v\n", host.Name, err)
+					continue
+				}
+
+				printAptTransactionResult(host, result)
 			}
 
-			fmt.Println("Secret updated successfully")
 			return nil
 		},
 	}
+}
 
-	cmd.Flags().StringVarP(&secretsNixPath, "config", "c", "secrets/secrets.nix", "Path to secrets.nix")
-	cmd.Flags().StringVar(&identityPath, "identity", "", "Path to age identity for decryption (default: ~/.config/age/admin-key.txt)")
-
+func nixCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "nix",
+		Short: "Manage the Nix flake inputs (nixpkgs) for the fleet",
+		Long:  `Update and deploy the Nix package set the fleet is built from.`,
+	}
+	cmd.AddCommand(nixUpdateCmd())
 	return cmd
 }
 
-func secretsAddCmd() *cobra.Command {
-	var secretsNixPath string
-	var secretsDir string
-	var recipients []string
-	var fromFile string
-	var hostNames []string
+func nixUpdateCmd() *cobra.Command {
+	var (
+		doApply    bool
+		skipVerify bool
+		skipState  bool
+		inputs     []string
+	)
 
 	cmd := &cobra.Command{
-		Use:   "add [secret-name]",
-		Short: "Add a new encrypted secret",
-		Long: `Create a new encrypted secret file.
-
-Secret value can be provided via:
-  - stdin (pipe or interactive)
-  - --from-file flag
-
-Recipients are determined by:
-  - --recipient flags (explicit keys)
-  - --host flags (looked up from secrets.nix)
-  - Default: all admins from secrets.nix
+		Use:   "update",
+		Short: "Update flake.lock (nixpkgs) and optionally deploy",
+		Long: `Run 'nix flake update' to refresh flake.lock, verify every host still
+evaluates with the new package set, and optionally build + deploy the result.
 
-Example:
-  echo "my-secret-value" | nixfleet secrets add api-key.age
-  nixfleet secrets add db-password.age --host gtr --host web-1
-  nixfleet secrets add ssl-cert.age --from-file /path/to/cert.pem`,
-		Args: cobra.ExactArgs(1),
+By default only the 'nixpkgs' input is updated. Pass --input to target others
+(repeatable), or --input "" semantics are not supported — omit the flag to keep
+the default. Use --apply to roll the new closures out to all inventory hosts.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
-			secretName := args[0]
 
-			// Ensure .age extension
-			if !strings.HasSuffix(secretName, ".age") {
-				secretName += ".age"
+			flake, err := nix.ResolveFlakePath(flakePath)
+			if err != nil {
+				return err
+			}
+			evaluator, err := newEvaluator(flake)
+			if err != nil {
+				return err
 			}
 
-			secretPath := filepath.Join(secretsDir, secretName)
-
-			// Check if already exists
-			if _, err := os.Stat(secretPath); err == nil {
-				return fmt.Errorf("secret already exists: %s\nUse 'nixfleet secrets edit' to modify", secretPath)
+			fmt.Printf("Updating flake inputs: %s\n", strings.Join(inputs, ", "))
+			out, err := evaluator.FlakeUpdate(ctx, inputs...)
+			if out != "" {
+				fmt.Println(strings.TrimRight(out, "\n"))
+			}
+			if err != nil {
+				return err
 			}
 
-			// Determine recipients
-			var finalRecipients []string
-			if len(recipients) > 0 {
-				finalRecipients = recipients
-			} else {
-				// Parse secrets.nix
-				config, err := secrets.ParseSecretsNix(ctx, secretsNixPath)
-				if err != nil {
-					return fmt.Errorf("parsing secrets.nix: %w", err)
-				}
+			if !strings.Contains(out, "Updated input") {
+				fmt.Println("\nflake.lock already up to date — nothing to do.")
+				return nil
+			}
 
-				// Start with all admins
-				finalRecipients = append(finalRecipients, config.AllAdmins...)
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
 
-				// Add specified hosts
-				for _, hostName := range hostNames {
-					if key, ok := config.Hosts[hostName]; ok {
-						finalRecipients = append(finalRecipients, key)
-					} else {
-						return fmt.Errorf("host %q not found in secrets.nix", hostName)
+			// Verify every host still evaluates before we consider deploying.
+			if !skipVerify {
+				fmt.Printf("\nVerifying %d host(s) still evaluate...\n", len(hosts))
+				var broken []string
+				for _, host := range hosts {
+					if _, err := evaluator.EvalHost(ctx, host.Name, host.Base); err != nil {
+						fmt.Printf("  %s: EVAL FAILED - %v\n", host.Name, err)
+						broken = append(broken, host.Name)
+					} else if verbose {
+						fmt.Printf("  %s: ok\n", host.Name)
 					}
 				}
-
-				if len(finalRecipients) == 0 {
-					return fmt.Errorf("no recipients specified and no admins in secrets.nix")
+				if len(broken) > 0 {
+					return fmt.Errorf("%d host(s) fail to evaluate with updated nixpkgs: %s (flake.lock left updated; fix or `git checkout flake.lock`)", len(broken), strings.Join(broken, ", "))
 				}
+				fmt.Printf("All %d host(s) evaluate cleanly.\n", len(hosts))
 			}
 
-			// Get secret content
-			var content []byte
-			var err error
-			if fromFile != "" {
-				content, err = os.ReadFile(fromFile)
+			if !doApply {
+				fmt.Println("\nflake.lock updated. Run `nixfleet apply` (or re-run with --apply) to deploy.")
+				return nil
+			}
+
+			// Deploy: build + copy + activate each host. This intentionally does
+			// not run preflight/PKI (see `nixfleet apply` for the full pipeline);
+			// a package-set bump only needs the closure rolled out.
+			deployer := nix.NewDeployer(evaluator)
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+			stateMgr := state.NewManager()
+
+			fmt.Printf("\nDeploying updated closures to %d host(s)...\n\n", len(hosts))
+			success, failed := 0, 0
+			for _, host := range hosts {
+				fmt.Printf("Deploying to %s...\n", host.Name)
+				startTime := time.Now()
+
+				closure, err := evaluator.BuildHost(ctx, host.Name, host.Base)
 				if err != nil {
-					return fmt.Errorf("reading file: %w", err)
+					fmt.Printf("  Build failed: %v\n", err)
+					failed++
+					continue
 				}
-			} else {
-				// Read from stdin
-				fmt.Println("Enter secret value (Ctrl+D to finish):")
-				content, err = os.ReadFile("/dev/stdin")
+				if err := deployer.CopyToHost(ctx, closure, host); err != nil {
+					fmt.Printf("  Copy failed: %v\n", err)
+					failed++
+					continue
+				}
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 				if err != nil {
-					return fmt.Errorf("reading stdin: %w", err)
+					fmt.Printf("  Connection failed: %v\n", err)
+					failed++
+					continue
 				}
+				switch host.Base {
+				case "ubuntu":
+					err = deployer.ActivateUbuntu(ctx, client, closure)
+				case "nixos":
+					err = deployer.ActivateNixOS(ctx, client, closure, "switch")
+				}
+				if err != nil {
+					fmt.Printf("  Activation failed: %v\n", err)
+					if !skipState {
+						profilePath, _ := nix.ProfilePath(host.Base)
+						stateMgr.RecordGeneration(ctx, client, state.GenerationRecord{
+							ProfilePath: profilePath,
+							StorePath:   closure.StorePath,
+							Outcome:     state.GenerationFailed,
+							Note:        err.Error(),
+						})
+					}
+					failed++
+					continue
+				}
+				if !skipState {
+					gen, _, _ := deployer.GetCurrentGeneration(ctx, client, host.Base)
+					if err := stateMgr.UpdateAfterApply(ctx, client, closure.StorePath, closure.ManifestHash, gen, time.Since(startTime)); err != nil {
+						fmt.Printf("  Warning: failed to update state - %v\n", err)
+					}
+					profilePath, _ := nix.ProfilePath(host.Base)
+					stateMgr.RecordGeneration(ctx, client, state.GenerationRecord{
+						Generation:  gen,
+						ProfilePath: profilePath,
+						StorePath:   closure.StorePath,
+						Outcome:     state.GenerationActive,
+					})
+				}
+				fmt.Printf("  Done! (%s)\n\n", time.Since(startTime).Round(time.Second))
+				success++
 			}
-
-			if len(content) == 0 {
-				return fmt.Errorf("empty secret content")
-			}
-
-			if dryRun {
-				fmt.Printf("Would create %s with %d recipients\n", secretPath, len(finalRecipients))
-				return nil
-			}
-
-			if err := secrets.AddSecret(ctx, secretPath, content, finalRecipients); err != nil {
-				return err
+			fmt.Printf("Summary: %d succeeded, %d failed\n", success, failed)
+			if failed > 0 {
+				return fmt.Errorf("%d host(s) failed to deploy", failed)
 			}
-
-			fmt.Printf("Created %s (%d recipients)\n", secretPath, len(finalRecipients))
-			fmt.Println("\nDon't forget to add this secret to secrets.nix:")
-			fmt.Printf("  \"%s\".publicKeys = allAdmins ++ [ hosts.<hostname> ];\n", secretName)
-
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&secretsNixPath, "config", "c", "secrets/secrets.nix", "Path to secrets.nix")
-	cmd.Flags().StringVarP(&secretsDir, "secrets-dir", "s", "secrets/", "Output directory")
-	cmd.Flags().StringSliceVarP(&recipients, "recipient", "r", nil, "Age recipient public key(s)")
-	cmd.Flags().StringSliceVar(&hostNames, "host", nil, "Host name(s) from secrets.nix to add as recipients")
-	cmd.Flags().StringVar(&fromFile, "from-file", "", "Read secret value from file")
+	cmd.Flags().BoolVar(&doApply, "apply", false, "Build and deploy updated closures to all hosts after updating")
+	cmd.Flags().BoolVar(&skipVerify, "skip-verify", false, "Skip re-evaluating all hosts after the lock update")
+	cmd.Flags().BoolVar(&skipState, "skip-state", false, "Skip updating host state after deploy (with --apply)")
+	cmd.Flags().StringSliceVar(&inputs, "input", []string{"nixpkgs"}, "Flake inputs to update (repeatable)")
 
 	return cmd
 }
 
-func secretsHostKeyCmd() *cobra.Command {
-	var sshKeyPath string
-
+func rebootCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "host-key [host]",
-		Short: "Get age public key from a host's SSH key",
-		Long: `Derive an age public key from a host's SSH ed25519 host key.
-
-This can be used to:
-  - Get a host's age key for adding to secrets.nix
-  - Verify the expected key for a host
-
-Examples:
-  # Get key from remote host
-  nixfleet secrets host-key gtr
-
-  # Get key from local SSH key file
-  nixfleet secrets host-key --ssh-key /path/to/ssh_host_ed25519_key.pub`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
-
-			if sshKeyPath != "" {
-				// Local file mode
-				key, err := secrets.GetHostAgeKey(ctx, sshKeyPath)
-				if err != nil {
-					return err
-				}
-				fmt.Println(key)
-				return nil
-			}
-
-			// Remote host mode - need a host argument
-			if len(args) == 0 {
-				return fmt.Errorf("specify a host or use --ssh-key for a local file")
-			}
-
-			_, hosts, err := loadInventoryAndHosts(ctx)
-			if err != nil {
-				return err
-			}
-
-			// Find the target host
-			var targetHost *inventory.Host
-			for _, h := range hosts {
-				if h.Name == args[0] {
-					targetHost = h
-					break
-				}
-			}
-
-			if targetHost == nil {
-				return fmt.Errorf("host %q not found in inventory", args[0])
-			}
-
-			port := targetHost.SSHPort
-			if port == 0 {
-				port = 22
-			}
-
-			key, err := secrets.GetHostAgeKeyFromRemote(ctx, targetHost.Addr, targetHost.SSHUser, port)
-			if err != nil {
-				return err
-			}
-
-			fmt.Printf("Host: %s\n", targetHost.Name)
-			fmt.Printf("Age public key: %s\n", key)
-			fmt.Println("\nAdd to secrets.nix:")
-			fmt.Printf("  %s = \"%s\";\n", targetHost.Name, key)
-
-			return nil
-		},
-	}
-
-	cmd.Flags().StringVar(&sshKeyPath, "ssh-key", "", "Path to SSH public key file (for local keys)")
-
-	return cmd
-}
-
-func driftCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "drift",
-		Short: "Detect and fix configuration drift",
-		Long: `Detect and remediate configuration drift on managed hosts.
+		Use:   "reboot",
+		Short: "Manage host reboots",
+		Long: `Manage host reboots with configurable windows and hooks.
 
 Subcommands:
-  check  - Check for configuration drift
-  fix    - Remediate detected drift
-  status - Show drift status from cached state`,
+  status  - Check reboot requirements
+  now     - Reboot hosts immediately
+  schedule - Schedule reboots in maintenance window`,
 	}
 
-	cmd.AddCommand(driftCheckCmd())
-	cmd.AddCommand(driftFixCmd())
-	cmd.AddCommand(driftStatusCmd())
+	cmd.AddCommand(rebootStatusCmd())
+	cmd.AddCommand(rebootNowCmd())
+	cmd.AddCommand(rebootResumeCmd())
 
 	return cmd
 }
 
-func driftCheckCmd() *cobra.Command {
-	var saveState bool
+// rebootResumeCmd resumes a `reboot now` run that checkpointed itself
+// before rebooting the machine nixfleet runs on. It's normally invoked by
+// the systemd unit InstallResumeUnit installs, not run by hand.
+func rebootResumeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "resume <run-id>",
+		Short: "Resume a checkpointed reboot orchestration run",
+		Long: `Resume a fleet reboot run that checkpointed itself before rebooting the
+machine running nixfleet.
 
-	cmd := &cobra.Command{
-		Use:   "check",
-		Short: "Check for configuration drift",
-		Long:  `Compare current file states against expected configuration.`,
+Verifies the self-host came back up and runs its post-reboot hook, then
+continues rebooting any hosts still remaining from the original run.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
+			runID := args[0]
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			store, err := reboot.NewCheckpointStore()
+			if err != nil {
+				return err
+			}
+			run, err := store.Load(runID)
+			if err != nil {
+				return fmt.Errorf("loading checkpoint %s: %w", runID, err)
+			}
+
+			inv, allHosts, err := loadInventoryAndHosts(ctx)
 			if err != nil {
 				return err
 			}
+			byName := make(map[string]*inventory.Host, len(allHosts))
+			for _, h := range allHosts {
+				byName[h.Name] = h
+			}
 
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
+			config := reboot.RebootConfig{
+				AllowReboot:          true,
+				MaxConcurrentReboots: run.MaxConcurrent,
+				WaitTimeout:          10 * time.Minute,
+				WaitInterval:         10 * time.Second,
+				Kexec:                run.Kexec,
+			}
+			orchestrator := reboot.NewOrchestrator(config)
 			stateMgr := state.NewManager()
 
-			fmt.Printf("Checking drift on %d host(s)...\n\n", len(hosts))
-
-			totalDrift := 0
-			for _, host := range hosts {
-				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+			// Verify the self-host that triggered this checkpoint came back up
+			// and run its post-reboot hook before continuing.
+			if selfHost, ok := byName[run.SelfHost]; ok {
+				port := selfHost.SSHPort
+				if port == 0 {
+					port = 22
+				}
+				client, err := pool.GetWithUser(ctx, selfHost.Addr, port, selfHost.SSHUser)
 				if err != nil {
-					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
-					continue
+					return fmt.Errorf("resuming run %s: self-host %s unreachable after reboot: %w", runID, selfHost.Name, err)
+				}
+				if err := orchestrator.RunPostRebootHook(ctx, client); err != nil {
+					fmt.Printf("%s: post-reboot hook failed: %v\n", selfHost.Name, err)
 				}
+				if err := reboot.RemoveResumeUnit(ctx, client); err != nil {
+					fmt.Printf("%s: failed to remove resume unit: %v\n", selfHost.Name, err)
+				}
+				run.Completed = append(run.Completed, selfHost.Name)
+				run.Remaining = removeHostName(run.Remaining, selfHost.Name)
+				fmt.Printf("%s: verified post-reboot, resuming run %s\n", selfHost.Name, runID)
+			}
 
-				// Read current state from host
-				hostState, err := stateMgr.ReadState(ctx, client)
-				if err != nil {
-					fmt.Printf("%s: failed to read state - %v\n", host.Name, err)
+			limiter := reboot.NewConcurrencyLimiter(run.MaxConcurrent)
+			success, failed := 0, 0
+
+			for _, name := range run.Remaining {
+				host, ok := byName[name]
+				if !ok {
+					fmt.Printf("%s: no longer in inventory, skipping\n", name)
 					continue
 				}
 
-				if len(hostState.ManagedFiles) == 0 {
-					fmt.Printf("%s: no managed files configured\n", host.Name)
+				if err := limiter.Acquire(ctx); err != nil {
+					return err
+				}
+
+				fmt.Printf("Rebooting %s...\n", host.Name)
+
+				port := host.SSHPort
+				if port == 0 {
+					port = 22
+				}
+				client, err := pool.GetWithUser(ctx, host.Addr, port, host.SSHUser)
+				if err != nil {
+					fmt.Printf("  Connection failed: %v\n", err)
+					failed++
+					run.Failed = append(run.Failed, host.Name)
+					limiter.Release()
 					continue
 				}
 
-				// Check drift against managed files
-				results, err := stateMgr.CheckDrift(ctx, client, hostState.ManagedFiles)
+				hostWindow, err := rebootWindowForHost(inv, host, run.Window)
 				if err != nil {
-					fmt.Printf("%s: drift check failed - %v\n", host.Name, err)
+					fmt.Printf("  %v\n", err)
+					failed++
+					run.Failed = append(run.Failed, host.Name)
+					limiter.Release()
 					continue
 				}
 
-				// Count drift
-				driftCount := 0
-				for _, r := range results {
-					if r.HasDrift() {
-						driftCount++
+				checks, wantsKernel := postRebootChecksForHost(inv, host)
+				if wantsKernel {
+					if kv, err := reboot.ReadKernelVersion(ctx, client); err == nil {
+						checks.ExpectedKernel = kv
 					}
 				}
 
-				if driftCount == 0 {
-					fmt.Printf("%s: no drift detected (%d files checked)\n", host.Name, len(results))
-				} else {
-					fmt.Printf("%s: DRIFT DETECTED (%d/%d files)\n", host.Name, driftCount, len(results))
-					for _, r := range results {
-						if r.HasDrift() {
-							fmt.Printf("  - %s: %s\n", r.Path, r.Status)
-							if verbose {
-								switch r.Status {
-								case state.DriftStatusContentChanged:
-									fmt.Printf("      expected hash: %s\n", r.Expected.Hash[:16]+"...")
-									fmt.Printf("      actual hash:   %s\n", r.Actual.Hash[:16]+"...")
-								case state.DriftStatusPermissionsChanged:
-									fmt.Printf("      expected: %s %s:%s\n", r.Expected.Mode, r.Expected.Owner, r.Expected.Group)
-									fmt.Printf("      actual:   %s %s:%s\n", r.Actual.Mode, r.Actual.Owner, r.Actual.Group)
-								}
-							}
-						}
-					}
-					totalDrift += driftCount
+				if _, err := orchestrator.ExecuteReboot(ctx, client, pool, host.Addr, port, host.SSHUser, host.Base, host.KexecReboot, hostWindow); err != nil {
+					fmt.Printf("  Reboot failed: %v\n", err)
+					failed++
+					run.Failed = append(run.Failed, host.Name)
+					limiter.Release()
+					continue
 				}
 
-				// Update state with drift info
-				if saveState {
-					hostState.DriftDetected = driftCount > 0
-					hostState.DriftFiles = nil
-					for _, r := range results {
-						if r.HasDrift() {
-							hostState.DriftFiles = append(hostState.DriftFiles, r.Path)
-						}
-					}
-					hostState.LastDriftCheck = time.Now()
-					if err := stateMgr.WriteState(ctx, client, hostState); err != nil {
-						fmt.Printf("  warning: failed to save state - %v\n", err)
+				client, err = pool.GetWithUser(ctx, host.Addr, port, host.SSHUser)
+				if err == nil {
+					if err := orchestrator.RunPostRebootHook(ctx, client); err != nil {
+						fmt.Printf("  Post-reboot hook failed: %v\n", err)
 					}
 				}
 
-				fmt.Println()
+				reportRebootValidation(ctx, pool, stateMgr, orchestrator, host, port, checks, "", "")
+
+				fmt.Printf("  OK\n")
+				success++
+				run.Completed = append(run.Completed, host.Name)
+				limiter.Release()
 			}
 
-			if totalDrift > 0 {
-				fmt.Printf("Total: %d file(s) with drift detected\n", totalDrift)
-				fmt.Println("Run 'nixfleet drift fix' to remediate drift")
-			} else {
-				fmt.Println("No drift detected across all hosts")
+			run.Remaining = nil
+			if err := store.Save(run); err != nil {
+				fmt.Printf("Warning: failed to save final checkpoint: %v\n", err)
+			}
+
+			fmt.Printf("\nResume complete: %d rebooted, %d failed\n", success, failed)
+			if len(run.Failed) == 0 {
+				if err := store.Remove(runID); err != nil {
+					fmt.Printf("Warning: failed to remove checkpoint: %v\n", err)
+				}
 			}
 
 			return nil
 		},
 	}
-
-	cmd.Flags().BoolVar(&saveState, "save-state", true, "Update host state with drift results")
-
-	return cmd
 }
 
-func driftFixCmd() *cobra.Command {
-	var filesOnly []string
-
-	cmd := &cobra.Command{
-		Use:   "fix",
-		Short: "Remediate configuration drift",
-		Long: `Fix detected drift by restoring files to expected state.
+// removeHostName returns names with target removed, preserving order.
+func removeHostName(names []string, target string) []string {
+	out := names[:0]
+	for _, n := range names {
+		if n != target {
+			out = append(out, n)
+		}
+	}
+	return out
+}
 
-By default, restores permissions on drifted files. For content changes,
-a full re-apply is recommended as file contents come from the Nix store.`,
+func rebootStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Check reboot requirements",
+		Long:  `Check if hosts require a reboot.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			inv, hosts, err := loadInventoryAndHosts(ctx)
 			if err != nil {
 				return err
 			}
 
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
+			orchestrator := reboot.NewOrchestrator(reboot.DefaultRebootConfig())
 			stateMgr := state.NewManager()
 
-			fmt.Printf("Fixing drift on %d host(s)...\n\n", len(hosts))
+			fmt.Printf("Checking reboot status on %d host(s)...\n\n", len(hosts))
+			fmt.Printf("%-20s %-10s %-15s %s\n", "HOST", "BASE", "REBOOT", "REASON")
+			fmt.Printf("%-20s %-10s %-15s %s\n", "----", "----", "------", "------")
 
 			for _, host := range hosts {
 				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 				if err != nil {
-					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
+					fmt.Printf("%-20s %-10s %-15s %s\n", host.Name, host.Base, "error", err.Error())
 					continue
 				}
 
-				// Read current state
-				hostState, err := stateMgr.ReadState(ctx, client)
+				hostState, stateErr := stateMgr.ReadState(ctx, client)
+				if stateErr == nil {
+					if reason, ok := hostState.GetAnnotation(state.AnnotationNoReboot); ok {
+						fmt.Printf("%-20s %-10s %-15s %s\n", host.Name, host.Base, "skipped", "no-reboot: "+reason)
+						continue
+					}
+				}
+
+				status, err := orchestrator.CheckRebootRequired(ctx, client, host.Base)
 				if err != nil {
-					fmt.Printf("%s: failed to read state - %v\n", host.Name, err)
+					fmt.Printf("%-20s %-10s %-15s %s\n", host.Name, host.Base, "error", err.Error())
 					continue
 				}
 
-				if len(hostState.ManagedFiles) == 0 {
-					fmt.Printf("%s: no managed files configured\n", host.Name)
-					continue
+				rebootStr := "no"
+				reason := ""
+				if status.Required {
+					rebootStr = "YES"
+					reason = status.Reason
+					if len(status.TriggerPackages) > 0 {
+						reason += fmt.Sprintf(" (%s)", strings.Join(status.TriggerPackages, ", "))
+					}
 				}
 
-				// Check drift
-				results, err := stateMgr.CheckDrift(ctx, client, hostState.ManagedFiles)
-				if err != nil {
-					fmt.Printf("%s: drift check failed - %v\n", host.Name, err)
-					continue
+				fmt.Printf("%-20s %-10s %-15s %s\n", host.Name, host.Base, rebootStr, reason)
+
+				if stateErr == nil && hostState.LastRebootValidation != nil && !hostState.LastRebootValidation.Passed {
+					var failed []string
+					for _, c := range hostState.LastRebootValidation.Checks {
+						if !c.Passed {
+							failed = append(failed, c.Name)
+						}
+					}
+					fmt.Printf("%20s   REBOOTED WITH ISSUES: %s\n", "", strings.Join(failed, ", "))
 				}
 
-				// Filter results if specific files requested
-				if len(filesOnly) > 0 {
-					filtered := make([]state.DriftResult, 0)
-					fileSet := make(map[string]bool)
-					for _, f := range filesOnly {
-						fileSet[f] = true
-					}
-					for _, r := range results {
-						if fileSet[r.Path] {
-							filtered = append(filtered, r)
-						}
-					}
-					results = filtered
+				if hostWindow, err := rebootWindowForHost(inv, host, ""); err == nil && hostWindow != nil {
+					next := hostWindow.NextWindowStart(time.Now())
+					fmt.Printf("%20s   next window: %s (%s local)\n", "", next.Format("Mon 2006-01-02 15:04 MST"), next.Location())
+					fmt.Printf("%20s                %s (your local)\n", "", next.Local().Format("Mon 2006-01-02 15:04 MST"))
 				}
+			}
 
-				// Fix drift
-				fixed := 0
-				skipped := 0
-				for _, r := range results {
-					if !r.HasDrift() {
-						continue
-					}
+			return nil
+		},
+	}
+}
 
-					if dryRun {
-						fmt.Printf("%s: would fix %s (%s)\n", host.Name, r.Path, r.Status)
-						continue
-					}
+// rebootWindowForHost resolves the reboot window host should reboot in,
+// preferring windowFlag (the --window flag text, shared across the command
+// invocation) and falling back to the host's own os_updates.reboot_window.
+// The window's day/hour/minute are evaluated in host's resolved time zone
+// rather than the operator's, so a shared --window flag still means each
+// host's own local time. Returns nil, nil if no window text applies.
+func rebootWindowForHost(inv *inventory.Inventory, host *inventory.Host, windowFlag string) (*reboot.RebootWindow, error) {
+	windowStr := windowFlag
+	if windowStr == "" {
+		windowStr = host.OSUpdate.RebootWindow
+	}
+	if windowStr == "" {
+		return nil, nil
+	}
 
-					if r.Status == state.DriftStatusContentChanged {
-						fmt.Printf("%s: %s - content changed, run 'nixfleet apply' to restore\n", host.Name, r.Path)
-						skipped++
-						continue
-					}
+	loc, err := inv.LocationForHost(host)
+	if err != nil {
+		return nil, err
+	}
+	w, err := reboot.ParseRebootWindow(windowStr, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", host.Name, err)
+	}
+	return w, nil
+}
 
-					if r.Status == state.DriftStatusMissing {
-						fmt.Printf("%s: %s - file missing, run 'nixfleet apply' to restore\n", host.Name, r.Path)
-						skipped++
-						continue
-					}
+// postRebootChecksForHost builds the reboot.PostRebootChecks host should be
+// validated against after a reboot: its resolved
+// inventory.PostRebootValidationConfig (see Inventory.PostRebootChecksForHost)
+// plus any health probes configured on it or its groups - those always run
+// during validation, independent of whether a PostRebootValidationConfig is
+// set at all. wantsKernelCheck reports whether the caller should read the
+// host's pre-reboot kernel version and set the result on
+// PostRebootChecks.ExpectedKernel before validating.
+func postRebootChecksForHost(inv *inventory.Inventory, host *inventory.Host) (checks reboot.PostRebootChecks, wantsKernelCheck bool) {
+	checks = reboot.PostRebootChecks{Probes: inv.ProbesForHost(host)}
+
+	cfg := inv.PostRebootChecksForHost(host)
+	if cfg == nil {
+		return checks, false
+	}
 
-					// Fix permissions
-					if r.Status == state.DriftStatusPermissionsChanged {
-						if err := stateMgr.FixDrift(ctx, client, r, nil); err != nil {
-							fmt.Printf("%s: failed to fix %s - %v\n", host.Name, r.Path, err)
-							continue
-						}
-						fmt.Printf("%s: fixed permissions on %s\n", host.Name, r.Path)
-						fixed++
-					}
-				}
+	checks.Mounts = cfg.Mounts
+	checks.RAID = cfg.RAID
+	checks.ZFS = cfg.ZFS
+	checks.SystemdTargets = cfg.SystemdTargets
+	checks.NTP = cfg.NTP
+	return checks, cfg.KernelVersion
+}
 
-				if dryRun {
-					continue
-				}
+// reportRebootValidation runs host's post-reboot validation suite once it's
+// reachable again, records the outcome in its state, prints a one-line
+// summary, and posts a webhook when any check failed. It never returns an
+// error: a validation failure is reported, not propagated, so it can't mask
+// the reboot itself having succeeded.
+func reportRebootValidation(ctx context.Context, pool *ssh.Pool, stateMgr *state.Manager, orchestrator *reboot.Orchestrator, host *inventory.Host, port int, checks reboot.PostRebootChecks, webhookURL, webhookSecret string) bool {
+	if !checks.HasChecks() {
+		return true
+	}
 
-				if fixed > 0 || skipped > 0 {
-					fmt.Printf("%s: %d fixed, %d require re-apply\n", host.Name, fixed, skipped)
-				} else {
-					fmt.Printf("%s: no drift to fix\n", host.Name)
-				}
+	client, err := pool.GetWithUser(ctx, host.Addr, port, host.SSHUser)
+	if err != nil {
+		fmt.Printf("  Post-reboot validation skipped: %v\n", err)
+		return true
+	}
 
-				// Update state
-				hostState.DriftDetected = skipped > 0
-				hostState.DriftFiles = nil
-				for _, r := range results {
-					if r.Status == state.DriftStatusContentChanged || r.Status == state.DriftStatusMissing {
-						hostState.DriftFiles = append(hostState.DriftFiles, r.Path)
-					}
-				}
-				hostState.LastDriftCheck = time.Now()
-				if err := stateMgr.WriteState(ctx, client, hostState); err != nil {
-					fmt.Printf("  warning: failed to save state - %v\n", err)
-				}
+	report := orchestrator.ValidatePostReboot(ctx, client, host.Name, checks)
+	if err := stateMgr.RecordRebootValidation(ctx, client, report); err != nil {
+		fmt.Printf("  Warning: failed to record validation result: %v\n", err)
+	}
 
-				fmt.Println()
-			}
+	if report.Passed {
+		fmt.Printf("  Validation: %s\n", report.Summary())
+		return true
+	}
 
-			return nil
-		},
+	var failed []string
+	for _, c := range report.Checks {
+		if !c.Passed {
+			failed = append(failed, fmt.Sprintf("%s (%s)", c.Name, c.Message))
+		}
 	}
+	fmt.Printf("  Validation: %s - FAILED: %s\n", report.Summary(), strings.Join(failed, ", "))
 
-	cmd.Flags().StringSliceVar(&filesOnly, "files", nil, "Only fix specific files")
+	postWebhook(webhookURL, webhookSecret, "reboot-validation-failed", map[string]any{
+		"host":   host.Name,
+		"failed": failed,
+	})
 
-	return cmd
+	return false
 }
 
-func driftStatusCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "status",
-		Short: "Show drift status from cached state",
-		Long:  `Display last known drift status from host state without performing checks.`,
+// checkpointAndRebootSelf handles the one host in a `reboot now` run that
+// turns out to be the machine nixfleet itself runs on: it checkpoints the
+// orchestration to disk, installs a systemd unit that re-invokes
+// `nixfleet reboot resume` on boot, then triggers the reboot without
+// waiting for the host to come back - this process is about to die along
+// with it.
+func checkpointAndRebootSelf(ctx context.Context, client *ssh.Client, host *inventory.Host, window string, maxConcurrent int, kexec bool, completed []string, hostWindow *reboot.RebootWindow, orchestrator *reboot.Orchestrator) error {
+	runID, err := reboot.NewRunID()
+	if err != nil {
+		return err
+	}
+
+	store, err := reboot.NewCheckpointStore()
+	if err != nil {
+		return fmt.Errorf("creating checkpoint store: %w", err)
+	}
+
+	run := &reboot.RunState{
+		RunID:         runID,
+		StartedAt:     time.Now(),
+		Window:        window,
+		MaxConcurrent: maxConcurrent,
+		Kexec:         kexec,
+		Remaining:     []string{host.Name},
+		Completed:     completed,
+		SelfHost:      host.Name,
+	}
+	if err := store.Save(run); err != nil {
+		return fmt.Errorf("checkpointing run: %w", err)
+	}
+
+	nixfleetBin, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("resolving nixfleet binary path: %w", err)
+	}
+
+	if err := reboot.InstallResumeUnit(ctx, client, nixfleetBin, flakePath, inventoryPath, runID); err != nil {
+		return fmt.Errorf("installing resume unit: %w", err)
+	}
+
+	fmt.Printf("Rebooting %s (the machine running nixfleet)...\n", host.Name)
+	fmt.Printf("  Checkpointed run %s; it will resume automatically after boot\n", runID)
+	fmt.Printf("  (or manually: nixfleet reboot resume %s)\n", runID)
+
+	if err := orchestrator.ExecuteSelfReboot(ctx, client, hostWindow); err != nil {
+		return err
+	}
+
+	fmt.Printf("  Reboot scheduled\n")
+	return nil
+}
+
+func rebootNowCmd() *cobra.Command {
+	var window string
+	var preHook, postHook string
+	var maxConcurrent int
+	var waitTimeout time.Duration
+	var force bool
+	var kexec bool
+	var webhookURL, webhookSecret string
+
+	cmd := &cobra.Command{
+		Use:   "now",
+		Short: "Reboot hosts immediately",
+		Long: `Reboot hosts that require a reboot.
+
+Only reboots hosts that have the reboot-required flag set, unless --force is used.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			inv, hosts, err := loadInventoryAndHosts(ctx)
 			if err != nil {
 				return err
 			}
 
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
-			stateMgr := state.NewManager()
+			config := reboot.RebootConfig{
+				AllowReboot:          true,
+				MaxConcurrentReboots: maxConcurrent,
+				PreRebootHook:        preHook,
+				PostRebootHook:       postHook,
+				WaitTimeout:          waitTimeout,
+				WaitInterval:         10 * time.Second,
+				Kexec:                kexec,
+			}
 
-			fmt.Printf("%-20s %-10s %-15s %s\n", "HOST", "DRIFT", "LAST CHECK", "FILES")
-			fmt.Printf("%-20s %-10s %-15s %s\n", "----", "-----", "----------", "-----")
+			orchestrator := reboot.NewOrchestrator(config)
+			limiter := reboot.NewConcurrencyLimiter(maxConcurrent)
+			stateMgr := state.NewManager()
 
+			// First check which hosts need reboot
+			var hostsToReboot []*inventory.Host
 			for _, host := range hosts {
 				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 				if err != nil {
-					fmt.Printf("%-20s %-10s %-15s %s\n", host.Name, "error", "-", err.Error())
+					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
 					continue
 				}
 
-				hostState, err := stateMgr.ReadState(ctx, client)
+				if hostState, err := stateMgr.ReadState(ctx, client); err == nil {
+					if reason, ok := hostState.GetAnnotation(state.AnnotationNoReboot); ok {
+						fmt.Printf("%s: skipped (no-reboot: %s)\n", host.Name, reason)
+						continue
+					}
+				}
+
+				status, err := orchestrator.CheckRebootRequired(ctx, client, host.Base)
 				if err != nil {
-					fmt.Printf("%-20s %-10s %-15s %s\n", host.Name, "error", "-", err.Error())
+					fmt.Printf("%s: check failed - %v\n", host.Name, err)
 					continue
 				}
 
-				driftStr := "no"
-				if hostState.DriftDetected {
-					driftStr = "YES"
+				if status.Required || force {
+					hostsToReboot = append(hostsToReboot, host)
 				}
+			}
 
-				lastCheck := "-"
-				if !hostState.LastDriftCheck.IsZero() {
-					lastCheck = hostState.LastDriftCheck.Format("Jan 02 15:04")
-				}
+			if len(hostsToReboot) == 0 {
+				fmt.Println("No hosts require reboot")
+				return nil
+			}
 
-				filesStr := "-"
-				if len(hostState.DriftFiles) > 0 {
-					filesStr = fmt.Sprintf("%d file(s)", len(hostState.DriftFiles))
-					if verbose {
-						filesStr = strings.Join(hostState.DriftFiles, ", ")
-					}
+			if dryRun {
+				fmt.Printf("Would reboot %d host(s):\n", len(hostsToReboot))
+				for _, h := range hostsToReboot {
+					fmt.Printf("  - %s (%s)\n", h.Name, h.Addr)
 				}
-
-				fmt.Printf("%-20s %-10s %-15s %s\n", host.Name, driftStr, lastCheck, filesStr)
+				return nil
 			}
 
-			return nil
-		},
-	}
-}
-
-func serverCmd() *cobra.Command {
-	var listenAddr string
-	var apiToken string
-	var webhookURL string
-	var webhookSecret string
-	var webhookEvents []string
-	var driftInterval time.Duration
-	var updateInterval time.Duration
-	var healthInterval time.Duration
+			// Order the host running nixfleet itself (if any) last, so a
+			// fleet-wide reboot never kills the orchestration before the
+			// rest of the fleet is handled.
+			hostsToReboot = reboot.OrderSelfLast(ctx, pool, hostsToReboot)
 
-	cmd := &cobra.Command{
-		Use:   "server",
-		Short: "Run NixFleet as an HTTP API server",
-		Long: `Start NixFleet in server mode with a REST API for fleet management.
+			fmt.Printf("Rebooting %d host(s) (max %d concurrent)...\n\n", len(hostsToReboot), maxConcurrent)
 
-The server provides:
-  - REST API for host management, deployment, and drift detection
-  - Scheduled background tasks for drift, update, and health checks
-  - Webhook notifications for events
-  - Job queue for async operations
+			success := 0
+			failed := 0
+			fastRebooted := []string{}
+			fullRebooted := []string{}
+			completed := []string{}
+			withIssues := []string{}
 
-API Endpoints:
-  GET  /api/health           - Server health check
-  GET  /api/info             - Server information
-  GET  /api/hosts            - List all hosts
-  GET  /api/hosts/{name}     - Get host details
-  POST /api/hosts/{name}/apply    - Trigger deployment
-  POST /api/hosts/{name}/rollback - Rollback to previous generation
-  GET  /api/drift            - Drift status for all hosts
-  POST /api/drift/check      - Trigger drift check
-  POST /api/drift/fix        - Fix detected drift
-  GET  /api/plan             - Plan changes for all hosts
-  POST /api/apply            - Apply to all hosts (async)
-  GET  /api/jobs             - List running/completed jobs
-  GET  /api/jobs/{id}        - Get job status`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
+			for _, host := range hostsToReboot {
+				if err := limiter.Acquire(ctx); err != nil {
+					return err
+				}
 
-			// Load inventory
-			inv, err := inventory.LoadFromDir(inventoryPath)
-			if err != nil {
-				inv, err = inventory.LoadFromFile(inventoryPath)
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 				if err != nil {
-					return fmt.Errorf("loading inventory: %w", err)
+					fmt.Printf("Rebooting %s...\n", host.Name)
+					fmt.Printf("  Connection failed: %v\n", err)
+					failed++
+					limiter.Release()
+					continue
 				}
-			}
-
-			if err := inv.Validate(); err != nil {
-				return fmt.Errorf("invalid inventory: %w", err)
-			}
 
-			config := server.Config{
-				ListenAddr:          listenAddr,
-				FlakePath:           flakePath,
-				Inventory:           inv,
-				DriftCheckInterval:  driftInterval,
-				UpdateCheckInterval: updateInterval,
-				HealthCheckInterval: healthInterval,
-				WebhookURL:          webhookURL,
-				WebhookSecret:       webhookSecret,
-				WebhookEvents:       webhookEvents,
-				APIToken:            apiToken,
-			}
+				port := host.SSHPort
+				if port == 0 {
+					port = 22
+				}
 
-			srv, err := server.New(config)
-			if err != nil {
-				return fmt.Errorf("creating server: %w", err)
-			}
-			defer srv.Close()
+				hostWindow, err := rebootWindowForHost(inv, host, window)
+				if err != nil {
+					fmt.Printf("Rebooting %s...\n", host.Name)
+					fmt.Printf("  %v\n", err)
+					failed++
+					limiter.Release()
+					continue
+				}
 
-			return srv.Start(ctx)
-		},
-	}
+				if reboot.IsSelfHost(ctx, client, host) {
+					if err := checkpointAndRebootSelf(ctx, client, host, window, maxConcurrent, kexec, completed, hostWindow, orchestrator); err != nil {
+						fmt.Printf("  Reboot failed: %v\n", err)
+						failed++
+					} else {
+						success++
+					}
+					limiter.Release()
+					continue
+				}
 
-	cmd.Flags().StringVar(&listenAddr, "listen", ":8080", "Address to listen on")
-	cmd.Flags().StringVar(&apiToken, "api-token", "", "API authentication token (optional)")
-	cmd.Flags().StringVar(&webhookURL, "webhook-url", "", "Webhook URL for notifications")
-	cmd.Flags().StringVar(&webhookSecret, "webhook-secret", "", "Webhook secret for signing")
-	cmd.Flags().StringSliceVar(&webhookEvents, "webhook-events", []string{"drift", "apply", "health"}, "Events to send webhooks for")
-	cmd.Flags().DurationVar(&driftInterval, "drift-interval", 0, "Interval for drift checks (e.g., 1h)")
-	cmd.Flags().DurationVar(&updateInterval, "update-interval", 0, "Interval for update checks (e.g., 6h)")
-	cmd.Flags().DurationVar(&healthInterval, "health-interval", 0, "Interval for health checks (e.g., 5m)")
+				fmt.Printf("Rebooting %s...\n", host.Name)
 
-	return cmd
-}
+				checks, wantsKernel := postRebootChecksForHost(inv, host)
+				if wantsKernel {
+					if kv, err := reboot.ReadKernelVersion(ctx, client); err == nil {
+						checks.ExpectedKernel = kv
+					}
+				}
 
-func pullModeCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "pull-mode",
-		Short: "Configure pull-based deployment mode",
-		Long: `Pull mode allows hosts to fetch and apply their own configuration
-from a Git repository, rather than having a central server push changes.
+				method, err := orchestrator.ExecuteReboot(ctx, client, pool, host.Addr, port, host.SSHUser, host.Base, host.KexecReboot, hostWindow)
+				if err != nil {
+					fmt.Printf("  Reboot failed: %v\n", err)
+					failed++
+					limiter.Release()
+					continue
+				}
 
-This is ideal for:
-  - Air-gapped environments
-  - Hosts behind NAT/firewalls
-  - GitOps workflows
-  - Self-managing infrastructure
+				// Run post-reboot hook if host came back
+				client, err = pool.GetWithUser(ctx, host.Addr, port, host.SSHUser)
+				if err == nil {
+					if err := orchestrator.RunPostRebootHook(ctx, client); err != nil {
+						fmt.Printf("  Post-reboot hook failed: %v\n", err)
+					}
+				}
 
-The host will periodically:
-  1. Pull from the configured Git repository
-  2. Build its configuration locally
-  3. Apply changes automatically
-  4. Report status via webhooks (optional)`,
+				if method == reboot.RebootMethodKexec {
+					fmt.Printf("  OK (host is back, kexec)\n")
+					fastRebooted = append(fastRebooted, host.Name)
+				} else {
+					fmt.Printf("  OK (host is back, full reboot)\n")
+					fullRebooted = append(fullRebooted, host.Name)
+				}
+
+				if !reportRebootValidation(ctx, pool, stateMgr, orchestrator, host, port, checks, webhookURL, webhookSecret) {
+					withIssues = append(withIssues, host.Name)
+				}
+
+				success++
+				completed = append(completed, host.Name)
+				limiter.Release()
+			}
+
+			fmt.Printf("\nSummary: %d rebooted, %d failed", success, failed)
+			if len(withIssues) > 0 {
+				fmt.Printf(", %d with validation issues", len(withIssues))
+			}
+			fmt.Println()
+			if len(withIssues) > 0 {
+				fmt.Printf("  With issues:  %s\n", strings.Join(withIssues, ", "))
+			}
+			if len(fastRebooted) > 0 {
+				fmt.Printf("  Fast (kexec):  %s\n", strings.Join(fastRebooted, ", "))
+			}
+			if len(fullRebooted) > 0 {
+				fmt.Printf("  Full reboot:   %s\n", strings.Join(fullRebooted, ", "))
+			}
+
+			if failed > 0 {
+				return exitWithCode(1, fmt.Errorf("%d host(s) failed to reboot", failed))
+			}
+			if len(withIssues) > 0 {
+				return exitWithCode(3, fmt.Errorf("%d host(s) rebooted but failed post-reboot validation", len(withIssues)))
+			}
+			return nil
+		},
 	}
 
-	cmd.AddCommand(pullModeInstallCmd())
-	cmd.AddCommand(pullModeUninstallCmd())
-	cmd.AddCommand(pullModeStatusCmd())
-	cmd.AddCommand(pullModeTriggerCmd())
+	cmd.Flags().StringVar(&window, "window", "", "Reboot window (e.g., 'Sun 02:00-04:00')")
+	cmd.Flags().StringVar(&preHook, "pre-hook", "", "Command to run before reboot")
+	cmd.Flags().StringVar(&postHook, "post-hook", "", "Command to run after reboot")
+	cmd.Flags().BoolVar(&kexec, "kexec", false, "Use kexec to fast-reboot into the current kernel, skipping firmware POST, falling back to a full reboot when unavailable")
+	cmd.Flags().IntVar(&maxConcurrent, "max-concurrent", 1, "Maximum concurrent reboots")
+	cmd.Flags().DurationVar(&waitTimeout, "wait-timeout", 10*time.Minute, "Timeout waiting for host to come back")
+	cmd.Flags().BoolVar(&force, "force", false, "Reboot even if not required")
+	cmd.Flags().StringVar(&webhookURL, "webhook-url", "", "Webhook URL to notify when post-reboot validation fails")
+	cmd.Flags().StringVar(&webhookSecret, "webhook-secret", "", "Webhook secret for signing")
 
 	return cmd
 }
 
-func pullModeInstallCmd() *cobra.Command {
-	var repoURL string
-	var branch string
-	var interval string
-	var sshKeyPath string
-	var ageKeyPath string
-	var applyOnBoot bool
-	var webhookURL string
-	var webhookSecret string
-
-	// Home-manager options
-	var hmUser string
-	var hmDotfilesPath string
-	var hmBranch string
-	var hmSSHKey string
-	var hmConfigName string
+func runCmd() *cobra.Command {
+	var timeout time.Duration
+	var hostTimeout time.Duration
+	var timeoutGrace time.Duration
+	var become bool
+	var becomeUser string
+	var envVars []string
+	var varOverrides []string
+	var chdir string
+	var shell string
 
 	cmd := &cobra.Command{
-		Use:   "install",
-		Short: "Install pull mode on hosts",
-		Long: `Install and configure pull mode on target hosts.
+		Use:   "run [command] [-- args...]",
+		Short: "Run ad-hoc commands on hosts",
+		Long: `Execute commands on target hosts.
 
-This will:
-  1. Set up SSH config for Git repository access
-  2. Clone the configuration repository
-  3. Install the nixfleet-pull script
-  4. Create and enable systemd timer for periodic pulls
-  5. Optionally sync home-manager dotfiles (use --hm-* flags)
+By default the command runs as the SSH user via /bin/sh -c "<args joined
+with spaces>", so a single quoted argument works as it always has:
 
-Example:
-  nixfleet pull-mode install -H gtr --repo git@github.com:org/fleet-config.git
+  nixfleet run "systemctl restart nginx"
 
-With home-manager:
-  nixfleet pull-mode install -H gtr --repo git@github.com:org/fleet-config.git \
-    --hm-user ztaylor --hm-dotfiles-path /home/ztaylor/dotfiles/nix \
-    --hm-branch main --hm-config-name "ztaylor@x86_64-linux"`,
+--become / --become-user run it under sudo, --env sets environment
+variables (passed via an "env KEY=VALUE ..." prefix, not shell
+interpolation), --chdir changes directory first, and --shell none combined
+with "--" avoids the shell entirely by quoting each argument individually:
+
+  nixfleet run --become-user postgres --shell none -- psql -c "select 1"
+
+Each argument is expanded as a Go template against the host's resolved
+variables (its own Host.Vars, with group vars merged in - see
+Inventory.ResolvedVarsForHost) before the command is built, so the same
+invocation can vary per host:
+
+  nixfleet run "echo {{ .Vars.datacenter }}"
+
+--var key=value overrides (or adds) a variable for every host in this run,
+taking precedence over both the host's and its groups' vars.
+
+--host-timeout bounds each host's own command independently, so one wedged
+host is reported as timed out without affecting the others. --timeout is
+the overall deadline for the run: once it passes, hosts that haven't
+started yet are skipped (reported separately from failures) while hosts
+already in flight get --timeout-grace more time to finish before being
+cancelled too.`,
+		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			if repoURL == "" {
-				return fmt.Errorf("--repo is required")
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
 			}
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			env, err := parseEnvFlags(envVars)
 			if err != nil {
 				return err
 			}
-
-			if len(hosts) == 0 {
-				return fmt.Errorf("no hosts selected")
-			}
-
-			defaults := pullmode.DefaultConfig()
-			config := pullmode.Config{
-				RepoURL:       repoURL,
-				Branch:        branch,
-				SSHKeyPath:    sshKeyPath,
-				AgeKeyPath:    ageKeyPath,
-				Interval:      interval,
-				ApplyOnBoot:   applyOnBoot,
-				RepoPath:      defaults.RepoPath,
-				WebhookURL:    webhookURL,
-				WebhookSecret: webhookSecret,
-			}
-
-			if config.Branch == "" {
-				config.Branch = defaults.Branch
-			}
-			if config.SSHKeyPath == "" {
-				config.SSHKeyPath = defaults.SSHKeyPath
-			}
-			if config.AgeKeyPath == "" {
-				config.AgeKeyPath = defaults.AgeKeyPath
-			}
-			if config.Interval == "" {
-				config.Interval = defaults.Interval
+			overrides, err := parseEnvFlags(varOverrides)
+			if err != nil {
+				return err
 			}
 
-			// Configure home-manager if user is specified
-			if hmUser != "" {
-				config.HomeManager = &pullmode.HomeManagerConfig{
-					User:         hmUser,
-					DotfilesPath: hmDotfilesPath,
-					Branch:       hmBranch,
-					SSHKeyPath:   hmSSHKey,
-					ConfigName:   hmConfigName,
-				}
-				// Set defaults for home-manager
-				if config.HomeManager.Branch == "" {
-					config.HomeManager.Branch = "main"
-				}
-				if config.HomeManager.DotfilesPath == "" {
-					config.HomeManager.DotfilesPath = "/home/" + hmUser + "/dotfiles/nix"
-				}
-				if config.HomeManager.ConfigName == "" {
-					config.HomeManager.ConfigName = hmUser + "@x86_64-linux"
-				}
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
 			}
 
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
-			installer := pullmode.NewInstaller()
-
-			fmt.Printf("Installing pull mode on %d host(s)...\n\n", len(hosts))
+			executor := ssh.NewExecutor(pool, maxParallel)
+			executor.SetHostTimeout(hostTimeout, timeoutGrace)
 
-			var failed int
-			for _, host := range hosts {
-				fmt.Printf("%s: ", host.Name)
+			fmt.Printf("Running on %d host(s): %s\n", len(hosts), strings.Join(args, " "))
+			fmt.Println()
 
-				if dryRun {
-					fmt.Println("would install pull mode")
-					continue
+			var outMu sync.Mutex
+			results := executor.RunFunc(ctx, hosts, func(hostCtx context.Context, client *ssh.Client, host *inventory.Host) error {
+				renderedArgs, err := renderRunArgs(args, inv, host, overrides)
+				if err != nil {
+					return err
 				}
 
-				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				rc := &ssh.RemoteCommand{
+					Args:       renderedArgs,
+					Become:     become,
+					BecomeUser: becomeUser,
+					Env:        env,
+					Chdir:      chdir,
+					Shell:      ssh.ShellMode(shell),
+				}
+				remoteCmd, err := rc.Build()
 				if err != nil {
-					fmt.Printf("connection failed - %v\n", err)
-					failed++
-					continue
+					return err
 				}
 
-				// Set host name for this installation
-				hostConfig := config
-				hostConfig.HostName = host.Name
+				var result *ssh.ExecResult
+				if become || becomeUser != "" {
+					result, err = client.ExecSudo(hostCtx, remoteCmd)
+				} else {
+					result, err = client.Exec(hostCtx, remoteCmd)
+				}
 
-				if err := installer.Install(ctx, client, hostConfig); err != nil {
-					fmt.Printf("failed - %v\n", err)
-					failed++
-					continue
+				var buf strings.Builder
+				fmt.Fprintf(&buf, "=== %s (as %s) ===\n", host.Name, rc.EffectiveUser(host.SSHUser))
+				if verbose {
+					fmt.Fprintf(&buf, "remote command: %s\n", remoteCmd)
+				}
+				switch {
+				case err != nil:
+					fmt.Fprintf(&buf, "ERROR: %v\n", err)
+				default:
+					if result.Stdout != "" {
+						fmt.Fprint(&buf, result.Stdout)
+					}
+					if result.Stderr != "" {
+						fmt.Fprintf(&buf, "stderr: %s", result.Stderr)
+					}
+					if result.ExitCode != 0 {
+						fmt.Fprintf(&buf, "exit code: %d\n", result.ExitCode)
+					}
 				}
+				fmt.Fprintln(&buf)
 
-				fmt.Println("OK")
-			}
+				outMu.Lock()
+				fmt.Print(buf.String())
+				outMu.Unlock()
 
-			if failed > 0 {
-				return fmt.Errorf("%d host(s) failed", failed)
-			}
+				if err != nil {
+					return err
+				}
+				if result.ExitCode != 0 {
+					return fmt.Errorf("exit code %d", result.ExitCode)
+				}
+				return nil
+			})
 
-			fmt.Printf("\nPull mode installed successfully. Hosts will pull every %s.\n", interval)
-			if hmUser != "" {
-				fmt.Printf("Home-manager sync enabled for user '%s' (dotfiles: %s)\n", hmUser, config.HomeManager.DotfilesPath)
+			// RunFunc never calls the per-host func for a host that was
+			// skipped or killed before it got a turn, so those don't have
+			// the "=== host ===" block above printed for them yet.
+			for _, r := range results {
+				switch {
+				case r.NeverStarted:
+					fmt.Printf("=== %s ===\nSKIPPED: %v\n\n", r.Host.Name, r.Error)
+				case r.TimedOut:
+					fmt.Printf("=== %s ===\nTIMED OUT: %v\n\n", r.Host.Name, r.Error)
+				}
 			}
+
+			fmt.Printf("Success: %d, Failed: %d, Timed out: %d, Never started: %d\n",
+				ssh.CountSuccess(results), ssh.CountErrors(results), ssh.CountTimedOut(results), ssh.CountNeverStarted(results))
+
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&repoURL, "repo", "", "Git repository URL (SSH format, e.g., git@github.com:org/repo.git)")
-	cmd.Flags().StringVar(&branch, "branch", "main", "Branch to track")
-	cmd.Flags().StringVar(&interval, "interval", "15min", "Pull interval (systemd timer format)")
-	cmd.Flags().StringVar(&sshKeyPath, "ssh-key", "/run/nixfleet-secrets/github-deploy-key", "Path to SSH key for Git access")
-	cmd.Flags().StringVar(&ageKeyPath, "age-key", "/root/.config/age/key.txt", "Path to age key for secrets")
-	cmd.Flags().BoolVar(&applyOnBoot, "apply-on-boot", true, "Apply configuration on boot")
-	cmd.Flags().StringVar(&webhookURL, "webhook-url", "", "Webhook URL for status notifications")
-	cmd.Flags().StringVar(&webhookSecret, "webhook-secret", "", "Webhook secret for signing")
-
-	// Home-manager flags
-	cmd.Flags().StringVar(&hmUser, "hm-user", "", "Username to run home-manager as (enables home-manager sync)")
-	cmd.Flags().StringVar(&hmDotfilesPath, "hm-dotfiles-path", "", "Path to dotfiles repository (default: /home/<user>/dotfiles/nix)")
-	cmd.Flags().StringVar(&hmBranch, "hm-branch", "main", "Branch to track for dotfiles")
-	cmd.Flags().StringVar(&hmSSHKey, "hm-ssh-key", "", "Path to SSH key for dotfiles repo access")
-	cmd.Flags().StringVar(&hmConfigName, "hm-config-name", "", "Home-manager flake config name (default: <user>@x86_64-linux)")
-
-	cmd.MarkFlagRequired("repo")
+	cmd.Flags().DurationVar(&timeout, "timeout", 2*time.Minute, "Overall deadline for the run across all hosts")
+	cmd.Flags().DurationVar(&hostTimeout, "host-timeout", 90*time.Second, "Per-host command timeout; a wedged host is killed and reported without affecting the others")
+	cmd.Flags().DurationVar(&timeoutGrace, "timeout-grace", 15*time.Second, "Extra time an in-flight host gets to finish after --timeout is reached, before it's cancelled too")
+	cmd.Flags().BoolVar(&become, "become", false, "Run the command via sudo")
+	cmd.Flags().StringVar(&becomeUser, "become-user", "", "Run the command via sudo -u <user> (implies --become)")
+	cmd.Flags().StringArrayVar(&envVars, "env", nil, "Environment variable to set, as KEY=VALUE (repeatable)")
+	cmd.Flags().StringArrayVar(&varOverrides, "var", nil, "Override or add a host variable for this run, as KEY=VALUE (repeatable); takes precedence over inventory vars")
+	cmd.Flags().StringVar(&chdir, "chdir", "", "Change to this directory before running the command")
+	cmd.Flags().StringVar(&shell, "shell", "sh", "How to run the command: bash, sh, or none (exec args directly, no shell wrapping)")
 
 	return cmd
 }
 
-func pullModeUninstallCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "uninstall",
-		Short: "Remove pull mode from hosts",
-		Long:  `Stop and remove pull mode configuration from target hosts.`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
+// runTemplateData is the template root object each of 'nixfleet run's
+// command arguments is rendered against, so "{{ .Vars.datacenter }}"
+// resolves to that host's merged variables.
+type runTemplateData struct {
+	Vars map[string]string
+}
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
-			if err != nil {
-				return err
-			}
+// renderRunArgs expands each of args as a Go template against host's
+// resolved variables (inv.ResolvedVarsForHost, with overrides applied on
+// top with the highest precedence), for 'nixfleet run's per-host
+// templating.
+func renderRunArgs(args []string, inv *inventory.Inventory, host *inventory.Host, overrides map[string]string) ([]string, error) {
+	vars, err := inv.ResolvedVarsForHost(host)
+	if err != nil {
+		return nil, fmt.Errorf("resolving vars: %w", err)
+	}
+	for k, v := range overrides {
+		vars[k] = v
+	}
+	data := runTemplateData{Vars: vars}
 
-			if len(hosts) == 0 {
-				return fmt.Errorf("no hosts selected")
-			}
+	rendered := make([]string, len(args))
+	for i, a := range args {
+		tmpl, err := template.New("arg").Parse(a)
+		if err != nil {
+			return nil, fmt.Errorf("parsing template %q: %w", a, err)
+		}
+		var buf strings.Builder
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("expanding template %q for host %s: %w", a, host.Name, err)
+		}
+		rendered[i] = buf.String()
+	}
+	return rendered, nil
+}
 
-			pool := ssh.NewPool(nil)
-			defer pool.Close()
+// parseEnvFlags parses --env KEY=VALUE flags into a map, rejecting any entry
+// without an '=' rather than silently dropping it.
+func parseEnvFlags(vars []string) (map[string]string, error) {
+	if len(vars) == 0 {
+		return nil, nil
+	}
+	env := make(map[string]string, len(vars))
+	for _, v := range vars {
+		k, val, ok := strings.Cut(v, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid --env %q, want KEY=VALUE", v)
+		}
+		env[k] = val
+	}
+	return env, nil
+}
 
-			installer := pullmode.NewInstaller()
+func cacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage binary cache",
+		Long: `Manage Nix binary cache for faster deployments.
 
-			fmt.Printf("Uninstalling pull mode from %d host(s)...\n\n", len(hosts))
+Subcommands:
+  push         - Push store paths to cache
+  configure    - Configure hosts to use cache
+  keygen       - Generate signing keys
+  test         - Test cache reachability and latency from a host
+  rotate-key   - Generate a new signing key and re-sign cache paths
+  retire-key   - Verify and drop a retired signing key from host configs`,
+	}
 
-			var failed int
-			for _, host := range hosts {
-				fmt.Printf("%s: ", host.Name)
+	cmd.AddCommand(cachePushCmd())
+	cmd.AddCommand(cacheConfigureCmd())
+	cmd.AddCommand(cacheKeygenCmd())
+	cmd.AddCommand(cacheTestCmd())
+	cmd.AddCommand(cacheRotateKeyCmd())
+	cmd.AddCommand(cacheRetireKeyCmd())
 
-				if dryRun {
-					fmt.Println("would uninstall pull mode")
-					continue
-				}
+	return cmd
+}
 
-				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
-				if err != nil {
-					fmt.Printf("connection failed - %v\n", err)
-					failed++
-					continue
-				}
+func cachePushCmd() *cobra.Command {
+	var cacheURL string
+	var secretKey string
 
-				if err := installer.Uninstall(ctx, client); err != nil {
-					fmt.Printf("failed - %v\n", err)
-					failed++
-					continue
-				}
+	cmd := &cobra.Command{
+		Use:   "push [store-path]",
+		Short: "Push store path to cache",
+		Long:  `Push a Nix store path and its dependencies to the binary cache.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			storePath := args[0]
 
-				fmt.Println("OK")
+			if cacheURL == "" {
+				return fmt.Errorf("--cache-url is required")
+			}
+			if secretKey == "" {
+				return fmt.Errorf("--secret-key is required")
 			}
 
-			if failed > 0 {
-				return fmt.Errorf("%d host(s) failed", failed)
+			signing := &cache.SigningConfig{SecretKey: secretKey}
+			mgr := cache.NewManager(nil, signing)
+
+			fmt.Printf("Pushing %s to %s...\n", storePath, cacheURL)
+
+			if dryRun {
+				fmt.Println("Would push (dry-run)")
+				return nil
 			}
 
+			if offline {
+				fmt.Println("skipped: offline (cache push requires network access)")
+				return nil
+			}
+
+			if err := mgr.PushToCache(ctx, storePath, cacheURL); err != nil {
+				return fmt.Errorf("push failed: %w", err)
+			}
+
+			fmt.Println("Done!")
 			return nil
 		},
 	}
 
+	cmd.Flags().StringVar(&cacheURL, "cache-url", defaultCacheURL(), "Cache URL (e.g., s3://bucket or ssh://host)")
+	cmd.Flags().StringVar(&secretKey, "secret-key", "", "Path to signing secret key")
+
 	return cmd
 }
 
-func pullModeStatusCmd() *cobra.Command {
+// parseCacheFlag parses one --cache flag value into a cache.CacheConfig.
+// The syntax is semicolon-separated key=value fields, e.g.
+// "url=https://cache.example.com;priority=10;key=cache1:AbC...;auth-secret=secrets/cache1.age",
+// with "key" repeatable for caches that publish more than one signing key.
+func parseCacheFlag(spec string) (cache.CacheConfig, error) {
+	var cfg cache.CacheConfig
+	for _, field := range strings.Split(spec, ";") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			return cache.CacheConfig{}, fmt.Errorf("invalid --cache field %q, want key=value", field)
+		}
+		switch k {
+		case "url":
+			cfg.URL = v
+		case "priority":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return cache.CacheConfig{}, fmt.Errorf("invalid priority %q: %w", v, err)
+			}
+			cfg.Priority = n
+		case "key":
+			cfg.PublicKeys = append(cfg.PublicKeys, v)
+		case "auth-secret":
+			cfg.AuthSecretPath = v
+		default:
+			return cache.CacheConfig{}, fmt.Errorf("unknown --cache field %q", k)
+		}
+	}
+	if cfg.URL == "" {
+		return cache.CacheConfig{}, fmt.Errorf("--cache %q is missing url=", spec)
+	}
+	return cfg, nil
+}
+
+func cacheConfigureCmd() *cobra.Command {
+	var cacheURL string
+	var publicKeys []string
+	var caches []string
+	var identities []string
+
 	cmd := &cobra.Command{
-		Use:   "status",
-		Short: "Show pull mode status on hosts",
-		Long:  `Display pull mode status including last run, next scheduled run, and current commit.`,
+		Use:   "configure",
+		Short: "Configure hosts to use cache",
+		Long: `Configure remote hosts to substitute from one or more binary caches.
+
+A single cache can still be given with --cache-url/--public-key. For
+multiple caches with failover priority (and optionally per-cache
+authentication), repeat --cache, e.g.:
+
+  nixfleet cache configure \
+    --cache "url=https://cache.internal;priority=0;key=internal-1:AbC...;auth-secret=secrets/cache-internal.age" \
+    --cache "url=s3://fleet-cache;priority=10;key=fleet-1:XyZ..."
+
+Lower priority is tried first; nix falls back to the next substituter on
+its own if one is unreachable.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			inv, hosts, err := loadInventoryAndHosts(ctx)
 			if err != nil {
 				return err
 			}
 
-			if len(hosts) == 0 {
-				return fmt.Errorf("no hosts selected")
+			var cacheConfigs []cache.CacheConfig
+			for _, spec := range caches {
+				cfg, err := parseCacheFlag(spec)
+				if err != nil {
+					return err
+				}
+				cacheConfigs = append(cacheConfigs, cfg)
 			}
+			if cacheURL != "" {
+				cacheConfigs = append(cacheConfigs, cache.CacheConfig{URL: cacheURL, PublicKeys: publicKeys})
+			}
+			if len(cacheConfigs) == 0 {
+				return fmt.Errorf("at least one of --cache or --cache-url is required")
+			}
+
+			mgr := cache.NewManager(cacheConfigs, nil)
+			mgr.SetSecretsManager(secrets.NewManager(secrets.EncryptionAge, identities, nil))
+			stateMgr := state.NewManager()
 
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
-			installer := pullmode.NewInstaller()
-
-			fmt.Printf("Pull mode status for %d host(s):\n\n", len(hosts))
+			fmt.Printf("Configuring cache on %d host(s)...\n\n", len(hosts))
 
 			for _, host := range hosts {
-				fmt.Printf("%s:\n", host.Name)
-
 				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 				if err != nil {
-					fmt.Printf("  Connection failed: %v\n\n", err)
+					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
 					continue
 				}
 
-				status, err := installer.Status(ctx, client)
+				path, hash, err := mgr.ConfigureHostCache(ctx, client, host.Base)
 				if err != nil {
-					fmt.Printf("  Status check failed: %v\n\n", err)
+					fmt.Printf("%s: failed - %v\n", host.Name, err)
 					continue
 				}
 
-				if !status.Installed {
-					fmt.Println("  Pull mode: not installed")
-				} else {
-					fmt.Println("  Pull mode: installed")
-					if status.TimerActive {
-						fmt.Println("  Timer: active")
-					} else {
-						fmt.Println("  Timer: inactive")
-					}
-					fmt.Printf("  Last run: %s", status.LastRun)
-					fmt.Printf("  Last result: %s", status.LastResult)
-					fmt.Printf("  Next run: %s", status.NextRun)
-					fmt.Printf("  Current commit: %s", status.CurrentCommit)
+				if err := stateMgr.UpdateManagedFile(ctx, client, state.FileState{Path: path, Hash: hash}); err != nil {
+					fmt.Printf("%s: OK, but failed to record managed file - %v\n", host.Name, err)
+					continue
 				}
-				fmt.Println()
+
+				fmt.Printf("%s: OK\n", host.Name)
 			}
 
 			return nil
 		},
 	}
 
+	cmd.Flags().StringVar(&cacheURL, "cache-url", "", "Single cache URL (for one cache; use --cache for multiple)")
+	cmd.Flags().StringSliceVar(&publicKeys, "public-key", nil, "Trusted public keys for --cache-url")
+	cmd.Flags().StringArrayVar(&caches, "cache", nil, "A cache as url=...;priority=N;key=...;auth-secret=... (repeatable)")
+	cmd.Flags().StringSliceVarP(&identities, "identity", "i", defaultIdentities(), "Age identity file(s) for decrypting --cache auth-secret entries")
+
 	return cmd
 }
 
-func pullModeTriggerCmd() *cobra.Command {
+func cacheTestCmd() *cobra.Command {
+	var cacheURL string
+	var publicKeys []string
+	var caches []string
+
 	cmd := &cobra.Command{
-		Use:   "trigger",
-		Short: "Manually trigger a pull operation",
-		Long:  `Immediately trigger a pull and apply operation on target hosts.`,
+		Use:   "test",
+		Short: "Test cache reachability and latency from a host",
+		Long: `From each target host, fetch nix-cache-info from every configured cache
+and report whether it's reachable and how long it took, so failover
+priority can be verified before an outage forces it.
+
+Takes the same --cache/--cache-url flags as 'cache configure'; use -H to
+target a single host.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			inv, hosts, err := loadInventoryAndHosts(ctx)
 			if err != nil {
 				return err
 			}
 
-			if len(hosts) == 0 {
-				return fmt.Errorf("no hosts selected")
+			var cacheConfigs []cache.CacheConfig
+			for _, spec := range caches {
+				cfg, err := parseCacheFlag(spec)
+				if err != nil {
+					return err
+				}
+				cacheConfigs = append(cacheConfigs, cfg)
+			}
+			if cacheURL != "" {
+				cacheConfigs = append(cacheConfigs, cache.CacheConfig{URL: cacheURL, PublicKeys: publicKeys})
+			}
+			if len(cacheConfigs) == 0 {
+				return fmt.Errorf("at least one of --cache or --cache-url is required")
 			}
 
+			mgr := cache.NewManager(cacheConfigs, nil)
+
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
-			installer := pullmode.NewInstaller()
-
-			fmt.Printf("Triggering pull on %d host(s)...\n\n", len(hosts))
-
-			var failed int
 			for _, host := range hosts {
-				fmt.Printf("%s: ", host.Name)
-
-				if dryRun {
-					fmt.Println("would trigger pull")
-					continue
-				}
+				fmt.Printf("%s:\n", host.Name)
 
 				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 				if err != nil {
-					fmt.Printf("connection failed - %v\n", err)
-					failed++
+					fmt.Printf("  connection failed - %v\n", err)
 					continue
 				}
 
-				if err := installer.TriggerPull(ctx, client); err != nil {
-					fmt.Printf("failed - %v\n", err)
-					failed++
+				results, err := mgr.TestCaches(ctx, client)
+				if err != nil {
+					fmt.Printf("  test failed - %v\n", err)
 					continue
 				}
 
-				fmt.Println("triggered")
-			}
-
-			if failed > 0 {
-				return fmt.Errorf("%d host(s) failed", failed)
+				for _, r := range results {
+					switch {
+					case r.Reachable:
+						fmt.Printf("  [priority %d] %s: reachable (%dms)\n", r.Priority, r.URL, r.LatencyMS)
+					default:
+						fmt.Printf("  [priority %d] %s: unreachable - %s\n", r.Priority, r.URL, r.Error)
+					}
+				}
 			}
 
-			fmt.Println("\nPull operations triggered. Use 'nixfleet pull-mode status' to check progress.")
 			return nil
 		},
 	}
 
+	cmd.Flags().StringVar(&cacheURL, "cache-url", "", "Single cache URL (for one cache; use --cache for multiple)")
+	cmd.Flags().StringSliceVar(&publicKeys, "public-key", nil, "Trusted public keys for --cache-url")
+	cmd.Flags().StringArrayVar(&caches, "cache", nil, "A cache as url=...;priority=N;key=...;auth-secret=... (repeatable)")
+
 	return cmd
 }
 
-func hostCmd() *cobra.Command {
+func cacheKeygenCmd() *cobra.Command {
+	var keyName string
+	var outputDir string
+
 	cmd := &cobra.Command{
-		Use:   "host",
-		Short: "Host management commands",
-		Long: `Commands for managing hosts in the fleet.
+		Use:   "keygen",
+		Short: "Generate signing key pair",
+		Long:  `Generate a new Nix signing key pair for binary cache.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 
-Subcommands:
-  onboard  - Onboard a new host (get age key, setup secrets, install pull mode)`,
+			if keyName == "" {
+				return fmt.Errorf("--name is required")
+			}
+			if outputDir == "" {
+				outputDir = "."
+			}
+
+			fmt.Printf("Generating signing key '%s'...\n", keyName)
+
+			signing, err := cache.GenerateSigningKey(ctx, keyName, outputDir)
+			if err != nil {
+				return fmt.Errorf("keygen failed: %w", err)
+			}
+
+			fmt.Printf("Secret key: %s\n", signing.SecretKey)
+			fmt.Printf("Public key: %s\n", signing.PublicKey)
+			fmt.Println("\nAdd the public key to your cache configuration.")
+
+			return nil
+		},
 	}
 
-	cmd.AddCommand(hostOnboardCmd())
+	cmd.Flags().StringVar(&keyName, "name", "", "Key name (e.g., 'myorg-cache-1')")
+	cmd.Flags().StringVar(&outputDir, "output", ".", "Output directory for key files")
 
 	return cmd
 }
 
-func hostOnboardCmd() *cobra.Command {
-	var secretsNixPath string
-	var secretsDir string
-	var repoURL string
-	var branch string
-	var interval string
-	var skipPullMode bool
-	var skipRekey bool
-	var outputSecretsNix bool
-
-	cmd := &cobra.Command{
-		Use:   "onboard",
-		Short: "Onboard a new host to the fleet",
-		Long: `Onboard a new host by performing the following steps:
+// deployedStorePaths collects every store path currently or historically
+// deployed to the fleet's hosts - HostState.StorePath and
+// HostState.Generations[].StorePath - by reading each reachable host's
+// state.json over SSH. It's the default --scope for cache rotate-key and
+// retire-key: the paths substitution actually depends on, as opposed to
+// everything that happens to sit in the cache.
+func deployedStorePaths(ctx context.Context, inv *inventory.Inventory, hosts []*inventory.Host) ([]string, error) {
+	pool := ssh.NewPool(nil)
+	_, _ = pool.EnableSSHConfig(inv)
+	defer pool.Close()
+
+	stateMgr := state.NewManager()
+	seen := make(map[string]bool)
+	var paths []string
+
+	for _, host := range hosts {
+		client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+		if err != nil {
+			fmt.Printf("%s: connection failed - %v\n", host.Name, err)
+			continue
+		}
 
-1. Get the host's SSH host key and convert to age public key
-2. Display what to add to secrets.nix (or output in copy-paste format)
-3. Optionally rekey all secrets to include the new host
-4. Optionally install pull mode for GitOps deployments
+		hostState, err := stateMgr.ReadState(ctx, client)
+		if err != nil {
+			fmt.Printf("%s: failed to read state - %v\n", host.Name, err)
+			continue
+		}
 
-Prerequisites:
-  - Host must be bootstrapped (run bootstrap-ubuntu.sh first)
-  - Host must be in your inventory file
-  - SSH access must be configured
+		if hostState.StorePath != "" && !seen[hostState.StorePath] {
+			seen[hostState.StorePath] = true
+			paths = append(paths, hostState.StorePath)
+		}
+		for _, g := range hostState.Generations {
+			if g.StorePath != "" && !seen[g.StorePath] {
+				seen[g.StorePath] = true
+				paths = append(paths, g.StorePath)
+			}
+		}
+	}
 
-Example:
-  # Onboard a new host with full setup
-  nixfleet host onboard -H newhost --repo git@github.com:org/fleet-hosts.git
+	sort.Strings(paths)
+	return paths, nil
+}
 
-  # Just get the age key (for manual setup)
-  nixfleet host onboard -H newhost --skip-pull-mode --skip-rekey
+func cacheRotateKeyCmd() *cobra.Command {
+	var keyName string
+	var outputDir string
+	var cacheURL string
+	var oldPublicKey string
+	var scope string
+	var explicitPaths []string
 
-  # Output secrets.nix snippet for copy-paste
-  nixfleet host onboard -H newhost --output-secrets-nix`,
+	cmd := &cobra.Command{
+		Use:   "rotate-key",
+		Short: "Generate a new signing key and re-sign cache paths",
+		Long: `Generate a new Nix signing keypair and re-sign existing cache contents
+with it, without breaking substitution for hosts that haven't yet been told
+to trust the new key.
+
+--scope controls which paths get re-signed:
+  deployed (default) - every store path currently or historically deployed
+                        to a fleet host, gathered from each host's state.json
+  all                 - every path the cache can enumerate via
+                        'nix path-info --all' (not every cache backend
+                        supports this)
+Pass --path (repeatable) instead to re-sign an explicit list.
+
+The report lists every path attempted and whether signing succeeded, plus
+the ordered [old-key, new-key] list 'cache configure --cache
+...;key=...;key=...' needs so hosts trust both during the transition. Use
+--dry-run to see the path list and key ordering without generating a key or
+touching the cache.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
-			if err != nil {
-				return err
+			if keyName == "" {
+				return fmt.Errorf("--name is required")
 			}
-
-			if len(hosts) == 0 {
-				return fmt.Errorf("no hosts selected. Use -H to specify a host")
+			if cacheURL == "" {
+				return fmt.Errorf("--cache-url is required")
+			}
+			if outputDir == "" {
+				outputDir = "."
 			}
 
-			if len(hosts) > 1 {
-				return fmt.Errorf("onboard operates on one host at a time. Found %d hosts", len(hosts))
+			var paths []string
+			switch {
+			case len(explicitPaths) > 0:
+				paths = explicitPaths
+			case scope == "all":
+				if offline {
+					return fmt.Errorf("skipped: offline (--scope all requires network access)")
+				}
+				listed, err := cache.ResolveAllCachePaths(ctx, cacheURL)
+				if err != nil {
+					return fmt.Errorf("resolving --scope all paths: %w", err)
+				}
+				paths = listed
+			case scope == "deployed":
+				inv, hosts, err := loadInventoryAndHosts(ctx)
+				if err != nil {
+					return err
+				}
+				paths, err = deployedStorePaths(ctx, inv, hosts)
+				if err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("--scope must be \"deployed\" or \"all\"")
 			}
 
-			host := hosts[0]
-			fmt.Printf("Onboarding host: %s (%s)\n\n", host.Name, host.Addr)
+			if len(paths) == 0 {
+				fmt.Println("No store paths to re-sign.")
+				return nil
+			}
 
-			// Step 1: Get age public key from SSH host key
-			fmt.Println("Step 1: Getting age public key from SSH host key...")
+			fmt.Printf("Rotating to key %q: %d path(s) to re-sign\n", keyName, len(paths))
 
-			port := host.SSHPort
-			if port == 0 {
-				port = 22
+			result, err := cache.RotateKey(ctx, cache.RotateKeyOptions{
+				KeyName:      keyName,
+				OutputDir:    outputDir,
+				CacheURL:     cacheURL,
+				OldPublicKey: oldPublicKey,
+				StorePaths:   paths,
+				DryRun:       dryRun,
+			})
+			if err != nil {
+				return fmt.Errorf("rotate-key failed: %w", err)
 			}
 
-			ageKey, err := secrets.GetHostAgeKeyFromRemote(ctx, host.Addr, host.SSHUser, port)
-			if err != nil {
-				return fmt.Errorf("failed to get age key: %w", err)
+			if dryRun {
+				fmt.Println("Dry run - no key generated, no paths signed.")
+			} else {
+				fmt.Printf("New secret key: %s\n", result.NewKey.SecretKey)
+				fmt.Printf("New public key: %s\n", result.NewKey.PublicKey)
 			}
 
-			fmt.Printf("  Age public key: %s\n\n", ageKey)
+			failed := 0
+			for _, p := range result.Paths {
+				switch {
+				case dryRun:
+					fmt.Printf("  would sign: %s\n", p.StorePath)
+				case p.Signed:
+					fmt.Printf("  signed: %s\n", p.StorePath)
+				default:
+					failed++
+					fmt.Printf("  FAILED: %s - %s\n", p.StorePath, p.Error)
+				}
+			}
 
-			// Step 2: Show secrets.nix addition
-			fmt.Println("Step 2: secrets.nix configuration")
+			fmt.Println("\nTrust both keys during the transition:")
+			for _, k := range result.TrustedKeys {
+				fmt.Printf("  %s\n", k)
+			}
 
-			if outputSecretsNix {
-				// Output in copy-paste format
-				fmt.Println("Add to your secrets.nix hosts section:")
-				fmt.Println("```nix")
-				fmt.Printf("  %s = \"%s\";\n", host.Name, ageKey)
-				fmt.Println("```")
-				fmt.Println()
-				fmt.Println("Then add secrets access:")
-				fmt.Println("```nix")
-				fmt.Printf("  \"your-secret.age\".publicKeys = allAdmins ++ [ hosts.%s ];\n", host.Name)
-				fmt.Println("```")
-			} else {
-				fmt.Println("  Add to secrets.nix hosts section:")
-				fmt.Printf("    %s = \"%s\";\n\n", host.Name, ageKey)
-				fmt.Println("  Then add secrets access for this host:")
-				fmt.Printf("    \"secret-name.age\".publicKeys = allAdmins ++ [ hosts.%s ];\n\n", host.Name)
+			if failed > 0 {
+				return fmt.Errorf("%d path(s) failed to sign", failed)
 			}
+			return nil
+		},
+	}
 
-			// Step 3: Rekey secrets (optional)
-			if !skipRekey {
-				fmt.Println("Step 3: Rekeying secrets...")
+	cmd.Flags().StringVar(&keyName, "name", "", "New key name (e.g., 'myorg-cache-2')")
+	cmd.Flags().StringVar(&outputDir, "output", ".", "Output directory for the new key files")
+	cmd.Flags().StringVar(&cacheURL, "cache-url", "", "Cache to re-sign paths in")
+	cmd.Flags().StringVar(&oldPublicKey, "old-key", "", "Current public key, reported first in the trust-both-keys list")
+	cmd.Flags().StringVar(&scope, "scope", "deployed", `Which paths to re-sign: "deployed" or "all"`)
+	cmd.Flags().StringArrayVar(&explicitPaths, "path", nil, "Re-sign this store path instead of resolving --scope (repeatable)")
 
-				// Check if secrets.nix exists
-				if _, err := os.Stat(secretsNixPath); os.IsNotExist(err) {
-					fmt.Printf("  Skipped: secrets.nix not found at %s\n", secretsNixPath)
-					fmt.Println("  After adding the host to secrets.nix, run: nixfleet secrets rekey")
-				} else {
-					// Parse and check if host is in secrets.nix
-					config, err := secrets.ParseSecretsNix(ctx, secretsNixPath)
-					if err != nil {
-						fmt.Printf("  Warning: Could not parse secrets.nix: %v\n", err)
-						fmt.Println("  After adding the host to secrets.nix, run: nixfleet secrets rekey")
-					} else if _, exists := config.Hosts[host.Name]; !exists {
-						fmt.Printf("  Host %s not yet in secrets.nix\n", host.Name)
-						fmt.Println("  After adding the host, run: nixfleet secrets rekey")
-					} else {
-						// Host exists, get identity and rekey
-						home, _ := os.UserHomeDir()
-						identityPath := filepath.Join(home, ".config", "age", "admin-key.txt")
+	return cmd
+}
 
-						if _, err := os.Stat(identityPath); os.IsNotExist(err) {
-							fmt.Printf("  Skipped: Admin key not found at %s\n", identityPath)
-							fmt.Println("  Run manually: nixfleet secrets rekey --identity /path/to/key")
-						} else {
-							rekeyed, err := secrets.RekeyAll(ctx, secretsDir, config, identityPath, dryRun)
-							if err != nil {
-								fmt.Printf("  Warning: Rekey failed: %v\n", err)
-							} else if dryRun {
-								fmt.Printf("  Would rekey %d secret(s)\n", len(rekeyed))
-							} else {
-								fmt.Printf("  Rekeyed %d secret(s)\n", len(rekeyed))
-							}
-						}
-					}
-				}
-				fmt.Println()
-			} else {
-				fmt.Println("Step 3: Skipped (--skip-rekey)")
-				fmt.Println()
+func cacheRetireKeyCmd() *cobra.Command {
+	var keyName string
+	var cacheURL string
+	var scope string
+	var explicitPaths []string
+	var verify bool
+
+	cmd := &cobra.Command{
+		Use:   "retire-key",
+		Short: "Verify and report readiness to drop a retired signing key",
+		Long: `Sample narinfo signatures across the cache to confirm no still-referenced
+path is signed only by the retiring key before it's removed from host
+configs - removing a key that's the sole signer of a path in active use
+would make that path unsubstitutable fleet-wide.
+
+--scope works the same as 'cache rotate-key': "deployed" (default) samples
+every path currently or historically deployed to a fleet host, "all"
+enumerates everything the cache can list, or pass --path explicitly.
+
+--verify is required to actually run the check (plain 'retire-key' without
+it only prints what would be sampled), a deliberate speed bump since a
+false "safe" here bricks substitution once the key is actually dropped.
+This command never modifies host configs itself - re-run 'cache configure'
+without the retiring key in --cache once it reports safe.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if keyName == "" {
+				return fmt.Errorf("--name is required")
+			}
+			if cacheURL == "" {
+				return fmt.Errorf("--cache-url is required")
 			}
 
-			// Step 4: Install pull mode (optional)
-			if !skipPullMode {
-				fmt.Println("Step 4: Installing pull mode...")
+			var paths []string
+			switch {
+			case len(explicitPaths) > 0:
+				paths = explicitPaths
+			case scope == "all":
+				if offline {
+					return fmt.Errorf("skipped: offline (--scope all requires network access)")
+				}
+				listed, err := cache.ResolveAllCachePaths(ctx, cacheURL)
+				if err != nil {
+					return fmt.Errorf("resolving --scope all paths: %w", err)
+				}
+				paths = listed
+			case scope == "deployed":
+				inv, hosts, err := loadInventoryAndHosts(ctx)
+				if err != nil {
+					return err
+				}
+				paths, err = deployedStorePaths(ctx, inv, hosts)
+				if err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("--scope must be \"deployed\" or \"all\"")
+			}
 
-				if repoURL == "" {
-					fmt.Println("  Skipped: No --repo specified")
-					fmt.Println("  To install later: nixfleet pull-mode install -H " + host.Name + " --repo <url>")
-				} else if dryRun {
-					fmt.Printf("  Would install pull mode with repo: %s\n", repoURL)
-				} else {
-					pool := ssh.NewPool(nil)
-					defer pool.Close()
+			fmt.Printf("Checking whether %q is safe to retire across %d path(s)...\n", keyName, len(paths))
 
-					client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
-					if err != nil {
-						return fmt.Errorf("SSH connection failed: %w", err)
-					}
+			if !verify || dryRun {
+				fmt.Println("Dry run (pass --verify to sample narinfos):")
+				for _, p := range paths {
+					fmt.Printf("  would sample: %s\n", p)
+				}
+				return nil
+			}
 
-					defaults := pullmode.DefaultConfig()
-					pmConfig := pullmode.Config{
-						RepoURL:     repoURL,
-						Branch:      branch,
-						HostName:    host.Name,
-						SSHKeyPath:  defaults.SSHKeyPath,
-						AgeKeyPath:  defaults.AgeKeyPath,
-						Interval:    interval,
-						ApplyOnBoot: true,
-						RepoPath:    defaults.RepoPath,
-					}
-					if pmConfig.Branch == "" {
-						pmConfig.Branch = defaults.Branch
-					}
-					if pmConfig.Interval == "" {
-						pmConfig.Interval = defaults.Interval
-					}
+			if len(paths) == 0 {
+				fmt.Println("No store paths to check; nothing references this key, but sample size is zero - verify --scope before retiring.")
+				return nil
+			}
 
-					installer := pullmode.NewInstaller()
-					if err := installer.Install(ctx, client, pmConfig); err != nil {
-						return fmt.Errorf("pull mode installation failed: %w", err)
-					}
+			result, err := cache.RetireKey(ctx, cache.RetireKeyOptions{
+				KeyName:    keyName,
+				CacheURL:   cacheURL,
+				StorePaths: paths,
+			})
+			if err != nil {
+				return fmt.Errorf("retire-key failed: %w", err)
+			}
 
-					fmt.Println("  Pull mode installed successfully")
+			for _, p := range result.Paths {
+				switch {
+				case p.Error != "":
+					fmt.Printf("  UNKNOWN: %s - %s\n", p.StorePath, p.Error)
+				case p.OnlyOldKey:
+					fmt.Printf("  UNSAFE: %s is signed only by %q\n", p.StorePath, keyName)
+				default:
+					fmt.Printf("  ok: %s (signed by %s)\n", p.StorePath, strings.Join(p.Signers, ", "))
 				}
-				fmt.Println()
-			} else {
-				fmt.Println("Step 4: Skipped (--skip-pull-mode)")
-				fmt.Println()
 			}
 
-			// Summary
-			fmt.Println("========================================")
-			fmt.Printf("Onboarding complete for %s\n", host.Name)
-			fmt.Println("========================================")
-			fmt.Println()
-			fmt.Println("Next steps:")
-			if skipRekey || skipPullMode {
-				fmt.Println("  1. Add host to secrets.nix (see above)")
-				fmt.Println("  2. Run: nixfleet secrets rekey")
-				fmt.Println("  3. Commit and push changes")
-				if skipPullMode && repoURL == "" {
-					fmt.Println("  4. Install pull mode: nixfleet pull-mode install -H " + host.Name + " --repo <url>")
-				}
-			} else {
-				fmt.Println("  1. Verify deployment: nixfleet pull-mode status -H " + host.Name)
-				fmt.Println("  2. Trigger first pull: nixfleet pull-mode trigger -H " + host.Name)
+			if !result.Safe {
+				return fmt.Errorf("%q is not safe to retire: at least one sampled path depends on it", keyName)
 			}
 
+			fmt.Printf("\n%q is safe to retire - no sampled path depends on it.\n", keyName)
+			fmt.Println("Re-run 'cache configure' without this key in --cache to drop it from host configs.")
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&secretsNixPath, "secrets-nix", "c", "secrets/secrets.nix", "Path to secrets.nix")
-	cmd.Flags().StringVarP(&secretsDir, "secrets-dir", "s", "secrets/", "Directory containing .age files")
-	cmd.Flags().StringVar(&repoURL, "repo", "", "Git repository URL for pull mode")
-	cmd.Flags().StringVar(&branch, "branch", "main", "Git branch for pull mode")
-	cmd.Flags().StringVar(&interval, "interval", "5m", "Pull interval (e.g., 5m, 1h)")
-	cmd.Flags().BoolVar(&skipPullMode, "skip-pull-mode", false, "Skip pull mode installation")
-	cmd.Flags().BoolVar(&skipRekey, "skip-rekey", false, "Skip secrets rekey step")
-	cmd.Flags().BoolVar(&outputSecretsNix, "output-secrets-nix", false, "Output secrets.nix snippet in copy-paste format")
+	cmd.Flags().StringVar(&keyName, "name", "", "Retiring key's name (e.g., 'myorg-cache-1')")
+	cmd.Flags().StringVar(&cacheURL, "cache-url", "", "Cache to sample narinfos from")
+	cmd.Flags().StringVar(&scope, "scope", "deployed", `Which paths to sample: "deployed" or "all"`)
+	cmd.Flags().StringArrayVar(&explicitPaths, "path", nil, "Sample this store path instead of resolving --scope (repeatable)")
+	cmd.Flags().BoolVar(&verify, "verify", false, "Actually sample narinfos rather than just listing what would be checked")
 
 	return cmd
 }
 
-// PKI Commands
-
-func pkiCmd() *cobra.Command {
+func secretsCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "pki",
-		Short: "Manage fleet PKI and certificates",
-		Long: `Manage the fleet's Public Key Infrastructure.
+		Use:   "secrets",
+		Short: "Manage encrypted secrets",
+		Long: `Manage encrypted secrets with age encryption.
 
-Commands:
-  init             - Initialize a new root Certificate Authority
-  init-intermediate - Create an intermediate CA (signed by root)
-  issue            - Issue a certificate for a host
-  status           - Show certificate status for fleet hosts
-  renew            - Renew expiring certificates
-  export           - Export CA certificate for external trust
-  trust            - Add CA to local machine's trust store
-  certmanager      - Integration with Kubernetes cert-manager
-  install-timer    - Install systemd timer for auto-rotation
-  uninstall-timer  - Remove systemd timer`,
+Subcommands:
+  rekey    - Re-encrypt all secrets after modifying secrets.nix
+  edit     - Edit a secret in-place
+  add      - Add a new encrypted secret
+  host-key - Get age public key from a host's SSH key
+  deploy   - Deploy secrets to hosts
+  encrypt  - Encrypt a secret file
+  decrypt      - Decrypt a secret file
+  keygen       - Generate age key pair
+  scan         - Scan files for accidentally-committed plaintext secrets
+  install-hook - Install a git pre-commit hook that runs 'secrets scan'
+  seal         - Write a signed integrity manifest for the secrets directory
+  check        - Verify the secrets directory against its signed manifest
+  access-matrix - Report which principals can decrypt which secrets
+  sync-check    - Check secrets.nix recipients against on-disk .age files
+  verify        - Report orphaned files, missing files, and stale rekeys`,
 	}
 
-	cmd.AddCommand(pkiInitCmd())
-	cmd.AddCommand(pkiInitIntermediateCmd())
-	cmd.AddCommand(pkiIssueCmd())
-	cmd.AddCommand(pkiStatusCmd())
-	cmd.AddCommand(pkiExportCmd())
-	cmd.AddCommand(pkiTrustCmd())
-	cmd.AddCommand(pkiDeployCmd())
-	cmd.AddCommand(pkiRenewCmd())
-	cmd.AddCommand(pkiRevokeCmd())
-	cmd.AddCommand(pkiCertManagerCmd())
-	cmd.AddCommand(pkiInstallTimerCmd())
-	cmd.AddCommand(pkiUninstallTimerCmd())
+	cmd.AddCommand(secretsRekeyCmd())
+	cmd.AddCommand(secretsSyncCheckCmd())
+	cmd.AddCommand(secretsVerifyCmd())
+	cmd.AddCommand(secretsEditCmd())
+	cmd.AddCommand(secretsAddCmd())
+	cmd.AddCommand(secretsHostKeyCmd())
+	cmd.AddCommand(secretsDeployCmd())
+	cmd.AddCommand(secretsEncryptCmd())
+	cmd.AddCommand(secretsDecryptCmd())
+	cmd.AddCommand(secretsKeygenCmd())
+	cmd.AddCommand(secretsScanCmd())
+	cmd.AddCommand(secretsInstallHookCmd())
+	cmd.AddCommand(secretsPruneCmd())
+	cmd.AddCommand(secretsSealCmd())
+	cmd.AddCommand(secretsCheckCmd())
+	cmd.AddCommand(secretsAccessMatrixCmd())
 
 	return cmd
 }
 
-func pkiInitCmd() *cobra.Command {
-	var (
-		configFile   string
-		pkiDir       string
-		recipients   []string
-		identities   []string
-		commonName   string
-		organization string
-		validity     string
-		force        bool
-	)
+func secretsAccessMatrixCmd() *cobra.Command {
+	var secretsNixPath, secretsDir, output, secretFilter, hostFilter string
 
 	cmd := &cobra.Command{
-		Use:   "init",
-		Short: "Initialize a new Certificate Authority",
-		Long: `Create a new root CA for the fleet.
+		Use:   "access-matrix",
+		Short: "Report which principals can decrypt which secrets",
+		Long: `Parse secrets.nix, resolve every recipient key back to its named admin
+or host, and cross-check the declared recipients against the recipient
+stanzas actually present in each .age file on disk - the same drift
+secrets check looks for, but reported as a full secret x principal matrix
+instead of a pass/fail.
+
+Each row is marked:
+  declared-and-encrypted     - declared in secrets.nix, file matches
+  declared-but-not-encrypted - declared in secrets.nix, but the file has
+                                fewer recipients than declared (stale, or
+                                never encrypted)
+  encrypted-but-not-declared - the file has more recipients than declared,
+                                or no secrets.nix entry at all; age doesn't
+                                record which recipient a stanza is for, so
+                                these surplus recipients show up as
+                                "unidentified" rather than a named principal
+
+Use --secret or --host to answer point questions ("what can the old build
+server read?"). JSON output sorts by secret then principal so two audits
+can be diffed directly.
 
-This generates:
-  - A self-signed root CA certificate (public)
-  - An age-encrypted CA private key
+Example:
+  nixfleet secrets access-matrix --host old-build-server
+  nixfleet secrets access-matrix --output json > audit-2026-08.json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "csv" && output != "json" {
+				return fmt.Errorf("--output must be table, csv, or json")
+			}
 
-The CA certificate will be deployed to all hosts to establish trust.
-The private key is encrypted and only used to sign host certificates.
+			config, err := secrets.ParseSecretsNix(cmd.Context(), secretsNixPath)
+			if err != nil {
+				return fmt.Errorf("parsing secrets.nix: %w", err)
+			}
 
-You can use a config file instead of CLI flags:
-  nixfleet pki init --config secrets/pki.yaml`,
+			matrix, err := secrets.BuildAccessMatrix(secretsDir, config)
+			if err != nil {
+				return err
+			}
+			matrix = secrets.FilterAccessMatrix(matrix, secretFilter, hostFilter)
+
+			switch output {
+			case "json":
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(matrix)
+			case "csv":
+				return writeAccessMatrixCSV(os.Stdout, matrix)
+			default:
+				printAccessMatrixTable(os.Stdout, matrix)
+				return nil
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&secretsNixPath, "config", "c", "secrets/secrets.nix", "Path to secrets.nix")
+	cmd.Flags().StringVarP(&secretsDir, "secrets-dir", "s", "secrets/", "Directory containing .age files")
+	cmd.Flags().StringVar(&output, "output", "table", "Output format: table, csv, or json")
+	cmd.Flags().StringVar(&secretFilter, "secret", "", "Only show this secret (matches secrets.nix entry name)")
+	cmd.Flags().StringVar(&hostFilter, "host", "", "Only show this host's access")
+
+	return cmd
+}
+
+// writeAccessMatrixCSV writes one row per (secret, principal), mirroring
+// writeComplianceCSV's plain encoding/csv usage.
+func writeAccessMatrixCSV(w io.Writer, m *secrets.AccessMatrix) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"secret", "principal", "marker"}); err != nil {
+		return err
+	}
+	for _, e := range m.Entries {
+		if err := cw.Write([]string{e.Secret, e.Principal, string(e.Marker)}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// printAccessMatrixTable prints a simple aligned table, marking anything
+// other than declared-and-encrypted so drift stands out at a glance.
+func printAccessMatrixTable(w io.Writer, m *secrets.AccessMatrix) {
+	if len(m.Entries) == 0 {
+		fmt.Fprintln(w, "no matching entries")
+		return
+	}
+	secretW, principalW := len("SECRET"), len("PRINCIPAL")
+	for _, e := range m.Entries {
+		if len(e.Secret) > secretW {
+			secretW = len(e.Secret)
+		}
+		if len(e.Principal) > principalW {
+			principalW = len(e.Principal)
+		}
+	}
+	fmt.Fprintf(w, "%-*s  %-*s  %s\n", secretW, "SECRET", principalW, "PRINCIPAL", "MARKER")
+	for _, e := range m.Entries {
+		marker := string(e.Marker)
+		if e.Marker != secrets.MarkerDeclaredEncrypted {
+			marker = "! " + marker
+		}
+		fmt.Fprintf(w, "%-*s  %-*s  %s\n", secretW, e.Secret, principalW, e.Principal, marker)
+	}
+}
+
+// defaultManifestPath is where 'secrets seal' writes, and where
+// add/edit/rekey look to decide whether to reseal automatically.
+const defaultManifestPath = "secrets/.manifest.json"
+
+// defaultSignIdentity is the SSH private key 'secrets seal' signs the
+// manifest with by default, matching the key format ssh-keygen -Y sign
+// expects (the same mechanism approvals grants use).
+func defaultSignIdentity() string {
+	home, _ := os.UserHomeDir()
+	return home + "/.ssh/id_ed25519"
+}
+
+// resealIfManifestExists reseals manifestPath after an add/edit/rekey, but
+// only if a manifest already exists there - sealing is opt-in the first
+// time (someone has to run 'secrets seal' by hand), and only becomes
+// mandatory maintenance once that first manifest is checked in.
+func resealIfManifestExists(ctx context.Context, secretsDir, manifestPath string, config *secrets.SecretsNixConfig, identityPath, actor string) error {
+	if _, err := os.Stat(manifestPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	if _, err := secrets.SealManifest(ctx, secretsDir, manifestPath, config, identityPath, actor); err != nil {
+		return fmt.Errorf("resealing %s: %w", manifestPath, err)
+	}
+	fmt.Printf("Resealed %s\n", manifestPath)
+	return nil
+}
+
+func secretsSealCmd() *cobra.Command {
+	var secretsNixPath, secretsDir, manifestPath, identityPath, actor string
+
+	cmd := &cobra.Command{
+		Use:   "seal",
+		Short: "Write a signed integrity manifest for the secrets directory",
+		Long: `Record every .age file's size, SHA-256, and recipient stanzas, plus the
+secrets.nix entry it corresponds to, into a manifest, then sign it with an
+SSH key via 'ssh-keygen -Y sign' - the same mechanism 'nixfleet approvals'
+uses for approval grants.
+
+Run this once to start tracking a secrets directory; after that, add/edit/
+rekey reseal automatically. Check the manifest into git alongside the
+.age files it describes so 'secrets check' can run in CI.
+
+Example:
+  nixfleet secrets seal -i ~/.ssh/id_ed25519 --actor jdoe@example.com`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
-			_ = ctx // for future use
 
-			// Load config file if specified
-			var pkiCfg *pki.PKIConfig
-			if configFile != "" {
-				var err error
-				pkiCfg, err = pki.LoadPKIConfig(configFile)
-				if err != nil {
-					return fmt.Errorf("loading config: %w", err)
-				}
-				if err := pkiCfg.Validate(); err != nil {
-					return fmt.Errorf("invalid config: %w", err)
-				}
+			if identityPath == "" {
+				identityPath = defaultSignIdentity()
+			}
+			if actor == "" {
+				return fmt.Errorf("--actor is required (the signer principal, matched against allowed_signers)")
+			}
 
-				// Use config values as defaults (CLI flags override)
-				if pkiDir == "secrets/pki" && pkiCfg.Directory != "" {
-					pkiDir = pkiCfg.Directory
-				}
-				if len(recipients) == 0 {
-					recipients = pkiCfg.Recipients
-				}
-				if len(identities) == 0 {
-					identities = pkiCfg.Identities
+			config, err := secrets.ParseSecretsNix(ctx, secretsNixPath)
+			if err != nil {
+				return fmt.Errorf("parsing secrets.nix: %w", err)
+			}
+
+			m, err := secrets.SealManifest(ctx, secretsDir, manifestPath, config, identityPath, actor)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Sealed %d secret(s) into %s (signed by %s)\n", len(m.Files), manifestPath, actor)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&secretsNixPath, "config", "c", "secrets/secrets.nix", "Path to secrets.nix")
+	cmd.Flags().StringVarP(&secretsDir, "secrets-dir", "s", "secrets/", "Directory containing .age files")
+	cmd.Flags().StringVar(&manifestPath, "manifest", defaultManifestPath, "Path to write the integrity manifest")
+	cmd.Flags().StringVarP(&identityPath, "identity", "i", "", "SSH private key to sign the manifest with (default: ~/.ssh/id_ed25519)")
+	cmd.Flags().StringVar(&actor, "actor", os.Getenv("USER"), "Signer principal recorded in the manifest, matched against allowed_signers")
+
+	return cmd
+}
+
+func secretsCheckCmd() *cobra.Command {
+	var secretsNixPath, secretsDir, manifestPath, allowedSigners, identityPath, actor string
+	var update bool
+
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Verify the secrets directory against its signed manifest",
+		Long: `Verify every .age file under --secrets-dir against the sealed manifest
+and the manifest's own signature, reporting:
+
+  modified      - sha256 changed since the manifest was sealed
+  unsigned-new  - an .age file with no manifest entry at all
+  missing       - a manifest entry with no file on disk
+  orphaned      - tracked by the manifest but no longer in secrets.nix
+
+A modified file whose recipients still match secrets.nix is flagged as an
+expected rekey; one whose recipient set changed - especially shrank - is
+flagged suspicious, since a routine rekey doesn't produce that.
+
+Exit codes: 0 clean, 1 routine drift (needs a reseal), 2 suspicious
+changes or an invalid manifest signature. Fail CI builds on a non-zero
+exit; only 2 should page anyone.
+
+Example:
+  nixfleet secrets check
+  nixfleet secrets check --update -i ~/.ssh/id_ed25519 --actor jdoe@example.com`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			config, err := secrets.ParseSecretsNix(ctx, secretsNixPath)
+			if err != nil {
+				return fmt.Errorf("parsing secrets.nix: %w", err)
+			}
+
+			result, _, err := secrets.CheckManifest(ctx, secretsDir, manifestPath, allowedSigners, config)
+			if err != nil {
+				return err
+			}
+
+			if !result.SignatureValid {
+				fmt.Println("✗ manifest signature is invalid or missing")
+			}
+			for _, mf := range result.Modified {
+				note := "recipients match secrets.nix (expected rekey)"
+				if !mf.RecipientsMatch {
+					note = "recipients changed"
+					if mf.RecipientsShrank {
+						note = "recipient set SHRANK"
+					}
 				}
-				if commonName == "NixFleet Root CA" && pkiCfg.RootCA.CommonName != "" {
-					commonName = pkiCfg.RootCA.CommonName
+				fmt.Printf("  ~ %s: modified, %s\n", mf.Path, note)
+			}
+			for _, path := range result.Missing {
+				fmt.Printf("  - %s: missing (in manifest, not on disk)\n", path)
+			}
+			for _, path := range result.UnsignedNew {
+				fmt.Printf("  + %s: not in manifest\n", path)
+			}
+			for _, path := range result.Orphaned {
+				fmt.Printf("  ? %s: orphaned (no secrets.nix entry)\n", path)
+			}
+
+			if result.Clean() {
+				fmt.Println("secrets directory matches the sealed manifest")
+				return nil
+			}
+
+			if update {
+				if identityPath == "" {
+					identityPath = defaultSignIdentity()
 				}
-				if organization == "NixFleet" && pkiCfg.RootCA.Organization != "" {
-					organization = pkiCfg.RootCA.Organization
+				if actor == "" {
+					return fmt.Errorf("--actor is required with --update")
 				}
-				if validity == "10y" && pkiCfg.RootCA.Validity != "" {
-					validity = pkiCfg.RootCA.Validity
+				m, err := secrets.SealManifest(ctx, secretsDir, manifestPath, config, identityPath, actor)
+				if err != nil {
+					return fmt.Errorf("resealing: %w", err)
 				}
+				fmt.Printf("Resealed %d secret(s) into %s\n", len(m.Files), manifestPath)
+				return nil
 			}
 
-			store := pki.NewStore(pkiDir, recipients, identities)
+			if result.Suspicious() {
+				return exitWithCode(2, fmt.Errorf("secrets manifest check found suspicious changes"))
+			}
+			return exitWithCode(1, fmt.Errorf("secrets manifest is out of date; run 'secrets check --update' or 'secrets seal'"))
+		},
+	}
 
-			// Check if CA already exists
-			if store.CAExists() && !force {
-				return fmt.Errorf("CA already exists at %s. Use --force to overwrite", pkiDir)
+	cmd.Flags().StringVarP(&secretsNixPath, "config", "c", "secrets/secrets.nix", "Path to secrets.nix")
+	cmd.Flags().StringVarP(&secretsDir, "secrets-dir", "s", "secrets/", "Directory containing .age files")
+	cmd.Flags().StringVar(&manifestPath, "manifest", defaultManifestPath, "Path to the integrity manifest")
+	cmd.Flags().StringVar(&allowedSigners, "allowed-signers", "secrets/allowed_signers", "SSH allowed_signers file used to verify the manifest signature")
+	cmd.Flags().BoolVar(&update, "update", false, "Reseal the manifest if the check finds drift")
+	cmd.Flags().StringVarP(&identityPath, "identity", "i", "", "SSH private key to sign the reseal with, used only with --update (default: ~/.ssh/id_ed25519)")
+	cmd.Flags().StringVar(&actor, "actor", os.Getenv("USER"), "Signer principal recorded in the manifest, used only with --update")
+
+	return cmd
+}
+
+func secretsPruneCmd() *cobra.Command {
+	var dryRun bool
+	var secretsDestDir string
+	var secretsDir string
+	var manifestPath string
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove deployed secrets that are no longer assigned",
+		Long: `Diff a host's deployed-secrets manifest against --manifest (secrets/
+secrets.yaml by default) and shred (overwrite then unlink) any secret file
+that's no longer assigned to the host, since a plain rm leaves recoverable
+plaintext credentials on disk.
+
+Also reports files found under the secrets destination directory that
+nixfleet has no manifest record of ever deploying, flagged separately as
+"unknown" - they may predate manifest tracking, or were placed there by
+another process.
+
+Never touches a path outside --secrets-dest-dir, even if the manifest is
+corrupted.
+
+Example:
+  nixfleet secrets prune -H web-1 --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if targetHost == "" {
+				return fmt.Errorf("--host is required")
 			}
 
-			if len(recipients) == 0 {
-				return fmt.Errorf("at least one --recipient is required for encrypting the CA private key")
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
 			}
+			host := hosts[0]
 
-			// Parse validity using our helper
-			validityDuration, err := pki.ParseValidityDuration(validity)
+			hostSecrets, err := secrets.LoadHostSecretsFile(manifestPath)
 			if err != nil {
-				return fmt.Errorf("invalid validity format: %s (use e.g., 10y, 90d, 8760h)", validity)
+				return fmt.Errorf("loading secrets manifest: %w", err)
 			}
+			desired := hostSecrets.SecretConfigsFor(host.Name, secretsDir)
 
-			cfg := &pki.CAConfig{
-				CommonName:   commonName,
-				Organization: organization,
-				Validity:     validityDuration,
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+			if err != nil {
+				return fmt.Errorf("connecting to %s: %w", host.Name, err)
 			}
 
-			fmt.Println("Initializing NixFleet PKI...")
-			fmt.Printf("  Common Name:  %s\n", cfg.CommonName)
-			fmt.Printf("  Organization: %s\n", cfg.Organization)
-			fmt.Printf("  Validity:     %s\n", validity)
-			fmt.Println()
+			stateMgr := state.NewManager()
+			hostState, err := stateMgr.ReadState(ctx, client)
+			if err != nil {
+				return fmt.Errorf("reading state: %w", err)
+			}
+
+			mgr := secrets.NewManager(secrets.EncryptionAge, nil, nil)
 
-			// Create CA
-			ca, err := pki.InitCA(cfg)
+			result, err := mgr.PruneOrphaned(ctx, client, desired, hostState.DeployedSecrets, secretsDestDir, dryRun)
 			if err != nil {
-				return fmt.Errorf("creating CA: %w", err)
+				return fmt.Errorf("pruning secrets on %s: %w", host.Name, err)
 			}
 
-			// Save to disk
-			if err := store.SaveCA(ca); err != nil {
-				return fmt.Errorf("saving CA: %w", err)
+			if len(result.Removed) == 0 && len(result.Unknown) == 0 {
+				fmt.Printf("%s: no orphaned or unknown secret files found\n", host.Name)
+				return nil
 			}
 
-			fmt.Println("CA initialized successfully!")
-			fmt.Println()
-			fmt.Printf("Files created:\n")
-			fmt.Printf("  Certificate: %s/ca/root.crt (public)\n", pkiDir)
-			fmt.Printf("  Private Key: %s/ca/root.key.age (encrypted)\n", pkiDir)
-			fmt.Println()
-			if pkiCfg != nil && pkiCfg.IntermediateCA != nil {
-				fmt.Println("Next steps:")
-				fmt.Println("  1. Create intermediate CA: nixfleet pki init-intermediate --config " + configFile)
-				fmt.Println("  2. Issue certificates:     nixfleet pki issue <hostname>")
-				fmt.Println("  3. Deploy to hosts:        nixfleet apply")
-			} else {
-				fmt.Println("Next steps:")
-				fmt.Println("  1. Issue certificates: nixfleet pki issue <hostname>")
-				fmt.Println("  2. Deploy to hosts:    nixfleet apply")
+			if len(result.Removed) > 0 {
+				verb := "Removed"
+				if dryRun {
+					verb = "Would remove"
+				}
+				fmt.Printf("%s orphaned secret(s):\n", verb)
+				for _, path := range result.Removed {
+					fmt.Printf("  - %s\n", path)
+				}
+			}
+			if len(result.Unknown) > 0 {
+				fmt.Printf("Unknown file(s) under %s (never deployed by nixfleet):\n", secretsDestDir)
+				for _, path := range result.Unknown {
+					fmt.Printf("  ? %s\n", path)
+				}
+			}
+
+			if !dryRun && len(result.Removed) > 0 {
+				for _, path := range result.Removed {
+					delete(hostState.DeployedSecrets, path)
+					delete(hostState.ManagedFiles, path)
+				}
+				if err := stateMgr.WriteState(ctx, client, hostState); err != nil {
+					return fmt.Errorf("updating state: %w", err)
+				}
 			}
 
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&configFile, "config", "c", "", "PKI config file (e.g., secrets/pki.yaml)")
-	cmd.Flags().StringVar(&pkiDir, "pki-dir", "secrets/pki", "Directory for PKI files")
-	cmd.Flags().StringSliceVarP(&recipients, "recipient", "r", nil, "Age recipients for encrypting CA key")
-	cmd.Flags().StringSliceVar(&identities, "identity", nil, "Age identity files for decryption")
-	cmd.Flags().StringVar(&commonName, "cn", "NixFleet Root CA", "CA common name")
-	cmd.Flags().StringVar(&organization, "org", "NixFleet", "Organization name")
-	cmd.Flags().StringVar(&validity, "validity", "10y", "CA certificate validity (e.g., 10y, 8760h)")
-	cmd.Flags().BoolVar(&force, "force", false, "Overwrite existing CA")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview removals without touching the host")
+	cmd.Flags().StringVar(&secretsDestDir, "secrets-dest-dir", "/run/nixfleet-secrets", "Secrets destination directory on the host; pruning never touches paths outside it")
+	cmd.Flags().StringVar(&secretsDir, "secrets-dir", "secrets/", "Directory containing encrypted secrets")
+	cmd.Flags().StringVar(&manifestPath, "manifest", "secrets/secrets.yaml", "Path to the per-host secrets manifest")
 
 	return cmd
 }
 
-func pkiInitIntermediateCmd() *cobra.Command {
-	var (
-		configFile   string
-		pkiDir       string
-		recipients   []string
-		identities   []string
-		commonName   string
-		organization string
-		validity     string
-		force        bool
-	)
+func secretsScanCmd() *cobra.Command {
+	var staged bool
 
 	cmd := &cobra.Command{
-		Use:   "init-intermediate",
-		Short: "Create an intermediate CA signed by the root CA",
-		Long: `Create an intermediate CA for signing host certificates.
-
-This provides better security by keeping the root CA private key offline.
-The intermediate CA:
-  - Is signed by the root CA
-  - Has a shorter validity than root (default 5 years)
-  - Can only sign end-entity certificates (not other CAs)
+		Use:   "scan [files...]",
+		Short: "Scan files for plaintext secrets before they're committed",
+		Long: `Scan files for content that looks like a plaintext secret (PEM/SSH
+private keys, age identities, cloud provider keys, generic
+password/token/api_key assignments) so it doesn't end up committed
+next to its intended .age counterpart.
 
-The certificate chain (intermediate + root) is automatically included
-when issuing certificates, enabling full chain validation.
+Exits non-zero if any findings are reported, making it suitable for a
+git pre-commit hook (see 'nixfleet secrets install-hook') or CI step.
 
 Examples:
-  nixfleet pki init-intermediate --config secrets/pki.yaml
-  nixfleet pki init-intermediate -r age1...
-  nixfleet pki init-intermediate --cn "NixFleet Signing CA" --validity 3y`,
+  nixfleet secrets scan --staged
+  nixfleet secrets scan secrets/pki.yaml hosts/db-1.nix`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
-
-			// Load config file if specified
-			if configFile != "" {
-				pkiCfg, err := pki.LoadPKIConfig(configFile)
+			paths := args
+			if staged {
+				var err error
+				paths, err = secrets.StagedFiles()
 				if err != nil {
-					return fmt.Errorf("loading config: %w", err)
-				}
-				if err := pkiCfg.Validate(); err != nil {
-					return fmt.Errorf("invalid config: %w", err)
+					return err
 				}
+			}
+			if len(paths) == 0 {
+				fmt.Println("No files to scan")
+				return nil
+			}
 
-				// Check if intermediate CA is configured
-				if pkiCfg.IntermediateCA == nil {
-					return fmt.Errorf("intermediate CA not configured in %s", configFile)
-				}
+			findings, err := secrets.ScanPaths(paths)
+			if err != nil {
+				return err
+			}
 
-				// Use config values as defaults (CLI flags override)
-				if pkiDir == "secrets/pki" && pkiCfg.Directory != "" {
-					pkiDir = pkiCfg.Directory
+			if len(findings) == 0 {
+				fmt.Printf("Scanned %d file(s), no plaintext secrets found\n", len(paths))
+				return nil
+			}
+
+			fmt.Printf("Found %d potential plaintext secret(s):\n\n", len(findings))
+			for _, f := range findings {
+				fmt.Printf("  %s\n", f.String())
+			}
+			fmt.Println()
+			return fmt.Errorf("refusing to continue: encrypt these with 'nixfleet secrets encrypt' or add them to .gitignore")
+		},
+	}
+
+	cmd.Flags().BoolVar(&staged, "staged", false, "Scan files staged for commit (git diff --cached) instead of explicit paths")
+
+	return cmd
+}
+
+func secretsInstallHookCmd() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "install-hook",
+		Short: "Install a git pre-commit hook that runs 'secrets scan'",
+		Long: `Install a pre-commit hook at .git/hooks/pre-commit that scans staged
+files for plaintext secrets before every commit.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hookPath := filepath.Join(".git", "hooks", "pre-commit")
+			if _, err := os.Stat(filepath.Join(".git")); err != nil {
+				return fmt.Errorf("not a git repository (no .git directory found)")
+			}
+			if _, err := os.Stat(hookPath); err == nil && !force {
+				return fmt.Errorf("%s already exists. Use --force to overwrite", hookPath)
+			}
+
+			if err := os.WriteFile(hookPath, []byte(secrets.PreCommitHookScript), 0755); err != nil {
+				return fmt.Errorf("writing hook: %w", err)
+			}
+
+			fmt.Printf("Installed pre-commit hook: %s\n", hookPath)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite an existing pre-commit hook")
+
+	return cmd
+}
+
+func secretsDeployCmd() *cobra.Command {
+	var identities []string
+	var secretsDir string
+	var manifestPath string
+	var secretsNixPath string
+	var dryRun bool
+	var ref approvalRef
+	var approvalID, allowedSigners, actor, auditLogPath string
+
+	cmd := &cobra.Command{
+		Use:   "deploy",
+		Short: "Deploy secrets to hosts",
+		Long: `Decrypt and deploy secrets to remote hosts.
+
+Reads --manifest (secrets/secrets.yaml by default), which maps each host
+to the secrets it should receive: a source file under --secrets-dir, a
+destination path, owner/group/mode, and the systemd units to restart when
+its content changes. Each secret's plaintext is compared against a
+sha256sum of the remote file before anything is written; a secret whose
+deployed copy already matches is left alone and its units aren't
+restarted. Plaintext is never written to a temp file on the control
+machine - it's piped straight to the host over the existing SSH
+connection, the same way 'secrets edit' does.
+
+Also prunes any secret nixfleet previously deployed to a host (recorded in
+its state) that's no longer in the host's manifest entry, shredding it on
+the host rather than leaving a stale credential behind. --dry-run reports
+what would change - deployed, pruned, or neither - without touching any
+host.
+
+If --config is set and a secret's basename is marked requiresApproval =
+true in secrets.nix, deploying it is gated on --approval naming a request
+with a valid grant from a second admin, the same as 'secrets decrypt' and
+'secrets edit'.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			hostSecrets, err := secrets.LoadHostSecretsFile(manifestPath)
+			if err != nil {
+				return fmt.Errorf("loading secrets manifest: %w", err)
+			}
+
+			var secretsNix *secrets.SecretsNixConfig
+			if secretsNixPath != "" {
+				secretsNix, err = secrets.ParseSecretsNix(ctx, secretsNixPath)
+				if err != nil {
+					return fmt.Errorf("parsing secrets.nix: %w", err)
 				}
-				if len(recipients) == 0 {
-					recipients = pkiCfg.Recipients
+			}
+
+			var audit *secrets.AuditLogger
+			if auditLogPath != "" {
+				audit = secrets.NewAuditLogger(auditLogPath)
+			}
+
+			mgr := secrets.NewManager(secrets.EncryptionAge, identities, nil)
+			stateMgr := state.NewManager()
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			for _, host := range hosts {
+				desired := hostSecrets.SecretConfigsFor(host.Name, secretsDir)
+				if len(desired) == 0 {
+					continue
 				}
-				if len(identities) == 0 {
-					identities = pkiCfg.Identities
+
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
+					continue
 				}
-				if commonName == "NixFleet Intermediate CA" && pkiCfg.IntermediateCA.CommonName != "" {
-					commonName = pkiCfg.IntermediateCA.CommonName
+
+				if secretsNix != nil {
+					if err := requireSecretApprovals(ctx, ref, allowedSigners, approvalID, actor, audit, secretsNix, desired); err != nil {
+						fmt.Printf("%s: %v\n", host.Name, err)
+						continue
+					}
 				}
-				if organization == "NixFleet" && pkiCfg.IntermediateCA.Organization != "" {
-					organization = pkiCfg.IntermediateCA.Organization
+
+				hostState, err := stateMgr.ReadState(ctx, client)
+				if err != nil {
+					fmt.Printf("%s: reading state - %v\n", host.Name, err)
+					continue
 				}
-				if validity == "5y" && pkiCfg.IntermediateCA.Validity != "" {
-					validity = pkiCfg.IntermediateCA.Validity
+				if hostState.ManagedFiles == nil {
+					hostState.ManagedFiles = make(map[string]state.FileState)
+				}
+				if hostState.DeployedSecrets == nil {
+					hostState.DeployedSecrets = make(map[string]state.DeployedSecret)
+				}
+
+				if dryRun {
+					printSecretsDeployPlan(ctx, mgr, client, host.Name, desired, hostState.DeployedSecrets)
+					continue
+				}
+
+				units, manifest, changed, removed, err := mgr.DeploySecrets(ctx, client, desired, hostState.DeployedSecrets, secretsDir)
+				if err != nil {
+					fmt.Printf("%s: deploy failed - %v\n", host.Name, err)
+					continue
+				}
+				hostState.DeployedSecrets = manifest
+
+				changedPaths := make(map[string]bool, len(changed))
+				for _, path := range changed {
+					changedPaths[path] = true
+				}
+				for _, secret := range desired {
+					if !changedPaths[secret.DestPath] {
+						continue
+					}
+					hostState.ManagedFiles[secret.DestPath] = state.FileState{
+						Path:         secret.DestPath,
+						Hash:         manifest[secret.DestPath].Hash,
+						Mode:         secret.Mode,
+						Owner:        secret.Owner,
+						Group:        secret.Group,
+						RestartUnits: secret.RestartUnits,
+					}
+				}
+				for _, path := range removed {
+					delete(hostState.ManagedFiles, path)
+				}
+
+				if err := stateMgr.WriteState(ctx, client, hostState); err != nil {
+					fmt.Printf("%s: updating state - %v\n", host.Name, err)
+					continue
+				}
+
+				if err := secrets.RestartUnits(ctx, client, units); err != nil {
+					fmt.Printf("%s: deployed but restart failed - %v\n", host.Name, err)
+					continue
 				}
+
+				fmt.Printf("%s: %d secret(s) deployed, %d changed, %d unit(s) restarted, %d pruned\n",
+					host.Name, len(desired), len(changed), len(units), len(removed))
 			}
 
-			store := pki.NewStore(pkiDir, recipients, identities)
+			return nil
+		},
+	}
 
-			// Check if root CA exists
-			if !store.CAExists() {
-				return fmt.Errorf("root CA not initialized. Run 'nixfleet pki init' first")
+	cmd.Flags().StringSliceVarP(&identities, "identity", "i", defaultIdentities(), "Age identity file(s)")
+	cmd.Flags().StringVar(&secretsDir, "secrets-dir", "secrets/", "Directory containing encrypted secrets")
+	cmd.Flags().StringVar(&manifestPath, "manifest", "secrets/secrets.yaml", "Path to the per-host secrets manifest")
+	cmd.Flags().StringVarP(&secretsNixPath, "config", "c", "", "Path to secrets.nix, to check secrets against requiresApproval (default: skip the check)")
+	cmd.Flags().StringVar(&approvalID, "approval", "", "Approval request ID, required if a deployed secret is marked requiresApproval")
+	cmd.Flags().StringVar(&allowedSigners, "allowed-signers", "secrets/allowed_signers", "SSH allowed_signers file used to verify approval grants")
+	cmd.Flags().StringVar(&actor, "actor", os.Getenv("USER"), "Actor name recorded in --audit-log")
+	cmd.Flags().StringVar(&auditLogPath, "audit-log", "", "Path to append approval decisions as JSON lines")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show which secrets would change without deploying anything")
+	ref.addApprovalFlags(cmd)
+
+	return cmd
+}
+
+// requireSecretApprovals gates desired's requiresApproval secrets (per
+// secretsNix) on approvalID, the same two-person-rule check secretsDecryptCmd
+// and secretsEditCmd apply to a single secret, run here once per host over
+// its whole secret set so one missing approval skips the host instead of
+// deploying everything but the gated secret.
+func requireSecretApprovals(ctx context.Context, ref approvalRef, allowedSigners, approvalID, actor string, audit *secrets.AuditLogger, secretsNix *secrets.SecretsNixConfig, desired []secrets.SecretConfig) error {
+	for _, secret := range desired {
+		secretName := filepath.Base(secret.SourcePath)
+		entry, ok := secretsNix.Secrets[secretName]
+		if !ok || !entry.RequiresApproval {
+			continue
+		}
+
+		err := requireApproval(ctx, ref, allowedSigners, approvalID, secretName, secrets.OperationDeploy)
+		if audit != nil {
+			_ = audit.Log(secrets.AuditEntry{Actor: actor, SecretName: secretName, Operation: secrets.OperationDeploy, ApprovalID: approvalID, Allowed: err == nil, Reason: errString(err)})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errString returns err's message, or "" for a nil err - so an AuditEntry's
+// Reason is empty on success instead of "<nil>".
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// printSecretsDeployPlan reports, without deploying anything, which of
+// host's desired secrets would be pushed (missing or content changed),
+// which would be left alone (already up to date), and which currently
+// deployed secrets would be pruned.
+func printSecretsDeployPlan(ctx context.Context, mgr *secrets.Manager, client *ssh.Client, host string, desired []secrets.SecretConfig, prevManifest map[string]state.DeployedSecret) {
+	desiredPaths := make(map[string]bool, len(desired))
+	for _, secret := range desired {
+		desiredPaths[secret.DestPath] = true
+
+		changed, err := mgr.CheckSecretChanged(ctx, client, secret)
+		if err != nil {
+			fmt.Printf("%s: %s - error checking: %v\n", host, secret.Name, err)
+			continue
+		}
+		if changed {
+			fmt.Printf("%s: %s -> %s would change\n", host, secret.Name, secret.DestPath)
+		} else {
+			fmt.Printf("%s: %s -> %s unchanged\n", host, secret.Name, secret.DestPath)
+		}
+	}
+
+	for path := range prevManifest {
+		if !desiredPaths[path] {
+			fmt.Printf("%s: %s would be pruned (no longer in manifest)\n", host, path)
+		}
+	}
+}
+
+func secretsEncryptCmd() *cobra.Command {
+	var recipients []string
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "encrypt [file]",
+		Short: "Encrypt a file",
+		Long:  `Encrypt a file using age encryption.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			inputFile := args[0]
+
+			if len(recipients) == 0 {
+				return fmt.Errorf("at least one --recipient is required")
+			}
+			if output == "" {
+				output = inputFile + ".age"
+			}
+
+			data, err := os.ReadFile(inputFile)
+			if err != nil {
+				return fmt.Errorf("reading input: %w", err)
+			}
+
+			mgr := secrets.NewManager(secrets.EncryptionAge, nil, recipients)
+
+			if err := mgr.EncryptSecret(ctx, data, output); err != nil {
+				return fmt.Errorf("encryption failed: %w", err)
+			}
+
+			fmt.Printf("Encrypted to %s\n", output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(&recipients, "recipient", "r", nil, "Age recipient public key(s)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file (default: input.age)")
+
+	return cmd
+}
+
+func secretsDecryptCmd() *cobra.Command {
+	var identities []string
+	var output string
+	var secretsNixPath string
+	var ref approvalRef
+	var approvalID, allowedSigners, actor, auditLogPath string
+
+	cmd := &cobra.Command{
+		Use:   "decrypt [file]",
+		Short: "Decrypt a file",
+		Long: `Decrypt an age-encrypted file.
+
+If --config is set and the file's basename is marked requiresApproval =
+true in secrets.nix, decryption is gated on --approval naming a request
+with a valid grant from a second admin (see 'nixfleet approvals').
+Without --config, decrypt has no secret name to check against secrets.nix
+and proceeds unconditionally, as before.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeSecretNames,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			inputFile := args[0]
+
+			if len(identities) == 0 {
+				return fmt.Errorf("at least one --identity is required")
+			}
+
+			var audit *secrets.AuditLogger
+			if auditLogPath != "" {
+				audit = secrets.NewAuditLogger(auditLogPath)
+			}
+
+			if secretsNixPath != "" {
+				secretName := filepath.Base(inputFile)
+				config, err := secrets.ParseSecretsNix(ctx, secretsNixPath)
+				if err != nil {
+					return fmt.Errorf("parsing secrets.nix: %w", err)
+				}
+				if entry, ok := config.Secrets[secretName]; ok && entry.RequiresApproval {
+					if err := requireApproval(ctx, ref, allowedSigners, approvalID, secretName, secrets.OperationDecrypt); err != nil {
+						if audit != nil {
+							_ = audit.Log(secrets.AuditEntry{Actor: actor, SecretName: secretName, Operation: secrets.OperationDecrypt, ApprovalID: approvalID, Allowed: false, Reason: err.Error()})
+						}
+						return err
+					}
+					if audit != nil {
+						_ = audit.Log(secrets.AuditEntry{Actor: actor, SecretName: secretName, Operation: secrets.OperationDecrypt, ApprovalID: approvalID, Allowed: true})
+					}
+				}
+			}
+
+			mgr := secrets.NewManager(secrets.EncryptionAge, identities, nil)
+
+			data, err := mgr.DecryptSecret(ctx, inputFile)
+			if err != nil {
+				return fmt.Errorf("decryption failed: %w", err)
+			}
+
+			if output == "" {
+				fmt.Print(string(data))
+			} else {
+				if err := os.WriteFile(output, data, 0600); err != nil {
+					return fmt.Errorf("writing output: %w", err)
+				}
+				fmt.Printf("Decrypted to %s\n", output)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(&identities, "identity", "i", defaultIdentities(), "Age identity file(s)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file (default: stdout)")
+	cmd.Flags().StringVarP(&secretsNixPath, "config", "c", "", "Path to secrets.nix, to check the file against requiresApproval (default: skip the check)")
+	cmd.Flags().StringVar(&approvalID, "approval", "", "Approval request ID, required if the secret is marked requiresApproval")
+	cmd.Flags().StringVar(&allowedSigners, "allowed-signers", "secrets/allowed_signers", "SSH allowed_signers file used to verify approval grants")
+	cmd.Flags().StringVar(&actor, "actor", os.Getenv("USER"), "Actor name recorded in --audit-log")
+	cmd.Flags().StringVar(&auditLogPath, "audit-log", "", "Path to append this decrypt decision as a JSON line")
+	ref.addApprovalFlags(cmd)
+
+	return cmd
+}
+
+func secretsKeygenCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate age key pair",
+		Long:  `Generate a new age key pair for secrets encryption.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if output == "" {
+				output = "age-key.txt"
 			}
 
-			// Check if intermediate already exists
-			if store.IntermediateCAExists() && !force {
-				return fmt.Errorf("intermediate CA already exists. Use --force to overwrite")
-			}
+			publicKey, err := secrets.GenerateAgeKey(ctx, output)
+			if err != nil {
+				return fmt.Errorf("keygen failed: %w", err)
+			}
+
+			fmt.Printf("Generated key pair:\n")
+			fmt.Printf("  Secret key: %s\n", output)
+			fmt.Printf("  Public key: %s\n", publicKey)
+			fmt.Println("\nUse the public key as a recipient for encryption.")
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "age-key.txt", "Output file for secret key")
+
+	return cmd
+}
+
+func secretsRekeyCmd() *cobra.Command {
+	var secretsNixPath string
+	var secretsDir string
+	var identityPath string
+	var manifestPath string
+	var signIdentity string
+	var actor string
+	var onlyChanged bool
+
+	cmd := &cobra.Command{
+		Use:   "rekey",
+		Short: "Re-encrypt all secrets after modifying secrets.nix",
+		Long: `Re-encrypt all secrets using the recipients defined in secrets.nix.
+
+Use this after:
+  - Adding a new host to secrets.nix
+  - Removing a host from secrets.nix
+  - Changing which secrets a host can access
+
+By default every secret in secrets.nix gets rewritten, even ones whose
+recipients didn't actually change, which produces a noisy diff of
+re-encrypted-but-unchanged files. --only-changed rewrites just the secrets
+'secrets sync-check' would report out of sync, using the same diff.
+
+Example:
+  nixfleet secrets rekey -c secrets/secrets.nix -i ~/.config/age/admin-key.txt`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if identityPath == "" {
+				// Default to admin key location
+				home, _ := os.UserHomeDir()
+				identityPath = home + "/.config/age/admin-key.txt"
+			}
+
+			// Check identity exists
+			if _, err := os.Stat(identityPath); os.IsNotExist(err) {
+				return fmt.Errorf("identity file not found: %s\nUse -i to specify your age identity file", identityPath)
+			}
+
+			// Parse secrets.nix
+			config, err := secrets.ParseSecretsNix(ctx, secretsNixPath)
+			if err != nil {
+				return fmt.Errorf("parsing secrets.nix: %w", err)
+			}
+
+			fmt.Printf("Parsed secrets.nix:\n")
+			fmt.Printf("  Admins: %d\n", len(config.Admins))
+			fmt.Printf("  Hosts: %d\n", len(config.Hosts))
+			fmt.Printf("  Secrets: %d\n\n", len(config.Secrets))
+
+			if dryRun {
+				fmt.Println("Would rekey the following secrets:")
+				if onlyChanged {
+					result, err := secrets.SyncCheck(secretsDir, config)
+					if err != nil {
+						return fmt.Errorf("checking sync status: %w", err)
+					}
+					for _, e := range result.OutOfSync() {
+						fmt.Printf("  %s -> %d recipients (currently %d)\n", e.Secret, e.DeclaredCount, e.ActualCount)
+					}
+				} else {
+					for name, entry := range config.Secrets {
+						fmt.Printf("  %s -> %d recipients\n", name, len(entry.PublicKeys))
+					}
+				}
+				return nil
+			}
+
+			rekeyed, err := secrets.RekeyAll(ctx, secretsDir, config, identityPath, false, onlyChanged)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Rekeyed %d secret(s):\n", len(rekeyed))
+			for _, name := range rekeyed {
+				entry := config.Secrets[name]
+				fmt.Printf("  ✓ %s (%d recipients)\n", name, len(entry.PublicKeys))
+			}
+
+			if signIdentity == "" {
+				signIdentity = defaultSignIdentity()
+			}
+			if err := resealIfManifestExists(ctx, secretsDir, manifestPath, config, signIdentity, actor); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&secretsNixPath, "config", "c", "secrets/secrets.nix", "Path to secrets.nix")
+	cmd.Flags().StringVarP(&secretsDir, "secrets-dir", "s", "secrets/", "Directory containing .age files")
+	cmd.Flags().StringVar(&identityPath, "identity", "", "Path to age identity for decryption (default: ~/.config/age/admin-key.txt)")
+	cmd.Flags().StringVar(&manifestPath, "manifest", defaultManifestPath, "Path to the integrity manifest; rekey reseals it automatically if it exists")
+	cmd.Flags().StringVar(&signIdentity, "sign-identity", "", "SSH private key used to reseal the manifest (default: ~/.ssh/id_ed25519)")
+	cmd.Flags().StringVar(&actor, "actor", os.Getenv("USER"), "Signer principal recorded in the manifest when rekey reseals it")
+	cmd.Flags().BoolVar(&onlyChanged, "only-changed", false, "Only rewrite secrets whose recipient count is out of sync with secrets.nix")
+
+	return cmd
+}
+
+func secretsSyncCheckCmd() *cobra.Command {
+	var secretsNixPath string
+	var secretsDir string
+	var identityPath string
+	var fix bool
+
+	cmd := &cobra.Command{
+		Use:   "sync-check",
+		Short: "Check secrets.nix recipients against on-disk .age files",
+		Long: `Compare, for every secret in secrets.nix, the number of recipients
+declared against the recipient stanzas actually present in its .age file -
+a header parse, no decryption needed, so it's fast enough to run in a
+pre-push hook or CI on every commit that touches secrets.nix.
+
+Reports secrets whose on-disk recipients are out of sync: usually because
+secrets.nix was edited to add or remove a host's access and nobody ran
+'secrets rekey' afterward, so that host still can't (or, worse, still can)
+decrypt it.
+
+With --fix and --identity, rekeys only the out-of-sync secrets (not the
+whole directory like 'secrets rekey' does by default) and prints exactly
+which secrets changed. Exit code is non-zero whenever something is out of
+sync, fixed or not, so CI can gate on it.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			config, err := secrets.ParseSecretsNix(ctx, secretsNixPath)
+			if err != nil {
+				return fmt.Errorf("parsing secrets.nix: %w", err)
+			}
+
+			result, err := secrets.SyncCheck(secretsDir, config)
+			if err != nil {
+				return fmt.Errorf("checking sync status: %w", err)
+			}
+
+			outOfSync := result.OutOfSync()
+			if len(outOfSync) == 0 {
+				fmt.Println("All secrets are in sync with secrets.nix.")
+				return nil
+			}
+
+			fmt.Printf("%d secret(s) out of sync with secrets.nix:\n", len(outOfSync))
+			for _, e := range outOfSync {
+				fmt.Printf("  %s: secrets.nix declares %d recipient(s), file has %d\n", e.Secret, e.DeclaredCount, e.ActualCount)
+			}
+
+			if !fix {
+				return fmt.Errorf("%d secret(s) out of sync (run with --fix to rekey them)", len(outOfSync))
+			}
+
+			if identityPath == "" {
+				home, _ := os.UserHomeDir()
+				identityPath = home + "/.config/age/admin-key.txt"
+			}
+			if _, err := os.Stat(identityPath); os.IsNotExist(err) {
+				return fmt.Errorf("identity file not found: %s\nUse --identity to specify your age identity file", identityPath)
+			}
+
+			fmt.Println()
+			rekeyed, err := secrets.RekeyOutOfSync(ctx, secretsDir, config, identityPath, result, false)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Rekeyed %d secret(s):\n", len(rekeyed))
+			for _, name := range rekeyed {
+				fmt.Printf("  ✓ %s\n", name)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&secretsNixPath, "config", "c", "secrets/secrets.nix", "Path to secrets.nix")
+	cmd.Flags().StringVarP(&secretsDir, "secrets-dir", "s", "secrets/", "Directory containing .age files")
+	cmd.Flags().StringVar(&identityPath, "identity", "", "Path to age identity for decryption when using --fix (default: ~/.config/age/admin-key.txt)")
+	cmd.Flags().BoolVar(&fix, "fix", false, "Rekey the out-of-sync secrets instead of just reporting them")
+
+	return cmd
+}
+
+func secretsVerifyCmd() *cobra.Command {
+	var secretsNixPath string
+	var secretsDir string
+	var fixMissing bool
+	var assumeYes bool
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check secrets.nix and the secrets directory for drift",
+		Long: `Parse secrets.nix and cross-check it against --secrets-dir for three
+kinds of drift that build up over months of edits to either side:
+
+  orphaned files - .age files on disk with no secrets.nix entry, so
+                   'secrets rekey' never re-encrypts them
+  missing files  - secrets.nix entries whose .age file doesn't exist
+  stale rekeys   - files whose recipient stanza count no longer matches
+                   the entry's publicKeys (secrets.nix was edited to add
+                   or remove a recipient and nobody ran 'secrets rekey')
+
+Exit code is non-zero whenever any of the three is found, so this can gate
+CI on a repo whose secrets.nix and secrets/ have diverged.
+
+--fix-missing removes secrets.nix's declaration for each missing-file
+entry, after confirmation. It only rewrites entries declared on a single
+line ("name.age".publicKeys = ...;), the shape secrets.nix already uses -
+anything split across lines is reported but left for a human to edit.
+Orphaned files and stale rekeys are reported but never modified - those
+require judgment about whether to add an entry or delete a file, and
+which recipients a stale rekey should actually use.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			config, err := secrets.ParseSecretsNix(ctx, secretsNixPath)
+			if err != nil {
+				return fmt.Errorf("parsing secrets.nix: %w", err)
+			}
+
+			result, err := secrets.Verify(secretsDir, config)
+			if err != nil {
+				return fmt.Errorf("verifying secrets: %w", err)
+			}
+
+			if result.Clean() {
+				fmt.Printf("secrets.nix and %s are in sync\n", secretsDir)
+				return nil
+			}
+
+			if len(result.OrphanedFiles) > 0 {
+				fmt.Println("Files without a secrets.nix entry:")
+				for _, f := range result.OrphanedFiles {
+					fmt.Printf("  ? %s\n", f)
+				}
+			}
+			if len(result.MissingFiles) > 0 {
+				fmt.Println("secrets.nix entries with no file on disk:")
+				for _, f := range result.MissingFiles {
+					fmt.Printf("  - %s\n", f)
+				}
+			}
+			if len(result.StaleRekeys) > 0 {
+				fmt.Println("Secrets whose recipients no longer match secrets.nix:")
+				for _, e := range result.StaleRekeys {
+					fmt.Printf("  - %s: declares %d recipient(s), file has %d\n", e.Secret, e.DeclaredCount, e.ActualCount)
+				}
+			}
+
+			if fixMissing && len(result.MissingFiles) > 0 {
+				fmt.Printf("\nThis will remove %d entr(y/ies) from %s.\n", len(result.MissingFiles), secretsNixPath)
+				if !assumeYes {
+					fmt.Print("Type 'yes' to confirm: ")
+					var confirm string
+					if _, err := fmt.Scanln(&confirm); err != nil || confirm != "yes" {
+						fmt.Println("Aborted")
+						return fmt.Errorf("secrets.nix and %s are out of sync", secretsDir)
+					}
+				}
+
+				removed, skipped, err := secrets.RemoveSecretsNixEntries(secretsNixPath, result.MissingFiles)
+				if err != nil {
+					return fmt.Errorf("editing secrets.nix: %w", err)
+				}
+				for _, name := range removed {
+					fmt.Printf("Removed %s from %s\n", name, secretsNixPath)
+				}
+				for _, name := range skipped {
+					fmt.Printf("Could not auto-remove %s (not declared on a single line) - edit %s by hand\n", name, secretsNixPath)
+				}
+
+				config, err = secrets.ParseSecretsNix(ctx, secretsNixPath)
+				if err != nil {
+					return fmt.Errorf("re-parsing secrets.nix after fix: %w", err)
+				}
+				result, err = secrets.Verify(secretsDir, config)
+				if err != nil {
+					return fmt.Errorf("re-verifying secrets after fix: %w", err)
+				}
+				if result.Clean() {
+					fmt.Printf("secrets.nix and %s are now in sync\n", secretsDir)
+					return nil
+				}
+			}
+
+			return fmt.Errorf("secrets.nix and %s are out of sync", secretsDir)
+		},
+	}
+
+	cmd.Flags().StringVarP(&secretsNixPath, "config", "c", "secrets/secrets.nix", "Path to secrets.nix")
+	cmd.Flags().StringVarP(&secretsDir, "secrets-dir", "s", "secrets/", "Directory containing .age files")
+	cmd.Flags().BoolVar(&fixMissing, "fix-missing", false, "Remove secrets.nix entries whose file is missing, after confirmation")
+	cmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Skip the confirmation prompt for --fix-missing")
+
+	return cmd
+}
+
+func secretsEditCmd() *cobra.Command {
+	var secretsNixPath string
+	var secretsDir string
+	var identityPath string
+	var manifestPath string
+	var signIdentity string
+	var ref approvalRef
+	var approvalID, allowedSigners, actor, auditLogPath string
+
+	cmd := &cobra.Command{
+		Use:   "edit [secret-file]",
+		Short: "Edit a secret in-place",
+		Long: `Decrypt a secret, open in $EDITOR, and re-encrypt with the same recipients.
+
+The recipients are looked up from secrets.nix to ensure proper multi-recipient encryption.
+
+A secret marked requiresApproval = true in secrets.nix can't be edited
+without --approval naming a request with a valid grant from a second
+admin (see 'nixfleet approvals').
+
+Example:
+  nixfleet secrets edit secrets/api-key.age`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeSecretNames,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			secretPath := args[0]
+
+			if identityPath == "" {
+				home, _ := os.UserHomeDir()
+				identityPath = home + "/.config/age/admin-key.txt"
+			}
+
+			// Check identity exists
+			if _, err := os.Stat(identityPath); os.IsNotExist(err) {
+				return fmt.Errorf("identity file not found: %s", identityPath)
+			}
+
+			// Check secret exists
+			if _, err := os.Stat(secretPath); os.IsNotExist(err) {
+				return fmt.Errorf("secret file not found: %s", secretPath)
+			}
+
+			// Parse secrets.nix to get recipients
+			config, err := secrets.ParseSecretsNix(ctx, secretsNixPath)
+			if err != nil {
+				return fmt.Errorf("parsing secrets.nix: %w", err)
+			}
+
+			// Get secret name (basename)
+			secretName := filepath.Base(secretPath)
+			recipients, err := config.LookupRecipientsForSecret(secretName)
+			if err != nil {
+				return err
+			}
+
+			var audit *secrets.AuditLogger
+			if auditLogPath != "" {
+				audit = secrets.NewAuditLogger(auditLogPath)
+			}
+
+			if entry, ok := config.Secrets[secretName]; ok && entry.RequiresApproval {
+				if err := requireApproval(ctx, ref, allowedSigners, approvalID, secretName, secrets.OperationEdit); err != nil {
+					if audit != nil {
+						_ = audit.Log(secrets.AuditEntry{Actor: actor, SecretName: secretName, Operation: secrets.OperationEdit, ApprovalID: approvalID, Allowed: false, Reason: err.Error()})
+					}
+					return err
+				}
+				if audit != nil {
+					_ = audit.Log(secrets.AuditEntry{Actor: actor, SecretName: secretName, Operation: secrets.OperationEdit, ApprovalID: approvalID, Allowed: true})
+				}
+			}
+
+			fmt.Printf("Editing %s (%d recipients)\n", secretName, len(recipients))
+			fmt.Printf("Opening in $EDITOR...\n\n")
+
+			if err := secrets.EditSecret(ctx, secretPath, recipients, identityPath); err != nil {
+				return err
+			}
+
+			fmt.Println("Secret updated successfully")
+
+			if signIdentity == "" {
+				signIdentity = defaultSignIdentity()
+			}
+			if err := resealIfManifestExists(ctx, secretsDir, manifestPath, config, signIdentity, actor); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&secretsNixPath, "config", "c", "secrets/secrets.nix", "Path to secrets.nix")
+	cmd.Flags().StringVarP(&secretsDir, "secrets-dir", "s", "secrets/", "Directory containing .age files, used to reseal the manifest")
+	cmd.Flags().StringVar(&identityPath, "identity", "", "Path to age identity for decryption (default: ~/.config/age/admin-key.txt)")
+	cmd.Flags().StringVar(&approvalID, "approval", "", "Approval request ID, required if the secret is marked requiresApproval")
+	cmd.Flags().StringVar(&allowedSigners, "allowed-signers", "secrets/allowed_signers", "SSH allowed_signers file used to verify approval grants")
+	cmd.Flags().StringVar(&actor, "actor", os.Getenv("USER"), "Actor name recorded in --audit-log, and manifest signer when edit reseals it")
+	cmd.Flags().StringVar(&auditLogPath, "audit-log", "", "Path to append this edit decision as a JSON line")
+	cmd.Flags().StringVar(&manifestPath, "manifest", defaultManifestPath, "Path to the integrity manifest; edit reseals it automatically if it exists")
+	cmd.Flags().StringVar(&signIdentity, "sign-identity", "", "SSH private key used to reseal the manifest (default: ~/.ssh/id_ed25519)")
+	ref.addApprovalFlags(cmd)
+
+	return cmd
+}
+
+func secretsAddCmd() *cobra.Command {
+	var secretsNixPath string
+	var secretsDir string
+	var recipients []string
+	var fromFile string
+	var hostNames []string
+	var manifestPath string
+	var signIdentity string
+	var actor string
+
+	cmd := &cobra.Command{
+		Use:   "add [secret-name]",
+		Short: "Add a new encrypted secret",
+		Long: `Create a new encrypted secret file.
+
+Secret value can be provided via:
+  - stdin (pipe or interactive)
+  - --from-file flag
+
+Recipients are determined by:
+  - --recipient flags (explicit keys)
+  - --host flags (looked up from secrets.nix)
+  - Default: all admins from secrets.nix
+
+Example:
+  echo "my-secret-value" | nixfleet secrets add api-key.age
+  nixfleet secrets add db-password.age --host gtr --host web-1
+  nixfleet secrets add ssl-cert.age --from-file /path/to/cert.pem`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			secretName := args[0]
+
+			// Ensure .age extension
+			if !strings.HasSuffix(secretName, ".age") {
+				secretName += ".age"
+			}
+
+			secretPath := filepath.Join(secretsDir, secretName)
+
+			// Check if already exists
+			if _, err := os.Stat(secretPath); err == nil {
+				return fmt.Errorf("secret already exists: %s\nUse 'nixfleet secrets edit' to modify", secretPath)
+			}
+
+			// Determine recipients
+			var finalRecipients []string
+			if len(recipients) > 0 {
+				finalRecipients = recipients
+			} else {
+				// Parse secrets.nix
+				config, err := secrets.ParseSecretsNix(ctx, secretsNixPath)
+				if err != nil {
+					return fmt.Errorf("parsing secrets.nix: %w", err)
+				}
+
+				// Start with all admins
+				finalRecipients = append(finalRecipients, config.AllAdmins...)
+
+				// Add specified hosts
+				for _, hostName := range hostNames {
+					if key, ok := config.Hosts[hostName]; ok {
+						finalRecipients = append(finalRecipients, key)
+					} else {
+						return fmt.Errorf("host %q not found in secrets.nix", hostName)
+					}
+				}
+
+				if len(finalRecipients) == 0 {
+					return fmt.Errorf("no recipients specified and no admins in secrets.nix")
+				}
+			}
+
+			// Get secret content
+			var content []byte
+			var err error
+			if fromFile != "" {
+				content, err = os.ReadFile(fromFile)
+				if err != nil {
+					return fmt.Errorf("reading file: %w", err)
+				}
+			} else {
+				// Read from stdin
+				fmt.Println("Enter secret value (Ctrl+D to finish):")
+				content, err = os.ReadFile("/dev/stdin")
+				if err != nil {
+					return fmt.Errorf("reading stdin: %w", err)
+				}
+			}
+
+			if len(content) == 0 {
+				return fmt.Errorf("empty secret content")
+			}
+
+			if dryRun {
+				fmt.Printf("Would create %s with %d recipients\n", secretPath, len(finalRecipients))
+				return nil
+			}
+
+			if err := secrets.AddSecret(ctx, secretPath, content, finalRecipients); err != nil {
+				return err
+			}
+
+			fmt.Printf("Created %s (%d recipients)\n", secretPath, len(finalRecipients))
+			fmt.Println("\nDon't forget to add this secret to secrets.nix:")
+			fmt.Printf("  \"%s\".publicKeys = allAdmins ++ [ hosts.<hostname> ];\n", secretName)
+
+			// secrets.nix may not even reference secretName yet (see the
+			// reminder above), so a reseal here just records the file as
+			// orphaned until the next add/edit/rekey after secrets.nix
+			// catches up - still an honest snapshot, not worth failing on.
+			config, err := secrets.ParseSecretsNix(ctx, secretsNixPath)
+			if err != nil {
+				config = nil
+			}
+			if signIdentity == "" {
+				signIdentity = defaultSignIdentity()
+			}
+			if err := resealIfManifestExists(ctx, secretsDir, manifestPath, config, signIdentity, actor); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&secretsNixPath, "config", "c", "secrets/secrets.nix", "Path to secrets.nix")
+	cmd.Flags().StringVarP(&secretsDir, "secrets-dir", "s", "secrets/", "Output directory")
+	cmd.Flags().StringSliceVarP(&recipients, "recipient", "r", nil, "Age recipient public key(s)")
+	cmd.Flags().StringSliceVar(&hostNames, "host", nil, "Host name(s) from secrets.nix to add as recipients")
+	cmd.Flags().StringVar(&fromFile, "from-file", "", "Read secret value from file")
+	cmd.Flags().StringVar(&manifestPath, "manifest", defaultManifestPath, "Path to the integrity manifest; add reseals it automatically if it exists")
+	cmd.Flags().StringVar(&signIdentity, "sign-identity", "", "SSH private key used to reseal the manifest (default: ~/.ssh/id_ed25519)")
+	cmd.Flags().StringVar(&actor, "actor", os.Getenv("USER"), "Signer principal recorded in the manifest when add reseals it")
+
+	return cmd
+}
+
+func secretsHostKeyCmd() *cobra.Command {
+	var sshKeyPath string
+
+	cmd := &cobra.Command{
+		Use:   "host-key [host]",
+		Short: "Get age public key from a host's SSH key",
+		Long: `Derive an age public key from a host's SSH ed25519 host key.
+
+This can be used to:
+  - Get a host's age key for adding to secrets.nix
+  - Verify the expected key for a host
+
+Examples:
+  # Get key from remote host
+  nixfleet secrets host-key gtr
+
+  # Get key from local SSH key file
+  nixfleet secrets host-key --ssh-key /path/to/ssh_host_ed25519_key.pub`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if sshKeyPath != "" {
+				// Local file mode
+				key, err := secrets.GetHostAgeKey(ctx, sshKeyPath)
+				if err != nil {
+					return err
+				}
+				fmt.Println(key)
+				return nil
+			}
+
+			// Remote host mode - need a host argument
+			if len(args) == 0 {
+				return fmt.Errorf("specify a host or use --ssh-key for a local file")
+			}
+
+			_, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			// Find the target host
+			var targetHost *inventory.Host
+			for _, h := range hosts {
+				if h.Name == args[0] {
+					targetHost = h
+					break
+				}
+			}
+
+			if targetHost == nil {
+				return fmt.Errorf("host %q not found in inventory", args[0])
+			}
+
+			port := targetHost.SSHPort
+			if port == 0 {
+				port = 22
+			}
+
+			key, err := secrets.GetHostAgeKeyFromRemote(ctx, targetHost.Addr, targetHost.SSHUser, port)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Host: %s\n", targetHost.Name)
+			fmt.Printf("Age public key: %s\n", key)
+			fmt.Println("\nAdd to secrets.nix:")
+			fmt.Printf("  %s = \"%s\";\n", targetHost.Name, key)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&sshKeyPath, "ssh-key", "", "Path to SSH public key file (for local keys)")
+
+	return cmd
+}
+
+func driftCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "drift",
+		Short: "Detect and fix configuration drift",
+		Long: `Detect and remediate configuration drift on managed hosts.
+
+Subcommands:
+  check  - Check for configuration drift
+  fix    - Remediate detected drift
+  accept - Approve current on-host content as the new expected state
+  status - Show drift status from cached state
+  report - Report which hosts and files drift repeatedly, and for how long`,
+	}
+
+	cmd.AddCommand(driftCheckCmd())
+	cmd.AddCommand(driftFixCmd())
+	cmd.AddCommand(driftAcceptCmd())
+	cmd.AddCommand(driftStatusCmd())
+	cmd.AddCommand(driftReportCmd())
+
+	return cmd
+}
+
+func driftAcceptCmd() *cobra.Command {
+	var (
+		files         []string
+		by            string
+		webhookURL    string
+		webhookSecret string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "accept",
+		Short: "Approve current drift as the new expected state",
+		Long: `Accept intentional drift instead of reverting it.
+
+Re-hashes the current on-host content and permissions for --files, records
+them as the new expected ManagedFiles state (with who accepted it and
+when), and clears those paths from DriftFiles.
+
+A subsequent 'nixfleet apply' will refuse to overwrite accepted paths
+unless --overwrite-accepted is also passed, so the hotfix isn't clobbered
+before it's upstreamed into the Nix config.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if len(files) == 0 {
+				return fmt.Errorf("--files is required")
+			}
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			acceptedBy := by
+			if acceptedBy == "" {
+				acceptedBy = os.Getenv("USER")
+			}
+			if acceptedBy == "" {
+				acceptedBy = "unknown"
+			}
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			stateMgr := state.NewManager()
+
+			for _, host := range hosts {
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
+					continue
+				}
+
+				accepted, err := stateMgr.AcceptDrift(ctx, client, files, acceptedBy)
+				if err != nil {
+					fmt.Printf("%s: accept failed - %v\n", host.Name, err)
+					continue
+				}
+				if len(accepted) == 0 {
+					fmt.Printf("%s: no matching managed files, nothing accepted\n", host.Name)
+					continue
+				}
+
+				fmt.Printf("%s: accepted drift on %s (by %s)\n", host.Name, strings.Join(accepted, ", "), acceptedBy)
+				postWebhook(webhookURL, webhookSecret, "drift-accept", map[string]any{
+					"host":  host.Name,
+					"files": accepted,
+					"by":    acceptedBy,
+				})
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&files, "files", nil, "Comma-separated file paths to accept drift for")
+	cmd.Flags().StringVar(&by, "by", "", "Who is accepting the drift (default: $USER)")
+	cmd.Flags().StringVar(&webhookURL, "webhook-url", "", "Webhook URL to notify of the acceptance")
+	cmd.Flags().StringVar(&webhookSecret, "webhook-secret", "", "Webhook secret for signing")
+
+	return cmd
+}
+
+// approvalRef points at where two-person-rule approval requests live: a
+// running nixfleet server (Server set, reached over HTTP the way
+// postWebhook reaches a webhook receiver) or a local approvals.json under
+// DataDir (the "offline mode" the request describes, read/written directly
+// via server.ApprovalStore the same way 'server backup' reads a data dir
+// without a live *Server).
+type approvalRef struct {
+	Server   string
+	APIToken string
+	DataDir  string
+}
+
+func (a approvalRef) online() bool { return a.Server != "" }
+
+func (a *approvalRef) addApprovalFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&a.Server, "server", "", "nixfleet server URL (e.g. http://localhost:8080); unset uses --data-dir directly")
+	cmd.Flags().StringVar(&a.APIToken, "api-token", defaultServerToken(), "API authentication token for --server")
+	cmd.Flags().StringVar(&a.DataDir, "data-dir", ".", "Server data dir to read/write approvals.json from when --server is unset")
+}
+
+func createApproval(ctx context.Context, ref approvalRef, secretName string, op secrets.Operation, requester, purpose string, ttl time.Duration, identityPath string) (*secrets.ApprovalRequest, error) {
+	req := secrets.NewApprovalRequest(secretName, op, requester, purpose, ttl)
+	if err := secrets.SignRequest(ctx, req, identityPath); err != nil {
+		return nil, err
+	}
+
+	if !ref.online() {
+		store := server.NewApprovalStore(ref.DataDir)
+		if err := store.Create(req); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+
+	var resp secrets.ApprovalRequest
+	body := map[string]any{
+		"secret_name":         secretName,
+		"operation":           op,
+		"requester":           requester,
+		"purpose":             purpose,
+		"expires_at":          req.ExpiresAt,
+		"requester_signature": req.RequesterSignature,
+	}
+	if err := approvalHTTP(ctx, ref, "POST", "/api/approvals", body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func getApproval(ctx context.Context, ref approvalRef, id string) (*secrets.ApprovalRequest, error) {
+	if !ref.online() {
+		store := server.NewApprovalStore(ref.DataDir)
+		req, ok := store.Get(id)
+		if !ok {
+			return nil, fmt.Errorf("approval request %s not found in %s", id, ref.DataDir)
+		}
+		return req, nil
+	}
+
+	var req secrets.ApprovalRequest
+	if err := approvalHTTP(ctx, ref, "GET", "/api/approvals/"+id, nil, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func listApprovalsRef(ctx context.Context, ref approvalRef) ([]*secrets.ApprovalRequest, error) {
+	if !ref.online() {
+		store := server.NewApprovalStore(ref.DataDir)
+		return store.List(), nil
+	}
+
+	var resp struct {
+		Approvals []*secrets.ApprovalRequest `json:"approvals"`
+	}
+	if err := approvalHTTP(ctx, ref, "GET", "/api/approvals", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Approvals, nil
+}
+
+func addApprovalGrant(ctx context.Context, ref approvalRef, id string, grant secrets.Grant) (*secrets.ApprovalRequest, error) {
+	if !ref.online() {
+		store := server.NewApprovalStore(ref.DataDir)
+		return store.AddGrant(id, grant)
+	}
+
+	var req secrets.ApprovalRequest
+	if err := approvalHTTP(ctx, ref, "POST", "/api/approvals/"+id+"/grant", grant, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// approvalHTTP issues a JSON request against ref.Server, the same
+// http.Client-per-call approach postWebhook uses, and decodes the response
+// body into out (skipped if out is nil).
+func approvalHTTP(ctx context.Context, ref approvalRef, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(ref.Server, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if ref.APIToken != "" {
+		req.Header.Set("Authorization", "Bearer "+ref.APIToken)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, string(respBody))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// requireApproval enforces the two-person rule on a secret marked
+// requiresApproval = true: approvalID must name a request bound to exactly
+// this secretName and operation with a valid, non-expired grant from a
+// second admin, or the caller is told how to obtain one.
+func requireApproval(ctx context.Context, ref approvalRef, allowedSigners, approvalID, secretName string, operation secrets.Operation) error {
+	if approvalID == "" {
+		return fmt.Errorf("secret %q requires approval - request one with 'nixfleet approvals request %s %s' and have a second admin run 'nixfleet approvals grant <id>', then retry with --approval <id>", secretName, secretName, operation)
+	}
+
+	req, err := getApproval(ctx, ref, approvalID)
+	if err != nil {
+		return fmt.Errorf("loading approval %s: %w", approvalID, err)
+	}
+	if req.SecretName != secretName || req.Operation != operation {
+		return fmt.Errorf("approval %s is for %s/%s, not %s/%s", approvalID, req.SecretName, req.Operation, secretName, operation)
+	}
+
+	ok, err := req.HasValidGrant(ctx, allowedSigners)
+	if err != nil {
+		return fmt.Errorf("verifying approval %s: %w", approvalID, err)
+	}
+	if !ok {
+		return fmt.Errorf("approval %s has no valid grant yet from a second admin", approvalID)
+	}
+	return nil
+}
+
+func approvalsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "approvals",
+		Short: "Manage two-person-rule approvals for requiresApproval secrets",
+		Long: `Request and grant approvals for secrets marked requiresApproval = true
+in secrets.nix, which 'secrets decrypt'/'secrets edit' refuse to touch
+without one.
+
+Subcommands:
+  request - Create a new approval request
+  list    - List approval requests
+  show    - Show a single approval request
+  grant   - Countersign a request as a second admin
+
+By default these read/write approvals.json under --data-dir directly
+("offline mode"); pass --server to talk to a running nixfleet server's
+/api/approvals endpoints instead.`,
+	}
+
+	cmd.AddCommand(approvalsRequestCmd())
+	cmd.AddCommand(approvalsListCmd())
+	cmd.AddCommand(approvalsShowCmd())
+	cmd.AddCommand(approvalsGrantCmd())
+
+	return cmd
+}
+
+func approvalsRequestCmd() *cobra.Command {
+	var ref approvalRef
+	var requester, purpose, identityPath string
+	var ttl time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "request <secret-name> <decrypt|edit|deploy>",
+		Short: "Create a new approval request",
+		Long: `Create a two-person-rule approval request bound to exactly one secret
+and operation, signed with --identity to prove --requester names a real
+signer (matching an allowed_signers entry) rather than an arbitrary
+string. A second admin (not --requester) must grant it with
+'nixfleet approvals grant <id>' before the gated command will proceed.
+
+Example:
+  nixfleet approvals request cloud-master-key.age decrypt --requester alice@example.com --identity ~/.ssh/id_ed25519 --purpose "rotating expired cert"`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if requester == "" {
+				return fmt.Errorf("--requester is required")
+			}
+			req, err := createApproval(cmd.Context(), ref, args[0], secrets.Operation(args[1]), requester, purpose, ttl, identityPath)
+			if err != nil {
+				return fmt.Errorf("creating approval: %w", err)
+			}
+			fmt.Printf("Created approval %s for %s/%s, expires %s\n", req.ID, req.SecretName, req.Operation, req.ExpiresAt.Format(time.RFC3339))
+			return nil
+		},
+	}
+
+	ref.addApprovalFlags(cmd)
+	cmd.Flags().StringVar(&requester, "requester", "", "Signer principal of the person requesting approval (must match an allowed_signers entry)")
+	cmd.Flags().StringVar(&purpose, "purpose", "", "Why this operation is needed")
+	cmd.Flags().DurationVar(&ttl, "ttl", secrets.DefaultApprovalTTL, "How long the request stays valid")
+	cmd.Flags().StringVar(&identityPath, "identity", "", "Path to the requester's own SSH private key, used to prove --requester is real")
+	cmd.MarkFlagRequired("identity")
+
+	return cmd
+}
+
+func approvalsListCmd() *cobra.Command {
+	var ref approvalRef
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List approval requests",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reqs, err := listApprovalsRef(cmd.Context(), ref)
+			if err != nil {
+				return err
+			}
+			if len(reqs) == 0 {
+				fmt.Println("No approval requests")
+				return nil
+			}
+			for _, r := range reqs {
+				status := "pending"
+				if r.IsExpired() {
+					status = "expired"
+				} else if len(r.Grants) > 0 {
+					status = "granted"
+				}
+				fmt.Printf("%s  %-8s %-8s %-30s %s\n", r.ID, r.Operation, status, r.SecretName, r.Requester)
+			}
+			return nil
+		},
+	}
+
+	ref.addApprovalFlags(cmd)
+	return cmd
+}
+
+func approvalsShowCmd() *cobra.Command {
+	var ref approvalRef
+
+	cmd := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show a single approval request",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req, err := getApproval(cmd.Context(), ref, args[0])
+			if err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(req, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		},
+	}
+
+	ref.addApprovalFlags(cmd)
+	return cmd
+}
+
+func approvalsGrantCmd() *cobra.Command {
+	var ref approvalRef
+	var identityPath, signerPrincipal string
+
+	cmd := &cobra.Command{
+		Use:   "grant <id>",
+		Short: "Countersign an approval request as a second admin",
+		Long: `Sign the approval request identified by <id> with an SSH private key
+(via 'ssh-keygen -Y sign') and record the resulting grant. Refuses to let
+the requester grant their own request.
+
+Example:
+  nixfleet approvals grant a1b2c3d4e5f6a7b8 --identity ~/.ssh/id_ed25519 --as bob@example.com`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			id := args[0]
+
+			if signerPrincipal == "" {
+				return fmt.Errorf("--as is required (your signer principal, matching an allowed_signers entry)")
+			}
+
+			req, err := getApproval(ctx, ref, id)
+			if err != nil {
+				return err
+			}
+
+			grant, err := secrets.SignGrant(ctx, req, identityPath, signerPrincipal)
+			if err != nil {
+				return fmt.Errorf("signing grant: %w", err)
+			}
+
+			updated, err := addApprovalGrant(ctx, ref, id, grant)
+			if err != nil {
+				return fmt.Errorf("recording grant: %w", err)
+			}
+
+			fmt.Printf("Granted %s (now has %d grant(s))\n", updated.ID, len(updated.Grants))
+			return nil
+		},
+	}
+
+	ref.addApprovalFlags(cmd)
+	cmd.Flags().StringVar(&identityPath, "identity", "", "Path to the SSH private key to sign with")
+	cmd.Flags().StringVar(&signerPrincipal, "as", "", "Your signer principal (matching an allowed_signers entry)")
+	cmd.MarkFlagRequired("identity")
+
+	return cmd
+}
+
+// postWebhook sends a best-effort event notification for CLI commands that
+// don't run against a server instance (see Server.sendWebhook for the
+// equivalent used by server-triggered events). Errors are logged, not
+// returned, since a failed notification shouldn't fail the underlying
+// operation it's reporting on.
+func postWebhook(url, secret, event string, data map[string]any) {
+	if url == "" {
+		return
+	}
+
+	payload := map[string]any{
+		"event":     event,
+		"timestamp": time.Now(),
+		"data":      data,
+	}
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "webhook error: %v\n", err)
+		return
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(jsonData))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "webhook error: %v\n", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set("X-Webhook-Secret", secret)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "webhook error: %v\n", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func driftCheckCmd() *cobra.Command {
+	var saveState bool
+	var historyDir string
+
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check for configuration drift",
+		Long: `Compare current file states against expected configuration.
+
+With --save-state, each host's result is also appended to --history-dir's
+drift-history.json, the trend history 'nixfleet drift report' reads - so a
+single ad-hoc check contributes to the same record as the server's
+scheduled checks, as long as they share a history dir.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			stateMgr := state.NewManager()
+			var history *driftreport.Store
+			if saveState {
+				history = driftreport.NewStore(historyDir)
+			}
+
+			fmt.Printf("Checking drift on %d host(s)...\n\n", len(hosts))
+
+			totalDrift := 0
+			for _, host := range hosts {
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
+					continue
+				}
+
+				if err := stateMgr.CheckBaseMatch(ctx, client, host.Base); err != nil {
+					fmt.Printf("%s: %v\n", host.Name, err)
+					continue
+				}
+
+				// Read current state from host
+				hostState, err := stateMgr.ReadState(ctx, client)
+				if err != nil {
+					fmt.Printf("%s: failed to read state - %v\n", host.Name, err)
+					continue
+				}
+
+				if len(hostState.ManagedFiles) == 0 && len(hostState.ManagedDirs) == 0 {
+					fmt.Printf("%s: no managed files configured\n", host.Name)
+					continue
+				}
+
+				// Check drift against managed files
+				results, err := stateMgr.CheckDrift(ctx, client, hostState.ManagedFiles)
+				if err != nil {
+					fmt.Printf("%s: drift check failed - %v\n", host.Name, err)
+					continue
+				}
+
+				// Check for unexpected files inside managed directories -
+				// drift CheckDrift can't see, since it only ever compares
+				// paths it already knows about.
+				dirResults, err := stateMgr.CheckManagedDirs(ctx, client, hostState.ManagedDirs)
+				if err != nil {
+					fmt.Printf("%s: managed directory check failed - %v\n", host.Name, err)
+				} else {
+					results = append(results, dirResults...)
+				}
+
+				// Count drift
+				driftCount := 0
+				for _, r := range results {
+					if r.HasDrift() {
+						driftCount++
+					}
+				}
+
+				if driftCount == 0 {
+					fmt.Printf("%s: no drift detected (%d files checked)\n", host.Name, len(results))
+				} else {
+					fmt.Printf("%s: DRIFT DETECTED (%d/%d files)\n", host.Name, driftCount, len(results))
+					for _, r := range results {
+						if r.HasDrift() {
+							fmt.Printf("  - %s: %s\n", r.Path, r.Status)
+							if verbose {
+								switch r.Status {
+								case state.DriftStatusContentChanged:
+									fmt.Printf("      expected hash: %s\n", r.Expected.Hash[:16]+"...")
+									fmt.Printf("      actual hash:   %s\n", r.Actual.Hash[:16]+"...")
+								case state.DriftStatusPermissionsChanged:
+									fmt.Printf("      expected: %s %s:%s\n", r.Expected.Mode, r.Expected.Owner, r.Expected.Group)
+									fmt.Printf("      actual:   %s %s:%s\n", r.Actual.Mode, r.Actual.Owner, r.Actual.Group)
+								}
+							}
+						}
+					}
+					totalDrift += driftCount
+				}
+
+				// Update state with drift info
+				if saveState {
+					hostState.DriftDetected = driftCount > 0
+					hostState.DriftFiles = nil
+					for _, r := range results {
+						if r.HasDrift() {
+							hostState.DriftFiles = append(hostState.DriftFiles, r.Path)
+						}
+					}
+					hostState.LastDriftCheck = time.Now()
+					if err := stateMgr.WriteState(ctx, client, hostState); err != nil {
+						fmt.Printf("  warning: failed to save state - %v\n", err)
+					}
+					history.Record(host.Name, hostState.LastDriftCheck, hostState.DriftFiles)
+				}
+
+				fmt.Println()
+			}
+
+			if totalDrift > 0 {
+				fmt.Printf("Total: %d file(s) with drift detected\n", totalDrift)
+				fmt.Println("Run 'nixfleet drift fix' to remediate drift")
+			} else {
+				fmt.Println("No drift detected across all hosts")
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&saveState, "save-state", true, "Update host state with drift results")
+	cmd.Flags().StringVar(&historyDir, "history-dir", ".", "Directory to record drift-history.json in, for 'drift report' (only written when --save-state is set)")
+
+	return cmd
+}
+
+func driftFixCmd() *cobra.Command {
+	var filesOnly []string
+	var removeUnexpected bool
+	var restoreContent bool
+	var assumeYes bool
+
+	cmd := &cobra.Command{
+		Use:   "fix",
+		Short: "Remediate configuration drift",
+		Long: `Fix detected drift by restoring files to expected state.
+
+By default, restores permissions on drifted files. For content changes and
+missing files, a full re-apply is recommended, since that's where the
+content comes from - but with --restore-content, fix instead copies the
+file straight back from the active closure on the host, skipping the
+rebuild. Falls back to the re-apply message if that generation has since
+been garbage-collected.
+With --remove-unexpected, also deletes files found in managed directories
+that aren't on their allowlist (see 'nixfleet drift check').`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if removeUnexpected && !dryRun && !assumeYes {
+				fmt.Println("This will permanently delete files in managed directories that aren't on their allowlist.")
+				fmt.Print("Type 'yes' to confirm: ")
+				var confirm string
+				if _, err := fmt.Scanln(&confirm); err != nil || confirm != "yes" {
+					fmt.Println("Aborted")
+					return nil
+				}
+			}
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			stateMgr := state.NewManager()
+
+			fmt.Printf("Fixing drift on %d host(s)...\n\n", len(hosts))
+
+			for _, host := range hosts {
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("%s: connection failed - %v\n", host.Name, err)
+					continue
+				}
+
+				// Read current state
+				hostState, err := stateMgr.ReadState(ctx, client)
+				if err != nil {
+					fmt.Printf("%s: failed to read state - %v\n", host.Name, err)
+					continue
+				}
+
+				if len(hostState.ManagedFiles) == 0 && len(hostState.ManagedDirs) == 0 {
+					fmt.Printf("%s: no managed files configured\n", host.Name)
+					continue
+				}
+
+				// Check drift
+				results, err := stateMgr.CheckDrift(ctx, client, hostState.ManagedFiles)
+				if err != nil {
+					fmt.Printf("%s: drift check failed - %v\n", host.Name, err)
+					continue
+				}
+
+				dirResults, err := stateMgr.CheckManagedDirs(ctx, client, hostState.ManagedDirs)
+				if err != nil {
+					fmt.Printf("%s: managed directory check failed - %v\n", host.Name, err)
+					dirResults = nil
+				}
+
+				// Filter results if specific files requested
+				if len(filesOnly) > 0 {
+					filtered := make([]state.DriftResult, 0)
+					fileSet := make(map[string]bool)
+					for _, f := range filesOnly {
+						fileSet[f] = true
+					}
+					for _, r := range results {
+						if fileSet[r.Path] {
+							filtered = append(filtered, r)
+						}
+					}
+					results = filtered
+				}
+
+				// Fix drift
+				fixed := 0
+				skipped := 0
+				var stillDrifted []string
+				for _, r := range results {
+					if !r.HasDrift() {
+						continue
+					}
+
+					if dryRun {
+						fmt.Printf("%s: would fix %s (%s)\n", host.Name, r.Path, r.Status)
+						continue
+					}
+
+					if r.Status == state.DriftStatusContentChanged || r.Status == state.DriftStatusMissing {
+						if !restoreContent {
+							fmt.Printf("%s: %s - %s, run 'nixfleet apply' to restore\n", host.Name, r.Path, r.Status)
+							skipped++
+							stillDrifted = append(stillDrifted, r.Path)
+							continue
+						}
+
+						gone, err := stateMgr.RestoreFromStore(ctx, client, hostState.StorePath, r.Expected)
+						if err != nil {
+							fmt.Printf("%s: failed to restore %s from store - %v\n", host.Name, r.Path, err)
+							skipped++
+							stillDrifted = append(stillDrifted, r.Path)
+							continue
+						}
+						if gone {
+							fmt.Printf("%s: %s - store path gone (generation GC'd), run 'nixfleet apply' to restore\n", host.Name, r.Path)
+							skipped++
+							stillDrifted = append(stillDrifted, r.Path)
+							continue
+						}
+
+						fmt.Printf("%s: restored %s from store\n", host.Name, r.Path)
+						fixed++
+						continue
+					}
+
+					// Fix permissions
+					if r.Status == state.DriftStatusPermissionsChanged {
+						if err := stateMgr.FixDrift(ctx, client, r, nil); err != nil {
+							fmt.Printf("%s: failed to fix %s - %v\n", host.Name, r.Path, err)
+							stillDrifted = append(stillDrifted, r.Path)
+							continue
+						}
+						fmt.Printf("%s: fixed permissions on %s\n", host.Name, r.Path)
+						fixed++
+					}
+				}
+
+				// Remove unexpected files found in managed directories
+				removed := 0
+				var remainingUnexpected []string
+				for _, r := range dirResults {
+					if dryRun {
+						fmt.Printf("%s: would remove unexpected file %s\n", host.Name, r.Path)
+						continue
+					}
+					if !removeUnexpected {
+						fmt.Printf("%s: unexpected file %s (use --remove-unexpected to delete)\n", host.Name, r.Path)
+						remainingUnexpected = append(remainingUnexpected, r.Path)
+						continue
+					}
+					if err := stateMgr.RemoveUnexpectedFile(ctx, client, r.Path); err != nil {
+						fmt.Printf("%s: failed to remove %s - %v\n", host.Name, r.Path, err)
+						remainingUnexpected = append(remainingUnexpected, r.Path)
+						continue
+					}
+					fmt.Printf("%s: removed unexpected file %s\n", host.Name, r.Path)
+					removed++
+				}
+
+				if dryRun {
+					continue
+				}
+
+				if fixed > 0 || skipped > 0 || removed > 0 {
+					fmt.Printf("%s: %d fixed, %d require re-apply, %d unexpected file(s) removed\n", host.Name, fixed, skipped, removed)
+				} else {
+					fmt.Printf("%s: no drift to fix\n", host.Name)
+				}
+
+				// Update state
+				hostState.DriftDetected = len(stillDrifted) > 0 || len(remainingUnexpected) > 0
+				hostState.DriftFiles = append(stillDrifted, remainingUnexpected...)
+				hostState.LastDriftCheck = time.Now()
+				if err := stateMgr.WriteState(ctx, client, hostState); err != nil {
+					fmt.Printf("  warning: failed to save state - %v\n", err)
+				}
+
+				fmt.Println()
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&filesOnly, "files", nil, "Only fix specific files")
+	cmd.Flags().BoolVar(&removeUnexpected, "remove-unexpected", false, "Delete files found in managed directories that aren't on their allowlist")
+	cmd.Flags().BoolVar(&restoreContent, "restore-content", false, "Restore content-changed or missing files directly from the active closure instead of recommending a re-apply")
+	cmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Don't prompt for confirmation before removing unexpected files")
+
+	return cmd
+}
+
+func driftStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show drift status from cached state",
+		Long:  `Display last known drift status from host state without performing checks.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			stateMgr := state.NewManager()
+
+			fmt.Printf("%-20s %-10s %-15s %-10s %s\n", "HOST", "DRIFT", "LAST CHECK", "APPROVED", "FILES")
+			fmt.Printf("%-20s %-10s %-15s %-10s %s\n", "----", "-----", "----------", "--------", "-----")
+
+			for _, host := range hosts {
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("%-20s %-10s %-15s %-10s %s\n", host.Name, "error", "-", "-", err.Error())
+					continue
+				}
+
+				hostState, err := stateMgr.ReadState(ctx, client)
+				if err != nil {
+					fmt.Printf("%-20s %-10s %-15s %-10s %s\n", host.Name, "error", "-", "-", err.Error())
+					continue
+				}
+
+				driftStr := "no"
+				if hostState.DriftDetected {
+					driftStr = "YES"
+				}
+
+				lastCheck := "-"
+				if !hostState.LastDriftCheck.IsZero() {
+					lastCheck = hostState.LastDriftCheck.Format("Jan 02 15:04")
+				}
+
+				filesStr := "-"
+				if len(hostState.DriftFiles) > 0 {
+					filesStr = fmt.Sprintf("%d file(s)", len(hostState.DriftFiles))
+					if verbose {
+						filesStr = strings.Join(hostState.DriftFiles, ", ")
+					}
+				}
+
+				approvedStr := "-"
+				if len(hostState.Approvals) > 0 {
+					approvedStr = fmt.Sprintf("%d file(s)", len(hostState.Approvals))
+				}
+
+				fmt.Printf("%-20s %-10s %-15s %-10s %s\n", host.Name, driftStr, lastCheck, approvedStr, filesStr)
+			}
+
+			return nil
+		},
+	}
+}
+
+func driftReportCmd() *cobra.Command {
+	var (
+		output     string
+		window     string
+		server     string
+		apiToken   string
+		historyDir string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Report which hosts and files drift repeatedly, and how long drift sits before resolution",
+		Long: `Aggregate recorded drift checks over --window into: hosts ranked by drift
+frequency, files ranked by how often they drift across the fleet, mean time
+between drift detection and resolution, and currently-unresolved drift with
+its age. A host is flagged "chronic" when it drifted in 3 or more of its
+last 5 checks - usually a sign of an unmanaged script or cron job touching
+a managed file rather than a one-off change worth just fixing.
+
+With --server, this calls GET /api/drift/report on a running nixfleet
+server, which is the only place the scheduler's check history lives.
+Without --server, it computes the same metrics directly from
+--history-dir's drift-history.json, written there by 'nixfleet drift check
+--save-state' (for a server's own data dir, inspected offline, pass its
+--data-dir as --history-dir).`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid --output %q (want table or json)", output)
+			}
+
+			report, err := getDriftReport(cmd.Context(), server, apiToken, historyDir, window)
+			if err != nil {
+				return err
+			}
+
+			if output == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(report)
+			}
+
+			printDriftReport(os.Stdout, report)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&output, "output", "table", "Output format: table or json")
+	cmd.Flags().StringVar(&window, "window", "30d", "Reporting window, e.g. 30d or 720h")
+	cmd.Flags().StringVar(&server, "server", "", "nixfleet server URL (e.g. http://localhost:8080); unset computes locally from --history-dir")
+	cmd.Flags().StringVar(&apiToken, "api-token", defaultServerToken(), "API authentication token for --server")
+	cmd.Flags().StringVar(&historyDir, "history-dir", ".", "Directory to read drift-history.json from when --server is unset")
+
+	return cmd
+}
+
+// getDriftReport resolves a driftreport.Report either by calling a live
+// server (the only place the scheduler's recorded history lives) or, for
+// inspecting a history dir offline, by loading its drift-history.json and
+// the local inventory directly - the same "--server or local files"
+// duality getComplianceMetrics uses.
+func getDriftReport(ctx context.Context, server, apiToken, historyDir, window string) (*driftreport.Report, error) {
+	if server != "" {
+		var report driftreport.Report
+		url := strings.TrimSuffix(server, "/") + "/api/drift/report?window=" + window
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if apiToken != "" {
+			req.Header.Set("Authorization", "Bearer "+apiToken)
+		}
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, body)
+		}
+		if err := json.Unmarshal(body, &report); err != nil {
+			return nil, err
+		}
+		return &report, nil
+	}
+
+	win, err := driftreport.ParseWindow(window)
+	if err != nil {
+		return nil, err
+	}
+	_, hosts, err := loadInventoryAndHosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(hosts))
+	for i, h := range hosts {
+		names[i] = h.Name
+	}
+
+	store := driftreport.NewStore(historyDir)
+	report := driftreport.ComputeReport(store, names, time.Now(), win)
+	return &report, nil
+}
+
+// printDriftReport renders report as two ranked tables plus the fleet-wide
+// summary line, mirroring driftStatusCmd's plain fmt.Printf table style.
+func printDriftReport(w io.Writer, report *driftreport.Report) {
+	fmt.Fprintf(w, "Drift report (window: %s, generated %s)\n\n", report.Window, report.GeneratedAt.Format("2006-01-02 15:04"))
+
+	fmt.Fprintf(w, "%-20s %-10s %-10s %-10s %-10s %s\n", "HOST", "CHECKS", "DRIFTED", "FREQ %", "CHRONIC", "MTTR (h)")
+	fmt.Fprintf(w, "%-20s %-10s %-10s %-10s %-10s %s\n", "----", "------", "-------", "------", "-------", "--------")
+	for _, h := range report.Hosts {
+		chronic := ""
+		if h.Chronic {
+			chronic = "YES"
+		}
+		fmt.Fprintf(w, "%-20s %-10d %-10d %-10.1f %-10s %.1f\n",
+			h.Host, h.ChecksInWindow, h.DriftedChecksInWindow, h.DriftFrequencyPercent, chronic, h.MeanTimeToResolutionHours)
+	}
+
+	if len(report.Files) > 0 {
+		fmt.Fprintf(w, "\n%-40s %-10s %s\n", "FILE", "COUNT", "HOSTS")
+		fmt.Fprintf(w, "%-40s %-10s %s\n", "----", "-----", "-----")
+		for _, f := range report.Files {
+			fmt.Fprintf(w, "%-40s %-10d %s\n", f.Path, f.DriftCount, strings.Join(f.Hosts, ", "))
+		}
+	}
+
+	fmt.Fprintf(w, "\nUnresolved drift: %d\n", report.UnresolvedCount)
+	fmt.Fprintf(w, "Fleet mean time to resolution: %.1f hours\n", report.MeanTimeToResolutionHours)
+	if len(report.ChronicHosts) > 0 {
+		fmt.Fprintf(w, "Chronic hosts: %s\n", strings.Join(report.ChronicHosts, ", "))
+	}
+}
+
+func serverCmd() *cobra.Command {
+	var configPath string
+	var listenAddr string
+	var apiToken string
+	var metricsToken string
+	var webhookURL string
+	var webhookSecret string
+	var webhookEvents []string
+	var webhookDetail string
+	var driftInterval time.Duration
+	var updateInterval time.Duration
+	var healthInterval time.Duration
+	var probeInterval time.Duration
+	var dataDir string
+	var maxJobs int
+	var jobRetention time.Duration
+	var pkiDir string
+	var credentialsDir string
+	var provenanceDir string
+	var requireProvenance bool
+	var backupInterval time.Duration
+	var backupDir string
+	var backupRetention int
+	var backupRecipients []string
+	var k0sMetricsInterval time.Duration
+	var complianceCheckInterval time.Duration
+	var drainTimeout time.Duration
+	var hostTimeout time.Duration
+	var logLevel string
+	var logFormat string
+	var noReadinessCheck bool
+	var emailSMTPHost string
+	var emailSMTPPort int
+	var emailSTARTTLS bool
+	var emailImplicitTLS bool
+	var emailUsername string
+	var emailPassword string
+	var emailFrom string
+	var emailTo []string
+	var emailEvents []string
+	var slackWebhookURL string
+	var slackEvents []string
+	var matrixHomeserverURL string
+	var matrixAccessToken string
+	var matrixRoomID string
+	var matrixEvents []string
+	var siemURL string
+	var siemEvents []string
+	var siemSpoolFile string
+	var publicURL string
+
+	cmd := &cobra.Command{
+		Use:   "server",
+		Short: "Run NixFleet as an HTTP API server",
+		Long: `Start NixFleet in server mode with a REST API for fleet management.
+
+The server provides:
+  - REST API for host management, deployment, and drift detection
+  - Scheduled background tasks for drift, update, and health checks
+  - A lightweight connectivity prober tracking per-host uptime/flapping
+  - Webhook notifications for events (including host-up/host-down), with
+    diff-aware apply events (manifest/store path, package diff, changed
+    files, restarted units) and a --webhook-detail summary|full setting
+    for apply-all runs
+  - Email (SMTP) and Slack/Matrix notification channels alongside the
+    webhook, each with their own event list; failed deliveries on any
+    channel show up at GET /api/notifications/failed. Verify a channel's
+    config with 'nixfleet server notify-test --channel slack' without
+    waiting for real drift
+  - SIEM export: the same events as CEF (or JSON) over syslog
+    (udp/tcp/tls), via --siem syslog://host:514?proto=tcp&format=cef.
+    Undelivered events are spooled to --siem-spool-file and retried
+    rather than dropped. Verify with 'nixfleet siem test'
+  - Job queue for async operations
+  - Optional per-host SSH credentials (--credentials-dir) instead of one
+    agent key for the whole fleet; see 'nixfleet server rotate-key'
+
+API Endpoints:
+  GET  /metrics              - Prometheus metrics (host gauges, job counters, apply durations)
+  GET  /api/health           - Server health check
+  GET  /api/info             - Server information
+  GET  /api/hosts            - List all hosts
+  GET  /api/hosts/{name}     - Get host details
+  POST /api/hosts/{name}/apply    - Trigger deployment
+  POST /api/hosts/{name}/rollback - Rollback to previous generation
+  GET  /api/drift            - Drift status for all hosts
+  POST /api/drift/check      - Trigger drift check
+  POST /api/drift/fix        - Fix detected drift
+  GET  /api/plan             - Plan changes for all hosts
+  POST /api/apply            - Apply to all hosts (async)
+  GET  /api/jobs             - List running/completed jobs
+  GET  /api/jobs/{id}        - Get job status
+  GET  /api/jobs/{id}/logs   - Get a job's captured structured logs (format=json)
+  GET  /api/export           - CMDB export (format=csv|json, fields=...)
+  POST /api/admin/backup     - Snapshot the server's data dir as a tar.gz
+  POST /api/admin/reload-config - Hot-reload webhooks/schedules/api-token from --config
+  GET  /api/k8s/{controller}/summary - Latest k0s cluster-health snapshot
+  GET  /api/notifications/failed - Recent failed webhook/email/Slack/Matrix deliveries
+  POST /api/admin/drain      - Stop accepting new mutating requests and wait for in-flight jobs to finish
+
+Draining:
+  SIGTERM (and POST /api/admin/drain, for maintenance without exiting)
+  stops the server from accepting new mutating requests (503 with
+  Retry-After) and job runners from starting a new host mid-fleet-apply,
+  then waits up to --drain-timeout for whatever's already running to
+  finish before the HTTP listener and SSH pool are shut down. A job that
+  can't finish in time is checkpointed (completed hosts, in-progress host
+  and phase) and reported as interrupted rather than silently lost. If
+  this is run under systemd, set TimeoutStopSec a bit higher than
+  --drain-timeout so systemd doesn't SIGKILL the process out from under
+  its own drain wait.
+
+Configuration:
+  Everything below can also go in a --config server.yaml file (snake_case
+  keys, e.g. "listen_addr", "drift_check_interval: 1h"; see
+  'nixfleet server validate-config'). Flags always override the file. A
+  SIGHUP or POST /api/admin/reload-config re-reads that file and applies
+  its webhook, schedule, and api-token settings without a restart.
+
+Subcommands:
+  backup           - Snapshot the server's data dir to a tar.gz archive
+  restore          - Restore a data dir from a backup archive
+  validate-config  - Validate a --config file without starting a server`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			// Load inventory
+			inv, err := inventory.LoadFromDir(inventoryPath)
+			if err != nil {
+				inv, err = inventory.LoadFromFile(inventoryPath)
+				if err != nil {
+					return fmt.Errorf("loading inventory: %w", err)
+				}
+			}
+
+			report := inv.ValidateStrict(ctx, inventory.ValidateStrictOptions{CheckDNS: checkDNS})
+			for _, check := range report.Checks {
+				if check.Status == inventory.ValidationWarn {
+					fmt.Fprintf(os.Stderr, "warning: %s\n", check.Message)
+				}
+			}
+			if report.HasFailures() {
+				return fmt.Errorf("invalid inventory: %s", report.FailureSummary())
+			}
+
+			var config server.Config
+			if configPath != "" {
+				fc, err := server.LoadConfigFile(configPath)
+				if err != nil {
+					return fmt.Errorf("loading server config: %w", err)
+				}
+				config = fc.ToConfig()
+				config.ConfigPath = configPath
+			}
+
+			// Flags override the file, but only the ones the user actually
+			// passed - an unset flag shouldn't stomp a value the file set.
+			if config.FlakePath == "" || cmd.Flags().Changed("flake") {
+				config.FlakePath = flakePath
+			}
+			if cmd.Flags().Changed("listen") || config.ListenAddr == "" {
+				config.ListenAddr = listenAddr
+			}
+			if cmd.Flags().Changed("api-token") || config.APIToken == "" {
+				config.APIToken = apiToken
+			}
+			if cmd.Flags().Changed("metrics-token") || config.MetricsToken == "" {
+				config.MetricsToken = metricsToken
+			}
+			if cmd.Flags().Changed("webhook-url") || config.WebhookURL == "" {
+				config.WebhookURL = webhookURL
+			}
+			if cmd.Flags().Changed("webhook-secret") || config.WebhookSecret == "" {
+				config.WebhookSecret = webhookSecret
+			}
+			if cmd.Flags().Changed("webhook-events") || len(config.WebhookEvents) == 0 {
+				config.WebhookEvents = webhookEvents
+			}
+			if cmd.Flags().Changed("webhook-detail") || config.WebhookDetail == "" {
+				config.WebhookDetail = webhookDetail
+			}
+			if cmd.Flags().Changed("drift-interval") || config.DriftCheckInterval == 0 {
+				config.DriftCheckInterval = driftInterval
+			}
+			if cmd.Flags().Changed("update-interval") || config.UpdateCheckInterval == 0 {
+				config.UpdateCheckInterval = updateInterval
+			}
+			if cmd.Flags().Changed("health-interval") || config.HealthCheckInterval == 0 {
+				config.HealthCheckInterval = healthInterval
+			}
+			if cmd.Flags().Changed("probe-interval") || config.ProbeInterval == 0 {
+				config.ProbeInterval = probeInterval
+			}
+			if cmd.Flags().Changed("data-dir") || config.DataDir == "" {
+				config.DataDir = dataDir
+			}
+			if cmd.Flags().Changed("max-jobs") || config.MaxJobs == 0 {
+				config.MaxJobs = maxJobs
+			}
+			if cmd.Flags().Changed("job-retention") || config.JobRetention == 0 {
+				config.JobRetention = jobRetention
+			}
+			if cmd.Flags().Changed("pki-dir") || config.PKIDir == "" {
+				config.PKIDir = pkiDir
+			}
+			if cmd.Flags().Changed("credentials-dir") || config.CredentialsDir == "" {
+				config.CredentialsDir = credentialsDir
+			}
+			if cmd.Flags().Changed("provenance-dir") || config.ProvenanceDir == "" {
+				config.ProvenanceDir = provenanceDir
+			}
+			if cmd.Flags().Changed("require-provenance") {
+				config.RequireProvenance = requireProvenance
+			}
+			if cmd.Flags().Changed("offline") {
+				config.Offline = offline
+			}
+			if cmd.Flags().Changed("no-eval-cache") {
+				config.NoEvalCache = noEvalCache
+			}
+			if cmd.Flags().Changed("backup-interval") || config.BackupInterval == 0 {
+				config.BackupInterval = backupInterval
+			}
+			if cmd.Flags().Changed("backup-dir") || config.BackupDir == "" {
+				config.BackupDir = backupDir
+			}
+			if cmd.Flags().Changed("backup-retention") || config.BackupRetention == 0 {
+				config.BackupRetention = backupRetention
+			}
+			if cmd.Flags().Changed("backup-recipients") || len(config.BackupRecipients) == 0 {
+				config.BackupRecipients = backupRecipients
+			}
+			if cmd.Flags().Changed("k0s-metrics-interval") || config.K0sMetricsInterval == 0 {
+				config.K0sMetricsInterval = k0sMetricsInterval
+			}
+			if cmd.Flags().Changed("compliance-check-interval") || config.ComplianceCheckInterval == 0 {
+				config.ComplianceCheckInterval = complianceCheckInterval
+			}
+			if cmd.Flags().Changed("drain-timeout") || config.DrainTimeout == 0 {
+				config.DrainTimeout = drainTimeout
+			}
+			if cmd.Flags().Changed("host-timeout") || config.HostOperationTimeout == 0 {
+				config.HostOperationTimeout = hostTimeout
+			}
+			if cmd.Flags().Changed("log-level") || config.LogLevel == "" {
+				config.LogLevel = logLevel
+			}
+			if cmd.Flags().Changed("log-format") || config.LogFormat == "" {
+				config.LogFormat = logFormat
+			}
+			if cmd.Flags().Changed("no-readiness-check") {
+				config.SkipReadinessCheck = noReadinessCheck
+			}
+			if cmd.Flags().Changed("email-smtp-host") || config.EmailSMTPHost == "" {
+				config.EmailSMTPHost = emailSMTPHost
+			}
+			if cmd.Flags().Changed("email-smtp-port") || config.EmailSMTPPort == 0 {
+				config.EmailSMTPPort = emailSMTPPort
+			}
+			if cmd.Flags().Changed("email-starttls") {
+				config.EmailSTARTTLS = emailSTARTTLS
+			}
+			if cmd.Flags().Changed("email-implicit-tls") {
+				config.EmailImplicitTLS = emailImplicitTLS
+			}
+			if cmd.Flags().Changed("email-username") || config.EmailUsername == "" {
+				config.EmailUsername = emailUsername
+			}
+			if cmd.Flags().Changed("email-password") || config.EmailPassword == "" {
+				config.EmailPassword = emailPassword
+			}
+			if cmd.Flags().Changed("email-from") || config.EmailFrom == "" {
+				config.EmailFrom = emailFrom
+			}
+			if cmd.Flags().Changed("email-to") || len(config.EmailTo) == 0 {
+				config.EmailTo = emailTo
+			}
+			if cmd.Flags().Changed("email-events") || len(config.EmailEvents) == 0 {
+				config.EmailEvents = emailEvents
+			}
+			if cmd.Flags().Changed("slack-webhook-url") || config.SlackWebhookURL == "" {
+				config.SlackWebhookURL = slackWebhookURL
+			}
+			if cmd.Flags().Changed("slack-events") || len(config.SlackEvents) == 0 {
+				config.SlackEvents = slackEvents
+			}
+			if cmd.Flags().Changed("matrix-homeserver-url") || config.MatrixHomeserverURL == "" {
+				config.MatrixHomeserverURL = matrixHomeserverURL
+			}
+			if cmd.Flags().Changed("matrix-access-token") || config.MatrixAccessToken == "" {
+				config.MatrixAccessToken = matrixAccessToken
+			}
+			if cmd.Flags().Changed("matrix-room-id") || config.MatrixRoomID == "" {
+				config.MatrixRoomID = matrixRoomID
+			}
+			if cmd.Flags().Changed("matrix-events") || len(config.MatrixEvents) == 0 {
+				config.MatrixEvents = matrixEvents
+			}
+			if cmd.Flags().Changed("siem") || config.SIEMURL == "" {
+				config.SIEMURL = siemURL
+			}
+			if cmd.Flags().Changed("siem-events") || len(config.SIEMEvents) == 0 {
+				config.SIEMEvents = siemEvents
+			}
+			if cmd.Flags().Changed("siem-spool-file") || config.SIEMSpoolFile == "" {
+				config.SIEMSpoolFile = siemSpoolFile
+			}
+			if cmd.Flags().Changed("public-url") || config.PublicURL == "" {
+				config.PublicURL = publicURL
+			}
+			config.Inventory = inv
+
+			srv, err := server.New(config)
+			if err != nil {
+				return fmt.Errorf("creating server: %w", err)
+			}
+			defer srv.Close()
+
+			return srv.Start(ctx)
+		},
+	}
+
+	cmd.Flags().StringVar(&listenAddr, "listen", ":8080", "Address to listen on")
+	cmd.Flags().StringVar(&apiToken, "api-token", defaultServerToken(), "API authentication token (optional)")
+	cmd.Flags().StringVar(&metricsToken, "metrics-token", "", "Bearer token required on GET /metrics; unset leaves it unauthenticated (most scrape configs can't send one anyway)")
+	cmd.Flags().StringVar(&webhookURL, "webhook-url", "", "Webhook URL for notifications")
+	cmd.Flags().StringVar(&webhookSecret, "webhook-secret", "", "Webhook secret for signing")
+	cmd.Flags().StringSliceVar(&webhookEvents, "webhook-events", []string{"drift", "apply", "health"}, "Events to send webhooks for")
+	cmd.Flags().StringVar(&webhookDetail, "webhook-detail", "summary", "Detail level for apply-all webhooks: summary or full (also sends a per-host apply event)")
+	cmd.Flags().DurationVar(&driftInterval, "drift-interval", 0, "Interval for drift checks (e.g., 1h)")
+	cmd.Flags().DurationVar(&updateInterval, "update-interval", 0, "Interval for update checks (e.g., 6h)")
+	cmd.Flags().DurationVar(&healthInterval, "health-interval", 0, "Interval for health checks (e.g., 5m)")
+	cmd.Flags().DurationVar(&probeInterval, "probe-interval", 60*time.Second, "Interval for the background connectivity prober (0 disables it)")
+	cmd.Flags().StringVar(&dataDir, "data-dir", ".", "Directory for server-local state (prober availability history)")
+	cmd.Flags().IntVar(&maxJobs, "max-jobs", 500, "Maximum number of jobs (including completed ones) kept in memory and in <data-dir>/jobs.json; the background pruner removes the oldest completed ones beyond this")
+	cmd.Flags().DurationVar(&jobRetention, "job-retention", 24*time.Hour, "How long a completed job is kept before the background pruner removes it (e.g., 24h)")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files (used by the CMDB export's cert_days_left column)")
+	cmd.Flags().StringVar(&credentialsDir, "credentials-dir", "", "Directory of per-host (or @group) SSH private keys; unset uses the SSH agent for every host")
+	cmd.Flags().StringVar(&provenanceDir, "provenance-dir", defaultProvenanceDir(), "Directory containing provenance records and the signing key")
+	cmd.Flags().BoolVar(&requireProvenance, "require-provenance", false, "Refuse to deploy closures lacking a valid, matching provenance record")
+	cmd.Flags().DurationVar(&backupInterval, "backup-interval", 0, "Interval for scheduled data-dir backups (e.g., 24h); 0 disables scheduled backups")
+	cmd.Flags().StringVar(&backupDir, "backup-dir", "", "Directory for scheduled backups (defaults to --data-dir)")
+	cmd.Flags().IntVar(&backupRetention, "backup-retention", 7, "Number of scheduled backups to keep; 0 keeps them all")
+	cmd.Flags().StringSliceVar(&backupRecipients, "backup-recipients", nil, "Age public keys to encrypt scheduled backups for (typically the fleet's admin keys); unset leaves backups unencrypted")
+	cmd.Flags().DurationVar(&k0sMetricsInterval, "k0s-metrics-interval", time.Minute, "How often to check whether any k0s-controller host is due for a metrics collection (each host's own k0s_monitor.interval still governs its actual cadence); 0 disables k0s metrics collection")
+	cmd.Flags().DurationVar(&complianceCheckInterval, "compliance-check-interval", 0, "How often to record each ubuntu host's outstanding security/regular updates for GET /api/compliance; 0 disables compliance tracking")
+	cmd.Flags().DurationVar(&drainTimeout, "drain-timeout", 2*time.Minute, "How long SIGTERM or POST /api/admin/drain waits for in-flight jobs to finish their current host before giving up (set the systemd unit's TimeoutStopSec a bit higher than this)")
+	cmd.Flags().DurationVar(&hostTimeout, "host-timeout", 5*time.Minute, "How long a drift check or apply-all job spends on any single host before moving on, so one wedged host can't stall the rest of the fleet")
+	cmd.Flags().StringVar(&logLevel, "log-level", "info", "Log level (debug, info, warn, error)")
+	cmd.Flags().StringVar(&logFormat, "log-format", "text", "Log output format (text, json)")
+	cmd.Flags().StringVar(&configPath, "config", "", "Path to a server config file (see 'nixfleet server validate-config'); flags override its values")
+	cmd.Flags().BoolVar(&noReadinessCheck, "no-readiness-check", false, "Skip the target-readiness probe (nix daemon ping, /nix free space, profile writability) before copying to each host")
+	cmd.Flags().StringVar(&emailSMTPHost, "email-smtp-host", "", "SMTP host for the email notification channel")
+	cmd.Flags().IntVar(&emailSMTPPort, "email-smtp-port", 587, "SMTP port for the email notification channel")
+	cmd.Flags().BoolVar(&emailSTARTTLS, "email-starttls", true, "Use STARTTLS when connecting to the SMTP host")
+	cmd.Flags().BoolVar(&emailImplicitTLS, "email-implicit-tls", false, "Connect to the SMTP host over implicit TLS (e.g. port 465) instead of STARTTLS")
+	cmd.Flags().StringVar(&emailUsername, "email-username", "", "SMTP auth username (leave unset for an open relay)")
+	cmd.Flags().StringVar(&emailPassword, "email-password", "", "SMTP auth password")
+	cmd.Flags().StringVar(&emailFrom, "email-from", "", "From address for email notifications")
+	cmd.Flags().StringSliceVar(&emailTo, "email-to", nil, "Recipient addresses for email notifications")
+	cmd.Flags().StringSliceVar(&emailEvents, "email-events", nil, "Events to send email notifications for")
+	cmd.Flags().StringVar(&slackWebhookURL, "slack-webhook-url", "", "Incoming webhook URL for the Slack (or Mattermost/Rocket.Chat compatible) notification channel")
+	cmd.Flags().StringSliceVar(&slackEvents, "slack-events", nil, "Events to send Slack notifications for")
+	cmd.Flags().StringVar(&matrixHomeserverURL, "matrix-homeserver-url", "", "Matrix homeserver base URL for the Matrix notification channel")
+	cmd.Flags().StringVar(&matrixAccessToken, "matrix-access-token", "", "Matrix access token")
+	cmd.Flags().StringVar(&matrixRoomID, "matrix-room-id", "", "Matrix room ID to post notifications to")
+	cmd.Flags().StringSliceVar(&matrixEvents, "matrix-events", nil, "Events to send Matrix notifications for")
+	cmd.Flags().StringVar(&siemURL, "siem", "", "SIEM export target, e.g. syslog://host:514?proto=tcp&format=cef (see 'nixfleet siem test')")
+	cmd.Flags().StringSliceVar(&siemEvents, "siem-events", nil, "Events to export to the SIEM")
+	cmd.Flags().StringVar(&siemSpoolFile, "siem-spool-file", "", "Path to spool undelivered SIEM events to while the collector is unreachable")
+	cmd.Flags().StringVar(&publicURL, "public-url", "", "Public URL of this server's dashboard, included in notification messages")
+
+	cmd.AddCommand(serverBackupCmd())
+	cmd.AddCommand(serverRestoreCmd())
+	cmd.AddCommand(serverValidateConfigCmd())
+	cmd.AddCommand(serverNotifyTestCmd())
+	cmd.AddCommand(serverRotateKeyCmd())
+
+	return cmd
+}
+
+func serverBackupCmd() *cobra.Command {
+	var dataDir string
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Snapshot the server's data dir to a tar.gz archive",
+		Long: `Snapshot the server's persisted local state - host overrides, job
+history, and prober availability - into a single tar.gz archive with a
+manifest recording each file's schema version, for 'server restore' later.
+
+Point --data-dir at the same directory the running server uses. Prefer
+POST /api/admin/backup for a server that's currently running: it reads each
+store's in-memory state under lock, so it can't race that server's own
+writes the way this CLI command (which loads the files fresh) can.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("creating %s: %w", output, err)
+			}
+			defer f.Close()
+
+			manifest, err := server.BackupDataDir(dataDir, f)
+			if err != nil {
+				return fmt.Errorf("backing up: %w", err)
+			}
+
+			fmt.Printf("Backed up %d file(s) to %s (schema v%d)\n", len(manifest.Files), output, manifest.Version)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dataDir, "data-dir", ".", "Server data dir to back up")
+	cmd.Flags().StringVarP(&output, "output", "o", "server-backup.tar.gz", "Path to write the backup archive")
+
+	return cmd
+}
+
+func serverRestoreCmd() *cobra.Command {
+	var input string
+	var dataDir string
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore the server's data dir from a backup archive",
+		Long: `Restore a tar.gz archive produced by 'server backup' (or downloaded
+from POST /api/admin/backup), replacing --data-dir atomically: the archive
+is extracted into a fresh directory alongside it, any existing data dir is
+moved aside as "<data-dir>.pre-restore", and the fresh directory is renamed
+into place.
+
+Refuses to restore a backup whose schema is newer than this nixfleet
+understands unless --force is passed, since restoring it anyway could
+silently drop fields a newer nixfleet would have kept.
+
+Stop the server before restoring - it doesn't reload its stores from disk
+while running.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(input)
+			if err != nil {
+				return fmt.Errorf("opening %s: %w", input, err)
+			}
+			defer f.Close()
+
+			manifest, err := server.RestoreDataDir(f, dataDir, force)
+			if err != nil {
+				return fmt.Errorf("restoring: %w", err)
+			}
+
+			fmt.Printf("Restored %d file(s) into %s (backup schema v%d)\n", len(manifest.Files), dataDir, manifest.Version)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&input, "input", "", "Path to the backup archive to restore")
+	cmd.Flags().StringVar(&dataDir, "data-dir", ".", "Server data dir to restore into")
+	cmd.Flags().BoolVar(&force, "force", false, "Restore even if the backup's schema is newer than this nixfleet understands")
+	cmd.MarkFlagRequired("input")
+
+	return cmd
+}
+
+func serverRotateKeyCmd() *cobra.Command {
+	var credentialsDir string
+	var dataDir string
+
+	cmd := &cobra.Command{
+		Use:   "rotate-key",
+		Short: "Rotate a host's per-host SSH credential",
+		Long: `Generate a new SSH keypair for a host, install the public half via
+whatever credential currently works (the existing per-host key in
+--credentials-dir, or the SSH agent if the host doesn't have one yet),
+verify a login with the new key, and only then remove the old key from the
+host's authorized_keys and write the new private key into --credentials-dir.
+
+The old credential is never touched until the new one is proven to work, so
+a failed rotation leaves the host reachable exactly as it was before. Every
+step is recorded to <data-dir>/credential-rotations.jsonl.
+
+Run the server with --credentials-dir pointed at the same directory so it
+picks up rotated keys on its next connection to the host.
+
+Example:
+  nixfleet server rotate-key -H web1 --credentials-dir /etc/nixfleet/creds`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if credentialsDir == "" {
+				return fmt.Errorf("--credentials-dir is required")
+			}
+
+			_, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+			if len(hosts) != 1 {
+				return fmt.Errorf("rotate-key operates on one host at a time, use -H to select it (got %d)", len(hosts))
+			}
+			host := hosts[0]
+
+			pool := ssh.NewPool(nil)
+			defer pool.Close()
+
+			audit := server.NewCredentialAuditLogger(server.CredentialAuditLogPath(dataDir))
+
+			if err := server.RotateHostKey(ctx, pool, credentialsDir, host, audit); err != nil {
+				return fmt.Errorf("rotating key for %s: %w", host.Name, err)
+			}
+
+			fmt.Printf("Rotated SSH credential for %s (%s)\n", host.Name, host.Addr)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&credentialsDir, "credentials-dir", "", "Directory of per-host SSH private keys (same path passed to 'nixfleet server --credentials-dir')")
+	cmd.Flags().StringVar(&dataDir, "data-dir", ".", "Server data dir to append the rotation audit log to")
+
+	return cmd
+}
+
+func serverValidateConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate-config <path>",
+		Short: "Validate a server --config file without starting a server",
+		Long: `Loads and strictly validates a server config file the same way
+'nixfleet server --config' would: unknown keys and unparseable durations
+are reported with the offending line number. Exits nonzero on any error,
+so it can gate CI.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := server.LoadConfigFile(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("%s: OK\n", args[0])
+			return nil
+		},
+	}
+	return cmd
+}
+
+func serverNotifyTestCmd() *cobra.Command {
+	var configPath string
+	var channel string
+
+	cmd := &cobra.Command{
+		Use:   "notify-test",
+		Short: "Send a test message on a notification channel",
+		Long: `Loads a server --config file and sends a synthetic test notification
+through --channel (email, slack, or matrix), bypassing the delivery queue
+so misconfiguration fails loud immediately instead of showing up later as
+a failed count in GET /api/notifications/failed.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if configPath == "" {
+				return fmt.Errorf("--config is required")
+			}
+			if channel == "" {
+				return fmt.Errorf("--channel is required (email, slack, or matrix)")
+			}
+			fc, err := server.LoadConfigFile(configPath)
+			if err != nil {
+				return err
+			}
+			if err := server.SendTestNotification(fc.ToConfig(), channel); err != nil {
+				return fmt.Errorf("sending test %s notification: %w", channel, err)
+			}
+			fmt.Printf("test %s notification sent\n", channel)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&configPath, "config", "", "Path to a server config file (required)")
+	cmd.Flags().StringVar(&channel, "channel", "", "Notification channel to test: email, slack, or matrix (required)")
+	return cmd
+}
+
+func siemCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "siem",
+		Short: "Manage the SIEM (syslog/CEF) event export",
+		Long: `SIEM export sends the same change events (apply, rollback, drift,
+drift-fix, secret-deploy, ...) that 'nixfleet server' already sends to its
+webhook/email/Slack/Matrix channels to a security team's syslog collector,
+formatted as CEF or JSON - see 'nixfleet server --help' for the --siem flag.`,
+	}
+	cmd.AddCommand(siemTestCmd())
+	return cmd
+}
+
+func siemTestCmd() *cobra.Command {
+	var configPath string
+	var target string
+
+	cmd := &cobra.Command{
+		Use:   "test",
+		Short: "Send a test event to a SIEM collector",
+		Long: `Sends a synthetic "test" event to --siem (or the siem_url in a
+--config file), bypassing the delivery queue and spool entirely, so a bad
+collector address or unsupported format fails loud immediately instead of
+spooling forever.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if target == "" && configPath != "" {
+				fc, err := server.LoadConfigFile(configPath)
+				if err != nil {
+					return err
+				}
+				target = fc.ToConfig().SIEMURL
+			}
+			if target == "" {
+				return fmt.Errorf("--siem is required (or --config with siem_url set)")
+			}
+			if err := server.SendTestSIEM(target); err != nil {
+				return fmt.Errorf("sending test SIEM event: %w", err)
+			}
+			fmt.Printf("test SIEM event sent to %s\n", target)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&configPath, "config", "", "Path to a server config file to read siem_url from")
+	cmd.Flags().StringVar(&target, "siem", "", "SIEM target, e.g. syslog://host:514?proto=tcp&format=cef (overrides --config)")
+	return cmd
+}
+
+func pullModeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pull-mode",
+		Short: "Configure pull-based deployment mode",
+		Long: `Pull mode allows hosts to fetch and apply their own configuration
+from a Git repository, rather than having a central server push changes.
+
+This is ideal for:
+  - Air-gapped environments
+  - Hosts behind NAT/firewalls
+  - GitOps workflows
+  - Self-managing infrastructure
+
+The host will periodically:
+  1. Pull from the configured Git repository
+  2. Build its configuration locally
+  3. Apply changes automatically
+  4. Report status via webhooks (optional)
+
+If a host has 'pull_build_leader: true' in the inventory, every other
+pull-mode host substitutes pre-built closures from it over ssh-ng instead
+of rebuilding from source, falling back to a local build on a cache miss.`,
+	}
+
+	cmd.AddCommand(pullModeInstallCmd())
+	cmd.AddCommand(pullModeUninstallCmd())
+	cmd.AddCommand(pullModeStatusCmd())
+	cmd.AddCommand(pullModeTriggerCmd())
+
+	return cmd
+}
+
+func pullModeInstallCmd() *cobra.Command {
+	var repoURL string
+	var branch string
+	var interval string
+	var sshKeyPath string
+	var ageKeyPath string
+	var applyOnBoot bool
+	var webhookURL string
+	var webhookSecret string
+	var rollbackWindow string
+
+	// Home-manager options
+	var hmUser string
+	var hmDotfilesPath string
+	var hmBranch string
+	var hmSSHKey string
+	var hmConfigName string
+
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Install pull mode on hosts",
+		Long: `Install and configure pull mode on target hosts.
+
+This will:
+  1. Set up SSH config for Git repository access
+  2. Clone the configuration repository
+  3. Install the nixfleet-pull script
+  4. Create and enable systemd timer for periodic pulls
+  5. Optionally sync home-manager dotfiles (use --hm-* flags)
+
+Example:
+  nixfleet pull-mode install -H gtr --repo git@github.com:org/fleet-config.git
+
+With home-manager:
+  nixfleet pull-mode install -H gtr --repo git@github.com:org/fleet-config.git \
+    --hm-user ztaylor --hm-dotfiles-path /home/ztaylor/dotfiles/nix \
+    --hm-branch main --hm-config-name "ztaylor@x86_64-linux"`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if repoURL == "" {
+				return fmt.Errorf("--repo is required")
+			}
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			if len(hosts) == 0 {
+				return fmt.Errorf("no hosts selected")
+			}
+
+			defaults := pullmode.DefaultConfig()
+			config := pullmode.Config{
+				RepoURL:        repoURL,
+				Branch:         branch,
+				SSHKeyPath:     sshKeyPath,
+				AgeKeyPath:     ageKeyPath,
+				Interval:       interval,
+				ApplyOnBoot:    applyOnBoot,
+				RepoPath:       defaults.RepoPath,
+				WebhookURL:     webhookURL,
+				WebhookSecret:  webhookSecret,
+				RollbackWindow: rollbackWindow,
+			}
+
+			if leader, ok := inv.BuildLeader(); ok {
+				config.LeaderAddr = leader.Addr
+				config.LeaderSSHUser = leader.SSHUser
+			}
+
+			if config.Branch == "" {
+				config.Branch = defaults.Branch
+			}
+			if config.SSHKeyPath == "" {
+				config.SSHKeyPath = defaults.SSHKeyPath
+			}
+			if config.AgeKeyPath == "" {
+				config.AgeKeyPath = defaults.AgeKeyPath
+			}
+			if config.Interval == "" {
+				config.Interval = defaults.Interval
+			}
+			if config.RollbackWindow == "" {
+				config.RollbackWindow = defaults.RollbackWindow
+			}
+
+			// Configure home-manager if user is specified
+			if hmUser != "" {
+				config.HomeManager = &pullmode.HomeManagerConfig{
+					User:         hmUser,
+					DotfilesPath: hmDotfilesPath,
+					Branch:       hmBranch,
+					SSHKeyPath:   hmSSHKey,
+					ConfigName:   hmConfigName,
+				}
+				// Set defaults for home-manager
+				if config.HomeManager.Branch == "" {
+					config.HomeManager.Branch = "main"
+				}
+				if config.HomeManager.DotfilesPath == "" {
+					config.HomeManager.DotfilesPath = "/home/" + hmUser + "/dotfiles/nix"
+				}
+				if config.HomeManager.ConfigName == "" {
+					config.HomeManager.ConfigName = hmUser + "@x86_64-linux"
+				}
+			}
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			installer := pullmode.NewInstaller()
+
+			fmt.Printf("Installing pull mode on %d host(s)...\n\n", len(hosts))
+
+			var failed int
+			for _, host := range hosts {
+				fmt.Printf("%s: ", host.Name)
+
+				if dryRun {
+					fmt.Println("would install pull mode")
+					continue
+				}
+
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("connection failed - %v\n", err)
+					failed++
+					continue
+				}
+
+				// Set host name for this installation
+				hostConfig := config
+				hostConfig.HostName = host.Name
+				hostConfig.BuildLeader = host.PullBuildLeader
+				hostConfig.BandwidthLimitKB = host.PullBandwidthLimitKB
+				hostConfig.TransferWindow = host.PullTransferWindow
+				hostConfig.TransferThresholdMB = host.PullTransferThresholdMB
+				if hostConfig.TransferWindow != "" && hostConfig.TransferThresholdMB == 0 {
+					hostConfig.TransferThresholdMB = defaults.TransferThresholdMB
+				}
+
+				if err := pullmode.ParseTransferWindow(hostConfig.TransferWindow); err != nil {
+					fmt.Printf("invalid pull_transfer_window - %v\n", err)
+					failed++
+					continue
+				}
+
+				if err := installer.Install(ctx, client, hostConfig); err != nil {
+					fmt.Printf("failed - %v\n", err)
+					failed++
+					continue
+				}
+
+				fmt.Println("OK")
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d host(s) failed", failed)
+			}
+
+			fmt.Printf("\nPull mode installed successfully. Hosts will pull every %s.\n", interval)
+			if hmUser != "" {
+				fmt.Printf("Home-manager sync enabled for user '%s' (dotfiles: %s)\n", hmUser, config.HomeManager.DotfilesPath)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&repoURL, "repo", "", "Git repository URL (SSH format, e.g., git@github.com:org/repo.git)")
+	cmd.Flags().StringVar(&branch, "branch", "main", "Branch to track")
+	cmd.Flags().StringVar(&interval, "interval", "15min", "Pull interval (systemd timer format)")
+	cmd.Flags().StringVar(&sshKeyPath, "ssh-key", "/run/nixfleet-secrets/github-deploy-key", "Path to SSH key for Git access")
+	cmd.Flags().StringVar(&ageKeyPath, "age-key", "/root/.config/age/key.txt", "Path to age key for secrets")
+	cmd.Flags().BoolVar(&applyOnBoot, "apply-on-boot", true, "Apply configuration on boot")
+	cmd.Flags().StringVar(&webhookURL, "webhook-url", "", "Webhook URL for status notifications")
+	cmd.Flags().StringVar(&webhookSecret, "webhook-secret", "", "Webhook secret for signing")
+	cmd.Flags().StringVar(&rollbackWindow, "rollback-window", "5min", "How long a new generation has to confirm itself healthy before automatic rollback (systemd timer format)")
+
+	// Home-manager flags
+	cmd.Flags().StringVar(&hmUser, "hm-user", "", "Username to run home-manager as (enables home-manager sync)")
+	cmd.Flags().StringVar(&hmDotfilesPath, "hm-dotfiles-path", "", "Path to dotfiles repository (default: /home/<user>/dotfiles/nix)")
+	cmd.Flags().StringVar(&hmBranch, "hm-branch", "main", "Branch to track for dotfiles")
+	cmd.Flags().StringVar(&hmSSHKey, "hm-ssh-key", "", "Path to SSH key for dotfiles repo access")
+	cmd.Flags().StringVar(&hmConfigName, "hm-config-name", "", "Home-manager flake config name (default: <user>@x86_64-linux)")
+
+	cmd.MarkFlagRequired("repo")
+
+	return cmd
+}
+
+func pullModeUninstallCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "uninstall",
+		Short: "Remove pull mode from hosts",
+		Long:  `Stop and remove pull mode configuration from target hosts.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			if len(hosts) == 0 {
+				return fmt.Errorf("no hosts selected")
+			}
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			installer := pullmode.NewInstaller()
+
+			fmt.Printf("Uninstalling pull mode from %d host(s)...\n\n", len(hosts))
+
+			var failed int
+			for _, host := range hosts {
+				fmt.Printf("%s: ", host.Name)
+
+				if dryRun {
+					fmt.Println("would uninstall pull mode")
+					continue
+				}
+
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("connection failed - %v\n", err)
+					failed++
+					continue
+				}
+
+				if err := installer.Uninstall(ctx, client); err != nil {
+					fmt.Printf("failed - %v\n", err)
+					failed++
+					continue
+				}
+
+				fmt.Println("OK")
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d host(s) failed", failed)
+			}
+
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func pullModeStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show pull mode status on hosts",
+		Long:  `Display pull mode status including last run, next scheduled run, and current commit.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			if len(hosts) == 0 {
+				return fmt.Errorf("no hosts selected")
+			}
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			installer := pullmode.NewInstaller()
+
+			fmt.Printf("Pull mode status for %d host(s):\n\n", len(hosts))
+
+			for _, host := range hosts {
+				fmt.Printf("%s:\n", host.Name)
+
+				if host.PullBuildLeader {
+					fmt.Println("  Role: build leader")
+				} else {
+					fmt.Println("  Role: follower")
+				}
+
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("  Connection failed: %v\n\n", err)
+					continue
+				}
+
+				status, err := installer.Status(ctx, client)
+				if err != nil {
+					fmt.Printf("  Status check failed: %v\n\n", err)
+					continue
+				}
+
+				if !status.Installed {
+					fmt.Println("  Pull mode: not installed")
+				} else {
+					fmt.Println("  Pull mode: installed")
+					if status.TimerActive {
+						fmt.Println("  Timer: active")
+					} else {
+						fmt.Println("  Timer: inactive")
+					}
+					fmt.Printf("  Last run: %s", status.LastRun)
+					fmt.Printf("  Last result: %s", status.LastResult)
+					fmt.Printf("  Next run: %s", status.NextRun)
+					fmt.Printf("  Current commit: %s", status.CurrentCommit)
+					if status.LastBuildSource != "" && status.LastBuildSource != "unknown" {
+						fmt.Printf("  Last build: %s\n", status.LastBuildSource)
+					}
+					if len(status.FailedSecrets) > 0 {
+						fmt.Printf("  SECRET PREFLIGHT FAILED (%s): cannot decrypt %s\n",
+							status.FailedSecretsAt, strings.Join(status.FailedSecrets, ", "))
+					}
+					if status.RollbackOccurred {
+						fmt.Printf("  ROLLED BACK (%s): generation %s failed to confirm healthy, reverted to %s - %s\n",
+							status.RollbackAt, status.RollbackFrom, status.RollbackTo, status.RollbackReason)
+					}
+					if status.TransferDeferred {
+						fmt.Printf("  deferred until window %s (pending ~%.0fMiB) since %s\n",
+							status.TransferWindow, status.DeferredPendingMB, status.DeferredAt)
+					}
+				}
+				fmt.Println()
+			}
+
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func pullModeTriggerCmd() *cobra.Command {
+	var ignoreWindow bool
+
+	cmd := &cobra.Command{
+		Use:   "trigger",
+		Short: "Manually trigger a pull operation",
+		Long: `Immediately trigger a pull and apply operation on target hosts.
+
+Use --ignore-window to bypass a host's pull_transfer_window gate for an
+emergency apply, even if its pending download is over the size threshold
+and outside the configured window.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			if len(hosts) == 0 {
+				return fmt.Errorf("no hosts selected")
+			}
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			installer := pullmode.NewInstaller()
+
+			fmt.Printf("Triggering pull on %d host(s)...\n\n", len(hosts))
+
+			var failed int
+			for _, host := range hosts {
+				fmt.Printf("%s: ", host.Name)
+
+				if dryRun {
+					fmt.Println("would trigger pull")
+					continue
+				}
+
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("connection failed - %v\n", err)
+					failed++
+					continue
+				}
+
+				if err := installer.TriggerPull(ctx, client, ignoreWindow); err != nil {
+					fmt.Printf("failed - %v\n", err)
+					failed++
+					continue
+				}
+
+				fmt.Println("triggered")
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d host(s) failed", failed)
+			}
+
+			fmt.Println("\nPull operations triggered. Use 'nixfleet pull-mode status' to check progress.")
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&ignoreWindow, "ignore-window", false, "Bypass a host's transfer window gate for an emergency apply")
+
+	return cmd
+}
+
+func hostCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "host",
+		Short: "Host management commands",
+		Long: `Commands for managing hosts in the fleet.
+
+Subcommands:
+  show         - Show a host's inventory, roles, and effective connection parameters
+  onboard      - Onboard a new host (get age key, setup secrets, install pull mode)
+  annotate     - Attach or remove short operator notes on a host
+  rotate-key   - Rotate a host's age key after a reimage
+  diff         - Compare two hosts' inventory, deployed state, and certs
+  audit        - Find (and optionally prune) hosts that have gone quiet for a long time
+  cleanup-generations - Remove obsolete generations left by failed or rolled-back deploys
+  validate     - Check the inventory for duplicate/dangling definitions and (optionally) DNS
+  migrate      - Record and reconcile a host that has changed base (e.g. ubuntu -> nixos)`,
+	}
+
+	cmd.AddCommand(hostShowCmd())
+	cmd.AddCommand(hostOnboardCmd())
+	cmd.AddCommand(hostAnnotateCmd())
+	cmd.AddCommand(hostRotateKeyCmd())
+	cmd.AddCommand(hostDiffCmd())
+	cmd.AddCommand(hostAuditCmd())
+	cmd.AddCommand(hostCleanupGenerationsCmd())
+	cmd.AddCommand(hostValidateCmd())
+	cmd.AddCommand(hostMigrateCmd())
+
+	return cmd
+}
+
+func hostMigrateCmd() *cobra.Command {
+	var toBase string
+	var method string
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Record a host that has changed base (e.g. ubuntu -> nixos)",
+		Long: `Every other command trusts the inventory's base field for a host
+(ubuntu/nixos/darwin) to pick the right activation command, profile path,
+and rollback procedure. A host reimaged onto a different base out-of-band -
+by hand, or via a tool like nixos-anywhere - silently breaks that
+assumption, and 'nixfleet apply' can run the wrong activation path against
+it.
+
+This command makes the change explicit:
+  1. With --method manual, connects to the host and confirms it's actually
+     running --to before touching anything (refuses otherwise)
+  2. Archives the host's base-specific state (managed files, update
+     tracking, OS info) under its migration history
+  3. Re-gathers OS info for the new base
+  4. Updates the host's base in its inventory file in place
+
+Use --dry-run to see what would happen without changing anything.
+
+Example:
+  nixfleet host migrate -H web5 --to nixos
+  nixfleet host migrate -H web5 --to nixos --method nixos-anywhere`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if toBase == "" {
+				return fmt.Errorf("--to is required (ubuntu, nixos, or darwin)")
+			}
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+			if len(hosts) != 1 {
+				return fmt.Errorf("migrate operates on one host at a time, use -H to select it")
+			}
+			host := hosts[0]
+
+			if host.Base == toBase {
+				return fmt.Errorf("host %q is already recorded as base %q", host.Name, toBase)
+			}
+
+			path, ok := inv.SourceFile(host.Name)
+			if !ok {
+				return fmt.Errorf("couldn't determine %q's inventory file", host.Name)
+			}
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+			if err != nil {
+				return fmt.Errorf("connecting to %s: %w", host.Name, err)
+			}
+
+			mgr := state.NewManager()
+
+			if method == "manual" {
+				fmt.Printf("Checking %s's live base...\n", host.Name)
+				liveBase, err := mgr.DetectBase(ctx, client)
+				if err != nil {
+					return fmt.Errorf("detecting live base: %w", err)
+				}
+				if liveBase != toBase {
+					return fmt.Errorf("host %s is running %q, not %q - refusing to record a migration that hasn't happened", host.Name, liveBase, toBase)
+				}
+			}
+
+			if dryRun {
+				fmt.Printf("Would migrate %s: %s -> %s (method %s)\n", host.Name, host.Base, toBase, method)
+				fmt.Printf("  Archive managed files, update tracking, and OS info under migration history\n")
+				fmt.Printf("  Update base in %s\n", path)
+				return nil
+			}
+
+			rec, err := mgr.MigrateBase(ctx, client, toBase, method)
+			if err != nil {
+				return fmt.Errorf("migrating state: %w", err)
+			}
+			fmt.Printf("%s: archived %s state, recorded migration to %s\n", host.Name, rec.FromBase, rec.ToBase)
+
+			if err := inventory.SetHostBaseInFile(path, host.Name, toBase); err != nil {
+				return fmt.Errorf("updating %s: %w", path, err)
+			}
+			fmt.Printf("%s: updated base in %s\n", host.Name, path)
+
+			fmt.Println("\nNext steps:")
+			fmt.Println("  1. Commit the inventory change")
+			fmt.Printf("  2. Run 'nixfleet apply -H %s' to deploy the %s configuration\n", host.Name, toBase)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&toBase, "to", "", "Base the host is now running (ubuntu, nixos, darwin)")
+	cmd.Flags().StringVar(&method, "method", "manual", "How the migration was performed (manual, nixos-anywhere)")
+
+	return cmd
+}
+
+func hostValidateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the inventory for duplicate or dangling definitions",
+		Long: `Run the full set of inventory consistency checks: group membership and
+apply_order referencing only defined hosts/groups, a host name defined more
+than once across the loaded files (reported with every definition's file
+and line), and an address shared by more than one host (a warning, since
+that's sometimes intentional). With --check-dns, also resolves every host's
+address up front instead of only discovering a DNS failure deep inside an
+apply's SSH connection.
+
+Exit codes: 0 if every check passed or only warned, 1 if any check failed.
+
+Example:
+  nixfleet host validate
+  nixfleet host validate --check-dns`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			inv, err := inventory.LoadFromDir(inventoryPath)
+			if err != nil {
+				inv, err = inventory.LoadFromFile(inventoryPath)
+				if err != nil {
+					return fmt.Errorf("loading inventory: %w", err)
+				}
+			}
+
+			report := inv.ValidateStrict(ctx, inventory.ValidateStrictOptions{CheckDNS: checkDNS})
+			for _, check := range report.Checks {
+				symbol := map[inventory.ValidationStatus]string{inventory.ValidationPass: "✓", inventory.ValidationWarn: "⚠", inventory.ValidationFail: "✗"}[check.Status]
+				fmt.Printf("%s %-24s %s\n", symbol, check.Name, check.Message)
+			}
+
+			if report.HasFailures() {
+				return exitWithCode(1, fmt.Errorf("one or more inventory checks failed"))
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func hostShowCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "show <host>",
+		Short: "Show a host's inventory and effective connection parameters",
+		Long: `Show a host's inventory fields (base, roles, groups, tags) and the
+connection parameters the SSH pool will actually use to reach it: hostname,
+user, port, identity file, ProxyJump, and connect timeout.
+
+Each connection parameter is tagged with where it came from - "inventory"
+when the inventory YAML set it explicitly, "ssh_config" when it was resolved
+from ~/.ssh/config or /etc/ssh/ssh_config (only when use_ssh_config is
+enabled, globally or on this host), or "default" otherwise. Any ssh_config
+directive nixfleet doesn't understand (ControlMaster, Include, a Match block
+with criteria other than a host pattern, ...) is listed once as a warning
+rather than silently ignored.
+
+Example:
+  nixfleet host show web3
+  nixfleet host show web3 --output json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid --output %q: must be table or json", output)
+			}
+
+			inv, err := inventory.LoadFromDir(inventoryPath)
+			if err != nil {
+				inv, err = inventory.LoadFromFile(inventoryPath)
+				if err != nil {
+					return fmt.Errorf("loading inventory: %w", err)
+				}
+			}
+
+			host, ok := inv.GetHost(args[0])
+			if !ok {
+				return fmt.Errorf("host %q not found", args[0])
+			}
+
+			var sshCfg *sshconfig.Config
+			var warnings []string
+			if inv.UseSSHConfigForHost(host) {
+				sshCfg, err = sshconfig.Load(sshconfig.DefaultPaths())
+				if err != nil {
+					return fmt.Errorf("loading ssh_config: %w", err)
+				}
+				warnings = sshCfg.Unsupported
+			}
+			resolved := ssh.ResolveConnection(inv, host, sshCfg)
+
+			if output == "json" {
+				out := struct {
+					Host       *inventory.Host         `json:"host"`
+					Groups     []string                `json:"groups"`
+					Connection *ssh.ResolvedConnection `json:"connection"`
+					Warnings   []string                `json:"warnings,omitempty"`
+				}{
+					Host:       host,
+					Groups:     inv.GroupsForHost(host),
+					Connection: resolved,
+					Warnings:   warnings,
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(out)
+			}
+
+			fmt.Printf("Host: %s\n", host.Name)
+			fmt.Printf("  Base:    %s\n", host.Base)
+			fmt.Printf("  Roles:   %v\n", host.Roles)
+			fmt.Printf("  Groups:  %v\n", inv.GroupsForHost(host))
+			if len(host.Tags) > 0 {
+				fmt.Printf("  Tags:    %v\n", host.Tags)
+			}
+
+			fmt.Println("\nEffective connection parameters:")
+			printResolvedField := func(name string, f ssh.ConnectionField) {
+				value := f.Value
+				if value == "" {
+					value = "(not set)"
+				}
+				fmt.Printf("  %-16s %-30s [%s]\n", name+":", value, f.Source)
+			}
+			printResolvedField("HostName", resolved.HostName)
+			printResolvedField("User", resolved.User)
+			printResolvedField("Port", resolved.Port)
+			printResolvedField("IdentityFile", resolved.IdentityFile)
+			printResolvedField("ProxyJump", resolved.ProxyJump)
+			printResolvedField("ConnectTimeout", resolved.ConnectTimeout)
+
+			if len(warnings) > 0 {
+				fmt.Println("\nUnsupported ssh_config directives (ignored):")
+				for _, w := range warnings {
+					fmt.Printf("  - %s\n", w)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&output, "output", "table", "Output format: table or json")
+
+	return cmd
+}
+
+func hostAuditCmd() *cobra.Command {
+	var (
+		dataDir        string
+		thresholdStr   string
+		olderThanStr   string
+		prune          bool
+		assumeYes      bool
+		pkiDir         string
+		secretsNixPath string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Find hosts that have gone quiet for a long time",
+		Long: `Probe every inventory host's SSH port and record the result in a local
+liveness cache under --data-dir, then list hosts that haven't answered in
+longer than --threshold (default 30d) as stale - almost always
+decommissioned hardware or a leftover inventory entry rather than a host
+having a bad day.
+
+With --prune, stale hosts unreachable longer than --older-than (default:
+--threshold) are listed and, on confirmation, removed from their inventory
+YAML file. Pruning only touches inventory - it warns about, but doesn't
+remove, leftover secrets.nix recipients, PKI certs, and k0s join tokens,
+since those need an operator's judgment to clean up safely.
+
+Example:
+  nixfleet host audit
+  nixfleet host audit --threshold 14d
+  nixfleet host audit --prune --older-than 60d`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			threshold, err := parseTTLDuration(thresholdStr)
+			if err != nil {
+				return fmt.Errorf("invalid --threshold: %w", err)
+			}
+			pruneThreshold := threshold
+			if olderThanStr != "" {
+				if pruneThreshold, err = parseTTLDuration(olderThanStr); err != nil {
+					return fmt.Errorf("invalid --older-than: %w", err)
+				}
+			}
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			tracker := liveness.NewTracker(dataDir)
+			engine := probe.NewEngine()
+			for _, h := range hosts {
+				port := h.SSHPort
+				if port == 0 {
+					port = 22
+				}
+				result := engine.RunOne(ctx, nil, h.Addr, probe.Config{
+					Type:    probe.TypeTCP,
+					Target:  fmt.Sprintf(":%d", port),
+					Timeout: 5 * time.Second,
+				})
+				tracker.Record(h.Name, result.Passed)
+			}
+
+			type staleHost struct {
+				host *inventory.Host
+				days int
+				seen bool
+			}
+			var stale []staleHost
+			for _, h := range hosts {
+				if !tracker.IsStale(h.Name, threshold) {
+					continue
+				}
+				days, seen := tracker.DaysUnreachable(h.Name)
+				stale = append(stale, staleHost{host: h, days: days, seen: seen})
+			}
+			sort.Slice(stale, func(i, j int) bool { return stale[i].days > stale[j].days })
+
+			if len(stale) == 0 {
+				fmt.Printf("No stale hosts (threshold: %s)\n", threshold)
+				return nil
+			}
+
+			fmt.Printf("%-20s %-15s %s\n", "HOST", "ADDRESS", "UNREACHABLE FOR")
+			for _, sh := range stale {
+				unreachable := fmt.Sprintf("%dd", sh.days)
+				if !sh.seen {
+					unreachable = "never seen"
+				}
+				fmt.Printf("%-20s %-15s %s\n", sh.host.Name, sh.host.Addr, unreachable)
+			}
+
+			if !prune {
+				return nil
+			}
+
+			var toPrune []staleHost
+			for _, sh := range stale {
+				if !sh.seen || time.Duration(sh.days)*24*time.Hour >= pruneThreshold {
+					toPrune = append(toPrune, sh)
+				}
+			}
+			if len(toPrune) == 0 {
+				fmt.Printf("\nNo stale hosts exceed --older-than %s; nothing to prune\n", pruneThreshold)
+				return nil
+			}
+
+			names := make([]string, len(toPrune))
+			for i, sh := range toPrune {
+				names[i] = sh.host.Name
+			}
+			fmt.Printf("\nAbout to remove %d host(s) from inventory: %s\n", len(toPrune), strings.Join(names, ", "))
+
+			if !assumeYes {
+				fmt.Print("Proceed? [y/N]: ")
+				var resp string
+				fmt.Scanln(&resp)
+				if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(resp)), "y") {
+					fmt.Println("aborted")
+					return nil
+				}
+			}
+
+			var pkiStore *pki.Store
+			if pkiDir != "" {
+				pkiStore = pki.NewStore(pkiDir, nil, nil)
+				if !pkiStore.CAExists() {
+					pkiStore = nil
+				}
+			}
+			var secretsCfg *secrets.SecretsNixConfig
+			if secretsNixPath != "" {
+				secretsCfg, _ = secrets.ParseSecretsNix(ctx, secretsNixPath)
+			}
+
+			for _, sh := range toPrune {
+				path, ok := inv.SourceFile(sh.host.Name)
+				if !ok {
+					fmt.Printf("  %s: skipped (couldn't determine its inventory file)\n", sh.host.Name)
+					continue
+				}
+				if err := inventory.RemoveHostFromFile(path, sh.host.Name); err != nil {
+					fmt.Printf("  %s: failed to remove from %s: %v\n", sh.host.Name, path, err)
+					continue
+				}
+				tracker.Forget(sh.host.Name)
+				fmt.Printf("  %s: removed from %s\n", sh.host.Name, path)
+
+				if pkiStore != nil && pkiStore.HostCertExists(sh.host.Name) {
+					fmt.Printf("    warning: %s still has a PKI cert issued - run `nixfleet pki revoke` if it should go\n", sh.host.Name)
+				}
+				if secretsCfg != nil {
+					if _, ok := secretsCfg.Hosts[sh.host.Name]; ok {
+						fmt.Printf("    warning: %s is still a recipient in secrets.nix - remove it and run `nixfleet secrets rekey`\n", sh.host.Name)
+					}
+				}
+				fmt.Printf("    warning: check for leftover k0s join tokens/node entries for %s\n", sh.host.Name)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dataDir, "data-dir", ".", "Directory for server-local state (host liveness cache)")
+	cmd.Flags().StringVar(&thresholdStr, "threshold", "30d", "How long a host can go unreachable before it's considered stale")
+	cmd.Flags().BoolVar(&prune, "prune", false, "Remove stale hosts from inventory after confirmation")
+	cmd.Flags().StringVar(&olderThanStr, "older-than", "", "Only prune hosts unreachable longer than this (default: --threshold)")
+	cmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Don't prompt for confirmation before pruning")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files, checked for leftover certs when pruning")
+	cmd.Flags().StringVar(&secretsNixPath, "secrets-nix", "secrets/secrets.nix", "Path to secrets.nix, checked for leftover recipients when pruning")
+
+	return cmd
+}
+
+func hostDiffCmd() *cobra.Command {
+	var output string
+	var pkiDir string
+
+	cmd := &cobra.Command{
+		Use:   "diff <host1> <host2>",
+		Short: "Compare two hosts' inventory, deployed state, and certs",
+		Long: `Compare two hosts side by side: inventory (base, roles, groups, tags),
+deployed store path and manifest hash (with a package-level closure diff
+when both paths are available locally), last-reported HostState
+(generation, drift, pending updates, service health), and PKI certificate
+info if a PKI store is configured.
+
+Hosts of different bases still compare - base-specific sections like
+pending update counts are marked not-applicable instead of erroring.
+
+Example:
+  nixfleet host diff web3 web4
+  nixfleet host diff web3 web4 --output json`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			inv, _, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+			host1, ok := inv.GetHost(args[0])
+			if !ok {
+				return fmt.Errorf("host %q not found", args[0])
+			}
+			host2, ok := inv.GetHost(args[1])
+			if !ok {
+				return fmt.Errorf("host %q not found", args[1])
+			}
+
+			var pkiStore *pki.Store
+			if pkiDir != "" {
+				pkiStore = pki.NewStore(pkiDir, nil, nil)
+			}
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			// The package-level closure diff is a nice-to-have, not a
+			// requirement: if nix isn't available or the flake can't be
+			// resolved, skip it rather than failing the whole comparison.
+			var evaluator *nix.Evaluator
+			if flake, ferr := nix.ResolveFlakePath(flakePath); ferr == nil {
+				evaluator, _ = newEvaluator(flake)
+			}
+
+			result := compare.Result{
+				Host1:     host1.Name,
+				Host2:     host2.Name,
+				Inventory: compare.Inventory(inv, host1, host2),
+				PKI:       compare.PKI(pkiStore, host1, host2),
+			}
+			result.Deploy, result.State = compare.DeployAndState(ctx, pool, state.NewManager(), evaluator, host1, host2)
+
+			if output == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(result)
+			}
+
+			printHostDiff(result)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&output, "output", "text", "Output format: text or json")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files (used for cert comparison; skipped if no CA is initialized)")
+
+	return cmd
+}
+
+func printHostDiff(r compare.Result) {
+	same := func(differs bool) string {
+		if differs {
+			return "DIFFERS"
+		}
+		return "same"
+	}
+
+	fmt.Printf("Comparing %s <-> %s\n\n", r.Host1, r.Host2)
+
+	fmt.Println("Inventory:")
+	fmt.Printf("  Base:   %-30s %-30s [%s]\n", r.Inventory.Base1, r.Inventory.Base2, same(r.Inventory.Base2Diff))
+	fmt.Printf("  Roles:  %-30v %-30v [%s]\n", r.Inventory.Roles1, r.Inventory.Roles2, same(r.Inventory.RolesDiff))
+	fmt.Printf("  Groups: %-30v %-30v [%s]\n", r.Inventory.Groups1, r.Inventory.Groups2, same(r.Inventory.GroupsDiff))
+	for _, k := range r.Inventory.TagKeys {
+		differs := false
+		for _, d := range r.Inventory.TagsDiffs {
+			if d == k {
+				differs = true
+			}
+		}
+		fmt.Printf("  Tag %-10s %-30s %-30s [%s]\n", k+":", r.Inventory.Tags1[k], r.Inventory.Tags2[k], same(differs))
+	}
+
+	fmt.Println("\nDeploy:")
+	if r.Deploy.Error1 != "" || r.Deploy.Error2 != "" {
+		fmt.Printf("  errors: %s / %s\n", r.Deploy.Error1, r.Deploy.Error2)
+	}
+	fmt.Printf("  Store path:    %-40s %-40s [%s]\n", r.Deploy.StorePath1, r.Deploy.StorePath2, same(r.Deploy.StorePathDiffers))
+	fmt.Printf("  Manifest hash: %-40s %-40s\n", r.Deploy.ManifestHash1, r.Deploy.ManifestHash2)
+	if r.Deploy.ClosureDiffSkipped != "" {
+		fmt.Printf("  Closure diff:  skipped (%s)\n", r.Deploy.ClosureDiffSkipped)
+	} else if r.Deploy.ClosureDiff != nil {
+		fmt.Printf("  Closure diff:  %d added, %d removed, %d upgraded\n", len(r.Deploy.ClosureDiff.Added), len(r.Deploy.ClosureDiff.Removed), len(r.Deploy.ClosureDiff.Upgraded))
+	}
+
+	fmt.Println("\nState:")
+	fmt.Printf("  Generation:      %-10d %-10d [%s]\n", r.State.Generation1, r.State.Generation2, same(r.State.Generation2Differs))
+	fmt.Printf("  Drift files:     %-10v %-10v [%s]\n", r.State.DriftFiles1, r.State.DriftFiles2, same(r.State.DriftDiffers))
+	if r.State.PendingUpdatesApplicable {
+		fmt.Printf("  Pending updates: %-10d %-10d [%s]\n", r.State.PendingUpdates1, r.State.PendingUpdates2, same(r.State.PendingUpdatesDiffer))
+	} else {
+		fmt.Println("  Pending updates: not applicable (bases differ)")
+	}
+	if len(r.State.ServiceHealthDiffers) > 0 {
+		fmt.Printf("  Service health differs for: %v\n", r.State.ServiceHealthDiffers)
+	} else {
+		fmt.Println("  Service health: same")
+	}
+
+	fmt.Println("\nPKI:")
+	if !r.PKI.Applicable {
+		fmt.Println("  not applicable (no PKI store configured)")
+	} else {
+		fmt.Printf("  Serial:     %-30s %-30s [%s]\n", r.PKI.Serial1, r.PKI.Serial2, same(r.PKI.Differs))
+		fmt.Printf("  Not after:  %-30s %-30s\n", r.PKI.NotAfter1, r.PKI.NotAfter2)
+		fmt.Printf("  Days left:  %-30d %-30d\n", r.PKI.DaysLeft1, r.PKI.DaysLeft2)
+	}
+}
+
+func searchCmd() *cobra.Command {
+	var searchType, output, pkiDir, dataDir string
+
+	cmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Search hosts, cached packages/files, and certs across the fleet",
+		Long: `Search across the fleet without ever SSHing to a host: inventory
+(host names, addresses, roles, tags), certificate CNs/SANs/serials from the
+PKI store, and installed packages / managed files / deployed store paths
+from the server's local search cache (populated whenever the server's apt
+or state endpoints have already talked to a host - see nixfleet server).
+
+Because this runs entirely against local data, package and file results
+can be stale; each carries the timestamp it was last collected at.
+
+Supports simple comparison operators:
+  nixfleet search "package:openssl<3.0.7"
+  nixfleet search "cert:expires<30d"
+
+Example:
+  nixfleet search openssl
+  nixfleet search --type host web
+  nixfleet search --type cert wildcard`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			inv, _, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			var pkiStore *pki.Store
+			if pkiDir != "" {
+				pkiStore = pki.NewStore(pkiDir, nil, nil)
+			}
+			cache := search.NewCache(dataDir)
+
+			results := search.Run(inv, pkiStore, cache, args[0], searchType)
+
+			if output == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(results)
+			}
+
+			printSearchResults(results)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&searchType, "type", "any", "Result type to search: host, package, file, cert, or any")
+	cmd.Flags().StringVar(&output, "output", "text", "Output format: text or json")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files (used for cert search; skipped if no CA is initialized)")
+	cmd.Flags().StringVar(&dataDir, "data-dir", ".", "Directory for server-local state (search cache, populated by a running nixfleet server)")
+
+	return cmd
+}
+
+func printSearchResults(r search.Results) {
+	if len(r.Matches) == 0 {
+		fmt.Printf("No matches for %q\n", r.Query)
+		return
+	}
+
+	fmt.Printf("%-10s %-20s %-30s %s\n", "TYPE", "HOST", "VALUE", "DETAIL")
+	for _, m := range r.Matches {
+		detail := m.Detail
+		if !m.CollectedAt.IsZero() {
+			detail = fmt.Sprintf("%s (collected %s)", detail, m.CollectedAt.Format("2006-01-02 15:04"))
+		}
+		fmt.Printf("%-10s %-20s %-30s %s\n", m.Type, m.Host, m.Value, detail)
+	}
+}
+
+func discoverCmd() *cobra.Command {
+	var (
+		cidr           string
+		sshUser        string
+		sshPort        int
+		timeout        time.Duration
+		awsTag         string
+		hetzner        bool
+		output         string
+		apply          bool
+		inventoryFile  string
+		knownHostsFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "discover",
+		Short: "Propose inventory entries from a network scan or cloud API",
+		Long: `Probe a network range for machines that could become inventory hosts:
+for every address that answers SSH, record its host key fingerprint and,
+when --ssh-user credentials work, its hostname and OS (via an authenticated
+fact-gather on top of the unauthenticated banner/host-key check).
+
+Responders are then diffed against the existing inventory:
+  new        - no inventory host has this address; shown in ready-to-commit
+               inventory format
+  moved      - this host key was previously seen (in --known-hosts) under a
+               different address that belongs to an existing inventory host
+  unexpected - an inventory host's configured address answered with a host
+               key --known-hosts has on record as belonging to somewhere else
+
+Nothing is written to the inventory unless --apply is given, in which case
+every "new" host is appended to --inventory-file.
+
+--aws and --hetzner pull candidates from a cloud provider's API instead of
+scanning a CIDR, populating addresses/names/tags-as-groups from the
+provider. Neither is implemented in this build (no cloud SDK is vendored);
+they're accepted here so the command's surface matches where cloud support
+will land, and fail clearly rather than silently scanning nothing.
+
+Examples:
+  nixfleet discover --cidr 10.0.7.0/24
+  nixfleet discover --cidr 10.0.7.0/24 --ssh-user ubuntu
+  nixfleet discover --cidr 10.0.7.0/24 --ssh-user ubuntu --apply`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid --output %q (want table or json)", output)
+			}
+
+			if awsTag != "" {
+				_, err := (&discover.AWSBackend{Tag: awsTag}).ListHosts(ctx)
+				return err
+			}
+			if hetzner {
+				_, err := (&discover.HetznerBackend{}).ListHosts(ctx)
+				return err
+			}
+
+			if cidr == "" {
+				return fmt.Errorf("--cidr is required (or --aws / --hetzner)")
+			}
+
+			inv, err := inventory.LoadFromDir(inventoryPath)
+			if err != nil {
+				inv, err = inventory.LoadFromFile(inventoryPath)
+				if err != nil {
+					return fmt.Errorf("loading inventory: %w", err)
+				}
+			}
+
+			responders, err := discover.Scan(ctx, discover.Config{
+				CIDR:    cidr,
+				SSHUser: sshUser,
+				SSHPort: sshPort,
+				Timeout: timeout,
+			})
+			if err != nil {
+				return fmt.Errorf("scanning %s: %w", cidr, err)
+			}
+
+			diff := discover.DiffAgainstInventory(inv, responders, knownHostsFile)
+
+			if output == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(diff)
+			}
+
+			printDiscoverDiff(diff)
+
+			if apply {
+				if len(diff.New) == 0 {
+					fmt.Println("\nNothing to apply: no new hosts found")
+					return nil
+				}
+				if inventoryFile == "" {
+					return fmt.Errorf("--apply requires --inventory-file (the file new hosts should be appended to)")
+				}
+
+				var newHosts []*inventory.Host
+				for _, p := range diff.New {
+					newHosts = append(newHosts, &inventory.Host{Name: p.Name, Base: p.Base, Addr: p.Addr, SSHUser: sshUser})
+				}
+				if err := inventory.AddHostsToFile(inventoryFile, newHosts); err != nil {
+					return fmt.Errorf("writing %s: %w", inventoryFile, err)
+				}
+				fmt.Printf("\nAdded %d new host(s) to %s\n", len(newHosts), inventoryFile)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&cidr, "cidr", "", "Network range to scan, e.g. 10.0.7.0/24")
+	cmd.Flags().StringVar(&sshUser, "ssh-user", "", "SSH user to attempt an authenticated fact-gather as (hostname, OS)")
+	cmd.Flags().IntVar(&sshPort, "ssh-port", discover.DefaultSSHPort, "SSH port to probe")
+	cmd.Flags().DurationVar(&timeout, "timeout", discover.DefaultTimeout, "Per-address probe timeout")
+	cmd.Flags().StringVar(&awsTag, "aws", "", "List candidates from AWS EC2 matching a \"key=value\" tag instead of scanning a CIDR")
+	cmd.Flags().BoolVar(&hetzner, "hetzner", false, "List candidates from the Hetzner Cloud API instead of scanning a CIDR")
+	cmd.Flags().StringVar(&output, "output", "table", "Output format: table or json")
+	cmd.Flags().BoolVar(&apply, "apply", false, "Write new hosts to --inventory-file instead of only proposing them")
+	cmd.Flags().StringVar(&inventoryFile, "inventory-file", "", "Inventory file new hosts are appended to with --apply")
+	cmd.Flags().StringVar(&knownHostsFile, "known-hosts", defaultKnownHostsFile(), "known_hosts file used to detect moved/unexpected host keys")
+
+	return cmd
+}
+
+// defaultKnownHostsFile returns the operator's default known_hosts path,
+// matching internal/ssh.DefaultConfig's KnownHostsFile.
+func defaultKnownHostsFile() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+func printDiscoverDiff(diff *discover.Diff) {
+	if len(diff.New) == 0 && len(diff.Moved) == 0 && len(diff.Unexpected) == 0 {
+		fmt.Println("No new, moved, or unexpected hosts found")
+		return
+	}
+
+	if len(diff.New) > 0 {
+		fmt.Println("New hosts:")
+		for _, h := range diff.New {
+			fmt.Printf("  %s:\n    base: %s\n    addr: %s\n", h.Name, h.Base, h.Addr)
+			fmt.Printf("    # host key fingerprint: %s\n\n", h.HostKeyFingerprint)
+		}
+	}
+
+	if len(diff.Moved) > 0 {
+		fmt.Println("Moved (same host key, different address):")
+		for _, h := range diff.Moved {
+			fmt.Printf("  %s: %s -> %s\n", h.Name, h.OldAddr, h.NewAddr)
+		}
+		fmt.Println()
+	}
+
+	if len(diff.Unexpected) > 0 {
+		fmt.Println("Unexpected (inventory address answered with a different host key):")
+		for _, h := range diff.Unexpected {
+			fmt.Printf("  %s (%s): expected %s, got %s\n", h.Name, h.Addr, h.ExpectedFingerprint, h.ActualFingerprint)
+		}
+	}
+}
+
+func hostAnnotateCmd() *cobra.Command {
+	var setPairs []string
+	var unsetKeys []string
+	var ttl string
+
+	cmd := &cobra.Command{
+		Use:   "annotate <hostname>",
+		Short: "Attach or remove operator annotations on a host",
+		Long: `Attach short free-form notes to a host that travel with it in state,
+instead of living in a wiki (e.g. "RAM flaky, replace Q3").
+
+Annotations are stored in the host's state and shown in 'status -v' and
+the API host detail response. A few keys change behavior:
+  no-reboot          - the reboot orchestrator skips this host
+  sticky-generation  - auto-apply skips this host
+
+Examples:
+  nixfleet host annotate db-1 --set no-reboot="telescope run until May 12" --ttl 30d
+  nixfleet host annotate db-1 --unset no-reboot`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			hostname := args[0]
+
+			var ttlDuration time.Duration
+			if ttl != "" {
+				d, err := parseTTLDuration(ttl)
+				if err != nil {
+					return fmt.Errorf("invalid --ttl: %w", err)
+				}
+				ttlDuration = d
+			}
+
+			targetHost = hostname
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+			if len(hosts) != 1 {
+				return fmt.Errorf("host %q not found in inventory", hostname)
+			}
+			host := hosts[0]
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+			if err != nil {
+				return fmt.Errorf("connecting to %s: %w", host.Name, err)
+			}
+
+			mgr := state.NewManager()
+			hostState, err := mgr.ReadState(ctx, client)
+			if err != nil {
+				return fmt.Errorf("reading state: %w", err)
+			}
+
+			for _, pair := range setPairs {
+				key, value, ok := strings.Cut(pair, "=")
+				if !ok {
+					return fmt.Errorf("invalid --set %q, expected key=value", pair)
+				}
+				hostState.SetAnnotation(key, value, ttlDuration)
+				fmt.Printf("%s: set %s=%s\n", host.Name, key, value)
+			}
+			for _, key := range unsetKeys {
+				hostState.UnsetAnnotation(key)
+				fmt.Printf("%s: unset %s\n", host.Name, key)
+			}
+
+			if len(setPairs) == 0 && len(unsetKeys) == 0 {
+				if len(hostState.Annotations) == 0 {
+					fmt.Printf("%s: no annotations\n", host.Name)
+					return nil
+				}
+				for key, ann := range hostState.Annotations {
+					fmt.Printf("%s: %s=%s (set %s)\n", host.Name, key, ann.Value, ann.SetAt.Format(time.RFC3339))
+				}
+				return nil
+			}
+
+			return mgr.WriteState(ctx, client, hostState)
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&setPairs, "set", nil, "Set an annotation as key=value (repeatable)")
+	cmd.Flags().StringArrayVar(&unsetKeys, "unset", nil, "Remove an annotation key (repeatable)")
+	cmd.Flags().StringVar(&ttl, "ttl", "", "Expire the annotation after a duration (e.g. 30d, 12h)")
+
+	return cmd
+}
+
+func hostCleanupGenerationsCmd() *cobra.Command {
+	var keep int
+	var dryRun bool
+	var gc bool
+
+	cmd := &cobra.Command{
+		Use:   "cleanup-generations",
+		Short: "Remove obsolete generations left by failed or rolled-back deploys",
+		Long: `Lists the generations nixfleet has recorded for a host (see
+HostState.Generations) alongside their outcome, age, and closure size, then
+removes the failed/rolled-back ones beyond --keep (default 5, most recent
+kept for post-mortem debugging): the profile generation is deleted with
+nix-env --delete-generations and the temporary GC root CopyToHost created
+for it during the copy phase is released. Superseded generations that
+activated successfully are left alone - use plain nix-collect-garbage (or
+--gc here) if you want those reclaimed too.
+
+Example:
+  nixfleet host cleanup-generations -H web-1
+  nixfleet host cleanup-generations -H web-1 --keep 2 --dry-run
+  nixfleet host cleanup-generations -H web-1 --gc`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+			if len(hosts) != 1 {
+				return fmt.Errorf("cleanup-generations operates on one host at a time; use -H to select it")
+			}
+			host := hosts[0]
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+			client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+			if err != nil {
+				return fmt.Errorf("connecting to %s: %w", host.Name, err)
+			}
+
+			mgr := state.NewManager()
+			toKeep, toRemove, err := mgr.GenerationsForCleanup(ctx, client, keep)
+			if err != nil {
+				return fmt.Errorf("reading state: %w", err)
+			}
+			if len(toKeep) == 0 && len(toRemove) == 0 {
+				fmt.Printf("%s: no failed or rolled-back generations recorded\n", host.Name)
+				return nil
+			}
+
+			evaluator, err := newEvaluator(flakePath)
+			if err != nil {
+				return fmt.Errorf("creating evaluator: %w", err)
+			}
+			deployer := nix.NewDeployer(evaluator)
+
+			fmt.Printf("%-6s %-12s %-8s %-10s %s\n", "GEN", "OUTCOME", "AGE", "SIZE", "STORE PATH")
+			printRow := func(rec state.GenerationRecord, action string) {
+				size, _ := deployer.RemoteClosureSize(ctx, client, rec.StorePath)
+				age := time.Since(rec.CreatedAt).Round(time.Hour)
+				fmt.Printf("%-6d %-12s %-8s %-10s %s%s\n", rec.Generation, rec.Outcome, age, formatBytes(size), rec.StorePath, action)
+			}
+			for _, rec := range toKeep {
+				printRow(rec, "")
+			}
+			for _, rec := range toRemove {
+				printRow(rec, "  (remove)")
+			}
+
+			if len(toRemove) == 0 {
+				fmt.Printf("\nNothing beyond --keep %d to remove\n", keep)
+				return nil
+			}
+
+			if dryRun {
+				fmt.Printf("\nDry run: would remove %d generation(s)\n", len(toRemove))
+				return nil
+			}
+
+			var freed int64
+			var removed []state.GenerationRecord
+			for _, rec := range toRemove {
+				size, _ := deployer.RemoteClosureSize(ctx, client, rec.StorePath)
+
+				if rec.Generation > 0 {
+					if err := deployer.DeleteGeneration(ctx, client, host.Base, rec.Generation); err != nil {
+						fmt.Printf("  Warning: failed to delete generation %d: %v\n", rec.Generation, err)
+						continue
+					}
+				}
+				if err := deployer.RemoveTempGCRoot(ctx, client, host.SSHUser, rec.StorePath); err != nil {
+					fmt.Printf("  Warning: failed to remove GC root for generation %d: %v\n", rec.Generation, err)
+				}
+
+				freed += size
+				removed = append(removed, rec)
+			}
+
+			if err := mgr.RemoveGenerationRecords(ctx, client, removed); err != nil {
+				fmt.Printf("  Warning: failed to update state after cleanup: %v\n", err)
+			}
+
+			fmt.Printf("\nRemoved %d generation(s), reclaiming approximately %s\n", len(removed), formatBytes(freed))
+
+			if gc {
+				fmt.Printf("\nRunning nix-collect-garbage...\n")
+				output, err := deployer.CollectGarbage(ctx, client)
+				if err != nil {
+					return fmt.Errorf("nix-collect-garbage: %w", err)
+				}
+				fmt.Println(output)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&keep, "keep", 5, "Number of failed/rolled-back generations to keep for debugging")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List what would be removed without removing it")
+	cmd.Flags().BoolVar(&gc, "gc", false, "Run nix-collect-garbage on the host after removing generations")
+
+	return cmd
+}
+
+// formatBytes renders a byte count in human-readable units, matching the
+// precision 'nixfleet status' uses for closure sizes.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// parseTTLDuration parses a duration string that additionally supports a
+// "d" (day) suffix, matching the format used for PKI validity periods.
+func parseTTLDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func hostOnboardCmd() *cobra.Command {
+	var secretsNixPath string
+	var secretsDir string
+	var repoURL string
+	var branch string
+	var interval string
+	var skipPullMode bool
+	var skipRekey bool
+	var outputSecretsNix bool
+
+	cmd := &cobra.Command{
+		Use:   "onboard",
+		Short: "Onboard a new host to the fleet",
+		Long: `Onboard a new host by performing the following steps:
+
+1. Get the host's SSH host key and convert to age public key
+2. Display what to add to secrets.nix (or output in copy-paste format)
+3. Optionally rekey all secrets to include the new host
+4. Optionally install pull mode for GitOps deployments
+
+Prerequisites:
+  - Host must be bootstrapped (run bootstrap-ubuntu.sh first)
+  - Host must be in your inventory file
+  - SSH access must be configured
+
+Example:
+  # Onboard a new host with full setup
+  nixfleet host onboard -H newhost --repo git@github.com:org/fleet-hosts.git
+
+  # Just get the age key (for manual setup)
+  nixfleet host onboard -H newhost --skip-pull-mode --skip-rekey
+
+  # Output secrets.nix snippet for copy-paste
+  nixfleet host onboard -H newhost --output-secrets-nix`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			if len(hosts) == 0 {
+				return fmt.Errorf("no hosts selected. Use -H to specify a host")
+			}
+
+			if len(hosts) > 1 {
+				return fmt.Errorf("onboard operates on one host at a time. Found %d hosts", len(hosts))
+			}
+
+			host := hosts[0]
+			fmt.Printf("Onboarding host: %s (%s)\n\n", host.Name, host.Addr)
+
+			// Step 1: Get age public key from SSH host key
+			fmt.Println("Step 1: Getting age public key from SSH host key...")
+
+			port := host.SSHPort
+			if port == 0 {
+				port = 22
+			}
+
+			ageKey, err := secrets.GetHostAgeKeyFromRemote(ctx, host.Addr, host.SSHUser, port)
+			if err != nil {
+				return fmt.Errorf("failed to get age key: %w", err)
+			}
+
+			fmt.Printf("  Age public key: %s\n\n", ageKey)
+
+			// Step 2: Show secrets.nix addition
+			fmt.Println("Step 2: secrets.nix configuration")
+
+			if outputSecretsNix {
+				// Output in copy-paste format
+				fmt.Println("Add to your secrets.nix hosts section:")
+				fmt.Println("```nix")
+				fmt.Printf("  %s = \"%s\";\n", host.Name, ageKey)
+				fmt.Println("```")
+				fmt.Println()
+				fmt.Println("Then add secrets access:")
+				fmt.Println("```nix")
+				fmt.Printf("  \"your-secret.age\".publicKeys = allAdmins ++ [ hosts.%s ];\n", host.Name)
+				fmt.Println("```")
+			} else {
+				fmt.Println("  Add to secrets.nix hosts section:")
+				fmt.Printf("    %s = \"%s\";\n\n", host.Name, ageKey)
+				fmt.Println("  Then add secrets access for this host:")
+				fmt.Printf("    \"secret-name.age\".publicKeys = allAdmins ++ [ hosts.%s ];\n\n", host.Name)
+			}
+
+			// Step 3: Rekey secrets (optional)
+			if !skipRekey {
+				fmt.Println("Step 3: Rekeying secrets...")
+
+				// Check if secrets.nix exists
+				if _, err := os.Stat(secretsNixPath); os.IsNotExist(err) {
+					fmt.Printf("  Skipped: secrets.nix not found at %s\n", secretsNixPath)
+					fmt.Println("  After adding the host to secrets.nix, run: nixfleet secrets rekey")
+				} else {
+					// Parse and check if host is in secrets.nix
+					config, err := secrets.ParseSecretsNix(ctx, secretsNixPath)
+					if err != nil {
+						fmt.Printf("  Warning: Could not parse secrets.nix: %v\n", err)
+						fmt.Println("  After adding the host to secrets.nix, run: nixfleet secrets rekey")
+					} else if _, exists := config.Hosts[host.Name]; !exists {
+						fmt.Printf("  Host %s not yet in secrets.nix\n", host.Name)
+						fmt.Println("  After adding the host, run: nixfleet secrets rekey")
+					} else {
+						// Host exists, get identity and rekey
+						home, _ := os.UserHomeDir()
+						identityPath := filepath.Join(home, ".config", "age", "admin-key.txt")
+
+						if _, err := os.Stat(identityPath); os.IsNotExist(err) {
+							fmt.Printf("  Skipped: Admin key not found at %s\n", identityPath)
+							fmt.Println("  Run manually: nixfleet secrets rekey --identity /path/to/key")
+						} else {
+							rekeyed, err := secrets.RekeyAll(ctx, secretsDir, config, identityPath, dryRun, false)
+							if err != nil {
+								fmt.Printf("  Warning: Rekey failed: %v\n", err)
+							} else if dryRun {
+								fmt.Printf("  Would rekey %d secret(s)\n", len(rekeyed))
+							} else {
+								fmt.Printf("  Rekeyed %d secret(s)\n", len(rekeyed))
+							}
+						}
+					}
+				}
+				fmt.Println()
+			} else {
+				fmt.Println("Step 3: Skipped (--skip-rekey)")
+				fmt.Println()
+			}
+
+			// Step 4: Install pull mode (optional)
+			if !skipPullMode {
+				fmt.Println("Step 4: Installing pull mode...")
+
+				if repoURL == "" {
+					fmt.Println("  Skipped: No --repo specified")
+					fmt.Println("  To install later: nixfleet pull-mode install -H " + host.Name + " --repo <url>")
+				} else if dryRun {
+					fmt.Printf("  Would install pull mode with repo: %s\n", repoURL)
+				} else {
+					pool := ssh.NewPool(nil)
+					_, _ = pool.EnableSSHConfig(inv)
+					defer pool.Close()
+
+					client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+					if err != nil {
+						return fmt.Errorf("SSH connection failed: %w", err)
+					}
+
+					defaults := pullmode.DefaultConfig()
+					pmConfig := pullmode.Config{
+						RepoURL:             repoURL,
+						Branch:              branch,
+						HostName:            host.Name,
+						SSHKeyPath:          defaults.SSHKeyPath,
+						AgeKeyPath:          defaults.AgeKeyPath,
+						Interval:            interval,
+						ApplyOnBoot:         true,
+						RepoPath:            defaults.RepoPath,
+						RollbackWindow:      defaults.RollbackWindow,
+						BuildLeader:         host.PullBuildLeader,
+						BandwidthLimitKB:    host.PullBandwidthLimitKB,
+						TransferWindow:      host.PullTransferWindow,
+						TransferThresholdMB: host.PullTransferThresholdMB,
+					}
+					if pmConfig.Branch == "" {
+						pmConfig.Branch = defaults.Branch
+					}
+					if pmConfig.Interval == "" {
+						pmConfig.Interval = defaults.Interval
+					}
+					if pmConfig.TransferWindow != "" && pmConfig.TransferThresholdMB == 0 {
+						pmConfig.TransferThresholdMB = defaults.TransferThresholdMB
+					}
+					if err := pullmode.ParseTransferWindow(pmConfig.TransferWindow); err != nil {
+						return fmt.Errorf("invalid pull_transfer_window: %w", err)
+					}
+
+					installer := pullmode.NewInstaller()
+					if err := installer.Install(ctx, client, pmConfig); err != nil {
+						return fmt.Errorf("pull mode installation failed: %w", err)
+					}
+
+					fmt.Println("  Pull mode installed successfully")
+				}
+				fmt.Println()
+			} else {
+				fmt.Println("Step 4: Skipped (--skip-pull-mode)")
+				fmt.Println()
+			}
+
+			// Summary
+			fmt.Println("========================================")
+			fmt.Printf("Onboarding complete for %s\n", host.Name)
+			fmt.Println("========================================")
+			fmt.Println()
+			fmt.Println("Next steps:")
+			if skipRekey || skipPullMode {
+				fmt.Println("  1. Add host to secrets.nix (see above)")
+				fmt.Println("  2. Run: nixfleet secrets rekey")
+				fmt.Println("  3. Commit and push changes")
+				if skipPullMode && repoURL == "" {
+					fmt.Println("  4. Install pull mode: nixfleet pull-mode install -H " + host.Name + " --repo <url>")
+				}
+			} else {
+				fmt.Println("  1. Verify deployment: nixfleet pull-mode status -H " + host.Name)
+				fmt.Println("  2. Trigger first pull: nixfleet pull-mode trigger -H " + host.Name)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&secretsNixPath, "secrets-nix", "c", "secrets/secrets.nix", "Path to secrets.nix")
+	cmd.Flags().StringVarP(&secretsDir, "secrets-dir", "s", "secrets/", "Directory containing .age files")
+	cmd.Flags().StringVar(&repoURL, "repo", "", "Git repository URL for pull mode")
+	cmd.Flags().StringVar(&branch, "branch", "main", "Git branch for pull mode")
+	cmd.Flags().StringVar(&interval, "interval", "5m", "Pull interval (e.g., 5m, 1h)")
+	cmd.Flags().BoolVar(&skipPullMode, "skip-pull-mode", false, "Skip pull mode installation")
+	cmd.Flags().BoolVar(&skipRekey, "skip-rekey", false, "Skip secrets rekey step")
+	cmd.Flags().BoolVar(&outputSecretsNix, "output-secrets-nix", false, "Output secrets.nix snippet in copy-paste format")
+
+	return cmd
+}
+
+func hostRotateKeyCmd() *cobra.Command {
+	var secretsNixPath string
+	var secretsDir string
+	var identityPath string
+
+	cmd := &cobra.Command{
+		Use:   "rotate-key",
+		Short: "Rotate a host's age key after a reimage",
+		Long: `Rotate a host's age key after it has been reimaged and its SSH host key
+has changed. A reimage silently breaks every secret and k0s token that was
+encrypted for the old key, and the first symptom is usually an inscrutable
+decrypt error on the next pull.
+
+This command:
+  1. Fetches the host's current SSH host key and derives its age key
+  2. Compares it against the key on file in secrets.nix (refuses to
+     proceed if they're identical - nothing to rotate)
+  3. Updates the host's key binding in secrets.nix in place, keeping a
+     .bak copy of the original
+  4. Rekeys every secret whose recipient list included the old key
+  5. Rekeys the k0s join tokens, if any are present
+  6. Updates the host's entry in the fleet known_hosts file, if one exists
+
+Use --dry-run to see exactly what would change without touching anything.
+
+Example:
+  nixfleet host rotate-key -H web1
+  nixfleet host rotate-key -H web1 --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+			if len(hosts) != 1 {
+				return fmt.Errorf("rotate-key operates on one host at a time, use -H to select it")
+			}
+			host := hosts[0]
+
+			port := host.SSHPort
+			if port == 0 {
+				port = 22
+			}
+
+			config, err := secrets.ParseSecretsNix(ctx, secretsNixPath)
+			if err != nil {
+				return fmt.Errorf("parsing secrets.nix: %w", err)
+			}
+
+			oldKey, ok := config.Hosts[host.Name]
+			if !ok {
+				return fmt.Errorf("host %q has no key on file in %s", host.Name, secretsNixPath)
+			}
+
+			fmt.Printf("Fetching current SSH host key from %s...\n", host.Name)
+			newKey, err := secrets.GetHostAgeKeyFromRemote(ctx, host.Addr, host.SSHUser, port)
+			if err != nil {
+				return fmt.Errorf("failed to get age key: %w", err)
+			}
+
+			fmt.Printf("  Old key: %s\n", oldKey)
+			fmt.Printf("  New key: %s\n\n", newKey)
+
+			if oldKey == newKey {
+				return fmt.Errorf("host %q's key is unchanged, nothing to rotate", host.Name)
+			}
+
+			affected := config.SecretsWithRecipient(oldKey)
+
+			k0sSecretsDir := filepath.Join(flakePath, "secrets", "k0s")
+			tokenFiles := []string{"worker-token.age", "controller-token.age"}
+			var presentTokens []string
+			for _, f := range tokenFiles {
+				if _, err := os.Stat(filepath.Join(k0sSecretsDir, f)); err == nil {
+					presentTokens = append(presentTokens, f)
+				}
+			}
+
+			knownHostsPath := filepath.Join(filepath.Dir(secretsNixPath), "known_hosts")
+			_, knownHostsErr := os.Stat(knownHostsPath)
+
+			if dryRun {
+				fmt.Println("Would change:")
+				fmt.Printf("  %s (key binding for %s)\n", secretsNixPath, host.Name)
+				for name := range affected {
+					fmt.Printf("  %s\n", filepath.Join(secretsDir, name))
+				}
+				for _, f := range presentTokens {
+					fmt.Printf("  %s\n", filepath.Join(k0sSecretsDir, f))
+				}
+				if knownHostsErr == nil {
+					fmt.Printf("  %s (host key line for %s)\n", knownHostsPath, host.Addr)
+				} else {
+					fmt.Printf("  (no fleet known_hosts file at %s yet, skipping)\n", knownHostsPath)
+				}
+				return nil
+			}
+
+			if identityPath == "" {
+				home, _ := os.UserHomeDir()
+				identityPath = filepath.Join(home, ".config", "age", "admin-key.txt")
+			}
+			if _, err := os.Stat(identityPath); os.IsNotExist(err) {
+				return fmt.Errorf("identity file not found: %s\nUse --identity to specify your age identity file", identityPath)
+			}
+
+			fmt.Printf("Updating %s...\n", secretsNixPath)
+			if err := secrets.RotateHostKey(secretsNixPath, host.Name, oldKey, newKey); err != nil {
+				return fmt.Errorf("updating secrets.nix: %w", err)
+			}
+			fmt.Printf("  Backed up original to %s.bak\n\n", secretsNixPath)
+
+			updatedConfig, err := secrets.ParseSecretsNix(ctx, secretsNixPath)
+			if err != nil {
+				return fmt.Errorf("re-parsing updated secrets.nix: %w", err)
+			}
+
+			if len(affected) > 0 {
+				fmt.Printf("Rekeying %d secret(s)...\n", len(affected))
+				rekeyConfig := &secrets.SecretsNixConfig{Secrets: updatedConfig.SecretsWithRecipient(newKey)}
+				rekeyed, err := secrets.RekeyAll(ctx, secretsDir, rekeyConfig, identityPath, false, false)
+				if err != nil {
+					return fmt.Errorf("rekeying secrets: %w", err)
+				}
+				for _, name := range rekeyed {
+					fmt.Printf("  ✓ %s\n", name)
+				}
+				fmt.Println()
+			} else {
+				fmt.Println("No secrets referenced the old key, nothing to rekey there.")
+				fmt.Println()
+			}
+
+			if len(presentTokens) > 0 {
+				fmt.Println("Rekeying k0s tokens...")
+				allRecipients := append(append([]string{}, updatedConfig.AllAdmins...), updatedConfig.AllHosts...)
+				for _, f := range presentTokens {
+					tokenPath := filepath.Join(k0sSecretsDir, f)
+
+					decryptCmd := exec.CommandContext(ctx, "age", "--decrypt", "-i", identityPath, tokenPath)
+					plaintext, err := decryptCmd.Output()
+					if err != nil {
+						return fmt.Errorf("decrypting %s: %w", f, err)
+					}
+
+					encryptArgs := []string{"--encrypt", "-o", tokenPath}
+					for _, r := range allRecipients {
+						encryptArgs = append(encryptArgs, "-r", r)
+					}
+					encryptCmd := exec.CommandContext(ctx, "age", encryptArgs...)
+					encryptCmd.Stdin = bytes.NewReader(plaintext)
+					if err := encryptCmd.Run(); err != nil {
+						return fmt.Errorf("re-encrypting %s: %w", f, err)
+					}
+					fmt.Printf("  ✓ %s\n", f)
+				}
+				fmt.Println()
+			}
+
+			if knownHostsErr == nil {
+				fmt.Printf("Updating %s...\n", knownHostsPath)
+				pool := ssh.NewPool(nil)
+				_, _ = pool.EnableSSHConfig(inv)
+				defer pool.Close()
+
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					return fmt.Errorf("connecting to %s: %w", host.Name, err)
+				}
+
+				sshKeyResult, err := client.Exec(ctx, "cat /etc/ssh/ssh_host_ed25519_key.pub")
+				if err != nil || sshKeyResult.ExitCode != 0 {
+					return fmt.Errorf("reading SSH host key: %w", err)
+				}
+
+				if err := updateKnownHosts(knownHostsPath, host.Addr, strings.TrimSpace(sshKeyResult.Stdout)); err != nil {
+					return fmt.Errorf("updating known_hosts: %w", err)
+				}
+				fmt.Println("  Updated")
+			} else {
+				fmt.Printf("No fleet known_hosts file at %s yet, skipping\n", knownHostsPath)
+			}
+			fmt.Println()
+
+			fmt.Println("Next steps:")
+			fmt.Println("  1. Review the diff in secrets.nix and the rekeyed secrets")
+			fmt.Println("  2. Commit and push the changes")
+			fmt.Printf("  3. Trigger a pull on %s: nixfleet pull-mode trigger -H %s\n", host.Name, host.Name)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&secretsNixPath, "secrets-nix", "c", "secrets/secrets.nix", "Path to secrets.nix")
+	cmd.Flags().StringVarP(&secretsDir, "secrets-dir", "s", "secrets/", "Directory containing .age files")
+	cmd.Flags().StringVar(&identityPath, "identity", "", "Path to age identity for decryption (default: ~/.config/age/admin-key.txt)")
+
+	return cmd
+}
+
+// updateKnownHosts rewrites (or appends) the line for hostAddr in a standard
+// OpenSSH known_hosts file, so a rotated host key doesn't leave a stale
+// pinned entry behind that blocks the next SSH connection.
+func updateKnownHosts(path, hostAddr, sshHostKeyLine string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	newLine := hostAddr + " " + sshHostKeyLine
+	lines := strings.Split(string(data), "\n")
+	replaced := false
+	for i, line := range lines {
+		if strings.HasPrefix(line, hostAddr+" ") {
+			lines[i] = newLine
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		lines = append(lines, newLine)
+	}
+
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644)
+}
+
+// PKI Commands
+
+func provenanceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "provenance",
+		Short: "Inspect signed build provenance for deployed closures",
+		Long: `Inspect signed build provenance records.
+
+Every 'nixfleet apply' (unless --skip-state is set) signs and records a
+provenance document for the closure it deploys: the git commit and
+dirty-tree flag of the flake it was built from, the builder identity, the
+nix version, and a timestamp. Records are signed with a dedicated ed25519
+key and stored under --provenance-dir, keyed by store path.
+
+Commands:
+  show    - Print the provenance record for a host or store path
+  verify  - Check a record's signature and that it matches what's on disk`,
+	}
+
+	cmd.AddCommand(provenanceShowCmd())
+	cmd.AddCommand(provenanceVerifyCmd())
+
+	return cmd
+}
+
+// resolveProvenanceTarget interprets arg as a nix store path if it looks
+// like one, otherwise as a host name whose currently-deployed store path is
+// looked up from its remote state.
+func resolveProvenanceTarget(ctx context.Context, arg string) (storePath, hostName string, err error) {
+	if strings.HasPrefix(arg, "/nix/store/") {
+		return arg, "", nil
+	}
+
+	inv, err := inventory.LoadFromDir(inventoryPath)
+	if err != nil {
+		inv, err = inventory.LoadFromFile(inventoryPath)
+		if err != nil {
+			return "", "", fmt.Errorf("loading inventory: %w", err)
+		}
+	}
+	host, ok := inv.GetHost(arg)
+	if !ok {
+		return "", "", fmt.Errorf("%q is neither a /nix/store path nor a known host name", arg)
+	}
+
+	pool := ssh.NewPool(nil)
+	_, _ = pool.EnableSSHConfig(inv)
+	defer pool.Close()
+
+	client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+	if err != nil {
+		return "", "", fmt.Errorf("connecting to %s: %w", host.Name, err)
+	}
+
+	hostState, err := state.NewManager().ReadState(ctx, client)
+	if err != nil {
+		return "", "", fmt.Errorf("reading state for %s: %w", host.Name, err)
+	}
+	if hostState.StorePath == "" {
+		return "", "", fmt.Errorf("%s has no recorded store path yet", host.Name)
+	}
+
+	return hostState.StorePath, host.Name, nil
+}
+
+func provenanceShowCmd() *cobra.Command {
+	var provenanceDir string
+
+	cmd := &cobra.Command{
+		Use:   "show <store-path|host>",
+		Short: "Print the provenance record for a host or store path",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			storePath, hostName, err := resolveProvenanceTarget(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			store := provenance.NewStore(provenanceDir, nil, defaultIdentities())
+			rec, err := store.Load(storePath)
+			if err != nil {
+				return fmt.Errorf("no provenance record for %s: %w", storePath, err)
+			}
+
+			if hostName == "" {
+				hostName = rec.HostName
+			}
+			fmt.Printf("Store path:    %s\n", rec.StorePath)
+			fmt.Printf("Host:          %s\n", hostName)
+			fmt.Printf("Manifest hash: %s\n", rec.ManifestHash)
+			fmt.Printf("Git commit:    %s", rec.GitCommit)
+			if rec.GitDirty {
+				fmt.Printf(" (dirty)")
+			}
+			fmt.Println()
+			fmt.Printf("Builder:       %s\n", rec.Builder)
+			fmt.Printf("Nix version:   %s\n", rec.NixVersion)
+			fmt.Printf("Signed at:     %s\n", rec.CreatedAt.Format(time.RFC3339))
+
+			ok, err := store.Verify(rec)
+			if err != nil {
+				fmt.Printf("Signature:     unverifiable (%v)\n", err)
+			} else if ok {
+				fmt.Printf("Signature:     valid\n")
+			} else {
+				fmt.Printf("Signature:     INVALID\n")
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&provenanceDir, "provenance-dir", defaultProvenanceDir(), "Directory containing provenance records and the signing key")
+
+	return cmd
+}
+
+func provenanceVerifyCmd() *cobra.Command {
+	var provenanceDir string
+
+	cmd := &cobra.Command{
+		Use:   "verify <store-path|host>",
+		Short: "Check a provenance record's signature and store path hash",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			storePath, hostName, err := resolveProvenanceTarget(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if hostName != "" {
+				fmt.Printf("Resolved %s -> %s\n", hostName, storePath)
+			}
+
+			store := provenance.NewStore(provenanceDir, nil, defaultIdentities())
+			rec, err := store.Load(storePath)
+			if err != nil {
+				return fmt.Errorf("no provenance record for %s: %w", storePath, err)
+			}
+
+			ok, err := store.Verify(rec)
+			if err != nil {
+				return fmt.Errorf("signature check failed: %w", err)
+			}
+			if !ok {
+				return fmt.Errorf("signature does NOT verify for %s", storePath)
+			}
+			fmt.Println("Signature: valid")
+
+			flake, err := nix.ResolveFlakePath(flakePath)
+			if err != nil {
+				return err
+			}
+			evaluator, err := newEvaluator(flake)
+			if err != nil {
+				return err
+			}
+
+			currentHash, err := evaluator.ManifestHashFor(ctx, storePath)
+			if err != nil {
+				return fmt.Errorf("hashing %s: %w", storePath, err)
+			}
+			if currentHash != rec.ManifestHash {
+				return fmt.Errorf("recorded manifest hash %s does not match current hash %s - store path has changed since it was signed", rec.ManifestHash, currentHash)
+			}
+			fmt.Println("Manifest hash: matches")
+			fmt.Println("OK")
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&provenanceDir, "provenance-dir", defaultProvenanceDir(), "Directory containing provenance records and the signing key")
+
+	return cmd
+}
+
+// pkiCertJSON is one row of --output json output for 'pki status', 'pki
+// renew', and 'pki scan' - the same stable field names across all three so
+// a cron wrapper can consume any of them without three separate parsers or
+// having to grep for a unicode status icon. A command that doesn't have a
+// value for a given field (e.g. 'pki scan' has no cert serial) just leaves
+// it at its zero value.
+type pkiCertJSON struct {
+	Hostname   string   `json:"hostname,omitempty"`
+	CertName   string   `json:"certName,omitempty"`
+	Serial     string   `json:"serial,omitempty"`
+	NotAfter   string   `json:"notAfter,omitempty"`
+	DaysLeft   int      `json:"daysLeft,omitempty"`
+	Status     string   `json:"status"`
+	SANs       []string `json:"sans,omitempty"`
+	Profile    string   `json:"profile,omitempty"`
+	Algorithm  string   `json:"algorithm,omitempty"`
+	KeyAgeDays int      `json:"keyAgeDays,omitempty"`
+	KeyReused  bool     `json:"keyReused,omitempty"`
+	// Error is set instead of the fields above when the entry itself
+	// couldn't be read, so a broken cert shows up as data rather than
+	// disappearing from the report the way a printed "ERROR" table row does.
+	Error string `json:"error,omitempty"`
+}
+
+// pkiExitError inspects a batch of pkiCertJSON rows and returns the exit
+// code monitoring should see: 10 if any entry is revoked, 9 if any is
+// expired (or a renewal of one failed), 8 if any is merely expiring, 1 if
+// any entry couldn't be read at all, nil (exit 0) otherwise. Revoked takes
+// priority over expired, which takes priority over expiring, and both take
+// priority over a read error, since an unreachable cert is a lesser
+// problem than one that's confirmed bad.
+func pkiExitError(rows []pkiCertJSON) error {
+	var revoked, expired, expiring, errored int
+	for _, r := range rows {
+		switch r.Status {
+		case "revoked":
+			revoked++
+		case "expired", "failed":
+			expired++
+		case "expiring":
+			expiring++
+		}
+		if r.Error != "" {
+			errored++
+		}
+	}
+
+	switch {
+	case revoked > 0:
+		return exitWithCode(10, fmt.Errorf("%d cert(s) revoked", revoked))
+	case expired > 0:
+		return exitWithCode(9, fmt.Errorf("%d cert(s) expired or failed to renew", expired))
+	case expiring > 0:
+		return exitWithCode(8, fmt.Errorf("%d cert(s) expiring", expiring))
+	case errored > 0:
+		return exitWithCode(1, fmt.Errorf("%d cert(s) could not be read", errored))
+	}
+	return nil
+}
+
+func pkiCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pki",
+		Short: "Manage fleet PKI and certificates",
+		Long: `Manage the fleet's Public Key Infrastructure.
+
+Commands:
+  init             - Initialize a new root Certificate Authority
+  init-intermediate - Create an intermediate CA (signed by root)
+  issue            - Issue a certificate for a host
+  status           - Show certificate status for fleet hosts
+  scan             - Find certs on hosts that the PKI store doesn't know about
+  renew            - Renew expiring certificates
+  export           - Export CA certificate for external trust
+  trust            - Add CA to local machine's trust store
+  certmanager      - Integration with Kubernetes cert-manager
+  install-timer    - Install systemd timer for auto-rotation
+  uninstall-timer  - Remove systemd timer
+  bundle           - Build the fleet-wide external CA trust bundle
+  crl              - Generate the CRL covering revoked certificates
+  request          - Generate a CSR for an admin to approve
+  requests         - List/approve/deny pending certificate requests`,
+	}
+
+	cmd.AddCommand(pkiInitCmd())
+	cmd.AddCommand(pkiInitIntermediateCmd())
+	cmd.AddCommand(pkiIssueCmd())
+	cmd.AddCommand(pkiStatusCmd())
+	cmd.AddCommand(pkiExportCmd())
+	cmd.AddCommand(pkiTrustCmd())
+	cmd.AddCommand(pkiDeployCmd())
+	cmd.AddCommand(pkiRenewCmd())
+	cmd.AddCommand(pkiRevokeCmd())
+	cmd.AddCommand(pkiCertManagerCmd())
+	cmd.AddCommand(pkiInstallTimerCmd())
+	cmd.AddCommand(pkiUninstallTimerCmd())
+	cmd.AddCommand(pkiInstallAgentCmd())
+	cmd.AddCommand(pkiScanCmd())
+	cmd.AddCommand(pkiBundleCmd())
+	cmd.AddCommand(pkiCrlCmd())
+	cmd.AddCommand(pkiRequestCmd())
+	cmd.AddCommand(pkiRequestsCmd())
+
+	return cmd
+}
+
+func pkiBundleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Manage the fleet-wide trust bundle",
+		Long: `Manage a combined trust bundle of the fleet's own CA plus any
+external CAs declared in trust-bundle.yaml, for hosts that need to trust
+certificates nixfleet didn't issue (partner CAs, legacy internal roots).`,
+	}
+
+	cmd.AddCommand(pkiBundleBuildCmd())
+
+	return cmd
+}
+
+func pkiBundleBuildCmd() *cobra.Command {
+	var (
+		pkiDir     string
+		identities []string
+		configFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "build",
+		Short: "Build the combined trust bundle from trust-bundle.yaml",
+		Long: `Build the combined trust bundle: the fleet's own root (and
+intermediate, if any) plus every external CA declared in
+trust-bundle.yaml, concatenated in a fixed order (root, intermediate,
+external sorted by name). Each external CA's PEM is checked against its
+expectedFingerprint before being included, so a swapped-out file in the
+repo is caught rather than trusted.
+
+Run this after editing trust-bundle.yaml, then 'nixfleet pki deploy' or
+'nixfleet apply --with-pki' to push the rebuilt bundle to hosts. Removing
+an entry from trust-bundle.yaml and rebuilding drops it from the bundle
+deployed on the next run - it isn't merely left out of new installs.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store := pki.NewStore(pkiDir, nil, identities)
+
+			cfgPath := configFile
+			if cfgPath == "" {
+				cfgPath = store.GetTrustBundleConfigPath()
+			}
+			cfg, err := pki.LoadTrustBundleConfig(cfgPath)
+			if err != nil {
+				return err
+			}
+
+			bundle, manifest, err := store.BuildBundle(cfg)
+			if err != nil {
+				return fmt.Errorf("building trust bundle: %w", err)
+			}
+			if err := store.SaveBundle(bundle, manifest); err != nil {
+				return err
+			}
+
+			fmt.Printf("Built trust bundle: %d certificate(s), hash %s\n", len(manifest.Certs), manifest.Hash)
+			for _, c := range manifest.Certs {
+				fmt.Printf("  %-14s %s (expires %s)\n", c.Source, c.Subject, c.NotAfter.Format("2006-01-02"))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", "secrets/pki", "Directory containing PKI files")
+	cmd.Flags().StringSliceVar(&identities, "identity", nil, "Age identity file(s) for decryption")
+	cmd.Flags().StringVar(&configFile, "config", "", "Path to trust-bundle.yaml (default: <pki-dir>/trust-bundle.yaml)")
+
+	return cmd
+}
+
+func pkiCrlCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "crl",
+		Short: "Manage the fleet's certificate revocation list",
+		Long: `Manage the CRL derived from 'pki revoke's revocation list.
+
+Commands:
+  generate - Sign a CRL covering every revoked serial and write it to the store`,
+	}
+
+	cmd.AddCommand(pkiCrlGenerateCmd())
+
+	return cmd
+}
+
+func pkiCrlGenerateCmd() *cobra.Command {
+	var (
+		pkiDir     string
+		identities []string
+		validity   time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "generate",
+		Short: "Sign a CRL from the revocation list",
+		Long: `Sign a standard X.509 CRL listing every serial recorded by
+'nixfleet pki revoke', using the intermediate CA if one exists or the
+root CA otherwise, and write it to the store (secrets/pki/crl/ca.crl).
+
+Run this after 'pki revoke' and before 'pki deploy', which pushes the
+generated CRL to hosts alongside the CA certificate.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			store := pki.NewStore(pkiDir, nil, identities)
+
+			if !store.CAExists() {
+				return fmt.Errorf("CA not initialized. Run 'nixfleet pki init' first")
+			}
+
+			crlPEM, err := store.GenerateCRL(ctx, validity)
+			if err != nil {
+				return fmt.Errorf("generating CRL: %w", err)
+			}
+			if err := store.SaveCRL(crlPEM); err != nil {
+				return fmt.Errorf("saving CRL: %w", err)
+			}
+
+			list, err := store.LoadRevocationList()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("CRL generated with %d revoked certificate(s): %s\n", len(list.Entries), store.GetCRLPath())
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().StringSliceVar(&identities, "identity", defaultIdentities(), "Age identity files (to sign with the CA key)")
+	cmd.Flags().DurationVar(&validity, "validity", 30*24*time.Hour, "How long until the CRL's next update is due")
+
+	return cmd
+}
+
+func pkiInitCmd() *cobra.Command {
+	var (
+		configFile   string
+		pkiDir       string
+		recipients   []string
+		identities   []string
+		commonName   string
+		organization string
+		validity     string
+		force        bool
+		keyBackend   string
+		pkcs11Module string
+		pkcs11Token  string
+		keyLabel     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Initialize a new Certificate Authority",
+		Long: `Create a new root CA for the fleet.
+
+This generates:
+  - A self-signed root CA certificate (public)
+  - An age-encrypted CA private key
+
+The CA certificate will be deployed to all hosts to establish trust.
+The private key is encrypted and only used to sign host certificates.
+
+You can use a config file instead of CLI flags:
+  nixfleet pki init --config secrets/pki.yaml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			_ = ctx // for future use
+
+			// Load config file if specified
+			var pkiCfg *pki.PKIConfig
+			if configFile != "" {
+				var err error
+				pkiCfg, err = pki.LoadPKIConfig(configFile)
+				if err != nil {
+					return fmt.Errorf("loading config: %w", err)
+				}
+				if err := pkiCfg.Validate(); err != nil {
+					return fmt.Errorf("invalid config: %w", err)
+				}
+
+				// Use config values as defaults (CLI flags override)
+				if pkiDir == "secrets/pki" && pkiCfg.Directory != "" {
+					pkiDir = pkiCfg.Directory
+				}
+				if len(recipients) == 0 {
+					recipients = pkiCfg.Recipients
+				}
+				if len(identities) == 0 {
+					identities = pkiCfg.Identities
+				}
+				if commonName == "NixFleet Root CA" && pkiCfg.RootCA.CommonName != "" {
+					commonName = pkiCfg.RootCA.CommonName
+				}
+				if organization == "NixFleet" && pkiCfg.RootCA.Organization != "" {
+					organization = pkiCfg.RootCA.Organization
+				}
+				if validity == "10y" && pkiCfg.RootCA.Validity != "" {
+					validity = pkiCfg.RootCA.Validity
+				}
+			}
+
+			store := pki.NewStore(pkiDir, recipients, identities)
+
+			// Check if CA already exists
+			if store.CAExists() && !force {
+				return fmt.Errorf("CA already exists at %s. Use --force to overwrite", pkiDir)
+			}
+
+			if keyBackend == "memory" && len(recipients) == 0 {
+				return fmt.Errorf("at least one --recipient is required for encrypting the CA private key")
+			}
+
+			// Parse validity using our helper
+			validityDuration, err := pki.ParseValidityDuration(validity)
+			if err != nil {
+				return fmt.Errorf("invalid validity format: %s (use e.g., 10y, 90d, 8760h)", validity)
+			}
+
+			cfg := &pki.CAConfig{
+				CommonName:   commonName,
+				Organization: organization,
+				Validity:     validityDuration,
+			}
+
+			fmt.Println("Initializing NixFleet PKI...")
+			fmt.Printf("  Common Name:  %s\n", cfg.CommonName)
+			fmt.Printf("  Organization: %s\n", cfg.Organization)
+			fmt.Printf("  Validity:     %s\n", validity)
+			fmt.Printf("  Key Backend:  %s\n", keyBackend)
+			fmt.Println()
+
+			var ca *pki.CA
+			var backendMeta *pki.KeyBackendMeta
+			switch keyBackend {
+			case "memory":
+				ca, err = pki.InitCA(cfg)
+				if err != nil {
+					return fmt.Errorf("creating CA: %w", err)
+				}
+			case "pkcs11":
+				signer, err := openPKCS11SignerForCLI(pkcs11Module, pkcs11Token, keyLabel)
+				if err != nil {
+					return err
+				}
+				ca, err = pki.InitCAWithSigner(cfg, signer)
+				if err != nil {
+					return fmt.Errorf("creating CA: %w", err)
+				}
+				backendMeta = &pki.KeyBackendMeta{Type: pki.KeyBackendPKCS11, Module: pkcs11Module, TokenLabel: pkcs11Token, KeyLabel: keyLabel}
+			default:
+				return fmt.Errorf("unknown --key-backend %q (want memory or pkcs11)", keyBackend)
+			}
+
+			// Save to disk
+			if err := store.SaveCA(ca); err != nil {
+				return fmt.Errorf("saving CA: %w", err)
+			}
+			if backendMeta != nil {
+				if err := store.SaveCAKeyBackend(backendMeta); err != nil {
+					return fmt.Errorf("saving CA key backend: %w", err)
+				}
+			}
+			if verbose {
+				fmt.Printf("  Sign latency: %s\n", ca.LastSignLatency)
+			}
+
+			fmt.Println("CA initialized successfully!")
+			fmt.Println()
+			fmt.Printf("Files created:\n")
+			fmt.Printf("  Certificate: %s/ca/root.crt (public)\n", pkiDir)
+			if backendMeta != nil {
+				fmt.Printf("  Key Backend: %s/ca/root.key-backend.json (%s token, key %q)\n", pkiDir, backendMeta.Type, backendMeta.KeyLabel)
+			} else {
+				fmt.Printf("  Private Key: %s/ca/root.key.age (encrypted)\n", pkiDir)
+			}
+			fmt.Println()
+			if pkiCfg != nil && pkiCfg.IntermediateCA != nil {
+				fmt.Println("Next steps:")
+				fmt.Println("  1. Create intermediate CA: nixfleet pki init-intermediate --config " + configFile)
+				fmt.Println("  2. Issue certificates:     nixfleet pki issue <hostname>")
+				fmt.Println("  3. Deploy to hosts:        nixfleet apply")
+			} else {
+				fmt.Println("Next steps:")
+				fmt.Println("  1. Issue certificates: nixfleet pki issue <hostname>")
+				fmt.Println("  2. Deploy to hosts:    nixfleet apply")
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&configFile, "config", "c", "", "PKI config file (e.g., secrets/pki.yaml)")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().StringSliceVarP(&recipients, "recipient", "r", nil, "Age recipients for encrypting CA key")
+	cmd.Flags().StringSliceVar(&identities, "identity", defaultIdentities(), "Age identity files for decryption")
+	cmd.Flags().StringVar(&commonName, "cn", "NixFleet Root CA", "CA common name")
+	cmd.Flags().StringVar(&organization, "org", "NixFleet", "Organization name")
+	cmd.Flags().StringVar(&validity, "validity", "10y", "CA certificate validity (e.g., 10y, 8760h)")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite existing CA")
+	cmd.Flags().StringVar(&keyBackend, "key-backend", "memory", "Where the CA private key lives: memory or pkcs11")
+	cmd.Flags().StringVar(&pkcs11Module, "pkcs11-module", "", "Path to the PKCS#11 shared library (key-backend=pkcs11)")
+	cmd.Flags().StringVar(&pkcs11Token, "pkcs11-token-label", "", "PKCS#11 token label to use (key-backend=pkcs11, default: first token found)")
+	cmd.Flags().StringVar(&keyLabel, "key-label", "nixfleet-root-ca", "PKCS#11 key label to sign with, created if missing (key-backend=pkcs11)")
+
+	return cmd
+}
+
+func pkiInitIntermediateCmd() *cobra.Command {
+	var (
+		configFile   string
+		pkiDir       string
+		recipients   []string
+		identities   []string
+		commonName   string
+		organization string
+		validity     string
+		force        bool
+		keyBackend   string
+		pkcs11Module string
+		pkcs11Token  string
+		keyLabel     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "init-intermediate",
+		Short: "Create an intermediate CA signed by the root CA",
+		Long: `Create an intermediate CA for signing host certificates.
+
+This provides better security by keeping the root CA private key offline.
+The intermediate CA:
+  - Is signed by the root CA
+  - Has a shorter validity than root (default 5 years)
+  - Can only sign end-entity certificates (not other CAs)
+
+The certificate chain (intermediate + root) is automatically included
+when issuing certificates, enabling full chain validation.
+
+Examples:
+  nixfleet pki init-intermediate --config secrets/pki.yaml
+  nixfleet pki init-intermediate -r age1...
+  nixfleet pki init-intermediate --cn "NixFleet Signing CA" --validity 3y`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			// Load config file if specified
+			if configFile != "" {
+				pkiCfg, err := pki.LoadPKIConfig(configFile)
+				if err != nil {
+					return fmt.Errorf("loading config: %w", err)
+				}
+				if err := pkiCfg.Validate(); err != nil {
+					return fmt.Errorf("invalid config: %w", err)
+				}
+
+				// Check if intermediate CA is configured
+				if pkiCfg.IntermediateCA == nil {
+					return fmt.Errorf("intermediate CA not configured in %s", configFile)
+				}
+
+				// Use config values as defaults (CLI flags override)
+				if pkiDir == "secrets/pki" && pkiCfg.Directory != "" {
+					pkiDir = pkiCfg.Directory
+				}
+				if len(recipients) == 0 {
+					recipients = pkiCfg.Recipients
+				}
+				if len(identities) == 0 {
+					identities = pkiCfg.Identities
+				}
+				if commonName == "NixFleet Intermediate CA" && pkiCfg.IntermediateCA.CommonName != "" {
+					commonName = pkiCfg.IntermediateCA.CommonName
+				}
+				if organization == "NixFleet" && pkiCfg.IntermediateCA.Organization != "" {
+					organization = pkiCfg.IntermediateCA.Organization
+				}
+				if validity == "5y" && pkiCfg.IntermediateCA.Validity != "" {
+					validity = pkiCfg.IntermediateCA.Validity
+				}
+			}
+
+			store := pki.NewStore(pkiDir, recipients, identities)
+
+			// Check if root CA exists
+			if !store.CAExists() {
+				return fmt.Errorf("root CA not initialized. Run 'nixfleet pki init' first")
+			}
+
+			// Check if intermediate already exists
+			if store.IntermediateCAExists() && !force {
+				return fmt.Errorf("intermediate CA already exists. Use --force to overwrite")
+			}
+
+			if keyBackend == "memory" && len(recipients) == 0 {
+				return fmt.Errorf("at least one --recipient is required for encrypting the intermediate CA key")
+			}
+
+			// Parse validity using our helper
+			validityDuration, err := pki.ParseValidityDuration(validity)
+			if err != nil {
+				return fmt.Errorf("invalid validity format: %s (use e.g., 5y, 90d, 8760h)", validity)
+			}
+
+			// Load root CA
+			rootCA, err := store.LoadCA(ctx)
+			if err != nil {
+				return fmt.Errorf("loading root CA: %w", err)
+			}
+
+			cfg := &pki.IntermediateCAConfig{
+				CommonName:   commonName,
+				Organization: organization,
+				Validity:     validityDuration,
+			}
+
+			fmt.Println("Creating intermediate CA...")
+			fmt.Printf("  Common Name:  %s\n", cfg.CommonName)
+			fmt.Printf("  Organization: %s\n", cfg.Organization)
+			fmt.Printf("  Validity:     %s\n", validity)
+			fmt.Printf("  Key Backend:  %s\n", keyBackend)
+			fmt.Println()
+
+			var intermediateCA *pki.IntermediateCA
+			var backendMeta *pki.KeyBackendMeta
+			switch keyBackend {
+			case "memory":
+				intermediateCA, err = rootCA.InitIntermediateCA(cfg)
+				if err != nil {
+					return fmt.Errorf("creating intermediate CA: %w", err)
+				}
+			case "pkcs11":
+				signer, err := openPKCS11SignerForCLI(pkcs11Module, pkcs11Token, keyLabel)
+				if err != nil {
+					return err
+				}
+				intermediateCA, err = rootCA.InitIntermediateCAWithSigner(cfg, signer)
+				if err != nil {
+					return fmt.Errorf("creating intermediate CA: %w", err)
+				}
+				backendMeta = &pki.KeyBackendMeta{Type: pki.KeyBackendPKCS11, Module: pkcs11Module, TokenLabel: pkcs11Token, KeyLabel: keyLabel}
+			default:
+				return fmt.Errorf("unknown --key-backend %q (want memory or pkcs11)", keyBackend)
+			}
+
+			// Save to disk
+			if err := store.SaveIntermediateCA(intermediateCA); err != nil {
+				return fmt.Errorf("saving intermediate CA: %w", err)
+			}
+			if backendMeta != nil {
+				if err := store.SaveIntermediateCAKeyBackend(backendMeta); err != nil {
+					return fmt.Errorf("saving intermediate CA key backend: %w", err)
+				}
+			}
+			if verbose {
+				fmt.Printf("  Sign latency: %s\n", intermediateCA.LastSignLatency)
+			}
+
+			fmt.Println("Intermediate CA created successfully!")
+			fmt.Println()
+			fmt.Printf("Files created:\n")
+			fmt.Printf("  Certificate: %s/ca/intermediate.crt\n", pkiDir)
+			fmt.Printf("  Chain:       %s/ca/chain.crt (intermediate + root)\n", pkiDir)
+			if backendMeta != nil {
+				fmt.Printf("  Key Backend: %s/ca/intermediate.key-backend.json (%s token, key %q)\n", pkiDir, backendMeta.Type, backendMeta.KeyLabel)
+			} else {
+				fmt.Printf("  Private Key: %s/ca/intermediate.key.age (encrypted)\n", pkiDir)
+			}
+			fmt.Println()
+			fmt.Println("Host certificates will now be signed by the intermediate CA")
+			fmt.Println("and include the full certificate chain.")
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&configFile, "config", "c", "", "PKI config file (e.g., secrets/pki.yaml)")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().StringSliceVarP(&recipients, "recipient", "r", nil, "Age recipients for encrypting intermediate CA key")
+	cmd.Flags().StringSliceVar(&identities, "identity", defaultIdentities(), "Age identity files for decryption")
+	cmd.Flags().StringVar(&commonName, "cn", "NixFleet Intermediate CA", "Intermediate CA common name")
+	cmd.Flags().StringVar(&organization, "org", "NixFleet", "Organization name")
+	cmd.Flags().StringVar(&validity, "validity", "5y", "Intermediate CA validity (e.g., 5y, 8760h)")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite existing intermediate CA")
+	cmd.Flags().StringVar(&keyBackend, "key-backend", "memory", "Where the intermediate CA private key lives: memory or pkcs11")
+	cmd.Flags().StringVar(&pkcs11Module, "pkcs11-module", "", "Path to the PKCS#11 shared library (key-backend=pkcs11)")
+	cmd.Flags().StringVar(&pkcs11Token, "pkcs11-token-label", "", "PKCS#11 token label to use (key-backend=pkcs11, default: first token found)")
+	cmd.Flags().StringVar(&keyLabel, "key-label", "nixfleet-intermediate-ca", "PKCS#11 key label to sign with, created if missing (key-backend=pkcs11)")
+
+	return cmd
+}
+
+// openPKCS11SignerForCLI resolves the token PIN (NIXFLEET_PKCS11_PIN or an
+// interactive prompt) and opens a PKCS#11-backed signer for `pki
+// init`/`init-intermediate --key-backend pkcs11`.
+func openPKCS11SignerForCLI(module, tokenLabel, keyLabel string) (crypto.Signer, error) {
+	if module == "" {
+		return nil, fmt.Errorf("--pkcs11-module is required with --key-backend pkcs11")
+	}
+	if keyLabel == "" {
+		return nil, fmt.Errorf("--key-label is required with --key-backend pkcs11")
+	}
+	pin, err := pki.ResolvePKCS11PIN(tokenLabel)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := pki.OpenPKCS11Signer(pki.PKCS11Config{
+		Module:     module,
+		TokenLabel: tokenLabel,
+		KeyLabel:   keyLabel,
+		PIN:        pin,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+func pkiIssueCmd() *cobra.Command {
+	var (
+		configFile string
+		pkiDir     string
+		recipients []string
+		identities []string
+		sans       []string
+		validity   string
+		all        bool
+		certName   string
+		shared     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "issue [hostname]",
+		Short: "Issue a certificate for a host",
+		Long: `Issue a TLS certificate for a host, signed by the fleet CA.
+
+The certificate includes:
+  - The hostname as Common Name
+  - Additional SANs (DNS names and IP addresses)
+  - Server and client auth extended key usage (for mTLS)
+
+Multiple named certificates per host are supported using --name:
+  - Default name is "host" if not specified
+  - Stored at: secrets/pki/hosts/{hostname}/{name}.crt
+
+A single certificate can also be shared across many hosts (e.g. a
+wildcard cert for a group of ingress hosts) using --shared:
+  - Stored at: secrets/pki/shared/{name}/{name}.crt
+  - Target hosts come from the "deployTo" list in --config, or --san
+    can be used to set the SANs directly
+
+With a config file, host SANs and certificate settings can be predefined.
+
+Examples:
+  nixfleet pki issue host-a
+  nixfleet pki issue host-a --name web --san host-a.example.com
+  nixfleet pki issue host-a --config secrets/pki.yaml  # Uses SANs from config
+  nixfleet pki issue --all
+  nixfleet pki issue --shared ingress-wildcard --san '*.apps.internal' --config secrets/pki.yaml`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if all || shared != "" {
+				return nil
+			}
+			if len(args) != 1 {
+				return fmt.Errorf("hostname required (or use --all/--shared)")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			// Load config file if specified
+			var pkiCfg *pki.PKIConfig
+			if configFile != "" {
+				var err error
+				pkiCfg, err = pki.LoadPKIConfig(configFile)
+				if err != nil {
+					return fmt.Errorf("loading config: %w", err)
+				}
+
+				// Use config values as defaults (CLI flags override)
+				if pkiDir == "secrets/pki" && pkiCfg.Directory != "" {
+					pkiDir = pkiCfg.Directory
+				}
+				if len(recipients) == 0 {
+					recipients = pkiCfg.Recipients
+				}
+				if len(identities) == 0 {
+					identities = pkiCfg.Identities
+				}
+				if validity == "365d" && pkiCfg.Defaults.Validity != "" {
+					validity = pkiCfg.Defaults.Validity
+				}
+			}
+
+			store := pki.NewStore(pkiDir, recipients, identities)
+
+			// Check CA exists
+			if !store.CAExists() {
+				return fmt.Errorf("CA not initialized. Run 'nixfleet pki init' first")
+			}
+
+			// Determine which CA to use for signing
+			// Prefer intermediate CA if available, otherwise use root
+			var issuer interface {
+				IssueCert(req *pki.CertRequest) (*pki.IssuedCert, error)
+			}
+			var signerName string
+
+			var maxValidity time.Duration
+			if pkiCfg != nil {
+				mv, err := pkiCfg.GetMaxValidity()
+				if err != nil {
+					return fmt.Errorf("parsing max validity policy: %w", err)
+				}
+				maxValidity = mv
+			}
+
+			if store.IntermediateCAExists() {
+				ica, err := store.LoadIntermediateCA(ctx)
+				if err != nil {
+					return fmt.Errorf("loading intermediate CA: %w", err)
+				}
+				ica.MaxCertValidity = maxValidity
+				issuer = ica
+				signerName = "intermediate CA"
+			} else {
+				ca, err := store.LoadCA(ctx)
+				if err != nil {
+					return fmt.Errorf("loading CA: %w", err)
+				}
+				ca.MaxCertValidity = maxValidity
+				issuer = ca
+				signerName = "root CA"
+			}
+
+			// Parse validity using helper
+			validityDuration, err := pki.ParseValidityDuration(validity)
+			if err != nil {
+				return fmt.Errorf("invalid validity format: %s (use e.g., 90d, 1y)", validity)
+			}
+
+			if shared != "" {
+				if len(recipients) == 0 {
+					return fmt.Errorf("at least one --recipient is required")
+				}
+
+				req := &pki.CertRequest{
+					Hostname: shared,
+					Name:     shared,
+					Validity: validityDuration,
+				}
+				if pkiCfg != nil {
+					if cfgReq, err := pkiCfg.GetSharedCertRequest(shared); err == nil {
+						req = cfgReq
+					}
+				}
+				if len(sans) > 0 {
+					req.SANs = append(req.SANs, sans...)
+				}
+
+				cert, err := issuer.IssueCert(req)
+				if err != nil {
+					return fmt.Errorf("issuing shared certificate: %w", err)
+				}
+				if err := store.SaveSharedCert(shared, cert); err != nil {
+					return fmt.Errorf("saving shared certificate: %w", err)
+				}
+
+				fmt.Printf("Shared certificate %q issued using %s (expires %s)\n", shared, signerName, cert.NotAfter.Format("2006-01-02"))
+				if pkiCfg != nil && pkiCfg.Shared[shared] != nil && len(pkiCfg.Shared[shared].DeployTo) > 0 {
+					fmt.Printf("Deploy targets: %s\n", strings.Join(pkiCfg.Shared[shared].DeployTo, ", "))
+				}
+				fmt.Println("Deploy with: nixfleet pki deploy --config <config>")
+				return nil
+			}
+
+			// Determine hosts to issue certs for
+			var hostnames []string
+			if all {
+				_, hosts, err := loadInventoryAndHosts(ctx)
+				if err != nil {
+					return err
+				}
+				for _, h := range hosts {
+					hostnames = append(hostnames, h.Name)
+				}
+			} else {
+				hostnames = []string{args[0]}
+			}
+
+			if len(recipients) == 0 {
+				return fmt.Errorf("at least one --recipient is required")
+			}
+
+			fmt.Printf("Issuing certificates for %d host(s) using %s...\n\n", len(hostnames), signerName)
+
+			for _, hostname := range hostnames {
+				// Build request, merging config and CLI flags
+				var req *pki.CertRequest
+
+				// Try to get config-defined request first
+				if pkiCfg != nil {
+					var err error
+					req, err = pkiCfg.GetHostCertRequest(hostname, certName)
+					if err != nil {
+						req = nil // Fall back to manual construction
+					}
+				}
+
+				// If no config or config failed, build manually
+				if req == nil {
+					req = &pki.CertRequest{
+						Hostname: hostname,
+						Name:     certName,
+						Validity: validityDuration,
+					}
+				}
+
+				// CLI sans always override/append
+				if len(sans) > 0 {
+					req.SANs = append(req.SANs, sans...)
+				}
+
+				cert, err := issuer.IssueCert(req)
+				if err != nil {
+					fmt.Printf("  %s: FAILED - %v\n", hostname, err)
+					continue
+				}
+
+				if err := store.SaveHostCert(cert); err != nil {
+					fmt.Printf("  %s: FAILED to save - %v\n", hostname, err)
+					continue
+				}
+
+				certLabel := hostname
+				if certName != "" && certName != "host" {
+					certLabel = fmt.Sprintf("%s/%s", hostname, certName)
+				}
+				fmt.Printf("  %s: OK (expires %s)\n", certLabel, cert.NotAfter.Format("2006-01-02"))
+			}
+
+			fmt.Println()
+			fmt.Println("Certificates issued. Deploy with: nixfleet apply")
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&configFile, "config", "c", "", "PKI config file (e.g., secrets/pki.yaml)")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().StringSliceVarP(&recipients, "recipient", "r", nil, "Age recipients for encrypting host keys")
+	cmd.Flags().StringSliceVar(&identities, "identity", defaultIdentities(), "Age identity files for decryption")
+	cmd.Flags().StringSliceVar(&sans, "san", nil, "Subject Alternative Names (DNS names or IPs)")
+	cmd.Flags().StringVar(&validity, "validity", "365d", "Certificate validity (e.g., 365d, 1y)")
+	cmd.Flags().BoolVar(&all, "all", false, "Issue certificates for all hosts in inventory")
+	cmd.Flags().StringVar(&certName, "name", "", "Certificate name (default: host). Use for multiple certs per host")
+	cmd.Flags().StringVar(&shared, "shared", "", "Issue a shared certificate (deployed to multiple hosts) with this name instead of a per-host cert")
+
+	return cmd
+}
+
+func pkiStatusCmd() *cobra.Command {
+	var (
+		pkiDir     string
+		identities []string
+		configFile string
+		live       bool
+		destDir    string
+		fleet      bool
+		bundle     bool
+		output     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show certificate status for fleet hosts",
+		Long: `Display certificate status for all hosts in the fleet.
+
+Shows:
+  - Certificate names (host, web, api, etc.)
+  - Certificate expiration dates
+  - Days remaining until expiry
+  - Status (valid, expiring, expired, or revoked - see 'pki revoke')
+  - Subject Alternative Names
+  - Whether the certificate is push-managed or renewed by the on-host agent
+  - The key's age, separately from the certificate's - a reuseKey renewal
+    (see 'pki renew --reuse-key') keeps reissuing the cert for the same
+    key, so an old key behind a recently-renewed cert is flagged with a
+    warning once it passes a year old
+
+With --live, connects to each host to report its self-renewal agent's last
+renewal time (see 'pki install-agent'), rather than relying on when this
+machine last ran 'pki deploy'.
+
+With --fleet, also connects to each host in the inventory and reports its
+most recent 'pki scan' findings - certs discovered on disk that aren't
+cleanly fleet-managed, so a foreign or orphaned cert doesn't sit unnoticed
+on a host that never shows up in the table above.
+
+With --bundle, connects to each host in the inventory and compares the
+trust bundle hash it last recorded (see 'pki deploy') against the hash of
+the bundle currently built locally (see 'pki bundle build'), flagging
+hosts that are missing the bundle entirely or running a stale one.
+
+With --output json, prints one JSON object per row (stable field names:
+hostname, certName, serial, notAfter, daysLeft, status, sans, profile,
+algorithm, keyAgeDays, error) instead of the table, and the process exits
+9 if any cert is expired, 8 if any is merely expiring, 1 if any entry
+couldn't be read - so a cron wrapper can act on the exit code alone.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid --output %q (want table or json)", output)
+			}
+			asJSON := output == "json"
+
+			store := pki.NewStore(pkiDir, nil, identities)
+
+			// Check CA exists
+			if !store.CAExists() {
+				return fmt.Errorf("CA not initialized. Run 'nixfleet pki init' first")
+			}
+
+			revoked, err := store.LoadRevocationList()
+			if err != nil {
+				return fmt.Errorf("loading revocation list: %w", err)
+			}
+
+			// List host certs
+			hosts, err := store.ListHostCerts()
+			if err != nil {
+				return fmt.Errorf("listing certificates: %w", err)
+			}
+
+			if len(hosts) == 0 && !asJSON {
+				fmt.Println("No host certificates found.")
+				fmt.Println("Issue certificates with: nixfleet pki issue <hostname>")
+			}
+
+			var liveAgents map[string]*state.PKIAgentState
+			if live {
+				liveAgents, err = gatherLivePKIAgentInfo(ctx, hosts, destDir)
+				if err != nil {
+					return err
+				}
+			}
+
+			if len(hosts) > 0 && !asJSON {
+				fmt.Printf("%-25s %-12s %-10s %-12s %-9s %-10s %s\n", "HOST/CERT", "EXPIRES", "DAYS LEFT", "STATUS", "MANAGED", "KEY AGE", "SANs")
+				fmt.Println(strings.Repeat("-", 110))
+			}
+
+			var rows []pkiCertJSON
+
+			for _, hostname := range hosts {
+				// List all named certs for this host
+				certNames, err := store.ListHostNamedCerts(hostname)
+				if err != nil {
+					rows = append(rows, pkiCertJSON{Hostname: hostname, Error: err.Error()})
+					if !asJSON {
+						fmt.Printf("%-25s %-12s %-10s %-12s %s\n", hostname, "ERROR", "-", "error", err.Error())
+					}
+					continue
+				}
+
+				for i, certName := range certNames {
+					info, err := store.GetNamedCertInfo(hostname, certName)
+					if err != nil {
+						rows = append(rows, pkiCertJSON{Hostname: hostname, CertName: certName, Error: err.Error()})
+						if !asJSON {
+							label := fmt.Sprintf("%s/%s", hostname, certName)
+							fmt.Printf("%-25s %-12s %-10s %-12s %s\n", label, "ERROR", "-", "error", err.Error())
+						}
+						continue
+					}
+
+					if _, isRevoked := revoked.IsRevoked(info.Serial); isRevoked {
+						info.Status = "revoked"
+					}
+
+					managed := "push"
+					if info.AgentManaged {
+						managed = "agent"
+					}
+					if agent, ok := liveAgents[hostname]; ok && certName == "host" && agent.Managed {
+						managed = "agent"
+					}
+
+					rows = append(rows, pkiCertJSON{
+						Hostname:   hostname,
+						CertName:   certName,
+						Serial:     info.Serial,
+						NotAfter:   info.NotAfter.Format(time.RFC3339),
+						DaysLeft:   info.DaysLeft,
+						Status:     info.Status,
+						SANs:       info.SANs,
+						Profile:    managed,
+						Algorithm:  info.Algorithm,
+						KeyAgeDays: info.KeyAgeDays,
+					})
+
+					if asJSON {
+						continue
+					}
+
+					// Format status with color indicators
+					var statusIcon string
+					switch info.Status {
+					case "valid":
+						statusIcon = "✓ valid"
+					case "expiring":
+						statusIcon = "⚠ expiring"
+					case "expired":
+						statusIcon = "✗ expired"
+					case "revoked":
+						statusIcon = "⛔ revoked"
+					}
+
+					sansStr := strings.Join(info.SANs, ", ")
+					if len(sansStr) > 25 {
+						sansStr = sansStr[:22] + "..."
+					}
+
+					// Format host/cert label
+					var label string
+					if len(certNames) == 1 && certName == "host" {
+						label = hostname
+					} else if i == 0 {
+						label = fmt.Sprintf("%s/%s", hostname, certName)
+					} else {
+						label = fmt.Sprintf("  └─ %s", certName)
+					}
+
+					displayManaged := managed
+					if agent, ok := liveAgents[hostname]; ok && certName == "host" && agent.Managed && !agent.LastRenewal.IsZero() {
+						displayManaged = fmt.Sprintf("agent (%s)", agent.LastRenewal.Format("2006-01-02"))
+					}
+
+					keyAge := fmt.Sprintf("%dd", info.KeyAgeDays)
+					if info.KeyAgeDays > 365 {
+						keyAge += " ⚠"
+					}
+
+					fmt.Printf("%-25s %-12s %-10d %-12s %-9s %-10s %s\n",
+						label,
+						info.NotAfter.Format("2006-01-02"),
+						info.DaysLeft,
+						statusIcon,
+						displayManaged,
+						keyAge,
+						sansStr,
+					)
+				}
+			}
+
+			// List shared certs, showing their deploy targets from config if available
+			sharedNames, err := store.ListSharedCerts()
+			if err != nil {
+				return fmt.Errorf("listing shared certificates: %w", err)
+			}
+			if len(sharedNames) > 0 {
+				var pkiCfg *pki.PKIConfig
+				if configFile != "" {
+					pkiCfg, _ = pki.LoadPKIConfig(configFile)
+				}
+
+				if !asJSON {
+					fmt.Println()
+					fmt.Println("Shared certificates:")
+					fmt.Printf("%-25s %-12s %-10s %-12s %s\n", "NAME", "EXPIRES", "DAYS LEFT", "STATUS", "TARGETS")
+					fmt.Println(strings.Repeat("-", 90))
+				}
+				for _, name := range sharedNames {
+					info, err := store.GetSharedCertInfo(name)
+					if err != nil {
+						rows = append(rows, pkiCertJSON{CertName: name, Error: err.Error()})
+						if !asJSON {
+							fmt.Printf("%-25s %-12s %-10s %-12s %s\n", name, "ERROR", "-", "error", err.Error())
+						}
+						continue
+					}
+
+					if _, isRevoked := revoked.IsRevoked(info.Serial); isRevoked {
+						info.Status = "revoked"
+					}
+
+					rows = append(rows, pkiCertJSON{
+						CertName:  name,
+						Serial:    info.Serial,
+						NotAfter:  info.NotAfter.Format(time.RFC3339),
+						DaysLeft:  info.DaysLeft,
+						Status:    info.Status,
+						SANs:      info.SANs,
+						Algorithm: info.Algorithm,
+					})
+
+					if asJSON {
+						continue
+					}
+
+					var statusIcon string
+					switch info.Status {
+					case "valid":
+						statusIcon = "✓ valid"
+					case "expiring":
+						statusIcon = "⚠ expiring"
+					case "expired":
+						statusIcon = "✗ expired"
+					case "revoked":
+						statusIcon = "⛔ revoked"
+					}
+
+					targets := "-"
+					if pkiCfg != nil && pkiCfg.Shared[name] != nil && len(pkiCfg.Shared[name].DeployTo) > 0 {
+						targets = strings.Join(pkiCfg.Shared[name].DeployTo, ", ")
+					}
+
+					fmt.Printf("%-25s %-12s %-10d %-12s %s\n",
+						name, info.NotAfter.Format("2006-01-02"), info.DaysLeft, statusIcon, targets)
+				}
+			}
+
+			if fleet {
+				findings, err := gatherFleetPKIScanFindings(ctx)
+				if err != nil {
+					return err
+				}
+
+				if asJSON {
+					for _, f := range findings {
+						rows = append(rows, pkiCertJSON{
+							Hostname: f.host,
+							CertName: f.finding.Path,
+							NotAfter: f.finding.NotAfter.Format(time.RFC3339),
+							DaysLeft: f.finding.DaysLeft,
+							Status:   f.finding.Classification,
+						})
+					}
+				} else {
+					fmt.Println()
+					fmt.Println("Fleet-wide certificate scan findings (see 'pki scan'):")
+					if len(findings) == 0 {
+						fmt.Println("  none - run 'nixfleet pki scan --group all' if this hasn't been scanned yet")
+					} else {
+						fmt.Printf("%-15s %-25s %-12s %-10s %-12s %s\n", "HOST", "PATH", "EXPIRES", "DAYS LEFT", "CLASS", "DETAIL")
+						fmt.Println(strings.Repeat("-", 110))
+						for _, f := range findings {
+							fmt.Printf("%-15s %-25s %-12s %-10d %-12s %s\n",
+								f.host, f.finding.Path, f.finding.NotAfter.Format("2006-01-02"),
+								f.finding.DaysLeft, strings.ToUpper(f.finding.Classification), f.finding.Detail)
+						}
+					}
+				}
+			}
+
+			if bundle {
+				var localHash string
+				if manifest, err := store.LoadBundleManifest(); err == nil {
+					localHash = manifest.Hash
+				}
+
+				statuses, err := gatherFleetPKIBundleStatus(ctx)
+				if err != nil {
+					return err
+				}
+
+				if asJSON {
+					for _, s := range statuses {
+						status := "missing"
+						if s.hash != "" {
+							status = "stale"
+							if localHash != "" && s.hash == localHash {
+								status = "current"
+							}
+						}
+						rows = append(rows, pkiCertJSON{Hostname: s.host, Status: status})
+					}
+				} else {
+					fmt.Println()
+					fmt.Println("Fleet trust bundle status (see 'pki bundle build', 'pki deploy'):")
+					if localHash == "" {
+						fmt.Println("  no local bundle built yet - run 'nixfleet pki bundle build'")
+					}
+					fmt.Printf("%-15s %-10s %s\n", "HOST", "STATUS", "DEPLOYED HASH")
+					fmt.Println(strings.Repeat("-", 50))
+					for _, s := range statuses {
+						status := "missing"
+						if s.hash != "" {
+							status = "stale"
+							if localHash != "" && s.hash == localHash {
+								status = "current"
+							}
+						}
+						hashDisplay := "-"
+						if s.hash != "" {
+							hashDisplay = s.hash[:12]
+						}
+						fmt.Printf("%-15s %-10s %s\n", s.host, status, hashDisplay)
+					}
+				}
+			}
+
+			if asJSON {
+				data, err := json.MarshalIndent(rows, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+			}
+
+			return pkiExitError(rows)
+		},
+	}
+
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().StringSliceVar(&identities, "identity", defaultIdentities(), "Age identity files (for CA info)")
+	cmd.Flags().StringVarP(&configFile, "config", "c", "", "PKI config file (to resolve shared certificate deploy targets)")
+	cmd.Flags().BoolVar(&live, "live", false, "Connect to hosts to report the on-host renewal agent's last renewal time")
+	cmd.Flags().StringVar(&destDir, "dest-dir", "/etc/nixfleet/pki", "Directory on hosts containing the renewal agent's marker file (with --live)")
+	cmd.Flags().BoolVar(&fleet, "fleet", false, "Aggregate 'pki scan' findings across every host in the inventory")
+	cmd.Flags().BoolVar(&bundle, "bundle", false, "Report trust bundle drift across every host in the inventory")
+	cmd.Flags().StringVar(&output, "output", "table", "Output format: table or json")
+
+	return cmd
+}
+
+// fleetPKIBundleStatus pairs a host with the trust bundle hash it last
+// recorded via 'pki deploy', for gatherFleetPKIBundleStatus's output. An
+// empty hash means the host has no bundle deployed at all, as distinct from
+// one deployed but now stale relative to the local build.
+type fleetPKIBundleStatus struct {
+	host string
+	hash string
+}
+
+// gatherFleetPKIBundleStatus connects to every host in the inventory and
+// reads back the trust bundle hash it last recorded. Hosts it can't reach
+// are simply omitted rather than failing the whole status report.
+func gatherFleetPKIBundleStatus(ctx context.Context) ([]fleetPKIBundleStatus, error) {
+	inv, hosts, err := loadInventoryAndHosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := ssh.NewPool(nil)
+	_, _ = pool.EnableSSHConfig(inv)
+	defer pool.Close()
+	mgr := state.NewManager()
+
+	var statuses []fleetPKIBundleStatus
+	for _, host := range hosts {
+		client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+		if err != nil {
+			continue
+		}
+
+		hostState, err := mgr.ReadState(ctx, client)
+		if err != nil {
+			continue
+		}
+
+		hash := ""
+		if hostState.PKIBundle != nil {
+			hash = hostState.PKIBundle.Hash
+		}
+		statuses = append(statuses, fleetPKIBundleStatus{host: host.Name, hash: hash})
+	}
+
+	return statuses, nil
+}
+
+// fleetPKIScanFinding pairs a state.PKIScanFinding with the host it was
+// found on, for gatherFleetPKIScanFindings' flattened, sorted output.
+type fleetPKIScanFinding struct {
+	host    string
+	finding state.PKIScanFinding
+}
+
+// gatherFleetPKIScanFindings connects to every host in the inventory and
+// reads back its most recently recorded 'pki scan' findings, flattened
+// into a single list sorted soonest-to-expire first. Hosts it can't reach,
+// or that have never been scanned, are simply omitted.
+func gatherFleetPKIScanFindings(ctx context.Context) ([]fleetPKIScanFinding, error) {
+	inv, hosts, err := loadInventoryAndHosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := ssh.NewPool(nil)
+	_, _ = pool.EnableSSHConfig(inv)
+	defer pool.Close()
+	mgr := state.NewManager()
+
+	var findings []fleetPKIScanFinding
+	for _, host := range hosts {
+		client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+		if err != nil {
+			continue
+		}
+
+		hostState, err := mgr.ReadState(ctx, client)
+		if err != nil || hostState.PKIScan == nil {
+			continue
+		}
+
+		for _, f := range hostState.PKIScan.Findings {
+			findings = append(findings, fleetPKIScanFinding{host: host.Name, finding: f})
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].finding.NotAfter.Before(findings[j].finding.NotAfter)
+	})
+
+	return findings, nil
+}
+
+// gatherLivePKIAgentInfo connects to each host and reads its self-renewal
+// agent's status, keyed by hostname. Hosts it can't reach are simply
+// omitted rather than failing the whole status report.
+func gatherLivePKIAgentInfo(ctx context.Context, hostnames []string, destDir string) (map[string]*state.PKIAgentState, error) {
+	inv, _, err := loadInventoryAndHosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := ssh.NewPool(nil)
+	_, _ = pool.EnableSSHConfig(inv)
+	defer pool.Close()
+	mgr := state.NewManager()
+
+	result := make(map[string]*state.PKIAgentState, len(hostnames))
+	for _, hostname := range hostnames {
+		host, ok := inv.GetHost(hostname)
+		if !ok {
+			continue
+		}
+
+		client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+		if err != nil {
+			continue
+		}
+
+		agentInfo, err := mgr.GatherPKIAgentInfo(ctx, client, destDir)
+		if err != nil {
+			continue
+		}
+		result[hostname] = agentInfo
+	}
+
+	return result, nil
+}
+
+func pkiExportCmd() *cobra.Command {
+	var pkiDir string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export CA certificate",
+		Long: `Export the CA certificate in PEM format.
+
+This can be used to add the fleet CA to external trust stores
+or configure applications to trust fleet certificates.
+
+Example:
+  nixfleet pki export > fleet-ca.crt
+  sudo cp fleet-ca.crt /usr/local/share/ca-certificates/
+  sudo update-ca-certificates`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store := pki.NewStore(pkiDir, nil, nil)
+
+			if !store.CAExists() {
+				return fmt.Errorf("CA not initialized. Run 'nixfleet pki init' first")
+			}
+
+			caCertPath := store.GetCACertPath()
+			certPEM, err := os.ReadFile(caCertPath)
+			if err != nil {
+				return fmt.Errorf("reading CA certificate: %w", err)
+			}
+
+			fmt.Print(string(certPEM))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+
+	return cmd
+}
+
+func pkiTrustCmd() *cobra.Command {
+	var pkiDir string
+
+	cmd := &cobra.Command{
+		Use:   "trust",
+		Short: "Add CA certificate to local trust store",
+		Long: `Add the fleet CA certificate to your local machine's trust store.
+
+This command detects your operating system and installs the CA certificate
+to the appropriate system trust store:
+
+  macOS:  System Keychain via 'security' command
+  Linux:  /usr/local/share/ca-certificates/ + update-ca-certificates (Debian/Ubuntu)
+          /etc/pki/ca-trust/source/anchors/ + update-ca-trust (RHEL/Fedora)
+
+After running this command, applications on your machine will trust
+certificates signed by the fleet CA.
+
+Examples:
+  nixfleet pki trust
+  nixfleet pki trust --pki-dir /path/to/pki`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store := pki.NewStore(pkiDir, nil, nil)
+
+			if !store.CAExists() {
+				return fmt.Errorf("CA not initialized. Run 'nixfleet pki init' first")
+			}
+
+			caCertPath := store.GetCACertPath()
+			certPEM, err := os.ReadFile(caCertPath)
+			if err != nil {
+				return fmt.Errorf("reading CA certificate: %w", err)
+			}
+
+			// Create temp file for the certificate
+			tmpFile, err := os.CreateTemp("", "fleet-ca-*.crt")
+			if err != nil {
+				return fmt.Errorf("creating temp file: %w", err)
+			}
+			defer os.Remove(tmpFile.Name())
+
+			if _, err := tmpFile.Write(certPEM); err != nil {
+				return fmt.Errorf("writing temp file: %w", err)
+			}
+			tmpFile.Close()
+
+			// Detect OS and install appropriately
+			switch runtime.GOOS {
+			case "darwin":
+				fmt.Println("Installing CA certificate to macOS System Keychain...")
+				installCmd := exec.Command("sudo", "security", "add-trusted-cert",
+					"-d", "-r", "trustRoot",
+					"-k", "/Library/Keychains/System.keychain",
+					tmpFile.Name())
+				installCmd.Stdout = os.Stdout
+				installCmd.Stderr = os.Stderr
+				installCmd.Stdin = os.Stdin
+				if err := installCmd.Run(); err != nil {
+					return fmt.Errorf("adding certificate to keychain: %w", err)
+				}
+				fmt.Println("CA certificate installed to System Keychain")
+
+			case "linux":
+				// Try Debian/Ubuntu style first
+				debianPath := "/usr/local/share/ca-certificates/fleet-ca.crt"
+				if _, err := os.Stat("/usr/local/share/ca-certificates"); err == nil {
+					fmt.Println("Installing CA certificate (Debian/Ubuntu style)...")
+					copyCmd := exec.Command("sudo", "cp", tmpFile.Name(), debianPath)
+					if err := copyCmd.Run(); err != nil {
+						return fmt.Errorf("copying certificate: %w", err)
+					}
+					updateCmd := exec.Command("sudo", "update-ca-certificates")
+					updateCmd.Stdout = os.Stdout
+					updateCmd.Stderr = os.Stderr
+					if err := updateCmd.Run(); err != nil {
+						return fmt.Errorf("updating CA certificates: %w", err)
+					}
+					fmt.Printf("CA certificate installed to %s\n", debianPath)
+				} else {
+					// Try RHEL/Fedora style
+					rhelPath := "/etc/pki/ca-trust/source/anchors/fleet-ca.crt"
+					if _, err := os.Stat("/etc/pki/ca-trust/source/anchors"); err == nil {
+						fmt.Println("Installing CA certificate (RHEL/Fedora style)...")
+						copyCmd := exec.Command("sudo", "cp", tmpFile.Name(), rhelPath)
+						if err := copyCmd.Run(); err != nil {
+							return fmt.Errorf("copying certificate: %w", err)
+						}
+						updateCmd := exec.Command("sudo", "update-ca-trust")
+						updateCmd.Stdout = os.Stdout
+						updateCmd.Stderr = os.Stderr
+						if err := updateCmd.Run(); err != nil {
+							return fmt.Errorf("updating CA trust: %w", err)
+						}
+						fmt.Printf("CA certificate installed to %s\n", rhelPath)
+					} else {
+						return fmt.Errorf("could not detect Linux CA trust store location")
+					}
+				}
+
+			default:
+				return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+			}
+
+			fmt.Println("\nFleet CA is now trusted by your system.")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+
+	return cmd
+}
+
+func pkiDeployCmd() *cobra.Command {
+	var (
+		pkiDir      string
+		identities  []string
+		destDir     string
+		trustSystem bool
+		caOnly      bool
+		configFile  string
+		skipReload  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "deploy",
+		Short: "Deploy certificates to fleet hosts",
+		Long: `Deploy CA and host certificates to fleet hosts via SSH.
+
+This command:
+  - Deploys the CA certificate to all hosts
+  - Deploys host-specific certificates and private keys
+  - Optionally adds CA to system trust store
+
+The host private keys are decrypted using age and deployed securely.
+
+If the PKI config (--config) declares reloadUnits for a host or shared
+certificate, the named systemd units are reloaded (not restarted) after
+deploy, but only when the certificate content actually changed on the
+host. Units named by multiple certificates on the same host are only
+reloaded once. A reload failure is reported as a warning rather than
+failing the host. --skip-reload bypasses this entirely, e.g. for a
+maintenance window.
+
+Examples:
+  nixfleet pki deploy --identity ~/.config/age/key.txt
+  nixfleet pki deploy --ca-only      # Only deploy CA cert
+  nixfleet pki deploy -H myhost      # Deploy to specific host
+  nixfleet pki deploy --skip-reload  # Push certs without reloading services`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := ssh.WithOperation(cmd.Context(), "pki deploy")
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			store := pki.NewStore(pkiDir, nil, identities)
+
+			if !store.CAExists() {
+				return fmt.Errorf("CA not initialized. Run 'nixfleet pki init' first")
+			}
+
+			var pkiCfg *pki.PKIConfig
+			if configFile != "" {
+				pkiCfg, err = pki.LoadPKIConfig(configFile)
+				if err != nil {
+					return fmt.Errorf("loading config: %w", err)
+				}
+			}
+
+			// Read CA certificate
+			caCertPath := store.GetCACertPath()
+			caCertPEM, err := os.ReadFile(caCertPath)
+			if err != nil {
+				return fmt.Errorf("reading CA certificate: %w", err)
+			}
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			stateMgr := state.NewManager()
+			deployer := pki.NewDeployer(&pki.DeployConfig{PKIDir: pkiDir, DestDir: destDir, Identities: identities})
+
+			var bundle []byte
+			var bundleManifest *pki.BundleManifest
+			if store.BundleExists() {
+				bundle, err = os.ReadFile(store.GetBundlePath())
+				if err != nil {
+					return fmt.Errorf("reading trust bundle: %w", err)
+				}
+				bundleManifest, err = store.LoadBundleManifest()
+				if err != nil {
+					return fmt.Errorf("loading trust bundle manifest: %w", err)
+				}
+			}
+
+			fmt.Printf("Deploying PKI to %d host(s)...\n\n", len(hosts))
+
+			successCount := 0
+			failedCount := 0
+
+			for _, host := range hosts {
+				fmt.Printf("%s:\n", host.Name)
+
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("  Connection failed: %v\n", err)
+					failedCount++
+					continue
+				}
+
+				// Create PKI directory
+				mkdirCmd := fmt.Sprintf("sudo mkdir -p %s && sudo chmod 755 %s", destDir, destDir)
+				if _, err := client.Exec(ctx, mkdirCmd); err != nil {
+					fmt.Printf("  Failed to create directory: %v\n", err)
+					failedCount++
+					continue
+				}
+
+				// Deploy CA certificate
+				caCertDest := destDir + "/ca.crt"
+				if err := deployFileContent(ctx, client, caCertPEM, caCertDest, "0644"); err != nil {
+					fmt.Printf("  Failed to deploy CA cert: %v\n", err)
+					failedCount++
+					continue
+				}
+				fmt.Printf("  CA cert: %s\n", caCertDest)
+
+				// Update system trust store if requested
+				if trustSystem {
+					updateCmd := ""
+					switch host.Base {
+					case "ubuntu":
+						updateCmd = fmt.Sprintf("sudo cp %s /usr/local/share/ca-certificates/nixfleet-ca.crt && sudo update-ca-certificates", caCertDest)
+					case "nixos", "darwin":
+						// NixOS/darwin handle this differently via configuration
+						updateCmd = ""
+					}
+					if updateCmd != "" {
+						if _, err := client.Exec(ctx, updateCmd); err != nil {
+							fmt.Printf("  Warning: failed to update system trust: %v\n", err)
+						} else {
+							fmt.Printf("  System trust updated\n")
+						}
+					}
+				}
+
+				// Deploy the fleet-wide trust bundle, if one has been built
+				if bundle != nil {
+					if err := deployer.DeployBundle(ctx, client, host, bundle, bundleManifest); err != nil {
+						fmt.Printf("  Warning: trust bundle deploy failed: %v\n", err)
+					} else {
+						if err := stateMgr.UpdatePKIBundleState(ctx, client, bundleManifest.Hash); err != nil {
+							fmt.Printf("  Warning: failed to record trust bundle state: %v\n", err)
+						}
+						fmt.Printf("  Trust bundle: %s (%d certs)\n", bundleManifest.Hash[:12], len(bundleManifest.Certs))
+					}
+				}
+
+				// Deploy host certificate and key (unless CA-only mode)
+				if !caOnly {
+					if store.HostCertExists(host.Name) {
+						hostCert, err := store.LoadHostCert(ctx, host.Name)
+						if err != nil {
+							fmt.Printf("  Failed to load host cert: %v\n", err)
+						} else {
+							// Deploy host certificate
+							hostCertDest := destDir + "/host.crt"
+							certChanged := true
+							if !skipReload {
+								if changed, err := deployer.CertContentChanged(ctx, client, hostCertDest, hostCert.CertPEM); err == nil {
+									certChanged = changed
+								}
+							}
+							if err := deployFileContent(ctx, client, hostCert.CertPEM, hostCertDest, "0644"); err != nil {
+								fmt.Printf("  Failed to deploy host cert: %v\n", err)
+							} else {
+								fmt.Printf("  Host cert: %s\n", hostCertDest)
+							}
+
+							// Deploy host key (restricted permissions)
+							hostKeyDest := destDir + "/host.key"
+							if err := deployFileContent(ctx, client, hostCert.KeyPEM, hostKeyDest, "0600"); err != nil {
+								fmt.Printf("  Failed to deploy host key: %v\n", err)
+							} else {
+								fmt.Printf("  Host key: %s\n", hostKeyDest)
+							}
 
-			if len(recipients) == 0 {
-				return fmt.Errorf("at least one --recipient is required for encrypting the intermediate CA key")
-			}
+							if !skipReload && certChanged && pkiCfg != nil {
+								if units := pkiCfg.GetHostReloadUnits(host.Name); len(units) > 0 {
+									for _, r := range deployer.ReloadUnits(ctx, client, units) {
+										if r.Success {
+											fmt.Printf("  Reloaded %s\n", r.Unit)
+										} else {
+											fmt.Printf("  Warning: reload of %s failed: %s\n", r.Unit, r.Output)
+										}
+									}
+								}
+							}
+						}
+					} else {
+						fmt.Printf("  No host certificate found (run 'nixfleet pki issue %s')\n", host.Name)
+					}
+				}
 
-			// Parse validity using our helper
-			validityDuration, err := pki.ParseValidityDuration(validity)
-			if err != nil {
-				return fmt.Errorf("invalid validity format: %s (use e.g., 5y, 90d, 8760h)", validity)
+				fmt.Println()
+				successCount++
 			}
 
-			// Load root CA
-			rootCA, err := store.LoadCA(ctx)
-			if err != nil {
-				return fmt.Errorf("loading root CA: %w", err)
-			}
+			// Deploy shared certs (config-defined "deployTo" host lists) unless CA-only
+			if !caOnly && pkiCfg != nil && len(pkiCfg.Shared) > 0 {
+				hostsByName := make(map[string]*inventory.Host, len(hosts))
+				for _, h := range hosts {
+					hostsByName[h.Name] = h
+				}
 
-			cfg := &pki.IntermediateCAConfig{
-				CommonName:   commonName,
-				Organization: organization,
-				Validity:     validityDuration,
-			}
+				for name, shared := range pkiCfg.Shared {
+					if !store.SharedCertExists(name) {
+						fmt.Printf("shared/%s: no certificate issued (run 'nixfleet pki issue --shared %s --config %s')\n", name, name, configFile)
+						continue
+					}
+					sharedCert, err := store.LoadSharedCert(ctx, name)
+					if err != nil {
+						fmt.Printf("shared/%s: failed to load - %v\n", name, err)
+						failedCount++
+						continue
+					}
 
-			fmt.Println("Creating intermediate CA...")
-			fmt.Printf("  Common Name:  %s\n", cfg.CommonName)
-			fmt.Printf("  Organization: %s\n", cfg.Organization)
-			fmt.Printf("  Validity:     %s\n", validity)
-			fmt.Println()
+					fmt.Printf("shared/%s -> %s:\n", name, strings.Join(shared.DeployTo, ", "))
+					for _, targetName := range shared.DeployTo {
+						host, ok := hostsByName[targetName]
+						if !ok {
+							fmt.Printf("  %s: not found in inventory, skipping\n", targetName)
+							continue
+						}
 
-			// Create intermediate CA
-			intermediateCA, err := rootCA.InitIntermediateCA(cfg)
-			if err != nil {
-				return fmt.Errorf("creating intermediate CA: %w", err)
-			}
+						client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+						if err != nil {
+							fmt.Printf("  %s: connection failed: %v\n", targetName, err)
+							failedCount++
+							continue
+						}
 
-			// Save to disk
-			if err := store.SaveIntermediateCA(intermediateCA); err != nil {
-				return fmt.Errorf("saving intermediate CA: %w", err)
+						certDest := fmt.Sprintf("%s/shared/%s.crt", destDir, name)
+						keyDest := fmt.Sprintf("%s/shared/%s.key", destDir, name)
+						if _, err := client.Exec(ctx, fmt.Sprintf("sudo mkdir -p %s/shared", destDir)); err != nil {
+							fmt.Printf("  %s: failed to create directory: %v\n", targetName, err)
+							failedCount++
+							continue
+						}
+						certChanged := true
+						if !skipReload {
+							if changed, err := deployer.CertContentChanged(ctx, client, certDest, sharedCert.CertPEM); err == nil {
+								certChanged = changed
+							}
+						}
+						if err := deployFileContent(ctx, client, sharedCert.CertPEM, certDest, "0644"); err != nil {
+							fmt.Printf("  %s: failed to deploy shared cert: %v\n", targetName, err)
+							failedCount++
+							continue
+						}
+						if err := deployFileContent(ctx, client, sharedCert.KeyPEM, keyDest, "0600"); err != nil {
+							fmt.Printf("  %s: failed to deploy shared key: %v\n", targetName, err)
+							failedCount++
+							continue
+						}
+						fmt.Printf("  %s: OK (%s)\n", targetName, certDest)
+						if !skipReload && certChanged {
+							if units := pkiCfg.GetSharedReloadUnits(name); len(units) > 0 {
+								for _, r := range deployer.ReloadUnits(ctx, client, units) {
+									if r.Success {
+										fmt.Printf("  %s: reloaded %s\n", targetName, r.Unit)
+									} else {
+										fmt.Printf("  %s: warning: reload of %s failed: %s\n", targetName, r.Unit, r.Output)
+									}
+								}
+							}
+						}
+						successCount++
+					}
+				}
 			}
 
-			fmt.Println("Intermediate CA created successfully!")
-			fmt.Println()
-			fmt.Printf("Files created:\n")
-			fmt.Printf("  Certificate: %s/ca/intermediate.crt\n", pkiDir)
-			fmt.Printf("  Chain:       %s/ca/chain.crt (intermediate + root)\n", pkiDir)
-			fmt.Printf("  Private Key: %s/ca/intermediate.key.age (encrypted)\n", pkiDir)
-			fmt.Println()
-			fmt.Println("Host certificates will now be signed by the intermediate CA")
-			fmt.Println("and include the full certificate chain.")
-
+			fmt.Printf("Summary: %d succeeded, %d failed\n", successCount, failedCount)
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&configFile, "config", "c", "", "PKI config file (e.g., secrets/pki.yaml)")
-	cmd.Flags().StringVar(&pkiDir, "pki-dir", "secrets/pki", "Directory for PKI files")
-	cmd.Flags().StringSliceVarP(&recipients, "recipient", "r", nil, "Age recipients for encrypting intermediate CA key")
-	cmd.Flags().StringSliceVar(&identities, "identity", nil, "Age identity files for decryption")
-	cmd.Flags().StringVar(&commonName, "cn", "NixFleet Intermediate CA", "Intermediate CA common name")
-	cmd.Flags().StringVar(&organization, "org", "NixFleet", "Organization name")
-	cmd.Flags().StringVar(&validity, "validity", "5y", "Intermediate CA validity (e.g., 5y, 8760h)")
-	cmd.Flags().BoolVar(&force, "force", false, "Overwrite existing intermediate CA")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().StringSliceVar(&identities, "identity", defaultIdentities(), "Age identity files for decrypting host keys")
+	cmd.Flags().StringVar(&destDir, "dest-dir", "/etc/nixfleet/pki", "Destination directory on hosts")
+	cmd.Flags().BoolVar(&trustSystem, "trust-system", false, "Add CA to system trust store")
+	cmd.Flags().BoolVar(&caOnly, "ca-only", false, "Only deploy CA certificate (skip host certs)")
+	cmd.Flags().StringVarP(&configFile, "config", "c", "", "PKI config file (needed to resolve shared certificate deploy targets)")
+	cmd.Flags().BoolVar(&skipReload, "skip-reload", false, "Skip reloading dependent systemd units after a certificate changes")
 
 	return cmd
 }
 
-func pkiIssueCmd() *cobra.Command {
+func pkiScanCmd() *cobra.Command {
 	var (
-		configFile string
 		pkiDir     string
-		recipients []string
 		identities []string
-		sans       []string
-		validity   string
-		all        bool
-		certName   string
+		dirs       []string
+		output     string
 	)
 
 	cmd := &cobra.Command{
-		Use:   "issue [hostname]",
-		Short: "Issue a certificate for a host",
-		Long: `Issue a TLS certificate for a host, signed by the fleet CA.
-
-The certificate includes:
-  - The hostname as Common Name
-  - Additional SANs (DNS names and IP addresses)
-  - Server and client auth extended key usage (for mTLS)
-
-Multiple named certificates per host are supported using --name:
-  - Default name is "host" if not specified
-  - Stored at: secrets/pki/hosts/{hostname}/{name}.crt
-
-With a config file, host SANs and certificate settings can be predefined.
+		Use:   "scan",
+		Short: "Find certificates on hosts that the PKI store doesn't know about",
+		Long: `Walk a configurable set of remote directories over SSH, parse every
+certificate found, and reconcile it against the local PKI store.
+
+Each certificate is classified as:
+  fleet-managed - serial matches a certificate this store issued and tracks
+  orphaned      - signed by the fleet CA, but no longer tracked here
+  foreign       - issued by something else entirely
+  expired       - past its NotAfter, regardless of the above
+
+Findings are printed per host and recorded into HostState (see
+'pki status --fleet' to see them aggregated across the fleet, and
+GET /api/hosts/{name}/pki/scan for the live result).
+
+With --output json, prints one JSON row per finding (same field names as
+'pki status --output json', with certName holding the on-disk path) and
+exits 9/8/1 for expired/expiring/unreadable findings, so a monitoring
+job doesn't have to parse the classification text.
 
 Examples:
-  nixfleet pki issue host-a
-  nixfleet pki issue host-a --name web --san host-a.example.com
-  nixfleet pki issue host-a --config secrets/pki.yaml  # Uses SANs from config
-  nixfleet pki issue --all`,
-		Args: func(cmd *cobra.Command, args []string) error {
-			if all {
-				return nil
-			}
-			if len(args) != 1 {
-				return fmt.Errorf("hostname required (or use --all)")
-			}
-			return nil
-		},
+  nixfleet pki scan --group all
+  nixfleet pki scan -H myhost
+  nixfleet pki scan --dir /etc/ssl/private --dir /opt/app/certs`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			// Load config file if specified
-			var pkiCfg *pki.PKIConfig
-			if configFile != "" {
-				var err error
-				pkiCfg, err = pki.LoadPKIConfig(configFile)
-				if err != nil {
-					return fmt.Errorf("loading config: %w", err)
-				}
-
-				// Use config values as defaults (CLI flags override)
-				if pkiDir == "secrets/pki" && pkiCfg.Directory != "" {
-					pkiDir = pkiCfg.Directory
-				}
-				if len(recipients) == 0 {
-					recipients = pkiCfg.Recipients
-				}
-				if len(identities) == 0 {
-					identities = pkiCfg.Identities
-				}
-				if validity == "365d" && pkiCfg.Defaults.Validity != "" {
-					validity = pkiCfg.Defaults.Validity
-				}
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid --output %q (want table or json)", output)
 			}
+			asJSON := output == "json"
 
-			store := pki.NewStore(pkiDir, recipients, identities)
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
 
-			// Check CA exists
+			store := pki.NewStore(pkiDir, nil, identities)
 			if !store.CAExists() {
 				return fmt.Errorf("CA not initialized. Run 'nixfleet pki init' first")
 			}
+			scanner := pki.NewScanner(store)
+			mgr := state.NewManager()
 
-			// Determine which CA to use for signing
-			// Prefer intermediate CA if available, otherwise use root
-			var issuer interface {
-				IssueCert(req *pki.CertRequest) (*pki.IssuedCert, error)
-			}
-			var signerName string
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
 
-			if store.IntermediateCAExists() {
-				ica, err := store.LoadIntermediateCA(ctx)
-				if err != nil {
-					return fmt.Errorf("loading intermediate CA: %w", err)
-				}
-				issuer = ica
-				signerName = "intermediate CA"
-			} else {
-				ca, err := store.LoadCA(ctx)
-				if err != nil {
-					return fmt.Errorf("loading CA: %w", err)
+			var rows []pkiCertJSON
+			totalFindings := 0
+			for _, host := range hosts {
+				if !asJSON {
+					fmt.Printf("%s:\n", host.Name)
 				}
-				issuer = ca
-				signerName = "root CA"
-			}
-
-			// Parse validity using helper
-			validityDuration, err := pki.ParseValidityDuration(validity)
-			if err != nil {
-				return fmt.Errorf("invalid validity format: %s (use e.g., 90d, 1y)", validity)
-			}
 
-			// Determine hosts to issue certs for
-			var hostnames []string
-			if all {
-				_, hosts, err := loadInventoryAndHosts(ctx)
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
 				if err != nil {
-					return err
-				}
-				for _, h := range hosts {
-					hostnames = append(hostnames, h.Name)
-				}
-			} else {
-				hostnames = []string{args[0]}
-			}
-
-			if len(recipients) == 0 {
-				return fmt.Errorf("at least one --recipient is required")
-			}
-
-			fmt.Printf("Issuing certificates for %d host(s) using %s...\n\n", len(hostnames), signerName)
-
-			for _, hostname := range hostnames {
-				// Build request, merging config and CLI flags
-				var req *pki.CertRequest
-
-				// Try to get config-defined request first
-				if pkiCfg != nil {
-					var err error
-					req, err = pkiCfg.GetHostCertRequest(hostname, certName)
-					if err != nil {
-						req = nil // Fall back to manual construction
+					rows = append(rows, pkiCertJSON{Hostname: host.Name, Error: fmt.Sprintf("connection failed: %v", err)})
+					if !asJSON {
+						fmt.Printf("  Connection failed: %v\n", err)
 					}
+					continue
 				}
 
-				// If no config or config failed, build manually
-				if req == nil {
-					req = &pki.CertRequest{
-						Hostname: hostname,
-						Name:     certName,
-						Validity: validityDuration,
+				result, err := scanner.ScanHost(ctx, client, dirs)
+				if err != nil {
+					rows = append(rows, pkiCertJSON{Hostname: host.Name, Error: fmt.Sprintf("scan failed: %v", err)})
+					if !asJSON {
+						fmt.Printf("  Scan failed: %v\n", err)
 					}
+					continue
 				}
 
-				// CLI sans always override/append
-				if len(sans) > 0 {
-					req.SANs = append(req.SANs, sans...)
+				if err := mgr.UpdatePKIScan(ctx, client, result); err != nil && !asJSON {
+					fmt.Printf("  Warning: failed to record scan in state: %v\n", err)
 				}
 
-				cert, err := issuer.IssueCert(req)
-				if err != nil {
-					fmt.Printf("  %s: FAILED - %v\n", hostname, err)
+				if len(result.Certs) == 0 && !asJSON {
+					fmt.Printf("  No certificates found under %s\n\n", strings.Join(result.Dirs, ", "))
 					continue
 				}
 
-				if err := store.SaveHostCert(cert); err != nil {
-					fmt.Printf("  %s: FAILED to save - %v\n", hostname, err)
-					continue
-				}
+				for _, cert := range result.Certs {
+					if cert.Classification == "fleet-managed" {
+						continue
+					}
+					totalFindings++
 
-				certLabel := hostname
-				if certName != "" && certName != "host" {
-					certLabel = fmt.Sprintf("%s/%s", hostname, certName)
+					status := cert.Classification
+					if status != "expired" && cert.DaysLeft <= 30 {
+						status = "expiring"
+					}
+					rows = append(rows, pkiCertJSON{
+						Hostname:  host.Name,
+						CertName:  cert.Path,
+						Serial:    cert.Serial,
+						NotAfter:  cert.NotAfter.Format(time.RFC3339),
+						DaysLeft:  cert.DaysLeft,
+						Status:    status,
+						SANs:      cert.SANs,
+						Algorithm: cert.Algorithm,
+					})
+
+					if asJSON {
+						continue
+					}
+					keyNote := "no key"
+					if cert.HasKey {
+						keyNote = "key matches"
+						if !cert.KeyMatches {
+							keyNote = "key MISMATCH"
+						}
+					}
+					fmt.Printf("  [%s] %s (%s, expires %s, %d days, %s) - %s\n",
+						strings.ToUpper(cert.Classification), cert.Path, cert.Subject,
+						cert.NotAfter.Format("2006-01-02"), cert.DaysLeft, keyNote, cert.Detail)
+				}
+				for _, scanErr := range result.Errors {
+					rows = append(rows, pkiCertJSON{Hostname: host.Name, Error: scanErr})
+					if !asJSON {
+						fmt.Printf("  error: %s\n", scanErr)
+					}
+				}
+				if !asJSON {
+					fmt.Println()
 				}
-				fmt.Printf("  %s: OK (expires %s)\n", certLabel, cert.NotAfter.Format("2006-01-02"))
 			}
 
-			fmt.Println()
-			fmt.Println("Certificates issued. Deploy with: nixfleet apply")
+			if asJSON {
+				data, err := json.MarshalIndent(rows, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+			} else {
+				fmt.Printf("Summary: %d finding(s) needing attention across %d host(s)\n", totalFindings, len(hosts))
+			}
 
-			return nil
+			return pkiExitError(rows)
 		},
 	}
 
-	cmd.Flags().StringVarP(&configFile, "config", "c", "", "PKI config file (e.g., secrets/pki.yaml)")
-	cmd.Flags().StringVar(&pkiDir, "pki-dir", "secrets/pki", "Directory for PKI files")
-	cmd.Flags().StringSliceVarP(&recipients, "recipient", "r", nil, "Age recipients for encrypting host keys")
-	cmd.Flags().StringSliceVar(&identities, "identity", nil, "Age identity files for decryption")
-	cmd.Flags().StringSliceVar(&sans, "san", nil, "Subject Alternative Names (DNS names or IPs)")
-	cmd.Flags().StringVar(&validity, "validity", "365d", "Certificate validity (e.g., 365d, 1y)")
-	cmd.Flags().BoolVar(&all, "all", false, "Issue certificates for all hosts in inventory")
-	cmd.Flags().StringVar(&certName, "name", "", "Certificate name (default: host). Use for multiple certs per host")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().StringSliceVar(&identities, "identity", defaultIdentities(), "Age identity files (for CA info)")
+	cmd.Flags().StringSliceVar(&dirs, "dir", nil, "Remote directory to scan (repeatable; defaults to pki.DefaultScanDirs)")
+	cmd.Flags().StringVar(&output, "output", "table", "Output format: table or json")
 
 	return cmd
 }
 
-func pkiStatusCmd() *cobra.Command {
+func pkiRenewCmd() *cobra.Command {
 	var (
-		pkiDir     string
-		identities []string
+		pkiDir       string
+		identities   []string
+		validity     time.Duration
+		days         int
+		force        bool
+		configFile   string
+		output       string
+		reuseKey     bool
+		auditLogPath string
 	)
 
 	cmd := &cobra.Command{
-		Use:   "status",
-		Short: "Show certificate status for fleet hosts",
-		Long: `Display certificate status for all hosts in the fleet.
+		Use:   "renew [hostname...]",
+		Short: "Renew expiring certificates",
+		Long: `Renew certificates that are expiring or have expired.
 
-Shows:
-  - Certificate names (host, web, api, etc.)
-  - Certificate expiration dates
-  - Days remaining until expiry
-  - Status (valid, expiring, expired)
-  - Subject Alternative Names`,
+Without arguments, checks all certificates and renews those expiring within --days.
+With hostnames, renews certificates for the specified hosts.
+
+If --config points at a PKI config file with defaults.maxValidity set,
+renewals requesting a longer validity than that policy are refused rather
+than silently clamped.
+
+With --reuse-key, each renewal reissues the certificate for its existing
+private key instead of generating a new one, leaving the key file on disk
+untouched - for DANE/TLSA records and appliances that must be
+re-provisioned whenever the key changes. A host's cert can also opt into
+this via a reuseKey: true setting in --config; the flag overrides the
+config when explicitly passed.
+
+With --output json, prints one JSON row per host with a "status" of
+renewed, skipped, or failed, and exits 9 if any renewal failed (or a
+cert is still expired afterwards), 8 if any remaining cert is merely
+expiring, 1 if a row's cert couldn't be read at all.
+
+Examples:
+  nixfleet pki renew --days 30         # Renew certs expiring in 30 days
+  nixfleet pki renew myhost            # Renew cert for myhost
+  nixfleet pki renew --force myhost    # Force renew even if not expiring
+  nixfleet pki renew --reuse-key myhost  # Renew, keeping the existing key`,
+		ValidArgsFunction: completePKIHostnames,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
-			_ = ctx
 
-			store := pki.NewStore(pkiDir, nil, identities)
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid --output %q (want table or json)", output)
+			}
+			asJSON := output == "json"
 
-			// Check CA exists
+			store := pki.NewStore(pkiDir, nil, identities)
 			if !store.CAExists() {
 				return fmt.Errorf("CA not initialized. Run 'nixfleet pki init' first")
 			}
 
-			// List host certs
-			hosts, err := store.ListHostCerts()
-			if err != nil {
-				return fmt.Errorf("listing certificates: %w", err)
+			var maxValidity time.Duration
+			var pkiCfg *pki.PKIConfig
+			if configFile != "" {
+				var err error
+				pkiCfg, err = pki.LoadPKIConfig(configFile)
+				if err != nil {
+					return fmt.Errorf("loading config: %w", err)
+				}
+				maxValidity, err = pkiCfg.GetMaxValidity()
+				if err != nil {
+					return fmt.Errorf("parsing max validity policy: %w", err)
+				}
 			}
 
-			if len(hosts) == 0 {
-				fmt.Println("No host certificates found.")
-				fmt.Println("Issue certificates with: nixfleet pki issue <hostname>")
-				return nil
-			}
+			deployer := pki.NewDeployer(&pki.DeployConfig{
+				PKIDir:          pkiDir,
+				Identities:      identities,
+				MaxCertValidity: maxValidity,
+			})
 
-			fmt.Printf("%-25s %-12s %-10s %-12s %s\n", "HOST/CERT", "EXPIRES", "DAYS LEFT", "STATUS", "SANs")
-			fmt.Println(strings.Repeat("-", 90))
+			var audit *pki.AuditLogger
+			if auditLogPath != "" {
+				audit = pki.NewAuditLogger(auditLogPath)
+			}
 
-			for _, hostname := range hosts {
-				// List all named certs for this host
-				certNames, err := store.ListHostNamedCerts(hostname)
+			// Determine which certs to renew
+			var toRenew []string
+			if len(args) > 0 {
+				// Specific hosts provided
+				toRenew = args
+			} else {
+				// Check for expiring certs
+				renewalInfos, err := deployer.CheckRenewalNeeded(ctx, days)
 				if err != nil {
-					fmt.Printf("%-25s %-12s %-10s %-12s %s\n", hostname, "ERROR", "-", "error", err.Error())
-					continue
+					return fmt.Errorf("checking renewal: %w", err)
 				}
+				if len(renewalInfos) == 0 {
+					if !asJSON {
+						fmt.Println("No certificates need renewal")
+					} else {
+						fmt.Println("[]")
+					}
+					return nil
+				}
+				for _, info := range renewalInfos {
+					toRenew = append(toRenew, info.Hostname)
+				}
+			}
 
-				for i, certName := range certNames {
-					info, err := store.GetNamedCertInfo(hostname, certName)
+			if !asJSON {
+				fmt.Printf("Renewing %d certificate(s)...\n\n", len(toRenew))
+			}
+
+			var rows []pkiCertJSON
+			for _, hostname := range toRenew {
+				// Check if cert exists and needs renewal (unless force)
+				if !force && len(args) > 0 {
+					info, err := store.GetCertInfo(hostname)
 					if err != nil {
-						label := fmt.Sprintf("%s/%s", hostname, certName)
-						fmt.Printf("%-25s %-12s %-10s %-12s %s\n", label, "ERROR", "-", "error", err.Error())
+						rows = append(rows, pkiCertJSON{Hostname: hostname, CertName: "host", Status: "skipped", Error: "certificate not found"})
+						if !asJSON {
+							fmt.Printf("%s: certificate not found\n", hostname)
+						}
 						continue
 					}
-
-					// Format status with color indicators
-					var statusIcon string
-					switch info.Status {
-					case "valid":
-						statusIcon = "✓ valid"
-					case "expiring":
-						statusIcon = "⚠ expiring"
-					case "expired":
-						statusIcon = "✗ expired"
+					if info.DaysLeft > days {
+						rows = append(rows, pkiCertJSON{Hostname: hostname, CertName: "host", Status: "skipped", DaysLeft: info.DaysLeft})
+						if !asJSON {
+							fmt.Printf("%s: skipping (expires in %d days, use --force to renew anyway)\n",
+								hostname, info.DaysLeft)
+						}
+						continue
 					}
+				}
 
-					sansStr := strings.Join(info.SANs, ", ")
-					if len(sansStr) > 25 {
-						sansStr = sansStr[:22] + "..."
-					}
+				wantReuseKey := reuseKey
+				if !cmd.Flags().Changed("reuse-key") && pkiCfg != nil {
+					wantReuseKey = pkiCfg.GetHostCertReuseKey(hostname, "host")
+				}
 
-					// Format host/cert label
-					var label string
-					if len(certNames) == 1 && certName == "host" {
-						label = hostname
-					} else if i == 0 {
-						label = fmt.Sprintf("%s/%s", hostname, certName)
-					} else {
-						label = fmt.Sprintf("  └─ %s", certName)
+				cert, keyReused, err := deployer.RenewCert(ctx, hostname, nil, validity, wantReuseKey)
+				if err != nil {
+					rows = append(rows, pkiCertJSON{Hostname: hostname, CertName: "host", Status: "failed", Error: err.Error()})
+					if !asJSON {
+						fmt.Printf("%s: renewal failed - %v\n", hostname, err)
 					}
-
-					fmt.Printf("%-25s %-12s %-10d %-12s %s\n",
-						label,
-						info.NotAfter.Format("2006-01-02"),
-						info.DaysLeft,
-						statusIcon,
-						sansStr,
-					)
+					if audit != nil {
+						_ = audit.Log(pki.AuditEntry{Hostname: hostname, Allowed: false, Reason: err.Error(), KeyReused: wantReuseKey})
+					}
+					continue
 				}
-			}
-
-			return nil
-		},
-	}
-
-	cmd.Flags().StringVar(&pkiDir, "pki-dir", "secrets/pki", "Directory for PKI files")
-	cmd.Flags().StringSliceVar(&identities, "identity", nil, "Age identity files (for CA info)")
-
-	return cmd
-}
-
-func pkiExportCmd() *cobra.Command {
-	var pkiDir string
-
-	cmd := &cobra.Command{
-		Use:   "export",
-		Short: "Export CA certificate",
-		Long: `Export the CA certificate in PEM format.
-
-This can be used to add the fleet CA to external trust stores
-or configure applications to trust fleet certificates.
 
-Example:
-  nixfleet pki export > fleet-ca.crt
-  sudo cp fleet-ca.crt /usr/local/share/ca-certificates/
-  sudo update-ca-certificates`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			store := pki.NewStore(pkiDir, nil, nil)
+				if audit != nil {
+					_ = audit.Log(pki.AuditEntry{Hostname: hostname, SANs: cert.SANs, Allowed: true, Serial: cert.Serial, KeyReused: keyReused})
+				}
 
-			if !store.CAExists() {
-				return fmt.Errorf("CA not initialized. Run 'nixfleet pki init' first")
+				rows = append(rows, pkiCertJSON{
+					Hostname:  hostname,
+					CertName:  "host",
+					Serial:    cert.Serial,
+					KeyReused: keyReused,
+					NotAfter:  cert.NotAfter.Format(time.RFC3339),
+					SANs:      cert.SANs,
+					Status:    "renewed",
+				})
+				if !asJSON {
+					fmt.Printf("%s: renewed (valid until %s)\n",
+						hostname, cert.NotAfter.Format("2006-01-02"))
+				}
 			}
 
-			caCertPath := store.GetCACertPath()
-			certPEM, err := os.ReadFile(caCertPath)
-			if err != nil {
-				return fmt.Errorf("reading CA certificate: %w", err)
+			if asJSON {
+				data, err := json.MarshalIndent(rows, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
 			}
 
-			fmt.Print(string(certPEM))
-			return nil
+			return pkiExitError(rows)
 		},
 	}
 
-	cmd.Flags().StringVar(&pkiDir, "pki-dir", "secrets/pki", "Directory for PKI files")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().StringSliceVar(&identities, "identity", defaultIdentities(), "Age identity files for decryption")
+	cmd.Flags().DurationVar(&validity, "validity", 365*24*time.Hour, "Validity period for renewed certs")
+	cmd.Flags().IntVar(&days, "days", 30, "Renew certs expiring within this many days")
+	cmd.Flags().BoolVar(&force, "force", false, "Force renewal even if cert is not expiring")
+	cmd.Flags().StringVarP(&configFile, "config", "c", "", "PKI config file (for maxValidity and reuseKey policy)")
+	cmd.Flags().StringVar(&output, "output", "table", "Output format: table or json")
+	cmd.Flags().BoolVar(&reuseKey, "reuse-key", false, "Reissue for the existing key instead of generating a new one")
+	cmd.Flags().StringVar(&auditLogPath, "audit-log", "", "Path to append renewal decisions as JSON lines")
 
 	return cmd
 }
 
-func pkiTrustCmd() *cobra.Command {
-	var pkiDir string
+func pkiRevokeCmd() *cobra.Command {
+	var (
+		pkiDir     string
+		force      bool
+		shared     string
+		configFile string
+		reason     string
+	)
 
 	cmd := &cobra.Command{
-		Use:   "trust",
-		Short: "Add CA certificate to local trust store",
-		Long: `Add the fleet CA certificate to your local machine's trust store.
-
-This command detects your operating system and installs the CA certificate
-to the appropriate system trust store:
+		Use:   "revoke <hostname>",
+		Short: "Revoke a host certificate",
+		Long: `Revoke a host certificate: records its serial in the store's
+revocation list (secrets/pki/crl/revoked.json) and removes the
+certificate and key files.
 
-  macOS:  System Keychain via 'security' command
-  Linux:  /usr/local/share/ca-certificates/ + update-ca-certificates (Debian/Ubuntu)
-          /etc/pki/ca-trust/source/anchors/ + update-ca-trust (RHEL/Fedora)
+Recording the revocation doesn't by itself stop an already-deployed
+certificate from working - run 'nixfleet pki crl generate' to sign a CRL
+covering it, then 'nixfleet pki deploy' to push the CRL to hosts. Until
+then, 'nixfleet pki status' still flags the certificate as "revoked".
 
-After running this command, applications on your machine will trust
-certificates signed by the fleet CA.
+Use --shared <name> to revoke a shared certificate instead; this warns
+about every host in its "deployTo" list that still has it installed.
 
 Examples:
-  nixfleet pki trust
-  nixfleet pki trust --pki-dir /path/to/pki`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			store := pki.NewStore(pkiDir, nil, nil)
-
-			if !store.CAExists() {
-				return fmt.Errorf("CA not initialized. Run 'nixfleet pki init' first")
-			}
-
-			caCertPath := store.GetCACertPath()
-			certPEM, err := os.ReadFile(caCertPath)
-			if err != nil {
-				return fmt.Errorf("reading CA certificate: %w", err)
+  nixfleet pki revoke oldhost
+  nixfleet pki revoke --reason key-compromise oldhost
+  nixfleet pki revoke --force oldhost  # Skip confirmation
+  nixfleet pki revoke --shared ingress-wildcard --config secrets/pki.yaml`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if shared != "" {
+				return nil
 			}
-
-			// Create temp file for the certificate
-			tmpFile, err := os.CreateTemp("", "fleet-ca-*.crt")
-			if err != nil {
-				return fmt.Errorf("creating temp file: %w", err)
+			if len(args) != 1 {
+				return fmt.Errorf("hostname required (or use --shared)")
 			}
-			defer os.Remove(tmpFile.Name())
+			return nil
+		},
+		ValidArgsFunction: completePKIHostnames,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 
-			if _, err := tmpFile.Write(certPEM); err != nil {
-				return fmt.Errorf("writing temp file: %w", err)
+			switch reason {
+			case pki.ReasonUnspecified, pki.ReasonKeyCompromise, pki.ReasonSuperseded, pki.ReasonCessationOfOperation:
+			default:
+				return fmt.Errorf("invalid --reason %q (want unspecified, key-compromise, superseded, or cessation-of-operation)", reason)
 			}
-			tmpFile.Close()
-
-			// Detect OS and install appropriately
-			switch runtime.GOOS {
-			case "darwin":
-				fmt.Println("Installing CA certificate to macOS System Keychain...")
-				installCmd := exec.Command("sudo", "security", "add-trusted-cert",
-					"-d", "-r", "trustRoot",
-					"-k", "/Library/Keychains/System.keychain",
-					tmpFile.Name())
-				installCmd.Stdout = os.Stdout
-				installCmd.Stderr = os.Stderr
-				installCmd.Stdin = os.Stdin
-				if err := installCmd.Run(); err != nil {
-					return fmt.Errorf("adding certificate to keychain: %w", err)
-				}
-				fmt.Println("CA certificate installed to System Keychain")
 
-			case "linux":
-				// Try Debian/Ubuntu style first
-				debianPath := "/usr/local/share/ca-certificates/fleet-ca.crt"
-				if _, err := os.Stat("/usr/local/share/ca-certificates"); err == nil {
-					fmt.Println("Installing CA certificate (Debian/Ubuntu style)...")
-					copyCmd := exec.Command("sudo", "cp", tmpFile.Name(), debianPath)
-					if err := copyCmd.Run(); err != nil {
-						return fmt.Errorf("copying certificate: %w", err)
+			store := pki.NewStore(pkiDir, nil, nil)
+
+			if shared != "" {
+				if !store.SharedCertExists(shared) {
+					return fmt.Errorf("no shared certificate found for %s", shared)
+				}
+
+				var targets []string
+				if configFile != "" {
+					if pkiCfg, err := pki.LoadPKIConfig(configFile); err == nil && pkiCfg.Shared[shared] != nil {
+						targets = pkiCfg.Shared[shared].DeployTo
 					}
-					updateCmd := exec.Command("sudo", "update-ca-certificates")
-					updateCmd.Stdout = os.Stdout
-					updateCmd.Stderr = os.Stderr
-					if err := updateCmd.Run(); err != nil {
-						return fmt.Errorf("updating CA certificates: %w", err)
+				}
+
+				if !force {
+					fmt.Printf("Shared certificate %q is deployed to: %s\n", shared, strings.Join(targets, ", "))
+					fmt.Printf("Revoking will not remove it from those hosts until they are re-deployed.\n")
+					fmt.Printf("Type 'yes' to confirm: ")
+
+					var confirm string
+					if _, err := fmt.Scanln(&confirm); err != nil || confirm != "yes" {
+						fmt.Println("Aborted")
+						return nil
 					}
-					fmt.Printf("CA certificate installed to %s\n", debianPath)
-				} else {
-					// Try RHEL/Fedora style
-					rhelPath := "/etc/pki/ca-trust/source/anchors/fleet-ca.crt"
-					if _, err := os.Stat("/etc/pki/ca-trust/source/anchors"); err == nil {
-						fmt.Println("Installing CA certificate (RHEL/Fedora style)...")
-						copyCmd := exec.Command("sudo", "cp", tmpFile.Name(), rhelPath)
-						if err := copyCmd.Run(); err != nil {
-							return fmt.Errorf("copying certificate: %w", err)
-						}
-						updateCmd := exec.Command("sudo", "update-ca-trust")
-						updateCmd.Stdout = os.Stdout
-						updateCmd.Stderr = os.Stderr
-						if err := updateCmd.Run(); err != nil {
-							return fmt.Errorf("updating CA trust: %w", err)
-						}
-						fmt.Printf("CA certificate installed to %s\n", rhelPath)
-					} else {
-						return fmt.Errorf("could not detect Linux CA trust store location")
+				}
+
+				if info, err := store.GetSharedCertInfo(shared); err == nil {
+					if err := store.RevokeSerial(info.Serial, "shared:"+shared, reason); err != nil {
+						return fmt.Errorf("recording revocation: %w", err)
 					}
 				}
 
-			default:
-				return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+				sharedDir := filepath.Join(pkiDir, "shared", shared)
+				if err := os.RemoveAll(sharedDir); err != nil {
+					return fmt.Errorf("removing shared certificate: %w", err)
+				}
+
+				fmt.Printf("Shared certificate %q has been revoked\n", shared)
+				if len(targets) > 0 {
+					fmt.Printf("WARNING: still installed on: %s (until next 'nixfleet pki deploy')\n", strings.Join(targets, ", "))
+				}
+				return nil
 			}
 
-			fmt.Println("\nFleet CA is now trusted by your system.")
+			hostname := args[0]
+
+			// Check if cert exists
+			if !store.HostCertExists(hostname) {
+				return fmt.Errorf("no certificate found for %s", hostname)
+			}
+
+			// Get cert info for confirmation
+			info, err := store.GetCertInfo(hostname)
+			if err != nil {
+				return fmt.Errorf("reading certificate: %w", err)
+			}
+
+			if !force {
+				fmt.Printf("Certificate for %s:\n", hostname)
+				fmt.Printf("  Serial: %s\n", info.Serial)
+				fmt.Printf("  Expires: %s (%d days)\n", info.NotAfter.Format("2006-01-02"), info.DaysLeft)
+				fmt.Printf("\nThis will permanently remove this certificate.\n")
+				fmt.Printf("Type 'yes' to confirm: ")
+
+				var confirm string
+				if _, err := fmt.Scanln(&confirm); err != nil || confirm != "yes" {
+					fmt.Println("Aborted")
+					return nil
+				}
+			}
+
+			deployer := pki.NewDeployer(&pki.DeployConfig{PKIDir: pkiDir})
+			if err := deployer.RevokeCert(ctx, hostname, reason); err != nil {
+				return fmt.Errorf("revoking certificate: %w", err)
+			}
+
+			fmt.Printf("Certificate for %s has been revoked\n", hostname)
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&pkiDir, "pki-dir", "secrets/pki", "Directory for PKI files")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().BoolVar(&force, "force", false, "Skip confirmation prompt")
+	cmd.Flags().StringVar(&shared, "shared", "", "Revoke a shared certificate by name instead of a host certificate")
+	cmd.Flags().StringVarP(&configFile, "config", "c", "", "PKI config file (to list affected hosts for shared certs)")
+	cmd.Flags().StringVar(&reason, "reason", pki.ReasonUnspecified, "Revocation reason recorded in the CRL (unspecified, key-compromise, superseded, cessation-of-operation)")
 
 	return cmd
 }
 
-func pkiDeployCmd() *cobra.Command {
+func pkiRequestCmd() *cobra.Command {
 	var (
-		pkiDir      string
-		identities  []string
-		destDir     string
-		trustSystem bool
-		caOnly      bool
+		cn        string
+		sans      []string
+		validity  string
+		output    string
+		keyOutput string
+		requester string
 	)
 
 	cmd := &cobra.Command{
-		Use:   "deploy",
-		Short: "Deploy certificates to fleet hosts",
-		Long: `Deploy CA and host certificates to fleet hosts via SSH.
-
-This command:
-  - Deploys the CA certificate to all hosts
-  - Deploys host-specific certificates and private keys
-  - Optionally adds CA to system trust store
+		Use:   "request",
+		Short: "Generate a certificate signing request for an admin to approve",
+		Long: `Generate a key pair and a certificate signing request (CSR).
 
-The host private keys are decrypted using age and deployed securely.
+The private key is written to --key-out and never leaves this machine.
+Only the CSR (in --output) should be sent on to an admin, either as a file
+or POSTed to the server's /api/pki/requests endpoint, where it becomes a
+pending entry for 'nixfleet pki requests approve'.
 
 Examples:
-  nixfleet pki deploy --identity ~/.config/age/key.txt
-  nixfleet pki deploy --ca-only      # Only deploy CA cert
-  nixfleet pki deploy -H myhost      # Deploy to specific host`,
+  nixfleet pki request --cn svc.internal --output req.json --key-out svc.key
+  nixfleet pki request --cn svc.internal --san svc.example.com --validity 90d -o req.json`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
+			if cn == "" {
+				return fmt.Errorf("--cn is required")
+			}
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			csrPEM, keyPEM, err := pki.GenerateCSR(cn, sans)
 			if err != nil {
-				return err
+				return fmt.Errorf("generating request: %w", err)
 			}
 
-			store := pki.NewStore(pkiDir, nil, identities)
+			id, err := pki.NewRequestID()
+			if err != nil {
+				return err
+			}
 
-			if !store.CAExists() {
-				return fmt.Errorf("CA not initialized. Run 'nixfleet pki init' first")
+			now := time.Now()
+			req := &pki.CertIntakeRequest{
+				ID:         id,
+				CSRPEM:     csrPEM,
+				CommonName: cn,
+				SANs:       sans,
+				Validity:   validity,
+				Status:     pki.RequestPending,
+				Requester:  requester,
+				CreatedAt:  now,
+				ExpiresAt:  now.Add(pki.DefaultRequestTTL),
 			}
 
-			// Read CA certificate
-			caCertPath := store.GetCACertPath()
-			caCertPEM, err := os.ReadFile(caCertPath)
+			data, err := json.MarshalIndent(req, "", "  ")
 			if err != nil {
-				return fmt.Errorf("reading CA certificate: %w", err)
+				return fmt.Errorf("encoding request: %w", err)
+			}
+			if err := os.WriteFile(output, data, 0644); err != nil {
+				return fmt.Errorf("writing request file: %w", err)
 			}
 
-			pool := ssh.NewPool(nil)
-			defer pool.Close()
+			if err := os.WriteFile(keyOutput, keyPEM, 0600); err != nil {
+				return fmt.Errorf("writing private key: %w", err)
+			}
 
-			fmt.Printf("Deploying PKI to %d host(s)...\n\n", len(hosts))
+			fmt.Printf("Request written to %s (id %s)\n", output, id)
+			fmt.Printf("Private key written to %s - keep this, it is never sent anywhere\n", keyOutput)
+			return nil
+		},
+	}
 
-			successCount := 0
-			failedCount := 0
+	cmd.Flags().StringVar(&cn, "cn", "", "Common name for the certificate (required)")
+	cmd.Flags().StringSliceVar(&sans, "san", nil, "Additional DNS names or IP addresses")
+	cmd.Flags().StringVar(&validity, "validity", "90d", "Requested validity (subject to the admin's issuance policy)")
+	cmd.Flags().StringVarP(&output, "output", "o", "request.json", "Path to write the request file")
+	cmd.Flags().StringVar(&keyOutput, "key-out", "request.key", "Path to write the private key (keep local)")
+	cmd.Flags().StringVar(&requester, "requester", "", "Free-form identity to record with the request")
 
-			for _, host := range hosts {
-				fmt.Printf("%s:\n", host.Name)
+	return cmd
+}
 
-				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
-				if err != nil {
-					fmt.Printf("  Connection failed: %v\n", err)
-					failedCount++
-					continue
-				}
+func pkiRequestsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "requests",
+		Short: "Manage pending certificate requests",
+		Long: `Review, approve, and deny certificate requests submitted with
+'nixfleet pki request' or POSTed to the server's /api/pki/requests endpoint.
 
-				// Create PKI directory
-				mkdirCmd := fmt.Sprintf("sudo mkdir -p %s && sudo chmod 755 %s", destDir, destDir)
-				if _, err := client.Exec(ctx, mkdirCmd); err != nil {
-					fmt.Printf("  Failed to create directory: %v\n", err)
-					failedCount++
-					continue
-				}
+Commands:
+  list     - List pending (and, with --all, decided) requests
+  approve  - Sign a pending request's CSR with the fleet CA
+  deny     - Reject a pending request with a reason`,
+	}
 
-				// Deploy CA certificate
-				caCertDest := destDir + "/ca.crt"
-				if err := deployFileContent(ctx, client, caCertPEM, caCertDest, "0644"); err != nil {
-					fmt.Printf("  Failed to deploy CA cert: %v\n", err)
-					failedCount++
-					continue
-				}
-				fmt.Printf("  CA cert: %s\n", caCertDest)
+	cmd.AddCommand(pkiRequestsListCmd())
+	cmd.AddCommand(pkiRequestsApproveCmd())
+	cmd.AddCommand(pkiRequestsDenyCmd())
 
-				// Update system trust store if requested
-				if trustSystem {
-					updateCmd := ""
-					switch host.Base {
-					case "ubuntu":
-						updateCmd = fmt.Sprintf("sudo cp %s /usr/local/share/ca-certificates/nixfleet-ca.crt && sudo update-ca-certificates", caCertDest)
-					case "nixos", "darwin":
-						// NixOS/darwin handle this differently via configuration
-						updateCmd = ""
-					}
-					if updateCmd != "" {
-						if _, err := client.Exec(ctx, updateCmd); err != nil {
-							fmt.Printf("  Warning: failed to update system trust: %v\n", err)
-						} else {
-							fmt.Printf("  System trust updated\n")
-						}
-					}
-				}
+	return cmd
+}
 
-				// Deploy host certificate and key (unless CA-only mode)
-				if !caOnly {
-					if store.HostCertExists(host.Name) {
-						hostCert, err := store.LoadHostCert(ctx, host.Name)
-						if err != nil {
-							fmt.Printf("  Failed to load host cert: %v\n", err)
-						} else {
-							// Deploy host certificate
-							hostCertDest := destDir + "/host.crt"
-							if err := deployFileContent(ctx, client, hostCert.CertPEM, hostCertDest, "0644"); err != nil {
-								fmt.Printf("  Failed to deploy host cert: %v\n", err)
-							} else {
-								fmt.Printf("  Host cert: %s\n", hostCertDest)
-							}
+func pkiRequestsListCmd() *cobra.Command {
+	var (
+		pkiDir string
+		all    bool
+		output string
+	)
 
-							// Deploy host key (restricted permissions)
-							hostKeyDest := destDir + "/host.key"
-							if err := deployFileContent(ctx, client, hostCert.KeyPEM, hostKeyDest, "0600"); err != nil {
-								fmt.Printf("  Failed to deploy host key: %v\n", err)
-							} else {
-								fmt.Printf("  Host key: %s\n", hostKeyDest)
-							}
-						}
-					} else {
-						fmt.Printf("  No host certificate found (run 'nixfleet pki issue %s')\n", host.Name)
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List certificate requests",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store := pki.NewStore(pkiDir, nil, nil)
+
+			if _, err := store.ExpirePendingRequests(); err != nil {
+				return fmt.Errorf("expiring stale requests: %w", err)
+			}
+
+			requests, err := store.ListRequests()
+			if err != nil {
+				return fmt.Errorf("listing requests: %w", err)
+			}
+
+			if !all {
+				var pending []*pki.CertIntakeRequest
+				for _, req := range requests {
+					if req.Status == pki.RequestPending {
+						pending = append(pending, req)
 					}
 				}
+				requests = pending
+			}
 
-				fmt.Println()
-				successCount++
+			if output == "json" {
+				data, err := json.MarshalIndent(requests, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+				return nil
 			}
 
-			fmt.Printf("Summary: %d succeeded, %d failed\n", successCount, failedCount)
+			if len(requests) == 0 {
+				fmt.Println("No requests found")
+				return nil
+			}
+
+			for _, req := range requests {
+				fmt.Printf("%s  %-10s %-30s %s\n", req.ID, req.Status, req.CommonName, req.CreatedAt.Format("2006-01-02 15:04"))
+			}
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&pkiDir, "pki-dir", "secrets/pki", "Directory for PKI files")
-	cmd.Flags().StringSliceVar(&identities, "identity", nil, "Age identity files for decrypting host keys")
-	cmd.Flags().StringVar(&destDir, "dest-dir", "/etc/nixfleet/pki", "Destination directory on hosts")
-	cmd.Flags().BoolVar(&trustSystem, "trust-system", false, "Add CA to system trust store")
-	cmd.Flags().BoolVar(&caOnly, "ca-only", false, "Only deploy CA certificate (skip host certs)")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().BoolVar(&all, "all", false, "Show approved/denied/expired requests too")
+	cmd.Flags().StringVar(&output, "output", "table", "Output format: table or json")
 
 	return cmd
 }
 
-func pkiRenewCmd() *cobra.Command {
+func pkiRequestsApproveCmd() *cobra.Command {
 	var (
-		pkiDir     string
-		identities []string
-		validity   time.Duration
-		days       int
-		force      bool
+		pkiDir       string
+		identities   []string
+		configFile   string
+		validity     string
+		certName     string
+		auditLogPath string
+		decidedBy    string
 	)
 
 	cmd := &cobra.Command{
-		Use:   "renew [hostname...]",
-		Short: "Renew expiring certificates",
-		Long: `Renew certificates that are expiring or have expired.
+		Use:   "approve <request-id>",
+		Short: "Approve a pending request and sign its CSR",
+		Long: `Validate and sign a pending certificate request against the CSR's own
+public key - the requester's private key is never transmitted or needed here.
 
-Without arguments, checks all certificates and renews those expiring within --days.
-With hostnames, renews certificates for the specified hosts.
-
-Examples:
-  nixfleet pki renew --days 30         # Renew certs expiring in 30 days
-  nixfleet pki renew myhost            # Renew cert for myhost
-  nixfleet pki renew --force myhost    # Force renew even if not expiring`,
+If --config points at a PKI config file with defaults.maxValidity set,
+an approval requesting a longer validity is refused rather than clamped.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
+			id := args[0]
 
 			store := pki.NewStore(pkiDir, nil, identities)
 			if !store.CAExists() {
 				return fmt.Errorf("CA not initialized. Run 'nixfleet pki init' first")
 			}
 
-			deployer := pki.NewDeployer(&pki.DeployConfig{
-				PKIDir:     pkiDir,
-				Identities: identities,
-			})
+			req, err := store.LoadRequest(id)
+			if err != nil {
+				return err
+			}
+			if req.Status != pki.RequestPending {
+				return fmt.Errorf("request %s is %s, not pending", id, req.Status)
+			}
 
-			// Determine which certs to renew
-			var toRenew []string
-			if len(args) > 0 {
-				// Specific hosts provided
-				toRenew = args
-			} else {
-				// Check for expiring certs
-				renewalInfos, err := deployer.CheckRenewalNeeded(ctx, days)
-				if err != nil {
-					return fmt.Errorf("checking renewal: %w", err)
-				}
-				if len(renewalInfos) == 0 {
-					fmt.Println("No certificates need renewal")
-					return nil
+			csr, err := pki.ParseCSR(req.CSRPEM)
+			if err != nil {
+				return fmt.Errorf("invalid request CSR: %w", err)
+			}
+
+			var maxValidity time.Duration
+			if configFile != "" {
+				pkiCfg, err := pki.LoadPKIConfig(configFile)
+				if err != nil {
+					return fmt.Errorf("loading config: %w", err)
 				}
-				for _, info := range renewalInfos {
-					toRenew = append(toRenew, info.Hostname)
+				if maxValidity, err = pkiCfg.GetMaxValidity(); err != nil {
+					return fmt.Errorf("parsing max validity policy: %w", err)
 				}
 			}
 
-			fmt.Printf("Renewing %d certificate(s)...\n\n", len(toRenew))
+			if !cmd.Flags().Changed("validity") {
+				validity = req.Validity
+			}
+			validityDuration, err := pki.ParseValidityDuration(validity)
+			if err != nil {
+				return fmt.Errorf("invalid --validity: %w", err)
+			}
 
-			for _, hostname := range toRenew {
-				// Check if cert exists and needs renewal (unless force)
-				if !force && len(args) > 0 {
-					info, err := store.GetCertInfo(hostname)
-					if err != nil {
-						fmt.Printf("%s: certificate not found\n", hostname)
-						continue
-					}
-					if info.DaysLeft > days {
-						fmt.Printf("%s: skipping (expires in %d days, use --force to renew anyway)\n",
-							hostname, info.DaysLeft)
-						continue
-					}
+			var issuer interface {
+				IssueCertForCSR(csr *x509.CertificateRequest, req *pki.CertRequest) (*pki.IssuedCert, error)
+			}
+			if store.IntermediateCAExists() {
+				ica, err := store.LoadIntermediateCA(ctx)
+				if err != nil {
+					return fmt.Errorf("loading intermediate CA: %w", err)
 				}
-
-				cert, err := deployer.RenewCert(ctx, hostname, nil, validity)
+				ica.MaxCertValidity = maxValidity
+				issuer = ica
+			} else {
+				ca, err := store.LoadCA(ctx)
 				if err != nil {
-					fmt.Printf("%s: renewal failed - %v\n", hostname, err)
-					continue
+					return fmt.Errorf("loading CA: %w", err)
 				}
+				ca.MaxCertValidity = maxValidity
+				issuer = ca
+			}
+
+			name := certName
+			if name == "" {
+				name = req.CertName
+			}
+
+			cert, err := issuer.IssueCertForCSR(csr, &pki.CertRequest{
+				Hostname: req.CommonName,
+				Name:     name,
+				SANs:     req.SANs,
+				Validity: validityDuration,
+			})
+			if err != nil {
+				return fmt.Errorf("signing request: %w", err)
+			}
+
+			if err := store.SaveHostCert(cert); err != nil {
+				return fmt.Errorf("saving issued certificate: %w", err)
+			}
+
+			req.Status = pki.RequestApproved
+			req.DecidedAt = time.Now()
+			req.DecidedBy = decidedBy
+			req.IssuedSerial = cert.Serial
+			if err := store.SaveRequest(req); err != nil {
+				return fmt.Errorf("updating request record: %w", err)
+			}
 
-				fmt.Printf("%s: renewed (valid until %s)\n",
-					hostname, cert.NotAfter.Format("2006-01-02"))
+			if auditLogPath != "" {
+				audit := pki.NewAuditLogger(auditLogPath)
+				_ = audit.Log(pki.AuditEntry{Identity: decidedBy, Hostname: req.CommonName, SANs: cert.SANs, Allowed: true, Serial: cert.Serial})
 			}
 
+			fmt.Printf("Request %s approved: issued certificate %s (serial %s, valid until %s)\n",
+				id, req.CommonName, cert.Serial, cert.NotAfter.Format("2006-01-02"))
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&pkiDir, "pki-dir", "secrets/pki", "Directory for PKI files")
-	cmd.Flags().StringSliceVar(&identities, "identity", nil, "Age identity files for decryption")
-	cmd.Flags().DurationVar(&validity, "validity", 365*24*time.Hour, "Validity period for renewed certs")
-	cmd.Flags().IntVar(&days, "days", 30, "Renew certs expiring within this many days")
-	cmd.Flags().BoolVar(&force, "force", false, "Force renewal even if cert is not expiring")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().StringSliceVar(&identities, "identity", defaultIdentities(), "Age identity files for decryption")
+	cmd.Flags().StringVarP(&configFile, "config", "c", "", "PKI config file (for maxValidity policy)")
+	cmd.Flags().StringVar(&validity, "validity", "90d", "Validity to issue (overrides the requested validity)")
+	cmd.Flags().StringVar(&certName, "profile", "", "Named certificate slot to store this under (default: request's certName, or \"host\")")
+	cmd.Flags().StringVar(&auditLogPath, "audit-log", "", "Path to append the approval decision as a JSON line")
+	cmd.Flags().StringVar(&decidedBy, "by", "", "Identity of the approving admin, recorded on the request and audit log")
 
 	return cmd
 }
 
-func pkiRevokeCmd() *cobra.Command {
+func pkiRequestsDenyCmd() *cobra.Command {
 	var (
-		pkiDir string
-		force  bool
+		pkiDir    string
+		reason    string
+		decidedBy string
 	)
 
 	cmd := &cobra.Command{
-		Use:   "revoke <hostname>",
-		Short: "Revoke a host certificate",
-		Long: `Revoke a host certificate by removing it from the PKI store.
-
-This removes the certificate and key files for the specified host.
-The certificate will no longer be deployed to the host.
-
-Examples:
-  nixfleet pki revoke oldhost
-  nixfleet pki revoke --force oldhost  # Skip confirmation`,
-		Args: cobra.ExactArgs(1),
+		Use:   "deny <request-id>",
+		Short: "Deny a pending certificate request",
+		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
-			hostname := args[0]
+			id := args[0]
 
 			store := pki.NewStore(pkiDir, nil, nil)
-
-			// Check if cert exists
-			if !store.HostCertExists(hostname) {
-				return fmt.Errorf("no certificate found for %s", hostname)
-			}
-
-			// Get cert info for confirmation
-			info, err := store.GetCertInfo(hostname)
+			req, err := store.LoadRequest(id)
 			if err != nil {
-				return fmt.Errorf("reading certificate: %w", err)
+				return err
 			}
-
-			if !force {
-				fmt.Printf("Certificate for %s:\n", hostname)
-				fmt.Printf("  Serial: %s\n", info.Serial)
-				fmt.Printf("  Expires: %s (%d days)\n", info.NotAfter.Format("2006-01-02"), info.DaysLeft)
-				fmt.Printf("\nThis will permanently remove this certificate.\n")
-				fmt.Printf("Type 'yes' to confirm: ")
-
-				var confirm string
-				if _, err := fmt.Scanln(&confirm); err != nil || confirm != "yes" {
-					fmt.Println("Aborted")
-					return nil
-				}
+			if req.Status != pki.RequestPending {
+				return fmt.Errorf("request %s is %s, not pending", id, req.Status)
 			}
 
-			deployer := pki.NewDeployer(&pki.DeployConfig{PKIDir: pkiDir})
-			if err := deployer.RevokeCert(ctx, hostname); err != nil {
-				return fmt.Errorf("revoking certificate: %w", err)
+			req.Status = pki.RequestDenied
+			req.DecidedAt = time.Now()
+			req.DecidedBy = decidedBy
+			req.Reason = reason
+			if err := store.SaveRequest(req); err != nil {
+				return fmt.Errorf("updating request record: %w", err)
 			}
 
-			fmt.Printf("Certificate for %s has been revoked\n", hostname)
+			fmt.Printf("Request %s denied\n", id)
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&pkiDir, "pki-dir", "secrets/pki", "Directory for PKI files")
-	cmd.Flags().BoolVar(&force, "force", false, "Skip confirmation prompt")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().StringVar(&reason, "reason", "", "Reason for denial, recorded on the request")
+	cmd.Flags().StringVar(&decidedBy, "by", "", "Identity of the denying admin")
 
 	return cmd
 }
@@ -4583,11 +12978,15 @@ Commands:
 
 func pkiCertManagerServeCmd() *cobra.Command {
 	var (
-		pkiDir     string
-		identities []string
-		listenAddr string
-		tlsCert    string
-		tlsKey     string
+		pkiDir       string
+		identities   []string
+		listenAddr   string
+		tlsCert      string
+		tlsKey       string
+		clientCA     string
+		auditLog     string
+		configFile   string
+		allowReissue bool
 	)
 
 	cmd := &cobra.Command{
@@ -4600,9 +12999,18 @@ without exposing the CA private key to the Kubernetes cluster.
 
 The webhook listens for signing requests and returns signed certificates.
 
+With --client-ca set, the server also accepts mTLS-authenticated renewal
+requests from the on-host agent installed by 'pki install-agent': the
+client cert's CommonName must match the CSR's, and the CSR's SANs must
+already be on the certificate on file for that host.
+
+A CSR whose requested CommonName was revoked (see 'pki revoke') and
+hasn't since been reissued is refused unless --allow-reissue is set.
+
 Examples:
   nixfleet pki certmanager serve
-  nixfleet pki certmanager serve --listen :8443 --tls-cert server.crt --tls-key server.key`,
+  nixfleet pki certmanager serve --listen :8443 --tls-cert server.crt --tls-key server.key
+  nixfleet pki certmanager serve --client-ca secrets/pki/ca/root.crt --audit-log secrets/pki/audit.log`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
@@ -4617,17 +13025,34 @@ Examples:
 				return fmt.Errorf("loading CA: %w", err)
 			}
 
+			if configFile != "" {
+				pkiCfg, err := pki.LoadPKIConfig(configFile)
+				if err != nil {
+					return fmt.Errorf("loading config: %w", err)
+				}
+				ca.MaxCertValidity, err = pkiCfg.GetMaxValidity()
+				if err != nil {
+					return fmt.Errorf("parsing max validity policy: %w", err)
+				}
+			}
+
 			config := pki.DefaultCertManagerConfig()
 			config.ListenAddr = listenAddr
 			config.TLSCertFile = tlsCert
 			config.TLSKeyFile = tlsKey
+			config.ClientCAFile = clientCA
+			config.AuditLogPath = auditLog
+			config.AllowReissue = allowReissue
 
-			webhook := pki.NewCertManagerWebhook(ca, config)
+			webhook := pki.NewCertManagerWebhook(ca, store, config)
 
 			fmt.Printf("Starting cert-manager webhook server on %s\n", listenAddr)
 			if tlsCert != "" {
 				fmt.Println("TLS enabled")
 			}
+			if clientCA != "" {
+				fmt.Println("mTLS agent renewals enabled")
+			}
 			fmt.Println("Endpoints:")
 			fmt.Println("  POST /sign   - Sign CSR")
 			fmt.Println("  GET  /health - Health check")
@@ -4636,11 +13061,15 @@ Examples:
 		},
 	}
 
-	cmd.Flags().StringVar(&pkiDir, "pki-dir", "secrets/pki", "Directory for PKI files")
-	cmd.Flags().StringSliceVar(&identities, "identity", nil, "Age identity files for decryption")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().StringSliceVar(&identities, "identity", defaultIdentities(), "Age identity files for decryption")
 	cmd.Flags().StringVar(&listenAddr, "listen", ":8443", "Address to listen on")
 	cmd.Flags().StringVar(&tlsCert, "tls-cert", "", "TLS certificate file for HTTPS")
 	cmd.Flags().StringVar(&tlsKey, "tls-key", "", "TLS key file for HTTPS")
+	cmd.Flags().StringVar(&clientCA, "client-ca", "", "CA certificate to verify on-host agent client certs (enables mTLS agent renewals)")
+	cmd.Flags().StringVar(&auditLog, "audit-log", "", "Path to append agent-renewal signing decisions as JSON lines")
+	cmd.Flags().StringVarP(&configFile, "config", "c", "", "PKI config file (for maxValidity policy)")
+	cmd.Flags().BoolVar(&allowReissue, "allow-reissue", false, "Allow signing a CSR for a revoked-and-not-reissued hostname")
 
 	return cmd
 }
@@ -4767,8 +13196,8 @@ Examples:
 		},
 	}
 
-	cmd.Flags().StringVar(&pkiDir, "pki-dir", "secrets/pki", "Directory for PKI files")
-	cmd.Flags().StringSliceVar(&identities, "identity", nil, "Age identity files for decryption")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().StringSliceVar(&identities, "identity", defaultIdentities(), "Age identity files for decryption")
 	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Kubernetes namespace (default: cert-manager for CA, default for certs)")
 	cmd.Flags().StringVar(&secretName, "secret-name", "", "Secret name (auto-generated if not specified)")
 	cmd.Flags().BoolVar(&exportCA, "ca", false, "Export root CA certificate")
@@ -4973,8 +13402,8 @@ Examples:
 	}
 
 	cmd.Flags().StringVarP(&configFile, "config", "c", "", "PKI config file")
-	cmd.Flags().StringVar(&pkiDir, "pki-dir", "secrets/pki", "Directory for PKI files")
-	cmd.Flags().StringSliceVar(&identities, "identity", nil, "Age identity files for decryption")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().StringSliceVar(&identities, "identity", defaultIdentities(), "Age identity files for decryption")
 	cmd.Flags().StringVar(&schedule, "schedule", "daily", "Timer schedule (systemd calendar format)")
 	cmd.Flags().StringVar(&unitName, "unit-name", "nixfleet-pki-renew", "Name for systemd units")
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview units without installing")
@@ -5012,65 +13441,357 @@ Examples:
 			if err := os.Remove(timerPath); err != nil && !os.IsNotExist(err) {
 				return fmt.Errorf("removing timer file: %w", err)
 			}
-			if err := os.Remove(servicePath); err != nil && !os.IsNotExist(err) {
-				return fmt.Errorf("removing service file: %w", err)
+			if err := os.Remove(servicePath); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("removing service file: %w", err)
+			}
+			fmt.Printf("Removed %s\n", servicePath)
+			fmt.Printf("Removed %s\n", timerPath)
+
+			// Reload systemd
+			if err := exec.Command("systemctl", "daemon-reload").Run(); err != nil {
+				return fmt.Errorf("systemctl daemon-reload: %w", err)
+			}
+			fmt.Println("Reloaded systemd daemon")
+
+			fmt.Println()
+			fmt.Println("Certificate rotation timer removed.")
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&unitName, "unit-name", "nixfleet-pki-renew", "Name of systemd units to remove")
+
+	return cmd
+}
+
+func pkiInstallAgentCmd() *cobra.Command {
+	var (
+		pkiDir      string
+		identities  []string
+		destDir     string
+		webhookURL  string
+		reloadUnits []string
+		schedule    string
+		unitName    string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "install-agent",
+		Short: "Install the on-host renewal agent for short-lived certificates",
+		Long: `Deploy a renewal script and systemd timer to hosts that renews their
+own certificate locally, without the operator machine's involvement.
+
+Before expiry, the agent generates a new key and CSR and calls the fleet's
+certmanager webhook's /sign endpoint over mTLS, authenticating with the
+certificate it's about to replace. The webhook (run with 'pki certmanager
+serve --client-ca ...') only allows a host to renew its own certificate.
+
+This is meant for short-lived certificates (e.g. 24h) where the central
+'pki renew' + 'pki deploy' push, run daily at best, is too slow.
+
+Examples:
+  nixfleet pki install-agent -H web-1 --webhook-url https://ca.example.com:8443/sign
+  nixfleet pki install-agent --reload-unit nginx --reload-unit myapp`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if webhookURL == "" {
+				return fmt.Errorf("--webhook-url is required")
+			}
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			store := pki.NewStore(pkiDir, nil, identities)
+			if !store.CAExists() {
+				return fmt.Errorf("CA not initialized. Run 'nixfleet pki init' first")
+			}
+
+			deployer := pki.NewDeployer(&pki.DeployConfig{
+				PKIDir:     pkiDir,
+				DestDir:    destDir,
+				Identities: identities,
+			})
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			spec := pki.DefaultAgentInstallSpec()
+			spec.WebhookURL = webhookURL
+			spec.DestDir = destDir
+			spec.ReloadUnits = reloadUnits
+			spec.Schedule = schedule
+			spec.UnitName = unitName
+
+			successCount := 0
+			failedCount := 0
+
+			for _, host := range hosts {
+				if !store.HostCertExists(host.Name) {
+					fmt.Printf("%s: no certificate on file, run 'nixfleet pki issue %s' first\n", host.Name, host.Name)
+					failedCount++
+					continue
+				}
+
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("%s: connection failed: %v\n", host.Name, err)
+					failedCount++
+					continue
+				}
+
+				if err := deployer.InstallAgent(ctx, client, host, spec); err != nil {
+					fmt.Printf("%s: %v\n", host.Name, err)
+					failedCount++
+					continue
+				}
+
+				fmt.Printf("%s: renewal agent installed (%s.timer)\n", host.Name, unitName)
+				successCount++
+			}
+
+			fmt.Printf("Summary: %d succeeded, %d failed\n", successCount, failedCount)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().StringSliceVar(&identities, "identity", defaultIdentities(), "Age identity files for decrypting host keys")
+	cmd.Flags().StringVar(&destDir, "dest-dir", "/etc/nixfleet/pki", "Directory on hosts containing host.crt/host.key/ca.crt")
+	cmd.Flags().StringVar(&webhookURL, "webhook-url", "", "URL of the certmanager webhook's /sign endpoint (required)")
+	cmd.Flags().StringSliceVar(&reloadUnits, "reload-unit", nil, "systemd unit(s) to reload after a successful renewal")
+	cmd.Flags().StringVar(&schedule, "schedule", "daily", "Renewal check schedule (systemd calendar format)")
+	cmd.Flags().StringVar(&unitName, "unit-name", "nixfleet-pki-agent", "Name for the on-host systemd units")
+
+	return cmd
+}
+
+// =============================================================================
+// k0s Commands - Kubernetes cluster management
+// =============================================================================
+
+func k0sCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "k0s",
+		Short: "Kubernetes cluster management with k0s",
+		Long: `Manage k0s Kubernetes clusters across your fleet.
+
+The k0s integration works in two modes:
+  1. Controller init (manual): Bootstrap cluster and generate join tokens
+  2. Worker join (pull-mode): Workers auto-join using encrypted tokens
+
+Workflow:
+  1. nixfleet k0s init -H controller-host    # Bootstrap controller
+  2. nixfleet k0s certmanager -H controller  # Deploy Fleet CA for TLS
+  3. Add worker hosts to config with role=worker
+  4. Workers auto-join on next pull
+
+Commands:
+  init         - Bootstrap k0s controller and generate join tokens
+  status       - Show cluster status
+  upgrade      - Upgrade the k0s binary across the fleet, controllers first
+  kubeconfig   - Fetch admin kubeconfig from controller
+  certmanager  - Deploy Fleet CA to cert-manager for TLS certificates
+  token        - Generate new join tokens
+  rekey        - Re-encrypt tokens with new recipients
+  images       - Manage airgapped image bundles for registry-less clusters
+  reconcile    - Apply per-node kubelet/containerd config from fleet config`,
+	}
+
+	cmd.AddCommand(k0sInitCmd())
+	cmd.AddCommand(k0sStatusCmd())
+	cmd.AddCommand(k0sUpgradeCmd())
+	cmd.AddCommand(k0sReconcileCmd())
+	cmd.AddCommand(k0sRekeyCmd())
+	cmd.AddCommand(k0sTokenCmd())
+	cmd.AddCommand(k0sKubeconfigCmd())
+	cmd.AddCommand(k0sCertManagerCmd())
+	cmd.AddCommand(k0sImagesCmd())
+
+	return cmd
+}
+
+func k0sImagesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "images",
+		Short: "Manage airgapped image bundles",
+		Long: `Build and distribute OCI image bundles for k0s clusters with no
+registry pull access (Docker Hub, ghcr, etc).
+
+Commands:
+  bundle - Resolve chart/manifest images and pull+export them to a tar
+  push   - Upload a bundle to a host and load it into containerd`,
+	}
+
+	cmd.AddCommand(k0sImagesBundleCmd())
+	cmd.AddCommand(k0sImagesPushCmd())
+
+	return cmd
+}
+
+func k0sImagesBundleCmd() *cobra.Command {
+	var (
+		fromFile   string
+		outputFile string
+		includeK0s bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Resolve and pull the images used by a set of Helm charts into an OCI archive",
+		Long: `Resolve the image references used by the Helm charts in an addons file
+(via 'helm template'), optionally add the k0s system images for the
+locally installed k0s version, pull them all with 'ctr images pull',
+and export them as a single OCI archive.
+
+Requires 'helm' and 'ctr' (containerd) on the machine running this
+command.
+
+Examples:
+  nixfleet k0s images bundle --from k0s-addons.yaml --output images.tar`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if fromFile == "" {
+				return fmt.Errorf("--from is required")
+			}
+			if outputFile == "" {
+				return fmt.Errorf("--output is required")
+			}
+
+			addons, err := k0s.LoadAddonsFile(fromFile)
+			if err != nil {
+				return err
+			}
+
+			imageSet := make(map[string]bool)
+			for _, chart := range addons.Charts {
+				fmt.Printf("Resolving images for chart %s (%s)...\n", chart.Name, chart.ChartName)
+				images, err := k0s.ResolveChartImages(chart.ChartName, chart.Version, chart.Namespace, chart.Values)
+				if err != nil {
+					return fmt.Errorf("chart %s: %w", chart.Name, err)
+				}
+				for _, img := range images {
+					imageSet[img] = true
+				}
+			}
+
+			if includeK0s {
+				sysImages, err := k0s.SystemImages()
+				if err != nil {
+					return fmt.Errorf("listing k0s system images: %w", err)
+				}
+				if len(sysImages) == 0 {
+					fmt.Println("Warning: could not list k0s system images locally (is k0s installed?), skipping")
+				}
+				for _, img := range sysImages {
+					imageSet[img] = true
+				}
 			}
-			fmt.Printf("Removed %s\n", servicePath)
-			fmt.Printf("Removed %s\n", timerPath)
 
-			// Reload systemd
-			if err := exec.Command("systemctl", "daemon-reload").Run(); err != nil {
-				return fmt.Errorf("systemctl daemon-reload: %w", err)
+			images := make([]string, 0, len(imageSet))
+			for img := range imageSet {
+				images = append(images, img)
 			}
-			fmt.Println("Reloaded systemd daemon")
+			sort.Strings(images)
 
-			fmt.Println()
-			fmt.Println("Certificate rotation timer removed.")
+			fmt.Printf("Pulling and bundling %d image(s)...\n", len(images))
+			result, err := k0s.BuildBundle(images, outputFile)
+			if err != nil {
+				return err
+			}
 
+			fmt.Printf("\nBundle written: %s\n", result.OutputPath)
+			fmt.Printf("SHA-256:        %s\n", result.SHA256)
+			fmt.Printf("Images:         %d\n", len(result.Images))
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&unitName, "unit-name", "nixfleet-pki-renew", "Name of systemd units to remove")
+	cmd.Flags().StringVar(&fromFile, "from", "", "Addons file listing Helm charts to resolve images for (required)")
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output path for the OCI image archive (required)")
+	cmd.Flags().BoolVar(&includeK0s, "include-k0s-images", true, "Include k0s system images for the locally installed k0s version")
 
 	return cmd
 }
 
-// =============================================================================
-// k0s Commands - Kubernetes cluster management
-// =============================================================================
+func k0sImagesPushCmd() *cobra.Command {
+	var bundlePath string
 
-func k0sCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "k0s",
-		Short: "Kubernetes cluster management with k0s",
-		Long: `Manage k0s Kubernetes clusters across your fleet.
+		Use:   "push",
+		Short: "Upload an image bundle to a host and load it into containerd",
+		Long: `Upload an OCI image bundle produced by 'nixfleet k0s images bundle' to
+/var/lib/k0s/images/ on a host, verifying the transfer with a SHA-256
+checksum. Interrupted transfers resume rather than restarting the
+multi-GB copy.
 
-The k0s integration works in two modes:
-  1. Controller init (manual): Bootstrap cluster and generate join tokens
-  2. Worker join (pull-mode): Workers auto-join using encrypted tokens
+Examples:
+  nixfleet k0s images push -H worker1 --bundle images.tar`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 
-Workflow:
-  1. nixfleet k0s init -H controller-host    # Bootstrap controller
-  2. nixfleet k0s certmanager -H controller  # Deploy Fleet CA for TLS
-  3. Add worker hosts to config with role=worker
-  4. Workers auto-join on next pull
+			if bundlePath == "" {
+				return fmt.Errorf("--bundle is required")
+			}
 
-Commands:
-  init         - Bootstrap k0s controller and generate join tokens
-  status       - Show cluster status
-  kubeconfig   - Fetch admin kubeconfig from controller
-  certmanager  - Deploy Fleet CA to cert-manager for TLS certificates
-  token        - Generate new join tokens
-  rekey        - Re-encrypt tokens with new recipients`,
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+
+			stateMgr := state.NewManager()
+			name := filepath.Base(bundlePath)
+
+			for _, host := range hosts {
+				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
+				if err != nil {
+					fmt.Printf("%s: connection failed: %v\n", host.Name, err)
+					continue
+				}
+
+				fmt.Printf("%s: uploading %s...\n", host.Name, name)
+				result, err := k0s.PushBundle(ctx, client, bundlePath, name)
+				if err != nil {
+					fmt.Printf("%s: upload failed: %v\n", host.Name, err)
+					continue
+				}
+				if result.Resumed {
+					fmt.Printf("%s: resumed upload, sent %d new byte(s)\n", host.Name, result.BytesSent)
+				}
+
+				fmt.Printf("%s: loading bundle into containerd...\n", host.Name)
+				if err := k0s.LoadBundle(ctx, client, name); err != nil {
+					fmt.Printf("%s: load failed: %v\n", host.Name, err)
+					continue
+				}
+
+				hostState, err := stateMgr.ReadState(ctx, client)
+				if err != nil {
+					hostState = state.NewHostState(host.Name, "")
+				}
+				if hostState.K0s == nil {
+					hostState.K0s = &state.K0sState{}
+				}
+				hostState.K0s.LoadedImageBundle = result.SHA256
+				if err := stateMgr.WriteState(ctx, client, hostState); err != nil {
+					fmt.Printf("%s: warning: failed to record loaded bundle hash: %v\n", host.Name, err)
+				}
+
+				fmt.Printf("%s: loaded bundle %s\n", host.Name, result.SHA256[:16])
+			}
+
+			return nil
+		},
 	}
 
-	cmd.AddCommand(k0sInitCmd())
-	cmd.AddCommand(k0sStatusCmd())
-	cmd.AddCommand(k0sRekeyCmd())
-	cmd.AddCommand(k0sTokenCmd())
-	cmd.AddCommand(k0sKubeconfigCmd())
-	cmd.AddCommand(k0sCertManagerCmd())
+	cmd.Flags().StringVar(&bundlePath, "bundle", "", "Path to the local image bundle tar (required)")
 
 	return cmd
 }
@@ -5119,6 +13840,7 @@ Examples:
 
 			// Connect via SSH
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
 			client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
@@ -5230,7 +13952,7 @@ Prerequisites:
 Example:
   nixfleet k0s init -H gtr --cluster stigen-fleet --san k8s.stigen.ai`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
+			ctx := ssh.WithOperation(cmd.Context(), "k0s init")
 
 			if targetHost == "" {
 				return fmt.Errorf("--host is required")
@@ -5261,6 +13983,7 @@ Example:
 			// Get SSH host keys from all hosts and convert to age keys
 			fmt.Println("Collecting age recipients from inventory hosts...")
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
 			for _, h := range inv.Hosts {
@@ -5610,7 +14333,7 @@ spec:
 	cmd.Flags().StringVar(&podCIDR, "pod-cidr", "10.244.0.0/16", "Pod CIDR")
 	cmd.Flags().StringVar(&serviceCIDR, "service-cidr", "10.96.0.0/12", "Service CIDR")
 	cmd.Flags().StringSliceVarP(&recipients, "recipient", "r", nil, "Age recipients for token encryption")
-	cmd.Flags().StringSliceVar(&identities, "identity", nil, "Age identity files for decryption")
+	cmd.Flags().StringSliceVar(&identities, "identity", defaultIdentities(), "Age identity files for decryption")
 	cmd.Flags().BoolVar(&enableWorker, "enable-worker", true, "Also run as worker (controller+worker mode)")
 	cmd.Flags().StringVar(&tokenExpiry, "token-expiry", "8760h", "Token expiry (default 1 year)")
 	cmd.Flags().BoolVar(&commitChanges, "commit", true, "Commit changes to git")
@@ -5632,12 +14355,13 @@ Examples:
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			inv, hosts, err := loadInventoryAndHosts(ctx)
 			if err != nil {
 				return err
 			}
 
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
 			reconciler := k0s.NewReconciler()
@@ -5674,7 +14398,31 @@ Examples:
 							if !node.Ready {
 								readyStr = "NotReady"
 							}
-							fmt.Printf("  - %s: %s\n", node.Name, readyStr)
+							profileStr := ""
+							if node.Profile != "" && node.Profile != "default" {
+								profileStr = fmt.Sprintf(" [profile: %s]", node.Profile)
+							}
+							if node.Version != "" {
+								fmt.Printf("  - %s: %s (%s)%s\n", node.Name, readyStr, node.Version, profileStr)
+							} else {
+								fmt.Printf("  - %s: %s%s\n", node.Name, readyStr, profileStr)
+							}
+
+							if nodeHost, ok := inv.GetHost(node.Name); ok && (len(nodeHost.K0sNodeConfig.NodeLabels) > 0 || len(nodeHost.K0sNodeConfig.NodeTaints) > 0) {
+								wantTaints := make([]k0s.Taint, len(nodeHost.K0sNodeConfig.NodeTaints))
+								for i, t := range nodeHost.K0sNodeConfig.NodeTaints {
+									wantTaints[i] = k0s.Taint{Key: t.Key, Value: t.Value, Effect: t.Effect}
+								}
+								if mismatched := node.LabelMismatches(nodeHost.K0sNodeConfig.NodeLabels); len(mismatched) > 0 {
+									fmt.Printf("    Warning: label mismatch, not yet applied: %v (run 'nixfleet k0s reconcile')\n", mismatched)
+								}
+								if mismatched := node.TaintMismatches(wantTaints); len(mismatched) > 0 {
+									fmt.Printf("    Warning: taint mismatch, not yet applied: %v (run 'nixfleet k0s reconcile')\n", mismatched)
+								}
+							}
+						}
+						if k0sStatus.MixedVersions {
+							fmt.Println("  Warning: nodes span more than one minor version - upgrade may be incomplete (see 'nixfleet k0s upgrade --plan')")
 						}
 					}
 
@@ -5707,6 +14455,9 @@ Examples:
 						if !k0sState.LastReconcile.IsZero() {
 							fmt.Printf("  Last Reconcile: %s\n", k0sState.LastReconcile.Format("2006-01-02 15:04:05"))
 						}
+						if k0sState.LoadedImageBundle != "" {
+							fmt.Printf("  Loaded Image Bundle: %s\n", k0sState.LoadedImageBundle[:16])
+						}
 
 						if len(k0sState.HelmCharts) > 0 {
 							fmt.Printf("  Tracked Charts: %d\n", len(k0sState.HelmCharts))
@@ -5734,6 +14485,317 @@ Examples:
 	return cmd
 }
 
+func k0sUpgradeCmd() *cobra.Command {
+	var (
+		version     string
+		plan        bool
+		waitTimeout time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "upgrade",
+		Short: "Upgrade the k0s binary across the fleet",
+		Long: `Upgrade k0s to the given version in the documented safe order:
+controllers first (one at a time - stop k0s, replace the binary after
+verifying its checksum, start, wait for the API server and etcd to report
+healthy), then workers (cordon, drain, replace the binary, restart, wait
+Ready, uncordon).
+
+Use --plan to print the upgrade order and current -> target versions for
+each node without making any changes.
+
+Progress is recorded on each host's state, so an interrupted upgrade can be
+resumed by re-running the same command - nodes already upgraded to
+--version are skipped.
+
+Example:
+  nixfleet k0s upgrade --group k8s --version v1.30.1+k0s.0 --plan
+  nixfleet k0s upgrade --group k8s --version v1.30.1+k0s.0`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if version == "" {
+				return fmt.Errorf("--version is required")
+			}
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+			stateMgr := state.NewManager()
+
+			type upgradeNode struct {
+				host    *inventory.Host
+				client  *ssh.Client
+				role    string
+				current string
+			}
+
+			var controllers, workers []upgradeNode
+			for _, h := range hosts {
+				client, err := pool.GetWithUser(ctx, h.Addr, h.SSHPort, h.SSHUser)
+				if err != nil {
+					fmt.Printf("%s: connection failed: %v\n", h.Name, err)
+					continue
+				}
+				role, err := k0s.NodeRole(ctx, client)
+				if err != nil || role == "" {
+					fmt.Printf("%s: k0s not running, skipping\n", h.Name)
+					continue
+				}
+				current, _ := k0s.Version(ctx, client)
+				n := upgradeNode{host: h, client: client, role: role, current: current}
+				if role == k0s.RoleController {
+					controllers = append(controllers, n)
+				} else {
+					workers = append(workers, n)
+				}
+			}
+
+			if len(controllers) == 0 && len(workers) == 0 {
+				return fmt.Errorf("no k0s nodes found among target hosts")
+			}
+
+			if plan {
+				fmt.Println("Upgrade plan (controllers first, then workers):")
+				i := 1
+				for _, n := range append(append([]upgradeNode{}, controllers...), workers...) {
+					fmt.Printf("  %d. %-20s %-10s %s -> %s\n", i, n.host.Name, n.role, n.current, version)
+					i++
+				}
+				return nil
+			}
+
+			if len(controllers) == 0 {
+				return fmt.Errorf("no controllers found among target hosts; refusing to upgrade workers without a controller to drain against")
+			}
+			primaryController := controllers[0].client
+
+			upgradeOne := func(n upgradeNode) error {
+				hostState, err := stateMgr.ReadState(ctx, n.client)
+				if err != nil {
+					hostState = state.NewHostState(n.host.Name, n.host.Base)
+				}
+				if hostState.K0sUpgrade != nil && hostState.K0sUpgrade.TargetVersion == version && hostState.K0sUpgrade.Done {
+					fmt.Printf("%s: already upgraded to %s, skipping\n", n.host.Name, version)
+					return nil
+				}
+
+				fmt.Printf("%s (%s): upgrading %s -> %s\n", n.host.Name, n.role, n.current, version)
+				hostState.K0sUpgrade = &state.K0sUpgradeState{
+					TargetVersion: version,
+					FromVersion:   n.current,
+					Role:          n.role,
+					StartedAt:     time.Now(),
+				}
+				_ = stateMgr.WriteState(ctx, n.client, hostState)
+
+				fail := func(err error) error {
+					hostState.K0sUpgrade.Error = err.Error()
+					_ = stateMgr.WriteState(ctx, n.client, hostState)
+					return err
+				}
+
+				if n.role == k0s.RoleWorker {
+					if err := k0s.CordonNode(ctx, primaryController, n.host.Name); err != nil {
+						return fail(fmt.Errorf("cordoning: %w", err))
+					}
+					if err := k0s.DrainNode(ctx, primaryController, n.host.Name); err != nil {
+						return fail(fmt.Errorf("draining: %w", err))
+					}
+				}
+
+				if err := k0s.UpgradeBinary(ctx, n.client, n.role, version); err != nil {
+					return fail(err)
+				}
+
+				if n.role == k0s.RoleController {
+					if err := k0s.WaitForAPIHealthy(ctx, n.client, waitTimeout); err != nil {
+						return fail(err)
+					}
+					if err := k0s.WaitForEtcdHealthy(ctx, n.client, waitTimeout); err != nil {
+						return fail(err)
+					}
+				} else {
+					if err := k0s.WaitForNodeReady(ctx, primaryController, n.host.Name, waitTimeout); err != nil {
+						return fail(err)
+					}
+					if err := k0s.UncordonNode(ctx, primaryController, n.host.Name); err != nil {
+						return fail(fmt.Errorf("uncordoning: %w", err))
+					}
+				}
+
+				hostState.K0sUpgrade.Done = true
+				hostState.K0sUpgrade.CompletedAt = time.Now()
+				hostState.K0sUpgrade.Error = ""
+				if err := stateMgr.WriteState(ctx, n.client, hostState); err != nil {
+					return fmt.Errorf("recording upgrade state: %w", err)
+				}
+
+				fmt.Printf("%s: upgraded successfully\n", n.host.Name)
+				return nil
+			}
+
+			for _, n := range controllers {
+				if err := upgradeOne(n); err != nil {
+					return fmt.Errorf("upgrading controller %s: %w (re-run with the same --version to resume)", n.host.Name, err)
+				}
+			}
+			for _, n := range workers {
+				if err := upgradeOne(n); err != nil {
+					return fmt.Errorf("upgrading worker %s: %w (re-run with the same --version to resume)", n.host.Name, err)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&version, "version", "", "Target k0s version (e.g. v1.30.1+k0s.0)")
+	cmd.Flags().BoolVar(&plan, "plan", false, "Print the upgrade order and versions without making changes")
+	cmd.Flags().DurationVar(&waitTimeout, "wait-timeout", 5*time.Minute, "How long to wait for API/etcd/node health after each node's binary is replaced")
+
+	return cmd
+}
+
+func k0sReconcileCmd() *cobra.Command {
+	var pruneLabels bool
+
+	cmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Apply per-node kubelet/containerd config from fleet config",
+		Long: `Reconcile each target host's k0s_node_config - kubelet overrides (via a
+k0s WorkerProfile and node label), node labels/taints, and containerd
+registry mirror/auth entries - against what's actually running, restarting
+the affected service only when content changed (label/taint changes never
+trigger a restart) and waiting for the node to report Ready again
+afterwards.
+
+Kubelet overrides, labels, and taints are patched through a controller's
+admin kubeconfig, so at least one controller must be present among the
+target hosts even when reconciling only worker nodes.
+
+Example:
+  nixfleet k0s reconcile --group k8s`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			inv, hosts, err := loadInventoryAndHosts(ctx)
+			if err != nil {
+				return err
+			}
+
+			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
+			defer pool.Close()
+			stateMgr := state.NewManager()
+			reconciler := k0s.NewReconciler()
+
+			type reconcileNode struct {
+				host   *inventory.Host
+				client *ssh.Client
+				role   string
+			}
+
+			var controllers, workers []reconcileNode
+			for _, h := range hosts {
+				client, err := pool.GetWithUser(ctx, h.Addr, h.SSHPort, h.SSHUser)
+				if err != nil {
+					fmt.Printf("%s: connection failed: %v\n", h.Name, err)
+					continue
+				}
+				role, err := k0s.NodeRole(ctx, client)
+				if err != nil || role == "" {
+					fmt.Printf("%s: k0s not running, skipping\n", h.Name)
+					continue
+				}
+				n := reconcileNode{host: h, client: client, role: role}
+				if role == k0s.RoleController {
+					controllers = append(controllers, n)
+				} else {
+					workers = append(workers, n)
+				}
+			}
+
+			if len(controllers) == 0 {
+				return fmt.Errorf("no controllers found among target hosts; refusing to reconcile without a controller to patch WorkerProfiles against")
+			}
+			primaryController := controllers[0].client
+
+			reconcileOne := func(n reconcileNode) error {
+				if !n.host.K0sNodeConfig.HasOverrides() {
+					fmt.Printf("%s: no node config overrides, skipping\n", n.host.Name)
+					return nil
+				}
+
+				cfg := k0s.NodeConfig{
+					Profile:              n.host.K0sNodeConfig.Profile,
+					KubeletOverrides:     n.host.K0sNodeConfig.KubeletOverrides,
+					ContainerdRegistries: make([]k0s.ContainerdRegistryMirror, len(n.host.K0sNodeConfig.ContainerdRegistries)),
+					NodeLabels:           n.host.K0sNodeConfig.NodeLabels,
+					NodeTaints:           make([]k0s.Taint, len(n.host.K0sNodeConfig.NodeTaints)),
+					PruneLabels:          pruneLabels || n.host.K0sNodeConfig.PruneLabels,
+				}
+				for i, m := range n.host.K0sNodeConfig.ContainerdRegistries {
+					cfg.ContainerdRegistries[i] = k0s.ContainerdRegistryMirror{
+						Registry:  m.Registry,
+						Endpoints: m.Endpoints,
+						Username:  m.Username,
+						Password:  m.Password,
+					}
+				}
+				for i, t := range n.host.K0sNodeConfig.NodeTaints {
+					cfg.NodeTaints[i] = k0s.Taint{Key: t.Key, Value: t.Value, Effect: t.Effect}
+				}
+
+				result, err := reconciler.ReconcileNodeConfig(ctx, primaryController, n.client, n.host.Name, n.role, cfg)
+				if result != nil {
+					for path, fs := range result.ManagedFiles {
+						if err := stateMgr.UpdateManagedFile(ctx, n.client, fs); err != nil {
+							fmt.Printf("%s: warning: failed to record managed file %s: %v\n", n.host.Name, path, err)
+						}
+					}
+				}
+				if err != nil {
+					return err
+				}
+
+				if !result.WorkerProfileChanged && len(result.ContainerdChanged) == 0 &&
+					len(result.LabelsChanged) == 0 && !result.TaintsChanged &&
+					len(result.PrunedLabels) == 0 && len(result.PrunedTaints) == 0 {
+					fmt.Printf("%s: already up to date\n", n.host.Name)
+					return nil
+				}
+				fmt.Printf("%s: reconciled (profile changed: %v, containerd changed: %v, labels changed: %v, taints changed: %v, restarted: %v)\n",
+					n.host.Name, result.WorkerProfileChanged, result.ContainerdChanged, result.LabelsChanged, result.TaintsChanged, result.Restarted)
+				if len(result.PrunedLabels) > 0 {
+					fmt.Printf("%s: pruned out-of-band labels: %v\n", n.host.Name, result.PrunedLabels)
+				}
+				if len(result.PrunedTaints) > 0 {
+					fmt.Printf("%s: pruned out-of-band taints: %v\n", n.host.Name, result.PrunedTaints)
+				}
+				return nil
+			}
+
+			for _, n := range append(append([]reconcileNode{}, controllers...), workers...) {
+				if err := reconcileOne(n); err != nil {
+					return fmt.Errorf("reconciling %s: %w", n.host.Name, err)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&pruneLabels, "prune-labels", false, "Remove labels/taints present on a node but not declared in its k0s_node_config, in addition to any host that sets prune_labels itself (never touches protected system prefixes like node.kubernetes.io)")
+
+	return cmd
+}
+
 func k0sRekeyCmd() *cobra.Command {
 	var (
 		recipients []string
@@ -5775,6 +14837,7 @@ Example:
 				}
 
 				pool := ssh.NewPool(nil)
+				_, _ = pool.EnableSSHConfig(inv)
 				defer pool.Close()
 
 				client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
@@ -5846,7 +14909,7 @@ Example:
 	}
 
 	cmd.Flags().StringSliceVarP(&recipients, "recipient", "r", nil, "Age recipients to add")
-	cmd.Flags().StringSliceVar(&identities, "identity", nil, "Age identity files for decryption")
+	cmd.Flags().StringSliceVar(&identities, "identity", defaultIdentities(), "Age identity files for decryption")
 	cmd.Flags().StringVar(&addHost, "add-host", "", "Add a host from inventory as recipient")
 
 	return cmd
@@ -5872,7 +14935,7 @@ Use this to rotate tokens or generate tokens with different expiry.`,
 				return fmt.Errorf("--host is required (specify the controller)")
 			}
 
-			_, hosts, err := loadInventoryAndHosts(ctx)
+			inv, hosts, err := loadInventoryAndHosts(ctx)
 			if err != nil {
 				return err
 			}
@@ -5883,6 +14946,7 @@ Use this to rotate tokens or generate tokens with different expiry.`,
 			host := hosts[0]
 
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
 			client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
@@ -6023,6 +15087,7 @@ Examples:
 
 			// Connect via SSH
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
 			client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
@@ -6079,8 +15144,8 @@ Examples:
 	}
 
 	cmd.Flags().StringVarP(&hostName, "host", "H", "", "Controller host name (required)")
-	cmd.Flags().StringVar(&pkiDir, "pki-dir", "secrets/pki", "Directory for PKI files")
-	cmd.Flags().StringSliceVar(&identities, "identity", nil, "Age identity files for decryption")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", defaultPKIDir(), "Directory for PKI files")
+	cmd.Flags().StringSliceVar(&identities, "identity", defaultIdentities(), "Age identity files for decryption")
 	cmd.Flags().StringVar(&secretName, "secret-name", "fleet-ca", "Name for the CA secret")
 	cmd.Flags().StringVarP(&namespace, "namespace", "n", "cert-manager", "Namespace for the secret")
 	cmd.Flags().StringVar(&issuerName, "issuer-name", "fleet-ca", "ClusterIssuer name to verify")
@@ -6117,6 +15182,13 @@ func nodeStatusCmd() *cobra.Command {
 	var logFile string
 	var hostRepoPath string
 	var homeManagerPath string
+	var tlsCert string
+	var tlsKey string
+	var clientCA string
+	var clientCRL string
+	var tlsExempt []string
+	var driftCheckInterval time.Duration
+	var driftCriticalPaths []string
 
 	cmd := &cobra.Command{
 		Use:   "node-status",
@@ -6132,18 +15204,41 @@ Endpoints:
   GET /health   - Simple health check (returns 200 if healthy, 503 if not)
   GET /pull     - Pull mode status and recent log entries
   GET /state    - Current state.json information
+  GET /drift    - Most recent local managed-file drift check
 
 The server reads status from:
   - /var/lib/nixfleet/state.json - Last deployment info
   - /var/log/nixfleet/pull.log   - Pull operation logs
   - Git repositories for commit info
 
+On a timer (--drift-check-interval, default 30m), the server re-hashes the
+ManagedFiles recorded in state.json against what's actually on disk and
+updates state.json's drift fields itself, without a central server SSHing
+in to run the check. Drift on any path listed in --drift-critical-path
+makes /health report 503; drift elsewhere only degrades /status.
+
+With --tls-cert/--tls-key, the server speaks HTTPS instead of plaintext
+HTTP using a certificate from the fleet PKI (see nixfleet pki issue).
+Adding --client-ca additionally requires every request, other than
+--tls-exempt paths (default: /health), to present a client certificate
+signed by that CA - the central server's collector authenticates this way
+when scraping. The certificate is re-read from disk whenever it changes
+(also forced by SIGHUP), so a renewal never requires restarting the daemon.
+--client-crl additionally rejects the handshake if the client certificate
+has been revoked (see 'nixfleet pki revoke'); it too is re-read whenever
+the file changes, so a revocation published by 'nixfleet pki deploy' takes
+effect immediately instead of waiting for the certificate to expire.
+
 Example:
   # Run on default port 9100
   nixfleet node-status
 
   # Run on custom port with specific bind address
-  nixfleet node-status --port 8080 --bind 127.0.0.1`,
+  nixfleet node-status --port 8080 --bind 127.0.0.1
+
+  # Require mTLS from the fleet CA for everything but /health
+  nixfleet node-status --tls-cert /etc/nixfleet/pki/host.crt \
+    --tls-key /etc/nixfleet/pki/host.key --client-ca /etc/nixfleet/pki/ca.crt`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
@@ -6165,6 +15260,23 @@ Example:
 			if homeManagerPath != "" {
 				cfg.HomeManagerPath = homeManagerPath
 			}
+			cfg.DriftCheckInterval = driftCheckInterval
+			cfg.DriftCriticalPaths = driftCriticalPaths
+
+			if tlsCert != "" || tlsKey != "" {
+				if tlsCert == "" || tlsKey == "" {
+					return fmt.Errorf("--tls-cert and --tls-key must be set together")
+				}
+				cfg.TLS = &nodestatus.TLSConfig{
+					CertFile:     tlsCert,
+					KeyFile:      tlsKey,
+					ClientCAFile: clientCA,
+					CRLFile:      clientCRL,
+					ExemptPaths:  tlsExempt,
+				}
+			} else if clientCA != "" {
+				return fmt.Errorf("--client-ca requires --tls-cert and --tls-key")
+			}
 
 			srv := nodestatus.NewServer(cfg)
 			return srv.Start(ctx)
@@ -6177,6 +15289,13 @@ Example:
 	cmd.Flags().StringVar(&logFile, "log-file", "", "Pull log file (default: /var/log/nixfleet/pull.log)")
 	cmd.Flags().StringVar(&hostRepoPath, "host-repo", "", "Host config repository path (default: /var/lib/nixfleet/repo)")
 	cmd.Flags().StringVar(&homeManagerPath, "home-manager-path", "", "Home-manager dotfiles path")
+	cmd.Flags().StringVar(&tlsCert, "tls-cert", "", "This node's fleet PKI certificate, enables HTTPS")
+	cmd.Flags().StringVar(&tlsKey, "tls-key", "", "Private key matching --tls-cert")
+	cmd.Flags().StringVar(&clientCA, "client-ca", "", "Fleet CA certificate; requires a matching client cert on every request except --tls-exempt paths")
+	cmd.Flags().StringVar(&clientCRL, "client-crl", "", "Fleet CRL (deployed by 'nixfleet pki deploy' as ca.crl); rejects handshakes from a revoked client certificate")
+	cmd.Flags().StringSliceVar(&tlsExempt, "tls-exempt", []string{"/health"}, "Paths served without a client certificate")
+	cmd.Flags().DurationVar(&driftCheckInterval, "drift-check-interval", 0, "How often to re-hash managed files locally (default: 30m; negative disables)")
+	cmd.Flags().StringSliceVar(&driftCriticalPaths, "drift-critical-path", nil, "Managed-file path whose drift fails /health (may be repeated)")
 
 	return cmd
 }
@@ -6239,6 +15358,7 @@ Examples:
 
 			// SSH connect
 			pool := ssh.NewPool(nil)
+			_, _ = pool.EnableSSHConfig(inv)
 			defer pool.Close()
 
 			client, err := pool.GetWithUser(ctx, host.Addr, host.SSHPort, host.SSHUser)
@@ -0,0 +1,144 @@
+// Package api holds the wire types shared between the nixfleet server's
+// handlers (internal/server) and pkg/client's SDK - moving a response shape
+// here and having both sides reference it means a handler can't add or
+// rename a field without the client (and anyone vendoring this package)
+// seeing it at compile time, instead of at runtime against undocumented
+// JSON.
+package api
+
+import "time"
+
+// ErrorResponse is the body every handler error returns, see
+// internal/server.Server.jsonError.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Pagination describes a page of a larger result set. Page is 1-based; a
+// Page beyond the last one returns an empty slice with HasMore false rather
+// than an error.
+type Pagination struct {
+	Page    int  `json:"page"`
+	PerPage int  `json:"per_page"`
+	Total   int  `json:"total"`
+	HasMore bool `json:"has_more"`
+}
+
+// Job is the wire shape of an async server-side operation (apply,
+// drift-check, update-check, ...), returned immediately by the endpoint
+// that starts one and polled via GET /api/jobs/{id} until Status leaves
+// "pending"/"running".
+type Job struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Status    string    `json:"status"` // pending, running, completed, failed, interrupted
+	Host      string    `json:"host,omitempty"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time,omitempty"`
+	Result    any       `json:"result,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Done reports whether j has left the pending/running states.
+func (j Job) Done() bool {
+	return j.Status != "pending" && j.Status != "running"
+}
+
+// JobList is the response from GET /api/jobs.
+type JobList struct {
+	Jobs       []Job      `json:"jobs"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// HostSummary is one entry in the GET /api/hosts response - the subset of a
+// host's state cheap enough to gather for every host in the fleet in one
+// request. GetHost returns the fuller HostDetail.
+type HostSummary struct {
+	Name       string   `json:"name"`
+	Addr       string   `json:"addr"`
+	Port       int      `json:"port"`
+	Base       string   `json:"base"`
+	Roles      []string `json:"roles"`
+	SSHUser    string   `json:"ssh_user"`
+	K0sMonitor bool     `json:"k0s_monitor"`
+	Groups     []string `json:"groups"`
+
+	Online bool   `json:"online"`
+	Error  string `json:"error,omitempty"`
+
+	// Since and Availability24h come from the background prober, when one
+	// is running - see internal/server.Prober.Get.
+	Since           time.Time `json:"since,omitempty"`
+	Availability24h float64   `json:"availability_24h,omitempty"`
+
+	DriftDetected  bool      `json:"drift_detected,omitempty"`
+	LastApply      time.Time `json:"last_apply,omitempty"`
+	LastDriftCheck time.Time `json:"last_drift_check,omitempty"`
+	Generation     int       `json:"generation,omitempty"`
+	Healthy        bool      `json:"healthy,omitempty"`
+	PullMode       bool      `json:"pull_mode,omitempty"`
+}
+
+// HostList is the response from GET /api/hosts.
+type HostList struct {
+	Hosts []HostSummary `json:"hosts"`
+}
+
+// PullModeStatus is a host's pull-mode install/timer status, embedded in
+// HostDetail and returned per-host by GET /api/pull-mode/status.
+type PullModeStatus struct {
+	Installed     bool   `json:"installed"`
+	TimerActive   bool   `json:"timer_active,omitempty"`
+	LastRun       string `json:"last_run,omitempty"`
+	LastResult    string `json:"last_result,omitempty"`
+	NextRun       string `json:"next_run,omitempty"`
+	CurrentCommit string `json:"current_commit,omitempty"`
+}
+
+// HostDetail is the response from GET /api/hosts/{name}.
+type HostDetail struct {
+	Name       string   `json:"name"`
+	Addr       string   `json:"addr"`
+	Port       int      `json:"port"`
+	Base       string   `json:"base"`
+	SSHUser    string   `json:"ssh_user"`
+	Roles      []string `json:"roles"`
+	Online     bool     `json:"online"`
+	Error      string   `json:"error,omitempty"`
+	Generation int      `json:"generation,omitempty"`
+	StorePath  string   `json:"store_path,omitempty"`
+	Reboot     bool     `json:"reboot,omitempty"`
+	PullMode   bool     `json:"pull_mode"`
+	K0sMonitor bool     `json:"k0s_monitor"`
+
+	PullModeStatus *PullModeStatus `json:"pull_mode_status,omitempty"`
+	State          map[string]any  `json:"state,omitempty"`
+	// Override is the host's HostOverride (internal/server), if any - left
+	// as any here since pkg/api can't import internal/server without a
+	// cycle and the client only needs to round-trip it as JSON.
+	Override any `json:"override,omitempty"`
+}
+
+// PullModeHostStatus is one entry in the GET /api/pull-mode/status response.
+type PullModeHostStatus struct {
+	Host   string `json:"host"`
+	Online bool   `json:"online"`
+	Error  string `json:"error,omitempty"`
+	PullModeStatus
+}
+
+// DriftHostStatus is one entry in the GET /api/drift response.
+type DriftHostStatus struct {
+	Host          string    `json:"host"`
+	Online        bool      `json:"online"`
+	Error         string    `json:"error,omitempty"`
+	DriftDetected bool      `json:"drift_detected,omitempty"`
+	DriftFiles    []string  `json:"drift_files,omitempty"`
+	LastCheck     time.Time `json:"last_check,omitempty"`
+}
+
+// DriftFixResult is the response from POST /api/drift/fix.
+type DriftFixResult struct {
+	Fixed   int `json:"fixed"`
+	Checked int `json:"checked"`
+}
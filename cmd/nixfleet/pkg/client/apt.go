@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/nixfleet/nixfleet/internal/apt"
+)
+
+// AptUpdates checks for pending apt updates on host name (GET
+// /api/hosts/{name}/apt/updates).
+func (c *Client) AptUpdates(ctx context.Context, name string) (*apt.UpdateStatus, error) {
+	var out apt.UpdateStatus
+	if err := c.do(ctx, "GET", "/api/hosts/"+name+"/apt/updates", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AptUpdate runs apt-get update on host name (POST
+// /api/hosts/{name}/apt/update).
+func (c *Client) AptUpdate(ctx context.Context, name string) error {
+	return c.do(ctx, "POST", "/api/hosts/"+name+"/apt/update", nil, nil, nil)
+}
+
+// AptUpgradeOptions configures an AptUpgrade call.
+type AptUpgradeOptions struct {
+	SecurityOnly   bool
+	ConffilePolicy apt.ConffilePolicy
+}
+
+// AptUpgrade upgrades packages on host name (POST
+// /api/hosts/{name}/apt/upgrade).
+func (c *Client) AptUpgrade(ctx context.Context, name string, opts AptUpgradeOptions) (*apt.UpgradeResult, error) {
+	q := url.Values{}
+	if opts.SecurityOnly {
+		q.Set("security", "true")
+	}
+	if opts.ConffilePolicy != "" {
+		q.Set("conffile", string(opts.ConffilePolicy))
+	}
+	var out apt.UpgradeResult
+	if err := c.do(ctx, "POST", "/api/hosts/"+name+"/apt/upgrade", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AptPackages lists the packages installed on host name (GET
+// /api/hosts/{name}/apt/packages).
+func (c *Client) AptPackages(ctx context.Context, name string) ([]apt.Package, error) {
+	var out struct {
+		Count    int           `json:"count"`
+		Packages []apt.Package `json:"packages"`
+	}
+	if err := c.do(ctx, "GET", "/api/hosts/"+name+"/apt/packages", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Packages, nil
+}
+
+// AptInstallRequest is the body of an AptInstall call: Packages accepts
+// plain names or "name=version" pins; Remove lets packages be removed in
+// the same apt-get transaction.
+type AptInstallRequest struct {
+	Packages     []string `json:"packages"`
+	Remove       []string `json:"remove,omitempty"`
+	NoRecommends bool     `json:"no_recommends,omitempty"`
+}
+
+// AptInstall installs (and optionally removes) packages on host name (POST
+// /api/hosts/{name}/apt/install).
+func (c *Client) AptInstall(ctx context.Context, name string, req AptInstallRequest) (*apt.TransactionResult, error) {
+	var out apt.TransactionResult
+	if err := c.do(ctx, "POST", "/api/hosts/"+name+"/apt/install", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AptRemove removes packages from host name (POST
+// /api/hosts/{name}/apt/remove).
+func (c *Client) AptRemove(ctx context.Context, name string, packages []string) (*apt.TransactionResult, error) {
+	req := struct {
+		Packages []string `json:"packages"`
+	}{Packages: packages}
+	var out apt.TransactionResult
+	if err := c.do(ctx, "POST", "/api/hosts/"+name+"/apt/remove", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AptAutoremove runs apt-get autoremove on host name (POST
+// /api/hosts/{name}/apt/autoremove).
+func (c *Client) AptAutoremove(ctx context.Context, name string) (*apt.TransactionResult, error) {
+	var out apt.TransactionResult
+	if err := c.do(ctx, "POST", "/api/hosts/"+name+"/apt/autoremove", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AptClean runs apt-get clean on host name (POST
+// /api/hosts/{name}/apt/clean).
+func (c *Client) AptClean(ctx context.Context, name string) error {
+	return c.do(ctx, "POST", "/api/hosts/"+name+"/apt/clean", nil, nil, nil)
+}
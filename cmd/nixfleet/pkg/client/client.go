@@ -0,0 +1,187 @@
+// Package client is a Go SDK for the NixFleet server's HTTP API
+// (internal/server). It decodes responses into the shared wire types from
+// pkg/api, so a handler can't add or rename a field without this package
+// (and anyone vendoring it) seeing it at compile time.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/nixfleet/nixfleet/pkg/api"
+)
+
+// Config holds configuration for a Client.
+type Config struct {
+	// BaseURL is the server's address, e.g. "https://fleet.example.com".
+	// Required.
+	BaseURL string
+
+	// Token is sent as "Authorization: Bearer <Token>" on every request, if
+	// set. Must match the server's configured API token.
+	Token string
+
+	// HTTPClient is used to make requests. Defaults to a client with a 30s
+	// timeout if nil.
+	HTTPClient *http.Client
+
+	// MaxRetries is how many times a request is retried on a 429 or 5xx
+	// response before giving up. Defaults to 3.
+	MaxRetries int
+}
+
+// Client is a NixFleet API client.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+	maxRetries int
+}
+
+// New creates a Client from cfg. BaseURL is required; everything else
+// defaults to a reasonable value when left unset.
+func New(cfg Config) (*Client, error) {
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("client: BaseURL is required")
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	maxRetries := cfg.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = 3
+	}
+	return &Client{
+		baseURL:    cfg.BaseURL,
+		token:      cfg.Token,
+		httpClient: httpClient,
+		maxRetries: maxRetries,
+	}, nil
+}
+
+// APIError is returned when the server responds with a non-2xx status. It
+// carries the decoded error message and the HTTP status code, so a caller
+// can distinguish e.g. a 404 "host not found" from a 503 "draining".
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("nixfleet: %s (status %d)", e.Message, e.StatusCode)
+}
+
+// do issues method/path against the server, encoding body as the request
+// body (if non-nil) and decoding the response into out (if non-nil). It
+// retries a 429 or 5xx response up to c.maxRetries times, honoring
+// Retry-After when the server sends one and otherwise backing off
+// exponentially.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var bodyBytes []byte
+	if body != nil {
+		var err error
+		bodyBytes, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("client: encoding request body: %w", err)
+		}
+	}
+
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			wait := backoffDelay(attempt)
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		var reqBody io.Reader
+		if bodyBytes != nil {
+			reqBody = bytes.NewReader(bodyBytes)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+		if err != nil {
+			return fmt.Errorf("client: building request: %w", err)
+		}
+		if bodyBytes != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+			resp.Body.Close()
+			lastErr = &APIError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("server returned %d", resp.StatusCode)}
+			if retryAfter > 0 {
+				select {
+				case <-time.After(retryAfter):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			continue
+		}
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			var errResp api.ErrorResponse
+			if decErr := json.NewDecoder(resp.Body).Decode(&errResp); decErr != nil || errResp.Error == "" {
+				return &APIError{StatusCode: resp.StatusCode, Message: resp.Status}
+			}
+			return &APIError{StatusCode: resp.StatusCode, Message: errResp.Error}
+		}
+
+		if out == nil {
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("client: decoding response: %w", err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("client: giving up after %d attempts: %w", c.maxRetries+1, lastErr)
+}
+
+// backoffDelay returns the exponential backoff delay ahead of retry
+// attempt n (n >= 1): 500ms, 1s, 2s, 4s, ...
+func backoffDelay(n int) time.Duration {
+	return time.Duration(1<<(n-1)) * 500 * time.Millisecond
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds. An empty or
+// unparseable value returns 0, meaning "use the default backoff instead".
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	secs, err := strconv.Atoi(v)
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
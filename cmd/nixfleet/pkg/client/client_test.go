@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestListHosts(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			t.Errorf("expected bearer token, got %q", r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"hosts":[{"name":"web1","addr":"10.0.0.1"}]}`))
+	}))
+	defer ts.Close()
+
+	c, err := New(Config{BaseURL: ts.URL, Token: "test-token"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	hosts, err := c.ListHosts(context.Background())
+	if err != nil {
+		t.Fatalf("ListHosts: %v", err)
+	}
+	if len(hosts) != 1 || hosts[0].Name != "web1" {
+		t.Errorf("unexpected hosts: %+v", hosts)
+	}
+}
+
+func TestDoRetriesOn503ThenSucceeds(t *testing.T) {
+	var attempts atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"job1","type":"apply","status":"completed"}`))
+	}))
+	defer ts.Close()
+
+	c, err := New(Config{BaseURL: ts.URL, MaxRetries: 3})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	job, err := c.GetJob(context.Background(), "job1")
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if job.ID != "job1" || !job.Done() {
+		t.Errorf("unexpected job: %+v", job)
+	}
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+}
+
+func TestDoReturnsAPIErrorOnNotFound(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"host not found"}`))
+	}))
+	defer ts.Close()
+
+	c, err := New(Config{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	_, err = c.GetHost(context.Background(), "nonexistent")
+	var apiErr *APIError
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !asAPIError(err, &apiErr) {
+		t.Fatalf("expected *APIError, got %T: %v", err, err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "host not found" {
+		t.Errorf("unexpected APIError: %+v", apiErr)
+	}
+}
+
+func asAPIError(err error, target **APIError) bool {
+	if ae, ok := err.(*APIError); ok {
+		*target = ae
+		return true
+	}
+	return false
+}
+
+func TestBackoffDelayGrowsExponentially(t *testing.T) {
+	prev := time.Duration(0)
+	for n := 1; n <= 4; n++ {
+		d := backoffDelay(n)
+		if d <= prev {
+			t.Errorf("backoffDelay(%d) = %s did not grow past previous %s", n, d, prev)
+		}
+		prev = d
+	}
+}
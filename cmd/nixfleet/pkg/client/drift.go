@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/nixfleet/nixfleet/pkg/api"
+)
+
+// DriftStatus returns the last known drift status for every host, or for
+// just group if non-empty (GET /api/drift).
+func (c *Client) DriftStatus(ctx context.Context, group string) ([]api.DriftHostStatus, error) {
+	var q url.Values
+	if group != "" {
+		q = url.Values{"group": {group}}
+	}
+	var out []api.DriftHostStatus
+	if err := c.do(ctx, "GET", "/api/drift", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DriftCheck starts an async drift check (POST /api/drift/check). host and
+// group are mutually exclusive; passing both empty checks the whole fleet.
+func (c *Client) DriftCheck(ctx context.Context, host, group string) (*JobHandle, error) {
+	q := url.Values{}
+	if host != "" {
+		q.Set("host", host)
+	}
+	if group != "" {
+		q.Set("group", group)
+	}
+	var job api.Job
+	if err := c.do(ctx, "POST", "/api/drift/check", q, nil, &job); err != nil {
+		return nil, err
+	}
+	return &JobHandle{client: c, job: job}, nil
+}
+
+// DriftFix fixes permissions drift on host, reading its managed files from
+// state and fixing any that have drifted (POST /api/drift/fix).
+func (c *Client) DriftFix(ctx context.Context, host string) (*api.DriftFixResult, error) {
+	q := url.Values{"host": {host}}
+	var out api.DriftFixResult
+	if err := c.do(ctx, "POST", "/api/drift/fix", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+
+	"github.com/nixfleet/nixfleet/internal/state"
+	"github.com/nixfleet/nixfleet/pkg/api"
+)
+
+// ListHosts returns a summary of every host in the fleet (GET /api/hosts).
+func (c *Client) ListHosts(ctx context.Context) ([]api.HostSummary, error) {
+	var out api.HostList
+	if err := c.do(ctx, "GET", "/api/hosts", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Hosts, nil
+}
+
+// GetHost returns the full detail for one host (GET /api/hosts/{name}).
+func (c *Client) GetHost(ctx context.Context, name string) (*api.HostDetail, error) {
+	var out api.HostDetail
+	if err := c.do(ctx, "GET", "/api/hosts/"+name, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetHostState returns a host's persisted state (GET
+// /api/hosts/{name}/state).
+func (c *Client) GetHostState(ctx context.Context, name string) (*state.HostState, error) {
+	var out state.HostState
+	if err := c.do(ctx, "GET", "/api/hosts/"+name+"/state", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Apply triggers a deployment to host name (POST /api/hosts/{name}/apply)
+// and returns a handle for following it to completion.
+func (c *Client) Apply(ctx context.Context, name string) (*JobHandle, error) {
+	var job api.Job
+	if err := c.do(ctx, "POST", "/api/hosts/"+name+"/apply", nil, nil, &job); err != nil {
+		return nil, err
+	}
+	return &JobHandle{client: c, job: job}, nil
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/nixfleet/nixfleet/internal/logging"
+	"github.com/nixfleet/nixfleet/pkg/api"
+)
+
+// JobFilter narrows a ListJobs call. Zero values mean "don't filter on
+// this field". Page is 1-based; PerPage defaults to the server's default
+// (50) when zero.
+type JobFilter struct {
+	Type    string
+	Status  string
+	Host    string
+	Page    int
+	PerPage int
+}
+
+func (f JobFilter) query() url.Values {
+	q := url.Values{}
+	if f.Type != "" {
+		q.Set("type", f.Type)
+	}
+	if f.Status != "" {
+		q.Set("status", f.Status)
+	}
+	if f.Host != "" {
+		q.Set("host", f.Host)
+	}
+	if f.Page > 0 {
+		q.Set("page", strconv.Itoa(f.Page))
+	}
+	if f.PerPage > 0 {
+		q.Set("per_page", strconv.Itoa(f.PerPage))
+	}
+	return q
+}
+
+// ListJobs returns a page of jobs matching filter (GET /api/jobs).
+func (c *Client) ListJobs(ctx context.Context, filter JobFilter) (*api.JobList, error) {
+	var out api.JobList
+	if err := c.do(ctx, "GET", "/api/jobs", filter.query(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetJob returns the current state of job id (GET /api/jobs/{id}).
+func (c *Client) GetJob(ctx context.Context, id string) (*api.Job, error) {
+	var out api.Job
+	if err := c.do(ctx, "GET", "/api/jobs/"+id, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetJobLogs returns the structured log records captured for job id (GET
+// /api/jobs/{id}/logs?format=json).
+func (c *Client) GetJobLogs(ctx context.Context, id string) ([]logging.Record, error) {
+	var out []logging.Record
+	q := url.Values{"format": {"json"}}
+	if err := c.do(ctx, "GET", "/api/jobs/"+id+"/logs", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// JobHandle wraps a Job returned by an endpoint that starts one (Apply,
+// DriftCheck, ...) with helpers to follow it to completion.
+type JobHandle struct {
+	client *Client
+	job    api.Job
+}
+
+// Job returns the most recently observed state of the job.
+func (h *JobHandle) Job() api.Job { return h.job }
+
+// Poll fetches the job's current state once and updates the handle.
+func (h *JobHandle) Poll(ctx context.Context) (*api.Job, error) {
+	job, err := h.client.GetJob(ctx, h.job.ID)
+	if err != nil {
+		return nil, err
+	}
+	h.job = *job
+	return job, nil
+}
+
+// Wait polls the job until it leaves the pending/running states, sleeping
+// interval between polls, and returns its final state. A canceled ctx
+// returns ctx.Err() with the handle left at its last observed state.
+func (h *JobHandle) Wait(ctx context.Context, interval time.Duration) (*api.Job, error) {
+	for {
+		job, err := h.Poll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if job.Done() {
+			return job, nil
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
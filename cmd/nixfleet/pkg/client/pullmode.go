@@ -0,0 +1,29 @@
+package client
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/nixfleet/nixfleet/pkg/api"
+)
+
+// PullModeStatus returns pull-mode install/timer status for every host
+// (GET /api/pull-mode/status).
+func (c *Client) PullModeStatus(ctx context.Context) ([]api.PullModeHostStatus, error) {
+	var out []api.PullModeHostStatus
+	if err := c.do(ctx, "GET", "/api/pull-mode/status", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PullModeTrigger triggers an immediate pull on host name (POST
+// /api/pull-mode/{name}/trigger). ignoreWindow bypasses the host's transfer
+// window gate, mirroring the CLI's --ignore-window.
+func (c *Client) PullModeTrigger(ctx context.Context, name string, ignoreWindow bool) error {
+	var q url.Values
+	if ignoreWindow {
+		q = url.Values{"ignore_window": {"true"}}
+	}
+	return c.do(ctx, "POST", "/api/pull-mode/"+name+"/trigger", q, nil, nil)
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestPkiExitErrorAllValid(t *testing.T) {
+	err := pkiExitError([]pkiCertJSON{{Status: "valid"}, {Status: "renewed"}})
+	if err != nil {
+		t.Fatalf("expected nil error for all-valid rows, got %v", err)
+	}
+}
+
+func TestPkiExitErrorExpiring(t *testing.T) {
+	err := pkiExitError([]pkiCertJSON{{Status: "valid"}, {Status: "expiring"}})
+	exitErr, ok := err.(*cliExitError)
+	if !ok {
+		t.Fatalf("expected a *cliExitError, got %T (%v)", err, err)
+	}
+	if exitErr.code != 8 {
+		t.Errorf("expected exit code 8, got %d", exitErr.code)
+	}
+}
+
+func TestPkiExitErrorExpiredTakesPriority(t *testing.T) {
+	err := pkiExitError([]pkiCertJSON{{Status: "expiring"}, {Status: "expired"}, {Error: "boom"}})
+	exitErr, ok := err.(*cliExitError)
+	if !ok {
+		t.Fatalf("expected a *cliExitError, got %T (%v)", err, err)
+	}
+	if exitErr.code != 9 {
+		t.Errorf("expected exit code 9 (expired beats expiring and read errors), got %d", exitErr.code)
+	}
+}
+
+func TestPkiExitErrorReadFailure(t *testing.T) {
+	err := pkiExitError([]pkiCertJSON{{Status: "valid"}, {Error: "permission denied"}})
+	exitErr, ok := err.(*cliExitError)
+	if !ok {
+		t.Fatalf("expected a *cliExitError, got %T (%v)", err, err)
+	}
+	if exitErr.code != 1 {
+		t.Errorf("expected exit code 1 for an unreadable cert, got %d", exitErr.code)
+	}
+}